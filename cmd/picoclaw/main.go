@@ -10,18 +10,25 @@ import (
 	"bufio"
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/sipeed/picoclaw/pkg/admin"
 	"github.com/sipeed/picoclaw/pkg/agent"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/bus"
@@ -29,14 +36,20 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/dlp"
 	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/migrate"
+	"github.com/sipeed/picoclaw/pkg/outage"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/replay"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/store"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -136,12 +149,18 @@ func main() {
 		gatewayCmd()
 	case "status":
 		statusCmd()
+	case "doctor":
+		doctorCmd()
 	case "migrate":
 		migrateCmd()
 	case "auth":
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "audit":
+		auditCmd()
+	case "replay":
+		replayCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -210,7 +229,10 @@ func printHelp() {
 	fmt.Println("  auth        Manage authentication (login, logout, status)")
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
+	fmt.Println("  doctor      Check config, workspace and the gateway's channel health")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  audit       Show actions taken on your behalf")
+	fmt.Println("  replay      Re-run recorded rounds offline to catch regressions")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
@@ -373,13 +395,17 @@ func migrateHelp() {
 func agentCmd() {
 	message := ""
 	sessionKey := "cli:default"
+	debug := false
+	jsonOutput := false
 
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--debug", "-d":
-			logger.SetLevel(logger.DEBUG)
+			debug = true
 			fmt.Println("🔍 Debug mode enabled")
+		case "--json":
+			jsonOutput = true
 		case "-m", "--message":
 			if i+1 < len(args) {
 				message = args[i+1]
@@ -392,12 +418,17 @@ func agentCmd() {
 			}
 		}
 	}
+	if jsonOutput && message == "" {
+		fmt.Println("Error: --json needs a message (-m)")
+		os.Exit(1)
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	setupLogging(cfg, debug)
 
 	provider, err := providers.CreateProvider(cfg)
 	if err != nil {
@@ -417,7 +448,14 @@ func agentCmd() {
 			"skills_available": startupInfo["skills"].(map[string]interface{})["available"],
 		})
 
-	if message != "" {
+	if jsonOutput {
+		reply := agentLoop.ProcessDirectStructured(context.Background(), message, sessionKey)
+		data, _ := json.MarshalIndent(reply, "", "  ")
+		fmt.Println(string(data))
+		if reply.Error != "" {
+			os.Exit(1)
+		}
+	} else if message != "" {
 		ctx := context.Background()
 		response, err := agentLoop.ProcessDirect(ctx, message, sessionKey)
 		if err != nil {
@@ -519,10 +557,11 @@ func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 
 func gatewayCmd() {
 	// Check for --debug flag
+	debug := false
 	args := os.Args[2:]
 	for _, arg := range args {
 		if arg == "--debug" || arg == "-d" {
-			logger.SetLevel(logger.DEBUG)
+			debug = true
 			fmt.Println("🔍 Debug mode enabled")
 			break
 		}
@@ -533,6 +572,25 @@ func gatewayCmd() {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	setupLogging(cfg, debug)
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err = tracing.Init(tracing.Config{
+			Endpoint:    cfg.Tracing.Endpoint,
+			Headers:     cfg.Tracing.Headers,
+			ServiceName: cfg.Tracing.ServiceName,
+			SampleRatio: cfg.Tracing.SampleRatio,
+		})
+		if err != nil {
+			fmt.Printf("Error enabling tracing: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Tracing to %s\n", cfg.Tracing.Endpoint)
+	}
 
 	provider, err := providers.CreateProvider(cfg)
 	if err != nil {
@@ -571,6 +629,7 @@ func gatewayCmd() {
 		cfg.Heartbeat.Enabled,
 	)
 	heartbeatService.SetBus(msgBus)
+	heartbeatService.SetProfiles(agentLoop.Profiles())
 	heartbeatService.SetHandler(func(prompt, channel, chatID string) *tools.ToolResult {
 		// Use cli:direct as fallback if no valid channel
 		if channel == "" || chatID == "" {
@@ -589,6 +648,14 @@ func gatewayCmd() {
 		return tools.SilentResult(response)
 	})
 
+	// Config changes apply without a restart, from the file watcher or an
+	// owner's /reload config
+	reloader := &configReloader{cfg: cfg, debug: debug, agentLoop: agentLoop, heartbeat: heartbeatService}
+	agentLoop.SetConfigReloader(reloader.Reload)
+	settings := tools.NewSettingsTool(reloader, agentLoop.Profiles())
+	settings.SetOwnerCheck(agentLoop.IsOwner)
+	agentLoop.RegisterTool(settings)
+
 	channelManager, err := channels.NewManager(cfg, msgBus)
 	if err != nil {
 		fmt.Printf("Error creating channel manager: %v\n", err)
@@ -597,10 +664,34 @@ func gatewayCmd() {
 
 	// Inject channel manager into agent loop for command handling
 	agentLoop.SetChannelManager(channelManager)
+	channelManager.SetArtifacts(agentLoop.Artifacts())
+
+	if waChannel, ok := channelManager.GetChannel("whatsapp"); ok {
+		if wc, ok := waChannel.(*channels.WhatsAppChannel); ok {
+			groups := tools.NewWhatsAppGroupsTool(wc)
+			if contacts := agentLoop.Contacts(); contacts != nil {
+				groups.SetContacts(contacts)
+			}
+			agentLoop.RegisterTool(groups)
+
+			broadcast := tools.NewWhatsAppBroadcastTool(wc)
+			broadcast.SetOwnerCheck(agentLoop.IsOwner)
+			agentLoop.RegisterTool(broadcast)
+		}
+	}
+
+	if cfg.Channels.Telegram.InlineQueries {
+		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
+			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
+				tc.SetInlineHandler(agentLoop.AnswerInline)
+			}
+		}
+	}
 
 	var transcriber *voice.GroqTranscriber
 	if cfg.Providers.Groq.APIKey != "" {
 		transcriber = voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
+		transcriber.SetLocalOnly(agentLoop.LocalOnly)
 		logger.InfoC("voice", "Groq voice transcription enabled")
 	}
 
@@ -625,6 +716,28 @@ func gatewayCmd() {
 		}
 	}
 
+	if cfg.Providers.OpenAI.APIKey != "" {
+		synthesizer := voice.NewSpeechSynthesizer(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase,
+			cfg.Voice.TTSModel, cfg.Voice.TTSVoice)
+		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
+			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
+				tc.SetSynthesizer(synthesizer)
+				logger.InfoC("voice", "Voice replies available on Telegram (/voice on)")
+			}
+		}
+	}
+
+	if engine := agentLoop.OCR(); engine != nil {
+		if !engine.IsAvailable() {
+			logger.WarnC("ocr", "OCR enabled but tesseract is not installed and no Google Vision key is set; photos will not be read")
+		} else if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
+			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
+				tc.SetOCR(engine)
+				logger.InfoC("ocr", "Photo text recognition attached to Telegram channel")
+			}
+		}
+	}
+
 	enabledChannels := channelManager.GetEnabledChannels()
 	if len(enabledChannels) > 0 {
 		fmt.Printf("✓ Channels enabled: %s\n", enabledChannels)
@@ -654,6 +767,7 @@ func gatewayCmd() {
 		MonitorUSB: cfg.Devices.MonitorUSB,
 	}, stateManager)
 	deviceService.SetBus(msgBus)
+	deviceService.SetProfiles(agentLoop.Profiles())
 	if err := deviceService.Start(ctx); err != nil {
 		fmt.Printf("Error starting device service: %v\n", err)
 	} else if cfg.Devices.Enabled {
@@ -663,10 +777,55 @@ func gatewayCmd() {
 	// Create the gateway HTTP server first so channels can register webhooks on it
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
 	channelManager.RegisterWebhooks(healthServer.Mux())
+	if cfg.Gateway.Metrics {
+		metrics.NewGaugeFunc("picoclaw_inbound_queue_depth", "Messages waiting for the agent.", func() float64 {
+			in, _ := msgBus.QueueDepths()
+			return float64(in)
+		})
+		metrics.NewGaugeFunc("picoclaw_outbound_queue_depth", "Replies waiting to be sent.", func() float64 {
+			_, out := msgBus.QueueDepths()
+			return float64(out)
+		})
+		healthServer.Mux().Handle("/metrics", metrics.Handler())
+	}
+	healthServer.Mux().HandleFunc("/health/channels", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(channelManager.Health())
+	})
+	if cfg.Gateway.Events.Enabled {
+		healthServer.Mux().HandleFunc("/events", agentLoop.HandleEvent)
+		fmt.Printf("✓ Events accepted on /events from %d source(s)\n", len(cfg.Gateway.Events.Sources))
+	}
+	if cfg.Gateway.Admin.Enabled {
+		if cfg.Gateway.Admin.Password == "" {
+			logger.WarnC("admin", "Admin dashboard enabled without gateway.admin.password; not serving it")
+		} else {
+			feed := admin.NewFeed(500)
+			msgBus.Observe(feed.Inbound, feed.Outbound)
+			agentLoop.ObserveTools(feed.ToolCall)
+			dashboard := admin.NewServer(cfg.Gateway.Admin.Password, feed)
+			dashboard.SetAgent(agentLoop)
+			dashboard.SetJobs(func() []cron.CronJob { return cronService.ListJobs(true) })
+			dashboard.SetStatus(func() map[string]interface{} { return adminStatus(cfg, channelManager, msgBus) })
+			dashboard.SetConfig(cfg)
+			reloader.OnReload(func(next *config.Config) { dashboard.SetConfig(next) })
+			dashboard.Register(healthServer.Mux())
+			fmt.Printf("✓ Admin dashboard on http://%s:%d/admin/\n", cfg.Gateway.Host, cfg.Gateway.Port)
+		}
+	}
 
 	if err := channelManager.StartAll(ctx); err != nil {
 		fmt.Printf("Error starting channels: %v\n", err)
 	}
+	if w := cfg.Gateway.Watchdog; w.Enabled {
+		channelManager.StartWatchdog(ctx, channels.WatchdogOptions{
+			Interval:   time.Duration(w.CheckSeconds) * time.Second,
+			MaxBackoff: time.Duration(w.MaxBackoffSeconds) * time.Second,
+			AlertAfter: w.AlertAfter,
+			Owners:     cfg.Owners,
+		})
+		fmt.Println("✓ Channel watchdog started")
+	}
 
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
@@ -676,22 +835,258 @@ func gatewayCmd() {
 	fmt.Printf("✓ Gateway listening on http://%s:%d (health, webhooks)\n", cfg.Gateway.Host, cfg.Gateway.Port)
 
 	go agentLoop.Run(ctx)
+	go agentLoop.ResumeQueued(ctx)
+	agentLoop.ResumeTasks()
+
+	if cfg.Gateway.WatchConfig {
+		go config.Watch(ctx, getConfigPath(), 2*time.Second, func() {
+			summary, err := reloader.Reload()
+			if err != nil {
+				logger.ErrorCF("config", "Config change refused, keeping the current config", map[string]interface{}{"error": err.Error()})
+				return
+			}
+			logger.InfoCF("config", "Config reloaded from file", map[string]interface{}{"summary": summary})
+		})
+	}
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
+	shutdownGateway(ctx, cfg, gatewayParts{
+		health:    healthServer,
+		devices:   deviceService,
+		heartbeat: heartbeatService,
+		cron:      cronService,
+		agent:     agentLoop,
+		channels:  channelManager,
+		bus:       msgBus,
+	})
 	cancel()
-	healthServer.Stop(context.Background())
-	deviceService.Stop()
-	heartbeatService.Stop()
-	cronService.Stop()
-	agentLoop.Stop()
-	channelManager.StopAll(ctx)
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownTracing(flushCtx)
+	flushCancel()
 	fmt.Println("✓ Gateway stopped")
 }
 
+// gatewayParts are the services shutdownGateway stops.
+type gatewayParts struct {
+	health    *health.Server
+	devices   *devices.Service
+	heartbeat *heartbeat.HeartbeatService
+	cron      *cron.CronService
+	agent     *agent.AgentLoop
+	channels  *channels.Manager
+	bus       *bus.MessageBus
+}
+
+// shutdownGateway stops taking new work, lets running jobs and the round
+// in progress finish within gateway.shutdown_timeout_seconds, gives queued
+// replies a moment to go out, and journals whatever is left for the next
+// start. A second signal skips the wait.
+func shutdownGateway(ctx context.Context, cfg *config.Config, p gatewayParts) {
+	timeout := time.Duration(cfg.Gateway.ShutdownTimeoutSeconds) * time.Second
+	drainCtx, drainCancel := context.WithTimeout(ctx, timeout)
+	defer drainCancel()
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+		select {
+		case <-sig:
+			fmt.Println("Stopping now")
+			drainCancel()
+		case <-drainCtx.Done():
+		}
+	}()
+
+	p.health.Stop(context.Background())
+	p.devices.Stop()
+	p.heartbeat.Stop()
+	cronDone := make(chan error, 1)
+	go func() { cronDone <- p.cron.Shutdown(drainCtx) }()
+	if err := p.agent.Shutdown(drainCtx); err != nil {
+		logger.WarnC("gateway", "Message round still running at shutdown; it will be redone on restart")
+	}
+	if err := <-cronDone; err != nil {
+		logger.WarnC("gateway", "Scheduled jobs still running at shutdown; they will run again on restart")
+	}
+
+	// Give the dispatcher a moment to send replies already queued
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline) && drainCtx.Err() == nil; {
+		if _, out := p.bus.QueueDepths(); out == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	p.channels.StopAll(context.Background())
+
+	persistCtx, persistCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer persistCancel()
+	if in, out := p.agent.PersistQueued(persistCtx); in+out > 0 {
+		fmt.Printf("✓ Saved %d queued messages and %d unsent replies for the next start\n", in, out)
+	}
+}
+
+// adminStatus reports model, channels, service outages, providers and
+// stored credentials for the admin dashboard.
+func adminStatus(cfg *config.Config, channelManager *channels.Manager, msgBus *bus.MessageBus) map[string]interface{} {
+	configured := []string{}
+	var byName map[string]config.ProviderConfig
+	if data, err := json.Marshal(cfg.Providers); err == nil && json.Unmarshal(data, &byName) == nil {
+		for name, p := range byName {
+			if p.APIKey != "" || p.APIBase != "" || p.AuthMethod != "" {
+				configured = append(configured, name)
+			}
+		}
+	}
+
+	credentials := map[string]string{}
+	if store, _ := auth.LoadStore(); store != nil {
+		for provider, cred := range store.Credentials {
+			status := "authenticated"
+			if cred.IsExpired() {
+				status = "expired"
+			} else if cred.NeedsRefresh() {
+				status = "needs refresh"
+			}
+			credentials[provider] = fmt.Sprintf("%s (%s)", status, cred.AuthMethod)
+		}
+	}
+
+	inbound, outbound := msgBus.QueueDepths()
+	return map[string]interface{}{
+		"version":        formatVersion(),
+		"model":          cfg.Agents.Defaults.Model,
+		"channels":       channelManager.GetEnabledChannels(),
+		"channel_health": channelManager.Health(),
+		"services":       outage.Default().Statuses(),
+		"providers":      configured,
+		"auth":           credentials,
+		"inbound_queue":  inbound,
+		"outbound_queue": outbound,
+	}
+}
+
+// restartOnlyPrefixes are config paths read once at startup; changes to
+// them are reported but need a restart.
+var restartOnlyPrefixes = []string{
+	"channels.", "gateway.", "providers.", "tracing.", "devices.", "voice.", "ocr.",
+	"agents.defaults.workspace", "agents.defaults.provider",
+}
+
+// configReloader re-reads the config file, refuses it if invalid, and
+// applies what can change while running: logging, owners, model, tools
+// and their settings, scheduled job wiring and the heartbeat schedule.
+type configReloader struct {
+	mu        sync.Mutex
+	cfg       *config.Config
+	debug     bool
+	agentLoop *agent.AgentLoop
+	heartbeat *heartbeat.HeartbeatService
+	onReload  []func(*config.Config)
+}
+
+// OnReload registers fn to receive each applied config.
+func (r *configReloader) OnReload(fn func(*config.Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+// Reload applies the config file and returns a summary of the changes.
+func (r *configReloader) Reload() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if err := next.Validate(); err != nil {
+		return "", err
+	}
+	changes := config.Diff(r.cfg, next)
+	if len(changes) == 0 {
+		return "Config unchanged.", nil
+	}
+
+	setupLogging(next, r.debug)
+	toolCount := r.agentLoop.ApplyConfig(next)
+	r.heartbeat.Reconfigure(next.Heartbeat.Interval, next.Heartbeat.Enabled)
+	r.cfg = next
+	for _, fn := range r.onReload {
+		fn(next)
+	}
+
+	var sb strings.Builder
+	var pending []string
+	fmt.Fprintf(&sb, "Config reloaded (%d tools loaded):", toolCount)
+	for _, change := range changes {
+		fmt.Fprintf(&sb, "\n- %s", change)
+		for _, prefix := range restartOnlyPrefixes {
+			if strings.HasPrefix(change, prefix) {
+				pending = append(pending, strings.SplitN(change, ":", 2)[0])
+				break
+			}
+		}
+	}
+	if len(pending) > 0 {
+		fmt.Fprintf(&sb, "\nNeeds a restart to take effect: %s", strings.Join(pending, ", "))
+	}
+	return sb.String(), nil
+}
+
+// Settings lists the config values the settings tool may change.
+func (r *configReloader) Settings() []tools.SettingInfo {
+	r.mu.Lock()
+	cfg := r.cfg
+	r.mu.Unlock()
+	settings := make([]tools.SettingInfo, 0, len(config.EditableSettings))
+	for _, s := range config.EditableSettings {
+		settings = append(settings, tools.SettingInfo{Key: s.Key, Description: s.Description, Value: s.Value(cfg)})
+	}
+	return settings
+}
+
+// ChangeSetting writes one setting to the config file and reloads it, so
+// the change applies as a file edit would.
+func (r *configReloader) ChangeSetting(key, value string) (string, error) {
+	setting, ok := config.LookupSetting(key)
+	if !ok {
+		return "", fmt.Errorf("%s cannot be changed from chat; list shows the settings that can", key)
+	}
+	parsed, err := setting.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	old := setting.Value(r.cfg)
+	r.mu.Unlock()
+
+	edited, err := config.EditFile(getConfigPath(), setting.Key, parsed)
+	if err != nil {
+		return "", err
+	}
+	summary, err := r.Reload()
+	if err != nil {
+		return "", fmt.Errorf("saved but not applied: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s -> %s", setting.Key, old, config.FormatSetting(parsed))
+	if got := setting.Value(edited); got != config.FormatSetting(parsed) {
+		fmt.Fprintf(&sb, "\nAn environment variable overrides it, so %s stays in effect until it is unset.", got)
+	}
+	// The file watcher may have applied the edit first
+	if summary != "Config unchanged." {
+		fmt.Fprintf(&sb, "\n%s", summary)
+	}
+	logger.InfoCF("config", "Setting changed from chat", map[string]interface{}{"key": setting.Key})
+	return sb.String(), nil
+}
+
 func statusCmd() {
 	cfg, err := loadConfig()
 	if err != nil {
@@ -767,6 +1162,86 @@ func statusCmd() {
 	}
 }
 
+// doctorCmd checks the config and workspace, then asks a running gateway
+// how its channels are doing. It exits non-zero when something is wrong.
+func doctorCmd() {
+	problems := 0
+	report := func(ok bool, what, detail string) {
+		mark := "✓"
+		if !ok {
+			mark = "✗"
+			problems++
+		}
+		if detail != "" {
+			fmt.Printf("%s %s: %s\n", mark, what, detail)
+		} else {
+			fmt.Printf("%s %s\n", mark, what)
+		}
+	}
+
+	fmt.Printf("%s picoclaw doctor\n\n", logo)
+	cfg, err := loadConfig()
+	if err != nil {
+		report(false, "Config", err.Error())
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		report(false, "Config", err.Error())
+	} else {
+		report(true, "Config", getConfigPath())
+	}
+
+	workspace := cfg.WorkspacePath()
+	probe := filepath.Join(workspace, ".doctor")
+	if err := os.WriteFile(probe, []byte("ok"), 0o600); err != nil {
+		report(false, "Workspace", err.Error())
+	} else {
+		os.Remove(probe)
+		report(true, "Workspace", workspace)
+	}
+
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := fmt.Sprintf("http://%s/health/channels", net.JoinHostPort(host, strconv.Itoa(cfg.Gateway.Port)))
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		report(false, "Gateway", "not reachable ("+err.Error()+")")
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	var health []channels.ChannelHealth
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&health) != nil {
+		report(false, "Gateway", fmt.Sprintf("unexpected answer from %s (HTTP %d)", url, resp.StatusCode))
+		os.Exit(1)
+	}
+	report(true, "Gateway", url)
+	if len(health) == 0 {
+		report(false, "Channels", "none enabled")
+	}
+	for _, h := range health {
+		detail := h.State
+		if h.Failures > 0 {
+			detail += fmt.Sprintf(", %d failed checks", h.Failures)
+		}
+		if h.Reconnects > 0 {
+			detail += fmt.Sprintf(", %d reconnects", h.Reconnects)
+		}
+		if h.LastError != "" {
+			detail += ", last error: " + h.LastError
+		}
+		report(h.State == channels.ChannelOK, "Channel "+h.Name, detail)
+	}
+
+	if problems > 0 {
+		fmt.Printf("\n%d problem(s) found\n", problems)
+		os.Exit(1)
+	}
+	fmt.Println("\nEverything looks fine")
+}
+
 func authCmd() {
 	if len(os.Args) < 3 {
 		authHelp()
@@ -793,13 +1268,16 @@ func authHelp() {
 	fmt.Println("  status      Show current auth status")
 	fmt.Println()
 	fmt.Println("Login options:")
-	fmt.Println("  --provider <name>    Provider to login with (openai, anthropic)")
+	fmt.Println("  --provider <name>    Provider to login with (openai, anthropic, google)")
 	fmt.Println("  --device-code        Use device code flow (for headless environments)")
+	fmt.Println("  --scopes <preset>    Google access to ask for (read-only, standard, full)")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  picoclaw auth login --provider openai")
 	fmt.Println("  picoclaw auth login --provider openai --device-code")
 	fmt.Println("  picoclaw auth login --provider anthropic")
+	fmt.Println("  picoclaw auth login --provider google")
+	fmt.Println("  picoclaw auth login --provider google --scopes read-only")
 	fmt.Println("  picoclaw auth logout --provider openai")
 	fmt.Println("  picoclaw auth status")
 }
@@ -807,6 +1285,7 @@ func authHelp() {
 func authLoginCmd() {
 	provider := ""
 	useDeviceCode := false
+	scopes := ""
 
 	args := os.Args[3:]
 	for i := 0; i < len(args); i++ {
@@ -818,12 +1297,17 @@ func authLoginCmd() {
 			}
 		case "--device-code":
 			useDeviceCode = true
+		case "--scopes":
+			if i+1 < len(args) {
+				scopes = args[i+1]
+				i++
+			}
 		}
 	}
 
 	if provider == "" {
 		fmt.Println("Error: --provider is required")
-		fmt.Println("Supported providers: openai, anthropic")
+		fmt.Println("Supported providers: openai, anthropic, google")
 		return
 	}
 
@@ -832,10 +1316,55 @@ func authLoginCmd() {
 		authLoginOpenAI(useDeviceCode)
 	case "anthropic":
 		authLoginPasteToken(provider)
+	case "google":
+		authLoginGoogle(scopes)
 	default:
 		fmt.Printf("Unsupported provider: %s\n", provider)
-		fmt.Println("Supported providers: openai, anthropic")
+		fmt.Println("Supported providers: openai, anthropic, google")
+	}
+}
+
+// authLoginGoogle logs in to Google; a scope preset other than "" replaces
+// google.scopes in the config first.
+func authLoginGoogle(preset string) {
+	appCfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if appCfg.Google.ClientID == "" {
+		fmt.Println("Error: google.client_id is not set in config")
+		fmt.Println("Create an OAuth client (Desktop app) in Google Cloud Console and set google.client_id / google.client_secret")
+		os.Exit(1)
+	}
+	if preset != "" {
+		scopes, ok := config.GoogleScopePresets[preset]
+		if !ok {
+			fmt.Printf("Unknown scope preset: %s\n", preset)
+			fmt.Println("Presets: read-only, standard, full")
+			os.Exit(1)
+		}
+		appCfg.Google.Scopes = config.FlexibleStringSlice(append([]string(nil), scopes...))
+		if err := config.SaveConfig(getConfigPath(), appCfg); err != nil {
+			fmt.Printf("Error saving config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	cfg := auth.NewGoogleOAuthConfig(appCfg.Google.ClientID, appCfg.Google.ClientSecret, appCfg.Google.Scopes)
+	cred, err := auth.LoginGoogle(cfg)
+	if err != nil {
+		fmt.Printf("Login failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := auth.SetCredential(auth.GoogleProvider, cred); err != nil {
+		fmt.Printf("Failed to save credentials: %v\n", err)
+		os.Exit(1)
 	}
+
+	fmt.Println("Google login successful!")
+	fmt.Printf("Granted scopes: %s\n", strings.Join(appCfg.Google.Scopes, ", "))
 }
 
 func authLoginOpenAI(useDeviceCode bool) {
@@ -999,11 +1528,29 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 
 	// Create and register CronTool
 	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace, restrict, execTimeout)
+	cronTool.SetProfiles(agentLoop.Profiles())
+	cronTool.SetDigest(agentLoop.Digest())
 	agentLoop.RegisterTool(cronTool)
 
+	// Let tools that own job kinds (price alerts, etc.) schedule through the
+	// same service, again whenever the tools are rebuilt
+	wireScheduledTools := func() {
+		for _, st := range agentLoop.ScheduledTools() {
+			st.SetScheduler(cronService)
+			for _, kind := range st.JobKinds() {
+				cronTool.RegisterJobHandler(kind, st.ExecuteJob)
+			}
+		}
+	}
+	wireScheduledTools()
+	agentLoop.OnToolsReloaded(wireScheduledTools)
+
 	// Set the onJob handler
 	cronService.SetOnJob(func(job *cron.CronJob) (string, error) {
-		result := cronTool.ExecuteJob(context.Background(), job)
+		// Jobs run outside agent rounds; uploads they make still go
+		// through the content policy
+		ctx := dlp.WithGuard(context.Background(), agentLoop.ContentGuard())
+		result := cronTool.ExecuteJob(ctx, job)
 		return result, nil
 	})
 
@@ -1014,6 +1561,55 @@ func loadConfig() (*config.Config, error) {
 	return config.LoadConfig(getConfigPath())
 }
 
+// setupLogging applies the logging section of the config. --debug wins
+// over the configured level.
+func setupLogging(cfg *config.Config, debug bool) {
+	if level, err := logger.ParseLevel(cfg.Logging.Level); err == nil {
+		logger.SetLevel(level)
+	} else if cfg.Logging.Level != "" {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if debug {
+		logger.SetLevel(logger.DEBUG)
+	}
+	for component, name := range cfg.Logging.Components {
+		level, err := logger.ParseLevel(name)
+		if err != nil {
+			fmt.Printf("Warning: logging.components.%s: %v\n", component, err)
+			continue
+		}
+		logger.SetComponentLevel(component, level)
+	}
+	policy := logger.RedactPolicy{
+		Secrets: cfg.Logging.Redact.Secrets,
+		Emails:  cfg.Logging.Redact.Emails,
+		Content: cfg.Logging.Redact.Content,
+		Fields:  cfg.Logging.Redact.Fields,
+	}
+	for _, expr := range cfg.Logging.Redact.Patterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			fmt.Printf("Warning: logging.redact.patterns: %v\n", err)
+			continue
+		}
+		policy.Patterns = append(policy.Patterns, re)
+	}
+	logger.SetRedaction(policy)
+	if strings.EqualFold(cfg.Logging.Format, string(logger.FormatJSON)) {
+		logger.SetFormat(logger.FormatJSON)
+	}
+	if path := cfg.LogFilePath(); path != "" {
+		opts := logger.RotateOptions{
+			MaxSize:    int64(cfg.Logging.MaxSizeMB) << 20,
+			MaxAge:     time.Duration(cfg.Logging.MaxAgeDays) * 24 * time.Hour,
+			MaxBackups: cfg.Logging.MaxBackups,
+		}
+		if err := logger.EnableRotatingFileLogging(path, opts); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+}
+
 func cronCmd() {
 	if len(os.Args) < 3 {
 		cronHelp()
@@ -1052,6 +1648,163 @@ func cronCmd() {
 	}
 }
 
+func auditCmd() {
+	var filter store.AuditFilter
+	since := ""
+	filter.Limit = 50
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			auditHelp()
+			return
+		}
+		switch args[i] {
+		case "--since":
+			since = args[i+1]
+		case "--tool":
+			filter.Tool = args[i+1]
+		case "--query", "-q":
+			filter.Text = args[i+1]
+		case "--sender":
+			filter.Sender = args[i+1]
+		case "--limit", "-n":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				fmt.Printf("Invalid limit: %s\n", args[i+1])
+				return
+			}
+			filter.Limit = n
+		default:
+			auditHelp()
+			return
+		}
+		i++
+	}
+	from, err := tools.ParseAuditSince(since, time.Now())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	filter.Since = from
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	db := store.Open(store.WorkspacePath(cfg.WorkspacePath()))
+	entries, err := db.Audit.Query(context.Background(), filter)
+	if err != nil {
+		fmt.Printf("Error reading the audit log: %v\n", err)
+		return
+	}
+	fmt.Println(tools.FormatAuditEntries(entries, time.Local))
+}
+
+// replayCmd re-runs rounds recorded with debug.record_rounds, with the
+// model's answers and the tools' HTTP responses taken from the recording,
+// and reports where picoclaw now behaves differently.
+func replayCmd() {
+	var paths []string
+	verbose := false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--verbose", "-v":
+			verbose = true
+		case "--help", "-h":
+			replayHelp()
+			return
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		replayHelp()
+		os.Exit(1)
+	}
+
+	var files []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			matches, _ := filepath.Glob(filepath.Join(path, "*.json"))
+			files = append(files, matches...)
+		} else {
+			files = append(files, path)
+		}
+	}
+
+	failed := 0
+	for _, file := range files {
+		diffs, err := replayRound(file, verbose)
+		switch {
+		case err != nil:
+			fmt.Printf("ERROR %s: %v\n", file, err)
+			failed++
+		case len(diffs) > 0:
+			fmt.Printf("FAIL  %s\n", file)
+			for _, d := range diffs {
+				fmt.Printf("      %s\n", strings.ReplaceAll(d, "\n", "\n      "))
+			}
+			failed++
+		default:
+			fmt.Printf("ok    %s\n", file)
+		}
+	}
+	fmt.Printf("\n%d of %d rounds replayed as recorded\n", len(files)-failed, len(files))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// replayRound replays one recording in a throwaway workspace, so the
+// user's sessions and state are left alone.
+func replayRound(file string, verbose bool) ([]string, error) {
+	round, err := replay.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	setupLogging(cfg, verbose)
+	if !verbose {
+		// Failing tool calls log errors, which the diff already shows
+		logger.SetLevel(logger.FATAL)
+	}
+	workspace, err := os.MkdirTemp("", "picoclaw-replay-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workspace)
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Debug.RecordHTTP = false
+	cfg.Debug.RecordRounds = false
+
+	al := agent.NewAgentLoop(cfg, bus.NewMessageBus(), replay.NewProvider(round))
+	return replay.Compare(round, al.Replay(context.Background(), round)), nil
+}
+
+func replayHelp() {
+	fmt.Println("\nUsage: picoclaw replay [options] <round.json|dir>...")
+	fmt.Println()
+	fmt.Println("Rounds are recorded to debug/rounds in the workspace with debug.record_rounds.")
+	fmt.Println("Tools run for real, in a temporary workspace; the model and HTTP responses")
+	fmt.Println("come from the recording.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -v, --verbose   Show the agent's logs")
+}
+
+func auditHelp() {
+	fmt.Println("\nAudit options:")
+	fmt.Println("  --since <when>    today, yesterday, 7d, 12h or a date (default 7d)")
+	fmt.Println("  --tool <name>     Only actions by this tool")
+	fmt.Println("  -q, --query <t>   Only actions mentioning this text")
+	fmt.Println("  --sender <id>     Only actions asked for by this user")
+	fmt.Println("  -n, --limit <n>   Maximum entries (default 50)")
+}
+
 func cronHelp() {
 	fmt.Println("\nCron commands:")
 	fmt.Println("  list              List all scheduled jobs")
@@ -0,0 +1,290 @@
+// Package admin serves a small web dashboard on the gateway: live
+// conversations, recent tool calls, auth and provider status, scheduled
+// jobs and the running config, with controls to pause the agent and
+// cancel running tasks. Everything under /admin/ sits behind HTTP basic
+// auth with a configured password.
+package admin
+
+import (
+	"bytes"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+//go:embed ui.html
+var indexHTML []byte
+
+// attachmentThumbSize bounds the longer side of image thumbnails in the
+// conversation feed.
+const attachmentThumbSize = 240
+
+// Task is a unit of agent work that can be cancelled: the message being
+// processed or a background subagent.
+type Task struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	Channel     string    `json:"channel,omitempty"`
+	ChatID      string    `json:"chat_id,omitempty"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	Started     time.Time `json:"started"`
+}
+
+// AgentControl is what the dashboard needs from the agent loop.
+type AgentControl interface {
+	Paused() bool
+	SetPaused(paused bool)
+	Tasks() []Task
+	CancelTask(id string) bool
+}
+
+// Server handles the dashboard and its JSON API.
+type Server struct {
+	password string
+	feed     *Feed
+	started  time.Time
+
+	mu     sync.RWMutex
+	agent  AgentControl
+	jobs   func() []cron.CronJob
+	status func() map[string]interface{}
+	config interface{}
+}
+
+// NewServer returns a dashboard protected by password, showing feed.
+func NewServer(password string, feed *Feed) *Server {
+	return &Server{password: password, feed: feed, started: time.Now()}
+}
+
+// SetAgent attaches the agent loop for status, pause and cancel.
+func (s *Server) SetAgent(agent AgentControl) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agent = agent
+}
+
+// SetJobs sets the function listing scheduled jobs.
+func (s *Server) SetJobs(fn func() []cron.CronJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = fn
+}
+
+// SetStatus sets the function reporting auth, provider and channel status.
+func (s *Server) SetStatus(fn func() map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = fn
+}
+
+// SetConfig sets the config shown on the dashboard. Secret-looking values
+// are masked when served.
+func (s *Server) SetConfig(cfg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = cfg
+}
+
+// Register mounts the dashboard under /admin/ on mux.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.Handle("/admin/", s.Handler())
+}
+
+// Handler returns the authenticated handler for /admin/.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/{$}", s.handleIndex)
+	mux.HandleFunc("GET /admin/api/status", s.handleStatus)
+	mux.HandleFunc("GET /admin/api/events", s.handleEvents)
+	mux.HandleFunc("GET /admin/api/events/{seq}/attachments/{n}", s.handleAttachment)
+	mux.HandleFunc("GET /admin/api/tasks", s.handleTasks)
+	mux.HandleFunc("GET /admin/api/jobs", s.handleJobs)
+	mux.HandleFunc("GET /admin/api/config", s.handleConfig)
+	mux.HandleFunc("POST /admin/api/pause", s.handlePause(true))
+	mux.HandleFunc("POST /admin/api/resume", s.handlePause(false))
+	mux.HandleFunc("POST /admin/api/tasks/{id}/cancel", s.handleCancel)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, ok := r.BasicAuth()
+		if s.password == "" || !ok || subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="picoclaw admin", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Browsers resend basic auth on cross-site form posts; a custom
+		// header cannot be set without a CORS preflight, which we never allow
+		if r.Method != http.MethodGet && r.Header.Get("X-Picoclaw-Admin") == "" {
+			http.Error(w, "missing X-Picoclaw-Admin header", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	agent, status := s.agent, s.status
+	s.mu.RUnlock()
+
+	out := map[string]interface{}{}
+	if status != nil {
+		for k, v := range status() {
+			out[k] = v
+		}
+	}
+	out["uptime"] = time.Since(s.started).Round(time.Second).String()
+	if agent != nil {
+		out["paused"] = agent.Paused()
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	writeJSON(w, http.StatusOK, s.feed.Since(after))
+}
+
+// handleAttachment serves a thumbnail of an image sent or received in a
+// message still in the feed. Only files the feed recorded can be asked
+// for, and only as a thumbnail.
+func (s *Server) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	seq, _ := strconv.ParseInt(r.PathValue("seq"), 10, 64)
+	n, _ := strconv.Atoi(r.PathValue("n"))
+	path, ok := s.feed.Attachment(seq, n)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	img, err := imaging.Open(path)
+	if err != nil {
+		http.Error(w, "not an image that can be shown", http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, imaging.Thumbnail(img, attachmentThumbSize), imaging.ThumbnailQuality); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	agent := s.agent
+	s.mu.RUnlock()
+	tasks := []Task{}
+	if agent != nil {
+		tasks = append(tasks, agent.Tasks()...)
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	jobs := s.jobs
+	s.mu.RUnlock()
+	list := []cron.CronJob{}
+	if jobs != nil {
+		list = append(list, jobs()...)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	cfg := s.config
+	s.mu.RUnlock()
+	if cfg == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, maskSecrets("", generic))
+}
+
+func (s *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		agent := s.agent
+		s.mu.RUnlock()
+		if agent == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "agent not attached"})
+			return
+		}
+		agent.SetPaused(paused)
+		logger.InfoCF("admin", "Agent pause changed from dashboard", map[string]interface{}{"paused": paused})
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": paused})
+	}
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	agent := s.agent
+	s.mu.RUnlock()
+	id := r.PathValue("id")
+	if agent == nil || !agent.CancelTask(id) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no running task " + id})
+		return
+	}
+	logger.InfoCF("admin", "Task cancelled from dashboard", map[string]interface{}{"task": id})
+	writeJSON(w, http.StatusOK, map[string]string{"cancelled": id})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// maskSecrets replaces non-empty string values under keys that name a
+// secret, by the same rule the logs are redacted by.
+func maskSecrets(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			val[k] = maskSecrets(k, child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = maskSecrets(key, child)
+		}
+		return val
+	case string:
+		if val != "" && logger.IsSecretName(key) {
+			return "********"
+		}
+		return val
+	default:
+		return val
+	}
+}
@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type fakeAgent struct {
+	paused    bool
+	cancelled []string
+}
+
+func (a *fakeAgent) Paused() bool          { return a.paused }
+func (a *fakeAgent) SetPaused(paused bool) { a.paused = paused }
+func (a *fakeAgent) Tasks() []Task {
+	return []Task{{ID: "message-1", Kind: "message", Status: "running"}}
+}
+func (a *fakeAgent) CancelTask(id string) bool {
+	if id != "message-1" {
+		return false
+	}
+	a.cancelled = append(a.cancelled, id)
+	return true
+}
+
+func do(t *testing.T, h http.Handler, method, path, password string, header bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if password != "" {
+		req.SetBasicAuth("admin", password)
+	}
+	if header {
+		req.Header.Set("X-Picoclaw-Admin", "1")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestServer_RequiresAuth verifies every route needs the password and writes need the admin header
+func TestServer_RequiresAuth(t *testing.T) {
+	h := NewServer("hunter2", NewFeed(10)).Handler()
+
+	for _, password := range []string{"", "wrong"} {
+		if rec := do(t, h, "GET", "/admin/", password, false); rec.Code != http.StatusUnauthorized {
+			t.Errorf("password %q: status %d, want 401", password, rec.Code)
+		}
+	}
+	if rec := do(t, h, "GET", "/admin/", "hunter2", false); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "picoclaw admin") {
+		t.Errorf("index: status %d", rec.Code)
+	}
+	if rec := do(t, h, "POST", "/admin/api/pause", "hunter2", false); rec.Code != http.StatusForbidden {
+		t.Errorf("post without header: status %d, want 403", rec.Code)
+	}
+	if rec := do(t, NewServer("", NewFeed(10)).Handler(), "GET", "/admin/", "", false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("empty password must never authenticate, got %d", rec.Code)
+	}
+}
+
+// TestServer_PauseAndCancel verifies the controls reach the agent
+func TestServer_PauseAndCancel(t *testing.T) {
+	agent := &fakeAgent{}
+	s := NewServer("pw", NewFeed(10))
+	s.SetAgent(agent)
+	h := s.Handler()
+
+	if rec := do(t, h, "POST", "/admin/api/pause", "pw", true); rec.Code != http.StatusOK || !agent.paused {
+		t.Fatalf("pause: status %d, paused %v", rec.Code, agent.paused)
+	}
+	var status map[string]interface{}
+	json.Unmarshal(do(t, h, "GET", "/admin/api/status", "pw", false).Body.Bytes(), &status)
+	if status["paused"] != true {
+		t.Errorf("status does not report pause: %v", status)
+	}
+	if do(t, h, "POST", "/admin/api/resume", "pw", true); agent.paused {
+		t.Error("resume did not unpause")
+	}
+
+	if rec := do(t, h, "POST", "/admin/api/tasks/message-1/cancel", "pw", true); rec.Code != http.StatusOK {
+		t.Errorf("cancel: status %d", rec.Code)
+	}
+	if rec := do(t, h, "POST", "/admin/api/tasks/nope/cancel", "pw", true); rec.Code != http.StatusNotFound {
+		t.Errorf("cancel unknown: status %d", rec.Code)
+	}
+	if len(agent.cancelled) != 1 {
+		t.Errorf("cancelled %v", agent.cancelled)
+	}
+}
+
+// TestServer_EventsJobsConfig verifies the feed is paged by sequence, tool calls are redacted and config secrets are masked
+func TestServer_EventsJobsConfig(t *testing.T) {
+	feed := NewFeed(2)
+	s := NewServer("pw", feed)
+	s.SetJobs(func() []cron.CronJob { return []cron.CronJob{{ID: "j1", Name: "briefing"}} })
+	s.SetConfig(map[string]interface{}{
+		"providers": map[string]interface{}{"openai": map[string]interface{}{"api_key": "sk-live", "api_base": "https://api"}},
+		"tracing":   map[string]interface{}{"headers": map[string]interface{}{"Authorization": "Bearer abc", "X-Api-Key": "hdr-key"}},
+		"agents":    map[string]interface{}{"tokenizer": "cl100k"},
+	})
+	h := s.Handler()
+
+	feed.Inbound(bus.InboundMessage{Channel: "telegram", ChatID: "1", Content: "first"})
+	feed.Outbound(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "reply"})
+	feed.ToolCall(tools.ToolExecution{
+		Tool:     "web_fetch",
+		Args:     map[string]interface{}{"url": "https://x?api_key=abcdefgh123"},
+		Result:   tools.ErrorResult("boom"),
+		Started:  time.Now(),
+		Duration: 1500 * time.Millisecond,
+	})
+
+	var events []Event
+	json.Unmarshal(do(t, h, "GET", "/admin/api/events?after=0", "pw", false).Body.Bytes(), &events)
+	// The ring keeps the last two events
+	if len(events) != 2 || events[0].Seq != 2 || events[1].Kind != KindTool {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	call := events[1]
+	if !call.Error || call.DurationMS != 1500 || strings.Contains(call.Args, "abcdefgh123") {
+		t.Errorf("unexpected tool event: %+v", call)
+	}
+	json.Unmarshal(do(t, h, "GET", "/admin/api/events?after=3", "pw", false).Body.Bytes(), &events)
+	if len(events) != 0 {
+		t.Errorf("expected no events after the last seq, got %+v", events)
+	}
+
+	var jobs []cron.CronJob
+	json.Unmarshal(do(t, h, "GET", "/admin/api/jobs", "pw", false).Body.Bytes(), &jobs)
+	if len(jobs) != 1 || jobs[0].Name != "briefing" {
+		t.Errorf("unexpected jobs: %+v", jobs)
+	}
+
+	body := do(t, h, "GET", "/admin/api/config", "pw", false).Body.String()
+	if strings.Contains(body, "sk-live") || strings.Contains(body, "Bearer abc") || strings.Contains(body, "hdr-key") ||
+		!strings.Contains(body, "https://api") || !strings.Contains(body, "cl100k") {
+		t.Errorf("config not masked: %s", body)
+	}
+}
+
+// TestServer_AttachmentThumbnails verifies images in feed messages are served as small JPEG thumbnails, and nothing the feed did not record is
+func TestServer_AttachmentThumbnails(t *testing.T) {
+	feed := NewFeed(10)
+	h := NewServer("pw", feed).Handler()
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.png")
+	f, _ := os.Create(photo)
+	png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 1000, 500)))
+	f.Close()
+	notes := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notes, []byte("secret"), 0644)
+	feed.Inbound(bus.InboundMessage{Channel: "telegram", ChatID: "1", Media: []string{photo, notes}})
+
+	var events []Event
+	json.Unmarshal(do(t, h, "GET", "/admin/api/events?after=0", "pw", false).Body.Bytes(), &events)
+	if len(events) != 1 || events[0].Attachments != 2 || strings.Contains(do(t, h, "GET", "/admin/api/events?after=0", "pw", false).Body.String(), dir) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	rec := do(t, h, "GET", "/admin/api/events/1/attachments/0", "pw", false)
+	img, err := jpeg.Decode(rec.Body)
+	if rec.Code != http.StatusOK || err != nil || img.Bounds().Dx() != attachmentThumbSize {
+		t.Fatalf("thumbnail: %d %v", rec.Code, err)
+	}
+	for _, path := range []string{"/admin/api/events/1/attachments/1", "/admin/api/events/1/attachments/2", "/admin/api/events/9/attachments/0"} {
+		if rec := do(t, h, "GET", path, "pw", false); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: %d", path, rec.Code)
+		}
+	}
+	if rec := do(t, h, "GET", "/admin/api/events/1/attachments/0", "", false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("thumbnail served without auth: %d", rec.Code)
+	}
+}
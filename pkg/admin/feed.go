@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Event kinds in the feed.
+const (
+	KindInbound  = "inbound"
+	KindOutbound = "outbound"
+	KindTool     = "tool"
+)
+
+// maxFieldLen bounds message text, tool arguments and results kept per event.
+const maxFieldLen = 2000
+
+// Event is one entry in the live feed: a message in or out, or a tool call.
+type Event struct {
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Channel    string    `json:"channel,omitempty"`
+	ChatID     string    `json:"chat_id,omitempty"`
+	Sender     string    `json:"sender,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Tool       string    `json:"tool,omitempty"`
+	Args       string    `json:"args,omitempty"`
+	Result     string    `json:"result,omitempty"`
+	Error      bool      `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	// Attachments counts the message's files; images among them are
+	// served as thumbnails by index
+	Attachments int `json:"attachments,omitempty"`
+
+	media []string
+}
+
+// Feed keeps the most recent events in a ring buffer. Text passes through
+// the log redaction rules (secrets, emails) before it is stored, so the
+// dashboard never shows more than the logs would.
+type Feed struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+	next   int64
+	now    func() time.Time
+}
+
+// NewFeed returns a feed holding the last size events.
+func NewFeed(size int) *Feed {
+	if size <= 0 {
+		size = 500
+	}
+	return &Feed{size: size, next: 1, now: time.Now}
+}
+
+// Add appends e, assigning its sequence number and time.
+func (f *Feed) Add(e Event) {
+	e.Text = clean(e.Text)
+	e.Args = clean(e.Args)
+	e.Result = clean(e.Result)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.Seq = f.next
+	f.next++
+	if e.Time.IsZero() {
+		e.Time = f.now()
+	}
+	f.events = append(f.events, e)
+	if len(f.events) > f.size {
+		f.events = append([]Event(nil), f.events[len(f.events)-f.size:]...)
+	}
+}
+
+// Since returns events with a sequence number greater than seq, oldest first.
+func (f *Feed) Since(seq int64) []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := []Event{}
+	for _, e := range f.events {
+		if e.Seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Attachment returns the path of file n of the message with sequence
+// number seq, while the event is still in the feed.
+func (f *Feed) Attachment(seq int64, n int) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.events {
+		if e.Seq == seq && n >= 0 && n < len(e.media) {
+			return e.media[n], true
+		}
+	}
+	return "", false
+}
+
+// Inbound records a message published to the agent.
+func (f *Feed) Inbound(msg bus.InboundMessage) {
+	f.Add(Event{Kind: KindInbound, Channel: msg.Channel, ChatID: msg.ChatID, Sender: msg.SenderID, Text: msg.Content,
+		Attachments: len(msg.Media), media: msg.Media})
+}
+
+// Outbound records a reply published to a channel.
+func (f *Feed) Outbound(msg bus.OutboundMessage) {
+	f.Add(Event{Kind: KindOutbound, Channel: msg.Channel, ChatID: msg.ChatID, Text: msg.Content,
+		Attachments: len(msg.Media), media: msg.Media})
+}
+
+// ToolCall records a finished tool execution.
+func (f *Feed) ToolCall(call tools.ToolExecution) {
+	e := Event{
+		Time:       call.Started,
+		Kind:       KindTool,
+		Channel:    call.Channel,
+		ChatID:     call.ChatID,
+		Tool:       call.Tool,
+		DurationMS: call.Duration.Milliseconds(),
+	}
+	if args, err := json.Marshal(call.Args); err == nil {
+		e.Args = string(args)
+	}
+	if call.Result != nil {
+		e.Result = call.Result.ForLLM
+		e.Error = call.Result.IsError
+	}
+	f.Add(e)
+}
+
+func clean(s string) string {
+	if s == "" {
+		return s
+	}
+	return utils.Truncate(logger.Redact(s), maxFieldLen)
+}
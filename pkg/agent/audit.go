@@ -0,0 +1,22 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// recordAudit appends a mutating tool call to the audit log. The call has
+// already happened, so a failure to record it is only logged.
+func (al *AgentLoop) recordAudit(exec tools.ToolExecution) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := al.store.Audit.Append(ctx, tools.NewAuditEntry(exec)); err != nil {
+		logger.WarnCF("agent", "Failed to write the audit log", map[string]interface{}{
+			"tool":  exec.Tool,
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/automation"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// automationsWatchInterval is how often automation files are checked for
+// edits.
+const automationsWatchInterval = 5 * time.Second
+
+// syncAutomations schedules the file-defined schedules after a reload,
+// through whichever automations tool is registered now.
+func (al *AgentLoop) syncAutomations(*automation.Set) {
+	if tool, ok := al.tools.Get("automations"); ok {
+		if t, ok := tool.(*tools.AutomationsTool); ok {
+			t.SyncDefinitions()
+		}
+	}
+}
+
+// matchRule returns the automation file rule that applies to msg, if any.
+func (al *AgentLoop) matchRule(msg bus.InboundMessage) *automation.Rule {
+	rule := al.automations.Current().Match(msg.Channel+":"+msg.ChatID, msg.Content)
+	if rule != nil {
+		logger.InfoCF("agent", "Automation rule matched",
+			map[string]interface{}{
+				"rule":    rule.Name,
+				"file":    rule.File,
+				"chat_id": msg.ChatID,
+			})
+	}
+	return rule
+}
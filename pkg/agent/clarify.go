@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxPickResult bounds the result of a picked call quoted to the model.
+const maxPickResult = 4000
+
+// runPick runs the call a user's pick completes and returns their message
+// with the pick and its result, for the model to carry on from. Output
+// for the user is sent right away, as other tool results are.
+func (al *AgentLoop) runPick(ctx context.Context, msg bus.InboundMessage, pick *tools.Pick) string {
+	logger.InfoCF("agent", "User picked an option",
+		map[string]interface{}{
+			"tool":   pick.Tool,
+			"choice": pick.Label,
+		})
+	al.updateToolContexts(msg.Channel, msg.ChatID)
+	result := al.tools.ExecuteWithContext(tools.WithSender(ctx, msg.SenderID), pick.Tool, pick.Args, msg.Channel, msg.ChatID, nil)
+	if !result.Silent && (result.ForUser != "" || len(result.Media) > 0) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: result.ForUser,
+			Media:   result.Media,
+			Choices: result.Clarify.Labels(),
+		})
+	}
+	content := result.ForLLM
+	if content == "" && result.Err != nil {
+		content = result.Err.Error()
+	}
+	status := "returned"
+	if result.IsError {
+		status = "failed"
+	}
+	return fmt.Sprintf("%s\n\n[Asked %q, the user picked %q. %s was called with it and %s:\n%s]",
+		msg.Content, pick.Question, pick.Label, pick.Tool, status, utils.Truncate(content, maxPickResult))
+}
+
+// runPasswordRetry runs again the call that was waiting for a protected
+// PDF's password, now that the user sent it, and returns what stands in
+// for their message: a note that the password was given, never the
+// password, and the call's result.
+func (al *AgentLoop) runPasswordRetry(ctx context.Context, msg bus.InboundMessage, retry *tools.PasswordRetry) string {
+	if retry == nil {
+		return "[The user chose not to give the PDF's password. Do not ask for it again.]"
+	}
+	logger.InfoCF("agent", "User sent a PDF password", map[string]interface{}{"tool": retry.Tool})
+	al.updateToolContexts(msg.Channel, msg.ChatID)
+	result := al.tools.ExecuteWithContext(tools.WithSender(ctx, msg.SenderID), retry.Tool, retry.Args, msg.Channel, msg.ChatID, nil)
+	if !result.Silent && (result.ForUser != "" || len(result.Media) > 0) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: result.ForUser,
+			Media:   result.Media,
+			Choices: result.Clarify.Labels(),
+		})
+	}
+	content := result.ForLLM
+	if content == "" && result.Err != nil {
+		content = result.Err.Error()
+	}
+	status := "returned"
+	if result.IsError {
+		status = "failed"
+	}
+	return fmt.Sprintf("[The user sent the password of the protected PDF; it is not shown. %s was called again and %s:\n%s]",
+		retry.Tool, status, utils.Truncate(content, maxPickResult))
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/dlp"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// contentPolicy converts content_policy from the config. It returns nil,
+// which lets everything through, when the policy is off.
+func contentPolicy(cfg *config.Config) *dlp.Policy {
+	cp := cfg.ContentPolicy
+	if !cp.Enabled {
+		return nil
+	}
+	policy := &dlp.Policy{
+		CardNumbers:        cp.CardNumbers,
+		Keywords:           cp.Keywords,
+		MaxAttachmentBytes: int64(cp.MaxAttachmentMB) << 20,
+		RequireApproval:    strings.EqualFold(cp.Action, "approve"),
+	}
+	for _, expr := range cp.Patterns {
+		// Validate rejects bad patterns; skip any that slip through
+		if re, err := regexp.Compile(expr); err == nil {
+			policy.Patterns = append(policy.Patterns, re)
+		}
+	}
+	return policy
+}
+
+// ContentGuard returns the content policy guard, for tools run outside an
+// agent round (scheduled jobs) to put in their context.
+func (al *AgentLoop) ContentGuard() *dlp.Guard {
+	return al.guard
+}
+
+// filterOutbound takes emoji out of messages to users who turned them off
+// and screens chat messages against the content policy. A stopped message
+// is replaced by a notice, so the chat still learns that something was
+// withheld; a held one is sent when an owner releases it.
+func (al *AgentLoop) filterOutbound(msg bus.OutboundMessage) (bus.OutboundMessage, bool) {
+	if constants.IsInternalChannel(msg.Channel) {
+		return msg, true
+	}
+	if al.profiles != nil && al.profiles.Get(msg.Channel+":"+msg.ChatID).NoEmoji {
+		msg.Content = utils.StripEmoji(msg.Content)
+	}
+	original := msg
+	err := al.guard.Check(outboundItem(msg), func() { al.bus.PublishOutbound(original) })
+	var violation *dlp.Violation
+	if !errors.As(err, &violation) {
+		return msg, true
+	}
+	msg.Voice = false
+	if violation.HeldID != "" {
+		// Logged by the guard's OnHold
+		msg.Content = "This message is waiting for an owner's approval before it can be shown here."
+		return msg, true
+	}
+	logger.WarnCF("agent", "Outgoing message blocked by content policy", map[string]interface{}{
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+		"reasons": strings.Join(violation.Reasons, ", "),
+	})
+	msg.Content = "This message was withheld by the content policy."
+	return msg, true
+}
+
+func outboundItem(msg bus.OutboundMessage) dlp.Item {
+	return dlp.Item{Kind: dlp.KindMessage, Destination: msg.Channel + ":" + msg.ChatID, Text: msg.Content}
+}
+
+// heldReport lists held items without their content, which is what the
+// policy stopped and would be stopped again on the way to the owner.
+func (al *AgentLoop) heldReport() string {
+	held := al.guard.Held()
+	if len(held) == 0 {
+		return "Nothing is held."
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d held:", len(held))
+	for _, h := range held {
+		fmt.Fprintf(&sb, "\n%s: %s to %s, %s ago — %s", h.ID, h.Item.Kind, h.Item.Destination,
+			time.Since(h.At).Round(time.Second), strings.Join(h.Reasons, ", "))
+	}
+	return sb.String()
+}
+
+func (al *AgentLoop) decideHeld(release bool, id string) string {
+	if !release {
+		if _, err := al.guard.Drop(id); err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("Dropped %s.", id)
+	}
+	h, err := al.guard.Release(id)
+	if err != nil {
+		return err.Error()
+	}
+	if h.Item.Kind == dlp.KindMessage {
+		return fmt.Sprintf("Released %s: sent to %s.", id, h.Item.Destination)
+	}
+	return fmt.Sprintf("Released %s: the %s to %s goes through if it is retried within the hour.", id, h.Item.Kind, h.Item.Destination)
+}
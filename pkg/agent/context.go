@@ -8,7 +8,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/locale"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/tools"
@@ -19,6 +22,16 @@ type ContextBuilder struct {
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+	profiles     *profile.Store
+	memories     *tools.MemoryBook
+	entities     *tools.EntityBook
+	capabilities func(channel string) (bus.Capabilities, bool)
+	// languages is what each chat has been writing in; nil skips matching
+	languages *conversationLanguages
+	// planPreview reports whether multi-step changes are previewed
+	planPreview func() bool
+	// persona is the prompt of the persona an owner gave a chat
+	persona func(chatKey string) string
 }
 
 func getGlobalConfigDir() string {
@@ -48,13 +61,98 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
-func (cb *ContextBuilder) getIdentity() string {
+// SetPlanPreview tells the model to batch multi-step changes while
+// enabled reports true.
+func (cb *ContextBuilder) SetPlanPreview(enabled func() bool) {
+	cb.planPreview = enabled
+}
+
+// SetPersona adds the prompt prompt returns for a chat, if any, to the
+// chat's system prompt.
+func (cb *ContextBuilder) SetPersona(prompt func(chatKey string) string) {
+	cb.persona = prompt
+}
+
+// ToolExamples returns the examples of the tool called name to add to the
+// result of a call to it, or "" when it has none or messages already show
+// them. The model thus sees them once per conversation, for the tools it
+// actually uses, instead of in every prompt.
+func (cb *ContextBuilder) ToolExamples(name string, messages []providers.Message) string {
+	if cb.tools == nil {
+		return ""
+	}
+	tool, ok := cb.tools.Get(name)
+	if !ok {
+		return ""
+	}
+	header := tools.ExamplesHeader(name)
+	for _, m := range messages {
+		if m.Role == "tool" && strings.Contains(m.Content, header) {
+			return ""
+		}
+	}
+	return tools.FormatExamples(tool)
+}
+
+// SetMemories sets what is remembered about each chat's user, shown in
+// that chat's prompt.
+func (cb *ContextBuilder) SetMemories(book *tools.MemoryBook) {
+	cb.memories = book
+}
+
+// SetEntities sets the people, files and events mentioned in each chat,
+// the latest of which are listed in its prompt.
+func (cb *ContextBuilder) SetEntities(book *tools.EntityBook) {
+	cb.entities = book
+}
+
+// SetProfiles sets the user profile store used to localize the prompt.
+func (cb *ContextBuilder) SetProfiles(store *profile.Store) {
+	cb.profiles = store
+}
+
+// SetCapabilities sets how to look up what a channel can show, so replies
+// are formatted for it.
+func (cb *ContextBuilder) SetCapabilities(lookup func(channel string) (bus.Capabilities, bool)) {
+	cb.capabilities = lookup
+}
+
+// formattingNote tells the model how to format for the channel, or "" if
+// its capabilities are not known.
+func (cb *ContextBuilder) formattingNote(channel string) string {
+	if cb.capabilities == nil {
+		return ""
+	}
+	caps, ok := cb.capabilities(channel)
+	if !ok {
+		return ""
+	}
+	var note string
+	switch caps.Markdown {
+	case bus.MarkdownCommon:
+		note = "This chat renders Markdown: **bold**, _italic_, `code`, lists and [text](url) links."
+	case bus.MarkdownSlack:
+		note = "This chat uses Slack formatting: *bold*, _italic_, `code` and <url|text> links; no headings or tables."
+	case bus.MarkdownWhatsApp:
+		note = "This chat uses WhatsApp formatting: *bold*, _italic_, ~strikethrough~ and ```code```; no headings, tables or link syntax."
+	default:
+		note = "This chat shows plain text: do not use Markdown."
+	}
+	if len(caps.MediaTypes) == 0 {
+		note += " It cannot receive images or files."
+	} else if caps.MaxFileBytes > 0 {
+		note += fmt.Sprintf(" Images can be sent up to %d MB.", caps.MaxFileBytes>>20)
+	}
+	return note
+}
+
+func (cb *ContextBuilder) getIdentity(channel, chatID, senderID string) string {
 	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
 	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
 
 	// Build tools section dynamically
-	toolsSection := cb.buildToolsSection()
+	toolsSection := cb.buildToolsSection(channel, chatID, senderID)
 
 	return fmt.Sprintf(`# picoclaw 🦞
 
@@ -80,16 +178,18 @@ Your workspace is at: %s
 
 2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
 
-3. **Memory** - When remembering something, write to %s/memory/MEMORY.md`,
+3. **Memory** - When remembering something about the user, use the memory tool, so they can see and forget it; keep your own working notes in %s/memory/MEMORY.md`,
 		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
 }
 
-func (cb *ContextBuilder) buildToolsSection() string {
+// buildToolsSection lists the tools senderID may call in the chat, all
+// of them without a chat.
+func (cb *ContextBuilder) buildToolsSection(channel, chatID, senderID string) string {
 	if cb.tools == nil {
 		return ""
 	}
 
-	summaries := cb.tools.GetSummaries()
+	summaries := cb.tools.SummariesForChat(channel, chatID, senderID)
 	if len(summaries) == 0 {
 		return ""
 	}
@@ -102,15 +202,27 @@ func (cb *ContextBuilder) buildToolsSection() string {
 		sb.WriteString(s)
 		sb.WriteString("\n")
 	}
+	sb.WriteString("\n")
+	sb.WriteString(tools.UntrustedPrompt)
+	sb.WriteString("\n")
+	if cb.planPreview != nil && cb.planPreview() {
+		sb.WriteString("\n" + planPreviewNote + "\n")
+	}
 
 	return sb.String()
 }
 
 func (cb *ContextBuilder) BuildSystemPrompt() string {
+	return cb.buildSystemPrompt("", "", "")
+}
+
+// buildSystemPrompt is BuildSystemPrompt with the tools listed for
+// senderID in the chat.
+func (cb *ContextBuilder) buildSystemPrompt(channel, chatID, senderID string) string {
 	parts := []string{}
 
 	// Core identity section
-	parts = append(parts, cb.getIdentity())
+	parts = append(parts, cb.getIdentity(channel, chatID, senderID))
 
 	// Bootstrap files
 	bootstrapContent := cb.LoadBootstrapFiles()
@@ -157,14 +269,89 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	return result
 }
 
-func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
+// languageNote tells the model which language to reply in: the profile's
+// when it is fixed, else the one the user is writing in, so a bilingual
+// user is answered in the language of their message.
+func (cb *ContextBuilder) languageNote(p profile.Profile, chatKey string) string {
+	if p.FixedLanguage && p.Language != "" {
+		return fmt.Sprintf(" Always reply in %s, even when the user writes in another language.", p.Language)
+	}
+	if cb.languages != nil {
+		if name := locale.Name(cb.languages.current(chatKey)); name != "" {
+			return fmt.Sprintf("\n\nThe user is writing in %s: reply in %s until they switch language.", name, name)
+		}
+	}
+	if p.Language != "" {
+		return fmt.Sprintf(" Reply in %s unless the user writes in another language.", p.Language)
+	}
+	return ""
+}
+
+// styleNote turns the profile's reply style preferences into instructions,
+// "" when none is set.
+func styleNote(p profile.Profile) string {
+	var notes []string
+	if note := verbosityNotes[p.Verbosity]; note != "" {
+		notes = append(notes, note)
+	}
+	if p.NoEmoji {
+		notes = append(notes, "Do not use emoji.")
+	}
+	switch p.Clock {
+	case "12h":
+		notes = append(notes, "Write times on a 12-hour clock (3:30 PM).")
+	case "24h":
+		notes = append(notes, "Write times on a 24-hour clock (15:30).")
+	}
+	switch p.Units {
+	case "metric":
+		notes = append(notes, "Use metric units (°C, km, kg).")
+	case "imperial":
+		notes = append(notes, "Use imperial units (°F, miles, pounds).")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "\n\nThe user's style preferences, kept until they change them: " + strings.Join(notes, " ")
+}
+
+func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID, senderID string) []providers.Message {
 	messages := []providers.Message{}
 
-	systemPrompt := cb.BuildSystemPrompt()
+	systemPrompt := cb.buildSystemPrompt(channel, chatID, senderID)
 
 	// Add Current Session info if provided
 	if channel != "" && chatID != "" {
 		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
+		if note := cb.formattingNote(channel); note != "" {
+			systemPrompt += "\nFormatting: " + note
+		}
+
+		var p profile.Profile
+		if cb.profiles != nil {
+			p = cb.profiles.Get(channel + ":" + chatID)
+		}
+		if !p.IsZero() {
+			systemPrompt += "\n\n## User Profile\n" + tools.FormatProfile(p, time.Now()) +
+				"\n\nUse the user's timezone for all times and dates you mention or schedule."
+		}
+		systemPrompt += cb.languageNote(p, channel+":"+chatID)
+		systemPrompt += styleNote(p)
+		if cb.memories != nil {
+			if remembered := cb.memories.Context(channel + ":" + chatID); remembered != "" {
+				systemPrompt += "\n\n## What You Remember About This User" + remembered
+			}
+		}
+		if cb.entities != nil {
+			if mentioned := cb.entities.Context(channel + ":" + chatID); mentioned != "" {
+				systemPrompt += "\n\n## Mentioned Recently\nPeople, files and events the tools came across in this chat, the latest first. When the user refers to one without naming it (\"send it to her\", \"that meeting\"), it is most likely the latest that fits; use the addresses and IDs here, or the entities tool for more, and ask when two fit equally." + mentioned
+			}
+		}
+		if cb.persona != nil {
+			if note := cb.persona(channel + ":" + chatID); note != "" {
+				systemPrompt += "\n\n## Persona\nIn this chat, follow these instructions over the defaults above, and use only the tools you are offered here.\n\n" + note
+			}
+		}
 	}
 
 	// Log system prompt summary for debugging (debug mode only)
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/admin"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// pausedReply answers messages that arrive while the agent is paused.
+const pausedReply = "I'm paused by my administrator right now, so I didn't act on that. Please try again later."
+
+// cancelledReply replaces the response of a round cancelled from the dashboard.
+const cancelledReply = "Stopped: this request was cancelled by my administrator."
+
+// messageTask is an inbound message being processed.
+type messageTask struct {
+	id        string
+	msg       bus.InboundMessage
+	started   time.Time
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// messageTasks are the rounds running, one per chat at most.
+type messageTasks struct {
+	mu      sync.Mutex
+	seq     int
+	running map[string]*messageTask
+}
+
+// cancelAll cancels every running round, for shutdown.
+func (m *messageTasks) cancelAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, task := range m.running {
+		task.cancel()
+	}
+}
+
+// Paused reports whether the agent is ignoring new messages.
+func (al *AgentLoop) Paused() bool {
+	return al.paused.Load()
+}
+
+// SetPaused stops or resumes processing of new messages. Messages that
+// arrive while paused get a short notice instead of an answer; a round
+// already running finishes unless it is cancelled.
+func (al *AgentLoop) SetPaused(paused bool) {
+	al.paused.Store(paused)
+}
+
+// Tasks lists the messages being processed and background subagents.
+func (al *AgentLoop) Tasks() []admin.Task {
+	var out []admin.Task
+	al.current.mu.Lock()
+	for _, task := range al.current.running {
+		out = append(out, admin.Task{
+			ID:          task.id,
+			Kind:        "message",
+			Channel:     task.msg.Channel,
+			ChatID:      task.msg.ChatID,
+			Description: utils.Truncate(task.msg.Content, 120),
+			Status:      "running",
+			Started:     task.started,
+		})
+	}
+	al.current.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+
+	if al.subagents != nil {
+		subagents := al.subagents.ListTasks()
+		sort.Slice(subagents, func(i, j int) bool { return subagents[i].Created > subagents[j].Created })
+		for _, t := range subagents {
+			desc := t.Label
+			if desc == "" {
+				desc = t.Task
+			}
+			out = append(out, admin.Task{
+				ID:          t.ID,
+				Kind:        "subagent",
+				Channel:     t.OriginChannel,
+				ChatID:      t.OriginChatID,
+				Description: utils.Truncate(desc, 120),
+				Status:      t.Status,
+				Started:     time.UnixMilli(t.Created),
+			})
+		}
+	}
+	return out
+}
+
+// CancelTask cancels a running message round or a subagent by ID.
+func (al *AgentLoop) CancelTask(id string) bool {
+	al.current.mu.Lock()
+	if task, ok := al.current.running[id]; ok {
+		task.cancelled = true
+		task.cancel()
+		al.current.mu.Unlock()
+		return true
+	}
+	al.current.mu.Unlock()
+
+	if al.subagents != nil {
+		return al.subagents.Cancel(id)
+	}
+	return false
+}
+
+// ObserveTools calls fn after every tool execution, by the agent or its
+// subagents.
+func (al *AgentLoop) ObserveTools(fn func(tools.ToolExecution)) {
+	al.tools.SetObserver(fn)
+	if al.subagentTools != nil {
+		al.subagentTools.SetObserver(fn)
+	}
+}
+
+// beginTask records msg as a running, cancellable task. The returned
+// function ends it and reports whether it was cancelled from the dashboard.
+func (al *AgentLoop) beginTask(ctx context.Context, msg bus.InboundMessage) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	al.current.mu.Lock()
+	al.current.seq++
+	task := &messageTask{
+		id:      fmt.Sprintf("message-%d", al.current.seq),
+		msg:     msg,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+	if al.current.running == nil {
+		al.current.running = make(map[string]*messageTask)
+	}
+	al.current.running[task.id] = task
+	al.current.mu.Unlock()
+
+	return ctx, func() bool {
+		cancel()
+		al.current.mu.Lock()
+		defer al.current.mu.Unlock()
+		delete(al.current.running, task.id)
+		return task.cancelled
+	}
+}
+
+// replyPaused answers msg with the paused notice. Subagent results and
+// other system messages are dropped.
+func (al *AgentLoop) replyPaused(msg bus.InboundMessage) {
+	logger.InfoCF("agent", "Message skipped while paused", map[string]interface{}{
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+	})
+	if msg.Channel == "system" {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: pausedReply,
+	})
+}
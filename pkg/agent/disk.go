@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/janitor"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// diskSweepInterval is how often the disk budget is enforced between
+// downloads.
+const diskSweepInterval = 10 * time.Minute
+
+// diskBudget is the configured disk budget.
+func diskBudget(cfg *config.Config) janitor.Budget {
+	return janitor.Budget{
+		MaxBytes:     int64(cfg.Disk.BudgetMB) << 20,
+		MinFreeBytes: int64(cfg.Disk.MinFreeMB) << 20,
+	}
+}
+
+// newJanitor keeps received media, artifacts, previews and spools within
+// the disk budget. Artifacts are removed through their store so the
+// index stays in step.
+func (al *AgentLoop) newJanitor(cfg *config.Config) *janitor.Janitor {
+	cache := filepath.Join(al.workspace, "cache")
+	artifactArea := janitor.Area{
+		Name: "artifacts",
+		Items: func() []janitor.Item {
+			var items []janitor.Item
+			for _, a := range al.artifacts.List() {
+				items = append(items, janitor.Item{ID: a.Ref(), Size: a.Size, Used: a.Created})
+			}
+			return items
+		},
+		Remove: func(item janitor.Item) error {
+			return al.artifacts.Remove(item.ID)
+		},
+	}
+	j := janitor.New(diskBudget(cfg), al.workspace,
+		janitor.Dir("media", utils.MediaDir()),
+		artifactArea,
+		janitor.Dir("previews", filepath.Join(cache, "previews")),
+		janitor.Dir("slideshows", filepath.Join(cache, "slideshows")),
+		janitor.Dir("transfers", filepath.Join(cache, "transfers")),
+		janitor.Dir("backup spool", filepath.Join(cache, "backup-spool")),
+	)
+	j.SetAlert(al.alertOwners)
+	return j
+}
+
+// alertOwners sends text to every owner given as "channel:chat_id".
+func (al *AgentLoop) alertOwners(text string) {
+	al.cfgMu.RLock()
+	owners := append([]string(nil), al.owners...)
+	al.cfgMu.RUnlock()
+	for _, owner := range owners {
+		channel, chatID, ok := strings.Cut(strings.TrimSpace(owner), ":")
+		if !ok || chatID == "" {
+			continue
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: text})
+	}
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultHandoverHistory is how many recent messages a handover snapshot
+// shows when the config does not say.
+const defaultHandoverHistory = 10
+
+const handoverHelp = `/reply <chat> <text> - answer and hand the chat back to the agent
+/say <chat> <text> - answer and keep the chat
+/handback <chat> - hand the chat back without answering
+/handovers - chats waiting for a person`
+
+func (al *AgentLoop) escalation() config.EscalationConfig {
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	if al.cfg == nil {
+		return config.EscalationConfig{}
+	}
+	return al.cfg.Escalation
+}
+
+// Escalate hands a conversation over to a person: the escalation owner
+// chat gets a snapshot of it, and the chat's messages are relayed there
+// instead of answered until the person replies with /reply or hands it
+// back with /handback.
+func (al *AgentLoop) Escalate(ctx context.Context, channel, chatID, reason, summary string) error {
+	esc := al.escalation()
+	if !esc.Enabled {
+		return errors.New("escalation is not configured")
+	}
+	chatKey := channel + ":" + chatID
+	if chatKey == esc.OwnerChat {
+		return errors.New("this is the chat conversations are handed over to")
+	}
+	err := al.state.UpdateChatSettings(chatKey, func(s *state.ChatSettings) {
+		s.HandedOver = time.Now()
+		s.HandoverReason = reason
+	})
+	if err != nil {
+		return err
+	}
+
+	limit := esc.HistoryMessages
+	if limit == 0 {
+		limit = defaultHandoverHistory
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Handover from %s\nReason: %s\n", chatKey, reason)
+	if summary != "" {
+		fmt.Fprintf(&sb, "Summary: %s\n", summary)
+	}
+	if transcript := handoverTranscript(al.sessions.GetHistory(chatKey), limit); transcript != "" {
+		fmt.Fprintf(&sb, "\nRecent messages:\n%s\n", transcript)
+	}
+	fmt.Fprintf(&sb, "\nNew messages from this chat will be forwarded here.\n%s", strings.ReplaceAll(handoverHelp, "<chat>", chatKey))
+
+	logger.InfoCF("agent", "Conversation handed over", map[string]interface{}{
+		"chat":   chatKey,
+		"reason": reason,
+	})
+	al.sendToOwnerChat(esc.OwnerChat, sb.String(), nil)
+	return nil
+}
+
+// handoverTranscript formats the last limit user and assistant messages
+// of a session, leaving out tool calls and results.
+func handoverTranscript(history []providers.Message, limit int) string {
+	var lines []string
+	for _, m := range history {
+		if strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		switch m.Role {
+		case "user":
+			lines = append(lines, "User: "+utils.Truncate(m.Content, 500))
+		case "assistant":
+			lines = append(lines, "Assistant: "+utils.Truncate(m.Content, 500))
+		}
+	}
+	if len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sendToOwnerChat publishes to the escalation owner chat, past the
+// content policy: the person there needs to see what users actually wrote.
+func (al *AgentLoop) sendToOwnerChat(ownerChat, content string, media []string) {
+	channel, chatID, _ := strings.Cut(ownerChat, ":")
+	out := bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: content, Media: media}
+	al.guard.Allow(outboundItem(out))
+	al.bus.PublishOutbound(out)
+}
+
+// relayHandedOver forwards msg to the owner chat when its conversation is
+// handed over to a person, and reports whether it did. The message is
+// kept in the session so the agent knows what was said when the chat
+// comes back to it.
+func (al *AgentLoop) relayHandedOver(msg bus.InboundMessage) bool {
+	esc := al.escalation()
+	if !esc.Enabled || msg.Channel == "system" {
+		return false
+	}
+	chatKey := msg.Channel + ":" + msg.ChatID
+	if al.state.GetChatSettings(chatKey).HandedOver.IsZero() {
+		return false
+	}
+	al.sendToOwnerChat(esc.OwnerChat, fmt.Sprintf("%s (%s): %s", chatKey, msg.SenderID, msg.Content), msg.Media)
+	al.recordHandover(msg.SessionKey, "user", msg.Content)
+	return true
+}
+
+func (al *AgentLoop) recordHandover(sessionKey, role, content string) {
+	if sessionKey == "" {
+		return
+	}
+	al.sessions.AddMessage(sessionKey, role, content)
+	al.sessions.Save(sessionKey)
+}
+
+// handleHandoverCommand runs the commands the person in the escalation
+// owner chat (or an owner anywhere) uses to answer handed-over chats.
+func (al *AgentLoop) handleHandoverCommand(msg bus.InboundMessage) (string, bool) {
+	esc := al.escalation()
+	content := strings.TrimSpace(msg.Content)
+	if !esc.Enabled || !strings.HasPrefix(content, "/") {
+		return "", false
+	}
+	cmd := strings.Fields(content)[0]
+	rest := content[len(cmd):]
+	switch cmd {
+	case "/reply", "/say", "/handback", "/handovers":
+	default:
+		return "", false
+	}
+	if msg.Channel+":"+msg.ChatID != esc.OwnerChat && !al.isOwner(msg) {
+		return "", false
+	}
+
+	if cmd == "/handovers" {
+		return al.handoversReport(), true
+	}
+	rest = strings.TrimSpace(rest)
+	target, text := rest, ""
+	if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+		target, text = rest[:i], strings.TrimSpace(rest[i:])
+	}
+	channel, chatID, _ := strings.Cut(target, ":")
+	if channel == "" || chatID == "" || (cmd != "/handback" && text == "") {
+		if cmd == "/handback" {
+			return "Usage: /handback <channel:chat_id>", true
+		}
+		return fmt.Sprintf("Usage: %s <channel:chat_id> <text>", cmd), true
+	}
+	if al.state.GetChatSettings(target).HandedOver.IsZero() {
+		return fmt.Sprintf("%s is not handed over.", target), true
+	}
+
+	if text != "" {
+		out := bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: text}
+		al.guard.Allow(outboundItem(out))
+		al.bus.PublishOutbound(out)
+		al.recordHandover(target, "assistant", text)
+	}
+	if cmd == "/say" {
+		return fmt.Sprintf("Sent to %s; the chat stays with you.", target), true
+	}
+	if err := al.state.UpdateChatSettings(target, func(s *state.ChatSettings) {
+		s.HandedOver = time.Time{}
+		s.HandoverReason = ""
+	}); err != nil {
+		return fmt.Sprintf("Failed to hand %s back: %v", target, err), true
+	}
+	logger.InfoCF("agent", "Conversation handed back", map[string]interface{}{"chat": target})
+	if cmd == "/reply" {
+		return fmt.Sprintf("Sent to %s and handed back to the agent.", target), true
+	}
+	return fmt.Sprintf("%s is back with the agent.", target), true
+}
+
+func (al *AgentLoop) handoversReport() string {
+	var keys []string
+	all := al.state.AllChatSettings()
+	for key, s := range all {
+		if !s.HandedOver.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "No chats are handed over."
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString("Handed over:")
+	for _, key := range keys {
+		s := all[key]
+		fmt.Fprintf(&sb, "\n%s - %s ago: %s", key, time.Since(s.HandedOver).Round(time.Minute), s.HandoverReason)
+	}
+	return sb.String()
+}
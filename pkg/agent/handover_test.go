@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TestHandover_EscalateRelayAndReply verifies an escalated chat is snapshotted to the owner chat, relayed there instead of answered, and handed back by /reply
+func TestHandover_EscalateRelayAndReply(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Escalation: config.EscalationConfig{Enabled: true, OwnerChat: "telegram:900", HistoryMessages: 2},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	al.sessions.AddMessage("whatsapp:555", "user", "hello")
+	al.sessions.AddMessage("whatsapp:555", "assistant", "hi, how can I help?")
+	al.sessions.AddMessage("whatsapp:555", "user", "I want a refund")
+
+	tool, ok := al.tools.Get("escalate")
+	if !ok {
+		t.Fatal("escalate tool not registered")
+	}
+	ctx := tools.WithChat(context.Background(), "whatsapp", "555")
+	if res := tool.Execute(ctx, map[string]interface{}{"reason": "refund request", "summary": "order 42"}); res.IsError {
+		t.Fatalf("escalate: %s", res.ForLLM)
+	}
+	sent := al.bus.DrainOutbound()
+	if len(sent) != 1 || sent[0].Channel != "telegram" || sent[0].ChatID != "900" {
+		t.Fatalf("unexpected snapshot: %+v", sent)
+	}
+	snapshot := sent[0].Content
+	if !strings.Contains(snapshot, "refund request") || !strings.Contains(snapshot, "User: I want a refund") || strings.Contains(snapshot, "User: hello") {
+		t.Errorf("snapshot: %s", snapshot)
+	}
+
+	msg := bus.InboundMessage{Channel: "whatsapp", ChatID: "555", SenderID: "555", Content: "anyone there?", SessionKey: "whatsapp:555"}
+	if !al.relayHandedOver(msg) {
+		t.Fatal("message from a handed-over chat was not relayed")
+	}
+	if sent := al.bus.DrainOutbound(); len(sent) != 1 || sent[0].ChatID != "900" || !strings.Contains(sent[0].Content, "anyone there?") {
+		t.Errorf("unexpected relay: %+v", sent)
+	}
+
+	// Only the owner chat (or an owner) may answer
+	stranger := bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7", Content: "/reply whatsapp:555 done"}
+	if _, handled := al.handleHandoverCommand(stranger); handled {
+		t.Error("a stranger answered a handed-over chat")
+	}
+	owner := bus.InboundMessage{Channel: "telegram", ChatID: "900", SenderID: "1", Content: "/say whatsapp:555 Looking into it"}
+	if reply, handled := al.handleHandoverCommand(owner); !handled || !strings.Contains(reply, "stays with you") {
+		t.Fatalf("/say: %v %q", handled, reply)
+	}
+	if sent := al.bus.DrainOutbound(); len(sent) != 1 || sent[0].ChatID != "555" || sent[0].Content != "Looking into it" {
+		t.Errorf("unexpected /say delivery: %+v", sent)
+	}
+	if reply, _ := al.handleHandoverCommand(bus.InboundMessage{Channel: "telegram", ChatID: "900", Content: "/handovers"}); !strings.Contains(reply, "whatsapp:555") {
+		t.Errorf("/handovers: %q", reply)
+	}
+
+	owner.Content = "/reply whatsapp:555 Refund issued.\nAnything else?"
+	if reply, _ := al.handleHandoverCommand(owner); !strings.Contains(reply, "handed back") {
+		t.Fatalf("/reply: %q", reply)
+	}
+	if sent := al.bus.DrainOutbound(); len(sent) != 1 || sent[0].Content != "Refund issued.\nAnything else?" {
+		t.Errorf("unexpected /reply delivery: %+v", sent)
+	}
+	if al.relayHandedOver(msg) {
+		t.Error("chat still relayed after /reply")
+	}
+	history := al.sessions.GetHistory("whatsapp:555")
+	if last := history[len(history)-1]; last.Role != "assistant" || !strings.HasPrefix(last.Content, "Refund issued.") {
+		t.Errorf("the person's answer is missing from the session: %+v", last)
+	}
+}
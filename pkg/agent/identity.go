@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// sendLinkCode delivers an identity link code: by Gmail to "email:"
+// accounts, as a chat message to the others. The chat must be one the bot
+// can start, which on most channels means the user wrote to it before.
+func (al *AgentLoop) sendLinkCode(ctx context.Context, account, text string) error {
+	channel, id, _ := strings.Cut(account, ":")
+	if channel == "email" {
+		al.cfgMu.RLock()
+		cfg := al.cfg
+		al.cfgMu.RUnlock()
+		if cfg.Google.ClientID == "" {
+			return errors.New("email codes need Google auth for Gmail; link a chat account instead")
+		}
+		_, _, err := tools.NewGmailClient(googleTokenFunc(cfg)).Send(ctx, tools.OutgoingEmail{
+			To:      []string{id},
+			Subject: "Your picoclaw link code",
+			Body:    text,
+		})
+		return err
+	}
+	if al.channelManager != nil {
+		if _, ok := al.channelManager.GetChannel(channel); !ok {
+			return fmt.Errorf("channel %s is not enabled", channel)
+		}
+	}
+	out := bus.OutboundMessage{Channel: channel, ChatID: id, Content: text}
+	al.guard.Allow(outboundItem(out))
+	al.bus.PublishOutbound(out)
+	return nil
+}
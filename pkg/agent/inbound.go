@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// overflowNotice tells a chat that sent more than the queue keeps that the
+// rest was not read.
+const overflowNotice = "That was a lot at once: I'm answering what you sent so far and skipped the rest. Please send anything else once I've replied."
+
+// queueOptions are the inbound queue's limits, from config.QueueConfig.
+type queueOptions struct {
+	maxConcurrent int           // rounds in flight across chats
+	coalesce      time.Duration // quiet time before a chat's messages are taken
+	maxWait       time.Duration // longest a message waits for the quiet time
+	maxPending    int           // messages kept per chat
+}
+
+func newQueueOptions(cfg config.QueueConfig) queueOptions {
+	opts := queueOptions{
+		maxConcurrent: cfg.MaxConcurrent,
+		coalesce:      time.Duration(cfg.CoalesceMillis) * time.Millisecond,
+		maxPending:    cfg.MaxPending,
+	}
+	if opts.maxConcurrent <= 0 {
+		opts.maxConcurrent = 1
+	}
+	if opts.maxPending <= 0 {
+		opts.maxPending = 20
+	}
+	opts.maxWait = 4 * opts.coalesce
+	return opts
+}
+
+// chatQueue holds one chat's messages waiting for a round.
+type chatQueue struct {
+	pending  []bus.InboundMessage
+	busy     bool      // a round for this chat is running
+	first    time.Time // when the oldest pending message arrived
+	last     time.Time // when the newest one arrived
+	overflow bool      // the chat was told messages were skipped
+}
+
+// inboundQueue sits between the bus and the agent. Each chat's messages
+// are answered in order, one round at a time; at most maxConcurrent rounds
+// run across chats, the chat waiting longest going first. A burst from
+// one chat, or messages sent while its round runs, are merged into a
+// single round instead of one each.
+type inboundQueue struct {
+	opts queueOptions
+
+	mu      sync.Mutex
+	chats   map[string]*chatQueue
+	running int
+	wake    chan struct{}
+}
+
+func newInboundQueue(opts queueOptions) *inboundQueue {
+	return &inboundQueue{
+		opts:  opts,
+		chats: make(map[string]*chatQueue),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// chatKey is the chat a message belongs to. Subagent results carry their
+// origin chat as ChatID, so they queue behind that chat's messages.
+func chatKey(msg bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		return msg.ChatID
+	}
+	return msg.Channel + ":" + msg.ChatID
+}
+
+// add queues msg, or drops it when the chat already has maxPending
+// messages waiting. notify is true for the first message dropped since
+// the chat's last round, so the chat is told once.
+func (q *inboundQueue) add(msg bus.InboundMessage, now time.Time) (notify bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := chatKey(msg)
+	chat, ok := q.chats[key]
+	if !ok {
+		chat = &chatQueue{}
+		q.chats[key] = chat
+	}
+	if len(chat.pending) >= q.opts.maxPending {
+		inboundDropped.Inc(msg.Channel)
+		notify = !chat.overflow
+		chat.overflow = true
+		return notify
+	}
+	if len(chat.pending) == 0 {
+		chat.first = now
+	}
+	chat.last = now
+	chat.pending = append(chat.pending, msg)
+	q.signal()
+	return false
+}
+
+// setOptions changes the queue's limits. Rounds already running finish;
+// a higher max_concurrent lets waiting chats start at once.
+func (q *inboundQueue) setOptions(opts queueOptions) {
+	q.mu.Lock()
+	q.opts = opts
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *inboundQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next waits until a round may start and returns its chat and message:
+// the chat's leading messages merged into one. It returns false once ctx
+// is done.
+func (q *inboundQueue) next(ctx context.Context) (string, bus.InboundMessage, bool) {
+	for {
+		q.mu.Lock()
+		key, wait := q.due(time.Now())
+		if key != "" {
+			chat := q.chats[key]
+			msg, n := coalesce(chat.pending)
+			chat.pending = chat.pending[n:]
+			chat.first = time.Now()
+			chat.busy = true
+			q.running++
+			q.mu.Unlock()
+			if n > 1 {
+				inboundCoalesced.Add(float64(n-1), msg.Channel)
+			}
+			return key, msg, true
+		}
+		q.mu.Unlock()
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return "", bus.InboundMessage{}, false
+		}
+	}
+}
+
+// due returns the chat whose round should start now, or how long until
+// one might (0 when only a new message or a finished round can help).
+// Callers hold q.mu.
+func (q *inboundQueue) due(now time.Time) (string, time.Duration) {
+	if q.running >= q.opts.maxConcurrent {
+		return "", 0
+	}
+	var best string
+	var bestFirst time.Time
+	var wait time.Duration
+	for key, chat := range q.chats {
+		if chat.busy || len(chat.pending) == 0 {
+			continue
+		}
+		ready := chat.last.Add(q.opts.coalesce)
+		if limit := chat.first.Add(q.opts.maxWait); limit.Before(ready) {
+			ready = limit
+		}
+		if ready.After(now) {
+			if d := ready.Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+		if best == "" || chat.first.Before(bestFirst) {
+			best, bestFirst = key, chat.first
+		}
+	}
+	return best, wait
+}
+
+// done ends the round for key, letting the chat's next messages through.
+func (q *inboundQueue) done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	if chat, ok := q.chats[key]; ok {
+		chat.busy = false
+		chat.overflow = false
+		if len(chat.pending) == 0 {
+			delete(q.chats, key)
+		}
+	}
+	q.signal()
+}
+
+// drain removes and returns every message still waiting, each chat's in
+// order.
+func (q *inboundQueue) drain() []bus.InboundMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []bus.InboundMessage
+	for key, chat := range q.chats {
+		out = append(out, chat.pending...)
+		chat.pending = nil
+		if !chat.busy {
+			delete(q.chats, key)
+		}
+	}
+	return out
+}
+
+// depth returns how many messages are waiting in the queue.
+func (q *inboundQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, chat := range q.chats {
+		n += len(chat.pending)
+	}
+	return n
+}
+
+// coalesce merges the leading messages of pending that can share a round:
+// same sender and session, neither a command nor a system message. It
+// returns the merged message and how many it took.
+func coalesce(pending []bus.InboundMessage) (bus.InboundMessage, int) {
+	merged := pending[0]
+	if !mergeable(merged) {
+		return merged, 1
+	}
+	n := 1
+	for _, msg := range pending[1:] {
+		if !mergeable(msg) || msg.SenderID != merged.SenderID || msg.SessionKey != merged.SessionKey {
+			break
+		}
+		if merged.Content == "" {
+			merged.Content = msg.Content
+		} else if msg.Content != "" {
+			merged.Content += "\n" + msg.Content
+		}
+		if len(msg.Media) > 0 {
+			merged.Media = append(append([]string(nil), merged.Media...), msg.Media...)
+		}
+		// The latest message's metadata wins, so replies thread under it
+		if len(msg.Metadata) > 0 {
+			metadata := make(map[string]string, len(merged.Metadata)+len(msg.Metadata))
+			for k, v := range merged.Metadata {
+				metadata[k] = v
+			}
+			for k, v := range msg.Metadata {
+				metadata[k] = v
+			}
+			merged.Metadata = metadata
+		}
+		n++
+	}
+	return merged, n
+}
+
+func mergeable(msg bus.InboundMessage) bool {
+	return msg.Channel != "system" && !isEvent(msg) && !strings.HasPrefix(strings.TrimSpace(msg.Content), "/")
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func chatMessage(chatID, content string) bus.InboundMessage {
+	return bus.InboundMessage{Channel: "telegram", ChatID: chatID, SenderID: "u" + chatID, SessionKey: "telegram:" + chatID, Content: content}
+}
+
+// TestInboundQueue_CoalescesAndLimits verifies a chat's burst is answered in one round, rounds are limited across chats, and overflow is dropped with one notice
+func TestInboundQueue_CoalescesAndLimits(t *testing.T) {
+	q := newInboundQueue(queueOptions{maxConcurrent: 1, coalesce: 20 * time.Millisecond, maxWait: 80 * time.Millisecond, maxPending: 3})
+	ctx := context.Background()
+
+	q.add(chatMessage("1", "first"), time.Now())
+	q.add(chatMessage("1", "second"), time.Now())
+	q.add(chatMessage("1", "/help"), time.Now())
+	q.add(chatMessage("2", "hello"), time.Now())
+
+	chat, msg, ok := q.next(ctx)
+	if !ok || chat != "telegram:1" || msg.Content != "first\nsecond" {
+		t.Fatalf("first round = %q %q, want chat 1's burst merged", chat, msg.Content)
+	}
+
+	// The only slot is taken, so no other round starts
+	short, cancel := context.WithTimeout(ctx, 60*time.Millisecond)
+	defer cancel()
+	if chat, _, ok := q.next(short); ok {
+		t.Fatalf("a round for %s started past the limit", chat)
+	}
+
+	q.add(chatMessage("1", "third"), time.Now())
+	q.done("telegram:1")
+	if chat, msg, _ := q.next(ctx); chat != "telegram:2" || msg.Content != "hello" {
+		t.Errorf("second round = %s %q, want chat 2, waiting longest", chat, msg.Content)
+	}
+	q.done("telegram:2")
+	if _, msg, _ := q.next(ctx); msg.Content != "/help" {
+		t.Errorf("third round = %q, want the command on its own", msg.Content)
+	}
+
+	notices := 0
+	for i := 0; i < 4; i++ {
+		if q.add(chatMessage("3", "spam"), time.Now()) {
+			notices++
+		}
+	}
+	if notices != 1 {
+		t.Errorf("overflow notices = %d, want 1", notices)
+	}
+	if waiting := q.drain(); len(waiting) != 4 {
+		t.Errorf("drained %d messages, want chat 1's third and chat 3's three", len(waiting))
+	}
+}
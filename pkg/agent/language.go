@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// conversationLanguages remembers the language each chat last wrote in,
+// so a reply to "ok", a link or a photo keeps the conversation's language
+// instead of falling back to the profile's.
+type conversationLanguages struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+func newConversationLanguages() *conversationLanguages {
+	return &conversationLanguages{last: make(map[string]string)}
+}
+
+// observe detects the language of a message from the chat and returns
+// the conversation's language after it, "" while none is known.
+func (c *conversationLanguages) observe(chatKey, text string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lang := locale.Detect(text); lang != "" {
+		c.last[chatKey] = lang
+	}
+	return c.last[chatKey]
+}
+
+// current returns the chat's language, "" while none is known.
+func (c *conversationLanguages) current(chatKey string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last[chatKey]
+}
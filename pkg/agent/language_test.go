@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// systemPromptProvider keeps the system prompt of the last call.
+type systemPromptProvider struct {
+	prompt string
+}
+
+func (p *systemPromptProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.prompt = messages[0].Content
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *systemPromptProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+// TestAgentLoop_RepliesInTheLanguageOfTheMessage verifies the reply language follows what the user writes in, short messages keep the conversation's language, and a fixed profile language wins
+func TestAgentLoop_RepliesInTheLanguageOfTheMessage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &systemPromptProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.profiles.Set("test:chat1", profile.Profile{Locale: "pt-BR", Language: "Portuguese"})
+	helper := testHelper{al: al}
+
+	send := func(text string) {
+		helper.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+			Channel: "test", SenderID: "user1", ChatID: "chat1", Content: text, SessionKey: "test-session",
+		})
+	}
+	steps := []struct {
+		message, want, locale string
+	}{
+		{"Can you check my calendar for tomorrow please?", "The user is writing in English", "en"},
+		{"ok", "The user is writing in English", "en"},
+		{"Você pode ver a minha agenda de amanhã?", "The user is writing in Portuguese", "pt-BR"},
+	}
+	for _, step := range steps {
+		send(step.message)
+		if !strings.Contains(provider.prompt, step.want) {
+			t.Errorf("after %q the prompt lacks %q", step.message, step.want)
+		}
+		if got := al.replyLocale(processOptions{Channel: "test", ChatID: "chat1", UserMessage: step.message}); got != step.locale {
+			t.Errorf("after %q tool replies use locale %q, want %q", step.message, got, step.locale)
+		}
+	}
+
+	al.profiles.Set("test:chat1", profile.Profile{Locale: "de-DE", Language: "German", FixedLanguage: true})
+	send("Can you check my calendar for tomorrow please?")
+	if !strings.Contains(provider.prompt, "Always reply in German") || strings.Contains(provider.prompt, "is writing in") {
+		t.Errorf("fixed language ignored:\n%s", provider.prompt)
+	}
+	if got := al.replyLocale(processOptions{Channel: "test", ChatID: "chat1", UserMessage: "hello there, how are you?"}); got != "de-DE" {
+		t.Errorf("fixed language: tool replies use locale %q", got)
+	}
+}
+
+// TestAgentLoop_FollowsStylePreferences verifies the profile's verbosity, emoji, clock and units reach the system prompt, the locale tools format in and the messages sent to the chat
+func TestAgentLoop_FollowsStylePreferences(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &systemPromptProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.profiles.Set("test:chat1", profile.Profile{Locale: "en-GB", Verbosity: "concise", NoEmoji: true, Clock: "12h", Units: "imperial"})
+	helper := testHelper{al: al}
+
+	helper.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+		Channel: "test", SenderID: "user1", ChatID: "chat1", Content: "What's on my calendar tomorrow?", SessionKey: "test-session",
+	})
+	for _, want := range []string{"Replies: concise", "Keep replies short", "Do not use emoji.", "12-hour clock", "imperial units"} {
+		if !strings.Contains(provider.prompt, want) {
+			t.Errorf("the prompt lacks %q", want)
+		}
+	}
+	if got := al.replyLocale(processOptions{Channel: "test", ChatID: "chat1", UserMessage: "What's on my calendar tomorrow?"}); got != "en-GB-u-hc-h12-ms-ussystem" {
+		t.Errorf("tool replies use locale %q", got)
+	}
+
+	msg, _ := al.filterOutbound(bus.OutboundMessage{Channel: "test", ChatID: "chat1", Content: "⏰ Bills due soon:\n- EDP ✅ paid"})
+	if msg.Content != "Bills due soon:\n- EDP paid" {
+		t.Errorf("Expected the emoji taken out, got %q", msg.Content)
+	}
+	if msg, _ := al.filterOutbound(bus.OutboundMessage{Channel: "test", ChatID: "chat2", Content: "⏰ Bills"}); msg.Content != "⏰ Bills" {
+		t.Errorf("Expected other chats to keep emoji, got %q", msg.Content)
+	}
+}
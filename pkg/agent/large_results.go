@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// largeResultExcerpt is how much of a large result stays in the model's
+// context, from its start.
+const largeResultExcerpt = 1500
+
+// deliverLargeResult sends a tool result longer than the configured limit
+// (a long file listing, a whole email thread) to the chat as a Markdown
+// document and returns what the model gets instead: the start of the
+// result and where the rest went. It returns false, and the model gets
+// the result as is, when the result is short enough, the limit is off, or
+// the chat cannot receive the document.
+func (al *AgentLoop) deliverLargeResult(opts processOptions, toolName, content string) (string, bool) {
+	al.cfgMu.RLock()
+	limit := al.cfg.Agents.Defaults.LargeResultChars
+	al.cfgMu.RUnlock()
+	if limit <= 0 || utf8.RuneCountInString(content) <= limit {
+		return "", false
+	}
+	if opts.ChatID == "" || constants.IsInternalChannel(opts.Channel) {
+		return "", false
+	}
+
+	lines := strings.Count(strings.TrimRight(content, "\n"), "\n") + 1
+	doc := fmt.Sprintf("# %s result\n\n_%s, %d lines_\n\n%s\n", toolName, time.Now().Format("2006-01-02 15:04"), lines, content)
+	caps, ok := al.bus.Capabilities(opts.Channel)
+	if !ok || caps.CanSend("text/markdown", int64(len(doc))) != nil {
+		return "", false
+	}
+	name := fmt.Sprintf("%s-%s.md", toolName, time.Now().Format("20060102-150405"))
+	artifact, err := al.artifacts.Put(strings.NewReader(doc), name, "text/markdown", toolName, artifacts.DefaultTTL)
+	if err != nil {
+		logger.WarnCF("agent", "Could not store a large tool result", map[string]interface{}{
+			"tool":  toolName,
+			"error": err.Error(),
+		})
+		return "", false
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: opts.Channel,
+		ChatID:  opts.ChatID,
+		Media:   []string{artifact.Path},
+	})
+	logger.InfoCF("agent", "Sent a large tool result as a document", map[string]interface{}{
+		"tool":     toolName,
+		"chars":    len(content),
+		"artifact": artifact.ID,
+	})
+
+	excerpt := content
+	if cut := byteOffsetOfRune(content, largeResultExcerpt); cut < len(content) {
+		excerpt = content[:cut]
+		if nl := strings.LastIndex(excerpt, "\n"); nl > len(excerpt)/2 {
+			excerpt = excerpt[:nl]
+		}
+	}
+	return fmt.Sprintf("%s\n\n[Result truncated: %d lines, %d characters in all. The full result was sent to the user as the document %s, so do not repeat it; summarize what matters. Read %s with read_file if you need more of it.]",
+		excerpt, lines, utf8.RuneCountInString(content), name, artifact.Ref()), true
+}
+
+// byteOffsetOfRune returns where the n-th rune of s starts, or len(s).
+func byteOffsetOfRune(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
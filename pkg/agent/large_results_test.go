@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// listingTool returns one line per file, like a long directory listing
+type listingTool struct{ lines int }
+
+func (t listingTool) Name() string        { return "listing" }
+func (t listingTool) Description() string { return "lists files" }
+func (t listingTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t listingTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	var sb strings.Builder
+	for i := 1; i <= t.lines; i++ {
+		fmt.Fprintf(&sb, "file-%04d.txt\n", i)
+	}
+	return tools.SilentResult(sb.String())
+}
+
+// TestLargeResults_SentAsDocument verifies a result over the limit reaches the chat as a Markdown document while the model only gets its start
+func TestLargeResults_SentAsDocument(t *testing.T) {
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+		Workspace:         t.TempDir(),
+		Model:             "test-model",
+		MaxTokens:         4096,
+		MaxToolIterations: 5,
+		LargeResultChars:  2000,
+	}}}
+	msgBus := bus.NewMessageBus()
+	msgBus.SetCapabilities(func(channel string) (bus.Capabilities, bool) {
+		if channel == "telegram" {
+			return bus.Capabilities{MaxFileBytes: 10 << 20, MediaTypes: []string{"text/markdown"}}, true
+		}
+		return bus.Capabilities{}, true
+	})
+	provider := testkit.NewProvider(
+		testkit.CallTool("listing", nil), testkit.Say("500 files"),
+		testkit.CallTool("listing", nil), testkit.Say("500 files"))
+	al := NewAgentLoop(cfg, msgBus, provider)
+	al.RegisterTool(listingTool{lines: 500})
+	al.RestartTools()
+	ctx := context.Background()
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7", SessionKey: "telegram:7", Content: "list"}
+	if reply, err := al.processMessage(ctx, msg); err != nil || reply != "500 files" {
+		t.Fatalf("reply = %q, err %v", reply, err)
+	}
+	toModel := provider.Calls()[1].LastMessage()
+	if len(toModel) > 2000 || !strings.HasPrefix(toModel, "file-0001.txt\n") || !strings.Contains(toModel, "500 lines") || !strings.Contains(toModel, "artifact:") {
+		t.Errorf("model got %d chars:\n%s", len(toModel), toModel)
+	}
+
+	subCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	out, ok := msgBus.SubscribeOutbound(subCtx)
+	if !ok || len(out.Media) != 1 || out.Content != "" || out.ChatID != "7" {
+		t.Fatalf("unexpected outbound %+v", out)
+	}
+	doc, err := os.ReadFile(out.Media[0])
+	if err != nil || !strings.HasPrefix(string(doc), "# listing result") || !strings.Contains(string(doc), "file-0500.txt") {
+		t.Errorf("unexpected document %s: %v", out.Media[0], err)
+	}
+
+	// A chat that only takes text keeps the whole result in context
+	msg = bus.InboundMessage{Channel: "whatsapp", ChatID: "9", SenderID: "9", SessionKey: "whatsapp:9", Content: "list"}
+	al.processMessage(ctx, msg)
+	if toModel := provider.Calls()[3].LastMessage(); !strings.Contains(toModel, "file-0500.txt") {
+		t.Errorf("text-only chat lost the result: %d chars", len(toModel))
+	}
+}
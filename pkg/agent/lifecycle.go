@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/tasks"
+)
+
+// maxResumeAttempts drops a message that was cut short this many times, so
+// one that crashes the gateway cannot keep it in a restart loop.
+const maxResumeAttempts = 3
+
+// resumeAttemptsKey counts earlier tries in a resumed message's metadata.
+const resumeAttemptsKey = "resume_attempts"
+
+// resumeRoundKey names, in a resumed message's metadata, the round it was
+// first handled in, whose changes are not made again.
+const resumeRoundKey = "resume_round"
+
+// roundCallsTTL is how long the changes made by a round are remembered
+// for a resumed round to skip.
+const roundCallsTTL = 7 * 24 * time.Hour
+
+// Shutdown stops taking new messages and waits for the rounds being
+// processed, including their tool calls, to finish. If ctx ends first the
+// rounds are cancelled without a reply and stay journaled, so they are
+// redone on the next start.
+func (al *AgentLoop) Shutdown(ctx context.Context) error {
+	al.running.Store(false)
+	// Background tasks stop where they are and go on at the next start
+	al.tasks.Stop()
+	al.polls.Stop()
+	al.lifeMu.Lock()
+	stop, done := al.stopConsuming, al.done
+	al.lifeMu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	al.abandoning.Store(true)
+	al.current.cancelAll()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+	}
+	return ctx.Err()
+}
+
+func (al *AgentLoop) resumeEnabled() bool {
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	return al.cfg != nil && al.cfg.Gateway.ResumeWork && !al.journalOff.Load()
+}
+
+// journal records msg as in progress and returns its journal ID, or 0 when
+// journaling is off.
+func (al *AgentLoop) journal(ctx context.Context, msg bus.InboundMessage) int64 {
+	if !al.resumeEnabled() {
+		return 0
+	}
+	attempts, _ := strconv.Atoi(msg.Metadata[resumeAttemptsKey])
+	id, err := al.store.Inbox.Add(context.WithoutCancel(ctx), msg, attempts)
+	if err != nil {
+		al.journalFailed(err)
+		return 0
+	}
+	return id
+}
+
+func (al *AgentLoop) unjournal(ctx context.Context, id int64) {
+	if id == 0 {
+		return
+	}
+	if err := al.store.Inbox.Done(context.WithoutCancel(ctx), id); err != nil {
+		al.journalFailed(err)
+	}
+}
+
+// journalRound is the name the changes made handling msg are recorded
+// under: the journal ID it was first handled with.
+func journalRound(msg bus.InboundMessage, journalID int64) string {
+	if round := msg.Metadata[resumeRoundKey]; round != "" {
+		return round
+	}
+	return strconv.FormatInt(journalID, 10)
+}
+
+// roundCalls keeps the changes made by journaled rounds in the state
+// store, so a resumed round reports them instead of making them again.
+type roundCalls struct {
+	db *store.DB
+}
+
+func (r roundCalls) Done(ctx context.Context, key string) (string, bool) {
+	result, ok, err := r.db.Idempotency.Result(context.WithoutCancel(ctx), key)
+	return result, ok && err == nil
+}
+
+func (r roundCalls) Record(ctx context.Context, key, result string) {
+	ctx = context.WithoutCancel(ctx)
+	_, err := r.db.Idempotency.Claim(ctx, key, roundCallsTTL)
+	if err == nil {
+		err = r.db.Idempotency.Complete(ctx, key, result)
+	}
+	if err != nil {
+		logger.WarnCF("agent", "Could not record a change for resuming", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// journalFailed turns journaling off after the first error (usually no
+// sqlite3), so every message does not pay for a failing write.
+func (al *AgentLoop) journalFailed(err error) {
+	if al.journalOff.CompareAndSwap(false, true) {
+		logger.WarnCF("agent", "Message journal unavailable; interrupted work will not be resumed",
+			map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// PersistQueued saves messages still waiting for the connection, in the
+// inbound queue or on the bus, in either direction, so ResumeQueued can
+// pick them up after a restart. Call it after Shutdown and once channels have stopped sending.
+func (al *AgentLoop) PersistQueued(ctx context.Context) (inbound, outbound int) {
+	pendingIn := append(al.offline.heldMessages(), al.inbound.drain()...)
+	pendingIn = append(pendingIn, al.bus.DrainInbound()...)
+	pendingOut := al.bus.DrainOutbound()
+	if !al.resumeEnabled() {
+		if len(pendingIn)+len(pendingOut) > 0 {
+			logger.WarnCF("agent", "Dropping queued messages on shutdown", map[string]interface{}{
+				"inbound":  len(pendingIn),
+				"outbound": len(pendingOut),
+			})
+		}
+		return 0, 0
+	}
+	for _, msg := range pendingIn {
+		attempts, _ := strconv.Atoi(msg.Metadata[resumeAttemptsKey])
+		if _, err := al.store.Inbox.Add(ctx, msg, attempts); err != nil {
+			al.journalFailed(err)
+			break
+		}
+		inbound++
+	}
+	for _, msg := range pendingOut {
+		if constants.IsInternalChannel(msg.Channel) {
+			continue
+		}
+		if _, err := al.store.Outbox.Enqueue(ctx, msg.Channel, msg.ChatID, msg.Content); err != nil {
+			al.journalFailed(err)
+			break
+		}
+		outbound++
+	}
+	return inbound, outbound
+}
+
+// ResumeQueued puts journaled work back on the bus: messages whose
+// processing was cut short and replies that were never sent. A resumed
+// message's round is run again, but the changes it already made are
+// reported to the model instead of being made twice. Run must already be
+// consuming, as the inbound queue is bounded.
+func (al *AgentLoop) ResumeQueued(ctx context.Context) (inbound, outbound int) {
+	if !al.resumeEnabled() {
+		return 0, 0
+	}
+	items, err := al.store.Inbox.Pending(ctx)
+	if err != nil {
+		al.journalFailed(err)
+		return 0, 0
+	}
+	al.store.Idempotency.Prune(ctx)
+	for _, item := range items {
+		if err := al.store.Inbox.Done(ctx, item.ID); err != nil {
+			al.journalFailed(err)
+			return inbound, outbound
+		}
+		if item.Attempts+1 >= maxResumeAttempts {
+			logger.WarnCF("agent", "Dropping message interrupted too many times", map[string]interface{}{
+				"channel":  item.Message.Channel,
+				"chat_id":  item.Message.ChatID,
+				"attempts": item.Attempts + 1,
+			})
+			continue
+		}
+		msg := item.Message
+		metadata := make(map[string]string, len(msg.Metadata)+1)
+		for k, v := range msg.Metadata {
+			metadata[k] = v
+		}
+		metadata[resumeAttemptsKey] = strconv.Itoa(item.Attempts + 1)
+		if metadata[resumeRoundKey] == "" {
+			metadata[resumeRoundKey] = strconv.FormatInt(item.ID, 10)
+		}
+		msg.Metadata = metadata
+		al.bus.PublishInbound(msg)
+		inbound++
+	}
+
+	replies, err := al.store.Outbox.Pending(ctx, time.Now(), 1000)
+	if err != nil {
+		al.journalFailed(err)
+		return inbound, outbound
+	}
+	for _, item := range replies {
+		al.bus.PublishOutbound(bus.OutboundMessage{Channel: item.Channel, ChatID: item.ChatID, Content: item.Content})
+		al.store.Outbox.MarkSent(ctx, item.ID)
+		outbound++
+	}
+	if inbound+outbound > 0 {
+		logger.InfoCF("agent", "Resumed interrupted work", map[string]interface{}{
+			"inbound":  inbound,
+			"outbound": outbound,
+		})
+	}
+	return inbound, outbound
+}
+
+// ResumeTasks starts again the background tasks, such as backups, that
+// were running when the gateway last stopped, and the clock that closes
+// polls.
+func (al *AgentLoop) ResumeTasks() {
+	al.tasks.Restore()
+	al.polls.Start()
+}
+
+// announceTask tells a chat that one of its background tasks finished.
+func (al *AgentLoop) announceTask(t tasks.Task) {
+	msg := "✅ " + t.Name + " finished"
+	if t.Status == tasks.Failed {
+		msg = "⚠️ " + t.Name + " failed: " + t.Error
+	}
+	if t.Result != "" {
+		msg += "\n" + t.Result
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{Channel: t.Channel, ChatID: t.ChatID, Content: msg})
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// blockingProvider answers only once released, or fails when cancelled.
+type blockingProvider struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.started <- struct{}{}
+	select {
+	case <-p.release:
+		return &providers.LLMResponse{Content: "done"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *blockingProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func newLifecycleTestLoop(t *testing.T, workspace string, provider providers.LLMProvider) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Gateway: config.GatewayConfig{ResumeWork: true},
+	}
+	msgBus := bus.NewMessageBus()
+	return NewAgentLoop(cfg, msgBus, provider), msgBus
+}
+
+// TestShutdown_InterruptedRoundIsResumed verifies a round cut short by the deadline is journaled and redone on the next start
+func TestShutdown_InterruptedRoundIsResumed(t *testing.T) {
+	workspace := t.TempDir()
+	provider := &blockingProvider{started: make(chan struct{}, 1), release: make(chan struct{})}
+	al, msgBus := newLifecycleTestLoop(t, workspace, provider)
+
+	go al.Run(context.Background())
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "42", ChatID: "1", Content: "plan my week", SessionKey: "telegram:1"})
+	<-provider.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := al.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want deadline exceeded", err)
+	}
+	if _, out := msgBus.QueueDepths(); out != 0 {
+		t.Error("an interrupted round should not reply")
+	}
+
+	next, nextBus := newLifecycleTestLoop(t, workspace, &mockProvider{})
+	if in, _ := next.ResumeQueued(context.Background()); in != 1 {
+		t.Fatalf("resumed %d messages, want 1", in)
+	}
+	msg, _ := nextBus.ConsumeInbound(context.Background())
+	if msg.Content != "plan my week" || msg.Metadata[resumeAttemptsKey] != "1" {
+		t.Errorf("resumed message = %+v", msg)
+	}
+}
+
+// TestShutdown_WaitsForRoundToFinish verifies a round that finishes in time replies and leaves nothing to resume
+func TestShutdown_WaitsForRoundToFinish(t *testing.T) {
+	workspace := t.TempDir()
+	provider := &blockingProvider{started: make(chan struct{}, 1), release: make(chan struct{})}
+	al, msgBus := newLifecycleTestLoop(t, workspace, provider)
+
+	go al.Run(context.Background())
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "42", ChatID: "1", Content: "hi", SessionKey: "telegram:1"})
+	<-provider.started
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(provider.release)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := al.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if reply, ok := msgBus.SubscribeOutbound(ctx); !ok || reply.Content != "done" {
+		t.Errorf("reply = %+v", reply)
+	}
+	if in, _ := al.ResumeQueued(context.Background()); in != 0 {
+		t.Errorf("finished round should not be resumed, got %d", in)
+	}
+}
+
+// TestPersistQueued_UnsentRepliesGoOutOnRestart verifies queued replies survive a restart
+func TestPersistQueued_UnsentRepliesGoOutOnRestart(t *testing.T) {
+	workspace := t.TempDir()
+	al, msgBus := newLifecycleTestLoop(t, workspace, &mockProvider{})
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "your parcel arrived"})
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "system", ChatID: "x", Content: "internal"})
+
+	if _, out := al.PersistQueued(context.Background()); out != 1 {
+		t.Fatalf("persisted %d replies, want 1", out)
+	}
+
+	next, nextBus := newLifecycleTestLoop(t, workspace, &mockProvider{})
+	if _, out := next.ResumeQueued(context.Background()); out != 1 {
+		t.Fatalf("resumed %d replies, want 1", out)
+	}
+	reply, _ := nextBus.SubscribeOutbound(context.Background())
+	if reply.Content != "your parcel arrived" {
+		t.Errorf("reply = %+v", reply)
+	}
+	if _, out := next.ResumeQueued(context.Background()); out != 0 {
+		t.Error("a resumed reply should not be sent twice")
+	}
+}
+
+// toolThenBlockProvider asks for one tool call, then blocks like
+// blockingProvider.
+type toolThenBlockProvider struct {
+	blockingProvider
+	call   providers.ToolCall
+	called bool
+}
+
+func (p *toolThenBlockProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	if !p.called {
+		p.called = true
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{p.call}}, nil
+	}
+	return p.blockingProvider.Chat(ctx, messages, tools, model, opts)
+}
+
+// TestResumeQueued_SkipsChangesAlreadyMade verifies a round cut short after a changing tool call is resumed without making that call again, while its other calls still run
+func TestResumeQueued_SkipsChangesAlreadyMade(t *testing.T) {
+	workspace := t.TempDir()
+	provider := &toolThenBlockProvider{
+		blockingProvider: blockingProvider{started: make(chan struct{}, 1), release: make(chan struct{})},
+		call:             addNotes("milk").ToolCalls[0],
+	}
+	al, msgBus := newLifecycleTestLoop(t, workspace, provider)
+	notes := &noteTool{}
+	al.RegisterTool(notes)
+
+	go al.Run(context.Background())
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "42", ChatID: "1", Content: "add milk and eggs", SessionKey: "telegram:1"})
+	<-provider.started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := al.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want deadline exceeded", err)
+	}
+	if len(notes.added) != 1 {
+		t.Fatalf("added before the crash = %v", notes.added)
+	}
+
+	replay := testkit.NewProvider(addNotes("milk", "eggs"), testkit.Say("Added milk and eggs."))
+	next, nextBus := newLifecycleTestLoop(t, workspace, replay)
+	nextNotes := &noteTool{}
+	next.RegisterTool(nextNotes)
+	if in, _ := next.ResumeQueued(context.Background()); in != 1 {
+		t.Fatalf("resumed %d messages, want 1", in)
+	}
+	msg, _ := nextBus.ConsumeInbound(context.Background())
+	next.handleInbound(context.Background(), msg)
+	if len(nextNotes.added) != 1 || nextNotes.added[0] != "eggs" {
+		t.Errorf("added on resume = %v, want only eggs", nextNotes.added)
+	}
+	if reply, _ := nextBus.SubscribeOutbound(context.Background()); reply.Content != "Added milk and eggs." {
+		t.Errorf("reply = %+v", reply)
+	}
+}
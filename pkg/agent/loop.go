@@ -9,25 +9,52 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
+	"github.com/sipeed/picoclaw/pkg/artifacts"
+	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/automation"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/dlp"
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/embeddings"
+	"github.com/sipeed/picoclaw/pkg/features"
+	"github.com/sipeed/picoclaw/pkg/governor"
+	"github.com/sipeed/picoclaw/pkg/httprec"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/janitor"
+	"github.com/sipeed/picoclaw/pkg/locale"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mediaindex"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/outage"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/replay"
+	"github.com/sipeed/picoclaw/pkg/screening"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/storage"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/tasks"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tracing"
+	"github.com/sipeed/picoclaw/pkg/transfer"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+	"github.com/sipeed/picoclaw/pkg/webhooks"
 )
 
 type AgentLoop struct {
@@ -39,11 +66,63 @@ type AgentLoop struct {
 	maxIterations  int
 	sessions       *session.SessionManager
 	state          *state.Manager
+	profiles       *profile.Store
+	languages      *conversationLanguages
+	identities     *identity.Store       // Accounts linked to the same person
+	confirmations  *tools.Confirmations  // Changes waiting for a user's yes
+	plans          *tools.Plans          // Multi-step changes waiting for approval or running
+	clarifications *tools.Clarifications // Calls waiting for a user's pick
+	pdfPasswords   *tools.PDFPasswords   // Calls waiting for a protected PDF's password
+	hooks          *webhooks.Dispatcher  // Events posted to external systems
+	automations    *automation.Store     // Schedules, templates and rules from YAML files
+	artifacts      *artifacts.Store
+	store          *store.DB
 	contextBuilder *ContextBuilder
 	tools          *tools.ToolRegistry
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
 	channelManager *channels.Manager
+	subagents      *tools.SubagentManager
+	subagentTools  *tools.ToolRegistry
+	paused         atomic.Bool
+	current        messageTasks
+	inbound        *inboundQueue // Messages waiting for a round, per chat
+	usage          *usageTracker
+	started        time.Time
+	guard          *dlp.Guard // Content policy for outgoing messages and uploads
+	undo           *tools.UndoJournal
+	mail           *tools.MailOutbox // Emails waiting for Gmail to be reachable
+	archive        *tools.MediaArchiver
+	quotas         *quotaTracker
+	critical       *tools.CriticalReminders  // Critical reminders waiting for an answer
+	digest         *tools.NotificationDigest // Notifications held for chats in digest mode
+	tasks          *tasks.Manager            // Long operations running in the background
+	polls          *tools.Polls              // Polls posted to chats, until their results are in
+	memories       *tools.MemoryBook         // What is remembered about each chat's user
+	entities       *tools.EntityBook         // People, files and events the tools mentioned, by chat
+	offline        *offlineMode              // nil when offline mode is disabled
+	outages        *outage.Tracker           // nil when outage tracking is disabled
+	residency      *residencyProvider        // Keeps local-only chats on the local model
+	deferred       *tools.DeferredActions    // Changes waiting for the connection or a service
+	features       *features.Flags           // Experimental subsystems turned on or off
+	resources      governor.Resources        // RAM and CPUs found at startup
+	disk           *janitor.Janitor          // Keeps downloads and caches within the disk budget
+
+	// Shutdown stops Run taking messages through stopConsuming and waits
+	// on done; abandoning marks a round cut short by the deadline
+	lifeMu        sync.Mutex
+	stopConsuming context.CancelFunc
+	done          chan struct{}
+	abandoning    atomic.Bool
+	journalOff    atomic.Bool
+
+	// Guards what a config reload or tool restart replaces
+	cfgMu         sync.RWMutex
+	cfg           *config.Config
+	owners        []string
+	extraTools    []tools.Tool
+	onToolsReload []func()
+	reloadConfig  func() (string, error)
 }
 
 // processOptions configures how a message is processed
@@ -51,11 +130,17 @@ type processOptions struct {
 	SessionKey      string // Session identifier for history/context
 	Channel         string // Target channel for tool execution
 	ChatID          string // Target chat ID for tool execution
+	SenderID        string // Sender the request comes from, for tool policies
 	UserMessage     string // User message content (may include prefix)
 	DefaultResponse string // Response when LLM returns empty
 	EnableSummary   bool   // Whether to trigger summarization
 	SendResponse    bool   // Whether to send response via bus
 	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	Limited         bool   // Whether the sender's daily quotas apply
+
+	// Media are the user message's attachments; an image routes the turn
+	// to the vision model
+	Media []string
 }
 
 // createToolRegistry creates a tool registry with common tools.
@@ -86,6 +171,61 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 		registry.Register(searchTool)
 	}
 	registry.Register(tools.NewWebFetchTool(50000))
+	registry.Register(tools.NewCalculatorTool())
+
+	if issuesTool := newIssuesTool(cfg); issuesTool != nil {
+		registry.Register(issuesTool)
+	}
+
+	if cfg.Tools.Finance.Enabled {
+		var stocks, crypto tools.PriceProvider
+		if cfg.Tools.Finance.StockProvider == "yahoo" {
+			stocks = tools.NewYahooFinanceProvider()
+		}
+		if cfg.Tools.Finance.CryptoProvider == "coingecko" {
+			crypto = tools.NewCoinGeckoProvider(cfg.Tools.Finance.Currency)
+		}
+		checkInterval := time.Duration(cfg.Tools.Finance.AlertCheckMinutes) * time.Minute
+		registry.Register(tools.NewFinanceTool(stocks, crypto, workspace, checkInterval))
+	}
+
+	if cfg.Tools.Tracking.Enabled {
+		var flights tools.FlightTracker
+		var parcels tools.ParcelTracker
+		if cfg.Tools.Tracking.AviationStackAPIKey != "" {
+			flights = tools.NewAviationStackTracker(cfg.Tools.Tracking.AviationStackAPIKey)
+		}
+		switch cfg.Tools.Tracking.ParcelProvider {
+		case "aftership":
+			if cfg.Tools.Tracking.AfterShipAPIKey != "" {
+				parcels = tools.NewAfterShipTracker(cfg.Tools.Tracking.AfterShipAPIKey)
+			}
+		case "17track":
+			if cfg.Tools.Tracking.SeventeenTrackKey != "" {
+				parcels = tools.NewSeventeenTrackTracker(cfg.Tools.Tracking.SeventeenTrackKey)
+			}
+		}
+		checkInterval := time.Duration(cfg.Tools.Tracking.CheckMinutes) * time.Minute
+		registry.Register(tools.NewTrackingTool(flights, parcels, checkInterval))
+	}
+
+	if cfg.Tools.News.Enabled {
+		var providers []tools.NewsProvider
+		if cfg.Tools.News.NewsAPIKey != "" {
+			providers = append(providers, tools.NewNewsAPIProvider(cfg.Tools.News.NewsAPIKey))
+		}
+		if cfg.Tools.News.GDELT {
+			providers = append(providers, tools.NewGDELTProvider())
+		}
+		if len(cfg.Tools.News.Feeds) > 0 {
+			providers = append(providers, tools.NewRSSProvider(cfg.Tools.News.Feeds))
+		}
+		registry.Register(tools.NewNewsTool(providers, cfg.Tools.News.MaxResults))
+	}
+
+	if cfg.Tools.Contacts.Enabled {
+		registry.Register(tools.NewContactsTool(newContactDirectory(workspace, cfg)))
+	}
 
 	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 	registry.Register(tools.NewI2CTool())
@@ -102,44 +242,852 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 		})
 		return nil
 	})
+	messageTool.SetMediaCallback(func(channel, chatID, caption string, media []string) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: caption,
+			Media:   media,
+		})
+		return nil
+	})
+	messageTool.SetCapabilities(msgBus.Capabilities)
+	messageTool.SetDocuments(workspace, filepath.Join(workspace, "cache", "previews"))
 	registry.Register(messageTool)
 
 	return registry
 }
 
-func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
-	workspace := cfg.WorkspacePath()
-	os.MkdirAll(workspace, 0755)
+// newIssuesTool builds the Jira/Linear issue tool from config.
+// Returns nil when the tool is disabled or no projects are configured.
+func newIssuesTool(cfg *config.Config) *tools.IssuesTool {
+	issuesCfg := cfg.Tools.Issues
+	if !issuesCfg.Enabled || len(issuesCfg.Projects) == 0 {
+		return nil
+	}
+
+	trackers := make(map[string]tools.IssueTracker)
+	if issuesCfg.Jira.BaseURL != "" && issuesCfg.Jira.APIToken != "" {
+		trackers["jira"] = tools.NewJiraTracker(issuesCfg.Jira.BaseURL, issuesCfg.Jira.Email, issuesCfg.Jira.APIToken)
+	}
+	if issuesCfg.Linear.APIKey != "" {
+		trackers["linear"] = tools.NewLinearTracker(issuesCfg.Linear.APIKey)
+	}
+
+	projects := make([]tools.IssueProject, 0, len(issuesCfg.Projects))
+	for _, p := range issuesCfg.Projects {
+		if _, ok := trackers[p.Provider]; !ok {
+			logger.WarnCF("agent", "Skipping issue project with unconfigured provider",
+				map[string]interface{}{"project": p.Name, "provider": p.Provider})
+			continue
+		}
+		projects = append(projects, tools.IssueProject{
+			Name:      p.Name,
+			Provider:  p.Provider,
+			Project:   p.Project,
+			IssueType: p.IssueType,
+			Labels:    p.Labels,
+		})
+	}
+	if len(projects) == 0 {
+		return nil
+	}
+
+	return tools.NewIssuesTool(projects, trackers)
+}
+
+// googleTokenFunc returns an access token getter for the account stored by
+// `picoclaw auth login --provider google`.
+func googleTokenFunc(cfg *config.Config) tools.TokenFunc {
+	source := auth.NewGoogleTokenSource(auth.NewGoogleOAuthConfig(
+		cfg.Google.ClientID, cfg.Google.ClientSecret, cfg.Google.Scopes))
+	return source.AccessToken
+}
+
+// googleTokenRefresh replaces a token Google refused, or is nil when
+// Google is not set up.
+func googleTokenRefresh(cfg *config.Config) tools.GoogleTokenRefresh {
+	if cfg.Google.ClientID == "" {
+		return nil
+	}
+	source := auth.NewGoogleTokenSource(auth.NewGoogleOAuthConfig(
+		cfg.Google.ClientID, cfg.Google.ClientSecret, cfg.Google.Scopes))
+	return source.Refresh
+}
+
+// httpRecordDir is where tool calls' HTTP traffic is recorded, or "" when
+// recording is off.
+func httpRecordDir(cfg *config.Config) string {
+	if !cfg.Debug.RecordHTTP {
+		return ""
+	}
+	if cfg.Debug.RecordDir != "" {
+		return cfg.Debug.RecordDir
+	}
+	return filepath.Join(cfg.WorkspacePath(), "debug", "http")
+}
+
+// egressPolicy converts the egress section of the config.
+func egressPolicy(cfg *config.Config) egress.Policy {
+	e := cfg.Egress
+	return egress.Policy{
+		Allow:        e.Allow,
+		Deny:         e.Deny,
+		BlockPrivate: e.BlockPrivate,
+		MaxRedirects: e.MaxRedirects,
+	}
+}
+
+// screeningPolicy is what email attachments are screened against.
+func screeningPolicy(cfg *config.Config) screening.Policy {
+	s := cfg.Screening
+	return screening.Policy{
+		MaxBytes:      int64(s.MaxSizeMB) << 20,
+		Block:         s.Block,
+		Allow:         s.Allow,
+		ClamAV:        s.ClamAV,
+		VirusTotalKey: s.VirusTotalAPIKey,
+	}
+}
+
+// resourceLimits sizes the limits on heavy work for a device with r to
+// spare, or as configured.
+func resourceLimits(cfg *config.Config, r governor.Resources) governor.Limits {
+	l := governor.LimitsFor(r, cfg.Resources.MaxHeavyOps)
+	if cfg.Resources.MaxWaitSeconds > 0 {
+		l.MaxWait = time.Duration(cfg.Resources.MaxWaitSeconds) * time.Second
+	}
+	return l
+}
+
+// undoToken is the Google token the undo journal reverses Google changes
+// with, or nil when Google is not set up.
+func undoToken(cfg *config.Config) tools.TokenFunc {
+	if cfg.Google.ClientID == "" {
+		return nil
+	}
+	return googleTokenFunc(cfg)
+}
+
+// travelPlanner works out travel times to calendar events, or is nil
+// when travel_time is off.
+func travelPlanner(cfg *config.Config) *tools.TravelPlanner {
+	travel := cfg.Tools.TravelTime
+	if !travel.Enabled || travel.MapsAPIKey == "" {
+		return nil
+	}
+	return tools.NewTravelPlanner(tools.NewGoogleMapsTravel(travel.MapsAPIKey), tools.NewGoogleCalendarClient(googleTokenFunc(cfg)), tools.TravelOptions{
+		Home:    travel.Home,
+		Mode:    travel.Mode,
+		Buffers: travel.Buffers,
+	})
+}
+
+// newTransitTool creates the transit tool, with what the config has of a
+// timetable, a routes key and the calendar.
+func newTransitTool(cfg *config.Config, profiles *profile.Store) *tools.TransitTool {
+	transit := cfg.Tools.Transit
+	var feed *tools.GTFSFeed
+	if path := cfg.TransitGTFSPath(); path != "" {
+		feed = tools.NewGTFSFeed(path)
+	}
+	key, home := transit.RoutesAPIKey, transit.Home
+	if key == "" {
+		key = cfg.Tools.TravelTime.MapsAPIKey
+	}
+	if home == "" {
+		home = cfg.Tools.TravelTime.Home
+	}
+	var router tools.TransitRouter
+	if key != "" {
+		router = tools.NewGoogleRoutesTransit(key)
+	}
+	var calendar *tools.GoogleCalendarClient
+	if cfg.Tools.Events.Enabled {
+		calendar = tools.NewGoogleCalendarClient(googleTokenFunc(cfg))
+	}
+	return tools.NewTransitTool(feed, router, calendar, cfg.WorkspacePath(), tools.TransitOptions{
+		Home:  home,
+		Work:  transit.Work,
+		Lead:  time.Duration(transit.LeadMinutes) * time.Minute,
+		Every: time.Duration(transit.CheckMinutes) * time.Minute,
+	}, profiles)
+}
+
+// mailToken is the Google token queued emails are sent with, or nil when
+// the gmail tool is off, which leaves them waiting.
+func mailToken(cfg *config.Config) tools.TokenFunc {
+	if !cfg.Tools.Gmail.Enabled || cfg.Google.ClientID == "" {
+		return nil
+	}
+	return googleTokenFunc(cfg)
+}
+
+// storageConfig maps a storage section of the config to the backend
+// settings.
+func storageConfig(s config.StorageConfig) storage.Config {
+	return storage.Config{
+		Backend:   s.Backend,
+		Root:      s.Root,
+		URL:       s.URL,
+		Username:  s.Username,
+		Password:  s.Password,
+		Endpoint:  s.Endpoint,
+		Region:    s.Region,
+		Bucket:    s.Bucket,
+		AccessKey: s.AccessKey,
+		SecretKey: s.SecretKey,
+		Prefix:    s.Prefix,
+		Token:     s.Token,
+	}
+}
+
+// mediaArchive returns the token and rules for archiving received media;
+// the token is nil, which turns archiving off, unless it is enabled and
+// Google is set up.
+func mediaArchive(cfg *config.Config) (tools.TokenFunc, []tools.MediaArchiveRule) {
+	a := cfg.Tools.MediaArchive
+	if !a.Enabled || cfg.Google.ClientID == "" {
+		return nil, nil
+	}
+	rules := make([]tools.MediaArchiveRule, 0, len(a.Rules))
+	for _, r := range a.Rules {
+		rules = append(rules, tools.MediaArchiveRule{
+			Channel:     r.Channel,
+			Chats:       r.Chats,
+			Destination: strings.ToLower(r.Destination),
+			Album:       r.Album,
+			Folder:      r.Folder,
+			Name:        r.Name,
+		})
+	}
+	return googleTokenFunc(cfg), rules
+}
+
+// photoUploadQuality is how photos are downscaled before they are
+// uploaded to Google Photos.
+func photoUploadQuality(cfg *config.Config) tools.PhotoUploadQuality {
+	return tools.PhotoUploadQuality{
+		MaxDimension: cfg.Tools.Photos.Upload.MaxDimension,
+		Quality:      cfg.Tools.Photos.Upload.Quality,
+	}
+}
+
+// ocrEngine reads text in images as cfg.OCR says, or is nil when OCR is
+// disabled.
+func ocrEngine(cfg *config.Config) ocr.Engine {
+	if !cfg.OCR.Enabled {
+		return nil
+	}
+	return ocr.New(ocr.Config{
+		Backend:     cfg.OCR.Backend,
+		Languages:   cfg.OCR.Languages,
+		Handwriting: cfg.OCR.Handwriting,
+		APIKey:      cfg.OCR.APIKey,
+		APIBase:     cfg.OCR.APIBase,
+	})
+}
+
+// newContactDirectory builds the address book lookup shared by tools that
+// need to resolve people to emails or phone numbers.
+func newContactDirectory(workspace string, cfg *config.Config) *tools.ContactDirectory {
+	contactsCfg := cfg.Tools.Contacts
+	sources := []tools.ContactSource{
+		tools.NewLocalAddressBook(filepath.Join(workspace, "contacts.json")),
+	}
+	if contactsCfg.Google {
+		sources = append(sources, tools.NewGooglePeopleSource(googleTokenFunc(cfg)))
+	}
+	if contactsCfg.CardDAV.URL != "" {
+		sources = append(sources, tools.NewCardDAVSource(
+			contactsCfg.CardDAV.URL, contactsCfg.CardDAV.Username, contactsCfg.CardDAV.Password))
+	}
+	return tools.NewContactDirectory(sources...)
+}
+
+// newBriefingTool builds the daily briefing with sections backed by tools
+// already in the registry.
+func newBriefingTool(cfg *config.Config, profiles *profile.Store, registry *tools.ToolRegistry) *tools.BriefingTool {
+	briefingCfg := cfg.Tools.Briefing
+	briefing := tools.NewBriefingTool(profiles, tools.BriefingDefaults{
+		Time:            briefingCfg.Time,
+		Sections:        briefingCfg.Sections,
+		WeatherLocation: briefingCfg.WeatherLocation,
+		NewsTopics:      briefingCfg.NewsTopics,
+	})
+	if tool, ok := registry.Get("news"); ok {
+		if news, ok := tool.(*tools.NewsTool); ok {
+			briefing.RegisterSection(tools.NewNewsSection(news))
+		}
+	}
+	if cfg.Tools.Gmail.Enabled {
+		briefing.RegisterSection(tools.NewEmailSection(googleTokenFunc(cfg)))
+	}
+	return briefing
+}
+
+// newReportTool builds the report engine with the reports whose tools
+// are set up.
+func newReportTool(cfg *config.Config, workspace string, profiles *profile.Store, registry *tools.ToolRegistry) *tools.ReportTool {
+	reportsCfg := cfg.Tools.Reports
+	reports := tools.NewReportTool(googleTokenFunc(cfg), reportsCfg.DriveFolderID, reportsCfg.Format, workspace, profiles)
+	if cfg.Tools.Gmail.Enabled {
+		reports.RegisterSource(tools.NewEmailStatsReport(googleTokenFunc(cfg)))
+	}
+	if cfg.Tools.Expenses.Enabled {
+		reports.RegisterSource(tools.NewExpenseReport(newExpenseLedger(cfg), cfg.Tools.Expenses.Currency))
+	}
+	if tool, ok := registry.Get("backup"); ok {
+		if backups, ok := tool.(*tools.BackupTool); ok {
+			reports.RegisterSource(tools.NewBackupReport(backups))
+		}
+	}
+	return reports
+}
+
+// newExpenseLedger picks where logged expenses are stored: a Google Sheet
+// when one is configured, otherwise a SQLite file in the workspace.
+func newExpenseLedger(cfg *config.Config) tools.ExpenseLedger {
+	expensesCfg := cfg.Tools.Expenses
+	if expensesCfg.Backend == "google_sheets" && expensesCfg.SpreadsheetID != "" {
+		return tools.NewGoogleSheetLedger(googleTokenFunc(cfg), expensesCfg.SpreadsheetID, expensesCfg.Sheet)
+	}
+	return tools.NewSQLiteLedger(filepath.Join(cfg.WorkspacePath(), "expenses", "ledger.db"))
+}
 
+// buildToolRegistries creates the agent's and its subagents' tool
+// registries from cfg. It runs at startup and again when tools are
+// restarted or the config is reloaded.
+func buildToolRegistries(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider,
+	subagentManager *tools.SubagentManager, profileStore *profile.Store, stateDB *store.DB, defs *automation.Store, flags *features.Flags,
+	localOnly func(channel, chatID string) bool) (*tools.ToolRegistry, *tools.ToolRegistry) {
+	workspace := cfg.WorkspacePath()
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
 	// Create tool registry for main agent
 	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
 
-	// Create subagent manager with its own tool registry
-	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
+	// Subagents get their own registry without spawn/subagent tools to avoid recursion
 	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus)
-	// Subagent doesn't need spawn/subagent tools to avoid recursion
-	subagentManager.SetTools(subagentTools)
 
-	// Register spawn tool (for main agent)
-	spawnTool := tools.NewSpawnTool(subagentManager)
-	toolsRegistry.Register(spawnTool)
+	// Actions the granted Google scopes do not allow are neither offered
+	// nor run; with no scopes configured, nothing is held back
+	if len(cfg.Google.Scopes) > 0 {
+		toolsRegistry.SetGoogleScopes(cfg.Google.Scopes)
+		subagentTools.SetGoogleScopes(cfg.Google.Scopes)
+	}
+
+	if flags.Enabled(features.Subagents) {
+		// Register spawn tool (for main agent)
+		spawnTool := tools.NewSpawnTool(subagentManager)
+		toolsRegistry.Register(spawnTool)
+
+		// Register subagent tool (synchronous execution)
+		subagentTool := tools.NewSubagentTool(subagentManager)
+		toolsRegistry.Register(subagentTool)
+	}
+
+	toolsRegistry.Register(tools.NewProfileTool(profileStore))
+	toolsRegistry.Register(tools.NewUndoTool())
+	toolsRegistry.Register(tools.NewAuditTool(stateDB.Audit))
+
+	if cfg.Tools.Briefing.Enabled {
+		toolsRegistry.Register(newBriefingTool(cfg, profileStore, toolsRegistry))
+	}
+
+	if cfg.Tools.Expenses.Enabled {
+		toolsRegistry.Register(tools.NewExpenseTool(newExpenseLedger(cfg), cfg.Tools.Expenses.Currency, profileStore))
+	}
+
+	if cfg.Tools.Lists.Enabled {
+		var listSync tools.ListSync
+		switch cfg.Tools.Lists.Sync {
+		case "google_tasks":
+			listSync = tools.NewGoogleTasksSync(googleTokenFunc(cfg))
+		case "caldav":
+			c := cfg.Tools.Lists.CalDAV
+			listSync = tools.NewCalDAVTasksSync(c.URL, c.Username, c.Password)
+		}
+		toolsRegistry.Register(tools.NewListTool(workspace, listSync))
+	}
+
+	toolsRegistry.Register(tools.NewHabitTool(workspace, profileStore))
+
+	// Message templates and contact groups are shared by both registries'
+	// message tools
+	templates := tools.NewTemplateStore(workspace)
+	templates.SetDefinitions(defs)
+	toolsRegistry.Register(tools.NewTemplatesTool(templates))
+	toolsRegistry.Register(tools.NewContactGroupsTool(stateDB.ContactGroups))
+	for _, registry := range []*tools.ToolRegistry{toolsRegistry, subagentTools} {
+		if tool, ok := registry.Get("message"); ok {
+			if messageTool, ok := tool.(*tools.MessageTool); ok {
+				messageTool.SetTemplates(templates, profileStore)
+				messageTool.SetGroups(stateDB.ContactGroups)
+			}
+		}
+	}
+
+	// Automations set themselves up through the registry, whichever of
+	// the tools they wire end up registered
+	automationsTool := tools.NewAutomationsTool(toolsRegistry, workspace, profileStore)
+	automationsTool.SetDefinitions(defs)
+	toolsRegistry.Register(automationsTool)
+
+	if cfg.Tools.Summarize.Enabled {
+		model := routedModel(cfg, cfg.Tools.Summarize.Model, cfg.Agents.Routing.Summarize)
+		var token tools.TokenFunc
+		if cfg.Tools.Summarize.Google {
+			token = googleTokenFunc(cfg)
+		}
+		toolsRegistry.Register(tools.NewSummarizeTool(provider, model, workspace, restrict, token, ocrEngine(cfg)))
+		askFile := tools.NewAskFileTool(provider, model, workspace, restrict, token, ocrEngine(cfg))
+		askFile.SetEmbedders(embedders(cfg, localOnly))
+		toolsRegistry.Register(askFile)
+	}
+	if cfg.Tools.Screenshots.Enabled {
+		model := routedModel(cfg, cfg.Tools.Screenshots.Model, cfg.Agents.Routing.Tools)
+		screenshots := tools.NewScreenshotTool(provider, model, ocrEngine(cfg), workspace, restrict, profileStore)
+		if cfg.Tools.Events.Enabled {
+			screenshots.SetCalendar(tools.NewGoogleCalendarClient(googleTokenFunc(cfg)))
+		}
+		if cfg.Tools.Expenses.Enabled {
+			screenshots.SetLedger(newExpenseLedger(cfg), cfg.Tools.Expenses.Currency)
+		}
+		toolsRegistry.Register(screenshots)
+	}
+	if cfg.Tools.Podcasts.Enabled {
+		var transcriber tools.Transcriber
+		if cfg.Providers.Groq.APIKey != "" {
+			transcriber = voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
+		}
+		model := routedModel(cfg, cfg.Tools.Podcasts.Model, cfg.Agents.Routing.Summarize)
+		podcasts := tools.NewPodcastTool(provider, model, transcriber, workspace, tools.PodcastOptions{
+			Every: time.Duration(cfg.Tools.Podcasts.CheckHours) * time.Hour,
+		})
+		podcasts.SetEmbedders(embedders(cfg, localOnly))
+		toolsRegistry.Register(podcasts)
+	}
+
+	if cfg.Tools.Photos.Enabled && cfg.Tools.Photos.Storage.Backend != "" {
+		if store, err := storage.New(storageConfig(cfg.Tools.Photos.Storage)); err != nil {
+			logger.WarnCF("agent", "Photos storage not available", map[string]interface{}{"error": err.Error()})
+		} else {
+			toolsRegistry.Register(tools.NewStoragePhotosTool(store, profileStore, workspace, restrict, filepath.Join(workspace, "cache", "previews")))
+		}
+	} else if cfg.Tools.Photos.Enabled {
+		photos := tools.NewGooglePhotosClient(googleTokenFunc(cfg))
+		toolsRegistry.Register(tools.NewOrganizePhotosTool(photos, profileStore))
+		toolsRegistry.Register(tools.NewPhotoDuplicatesTool(photos, profileStore))
+		toolsRegistry.Register(tools.NewPhotosTool(photos, profileStore, filepath.Join(workspace, "cache", "previews")))
+		toolsRegistry.Register(tools.NewSlideshowTool(photos, profileStore, filepath.Join(workspace, "cache", "slideshows")))
+	}
+
+	if cfg.Tools.Files.Enabled {
+		if store, err := storage.New(storageConfig(cfg.Tools.Files.Storage)); err != nil {
+			logger.WarnCF("agent", "Files storage not available", map[string]interface{}{"error": err.Error()})
+		} else {
+			toolsRegistry.Register(tools.NewFilesTool(store, profileStore, workspace, restrict))
+		}
+	}
+
+	if cfg.Tools.Gmail.Enabled {
+		gmail := tools.NewGmailTool(googleTokenFunc(cfg))
+		gmail.SetOutbox(tools.NewMailOutbox(stateDB.MailOutbox, googleTokenFunc(cfg), msgBus))
+		gmail.SetGroups(stateDB.ContactGroups)
+		gmail.SetWorkspace(workspace)
+		toolsRegistry.Register(gmail)
+	}
+
+	if cfg.Tools.Drive.Enabled {
+		toolsRegistry.Register(tools.NewDriveTool(googleTokenFunc(cfg), workspace))
+	}
+
+	if cfg.Tools.Browse.Enabled {
+		browse := tools.NewBrowseTool(workspace)
+		if cfg.Tools.Drive.Enabled {
+			browse.SetDrive(tools.NewGoogleDriveClient(googleTokenFunc(cfg)))
+		}
+		if cfg.Tools.Files.Enabled {
+			if store, err := storage.New(storageConfig(cfg.Tools.Files.Storage)); err == nil {
+				browse.AddStore("files", store)
+			}
+		}
+		if len(browse.Sources()) > 0 {
+			toolsRegistry.Register(browse)
+		} else {
+			logger.WarnC("agent", "Browse needs the drive or files tool enabled")
+		}
+	}
+
+	if cfg.Tools.Security.Enabled {
+		toolsRegistry.Register(tools.NewSecurityReviewTool(googleTokenFunc(cfg), workspace))
+	}
+
+	if cfg.Tools.GoogleAPI.Enabled {
+		endpoints := make([]tools.GoogleAPIEndpoint, 0, len(cfg.Tools.GoogleAPI.Endpoints))
+		for _, e := range cfg.Tools.GoogleAPI.Endpoints {
+			endpoints = append(endpoints, tools.GoogleAPIEndpoint{Method: e.Method, URL: e.URL, Description: e.Description})
+		}
+		if googleAPI, err := tools.NewGoogleAPITool(googleTokenFunc(cfg), endpoints); err != nil {
+			logger.WarnCF("agent", "Google API tool not available", map[string]interface{}{"error": err.Error()})
+		} else {
+			toolsRegistry.Register(googleAPI)
+		}
+	}
+
+	if cfg.Tools.Keep.Enabled {
+		toolsRegistry.Register(tools.NewKeepTool(googleTokenFunc(cfg), workspace))
+	}
+
+	if cfg.Tools.LocalPhotos.Enabled {
+		var photos *tools.GooglePhotosClient
+		if cfg.Tools.Photos.Enabled && cfg.Tools.Photos.Storage.Backend == "" {
+			photos = tools.NewGooglePhotosClient(googleTokenFunc(cfg))
+		}
+		index := mediaindex.New(filepath.Join(workspace, "media", "index.db"),
+			filepath.Join(workspace, "cache", "thumbnails"), cfg.Tools.LocalPhotos.Directories)
+		localPhotos := tools.NewLocalPhotosTool(index, photos)
+		if photos != nil {
+			localPhotos.SetDrive(tools.NewGoogleDriveClient(googleTokenFunc(cfg)))
+		}
+		toolsRegistry.Register(localPhotos)
+	}
+
+	if cfg.Tools.Events.Enabled {
+		model := routedModel(cfg, cfg.Tools.Events.Model, cfg.Agents.Routing.Tools)
+		extractEvents := tools.NewExtractEventsTool(googleTokenFunc(cfg), provider, model, cfg.Tools.Events.CalendarID, profileStore)
+		if engine := ocrEngine(cfg); engine != nil {
+			extractEvents.SetOCR(engine, workspace, restrict)
+		}
+		travel := travelPlanner(cfg)
+		if travel != nil {
+			extractEvents.SetTravel(travel)
+		}
+		toolsRegistry.Register(extractEvents)
+		toolsRegistry.Register(tools.NewAgendaTool(googleTokenFunc(cfg), profileStore, filepath.Join(workspace, "cache", "previews")))
+		toolsRegistry.Register(tools.NewCalendarStatusTool(googleTokenFunc(cfg), profileStore))
+		toolsRegistry.Register(tools.NewCalendarImportTool(googleTokenFunc(cfg), cfg.Tools.Events.CalendarID, workspace, restrict, profileStore))
+		var mail *tools.GmailClient
+		if cfg.Tools.Gmail.Enabled {
+			mail = tools.NewGmailClient(googleTokenFunc(cfg))
+		}
+		scheduleCheck := tools.NewScheduleCheckTool(tools.NewGoogleCalendarClient(googleTokenFunc(cfg)), mail, profileStore)
+		if travel != nil {
+			scheduleCheck.SetTravel(travel)
+		}
+		toolsRegistry.Register(scheduleCheck)
+	}
+
+	if cfg.Tools.Invoices.Enabled {
+		invoicesCfg := cfg.Tools.Invoices
+		opts := tools.InvoiceInboxOptions{FolderID: invoicesCfg.DriveFolderID, Currency: cfg.Tools.Expenses.Currency}
+		for _, r := range invoicesCfg.Rules {
+			opts.Rules = append(opts.Rules, tools.InvoiceRule{
+				Name:        r.Name,
+				Query:       r.Query,
+				Vendor:      r.Vendor,
+				Category:    r.Category,
+				Attachments: r.Attachments,
+			})
+		}
+		var ledger tools.ExpenseLedger
+		if invoicesCfg.LogExpenses {
+			ledger = newExpenseLedger(cfg)
+		}
+		toolsRegistry.Register(tools.NewInvoiceInboxTool(googleTokenFunc(cfg), workspace, opts, ledger, ocrEngine(cfg)))
+	}
+
+	if cfg.Tools.Itinerary.Enabled {
+		itin := cfg.Tools.Itinerary
+		toolsRegistry.Register(tools.NewItineraryTool(googleTokenFunc(cfg), provider, routedModel(cfg, itin.Model, cfg.Agents.Routing.Tools), workspace,
+			tools.ItineraryOptions{Query: itin.Query, FolderID: itin.DriveFolderID, CalendarID: cfg.Tools.Events.CalendarID}, profileStore))
+	}
+
+	if cfg.Tools.Bills.Enabled {
+		bills := cfg.Tools.Bills
+		toolsRegistry.Register(tools.NewBillsTool(googleTokenFunc(cfg), provider, routedModel(cfg, bills.Model, cfg.Agents.Routing.Tools), workspace,
+			tools.BillsOptions{Query: bills.Query, RemindDays: bills.RemindDays, Currency: cfg.Tools.Expenses.Currency}, profileStore))
+	}
+
+	if cfg.Tools.Backup.Enabled {
+		toolsRegistry.Register(tools.NewBackupTool(googleTokenFunc(cfg), cfg.Tools.Backup.Destinations, workspace, profileStore, msgBus))
+	}
+
+	if cfg.Tools.Transfers.Enabled {
+		transferTool := tools.NewTransferTool(filepath.Join(workspace, "cache", "transfers"))
+		if cfg.Tools.Drive.Enabled {
+			transferTool.SetDrive(tools.NewGoogleDriveClient(googleTokenFunc(cfg)))
+		}
+		if cfg.Tools.Photos.Enabled && cfg.Tools.Photos.Storage.Backend == "" {
+			transferTool.SetPhotos(tools.NewGooglePhotosClient(googleTokenFunc(cfg)))
+		}
+		if cfg.Tools.Gmail.Enabled {
+			transferTool.SetGmail(tools.NewGmailClient(googleTokenFunc(cfg)))
+		}
+		if cfg.Tools.Files.Enabled {
+			if store, err := storage.New(storageConfig(cfg.Tools.Files.Storage)); err == nil {
+				transferTool.AddStore("files", store)
+			}
+		}
+		for name, backend := range cfg.Tools.Transfers.Backends {
+			if store, err := storage.New(storageConfig(backend)); err != nil {
+				logger.WarnCF("agent", "Transfer backend not available", map[string]interface{}{"backend": name, "error": err.Error()})
+			} else {
+				transferTool.AddStore(name, store)
+			}
+		}
+		toolsRegistry.Register(transferTool)
+	}
+
+	if cfg.Tools.Reports.Enabled {
+		toolsRegistry.Register(newReportTool(cfg, workspace, profileStore, toolsRegistry))
+	}
 
-	// Register subagent tool (synchronous execution)
-	subagentTool := tools.NewSubagentTool(subagentManager)
-	toolsRegistry.Register(subagentTool)
+	if cfg.Tools.Search.Enabled {
+		var sources []tools.SearchSource
+		token := googleTokenFunc(cfg)
+		hasGoogle := cfg.Google.ClientID != ""
+		for _, name := range cfg.Tools.Search.Sources {
+			switch {
+			case name == "gmail" && hasGoogle:
+				sources = append(sources, tools.NewGmailSearchSource(token))
+			case name == "drive" && hasGoogle:
+				sources = append(sources, tools.NewDriveSearchSource(token))
+			case name == "photos" && hasGoogle:
+				sources = append(sources, tools.NewPhotosSearchSource(token))
+			case name == "calendar" && hasGoogle:
+				sources = append(sources, tools.NewCalendarSearchSource(token))
+			case name == "notes":
+				notes := tools.NewNotesSearchSource(workspace)
+				if index := embeddingsIndex(cfg, "notes", localOnly); index != nil {
+					notes.SetIndex(index)
+				}
+				sources = append(sources, notes)
+			case name == "memory":
+				memory := tools.NewMemorySearchSource(workspace)
+				if index := embeddingsIndex(cfg, "memory", localOnly); index != nil {
+					memory.SetIndex(index)
+				}
+				sources = append(sources, memory)
+			}
+		}
+		if len(sources) > 0 {
+			search := tools.NewSearchEverythingTool(sources...)
+			search.SetProfiles(profileStore)
+			toolsRegistry.Register(search)
+		}
+	}
+
+	policies := toolPolicies(cfg)
+	if err := toolsRegistry.ApplyPolicies(policies); err != nil {
+		logger.WarnCF("agent", "Some tool settings were not applied", map[string]interface{}{"error": err.Error()})
+	}
+	// Same settings again for the subagent copies; problems are already logged
+	subagentTools.ApplyPolicies(policies)
+
+	return toolsRegistry, subagentTools
+}
+
+// embeddingsIndex returns an index for searching the named notes by
+// meaning, or nil when no embeddings provider is configured.
+func embeddingsIndex(cfg *config.Config, name string, localOnly func(channel, chatID string) bool) *embeddings.Index {
+	primary, fallback := embedders(cfg, localOnly)
+	if primary == nil {
+		return nil
+	}
+	return embeddings.NewIndex(filepath.Join(cfg.WorkspacePath(), "cache", "embeddings", name+".json"), primary, fallback)
+}
+
+// embedders returns the configured embeddings provider and its fallback,
+// either of which may be nil. Online ones refuse the chats localOnly
+// reports.
+func embedders(cfg *config.Config, localOnly func(channel, chatID string) bool) (primary, fallback embeddings.Embedder) {
+	e := cfg.Embeddings
+	if e.Provider == "" {
+		return nil, nil
+	}
+	primary, err := embeddings.New(embeddingsConfig(cfg, e.Provider, e.Model))
+	if err != nil {
+		logger.WarnCF("agent", "Embeddings not available", map[string]interface{}{"error": err.Error()})
+		return nil, nil
+	}
+	primary = keepLocal(e.Provider, primary, localOnly)
+	if e.Fallback != "" && e.Fallback != e.Provider {
+		if fallback, err = embeddings.New(embeddingsConfig(cfg, e.Fallback, "")); err == nil {
+			fallback = keepLocal(e.Fallback, fallback, localOnly)
+		}
+	}
+	return primary, fallback
+}
+
+// embeddingsConfig takes the key and base URL of the provider with the
+// same name.
+func embeddingsConfig(cfg *config.Config, provider, model string) embeddings.Config {
+	var p config.ProviderConfig
+	switch provider {
+	case "openai":
+		p = cfg.Providers.OpenAI
+	case "ollama":
+		p = cfg.Providers.Ollama
+	case "gemini":
+		p = cfg.Providers.Gemini
+	}
+	return embeddings.Config{Provider: provider, Model: model, APIKey: p.APIKey, APIBase: p.APIBase}
+}
+
+// toolPolicies converts tools.policies from the config for the registry.
+func toolPolicies(cfg *config.Config) map[string]tools.ToolPolicy {
+	policies := make(map[string]tools.ToolPolicy, len(cfg.Tools.Policies))
+	for name, p := range cfg.Tools.Policies {
+		policies[name] = tools.ToolPolicy{
+			Disabled: p.Enabled != nil && !*p.Enabled,
+			Channels: p.Channels,
+			Users:    p.Users,
+			Settings: p.Settings,
+		}
+	}
+	return policies
+}
+
+// registerAgentTools adds the tools that call back into the agent itself. They are
+// registered after the others, so tool policies do not apply to them.
+func (al *AgentLoop) registerAgentTools(registry *tools.ToolRegistry, cfg *config.Config) {
+	if cfg.Escalation.Enabled {
+		registry.Register(tools.NewEscalateTool(al))
+	}
+	if cfg.Tools.Identity.Enabled {
+		registry.Register(tools.NewIdentityTool(al.identities, al.sendLinkCode))
+	}
+	registry.Register(tools.NewDigestTool(al.digest))
+	focus := tools.NewFocusTool(al.digest, al.profiles)
+	if cfg.Tools.Events.Enabled {
+		focus.SetCalendar(tools.NewGoogleCalendarClient(googleTokenFunc(cfg)))
+	}
+	registry.Register(focus)
+	registry.Register(tools.NewMemoryTool(al.memories, cfg.WorkspacePath(), al.clearHistory))
+	registry.Register(tools.NewEntitiesTool(al.entities))
+	registry.Register(tools.NewUserDataTool(al))
+	registry.Register(tools.NewShareTool(al.chatHistory, filepath.Join(cfg.WorkspacePath(), "cache", "previews")))
+	registry.Register(tools.NewBackgroundTasksTool(al.tasks))
+	registry.Register(tools.NewPollTool(al.polls, al.profiles))
+	for _, name := range registry.List() {
+		if tool, ok := registry.Get(name); ok {
+			if bt, ok := tool.(tools.BackgroundTool); ok {
+				bt.SetTasks(al.tasks)
+			}
+		}
+	}
+	if cfg.Tools.Critical.Enabled {
+		critical := tools.NewCriticalReminderTool(al.critical, al, al.profiles, time.Duration(cfg.Tools.Critical.AckMinutes)*time.Minute)
+		if cfg.Tools.Gmail.Enabled {
+			critical.SetEmail(tools.NewGmailClient(googleTokenFunc(cfg)))
+		}
+		if sms := cfg.Tools.Critical.SMS; sms.AccountSID != "" {
+			critical.SetSMS(tools.NewTwilioSMS(sms.AccountSID, sms.AuthToken, sms.From))
+		}
+		registry.Register(critical)
+	}
+	if cfg.Tools.Attachments.Enabled {
+		var token tools.TokenFunc
+		if cfg.Tools.Drive.Enabled || cfg.Tools.Photos.Enabled {
+			token = googleTokenFunc(cfg)
+		}
+		var ledger tools.ExpenseLedger
+		if cfg.Tools.Expenses.Enabled {
+			ledger = newExpenseLedger(cfg)
+		}
+		registry.Register(tools.NewAttachmentInboxTool(al.artifacts, cfg.WorkspacePath(), token, ledger, cfg.Tools.Expenses.Currency, ocrEngine(cfg)))
+	}
+	if notes := cfg.Tools.MeetingNotes; notes.Enabled {
+		meetings := tools.NewMeetingNotesTool(googleTokenFunc(cfg), cfg.WorkspacePath(), tools.MeetingNotesOptions{
+			CalendarID: notes.CalendarID,
+			Docs:       notes.Docs,
+			FolderID:   notes.FolderID,
+			Every:      time.Duration(notes.CheckMinutes) * time.Minute,
+		}, al.profiles)
+		if cfg.Tools.Gmail.Enabled {
+			meetings.SetGmail(tools.NewGmailClient(googleTokenFunc(cfg)))
+		}
+		meetings.SetRecorder(al)
+		registry.Register(meetings)
+	}
+	if transit := cfg.Tools.Transit; transit.Enabled {
+		registry.Register(newTransitTool(cfg, al.profiles))
+	}
+	if gmail := cfg.Tools.Gmail; gmail.Enabled {
+		registry.Register(tools.NewWaitingOnTool(googleTokenFunc(cfg), cfg.WorkspacePath(), tools.WaitingOnOptions{
+			Days:      gmail.WaitingOn.DefaultDays,
+			Every:     time.Duration(gmail.WaitingOn.CheckMinutes) * time.Minute,
+			AutoDraft: gmail.WaitingOn.AutoDraft,
+		}, al.profiles))
+		registry.Register(tools.NewMailRoutesTool(googleTokenFunc(cfg), cfg.WorkspacePath(), tools.MailRoutesOptions{
+			Every: time.Duration(gmail.Routes.CheckMinutes) * time.Minute,
+		}, al.digest, al.identities))
+	}
+}
+
+func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
+	workspace := cfg.WorkspacePath()
+	os.MkdirAll(workspace, 0755)
+
+	// The backend is probed directly; the wrappers below hide CheckHealth
+	backend := provider
+
+	// Local-only chats are answered by the local model, on every path
+	residency := newResidencyProvider(cfg, provider)
+
+	// Model answers go into the round being recorded, if any
+	provider = replay.Record(residency)
+
+	// Create subagent manager; its tool registry is set below
+	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
 
 	sessionsManager := session.NewSessionManager(filepath.Join(workspace, "sessions"))
 
 	// Create state manager for atomic state persistence
 	stateManager := state.NewManager(workspace)
 
+	// Per-chat user profiles (timezone, locale, quiet hours)
+	profileStore := profile.NewStore(workspace)
+
+	// Accounts on other channels linked to the same person share a
+	// profile, conversation and quotas
+	identityStore := identity.NewStore(workspace)
+	profileStore.SetResolver(identityStore.Resolve)
+
+	// Files passed between tools and received from users, by short ID
+	artifactStore := artifacts.New(artifacts.WorkspaceDir(workspace))
+
+	// Shared state database, opened on first use
+	stateDB := store.Open(store.WorkspacePath(workspace))
+
+	// Automation files are read before the tools that use them are built
+	automations := automation.NewStore(cfg.AutomationsDir())
+	automations.Reload()
+
+	// Experimental subsystems, as configured or toggled by an owner
+	flags := features.New(workspace)
+	flags.SetConfig(cfg.Features)
+
+	toolsRegistry, subagentTools := buildToolRegistries(cfg, msgBus, provider, subagentManager, profileStore, stateDB, automations, flags, residency.isLocalOnly)
+	subagentManager.SetTools(subagentTools)
+
 	// Create context builder and set tools registry
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
-
-	return &AgentLoop{
+	contextBuilder.SetProfiles(profileStore)
+	memories := tools.NewMemoryBook(workspace)
+	memories.SetRetentionDefaults(cfg.Memory.RetentionDays)
+	contextBuilder.SetMemories(memories)
+	entities := tools.NewEntityBook(workspace)
+	contextBuilder.SetEntities(entities)
+	contextBuilder.SetCapabilities(msgBus.Capabilities)
+	contextBuilder.languages = newConversationLanguages()
+	contextBuilder.SetPlanPreview(func() bool { return flags.Enabled(features.PlanPreview) })
+	deferred := tools.NewDeferredActions(workspace, msgBus)
+
+	al := &AgentLoop{
 		bus:            msgBus,
 		provider:       provider,
 		workspace:      workspace,
@@ -148,64 +1096,398 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		maxIterations:  cfg.Agents.Defaults.MaxToolIterations,
 		sessions:       sessionsManager,
 		state:          stateManager,
+		profiles:       profileStore,
+		languages:      contextBuilder.languages,
+		identities:     identityStore,
+		confirmations:  tools.NewConfirmations(),
+		plans:          tools.NewPlans(),
+		clarifications: tools.NewClarifications(),
+		pdfPasswords:   tools.NewPDFPasswords(),
+		hooks:          webhooks.New(webhookEndpoints(cfg)),
+		automations:    automations,
+		artifacts:      artifactStore,
+		store:          stateDB,
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
 		summarizing:    sync.Map{},
+		subagents:      subagentManager,
+		subagentTools:  subagentTools,
+		usage:          newUsageTracker(),
+		started:        time.Now(),
+		cfg:            cfg,
+		owners:         cfg.Owners,
+		guard:          dlp.NewGuard(contentPolicy(cfg)),
+		undo:           tools.NewUndoJournal(stateDB.Undo, undoToken(cfg)),
+		mail:           tools.NewMailOutbox(stateDB.MailOutbox, mailToken(cfg), msgBus),
+		archive:        tools.NewMediaArchiver(mediaArchive(cfg)),
+		quotas:         newQuotaTracker(stateDB, cfg.Quotas),
+		critical:       tools.NewCriticalReminders(workspace),
+		digest:         tools.NewNotificationDigest(workspace),
+		tasks:          tasks.NewManager(filepath.Join(workspace, "tasks", "background.json")),
+		polls:          tools.NewPolls(filepath.Join(workspace, "polls", "polls.json")),
+		memories:       memories,
+		entities:       entities,
+		inbound:        newInboundQueue(newQueueOptions(cfg.Queue)),
+		offline:        newOfflineMode(cfg, deferred),
+		outages:        newOutageTracker(cfg, backend),
+		residency:      residency,
+		deferred:       deferred,
+		features:       flags,
+		resources:      governor.Detect(),
+	}
+	msgBus.SetOutboundFilter(al.filterOutbound)
+	al.tasks.SetNotify(al.announceTask)
+	al.polls.SetNotify(al.reportPoll)
+	transfer.SetOptions(transferOptions(cfg))
+	egress.SetPolicy(egressPolicy(cfg))
+	screening.SetPolicy(screeningPolicy(cfg))
+	limits := resourceLimits(cfg, al.resources)
+	governor.SetDefault(governor.New(limits))
+	logger.InfoCF("agent", "Heavy work limits set", map[string]interface{}{
+		"resources": al.resources.String(),
+		"max":       limits.Total,
+	})
+	webhooks.SetDefault(al.hooks)
+	al.disk = al.newJanitor(cfg)
+	janitor.SetDefault(al.disk)
+	tools.SetGoogleTokenRefresh(googleTokenRefresh(cfg))
+	tools.SetPhotoUploadQuality(photoUploadQuality(cfg))
+	httprec.SetDir(httpRecordDir(cfg))
+	locale.SetDefault(cfg.Agents.Defaults.Locale)
+	al.quotas.resolve = identityStore.Resolve
+	al.quotas.role = al.roleQuotas
+	al.applyRoles(cfg)
+	al.registerAgentTools(al.tools, cfg)
+	al.tools.SetAuditor(al.recordAudit)
+	al.subagentTools.SetAuditor(al.recordAudit)
+	al.tools.OnChange(al.toolsChanged)
+	// Subagents have no user to ask, so their ambiguous calls go back to
+	// them as options
+	al.tools.SetClarifications(al.clarifications)
+	al.tools.SetPDFPasswords(al.pdfPasswords)
+	al.tools.SetEntities(al.entities)
+	al.tools.SetChatTools(al.personaTools)
+	al.subagentTools.SetChatTools(al.personaTools)
+	contextBuilder.SetPersona(al.personaPrompt)
+	al.automations.OnChange(al.syncAutomations)
+	if al.offline != nil {
+		// Subagents run unattended, so their changes are refused rather
+		// than deferred
+		al.tools.SetConnectivity(al.offline.monitor, al.offline.deferred)
+		al.subagentTools.SetConnectivity(al.offline.monitor, nil)
+	}
+	residency.localOnly = al.LocalOnly
+	al.tools.SetLocalOnly(al.LocalOnly)
+	al.subagentTools.SetLocalOnly(al.LocalOnly)
+	if al.outages != nil {
+		al.tools.SetOutages(al.outages, al.deferred)
+		al.subagentTools.SetOutages(al.outages, nil)
 	}
+	al.guard.OnHold(func(h dlp.Held) {
+		logger.WarnCF("agent", "Content held for owner approval", map[string]interface{}{
+			"id":          h.ID,
+			"kind":        h.Item.Kind,
+			"destination": h.Item.Destination,
+			"reasons":     strings.Join(h.Reasons, ", "),
+		})
+	})
+	return al
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
-
+	go al.artifacts.Run(ctx, 10*time.Minute)
+	go al.disk.Run(ctx, diskSweepInterval)
+	go al.mail.Run(ctx, time.Minute)
+	al.startOffline(ctx)
+	al.startOutages(ctx)
+	go al.hooks.Run(ctx)
+	go al.automations.Watch(ctx, automationsWatchInterval)
+
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	done := make(chan struct{})
+	al.lifeMu.Lock()
+	al.stopConsuming, al.done = stopConsuming, done
+	al.lifeMu.Unlock()
+	defer close(done)
+	defer stopConsuming()
+
+	// Rounds run on their own goroutines, at most queue.max_concurrent at
+	// a time; Run returns once they have all finished
+	var rounds sync.WaitGroup
+	defer rounds.Wait()
+
+	go al.intake(ctx, consumeCtx)
 	for al.running.Load() {
-		select {
-		case <-ctx.Done():
+		chat, msg, ok := al.inbound.next(consumeCtx)
+		if !ok {
 			return nil
-		default:
-			msg, ok := al.bus.ConsumeInbound(ctx)
-			if !ok {
-				continue
-			}
+		}
+		rounds.Add(1)
+		go func() {
+			defer rounds.Done()
+			defer al.inbound.done(chat)
+			al.handleInbound(ctx, msg)
+		}()
+	}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
-			}
+	return nil
+}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				alreadySent := false
-				if tool, ok := al.tools.Get("message"); ok {
-					if mt, ok := tool.(*tools.MessageTool); ok {
-						alreadySent = mt.HasSentInRound()
-					}
-				}
+// intake takes messages off the bus as they arrive. Owner and handover
+// commands are answered at once, even while rounds run; the rest wait in
+// the inbound queue for their chat's turn.
+func (al *AgentLoop) intake(ctx, consumeCtx context.Context) {
+	for {
+		msg, ok := al.bus.ConsumeInbound(consumeCtx)
+		if !ok {
+			if consumeCtx.Err() != nil {
+				return
+			}
+			continue
+		}
+		// Owner commands work while paused, so /resume can get through
+		if reply, handled := al.handleOwnerCommand(ctx, msg); handled {
+			out := bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: reply,
+			}
+			al.guard.Allow(outboundItem(out))
+			al.bus.PublishOutbound(out)
+			continue
+		}
+		if reply, handled := al.handleHandoverCommand(msg); handled {
+			out := bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: reply,
+			}
+			al.guard.Allow(outboundItem(out))
+			al.bus.PublishOutbound(out)
+			continue
+		}
+		// Chats handed over to a person reach them even while paused
+		if al.relayHandedOver(msg) {
+			continue
+		}
+		// A stop reaches a running plan between its steps, ahead of the
+		// chat's queue
+		if msg.Channel != "system" && al.plans.Stop(msg.Channel+":"+msg.ChatID, msg.Content) {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: "🛑 Stopping the plan after the current step.",
+			})
+			continue
+		}
+		if al.paused.Load() {
+			al.replyPaused(msg)
+			continue
+		}
+		if al.inbound.add(msg, time.Now()) && msg.Channel != "system" {
+			logger.WarnCF("agent", "Chat queue full, dropping messages", map[string]interface{}{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+			})
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: overflowNotice,
+			})
+		}
+	}
+}
 
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
+// handleInbound runs one round for msg and publishes the reply.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	// A reply to a request for a PDF's password opens the file and is
+	// replaced before anything logs, journals or shows it to the model
+	if msg.Channel != "system" && !isEvent(msg) {
+		if retry, ok := al.pdfPasswords.Answer(msg.Channel+":"+msg.ChatID, msg.Content); ok {
+			msg.Content = al.runPasswordRetry(ctx, msg, retry)
+		}
+	}
+	if al.holdWhileOffline(msg) {
+		return
+	}
+	if len(msg.Media) > 0 {
+		go al.archive.Archive(ctx, msg.Channel, msg.ChatID, msg.SenderID, msg.Media)
+		if tool, ok := al.tools.Get("attachments"); ok {
+			if inbox, ok := tool.(*tools.AttachmentInboxTool); ok {
+				msg.Content += inbox.Receive(ctx, msg.Channel, msg.ChatID, msg.SenderID, msg.Media)
 			}
 		}
 	}
 
-	return nil
+	msgCtx, span := tracing.StartKind(ctx, "agent.message", tracing.KindServer,
+		tracing.String("channel", msg.Channel),
+		tracing.String("chat_id", msg.ChatID),
+		tracing.String("session_key", msg.SessionKey))
+	defer span.End()
+	started := time.Now()
+	journalID := al.journal(ctx, msg)
+	taskCtx, finish := al.beginTask(msgCtx, msg)
+	taskCtx, round := tools.WithMessageRound(taskCtx)
+	if journalID != 0 {
+		taskCtx = tools.WithCallJournal(taskCtx, roundCalls{al.store}, journalRound(msg, journalID))
+	}
+	response, err := al.processMessage(taskCtx, msg)
+	cancelled := finish()
+	messageDuration.Observe(time.Since(started).Seconds(), msg.Channel)
+	if al.abandoning.Load() {
+		// Cut short by shutdown: no reply, and the journal entry stays
+		span.SetError("interrupted by shutdown")
+		return
+	}
+	al.unjournal(ctx, journalID)
+	if cancelled {
+		span.SetError("cancelled")
+		response, err = cancelledReply, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		response = fmt.Sprintf("Error processing message: %v", err)
+		var overflow *contextOverflowError
+		if errors.As(err, &overflow) {
+			response = overflow.reply()
+		} else if reply := al.modelOutageReply(ctx, err); reply != "" {
+			response = reply
+		} else if isNetworkError(err) {
+			response = networkErrorReply
+		}
+	}
+
+	al.emitProcessed(msg, response, started, err)
+
+	// Skip publishing if the message tool already answered this chat
+	// while the message was processed, to avoid duplicates.
+	if response != "" && !round.SentTo(msg.Channel, msg.ChatID) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:     msg.Channel,
+			ChatID:      msg.ChatID,
+			Content:     response,
+			Voice:       al.wantsVoiceReply(msg),
+			TraceParent: span.TraceParent(),
+		})
+	}
+}
+
+// wantsVoiceReply reports whether the reply to msg should be a voice note:
+// the user spoke and the chat turned voice replies on with /voice. Replies
+// in local-only chats are not sent off to be spoken.
+func (al *AgentLoop) wantsVoiceReply(msg bus.InboundMessage) bool {
+	if msg.Metadata["voice_note"] != "true" || al.LocalOnly(msg.Channel, msg.ChatID) {
+		return false
+	}
+	return al.state.GetChatSettings(msg.Channel + ":" + msg.ChatID).VoiceReplies
 }
 
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
 }
 
+// RegisterTool adds a tool built outside the agent, or replaces the one
+// of the same name, at any time. It is kept when the tools are rebuilt.
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
+	al.cfgMu.Lock()
+	al.extraTools = slices.DeleteFunc(al.extraTools, func(t tools.Tool) bool { return t.Name() == tool.Name() })
+	al.extraTools = append(al.extraTools, tool)
+	al.cfgMu.Unlock()
 	al.tools.Register(tool)
 }
 
+// UnregisterTool removes the tool name, whether built by the agent or
+// added with RegisterTool, until the tools are rebuilt; a tool added
+// with RegisterTool stays removed. It reports whether there was one.
+func (al *AgentLoop) UnregisterTool(name string) bool {
+	al.cfgMu.Lock()
+	al.extraTools = slices.DeleteFunc(al.extraTools, func(t tools.Tool) bool { return t.Name() == name })
+	al.cfgMu.Unlock()
+	return al.tools.Unregister(name)
+}
+
+// ScheduledTools returns registered tools that own cron job kinds.
+func (al *AgentLoop) ScheduledTools() []tools.ScheduledTool {
+	var scheduled []tools.ScheduledTool
+	for _, name := range al.tools.List() {
+		if tool, ok := al.tools.Get(name); ok {
+			if st, ok := tool.(tools.ScheduledTool); ok {
+				scheduled = append(scheduled, st)
+			}
+		}
+	}
+	return scheduled
+}
+
+// Profiles returns the per-chat user profile store.
+func (al *AgentLoop) Profiles() *profile.Store {
+	return al.profiles
+}
+
+// Digest returns the notifications held for chats in digest mode, for
+// the scheduler to add to.
+func (al *AgentLoop) Digest() *tools.NotificationDigest {
+	return al.digest
+}
+
+// Artifacts returns the store tools use to hand files to each other.
+func (al *AgentLoop) Artifacts() *artifacts.Store {
+	return al.artifacts
+}
+
+// Contacts returns the address book lookup built from the current config,
+// or nil when contacts are turned off.
+func (al *AgentLoop) Contacts() *tools.ContactDirectory {
+	al.cfgMu.RLock()
+	cfg := al.cfg
+	al.cfgMu.RUnlock()
+	if !cfg.Tools.Contacts.Enabled {
+		return nil
+	}
+	return newContactDirectory(cfg.WorkspacePath(), cfg)
+}
+
+// OCR returns the engine reading text in images, for channels to read
+// received photos with, or nil when OCR is disabled.
+func (al *AgentLoop) OCR() ocr.Engine {
+	al.cfgMu.RLock()
+	cfg := al.cfg
+	al.cfgMu.RUnlock()
+	return ocrEngine(cfg)
+}
+
+// Store returns the shared state database.
+func (al *AgentLoop) Store() *store.DB {
+	return al.store
+}
+
 func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
+	al.watchChannels(cm)
+	// Channels with native polls take them and report their votes
+	for _, name := range cm.GetEnabledChannels() {
+		if ch, ok := cm.GetChannel(name); ok {
+			if pc, ok := ch.(tools.PollChannel); ok {
+				al.polls.AddChannel(name, pc)
+			}
+		}
+	}
+}
+
+// Deliver sends content to a chat right away, reporting whether the
+// channel took it, for critical reminders to fall back on failure.
+func (al *AgentLoop) Deliver(ctx context.Context, channel, chatID, content string) error {
+	if al.channelManager == nil {
+		return fmt.Errorf("channels are not running")
+	}
+	return al.channelManager.SendToChannel(ctx, channel, chatID, content)
+}
+
+// Remember adds a message sent to a chat outside a conversation turn to
+// its history, so the model sees it when the user answers.
+func (al *AgentLoop) Remember(channel, chatID, content string) {
+	al.recordHandover(al.identities.Resolve(channel+":"+chatID), "assistant", content)
 }
 
 // RecordLastChannel records the last active channel for this workspace.
@@ -251,6 +1533,38 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 	})
 }
 
+// AnswerInline answers a one-off inline query (e.g. "@bot question" typed in
+// a Telegram chat the bot is not part of). The answer is posted into someone
+// else's conversation, so it runs without tools, session history or memory.
+func (al *AgentLoop) AnswerInline(ctx context.Context, senderID, query string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+
+	messages := []providers.Message{
+		{
+			Role: "system",
+			Content: "You answer inline queries that will be pasted into a chat with other people. " +
+				"Reply with a short, self-contained answer (at most a few sentences). " +
+				"Do not ask follow-up questions, do not mention tools, and do not reveal anything about the user.",
+		},
+		{Role: "user", Content: query},
+	}
+
+	response, err := al.provider.Chat(ctx, messages, nil, al.model, map[string]interface{}{
+		"max_tokens":  400,
+		"temperature": 0.3,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logger.DebugCF("agent", "Answered inline query", map[string]interface{}{
+		"sender_id": senderID,
+		"query_len": len(query),
+	})
+	return strings.TrimSpace(response.Content), nil
+}
+
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
 	// Add message preview to log (show full content for error messages)
 	var logContent string
@@ -259,8 +1573,9 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	} else {
 		logContent = utils.Truncate(msg.Content, 80)
 	}
-	logger.InfoCF("agent", fmt.Sprintf("Processing message from %s:%s: %s", msg.Channel, msg.SenderID, logContent),
+	logger.InfoCF("agent", fmt.Sprintf("Processing message from %s:%s", msg.Channel, msg.SenderID),
 		map[string]interface{}{
+			"preview":     logContent,
 			"channel":     msg.Channel,
 			"chat_id":     msg.ChatID,
 			"sender_id":   msg.SenderID,
@@ -271,21 +1586,73 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	if msg.Channel == "system" {
 		return al.processSystemMessage(ctx, msg)
 	}
+	if isEvent(msg) {
+		return al.processEvent(ctx, msg)
+	}
 
 	// Check for commands
 	if response, handled := al.handleCommand(ctx, msg); handled {
 		return response, nil
 	}
 
+	// A new chat is walked through setup first, and answers to the setup
+	// wizard's questions go to it; the chat's first message is answered
+	// once the wizard is over
+	if reply, pending, handled := al.handleSetup(ctx, msg); handled {
+		if pending == "" {
+			return reply, nil
+		}
+		msg.Content = pending
+	}
+
+	// A reply to a change waiting for confirmation lets it through; the
+	// model still sees the message and calls the tool again
+	al.confirmations.Answer(msg.Channel+":"+msg.ChatID, msg.Content)
+
+	// Any message in a chat a critical reminder reached counts as seeing
+	// it, so no further fallback is tried
+	al.critical.Acknowledge(msg.Channel + ":" + msg.ChatID)
+
+	// Rules from automation files answer some messages without the model
+	// and give it instructions for others
+	rule := al.matchRule(msg)
+	if rule != nil && rule.Reply != "" {
+		return rule.Reply, nil
+	}
+
+	limited := al.quotaApplies(msg.Channel, msg.SenderID)
+	if limited {
+		if notice, ok := al.quotas.admitMessage(ctx, msg.Channel, msg.SenderID); !ok {
+			return notice, nil
+		}
+		defer al.quotas.save(context.WithoutCancel(ctx))
+	}
+
+	// A reply picking an option a tool asked about runs that call now; the
+	// model sees the pick and its result with the message
+	userMessage := msg.Content
+	if steps, ok := al.plans.Answer(msg.Channel+":"+msg.ChatID, msg.Content); ok {
+		// The same goes for a plan the user approved, step by step
+		userMessage = al.runPlan(ctx, msg, steps)
+	} else if pick, ok := al.clarifications.Answer(msg.Channel+":"+msg.ChatID, msg.Content); ok {
+		userMessage = al.runPick(ctx, msg, pick)
+	}
+	if rule != nil {
+		userMessage += fmt.Sprintf("\n\n[Instructions from the %q rule: %s]", rule.Name, rule.Instructions)
+	}
+
 	// Process as user message
 	return al.runAgentLoop(ctx, processOptions{
-		SessionKey:      msg.SessionKey,
+		SessionKey:      al.identities.Resolve(msg.SessionKey),
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
+		SenderID:        msg.SenderID,
+		UserMessage:     userMessage,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		Limited:         limited,
+		Media:           msg.Media,
 	})
 }
 
@@ -341,9 +1708,30 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 	return "", nil
 }
 
+// replyLocale notes the language of the user's message and returns the
+// locale tool replies are worded in: the profile's, with the user's clock
+// and units, switched to the language the user is writing in unless the
+// profile fixes it.
+func (al *AgentLoop) replyLocale(opts processOptions) string {
+	chatKey := opts.Channel + ":" + opts.ChatID
+	p := al.profiles.Get(chatKey)
+	// Heartbeats and internal channels carry picoclaw's words, not the user's
+	if constants.IsInternalChannel(opts.Channel) || opts.NoHistory || al.languages == nil {
+		return p.FormatLocale()
+	}
+	lang := al.languages.observe(chatKey, opts.UserMessage)
+	if p.FixedLanguage {
+		return p.FormatLocale()
+	}
+	return locale.ForLanguage(p.FormatLocale(), lang)
+}
+
 // runAgentLoop is the core message processing logic.
 // It handles context building, LLM calls, tool execution, and response handling.
-func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (string, error) {
+func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (reply string, err error) {
+	ctx, finish := al.recordRound(ctx, opts)
+	defer func() { finish(reply, err) }()
+
 	// 0. Record last channel for heartbeat notifications (skip internal channels)
 	if opts.Channel != "" && opts.ChatID != "" {
 		// Don't record internal channels (cli, system, subagent)
@@ -357,6 +1745,16 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 
 	// 1. Update tool contexts
 	al.updateToolContexts(opts.Channel, opts.ChatID)
+	ctx = tools.WithSender(ctx, opts.SenderID)
+	ctx = dlp.WithGuard(ctx, al.guard)
+	if opts.ChatID != "" {
+		ctx = tools.WithChat(ctx, opts.Channel, opts.ChatID)
+		ctx = tools.WithUndo(ctx, al.undo, opts.Channel+":"+opts.ChatID)
+		ctx = tools.WithLocale(ctx, al.replyLocale(opts))
+		if !constants.IsInternalChannel(opts.Channel) {
+			ctx = transfer.WithProgress(ctx, al.transferProgress(opts.Channel, opts.ChatID))
+		}
+	}
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
@@ -372,6 +1770,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		nil,
 		opts.Channel,
 		opts.ChatID,
+		opts.SenderID,
 	)
 
 	// 3. Save user message to session
@@ -411,8 +1810,9 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 
 	// 9. Log response
 	responsePreview := utils.Truncate(finalContent, 120)
-	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
+	logger.InfoCF("agent", "Response",
 		map[string]interface{}{
+			"preview":      responsePreview,
 			"session_key":  opts.SessionKey,
 			"iterations":   iteration,
 			"final_length": len(finalContent),
@@ -421,14 +1821,38 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	return finalContent, nil
 }
 
+// systemPrompt builds the system prompt of the round opts describes again.
+func (al *AgentLoop) systemPrompt(opts processOptions) providers.Message {
+	var summary string
+	if !opts.NoHistory {
+		summary = al.sessions.GetSummary(opts.SessionKey)
+	}
+	return al.contextBuilder.BuildMessages(nil, summary, "", nil, opts.Channel, opts.ChatID, opts.SenderID)[0]
+}
+
 // runLLMIteration executes the LLM call loop with tool handling.
 // Returns the final content, iteration count, and any error.
 func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.Message, opts processOptions) (string, int, error) {
 	iteration := 0
 	var finalContent string
+	// The tools model runs until it stops calling tools; then the final
+	// model gets the same turn and either answers or calls more tools,
+	// handing back to the tools model. An image pins the whole turn to the
+	// vision model.
+	toolsModel, finalModel := al.modelFor(routeTools), al.modelFor(routeFinal)
+	if hasImage(opts.Media) {
+		toolsModel = al.modelFor(routeVision)
+		finalModel = toolsModel
+	}
+	finalPass := toolsModel == finalModel
+	toolsVersion := al.tools.Version()
 
 	for iteration < al.maxIterations {
 		iteration++
+		model := toolsModel
+		if finalPass {
+			model = finalModel
+		}
 
 		logger.DebugCF("agent", "LLM iteration",
 			map[string]interface{}{
@@ -436,14 +1860,19 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"max":       al.maxIterations,
 			})
 
-		// Build tool definitions
-		providerToolDefs := al.tools.ToProviderDefs()
+		// Build tool definitions, and list them again in the prompt if
+		// tools were added or removed since it was built
+		if version := al.tools.Version(); version != toolsVersion && len(messages) > 0 && messages[0].Role == "system" {
+			toolsVersion = version
+			messages[0] = al.systemPrompt(opts)
+		}
+		providerToolDefs := al.tools.ToProviderDefsForChat(opts.Channel, opts.ChatID, opts.SenderID)
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
 			map[string]interface{}{
 				"iteration":         iteration,
-				"model":             al.model,
+				"model":             model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
 				"max_tokens":        8192,
@@ -459,129 +1888,129 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"tools_json":    formatToolsForLog(providerToolDefs),
 			})
 
+		if opts.Limited {
+			if notice, ok := al.quotas.tokensLeft(ctx, opts.Channel, opts.SenderID); !ok {
+				finalContent = notice
+				break
+			}
+		}
+
 		var response *providers.LLMResponse
 		var err error
 
+		// Offline, a local model answers if there is one
+		provider := al.provider
+		local, localModel, offline := al.offline.localProvider()
+		if offline {
+			provider, model = local, localModel
+		}
+
 		// Retry loop for context/token errors
 		maxRetries := 2
 		for retry := 0; retry <= maxRetries; retry++ {
-			response, err = al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
+			llmCtx, span := tracing.StartKind(ctx, "llm.chat", tracing.KindClient,
+				tracing.String("model", model),
+				tracing.Int("iteration", iteration),
+				tracing.Int("retry", retry),
+				tracing.Int("messages", len(messages)))
+			started := time.Now()
+			llmMessages := messages
+			if offline {
+				_, since := al.offline.online()
+				llmMessages = offlineNote(messages, since)
+			}
+			response, err = provider.Chat(llmCtx, llmMessages, providerToolDefs, model, map[string]interface{}{
 				"max_tokens":  8192,
 				"temperature": 0.7,
 			})
+			llmDuration.Observe(time.Since(started).Seconds(), model)
+			if !offline {
+				al.recordModelCall(err)
+			}
+			if err != nil {
+				al.usage.record(model, nil, err)
+			} else {
+				al.usage.record(model, response.Usage, nil)
+				if opts.Limited && response.Usage != nil {
+					al.quotas.addTokens(ctx, opts.Channel, opts.SenderID, response.Usage.TotalTokens)
+				}
+			}
+			if err != nil {
+				span.RecordError(err)
+				llmRequests.Inc(model, "error")
+			} else {
+				llmRequests.Inc(model, "ok")
+				if response.Usage != nil {
+					span.SetAttributes(
+						tracing.Int("prompt_tokens", response.Usage.PromptTokens),
+						tracing.Int("completion_tokens", response.Usage.CompletionTokens))
+					llmTokens.Add(float64(response.Usage.PromptTokens), model, "prompt")
+					llmTokens.Add(float64(response.Usage.CompletionTokens), model, "completion")
+				}
+			}
+			span.End()
 
 			if err == nil {
+				if !offline && al.offline != nil {
+					al.offline.monitor.Succeeded()
+				}
 				break // Success
 			}
+			if isNetworkError(err) {
+				// Compressing history won't help; check the connection
+				if al.offline != nil {
+					al.offline.monitor.Suspect()
+				}
+				break
+			}
 
-			errMsg := strings.ToLower(err.Error())
-			// Check for context window errors (provider specific, but usually contain "token" or "invalid")
-			isContextError := strings.Contains(errMsg, "token") ||
-				strings.Contains(errMsg, "context") ||
-				strings.Contains(errMsg, "invalidparameter") ||
-				strings.Contains(errMsg, "length")
-
-			if isContextError && retry < maxRetries {
-				logger.WarnCF("agent", "Context window error detected, attempting compression", map[string]interface{}{
-					"error": err.Error(),
-					"retry": retry,
-				})
-
-				// Notify user on first retry only
-				if retry == 0 && !constants.IsInternalChannel(opts.Channel) && opts.SendResponse {
+			if !isContextOverflow(err) {
+				break
+			}
+			logger.WarnCF("agent", "Context window exceeded", map[string]interface{}{
+				"error": err.Error(),
+				"retry": retry,
+			})
+			switch retry {
+			case 0:
+				// First compact the history, as a long conversation is the
+				// usual cause
+				if !constants.IsInternalChannel(opts.Channel) && opts.SendResponse {
 					al.bus.PublishOutbound(bus.OutboundMessage{
 						Channel: opts.Channel,
 						ChatID:  opts.ChatID,
 						Content: "⚠️ Context window exceeded. Compressing history and retrying...",
 					})
 				}
-
-				// Force compression
 				al.forceCompression(opts.SessionKey)
-
-				// Rebuild messages with compressed history
-				// Note: We need to reload history from session manager because forceCompression changed it
-				newHistory := al.sessions.GetHistory(opts.SessionKey)
-				newSummary := al.sessions.GetSummary(opts.SessionKey)
-
-				// Re-create messages for the next attempt
-				// We keep the current user message (opts.UserMessage) effectively
-				messages = al.contextBuilder.BuildMessages(
-					newHistory,
-					newSummary,
-					opts.UserMessage,
-					nil,
-					opts.Channel,
-					opts.ChatID,
-				)
-
-				// Important: If we are in the middle of a tool loop (iteration > 1),
-				// rebuilding messages from session history might duplicate the flow or miss context
-				// if intermediate steps weren't saved correctly.
-				// However, al.sessions.AddFullMessage is called after every tool execution,
-				// so GetHistory should reflect the current state including partial tool execution.
-				// But we need to ensure we don't duplicate the user message which is appended in BuildMessages.
-				// BuildMessages(history...) takes the stored history and appends the *current* user message.
-				// If iteration > 1, the "current user message" was already added to history in step 3 of runAgentLoop.
-				// So if we pass opts.UserMessage again, we might duplicate it?
-				// Actually, step 3 is: al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
-				// So GetHistory ALREADY contains the user message!
-
-				// CORRECTION:
-				// BuildMessages combines: [System] + [History] + [CurrentMessage]
-				// But Step 3 added CurrentMessage to History.
-				// So if we use GetHistory now, it has the user message.
-				// If we pass opts.UserMessage to BuildMessages, it adds it AGAIN.
-
-				// For retry in the middle of a loop, we should rely on what's in the session.
-				// BUT checking BuildMessages implementation:
-				// It appends history... then appends currentMessage.
-
-				// Logic fix for retry:
-				// If iteration == 1, opts.UserMessage corresponds to the user input.
-				// If iteration > 1, we are processing tool results. The "messages" passed to Chat
-				// already accumulated tool outputs.
-				// Rebuilding from session history is safest because it persists state.
-				// Start fresh with rebuilt history.
-
-				// Special case: standard BuildMessages appends "currentMessage".
-				// If we are strictly retrying the *LLM call*, we want the exact same state as before but compressed.
-				// However, the "messages" argument passed to runLLMIteration is constructed by the caller.
-				// If we rebuild from Session, we need to know if "currentMessage" should be appended or is already in history.
-
-				// In runAgentLoop:
-				// 3. sessions.AddMessage(userMsg)
-				// 4. runLLMIteration(..., UserMessage)
-
-				// So History contains the user message.
-				// BuildMessages typically appends the user message as a *new* pending message.
-				// Wait, standard BuildMessages usage in runAgentLoop:
-				// messages := BuildMessages(history (has old), UserMessage)
-				// THEN AddMessage(UserMessage).
-				// So "history" passed to BuildMessages does NOT contain the current UserMessage yet.
-
-				// But here, inside the loop, we have already saved it.
-				// So GetHistory() includes the current user message.
-				// If we call BuildMessages(GetHistory(), UserMessage), we get duplicates.
-
-				// Hack/Fix:
-				// If we are retrying, we rebuild from Session History ONLY.
-				// We pass empty string as "currentMessage" to BuildMessages
-				// because the "current message" is already saved in history (step 3).
-
+				// The session already holds this turn's user message and
+				// tool results, so the empty message BuildMessages ends
+				// with is dropped
 				messages = al.contextBuilder.BuildMessages(
-					newHistory,
-					newSummary,
-					"", // Empty because history already contains the relevant messages
+					al.sessions.GetHistory(opts.SessionKey),
+					al.sessions.GetSummary(opts.SessionKey),
+					"",
 					nil,
 					opts.Channel,
 					opts.ChatID,
+					opts.SenderID,
 				)
-
+				messages = messages[:len(messages)-1]
+				continue
+			case 1:
+				// Then shorten the large tool results, in the session too
+				// so the next turn does not overflow on them again
+				shrunk := shrinkToolResults(messages)
+				history := al.sessions.GetHistory(opts.SessionKey)
+				if shrinkToolResults(history) > 0 {
+					al.sessions.SetHistory(opts.SessionKey, history)
+					al.sessions.Save(opts.SessionKey)
+				}
+				logger.InfoCF("agent", "Shortened tool results to fit the context window", map[string]interface{}{"results": shrunk})
 				continue
 			}
-
-			// Real error or success, break loop
+			// Still too large: say what takes the room
+			err = newContextOverflowError(err, messages)
 			break
 		}
 
@@ -596,6 +2025,10 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
+			if !finalPass {
+				finalPass = true
+				continue
+			}
 			finalContent = response.Content
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
 				map[string]interface{}{
@@ -604,6 +2037,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				})
 			break
 		}
+		finalPass = toolsModel == finalModel
 
 		// Log tool calls
 		toolNames := make([]string, 0, len(response.ToolCalls))
@@ -638,13 +2072,29 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		// Save assistant message with tool calls to session
 		al.sessions.AddFullMessage(opts.SessionKey, assistantMsg)
 
+		// Several changes at once wait for the user to approve them as a
+		// plan, which ends the turn
+		if steps := al.planSteps(opts, response.ToolCalls); steps != nil {
+			for _, tc := range response.ToolCalls {
+				held := providers.Message{Role: "tool", Content: "Not run yet: held in a plan for the user to approve.", ToolCallID: tc.ID}
+				messages = append(messages, held)
+				al.sessions.AddFullMessage(opts.SessionKey, held)
+			}
+			finalContent = al.plans.Hold(opts.Channel+":"+opts.ChatID, steps)
+			if response.Content != "" {
+				finalContent = response.Content + "\n\n" + finalContent
+			}
+			break
+		}
+
 		// Execute tool calls
 		for _, tc := range response.ToolCalls {
 			// Log tool call with arguments preview
 			argsJSON, _ := json.Marshal(tc.Arguments)
 			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
+			logger.InfoCF("agent", "Tool call: "+tc.Name,
 				map[string]interface{}{
+					"args":      argsPreview,
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
@@ -665,14 +2115,32 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				}
 			}
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			var toolResult *tools.ToolResult
+			var captured *httprec.Capture
+			if notice, ok := al.admitToolCall(ctx, opts, tc.Name); !ok {
+				toolResult = tools.ErrorResult(notice)
+			} else {
+				toolCtx := ctx
+				if opts.ChatID != "" && !constants.IsInternalChannel(opts.Channel) && al.features.Enabled(features.Streaming) {
+					toolCtx = tools.WithStream(ctx, al.toolStream(opts.Channel, opts.ChatID))
+				}
+				if replay.FromContext(ctx) != nil {
+					toolCtx, captured = httprec.WithCapture(toolCtx)
+				}
+				toolResult = al.tools.ExecuteWithContext(toolCtx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			}
+			replay.FromContext(ctx).AddToolCall(tc.Name, tc.Arguments, toolResult.ForLLM, toolResult.IsError, toolResult.Media, captured.Exchanges())
 
-			// Send ForUser content to user immediately if not Silent
-			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
+			// Send ForUser content and images to user immediately if not
+			// Silent; a question with options always goes, as the reply
+			// itself will not repeat them
+			if !toolResult.Silent && (toolResult.ForUser != "" || len(toolResult.Media) > 0) && (opts.SendResponse || toolResult.Clarify != nil) {
 				al.bus.PublishOutbound(bus.OutboundMessage{
 					Channel: opts.Channel,
 					ChatID:  opts.ChatID,
 					Content: toolResult.ForUser,
+					Media:   toolResult.Media,
+					Choices: toolResult.Clarify.Labels(),
 				})
 				logger.DebugCF("agent", "Sent tool result to user",
 					map[string]interface{}{
@@ -686,6 +2154,18 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			if contentForLLM == "" && toolResult.Err != nil {
 				contentForLLM = toolResult.Err.Error()
 			}
+			if !toolResult.IsError {
+				if summary, sent := al.deliverLargeResult(opts, tc.Name, contentForLLM); sent {
+					contentForLLM = summary
+				}
+			}
+			contentForLLM = al.tools.QuoteResult(tc.Name, tc.Arguments, contentForLLM)
+			// The first call of a tool with examples brings them along, so a
+			// malformed call is retried right and later ones follow them
+			if examples := al.contextBuilder.ToolExamples(tc.Name, messages); examples != "" {
+				contentForLLM += "\n\n" + examples
+				logger.DebugCF("agent", "Showed tool examples", map[string]interface{}{"tool": tc.Name, "failed": toolResult.IsError})
+			}
 
 			toolResultMsg := providers.Message{
 				Role:       "tool",
@@ -704,12 +2184,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 
 // updateToolContexts updates the context for tools that need channel/chatID info.
 func (al *AgentLoop) updateToolContexts(channel, chatID string) {
-	// Use ContextualTool interface instead of type assertions
-	if tool, ok := al.tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID)
-		}
-	}
+	// The message tool reads the chat from each call's context instead
 	if tool, ok := al.tools.Get("spawn"); ok {
 		if st, ok := tool.(tools.ContextualTool); ok {
 			st.SetContext(channel, chatID)
@@ -740,7 +2215,7 @@ func (al *AgentLoop) maybeSummarize(sessionKey, channel, chatID string) {
 						Content: "⚠️ Memory threshold reached. Optimizing conversation history...",
 					})
 				}
-				al.summarizeSession(sessionKey)
+				al.summarizeSession(sessionKey, channel, chatID)
 			}()
 		}
 	}
@@ -875,8 +2350,8 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 }
 
 // summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(sessionKey string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+func (al *AgentLoop) summarizeSession(sessionKey, channel, chatID string) {
+	ctx, cancel := context.WithTimeout(tools.WithChat(context.Background(), channel, chatID), 120*time.Second)
 	defer cancel()
 
 	history := al.sessions.GetHistory(sessionKey)
@@ -925,7 +2400,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 
 		// Merge them
 		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.model, map[string]interface{}{
+		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.modelFor(routeSummarize), map[string]interface{}{
 			"max_tokens":  1024,
 			"temperature": 0.3,
 		})
@@ -960,7 +2435,7 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
 	}
 
-	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
+	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.modelFor(routeSummarize), map[string]interface{}{
 		"max_tokens":  1024,
 		"temperature": 0.3,
 	})
@@ -1031,6 +2506,38 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 			return fmt.Sprintf("Unknown list target: %s", args[0]), true
 		}
 
+	case "/setup":
+		return al.startSetup(msg, ""), true
+
+	case "/voice":
+		chatKey := msg.Channel + ":" + msg.ChatID
+		if len(args) < 1 {
+			status := "off"
+			if al.state.GetChatSettings(chatKey).VoiceReplies {
+				status = "on"
+			}
+			return fmt.Sprintf("Voice replies are %s. Usage: /voice [on|off]", status), true
+		}
+		var enabled bool
+		switch args[0] {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			return "Usage: /voice [on|off]", true
+		}
+		if err := al.state.UpdateChatSettings(chatKey, func(s *state.ChatSettings) { s.VoiceReplies = enabled }); err != nil {
+			return fmt.Sprintf("Failed to save setting: %v", err), true
+		}
+		if enabled {
+			return "Voice replies on: I'll answer your voice notes with a voice note.", true
+		}
+		return "Voice replies off.", true
+
+	case "/local":
+		return al.localCommand(msg, args), true
+
 	case "/switch":
 		if len(args) < 3 || args[1] != "to" {
 			return "Usage: /switch [model|channel] to <name>", true
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/testkit"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -624,3 +626,60 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+// exampleTool wants a query and shows how to write one
+type exampleTool struct{ mockCustomTool }
+
+func (m *exampleTool) Name() string { return "lookup" }
+
+func (m *exampleTool) Examples() []tools.ToolExample {
+	return []tools.ToolExample{{Request: "Find the lease", Args: map[string]interface{}{"query": "name:lease"}}}
+}
+
+func (m *exampleTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	if _, ok := args["query"].(string); !ok {
+		return tools.ErrorResult("query is required")
+	}
+	return tools.SilentResult("found it")
+}
+
+// TestToolExamples_ShownOnFirstCall verifies a tool's examples come with the result of its first call in a conversation only
+func TestToolExamples_ShownOnFirstCall(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := testkit.NewProvider(
+		testkit.CallTool("lookup", map[string]interface{}{"text": "lease"}),
+		testkit.CallTool("lookup", map[string]interface{}{"query": "name:lease"}),
+		testkit.Say("Found it."),
+		testkit.CallTool("lookup", map[string]interface{}{"query": "name:will"}),
+		testkit.Say("Found that too."),
+	)
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.RegisterTool(&exampleTool{})
+	helper := testHelper{al: al}
+	msg := func(content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7", Content: content, SessionKey: "telegram:7"}
+	}
+
+	helper.executeAndGetResponse(t, context.Background(), msg("find my lease"))
+	helper.executeAndGetResponse(t, context.Background(), msg("and my will"))
+
+	calls := provider.Calls()
+	var shown []string
+	for _, i := range []int{1, 2, 4} {
+		if last := calls[i].LastMessage(); strings.Contains(last, "[Examples of well-formed lookup calls:\n- Find the lease: {\"query\":\"name:lease\"}]") {
+			shown = append(shown, last)
+		}
+	}
+	if len(shown) != 1 || !strings.HasPrefix(shown[0], "query is required") {
+		t.Errorf("Expected the examples only after the first, failed call, got %q", shown)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 // MemoryStore manages persistent memory for the agent.
@@ -159,3 +161,19 @@ func (ms *MemoryStore) GetMemoryContext() string {
 	}
 	return fmt.Sprintf("# Memory\n\n%s", result)
 }
+
+// chatHistory returns a chat's conversation history, shared by its linked
+// accounts.
+func (al *AgentLoop) chatHistory(channel, chatID string) []providers.Message {
+	return al.sessions.GetHistory(al.identities.Resolve(channel + ":" + chatID))
+}
+
+// clearHistory deletes a chat's conversation history and summary, for
+// users asking to be forgotten. The chat's linked accounts share them.
+func (al *AgentLoop) clearHistory(channel, chatID string) error {
+	key := al.identities.Resolve(channel + ":" + chatID)
+	al.sessions.GetOrCreate(key)
+	al.sessions.SetHistory(key, nil)
+	al.sessions.SetSummary(key, "")
+	return al.sessions.Save(key)
+}
@@ -0,0 +1,18 @@
+package agent
+
+import "github.com/sipeed/picoclaw/pkg/metrics"
+
+var (
+	messageDuration = metrics.NewHistogram("picoclaw_message_duration_seconds",
+		"Time from taking a message off the queue to having the reply, by channel.", nil, "channel")
+	llmRequests = metrics.NewCounter("picoclaw_llm_requests_total",
+		"LLM chat requests by model and result.", "model", "result")
+	llmDuration = metrics.NewHistogram("picoclaw_llm_request_duration_seconds",
+		"LLM chat request latency, by model.", nil, "model")
+	llmTokens = metrics.NewCounter("picoclaw_llm_tokens_total",
+		"Tokens reported by the provider, by model and type (prompt, completion).", "model", "type")
+	inboundCoalesced = metrics.NewCounter("picoclaw_inbound_coalesced_total",
+		"Messages merged into another message's round instead of getting their own, by channel.", "channel")
+	inboundDropped = metrics.NewCounter("picoclaw_inbound_dropped_total",
+		"Messages dropped because their chat had too many waiting, by channel.", "channel")
+)
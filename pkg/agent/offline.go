@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/connectivity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// maxHeldMessages bounds the messages kept for when the connection is back.
+const maxHeldMessages = 50
+
+// networkErrorReply replaces a raw timeout when the model could not be
+// reached.
+const networkErrorReply = "I couldn't reach the AI service just now: the network seems to be down or very slow. Please try again in a little while."
+
+// offlineMode tracks the internet connection. While it is down, tools
+// needing it are refused or deferred by the registry, a local model
+// answers if one is configured, and otherwise messages are held and
+// answered once the connection is back.
+type offlineMode struct {
+	monitor    *connectivity.Monitor
+	deferred   *tools.DeferredActions
+	interval   time.Duration
+	local      providers.LLMProvider // nil without offline.model
+	localModel string
+
+	mu       sync.Mutex
+	held     []bus.InboundMessage
+	notified map[string]bool // chats told their messages wait
+}
+
+// newOfflineMode returns nil when offline mode is disabled.
+func newOfflineMode(cfg *config.Config, deferred *tools.DeferredActions) *offlineMode {
+	if !cfg.Offline.Enabled {
+		return nil
+	}
+	o := &offlineMode{
+		monitor:  connectivity.New(cfg.Offline.Targets),
+		deferred: deferred,
+		interval: time.Duration(cfg.Offline.CheckSeconds) * time.Second,
+		notified: make(map[string]bool),
+	}
+	if cfg.Offline.Model != "" && cfg.Providers.VLLM.APIBase != "" {
+		o.local = providers.NewHTTPProvider(cfg.Providers.VLLM.APIKey, cfg.Providers.VLLM.APIBase, "")
+		o.localModel = cfg.Offline.Model
+	}
+	return o
+}
+
+// online reports whether the connection is up; always true without
+// offline mode.
+func (o *offlineMode) online() (bool, time.Time) {
+	if o == nil {
+		return true, time.Time{}
+	}
+	return o.monitor.Online()
+}
+
+// localProvider returns the local model to use while offline, if any.
+func (o *offlineMode) localProvider() (providers.LLMProvider, string, bool) {
+	if online, _ := o.online(); online || o.local == nil {
+		return nil, "", false
+	}
+	return o.local, o.localModel, true
+}
+
+// startOffline probes the connection until ctx is done and catches up
+// whenever it comes back.
+func (al *AgentLoop) startOffline(ctx context.Context) {
+	if al.offline == nil {
+		return
+	}
+	al.offline.monitor.OnChange(func(online bool) {
+		if online {
+			go al.backOnline(ctx)
+		}
+	})
+	go al.offline.monitor.Run(ctx, al.offline.interval)
+}
+
+// backOnline makes the changes deferred while offline, then hands the held
+// messages back to the agent.
+func (al *AgentLoop) backOnline(ctx context.Context) {
+	if ran := al.offline.deferred.Replay(ctx, al.tools); ran > 0 {
+		logger.InfoCF("agent", "Made changes deferred while offline", map[string]interface{}{"calls": ran})
+	}
+	al.offline.mu.Lock()
+	held := al.offline.held
+	al.offline.held = nil
+	al.offline.notified = make(map[string]bool)
+	al.offline.mu.Unlock()
+	for _, msg := range held {
+		al.bus.PublishInbound(msg)
+	}
+}
+
+// holdWhileOffline keeps msg for later when there is no connection and no
+// local model to answer it, telling the chat once per outage. Commands
+// still run, since most are answered locally.
+func (al *AgentLoop) holdWhileOffline(msg bus.InboundMessage) bool {
+	o := al.offline
+	online, since := o.online()
+	if online || o.local != nil || strings.HasPrefix(strings.TrimSpace(msg.Content), "/") {
+		return false
+	}
+	key := chatKey(msg)
+	o.mu.Lock()
+	full := len(o.held) >= maxHeldMessages
+	if !full {
+		o.held = append(o.held, msg)
+	}
+	// An event's notification waits without telling the chat, which is
+	// told when its user writes
+	notify := !isEvent(msg) && (!o.notified[key] || full)
+	if !isEvent(msg) {
+		o.notified[key] = true
+	}
+	o.mu.Unlock()
+
+	if !notify || msg.Channel == "system" {
+		return true
+	}
+	text := fmt.Sprintf("📴 There has been no internet connection since %s, so I can't answer yet. I'll reply as soon as the connection is back; reminders you've set still go off.", since.Format("15:04"))
+	if full {
+		text = fmt.Sprintf("📴 There has been no internet connection since %s and I'm already holding too many messages, so I couldn't keep this one. Please send it again once I'm back online.", since.Format("15:04"))
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: text})
+	return true
+}
+
+// heldMessages removes and returns the messages waiting for the
+// connection.
+func (o *offlineMode) heldMessages() []bus.InboundMessage {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	held := o.held
+	o.held = nil
+	return held
+}
+
+// networkStatus is the /status line for the connection, empty without
+// offline mode.
+func (o *offlineMode) networkStatus() string {
+	if o == nil {
+		return ""
+	}
+	online, since := o.monitor.Online()
+	if online {
+		return "Network: online"
+	}
+	o.mu.Lock()
+	held := len(o.held)
+	o.mu.Unlock()
+	status := fmt.Sprintf("Network: offline since %s, %d messages and %d changes waiting",
+		since.Format("Jan 2 15:04"), held, len(o.deferred.Pending()))
+	if o.local != nil {
+		status += ", answering with " + o.localModel
+	}
+	return status
+}
+
+// offlineNote tells the local model what it can't do, appended to the
+// system prompt of a copy of messages.
+func offlineNote(messages []providers.Message, since time.Time) []providers.Message {
+	if len(messages) == 0 || messages[0].Role != "system" {
+		return messages
+	}
+	out := append([]providers.Message(nil), messages...)
+	out[0].Content += fmt.Sprintf("\n\n## Offline\n\nThere has been no internet connection since %s and you are running on a local model. Only tools on this device work: files, notes, lists and reminders. Changes to online services are saved and made when the connection is back. Tell the user plainly what you can't do right now instead of retrying.",
+		since.Format("15:04"))
+	return out
+}
+
+// isNetworkError reports whether err means a remote service could not be
+// reached, as opposed to the service answering with an error.
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"dial tcp", "no such host", "connection refused", "network is unreachable", "i/o timeout", "tls handshake timeout", "connection reset"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// quietHoursPattern reads quiet hours like "22:00-07:00" or "22:30 to 6:30".
+var quietHoursPattern = regexp.MustCompile(`^(\d{1,2}:\d{2})\s*(?:-|–|to)\s*(\d{1,2}:\d{2})$`)
+
+// setupStep is a question of the setup wizard.
+type setupStep struct {
+	name string
+	// ask returns the question, or a note and false when there is nothing
+	// to ask in this chat ("" to skip the step silently)
+	ask func(al *AgentLoop, msg bus.InboundMessage) (string, bool)
+	// answer takes the user's reply and returns what was done, or false
+	// with what to say when the question is asked again
+	answer func(al *AgentLoop, ctx context.Context, msg bus.InboundMessage, reply string) (string, bool)
+}
+
+// setupSteps are the wizard's questions, in the order they are asked.
+var setupSteps = []setupStep{
+	{name: "google", ask: askGoogle, answer: answerGoogle},
+	{name: "timezone", ask: askTimezone, answer: answerTimezone},
+	{name: "quiet_hours", ask: askQuietHours, answer: answerQuietHours},
+	{name: "features", ask: askFeatures, answer: answerFeatures},
+	{name: "briefing", ask: askBriefing, answer: answerBriefing},
+}
+
+const setupIntro = "👋 Welcome! A few quick questions to set things up. Reply skip to pass one, or stop to finish later with /setup."
+
+// googleConnected reports whether Google is set up and an account logged in.
+func (al *AgentLoop) googleConnected() bool {
+	al.cfgMu.RLock()
+	clientID := al.cfg.Google.ClientID
+	al.cfgMu.RUnlock()
+	if clientID == "" {
+		return false
+	}
+	cred, err := auth.GetCredential(auth.GoogleProvider)
+	return err == nil && cred != nil
+}
+
+func askGoogle(al *AgentLoop, msg bus.InboundMessage) (string, bool) {
+	switch {
+	case al.googleConnected():
+		return "✅ Google is connected, so Gmail, Calendar, Drive and Photos can be used.", false
+	case !al.isOwner(msg):
+		return "Google is not connected yet; the owner can connect it for Gmail, Calendar, Drive and Photos.", false
+	}
+	return "🔗 Connect Google to use Gmail, Calendar, Drive and Photos: set google.client_id and google.client_secret in the config, run `picoclaw auth login --provider google` where picoclaw runs, then reply done.", true
+}
+
+func answerGoogle(al *AgentLoop, ctx context.Context, msg bus.InboundMessage, reply string) (string, bool) {
+	if !al.googleConnected() {
+		return "Google is still not connected. Reply done once the login finished, or skip.", false
+	}
+	return "✅ Google is connected.", true
+}
+
+func askTimezone(al *AgentLoop, msg bus.InboundMessage) (string, bool) {
+	return "🕐 What is your timezone? An IANA name like Europe/Lisbon or America/New_York.", true
+}
+
+func answerTimezone(al *AgentLoop, ctx context.Context, msg bus.InboundMessage, reply string) (string, bool) {
+	chatKey := msg.Channel + ":" + msg.ChatID
+	p := al.profiles.Get(chatKey)
+	p.Timezone = strings.ReplaceAll(strings.TrimSpace(reply), " ", "_")
+	if err := al.profiles.Set(chatKey, p); err != nil {
+		return fmt.Sprintf("%v. Try again, or skip.", err), false
+	}
+	return fmt.Sprintf("✅ Timezone set to %s.", p.Timezone), true
+}
+
+func askQuietHours(al *AgentLoop, msg bus.InboundMessage) (string, bool) {
+	return "🌙 When should I hold notifications? Quiet hours like 22:00-07:00, or none.", true
+}
+
+func answerQuietHours(al *AgentLoop, ctx context.Context, msg bus.InboundMessage, reply string) (string, bool) {
+	chatKey := msg.Channel + ":" + msg.ChatID
+	p := al.profiles.Get(chatKey)
+	reply = strings.ToLower(strings.TrimSpace(reply))
+	if reply == "none" || reply == "no" {
+		p.QuietStart, p.QuietEnd = "", ""
+	} else {
+		m := quietHoursPattern.FindStringSubmatch(reply)
+		if m == nil {
+			return "Give the quiet hours as a start and end, like 22:00-07:00, or none.", false
+		}
+		for i, field := range []*string{&p.QuietStart, &p.QuietEnd} {
+			clock, err := time.Parse("15:04", m[i+1])
+			if err != nil {
+				return fmt.Sprintf("%s is not a time of day; try something like 22:00-07:00.", m[i+1]), false
+			}
+			*field = clock.Format("15:04")
+		}
+	}
+	if err := al.profiles.Set(chatKey, p); err != nil {
+		return fmt.Sprintf("%v. Try again, or skip.", err), false
+	}
+	if p.QuietStart == "" {
+		return "✅ No quiet hours.", true
+	}
+	return fmt.Sprintf("✅ Quiet from %s to %s.", p.QuietStart, p.QuietEnd), true
+}
+
+func askFeatures(al *AgentLoop, msg bus.InboundMessage) (string, bool) {
+	if !al.isOwner(msg) || al.features == nil {
+		return "", false
+	}
+	var sb strings.Builder
+	sb.WriteString("🧩 Optional features:")
+	for _, f := range al.features.All() {
+		fmt.Fprintf(&sb, "\n%s: %s - %s", f.Name, onOff(f.Enabled), f.Description)
+	}
+	sb.WriteString("\nReply with the ones to change, like \"browser on, plan_preview off\", or ok to keep them.")
+	return sb.String(), true
+}
+
+func answerFeatures(al *AgentLoop, ctx context.Context, msg bus.InboundMessage, reply string) (string, bool) {
+	reply = strings.ToLower(strings.TrimSpace(reply))
+	if reply == "ok" || reply == "keep" {
+		return "✅ Features unchanged.", true
+	}
+	var changed []string
+	for _, part := range strings.FieldsFunc(reply, func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+		fields := strings.Fields(part)
+		if len(fields) != 2 || (fields[1] != "on" && fields[1] != "off") {
+			return fmt.Sprintf("%q is not a feature and on or off, like \"browser on\". Try again, or ok.", strings.TrimSpace(part)), false
+		}
+		if err := al.features.Toggle(fields[0], fields[1] == "on"); err != nil {
+			return fmt.Sprintf("%v. Try again, or ok.", err), false
+		}
+		changed = append(changed, fields[0]+" "+fields[1])
+	}
+	if len(changed) == 0 {
+		return "✅ Features unchanged.", true
+	}
+	return fmt.Sprintf("✅ %s. Tools restarted: %d loaded.", strings.Join(changed, ", "), al.RestartTools()), true
+}
+
+func askBriefing(al *AgentLoop, msg bus.InboundMessage) (string, bool) {
+	if _, ok := al.tools.Get("briefing"); !ok {
+		return "", false
+	}
+	return "☀️ Would you like a daily briefing with your calendar, email, weather and reminders? Reply with a time like 07:30, or no.", true
+}
+
+func answerBriefing(al *AgentLoop, ctx context.Context, msg bus.InboundMessage, reply string) (string, bool) {
+	reply = strings.ToLower(strings.TrimSpace(reply))
+	if reply == "no" || reply == "none" {
+		return "No daily briefing; just ask when you want one.", true
+	}
+	clock, err := time.Parse("15:04", reply)
+	if err != nil {
+		return "Give a time of day like 07:30, or no.", false
+	}
+	al.updateToolContexts(msg.Channel, msg.ChatID)
+	result := al.tools.ExecuteWithContext(tools.WithSender(ctx, msg.SenderID), "automations",
+		map[string]interface{}{"action": "enable", "name": "daily_briefing", "time": clock.Format("15:04")}, msg.Channel, msg.ChatID, nil)
+	if result.IsError {
+		return fmt.Sprintf("Could not schedule the briefing: %s. Try another time, or no.", result.ForLLM), false
+	}
+	return fmt.Sprintf("✅ Daily briefing every day at %s.", clock.Format("15:04")), true
+}
+
+// firstContact reports whether msg opens a new private chat that should
+// be walked through setup.
+func (al *AgentLoop) firstContact(msg bus.InboundMessage, settings state.ChatSettings) bool {
+	al.cfgMu.RLock()
+	enabled := al.cfg.Agents.Defaults.Onboarding
+	al.cfgMu.RUnlock()
+	if !enabled || settings.SetupDone || constants.IsInternalChannel(msg.Channel) || msg.Metadata["is_group"] == "true" {
+		return false
+	}
+	return len(al.sessions.GetHistory(al.identities.Resolve(msg.SessionKey))) == 0
+}
+
+// startSetup begins the wizard in msg's chat, keeping pending to answer
+// when it is over.
+func (al *AgentLoop) startSetup(msg bus.InboundMessage, pending string) string {
+	chatKey := msg.Channel + ":" + msg.ChatID
+	notes := []string{setupIntro}
+	reply, step := al.nextSetupStep(msg, 0, &notes)
+	err := al.state.UpdateChatSettings(chatKey, func(s *state.ChatSettings) {
+		s.SetupStep, s.SetupDone, s.SetupPending = step, step == "", pending
+	})
+	if err != nil {
+		return fmt.Sprintf("Could not start the setup: %v", err)
+	}
+	logger.InfoCF("agent", "Setup wizard started", map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID})
+	return reply
+}
+
+// nextSetupStep asks the first step from index on that has a question for
+// the chat, after notes. It returns the reply and the step now waiting,
+// "" when the wizard is over.
+func (al *AgentLoop) nextSetupStep(msg bus.InboundMessage, from int, notes *[]string) (string, string) {
+	for _, step := range setupSteps[from:] {
+		text, wait := step.ask(al, msg)
+		if text != "" {
+			*notes = append(*notes, text)
+		}
+		if wait {
+			return strings.Join(*notes, "\n\n"), step.name
+		}
+	}
+	*notes = append(*notes, "All set. Ask me any time to change these, or send /setup to go through them again.")
+	return strings.Join(*notes, "\n\n"), ""
+}
+
+// handleSetup runs the wizard for msg: it starts it on a new chat's first
+// message and otherwise takes msg as the answer to the question waiting.
+// When the wizard ends with a first message still to answer, that
+// message is returned as pending for the caller to process, and the
+// wizard's reply is sent on its own.
+func (al *AgentLoop) handleSetup(ctx context.Context, msg bus.InboundMessage) (reply, pending string, handled bool) {
+	if al.state == nil || msg.Channel == "system" {
+		return "", "", false
+	}
+	chatKey := msg.Channel + ":" + msg.ChatID
+	settings := al.state.GetChatSettings(chatKey)
+	if settings.SetupStep == "" {
+		if !al.firstContact(msg, settings) {
+			return "", "", false
+		}
+		return al.startSetup(msg, msg.Content), "", true
+	}
+
+	index := -1
+	for i, step := range setupSteps {
+		if step.name == settings.SetupStep {
+			index = i
+		}
+	}
+	answer := strings.TrimSpace(msg.Content)
+	var notes []string
+	next := ""
+	switch {
+	case index < 0 || strings.EqualFold(answer, "stop"):
+		notes = append(notes, "Setup stopped; send /setup any time to finish it.")
+	case strings.EqualFold(answer, "skip"):
+		reply, next = al.nextSetupStep(msg, index+1, &notes)
+	default:
+		note, ok := setupSteps[index].answer(al, ctx, msg, answer)
+		if !ok {
+			return note, "", true
+		}
+		notes = append(notes, note)
+		reply, next = al.nextSetupStep(msg, index+1, &notes)
+	}
+	if reply == "" {
+		reply = strings.Join(notes, "\n\n")
+	}
+	if err := al.state.UpdateChatSettings(chatKey, func(s *state.ChatSettings) {
+		s.SetupStep = next
+		if next == "" {
+			s.SetupDone, s.SetupPending = true, ""
+		}
+	}); err != nil {
+		logger.WarnCF("agent", "Failed to save the setup progress", map[string]interface{}{"error": err.Error()})
+	}
+	if next == "" && settings.SetupPending != "" && !strings.HasPrefix(settings.SetupPending, "/") {
+		al.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply})
+		return "", settings.SetupPending, true
+	}
+	return reply, "", true
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/features"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestSetupWizard_WalksANewChatThroughSetup verifies a new private chat's first message starts the wizard, each answer is checked and saved to the profile, features and schedule, and the first message is answered at the end
+func TestSetupWizard_WalksANewChatThroughSetup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+			Workspace:         t.TempDir(),
+			Model:             "test-model",
+			MaxTokens:         4096,
+			MaxToolIterations: 5,
+			Onboarding:        true,
+		}},
+		Owners: config.FlexibleStringSlice{"telegram:42"},
+	}
+	cfg.Tools.Briefing.Enabled = true
+	cfg.Tools.Briefing.Time = "07:00"
+	provider := testkit.NewProvider(testkit.Say("Nothing on your calendar today."))
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, provider)
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	wire := func() {
+		for _, st := range al.ScheduledTools() {
+			st.SetScheduler(cs)
+		}
+	}
+	wire()
+	al.OnToolsReloaded(wire)
+	helper := testHelper{al: al}
+	send := func(content string) string {
+		return helper.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+			Channel: "telegram", ChatID: "42", SenderID: "42", SessionKey: "telegram:42", Content: content,
+		})
+	}
+
+	steps := []struct{ send, want string }{
+		{"what's on today?", "🔗 Connect Google"},
+		{"skip", "🕐 What is your timezone?"},
+		{"Mars/Olympus", "unknown timezone"},
+		{"Europe/Lisbon", "✅ Timezone set to Europe/Lisbon.\n\n🌙"},
+		{"22:00 to 7:00", "✅ Quiet from 22:00 to 07:00.\n\n🧩 Optional features:"},
+		{"browser on", "✅ browser on."},
+		{"7:30", "Nothing on your calendar today."},
+	}
+	for _, step := range steps {
+		if reply := send(step.send); !strings.Contains(reply, step.want) {
+			t.Fatalf("After %q expected %q, got %q", step.send, step.want, reply)
+		}
+	}
+	if calls := provider.Calls(); len(calls) != 1 || calls[0].LastMessage() != "what's on today?" {
+		t.Errorf("Expected only the first message sent to the model, got %d calls", len(calls))
+	}
+
+	p := al.profiles.Get("telegram:42")
+	if p.Timezone != "Europe/Lisbon" || p.QuietStart != "22:00" || p.QuietEnd != "07:00" {
+		t.Errorf("Expected the answers in the profile, got %+v", p)
+	}
+	if !al.features.State(features.Browser).Enabled {
+		t.Error("Expected the browser feature turned on")
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 1 || jobs[0].Schedule.Expr != "30 7 * * *" || jobs[0].Schedule.TZ != "Europe/Lisbon" {
+		t.Errorf("Expected the briefing at 07:30 Lisbon time, got %+v", jobs)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+	defer cancel()
+	if out, ok := msgBus.SubscribeOutbound(ctx); !ok || !strings.Contains(out.Content, "✅ Daily briefing every day at 07:30.\n\nAll set.") {
+		t.Errorf("Expected the wizard's last reply sent before the answer, got %q", out.Content)
+	}
+
+	if reply := send("/setup"); !strings.Contains(reply, "👋 Welcome!") {
+		t.Errorf("Expected /setup to start again, got %q", reply)
+	}
+	if reply := send("stop"); !strings.Contains(reply, "Setup stopped") {
+		t.Errorf("Expected the wizard stopped, got %q", reply)
+	}
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/outage"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// aiService is what the model's backend is called in outage reports.
+const aiService = "AI service"
+
+// newOutageTracker returns the tracker for cfg, with the model's backend
+// watched, or nil when outage tracking is disabled. Google services are
+// added as tools first use them, channels once the manager is set.
+func newOutageTracker(cfg *config.Config, provider providers.LLMProvider) *outage.Tracker {
+	if !cfg.Outages.Enabled {
+		return nil
+	}
+	t := outage.New()
+	var probe outage.Probe
+	if hc, ok := provider.(providers.HealthChecker); ok {
+		probe = hc.CheckHealth
+	}
+	t.Watch(aiService, probe)
+	return t
+}
+
+// startOutages probes the services until ctx is done and makes the
+// changes that waited for one once it is back.
+func (al *AgentLoop) startOutages(ctx context.Context) {
+	if al.outages == nil {
+		return
+	}
+	outage.SetDefault(al.outages)
+	if al.offline != nil {
+		// Without a connection every service looks down; offline mode
+		// handles that
+		al.outages.SetOnline(func() bool {
+			online, _ := al.offline.online()
+			return online
+		})
+	}
+	al.outages.OnChange(func(service string, up bool) {
+		if up {
+			go al.serviceBack(ctx, service)
+		}
+	})
+	al.cfgMu.RLock()
+	interval := time.Duration(al.cfg.Outages.CheckSeconds) * time.Second
+	al.cfgMu.RUnlock()
+	go al.outages.Run(ctx, interval)
+}
+
+// serviceBack makes the changes that waited for service.
+func (al *AgentLoop) serviceBack(ctx context.Context, service string) {
+	if ran := al.deferred.Replay(ctx, al.tools); ran > 0 {
+		logger.InfoCF("agent", "Made changes deferred during an outage", map[string]interface{}{"service": service, "calls": ran})
+	}
+	if service == "Gmail" {
+		al.mail.Deliver(ctx)
+	}
+}
+
+// watchChannels adds a probe for each channel, reading the watchdog's
+// last check instead of checking again.
+func (al *AgentLoop) watchChannels(cm *channels.Manager) {
+	if al.outages == nil {
+		return
+	}
+	for _, name := range cm.GetEnabledChannels() {
+		name := name
+		al.outages.Watch(channelService(name), func(ctx context.Context) error {
+			for _, h := range cm.Health() {
+				if h.Name != name || h.State == channels.ChannelOK {
+					continue
+				}
+				if h.LastError != "" {
+					return fmt.Errorf("%s: %s", h.State, h.LastError)
+				}
+				return fmt.Errorf("%s", h.State)
+			}
+			return nil
+		})
+	}
+}
+
+// channelService is what a channel is called in outage reports.
+func channelService(name string) string {
+	return name + " channel"
+}
+
+// recordModelCall tells the tracker how a call to the model went.
+func (al *AgentLoop) recordModelCall(err error) {
+	if al.outages == nil {
+		return
+	}
+	switch {
+	case err == nil:
+		al.outages.Succeeded(aiService)
+	case outage.IsOutage(0, err):
+		al.outages.Failed(aiService, err)
+	}
+}
+
+// modelOutageReply replaces the error of a failed round when the model's
+// backend is down, or is "" when it is not.
+func (al *AgentLoop) modelOutageReply(ctx context.Context, err error) string {
+	if al.outages == nil || !outage.IsOutage(0, err) {
+		return ""
+	}
+	down, since := al.outages.Confirm(ctx, aiService)
+	if !down {
+		return ""
+	}
+	return fmt.Sprintf("The AI service appears to be down (since %s), so I can't answer right now. I'll be able to once it's back; please try again in a little while.", since.Format("15:04"))
+}
+
+// servicesStatus is the /status line for the tracked services, empty
+// without outage tracking.
+func (al *AgentLoop) servicesStatus() string {
+	if al.outages == nil {
+		return ""
+	}
+	statuses := al.outages.Statuses()
+	var down []string
+	for _, s := range statuses {
+		if !s.Up {
+			down = append(down, fmt.Sprintf("%s down since %s (%s)", s.Service, s.Since.Format("Jan 2 15:04"), s.LastError))
+		}
+	}
+	up := len(statuses) - len(down)
+	if len(down) == 0 {
+		return fmt.Sprintf("Services: all %d up", up)
+	}
+	return fmt.Sprintf("Services: %s; %d up", strings.Join(down, ", "), up)
+}
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// shrunkResultChars is how much of each tool result stays in the model's
+// context when a request overflowed even after compacting the history.
+const shrunkResultChars = 2000
+
+// overflowParts is how many of the largest pieces an overflow reply names.
+const overflowParts = 3
+
+// isContextOverflow reports whether a provider error says the request did
+// not fit the model's context window. Providers word it differently
+// ("context_length_exceeded", "prompt is too long", "maximum context
+// length"); a bare mention of tokens, like an expired API token, is not
+// an overflow.
+func isContextOverflow(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{
+		"context_length_exceeded", "context length", "context window", "maximum context",
+		"context size", "prompt is too long", "input is too long", "too many tokens",
+		"token limit", "reduce the length", "request too large",
+		"string_above_max_length",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	// Others say the tokens exceed a maximum, or only name the parameter
+	// that was too long
+	return strings.Contains(msg, "token") && strings.Contains(msg, "exceed") ||
+		strings.Contains(msg, "invalidparameter") && strings.Contains(msg, "length")
+}
+
+// shrinkToolResults cuts every tool result longer than shrunkResultChars
+// down to its start, with a note saying how much was left out, and
+// returns how many it cut. Tool results are what usually overflows a
+// turn: a whole file, a long search, an email thread.
+func shrinkToolResults(messages []providers.Message) int {
+	shrunk := 0
+	for i, m := range messages {
+		if m.Role != "tool" {
+			continue
+		}
+		chars := utf8.RuneCountInString(m.Content)
+		if chars <= shrunkResultChars {
+			continue
+		}
+		excerpt := m.Content[:byteOffsetOfRune(m.Content, shrunkResultChars)]
+		if nl := strings.LastIndex(excerpt, "\n"); nl > len(excerpt)/2 {
+			excerpt = excerpt[:nl]
+		}
+		messages[i].Content = fmt.Sprintf("%s\n\n[Result shortened to fit the context window: %d characters in all. Ask for a smaller part of it if you need more.]", excerpt, chars)
+		shrunk++
+	}
+	return shrunk
+}
+
+// contextPart is one piece of a request and its size.
+type contextPart struct {
+	label string
+	chars int
+}
+
+// largestParts names the biggest pieces of messages, largest first: the
+// system prompt, the user's messages, and each tool result by its tool.
+func largestParts(messages []providers.Message, n int) []contextPart {
+	toolNames := make(map[string]string)
+	lastUser := -1
+	for i, m := range messages {
+		if m.Role == "user" {
+			lastUser = i
+		}
+	}
+	var parts []contextPart
+	for i, m := range messages {
+		for _, tc := range m.ToolCalls {
+			if tc.Function != nil {
+				toolNames[tc.ID] = tc.Function.Name
+			}
+		}
+		chars := utf8.RuneCountInString(m.Content)
+		if chars == 0 {
+			continue
+		}
+		var label string
+		switch m.Role {
+		case "system":
+			label = "the system prompt (instructions, memory and skills)"
+			if i > 0 {
+				label = "a system note"
+			}
+		case "user":
+			label = "your message"
+			if i != lastUser {
+				label = "an earlier message of yours"
+			}
+		case "tool":
+			label = "a tool result"
+			if name := toolNames[m.ToolCallID]; name != "" {
+				label = "the " + name + " result"
+			}
+		default:
+			label = "an earlier reply of mine"
+		}
+		parts = append(parts, contextPart{label: label, chars: chars})
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].chars > parts[j].chars })
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+	return parts
+}
+
+// contextOverflowError is returned when a request still did not fit the
+// context window after compacting the history and shortening tool
+// results. It names what took the room, so the user can act on it.
+type contextOverflowError struct {
+	err   error
+	total int
+	parts []contextPart
+}
+
+func (e *contextOverflowError) Error() string {
+	return fmt.Sprintf("request too large for the context window (%d characters): %v", e.total, e.err)
+}
+
+func (e *contextOverflowError) Unwrap() error {
+	return e.err
+}
+
+// reply tells the user what was too large, in place of the provider's
+// error.
+func (e *contextOverflowError) reply() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "This is too much for me to take in at once, even after compacting our conversation and shortening tool results: about %d characters in all.", e.total)
+	if len(e.parts) > 0 {
+		sb.WriteString(" The largest parts:")
+		for _, p := range e.parts {
+			fmt.Fprintf(&sb, "\n- %s: %d characters", p.label, p.chars)
+		}
+	}
+	sb.WriteString("\nTry a shorter message, ask for a smaller part (a page range, a single file, fewer results), or send any attachment in pieces.")
+	return sb.String()
+}
+
+// newContextOverflowError describes messages, the request that overflowed.
+func newContextOverflowError(err error, messages []providers.Message) *contextOverflowError {
+	total := 0
+	for _, m := range messages {
+		total += utf8.RuneCountInString(m.Content)
+	}
+	return &contextOverflowError{err: err, total: total, parts: largestParts(messages, overflowParts)}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestContextOverflow_ShrinksThenExplains verifies an overflowing round is retried with compacted history, then with shortened tool results, and otherwise ends in a reply naming what was too large
+func TestContextOverflow_ShrinksThenExplains(t *testing.T) {
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+		Workspace:         t.TempDir(),
+		Model:             "test-model",
+		MaxTokens:         4096,
+		MaxToolIterations: 5,
+	}}}
+	overflow := errors.New("API error: This model's maximum context length is 8192 tokens (context_length_exceeded)")
+	provider := testkit.NewProvider(
+		testkit.CallTool("listing", nil), testkit.Reply{Err: overflow}, testkit.Reply{Err: overflow}, testkit.Say("500 files"),
+		testkit.CallTool("listing", nil), testkit.Reply{Err: overflow}, testkit.Reply{Err: overflow}, testkit.Reply{Err: overflow})
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.RegisterTool(listingTool{lines: 500})
+	al.RestartTools()
+	ctx := context.Background()
+
+	msg := bus.InboundMessage{Channel: "cli", ChatID: "direct", SenderID: "u", SessionKey: "cli:direct", Content: "list"}
+	if reply, err := al.processMessage(ctx, msg); err != nil || reply != "500 files" {
+		t.Fatalf("reply = %q, err %v", reply, err)
+	}
+	calls := provider.Calls()
+	if full := calls[2].LastMessage(); !strings.Contains(full, "file-0500.txt") {
+		t.Errorf("compaction alone should keep the result whole, got %d chars", len(full))
+	}
+	shrunk := calls[3].LastMessage()
+	if len(shrunk) > 2200 || !strings.HasPrefix(shrunk, "file-0001.txt\n") || !strings.Contains(shrunk, "7000 characters in all") {
+		t.Errorf("model got %d chars:\n%s", len(shrunk), shrunk)
+	}
+	for _, m := range al.sessions.GetHistory("cli:direct") {
+		if m.Role == "tool" && strings.Contains(m.Content, "file-0500.txt") {
+			t.Error("the session still holds the whole result")
+		}
+	}
+
+	_, err := al.processMessage(ctx, msg)
+	var tooLarge *contextOverflowError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected an overflow error, got %v", err)
+	}
+	reply := tooLarge.reply()
+	if !strings.Contains(reply, "the listing result: ") || strings.Contains(reply, "maximum context length") {
+		t.Errorf("unexpected reply:\n%s", reply)
+	}
+
+	if isContextOverflow(errors.New("401: invalid API token")) {
+		t.Error("an auth error is not an overflow")
+	}
+}
@@ -0,0 +1,332 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/governor"
+	"github.com/sipeed/picoclaw/pkg/httprec"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/screening"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+const ownerHelp = `Owner commands:
+/status - uptime, model, channels, tools and queues
+/usage - LLM requests and tokens since start
+/quotas - today's usage per user against their quotas
+/pause - stop answering messages until /resume
+/resume - start answering again
+/restart tools - rebuild all tools from the current config
+/reload config - re-read the config file and apply it
+/features [<name> on|off|reset] - list or toggle experimental features
+/persona [<name>|off] - list personas or set this chat's
+/held - messages and uploads held by the content policy
+/release <id> - let a held item through
+/drop <id> - discard a held item
+/reply, /say, /handback, /handovers - answer chats handed over to a person`
+
+// isOwner reports whether msg comes from one of the configured owners.
+// Owner entries match the sender ID, its numeric part ("123|name"), or
+// either of those prefixed with the channel ("telegram:123").
+func (al *AgentLoop) isOwner(msg bus.InboundMessage) bool {
+	if msg.Channel == "system" || msg.SenderID == "" {
+		return false
+	}
+	idPart := msg.SenderID
+	if idx := strings.Index(idPart, "|"); idx > 0 {
+		idPart = idPart[:idx]
+	}
+
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	for _, owner := range al.owners {
+		switch owner {
+		case msg.SenderID, idPart, msg.Channel + ":" + msg.SenderID, msg.Channel + ":" + idPart:
+			return true
+		}
+	}
+	return false
+}
+
+// handleOwnerCommand runs admin commands sent by an owner. Commands from
+// anyone else are not recognized and go through as normal messages.
+func (al *AgentLoop) handleOwnerCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	content := strings.TrimSpace(msg.Content)
+	if !strings.HasPrefix(content, "/") || !al.isOwner(msg) {
+		return "", false
+	}
+	parts := strings.Fields(content)
+	cmd, args := parts[0], parts[1:]
+
+	reply, handled := "", true
+	switch cmd {
+	case "/admin":
+		reply = ownerHelp
+	case "/status":
+		reply = al.statusReport()
+	case "/usage":
+		reply = al.usage.summary()
+	case "/quotas":
+		reply = al.quotas.report(ctx)
+	case "/pause":
+		al.SetPaused(true)
+		reply = "Paused. Other messages get a short notice until you send /resume."
+	case "/resume":
+		al.SetPaused(false)
+		reply = "Resumed."
+	case "/restart":
+		if len(args) != 1 || args[0] != "tools" {
+			reply = "Usage: /restart tools"
+			break
+		}
+		reply = fmt.Sprintf("Tools restarted: %d loaded.", al.RestartTools())
+	case "/reload":
+		if len(args) != 1 || args[0] != "config" {
+			reply = "Usage: /reload config"
+			break
+		}
+		reply = al.reloadConfigCommand()
+	case "/features":
+		reply = al.featuresCommand(args)
+	case "/persona":
+		reply = al.personaCommand(msg, args)
+	case "/held":
+		reply = al.heldReport()
+	case "/release", "/drop":
+		if len(args) != 1 {
+			reply = fmt.Sprintf("Usage: %s <id>", cmd)
+			break
+		}
+		reply = al.decideHeld(cmd == "/release", args[0])
+	default:
+		handled = false
+	}
+	if handled {
+		logger.InfoCF("agent", "Owner command", map[string]interface{}{
+			"command":   cmd,
+			"channel":   msg.Channel,
+			"sender_id": msg.SenderID,
+		})
+	}
+	return reply, handled
+}
+
+func (al *AgentLoop) statusReport() string {
+	state := "running"
+	if al.Paused() {
+		state = "paused"
+	}
+	channels := "none"
+	if al.channelManager != nil {
+		var parts []string
+		for _, h := range al.channelManager.Health() {
+			switch {
+			case h.State == "ok":
+				parts = append(parts, h.Name)
+			case h.LastError != "":
+				parts = append(parts, fmt.Sprintf("%s (%s: %s)", h.Name, h.State, h.LastError))
+			default:
+				parts = append(parts, fmt.Sprintf("%s (%s)", h.Name, h.State))
+			}
+		}
+		if len(parts) > 0 {
+			channels = strings.Join(parts, ", ")
+		}
+	}
+	running := 0
+	for _, t := range al.Tasks() {
+		if t.Kind == "subagent" && t.Status == "running" {
+			running++
+		}
+	}
+	inbound, outbound := al.bus.QueueDepths()
+	inbound += al.inbound.depth()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Status: %s\n", state)
+	fmt.Fprintf(&sb, "Uptime: %s\n", time.Since(al.started).Round(time.Second))
+	fmt.Fprintf(&sb, "Model: %s\n", al.model)
+	if routes := al.routes(); routes != "" {
+		fmt.Fprintf(&sb, "Routing: %s\n", routes)
+	}
+	fmt.Fprintf(&sb, "Channels: %s\n", channels)
+	fmt.Fprintf(&sb, "Tools: %d\n", al.tools.Count())
+	fmt.Fprintf(&sb, "Subagents running: %d\n", running)
+	fmt.Fprintf(&sb, "Heavy work: %s (%s)\n", governor.Default().Status(), al.resources)
+	fmt.Fprintf(&sb, "Disk: %s\n", al.disk.Status())
+	if network := al.offline.networkStatus(); network != "" {
+		fmt.Fprintf(&sb, "%s\n", network)
+	}
+	if services := al.servicesStatus(); services != "" {
+		fmt.Fprintf(&sb, "%s\n", services)
+	}
+	if local := al.localOnlyStatus(); local != "" {
+		fmt.Fprintf(&sb, "%s\n", local)
+	}
+	fmt.Fprintf(&sb, "Queues: %d in, %d out", inbound, outbound)
+	return sb.String()
+}
+
+// SetConfigReloader sets what /reload config runs: usually re-reading and
+// validating the config file and applying it, returning a summary of the
+// changes. Without one the command is refused.
+func (al *AgentLoop) SetConfigReloader(fn func() (string, error)) {
+	al.cfgMu.Lock()
+	defer al.cfgMu.Unlock()
+	al.reloadConfig = fn
+}
+
+// OnToolsReloaded registers fn to run after tools are rebuilt or one is
+// registered, so wiring done outside the agent (schedulers, job
+// handlers) can be redone for the new tools.
+func (al *AgentLoop) OnToolsReloaded(fn func()) {
+	al.cfgMu.Lock()
+	defer al.cfgMu.Unlock()
+	al.onToolsReload = append(al.onToolsReload, fn)
+}
+
+// toolsChanged runs the OnToolsReloaded hooks when tools were added or
+// replaced, so tools registered while the agent runs are wired like the
+// ones it started with.
+func (al *AgentLoop) toolsChanged(change tools.ToolChange) {
+	if change.Empty() {
+		return
+	}
+	logger.InfoCF("agent", "Tools changed", map[string]interface{}{
+		"added":    strings.Join(change.Added, ", "),
+		"replaced": strings.Join(change.Replaced, ", "),
+		"removed":  strings.Join(change.Removed, ", "),
+	})
+	if len(change.Added) == 0 && len(change.Replaced) == 0 {
+		return
+	}
+	al.cfgMu.RLock()
+	hooks := append(al.onToolsReload[:0:0], al.onToolsReload...)
+	al.cfgMu.RUnlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+func (al *AgentLoop) reloadConfigCommand() string {
+	al.cfgMu.RLock()
+	reload := al.reloadConfig
+	al.cfgMu.RUnlock()
+	if reload == nil {
+		return "Config reload is not available here."
+	}
+	summary, err := reload()
+	if err != nil {
+		return fmt.Sprintf("Config reload failed, keeping the current config: %v", err)
+	}
+	return summary
+}
+
+// featuresCommand lists the feature flags, or turns one on or off until
+// reset to its configured state. Tools are rebuilt so a gated tool comes
+// or goes at once.
+func (al *AgentLoop) featuresCommand(args []string) string {
+	if len(args) == 0 {
+		var sb strings.Builder
+		sb.WriteString("Features:")
+		for _, f := range al.features.All() {
+			fmt.Fprintf(&sb, "\n%s: %s (%s) - %s", f.Name, onOff(f.Enabled), f.Source, f.Description)
+		}
+		return sb.String()
+	}
+	if len(args) != 2 {
+		return "Usage: /features [<name> on|off|reset]"
+	}
+	name := strings.ToLower(args[0])
+	var err error
+	switch strings.ToLower(args[1]) {
+	case "on":
+		err = al.features.Toggle(name, true)
+	case "off":
+		err = al.features.Toggle(name, false)
+	case "reset":
+		err = al.features.Reset(name)
+	default:
+		return "Usage: /features [<name> on|off|reset]"
+	}
+	if err != nil {
+		return fmt.Sprintf("Could not change %s: %v", name, err)
+	}
+	f := al.features.State(name)
+	return fmt.Sprintf("%s is %s (%s). Tools restarted: %d loaded.", name, onOff(f.Enabled), f.Source, al.RestartTools())
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// ApplyConfig switches the agent to cfg: owners, model, iteration limit
+// and queue limits change and tools are rebuilt. It returns the number of tools loaded.
+func (al *AgentLoop) ApplyConfig(cfg *config.Config) int {
+	al.cfgMu.Lock()
+	previous := al.cfg
+	al.cfg = cfg
+	al.owners = cfg.Owners
+	al.cfgMu.Unlock()
+
+	// Keep a model picked with /switch unless the config changed it
+	if previous == nil || previous.Agents.Defaults.Model != cfg.Agents.Defaults.Model {
+		al.model = cfg.Agents.Defaults.Model
+	}
+	al.maxIterations = cfg.Agents.Defaults.MaxToolIterations
+	al.guard.SetPolicy(contentPolicy(cfg))
+	al.undo.SetToken(undoToken(cfg))
+	al.mail.SetToken(mailToken(cfg))
+	al.archive.SetConfig(mediaArchive(cfg))
+	al.quotas.setConfig(cfg.Quotas)
+	al.inbound.setOptions(newQueueOptions(cfg.Queue))
+	al.applyRoles(cfg)
+	transfer.SetOptions(transferOptions(cfg))
+	egress.SetPolicy(egressPolicy(cfg))
+	screening.SetPolicy(screeningPolicy(cfg))
+	governor.Default().SetLimits(resourceLimits(cfg, al.resources))
+	al.disk.SetBudget(diskBudget(cfg))
+	al.hooks.SetEndpoints(webhookEndpoints(cfg))
+	al.automations.SetDir(cfg.AutomationsDir())
+	al.memories.SetRetentionDefaults(cfg.Memory.RetentionDays)
+	al.features.SetConfig(cfg.Features)
+	tools.SetGoogleTokenRefresh(googleTokenRefresh(cfg))
+	tools.SetPhotoUploadQuality(photoUploadQuality(cfg))
+	httprec.SetDir(httpRecordDir(cfg))
+	locale.SetDefault(cfg.Agents.Defaults.Locale)
+	return al.RestartTools()
+}
+
+// RestartTools rebuilds the tool registries from the current config.
+// Tools registered from outside with RegisterTool are carried over; the
+// OnToolsReloaded hooks run once the new set is in. It returns the
+// number of tools loaded.
+func (al *AgentLoop) RestartTools() int {
+	al.cfgMu.RLock()
+	cfg := al.cfg
+	extras := append(al.extraTools[:0:0], al.extraTools...)
+	al.cfgMu.RUnlock()
+
+	main, sub := buildToolRegistries(cfg, al.bus, al.provider, al.subagents, al.profiles, al.store, al.automations, al.features, al.LocalOnly)
+	al.registerAgentTools(main, cfg)
+	for _, tool := range extras {
+		main.Register(tool)
+	}
+	al.subagentTools.ReplaceWith(sub)
+	al.tools.ReplaceWith(main)
+
+	count := al.tools.Count()
+	logger.InfoCF("agent", "Tools rebuilt", map[string]interface{}{"count": count})
+	return count
+}
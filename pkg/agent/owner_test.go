@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func newOwnerTestLoop(t *testing.T) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Owners: config.FlexibleStringSlice{"telegram:42", "U123"},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+}
+
+// TestOwnerCommands_OnlyFromOwners verifies commands are recognized for owners and ignored for everyone else
+func TestOwnerCommands_OnlyFromOwners(t *testing.T) {
+	al := newOwnerTestLoop(t)
+	ctx := context.Background()
+
+	for _, sender := range []bus.InboundMessage{
+		{Channel: "telegram", SenderID: "42|alice", Content: "/status"},
+		{Channel: "slack", SenderID: "U123", Content: "/status"},
+	} {
+		reply, handled := al.handleOwnerCommand(ctx, sender)
+		if !handled || !strings.Contains(reply, "Model: test-model") {
+			t.Errorf("%s/%s: handled=%v reply=%q", sender.Channel, sender.SenderID, handled, reply)
+		}
+	}
+	for _, sender := range []bus.InboundMessage{
+		{Channel: "discord", SenderID: "42", Content: "/pause"},
+		{Channel: "telegram", SenderID: "7", Content: "/pause"},
+		{Channel: "system", SenderID: "U123", Content: "/pause"},
+	} {
+		if _, handled := al.handleOwnerCommand(ctx, sender); handled {
+			t.Errorf("%s/%s: command accepted from a non-owner", sender.Channel, sender.SenderID)
+		}
+	}
+	if al.Paused() {
+		t.Error("non-owner paused the agent")
+	}
+}
+
+// TestOwnerCommands_PauseResumeAndUsage verifies /pause, /resume and /usage
+func TestOwnerCommands_PauseResumeAndUsage(t *testing.T) {
+	al := newOwnerTestLoop(t)
+	owner := bus.InboundMessage{Channel: "telegram", SenderID: "42"}
+	run := func(content string) string {
+		owner.Content = content
+		reply, handled := al.handleOwnerCommand(context.Background(), owner)
+		if !handled {
+			t.Fatalf("%s not handled", content)
+		}
+		return reply
+	}
+
+	run("/pause")
+	if !al.Paused() {
+		t.Error("/pause did not pause")
+	}
+	run("/resume")
+	if al.Paused() {
+		t.Error("/resume did not resume")
+	}
+
+	if reply := run("/usage"); !strings.Contains(reply, "No LLM requests yet") {
+		t.Errorf("unexpected usage before requests: %q", reply)
+	}
+	al.usage.record("test-model", nil, errors.New("boom"))
+	if reply := run("/usage"); !strings.Contains(reply, "test-model: 1 requests (1 failed)") {
+		t.Errorf("unexpected usage: %q", reply)
+	}
+}
+
+// TestOwnerCommands_RestartAndReload verifies tools are rebuilt with externally registered tools kept, and a failed reload keeps the config
+func TestOwnerCommands_RestartAndReload(t *testing.T) {
+	al := newOwnerTestLoop(t)
+	al.RegisterTool(&mockCustomTool{})
+	hooks := 0
+	al.OnToolsReloaded(func() { hooks++ })
+	owner := bus.InboundMessage{Channel: "telegram", SenderID: "42"}
+
+	owner.Content = "/restart tools"
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.HasPrefix(reply, "Tools restarted") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	if _, ok := al.tools.Get("mock_custom"); !ok || hooks != 1 {
+		t.Errorf("custom tool lost or hook not run (hooks=%d)", hooks)
+	}
+
+	owner.Content = "/reload config"
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.Contains(reply, "not available") {
+		t.Errorf("reload without a reloader: %q", reply)
+	}
+	al.SetConfigReloader(func() (string, error) { return "", errors.New("bad json") })
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.Contains(reply, "keeping the current config: bad json") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	next := &config.Config{Agents: al.cfg.Agents, Owners: config.FlexibleStringSlice{"telegram:99"}}
+	next.Agents.Defaults.Model = "new-model"
+	al.SetConfigReloader(func() (string, error) {
+		return fmt.Sprintf("Config reloaded: %d tools loaded.", al.ApplyConfig(next)), nil
+	})
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.HasPrefix(reply, "Config reloaded") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	if al.model != "new-model" || hooks != 2 {
+		t.Errorf("config not applied: model=%s hooks=%d", al.model, hooks)
+	}
+	if _, handled := al.handleOwnerCommand(context.Background(), owner); handled {
+		t.Error("old owner still accepted after reload")
+	}
+}
+
+// TestOwnerCommands_ToggleFeatures verifies /features lists the flags and turning subagents off removes the spawn tools until reset
+func TestOwnerCommands_ToggleFeatures(t *testing.T) {
+	al := newOwnerTestLoop(t)
+	owner := bus.InboundMessage{Channel: "telegram", SenderID: "42", Content: "/features"}
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.Contains(reply, "subagents: on (default)") || !strings.Contains(reply, "browser: off") {
+		t.Errorf("unexpected list %q", reply)
+	}
+
+	owner.Content = "/features subagents off"
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.HasPrefix(reply, "subagents is off (owner)") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	if _, ok := al.tools.Get("spawn"); ok {
+		t.Error("spawn tool still registered")
+	}
+	owner.Content = "/features teleport on"
+	if reply, _ := al.handleOwnerCommand(context.Background(), owner); !strings.Contains(reply, "unknown feature") {
+		t.Errorf("unknown feature accepted: %q", reply)
+	}
+
+	owner.Content = "/features subagents reset"
+	al.handleOwnerCommand(context.Background(), owner)
+	if _, ok := al.tools.Get("spawn"); !ok {
+		t.Error("spawn tool not back after reset")
+	}
+}
+
+// TestOwnerCommands_ReleaseHeldMessage verifies a message held by the content policy is replaced by a notice and sent on /release
+func TestOwnerCommands_ReleaseHeldMessage(t *testing.T) {
+	al := newOwnerTestLoop(t)
+	al.cfg.ContentPolicy = config.ContentPolicyConfig{Enabled: true, CardNumbers: true, Action: "approve"}
+	al.guard.SetPolicy(contentPolicy(al.cfg))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	al.bus.PublishOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "7", Content: "Card: 4111 1111 1111 1111"})
+	notice, _ := al.bus.SubscribeOutbound(ctx)
+	if strings.Contains(notice.Content, "4111") || !strings.Contains(notice.Content, "approval") {
+		t.Fatalf("expected an approval notice, got %q", notice.Content)
+	}
+
+	owner := bus.InboundMessage{Channel: "telegram", SenderID: "42", Content: "/held"}
+	report, _ := al.handleOwnerCommand(ctx, owner)
+	held := al.guard.Held()
+	if len(held) != 1 || !strings.Contains(report, held[0].ID) || strings.Contains(report, "4111 1111") {
+		t.Fatalf("unexpected /held report: %q", report)
+	}
+	owner.Content = "/release " + held[0].ID
+	if reply, _ := al.handleOwnerCommand(ctx, owner); !strings.Contains(reply, "sent to telegram:7") {
+		t.Errorf("unexpected /release reply: %q", reply)
+	}
+	sent, _ := al.bus.SubscribeOutbound(ctx)
+	if sent.Content != "Card: 4111 1111 1111 1111" {
+		t.Errorf("released message = %q", sent.Content)
+	}
+}
+
+// installTool registers mock_custom when called, as a plugin would.
+type installTool struct{ al *AgentLoop }
+
+func (t *installTool) Name() string        { return "install" }
+func (t *installTool) Description() string { return "install a tool" }
+func (t *installTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+func (t *installTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.al.RegisterTool(&mockCustomTool{})
+	return tools.SilentResult("installed")
+}
+
+// promptProvider calls install first, then answers, keeping the system
+// prompt and tools of each call.
+type promptProvider struct {
+	prompts []string
+	offered [][]string
+}
+
+func (p *promptProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.prompts = append(p.prompts, messages[0].Content)
+	var names []string
+	for _, d := range defs {
+		names = append(names, d.Function.Name)
+	}
+	p.offered = append(p.offered, names)
+	if len(p.prompts) == 1 {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{ID: "c1", Name: "install", Arguments: map[string]interface{}{}}}}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *promptProvider) GetDefaultModel() string { return "test-model" }
+
+// TestRegisterTool_AtRuntime verifies a tool registered while the agent
+// runs is wired by the reload hooks and offered and listed from the next
+// model call of the same round, and UnregisterTool keeps it out
+func TestRegisterTool_AtRuntime(t *testing.T) {
+	provider := &promptProvider{}
+	al := NewAgentLoop(&config.Config{
+		Agents: config.AgentsConfig{Defaults: config.AgentDefaults{Workspace: t.TempDir(), Model: "test-model", MaxTokens: 4096, MaxToolIterations: 10}},
+	}, bus.NewMessageBus(), provider)
+	hooks := 0
+	al.OnToolsReloaded(func() { hooks++ })
+	al.RegisterTool(&installTool{al: al})
+
+	reply := testHelper{al: al}.executeAndGetResponse(t, context.Background(), bus.InboundMessage{Channel: "telegram", ChatID: "5", SenderID: "7", Content: "install it", SessionKey: "telegram:5"})
+	if reply != "done" || len(provider.prompts) != 2 {
+		t.Fatalf("reply %q after %d calls", reply, len(provider.prompts))
+	}
+	if strings.Contains(provider.prompts[0], "`mock_custom`") || !strings.Contains(provider.prompts[1], "`mock_custom`") {
+		t.Error("Expected the prompt to list mock_custom from the call after it was registered")
+	}
+	if slices.Contains(provider.offered[0], "mock_custom") || !slices.Contains(provider.offered[1], "mock_custom") {
+		t.Errorf("offered %v", provider.offered)
+	}
+	if hooks != 2 {
+		t.Errorf("hooks ran %d times, want once per registration", hooks)
+	}
+
+	if !al.UnregisterTool("mock_custom") || al.UnregisterTool("mock_custom") {
+		t.Error("Expected mock_custom removed once")
+	}
+	al.RestartTools()
+	if _, ok := al.tools.Get("mock_custom"); ok {
+		t.Error("Expected an unregistered tool to stay out after a rebuild")
+	}
+	if _, ok := al.tools.Get("install"); !ok {
+		t.Error("Expected registered tools kept after a rebuild")
+	}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// verbosityNotes tell the model how long its replies should be, by
+// persona or profile verbosity; "normal" adds nothing.
+var verbosityNotes = map[string]string{
+	"concise":  "Keep replies short: a few sentences at most, no preamble or recap, and more detail only when asked.",
+	"detailed": "Give thorough replies: explain your reasoning and include the relevant details, options and steps.",
+}
+
+// chatPersona returns the persona an owner gave the chat, while the
+// config still has it.
+func (al *AgentLoop) chatPersona(chatKey string) (string, config.PersonaConfig, bool) {
+	if al.state == nil {
+		return "", config.PersonaConfig{}, false
+	}
+	name := al.state.GetChatSettings(chatKey).Persona
+	if name == "" {
+		return "", config.PersonaConfig{}, false
+	}
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	persona, ok := al.cfg.Agents.Personas[name]
+	return name, persona, ok
+}
+
+// personaTools returns the tools the chat's persona limits it to, or nil
+// for every tool.
+func (al *AgentLoop) personaTools(chatKey string) []string {
+	_, persona, ok := al.chatPersona(chatKey)
+	if !ok || len(persona.Tools) == 0 {
+		return nil
+	}
+	return persona.Tools
+}
+
+// personaPrompt is the system prompt section of the chat's persona, ""
+// for none.
+func (al *AgentLoop) personaPrompt(chatKey string) string {
+	_, persona, ok := al.chatPersona(chatKey)
+	if !ok {
+		return ""
+	}
+	var parts []string
+	if prompt := strings.TrimSpace(persona.Prompt); prompt != "" {
+		parts = append(parts, prompt)
+	}
+	if note := verbosityNotes[strings.ToLower(persona.Verbosity)]; note != "" {
+		parts = append(parts, note)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// personaCommand lists the configured personas, or gives the chat msg
+// came from one ("off" for none).
+func (al *AgentLoop) personaCommand(msg bus.InboundMessage, args []string) string {
+	chatKey := msg.Channel + ":" + msg.ChatID
+	al.cfgMu.RLock()
+	personas := al.cfg.Agents.Personas
+	al.cfgMu.RUnlock()
+
+	if len(args) == 0 {
+		if len(personas) == 0 {
+			return "No personas configured (agents.personas)."
+		}
+		names := make([]string, 0, len(personas))
+		for name := range personas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var sb strings.Builder
+		sb.WriteString("Personas:")
+		for _, name := range names {
+			p := personas[name]
+			fmt.Fprintf(&sb, "\n%s - %s", name, p.Description)
+			var details []string
+			if len(p.Tools) > 0 {
+				details = append(details, "tools: "+strings.Join(p.Tools, ", "))
+			}
+			if p.Verbosity != "" {
+				details = append(details, p.Verbosity)
+			}
+			if len(details) > 0 {
+				sb.WriteString(" (" + strings.Join(details, "; ") + ")")
+			}
+		}
+		current := "none"
+		if name, _, ok := al.chatPersona(chatKey); ok {
+			current = name
+		}
+		fmt.Fprintf(&sb, "\nThis chat: %s", current)
+		return sb.String()
+	}
+	if len(args) != 1 {
+		return "Usage: /persona [<name>|off]"
+	}
+
+	name := strings.ToLower(args[0])
+	if name == "off" {
+		name = ""
+	} else if _, ok := personas[name]; !ok {
+		return fmt.Sprintf("No persona %q; /persona lists them.", args[0])
+	}
+	if err := al.state.UpdateChatSettings(chatKey, func(s *state.ChatSettings) { s.Persona = name }); err != nil {
+		return fmt.Sprintf("Could not change the persona: %v", err)
+	}
+	if name == "" {
+		return "This chat is back to the default assistant."
+	}
+	return fmt.Sprintf("This chat now uses the %s persona.", name)
+}
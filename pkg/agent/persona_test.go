@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// TestPersonaCommand_AppliesToOneChat verifies /persona gives one chat the preset's prompt, verbosity and tools, leaves other chats alone and is undone by /persona off
+func TestPersonaCommand_AppliesToOneChat(t *testing.T) {
+	al := newOwnerTestLoop(t)
+	al.cfg.Agents.Personas = map[string]config.PersonaConfig{
+		"dev": {Description: "dev bot", Prompt: "You help the team with code reviews.", Tools: config.FlexibleStringSlice{"read_file"}, Verbosity: "concise"},
+	}
+	owner := bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "42"}
+	run := func(content string) string {
+		owner.Content = content
+		reply, handled := al.handleOwnerCommand(context.Background(), owner)
+		if !handled {
+			t.Fatalf("%s not handled", content)
+		}
+		return reply
+	}
+
+	if reply := run("/persona nope"); !strings.HasPrefix(reply, `No persona "nope"`) {
+		t.Errorf("unknown persona: %q", reply)
+	}
+	if reply := run("/persona dev"); reply != "This chat now uses the dev persona." {
+		t.Fatalf("set: %q", reply)
+	}
+	if reply := run("/persona"); !strings.Contains(reply, "dev - dev bot (tools: read_file; concise)") || !strings.HasSuffix(reply, "This chat: dev") {
+		t.Errorf("list: %q", reply)
+	}
+
+	system := al.contextBuilder.BuildMessages(nil, "", "hi", nil, "telegram", "-100", "42")[0].Content
+	if !strings.Contains(system, "## Persona\n") || !strings.Contains(system, "code reviews") || !strings.Contains(system, "Keep replies short") {
+		t.Errorf("Expected the persona in the system prompt, got %q", system)
+	}
+	if other := al.contextBuilder.BuildMessages(nil, "", "hi", nil, "telegram", "7", "42")[0].Content; strings.Contains(other, "## Persona") {
+		t.Error("Expected other chats to keep the default prompt")
+	}
+	defs := al.tools.ToProviderDefsForChat("telegram", "-100", "42")
+	if len(defs) != 1 || defs[0].Function.Name != "read_file" {
+		t.Errorf("Expected only read_file offered, got %d tools", len(defs))
+	}
+	if len(al.tools.ToProviderDefsForChat("telegram", "7", "42")) < 2 {
+		t.Error("Expected other chats to keep every tool")
+	}
+	if r := al.tools.ExecuteWithContext(context.Background(), "list_dir", map[string]interface{}{"path": "."}, "telegram", "-100", nil); !r.IsError {
+		t.Errorf("Expected tools outside the persona refused, got %+v", r)
+	}
+
+	run("/persona off")
+	if len(al.tools.ToProviderDefsForChat("telegram", "-100", "42")) < 2 {
+		t.Error("Expected /persona off to restore every tool")
+	}
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/features"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// minPlanSteps is how many changes asked for at once make a plan
+	minPlanSteps = 3
+	// maxPlanStepResult bounds the result of each step quoted to the model
+	maxPlanStepResult = 1500
+)
+
+// planPreviewNote asks the model for the calls of a multi-step change in
+// one response, so they can be previewed together.
+const planPreviewNote = "When a request takes several changes, call the tools for all of them in one response: three or more changes are shown to the user as a numbered plan to approve before any of them runs."
+
+// planSteps returns the calls of one model response as a plan to show the
+// user first, or nil when plan preview is off or fewer than minPlanSteps
+// of the calls change something.
+func (al *AgentLoop) planSteps(opts processOptions, calls []providers.ToolCall) []tools.PlanStep {
+	if opts.ChatID == "" || constants.IsInternalChannel(opts.Channel) || !al.features.Enabled(features.PlanPreview) {
+		return nil
+	}
+	steps := make([]tools.PlanStep, 0, len(calls))
+	changes := 0
+	for _, tc := range calls {
+		steps = append(steps, tools.PlanStep{Tool: tc.Name, Args: tc.Arguments})
+		if tool, ok := al.tools.Get(tc.Name); ok {
+			if mutating, ok := tool.(tools.MutatingTool); ok && mutating.Mutates(tc.Arguments) {
+				changes++
+			}
+		}
+	}
+	if changes < minPlanSteps {
+		return nil
+	}
+	return steps
+}
+
+// runPlan runs the steps of the plan a user answered and returns their
+// message with how each step went, for the model to report from. steps
+// is nil when the user did not approve. Each step's outcome is posted to
+// the chat as it finishes; the plan ends early when a step fails or the
+// user says stop.
+func (al *AgentLoop) runPlan(ctx context.Context, msg bus.InboundMessage, steps []tools.PlanStep) string {
+	if steps == nil {
+		return msg.Content + "\n\n[The user did not approve the plan, so none of it was run. Ask what they would like instead.]"
+	}
+	chat := msg.Channel + ":" + msg.ChatID
+	defer al.plans.Finish(chat)
+	logger.InfoCF("agent", "Running an approved plan", map[string]interface{}{"chat": chat, "steps": len(steps)})
+
+	al.updateToolContexts(msg.Channel, msg.ChatID)
+	ctx = tools.WithSender(ctx, msg.SenderID)
+	var report strings.Builder
+	fmt.Fprintf(&report, "%s\n\n[The user approved the plan. How its steps went:", msg.Content)
+	skipped := ""
+	for i, step := range steps {
+		switch {
+		case skipped != "":
+		case al.plans.Stopped(chat) || ctx.Err() != nil:
+			skipped = "not run, the user stopped the plan"
+		}
+		if skipped != "" {
+			fmt.Fprintf(&report, "\n%d. %s: %s", i+1, step.Describe(), skipped)
+			continue
+		}
+
+		// Approving the plan is the yes for each of its changes
+		release := al.confirmations.Grant(chat, step.Tool, step.Args)
+		result := al.tools.ExecuteWithContext(ctx, step.Tool, step.Args, msg.Channel, msg.ChatID, nil)
+		release()
+		content := result.ForLLM
+		if content == "" && result.Err != nil {
+			content = result.Err.Error()
+		}
+		status, outcome := "✅", "done"
+		if result.IsError {
+			status, outcome = "❌", "failed"
+			skipped = "not run, an earlier step failed"
+		}
+		out := bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: fmt.Sprintf("%s %d/%d %s", status, i+1, len(steps), step.Describe()),
+		}
+		if !result.Silent {
+			if result.ForUser != "" {
+				out.Content += "\n" + result.ForUser
+			}
+			out.Media = result.Media
+		}
+		al.bus.PublishOutbound(out)
+		fmt.Fprintf(&report, "\n%d. %s: %s:\n%s", i+1, step.Describe(), outcome, utils.Truncate(content, maxPlanStepResult))
+	}
+	report.WriteString("\nTell the user briefly how it went, without running any of the steps again.]")
+	return report.String()
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/features"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// noteTool records the notes it is asked to add, and fails for "bad"
+type noteTool struct{ added []string }
+
+func (n *noteTool) Name() string        { return "note" }
+func (n *noteTool) Description() string { return "Add a note" }
+func (n *noteTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+func (n *noteTool) Mutates(args map[string]interface{}) bool { return true }
+func (n *noteTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	text, _ := args["text"].(string)
+	if text == "bad" {
+		return tools.ErrorResult("cannot add that note")
+	}
+	n.added = append(n.added, text)
+	return tools.SilentResult("added " + text)
+}
+
+func addNotes(texts ...string) testkit.Reply {
+	var calls []providers.ToolCall
+	for _, text := range texts {
+		calls = append(calls, providers.ToolCall{Type: "function", Name: "note", Arguments: map[string]interface{}{"action": "add", "text": text}})
+	}
+	return testkit.Reply{ToolCalls: calls}
+}
+
+// TestPlanPreview_HoldsRunsAndDrops verifies three changes at once are shown as a plan, run step by step on a yes until one fails, and dropped on anything else
+func TestPlanPreview_HoldsRunsAndDrops(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := testkit.NewProvider(
+		addNotes("milk", "bad", "eggs"),
+		testkit.Say("The second note failed, so I stopped there."),
+		addNotes("a", "b", "c"),
+		testkit.Say("Okay, nothing was changed."),
+	)
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	notes := &noteTool{}
+	al.RegisterTool(notes)
+	if err := al.features.Toggle(features.PlanPreview, true); err != nil {
+		t.Fatalf("Toggle() error: %v", err)
+	}
+	helper := testHelper{al: al}
+	msg := func(content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "42", Content: content, SessionKey: "telegram:42"}
+	}
+
+	reply := helper.executeAndGetResponse(t, context.Background(), msg("note down milk, bad and eggs"))
+	if !strings.Contains(reply, "1. note add (text: milk)\n2. note add (text: bad)\n3. note add (text: eggs)") || !strings.Contains(reply, "Reply yes") {
+		t.Fatalf("Expected the numbered plan, got %q", reply)
+	}
+	if len(notes.added) != 0 {
+		t.Fatalf("Expected nothing run before approval, got %v", notes.added)
+	}
+	al.bus.DrainOutbound()
+
+	reply = helper.executeAndGetResponse(t, context.Background(), msg("yes"))
+	if reply != "The second note failed, so I stopped there." {
+		t.Errorf("Unexpected reply: %q", reply)
+	}
+	if len(notes.added) != 1 || notes.added[0] != "milk" {
+		t.Errorf("Expected the plan to stop at the failed step, got %v", notes.added)
+	}
+	var statuses []string
+	for _, out := range al.bus.DrainOutbound() {
+		statuses = append(statuses, out.Content)
+	}
+	if len(statuses) != 2 || !strings.HasPrefix(statuses[0], "✅ 1/3 note add") || !strings.HasPrefix(statuses[1], "❌ 2/3 note add") {
+		t.Errorf("Expected a status per step run, got %q", statuses)
+	}
+	calls := provider.Calls()
+	report := calls[len(calls)-1].Messages[len(calls[len(calls)-1].Messages)-1].Content
+	if !strings.Contains(report, "approved the plan") || !strings.Contains(report, "3. note add (text: eggs): not run, an earlier step failed") {
+		t.Errorf("Expected the model told how each step went, got:\n%s", report)
+	}
+
+	helper.executeAndGetResponse(t, context.Background(), msg("note a, b and c"))
+	reply = helper.executeAndGetResponse(t, context.Background(), msg("no, wait"))
+	if reply != "Okay, nothing was changed." || len(notes.added) != 1 {
+		t.Errorf("Expected the plan dropped, got %q and %v", reply, notes.added)
+	}
+	calls = provider.Calls()
+	if last := calls[len(calls)-1].LastMessage(); !strings.Contains(last, "did not approve the plan") {
+		t.Errorf("Expected the model told the plan was dropped, got %q", last)
+	}
+}
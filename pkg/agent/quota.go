@@ -0,0 +1,351 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// quotaScope is the state store memory scope daily usage is kept under,
+// one entry per day, so counts survive restarts.
+const quotaScope = "quotas"
+
+// quotaUsage is what one user used on one day.
+type quotaUsage struct {
+	Messages  int            `json:"messages"`
+	ToolCalls int            `json:"tool_calls"`
+	Tokens    int            `json:"tokens"`
+	Tools     map[string]int `json:"tools,omitempty"`
+}
+
+// quotaTracker counts each user's messages, tool calls and tokens for the
+// current day and refuses what goes over the configured limits.
+type quotaTracker struct {
+	db *store.DB
+
+	mu     sync.Mutex
+	cfg    config.QuotasConfig
+	day    string
+	loaded bool
+	used   map[string]*quotaUsage
+	dirty  bool
+	now    func() time.Time
+	// resolve maps an account to its person, so linked accounts share
+	// one allowance
+	resolve func(account string) string
+	// role returns the quotas of the sender's role, if it has any
+	role func(channel, senderID string) (config.QuotaLimits, bool)
+}
+
+func newQuotaTracker(db *store.DB, cfg config.QuotasConfig) *quotaTracker {
+	return &quotaTracker{db: db, cfg: cfg, used: map[string]*quotaUsage{}, now: time.Now}
+}
+
+func (q *quotaTracker) setConfig(cfg config.QuotasConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cfg = cfg
+}
+
+// quotaApplies reports whether the sender's use is limited: owners and
+// local channels are not.
+func (al *AgentLoop) quotaApplies(channel, senderID string) bool {
+	return al.roleOf(channel, senderID) != tools.RoleOwner
+}
+
+// admitToolCall counts a tool call against the sender's quotas, or
+// returns the refusal to give the model instead of running it.
+func (al *AgentLoop) admitToolCall(ctx context.Context, opts processOptions, tool string) (string, bool) {
+	if !opts.Limited {
+		return "", true
+	}
+	return al.quotas.admitTool(ctx, opts.Channel, opts.SenderID, tool)
+}
+
+// quotaUser is the key usage is counted under: the channel and the sender
+// ID without any "|name" suffix.
+func quotaUser(channel, senderID string) string {
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		senderID = senderID[:idx]
+	}
+	return channel + ":" + senderID
+}
+
+// user is the key the sender's usage is counted under.
+func (q *quotaTracker) user(channel, senderID string) string {
+	user := quotaUser(channel, senderID)
+	if q.resolve != nil {
+		user = q.resolve(user)
+	}
+	return user
+}
+
+// limits returns the limits for a sender: their own entry in Users if
+// there is one, the default otherwise. ok is false when quotas are off.
+func (q *quotaTracker) limits(channel, senderID string) (config.QuotaLimits, bool) {
+	if !q.cfg.Enabled || senderID == "" {
+		return config.QuotaLimits{}, false
+	}
+	idPart := senderID
+	if idx := strings.Index(idPart, "|"); idx > 0 {
+		idPart = idPart[:idx]
+	}
+	for _, key := range []string{channel + ":" + senderID, channel + ":" + idPart, senderID, idPart} {
+		if l, ok := q.cfg.Users[key]; ok {
+			return l, true
+		}
+	}
+	if q.role != nil {
+		if l, ok := q.role(channel, senderID); ok {
+			return l, true
+		}
+	}
+	return q.cfg.Default, true
+}
+
+// usage returns user's counts for today, rolling over at midnight and
+// loading today's saved counts first. Callers hold q.mu.
+func (q *quotaTracker) usage(ctx context.Context, user string) *quotaUsage {
+	day := q.now().Format("2006-01-02")
+	if day != q.day {
+		q.day, q.loaded, q.dirty = day, false, false
+		q.used = map[string]*quotaUsage{}
+	}
+	if !q.loaded && q.db != nil {
+		q.loaded = true
+		if raw, ok, err := q.db.Memory.Get(ctx, quotaScope, day); err != nil {
+			logger.DebugCF("agent", "Quota counts not loaded", map[string]interface{}{"error": err.Error()})
+		} else if ok {
+			json.Unmarshal([]byte(raw), &q.used)
+		}
+	}
+	u, ok := q.used[user]
+	if !ok {
+		u = &quotaUsage{}
+		q.used[user] = u
+	}
+	return u
+}
+
+// untilReset says how long until the counts reset at midnight.
+func (q *quotaTracker) untilReset() string {
+	now := q.now()
+	y, m, d := now.AddDate(0, 0, 1).Date()
+	left := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Sub(now).Round(time.Minute)
+	return fmt.Sprintf("at midnight, in %s", strings.TrimSuffix(left.String(), "0s"))
+}
+
+// admitMessage counts a message from the sender, or returns the notice to
+// send back instead when today's message allowance is used up.
+func (q *quotaTracker) admitMessage(ctx context.Context, channel, senderID string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits, ok := q.limits(channel, senderID)
+	if !ok {
+		return "", true
+	}
+	u := q.usage(ctx, q.user(channel, senderID))
+	if limits.Messages > 0 && u.Messages >= limits.Messages {
+		return fmt.Sprintf("You've reached today's limit of %d messages. It resets %s.", limits.Messages, q.untilReset()), false
+	}
+	if limits.Tokens > 0 && u.Tokens >= limits.Tokens {
+		return fmt.Sprintf("You've used today's allowance of %d tokens. It resets %s.", limits.Tokens, q.untilReset()), false
+	}
+	u.Messages++
+	q.dirty = true
+	return "", true
+}
+
+// admitTool counts a tool call, or returns why it is refused, for the
+// model to pass on.
+func (q *quotaTracker) admitTool(ctx context.Context, channel, senderID, tool string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits, ok := q.limits(channel, senderID)
+	if !ok {
+		return "", true
+	}
+	u := q.usage(ctx, q.user(channel, senderID))
+	if limits.ToolCalls > 0 && u.ToolCalls >= limits.ToolCalls {
+		return fmt.Sprintf("Daily quota reached: this user may make %d tool calls a day; the allowance resets %s. Tell the user, and answer without tools if you can.",
+			limits.ToolCalls, q.untilReset()), false
+	}
+	if limit, ok := limits.Tools[tool]; ok && u.Tools[tool] >= limit {
+		return fmt.Sprintf("Daily quota reached: this user may use %s %d times a day; the allowance resets %s. Tell the user, and do not retry it today.",
+			tool, limit, q.untilReset()), false
+	}
+	u.ToolCalls++
+	if u.Tools == nil {
+		u.Tools = map[string]int{}
+	}
+	u.Tools[tool]++
+	q.dirty = true
+	return "", true
+}
+
+// tokensLeft reports whether the sender may make another LLM request.
+func (q *quotaTracker) tokensLeft(ctx context.Context, channel, senderID string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits, ok := q.limits(channel, senderID)
+	if !ok || limits.Tokens <= 0 {
+		return "", true
+	}
+	if u := q.usage(ctx, q.user(channel, senderID)); u.Tokens >= limits.Tokens {
+		return fmt.Sprintf("I had to stop here: you've used today's allowance of %d tokens. It resets %s.", limits.Tokens, q.untilReset()), false
+	}
+	return "", true
+}
+
+// addTokens counts tokens an LLM request used for the sender.
+func (q *quotaTracker) addTokens(ctx context.Context, channel, senderID string, tokens int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.limits(channel, senderID); !ok || tokens <= 0 {
+		return
+	}
+	q.usage(ctx, q.user(channel, senderID)).Tokens += tokens
+	q.dirty = true
+}
+
+// save stores today's counts if they changed.
+func (q *quotaTracker) save(ctx context.Context) {
+	q.mu.Lock()
+	if !q.dirty || q.db == nil {
+		q.mu.Unlock()
+		return
+	}
+	data, _ := json.Marshal(q.used)
+	day := q.day
+	q.dirty = false
+	q.mu.Unlock()
+	if err := q.db.Memory.Set(ctx, quotaScope, day, string(data)); err != nil {
+		logger.WarnCF("agent", "Failed to save quota counts", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// report lists today's usage per user against their limits, for /quotas.
+func (q *quotaTracker) report(ctx context.Context) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.cfg.Enabled {
+		return "Quotas are off."
+	}
+	q.usage(ctx, "")
+	delete(q.used, "")
+	if len(q.used) == 0 {
+		return "No usage counted today."
+	}
+	users := make([]string, 0, len(q.used))
+	for user := range q.used {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Usage on %s (resets %s):", q.day, q.untilReset())
+	for _, user := range users {
+		u := q.used[user]
+		channel, sender, _ := strings.Cut(user, ":")
+		limits, _ := q.limits(channel, sender)
+		fmt.Fprintf(&sb, "\n- %s: %s messages, %s tool calls, %s tokens", user,
+			ofLimit(u.Messages, limits.Messages), ofLimit(u.ToolCalls, limits.ToolCalls), ofLimit(u.Tokens, limits.Tokens))
+	}
+	return sb.String()
+}
+
+func ofLimit(used, limit int) string {
+	if limit <= 0 {
+		return fmt.Sprint(used)
+	}
+	return fmt.Sprintf("%d/%d", used, limit)
+}
+
+// chatUsers are the keys the user of a direct chat is counted under: the
+// account, and the person it is linked to.
+func (q *quotaTracker) chatUsers(chatKey string) []string {
+	users := []string{chatKey}
+	if q.resolve != nil {
+		if person := q.resolve(chatKey); person != chatKey {
+			users = append(users, person)
+		}
+	}
+	return users
+}
+
+// ChatData implements tools.ChatDataStore: the user's counts, by day.
+func (q *quotaTracker) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	if q.db == nil {
+		return nil, nil
+	}
+	q.save(ctx)
+	entries, err := q.db.Memory.List(ctx, quotaScope)
+	if err != nil {
+		return nil, err
+	}
+	days := map[string]map[string]*quotaUsage{}
+	for _, e := range entries {
+		var used map[string]*quotaUsage
+		if json.Unmarshal([]byte(e.Value), &used) != nil {
+			continue
+		}
+		for _, user := range q.chatUsers(chatKey) {
+			if u, ok := used[user]; ok {
+				if days[e.Key] == nil {
+					days[e.Key] = map[string]*quotaUsage{}
+				}
+				days[e.Key][user] = u
+			}
+		}
+	}
+	if len(days) == 0 {
+		return nil, nil
+	}
+	return days, nil
+}
+
+// PurgeChat implements tools.ChatDataStore, dropping the user's counts
+// from every day kept, today's included.
+func (q *quotaTracker) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	if q.db == nil {
+		return 0, nil
+	}
+	users := q.chatUsers(chatKey)
+	q.mu.Lock()
+	for _, user := range users {
+		delete(q.used, user)
+	}
+	q.mu.Unlock()
+	entries, err := q.db.Memory.List(ctx, quotaScope)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		var used map[string]*quotaUsage
+		if json.Unmarshal([]byte(e.Value), &used) != nil {
+			continue
+		}
+		before := len(used)
+		for _, user := range users {
+			delete(used, user)
+		}
+		if len(used) == before {
+			continue
+		}
+		n += before - len(used)
+		data, _ := json.Marshal(used)
+		if err := q.db.Memory.Set(ctx, quotaScope, e.Key, string(data)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
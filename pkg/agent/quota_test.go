@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+func newQuotaTestLoop(t *testing.T, quotas config.QuotasConfig, replies ...testkit.Reply) (*AgentLoop, *testkit.Provider) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+			Workspace:         t.TempDir(),
+			Model:             "test-model",
+			MaxTokens:         4096,
+			MaxToolIterations: 5,
+		}},
+		Owners: config.FlexibleStringSlice{"telegram:42"},
+		Quotas: quotas,
+	}
+	provider := testkit.NewProvider(replies...)
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider), provider
+}
+
+// TestQuotas_MessageLimitSparesOwners verifies a user over the daily message limit gets a notice without an LLM call, and owners are unlimited
+func TestQuotas_MessageLimitSparesOwners(t *testing.T) {
+	al, provider := newQuotaTestLoop(t, config.QuotasConfig{Enabled: true, Default: config.QuotaLimits{Messages: 1}},
+		testkit.Say("first"), testkit.Say("owner 1"), testkit.Say("owner 2"))
+	ctx := context.Background()
+	user := bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7|bob", SessionKey: "telegram:7", Content: "hi"}
+
+	if reply, _ := al.processMessage(ctx, user); reply != "first" {
+		t.Fatalf("first reply = %q", reply)
+	}
+	reply, _ := al.processMessage(ctx, user)
+	if !strings.Contains(reply, "today's limit of 1 messages") || !strings.Contains(reply, "resets at midnight") {
+		t.Errorf("over-quota reply = %q", reply)
+	}
+	owner := bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "42", SessionKey: "telegram:42", Content: "hi"}
+	for _, want := range []string{"owner 1", "owner 2"} {
+		if reply, _ := al.processMessage(ctx, owner); reply != want {
+			t.Errorf("owner reply = %q, want %q", reply, want)
+		}
+	}
+	if n := len(provider.Calls()); n != 3 {
+		t.Errorf("provider called %d times, want 3", n)
+	}
+	if report := al.quotas.report(ctx); !strings.Contains(report, "telegram:7: 1/1 messages") || strings.Contains(report, "telegram:42") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+// TestQuotas_ToolLimitRefusesCall verifies a tool over its per-user limit is refused with a message the model can relay
+func TestQuotas_ToolLimitRefusesCall(t *testing.T) {
+	calc := map[string]interface{}{"expression": "1+1"}
+	al, provider := newQuotaTestLoop(t,
+		config.QuotasConfig{Enabled: true, Users: map[string]config.QuotaLimits{"telegram:7": {Tools: map[string]int{"calculate": 1}}}},
+		testkit.CallTool("calculate", calc), testkit.CallTool("calculate", calc), testkit.Say("done"))
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7", SessionKey: "telegram:7", Content: "add"}
+	if reply, err := al.processMessage(context.Background(), msg); err != nil || reply != "done" {
+		t.Fatalf("reply = %q, err %v", reply, err)
+	}
+	calls := provider.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("provider called %d times", len(calls))
+	}
+	if first := calls[1].LastMessage(); strings.Contains(first, "quota") {
+		t.Errorf("first call refused: %s", first)
+	}
+	if second := calls[2].LastMessage(); !strings.Contains(second, "may use calculate 1 times a day") {
+		t.Errorf("second call not refused: %s", second)
+	}
+}
+
+// TestQuotaTracker_ResetsAtMidnight verifies counts start over on a new day
+func TestQuotaTracker_ResetsAtMidnight(t *testing.T) {
+	q := newQuotaTracker(nil, config.QuotasConfig{Enabled: true, Default: config.QuotaLimits{Messages: 1}})
+	now := time.Date(2026, 3, 6, 23, 50, 0, 0, time.Local)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, ok := q.admitMessage(ctx, "telegram", "7"); !ok {
+		t.Fatal("first message refused")
+	}
+	if notice, ok := q.admitMessage(ctx, "telegram", "7"); ok || !strings.Contains(notice, "in 10m") {
+		t.Fatalf("second message: ok=%v notice=%q", ok, notice)
+	}
+	now = now.Add(15 * time.Minute)
+	if _, ok := q.admitMessage(ctx, "telegram", "7"); !ok {
+		t.Error("counts did not reset at midnight")
+	}
+}
+
+// TestQuotas_RoleTiers verifies trusted users and guests get their role's quotas and users listed as owners get none
+func TestQuotas_RoleTiers(t *testing.T) {
+	al, _ := newQuotaTestLoop(t, config.QuotasConfig{Enabled: true, Default: config.QuotaLimits{Messages: 1}},
+		testkit.Say("1"), testkit.Say("2"), testkit.Say("3"), testkit.Say("4"), testkit.Say("5"))
+	al.ApplyConfig(&config.Config{
+		Agents: al.cfg.Agents,
+		Owners: al.cfg.Owners,
+		Quotas: al.cfg.Quotas,
+		Roles: config.RolesConfig{
+			Enabled: true,
+			Users:   map[string]string{"telegram:8": "trusted", "telegram:9": "owner"},
+			Trusted: config.RoleConfig{Quotas: &config.QuotaLimits{Messages: 3}},
+		},
+	})
+	ctx := context.Background()
+
+	sent := func(senderID string, n int) int {
+		msg := bus.InboundMessage{Channel: "telegram", ChatID: senderID, SenderID: senderID, SessionKey: "telegram:" + senderID, Content: "hi"}
+		answered := 0
+		for i := 0; i < n; i++ {
+			if reply, _ := al.processMessage(ctx, msg); !strings.Contains(reply, "limit") {
+				answered++
+			}
+		}
+		return answered
+	}
+	if n := sent("7", 2); n != 1 {
+		t.Errorf("guest got %d answers, want the default 1", n)
+	}
+	if n := sent("8", 4); n != 3 {
+		t.Errorf("trusted user got %d answers, want 3", n)
+	}
+	if got := al.roleOf("telegram", "9|carol"); got != "owner" {
+		t.Errorf("role of a listed owner = %q", got)
+	}
+	if al.quotaApplies("telegram", "9") {
+		t.Error("quotas apply to a user with the owner role")
+	}
+}
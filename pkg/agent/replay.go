@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/httprec"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/replay"
+)
+
+// roundsDir is where rounds are recorded, or "" when debug.record_rounds
+// is off.
+func (al *AgentLoop) roundsDir() string {
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	if !al.cfg.Debug.RecordRounds {
+		return ""
+	}
+	return filepath.Join(al.cfg.WorkspacePath(), "debug", "rounds")
+}
+
+// recordRound starts recording a round when debug.record_rounds is on, or
+// notes the reply of the round Replay is recording. The returned func
+// must be called with the round's outcome.
+func (al *AgentLoop) recordRound(ctx context.Context, opts processOptions) (context.Context, func(string, error)) {
+	if rec := replay.FromContext(ctx); rec != nil {
+		return ctx, rec.Finish
+	}
+	dir := al.roundsDir()
+	if dir == "" {
+		return ctx, func(string, error) {}
+	}
+	ctx, rec := replay.Start(ctx, dir, opts.Channel, opts.ChatID, opts.SenderID, opts.UserMessage)
+	return ctx, func(reply string, err error) {
+		rec.Finish(reply, err)
+		if path, err := rec.Save(); err != nil {
+			logger.WarnCF("agent", "Failed to save the round recording", map[string]interface{}{"error": err.Error()})
+		} else if path != "" {
+			logger.DebugCF("agent", "Round recorded", map[string]interface{}{"file": path})
+		}
+	}
+}
+
+// Replay runs a recorded round again and returns what happened this time,
+// for replay.Compare. al must have been made with replay.NewProvider for
+// the round, so the model answers as it did; the tools' requests are
+// answered from the recording, and requests it lacks fail. While it runs
+// http.DefaultTransport is swapped, so al must not be serving messages.
+func (al *AgentLoop) Replay(ctx context.Context, round *replay.Round) *replay.Round {
+	recorded := httprec.Call{Exchanges: round.Exchanges()}
+	previous := http.DefaultTransport
+	http.DefaultTransport = &httprec.Transport{Base: recorded.Replay()}
+	defer func() { http.DefaultTransport = previous }()
+
+	ctx, rec := replay.Start(ctx, "", round.Channel, round.ChatID, round.SenderID, round.Message)
+	al.runAgentLoop(ctx, processOptions{
+		SessionKey:      "replay:" + round.Channel + ":" + round.ChatID,
+		Channel:         round.Channel,
+		ChatID:          round.ChatID,
+		SenderID:        round.SenderID,
+		UserMessage:     round.Message,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		NoHistory:       true,
+	})
+	return rec.Round()
+}
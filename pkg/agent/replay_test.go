@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/replay"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// fetchTool fetches a fixed URL and returns the body, transformed.
+type fetchTool struct {
+	url       string
+	transform func(string) string
+}
+
+func (t *fetchTool) Name() string        { return "fetch_weather" }
+func (t *fetchTool) Description() string { return "Fetch the weather" }
+func (t *fetchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+func (t *fetchTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	req, _ := http.NewRequestWithContext(ctx, "GET", t.url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return tools.ErrorResult(err.Error())
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return tools.NewToolResult(t.transform(string(body)))
+}
+
+func newReplayTestConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+			Workspace:         t.TempDir(),
+			Model:             "test-model",
+			MaxTokens:         4096,
+			MaxToolIterations: 5,
+		}},
+	}
+}
+
+// TestReplay_RecordedRoundRunsOffline verifies a recorded round replays with the server gone, and a changed tool shows up as a difference
+func TestReplay_RecordedRoundRunsOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "sunny")
+	}))
+	cfg := newReplayTestConfig(t)
+	cfg.Debug.RecordRounds = true
+	provider := testkit.NewProvider(testkit.CallTool("fetch_weather", nil), testkit.Say("It's sunny."))
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.RegisterTool(&fetchTool{url: server.URL, transform: strings.TrimSpace})
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7", SessionKey: "telegram:7", Content: "weather?"}
+	if reply, err := al.processMessage(context.Background(), msg); err != nil || reply != "It's sunny." {
+		t.Fatalf("live reply %q, %v", reply, err)
+	}
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(cfg.WorkspacePath(), "debug", "rounds", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("recorded %d rounds, want 1", len(files))
+	}
+	round, err := replay.Load(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.Responses) != 2 || len(round.Calls) != 1 || len(round.Calls[0].Exchanges) != 1 || round.Calls[0].Result != "sunny" {
+		t.Fatalf("unexpected recording: %+v", round)
+	}
+
+	rerun := func(transform func(string) string) []string {
+		al := NewAgentLoop(newReplayTestConfig(t), bus.NewMessageBus(), replay.NewProvider(round))
+		al.RegisterTool(&fetchTool{url: server.URL, transform: transform})
+		return replay.Compare(round, al.Replay(context.Background(), round))
+	}
+	if diffs := rerun(strings.TrimSpace); len(diffs) != 0 {
+		t.Errorf("replay differs: %v", diffs)
+	}
+	diffs := rerun(strings.ToUpper)
+	if len(diffs) != 1 || !strings.Contains(diffs[0], "result differs") || !strings.Contains(diffs[0], "SUNNY") {
+		t.Errorf("regression not reported: %v", diffs)
+	}
+}
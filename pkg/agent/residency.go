@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/embeddings"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// errNoLocalModel is returned for local-only chats when no local model is
+// configured, instead of sending them to the cloud model.
+var errNoLocalModel = errors.New("this chat is local-only and no local model is configured (local_only.model or offline.model with providers.vllm.api_base)")
+
+// residencyProvider routes the model calls made for local-only chats to
+// the local model, whatever model they ask for, so no path can send what
+// is said in them to a cloud provider. The chat is the one recorded by
+// tools.WithChat; calls made for no chat go to the wrapped provider.
+type residencyProvider struct {
+	providers.LLMProvider
+	local      providers.LLMProvider // nil without a local model
+	localModel string
+	// localOnly is set once the loop is built
+	localOnly func(channel, chatID string) bool
+}
+
+// newResidencyProvider wraps provider with the local model cfg sets for
+// local-only chats: local_only.model, or offline.model, served by vllm.
+func newResidencyProvider(cfg *config.Config, provider providers.LLMProvider) *residencyProvider {
+	p := &residencyProvider{LLMProvider: provider}
+	model := cfg.LocalOnly.Model
+	if model == "" {
+		model = cfg.Offline.Model
+	}
+	if model != "" && cfg.Providers.VLLM.APIBase != "" {
+		p.local = providers.NewHTTPProvider(cfg.Providers.VLLM.APIKey, cfg.Providers.VLLM.APIBase, "")
+		p.localModel = model
+	}
+	return p
+}
+
+func (p *residencyProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	if !p.isLocalOnly(tools.ChatFromContext(ctx)) {
+		return p.LLMProvider.Chat(ctx, messages, defs, model, options)
+	}
+	if p.local == nil {
+		return nil, errNoLocalModel
+	}
+	return p.local.Chat(ctx, messages, defs, p.localModel, options)
+}
+
+// isLocalOnly reports whether the chat is local-only, once the loop is
+// built.
+func (p *residencyProvider) isLocalOnly(channel, chatID string) bool {
+	return chatID != "" && p.localOnly != nil && p.localOnly(channel, chatID)
+}
+
+// errLocalOnlyEmbeddings is returned by online embedders for local-only
+// chats; ask_file then ranks with the offline embedder and search matches
+// words only.
+var errLocalOnlyEmbeddings = errors.New("this chat is local-only; its text is not sent to online embedding services")
+
+// residencyEmbedder refuses to embed the text of local-only chats, which
+// would otherwise go to an online embeddings API.
+type residencyEmbedder struct {
+	embeddings.Embedder
+	localOnly func(channel, chatID string) bool
+}
+
+// keepLocal wraps e, made for provider, so that it refuses local-only
+// chats, unless it runs on this machine or network (local, ollama).
+func keepLocal(provider string, e embeddings.Embedder, localOnly func(channel, chatID string) bool) embeddings.Embedder {
+	switch strings.ToLower(provider) {
+	case "local", "ollama":
+		return e
+	}
+	if localOnly == nil {
+		return e
+	}
+	return &residencyEmbedder{Embedder: e, localOnly: localOnly}
+}
+
+func (e *residencyEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if channel, chatID := tools.ChatFromContext(ctx); chatID != "" && e.localOnly(channel, chatID) {
+		return nil, errLocalOnlyEmbeddings
+	}
+	return e.Embedder.Embed(ctx, texts)
+}
+
+// LocalOnly reports whether the chat is local-only, by local_only.chats
+// or /local.
+func (al *AgentLoop) LocalOnly(channel, chatID string) bool {
+	key := channel + ":" + chatID
+	return al.localOnlyByConfig(key) || al.state.GetChatSettings(key).LocalOnly
+}
+
+func (al *AgentLoop) localOnlyByConfig(key string) bool {
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	return slices.Contains(al.cfg.LocalOnly.Chats, key)
+}
+
+// localCommand runs /local [on|off]. Anyone in the chat may turn it on;
+// when owners are configured only they may turn it off again, and chats
+// listed in local_only.chats stay local-only.
+func (al *AgentLoop) localCommand(msg bus.InboundMessage, args []string) string {
+	key := msg.Channel + ":" + msg.ChatID
+	if len(args) < 1 {
+		status := "off"
+		if al.LocalOnly(msg.Channel, msg.ChatID) {
+			status = "on"
+		}
+		return fmt.Sprintf("Local-only mode is %s. Usage: /local [on|off]", status)
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		if al.residency.local == nil {
+			return "There is no local model to answer with (local_only.model or offline.model, served by providers.vllm), so this chat can't be kept local."
+		}
+		if err := al.state.UpdateChatSettings(key, func(s *state.ChatSettings) { s.LocalOnly = true }); err != nil {
+			return fmt.Sprintf("Failed to save setting: %v", err)
+		}
+		return fmt.Sprintf("Local-only mode on: this chat is answered by %s on this device, nothing said here is sent to cloud models, and changes to online services are refused.", al.residency.localModel)
+	case "off":
+		if al.localOnlyByConfig(key) {
+			return "This chat is local-only in the config (local_only.chats); an owner must remove it there."
+		}
+		al.cfgMu.RLock()
+		owners := len(al.owners)
+		al.cfgMu.RUnlock()
+		if owners > 0 && !al.isOwner(msg) {
+			return "Only an owner can turn local-only mode off."
+		}
+		if err := al.state.UpdateChatSettings(key, func(s *state.ChatSettings) { s.LocalOnly = false }); err != nil {
+			return fmt.Sprintf("Failed to save setting: %v", err)
+		}
+		return "Local-only mode off."
+	}
+	return "Usage: /local [on|off]"
+}
+
+// localOnlyStatus is the /status line for local-only chats, empty when
+// there are none.
+func (al *AgentLoop) localOnlyStatus() string {
+	chats := 0
+	for key, settings := range al.state.AllChatSettings() {
+		if settings.LocalOnly && !al.localOnlyByConfig(key) {
+			chats++
+		}
+	}
+	al.cfgMu.RLock()
+	chats += len(al.cfg.LocalOnly.Chats)
+	al.cfgMu.RUnlock()
+	if chats == 0 {
+		return ""
+	}
+	model := al.residency.localModel
+	if model == "" {
+		model = "no local model"
+	}
+	return fmt.Sprintf("Local-only chats: %d (%s)", chats, model)
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// namedProvider answers with its name and keeps the models it was asked for.
+type namedProvider struct {
+	name   string
+	models []string
+}
+
+func (p *namedProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return &providers.LLMResponse{Content: p.name}, nil
+}
+
+func (p *namedProvider) GetDefaultModel() string { return p.name }
+
+// TestLocalOnly_RoutesChatToLocalModel verifies /local on sends a chat's
+// model calls to the local model only, other chats keep the cloud model,
+// and only an owner can turn it off again
+func TestLocalOnly_RoutesChatToLocalModel(t *testing.T) {
+	cloud, local := &namedProvider{name: "cloud"}, &namedProvider{name: "local"}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "cloud-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Owners: config.FlexibleStringSlice{"telegram:42"},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), cloud)
+	msg := func(chatID, sender, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", ChatID: chatID, SenderID: sender, Content: content, SessionKey: "telegram:" + chatID}
+	}
+	h := testHelper{al: al}
+	ctx := context.Background()
+
+	if reply := h.executeAndGetResponse(t, ctx, msg("5", "7", "/local on")); !strings.Contains(reply, "no local model") {
+		t.Errorf("Expected /local on refused without a local model, got %q", reply)
+	}
+	al.residency.local, al.residency.localModel = local, "llama3.2:3b"
+	if reply := h.executeAndGetResponse(t, ctx, msg("5", "7", "/local on")); !strings.HasPrefix(reply, "Local-only mode on") {
+		t.Fatalf("/local on: %q", reply)
+	}
+
+	if reply := h.executeAndGetResponse(t, ctx, msg("5", "7", "my test results")); reply != "local" {
+		t.Errorf("Expected the local model to answer the local-only chat, got %q", reply)
+	}
+	if len(cloud.models) != 0 || len(local.models) != 1 || local.models[0] != "llama3.2:3b" {
+		t.Errorf("cloud asked for %v, local for %v", cloud.models, local.models)
+	}
+	if reply := h.executeAndGetResponse(t, ctx, msg("6", "7", "hello")); reply != "cloud" {
+		t.Errorf("Expected other chats to keep the cloud model, got %q", reply)
+	}
+
+	if reply := h.executeAndGetResponse(t, ctx, msg("5", "7", "/local off")); !strings.Contains(reply, "Only an owner") || !al.LocalOnly("telegram", "5") {
+		t.Errorf("Expected /local off refused for a non-owner, got %q", reply)
+	}
+	if reply := h.executeAndGetResponse(t, ctx, msg("5", "42", "/local off")); reply != "Local-only mode off." || al.LocalOnly("telegram", "5") {
+		t.Errorf("/local off by the owner: %q", reply)
+	}
+}
+
+// TestLocalOnly_EmbeddingsStayLocal verifies the text of a local-only
+// chat never reaches an online embeddings API: search ranks it with the
+// local fallback, while other chats still use the configured provider
+func TestLocalOnly_EmbeddingsStayLocal(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]},{"index":1,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Agents:     config.AgentsConfig{Defaults: config.AgentDefaults{Workspace: t.TempDir()}},
+		Embeddings: config.EmbeddingsConfig{Provider: "openai", Fallback: "local"},
+	}
+	cfg.Providers.OpenAI.APIBase = server.URL
+	localOnly := func(channel, chatID string) bool { return channel == "telegram" && chatID == "1" }
+	index := embeddingsIndex(cfg, "notes", localOnly)
+
+	private := tools.WithChat(context.Background(), "telegram", "1")
+	if _, err := index.Rank(private, "salary", []string{"my salary is 100"}); err != nil {
+		t.Fatalf("local-only chat: %v", err)
+	}
+	primary, _ := embedders(cfg, localOnly)
+	if _, err := primary.Embed(private, []string{"salary"}); err == nil {
+		t.Error("online embedder accepted a local-only chat")
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("local-only chat reached the online embedder %d times", n)
+	}
+
+	other := tools.WithChat(context.Background(), "telegram", "2")
+	if _, err := index.Rank(other, "salary", []string{"my salary is 100"}); err != nil {
+		t.Fatalf("other chat: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("other chat made %d calls to the online embedder, want 1", calls.Load())
+	}
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// roleOf returns the role of a sender: owner for the configured owners
+// and local channels, the role roles.users gives any of the person's
+// linked accounts, or the default role. With roles off everyone else is
+// trusted.
+func (al *AgentLoop) roleOf(channel, senderID string) string {
+	if constants.IsInternalChannel(channel) || al.isOwner(bus.InboundMessage{Channel: channel, SenderID: senderID}) {
+		return tools.RoleOwner
+	}
+	al.cfgMu.RLock()
+	roles := al.cfg.Roles
+	al.cfgMu.RUnlock()
+	if !roles.Enabled {
+		return tools.RoleTrusted
+	}
+	for _, account := range al.identities.Accounts(quotaUser(channel, senderID)) {
+		if role, ok := roles.Users[account]; ok {
+			return strings.ToLower(role)
+		}
+	}
+	if roles.Default != "" {
+		return strings.ToLower(roles.Default)
+	}
+	return tools.RoleGuest
+}
+
+// roleQuotas returns the quotas of the sender's role, when it has any.
+func (al *AgentLoop) roleQuotas(channel, senderID string) (config.QuotaLimits, bool) {
+	role := al.roleOf(channel, senderID)
+	al.cfgMu.RLock()
+	defer al.cfgMu.RUnlock()
+	if !al.cfg.Roles.Enabled {
+		return config.QuotaLimits{}, false
+	}
+	var limits *config.QuotaLimits
+	switch role {
+	case tools.RoleTrusted:
+		limits = al.cfg.Roles.Trusted.Quotas
+	case tools.RoleGuest:
+		limits = al.cfg.Roles.Guest.Quotas
+	}
+	if limits == nil {
+		return config.QuotaLimits{}, false
+	}
+	return *limits, true
+}
+
+// applyRoles has the tool registries enforce the roles in cfg.
+func (al *AgentLoop) applyRoles(cfg *config.Config) {
+	var roles *tools.Roles
+	if cfg.Roles.Enabled {
+		roles = &tools.Roles{
+			Of: al.roleOf,
+			Policies: map[string]tools.RolePolicy{
+				tools.RoleTrusted: {Tools: cfg.Roles.Trusted.Tools, Confirm: cfg.Roles.Trusted.Confirm},
+				tools.RoleGuest:   {Tools: cfg.Roles.Guest.Tools, Confirm: cfg.Roles.Guest.Confirm},
+			},
+		}
+	}
+	al.tools.SetRoles(roles, al.confirmations)
+	al.subagentTools.SetRoles(roles, al.confirmations)
+}
+
+// IsOwner reports whether senderID is an owner on channel. Internal
+// channels, such as scheduled jobs, act for the owner.
+func (al *AgentLoop) IsOwner(channel, senderID string) bool {
+	return al.roleOf(channel, senderID) == tools.RoleOwner
+}
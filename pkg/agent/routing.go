@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Kinds of work agents.routing picks a model for.
+const (
+	routeTools     = "tools"
+	routeFinal     = "final"
+	routeSummarize = "summarize"
+	routeVision    = "vision"
+)
+
+// routedModel returns the first non-empty model, or the agent model.
+func routedModel(cfg *config.Config, models ...string) string {
+	for _, m := range models {
+		if m != "" {
+			return m
+		}
+	}
+	return cfg.Agents.Defaults.Model
+}
+
+// modelFor returns the model for a kind of work: the one agents.routing
+// sets for it, or the agent model (which /switch model may have changed).
+func (al *AgentLoop) modelFor(route string) string {
+	al.cfgMu.RLock()
+	r := al.cfg.Agents.Routing
+	al.cfgMu.RUnlock()
+	var m string
+	switch route {
+	case routeTools:
+		m = r.Tools
+	case routeFinal:
+		m = r.Final
+	case routeSummarize:
+		m = r.Summarize
+	case routeVision:
+		m = r.Vision
+	}
+	if m == "" {
+		return al.model
+	}
+	return m
+}
+
+// routes lists the models agents.routing sets, for /status.
+func (al *AgentLoop) routes() string {
+	al.cfgMu.RLock()
+	r := al.cfg.Agents.Routing
+	al.cfgMu.RUnlock()
+	var parts []string
+	for _, route := range [][2]string{{routeTools, r.Tools}, {routeFinal, r.Final}, {routeSummarize, r.Summarize}, {routeVision, r.Vision}} {
+		if route[1] != "" {
+			parts = append(parts, route[0]+"="+route[1])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hasImage reports whether any of a message's attachments is an image.
+func hasImage(media []string) bool {
+	for _, path := range media {
+		if strings.HasPrefix(mime.TypeByExtension(strings.ToLower(filepath.Ext(path))), "image/") {
+			return true
+		}
+	}
+	return false
+}
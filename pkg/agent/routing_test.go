@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestModelRouting_ByTask verifies tool steps run on the tools model, the reply on the final model and image turns on the vision model
+func TestModelRouting_ByTask(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "default-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+			Routing: config.ModelRouting{Tools: "cheap", Final: "strong", Vision: "eyes"},
+		},
+	}
+	provider := testkit.NewProvider(
+		testkit.CallTool("calculator", map[string]interface{}{"expression": "2+2"}),
+		testkit.Say("draft"),
+		testkit.Say("2+2 is 4"),
+		testkit.Say("a cat"),
+	)
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	ctx := context.Background()
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "7", SenderID: "7", SessionKey: "telegram:7", Content: "what is 2+2?"}
+	if reply, _ := al.processMessage(ctx, msg); reply != "2+2 is 4" {
+		t.Errorf("reply = %q", reply)
+	}
+	msg.Content, msg.Media = "what is this?", []string{"/tmp/photo.JPG"}
+	if reply, _ := al.processMessage(ctx, msg); reply != "a cat" {
+		t.Errorf("image reply = %q", reply)
+	}
+
+	want := []string{"cheap", "cheap", "strong", "eyes"}
+	calls := provider.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("%d calls, want %d", len(calls), len(want))
+	}
+	for i, call := range calls {
+		if call.Model != want[i] {
+			t.Errorf("call %d used %q, want %q", i, call.Model, want[i])
+		}
+	}
+}
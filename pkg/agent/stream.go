@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	// toolStreamEvery bounds how often a streaming tool's chunks edit the
+	// chat's progress message
+	toolStreamEvery = 2 * time.Second
+	// toolStreamLines is how many of the latest chunks the message shows
+	toolStreamLines = 12
+)
+
+// toolStream shows the chunks a streaming tool emits in the chat's
+// progress message, which the reply replaces when it is ready.
+func (al *AgentLoop) toolStream(channel, chatID string) tools.ChunkFunc {
+	var mu sync.Mutex
+	var lines []string
+	var last time.Time
+	return func(chunk string) {
+		mu.Lock()
+		lines = append(lines, chunk)
+		if len(lines) > toolStreamLines {
+			lines = lines[len(lines)-toolStreamLines:]
+		}
+		if time.Since(last) < toolStreamEvery {
+			mu.Unlock()
+			return
+		}
+		last = time.Now()
+		content := strings.Join(lines, "\n")
+		mu.Unlock()
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  channel,
+			ChatID:   chatID,
+			Content:  content,
+			Progress: true,
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/replay"
+)
+
+// StructuredReply is the outcome of a message for programs rather than
+// people: the final answer, every tool call made on the way and the files
+// they produced.
+type StructuredReply struct {
+	Answer    string           `json:"answer"`
+	ToolCalls []StructuredCall `json:"tool_calls"`
+	Artifacts []string         `json:"artifacts"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// StructuredCall is a tool call of a StructuredReply and its result.
+type StructuredCall struct {
+	Tool    string                 `json:"tool"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Result  string                 `json:"result"`
+	IsError bool                   `json:"is_error,omitempty"`
+	Media   []string               `json:"media,omitempty"`
+}
+
+// ProcessDirectStructured handles content like ProcessDirect and returns
+// what happened as a StructuredReply, for headless callers that parse the
+// outcome instead of reading it.
+func (al *AgentLoop) ProcessDirectStructured(ctx context.Context, content, sessionKey string) *StructuredReply {
+	ctx, rec := replay.Start(ctx, "", "cli", "direct", "cron", content)
+	answer, err := al.ProcessDirect(ctx, content, sessionKey)
+
+	reply := &StructuredReply{Answer: answer, ToolCalls: []StructuredCall{}, Artifacts: []string{}}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	for _, call := range rec.Round().Calls {
+		reply.ToolCalls = append(reply.ToolCalls, StructuredCall{
+			Tool:    call.Tool,
+			Args:    call.Args,
+			Result:  call.Result,
+			IsError: call.IsError,
+			Media:   call.Media,
+		})
+		reply.Artifacts = append(reply.Artifacts, call.Media...)
+	}
+	return reply
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// chartTool draws a chart to a fixed file.
+type chartTool struct{ path string }
+
+func (t *chartTool) Name() string        { return "chart" }
+func (t *chartTool) Description() string { return "Draw a chart" }
+func (t *chartTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+func (t *chartTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	result := tools.NewToolResult("Chart drawn")
+	result.Media = []string{t.path}
+	return result
+}
+
+// TestProcessDirectStructured_ReportsCallsAndArtifacts verifies a structured reply carries the answer, each tool call with its arguments and result, and the files the calls produced
+func TestProcessDirectStructured_ReportsCallsAndArtifacts(t *testing.T) {
+	cfg := newReplayTestConfig(t)
+	provider := testkit.NewProvider(
+		testkit.CallTool("chart", map[string]interface{}{"metric": "sales"}),
+		testkit.Say("Here is the sales chart."),
+	)
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	chart := filepath.Join(t.TempDir(), "sales.png")
+	al.RegisterTool(&chartTool{path: chart})
+
+	reply := al.ProcessDirectStructured(context.Background(), "chart the sales", "cli:json")
+	if reply.Error != "" || reply.Answer != "Here is the sales chart." {
+		t.Fatalf("Expected the answer, got %+v", reply)
+	}
+	if len(reply.ToolCalls) != 1 || reply.ToolCalls[0].Tool != "chart" || reply.ToolCalls[0].Args["metric"] != "sales" || reply.ToolCalls[0].Result != "Chart drawn" {
+		t.Fatalf("Expected the chart call, got %+v", reply.ToolCalls)
+	}
+	if len(reply.Artifacts) != 1 || reply.Artifacts[0] != chart {
+		t.Errorf("Expected the chart as an artifact, got %v", reply.Artifacts)
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	for _, key := range []string{"answer", "tool_calls", "artifacts"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("Expected %q in %s", key, data)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+const (
+	// transferProgressEvery bounds how often a chat's progress message is
+	// edited; channels rate-limit edits too
+	transferProgressEvery = 5 * time.Second
+	// transferProgressMin is the smallest transfer worth reporting
+	transferProgressMin = 8 << 20
+)
+
+// transferOptions converts tools.transfers from the config.
+func transferOptions(cfg *config.Config) transfer.Options {
+	t := cfg.Tools.Transfers
+	o := transfer.Options{
+		ChunkSize:         int64(t.ChunkMB) << 20,
+		MaxBytesPerSecond: int64(t.MaxKBps) << 10,
+		Retries:           t.Retries,
+	}
+	for _, w := range t.Windows {
+		// Validation rejected times that don't parse
+		from, _ := time.Parse("15:04", w.From)
+		to, _ := time.Parse("15:04", w.To)
+		o.Windows = append(o.Windows, transfer.Window{
+			Start:             time.Duration(from.Hour())*time.Hour + time.Duration(from.Minute())*time.Minute,
+			End:               time.Duration(to.Hour())*time.Hour + time.Duration(to.Minute())*time.Minute,
+			MaxBytesPerSecond: int64(w.MaxKBps) << 10,
+		})
+	}
+	return o
+}
+
+// transferProgress reports large uploads and downloads made for a chat in
+// a progress message the channel keeps editing.
+func (al *AgentLoop) transferProgress(channel, chatID string) transfer.ProgressFunc {
+	return transfer.Throttle(func(p transfer.Progress) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  channel,
+			ChatID:   chatID,
+			Content:  transfer.FormatProgress(p),
+			Progress: true,
+		})
+	}, transferProgressEvery, transferProgressMin)
+}
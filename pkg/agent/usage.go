@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// usageTracker counts LLM requests and tokens per model since start, for
+// the /usage owner command.
+type usageTracker struct {
+	mu      sync.Mutex
+	since   time.Time
+	byModel map[string]*modelUsage
+}
+
+type modelUsage struct {
+	requests         int
+	errors           int
+	promptTokens     int
+	completionTokens int
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{since: time.Now(), byModel: make(map[string]*modelUsage)}
+}
+
+func (u *usageTracker) record(model string, usage *providers.UsageInfo, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	m, ok := u.byModel[model]
+	if !ok {
+		m = &modelUsage{}
+		u.byModel[model] = m
+	}
+	m.requests++
+	if err != nil {
+		m.errors++
+	}
+	if usage != nil {
+		m.promptTokens += usage.PromptTokens
+		m.completionTokens += usage.CompletionTokens
+	}
+}
+
+func (u *usageTracker) summary() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Usage since %s:\n", u.since.Format("2006-01-02 15:04"))
+	if len(u.byModel) == 0 {
+		sb.WriteString("No LLM requests yet.")
+		return sb.String()
+	}
+	models := make([]string, 0, len(u.byModel))
+	for model := range u.byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		m := u.byModel[model]
+		fmt.Fprintf(&sb, "- %s: %d requests (%d failed), %d prompt + %d completion tokens\n",
+			model, m.requests, m.errors, m.promptTokens, m.completionTokens)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
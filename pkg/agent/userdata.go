@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// exportAuditLimit caps the audit entries put in one export.
+const exportAuditLimit = 100000
+
+const exportReadme = `This archive holds what picoclaw stores about you.
+
+accounts.json      the chat accounts the export covers (linked accounts included)
+profile.json       your profile: name, time zone, quiet hours
+settings.json      per-chat settings such as voice replies, persona and handovers
+conversation.json  the conversation history and its running summary
+memories.json      what the agent was asked to remember, by chat
+entities.json      people, files and events mentioned in your chats, as linked
+audit.json         the changes made on your behalf (calendar, mail, files...)
+artifacts.json     metadata of the files you sent or that were made for you
+`
+
+const exportReadmeEnd = `
+The files themselves are not included; they expire on their own.
+`
+
+// chatDataStore is a store kept per chat that an export writes to file
+// and a deletion empties.
+type chatDataStore struct {
+	file  string
+	about string
+	store tools.ChatDataStore
+}
+
+// chatDataStores lists every store kept per chat besides the
+// conversation, profile, settings, memories, entities and files, which
+// ExportUserData and DeleteUserData handle themselves. A store added
+// anywhere else must be added here too. Tools that are off are left out.
+func (al *AgentLoop) chatDataStores() []chatDataStore {
+	stores := []chatDataStore{
+		{"records.json", "undo journal, outgoing mail and messages, contact groups", dbChatData{al.store}},
+		{"quotas.json", "your daily usage counts", al.quotas},
+		{"critical.json", "critical reminders waiting for an answer", al.critical},
+		{"digest.json", "notifications held for a digest or focus time", al.digest},
+		{"polls.json", "polls posted to your chats", al.polls},
+		{"deferred.json", "changes waiting for the connection or a service", al.deferred},
+	}
+	for _, t := range []struct{ file, about, tool string }{
+		{"schedules.json", "reminders and schedules", "cron"},
+		{"automations.json", "automations turned on", "automations"},
+		{"habits.json", "habits and health logs", "habits"},
+		{"lists.json", "lists", "lists"},
+		{"templates.json", "message templates you saved", "templates"},
+		{"waiting_on.json", "emails you are waiting on replies to", "waiting_on"},
+		{"mail_routes.json", "mail routing rules and held mail", "mail_routes"},
+		{"meeting_notes.json", "meeting notes", "meeting_notes"},
+		{"attachments.json", "files received and where you file them", "attachments"},
+		{"podcasts.json", "podcast subscriptions", "podcasts"},
+		{"transit.json", "transit alerts", "transit"},
+	} {
+		if tool, ok := al.tools.Get(t.tool); ok {
+			if store, ok := tool.(tools.ChatDataStore); ok {
+				stores = append(stores, chatDataStore{t.file, t.about, store})
+			}
+		}
+	}
+	return stores
+}
+
+// dbChatData is the state database's rows about a chat.
+type dbChatData struct {
+	db *store.DB
+}
+
+func (d dbChatData) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	channel, chatID, ok := strings.Cut(chatKey, ":")
+	if !ok {
+		return nil, nil
+	}
+	rows, err := d.db.ChatData(ctx, channel, chatID)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (d dbChatData) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	channel, chatID, ok := strings.Cut(chatKey, ":")
+	if !ok {
+		return 0, nil
+	}
+	return d.db.PurgeChat(ctx, channel, chatID)
+}
+
+// ExportUserData builds a zip of everything kept about the person behind
+// channel:chatID, across their linked accounts, and stores it as an
+// artifact of that chat.
+func (al *AgentLoop) ExportUserData(ctx context.Context, channel, chatID string) (*artifacts.Artifact, error) {
+	chatKey := channel + ":" + chatID
+	accounts := al.identities.Accounts(chatKey)
+	person := al.identities.Resolve(chatKey)
+
+	settings := map[string]state.ChatSettings{}
+	memories := map[string]interface{}{}
+	entities := map[string]interface{}{}
+	var entries []store.AuditEntry
+	var files []artifacts.Artifact
+	for _, account := range accounts {
+		if s := al.state.GetChatSettings(account); s != (state.ChatSettings{}) {
+			settings[account] = s
+		}
+		if list := al.memories.ForChat(account); len(list) > 0 {
+			memories[account] = list
+		}
+		if list := al.entities.Recent(account, ""); len(list) > 0 {
+			entities[account] = list
+		}
+		if ch, id, ok := strings.Cut(account, ":"); ok {
+			found, err := al.store.Audit.Query(ctx, store.AuditFilter{Channel: ch, ChatID: id, Limit: exportAuditLimit})
+			if err != nil {
+				// The rest of the export is still worth having
+				logger.WarnCF("agent", "Could not read the audit log for an export", map[string]interface{}{
+					"chat":  account,
+					"error": err.Error(),
+				})
+			}
+			entries = append(entries, found...)
+		}
+		for _, a := range al.artifacts.List() {
+			if a.Origin == account {
+				files = append(files, a)
+			}
+		}
+	}
+	if entries == nil {
+		entries = []store.AuditEntry{}
+	}
+	readme := exportReadme
+	stores := al.chatDataStores()
+	kept := make([]map[string]interface{}, len(stores))
+	for i, s := range stores {
+		readme += fmt.Sprintf("%-19s%s\n", s.file, s.about)
+		kept[i] = map[string]interface{}{}
+		for _, account := range accounts {
+			data, err := s.store.ChatData(ctx, account)
+			if err != nil {
+				logger.WarnCF("agent", "Could not read a store for an export", map[string]interface{}{
+					"chat":  account,
+					"file":  s.file,
+					"error": err.Error(),
+				})
+			}
+			if data != nil {
+				kept[i][account] = data
+			}
+		}
+	}
+	readme += exportReadmeEnd
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, v interface{}) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if s, ok := v.(string); ok {
+			_, err = w.Write([]byte(s))
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	parts := []struct {
+		name string
+		v    interface{}
+	}{
+		{"README.txt", readme},
+		{"accounts.json", accounts},
+		{"profile.json", al.profiles.Get(person)},
+		{"settings.json", settings},
+		{"conversation.json", map[string]interface{}{
+			"summary":  al.sessions.GetSummary(person),
+			"messages": al.sessions.GetHistory(person),
+		}},
+		{"memories.json", memories},
+		{"entities.json", entities},
+		{"audit.json", entries},
+		{"artifacts.json", files},
+	}
+	for i, s := range stores {
+		parts = append(parts, struct {
+			name string
+			v    interface{}
+		}{s.file, kept[i]})
+	}
+	for _, p := range parts {
+		if err := add(p.name, p.v); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", p.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("picoclaw-data-%s-%s.zip", strings.ReplaceAll(chatKey, ":", "-"), time.Now().Format("20060102"))
+	artifact, err := al.artifacts.Put(&buf, name, "application/zip", chatKey, artifacts.DefaultTTL)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoCF("agent", "Exported user data", map[string]interface{}{
+		"chat":     chatKey,
+		"accounts": len(accounts),
+		"artifact": artifact.ID,
+	})
+	return artifact, nil
+}
+
+// DeleteUserData erases the conversation, profile, settings, memories,
+// linked entities, files and every store in chatDataStores kept about the
+// person behind channel:chatID and unlinks their accounts. The audit log is append-only and keeps its
+// entries. It returns a report of what was removed.
+func (al *AgentLoop) DeleteUserData(ctx context.Context, channel, chatID string) (string, error) {
+	chatKey := channel + ":" + chatID
+	accounts := al.identities.Accounts(chatKey)
+	person := al.identities.Resolve(chatKey)
+
+	var errs []string
+	fail := func(what string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", what, err))
+		}
+	}
+	messages := len(al.sessions.GetHistory(person))
+	fail("conversation", al.sessions.Delete(person))
+	fail("profile", al.profiles.Set(person, profile.Profile{}))
+
+	memories, files, records, audited := 0, 0, 0, 0
+	stores := al.chatDataStores()
+	var purged []string
+	seen := map[string]bool{}
+	for _, account := range accounts {
+		for _, s := range stores {
+			n, err := s.store.PurgeChat(ctx, account)
+			if n > 0 && !seen[s.about] {
+				seen[s.about] = true
+				purged = append(purged, s.about)
+			}
+			records += n
+			fail(strings.TrimSuffix(s.file, ".json"), err)
+		}
+		fail("settings", al.state.UpdateChatSettings(account, func(s *state.ChatSettings) { *s = state.ChatSettings{} }))
+		removed, err := al.memories.Purge(account)
+		memories += len(removed)
+		fail("memories", err)
+		_, err = al.entities.Purge(account)
+		fail("entities", err)
+		for _, a := range al.artifacts.List() {
+			if a.Origin == account {
+				if err := al.artifacts.Remove(a.ID); err == nil {
+					files++
+				} else {
+					fail("files", err)
+				}
+			}
+		}
+		if ch, id, ok := strings.Cut(account, ":"); ok {
+			if found, err := al.store.Audit.Query(ctx, store.AuditFilter{Channel: ch, ChatID: id, Limit: exportAuditLimit}); err == nil {
+				audited += len(found)
+			}
+		}
+	}
+	// Cached embeddings may hold the text of the memories and notes
+	tools.DropEmbeddingsCaches(al.workspace)
+	if len(accounts) > 1 {
+		for _, account := range accounts[1:] {
+			// The last unlink also drops the primary's link
+			al.identities.Unlink(account)
+		}
+	}
+
+	logger.InfoCF("agent", "Deleted user data", map[string]interface{}{
+		"chat":     chatKey,
+		"accounts": len(accounts),
+		"messages": messages,
+		"memories": memories,
+		"files":    files,
+		"records":  records,
+	})
+	report := fmt.Sprintf("Deleted %d messages, the conversation summary, the profile and chat settings, %d memories and %d files", messages, memories, files)
+	if records > 0 {
+		report += fmt.Sprintf(", and %d other records (%s)", records, strings.Join(purged, "; "))
+	}
+	if len(accounts) > 1 {
+		report += fmt.Sprintf(", and unlinked %d accounts", len(accounts))
+	}
+	report += "."
+	if audited > 0 {
+		report += fmt.Sprintf(" The audit log is append-only, so its %d entries for this chat are kept.", audited)
+	}
+	if len(errs) > 0 {
+		return report, fmt.Errorf("some data could not be deleted: %s", strings.Join(errs, "; "))
+	}
+	return report, nil
+}
@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TestUserData_ExportAndDelete verifies my_data exports a chat's conversation, profile, memories, audit entries and file metadata as a zip, and delete erases all but the append-only audit log
+func TestUserData_ExportAndDelete(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+		Workspace:         t.TempDir(),
+		Model:             "test-model",
+		MaxTokens:         4096,
+		MaxToolIterations: 5,
+	}}}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	ctx := context.Background()
+	al.sessions.AddMessage("telegram:42", "user", "book the dentist")
+	al.sessions.Save("telegram:42")
+	al.sessions.AddMessage("telegram:7", "user", "someone else")
+	al.profiles.Set("telegram:42", profile.Profile{Timezone: "Europe/Lisbon"})
+	al.memories.Remember("telegram:42", "health", "Sees Dr. Costa")
+	al.artifacts.Put(strings.NewReader("scan"), "scan.pdf", "application/pdf", "telegram:42", 0)
+	al.artifacts.Put(strings.NewReader("other"), "other.pdf", "application/pdf", "telegram:7", 0)
+	if err := al.store.Audit.Append(ctx, store.AuditEntry{Channel: "telegram", ChatID: "42", Sender: "42", Tool: "calendar", Action: "create"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tool, ok := al.tools.Get("my_data")
+	if !ok {
+		t.Fatal("my_data tool not registered")
+	}
+	chat := tools.WithChat(ctx, "telegram", "42")
+	res := tool.Execute(chat, map[string]interface{}{"action": "export"})
+	if res.IsError || len(res.Media) != 1 {
+		t.Fatalf("export: %+v", res)
+	}
+	zr, err := zip.OpenReader(res.Media[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for name, want := range map[string]string{
+		"profile.json":      "Europe/Lisbon",
+		"conversation.json": "book the dentist",
+		"memories.json":     "Sees Dr. Costa",
+		"audit.json":        "calendar",
+		"artifacts.json":    "scan.pdf",
+	} {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("%s lacks %q: %s", name, want, files[name])
+		}
+	}
+	if strings.Contains(files["conversation.json"], "someone else") || strings.Contains(files["artifacts.json"], "other.pdf") {
+		t.Error("export includes another chat's data")
+	}
+
+	if res := tool.Execute(chat, map[string]interface{}{"action": "delete"}); !strings.Contains(res.ForLLM, "confirm") || len(al.sessions.GetHistory("telegram:42")) != 1 {
+		t.Fatalf("delete without confirm: %s", res.ForLLM)
+	}
+	res = tool.Execute(chat, map[string]interface{}{"action": "delete", "confirm": true})
+	if res.IsError || !strings.Contains(res.ForLLM, "1 memories and 2 files") || !strings.Contains(res.ForLLM, "1 entries for this chat are kept") {
+		t.Fatalf("delete: %s", res.ForLLM)
+	}
+	if len(al.sessions.GetHistory("telegram:42")) != 0 || !al.profiles.Get("telegram:42").IsZero() || len(al.memories.ForChat("telegram:42")) != 0 {
+		t.Error("data left after delete")
+	}
+	if len(al.sessions.GetHistory("telegram:7")) != 1 || len(al.artifacts.List()) != 1 {
+		t.Error("delete touched another chat")
+	}
+}
+
+// TestUserData_CoversEveryChatStore verifies every store kept per chat is filled in an export and empty after a delete, other chats' data staying
+func TestUserData_CoversEveryChatStore(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	workspace := t.TempDir()
+	now := time.Now().UTC().Format(time.RFC3339)
+	for path, data := range map[string]string{
+		"state/habits.json":        `{"telegram:42": {"water": {"name": "water", "entries": [{"date": "2026-10-16"}]}}}`,
+		"state/lists.json":         `{"telegram:42": {"groceries": {"title": "Groceries", "items": [{"text": "milk"}]}}}`,
+		"state/templates.json":     `{"late": {"name": "late", "text": "Running late", "chat": "telegram:42"}}`,
+		"state/automations.json":   `{"telegram:42": {"morning_briefing": {"since": "` + now + `"}}}`,
+		"state/critical.json":      `{"policies": {"telegram:42": {"fallbacks": ["telegram:9"]}}}`,
+		"state/digest.json":        `{"telegram:42": {"every_minutes": 60, "pending": [{"category": "news", "content": "x", "at": "` + now + `"}]}}`,
+		"state/deferred.json":      `[{"tool": "calendar", "args": {}, "channel": "telegram", "chat_id": "42", "queued": "` + now + `"}]`,
+		"polls/polls.json":         `[{"id": "p1", "channel": "telegram", "chat_id": "42", "question": "Lunch?", "options": ["a", "b"], "created": "` + now + `"}]`,
+		"state/waiting_on.json":    `{"threads": {"t1": {"thread_id": "t1", "chat": "telegram:42", "subject": "Quote"}}}`,
+		"state/mail_routes.json":   `{"chats": {"telegram:42": {"rules": [{"label": "Finance", "route": "now"}]}}}`,
+		"state/meeting_notes.json": `{"notes": {"e1": {"event_id": "e1", "title": "Standup", "end": "` + now + `", "chat": "telegram:42"}}, "last": {"telegram:42": "e1"}}`,
+		"state/attachments.json":   `{"items": [{"artifact": "a1", "name": "r.pdf", "chat": "telegram:42", "user": "telegram:42", "kind": "receipt"}]}`,
+		"state/podcasts.json":      `{"chats": {"telegram:42": {"feeds": [{"url": "https://example.com/feed", "title": "Show"}]}}}`,
+		"state/transit.json":       `{"chats": {"telegram:42": {"job_id": "j1"}}}`,
+	} {
+		path = filepath.Join(workspace, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+		Workspace:         workspace,
+		Model:             "test-model",
+		MaxTokens:         4096,
+		MaxToolIterations: 5,
+	}}}
+	cfg.Tools.Lists.Enabled = true
+	cfg.Tools.Gmail.Enabled = true
+	cfg.Tools.MeetingNotes.Enabled = true
+	cfg.Tools.Attachments.Enabled = true
+	cfg.Tools.Podcasts.Enabled = true
+	cfg.Tools.Transit.Enabled = true
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &mockProvider{})
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	al.RegisterTool(tools.NewCronTool(cs, al, msgBus, workspace, false, time.Minute))
+	every := int64(3600000)
+	if _, err := cs.AddJob("stretch", cron.CronSchedule{Kind: "every", EveryMS: &every}, "stretch", true, "telegram", "42"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := al.store.Memory.Set(ctx, "telegram:42", "plan", "gym"); err != nil {
+		t.Fatal(err)
+	}
+	if err := al.store.Memory.Set(ctx, "telegram:7", "plan", "swim"); err != nil {
+		t.Fatal(err)
+	}
+	if err := al.store.Memory.Set(ctx, quotaScope, "2026-10-16", `{"telegram:42": {"messages": 3}, "telegram:7": {"messages": 1}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	stores := al.chatDataStores()
+	var files []string
+	for _, s := range stores {
+		files = append(files, s.file)
+		if data, err := s.store.ChatData(ctx, "telegram:42"); err != nil || data == nil {
+			t.Errorf("%s not filled: %v %v", s.file, data, err)
+		}
+	}
+	if want := "records.json quotas.json critical.json digest.json polls.json deferred.json schedules.json automations.json habits.json lists.json templates.json waiting_on.json mail_routes.json meeting_notes.json attachments.json podcasts.json transit.json"; strings.Join(files, " ") != want {
+		t.Fatalf("stores = %s", strings.Join(files, " "))
+	}
+
+	artifact, err := al.ExportUserData(ctx, "telegram", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(artifact.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	exported := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		exported[f.Name] = string(data)
+	}
+	for _, file := range files {
+		if !strings.Contains(exported[file], "telegram:42") {
+			t.Errorf("%s not exported: %s", file, exported[file])
+		}
+		if !strings.Contains(exported["README.txt"], file) {
+			t.Errorf("README does not describe %s", file)
+		}
+	}
+
+	report, err := al.DeleteUserData(ctx, "telegram", "42")
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if !strings.Contains(report, "other records (") {
+		t.Errorf("report = %s", report)
+	}
+	for _, s := range stores {
+		if data, err := s.store.ChatData(ctx, "telegram:42"); err != nil || data != nil {
+			t.Errorf("%s left after delete: %v %v", s.file, data, err)
+		}
+	}
+	if v, ok, _ := al.store.Memory.Get(ctx, "telegram:7", "plan"); !ok || v != "swim" {
+		t.Error("delete touched another chat's records")
+	}
+	if v, _, _ := al.store.Memory.Get(ctx, quotaScope, "2026-10-16"); !strings.Contains(v, "telegram:7") {
+		t.Errorf("delete touched another user's quota: %s", v)
+	}
+}
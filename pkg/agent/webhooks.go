@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/webhooks"
+)
+
+// webhookEndpoints converts webhooks from the config; none when disabled.
+func webhookEndpoints(cfg *config.Config) []webhooks.Endpoint {
+	if !cfg.Webhooks.Enabled {
+		return nil
+	}
+	endpoints := make([]webhooks.Endpoint, 0, len(cfg.Webhooks.Endpoints))
+	for _, e := range cfg.Webhooks.Endpoints {
+		endpoints = append(endpoints, webhooks.Endpoint{URL: e.URL, Secret: e.Secret, Events: e.Events})
+	}
+	return endpoints
+}
+
+// emitProcessed posts a message.processed event for a chat message the
+// agent answered with reply. Internal channels don't count.
+func (al *AgentLoop) emitProcessed(msg bus.InboundMessage, reply string, started time.Time, err error) {
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+	data := map[string]interface{}{
+		"channel":     msg.Channel,
+		"chat_id":     msg.ChatID,
+		"sender_id":   msg.SenderID,
+		"duration_ms": time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	al.cfgMu.RLock()
+	includeContent := al.cfg.Webhooks.IncludeContent
+	al.cfgMu.RUnlock()
+	if includeContent {
+		data["message"] = msg.Content
+		data["reply"] = reply
+	}
+	webhooks.Emit(webhooks.MessageProcessed, data)
+}
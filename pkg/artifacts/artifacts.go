@@ -0,0 +1,365 @@
+// Package artifacts keeps files produced or received during a conversation
+// (downloaded attachments, rendered images, exported documents) under short
+// IDs, so tools can hand them to each other as "artifact:k3v9qz" instead of
+// passing temp paths through model text. Each artifact has a TTL and is
+// deleted by Cleanup once it expires.
+package artifacts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Prefix marks an artifact reference in tool arguments and results.
+const Prefix = "artifact:"
+
+// DefaultTTL is how long an artifact is kept when the caller gives no TTL.
+const DefaultTTL = 24 * time.Hour
+
+// MaxSize caps a single artifact.
+const MaxSize = 100 << 20
+
+const idAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// Artifact is a stored file. Path is inside the store and stays valid
+// until the artifact expires.
+type Artifact struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	// Origin says what produced the file: the "channel:chat_id" a file was
+	// received in, or a tool name such as "summarize"
+	Origin  string    `json:"origin"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// Ref returns the reference tools accept in place of a path.
+func (a *Artifact) Ref() string {
+	return Prefix + a.ID
+}
+
+// String describes the artifact for tool output.
+func (a *Artifact) String() string {
+	return fmt.Sprintf("%s (%s, %s, %s)", a.Ref(), a.Name, a.MimeType, formatSize(a.Size))
+}
+
+// Store keeps artifacts in dir/<id>/<name> with an index in dir/index.json.
+// It is safe for concurrent use.
+type Store struct {
+	dir   string
+	mu    sync.Mutex
+	items map[string]*Artifact
+	now   func() time.Time
+}
+
+// New opens the store in dir, loading the index left by a previous run.
+func New(dir string) *Store {
+	s := &Store{dir: dir, items: make(map[string]*Artifact), now: time.Now}
+	if data, err := os.ReadFile(s.indexPath()); err == nil {
+		var items []*Artifact
+		if err := json.Unmarshal(data, &items); err != nil {
+			logger.WarnCF("artifacts", "Ignoring unreadable artifact index", map[string]interface{}{"error": err.Error()})
+		}
+		for _, a := range items {
+			s.items[a.ID] = a
+		}
+	}
+	return s
+}
+
+// Dir returns the directory artifacts are stored in.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+// Put stores the contents of r as a new artifact. An empty mimeType is
+// guessed from the name; ttl <= 0 means DefaultTTL.
+func (s *Store) Put(r io.Reader, name, mimeType, origin string, ttl time.Duration) (*Artifact, error) {
+	name = sanitizeName(name)
+	if mimeType == "" {
+		mimeType = guessMimeType(name)
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	s.mu.Lock()
+	id := s.newID()
+	// Reserve the ID while the file is written outside the lock
+	s.items[id] = &Artifact{ID: id}
+	s.mu.Unlock()
+
+	a, err := s.write(id, r, name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		delete(s.items, id)
+		return nil, err
+	}
+	now := s.now()
+	a.MimeType = mimeType
+	a.Origin = origin
+	a.Created = now
+	a.Expires = now.Add(ttl)
+	s.items[id] = a
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	copied := *a
+	return &copied, nil
+}
+
+func (s *Store) write(id string, r io.Reader, name string) (*Artifact, error) {
+	dir := filepath.Join(s.dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(r, MaxSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > MaxSize {
+		err = fmt.Errorf("file is larger than %d MB", MaxSize>>20)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Artifact{ID: id, Name: name, Path: path, Size: n}, nil
+}
+
+// Add copies the file at path into the store. The original is left alone,
+// so callers can keep cleaning up their own temp files.
+func (s *Store) Add(path, mimeType, origin string, ttl time.Duration) (*Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.Put(f, filepath.Base(path), mimeType, origin, ttl)
+}
+
+// Get returns an unexpired artifact by ID or reference.
+func (s *Store) Get(ref string) (*Artifact, bool) {
+	id := strings.TrimPrefix(strings.TrimSpace(ref), Prefix)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.items[id]
+	if !ok || a.Path == "" || !s.now().Before(a.Expires) {
+		return nil, false
+	}
+	copied := *a
+	return &copied, true
+}
+
+// List returns the unexpired artifacts, newest first.
+func (s *Store) List() []Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var list []Artifact
+	for _, a := range s.items {
+		if a.Path != "" && now.Before(a.Expires) {
+			list = append(list, *a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	return list
+}
+
+// Remove deletes an artifact before it expires.
+func (s *Store) Remove(ref string) error {
+	id := strings.TrimPrefix(strings.TrimSpace(ref), Prefix)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return fmt.Errorf("artifact %s not found", id)
+	}
+	delete(s.items, id)
+	os.RemoveAll(filepath.Join(s.dir, id))
+	return s.saveLocked()
+}
+
+// Cleanup deletes expired artifacts and stray directories left by a crash,
+// returning how many artifacts were removed.
+func (s *Store) Cleanup() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	removed := 0
+	for id, a := range s.items {
+		if a.Path != "" && !now.Before(a.Expires) {
+			delete(s.items, id)
+			os.RemoveAll(filepath.Join(s.dir, id))
+			removed++
+		}
+	}
+	if entries, err := os.ReadDir(s.dir); err == nil {
+		for _, e := range entries {
+			if _, ok := s.items[e.Name()]; e.IsDir() && !ok {
+				os.RemoveAll(filepath.Join(s.dir, e.Name()))
+			}
+		}
+	}
+	if removed > 0 {
+		if err := s.saveLocked(); err != nil {
+			logger.WarnCF("artifacts", "Failed to save artifact index", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return removed
+}
+
+// Run calls Cleanup every interval until ctx is done.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	s.Cleanup()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.Cleanup(); n > 0 {
+				logger.DebugCF("artifacts", "Removed expired artifacts", map[string]interface{}{"count": n})
+			}
+		}
+	}
+}
+
+func (s *Store) saveLocked() error {
+	items := make([]*Artifact, 0, len(s.items))
+	for _, a := range s.items {
+		// Reservations of in-flight Puts have no file yet
+		if a.Path != "" {
+			items = append(items, a)
+		}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	tmp := s.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.indexPath())
+}
+
+func (s *Store) newID() string {
+	for {
+		var b [6]byte
+		rand.Read(b[:])
+		id := make([]byte, len(b))
+		for i, v := range b {
+			id[i] = idAlphabet[int(v)%len(idAlphabet)]
+		}
+		if _, taken := s.items[string(id)]; !taken {
+			return string(id)
+		}
+	}
+}
+
+// WorkspaceDir is where the agent keeps the artifact store of a workspace.
+func WorkspaceDir(workspace string) string {
+	return filepath.Join(workspace, "artifacts")
+}
+
+// Lookup resolves a reference to the artifact's file in dir without
+// loading the index, for code that only knows the store directory (path
+// validation in file tools). Expired artifacts resolve until the next
+// Cleanup.
+func Lookup(dir, ref string) (string, error) {
+	id := strings.TrimPrefix(strings.TrimSpace(ref), Prefix)
+	if id == "" || strings.Trim(id, idAlphabet) != "" {
+		return "", fmt.Errorf("invalid artifact reference %q", ref)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, id))
+	if err != nil || len(entries) != 1 {
+		return "", fmt.Errorf("artifact %s not found or expired", id)
+	}
+	return filepath.Join(dir, id, entries[0].Name()), nil
+}
+
+// IsRef reports whether s is an artifact reference.
+func IsRef(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), Prefix)
+}
+
+func sanitizeName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == "" || name == "index.json" {
+		return "file"
+	}
+	return name
+}
+
+var mimeTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".html": "text/html",
+	".json": "application/json",
+	".ics":  "text/calendar",
+	".zip":  "application/zip",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+func guessMimeType(name string) string {
+	if m, ok := mimeTypes[strings.ToLower(filepath.Ext(name))]; ok {
+		return m
+	}
+	return "application/octet-stream"
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,55 @@
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStore_PutGetExpire verifies artifacts are stored, resolved by reference and removed after their TTL
+func TestStore_PutGetExpire(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	store := New(dir)
+	store.now = func() time.Time { return now }
+
+	a, err := store.Put(strings.NewReader("%PDF-1.4"), "../invoice.pdf", "", "summarize", time.Hour)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if a.Name != "invoice.pdf" || a.MimeType != "application/pdf" || a.Size != 8 || filepath.Dir(filepath.Dir(a.Path)) != dir {
+		t.Fatalf("unexpected artifact: %+v", a)
+	}
+	if got, ok := store.Get(a.Ref()); !ok || got.Path != a.Path {
+		t.Fatalf("Get(%s) = %+v, %v", a.Ref(), got, ok)
+	}
+	if path, err := Lookup(dir, a.Ref()); err != nil || path != a.Path {
+		t.Fatalf("Lookup = %q, %v", path, err)
+	}
+	if _, err := Lookup(dir, "artifact:../etc"); err == nil {
+		t.Fatal("Lookup accepted an invalid ID")
+	}
+
+	// The index survives a restart
+	reopened := New(dir)
+	reopened.now = store.now
+	if _, ok := reopened.Get(a.ID); !ok {
+		t.Fatal("artifact lost after reopening the store")
+	}
+
+	os.MkdirAll(filepath.Join(dir, "stray"), 0755)
+	now = now.Add(2 * time.Hour)
+	if _, ok := reopened.Get(a.ID); ok {
+		t.Fatal("expired artifact still returned")
+	}
+	if n := reopened.Cleanup(); n != 1 {
+		t.Fatalf("Cleanup removed %d, want 1", n)
+	}
+	for _, name := range []string{a.ID, "stray"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleProvider is the credential store key for Google account tokens.
+const GoogleProvider = "google"
+
+type GoogleOAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	Port         int
+}
+
+func NewGoogleOAuthConfig(clientID, clientSecret string, scopes []string) GoogleOAuthConfig {
+	return GoogleOAuthConfig{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		Port:         1456,
+	}
+}
+
+func buildGoogleAuthorizeURL(cfg GoogleOAuthConfig, pkce PKCECodes, state, redirectURI string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"code_challenge":        {pkce.CodeChallenge},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		// Needed to get a refresh token back, and to get a new one when
+		// scopes were added since the last login.
+		"access_type": {"offline"},
+		"prompt":      {"consent"},
+	}
+	return cfg.AuthURL + "?" + params.Encode()
+}
+
+// LoginGoogle runs the installed-app OAuth flow with a loopback redirect.
+func LoginGoogle(cfg GoogleOAuthConfig) (*AuthCredential, error) {
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("google client_id is not configured")
+	}
+
+	pkce, err := GeneratePKCE()
+	if err != nil {
+		return nil, fmt.Errorf("generating PKCE: %w", err)
+	}
+	state, err := generateState()
+	if err != nil {
+		return nil, fmt.Errorf("generating state: %w", err)
+	}
+
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/auth/callback", cfg.Port)
+	authURL := buildGoogleAuthorizeURL(cfg, pkce, state, redirectURI)
+
+	resultCh := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/callback", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != state {
+			resultCh <- callbackResult{err: fmt.Errorf("state mismatch")}
+			http.Error(w, "State mismatch", http.StatusBadRequest)
+			return
+		}
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			resultCh <- callbackResult{err: fmt.Errorf("no code received: %s", r.URL.Query().Get("error"))}
+			http.Error(w, "No authorization code received", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body><h2>Authentication successful!</h2><p>You can close this window.</p></body></html>")
+		resultCh <- callbackResult{code: code}
+	})
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.Port))
+	if err != nil {
+		return nil, fmt.Errorf("starting callback server on port %d: %w", cfg.Port, err)
+	}
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	fmt.Printf("Open this URL to authenticate:\n\n%s\n\n", authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Printf("Could not open browser automatically.\nPlease open this URL manually:\n\n%s\n\n", authURL)
+	}
+	fmt.Println("Waiting for authentication in browser...")
+
+	select {
+	case result := <-resultCh:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return googleTokenRequest(cfg, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {result.code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {pkce.CodeVerifier},
+		})
+	case <-time.After(5 * time.Minute):
+		return nil, fmt.Errorf("authentication timed out after 5 minutes")
+	}
+}
+
+func googleTokenRequest(cfg GoogleOAuthConfig, data url.Values) (*AuthCredential, error) {
+	data.Set("client_id", cfg.ClientID)
+	if cfg.ClientSecret != "" {
+		data.Set("client_secret", cfg.ClientSecret)
+	}
+
+	resp, err := http.PostForm(cfg.TokenURL, data)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: %s", string(body))
+	}
+	return parseTokenResponse(body, GoogleProvider)
+}
+
+// RefreshGoogleToken exchanges the stored refresh token for a new access token.
+func RefreshGoogleToken(cred *AuthCredential, cfg GoogleOAuthConfig) (_ *AuthCredential, err error) {
+	defer func() { recordRefresh(GoogleProvider, err) }()
+	if cred.RefreshToken == "" {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+
+	refreshed, err := googleTokenRequest(cfg, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {cred.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = cred.RefreshToken
+	}
+	if refreshed.AccountID == "" {
+		refreshed.AccountID = cred.AccountID
+	}
+	return refreshed, nil
+}
+
+// GoogleTokenSource hands out a valid access token for the stored Google
+// credential, refreshing and persisting it when it is about to expire.
+type GoogleTokenSource struct {
+	cfg GoogleOAuthConfig
+	mu  sync.Mutex
+}
+
+func NewGoogleTokenSource(cfg GoogleOAuthConfig) *GoogleTokenSource {
+	return &GoogleTokenSource{cfg: cfg}
+}
+
+func (s *GoogleTokenSource) AccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cred, err := GetCredential(GoogleProvider)
+	if err != nil {
+		return "", fmt.Errorf("loading google credentials: %w", err)
+	}
+	if cred == nil {
+		return "", fmt.Errorf("not logged in to Google (run: picoclaw auth login --provider google)")
+	}
+	if !cred.NeedsRefresh() {
+		return cred.AccessToken, nil
+	}
+
+	refreshed, err := RefreshGoogleToken(cred, s.cfg)
+	if err != nil {
+		return "", fmt.Errorf("refreshing google token: %w", err)
+	}
+	if err := SetCredential(GoogleProvider, refreshed); err != nil {
+		return "", fmt.Errorf("saving google token: %w", err)
+	}
+	return refreshed.AccessToken, nil
+}
+
+// Refresh gets a new access token after Google refused stale, even though
+// it had not expired yet (revoked, or the clock is off). If the stored
+// token is no longer stale, someone else already refreshed it and that
+// token is returned.
+func (s *GoogleTokenSource) Refresh(ctx context.Context, stale string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cred, err := GetCredential(GoogleProvider)
+	if err != nil {
+		return "", fmt.Errorf("loading google credentials: %w", err)
+	}
+	if cred == nil {
+		return "", fmt.Errorf("not logged in to Google (run: picoclaw auth login --provider google)")
+	}
+	if cred.AccessToken != stale {
+		return cred.AccessToken, nil
+	}
+	refreshed, err := RefreshGoogleToken(cred, s.cfg)
+	if err != nil {
+		return "", fmt.Errorf("refreshing google token: %w", err)
+	}
+	if err := SetCredential(GoogleProvider, refreshed); err != nil {
+		return "", fmt.Errorf("saving google token: %w", err)
+	}
+	return refreshed.AccessToken, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBuildGoogleAuthorizeURL(t *testing.T) {
+	cfg := NewGoogleOAuthConfig("client.apps.googleusercontent.com", "secret",
+		[]string{"https://www.googleapis.com/auth/contacts", "openid"})
+	pkce := PKCECodes{CodeVerifier: "verifier", CodeChallenge: "challenge"}
+
+	u, err := url.Parse(buildGoogleAuthorizeURL(cfg, pkce, "state-1", "http://127.0.0.1:1456/auth/callback"))
+	if err != nil {
+		t.Fatalf("url.Parse() error: %v", err)
+	}
+	q := u.Query()
+
+	if q.Get("access_type") != "offline" {
+		t.Errorf("access_type = %q, want offline", q.Get("access_type"))
+	}
+	if q.Get("scope") != "https://www.googleapis.com/auth/contacts openid" {
+		t.Errorf("scope = %q", q.Get("scope"))
+	}
+	if q.Get("code_challenge") != "challenge" || q.Get("state") != "state-1" {
+		t.Errorf("missing PKCE/state params: %s", u.RawQuery)
+	}
+	if !strings.HasPrefix(u.String(), "https://accounts.google.com/") {
+		t.Errorf("unexpected auth host: %s", u.Host)
+	}
+}
+
+func TestRefreshGoogleTokenPreservesRefreshToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("client_secret") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// Google does not return a new refresh token on refresh
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "new-access",
+			"expires_in":   3599,
+		})
+	}))
+	defer server.Close()
+
+	cfg := NewGoogleOAuthConfig("client", "secret", nil)
+	cfg.TokenURL = server.URL
+
+	refreshed, err := RefreshGoogleToken(&AuthCredential{
+		AccessToken:  "old",
+		RefreshToken: "keep-me",
+		Provider:     GoogleProvider,
+	}, cfg)
+	if err != nil {
+		t.Fatalf("RefreshGoogleToken() error: %v", err)
+	}
+	if refreshed.AccessToken != "new-access" {
+		t.Errorf("AccessToken = %q, want new-access", refreshed.AccessToken)
+	}
+	if refreshed.RefreshToken != "keep-me" {
+		t.Errorf("RefreshToken = %q, want keep-me", refreshed.RefreshToken)
+	}
+	if refreshed.Provider != GoogleProvider {
+		t.Errorf("Provider = %q, want %q", refreshed.Provider, GoogleProvider)
+	}
+}
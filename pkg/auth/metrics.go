@@ -0,0 +1,14 @@
+package auth
+
+import "github.com/sipeed/picoclaw/pkg/metrics"
+
+var tokenRefreshes = metrics.NewCounter("picoclaw_auth_token_refreshes_total",
+	"OAuth access token refreshes by provider and result.", "provider", "result")
+
+func recordRefresh(provider string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	tokenRefreshes.Inc(provider, result)
+}
@@ -258,7 +258,8 @@ func pollDeviceCode(cfg OAuthProviderConfig, deviceAuthID, userCode string) (*Au
 	return exchangeCodeForTokens(cfg, tokenResp.AuthorizationCode, tokenResp.CodeVerifier, redirectURI)
 }
 
-func RefreshAccessToken(cred *AuthCredential, cfg OAuthProviderConfig) (*AuthCredential, error) {
+func RefreshAccessToken(cred *AuthCredential, cfg OAuthProviderConfig) (_ *AuthCredential, err error) {
+	defer func() { recordRefresh(cred.Provider, err) }()
 	if cred.RefreshToken == "" {
 		return nil, fmt.Errorf("no refresh token available")
 	}
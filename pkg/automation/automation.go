@@ -0,0 +1,360 @@
+// Package automation loads schedules, message templates, rules and event
+// rules from
+// YAML files in a directory, so they can be kept under version control
+// next to the config. They sit beside the ones created from chat: files
+// are read again when they change, and a file with mistakes is reported
+// and ignored until fixed, keeping the last good definitions.
+//
+// A file may hold any of the four sections:
+//
+//	schedules:
+//	  - name: standup
+//	    chat: telegram:123456
+//	    cron: "45 8 * * 1-5"
+//	    timezone: Europe/Lisbon
+//	    message: Standup in 15 minutes
+//	  - name: weekly-review
+//	    chat: telegram:123456
+//	    every: 168h
+//	    prompt: Summarize what I did this week
+//	templates:
+//	  - name: running late
+//	    text: Hi {first_name}, running {eta} late
+//	rules:
+//	  - name: wifi
+//	    chats: [telegram:123456]
+//	    match: wi-?fi password
+//	    reply: The guest network is "home-guest", password on the fridge
+//	events:
+//	  - name: door
+//	    source: home-assistant
+//	    match: door.*opened
+//	    chats: [telegram:123456]
+//	    instructions: Say which door, and ask whether to turn the alarm on if nobody is home
+package automation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+	"gopkg.in/yaml.v3"
+)
+
+// Set is the definitions read from a directory.
+type Set struct {
+	Schedules []Schedule
+	Templates []Template
+	Rules     []Rule
+	Events    []EventRule
+}
+
+// file is the layout of one YAML file.
+type file struct {
+	Schedules []Schedule  `yaml:"schedules"`
+	Templates []Template  `yaml:"templates"`
+	Rules     []Rule      `yaml:"rules"`
+	Events    []EventRule `yaml:"events"`
+}
+
+// Schedule sends Message to Chat, or runs Prompt as an agent turn there,
+// on a Cron expression or Every interval.
+type Schedule struct {
+	Name     string `yaml:"name"`
+	Chat     string `yaml:"chat"`
+	Cron     string `yaml:"cron"`
+	Every    string `yaml:"every"`
+	Timezone string `yaml:"timezone"`
+	Message  string `yaml:"message"`
+	Prompt   string `yaml:"prompt"`
+
+	// File is where the schedule is defined
+	File string `yaml:"-"`
+}
+
+// Channel and ChatID split Chat.
+func (s Schedule) Channel() string {
+	channel, _, _ := strings.Cut(s.Chat, ":")
+	return channel
+}
+
+func (s Schedule) ChatID() string {
+	_, chatID, _ := strings.Cut(s.Chat, ":")
+	return chatID
+}
+
+// Interval returns Every, zero for cron schedules.
+func (s Schedule) Interval() time.Duration {
+	d, _ := time.ParseDuration(s.Every)
+	return d
+}
+
+// Digest identifies the schedule's content; it changes with any field, so
+// a job made from an older version can be told apart.
+func (s Schedule) Digest() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{s.Name, s.Chat, s.Cron, s.Every, s.Timezone, s.Message, s.Prompt}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Template is a message template, as saved with the templates tool.
+type Template struct {
+	Name string `yaml:"name"`
+	Text string `yaml:"text"`
+	File string `yaml:"-"`
+}
+
+// Rule applies to messages matching Match in Chats (any chat when empty).
+// Reply answers them without the model; Instructions are given to the
+// model along with the message.
+type Rule struct {
+	Name         string   `yaml:"name"`
+	Chats        []string `yaml:"chats"`
+	Match        string   `yaml:"match"`
+	Reply        string   `yaml:"reply"`
+	Instructions string   `yaml:"instructions"`
+	File         string   `yaml:"-"`
+
+	re *regexp.Regexp
+}
+
+// Matches reports whether the rule applies to text sent in chat
+// ("channel:chat_id").
+func (r *Rule) Matches(chat, text string) bool {
+	if len(r.Chats) > 0 {
+		found := false
+		for _, c := range r.Chats {
+			found = found || c == chat
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.re != nil && r.re.MatchString(text)
+}
+
+// Match returns the first rule, in file order, that applies to text sent
+// in chat.
+func (s *Set) Match(chat, text string) *Rule {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Rules {
+		if s.Rules[i].Matches(chat, text) {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Event is something an external system posted to the gateway, such as a
+// door sensor opening or a build failing. Source is the name of the
+// system, taken from the token it authenticated with.
+type Event struct {
+	Source string
+	Type   string
+	Text   string
+	Data   map[string]string
+}
+
+// EventRule notifies Chats of events from Source (any source when empty)
+// whose type or text matches Match. Message is sent as it is, with
+// {source}, {type}, {text} and the event's data fields filled in;
+// Instructions have the model write the notification instead.
+type EventRule struct {
+	Name         string   `yaml:"name"`
+	Source       string   `yaml:"source"`
+	Match        string   `yaml:"match"`
+	Chats        []string `yaml:"chats"`
+	Message      string   `yaml:"message"`
+	Instructions string   `yaml:"instructions"`
+	File         string   `yaml:"-"`
+
+	re *regexp.Regexp
+}
+
+// Matches reports whether the rule applies to e.
+func (r *EventRule) Matches(e Event) bool {
+	if r.Source != "" && !strings.EqualFold(r.Source, e.Source) {
+		return false
+	}
+	return r.re != nil && (r.re.MatchString(e.Type) || r.re.MatchString(e.Text))
+}
+
+// Expand fills the rule's message in for e. Unknown placeholders are left
+// as they are.
+func (r *EventRule) Expand(e Event) string {
+	pairs := []string{"{source}", e.Source, "{type}", e.Type, "{text}", e.Text}
+	for k, v := range e.Data {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(r.Message)
+}
+
+// MatchEvent returns every event rule, in file order, that applies to e:
+// one event may concern several chats or people.
+func (s *Set) MatchEvent(e Event) []EventRule {
+	if s == nil {
+		return nil
+	}
+	var rules []EventRule
+	for i := range s.Events {
+		if s.Events[i].Matches(e) {
+			rules = append(rules, s.Events[i])
+		}
+	}
+	return rules
+}
+
+// Files lists the YAML files in dir, sorted by name. A missing directory
+// has none.
+func Files(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.IsDir() && (ext == ".yaml" || ext == ".yml") && !strings.HasPrefix(e.Name(), ".") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Load reads and validates every YAML file in dir. It fails on the first
+// file with a mistake, naming the file and the field, so a typo never
+// drops definitions silently.
+func Load(dir string) (*Set, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	set := &Set{}
+	v := &validator{names: map[string]string{}}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f file
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		v.file = filepath.Base(path)
+		for i := range f.Schedules {
+			f.Schedules[i].File = v.file
+			v.schedule(fmt.Sprintf("schedules[%d]", i), &f.Schedules[i])
+		}
+		for i := range f.Templates {
+			f.Templates[i].File = v.file
+			v.template(fmt.Sprintf("templates[%d]", i), &f.Templates[i])
+		}
+		for i := range f.Rules {
+			f.Rules[i].File = v.file
+			v.rule(fmt.Sprintf("rules[%d]", i), &f.Rules[i])
+		}
+		for i := range f.Events {
+			f.Events[i].File = v.file
+			v.event(fmt.Sprintf("events[%d]", i), &f.Events[i])
+		}
+		if len(v.errs) > 0 {
+			return nil, errors.Join(v.errs...)
+		}
+		set.Schedules = append(set.Schedules, f.Schedules...)
+		set.Templates = append(set.Templates, f.Templates...)
+		set.Rules = append(set.Rules, f.Rules...)
+		set.Events = append(set.Events, f.Events...)
+	}
+	return set, nil
+}
+
+type validator struct {
+	file  string
+	names map[string]string // kind/name -> file defining it
+	errs  []error
+}
+
+func (v *validator) check(ok bool, path, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s: %s", v.file, path, fmt.Sprintf(format, args...)))
+	}
+}
+
+// unique checks name is set and not used by another definition of kind.
+func (v *validator) unique(kind, path, name string) {
+	v.check(strings.TrimSpace(name) != "", path+".name", "is required")
+	key := kind + "/" + strings.ToLower(strings.TrimSpace(name))
+	if other, ok := v.names[key]; ok && name != "" {
+		v.check(false, path+".name", "%q is already defined in %s", name, other)
+	}
+	v.names[key] = v.file
+}
+
+// chat checks a "channel:chat_id" reference.
+func (v *validator) chat(path, chat string) {
+	channel, chatID, ok := strings.Cut(chat, ":")
+	v.check(ok && channel != "" && chatID != "", path, "must be channel:chat_id, got %q", chat)
+}
+
+func (v *validator) schedule(path string, s *Schedule) {
+	v.unique("schedule", path, s.Name)
+	v.chat(path+".chat", s.Chat)
+	v.check((s.Cron == "") != (s.Every == ""), path, "needs exactly one of cron or every")
+	if s.Cron != "" {
+		v.check(gronx.New().IsValid(s.Cron), path+".cron", "invalid cron expression %q", s.Cron)
+	}
+	if s.Every != "" {
+		d, err := time.ParseDuration(s.Every)
+		v.check(err == nil && d >= time.Minute, path+".every", "must be a duration of at least 1m, got %q", s.Every)
+	}
+	if s.Timezone != "" {
+		_, err := time.LoadLocation(s.Timezone)
+		v.check(err == nil, path+".timezone", "unknown timezone %q", s.Timezone)
+	}
+	v.check((strings.TrimSpace(s.Message) == "") != (strings.TrimSpace(s.Prompt) == ""), path, "needs exactly one of message or prompt")
+}
+
+func (v *validator) template(path string, t *Template) {
+	v.unique("template", path, t.Name)
+	v.check(strings.TrimSpace(t.Text) != "", path+".text", "is required")
+}
+
+func (v *validator) rule(path string, r *Rule) {
+	v.unique("rule", path, r.Name)
+	for i, chat := range r.Chats {
+		v.chat(fmt.Sprintf("%s.chats[%d]", path, i), chat)
+	}
+	re, err := regexp.Compile("(?i)" + r.Match)
+	v.check(r.Match != "" && err == nil, path+".match", "must be a regular expression, got %q", r.Match)
+	r.re = re
+	v.check((strings.TrimSpace(r.Reply) == "") != (strings.TrimSpace(r.Instructions) == ""), path, "needs exactly one of reply or instructions")
+}
+
+func (v *validator) event(path string, r *EventRule) {
+	v.unique("event", path, r.Name)
+	v.check(len(r.Chats) > 0, path+".chats", "is required")
+	for i, chat := range r.Chats {
+		v.chat(fmt.Sprintf("%s.chats[%d]", path, i), chat)
+	}
+	re, err := regexp.Compile("(?i)" + r.Match)
+	v.check(r.Match != "" && err == nil, path+".match", "must be a regular expression, got %q", r.Match)
+	r.re = re
+	v.check((strings.TrimSpace(r.Message) == "") != (strings.TrimSpace(r.Instructions) == ""), path, "needs exactly one of message or instructions")
+}
@@ -0,0 +1,133 @@
+package automation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStore_ReloadKeepsLastGoodDefinitions verifies files are loaded and matched, and a file with a mistake is reported without dropping the definitions in use
+func TestStore_ReloadKeepsLastGoodDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("home.yaml", `
+schedules:
+  - name: standup
+    chat: telegram:42
+    cron: "45 8 * * 1-5"
+    timezone: Europe/Lisbon
+    message: Standup in 15 minutes
+rules:
+  - name: wifi
+    chats: [telegram:42]
+    match: wi-?fi password
+    reply: On the fridge
+`)
+	write("work.yml", `
+templates:
+  - name: running late
+    text: Running {eta} late
+rules:
+  - name: tone
+    match: .
+    instructions: Answer briefly
+`)
+	write("notes.txt", "not: [yaml")
+
+	store := NewStore(dir)
+	changes := 0
+	store.OnChange(func(*Set) { changes++ })
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	set := store.Current()
+	if len(set.Schedules) != 1 || set.Schedules[0].ChatID() != "42" || set.Schedules[0].File != "home.yaml" || len(set.Templates) != 1 {
+		t.Fatalf("unexpected set %+v", set)
+	}
+	if r := set.Match("telegram:42", "What's the WiFi password?"); r == nil || r.Reply != "On the fridge" {
+		t.Errorf("wifi rule not matched: %+v", r)
+	}
+	if r := set.Match("telegram:7", "What's the WiFi password?"); r == nil || r.Name != "tone" {
+		t.Errorf("rule for another chat applied: %+v", r)
+	}
+
+	write("work.yml", `
+schedules:
+  - name: Standup
+    chat: telegram
+    cron: "61 * * * *"
+    message: hi
+    prompt: hi
+`)
+	err := store.Reload()
+	for _, want := range []string{"work.yml: schedules[0].name", "already defined in home.yaml", "schedules[0].chat", "schedules[0].cron", "exactly one of message or prompt"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not mention %q", err, want)
+		}
+	}
+	if store.Current() != set || changes != 1 {
+		t.Errorf("definitions replaced by a broken file (changes %d)", changes)
+	}
+
+	write("work.yml", "rules:\n  - name: x\n    match: a\n    reply: b\n    replies: c\n")
+	if err := store.Reload(); err == nil || !strings.Contains(err.Error(), "replies") {
+		t.Errorf("unknown field accepted: %v", err)
+	}
+}
+
+// TestEventRules_MatchAndExpand verifies event rules match by source and type or text, fill their message in, and are validated
+func TestEventRules_MatchAndExpand(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "events.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`
+events:
+  - name: door
+    source: home-assistant
+    match: door.*opened
+    chats: [telegram:42, slack:C1]
+    instructions: Say which door
+  - name: builds
+    match: ^build\.failed$
+    chats: [telegram:42]
+    message: "🔴 {source}: {text} ({branch})"
+`)
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	door := Event{Source: "Home-Assistant", Type: "binary_sensor", Text: "Front door opened"}
+	if rules := set.MatchEvent(door); len(rules) != 1 || rules[0].Name != "door" || len(rules[0].Chats) != 2 {
+		t.Errorf("unexpected rules for the door: %+v", rules)
+	}
+	if rules := set.MatchEvent(Event{Source: "ci", Text: "Front door opened"}); len(rules) != 0 {
+		t.Errorf("rule for another source applied: %+v", rules)
+	}
+	build := Event{Source: "ci", Type: "build.failed", Text: "tests failed", Data: map[string]string{"branch": "main"}}
+	rules := set.MatchEvent(build)
+	if len(rules) != 1 || rules[0].Expand(build) != "🔴 ci: tests failed (main)" {
+		t.Errorf("unexpected rules for the build: %+v", rules)
+	}
+
+	write(`
+events:
+  - name: x
+    match: "("
+    message: hi
+    instructions: hi
+`)
+	_, err = Load(dir)
+	for _, want := range []string{"events[0].chats: is required", "events[0].match", "exactly one of message or instructions"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not mention %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package automation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Store holds the definitions last loaded from a directory and reloads
+// them when its files change.
+type Store struct {
+	mu       sync.RWMutex
+	dir      string
+	set      *Set
+	err      error
+	onChange []func(*Set)
+}
+
+// NewStore creates a store for dir; Reload reads it.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, set: &Set{}}
+}
+
+// Dir returns the directory definitions are read from.
+func (s *Store) Dir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dir
+}
+
+// SetDir switches to another directory, empty for none, and reloads.
+func (s *Store) SetDir(dir string) error {
+	s.mu.Lock()
+	changed := s.dir != dir
+	s.dir = dir
+	s.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return s.Reload()
+}
+
+// Current returns the definitions in use; never nil.
+func (s *Store) Current() *Set {
+	if s == nil {
+		return &Set{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.set
+}
+
+// Err returns why the last reload failed, nil if it worked.
+func (s *Store) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// OnChange registers fn to be called with the new definitions after each
+// successful reload.
+func (s *Store) OnChange(fn func(*Set)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// Reload reads the directory again. When a file has mistakes the error is
+// returned and logged, and the definitions in use are kept.
+func (s *Store) Reload() error {
+	dir := s.Dir()
+	set := &Set{}
+	var err error
+	if dir != "" {
+		set, err = Load(dir)
+	}
+	s.mu.Lock()
+	s.err = err
+	if err != nil {
+		s.mu.Unlock()
+		logger.WarnCF("automation", "Automation files not loaded; keeping the previous definitions",
+			map[string]interface{}{"dir": dir, "error": err.Error()})
+		return err
+	}
+	s.set = set
+	hooks := append(s.onChange[:0:0], s.onChange...)
+	s.mu.Unlock()
+
+	logger.InfoCF("automation", "Automation files loaded", map[string]interface{}{
+		"dir":       dir,
+		"schedules": len(set.Schedules),
+		"templates": len(set.Templates),
+		"rules":     len(set.Rules),
+	})
+	for _, fn := range hooks {
+		fn(set)
+	}
+	return nil
+}
+
+// Watch reloads the definitions when files in the directory are added,
+// removed or edited, checking every interval until ctx is done. Like the
+// config watcher, it waits for a change to settle for one interval so a
+// file is not read while an editor is still writing it.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	last := fingerprint(s.Dir())
+	pending := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		key := fingerprint(s.Dir())
+		if key != last {
+			last = key
+			pending = true
+			continue
+		}
+		if pending {
+			pending = false
+			s.Reload()
+		}
+	}
+}
+
+// fingerprint summarizes the names, sizes and times of the YAML files in
+// dir, changing when any of them does.
+func fingerprint(dir string) string {
+	files, _ := Files(dir)
+	var sb strings.Builder
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&sb, "%s/%d/%d;", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return sb.String()
+}
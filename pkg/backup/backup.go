@@ -0,0 +1,473 @@
+// Package backup mirrors files from cloud sources (Drive folders, Photos
+// albums and date ranges) to a local disk, a mounted SMB/NFS share or
+// another store such as a Drive folder. Runs are incremental: a manifest
+// records what was copied, and how faithfully, so unchanged files are
+// skipped and interrupted transfers resume.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// metaDir holds manifests inside the destination, next to the files they
+// describe, so moving the disk moves its history too.
+const metaDir = ".picoclaw-backup"
+
+// manifestSaveEvery bounds how much progress a crash can lose.
+const manifestSaveEvery = 25
+
+// Entry is one file offered by a source.
+type Entry struct {
+	ID string
+	// Path is relative to the backup root, with "/" separators
+	Path string
+	// Size is -1 when the source does not know it in advance
+	Size int64
+	// Version changes whenever the content changes (checksum, revision)
+	Version string
+	// Resumable reports whether Open honors a non-zero offset
+	Resumable bool
+	// MD5 is the hex checksum of the content, when the source knows it
+	MD5 string
+	// Fidelity says how the copy falls short of the original, e.g. a
+	// photo without its location metadata; empty for an exact copy
+	Fidelity string
+}
+
+// Source lists and reads the files to back up.
+type Source interface {
+	List(ctx context.Context) ([]Entry, error)
+	Open(ctx context.Context, entry Entry, offset int64) (io.ReadCloser, error)
+}
+
+// ManifestEntry records a file as it was last copied.
+type ManifestEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Version  string    `json:"version"`
+	Synced   time.Time `json:"synced"`
+	Fidelity string    `json:"fidelity,omitempty"`
+	// Ref is the destination's own ID for the copy, such as a Drive file ID
+	Ref string `json:"ref,omitempty"`
+}
+
+// Stats summarizes one run.
+type Stats struct {
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Scanned    int       `json:"scanned"`
+	Copied     int       `json:"copied"`
+	Resumed    int       `json:"resumed"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+	GoneAtSrc  int       `json:"gone_at_source"`
+	Errors     []string  `json:"errors,omitempty"`
+	Incomplete bool      `json:"incomplete,omitempty"`
+	// Fidelity counts the files in the backup that are not exact copies
+	// of their originals, by Entry.Fidelity
+	Fidelity map[string]int `json:"fidelity,omitempty"`
+}
+
+// Manifest is the persisted state of one backup job.
+type Manifest struct {
+	Job     string                   `json:"job"`
+	Files   map[string]ManifestEntry `json:"files"`
+	LastRun *Stats                   `json:"last_run,omitempty"`
+}
+
+// Destination is where a backup is written: Dir for a directory, or a
+// remote store such as a Drive folder.
+type Destination interface {
+	// Prepare checks the destination can be written before a run
+	Prepare(ctx context.Context) error
+	LoadManifest(job string) (*Manifest, error)
+	SaveManifest(m *Manifest) error
+	// Has reports whether a file copied before is still there
+	Has(ctx context.Context, prev ManifestEntry) bool
+	// Write copies entry from src; prev is its earlier copy, if any,
+	// which the new one replaces
+	Write(ctx context.Context, src Source, entry Entry, prev *ManifestEntry) (Stored, error)
+}
+
+// Finisher is implemented by destinations with work to do once a run's
+// manifest is saved, such as uploading a copy of it next to the files.
+type Finisher interface {
+	Finish(ctx context.Context, m *Manifest) error
+}
+
+// Stored describes a file a destination wrote.
+type Stored struct {
+	Size    int64 // of the stored copy
+	Bytes   int64 // transferred during this run
+	Resumed bool
+	Ref     string // the destination's ID for the copy, if it has one
+}
+
+// Dir is a directory on a local disk or mounted share. The manifest lives
+// inside it, next to the files it describes, so moving the disk moves its
+// history too.
+type Dir string
+
+// Prepare requires the directory to exist: an unmounted NAS share shows
+// up as an error instead of silently filling the local disk.
+func (d Dir) Prepare(ctx context.Context) error {
+	info, err := os.Stat(string(d))
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("destination %s is not available (is the share mounted?)", string(d))
+	}
+	if err := os.MkdirAll(filepath.Join(string(d), metaDir), 0755); err != nil {
+		return fmt.Errorf("destination is not writable: %w", err)
+	}
+	return nil
+}
+
+func (d Dir) LoadManifest(job string) (*Manifest, error) {
+	return LoadManifest(string(d), job)
+}
+
+func (d Dir) SaveManifest(m *Manifest) error {
+	return WriteManifest(ManifestPath(string(d), m.Job), m)
+}
+
+func (d Dir) Has(ctx context.Context, prev ManifestEntry) bool {
+	fi, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(prev.Path)))
+	return err == nil && fi.Size() == prev.Size
+}
+
+func (d Dir) Write(ctx context.Context, src Source, entry Entry, prev *ManifestEntry) (Stored, error) {
+	target := filepath.Join(string(d), filepath.FromSlash(entry.Path))
+	n, resumed, err := copyEntry(ctx, src, entry, target)
+	if err != nil {
+		return Stored{Bytes: n}, err
+	}
+	stored := Stored{Size: n, Bytes: n, Resumed: resumed}
+	if fi, err := os.Stat(target); err == nil {
+		stored.Size = fi.Size()
+	}
+	return stored, nil
+}
+
+// Engine runs backup jobs into destinations.
+type Engine struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewEngine() *Engine {
+	return &Engine{running: make(map[string]bool)}
+}
+
+// ErrAlreadyRunning is returned when a job is started twice.
+var ErrAlreadyRunning = errors.New("backup already running")
+
+// ManifestPath returns where a job's manifest lives in a destination.
+func ManifestPath(destination, job string) string {
+	return filepath.Join(destination, metaDir, SafeName(job)+".json")
+}
+
+// LoadManifest reads a job's manifest from a destination directory; a
+// missing one is empty.
+func LoadManifest(destination, job string) (*Manifest, error) {
+	return ReadManifest(ManifestPath(destination, job), job)
+}
+
+// ReadManifest reads a job's manifest from path; a missing one is empty.
+func ReadManifest(path, job string) (*Manifest, error) {
+	m := &Manifest{Job: job, Files: make(map[string]ManifestEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("corrupt manifest: %w", err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]ManifestEntry)
+	}
+	return m, nil
+}
+
+// WriteManifest saves m to path atomically.
+func WriteManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context whose runs call fn before each file with
+// how many of the source's files were handled so far, their number and
+// the path of the one about to be.
+func WithProgress(ctx context.Context, fn func(done, total int, path string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// IsRunning reports whether the job is currently running.
+func (e *Engine) IsRunning(job string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.running[job]
+}
+
+// Run copies new and changed files from src into the destination
+// directory, which must already exist.
+func (e *Engine) Run(ctx context.Context, job string, src Source, destination string) (*Stats, error) {
+	return e.RunTo(ctx, job, src, Dir(destination))
+}
+
+// RunTo copies new and changed files from src into dst.
+func (e *Engine) RunTo(ctx context.Context, job string, src Source, dst Destination) (*Stats, error) {
+	e.mu.Lock()
+	if e.running[job] {
+		e.mu.Unlock()
+		return nil, ErrAlreadyRunning
+	}
+	e.running[job] = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.running, job)
+		e.mu.Unlock()
+	}()
+
+	if err := dst.Prepare(ctx); err != nil {
+		return nil, err
+	}
+	manifest, err := dst.LoadManifest(job)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{Started: time.Now()}
+	entries, err := src.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source: %w", err)
+	}
+	stats.Scanned = len(entries)
+
+	seen := make(map[string]bool, len(entries))
+	sinceSave := 0
+	progress, _ := ctx.Value(progressKey{}).(func(int, int, string))
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			stats.Incomplete = true
+			break
+		}
+		if progress != nil {
+			progress(i, len(entries), entry.Path)
+		}
+		seen[entry.ID] = true
+		if entry.Fidelity != "" {
+			if stats.Fidelity == nil {
+				stats.Fidelity = make(map[string]int)
+			}
+			stats.Fidelity[entry.Fidelity]++
+		}
+		var prevCopy *ManifestEntry
+		if prev, ok := manifest.Files[entry.ID]; ok {
+			if prev.Version == entry.Version && prev.Path == entry.Path && dst.Has(ctx, prev) {
+				stats.Skipped++
+				continue
+			}
+			prevCopy = &prev
+		}
+
+		stored, err := dst.Write(ctx, src, entry, prevCopy)
+		if err != nil {
+			stats.Failed++
+			if len(stats.Errors) < 10 {
+				stats.Errors = append(stats.Errors, fmt.Sprintf("%s: %v", entry.Path, err))
+			}
+			logger.WarnCF("backup", "Transfer failed", map[string]interface{}{
+				"job":   job,
+				"path":  entry.Path,
+				"error": err.Error(),
+			})
+			continue
+		}
+		stats.Copied++
+		stats.Bytes += stored.Bytes
+		if stored.Resumed {
+			stats.Resumed++
+		}
+		manifest.Files[entry.ID] = ManifestEntry{
+			Path:     entry.Path,
+			Size:     stored.Size,
+			Version:  entry.Version,
+			Synced:   time.Now(),
+			Fidelity: entry.Fidelity,
+			Ref:      stored.Ref,
+		}
+
+		if sinceSave++; sinceSave >= manifestSaveEvery {
+			sinceSave = 0
+			if err := dst.SaveManifest(manifest); err != nil {
+				return nil, fmt.Errorf("failed to save manifest: %w", err)
+			}
+		}
+	}
+	if !stats.Incomplete {
+		for id := range manifest.Files {
+			if !seen[id] {
+				// Deleting from the source never deletes the backup copy
+				stats.GoneAtSrc++
+			}
+		}
+	}
+
+	stats.Finished = time.Now()
+	manifest.LastRun = stats
+	if err := dst.SaveManifest(manifest); err != nil {
+		return stats, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	if f, ok := dst.(Finisher); ok {
+		if err := f.Finish(ctx, manifest); err != nil {
+			return stats, fmt.Errorf("failed to finish backup: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+// copyEntry downloads into a .part file next to the target and renames it
+// when complete. A leftover .part from an interrupted run is continued
+// when the source supports offsets.
+func copyEntry(ctx context.Context, src Source, entry Entry, target string) (int64, bool, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, false, err
+	}
+	part := target + ".part"
+
+	var offset int64
+	if fi, err := os.Stat(part); err == nil && entry.Resumable && fi.Size() > 0 &&
+		(entry.Size < 0 || fi.Size() < entry.Size) {
+		offset = fi.Size()
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	rc, err := src.Open(ctx, entry, offset)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rc.Close()
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	n, err := io.Copy(f, rc)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Keep the .part file so the next run can resume
+		return n, false, err
+	}
+	if entry.Size >= 0 && offset+n != entry.Size {
+		return n, false, fmt.Errorf("size mismatch: got %d of %d bytes", offset+n, entry.Size)
+	}
+	if err := os.Rename(part, target); err != nil {
+		return n, false, err
+	}
+	return n, offset > 0, nil
+}
+
+// SafeName makes a single path component safe on common filesystems
+// (including SMB shares, which reject characters such as ':' and '?').
+func SafeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(strings.TrimSpace(name), ".")
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+	return name
+}
+
+// JoinSafe builds an entry path from untrusted components.
+func JoinSafe(parts ...string) string {
+	safe := make([]string, 0, len(parts))
+	for _, p := range parts {
+		safe = append(safe, SafeName(p))
+	}
+	return strings.Join(safe, "/")
+}
+
+// FormatStats renders a run for chat.
+func FormatStats(s *Stats) string {
+	if s == nil {
+		return "never run"
+	}
+	var sb strings.Builder
+	status := "completed"
+	if s.Incomplete {
+		status = "interrupted"
+	}
+	fmt.Fprintf(&sb, "%s %s (%s): %d copied (%s), %d unchanged, %d failed",
+		status, s.Finished.Format("2006-01-02 15:04"), s.Finished.Sub(s.Started).Round(time.Second),
+		s.Copied, formatBytes(s.Bytes), s.Skipped, s.Failed)
+	if s.Resumed > 0 {
+		fmt.Fprintf(&sb, ", %d resumed", s.Resumed)
+	}
+	if s.GoneAtSrc > 0 {
+		fmt.Fprintf(&sb, ", %d deleted at source (kept in backup)", s.GoneAtSrc)
+	}
+	notes := make([]string, 0, len(s.Fidelity))
+	for note := range s.Fidelity {
+		notes = append(notes, note)
+	}
+	sort.Strings(notes)
+	for _, note := range notes {
+		fmt.Fprintf(&sb, "\n  ~ %d %s", s.Fidelity[note], note)
+	}
+	for _, e := range s.Errors {
+		sb.WriteString("\n  ! " + e)
+	}
+	return sb.String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
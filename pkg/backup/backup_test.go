@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type memSource struct {
+	files   map[string]string
+	entries []Entry
+	offsets []int64
+}
+
+func (s *memSource) List(ctx context.Context) ([]Entry, error) {
+	return s.entries, nil
+}
+
+func (s *memSource) Open(ctx context.Context, entry Entry, offset int64) (io.ReadCloser, error) {
+	s.offsets = append(s.offsets, offset)
+	return io.NopCloser(strings.NewReader(s.files[entry.ID][offset:])), nil
+}
+
+// TestEngine_IncrementalRun verifies unchanged files are skipped and changed ones recopied
+func TestEngine_IncrementalRun(t *testing.T) {
+	dest := t.TempDir()
+	src := &memSource{
+		files: map[string]string{"a": "hello", "b": "world!"},
+		entries: []Entry{
+			{ID: "a", Path: "Docs/a.txt", Size: 5, Version: "1"},
+			{ID: "b", Path: "Docs/sub/b.txt", Size: 6, Version: "1"},
+		},
+	}
+	engine := NewEngine()
+
+	stats, err := engine.Run(context.Background(), "drive docs", src, dest)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if stats.Copied != 2 || stats.Bytes != 11 {
+		t.Errorf("Unexpected first run: %+v", stats)
+	}
+	data, _ := os.ReadFile(filepath.Join(dest, "Docs", "sub", "b.txt"))
+	if string(data) != "world!" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+
+	src.files["a"] = "HELLO"
+	src.entries[0].Version = "2"
+	src.entries = src.entries[:1]
+	stats, _ = engine.Run(context.Background(), "drive docs", src, dest)
+	if stats.Copied != 1 || stats.Skipped != 0 || stats.GoneAtSrc != 1 {
+		t.Errorf("Unexpected second run: %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "Docs", "sub", "b.txt")); err != nil {
+		t.Errorf("Files deleted at the source must stay in the backup")
+	}
+
+	stats, _ = engine.Run(context.Background(), "drive docs", src, dest)
+	if stats.Skipped != 1 || stats.Copied != 0 {
+		t.Errorf("Expected unchanged file to be skipped: %+v", stats)
+	}
+
+	m, _ := LoadManifest(dest, "drive docs")
+	if m.LastRun == nil || m.Files["a"].Version != "2" {
+		t.Errorf("Unexpected manifest: %+v", m)
+	}
+}
+
+// TestEngine_ResumesPartialTransfer verifies a leftover .part file is continued from its size
+func TestEngine_ResumesPartialTransfer(t *testing.T) {
+	dest := t.TempDir()
+	src := &memSource{
+		files:   map[string]string{"v": "0123456789"},
+		entries: []Entry{{ID: "v", Path: "video.mp4", Size: 10, Version: "1", Resumable: true}},
+	}
+	os.WriteFile(filepath.Join(dest, "video.mp4.part"), []byte("0123"), 0644)
+
+	stats, err := NewEngine().Run(context.Background(), "videos", src, dest)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if stats.Resumed != 1 || src.offsets[0] != 4 {
+		t.Errorf("Expected a resume from byte 4: %+v offsets=%v", stats, src.offsets)
+	}
+	data, _ := os.ReadFile(filepath.Join(dest, "video.mp4"))
+	if string(data) != "0123456789" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+}
+
+// TestEngine_MissingDestination verifies an unmounted share is reported instead of created
+func TestEngine_MissingDestination(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "nas")
+	_, err := NewEngine().Run(context.Background(), "job", &memSource{}, dest)
+	if err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("Expected destination error, got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("Destination must not be created")
+	}
+}
+
+// TestJoinSafe verifies untrusted names cannot escape the backup root
+func TestJoinSafe(t *testing.T) {
+	if got := JoinSafe("..", "a/b", "what?.txt"); got != "_/a_b/what_.txt" {
+		t.Errorf("JoinSafe = %q", got)
+	}
+}
@@ -11,6 +11,11 @@ type MessageBus struct {
 	handlers map[string]MessageHandler
 	closed   bool
 	mu       sync.RWMutex
+
+	onInbound  func(InboundMessage)
+	onOutbound func(OutboundMessage)
+	filter     func(OutboundMessage) (OutboundMessage, bool)
+	caps       func(channel string) (Capabilities, bool)
 }
 
 func NewMessageBus() *MessageBus {
@@ -27,6 +32,9 @@ func (mb *MessageBus) PublishInbound(msg InboundMessage) {
 	if mb.closed {
 		return
 	}
+	if mb.onInbound != nil {
+		mb.onInbound(msg)
+	}
 	mb.inbound <- msg
 }
 
@@ -40,11 +48,25 @@ func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool)
 }
 
 func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
+	mb.mu.RLock()
+	filter := mb.filter
+	mb.mu.RUnlock()
+	// Outside the lock: a filter may publish, e.g. to release held messages
+	if filter != nil {
+		var ok bool
+		if msg, ok = filter(msg); !ok {
+			return
+		}
+	}
+
 	mb.mu.RLock()
 	defer mb.mu.RUnlock()
 	if mb.closed {
 		return
 	}
+	if mb.onOutbound != nil {
+		mb.onOutbound(msg)
+	}
 	mb.outbound <- msg
 }
 
@@ -57,6 +79,84 @@ func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, b
 	}
 }
 
+// QueueDepths returns how many messages are waiting in each direction.
+func (mb *MessageBus) QueueDepths() (inbound, outbound int) {
+	return len(mb.inbound), len(mb.outbound)
+}
+
+// DrainInbound removes and returns the messages waiting for the agent,
+// without blocking.
+func (mb *MessageBus) DrainInbound() []InboundMessage {
+	var msgs []InboundMessage
+	for {
+		select {
+		case msg, ok := <-mb.inbound:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// DrainOutbound removes and returns the replies waiting to be sent,
+// without blocking.
+func (mb *MessageBus) DrainOutbound() []OutboundMessage {
+	var msgs []OutboundMessage
+	for {
+		select {
+		case msg, ok := <-mb.outbound:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// Observe registers functions that see every published message, for
+// observers such as the admin dashboard. Either may be nil.
+func (mb *MessageBus) Observe(inbound func(InboundMessage), outbound func(OutboundMessage)) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.onInbound = inbound
+	mb.onOutbound = outbound
+}
+
+// SetOutboundFilter sets a function every outbound message passes
+// through before it is queued. It may change the message or drop it by
+// returning false.
+func (mb *MessageBus) SetOutboundFilter(filter func(OutboundMessage) (OutboundMessage, bool)) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.filter = filter
+}
+
+// SetCapabilities sets how to look up what a channel can deliver; the
+// channel manager registers itself here.
+func (mb *MessageBus) SetCapabilities(lookup func(channel string) (Capabilities, bool)) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.caps = lookup
+}
+
+// Capabilities returns what channel can deliver. ok is false when no
+// channel manager is running or it does not know the channel, as for the
+// CLI.
+func (mb *MessageBus) Capabilities(channel string) (Capabilities, bool) {
+	mb.mu.RLock()
+	lookup := mb.caps
+	mb.mu.RUnlock()
+	if lookup == nil {
+		return Capabilities{}, false
+	}
+	return lookup(channel)
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
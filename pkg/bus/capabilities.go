@@ -0,0 +1,58 @@
+package bus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown flavors a channel renders.
+const (
+	// MarkdownNone is plain text: markup shows as typed
+	MarkdownNone = ""
+	// MarkdownCommon is **bold**, `code`, [text](url) links and lists
+	MarkdownCommon = "markdown"
+	// MarkdownSlack is Slack's mrkdwn: *bold*, _italic_, <url|text> links
+	MarkdownSlack = "mrkdwn"
+	// MarkdownWhatsApp is *bold*, _italic_, ~strike~ and ```code```
+	MarkdownWhatsApp = "whatsapp"
+)
+
+// Capabilities describes what a channel can deliver, so tools and the
+// prompt do not assume every chat app is Telegram.
+type Capabilities struct {
+	// MaxFileBytes is the largest attachment the channel sends
+	MaxFileBytes int64
+	// MediaTypes are the MIME types of attachments it sends; none means
+	// the channel only sends text
+	MediaTypes []string
+	// Markdown is the formatting the channel renders (see MarkdownNone...)
+	Markdown string
+	// Buttons is set when messages can carry reply buttons
+	Buttons bool
+	// Edits is set when a message can be edited in place, which progress
+	// updates need
+	Edits bool
+}
+
+// CanSend reports why an attachment of mimeType and size cannot be sent,
+// or nil if it can.
+func (c Capabilities) CanSend(mimeType string, size int64) error {
+	if len(c.MediaTypes) == 0 {
+		return fmt.Errorf("this chat can only receive text")
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	supported := false
+	for _, t := range c.MediaTypes {
+		if strings.EqualFold(t, strings.TrimSpace(mimeType)) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("this chat cannot receive %s files (it takes %s)", mimeType, strings.Join(c.MediaTypes, ", "))
+	}
+	if c.MaxFileBytes > 0 && size > c.MaxFileBytes {
+		return fmt.Errorf("%.1f MB is over this chat's %.0f MB limit", float64(size)/(1<<20), float64(c.MaxFileBytes)/(1<<20))
+	}
+	return nil
+}
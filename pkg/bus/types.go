@@ -14,6 +14,21 @@ type OutboundMessage struct {
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// Voice asks the channel to deliver Content as a voice note when it can.
+	Voice bool `json:"voice,omitempty"`
+	// Media holds local files (images, documents) to send with Content,
+	// on channels that can send them; Content may then be empty.
+	Media []string `json:"media,omitempty"`
+	// Progress marks a status update (an upload at 40%) that replaces the
+	// previous one in place. Channels that cannot edit messages drop it.
+	Progress bool `json:"progress,omitempty"`
+	// Choices are options the user is asked to pick from; channels with
+	// buttons show one per choice, and a tap answers with its number.
+	// Content lists them numbered for the others.
+	Choices []string `json:"choices,omitempty"`
+	// TraceParent links the send to the agent round that produced it (W3C
+	// traceparent), when tracing is on.
+	TraceParent string `json:"trace_parent,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
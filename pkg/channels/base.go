@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/sipeed/picoclaw/pkg/artifacts"
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 type Channel interface {
@@ -17,12 +19,26 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// ProgressChannel is implemented by channels that can show progress
+// messages (see bus.OutboundMessage.Progress) by editing one message in
+// place; the final reply then takes its place.
+type ProgressChannel interface {
+	SendProgress(ctx context.Context, msg bus.OutboundMessage) error
+}
+
+// MediaChannel is implemented by channels that can send the files in
+// bus.OutboundMessage.Media. Others get only the text.
+type MediaChannel interface {
+	SendMedia(ctx context.Context, msg bus.OutboundMessage) error
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
 	running   bool
 	name      string
 	allowList []string
+	artifacts *artifacts.Store
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -82,6 +98,11 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 	return false
 }
 
+// SetArtifacts makes received media available to tools as artifacts.
+func (c *BaseChannel) SetArtifacts(store *artifacts.Store) {
+	c.artifacts = store
+}
+
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
 	if !c.IsAllowed(senderID) {
 		return
@@ -90,6 +111,26 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 	// Build session key: channel:chatID
 	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
 
+	// Channels delete their downloads once the message is handed off, so
+	// keep a copy the agent's tools can still open by reference
+	if c.artifacts != nil && len(media) > 0 {
+		stored := make([]string, 0, len(media))
+		for _, path := range media {
+			a, err := c.artifacts.Add(path, "", sessionKey, 0)
+			if err != nil {
+				logger.WarnCF(c.name, "Failed to store received file", map[string]interface{}{
+					"file":  path,
+					"error": err.Error(),
+				})
+				stored = append(stored, path)
+				continue
+			}
+			stored = append(stored, a.Path)
+			content += "\n[attachment " + a.String() + "]"
+		}
+		media = stored
+	}
+
 	msg := bus.InboundMessage{
 		Channel:    c.name,
 		SenderID:   senderID,
@@ -100,6 +141,7 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 		Metadata:   metadata,
 	}
 
+	messagesReceived.Inc(c.name)
 	c.bus.PublishInbound(msg)
 }
 
@@ -0,0 +1,51 @@
+package channels
+
+import "github.com/sipeed/picoclaw/pkg/bus"
+
+// CapableChannel is implemented by channels that describe what they can
+// deliver themselves, overriding the defaults below.
+type CapableChannel interface {
+	Capabilities() bus.Capabilities
+}
+
+// defaultCapabilities are the limits of each chat app. Media types only
+// apply to channels that implement MediaChannel, and edits to those that
+// implement ProgressChannel.
+var defaultCapabilities = map[string]bus.Capabilities{
+	// Bot API photos: 10 MB, JPEG, PNG or WebP; other files go as
+	// documents; Markdown is sent as HTML; choices become inline buttons
+	"telegram": {MaxFileBytes: 10 << 20, MediaTypes: []string{"image/jpeg", "image/png", "image/webp", "application/pdf", "text/markdown", "text/plain"}, Markdown: bus.MarkdownCommon, Buttons: true},
+	"whatsapp": {MaxFileBytes: 16 << 20, MediaTypes: []string{"image/jpeg", "image/png"}, Markdown: bus.MarkdownWhatsApp},
+	"discord":  {MaxFileBytes: 10 << 20, MediaTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"}, Markdown: bus.MarkdownCommon},
+	"slack":    {MaxFileBytes: 1 << 30, MediaTypes: []string{"image/jpeg", "image/png", "image/gif"}, Markdown: bus.MarkdownSlack},
+	"dingtalk": {Markdown: bus.MarkdownCommon},
+	"line":     {MaxFileBytes: 10 << 20, MediaTypes: []string{"image/jpeg", "image/png"}},
+	"feishu":   {},
+	"qq":       {},
+	"onebot":   {},
+	"maixcam":  {},
+}
+
+// Capabilities returns what the named channel can deliver, or false if
+// it is not running here.
+func (m *Manager) Capabilities(name string) (bus.Capabilities, bool) {
+	m.mu.RLock()
+	channel, ok := m.channels[name]
+	m.mu.RUnlock()
+	if !ok {
+		return bus.Capabilities{}, false
+	}
+	return capabilitiesOf(name, channel), true
+}
+
+func capabilitiesOf(name string, channel Channel) bus.Capabilities {
+	if cc, ok := channel.(CapableChannel); ok {
+		return cc.Capabilities()
+	}
+	caps := defaultCapabilities[name]
+	if _, ok := channel.(MediaChannel); !ok {
+		caps.MediaTypes, caps.MaxFileBytes = nil, 0
+	}
+	_, caps.Edits = channel.(ProgressChannel)
+	return caps
+}
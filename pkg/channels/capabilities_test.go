@@ -0,0 +1,49 @@
+package channels
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type textChannel struct{ *BaseChannel }
+
+func (textChannel) Start(ctx context.Context) error                         { return nil }
+func (textChannel) Stop(ctx context.Context) error                          { return nil }
+func (textChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+
+type mediaChannel struct{ textChannel }
+
+func (mediaChannel) SendMedia(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+
+func TestManagerCapabilities(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	m := &Manager{channels: map[string]Channel{}, bus: msgBus}
+	msgBus.SetCapabilities(m.Capabilities)
+	m.RegisterChannel("slack", textChannel{NewBaseChannel("slack", nil, msgBus, nil)})
+	m.RegisterChannel("telegram", mediaChannel{textChannel{NewBaseChannel("telegram", nil, msgBus, nil)}})
+
+	slack, ok := msgBus.Capabilities("slack")
+	if !ok || slack.Markdown != bus.MarkdownSlack || len(slack.MediaTypes) != 0 || slack.Edits {
+		t.Errorf("slack: %+v", slack)
+	}
+	if err := slack.CanSend("image/png", 100); err == nil {
+		t.Error("text-only channel accepted an image")
+	}
+
+	telegram, _ := msgBus.Capabilities("telegram")
+	if err := telegram.CanSend("image/png", 1<<20); err != nil {
+		t.Errorf("telegram refused a small PNG: %v", err)
+	}
+	if err := telegram.CanSend("image/png", 20<<20); err == nil {
+		t.Error("telegram accepted a 20 MB photo")
+	}
+	if err := telegram.CanSend("image/bmp", 100); err == nil {
+		t.Error("telegram accepted a BMP")
+	}
+
+	if _, ok := msgBus.Capabilities("discord"); ok {
+		t.Error("capabilities reported for a channel that is not running")
+	}
+}
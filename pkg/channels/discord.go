@@ -327,7 +327,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 				localFiles = append(localFiles, localPath)
 
 				transcribedText := ""
-				if c.transcriber != nil && c.transcriber.IsAvailable() {
+				if c.transcriber != nil && c.transcriber.AvailableFor("discord", m.ChannelID) {
 					ctx, cancel := context.WithTimeout(c.getContext(), transcriptionTimeout)
 					result, err := c.transcriber.Transcribe(ctx, localPath)
 					cancel() // 立即释放context资源，避免在for循环中泄漏
@@ -10,12 +10,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 
+	"github.com/sipeed/picoclaw/pkg/artifacts"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 )
 
 type Manager struct {
@@ -23,6 +26,7 @@ type Manager struct {
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
+	watchdog     *Watchdog
 	mu           sync.RWMutex
 }
 
@@ -40,6 +44,7 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 	if err := m.initChannels(); err != nil {
 		return nil, err
 	}
+	messageBus.SetCapabilities(m.Capabilities)
 
 	return m, nil
 }
@@ -273,12 +278,52 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
+			if msg.Progress {
+				// Progress is best effort: edited in place or not shown
+				if pc, ok := channel.(ProgressChannel); ok {
+					if err := pc.SendProgress(ctx, msg); err != nil {
+						logger.DebugCF("channels", "Progress update failed", map[string]interface{}{
+							"channel": msg.Channel,
+							"error":   err.Error(),
+						})
+					}
+				}
+				continue
+			}
+
+			if len(msg.Media) > 0 {
+				if mc, ok := channel.(MediaChannel); !ok {
+					logger.WarnCF("channels", "Channel cannot send media, sending only the text", map[string]interface{}{
+						"channel": msg.Channel,
+						"files":   len(msg.Media),
+					})
+				} else {
+					msg.Media = m.prepareMedia(msg.Channel, msg.Media)
+					if err := mc.SendMedia(ctx, msg); err != nil {
+						logger.ErrorCF("channels", "Error sending media to channel", map[string]interface{}{
+							"channel": msg.Channel,
+							"error":   err.Error(),
+						})
+					}
+				}
+				if msg.Content == "" {
+					continue
+				}
+			}
+
+			sendCtx, span := tracing.StartKind(tracing.WithTraceParent(ctx, msg.TraceParent), "channel.send", tracing.KindClient,
+				tracing.String("channel", msg.Channel), tracing.Int("length", len(msg.Content)))
+			if err := channel.Send(sendCtx, msg); err != nil {
+				span.RecordError(err)
+				messagesSent.Inc(msg.Channel, "error")
 				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
 					"channel": msg.Channel,
 					"error":   err.Error(),
 				})
+			} else {
+				messagesSent.Inc(msg.Channel, "ok")
 			}
+			span.End()
 		}
 	}
 }
@@ -290,6 +335,57 @@ func (m *Manager) GetChannel(name string) (Channel, bool) {
 	return channel, ok
 }
 
+// snapshot copies the channel map, so callers can work on channels
+// without holding the lock.
+func (m *Manager) snapshot() map[string]Channel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	channels := make(map[string]Channel, len(m.channels))
+	for name, ch := range m.channels {
+		channels[name] = ch
+	}
+	return channels
+}
+
+// StartWatchdog supervises the channels until ctx is done; see Watchdog.
+func (m *Manager) StartWatchdog(ctx context.Context, opts WatchdogOptions) {
+	w := NewWatchdog(m, m.bus, opts)
+	m.mu.Lock()
+	m.watchdog = w
+	m.mu.Unlock()
+	go w.Run(ctx)
+}
+
+// Health reports each channel's connection health: the watchdog's view
+// when it runs, otherwise whether each channel is running.
+func (m *Manager) Health() []ChannelHealth {
+	m.mu.RLock()
+	w := m.watchdog
+	m.mu.RUnlock()
+	if w != nil {
+		return w.Status()
+	}
+	channels := m.snapshot()
+	out := make([]ChannelHealth, 0, len(channels))
+	for name, ch := range channels {
+		out = append(out, runningHealth(name, ch))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetArtifacts hands the artifact store to every channel, so files users
+// send are kept for tools to use.
+func (m *Manager) SetArtifacts(store *artifacts.Store) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, channel := range m.channels {
+		if c, ok := channel.(interface{ SetArtifacts(*artifacts.Store) }); ok {
+			c.SetArtifacts(store)
+		}
+	}
+}
+
 func (m *Manager) GetStatus() map[string]interface{} {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -0,0 +1,41 @@
+package channels
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// prepareMedia adapts outgoing images to what the channel takes: ones it
+// would refuse for their type or size are replaced by a resized JPEG
+// copy, and with images.strip_location the GPS position is removed from
+// JPEG photos. Files that cannot be adapted go as they are, for the
+// channel to report.
+func (m *Manager) prepareMedia(name string, media []string) []string {
+	caps, _ := m.Capabilities(name)
+	dir := filepath.Join(utils.MediaDir(), "outgoing")
+	out := make([]string, 0, len(media))
+	for _, path := range media {
+		if m.config.Images.StripLocation {
+			if stripped, err := imaging.StripLocation(path, dir); err == nil {
+				path = stripped
+			}
+		}
+		if ct, err := imaging.ContentType(path); err == nil && strings.HasPrefix(ct, "image/") {
+			if fitted, err := imaging.Fit(path, caps, dir); err == nil {
+				path = fitted
+			} else {
+				logger.DebugCF("channels", "Image left as it is", map[string]interface{}{
+					"channel": name,
+					"file":    filepath.Base(path),
+					"reason":  err.Error(),
+				})
+			}
+		}
+		out = append(out, path)
+	}
+	return out
+}
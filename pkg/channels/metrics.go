@@ -0,0 +1,14 @@
+package channels
+
+import "github.com/sipeed/picoclaw/pkg/metrics"
+
+var (
+	messagesReceived = metrics.NewCounter("picoclaw_messages_received_total",
+		"Messages received from users, by channel.", "channel")
+	messagesSent = metrics.NewCounter("picoclaw_messages_sent_total",
+		"Messages delivered to channels, by channel and result.", "channel", "result")
+	channelUp = metrics.NewGauge("picoclaw_channel_up",
+		"Whether the channel passed its last health check (1) or not (0).", "channel")
+	channelReconnects = metrics.NewCounter("picoclaw_channel_reconnects_total",
+		"Channel restarts by the watchdog after a failed health check.", "channel")
+)
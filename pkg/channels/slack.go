@@ -253,7 +253,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 			localFiles = append(localFiles, localPath)
 			mediaPaths = append(mediaPaths, localPath)
 
-			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
+			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.AvailableFor("slack", chatID) {
 				ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
 				defer cancel()
 				result, err := c.transcriber.Transcribe(ctx, localPath)
@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +22,8 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/tools"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -31,8 +35,18 @@ type TelegramChannel struct {
 	config       *config.Config
 	chatIDs      map[string]int64
 	transcriber  *voice.GroqTranscriber
+	synthesizer  *voice.SpeechSynthesizer
+	ocr          ocr.Engine
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
+	topics       sync.Map // chatID of a forum topic -> topic name
+
+	inlineHandler InlineQueryHandler
+	inline        inlineState
+	pollVotes     func(tools.PollVote)
+
+	pollMu   sync.Mutex
+	stopPoll context.CancelFunc // ends the long poll Start began
 }
 
 type thinkingCancel struct {
@@ -84,18 +98,34 @@ func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 	c.transcriber = transcriber
 }
 
+// SetOCR enables text recognition on received photos; the text is added to
+// the message so tools can act on photographed documents.
+func (c *TelegramChannel) SetOCR(engine ocr.Engine) {
+	c.ocr = engine
+}
+
+// SetSynthesizer enables voice-note replies for chats that asked for them.
+func (c *TelegramChannel) SetSynthesizer(synthesizer *voice.SpeechSynthesizer) {
+	c.synthesizer = synthesizer
+}
+
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
-	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
+	// Stop cancels pollCtx, so the watchdog can restart the channel
+	// without leaving the old poll running
+	pollCtx, cancel := context.WithCancel(ctx)
+	updates, err := c.bot.UpdatesViaLongPolling(pollCtx, &telego.GetUpdatesParams{
 		Timeout: 30,
 	})
 	if err != nil {
+		cancel()
 		return fmt.Errorf("failed to start long polling: %w", err)
 	}
 
 	bh, err := telegohandler.NewBotHandler(c.bot, updates)
 	if err != nil {
+		cancel()
 		return fmt.Errorf("failed to create bot handler: %w", err)
 	}
 
@@ -119,6 +149,28 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handlePick(ctx, query)
+	}, th.CallbackDataPrefix(pickPrefix))
+
+	bh.HandlePollAnswer(func(ctx *th.Context, answer telego.PollAnswer) error {
+		c.handlePollAnswer(answer)
+		return nil
+	}, th.AnyPollAnswer())
+
+	if c.config.Channels.Telegram.InlineQueries {
+		bh.HandleInlineQuery(func(ctx *th.Context, query telego.InlineQuery) error {
+			return c.handleInlineQuery(ctx, query)
+		}, th.AnyInlineQuery())
+	}
+
+	c.pollMu.Lock()
+	if c.stopPoll != nil {
+		c.stopPoll()
+	}
+	c.stopPoll = cancel
+	c.pollMu.Unlock()
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]interface{}{
 		"username": c.bot.Username(),
@@ -127,24 +179,45 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 	go bh.Start()
 
 	go func() {
-		<-ctx.Done()
+		<-pollCtx.Done()
 		bh.Stop()
 	}()
 
 	return nil
 }
+
 func (c *TelegramChannel) Stop(ctx context.Context) error {
 	logger.InfoC("telegram", "Stopping Telegram bot...")
+	c.pollMu.Lock()
+	if c.stopPoll != nil {
+		c.stopPoll()
+		c.stopPoll = nil
+	}
+	c.pollMu.Unlock()
 	c.setRunning(false)
 	return nil
 }
 
+// CheckHealth asks the Bot API who the bot is, which fails when the token
+// was revoked or Telegram cannot be reached.
+func (c *TelegramChannel) CheckHealth(ctx context.Context) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("not running")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if _, err := c.bot.GetMe(ctx); err != nil {
+		return fmt.Errorf("getMe failed: %w", err)
+	}
+	return nil
+}
+
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
 		return fmt.Errorf("telegram bot not running")
 	}
 
-	chatID, err := parseChatID(msg.ChatID)
+	chatID, threadID, err := parseChatID(msg.ChatID)
 	if err != nil {
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
@@ -157,6 +230,16 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.stopThinking.Delete(msg.ChatID)
 	}
 
+	if msg.Voice && c.synthesizer != nil && c.synthesizer.IsAvailable() {
+		err := c.sendVoice(ctx, chatID, threadID, msg)
+		if err == nil {
+			return nil
+		}
+		logger.ErrorCF("telegram", "Voice reply failed, falling back to text", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
 	htmlContent := markdownToTelegramHTML(msg.Content)
 
 	// Try to edit placeholder
@@ -164,6 +247,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.placeholders.Delete(msg.ChatID)
 		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
 		editMsg.ParseMode = telego.ModeHTML
+		editMsg.ReplyMarkup = choiceKeyboard(msg.Choices)
 
 		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
 			return nil
@@ -173,6 +257,10 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 
 	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
 	tgMsg.ParseMode = telego.ModeHTML
+	tgMsg.MessageThreadID = threadID
+	if keyboard := choiceKeyboard(msg.Choices); keyboard != nil {
+		tgMsg.ReplyMarkup = keyboard
+	}
 
 	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
 		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
@@ -186,6 +274,131 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
+// SendProgress shows a progress update in the chat's "Thinking..."
+// placeholder, or in a new message that becomes the placeholder, so later
+// updates and the reply edit it rather than piling up.
+func (c *TelegramChannel) SendProgress(ctx context.Context, msg bus.OutboundMessage) error {
+	chatID, threadID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
+		_, err := c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), msg.Content))
+		return err
+	}
+	sent, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), msg.Content).WithMessageThreadID(threadID))
+	if err != nil {
+		return err
+	}
+	c.placeholders.Store(msg.ChatID, sent.MessageID)
+	return nil
+}
+
+// SendMedia sends each image in msg.Media as a photo and any other file
+// as a document.
+func (c *TelegramChannel) SendMedia(ctx context.Context, msg bus.OutboundMessage) error {
+	chatID, threadID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	for _, path := range msg.Media {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jpg", ".jpeg", ".png", ".webp":
+			_, err = c.bot.SendPhoto(ctx, tu.Photo(tu.ID(chatID), tu.File(f)).WithMessageThreadID(threadID))
+		default:
+			_, err = c.bot.SendDocument(ctx, tu.Document(tu.ID(chatID), tu.File(f)).WithMessageThreadID(threadID))
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to send %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// sendVoice delivers the reply as a synthesized voice note, replacing the
+// "Thinking..." placeholder.
+func (c *TelegramChannel) sendVoice(ctx context.Context, chatID int64, threadID int, msg bus.OutboundMessage) error {
+	audioPath, err := c.synthesizer.Synthesize(ctx, msg.Content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(audioPath)
+
+	audio, err := os.Open(audioPath)
+	if err != nil {
+		return fmt.Errorf("failed to open audio: %w", err)
+	}
+	defer audio.Close()
+
+	if _, err := c.bot.SendVoice(ctx, tu.Voice(tu.ID(chatID), tu.File(audio)).WithMessageThreadID(threadID)); err != nil {
+		return fmt.Errorf("failed to send voice: %w", err)
+	}
+
+	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
+		c.placeholders.Delete(msg.ChatID)
+		c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), pID.(int)))
+	}
+	return nil
+}
+
+// pickPrefix starts the callback data of choice buttons, followed by the
+// choice's number.
+const pickPrefix = "pick:"
+
+// choiceKeyboard puts each choice on a button of its own, nil for none.
+func choiceKeyboard(choices []string) *telego.InlineKeyboardMarkup {
+	if len(choices) == 0 {
+		return nil
+	}
+	rows := make([][]telego.InlineKeyboardButton, len(choices))
+	for i, choice := range choices {
+		rows[i] = tu.InlineKeyboardRow(tu.InlineKeyboardButton(utils.Truncate(choice, 60)).WithCallbackData(fmt.Sprintf("%s%d", pickPrefix, i+1)))
+	}
+	return tu.InlineKeyboard(rows...)
+}
+
+// handlePick takes a tap on a choice button as the user replying with the
+// choice's number, and removes the buttons so it is not picked twice.
+func (c *TelegramChannel) handlePick(ctx context.Context, query telego.CallbackQuery) error {
+	c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID))
+	senderID := fmt.Sprintf("%d", query.From.ID)
+	if query.From.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", query.From.ID, query.From.Username)
+	}
+	if !c.IsAllowed(senderID) || query.Message == nil || !query.Message.IsAccessible() {
+		return nil
+	}
+	message := query.Message.Message()
+	threadID := 0
+	if message.IsTopicMessage {
+		threadID = message.MessageThreadID
+	}
+	chatIDStr := telegramChatID(message.Chat.ID, threadID)
+	c.bot.EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+		ChatID:    tu.ID(message.Chat.ID),
+		MessageID: message.MessageID,
+	})
+
+	metadata := map[string]string{
+		"message_id": fmt.Sprintf("%d", message.MessageID),
+		"user_id":    fmt.Sprintf("%d", query.From.ID),
+		"username":   query.From.Username,
+		"first_name": query.From.FirstName,
+		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
+	}
+	if threadID != 0 {
+		metadata["topic_id"] = fmt.Sprintf("%d", threadID)
+		metadata["topic"] = c.topicName(chatIDStr, message)
+	}
+	c.HandleMessage(fmt.Sprintf("%d", query.From.ID), chatIDStr, strings.TrimPrefix(query.Data, pickPrefix), nil, metadata)
+	return nil
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -211,6 +424,17 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 
 	chatID := message.Chat.ID
 	c.chatIDs[senderID] = chatID
+	// Each topic of a forum group is a conversation of its own
+	threadID := 0
+	if message.IsTopicMessage {
+		threadID = message.MessageThreadID
+	}
+	chatIDStr := telegramChatID(chatID, threadID)
+	topic := c.topicName(chatIDStr, message)
+	if message.ForumTopicCreated != nil || message.ForumTopicEdited != nil {
+		// Only a topic being created or renamed; nothing to answer
+		return nil
+	}
 
 	content := ""
 	mediaPaths := []string{}
@@ -249,6 +473,15 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 				content += "\n"
 			}
 			content += "[image: photo]"
+			if c.ocr != nil && c.ocr.IsAvailable() {
+				if text, err := c.ocr.Recognize(ctx, photoPath); err != nil {
+					logger.ErrorCF("telegram", "Photo OCR failed", map[string]interface{}{
+						"error": err.Error(),
+					})
+				} else if text != "" {
+					content += fmt.Sprintf("\n[image text: %s]", utils.Truncate(text, 4000))
+				}
+			}
 		}
 	}
 
@@ -259,7 +492,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 			mediaPaths = append(mediaPaths, voicePath)
 
 			transcribedText := ""
-			if c.transcriber != nil && c.transcriber.IsAvailable() {
+			if c.transcriber != nil && c.transcriber.AvailableFor("telegram", chatIDStr) {
 				ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 				defer cancel()
 
@@ -317,12 +550,12 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 
 	logger.DebugCF("telegram", "Received message", map[string]interface{}{
 		"sender_id": senderID,
-		"chat_id":   fmt.Sprintf("%d", chatID),
+		"chat_id":   chatIDStr,
 		"preview":   utils.Truncate(content, 50),
 	})
 
 	// Thinking indicator
-	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
+	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping).WithMessageThreadID(threadID))
 	if err != nil {
 		logger.ErrorCF("telegram", "Failed to send chat action", map[string]interface{}{
 			"error": err.Error(),
@@ -330,7 +563,6 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	}
 
 	// Stop any previous thinking animation
-	chatIDStr := fmt.Sprintf("%d", chatID)
 	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
 		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
 			cf.Cancel()
@@ -341,7 +573,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	_, thinkCancel := context.WithTimeout(ctx, 5*time.Minute)
 	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
 
-	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭"))
+	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭").WithMessageThreadID(threadID))
 	if err == nil {
 		pID := pMsg.MessageID
 		c.placeholders.Store(chatIDStr, pID)
@@ -354,8 +586,15 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
 	}
+	if message.Voice != nil {
+		metadata["voice_note"] = "true"
+	}
+	if threadID != 0 {
+		metadata["topic_id"] = fmt.Sprintf("%d", threadID)
+		metadata["topic"] = topic
+	}
 
-	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), chatIDStr, content, mediaPaths, metadata)
 	return nil
 }
 
@@ -398,10 +637,50 @@ func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string)
 	return c.downloadFileWithInfo(file, ext)
 }
 
-func parseChatID(chatIDStr string) (int64, error) {
-	var id int64
-	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
-	return id, err
+// telegramChatID is the chat ID picoclaw knows a conversation by: the
+// chat's ID, followed by "/" and the topic's ID in a forum group, so
+// each topic keeps its own session and replies and schedules land in it.
+func telegramChatID(chatID int64, threadID int) string {
+	if threadID == 0 {
+		return fmt.Sprintf("%d", chatID)
+	}
+	return fmt.Sprintf("%d/%d", chatID, threadID)
+}
+
+// parseChatID splits a chat ID made by telegramChatID; threadID is 0 for
+// chats without topics.
+func parseChatID(chatIDStr string) (chatID int64, threadID int, err error) {
+	id, topic, hasTopic := strings.Cut(chatIDStr, "/")
+	if chatID, err = strconv.ParseInt(strings.TrimSpace(id), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if hasTopic {
+		if threadID, err = strconv.Atoi(strings.TrimSpace(topic)); err != nil || threadID <= 0 {
+			return 0, 0, fmt.Errorf("invalid topic ID %q", topic)
+		}
+	}
+	return chatID, threadID, nil
+}
+
+// topicName remembers the names of forum topics as the service messages
+// that create or rename them go by, and returns the topic's name. Messages
+// in a topic reply to the one that created it, so its name is found
+// without a lookup.
+func (c *TelegramChannel) topicName(chatID string, message *telego.Message) string {
+	switch {
+	case message.ForumTopicCreated != nil:
+		c.topics.Store(chatID, message.ForumTopicCreated.Name)
+	case message.ForumTopicEdited != nil && message.ForumTopicEdited.Name != "":
+		c.topics.Store(chatID, message.ForumTopicEdited.Name)
+	case message.ReplyToMessage != nil && message.ReplyToMessage.ForumTopicCreated != nil:
+		if _, known := c.topics.Load(chatID); !known {
+			c.topics.Store(chatID, message.ReplyToMessage.ForumTopicCreated.Name)
+		}
+	}
+	if name, ok := c.topics.Load(chatID); ok {
+		return name.(string)
+	}
+	return ""
 }
 
 func markdownToTelegramHTML(text string) string {
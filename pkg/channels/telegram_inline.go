@@ -0,0 +1,166 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// InlineQueryHandler answers an inline query ("@botname question" typed in
+// any chat). senderID uses the same "id|username" form as inbound messages.
+type InlineQueryHandler func(ctx context.Context, senderID, query string) (string, error)
+
+const (
+	// inlineMinQueryLen skips half-typed queries; Telegram sends an update
+	// for every keystroke.
+	inlineMinQueryLen = 3
+	// inlineDebounce is how long a query must stay unchanged before it is
+	// sent to the model.
+	inlineDebounce = 700 * time.Millisecond
+	inlineTimeout  = 10 * time.Second
+	// inlineCacheSeconds lets Telegram reuse the answer for an identical
+	// query from the same user.
+	inlineCacheSeconds = 60
+)
+
+// inlineState tracks the latest inline query per user so that superseded
+// keystrokes are dropped instead of each costing a model call.
+type inlineState struct {
+	mu     sync.Mutex
+	latest map[int64]string // user ID -> inline query ID
+}
+
+func (s *inlineState) mark(userID int64, queryID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest == nil {
+		s.latest = make(map[int64]string)
+	}
+	s.latest[userID] = queryID
+}
+
+func (s *inlineState) isLatest(userID int64, queryID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest[userID] == queryID
+}
+
+func (s *inlineState) done(userID int64, queryID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest[userID] == queryID {
+		delete(s.latest, userID)
+	}
+}
+
+// SetInlineHandler enables answering inline queries when
+// channels.telegram.inline_queries is set in the config.
+func (c *TelegramChannel) SetInlineHandler(handler InlineQueryHandler) {
+	c.inlineHandler = handler
+}
+
+func (c *TelegramChannel) handleInlineQuery(ctx context.Context, query telego.InlineQuery) error {
+	if c.inlineHandler == nil {
+		return nil
+	}
+
+	senderID := fmt.Sprintf("%d", query.From.ID)
+	if query.From.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", query.From.ID, query.From.Username)
+	}
+
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("telegram", "Inline query rejected by allowlist", map[string]interface{}{
+			"user_id": senderID,
+		})
+		return c.answerInline(ctx, query.ID, nil)
+	}
+
+	text := strings.TrimSpace(query.Query)
+	if utf8.RuneCountInString(text) < inlineMinQueryLen {
+		return c.answerInline(ctx, query.ID, nil)
+	}
+
+	c.inline.mark(query.From.ID, query.ID)
+	defer c.inline.done(query.From.ID, query.ID)
+
+	select {
+	case <-time.After(inlineDebounce):
+	case <-ctx.Done():
+		return nil
+	}
+	if !c.inline.isLatest(query.From.ID, query.ID) {
+		// The user kept typing; the newer query will be answered instead.
+		return nil
+	}
+
+	answerCtx, cancel := context.WithTimeout(ctx, inlineTimeout)
+	defer cancel()
+
+	answer, err := c.inlineHandler(answerCtx, senderID, text)
+	if err != nil {
+		logger.ErrorCF("telegram", "Inline query failed", map[string]interface{}{
+			"user_id": senderID,
+			"error":   err.Error(),
+		})
+		return c.answerInline(ctx, query.ID, nil)
+	}
+	if answer == "" {
+		return c.answerInline(ctx, query.ID, nil)
+	}
+
+	logger.InfoCF("telegram", "Answered inline query", map[string]interface{}{
+		"user_id": senderID,
+		"query":   utils.Truncate(text, 50),
+	})
+	return c.answerInline(ctx, query.ID, buildInlineResults(text, answer))
+}
+
+func (c *TelegramChannel) answerInline(ctx context.Context, queryID string, results []telego.InlineQueryResult) error {
+	if results == nil {
+		results = []telego.InlineQueryResult{}
+	}
+	return c.bot.AnswerInlineQuery(ctx, &telego.AnswerInlineQueryParams{
+		InlineQueryID: queryID,
+		Results:       results,
+		CacheTime:     inlineCacheSeconds,
+		IsPersonal:    true,
+	})
+}
+
+// buildInlineResults offers the answer on its own and, as an alternative,
+// quoted together with the question so the chat can see what was asked.
+func buildInlineResults(query, answer string) []telego.InlineQueryResult {
+	description := utils.Truncate(strings.Join(strings.Fields(answer), " "), 120)
+
+	return []telego.InlineQueryResult{
+		&telego.InlineQueryResultArticle{
+			Type:        telego.ResultTypeArticle,
+			ID:          "answer",
+			Title:       "Send answer",
+			Description: description,
+			InputMessageContent: &telego.InputTextMessageContent{
+				MessageText: markdownToTelegramHTML(answer),
+				ParseMode:   telego.ModeHTML,
+			},
+		},
+		&telego.InlineQueryResultArticle{
+			Type:        telego.ResultTypeArticle,
+			ID:          "question_answer",
+			Title:       "Send question and answer",
+			Description: utils.Truncate(query, 120),
+			InputMessageContent: &telego.InputTextMessageContent{
+				MessageText: "<b>" + escapeHTML(query) + "</b>\n\n" + markdownToTelegramHTML(answer),
+				ParseMode:   telego.ModeHTML,
+			},
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mymmrac/telego"
+)
+
+func TestBuildInlineResults(t *testing.T) {
+	results := buildInlineResults("what is <b>?", "It's **bold**.\n\nUsed for emphasis.")
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	answer, ok := results[0].(*telego.InlineQueryResultArticle)
+	if !ok {
+		t.Fatalf("unexpected result type %T", results[0])
+	}
+	if answer.Description != "It's **bold**. Used for emphasis." {
+		t.Errorf("description not flattened: %q", answer.Description)
+	}
+	content := answer.InputMessageContent.(*telego.InputTextMessageContent)
+	if !strings.Contains(content.MessageText, "<b>bold</b>") {
+		t.Errorf("answer not converted to HTML: %q", content.MessageText)
+	}
+
+	both := results[1].(*telego.InlineQueryResultArticle)
+	content = both.InputMessageContent.(*telego.InputTextMessageContent)
+	if !strings.HasPrefix(content.MessageText, "<b>what is &lt;b&gt;?</b>") {
+		t.Errorf("question not escaped: %q", content.MessageText)
+	}
+}
+
+func TestInlineStateKeepsLatestQuery(t *testing.T) {
+	var s inlineState
+	s.mark(1, "a")
+	s.mark(1, "b")
+	if s.isLatest(1, "a") || !s.isLatest(1, "b") {
+		t.Fatal("expected only the newest query to be current")
+	}
+	s.done(1, "a")
+	if !s.isLatest(1, "b") {
+		t.Fatal("finishing a superseded query must not clear the newer one")
+	}
+}
@@ -0,0 +1,79 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// SetPollHandler implements tools.PollChannel. It is set before Start.
+func (c *TelegramChannel) SetPollHandler(handler func(tools.PollVote)) {
+	c.pollVotes = handler
+}
+
+// SendPoll implements tools.PollChannel. Polls are posted as not
+// anonymous, so Telegram reports each vote with who cast it.
+func (c *TelegramChannel) SendPoll(ctx context.Context, chatID string, poll tools.PollRequest) (tools.SentPoll, error) {
+	id, threadID, err := parseChatID(chatID)
+	if err != nil {
+		return tools.SentPoll{}, fmt.Errorf("invalid chat ID: %w", err)
+	}
+	options := make([]telego.InputPollOption, len(poll.Options))
+	for i, o := range poll.Options {
+		options[i] = telego.InputPollOption{Text: o}
+	}
+	anonymous := false
+	msg, err := c.bot.SendPoll(ctx, &telego.SendPollParams{
+		ChatID:                tu.ID(id),
+		MessageThreadID:       threadID,
+		Question:              poll.Question,
+		Options:               options,
+		IsAnonymous:           &anonymous,
+		AllowsMultipleAnswers: poll.Multiple,
+	})
+	if err != nil {
+		return tools.SentPoll{}, err
+	}
+	if msg.Poll == nil {
+		return tools.SentPoll{}, fmt.Errorf("telegram did not return the poll")
+	}
+	return tools.SentPoll{ID: msg.Poll.ID, MessageID: strconv.Itoa(msg.MessageID)}, nil
+}
+
+// StopPoll implements tools.PollCloser.
+func (c *TelegramChannel) StopPoll(ctx context.Context, chatID, messageID string) error {
+	id, _, err := parseChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID %q", messageID)
+	}
+	_, err = c.bot.StopPoll(ctx, &telego.StopPollParams{ChatID: tu.ID(id), MessageID: msgID})
+	return err
+}
+
+// handlePollAnswer passes a vote in one of the bot's polls on. Everyone in
+// the chat may vote, so the allow list does not apply.
+func (c *TelegramChannel) handlePollAnswer(answer telego.PollAnswer) {
+	if c.pollVotes == nil || answer.User == nil {
+		return
+	}
+	name := strings.TrimSpace(answer.User.FirstName + " " + answer.User.LastName)
+	if name == "" {
+		name = answer.User.Username
+	}
+	c.pollVotes(tools.PollVote{
+		PollID:  answer.PollID,
+		Voter:   strconv.FormatInt(answer.User.ID, 10),
+		Name:    name,
+		Options: answer.OptionIDs,
+	})
+}
@@ -0,0 +1,51 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/mymmrac/telego"
+)
+
+// TestParseChatID_ForumTopics verifies chat IDs round-trip with and without a forum topic and malformed topics are refused
+func TestParseChatID_ForumTopics(t *testing.T) {
+	for _, tc := range []struct {
+		chatID int64
+		thread int
+		want   string
+	}{
+		{123456, 0, "123456"},
+		{-1001234567890, 42, "-1001234567890/42"},
+	} {
+		got := telegramChatID(tc.chatID, tc.thread)
+		if got != tc.want {
+			t.Errorf("telegramChatID(%d, %d) = %q, want %q", tc.chatID, tc.thread, got, tc.want)
+		}
+		chatID, thread, err := parseChatID(got)
+		if err != nil || chatID != tc.chatID || thread != tc.thread {
+			t.Errorf("parseChatID(%q) = %d, %d, %v", got, chatID, thread, err)
+		}
+	}
+	for _, bad := range []string{"abc", "-100123/", "-100123/x", "-100123/-4"} {
+		if _, _, err := parseChatID(bad); err == nil {
+			t.Errorf("parseChatID(%q) accepted", bad)
+		}
+	}
+}
+
+// TestTopicName_FollowsCreateAndRename verifies topic names are learned from the messages that create, rename and reply to a topic
+func TestTopicName_FollowsCreateAndRename(t *testing.T) {
+	c := &TelegramChannel{}
+	created := &telego.Message{ForumTopicCreated: &telego.ForumTopicCreated{Name: "Bills"}}
+	inTopic := &telego.Message{Text: "pay the rent", ReplyToMessage: created}
+
+	if got := c.topicName("-100/7", inTopic); got != "Bills" {
+		t.Errorf("topic from the reply = %q", got)
+	}
+	c.topicName("-100/7", &telego.Message{ForumTopicEdited: &telego.ForumTopicEdited{Name: "Home bills"}})
+	if got := c.topicName("-100/7", inTopic); got != "Home bills" {
+		t.Errorf("renamed topic = %q", got)
+	}
+	if got := c.topicName("-100/8", &telego.Message{Text: "hi"}); got != "" {
+		t.Errorf("unknown topic = %q", got)
+	}
+}
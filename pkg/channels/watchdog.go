@@ -0,0 +1,273 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// HealthChecker is implemented by channels that can tell whether their
+// connection still works, such as a Bot API call or a ping on a socket.
+// Channels without it count as healthy while running.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// Channel states reported by the watchdog.
+const (
+	ChannelOK           = "ok"
+	ChannelReconnecting = "reconnecting"
+	ChannelDown         = "down"
+)
+
+// ChannelHealth is the watchdog's view of one channel.
+type ChannelHealth struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	Failures   int       `json:"failures"`
+	LastError  string    `json:"last_error,omitempty"`
+	LastOK     time.Time `json:"last_ok"`
+	DownSince  time.Time `json:"down_since"`
+	Reconnects int       `json:"reconnects"`
+}
+
+// WatchdogOptions tunes the watchdog; zero values take the defaults.
+type WatchdogOptions struct {
+	Interval   time.Duration // between checks, default 1 minute
+	MaxBackoff time.Duration // longest wait between reconnects, default 10 minutes
+	AlertAfter int           // failed checks in a row before owners hear, default 3
+	Owners     []string      // "channel:chatID" entries to alert
+}
+
+// channelWatch is the state kept per channel between checks.
+type channelWatch struct {
+	health    ChannelHealth
+	backoff   time.Duration
+	nextRetry time.Time
+	alerted   bool
+}
+
+// Watchdog checks every channel's connection, restarts channels whose
+// check fails with exponential backoff, and tells the owners on another
+// channel once one stays down. Owners reachable only on the failed
+// channel hear when it is back.
+type Watchdog struct {
+	manager *Manager
+	bus     *bus.MessageBus
+	opts    WatchdogOptions
+
+	mu      sync.Mutex
+	watches map[string]*channelWatch
+}
+
+// NewWatchdog creates a watchdog over the manager's channels.
+func NewWatchdog(manager *Manager, messageBus *bus.MessageBus, opts WatchdogOptions) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.MaxBackoff < opts.Interval {
+		opts.MaxBackoff = 10 * opts.Interval
+	}
+	if opts.AlertAfter <= 0 {
+		opts.AlertAfter = 3
+	}
+	return &Watchdog{
+		manager: manager,
+		bus:     messageBus,
+		opts:    opts,
+		watches: make(map[string]*channelWatch),
+	}
+}
+
+// Run checks the channels every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.CheckAll(ctx, time.Now())
+		}
+	}
+}
+
+// CheckAll checks every channel once, restarting the failed ones that are
+// due for another attempt.
+func (w *Watchdog) CheckAll(ctx context.Context, now time.Time) {
+	channels := w.manager.snapshot()
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.check(ctx, name, channels[name], now)
+	}
+}
+
+func (w *Watchdog) check(ctx context.Context, name string, ch Channel, now time.Time) {
+	err := checkChannel(ctx, ch)
+
+	w.mu.Lock()
+	watch, ok := w.watches[name]
+	if !ok {
+		watch = &channelWatch{health: ChannelHealth{Name: name}, backoff: w.opts.Interval}
+		w.watches[name] = watch
+	}
+	h := &watch.health
+
+	if err == nil {
+		wasDown, downSince := watch.alerted, h.DownSince
+		h.State, h.Failures, h.LastError, h.LastOK, h.DownSince = ChannelOK, 0, "", now, time.Time{}
+		watch.backoff, watch.nextRetry, watch.alerted = w.opts.Interval, time.Time{}, false
+		w.mu.Unlock()
+		channelUp.Set(1, name)
+		if wasDown {
+			w.alert(name, fmt.Sprintf("✅ The %s channel is connected again after %s.", name, formatOutage(now.Sub(downSince))))
+		}
+		return
+	}
+
+	if h.Failures == 0 {
+		h.DownSince = now
+	}
+	h.Failures++
+	h.LastError = err.Error()
+	h.State = ChannelReconnecting
+	alert := h.Failures >= w.opts.AlertAfter && !watch.alerted
+	if alert {
+		watch.alerted = true
+	}
+	if watch.alerted {
+		h.State = ChannelDown
+	}
+	restart := !now.Before(watch.nextRetry)
+	if restart {
+		watch.nextRetry = now.Add(watch.backoff)
+		watch.backoff *= 2
+		if watch.backoff > w.opts.MaxBackoff {
+			watch.backoff = w.opts.MaxBackoff
+		}
+		h.Reconnects++
+	}
+	failures, lastErr := h.Failures, h.LastError
+	w.mu.Unlock()
+	channelUp.Set(0, name)
+
+	logger.WarnCF("channels", "Channel health check failed", map[string]interface{}{
+		"channel":  name,
+		"failures": failures,
+		"error":    lastErr,
+	})
+	if alert {
+		w.alert(name, fmt.Sprintf("⚠️ The %s channel has failed %d health checks in a row and is reconnecting: %s", name, failures, lastErr))
+	}
+	if restart {
+		channelReconnects.Inc(name)
+		if err := restartChannel(ctx, ch); err != nil {
+			logger.ErrorCF("channels", "Channel reconnect failed", map[string]interface{}{
+				"channel": name,
+				"error":   err.Error(),
+			})
+			w.mu.Lock()
+			h.LastError = err.Error()
+			w.mu.Unlock()
+		} else {
+			logger.InfoCF("channels", "Channel reconnected", map[string]interface{}{"channel": name})
+		}
+	}
+}
+
+// checkChannel runs the channel's own check, or falls back to IsRunning.
+func checkChannel(ctx context.Context, ch Channel) error {
+	if hc, ok := ch.(HealthChecker); ok {
+		return hc.CheckHealth(ctx)
+	}
+	if !ch.IsRunning() {
+		return fmt.Errorf("not running")
+	}
+	return nil
+}
+
+func restartChannel(ctx context.Context, ch Channel) error {
+	if err := ch.Stop(ctx); err != nil {
+		logger.DebugCF("channels", "Error stopping channel before reconnect", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return ch.Start(ctx)
+}
+
+// alert sends text to every owner on a channel that is up, other than
+// the one it is about unless that channel just recovered.
+func (w *Watchdog) alert(about, text string) {
+	channels := w.manager.snapshot()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sent := 0
+	for _, owner := range w.opts.Owners {
+		channel, chatID, ok := strings.Cut(strings.TrimSpace(owner), ":")
+		if !ok || chatID == "" {
+			continue
+		}
+		if watch, known := w.watches[channel]; known && watch.health.State != ChannelOK {
+			continue
+		}
+		if _, exists := channels[channel]; !exists {
+			continue
+		}
+		w.bus.PublishOutbound(bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: text})
+		sent++
+	}
+	logger.WarnCF("channels", "Channel watchdog alert", map[string]interface{}{
+		"channel":    about,
+		"alert":      text,
+		"recipients": sent,
+	})
+}
+
+// Status returns the health of every channel, sorted by name. Channels
+// not checked yet are reported from IsRunning.
+func (w *Watchdog) Status() []ChannelHealth {
+	channels := w.manager.snapshot()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]ChannelHealth, 0, len(channels))
+	for name, ch := range channels {
+		if watch, ok := w.watches[name]; ok {
+			out = append(out, watch.health)
+			continue
+		}
+		out = append(out, runningHealth(name, ch))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func runningHealth(name string, ch Channel) ChannelHealth {
+	h := ChannelHealth{Name: name, State: ChannelOK}
+	if !ch.IsRunning() {
+		h.State, h.LastError = ChannelDown, "not running"
+	}
+	return h
+}
+
+// formatOutage renders an outage length as "45s", "12m" or "3h05m".
+func formatOutage(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
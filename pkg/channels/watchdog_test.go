@@ -0,0 +1,78 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type flakyChannel struct {
+	textChannel
+	healthy bool
+	starts  int
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error { c.starts++; return nil }
+
+func (c *flakyChannel) CheckHealth(ctx context.Context) error {
+	if !c.healthy {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+// TestWatchdog_ReconnectsWithBackoffAndAlerts verifies a failing channel
+// is restarted with growing gaps, owners on another channel are alerted
+// after repeated failures and told when it recovers.
+func TestWatchdog_ReconnectsWithBackoffAndAlerts(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	m := &Manager{channels: map[string]Channel{}, bus: msgBus}
+	whatsapp := &flakyChannel{textChannel: textChannel{NewBaseChannel("whatsapp", nil, msgBus, nil)}, healthy: true}
+	m.RegisterChannel("whatsapp", whatsapp)
+	m.RegisterChannel("telegram", &flakyChannel{textChannel: textChannel{NewBaseChannel("telegram", nil, msgBus, nil)}, healthy: true})
+
+	w := NewWatchdog(m, msgBus, WatchdogOptions{
+		Interval:   time.Minute,
+		MaxBackoff: 4 * time.Minute,
+		AlertAfter: 3,
+		Owners:     []string{"telegram:42", "whatsapp:99"},
+	})
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	w.CheckAll(ctx, start)
+
+	whatsapp.healthy = false
+	// restarts at 1, 2 (1m later), 4 (2m later) and 8 (4m, the cap) minutes
+	for minute := 1; minute <= 8; minute++ {
+		w.CheckAll(ctx, start.Add(time.Duration(minute)*time.Minute))
+	}
+	if whatsapp.starts != 4 {
+		t.Errorf("starts = %d, want 4", whatsapp.starts)
+	}
+	status := w.Status()
+	if status[1].Name != "whatsapp" || status[1].State != ChannelDown || status[1].Failures != 8 || status[1].Reconnects != 4 {
+		t.Errorf("whatsapp status = %+v", status[1])
+	}
+	if status[0].State != ChannelOK {
+		t.Errorf("telegram status = %+v", status[0])
+	}
+
+	alert := msgBus.DrainOutbound()
+	if len(alert) != 1 || alert[0].Channel != "telegram" || alert[0].ChatID != "42" || !strings.Contains(alert[0].Content, "connection reset") {
+		t.Fatalf("alerts = %+v, want one on telegram", alert)
+	}
+
+	whatsapp.healthy = true
+	w.CheckAll(ctx, start.Add(9*time.Minute))
+	recovered := msgBus.DrainOutbound()
+	if len(recovered) != 2 || !strings.Contains(recovered[0].Content, "after 8m") {
+		t.Fatalf("recovery notices = %+v, want both owners told", recovered)
+	}
+	if h := w.Status()[1]; h.State != ChannelOK || h.Failures != 0 {
+		t.Errorf("after recovery: %+v", h)
+	}
+}
@@ -6,15 +6,19 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
+const whatsAppRequestTimeout = 15 * time.Second
+
 type WhatsAppChannel struct {
 	*BaseChannel
 	conn      *websocket.Conn
@@ -22,6 +26,20 @@ type WhatsAppChannel struct {
 	url       string
 	mu        sync.Mutex
 	connected bool
+
+	// Bridge request/response correlation for group operations
+	requestSeq atomic.Uint64
+	pendingMu  sync.Mutex
+	pending    map[string]chan whatsAppBridgeResponse
+
+	pollVotes func(tools.PollVote)
+}
+
+type whatsAppBridgeResponse struct {
+	ID    string          `json:"id"`
+	OK    bool            `json:"ok"`
+	Error string          `json:"error"`
+	Data  json.RawMessage `json:"data"`
 }
 
 func NewWhatsAppChannel(cfg config.WhatsAppConfig, bus *bus.MessageBus) (*WhatsAppChannel, error) {
@@ -32,6 +50,7 @@ func NewWhatsAppChannel(cfg config.WhatsAppConfig, bus *bus.MessageBus) (*WhatsA
 		config:      cfg,
 		url:         cfg.BridgeURL,
 		connected:   false,
+		pending:     make(map[string]chan whatsAppBridgeResponse),
 	}, nil
 }
 
@@ -54,11 +73,25 @@ func (c *WhatsAppChannel) Start(ctx context.Context) error {
 	c.setRunning(true)
 	log.Println("WhatsApp channel connected")
 
-	go c.listen(ctx)
+	go c.listen(ctx, conn)
 
 	return nil
 }
 
+// CheckHealth pings the bridge; a socket that dropped fails at once.
+func (c *WhatsAppChannel) CheckHealth(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.conn == nil {
+		return fmt.Errorf("not connected to the WhatsApp bridge")
+	}
+	if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	return nil
+}
+
 func (c *WhatsAppChannel) Stop(ctx context.Context) error {
 	log.Println("Stopping WhatsApp channel...")
 
@@ -104,26 +137,23 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
-func (c *WhatsAppChannel) listen(ctx context.Context) {
+// listen reads from conn until it fails. A failed read leaves the
+// channel disconnected for the watchdog to reconnect.
+func (c *WhatsAppChannel) listen(ctx context.Context, conn *websocket.Conn) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			c.mu.Lock()
-			conn := c.conn
-			c.mu.Unlock()
-
-			if conn == nil {
-				time.Sleep(1 * time.Second)
-				continue
-			}
-
 			_, message, err := conn.ReadMessage()
 			if err != nil {
 				log.Printf("WhatsApp read error: %v", err)
-				time.Sleep(2 * time.Second)
-				continue
+				c.mu.Lock()
+				if c.conn == conn {
+					c.connected = false
+				}
+				c.mu.Unlock()
+				return
 			}
 
 			var msg map[string]interface{}
@@ -137,8 +167,13 @@ func (c *WhatsAppChannel) listen(ctx context.Context) {
 				continue
 			}
 
-			if msgType == "message" {
+			switch msgType {
+			case "message":
 				c.handleIncomingMessage(msg)
+			case "response":
+				c.handleResponse(message)
+			case "poll_vote":
+				c.handlePollVote(msg)
 			}
 		}
 	}
@@ -182,3 +217,227 @@ func (c *WhatsAppChannel) handleIncomingMessage(msg map[string]interface{}) {
 
 	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
 }
+
+func (c *WhatsAppChannel) handleResponse(raw []byte) {
+	var resp whatsAppBridgeResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		log.Printf("Failed to unmarshal WhatsApp bridge response: %v", err)
+		return
+	}
+
+	c.pendingMu.Lock()
+	ch, ok := c.pending[resp.ID]
+	delete(c.pending, resp.ID)
+	c.pendingMu.Unlock()
+
+	if ok {
+		ch <- resp
+	}
+}
+
+// request sends a command to the bridge and waits for the response with the
+// same id. Bridges that don't implement a command never answer, so callers
+// get a timeout instead of hanging.
+func (c *WhatsAppChannel) request(ctx context.Context, reqType string, params map[string]interface{}, out interface{}) error {
+	id := fmt.Sprintf("req-%d", c.requestSeq.Add(1))
+	ch := make(chan whatsAppBridgeResponse, 1)
+
+	c.pendingMu.Lock()
+	c.pending[id] = ch
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	payload := map[string]interface{}{"type": reqType, "id": id}
+	for k, v := range params {
+		payload[k] = v
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.conn == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("whatsapp connection not established")
+	}
+	err = c.conn.WriteMessage(websocket.TextMessage, data)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	select {
+	case resp := <-ch:
+		if !resp.OK {
+			if resp.Error == "" {
+				resp.Error = "request failed"
+			}
+			return fmt.Errorf("whatsapp bridge: %s", resp.Error)
+		}
+		if out != nil && len(resp.Data) > 0 {
+			if err := json.Unmarshal(resp.Data, out); err != nil {
+				return fmt.Errorf("failed to parse bridge response: %w", err)
+			}
+		}
+		return nil
+	case <-time.After(whatsAppRequestTimeout):
+		return fmt.Errorf("whatsapp bridge did not answer %s (is it supported by your bridge version?)", reqType)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type whatsAppGroupMetadata struct {
+	ID           string `json:"id"`
+	Subject      string `json:"subject"`
+	Participants []struct {
+		ID    string `json:"id"`
+		Admin string `json:"admin"` // "admin", "superadmin" or empty
+	} `json:"participants"`
+}
+
+func (g *whatsAppGroupMetadata) toChatGroup() tools.ChatGroup {
+	return tools.ChatGroup{ID: g.ID, Subject: g.Subject, Participants: len(g.Participants)}
+}
+
+// ListGroups implements tools.GroupManager.
+func (c *WhatsAppChannel) ListGroups(ctx context.Context) ([]tools.ChatGroup, error) {
+	var groups []whatsAppGroupMetadata
+	if err := c.request(ctx, "groups_list", nil, &groups); err != nil {
+		return nil, err
+	}
+	result := make([]tools.ChatGroup, 0, len(groups))
+	for i := range groups {
+		result = append(result, groups[i].toChatGroup())
+	}
+	return result, nil
+}
+
+// GroupParticipants implements tools.GroupManager.
+func (c *WhatsAppChannel) GroupParticipants(ctx context.Context, groupID string) ([]tools.GroupMember, error) {
+	var meta whatsAppGroupMetadata
+	if err := c.request(ctx, "group_metadata", map[string]interface{}{"group": groupID}, &meta); err != nil {
+		return nil, err
+	}
+	members := make([]tools.GroupMember, 0, len(meta.Participants))
+	for _, p := range meta.Participants {
+		members = append(members, tools.GroupMember{ID: p.ID, Admin: p.Admin != ""})
+	}
+	return members, nil
+}
+
+// CreateGroup implements tools.GroupManager.
+func (c *WhatsAppChannel) CreateGroup(ctx context.Context, subject string, participants []string) (*tools.ChatGroup, error) {
+	var meta whatsAppGroupMetadata
+	err := c.request(ctx, "group_create", map[string]interface{}{
+		"subject":      subject,
+		"participants": participants,
+	}, &meta)
+	if err != nil {
+		return nil, err
+	}
+	group := meta.toChatGroup()
+	return &group, nil
+}
+
+// UpdateParticipants implements tools.GroupManager.
+func (c *WhatsAppChannel) UpdateParticipants(ctx context.Context, groupID string, participants []string, action string) error {
+	switch action {
+	case "add", "remove", "promote", "demote":
+	default:
+		return fmt.Errorf("unsupported participant action %q", action)
+	}
+	return c.request(ctx, "group_participants_update", map[string]interface{}{
+		"group":        groupID,
+		"participants": participants,
+		"action":       action,
+	}, nil)
+}
+
+type whatsAppBroadcastList struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"`
+}
+
+// BroadcastLists implements tools.Broadcaster.
+func (c *WhatsAppChannel) BroadcastLists(ctx context.Context) ([]tools.BroadcastList, error) {
+	var lists []whatsAppBroadcastList
+	if err := c.request(ctx, "broadcast_lists", nil, &lists); err != nil {
+		return nil, err
+	}
+	result := make([]tools.BroadcastList, 0, len(lists))
+	for _, l := range lists {
+		result = append(result, tools.BroadcastList{ID: l.ID, Name: l.Name, Recipients: len(l.Recipients)})
+	}
+	return result, nil
+}
+
+// SendBroadcast implements tools.Broadcaster.
+func (c *WhatsAppChannel) SendBroadcast(ctx context.Context, listID, content string) error {
+	return c.request(ctx, "broadcast_send", map[string]interface{}{
+		"list":    listID,
+		"content": content,
+	}, nil)
+}
+
+// PostStatus implements tools.Broadcaster. Bridges whose WhatsApp backend
+// cannot post status updates answer with an error.
+func (c *WhatsAppChannel) PostStatus(ctx context.Context, content string) error {
+	return c.request(ctx, "status_post", map[string]interface{}{"content": content}, nil)
+}
+
+// SetPollHandler implements tools.PollChannel. It is set before Start.
+func (c *WhatsAppChannel) SetPollHandler(handler func(tools.PollVote)) {
+	c.pollVotes = handler
+}
+
+// SendPoll implements tools.PollChannel. The bridge answers with the
+// poll message's ID, which its poll_vote events carry.
+func (c *WhatsAppChannel) SendPoll(ctx context.Context, chatID string, poll tools.PollRequest) (tools.SentPoll, error) {
+	selectable := 1
+	if poll.Multiple {
+		selectable = len(poll.Options)
+	}
+	var sent struct {
+		ID string `json:"id"`
+	}
+	err := c.request(ctx, "poll_send", map[string]interface{}{
+		"to":               chatID,
+		"question":         poll.Question,
+		"options":          poll.Options,
+		"selectable_count": selectable,
+	}, &sent)
+	if err != nil {
+		return tools.SentPoll{}, err
+	}
+	if sent.ID == "" {
+		return tools.SentPoll{}, fmt.Errorf("whatsapp bridge did not return the poll ID")
+	}
+	return tools.SentPoll{ID: sent.ID, MessageID: sent.ID}, nil
+}
+
+// handlePollVote passes on a poll_vote event: {"poll_id", "from",
+// "from_name", "options": [indexes of the voter's current picks]}.
+func (c *WhatsAppChannel) handlePollVote(msg map[string]interface{}) {
+	pollID, _ := msg["poll_id"].(string)
+	voter, _ := msg["from"].(string)
+	if c.pollVotes == nil || pollID == "" || voter == "" {
+		return
+	}
+	name, _ := msg["from_name"].(string)
+	var options []int
+	if picks, ok := msg["options"].([]interface{}); ok {
+		for _, pick := range picks {
+			if n, ok := pick.(float64); ok {
+				options = append(options, int(n))
+			}
+		}
+	}
+	c.pollVotes(tools.PollVote{PollID: pollID, Voter: voter, Name: name, Options: options})
+}
@@ -0,0 +1,93 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestWhatsAppChannelGroupRequests(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var req map[string]interface{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			resp := map[string]interface{}{"type": "response", "id": req["id"], "ok": true}
+			switch req["type"] {
+			case "groups_list":
+				resp["data"] = []map[string]interface{}{
+					{"id": "1@g.us", "subject": "Family", "participants": []map[string]string{{"id": "a"}, {"id": "b", "admin": "admin"}}},
+				}
+			case "group_participants_update":
+				resp["ok"] = false
+				resp["error"] = "not-authorized"
+			case "broadcast_lists":
+				resp["data"] = []map[string]interface{}{
+					{"id": "1@broadcast", "name": "Customers", "recipients": []string{"a", "b", "c"}},
+				}
+			case "status_post":
+				resp["ok"] = false
+				resp["error"] = "status updates are not supported"
+			}
+			conn.WriteJSON(resp)
+		}
+	}))
+	defer server.Close()
+
+	ch, err := NewWhatsAppChannel(config.WhatsAppConfig{
+		BridgeURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel() error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer ch.Stop(ctx)
+
+	groups, err := ch.ListGroups(ctx)
+	if err != nil {
+		t.Fatalf("ListGroups() error: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Subject != "Family" || groups[0].Participants != 2 {
+		data, _ := json.Marshal(groups)
+		t.Errorf("unexpected groups: %s", data)
+	}
+
+	err = ch.UpdateParticipants(ctx, "1@g.us", []string{"c@s.whatsapp.net"}, "add")
+	if err == nil || !strings.Contains(err.Error(), "not-authorized") {
+		t.Errorf("expected bridge error, got %v", err)
+	}
+
+	lists, err := ch.BroadcastLists(ctx)
+	if err != nil {
+		t.Fatalf("BroadcastLists() error: %v", err)
+	}
+	if len(lists) != 1 || lists[0].Name != "Customers" || lists[0].Recipients != 3 {
+		t.Errorf("unexpected broadcast lists: %+v", lists)
+	}
+
+	err = ch.PostStatus(ctx, "Closed today")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected bridge error, got %v", err)
+	}
+}
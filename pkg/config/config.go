@@ -51,11 +51,93 @@ type Config struct {
 	Tools     ToolsConfig     `json:"tools"`
 	Heartbeat HeartbeatConfig `json:"heartbeat"`
 	Devices   DevicesConfig   `json:"devices"`
-	mu        sync.RWMutex
+	Google    GoogleConfig    `json:"google"`
+	Voice     VoiceConfig     `json:"voice"`
+	OCR       OCRConfig       `json:"ocr"`
+	Logging   LoggingConfig   `json:"logging"`
+	Tracing   TracingConfig   `json:"tracing"`
+	Debug     DebugConfig     `json:"debug"`
+	// Embeddings turn text into vectors for searching memory by meaning
+	Embeddings EmbeddingsConfig `json:"embeddings"`
+	// ContentPolicy screens outgoing messages and uploads
+	ContentPolicy ContentPolicyConfig `json:"content_policy"`
+	// Quotas limit each user's daily use in shared deployments
+	Quotas QuotasConfig `json:"quotas"`
+	// Owners may run admin commands (/status, /pause, /reload config...)
+	// from chat. Entries are sender IDs, optionally prefixed with the
+	// channel ("telegram:123456").
+	Owners FlexibleStringSlice `json:"owners" env:"PICOCLAW_OWNERS"`
+	// Roles give users different tools, confirmations and quotas
+	Roles RolesConfig `json:"roles"`
+	// Escalation lets the agent hand a conversation over to a person
+	Escalation EscalationConfig `json:"escalation"`
+	// Egress limits where tools may connect when following links
+	Egress EgressConfig `json:"egress"`
+	// Screening checks email attachments before they are saved or passed on
+	Screening ScreeningConfig `json:"screening"`
+	// Queue shapes how bursts of inbound messages reach the agent
+	Queue QueueConfig `json:"queue"`
+	// Offline switches to local tools and model while the internet is down
+	Offline OfflineConfig `json:"offline"`
+	// LocalOnly keeps sensitive chats on the local model and off cloud
+	// uploads
+	LocalOnly LocalOnlyConfig `json:"local_only"`
+	// Outages probes Google APIs, the model's backend and the channels
+	// and explains failures while one is down
+	Outages OutagesConfig `json:"outages"`
+	// Webhooks post agent events to external systems
+	Webhooks WebhooksConfig `json:"webhooks"`
+	// Automations are schedules, templates and rules defined in YAML files
+	Automations AutomationsConfig `json:"automations"`
+	// Memory sets how long what the agent remembers about users is kept
+	Memory MemoryConfig `json:"memory"`
+	// Features turns experimental subsystems on or off by name ("browser",
+	// "subagents", "streaming"); unset ones keep their defaults
+	Features map[string]bool `json:"features,omitempty"`
+	// Resources caps heavy work (transcoding, OCR, embeddings) on small devices
+	Resources ResourcesConfig `json:"resources"`
+	// Disk caps the space temporary downloads, artifacts and caches take
+	Disk DiskConfig `json:"disk"`
+	// Images controls how photos are adapted before they are sent
+	Images ImagesConfig `json:"images"`
+	mu     sync.RWMutex
+
+	// Values loaded from ${env:...}, ${file:...} or ${keychain:...}
+	secretRefs []secretRef
 }
 
 type AgentsConfig struct {
 	Defaults AgentDefaults `json:"defaults"`
+	Routing  ModelRouting  `json:"routing"`
+	// Personas are presets an owner can give a chat with /persona, e.g.
+	// "formal", "family" or "dev", by name
+	Personas map[string]PersonaConfig `json:"personas,omitempty"`
+}
+
+// PersonaConfig is how the agent behaves in chats given the persona:
+// Prompt is added to the system prompt, Tools (when set) are the only
+// tools it may use there, and Verbosity is "concise", "normal" or
+// "detailed".
+type PersonaConfig struct {
+	Description string              `json:"description"`
+	Prompt      string              `json:"prompt"`
+	Tools       FlexibleStringSlice `json:"tools"`
+	Verbosity   string              `json:"verbosity"`
+}
+
+// ModelRouting picks a model per kind of work, so a busy bot can run its
+// tool steps and summaries on a cheap model and keep a strong one for what
+// the user reads. Empty entries use agents.defaults.model.
+type ModelRouting struct {
+	// Tools runs the steps that pick tools and fill in their arguments;
+	// when it is done calling tools, Final writes the reply
+	Tools string `json:"tools" env:"PICOCLAW_AGENTS_ROUTING_TOOLS"`
+	Final string `json:"final" env:"PICOCLAW_AGENTS_ROUTING_FINAL"`
+	// Summarize compresses long conversations, and is the default of the
+	// summarize tool
+	Summarize string `json:"summarize" env:"PICOCLAW_AGENTS_ROUTING_SUMMARIZE"`
+	// Vision handles whole turns whose message carries an image
+	Vision string `json:"vision" env:"PICOCLAW_AGENTS_ROUTING_VISION"`
 }
 
 type AgentDefaults struct {
@@ -66,6 +148,16 @@ type AgentDefaults struct {
 	MaxTokens           int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
 	Temperature         float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations   int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	// LargeResultChars is the size over which a tool result is sent to the
+	// chat as a document, with only its start kept in the model's context;
+	// 0 keeps every result in context
+	LargeResultChars int `json:"large_result_chars" env:"PICOCLAW_AGENTS_DEFAULTS_LARGE_RESULT_CHARS"`
+	// Locale is the BCP 47 tag (e.g. "pt-BR") tools format dates, numbers
+	// and their replies in for users whose profile sets none; empty is English
+	Locale string `json:"locale" env:"PICOCLAW_AGENTS_DEFAULTS_LOCALE"`
+	// Onboarding walks a new private chat through the setup wizard on its
+	// first message; /setup starts it in any chat
+	Onboarding bool `json:"onboarding" env:"PICOCLAW_AGENTS_DEFAULTS_ONBOARDING"`
 }
 
 type ChannelsConfig struct {
@@ -92,6 +184,9 @@ type TelegramConfig struct {
 	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
 	Proxy     string              `json:"proxy" env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	// InlineQueries answers "@botname question" in any chat. Inline mode must
+	// also be enabled for the bot with BotFather's /setinline.
+	InlineQueries bool `json:"inline_queries" env:"PICOCLAW_CHANNELS_TELEGRAM_INLINE_QUERIES"`
 }
 
 type FeishuConfig struct {
@@ -172,7 +267,7 @@ type ProvidersConfig struct {
 	OpenRouter    ProviderConfig `json:"openrouter"`
 	Groq          ProviderConfig `json:"groq"`
 	Zai           ProviderConfig `json:"zai"`
-	Zhipu         ProviderConfig `json:"zhipu"`    // Deprecated: use "zai" instead
+	Zhipu         ProviderConfig `json:"zhipu"` // Deprecated: use "zai" instead
 	VLLM          ProviderConfig `json:"vllm"`
 	Gemini        ProviderConfig `json:"gemini"`
 	Nvidia        ProviderConfig `json:"nvidia"`
@@ -183,6 +278,196 @@ type ProvidersConfig struct {
 	GitHubCopilot ProviderConfig `json:"github_copilot"`
 }
 
+// VoiceConfig configures synthesized voice replies. Speech uses the OpenAI
+// provider's API key and base URL.
+type VoiceConfig struct {
+	TTSModel string `json:"tts_model" env:"PICOCLAW_VOICE_TTS_MODEL"`
+	TTSVoice string `json:"tts_voice" env:"PICOCLAW_VOICE_TTS_VOICE"`
+}
+
+// EmbeddingsConfig picks how memory and notes are searched by meaning.
+// "openai", "ollama" and "gemini" use that provider's API key and base
+// URL; Ollama (like llama.cpp and vLLM behind the "openai" provider with
+// their base URL) runs the model locally. "local" embeds in-process with
+// no model and no network: less accurate, but always available. Empty
+// keeps search to matching words.
+type EmbeddingsConfig struct {
+	Provider string `json:"provider" env:"PICOCLAW_EMBEDDINGS_PROVIDER"`
+	Model    string `json:"model" env:"PICOCLAW_EMBEDDINGS_MODEL"`
+	// Fallback is used while Provider fails, e.g. "local" to keep search
+	// working offline
+	Fallback string `json:"fallback" env:"PICOCLAW_EMBEDDINGS_FALLBACK"`
+}
+
+// OCRConfig controls text recognition on received photos. Languages are
+// ISO 639-1 or tesseract codes such as "pt" or "por"; their tesseract
+// packs must be installed. Backend "google_vision" sends images to Cloud
+// Vision with APIKey instead, which also reads handwriting; Handwriting
+// keeps tesseract and sends only what it can't read there.
+type OCRConfig struct {
+	Enabled     bool                `json:"enabled" env:"PICOCLAW_OCR_ENABLED"`
+	Languages   FlexibleStringSlice `json:"languages" env:"PICOCLAW_OCR_LANGUAGES"`
+	Backend     string              `json:"backend" env:"PICOCLAW_OCR_BACKEND"`
+	Handwriting bool                `json:"handwriting" env:"PICOCLAW_OCR_HANDWRITING"`
+	APIKey      string              `json:"api_key" env:"PICOCLAW_OCR_API_KEY"`
+	APIBase     string              `json:"api_base" env:"PICOCLAW_OCR_API_BASE"`
+}
+
+// LoggingConfig controls log levels and output. Components overrides the
+// level per component (e.g. {"telegram": "debug"}). File, when set, gets
+// JSON lines and is rotated at MaxSizeMB, keeping MaxBackups rotated files
+// for at most MaxAgeDays. Format "json" also writes the console as JSON.
+type LoggingConfig struct {
+	Level      string            `json:"level" env:"PICOCLAW_LOGGING_LEVEL"`
+	Components map[string]string `json:"components"`
+	Format     string            `json:"format" env:"PICOCLAW_LOGGING_FORMAT"`
+	File       string            `json:"file" env:"PICOCLAW_LOGGING_FILE"`
+	MaxSizeMB  int               `json:"max_size_mb" env:"PICOCLAW_LOGGING_MAX_SIZE_MB"`
+	MaxAgeDays int               `json:"max_age_days" env:"PICOCLAW_LOGGING_MAX_AGE_DAYS"`
+	MaxBackups int               `json:"max_backups" env:"PICOCLAW_LOGGING_MAX_BACKUPS"`
+	Redact     RedactConfig      `json:"redact"`
+}
+
+// RedactConfig masks sensitive data in logs: Secrets (tokens, keys),
+// Emails (addresses), and Content (message bodies, tool arguments, file
+// contents, logged as their length). Fields and Patterns (regular
+// expressions) add site-specific rules.
+type RedactConfig struct {
+	Secrets  bool                `json:"secrets" env:"PICOCLAW_LOGGING_REDACT_SECRETS"`
+	Emails   bool                `json:"emails" env:"PICOCLAW_LOGGING_REDACT_EMAILS"`
+	Content  bool                `json:"content" env:"PICOCLAW_LOGGING_REDACT_CONTENT"`
+	Fields   FlexibleStringSlice `json:"fields"`
+	Patterns FlexibleStringSlice `json:"patterns"`
+}
+
+// ContentPolicyConfig stops outgoing chat messages, uploads and emails
+// that contain card numbers, Keywords or Patterns (regular expressions),
+// or files over MaxAttachmentMB. Action "block" refuses them; "approve"
+// holds them until an owner sends /release.
+type ContentPolicyConfig struct {
+	Enabled         bool                `json:"enabled" env:"PICOCLAW_CONTENT_POLICY_ENABLED"`
+	CardNumbers     bool                `json:"card_numbers" env:"PICOCLAW_CONTENT_POLICY_CARD_NUMBERS"`
+	Keywords        FlexibleStringSlice `json:"keywords"`
+	Patterns        FlexibleStringSlice `json:"patterns"`
+	MaxAttachmentMB int                 `json:"max_attachment_mb" env:"PICOCLAW_CONTENT_POLICY_MAX_ATTACHMENT_MB"`
+	Action          string              `json:"action" env:"PICOCLAW_CONTENT_POLICY_ACTION"`
+}
+
+// QuotasConfig limits what each chat user may use per day: messages, tool
+// calls, LLM tokens and calls of individual (expensive) tools. Default
+// applies to everyone; an entry in Users, keyed like owners ("123" or
+// "telegram:123"), replaces it for that user. Zero means unlimited, and
+// owners are never limited. Counts reset at local midnight.
+type QuotasConfig struct {
+	Enabled bool                   `json:"enabled" env:"PICOCLAW_QUOTAS_ENABLED"`
+	Default QuotaLimits            `json:"default"`
+	Users   map[string]QuotaLimits `json:"users"`
+}
+
+// QuotaLimits are one user's daily allowances.
+type QuotaLimits struct {
+	Messages  int `json:"messages"`
+	ToolCalls int `json:"tool_calls"`
+	Tokens    int `json:"tokens"`
+	// Tools limits individual tools by name, e.g. {"web_fetch": 20}
+	Tools map[string]int `json:"tools,omitempty"`
+}
+
+// RolesConfig gives each user a role: "owner", "trusted" or "guest".
+// Owners (and everyone in Owners) use every tool without confirming and
+// without quotas; trusted users and guests get what their RoleConfig
+// allows. Accounts linked to one person share its role.
+type RolesConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_ROLES_ENABLED"`
+	// Default is the role of users not in Users; empty means "guest"
+	Default string `json:"default" env:"PICOCLAW_ROLES_DEFAULT"`
+	// Users maps accounts ("telegram:123456", "whatsapp:5511999990000")
+	// to roles
+	Users   map[string]string `json:"users"`
+	Trusted RoleConfig        `json:"trusted"`
+	Guest   RoleConfig        `json:"guest"`
+}
+
+// RoleConfig is what users with one role may do.
+type RoleConfig struct {
+	// Tools the role may use; empty allows every tool
+	Tools FlexibleStringSlice `json:"tools"`
+	// Confirm lists tools whose changes wait until the user says yes
+	Confirm FlexibleStringSlice `json:"confirm"`
+	// Quotas replace quotas.default for users with the role; users with
+	// their own entry in quotas.users keep it
+	Quotas *QuotaLimits `json:"quotas,omitempty"`
+}
+
+// EscalationConfig lets the agent hand a conversation over to a person,
+// for deployments where the bot answers on someone's behalf. The agent
+// sends a snapshot of the conversation to the owner chat and stops
+// answering that chat until the person there replies or hands it back.
+type EscalationConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_ESCALATION_ENABLED"`
+	// OwnerChat receives handed-over conversations, as "channel:chat_id"
+	OwnerChat string `json:"owner_chat" env:"PICOCLAW_ESCALATION_OWNER_CHAT"`
+	// HistoryMessages is how many recent messages the snapshot shows; 0
+	// means 10
+	HistoryMessages int `json:"history_messages" env:"PICOCLAW_ESCALATION_HISTORY_MESSAGES"`
+}
+
+// TracingConfig exports OpenTelemetry spans for agent rounds, LLM calls,
+// tool calls and sends. Endpoint is the collector's OTLP/HTTP base URL;
+// Headers are added to export requests (e.g. an API key). SampleRatio is
+// the share of rounds traced.
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled" env:"PICOCLAW_TRACING_ENABLED"`
+	Endpoint    string            `json:"endpoint" env:"PICOCLAW_TRACING_ENDPOINT"`
+	Headers     map[string]string `json:"headers"`
+	ServiceName string            `json:"service_name" env:"PICOCLAW_TRACING_SERVICE_NAME"`
+	SampleRatio float64           `json:"sample_ratio" env:"PICOCLAW_TRACING_SAMPLE_RATIO"`
+}
+
+// EgressConfig limits the hosts tools connect to when following a link
+// they did not choose: URLs given to web_fetch and summarize, news feeds,
+// and download URLs from Google Drive and Photos. Allow, when set, is the
+// only domains links may lead to (subdomains included; it does not apply
+// to Google downloads); Deny is never reached. BlockPrivate refuses
+// loopback, LAN and link-local addresses, also when a public name
+// resolves to one. MaxRedirects bounds the redirects followed.
+type EgressConfig struct {
+	Allow        FlexibleStringSlice `json:"allow" env:"PICOCLAW_EGRESS_ALLOW"`
+	Deny         FlexibleStringSlice `json:"deny" env:"PICOCLAW_EGRESS_DENY"`
+	BlockPrivate bool                `json:"block_private" env:"PICOCLAW_EGRESS_BLOCK_PRIVATE"`
+	MaxRedirects int                 `json:"max_redirects" env:"PICOCLAW_EGRESS_MAX_REDIRECTS"`
+}
+
+// ScreeningConfig checks email attachments before picoclaw saves them,
+// uploads them to Drive or copies them elsewhere. Attachments over
+// MaxSizeMB (0 for no limit), with a Block extension, or without an Allow
+// one when Allow is set are held back without being downloaded. ClamAV,
+// a clamd socket (a path, "unix:<path>" or host:port), scans the
+// contents, and with VirusTotalAPIKey the file's hash is looked up on
+// VirusTotal; a file either flags, or that cannot be checked, is held
+// back too.
+type ScreeningConfig struct {
+	MaxSizeMB        int                 `json:"max_size_mb" env:"PICOCLAW_SCREENING_MAX_SIZE_MB"`
+	Block            FlexibleStringSlice `json:"block" env:"PICOCLAW_SCREENING_BLOCK"`
+	Allow            FlexibleStringSlice `json:"allow" env:"PICOCLAW_SCREENING_ALLOW"`
+	ClamAV           string              `json:"clamav" env:"PICOCLAW_SCREENING_CLAMAV"`
+	VirusTotalAPIKey string              `json:"virustotal_api_key" env:"PICOCLAW_SCREENING_VIRUSTOTAL_API_KEY"`
+}
+
+// DebugConfig turns on recording of the HTTP calls each tool call makes,
+// and of whole agent rounds, to reproduce bugs offline. Recordings have
+// secrets stripped from HTTP traffic but keep message and file contents,
+// so leave it off outside debugging.
+type DebugConfig struct {
+	RecordHTTP bool `json:"record_http" env:"PICOCLAW_DEBUG_RECORD_HTTP"`
+	// RecordDir defaults to debug/http in the workspace
+	RecordDir string `json:"record_dir" env:"PICOCLAW_DEBUG_RECORD_DIR"`
+	// RecordRounds saves each round that calls a tool (message, model
+	// answers, tool results and their HTTP traffic) to debug/rounds in the
+	// workspace, for picoclaw replay
+	RecordRounds bool `json:"record_rounds" env:"PICOCLAW_DEBUG_RECORD_ROUNDS"`
+}
+
 type ProviderConfig struct {
 	APIKey      string `json:"api_key" env:"PICOCLAW_PROVIDERS_{{.Name}}_API_KEY"`
 	APIBase     string `json:"api_base" env:"PICOCLAW_PROVIDERS_{{.Name}}_API_BASE"`
@@ -191,9 +476,157 @@ type ProviderConfig struct {
 	ConnectMode string `json:"connect_mode,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_CONNECT_MODE"` //only for Github Copilot, `stdio` or `grpc`
 }
 
+// GatewayConfig is the HTTP listener for health checks and webhooks.
+// Metrics adds a Prometheus /metrics endpoint on it; Admin adds the web
+// dashboard under /admin/. WatchConfig reloads the config file when it
+// changes.
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host        string      `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port        int         `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Metrics     bool        `json:"metrics" env:"PICOCLAW_GATEWAY_METRICS"`
+	Admin       AdminConfig `json:"admin"`
+	WatchConfig bool        `json:"watch_config" env:"PICOCLAW_GATEWAY_WATCH_CONFIG"`
+	// ResumeWork journals messages being handled and replies not yet sent
+	// (needs sqlite3), so work cut short by a crash, power loss or shutdown
+	// is picked up on the next start. ShutdownTimeoutSeconds bounds how
+	// long a shutdown waits for the round in progress.
+	ResumeWork             bool           `json:"resume_work" env:"PICOCLAW_GATEWAY_RESUME_WORK"`
+	ShutdownTimeoutSeconds int            `json:"shutdown_timeout_seconds" env:"PICOCLAW_GATEWAY_SHUTDOWN_TIMEOUT_SECONDS"`
+	Watchdog               WatchdogConfig `json:"watchdog"`
+	Events                 EventsConfig   `json:"events"`
+}
+
+// EventsConfig opens POST /events on the gateway, for external systems
+// (Home Assistant, a CI server) to post events that the event rules in
+// automation files turn into chat notifications. Each source has its own
+// token, sent as "Authorization: Bearer <token>", which also names it.
+type EventsConfig struct {
+	Enabled bool                `json:"enabled" env:"PICOCLAW_GATEWAY_EVENTS_ENABLED"`
+	Sources []EventSourceConfig `json:"sources,omitempty"`
+}
+
+type EventSourceConfig struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// WatchdogConfig supervises channel connections: each is checked every
+// CheckSeconds and restarted when the check fails, waiting up to
+// MaxBackoffSeconds between attempts. Owners are alerted on another
+// channel after AlertAfter failed checks in a row.
+type WatchdogConfig struct {
+	Enabled           bool `json:"enabled" env:"PICOCLAW_GATEWAY_WATCHDOG_ENABLED"`
+	CheckSeconds      int  `json:"check_seconds" env:"PICOCLAW_GATEWAY_WATCHDOG_CHECK_SECONDS"`
+	MaxBackoffSeconds int  `json:"max_backoff_seconds" env:"PICOCLAW_GATEWAY_WATCHDOG_MAX_BACKOFF_SECONDS"`
+	AlertAfter        int  `json:"alert_after" env:"PICOCLAW_GATEWAY_WATCHDOG_ALERT_AFTER"`
+}
+
+// QueueConfig limits inbound processing. Each chat's messages are
+// answered in order, one round at a time, and at most MaxConcurrent rounds
+// run across chats. Messages a chat sends less than CoalesceMillis apart,
+// or while its last round runs, are answered together in one round; past
+// MaxPending waiting messages the rest are dropped with a notice.
+type QueueConfig struct {
+	MaxConcurrent  int `json:"max_concurrent" env:"PICOCLAW_QUEUE_MAX_CONCURRENT"`
+	CoalesceMillis int `json:"coalesce_ms" env:"PICOCLAW_QUEUE_COALESCE_MS"`
+	MaxPending     int `json:"max_pending" env:"PICOCLAW_QUEUE_MAX_PENDING"`
+}
+
+// OfflineConfig is offline mode. The connection is probed every
+// CheckSeconds by dialing Targets (host:port, public resolvers by
+// default). While it is down only tools that work locally run, changes
+// other tools were asked for wait for the connection, and Model, when set,
+// answers through the vllm provider (e.g. a local Ollama); without it
+// messages are answered once the connection is back.
+type OfflineConfig struct {
+	Enabled      bool                `json:"enabled" env:"PICOCLAW_OFFLINE_ENABLED"`
+	CheckSeconds int                 `json:"check_seconds" env:"PICOCLAW_OFFLINE_CHECK_SECONDS"`
+	Targets      FlexibleStringSlice `json:"targets" env:"PICOCLAW_OFFLINE_TARGETS"`
+	Model        string              `json:"model" env:"PICOCLAW_OFFLINE_MODEL"`
+}
+
+// LocalOnlyConfig is data residency for sensitive chats. Chats listed
+// here ("channel:chat_id"), and those that turned /local on, are only
+// ever answered by Model through the vllm provider (offline.model when
+// empty), and tools may not send what is said in them to online
+// services.
+type LocalOnlyConfig struct {
+	Model string              `json:"model" env:"PICOCLAW_LOCAL_ONLY_MODEL"`
+	Chats FlexibleStringSlice `json:"chats" env:"PICOCLAW_LOCAL_ONLY_CHATS"`
+}
+
+// OutagesConfig tracks whether the services picoclaw uses are up. Each
+// is probed every CheckSeconds, and every quarter of that while down;
+// calls failing with server errors or timeouts count too. A tool failing
+// while its service is down is reported as an outage, and changes asked
+// for in a chat are made once the service is back.
+type OutagesConfig struct {
+	Enabled      bool `json:"enabled" env:"PICOCLAW_OUTAGES_ENABLED"`
+	CheckSeconds int  `json:"check_seconds" env:"PICOCLAW_OUTAGES_CHECK_SECONDS"`
+}
+
+// WebhooksConfig posts agent events as signed JSON to Endpoints.
+// IncludeContent adds the text of messages and replies to
+// message.processed events; without it they only say who and where.
+type WebhooksConfig struct {
+	Enabled        bool                    `json:"enabled" env:"PICOCLAW_WEBHOOKS_ENABLED"`
+	IncludeContent bool                    `json:"include_content" env:"PICOCLAW_WEBHOOKS_INCLUDE_CONTENT"`
+	Endpoints      []WebhookEndpointConfig `json:"endpoints,omitempty"`
+}
+
+// WebhookEndpointConfig is one URL events are posted to. Secret signs
+// them (HMAC-SHA256); Events limits the types sent, all when empty.
+type WebhookEndpointConfig struct {
+	URL    string              `json:"url"`
+	Secret string              `json:"secret,omitempty"`
+	Events FlexibleStringSlice `json:"events,omitempty"`
+}
+
+// MemoryConfig limits how long memories about users are kept, in days
+// per category ("health": 90); categories not listed, or 0, are kept
+// until forgotten. Users can choose otherwise for their own chat.
+type MemoryConfig struct {
+	RetentionDays map[string]int `json:"retention_days,omitempty"`
+}
+
+// AutomationsConfig reads schedules, message templates and rules from
+// the YAML files in Dir, reloading them when they change.
+type AutomationsConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_AUTOMATIONS_ENABLED"`
+	Dir     string `json:"dir" env:"PICOCLAW_AUTOMATIONS_DIR"`
+}
+
+// ResourcesConfig limits how many heavy operations run at once. With
+// MaxHeavyOps 0 the limit is sized from the RAM and CPUs found at
+// startup. Work over the limit waits up to MaxWaitSeconds and is then
+// turned down.
+type ResourcesConfig struct {
+	MaxHeavyOps    int `json:"max_heavy_ops" env:"PICOCLAW_RESOURCES_MAX_HEAVY_OPS"`
+	MaxWaitSeconds int `json:"max_wait_seconds" env:"PICOCLAW_RESOURCES_MAX_WAIT_SECONDS"`
+}
+
+// DiskConfig is the disk budget for received media, artifacts, previews
+// and transfer spools. When they take more than BudgetMB, or the disk has
+// less than MinFreeMB free, the least recently used files are removed.
+// 0 turns either limit off.
+type DiskConfig struct {
+	BudgetMB  int `json:"budget_mb" env:"PICOCLAW_DISK_BUDGET_MB"`
+	MinFreeMB int `json:"min_free_mb" env:"PICOCLAW_DISK_MIN_FREE_MB"`
+}
+
+// ImagesConfig adapts outgoing photos. Images a channel refuses for their
+// type or size are sent as a resized JPEG copy where one can be made;
+// StripLocation also removes the GPS position from every JPEG photo sent
+// to a chat.
+type ImagesConfig struct {
+	StripLocation bool `json:"strip_location" env:"PICOCLAW_IMAGES_STRIP_LOCATION"`
+}
+
+// AdminConfig enables the admin dashboard. Password is required; the
+// browser asks for it with HTTP basic auth (any user name).
+type AdminConfig struct {
+	Enabled  bool   `json:"enabled" env:"PICOCLAW_GATEWAY_ADMIN_ENABLED"`
+	Password string `json:"password" env:"PICOCLAW_GATEWAY_ADMIN_PASSWORD"`
 }
 
 type BraveConfig struct {
@@ -223,9 +656,569 @@ type CronToolsConfig struct {
 	ExecTimeoutMinutes int `json:"exec_timeout_minutes" env:"PICOCLAW_TOOLS_CRON_EXEC_TIMEOUT_MINUTES"` // 0 means no timeout
 }
 
+type JiraConfig struct {
+	BaseURL  string `json:"base_url" env:"PICOCLAW_TOOLS_ISSUES_JIRA_BASE_URL"`
+	Email    string `json:"email" env:"PICOCLAW_TOOLS_ISSUES_JIRA_EMAIL"`
+	APIToken string `json:"api_token" env:"PICOCLAW_TOOLS_ISSUES_JIRA_API_TOKEN"`
+}
+
+type LinearConfig struct {
+	APIKey string `json:"api_key" env:"PICOCLAW_TOOLS_ISSUES_LINEAR_API_KEY"`
+}
+
+// IssueProjectConfig maps a short project alias to a tracker project.
+// For Jira, Project is the project key (e.g. "OPS"); for Linear it is the team key.
+type IssueProjectConfig struct {
+	Name      string   `json:"name"`
+	Provider  string   `json:"provider"` // "jira" or "linear"
+	Project   string   `json:"project"`
+	IssueType string   `json:"issue_type,omitempty"` // Jira only, default "Task"
+	Labels    []string `json:"labels,omitempty"`
+}
+
+type IssuesToolsConfig struct {
+	Enabled  bool                 `json:"enabled" env:"PICOCLAW_TOOLS_ISSUES_ENABLED"`
+	Jira     JiraConfig           `json:"jira"`
+	Linear   LinearConfig         `json:"linear"`
+	Projects []IssueProjectConfig `json:"projects"`
+}
+
+type FinanceToolsConfig struct {
+	Enabled           bool   `json:"enabled" env:"PICOCLAW_TOOLS_FINANCE_ENABLED"`
+	Currency          string `json:"currency" env:"PICOCLAW_TOOLS_FINANCE_CURRENCY"`
+	StockProvider     string `json:"stock_provider" env:"PICOCLAW_TOOLS_FINANCE_STOCK_PROVIDER"`   // "yahoo"
+	CryptoProvider    string `json:"crypto_provider" env:"PICOCLAW_TOOLS_FINANCE_CRYPTO_PROVIDER"` // "coingecko"
+	AlertCheckMinutes int    `json:"alert_check_minutes" env:"PICOCLAW_TOOLS_FINANCE_ALERT_CHECK_MINUTES"`
+}
+
+type TrackingToolsConfig struct {
+	Enabled             bool   `json:"enabled" env:"PICOCLAW_TOOLS_TRACKING_ENABLED"`
+	AviationStackAPIKey string `json:"aviationstack_api_key" env:"PICOCLAW_TOOLS_TRACKING_AVIATIONSTACK_API_KEY"`
+	ParcelProvider      string `json:"parcel_provider" env:"PICOCLAW_TOOLS_TRACKING_PARCEL_PROVIDER"` // "aftership" or "17track"
+	AfterShipAPIKey     string `json:"aftership_api_key" env:"PICOCLAW_TOOLS_TRACKING_AFTERSHIP_API_KEY"`
+	SeventeenTrackKey   string `json:"17track_api_key" env:"PICOCLAW_TOOLS_TRACKING_17TRACK_API_KEY"`
+	CheckMinutes        int    `json:"check_minutes" env:"PICOCLAW_TOOLS_TRACKING_CHECK_MINUTES"`
+}
+
+type NewsToolsConfig struct {
+	Enabled    bool                `json:"enabled" env:"PICOCLAW_TOOLS_NEWS_ENABLED"`
+	NewsAPIKey string              `json:"newsapi_key" env:"PICOCLAW_TOOLS_NEWS_NEWSAPI_KEY"`
+	GDELT      bool                `json:"gdelt" env:"PICOCLAW_TOOLS_NEWS_GDELT"`
+	Feeds      FlexibleStringSlice `json:"feeds" env:"PICOCLAW_TOOLS_NEWS_FEEDS"`
+	MaxResults int                 `json:"max_results" env:"PICOCLAW_TOOLS_NEWS_MAX_RESULTS"`
+}
+
+type CardDAVConfig struct {
+	URL      string `json:"url" env:"PICOCLAW_TOOLS_CONTACTS_CARDDAV_URL"`
+	Username string `json:"username" env:"PICOCLAW_TOOLS_CONTACTS_CARDDAV_USERNAME"`
+	Password string `json:"password" env:"PICOCLAW_TOOLS_CONTACTS_CARDDAV_PASSWORD"`
+}
+
+type ContactsToolsConfig struct {
+	Enabled bool          `json:"enabled" env:"PICOCLAW_TOOLS_CONTACTS_ENABLED"`
+	Google  bool          `json:"google" env:"PICOCLAW_TOOLS_CONTACTS_GOOGLE"`
+	CardDAV CardDAVConfig `json:"carddav"`
+}
+
 type ToolsConfig struct {
-	Web  WebToolsConfig  `json:"web"`
-	Cron CronToolsConfig `json:"cron"`
+	Web          WebToolsConfig          `json:"web"`
+	Cron         CronToolsConfig         `json:"cron"`
+	Issues       IssuesToolsConfig       `json:"issues"`
+	Finance      FinanceToolsConfig      `json:"finance"`
+	Tracking     TrackingToolsConfig     `json:"tracking"`
+	News         NewsToolsConfig         `json:"news"`
+	Contacts     ContactsToolsConfig     `json:"contacts"`
+	Briefing     BriefingToolsConfig     `json:"briefing"`
+	Expenses     ExpensesToolsConfig     `json:"expenses"`
+	Lists        ListsToolsConfig        `json:"lists"`
+	Summarize    SummarizeToolsConfig    `json:"summarize"`
+	Podcasts     PodcastsToolsConfig     `json:"podcasts"`
+	Photos       PhotosToolsConfig       `json:"photos"`
+	Gmail        GmailToolsConfig        `json:"gmail"`
+	Drive        DriveToolsConfig        `json:"drive"`
+	Browse       BrowseToolsConfig       `json:"browse"`
+	Security     SecurityToolsConfig     `json:"security_review"`
+	Keep         KeepToolsConfig         `json:"keep"`
+	Backup       BackupToolsConfig       `json:"backup"`
+	Reports      ReportsToolsConfig      `json:"reports"`
+	LocalPhotos  LocalPhotosToolsConfig  `json:"local_photos"`
+	Events       EventsToolsConfig       `json:"events"`
+	TravelTime   TravelTimeToolsConfig   `json:"travel_time"`
+	Transit      TransitToolsConfig      `json:"transit"`
+	Invoices     InvoicesToolsConfig     `json:"invoices"`
+	Itinerary    ItineraryToolsConfig    `json:"itinerary"`
+	Bills        BillsToolsConfig        `json:"bills"`
+	Search       SearchToolsConfig       `json:"search"`
+	Transfers    TransfersToolsConfig    `json:"transfers"`
+	Files        FilesToolsConfig        `json:"files"`
+	MediaArchive MediaArchiveToolsConfig `json:"media_archive"`
+	Identity     IdentityToolsConfig     `json:"identity"`
+	Critical     CriticalToolsConfig     `json:"critical"`
+	MeetingNotes MeetingNotesToolsConfig `json:"meeting_notes"`
+	GoogleAPI    GoogleAPIToolsConfig    `json:"google_api"`
+	Attachments  AttachmentsToolsConfig  `json:"attachments"`
+	Screenshots  ScreenshotsToolsConfig  `json:"screenshots"`
+
+	// Policies adjusts individual tools by name, e.g. "exec" or
+	// "local_photos"; see ToolPolicyConfig
+	Policies map[string]ToolPolicyConfig `json:"policies,omitempty"`
+}
+
+// ToolPolicyConfig enables, limits and configures one tool. Enabled false
+// removes the tool; Channels and Users, when set, limit it to those
+// channels and sender IDs. Settings are passed to the tool, e.g.
+// {"default_album": "Family"} for local_photos or {"max_bytes": 1048576}
+// for read_file.
+type ToolPolicyConfig struct {
+	Enabled  *bool                  `json:"enabled,omitempty"`
+	Channels FlexibleStringSlice    `json:"channels,omitempty"`
+	Users    FlexibleStringSlice    `json:"users,omitempty"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// TransfersToolsConfig tunes Google Drive and Photos uploads and
+// downloads. Large uploads go in chunks of ChunkMB that are resumed after
+// a failure, up to Retries times in a row; MaxKBps caps the combined rate
+// of all transfers (0 for no cap), to leave room on a slow uplink.
+//
+// Windows limit scheduled backups to Drive to times of day, such as
+// overnight, each with its own cap; without windows they run whenever
+// they are due.
+//
+// Enabled adds the transfer tool, which copies files between Drive,
+// Photos, Gmail attachments, the files storage and the Backends named
+// here, such as {"dropbox": {"backend": "dropbox", "token": "..."}}.
+type TransfersToolsConfig struct {
+	ChunkMB  int                      `json:"chunk_mb" env:"PICOCLAW_TOOLS_TRANSFERS_CHUNK_MB"`
+	MaxKBps  int                      `json:"max_kbps" env:"PICOCLAW_TOOLS_TRANSFERS_MAX_KBPS"`
+	Retries  int                      `json:"retries" env:"PICOCLAW_TOOLS_TRANSFERS_RETRIES"`
+	Windows  []TransferWindowConfig   `json:"windows,omitempty"`
+	Enabled  bool                     `json:"enabled" env:"PICOCLAW_TOOLS_TRANSFERS_ENABLED"`
+	Backends map[string]StorageConfig `json:"backends,omitempty"`
+}
+
+// TransferWindowConfig is a daily period, From to To as "HH:MM" in the
+// device's local time, when background uploads may run at up to MaxKBps
+// (0 for only the overall cap). A To before From spans midnight.
+type TransferWindowConfig struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	MaxKBps int    `json:"max_kbps,omitempty"`
+}
+
+// SearchToolsConfig controls search_everything. Sources is any of gmail,
+// drive, photos, calendar, notes and memory; the Google ones are skipped
+// when Google auth is not configured.
+type SearchToolsConfig struct {
+	Enabled bool                `json:"enabled" env:"PICOCLAW_TOOLS_SEARCH_ENABLED"`
+	Sources FlexibleStringSlice `json:"sources" env:"PICOCLAW_TOOLS_SEARCH_SOURCES"`
+}
+
+// TravelTimeToolsConfig works out the travel time to calendar events with
+// a location, from the meeting before or from Home, using the Google Maps
+// Distance Matrix API with MapsAPIKey. Events added from email get a note
+// of the time, and a "Travel to" block before them with Buffers; meetings
+// too far apart to make in time are warned about. Mode is driving,
+// transit, walking or bicycling. Needs the events tools.
+type TravelTimeToolsConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_TRAVEL_TIME_ENABLED"`
+	MapsAPIKey string `json:"maps_api_key" env:"PICOCLAW_TOOLS_TRAVEL_TIME_MAPS_API_KEY"`
+	Home       string `json:"home" env:"PICOCLAW_TOOLS_TRAVEL_TIME_HOME"`
+	Mode       string `json:"mode" env:"PICOCLAW_TOOLS_TRAVEL_TIME_MODE"`
+	Buffers    bool   `json:"buffers" env:"PICOCLAW_TOOLS_TRAVEL_TIME_BUFFERS"`
+}
+
+// TransitToolsConfig enables the transit tool: next departures from the
+// GTFS timetable at GTFS (a feed zip or its unzipped folder), and trips
+// planned with the Google Routes API and RoutesAPIKey (default: the
+// travel_time key), from Home to Work unless said otherwise (Home
+// defaults to travel_time's). Leave-now alerts for calendar events with
+// a place check the calendar every CheckMinutes and come LeadMinutes
+// before it is time to leave; they need the events tools.
+type TransitToolsConfig struct {
+	Enabled      bool   `json:"enabled" env:"PICOCLAW_TOOLS_TRANSIT_ENABLED"`
+	GTFS         string `json:"gtfs" env:"PICOCLAW_TOOLS_TRANSIT_GTFS"`
+	RoutesAPIKey string `json:"routes_api_key" env:"PICOCLAW_TOOLS_TRANSIT_ROUTES_API_KEY"`
+	Home         string `json:"home" env:"PICOCLAW_TOOLS_TRANSIT_HOME"`
+	Work         string `json:"work" env:"PICOCLAW_TOOLS_TRANSIT_WORK"`
+	LeadMinutes  int    `json:"lead_minutes" env:"PICOCLAW_TOOLS_TRANSIT_LEAD_MINUTES"`
+	CheckMinutes int    `json:"check_minutes" env:"PICOCLAW_TOOLS_TRANSIT_CHECK_MINUTES"`
+}
+
+// InvoiceRuleConfig selects invoice emails by Gmail query. Attachments is
+// an optional regexp on attachment names (default: PDFs and images).
+type InvoiceRuleConfig struct {
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	Vendor      string `json:"vendor"`
+	Category    string `json:"category"`
+	Attachments string `json:"attachments"`
+}
+
+// InvoicesToolsConfig controls the invoice inbox pipeline (needs Google
+// auth). Invoices are saved to DriveFolderID (My Drive when empty) and
+// logged to the expense ledger when LogExpenses is set.
+type InvoicesToolsConfig struct {
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_TOOLS_INVOICES_ENABLED"`
+	DriveFolderID string              `json:"drive_folder_id" env:"PICOCLAW_TOOLS_INVOICES_DRIVE_FOLDER_ID"`
+	LogExpenses   bool                `json:"log_expenses" env:"PICOCLAW_TOOLS_INVOICES_LOG_EXPENSES"`
+	Rules         []InvoiceRuleConfig `json:"rules"`
+}
+
+// ItineraryToolsConfig controls the itinerary builder, which reads travel
+// confirmations from Gmail into a Google Doc per trip (needs Google auth).
+// Query replaces the Gmail search for confirmations; Docs go to
+// DriveFolderID (My Drive when empty). Model overrides the agent model
+// for reading the emails.
+type ItineraryToolsConfig struct {
+	Enabled       bool   `json:"enabled" env:"PICOCLAW_TOOLS_ITINERARY_ENABLED"`
+	Model         string `json:"model" env:"PICOCLAW_TOOLS_ITINERARY_MODEL"`
+	Query         string `json:"query" env:"PICOCLAW_TOOLS_ITINERARY_QUERY"`
+	DriveFolderID string `json:"drive_folder_id" env:"PICOCLAW_TOOLS_ITINERARY_DRIVE_FOLDER_ID"`
+}
+
+// BillsToolsConfig controls the bill tracker, which reads bills and
+// invoices from Gmail with their amounts and due dates (needs Google
+// auth). Query replaces the Gmail search for bills; reminders go out
+// RemindDays before a bill is due. Model overrides the agent model for
+// reading the emails.
+type BillsToolsConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_BILLS_ENABLED"`
+	Model      string `json:"model" env:"PICOCLAW_TOOLS_BILLS_MODEL"`
+	Query      string `json:"query" env:"PICOCLAW_TOOLS_BILLS_QUERY"`
+	RemindDays int    `json:"remind_days" env:"PICOCLAW_TOOLS_BILLS_REMIND_DAYS"`
+}
+
+// EventsToolsConfig controls extract_events, which turns emails into
+// Google Calendar events, and calendar_import, which creates them from a
+// Sheet or CSV schedule (both need Google auth). Model overrides the agent
+// model for extraction.
+type EventsToolsConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_EVENTS_ENABLED"`
+	Model      string `json:"model" env:"PICOCLAW_TOOLS_EVENTS_MODEL"`
+	CalendarID string `json:"calendar_id" env:"PICOCLAW_TOOLS_EVENTS_CALENDAR_ID"`
+}
+
+// LocalPhotosToolsConfig indexes photos on device storage. Directories are
+// scanned recursively; a missing one (card not inserted) is skipped. Upload
+// to Google Photos also needs tools.photos.enabled.
+type LocalPhotosToolsConfig struct {
+	Enabled     bool                `json:"enabled" env:"PICOCLAW_TOOLS_LOCAL_PHOTOS_ENABLED"`
+	Directories FlexibleStringSlice `json:"directories" env:"PICOCLAW_TOOLS_LOCAL_PHOTOS_DIRECTORIES"`
+}
+
+// BackupToolsConfig enables Drive/Photos backups (needs Google auth).
+// Destinations are the directories backups may be written under, e.g. a
+// local disk or the mount point of a NAS share.
+type BackupToolsConfig struct {
+	Enabled      bool                `json:"enabled" env:"PICOCLAW_TOOLS_BACKUP_ENABLED"`
+	Destinations FlexibleStringSlice `json:"destinations" env:"PICOCLAW_TOOLS_BACKUP_DESTINATIONS"`
+}
+
+// ReportsToolsConfig enables scheduled reports (email stats, expenses,
+// backup status) saved as Google Docs or Sheets (needs Google auth), in
+// DriveFolderID or My Drive when empty. Format is "doc" or "sheet".
+type ReportsToolsConfig struct {
+	Enabled       bool   `json:"enabled" env:"PICOCLAW_TOOLS_REPORTS_ENABLED"`
+	DriveFolderID string `json:"drive_folder_id" env:"PICOCLAW_TOOLS_REPORTS_DRIVE_FOLDER_ID"`
+	Format        string `json:"format" env:"PICOCLAW_TOOLS_REPORTS_FORMAT"`
+}
+
+// PhotosToolsConfig enables the photos tools. They use Google Photos (and
+// need Google auth) unless Storage names another backend, in which case
+// the photos tool browses that instead and albums are its top-level
+// folders.
+type PhotosToolsConfig struct {
+	Enabled bool          `json:"enabled" env:"PICOCLAW_TOOLS_PHOTOS_ENABLED"`
+	Storage StorageConfig `json:"storage" envPrefix:"PICOCLAW_TOOLS_PHOTOS_STORAGE_"`
+	// Upload downscales JPEG photos before they go to Google Photos
+	Upload PhotosUploadConfig `json:"upload"`
+}
+
+// PhotosUploadConfig saves Google account storage on uploads. MaxDimension
+// bounds a photo's longer side in pixels and Quality is the JPEG quality
+// (1-100) it is re-encoded at; 0 leaves either as it is. The photo's EXIF
+// data (date, camera, location) is kept.
+type PhotosUploadConfig struct {
+	MaxDimension int `json:"max_dimension" env:"PICOCLAW_TOOLS_PHOTOS_UPLOAD_MAX_DIMENSION"`
+	Quality      int `json:"quality" env:"PICOCLAW_TOOLS_PHOTOS_UPLOAD_QUALITY"`
+}
+
+// IdentityToolsConfig lets users link their accounts on other channels
+// (and their email address) with a one-time code, so their profile,
+// conversation and quotas follow them. Email codes go out through Gmail.
+type IdentityToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_IDENTITY_ENABLED"`
+}
+
+// CriticalToolsConfig enables critical reminders, which fall back to
+// other channels when the chat fails or the user does not reply within
+// AckMinutes. Email fallbacks go through Gmail; SMS ones need an SMS
+// account.
+type CriticalToolsConfig struct {
+	Enabled    bool      `json:"enabled" env:"PICOCLAW_TOOLS_CRITICAL_ENABLED"`
+	AckMinutes int       `json:"ack_minutes" env:"PICOCLAW_TOOLS_CRITICAL_ACK_MINUTES"`
+	SMS        SMSConfig `json:"sms" envPrefix:"PICOCLAW_TOOLS_CRITICAL_SMS_"`
+}
+
+// MeetingNotesToolsConfig asks for notes after calendar meetings end
+// (needs Google auth) and keeps them in workspace/meetings, and with Docs
+// also as Google Docs in FolderID. Schedules check for ended meetings
+// every CheckMinutes. Emailing notes to attendees needs the Gmail tools.
+type MeetingNotesToolsConfig struct {
+	Enabled      bool   `json:"enabled" env:"PICOCLAW_TOOLS_MEETING_NOTES_ENABLED"`
+	CalendarID   string `json:"calendar_id" env:"PICOCLAW_TOOLS_MEETING_NOTES_CALENDAR_ID"`
+	Docs         bool   `json:"docs" env:"PICOCLAW_TOOLS_MEETING_NOTES_DOCS"`
+	FolderID     string `json:"folder_id" env:"PICOCLAW_TOOLS_MEETING_NOTES_FOLDER_ID"`
+	CheckMinutes int    `json:"check_minutes" env:"PICOCLAW_TOOLS_MEETING_NOTES_CHECK_MINUTES"`
+}
+
+// AttachmentsToolsConfig enables the attachment inbox: files users send
+// are classified (receipt, ID document, contract, photo, document) and a
+// place to file them suggested, learned from where each user filed them
+// before. Filing to Drive or Photos needs those tools enabled, logging
+// receipts the expenses tool, and reading images OCR.
+type AttachmentsToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_ATTACHMENTS_ENABLED"`
+}
+
+// ScreenshotsToolsConfig enables the screenshot tool: screenshots users
+// send (invitations, bookings, bills, receipts) are read with OCR and the
+// model, with Model overriding the agent model, and the fitting actions
+// offered as one-tap choices. Adding to the calendar needs the events
+// tools, logging expenses the expenses tool.
+type ScreenshotsToolsConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_TOOLS_SCREENSHOTS_ENABLED"`
+	Model   string `json:"model" env:"PICOCLAW_TOOLS_SCREENSHOTS_MODEL"`
+}
+
+// GoogleAPIToolsConfig enables the google_api tool, which calls Google
+// REST endpoints directly for features no other tool covers, limited to
+// Endpoints. Calls use the account's Google token, so its scopes still
+// apply: an endpoint of an API the token has no scope for fails.
+type GoogleAPIToolsConfig struct {
+	Enabled   bool                      `json:"enabled" env:"PICOCLAW_TOOLS_GOOGLE_API_ENABLED"`
+	Endpoints []GoogleAPIEndpointConfig `json:"endpoints"`
+}
+
+// GoogleAPIEndpointConfig allows one method on one URL template, written
+// as OpenAPI paths are: {name} stands for one path segment, e.g.
+// {"method": "GET", "url": "https://tasks.googleapis.com/tasks/v1/lists/{tasklist}/tasks"}.
+// Description tells the model what the endpoint is for.
+type GoogleAPIEndpointConfig struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// SMSConfig is a Twilio account to send text messages from. From is one
+// of its phone numbers, with country code.
+type SMSConfig struct {
+	AccountSID string `json:"account_sid" env:"ACCOUNT_SID"`
+	AuthToken  string `json:"auth_token" env:"AUTH_TOKEN"`
+	From       string `json:"from" env:"FROM"`
+}
+
+// MediaArchiveToolsConfig uploads the media people send in chosen chats
+// to Google Photos or Drive as it arrives (needs Google auth).
+type MediaArchiveToolsConfig struct {
+	Enabled bool                     `json:"enabled" env:"PICOCLAW_TOOLS_MEDIA_ARCHIVE_ENABLED"`
+	Rules   []MediaArchiveRuleConfig `json:"rules"`
+}
+
+// MediaArchiveRuleConfig archives the media of the Chats (all chats when
+// empty) on Channel (any when empty) to Destination, "photos" or "drive".
+// Album (photos), Folder (drive, a path under My Drive) and Name (the file
+// name without extension, default "{date}_{time}_{channel}_{n}") may use
+// {date}, {time}, {year}, {month}, {day}, {channel}, {chat}, {sender} and
+// {n}, e.g. folder "Family chat/{year}/{month}".
+type MediaArchiveRuleConfig struct {
+	Channel     string              `json:"channel"`
+	Chats       FlexibleStringSlice `json:"chats"`
+	Destination string              `json:"destination"`
+	Album       string              `json:"album"`
+	Folder      string              `json:"folder"`
+	Name        string              `json:"name"`
+}
+
+// FilesToolsConfig enables the files tool over the backend in Storage, so
+// users outside Google can list, search, upload and download their files.
+type FilesToolsConfig struct {
+	Enabled bool          `json:"enabled" env:"PICOCLAW_TOOLS_FILES_ENABLED"`
+	Storage StorageConfig `json:"storage" envPrefix:"PICOCLAW_TOOLS_FILES_STORAGE_"`
+}
+
+// StorageConfig selects where files live: "local" (Root, a folder or a
+// mounted share), "webdav" (URL, Username, Password; Nextcloud, ownCloud
+// and NAS boxes), "s3" (Endpoint, Region, Bucket, Prefix, AccessKey,
+// SecretKey; AWS, MinIO, B2, R2 and the like) or "dropbox" (Token, an
+// access token of a Dropbox app).
+type StorageConfig struct {
+	Backend   string `json:"backend" env:"BACKEND"`
+	Root      string `json:"root" env:"ROOT"`
+	URL       string `json:"url" env:"URL"`
+	Username  string `json:"username" env:"USERNAME"`
+	Password  string `json:"password" env:"PASSWORD"`
+	Endpoint  string `json:"endpoint" env:"ENDPOINT"`
+	Region    string `json:"region" env:"REGION"`
+	Bucket    string `json:"bucket" env:"BUCKET"`
+	Prefix    string `json:"prefix" env:"PREFIX"`
+	AccessKey string `json:"access_key" env:"ACCESS_KEY"`
+	SecretKey string `json:"secret_key" env:"SECRET_KEY"`
+	Token     string `json:"token" env:"TOKEN"`
+}
+
+// GmailToolsConfig enables the gmail tool, which lists a message's
+// attachments and saves them to Drive, and sends mail. Sending needs the
+// https://www.googleapis.com/auth/gmail.send scope added to google.scopes;
+// archiving future mail after unsubscribing needs gmail.settings.basic,
+// and moving suspicious mail to spam needs gmail.modify.
+type GmailToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_GMAIL_ENABLED"`
+	// WaitingOn tracks sent emails awaiting a reply
+	WaitingOn WaitingOnConfig `json:"waiting_on"`
+	// Routes sends new mail to chats by label
+	Routes MailRoutesConfig `json:"routes"`
+}
+
+// WaitingOnConfig controls the waiting_on tracker, which watches sent
+// threads for a reply every CheckMinutes and nudges the user when none
+// came within DefaultDays (or the days given for a thread). AutoDraft
+// also drafts a follow-up in Gmail, which needs the gmail.compose scope.
+type WaitingOnConfig struct {
+	DefaultDays  int  `json:"default_days" env:"PICOCLAW_TOOLS_GMAIL_WAITING_ON_DEFAULT_DAYS"`
+	CheckMinutes int  `json:"check_minutes" env:"PICOCLAW_TOOLS_GMAIL_WAITING_ON_CHECK_MINUTES"`
+	AutoDraft    bool `json:"auto_draft" env:"PICOCLAW_TOOLS_GMAIL_WAITING_ON_AUTO_DRAFT"`
+}
+
+// MailRoutesConfig controls the mail_routes tool, which checks for new
+// mail every CheckMinutes in chats that have label rules.
+type MailRoutesConfig struct {
+	CheckMinutes int `json:"check_minutes" env:"PICOCLAW_TOOLS_GMAIL_ROUTES_CHECK_MINUTES"`
+}
+
+// DriveToolsConfig enables the drive tool, which reports what takes up
+// space in Google Drive, lists starred and recent files and triages the
+// files others shared. It needs the
+// drive.readonly scope; starring files picoclaw did not create needs
+// https://www.googleapis.com/auth/drive instead.
+type DriveToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_DRIVE_ENABLED"`
+}
+
+// BrowseToolsConfig enables the browse tool, which walks Google Drive
+// (when the drive tool is enabled) and the files storage (when enabled)
+// with numbered listings and commands like "open 3" and "download 2".
+type BrowseToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_BROWSE_ENABLED"`
+}
+
+// SecurityToolsConfig enables the security_review tool, which checks
+// Gmail forwarding and filters with the gmail.readonly scope, and the apps
+// connected to Drive when https://www.googleapis.com/auth/drive.apps.readonly
+// is added to google.scopes.
+type SecurityToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_SECURITY_REVIEW_ENABLED"`
+}
+
+// KeepToolsConfig enables the keep tool for Google Keep notes. The Keep
+// API is only available to Google Workspace accounts, and needs the
+// https://www.googleapis.com/auth/keep scope added to google.scopes.
+type KeepToolsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_KEEP_ENABLED"`
+}
+
+// SummarizeToolsConfig controls the summarize tool and its sibling
+// ask_file, which answers one question about a document. Model overrides
+// the agent model (a cheaper one is usually fine); Google enables Drive
+// files and Gmail messages as sources.
+type SummarizeToolsConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_TOOLS_SUMMARIZE_ENABLED"`
+	Model   string `json:"model" env:"PICOCLAW_TOOLS_SUMMARIZE_MODEL"`
+	Google  bool   `json:"google" env:"PICOCLAW_TOOLS_SUMMARIZE_GOOGLE"`
+}
+
+// PodcastsToolsConfig enables podcast subscriptions: new episodes are
+// transcribed with Groq (providers.groq.api_key) and summarized, checking
+// every CheckHours. Model overrides the agent model for the summaries and
+// answers, as for summarize. ffmpeg cuts long episodes into parts.
+type PodcastsToolsConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_PODCASTS_ENABLED"`
+	Model      string `json:"model" env:"PICOCLAW_TOOLS_PODCASTS_MODEL"`
+	CheckHours int    `json:"check_hours" env:"PICOCLAW_TOOLS_PODCASTS_CHECK_HOURS"`
+}
+
+// ListsToolsConfig enables named per-chat lists. Sync "google_tasks" mirrors
+// every list to a Google Tasks list so others in the household see it;
+// "caldav" mirrors them to task lists in the CalDAV calendar home, for
+// Apple Reminders or Nextcloud Tasks.
+type ListsToolsConfig struct {
+	Enabled bool         `json:"enabled" env:"PICOCLAW_TOOLS_LISTS_ENABLED"`
+	Sync    string       `json:"sync" env:"PICOCLAW_TOOLS_LISTS_SYNC"`
+	CalDAV  CalDAVConfig `json:"caldav"`
+}
+
+// CalDAVConfig points at a CalDAV calendar home, e.g.
+// https://cloud.example.com/remote.php/dav/calendars/ana/ on Nextcloud.
+// iCloud needs an app-specific password.
+type CalDAVConfig struct {
+	URL      string `json:"url" env:"PICOCLAW_TOOLS_LISTS_CALDAV_URL"`
+	Username string `json:"username" env:"PICOCLAW_TOOLS_LISTS_CALDAV_USERNAME"`
+	Password string `json:"password" env:"PICOCLAW_TOOLS_LISTS_CALDAV_PASSWORD"`
+}
+
+// ExpensesToolsConfig selects where expenses are kept: "sqlite" (a local
+// ledger in the workspace, needs the sqlite3 binary) or "google_sheets".
+type ExpensesToolsConfig struct {
+	Enabled       bool   `json:"enabled" env:"PICOCLAW_TOOLS_EXPENSES_ENABLED"`
+	Backend       string `json:"backend" env:"PICOCLAW_TOOLS_EXPENSES_BACKEND"`
+	SpreadsheetID string `json:"spreadsheet_id" env:"PICOCLAW_TOOLS_EXPENSES_SPREADSHEET_ID"`
+	Sheet         string `json:"sheet" env:"PICOCLAW_TOOLS_EXPENSES_SHEET"`
+	Currency      string `json:"currency" env:"PICOCLAW_TOOLS_EXPENSES_CURRENCY"`
+}
+
+// BriefingToolsConfig holds defaults for the daily briefing. Users override
+// them per chat when scheduling.
+type BriefingToolsConfig struct {
+	Enabled         bool                `json:"enabled" env:"PICOCLAW_TOOLS_BRIEFING_ENABLED"`
+	Time            string              `json:"time" env:"PICOCLAW_TOOLS_BRIEFING_TIME"`
+	Sections        FlexibleStringSlice `json:"sections" env:"PICOCLAW_TOOLS_BRIEFING_SECTIONS"`
+	WeatherLocation string              `json:"weather_location" env:"PICOCLAW_TOOLS_BRIEFING_WEATHER_LOCATION"`
+	NewsTopics      FlexibleStringSlice `json:"news_topics" env:"PICOCLAW_TOOLS_BRIEFING_NEWS_TOPICS"`
+}
+
+// GoogleScopePresets are the sets of Google scopes `picoclaw auth login
+// --provider google --scopes <preset>` asks for. read-only lets picoclaw
+// look but never send, write or change anything; standard, the default,
+// adds contacts, tasks, sheets, calendar events and the Drive files
+// picoclaw creates; full adds sending mail and changing any Drive file.
+// Tool actions that need a scope outside google.scopes are not offered.
+var GoogleScopePresets = map[string][]string{
+	"read-only": googleScopes("contacts.readonly", "spreadsheets.readonly", "tasks.readonly",
+		"drive.readonly", "gmail.readonly", "photoslibrary.readonly", "calendar.readonly"),
+	"standard": googleScopes("contacts", "spreadsheets", "tasks", "drive.readonly", "drive.file",
+		"gmail.readonly", "photoslibrary", "calendar.events"),
+	"full": googleScopes("contacts", "spreadsheets", "tasks", "drive", "gmail.readonly", "gmail.send",
+		"gmail.compose", "gmail.modify", "gmail.settings.basic", "photoslibrary", "calendar"),
+}
+
+// DefaultGoogleScopePreset is the preset of a new config.
+const DefaultGoogleScopePreset = "standard"
+
+func googleScopes(names ...string) []string {
+	scopes := make([]string, len(names))
+	for i, name := range names {
+		scopes[i] = "https://www.googleapis.com/auth/" + name
+	}
+	return scopes
+}
+
+// GoogleConfig holds the OAuth client used by `picoclaw auth login --provider google`
+// and by the Google-backed tools.
+type GoogleConfig struct {
+	ClientID     string              `json:"client_id" env:"PICOCLAW_GOOGLE_CLIENT_ID"`
+	ClientSecret string              `json:"client_secret" env:"PICOCLAW_GOOGLE_CLIENT_SECRET"`
+	Scopes       FlexibleStringSlice `json:"scopes" env:"PICOCLAW_GOOGLE_SCOPES"`
 }
 
 func DefaultConfig() *Config {
@@ -239,6 +1232,8 @@ func DefaultConfig() *Config {
 				MaxTokens:           8192,
 				Temperature:         0.7,
 				MaxToolIterations:   20,
+				LargeResultChars:    12000,
+				Onboarding:          true,
 			},
 		},
 		Channels: ChannelsConfig{
@@ -319,8 +1314,17 @@ func DefaultConfig() *Config {
 			ShengSuanYun: ProviderConfig{},
 		},
 		Gateway: GatewayConfig{
-			Host: "0.0.0.0",
-			Port: 18790,
+			Host:                   "0.0.0.0",
+			Port:                   18790,
+			WatchConfig:            true,
+			ResumeWork:             true,
+			ShutdownTimeoutSeconds: 30,
+			Watchdog: WatchdogConfig{
+				Enabled:           true,
+				CheckSeconds:      60,
+				MaxBackoffSeconds: 600,
+				AlertAfter:        3,
+			},
 		},
 		Tools: ToolsConfig{
 			Web: WebToolsConfig{
@@ -342,6 +1346,138 @@ func DefaultConfig() *Config {
 			Cron: CronToolsConfig{
 				ExecTimeoutMinutes: 5, // default 5 minutes for LLM operations
 			},
+			Issues: IssuesToolsConfig{
+				Enabled:  false,
+				Projects: []IssueProjectConfig{},
+			},
+			Finance: FinanceToolsConfig{
+				Enabled:           false,
+				Currency:          "usd",
+				StockProvider:     "yahoo",
+				CryptoProvider:    "coingecko",
+				AlertCheckMinutes: 15,
+			},
+			Tracking: TrackingToolsConfig{
+				Enabled:        false,
+				ParcelProvider: "aftership",
+				CheckMinutes:   30,
+			},
+			News: NewsToolsConfig{
+				Enabled:    false,
+				GDELT:      true,
+				Feeds:      FlexibleStringSlice{},
+				MaxResults: 10,
+			},
+			Contacts: ContactsToolsConfig{
+				Enabled: true,
+				Google:  false,
+			},
+			Expenses: ExpensesToolsConfig{
+				Enabled:  true,
+				Backend:  "sqlite",
+				Sheet:    "Expenses",
+				Currency: "USD",
+			},
+			Lists: ListsToolsConfig{
+				Enabled: true,
+			},
+			Summarize: SummarizeToolsConfig{
+				Enabled: true,
+				Google:  false,
+			},
+			Podcasts: PodcastsToolsConfig{
+				Enabled:    false,
+				CheckHours: 6,
+			},
+			Photos: PhotosToolsConfig{
+				Enabled: false,
+			},
+			Gmail: GmailToolsConfig{
+				Enabled: false,
+				WaitingOn: WaitingOnConfig{
+					DefaultDays:  3,
+					CheckMinutes: 60,
+				},
+				Routes: MailRoutesConfig{
+					CheckMinutes: 10,
+				},
+			},
+			Drive: DriveToolsConfig{
+				Enabled: false,
+			},
+			Browse: BrowseToolsConfig{
+				Enabled: false,
+			},
+			Security: SecurityToolsConfig{
+				Enabled: false,
+			},
+			Keep: KeepToolsConfig{
+				Enabled: false,
+			},
+			Backup: BackupToolsConfig{
+				Enabled:      false,
+				Destinations: FlexibleStringSlice{},
+			},
+			Reports: ReportsToolsConfig{
+				Enabled: false,
+				Format:  "doc",
+			},
+			LocalPhotos: LocalPhotosToolsConfig{
+				Enabled:     false,
+				Directories: FlexibleStringSlice{},
+			},
+			Events: EventsToolsConfig{
+				Enabled:    false,
+				CalendarID: "primary",
+			},
+			Invoices: InvoicesToolsConfig{
+				Enabled:     false,
+				LogExpenses: true,
+				Rules:       []InvoiceRuleConfig{},
+			},
+			Bills: BillsToolsConfig{
+				Enabled:    false,
+				RemindDays: 3,
+			},
+			Search: SearchToolsConfig{
+				Enabled: true,
+				Sources: FlexibleStringSlice{"gmail", "drive", "photos", "calendar", "notes", "memory"},
+			},
+			Transfers: TransfersToolsConfig{
+				ChunkMB: 8,
+				Retries: 5,
+			},
+			Files: FilesToolsConfig{
+				Enabled: false,
+			},
+			MediaArchive: MediaArchiveToolsConfig{
+				Enabled: false,
+				Rules:   []MediaArchiveRuleConfig{},
+			},
+			TravelTime: TravelTimeToolsConfig{
+				Enabled: false,
+				Mode:    "driving",
+			},
+			Transit: TransitToolsConfig{
+				Enabled:      false,
+				LeadMinutes:  10,
+				CheckMinutes: 5,
+			},
+			Critical: CriticalToolsConfig{
+				Enabled:    false,
+				AckMinutes: 15,
+			},
+			MeetingNotes: MeetingNotesToolsConfig{
+				Enabled:      false,
+				CalendarID:   "primary",
+				CheckMinutes: 15,
+			},
+			Briefing: BriefingToolsConfig{
+				Enabled:    true,
+				Time:       "07:30",
+				Sections:   FlexibleStringSlice{"calendar", "email", "weather", "reminders", "news"},
+				NewsTopics: FlexibleStringSlice{},
+			},
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
@@ -351,6 +1487,85 @@ func DefaultConfig() *Config {
 			Enabled:    false,
 			MonitorUSB: true,
 		},
+		Google: GoogleConfig{
+			Scopes: FlexibleStringSlice(append([]string(nil), GoogleScopePresets[DefaultGoogleScopePreset]...)),
+		},
+		OCR: OCRConfig{
+			Enabled:   true,
+			Languages: FlexibleStringSlice{"eng"},
+			Backend:   "tesseract",
+		},
+		Logging: LoggingConfig{
+			Level:      "info",
+			Components: map[string]string{},
+			Format:     "text",
+			MaxSizeMB:  10,
+			MaxAgeDays: 7,
+			MaxBackups: 3,
+			Redact: RedactConfig{
+				Secrets:  true,
+				Emails:   true,
+				Content:  true,
+				Fields:   FlexibleStringSlice{},
+				Patterns: FlexibleStringSlice{},
+			},
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Endpoint:    "http://localhost:4318",
+			Headers:     map[string]string{},
+			ServiceName: "picoclaw",
+			SampleRatio: 1,
+		},
+		ContentPolicy: ContentPolicyConfig{
+			CardNumbers: true,
+			Keywords:    FlexibleStringSlice{},
+			Patterns:    FlexibleStringSlice{},
+			Action:      "block",
+		},
+		Voice: VoiceConfig{
+			TTSModel: "gpt-4o-mini-tts",
+			TTSVoice: "alloy",
+		},
+		Egress: EgressConfig{
+			Allow:        FlexibleStringSlice{},
+			Deny:         FlexibleStringSlice{},
+			BlockPrivate: true,
+			MaxRedirects: 5,
+		},
+		Screening: ScreeningConfig{
+			MaxSizeMB: 25,
+			Block: FlexibleStringSlice{".exe", ".scr", ".com", ".bat", ".cmd", ".msi", ".js", ".jse", ".vbs",
+				".vbe", ".wsf", ".ps1", ".hta", ".jar", ".lnk"},
+			Allow: FlexibleStringSlice{},
+		},
+		Queue: QueueConfig{
+			MaxConcurrent:  1,
+			CoalesceMillis: 1500,
+			MaxPending:     20,
+		},
+		Offline: OfflineConfig{
+			Enabled:      true,
+			CheckSeconds: 60,
+		},
+		Outages: OutagesConfig{
+			Enabled:      true,
+			CheckSeconds: 300,
+		},
+		Automations: AutomationsConfig{
+			Enabled: true,
+			Dir:     "~/.picoclaw/automations",
+		},
+		Resources: ResourcesConfig{
+			MaxWaitSeconds: 120,
+		},
+		Disk: DiskConfig{
+			BudgetMB:  1024,
+			MinFreeMB: 200,
+		},
+		Images: ImagesConfig{
+			StripLocation: true,
+		},
 	}
 }
 
@@ -366,7 +1581,11 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, err
+		return nil, describeJSONError(path, data, err)
+	}
+
+	if err := cfg.resolveSecretRefs(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 
 	if err := env.Parse(cfg); err != nil {
@@ -444,7 +1663,7 @@ func SaveConfig(path string, cfg *Config) error {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	data, err := cfg.marshalWithSecretRefs()
 	if err != nil {
 		return err
 	}
@@ -463,6 +1682,32 @@ func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// AutomationsDir returns the directory automation files are read from
+// with ~ expanded, empty when they are off.
+func (c *Config) AutomationsDir() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.Automations.Enabled {
+		return ""
+	}
+	return expandHome(c.Automations.Dir)
+}
+
+// LogFilePath returns the configured log file with ~ expanded.
+func (c *Config) LogFilePath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return expandHome(c.Logging.File)
+}
+
+// TransitGTFSPath returns the transit timetable feed with ~ expanded,
+// empty when there is none.
+func (c *Config) TransitGTFSPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return expandHome(c.Tools.Transit.GTFS)
+}
+
 func (c *Config) GetAPIKey() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var secretKeyParts = []string{"token", "secret", "password", "api_key", "apikey", "authorization"}
+
+// Diff lists the settings that differ between old and new as
+// "path: old -> new" lines, sorted by path. Secret values are not shown.
+func Diff(old, new *Config) []string {
+	var changes []string
+	diffValues("", toGeneric(old), toGeneric(new), &changes)
+	sort.Strings(changes)
+	return changes
+}
+
+func toGeneric(c *Config) interface{} {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	data, err := json.Marshal(c)
+	c.mu.RUnlock()
+	if err != nil {
+		return nil
+	}
+	var v interface{}
+	json.Unmarshal(data, &v)
+	return v
+}
+
+func diffValues(path string, a, b interface{}, changes *[]string) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffValues(child, am[k], bm[k], changes)
+		}
+		return
+	}
+
+	aj, _ := json.Marshal(a)
+	bj, _ := json.Marshal(b)
+	if string(aj) == string(bj) {
+		return
+	}
+	if isSecretPath(path) {
+		*changes = append(*changes, path+": changed")
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, aj, bj))
+}
+
+func isSecretPath(path string) bool {
+	lower := strings.ToLower(path)
+	for _, part := range secretKeyParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// secretRefPattern matches ${env:VAR}, ${file:/path} and ${keychain:name}.
+var secretRefPattern = regexp.MustCompile(`\$\{(env|file|keychain):([^}]+)\}`)
+
+// keychainLookup reads a secret from the OS keychain; replaced in tests.
+var keychainLookup = lookupKeychain
+
+// secretRef remembers a config value written as a reference, so SaveConfig
+// can write the reference back instead of the secret.
+type secretRef struct {
+	path     []string
+	raw      string
+	resolved string
+}
+
+// resolveSecretRefs replaces references in every string of c with the
+// secret they name:
+//
+//	${env:VAR}       environment variable VAR
+//	${file:/path}    contents of the file, without the trailing newline
+//	${keychain:name} macOS Keychain or, elsewhere, the Secret Service
+//	                 entry with service=name (via secret-tool)
+//
+// References may be part of a longer value ("Bearer ${env:TOKEN}"). A
+// reference that cannot be resolved is an error naming its JSON path.
+func (c *Config) resolveSecretRefs() error {
+	c.secretRefs = nil
+	return walkStrings(reflect.ValueOf(c).Elem(), nil, func(path []string, s string) (string, error) {
+		if !strings.Contains(s, "${") {
+			return s, nil
+		}
+		var failed error
+		resolved := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			m := secretRefPattern.FindStringSubmatch(ref)
+			value, err := resolveSecretRef(m[1], strings.TrimSpace(m[2]))
+			if err != nil && failed == nil {
+				failed = fmt.Errorf("%s: cannot resolve %s: %w", strings.Join(path, "."), ref, err)
+			}
+			return value
+		})
+		if failed != nil {
+			return s, failed
+		}
+		if resolved != s {
+			c.secretRefs = append(c.secretRefs, secretRef{
+				path:     append([]string(nil), path...),
+				raw:      s,
+				resolved: resolved,
+			})
+		}
+		return resolved, nil
+	})
+}
+
+func resolveSecretRef(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(expandHome(name))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "keychain":
+		return keychainLookup(name)
+	}
+	return "", fmt.Errorf("unknown reference kind %q", kind)
+}
+
+func lookupKeychain(name string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", name, "-w")
+	case "windows":
+		return "", fmt.Errorf("keychain references are not supported on Windows")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", name)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("keychain entry %q: %w", name, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// walkStrings calls fn with the JSON path of every string reachable from
+// v and stores what it returns. Unexported fields are skipped.
+func walkStrings(v reflect.Value, path []string, fn func(path []string, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := fn(path, v.String())
+		if err != nil {
+			return err
+		}
+		if s != v.String() {
+			v.SetString(s)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		// Copy out so the value can be changed, then put it back
+		inner := reflect.New(v.Elem().Type()).Elem()
+		inner.Set(v.Elem())
+		if err := walkStrings(inner, path, fn); err != nil {
+			return err
+		}
+		v.Set(inner)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if err := walkStrings(v.Field(i), append(path, name), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), append(path, strconv.Itoa(i)), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := walkStrings(elem, append(path, iter.Key().String()), fn); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
+
+// marshalWithSecretRefs marshals c like json.MarshalIndent, but values that
+// were loaded from a reference and not changed since are written back as
+// the reference.
+func (c *Config) marshalWithSecretRefs() ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil || len(c.secretRefs) == 0 {
+		return data, err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	for _, ref := range c.secretRefs {
+		restoreRef(tree, ref)
+	}
+	return json.MarshalIndent(tree, "", "  ")
+}
+
+func restoreRef(node interface{}, ref secretRef) {
+	for i, key := range ref.path {
+		last := i == len(ref.path)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if last {
+				if n[key] == ref.resolved {
+					n[key] = ref.raw
+				}
+				return
+			}
+			node = n[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx >= len(n) {
+				return
+			}
+			if last {
+				if n[idx] == ref.resolved {
+					n[idx] = ref.raw
+				}
+				return
+			}
+			node = n[idx]
+		default:
+			return
+		}
+	}
+}
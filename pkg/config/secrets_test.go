@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadConfig_ResolvesSecretRefs verifies env, file and keychain references are replaced at load
+func TestLoadConfig_ResolvesSecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "secret"), []byte("from-file\n"), 0600)
+	t.Setenv("TEST_GOOGLE_ID", "id-123")
+	keychainLookup = func(name string) (string, error) { return "kc-" + name, nil }
+	defer func() { keychainLookup = lookupKeychain }()
+
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{
+  "google": {"client_id": "${env:TEST_GOOGLE_ID}", "client_secret": "${file:`+filepath.Join(dir, "secret")+`}"},
+  "providers": {"openai": {"api_key": "${keychain:openai}"}},
+  "tools": {"policies": {"exec": {"settings": {"token": "Bearer ${env:TEST_GOOGLE_ID}"}}}}
+}`), 0600)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Google.ClientID != "id-123" || cfg.Google.ClientSecret != "from-file" {
+		t.Errorf("google = %+v", cfg.Google)
+	}
+	if cfg.Providers.OpenAI.APIKey != "kc-openai" {
+		t.Errorf("api_key = %q", cfg.Providers.OpenAI.APIKey)
+	}
+	if got := cfg.Tools.Policies["exec"].Settings["token"]; got != "Bearer id-123" {
+		t.Errorf("settings token = %v", got)
+	}
+}
+
+// TestLoadConfig_UnresolvedSecretRefNamesPath verifies a missing secret fails with its JSON path
+func TestLoadConfig_UnresolvedSecretRefNamesPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"google": {"client_secret": "${env:PICOCLAW_TEST_UNSET_SECRET}"}}`), 0600)
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "google.client_secret: cannot resolve ${env:PICOCLAW_TEST_UNSET_SECRET}") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestSaveConfig_KeepsSecretRefs verifies saving writes references back instead of secrets
+func TestSaveConfig_KeepsSecretRefs(t *testing.T) {
+	t.Setenv("TEST_GOOGLE_SECRET", "s3cret")
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"google": {"client_id": "${env:TEST_GOOGLE_SECRET}", "client_secret": "${env:TEST_GOOGLE_SECRET}"}}`), 0600)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Google.ClientID = "changed"
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cret") || !strings.Contains(string(data), `"client_secret": "${env:TEST_GOOGLE_SECRET}"`) {
+		t.Errorf("secret written in plain text:\n%s", data)
+	}
+	if !strings.Contains(string(data), `"client_id": "changed"`) {
+		t.Errorf("edited value lost:\n%s", data)
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of Setting values.
+const (
+	SettingBool   = "bool"
+	SettingInt    = "int"
+	SettingString = "string"
+	SettingClock  = "clock"
+	SettingList   = "list"
+)
+
+// Setting is a config value owners may change from chat. Only values
+// that cannot lock anyone out or leak anything are listed: no keys,
+// tokens, owners, channels or sandbox switches.
+type Setting struct {
+	// Key is the JSON path, e.g. "tools.briefing.time"
+	Key         string
+	Kind        string
+	Description string
+	// Min and Max bound int settings
+	Min, Max int
+	// Enum lists the values a string setting takes, any when empty
+	Enum []string
+}
+
+// EditableSettings are the settings the settings tool offers.
+var EditableSettings = []Setting{
+	{Key: "tools.briefing.enabled", Kind: SettingBool, Description: "send the daily briefing"},
+	{Key: "tools.briefing.time", Kind: SettingClock, Description: "when the daily briefing is sent, HH:MM"},
+	{Key: "tools.briefing.weather_location", Kind: SettingString, Description: "the city the briefing's weather is for"},
+	{Key: "tools.briefing.news_topics", Kind: SettingList, Description: "news topics in the briefing, comma-separated"},
+	{Key: "tools.policies.local_photos.settings.default_album", Kind: SettingString, Description: "the album photos are uploaded to when none is named"},
+	{Key: "quotas.enabled", Kind: SettingBool, Description: "limit each user's daily use"},
+	{Key: "quotas.default.messages", Kind: SettingInt, Min: 0, Max: 100000, Description: "messages each user may send a day, 0 for no limit"},
+	{Key: "quotas.default.tool_calls", Kind: SettingInt, Min: 0, Max: 100000, Description: "tool calls each user may make a day, 0 for no limit"},
+	{Key: "quotas.default.tokens", Kind: SettingInt, Min: 0, Max: 100000000, Description: "LLM tokens each user may use a day, 0 for no limit"},
+	{Key: "queue.max_concurrent", Kind: SettingInt, Min: 1, Max: 16, Description: "conversations answered at the same time"},
+	{Key: "queue.max_pending", Kind: SettingInt, Min: 1, Max: 1000, Description: "messages a chat may have waiting before more are dropped"},
+	{Key: "heartbeat.enabled", Kind: SettingBool, Description: "run the periodic heartbeat tasks"},
+	{Key: "heartbeat.interval", Kind: SettingInt, Min: 5, Max: 1440, Description: "minutes between heartbeats"},
+	{Key: "agents.defaults.max_tool_iterations", Kind: SettingInt, Min: 1, Max: 100, Description: "tool calls the agent may make for one message"},
+	{Key: "agents.defaults.large_result_chars", Kind: SettingInt, Min: 0, Max: 1000000, Description: "size over which a tool result is sent as a document, 0 for never"},
+	{Key: "agents.defaults.locale", Kind: SettingString, Description: "locale dates and numbers are written in for users who set none, e.g. pt-BR"},
+}
+
+// LookupSetting returns the editable setting at key.
+func LookupSetting(key string) (Setting, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, s := range EditableSettings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Parse checks value, as typed in chat, against the setting's kind and
+// bounds and returns it as stored in the config. Secret references are
+// refused: the config would expand them and the setting would show the
+// secret to whoever reads it back.
+func (s Setting) Parse(value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	if secretRefPattern.MatchString(value) {
+		return nil, fmt.Errorf("%s cannot refer to environment variables, files or the keychain from chat", s.Key)
+	}
+	switch s.Kind {
+	case SettingBool:
+		switch strings.ToLower(value) {
+		case "true", "on", "yes", "enabled":
+			return true, nil
+		case "false", "off", "no", "disabled":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%s is on or off, got %q", s.Key, value)
+	case SettingInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is a whole number, got %q", s.Key, value)
+		}
+		if n < s.Min || n > s.Max {
+			return nil, fmt.Errorf("%s must be between %d and %d, got %d", s.Key, s.Min, s.Max, n)
+		}
+		return n, nil
+	case SettingClock:
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is a time of day as HH:MM, got %q", s.Key, value)
+		}
+		return t.Format("15:04"), nil
+	case SettingList:
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	default:
+		if len(s.Enum) > 0 {
+			for _, e := range s.Enum {
+				if strings.EqualFold(e, value) {
+					return e, nil
+				}
+			}
+			return nil, fmt.Errorf("%s is one of %s, got %q", s.Key, strings.Join(s.Enum, ", "), value)
+		}
+		if len(value) > 200 {
+			return nil, fmt.Errorf("%s is too long", s.Key)
+		}
+		return value, nil
+	}
+}
+
+// Value returns the setting's current value in cfg, formatted for chat.
+func (s Setting) Value(cfg *Config) string {
+	var v interface{} = toGeneric(cfg)
+	for _, part := range strings.Split(s.Key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[part]
+	}
+	return FormatSetting(v)
+}
+
+// FormatSetting formats a setting's value, as returned by Parse or read
+// from the config, for chat.
+func FormatSetting(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ", ")
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// EditFile sets key to value in the config file at path and returns the
+// config it now holds. The file is only replaced when the result loads
+// and passes Validate; other settings, unknown fields and secret
+// references are kept as written.
+func EditFile(path, key string, value interface{}) (*Config, error) {
+	raw := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, describeJSONError(path, data, err)
+		}
+	}
+
+	node := raw
+	parts := strings.Split(key, ".")
+	for i, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			if node[part] != nil {
+				return nil, fmt.Errorf("%s is not an object in the config file", strings.Join(parts[:i+1], "."))
+			}
+			child = map[string]interface{}{}
+			node[part] = child
+		}
+		node = child
+	}
+	node[parts[len(parts)-1]] = value
+
+	edited, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// Load the edit the way the gateway will before it replaces the file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(edited, '\n'), 0600); err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(tmp)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEditFile_ChangesOneSettingAndKeepsTheRest verifies a chat edit is parsed, validated and written without touching other values or secret references
+func TestEditFile_ChangesOneSettingAndKeepsTheRest(t *testing.T) {
+	t.Setenv("PICOCLAW_TEST_SETTINGS_KEY", "sk-test")
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{"providers": {"openai": {"api_key": "${env:PICOCLAW_TEST_SETTINGS_KEY}"}}, "heartbeat": {"enabled": true, "interval": 30}}`
+	os.WriteFile(path, []byte(original), 0600)
+
+	setting, ok := LookupSetting("Tools.Briefing.Time")
+	if !ok {
+		t.Fatal("tools.briefing.time should be editable")
+	}
+	if _, err := setting.Parse("25:00"); err == nil {
+		t.Error("25:00 is not a time of day")
+	}
+	value, err := setting.Parse("7:05")
+	if err != nil || value != "07:05" {
+		t.Fatalf("Parse = %v, %v", value, err)
+	}
+	cfg, err := EditFile(path, setting.Key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setting.Value(cfg) != "07:05" || cfg.Heartbeat.Interval != 30 || cfg.Providers.OpenAI.APIKey != "sk-test" {
+		t.Errorf("unexpected config: time %q, interval %d, key %q", setting.Value(cfg), cfg.Heartbeat.Interval, cfg.Providers.OpenAI.APIKey)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "${env:PICOCLAW_TEST_SETTINGS_KEY}") || strings.Contains(string(data), "sk-test") {
+		t.Errorf("secret reference not kept:\n%s", data)
+	}
+
+	interval, _ := LookupSetting("heartbeat.interval")
+	if _, err := interval.Parse("2"); err == nil {
+		t.Error("an interval under 5 minutes should be refused")
+	}
+	if _, ok := LookupSetting("providers.openai.api_key"); ok {
+		t.Error("API keys must not be editable from chat")
+	}
+
+	// A value the config refuses leaves the file as it was
+	if _, err := EditFile(path, "agents.defaults.max_tool_iterations", 0); err == nil {
+		t.Error("an invalid config should be refused")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Errorf("refused edit changed the file:\n%s", after)
+	}
+}
+
+// TestSettingParse_RefusesSecretReferences verifies chat edits cannot
+// point a setting at an environment variable, file or keychain entry,
+// which the config would expand and the setting would read back
+func TestSettingParse_RefusesSecretReferences(t *testing.T) {
+	for _, key := range []string{"tools.briefing.weather_location", "tools.briefing.news_topics"} {
+		setting, ok := LookupSetting(key)
+		if !ok {
+			t.Fatalf("%s should be editable", key)
+		}
+		for _, value := range []string{"${env:PICOCLAW_SECRET}", "${file:/etc/shadow}", "Lisbon, ${keychain:openai}"} {
+			if got, err := setting.Parse(value); err == nil {
+				t.Errorf("%s accepted %q as %v", key, value, got)
+			}
+		}
+		if _, err := setting.Parse("Lisbon"); err != nil {
+			t.Errorf("%s refused a plain value: %v", key, err)
+		}
+	}
+}
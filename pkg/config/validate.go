@@ -0,0 +1,449 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/features"
+)
+
+// ValidationError lists every problem found in a config, each prefixed
+// with the JSON path of the offending field.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid config: " + e.Problems[0]
+	}
+	return fmt.Sprintf("invalid config (%d problems):\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+var (
+	logLevels        = []string{"debug", "info", "warn", "warning", "error", "fatal"}
+	logFormats       = []string{"text", "json"}
+	searchNames      = []string{"gmail", "drive", "photos", "calendar", "notes", "memory"}
+	expenseKinds     = []string{"sqlite", "google_sheets"}
+	listSyncs        = []string{"google_tasks", "caldav"}
+	parcelKinds      = []string{"aftership", "17track"}
+	storageKinds     = []string{"local", "webdav", "s3", "dropbox"}
+	archiveDests     = []string{"photos", "drive"}
+	dlpActions       = []string{"block", "approve"}
+	roleNames        = []string{"owner", "trusted", "guest"}
+	embedders        = []string{"openai", "ollama", "gemini", "local"}
+	reportKinds      = []string{"doc", "sheet"}
+	googleAPIMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	travelModes      = []string{"driving", "transit", "walking", "bicycling"}
+	verbosityLevels  = []string{"concise", "normal", "detailed"}
+)
+
+// Validate checks values that parse but cannot work, such as a zero
+// iteration limit or an unknown log level. It returns a *ValidationError
+// listing all problems, or nil.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	d := c.Agents.Defaults
+	v.check(strings.TrimSpace(d.Model) != "", "agents.defaults.model", "must be set")
+	v.check(d.MaxTokens > 0, "agents.defaults.max_tokens", "must be positive, got %d", d.MaxTokens)
+	v.check(d.MaxToolIterations > 0, "agents.defaults.max_tool_iterations", "must be positive, got %d", d.MaxToolIterations)
+	v.check(d.Temperature >= 0 && d.Temperature <= 2, "agents.defaults.temperature", "must be between 0 and 2, got %g", d.Temperature)
+
+	personas := make([]string, 0, len(c.Agents.Personas))
+	for name := range c.Agents.Personas {
+		personas = append(personas, name)
+	}
+	sort.Strings(personas)
+	for _, name := range personas {
+		v.check(strings.TrimSpace(name) != "" && !strings.ContainsAny(name, " \t"), "agents.personas", "names must be single words, got %q", name)
+		v.oneOf("agents.personas."+name+".verbosity", c.Agents.Personas[name].Verbosity, verbosityLevels)
+	}
+
+	v.check(c.Gateway.Port > 0 && c.Gateway.Port < 65536, "gateway.port", "must be between 1 and 65535, got %d", c.Gateway.Port)
+	v.check(c.Gateway.ShutdownTimeoutSeconds >= 0, "gateway.shutdown_timeout_seconds", "must not be negative, got %d", c.Gateway.ShutdownTimeoutSeconds)
+	if w := c.Gateway.Watchdog; w.Enabled {
+		v.check(w.CheckSeconds > 0, "gateway.watchdog.check_seconds", "must be positive, got %d", w.CheckSeconds)
+		v.check(w.MaxBackoffSeconds >= w.CheckSeconds, "gateway.watchdog.max_backoff_seconds", "must be at least check_seconds (%d), got %d", w.CheckSeconds, w.MaxBackoffSeconds)
+		v.check(w.AlertAfter > 0, "gateway.watchdog.alert_after", "must be positive, got %d", w.AlertAfter)
+	}
+	v.check(!c.Gateway.Admin.Enabled || c.Gateway.Admin.Password != "", "gateway.admin.password", "is required when the admin dashboard is enabled")
+	if e := c.Gateway.Events; e.Enabled {
+		v.check(len(e.Sources) > 0, "gateway.events.sources", "must list at least one source")
+		v.check(c.Automations.Enabled, "gateway.events.enabled", "needs automations.enabled, as events are routed by the event rules in automation files")
+		names, tokens := map[string]bool{}, map[string]bool{}
+		for i, src := range e.Sources {
+			path := fmt.Sprintf("gateway.events.sources[%d]", i)
+			name := strings.ToLower(strings.TrimSpace(src.Name))
+			v.check(name != "" && !names[name], path+".name", "must be set and unique, got %q", src.Name)
+			v.check(len(src.Token) >= 16 && !tokens[src.Token], path+".token", "must be unique and at least 16 characters")
+			names[name], tokens[src.Token] = true, true
+		}
+	}
+
+	v.check(c.Egress.MaxRedirects >= 0, "egress.max_redirects", "must not be negative, got %d", c.Egress.MaxRedirects)
+	for i, d := range c.Egress.Allow {
+		v.check(isDomain(d), fmt.Sprintf("egress.allow[%d]", i), "must be a domain like example.com, got %q", d)
+	}
+	for i, d := range c.Egress.Deny {
+		v.check(isDomain(d), fmt.Sprintf("egress.deny[%d]", i), "must be a domain like example.com, got %q", d)
+	}
+
+	v.check(c.Queue.MaxConcurrent >= 0, "queue.max_concurrent", "must not be negative, got %d", c.Queue.MaxConcurrent)
+	v.check(c.Queue.CoalesceMillis >= 0 && c.Queue.CoalesceMillis <= 60000, "queue.coalesce_ms", "must be between 0 and 60000, got %d", c.Queue.CoalesceMillis)
+	v.check(c.Queue.MaxPending >= 0, "queue.max_pending", "must not be negative, got %d", c.Queue.MaxPending)
+
+	if c.Offline.Enabled {
+		v.check(c.Offline.CheckSeconds > 0, "offline.check_seconds", "must be positive, got %d", c.Offline.CheckSeconds)
+		for i, target := range c.Offline.Targets {
+			_, port, err := net.SplitHostPort(target)
+			v.check(err == nil && port != "", fmt.Sprintf("offline.targets[%d]", i), "must be host:port, got %q", target)
+		}
+		v.check(c.Offline.Model == "" || c.Providers.VLLM.APIBase != "", "offline.model", "needs providers.vllm.api_base for the local model")
+	}
+
+	v.check(c.LocalOnly.Model == "" || c.Providers.VLLM.APIBase != "", "local_only.model", "needs providers.vllm.api_base for the local model")
+	v.check(len(c.LocalOnly.Chats) == 0 || (c.LocalOnly.Model != "" || c.Offline.Model != ""), "local_only.chats", "needs a local model: set local_only.model or offline.model")
+	for i, chat := range c.LocalOnly.Chats {
+		channel, chatID, ok := strings.Cut(chat, ":")
+		v.check(ok && channel != "" && chatID != "", fmt.Sprintf("local_only.chats[%d]", i), "must be channel:chat_id, got %q", chat)
+	}
+
+	if c.Outages.Enabled {
+		v.check(c.Outages.CheckSeconds >= 30, "outages.check_seconds", "must be at least 30, got %d", c.Outages.CheckSeconds)
+	}
+
+	if c.Webhooks.Enabled {
+		for i, e := range c.Webhooks.Endpoints {
+			path := fmt.Sprintf("webhooks.endpoints[%d]", i)
+			u, err := url.Parse(e.URL)
+			v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", path+".url", "must be an http(s) URL, got %q", e.URL)
+			for j, event := range e.Events {
+				v.oneOf(fmt.Sprintf("%s.events[%d]", path, j), event, []string{"message.processed", "tool.failed", "reminder.fired", "backup.finished"})
+			}
+		}
+	}
+
+	for category, days := range c.Memory.RetentionDays {
+		v.check(days >= 0, "memory.retention_days."+category, "must not be negative, got %d", days)
+	}
+
+	v.check(c.Resources.MaxHeavyOps >= 0, "resources.max_heavy_ops", "must not be negative, got %d", c.Resources.MaxHeavyOps)
+	v.check(c.Resources.MaxWaitSeconds >= 0, "resources.max_wait_seconds", "must not be negative, got %d", c.Resources.MaxWaitSeconds)
+
+	v.check(c.Disk.BudgetMB >= 0, "disk.budget_mb", "must not be negative, got %d", c.Disk.BudgetMB)
+	v.check(c.Disk.MinFreeMB >= 0, "disk.min_free_mb", "must not be negative, got %d", c.Disk.MinFreeMB)
+
+	for name := range c.Features {
+		_, known := features.Lookup(name)
+		v.check(known, "features."+name, "is not a known feature (known: %s)", strings.Join(features.Names(), ", "))
+	}
+
+	if c.Automations.Enabled {
+		v.check(strings.TrimSpace(c.Automations.Dir) != "", "automations.dir", "is required when automations are enabled")
+	}
+
+	v.check(c.Heartbeat.Interval >= 0, "heartbeat.interval", "must not be negative, got %d", c.Heartbeat.Interval)
+
+	for i, owner := range c.Owners {
+		v.check(strings.TrimSpace(owner) != "", fmt.Sprintf("owners[%d]", i), "must not be empty")
+	}
+
+	if c.Escalation.Enabled {
+		channel, chatID, _ := strings.Cut(c.Escalation.OwnerChat, ":")
+		v.check(channel != "" && chatID != "", "escalation.owner_chat", "must be \"channel:chat_id\", got %q", c.Escalation.OwnerChat)
+	}
+	v.check(c.Escalation.HistoryMessages >= 0, "escalation.history_messages", "must not be negative, got %d", c.Escalation.HistoryMessages)
+
+	v.oneOf("embeddings.provider", c.Embeddings.Provider, embedders)
+	v.oneOf("embeddings.fallback", c.Embeddings.Fallback, embedders)
+	v.check(c.Embeddings.Fallback == "" || c.Embeddings.Provider != "", "embeddings.fallback", "needs embeddings.provider")
+
+	v.oneOf("ocr.backend", c.OCR.Backend, []string{"tesseract", "google_vision"})
+	if c.OCR.Enabled {
+		v.check(c.OCR.Backend != "google_vision" || c.OCR.APIKey != "", "ocr.api_key", "is required for the google_vision backend")
+		v.check(!c.OCR.Handwriting || c.OCR.APIKey != "", "ocr.handwriting", "needs ocr.api_key for Google Vision")
+	}
+
+	v.oneOf("logging.level", c.Logging.Level, logLevels)
+	for component, level := range c.Logging.Components {
+		v.oneOf("logging.components."+component, level, logLevels)
+	}
+	v.oneOf("logging.format", c.Logging.Format, logFormats)
+	v.check(c.Logging.MaxSizeMB >= 0, "logging.max_size_mb", "must not be negative, got %d", c.Logging.MaxSizeMB)
+	v.check(c.Logging.MaxAgeDays >= 0, "logging.max_age_days", "must not be negative, got %d", c.Logging.MaxAgeDays)
+	v.check(c.Logging.MaxBackups >= 0, "logging.max_backups", "must not be negative, got %d", c.Logging.MaxBackups)
+	for i, expr := range c.Logging.Redact.Patterns {
+		if _, err := regexp.Compile(expr); err != nil {
+			v.add(fmt.Sprintf("logging.redact.patterns[%d]", i), "%v", err)
+		}
+	}
+
+	if c.Tracing.Enabled {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"tracing.endpoint", "must be an http(s) URL, got %q", c.Tracing.Endpoint)
+	}
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	cp := c.ContentPolicy
+	v.oneOf("content_policy.action", cp.Action, dlpActions)
+	v.check(cp.MaxAttachmentMB >= 0, "content_policy.max_attachment_mb", "must not be negative, got %d", cp.MaxAttachmentMB)
+	for i, expr := range cp.Patterns {
+		if _, err := regexp.Compile(expr); err != nil {
+			v.add(fmt.Sprintf("content_policy.patterns[%d]", i), "%v", err)
+		}
+	}
+
+	checkQuota := func(field string, l QuotaLimits) {
+		v.check(l.Messages >= 0, field+".messages", "must not be negative, got %d", l.Messages)
+		v.check(l.ToolCalls >= 0, field+".tool_calls", "must not be negative, got %d", l.ToolCalls)
+		v.check(l.Tokens >= 0, field+".tokens", "must not be negative, got %d", l.Tokens)
+		for _, name := range sortedKeys(l.Tools) {
+			v.check(l.Tools[name] >= 0, field+".tools."+name, "must not be negative, got %d", l.Tools[name])
+		}
+	}
+	checkQuota("quotas.default", c.Quotas.Default)
+	for _, user := range sortedKeys(c.Quotas.Users) {
+		checkQuota("quotas.users."+user, c.Quotas.Users[user])
+	}
+
+	v.oneOf("roles.default", c.Roles.Default, roleNames[1:])
+	for _, user := range sortedKeys(c.Roles.Users) {
+		v.oneOf("roles.users."+user, c.Roles.Users[user], roleNames)
+	}
+	if q := c.Roles.Trusted.Quotas; q != nil {
+		checkQuota("roles.trusted.quotas", *q)
+	}
+	if q := c.Roles.Guest.Quotas; q != nil {
+		checkQuota("roles.guest.quotas", *q)
+	}
+
+	t := c.Tools
+	v.check(t.Cron.ExecTimeoutMinutes >= 0, "tools.cron.exec_timeout_minutes", "must not be negative, got %d", t.Cron.ExecTimeoutMinutes)
+	v.check(t.Transfers.ChunkMB >= 0, "tools.transfers.chunk_mb", "must not be negative, got %d", t.Transfers.ChunkMB)
+	v.check(t.Transfers.MaxKBps >= 0, "tools.transfers.max_kbps", "must not be negative, got %d", t.Transfers.MaxKBps)
+	v.check(t.Transfers.Retries >= 0, "tools.transfers.retries", "must not be negative, got %d", t.Transfers.Retries)
+	for i, w := range t.Transfers.Windows {
+		path := fmt.Sprintf("tools.transfers.windows[%d]", i)
+		_, err := time.Parse("15:04", w.From)
+		v.check(err == nil, path+".from", "must be HH:MM, got %q", w.From)
+		_, err = time.Parse("15:04", w.To)
+		v.check(err == nil, path+".to", "must be HH:MM, got %q", w.To)
+		v.check(w.MaxKBps >= 0, path+".max_kbps", "must not be negative, got %d", w.MaxKBps)
+	}
+	if t.Finance.Enabled {
+		v.check(t.Finance.AlertCheckMinutes > 0, "tools.finance.alert_check_minutes", "must be positive, got %d", t.Finance.AlertCheckMinutes)
+	}
+	if t.Tracking.Enabled {
+		v.check(t.Tracking.CheckMinutes > 0, "tools.tracking.check_minutes", "must be positive, got %d", t.Tracking.CheckMinutes)
+		v.oneOf("tools.tracking.parcel_provider", t.Tracking.ParcelProvider, parcelKinds)
+	}
+	if t.Search.Enabled {
+		for i, name := range t.Search.Sources {
+			v.oneOf(fmt.Sprintf("tools.search.sources[%d]", i), name, searchNames)
+		}
+	}
+	if t.Expenses.Enabled {
+		v.oneOf("tools.expenses.backend", t.Expenses.Backend, expenseKinds)
+		v.check(t.Expenses.Backend != "google_sheets" || t.Expenses.SpreadsheetID != "",
+			"tools.expenses.spreadsheet_id", "is required for the google_sheets backend")
+	}
+	if t.Reports.Enabled {
+		v.oneOf("tools.reports.format", t.Reports.Format, reportKinds)
+	}
+	if t.Critical.Enabled {
+		v.check(t.Critical.AckMinutes >= 1, "tools.critical.ack_minutes", "must be at least 1, got %d", t.Critical.AckMinutes)
+		sms := t.Critical.SMS
+		v.check((sms.AccountSID == "") == (sms.AuthToken == "") && (sms.AccountSID == "") == (sms.From == ""),
+			"tools.critical.sms", "needs account_sid, auth_token and from together")
+	}
+	if t.TravelTime.Enabled {
+		v.check(t.TravelTime.MapsAPIKey != "", "tools.travel_time.maps_api_key", "is required")
+		v.oneOf("tools.travel_time.mode", t.TravelTime.Mode, travelModes)
+	}
+	if t.Podcasts.Enabled {
+		v.check(t.Podcasts.CheckHours >= 1, "tools.podcasts.check_hours", "must be at least 1, got %d", t.Podcasts.CheckHours)
+	}
+	if t.Bills.Enabled {
+		v.check(t.Bills.RemindDays >= 1, "tools.bills.remind_days", "must be at least 1, got %d", t.Bills.RemindDays)
+	}
+	if t.Transit.Enabled {
+		v.check(t.Transit.GTFS != "" || t.Transit.RoutesAPIKey != "" || t.TravelTime.MapsAPIKey != "",
+			"tools.transit", "needs a gtfs timetable or a routes_api_key")
+		v.check(t.Transit.LeadMinutes >= 1, "tools.transit.lead_minutes", "must be at least 1, got %d", t.Transit.LeadMinutes)
+		v.check(t.Transit.CheckMinutes >= 5, "tools.transit.check_minutes", "must be at least 5, got %d", t.Transit.CheckMinutes)
+	}
+	if t.Gmail.Enabled {
+		v.check(t.Gmail.WaitingOn.DefaultDays >= 1, "tools.gmail.waiting_on.default_days", "must be at least 1, got %d", t.Gmail.WaitingOn.DefaultDays)
+		v.check(t.Gmail.WaitingOn.CheckMinutes >= 5, "tools.gmail.waiting_on.check_minutes", "must be at least 5, got %d", t.Gmail.WaitingOn.CheckMinutes)
+		v.check(t.Gmail.Routes.CheckMinutes >= 5, "tools.gmail.routes.check_minutes", "must be at least 5, got %d", t.Gmail.Routes.CheckMinutes)
+	}
+	if t.MeetingNotes.Enabled {
+		v.check(t.MeetingNotes.CheckMinutes >= 5, "tools.meeting_notes.check_minutes", "must be at least 5, got %d", t.MeetingNotes.CheckMinutes)
+	}
+	if t.GoogleAPI.Enabled {
+		v.check(len(t.GoogleAPI.Endpoints) > 0, "tools.google_api.endpoints", "must list at least one endpoint")
+		for i, e := range t.GoogleAPI.Endpoints {
+			field := fmt.Sprintf("tools.google_api.endpoints[%d]", i)
+			v.check(e.Method != "", field+".method", "is required")
+			v.oneOf(field+".method", e.Method, googleAPIMethods)
+			u, err := url.Parse(e.URL)
+			v.check(err == nil && u.Scheme == "https" && strings.HasSuffix(u.Host, ".googleapis.com") && u.RawQuery == "" && u.Fragment == "",
+				field+".url", "must be an https://*.googleapis.com URL without a query, got %q", e.URL)
+		}
+	}
+	if t.Lists.Enabled {
+		v.oneOf("tools.lists.sync", t.Lists.Sync, listSyncs)
+		if strings.EqualFold(t.Lists.Sync, "caldav") {
+			u, err := url.Parse(t.Lists.CalDAV.URL)
+			v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				"tools.lists.caldav.url", "must be an http(s) URL, got %q", t.Lists.CalDAV.URL)
+		}
+	}
+	checkStorage := func(field string, s StorageConfig) {
+		v.oneOf(field+".backend", s.Backend, storageKinds)
+		switch strings.ToLower(s.Backend) {
+		case "local":
+			v.check(s.Root != "", field+".root", "is required for the local backend")
+		case "webdav":
+			u, err := url.Parse(s.URL)
+			v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				field+".url", "must be an http(s) URL, got %q", s.URL)
+		case "s3":
+			u, err := url.Parse(s.Endpoint)
+			v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				field+".endpoint", "must be an http(s) URL, got %q", s.Endpoint)
+			v.check(s.Bucket != "", field+".bucket", "is required for the s3 backend")
+			v.check((s.AccessKey == "") == (s.SecretKey == ""), field+".secret_key", "access_key and secret_key go together")
+		case "dropbox":
+			v.check(s.Token != "", field+".token", "is required for the dropbox backend")
+		}
+	}
+	if t.Photos.Enabled {
+		checkStorage("tools.photos.storage", t.Photos.Storage)
+	}
+	v.check(t.Photos.Upload.MaxDimension >= 0, "tools.photos.upload.max_dimension", "must not be negative, got %d", t.Photos.Upload.MaxDimension)
+	v.check(t.Photos.Upload.Quality >= 0 && t.Photos.Upload.Quality <= 100, "tools.photos.upload.quality", "must be between 1 and 100, or 0 to keep, got %d", t.Photos.Upload.Quality)
+	if t.MediaArchive.Enabled {
+		for i, r := range t.MediaArchive.Rules {
+			field := fmt.Sprintf("tools.media_archive.rules[%d]", i)
+			v.check(r.Destination != "", field+".destination", "is required")
+			v.oneOf(field+".destination", r.Destination, archiveDests)
+		}
+	}
+	if t.Files.Enabled {
+		v.check(t.Files.Storage.Backend != "", "tools.files.storage.backend", "is required")
+		checkStorage("tools.files.storage", t.Files.Storage)
+	}
+	if t.Transfers.Enabled {
+		for name, b := range t.Transfers.Backends {
+			field := "tools.transfers.backends." + name
+			switch strings.ToLower(name) {
+			case "drive", "photos", "gmail", "files":
+				v.add(field, "%q is a built-in endpoint; pick another name", name)
+			}
+			v.check(b.Backend != "", field+".backend", "is required")
+			checkStorage(field, b)
+		}
+	}
+
+	policyNames := make([]string, 0, len(t.Policies))
+	for name := range t.Policies {
+		policyNames = append(policyNames, name)
+	}
+	sort.Strings(policyNames)
+	for _, name := range policyNames {
+		policy := t.Policies[name]
+		for i, ch := range policy.Channels {
+			v.check(strings.TrimSpace(ch) != "", fmt.Sprintf("tools.policies.%s.channels[%d]", name, i), "must not be empty")
+		}
+		for i, user := range policy.Users {
+			v.check(strings.TrimSpace(user) != "", fmt.Sprintf("tools.policies.%s.users[%d]", name, i), "must not be empty")
+		}
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) check(ok bool, path, format string, args ...interface{}) {
+	if !ok {
+		v.add(path, format, args...)
+	}
+}
+
+// oneOf accepts an empty value (the default) or one of allowed.
+func (v *validator) oneOf(path, value string, allowed []string) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	v.add(path, "unknown value %q, want one of %s", value, strings.Join(allowed, ", "))
+}
+
+// describeJSONError points a syntax or type error at its line and column
+// in the config file.
+func describeJSONError(path string, data []byte, err error) error {
+	var offset int64
+	detail := err.Error()
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+		detail = fmt.Sprintf("%s: cannot use %s as %s", e.Field, e.Value, e.Type)
+	default:
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, col := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Errorf("%s:%d:%d: %s", path, line, col, detail)
+}
+
+// sortedKeys returns m's keys in order, so problems are reported in a
+// stable order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isDomain reports whether s looks like a bare domain, optionally with a
+// leading "*.", rather than a URL.
+func isDomain(s string) bool {
+	return strings.TrimPrefix(s, "*.") != "" && !strings.ContainsAny(s, "/: ")
+}
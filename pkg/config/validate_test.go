@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestValidate_DefaultConfigIsValid verifies the defaults pass validation
+func TestValidate_DefaultConfigIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config invalid: %v", err)
+	}
+}
+
+// TestValidate_ReportsEveryProblem verifies all problems are listed with their JSON paths
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Agents.Defaults.MaxToolIterations = 0
+	cfg.Gateway.Admin.Enabled = true
+	cfg.Logging.Level = "verbose"
+	cfg.Logging.Redact.Patterns = FlexibleStringSlice{"("}
+	cfg.Tools.Search.Sources = FlexibleStringSlice{"gmail", "dropbox"}
+
+	err := cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	want := []string{
+		"agents.defaults.max_tool_iterations: must be positive, got 0",
+		"gateway.admin.password: is required",
+		`logging.level: unknown value "verbose"`,
+		"logging.redact.patterns[0]:",
+		`tools.search.sources[1]: unknown value "dropbox"`,
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("got %d problems: %v", len(verr.Problems), verr.Problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(verr.Problems[i], w) {
+			t.Errorf("problem %d = %q, want prefix %q", i, verr.Problems[i], w)
+		}
+	}
+}
+
+// TestLoadConfig_ReportsLineAndColumn verifies parse errors point into the file
+func TestLoadConfig_ReportsLineAndColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte("{\n  \"gateway\": {\n    \"port\": \"eighty\"\n  }\n}\n"), 0600)
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), path+":3:") || !strings.Contains(err.Error(), "gateway.port") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestDiff_ListsChangesAndHidesSecrets verifies changed paths are reported and secret values are not shown
+func TestDiff_ListsChangesAndHidesSecrets(t *testing.T) {
+	old, next := DefaultConfig(), DefaultConfig()
+	next.Heartbeat.Interval = 60
+	next.Providers.OpenAI.APIKey = "sk-new"
+
+	changes := Diff(old, next)
+	want := []string{"heartbeat.interval: 30 -> 60", "providers.openai.api_key: changed"}
+	if strings.Join(changes, "|") != strings.Join(want, "|") {
+		t.Errorf("got %v, want %v", changes, want)
+	}
+	if len(Diff(old, DefaultConfig())) != 0 {
+		t.Error("identical configs should have no changes")
+	}
+}
+
+// TestWatch_CallsOnChangeOncePerEdit verifies edits fire once after they settle and touches are ignored
+func TestWatch_CallsOnChangeOncePerEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{}`), 0600)
+
+	var calls atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, path, 10*time.Millisecond, func() { calls.Add(1) })
+
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(path, []byte(`{"owners": ["1"]}`), 0600)
+	waitFor(t, func() bool { return calls.Load() == 1 })
+
+	// Same content with a new mtime
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(path, future, future)
+	time.Sleep(60 * time.Millisecond)
+	if calls.Load() != 1 {
+		t.Errorf("touch triggered a reload: %d calls", calls.Load())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
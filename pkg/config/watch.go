@@ -0,0 +1,66 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Watch polls the config file at path and calls onChange after its content
+// changes and has stayed the same for one more poll, so a save in progress
+// is not picked up half written. Polling keeps the gateway free of an
+// inotify dependency and works on every filesystem, including the SD cards
+// and network mounts picoclaw devices often run from. It returns when ctx
+// is done.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	lastStat := statKey(path)
+	lastSum := fileSum(path)
+	pending := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		key := statKey(path)
+		if key != lastStat {
+			lastStat = key
+			pending = true
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+		// A touch or a save without edits changes the stat but not the content
+		if sum := fileSum(path); sum != lastSum {
+			lastSum = sum
+			onChange()
+		}
+	}
+}
+
+func statKey(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+func fileSum(path string) [sha256.Size]byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,175 @@
+// Package connectivity tells whether the internet is reachable, so the
+// agent can switch to offline mode instead of letting every network call
+// time out.
+package connectivity
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DefaultTargets are dialed to probe the connection: public DNS resolvers
+// on port 443, by address so a broken resolver does not count as offline
+// and in different regions so one blocked network does not either.
+var DefaultTargets = []string{"1.1.1.1:443", "8.8.8.8:443", "223.5.5.5:443"}
+
+// offlineAfter is how many probes in a row must fail before the monitor
+// reports offline, so one slow check does not flip the agent.
+const offlineAfter = 2
+
+// Monitor probes the connection and tracks whether it is up. It starts
+// online; a probe succeeds when any target accepts a TCP connection.
+type Monitor struct {
+	targets []string
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+	timeout time.Duration
+
+	mu        sync.Mutex
+	online    bool
+	since     time.Time // when the current state began
+	failures  int       // failed probes in a row
+	listeners []func(online bool)
+
+	kick chan struct{}
+}
+
+// New creates a monitor dialing targets (host:port), or DefaultTargets
+// when empty.
+func New(targets []string) *Monitor {
+	if len(targets) == 0 {
+		targets = DefaultTargets
+	}
+	dialer := &net.Dialer{}
+	return &Monitor{
+		targets: targets,
+		dial:    dialer.DialContext,
+		timeout: 5 * time.Second,
+		online:  true,
+		since:   time.Now(),
+		kick:    make(chan struct{}, 1),
+	}
+}
+
+// Online reports whether the connection is up, and since when it has been
+// in that state.
+func (m *Monitor) Online() (bool, time.Time) {
+	if m == nil {
+		return true, time.Time{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.online, m.since
+}
+
+// OnChange calls fn, on the monitor's goroutine, whenever the connection
+// goes down or comes back.
+func (m *Monitor) OnChange(fn func(online bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Check probes the targets now and returns whether any answered.
+func (m *Monitor) Check(ctx context.Context) bool {
+	ok := m.probe(ctx)
+	m.record(ok)
+	return ok
+}
+
+// Succeeded records that a network call worked, which proves the
+// connection is up without waiting for the next probe.
+func (m *Monitor) Succeeded() {
+	if m != nil {
+		m.record(true)
+	}
+}
+
+// Suspect asks for a probe soon, after a network call failed in a way
+// that may mean the connection is gone.
+func (m *Monitor) Suspect() {
+	if m == nil {
+		return
+	}
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run probes every interval, and sooner after Suspect, until ctx is done.
+// While offline it probes every interval/4, to notice the connection
+// coming back quickly.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	for {
+		wait := interval
+		if online, _ := m.Online(); !online {
+			wait = interval / 4
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-m.kick:
+		case <-timer.C:
+		}
+		timer.Stop()
+		m.Check(ctx)
+	}
+}
+
+func (m *Monitor) probe(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	results := make(chan bool, len(m.targets))
+	for _, target := range m.targets {
+		go func(target string) {
+			conn, err := m.dial(ctx, "tcp", target)
+			if err == nil {
+				conn.Close()
+			}
+			results <- err == nil
+		}(target)
+	}
+	for range m.targets {
+		if <-results {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Monitor) record(ok bool) {
+	m.mu.Lock()
+	changed := false
+	if ok {
+		m.failures = 0
+		changed = !m.online
+	} else {
+		m.failures++
+		changed = m.online && m.failures >= offlineAfter
+	}
+	if changed {
+		m.online = !m.online
+		m.since = time.Now()
+	}
+	online := m.online
+	listeners := append([]func(bool){}, m.listeners...)
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if online {
+		logger.InfoC("connectivity", "Internet connection is back")
+	} else {
+		logger.WarnC("connectivity", "Internet connection lost, switching to offline mode")
+	}
+	for _, fn := range listeners {
+		fn(online)
+	}
+}
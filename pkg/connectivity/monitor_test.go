@@ -0,0 +1,45 @@
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// TestMonitor_GoesOfflineAfterRepeatedFailures verifies one failed probe is tolerated, two switch to offline, and a success switches back
+func TestMonitor_GoesOfflineAfterRepeatedFailures(t *testing.T) {
+	var up atomic.Bool
+	m := New([]string{"a:443", "b:443"})
+	m.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if up.Load() && address == "b:443" {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return nil, errors.New("network is unreachable")
+	}
+	var changes []bool
+	m.OnChange(func(online bool) { changes = append(changes, online) })
+	ctx := context.Background()
+
+	if m.Check(ctx) {
+		t.Fatal("probe succeeded with every target down")
+	}
+	if online, _ := m.Online(); !online {
+		t.Fatal("offline after a single failed probe")
+	}
+	m.Check(ctx)
+	if online, _ := m.Online(); online {
+		t.Fatal("still online after two failed probes")
+	}
+
+	up.Store(true)
+	if !m.Check(ctx) {
+		t.Fatal("probe failed with one target up")
+	}
+	if online, _ := m.Online(); !online || len(changes) != 2 || changes[0] || !changes[1] {
+		t.Errorf("online = %v, changes = %v, want offline then online", online, changes)
+	}
+}
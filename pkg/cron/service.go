@@ -1,6 +1,7 @@
 package cron
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -23,12 +24,13 @@ type CronSchedule struct {
 }
 
 type CronPayload struct {
-	Kind    string `json:"kind"`
-	Message string `json:"message"`
-	Command string `json:"command,omitempty"`
-	Deliver bool   `json:"deliver"`
-	Channel string `json:"channel,omitempty"`
-	To      string `json:"to,omitempty"`
+	Kind    string            `json:"kind"`
+	Message string            `json:"message"`
+	Command string            `json:"command,omitempty"`
+	Deliver bool              `json:"deliver"`
+	Channel string            `json:"channel,omitempty"`
+	To      string            `json:"to,omitempty"`
+	Data    map[string]string `json:"data,omitempty"` // Kind-specific parameters for tool-owned jobs
 }
 
 type CronJobState struct {
@@ -36,6 +38,9 @@ type CronJobState struct {
 	LastRunAtMS *int64 `json:"lastRunAtMs,omitempty"`
 	LastStatus  string `json:"lastStatus,omitempty"`
 	LastError   string `json:"lastError,omitempty"`
+	// RunningSinceMS is set while the job runs. Still set at Start means
+	// the last run was cut short, and the job runs again.
+	RunningSinceMS *int64 `json:"runningSinceMs,omitempty"`
 }
 
 type CronJob struct {
@@ -65,6 +70,7 @@ type CronService struct {
 	running   bool
 	stopChan  chan struct{}
 	gronx     *gronx.Gronx
+	inFlight  sync.WaitGroup
 }
 
 func NewCronService(storePath string, onJob JobHandler) *CronService {
@@ -91,6 +97,7 @@ func (cs *CronService) Start() error {
 	}
 
 	cs.recomputeNextRuns()
+	cs.resumeInterruptedUnsafe()
 	if err := cs.saveStoreUnsafe(); err != nil {
 		return fmt.Errorf("failed to save store: %w", err)
 	}
@@ -117,6 +124,42 @@ func (cs *CronService) Stop() {
 	}
 }
 
+// Shutdown stops scheduling and waits for running jobs to finish. Jobs
+// still running when ctx ends keep their running mark and run again on
+// the next Start.
+func (cs *CronService) Shutdown(ctx context.Context) error {
+	cs.Stop()
+	done := make(chan struct{})
+	go func() {
+		cs.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resumeInterruptedUnsafe makes jobs whose last run never finished due
+// now, including one-shot jobs whose time has passed since.
+func (cs *CronService) resumeInterruptedUnsafe() {
+	now := time.Now().UnixMilli()
+	for i := range cs.store.Jobs {
+		job := &cs.store.Jobs[i]
+		if job.State.RunningSinceMS == nil {
+			continue
+		}
+		job.State.RunningSinceMS = nil
+		if job.Enabled {
+			log.Printf("[cron] resuming interrupted job %s (%s)", job.ID, job.Name)
+			due := now
+			job.State.NextRunAtMS = &due
+		}
+	}
+}
+
 func (cs *CronService) runLoop(stopChan chan struct{}) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -157,9 +200,12 @@ func (cs *CronService) checkJobs() {
 	}
 	for i := range cs.store.Jobs {
 		if dueMap[cs.store.Jobs[i].ID] {
+			running := now
 			cs.store.Jobs[i].State.NextRunAtMS = nil
+			cs.store.Jobs[i].State.RunningSinceMS = &running
 		}
 	}
+	cs.inFlight.Add(len(dueJobIDs))
 
 	if err := cs.saveStoreUnsafe(); err != nil {
 		log.Printf("[cron] failed to save store: %v", err)
@@ -170,6 +216,7 @@ func (cs *CronService) checkJobs() {
 	// Execute jobs outside lock.
 	for _, jobID := range dueJobIDs {
 		cs.executeJobByID(jobID)
+		cs.inFlight.Done()
 	}
 }
 
@@ -214,6 +261,7 @@ func (cs *CronService) executeJobByID(jobID string) {
 	}
 
 	job.State.LastRunAtMS = &startTime
+	job.State.RunningSinceMS = nil
 	job.UpdatedAtMS = time.Now().UnixMilli()
 
 	if err != nil {
@@ -263,8 +311,16 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 			return nil
 		}
 
-		// Use gronx to calculate next run time
+		// Use gronx to calculate next run time. Cron fields are matched
+		// against the wall clock of the schedule's timezone when set.
 		now := time.UnixMilli(nowMS)
+		if schedule.TZ != "" {
+			if loc, err := time.LoadLocation(schedule.TZ); err == nil {
+				now = now.In(loc)
+			} else {
+				log.Printf("[cron] unknown timezone '%s', using local time", schedule.TZ)
+			}
+		}
 		nextTime, err := gronx.NextTickAfter(schedule.Expr, now, false)
 		if err != nil {
 			log.Printf("[cron] failed to compute next run for expr '%s': %v", schedule.Expr, err)
@@ -344,6 +400,18 @@ func (cs *CronService) saveStoreUnsafe() error {
 }
 
 func (cs *CronService) AddJob(name string, schedule CronSchedule, message string, deliver bool, channel, to string) (*CronJob, error) {
+	return cs.AddJobWithPayload(name, schedule, CronPayload{
+		Kind:    "agent_turn",
+		Message: message,
+		Deliver: deliver,
+		Channel: channel,
+		To:      to,
+	})
+}
+
+// AddJobWithPayload adds a job with a caller-provided payload.
+// Tools use this to schedule their own job kinds (see CronTool.RegisterJobHandler).
+func (cs *CronService) AddJobWithPayload(name string, schedule CronSchedule, payload CronPayload) (*CronJob, error) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
@@ -357,13 +425,7 @@ func (cs *CronService) AddJob(name string, schedule CronSchedule, message string
 		Name:     name,
 		Enabled:  true,
 		Schedule: schedule,
-		Payload: CronPayload{
-			Kind:    "agent_turn",
-			Message: message,
-			Deliver: deliver,
-			Channel: channel,
-			To:      to,
-		},
+		Payload:  payload,
 		State: CronJobState{
 			NextRunAtMS: cs.computeNextRun(&schedule, now),
 		},
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestSaveStore_FilePermissions(t *testing.T) {
@@ -33,6 +34,56 @@ func TestSaveStore_FilePermissions(t *testing.T) {
 	}
 }
 
+func TestComputeNextRun_CronUsesScheduleTimezone(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+
+	// 12:00 UTC is 09:00 in São Paulo (UTC-3, no DST since 2019)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli()
+	next := cs.computeNextRun(&CronSchedule{Kind: "cron", Expr: "0 10 * * *", TZ: "America/Sao_Paulo"}, now)
+	if next == nil {
+		t.Fatal("expected a next run")
+	}
+	want := time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC)
+	if got := time.UnixMilli(*next).UTC(); !got.Equal(want) {
+		t.Errorf("next run = %v, want %v", got, want)
+	}
+}
+
 func int64Ptr(v int64) *int64 {
 	return &v
 }
+
+// TestStart_ResumesInterruptedJob verifies a job whose run was cut short runs again after a restart
+func TestStart_ResumesInterruptedJob(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "jobs.json")
+	cs := NewCronService(storePath, nil)
+	at := time.Now().Add(-time.Minute).UnixMilli()
+	job, err := cs.AddJob("reminder", CronSchedule{Kind: "at", AtMS: &at}, "call mom", true, "telegram", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate power loss mid-run
+	running := at
+	cs.store.Jobs[0].State.RunningSinceMS = &running
+	cs.store.Jobs[0].State.NextRunAtMS = nil
+	cs.saveStoreUnsafe()
+
+	ran := make(chan string, 1)
+	restarted := NewCronService(storePath, func(j *CronJob) (string, error) {
+		ran <- j.ID
+		return "", nil
+	})
+	if err := restarted.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Stop()
+
+	select {
+	case id := <-ran:
+		if id != job.ID {
+			t.Errorf("ran %s, want %s", id, job.ID)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("interrupted job did not run again")
+	}
+}
@@ -4,23 +4,26 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/devices/events"
 	"github.com/sipeed/picoclaw/pkg/devices/sources"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/state"
 )
 
 type Service struct {
-	bus     *bus.MessageBus
-	state   *state.Manager
-	sources []events.EventSource
-	enabled bool
-	ctx     context.Context
-	cancel  context.CancelFunc
-	mu      sync.RWMutex
+	bus      *bus.MessageBus
+	state    *state.Manager
+	profiles *profile.Store
+	sources  []events.EventSource
+	enabled  bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.RWMutex
 }
 
 type Config struct {
@@ -49,6 +52,14 @@ func (s *Service) SetBus(msgBus *bus.MessageBus) {
 	s.bus = msgBus
 }
 
+// SetProfiles sets the user profiles whose quiet hours suppress device
+// notifications.
+func (s *Service) SetProfiles(store *profile.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles = store
+}
+
 func (s *Service) Start(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -107,6 +118,7 @@ func (s *Service) handleEvents(kind events.Kind, eventCh <-chan *events.DeviceEv
 func (s *Service) sendNotification(ev *events.DeviceEvent) {
 	s.mu.RLock()
 	msgBus := s.bus
+	profiles := s.profiles
 	s.mu.RUnlock()
 
 	if msgBus == nil {
@@ -126,6 +138,13 @@ func (s *Service) sendNotification(ev *events.DeviceEvent) {
 		return
 	}
 
+	if _, quiet := profiles.QuietUntil(lastChannel, time.Now()); quiet {
+		logger.DebugCF("devices", "Quiet hours, skipping notification", map[string]interface{}{
+			"event": ev.FormatMessage(),
+		})
+		return
+	}
+
 	msg := ev.FormatMessage()
 	msgBus.PublishOutbound(bus.OutboundMessage{
 		Channel: platform,
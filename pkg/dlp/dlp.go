@@ -0,0 +1,363 @@
+// Package dlp inspects content on its way out (chat replies, uploads,
+// emails) against a policy of prohibited patterns, and blocks it or holds
+// it until an owner approves. It is meant for family and work deployments
+// where the assistant must not pass on card numbers or confidential
+// material, whatever the model was talked into.
+package dlp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of outgoing content.
+const (
+	KindMessage = "message"
+	KindUpload  = "upload"
+	KindEmail   = "email"
+)
+
+// How long a released item's fingerprint lets the same content through,
+// so a tool call blocked pending approval can be retried.
+const approvalTTL = time.Hour
+
+// Policy says what outgoing content may not contain.
+type Policy struct {
+	// CardNumbers flags payment card numbers (13-19 digits passing the
+	// Luhn check, spaces and dashes allowed)
+	CardNumbers bool
+	// Keywords are matched case-insensitively as whole words or phrases
+	Keywords []string
+	// Patterns are extra regular expressions
+	Patterns []*regexp.Regexp
+	// MaxAttachmentBytes limits each attachment or upload (0 = no limit)
+	MaxAttachmentBytes int64
+	// RequireApproval holds flagged content for an owner instead of
+	// refusing it outright
+	RequireApproval bool
+}
+
+// Item is a piece of outgoing content.
+type Item struct {
+	Kind string
+	// Destination is where it goes: "telegram:123", a Drive folder, an
+	// email address
+	Destination string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with an Item. Data may be nil when only the
+// size is known.
+type Attachment struct {
+	Name string
+	Size int64
+	Data []byte
+}
+
+func (it Item) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", it.Kind, it.Destination, it.Text)
+	for _, a := range it.Attachments {
+		fmt.Fprintf(h, "\x00%s\x00%d\x00", a.Name, a.Size)
+		h.Write(a.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var cardCandidate = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// luhn reports whether digits pass the Luhn checksum.
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func findCards(text string) []string {
+	var found []string
+	for _, m := range cardCandidate.FindAllString(text, -1) {
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(m)
+		if len(digits) >= 13 && len(digits) <= 19 && luhn(digits) {
+			found = append(found, digits)
+		}
+	}
+	return found
+}
+
+func keywordPattern(keyword string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(^|\W)` + regexp.QuoteMeta(strings.TrimSpace(keyword)) + `($|\W)`)
+}
+
+// Inspect lists why item breaks the policy, or nil when it does not.
+// Reasons never repeat the offending content beyond a card's last digits.
+func (p *Policy) Inspect(item Item) []string {
+	if p == nil {
+		return nil
+	}
+	texts := []string{item.Text}
+	for _, a := range item.Attachments {
+		texts = append(texts, a.Name)
+		if a.Data != nil && isText(a.Data) {
+			texts = append(texts, string(a.Data))
+		}
+	}
+	text := strings.Join(texts, "\n")
+
+	var reasons []string
+	if p.CardNumbers {
+		for _, card := range findCards(text) {
+			reasons = append(reasons, "card number ending "+card[len(card)-4:])
+		}
+	}
+	for _, kw := range p.Keywords {
+		if strings.TrimSpace(kw) != "" && keywordPattern(kw).MatchString(text) {
+			reasons = append(reasons, fmt.Sprintf("keyword %q", kw))
+		}
+	}
+	for _, re := range p.Patterns {
+		if re.MatchString(text) {
+			reasons = append(reasons, fmt.Sprintf("pattern %q", re.String()))
+		}
+	}
+	if p.MaxAttachmentBytes > 0 {
+		for _, a := range item.Attachments {
+			if a.Size > p.MaxAttachmentBytes {
+				reasons = append(reasons, fmt.Sprintf("%s is %s (limit %s)", a.Name, formatSize(a.Size), formatSize(p.MaxAttachmentBytes)))
+			}
+		}
+	}
+	return reasons
+}
+
+// isText reports whether data looks like text worth scanning, rather
+// than an image or PDF whose bytes would only produce false alarms.
+func isText(data []byte) bool {
+	sample := data
+	if len(sample) > 512 {
+		sample = sample[:512]
+	}
+	for _, b := range sample {
+		if b == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// Violation is the error returned for content the policy stops.
+type Violation struct {
+	Reasons []string
+	// HeldID is set when the content waits for approval
+	HeldID string
+}
+
+func (v *Violation) Error() string {
+	if v.HeldID != "" {
+		return fmt.Sprintf("held for owner approval (%s) by the content policy: %s", v.HeldID, strings.Join(v.Reasons, ", "))
+	}
+	return "blocked by the content policy: " + strings.Join(v.Reasons, ", ")
+}
+
+// Held is content waiting for an owner's decision.
+type Held struct {
+	ID      string
+	Item    Item
+	Reasons []string
+	At      time.Time
+	release func()
+}
+
+// Guard applies a Policy and keeps the items it holds. A nil Guard lets
+// everything through, so callers need not check whether one is set.
+type Guard struct {
+	mu       sync.Mutex
+	policy   *Policy
+	held     map[string]*Held
+	approved map[string]time.Time
+	onHold   func(Held)
+}
+
+// NewGuard returns a Guard enforcing policy (nil allows everything).
+func NewGuard(policy *Policy) *Guard {
+	return &Guard{policy: policy, held: map[string]*Held{}, approved: map[string]time.Time{}}
+}
+
+// SetPolicy replaces the policy, e.g. after a config reload. Held items
+// stay held.
+func (g *Guard) SetPolicy(policy *Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+}
+
+// OnHold sets a function called whenever an item is held, to let owners
+// know.
+func (g *Guard) OnHold(fn func(Held)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onHold = fn
+}
+
+// Check returns nil when item may go out, or a *Violation. When the
+// policy requires approval the item is held; release, if not nil, is
+// called when an owner releases it (to send a held chat message, say).
+// Released content passes Check again for an hour, so a refused tool call
+// can simply be retried.
+func (g *Guard) Check(item Item, release func()) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	policy := g.policy
+	fp := item.fingerprint()
+	now := time.Now()
+	for key, until := range g.approved {
+		if now.After(until) {
+			delete(g.approved, key)
+		}
+	}
+	if _, ok := g.approved[fp]; ok {
+		g.mu.Unlock()
+		return nil
+	}
+	reasons := policy.Inspect(item)
+	if len(reasons) == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if !policy.RequireApproval {
+		g.mu.Unlock()
+		return &Violation{Reasons: reasons}
+	}
+
+	// The same content held twice (a retried tool call) keeps one entry
+	for _, h := range g.held {
+		if h.Item.fingerprint() == fp {
+			g.mu.Unlock()
+			return &Violation{Reasons: reasons, HeldID: h.ID}
+		}
+	}
+	h := &Held{ID: newHeldID(), Item: item, Reasons: reasons, At: now, release: release}
+	g.held[h.ID] = h
+	onHold := g.onHold
+	g.mu.Unlock()
+	if onHold != nil {
+		onHold(*h)
+	}
+	return &Violation{Reasons: reasons, HeldID: h.ID}
+}
+
+// Allow lets item through the next Check without inspection, for content
+// the system itself produces, such as replies to owner commands that
+// name the keywords that were matched.
+func (g *Guard) Allow(item Item) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.approved[item.fingerprint()] = time.Now().Add(approvalTTL)
+}
+
+// Held lists the items waiting for approval, oldest first.
+func (g *Guard) Held() []Held {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := make([]Held, 0, len(g.held))
+	for _, h := range g.held {
+		list = append(list, *h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].At.Before(list[j].At) })
+	return list
+}
+
+// Release approves a held item: its release function runs and the same
+// content passes Check for the next hour.
+func (g *Guard) Release(id string) (Held, error) {
+	h, err := g.take(id)
+	if err != nil {
+		return Held{}, err
+	}
+	g.mu.Lock()
+	g.approved[h.Item.fingerprint()] = time.Now().Add(approvalTTL)
+	g.mu.Unlock()
+	if h.release != nil {
+		h.release()
+	}
+	return *h, nil
+}
+
+// Drop discards a held item.
+func (g *Guard) Drop(id string) (Held, error) {
+	h, err := g.take(id)
+	if err != nil {
+		return Held{}, err
+	}
+	return *h, nil
+}
+
+func (g *Guard) take(id string) (*Held, error) {
+	if g == nil {
+		return nil, fmt.Errorf("nothing is held")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	h, ok := g.held[id]
+	if !ok {
+		return nil, fmt.Errorf("no held item %q", id)
+	}
+	delete(g.held, id)
+	return h, nil
+}
+
+func newHeldID() string {
+	buf := make([]byte, 3)
+	rand.Read(buf)
+	return "h" + hex.EncodeToString(buf)
+}
+
+type guardKey struct{}
+
+// WithGuard returns ctx carrying g, for tools that send content out.
+func WithGuard(ctx context.Context, g *Guard) context.Context {
+	return context.WithValue(ctx, guardKey{}, g)
+}
+
+// FromContext returns the Guard set with WithGuard, or nil.
+func FromContext(ctx context.Context) *Guard {
+	g, _ := ctx.Value(guardKey{}).(*Guard)
+	return g
+}
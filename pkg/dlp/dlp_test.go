@@ -0,0 +1,75 @@
+package dlp
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestInspect_FindsCardsKeywordsAndLargeFiles verifies each rule reports without echoing the content
+func TestInspect_FindsCardsKeywordsAndLargeFiles(t *testing.T) {
+	p := &Policy{
+		CardNumbers:        true,
+		Keywords:           []string{"Project Falcon"},
+		Patterns:           []*regexp.Regexp{regexp.MustCompile(`\bCPF \d{3}`)},
+		MaxAttachmentBytes: 1 << 20,
+	}
+	reasons := p.Inspect(Item{
+		Text: "card 4111 1111 1111 1111, see project falcon notes, CPF 123",
+		Attachments: []Attachment{
+			{Name: "video.mp4", Size: 5 << 20},
+		},
+	})
+	want := []string{"card number ending 1111", `keyword "Project Falcon"`, `pattern "\\bCPF \\d{3}"`, "video.mp4 is 5.0 MB (limit 1.0 MB)"}
+	if strings.Join(reasons, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", reasons, want)
+	}
+
+	// Order numbers that fail the Luhn check and words inside other words pass
+	if r := p.Inspect(Item{Text: "order 4111 1111 1111 1112 for falconry project falcons"}); len(r) != 0 {
+		t.Errorf("false positives: %q", r)
+	}
+}
+
+// TestGuard_HoldAndRelease verifies held content is released once and then passes on retry
+func TestGuard_HoldAndRelease(t *testing.T) {
+	g := NewGuard(&Policy{Keywords: []string{"confidential"}, RequireApproval: true})
+	item := Item{Kind: KindMessage, Destination: "telegram:1", Text: "Confidential: salaries"}
+
+	released := 0
+	err := g.Check(item, func() { released++ })
+	var v *Violation
+	if !errors.As(err, &v) || v.HeldID == "" {
+		t.Fatalf("expected a held violation, got %v", err)
+	}
+	// A retry does not add a second entry
+	g.Check(item, nil)
+	if held := g.Held(); len(held) != 1 {
+		t.Fatalf("held %d items, want 1", len(held))
+	}
+
+	if _, err := g.Release(v.HeldID); err != nil {
+		t.Fatal(err)
+	}
+	if released != 1 || len(g.Held()) != 0 {
+		t.Errorf("released %d times, %d still held", released, len(g.Held()))
+	}
+	if err := g.Check(item, nil); err != nil {
+		t.Errorf("released content refused on retry: %v", err)
+	}
+	if _, err := g.Release(v.HeldID); err == nil {
+		t.Error("releasing twice should fail")
+	}
+}
+
+// TestGuard_NilAllowsEverything verifies a missing guard or policy never blocks
+func TestGuard_NilAllowsEverything(t *testing.T) {
+	var g *Guard
+	if err := g.Check(Item{Text: "4111111111111111"}, nil); err != nil {
+		t.Errorf("nil guard blocked: %v", err)
+	}
+	if err := NewGuard(nil).Check(Item{Text: "4111111111111111"}, nil); err != nil {
+		t.Errorf("nil policy blocked: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package egress decides which hosts picoclaw may connect to when it
+// follows a link it did not choose itself: a URL the model passes to
+// web_fetch or summarize, a feed a user adds, a download URL an API hands
+// back. A hostile page or email can put any link in front of the model,
+// so without a policy those tools reach whatever the gateway can reach,
+// the router's admin page and cloud metadata endpoints included.
+package egress
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/httprec"
+)
+
+// DefaultMaxRedirects is how many redirects a Client follows when the
+// policy does not say.
+const DefaultMaxRedirects = 5
+
+// Policy limits outbound connections.
+type Policy struct {
+	// Allow, when not empty, is the only domains links may lead to; an
+	// entry matches the domain and its subdomains
+	Allow []string
+	// Deny is never connected to, by links or downloads
+	Deny []string
+	// BlockPrivate refuses loopback, private, link-local and unspecified
+	// addresses, whether a URL names them or a host name resolves to them
+	BlockPrivate bool
+	// MaxRedirects bounds the redirects a Client follows; 0 means
+	// DefaultMaxRedirects
+	MaxRedirects int
+}
+
+var (
+	mu     sync.RWMutex
+	policy Policy
+)
+
+// SetPolicy replaces the policy of every check and Client from now on.
+func SetPolicy(p Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+}
+
+// Current returns the policy in force.
+func Current() Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return policy
+}
+
+// CheckLink reports why a link must not be followed, or nil: it must be
+// http or https, not denied, within Allow when Allow is set, and not a
+// private address when those are blocked.
+func CheckLink(u *url.URL) error {
+	p := Current()
+	if err := p.checkDownload(u); err != nil {
+		return err
+	}
+	if len(p.Allow) > 0 && !matchesAny(u.Hostname(), p.Allow) {
+		return fmt.Errorf("%s is not on the list of sites picoclaw may open", u.Hostname())
+	}
+	return nil
+}
+
+// CheckDownload is CheckLink without Allow, for URLs a trusted API (Google
+// Drive or Photos) hands back: an allow list meant for web pages must not
+// break downloads from the user's own accounts.
+func CheckDownload(u *url.URL) error {
+	return Current().checkDownload(u)
+}
+
+// CheckDownloadURL is CheckDownload for an unparsed URL.
+func CheckDownloadURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	return CheckDownload(u)
+}
+
+func (p Policy) checkDownload(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only http and https links can be opened, not %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("the link has no host")
+	}
+	if matchesAny(host, p.Deny) {
+		return fmt.Errorf("%s is blocked", host)
+	}
+	if p.BlockPrivate {
+		if ip := net.ParseIP(host); ip != nil && private(ip) {
+			return fmt.Errorf("%s is a private address", host)
+		}
+		if h := strings.ToLower(strings.TrimSuffix(host, ".")); h == "localhost" || strings.HasSuffix(h, ".localhost") {
+			return fmt.Errorf("%s is a private address", host)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether host is one of domains or a subdomain of one.
+// "*.example.com" is taken as "example.com".
+func matchesAny(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "*."))
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+func private(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() ||
+		// Carrier-grade NAT, used by Tailscale and some ISPs' CPE
+		ip.To4() != nil && ip.To4()[0] == 100 && ip.To4()[1]&0xc0 == 64
+}
+
+// Client returns an HTTP client for following links: every request,
+// redirects included, is checked with CheckLink, redirects are counted
+// against MaxRedirects, and with BlockPrivate the address each connection
+// goes to is checked after DNS resolution, so a public name pointing at
+// 127.0.0.1 gets nowhere either. Requests are recorded by httprec like
+// those of every other client.
+func Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if !Current().BlockPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && private(ip) {
+				return fmt.Errorf("connecting to %s is blocked: it is a private address", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: checkedTransport{&httprec.Transport{Base: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+			TLSHandshakeTimeout: 15 * time.Second,
+		}}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			limit := Current().MaxRedirects
+			if limit <= 0 {
+				limit = DefaultMaxRedirects
+			}
+			if len(via) >= limit {
+				return fmt.Errorf("stopped after %d redirects", limit)
+			}
+			return nil
+		},
+	}
+}
+
+// checkedTransport refuses requests for links CheckLink rejects.
+type checkedTransport struct {
+	base http.RoundTripper
+}
+
+func (t checkedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := CheckLink(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
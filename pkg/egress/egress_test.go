@@ -0,0 +1,118 @@
+package egress
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/httprec"
+)
+
+func usePolicy(t *testing.T, p Policy) {
+	previous := Current()
+	SetPolicy(p)
+	t.Cleanup(func() { SetPolicy(previous) })
+}
+
+// TestCheckLink_AllowDenyAndPrivate verifies links are checked against the allow and deny lists, subdomains included, and private addresses are refused
+func TestCheckLink_AllowDenyAndPrivate(t *testing.T) {
+	usePolicy(t, Policy{
+		Allow:        []string{"example.com", "*.wikipedia.org"},
+		Deny:         []string{"ads.example.com"},
+		BlockPrivate: true,
+	})
+	cases := map[string]bool{
+		"https://example.com/page":          true,
+		"https://www.example.com/page":      true,
+		"https://en.wikipedia.org/wiki/Go":  true,
+		"https://ads.example.com/track":     false,
+		"https://notexample.com/":           false,
+		"https://evil.com/?u=example.com":   false,
+		"ftp://example.com/file":            false,
+		"http://127.0.0.1:8080/":            false,
+		"http://localhost/":                 false,
+		"http://[::1]/":                     false,
+		"http://169.254.169.254/latest/":    false,
+		"http://192.168.1.1/admin":          false,
+		"http://100.100.100.100/":           false,
+		"https://EXAMPLE.com./case-and-dot": true,
+	}
+	for raw, ok := range cases {
+		u, _ := url.Parse(raw)
+		if err := CheckLink(u); (err == nil) != ok {
+			t.Errorf("CheckLink(%s) = %v, want allowed=%v", raw, err, ok)
+		}
+	}
+
+	// Downloads from trusted APIs ignore the allow list but not the rest
+	if err := CheckDownloadURL("https://lh3.googleusercontent.com/photo"); err != nil {
+		t.Errorf("download outside the allow list refused: %v", err)
+	}
+	if err := CheckDownloadURL("http://10.0.0.5/photo"); err == nil {
+		t.Error("download from a private address allowed")
+	}
+}
+
+// TestClient_RefusesBlockedRedirectsAndPrivateHosts verifies the client checks every hop of a redirect chain and refuses private hosts when told to
+func TestClient_RefusesBlockedRedirectsAndPrivateHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/away":
+			http.Redirect(w, r, "http://blocked.example/secret", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			io.WriteString(w, "hello")
+		}
+	}))
+	defer server.Close()
+
+	usePolicy(t, Policy{Deny: []string{"blocked.example"}, MaxRedirects: 3})
+	client := Client(5 * time.Second)
+	resp, err := client.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("plain request failed: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(server.URL + "/away"); err == nil || !strings.Contains(err.Error(), "blocked.example is blocked") {
+		t.Errorf("redirect to a denied host: err = %v", err)
+	}
+	if _, err := client.Get(server.URL + "/loop"); err == nil || !strings.Contains(err.Error(), "stopped after 3 redirects") {
+		t.Errorf("redirect loop: err = %v", err)
+	}
+
+	usePolicy(t, Policy{BlockPrivate: true})
+	if _, err := client.Get(server.URL + "/"); err == nil || !strings.Contains(err.Error(), "private address") {
+		t.Errorf("request to a loopback server: err = %v", err)
+	}
+}
+
+// TestClient_RecordedByHTTPRec verifies requests made with the client
+// show up in the recording of the tool call that made them
+func TestClient_RecordedByHTTPRec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer server.Close()
+	usePolicy(t, Policy{})
+
+	ctx, capture := httprec.WithCapture(context.Background())
+	ctx, call := httprec.Start(ctx, "web_fetch", map[string]interface{}{"url": server.URL})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/page", nil)
+	resp, err := Client(5 * time.Second).Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	call.Finish()
+
+	exchanges := capture.Exchanges()
+	if len(exchanges) != 1 || !strings.HasSuffix(exchanges[0].URL, "/page") || exchanges[0].Status != http.StatusOK {
+		t.Fatalf("recorded %+v, want the one request", exchanges)
+	}
+}
@@ -0,0 +1,107 @@
+// Package embeddings turns text into vectors for semantic search, through
+// an OpenAI-compatible API (OpenAI itself, or Ollama, llama.cpp and vLLM
+// serving a local model), the Gemini API, or an in-process model that
+// needs no network.
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// Embedder turns texts into vectors, one per text, in order.
+type Embedder interface {
+	// Model names the vector space. Vectors from different models cannot
+	// be compared, so caches key on it.
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Config selects an embedder.
+type Config struct {
+	// Provider is "openai", "ollama", "gemini" or "local"
+	Provider string
+	Model    string
+	APIKey   string
+	APIBase  string
+}
+
+// New returns the embedder cfg describes.
+func New(cfg Config) (Embedder, error) {
+	switch strings.ToLower(cfg.Provider) {
+	case "openai":
+		return NewOpenAI(cfg.APIBase, cfg.APIKey, cfg.Model), nil
+	case "ollama":
+		base := cfg.APIBase
+		if base == "" {
+			base = "http://localhost:11434/v1"
+		}
+		model := cfg.Model
+		if model == "" {
+			model = "nomic-embed-text"
+		}
+		return NewOpenAI(base, cfg.APIKey, model), nil
+	case "gemini":
+		return NewGemini(cfg.APIBase, cfg.APIKey, cfg.Model), nil
+	case "local":
+		return NewLocal(), nil
+	default:
+		return nil, fmt.Errorf("unknown embeddings provider %q", cfg.Provider)
+	}
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 when their sizes
+// differ or either is all zeros.
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
+
+// postJSON sends payload to url and decodes the response into out.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("embeddings API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingEmbedder records how many texts it embedded, or fails.
+type countingEmbedder struct {
+	embedded int
+	err      error
+}
+
+func (e *countingEmbedder) Model() string { return "counting" }
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.embedded += len(texts)
+	return NewLocal().Embed(ctx, texts)
+}
+
+// TestOpenAI_EmbedOrdersByIndex verifies the request carries model and inputs and vectors come back in input order
+func TestOpenAI_EmbedOrdersByIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer key" || req.Model != "nomic-embed-text" || len(req.Input) != 2 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	e, _ := New(Config{Provider: "ollama", APIBase: srv.URL + "/v1", APIKey: "key"})
+	vectors, err := e.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("vectors out of order: %v", vectors)
+	}
+}
+
+// TestLocal_RanksRelatedTextFirst verifies the offline embedder puts lines sharing words and word stems ahead of unrelated ones
+func TestLocal_RanksRelatedTextFirst(t *testing.T) {
+	ix := NewIndex(filepath.Join(t.TempDir(), "ix.json"), NewLocal(), nil)
+	docs := []string{
+		"Bought milk and eggs",
+		"Dentist appointments are on Tuesdays with Dr. Lima",
+		"Reunião de condomínio na sexta",
+	}
+	matches, err := ix.Rank(context.Background(), "when is my dentist appointment", docs)
+	if err != nil || matches[0].Index != 1 {
+		t.Errorf("ranking %v, %v", matches, err)
+	}
+	if matches, _ := ix.Rank(context.Background(), "reuniao", docs); matches[0].Index != 2 {
+		t.Errorf("accents not folded: %v", matches)
+	}
+}
+
+// TestIndex_CachesAndFallsBack verifies unchanged documents are embedded once and a failing provider hands ranking to the fallback
+func TestIndex_CachesAndFallsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ix.json")
+	primary := &countingEmbedder{}
+	docs := []string{"alpha note", "beta note"}
+
+	NewIndex(path, primary, nil).Rank(context.Background(), "alpha", docs)
+	ix := NewIndex(path, primary, NewLocal())
+	ix.Rank(context.Background(), "beta", append(docs, "gamma note"))
+	// 1 query + 2 docs, then 1 query + the one new doc
+	if primary.embedded != 5 {
+		t.Errorf("embedded %d texts, want 5", primary.embedded)
+	}
+
+	primary.err = errors.New("offline")
+	matches, err := ix.Rank(context.Background(), "gamma", append(docs, "gamma note"))
+	if err != nil || matches[0].Index != 2 {
+		t.Errorf("fallback ranking %v, %v", matches, err)
+	}
+	if _, err := NewIndex(path, primary, nil).Rank(context.Background(), "x", docs); err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Errorf("error without a fallback: %v", err)
+	}
+}
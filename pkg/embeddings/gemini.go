@@ -0,0 +1,68 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// geminiBatch is the most texts batchEmbedContents takes in one request.
+const geminiBatch = 100
+
+// Gemini calls the Gemini API's batchEmbedContents.
+type Gemini struct {
+	apiBase string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func NewGemini(apiBase, apiKey, model string) *Gemini {
+	if apiBase == "" {
+		apiBase = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	if model == "" {
+		model = "text-embedding-004"
+	}
+	return &Gemini{
+		apiBase: strings.TrimRight(apiBase, "/"),
+		apiKey:  apiKey,
+		model:   strings.TrimPrefix(model, "models/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (e *Gemini) Model() string { return e.model }
+
+func (e *Gemini) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += geminiBatch {
+		end := min(start+geminiBatch, len(texts))
+		requests := make([]map[string]interface{}, 0, end-start)
+		for _, text := range texts[start:end] {
+			requests = append(requests, map[string]interface{}{
+				"model":   "models/" + e.model,
+				"content": map[string]interface{}{"parts": []map[string]string{{"text": text}}},
+			})
+		}
+		var resp struct {
+			Embeddings []struct {
+				Values []float32 `json:"values"`
+			} `json:"embeddings"`
+		}
+		target := fmt.Sprintf("%s/models/%s:batchEmbedContents?key=%s", e.apiBase, e.model, url.QueryEscape(e.apiKey))
+		if err := postJSON(ctx, e.client, target, nil, map[string]interface{}{"requests": requests}, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("got %d embeddings for %d texts", len(resp.Embeddings), end-start)
+		}
+		for _, emb := range resp.Embeddings {
+			vectors = append(vectors, emb.Values)
+		}
+	}
+	return vectors, nil
+}
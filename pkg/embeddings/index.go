@@ -0,0 +1,174 @@
+package embeddings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/governor"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Match is one document ranked against a query.
+type Match struct {
+	// Index is the document's position in the slice given to Rank
+	Index int
+	Score float32
+	// Relevant is set when the score is high enough, for the model that
+	// ranked it, for the document to be about the query
+	Relevant bool
+}
+
+// defaultMinScore is the similarity from which API models' documents
+// count as relevant.
+const defaultMinScore = 0.35
+
+// scoredEmbedder is an Embedder whose scores run lower or higher than an
+// API model's.
+type scoredEmbedder interface {
+	MinScore() float32
+}
+
+// Index ranks documents by similarity to a query. Document vectors are
+// cached in a file so unchanged text is embedded once. When the primary
+// embedder fails (offline, out of quota) the fallback ranks instead, with
+// its own vectors: the two models' vectors are never mixed.
+type Index struct {
+	path     string
+	primary  Embedder
+	fallback Embedder
+
+	mu     sync.Mutex
+	loaded bool
+	// vectors are keyed by model and the SHA-256 of the text
+	vectors map[string][]float32
+}
+
+// NewIndex caches vectors in the file at path. fallback may be nil.
+func NewIndex(path string, primary, fallback Embedder) *Index {
+	return &Index{path: path, primary: primary, fallback: fallback, vectors: map[string][]float32{}}
+}
+
+// Rank scores every document against query, best first.
+func (ix *Index) Rank(ctx context.Context, query string, docs []string) ([]Match, error) {
+	matches, err := ix.rank(ctx, ix.primary, query, docs)
+	// A busy device would be just as busy for the fallback
+	var busy *governor.BusyError
+	if err != nil && ix.fallback != nil && !errors.As(err, &busy) {
+		logger.WarnCF("embeddings", "Embedder failed, ranking with the fallback", map[string]interface{}{
+			"model":    ix.primary.Model(),
+			"fallback": ix.fallback.Model(),
+			"error":    err.Error(),
+		})
+		return ix.rank(ctx, ix.fallback, query, docs)
+	}
+	return matches, err
+}
+
+func (ix *Index) rank(ctx context.Context, e Embedder, query string, docs []string) ([]Match, error) {
+	ix.mu.Lock()
+	ix.loadLocked()
+	keys := make([]string, len(docs))
+	var missing []string
+	var missingKeys []string
+	for i, doc := range docs {
+		keys[i] = vectorKey(e.Model(), doc)
+		if _, ok := ix.vectors[keys[i]]; !ok {
+			missing = append(missing, doc)
+			missingKeys = append(missingKeys, keys[i])
+		}
+	}
+	ix.mu.Unlock()
+
+	// Embedding new documents is heavy work; a lone query is not
+	if len(missing) > 0 {
+		release, err := governor.Acquire(ctx, governor.Embeddings)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	vectors, err := e.Embed(ctx, append([]string{query}, missing...))
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(missing)+1 {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(missing)+1)
+	}
+	q := vectors[0]
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for i, key := range missingKeys {
+		ix.vectors[key] = vectors[i+1]
+	}
+	minScore := float32(defaultMinScore)
+	if scored, ok := e.(scoredEmbedder); ok {
+		minScore = scored.MinScore()
+	}
+	matches := make([]Match, len(docs))
+	for i, key := range keys {
+		score := Cosine(q, ix.vectors[key])
+		matches[i] = Match{Index: i, Score: score, Relevant: score >= minScore}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Score > matches[b].Score })
+	if len(missing) > 0 {
+		ix.saveLocked(keys)
+	}
+	return matches, nil
+}
+
+func vectorKey(model, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return model + ":" + hex.EncodeToString(sum[:16])
+}
+
+func (ix *Index) loadLocked() {
+	if ix.loaded {
+		return
+	}
+	ix.loaded = true
+	if data, err := os.ReadFile(ix.path); err == nil {
+		json.Unmarshal(data, &ix.vectors)
+	}
+}
+
+// saveLocked keeps the vectors of the texts just ranked, under any model
+// (for when the primary is back), and drops the rest, so edited and
+// deleted text does not pile up.
+func (ix *Index) saveLocked(current []string) {
+	texts := make(map[string]bool, len(current))
+	for _, k := range current {
+		texts[textHash(k)] = true
+	}
+	for key := range ix.vectors {
+		if !texts[textHash(key)] {
+			delete(ix.vectors, key)
+		}
+	}
+	data, err := json.Marshal(ix.vectors)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(ix.path), 0755)
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, ix.path); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// textHash is the text part of a vector key.
+func textHash(key string) string {
+	return key[strings.LastIndex(key, ":")+1:]
+}
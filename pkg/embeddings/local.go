@@ -0,0 +1,88 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// localDimensions is the size of the vectors Local makes.
+const localDimensions = 512
+
+// Local embeds text in-process by hashing its words and their character
+// trigrams into a fixed-size vector. It knows no synonyms, so it finds
+// "dentist appointment" from "dentist" but not from "doctor"; in exchange
+// it needs no model download, no network and next to no CPU, which keeps
+// semantic search working offline and on small boards.
+type Local struct{}
+
+func NewLocal() *Local { return &Local{} }
+
+func (e *Local) Model() string { return "local-hash-v1" }
+
+// MinScore is lower than for API models: a query about two things shares
+// only part of its words with a line about one of them.
+func (e *Local) MinScore() float32 { return 0.2 }
+
+func (e *Local) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = hashEmbed(text)
+	}
+	return vectors, nil
+}
+
+func hashEmbed(text string) []float32 {
+	v := make([]float32, localDimensions)
+	add := func(feature string, weight float32) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		// The top bit picks the sign, so unrelated features cancel out
+		// instead of piling up in the same buckets
+		if sum&(1<<31) != 0 {
+			weight = -weight
+		}
+		v[sum%localDimensions] += weight
+	}
+	for _, word := range localWords(text) {
+		add("w:"+word, 1)
+		padded := " " + word + " "
+		runes := []rune(padded)
+		for i := 0; i+3 <= len(runes); i++ {
+			add("t:"+string(runes[i:i+3]), 0.5)
+		}
+	}
+	var norm2 float64
+	for _, x := range v {
+		norm2 += float64(x) * float64(x)
+	}
+	if norm2 > 0 {
+		scale := float32(1 / math.Sqrt(norm2))
+		for i := range v {
+			v[i] *= scale
+		}
+	}
+	return v
+}
+
+// unaccent folds the accented Latin letters of the languages picoclaw is
+// most used in.
+var unaccent = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n", "ß", "ss",
+)
+
+// localWords lowercases text, drops accents and splits it into words, so
+// "Reunião" and "reuniao" match.
+func localWords(text string) []string {
+	return strings.FieldsFunc(unaccent.Replace(strings.ToLower(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
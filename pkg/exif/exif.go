@@ -0,0 +1,347 @@
+// Package exif reads the few EXIF fields the assistant needs from JPEG
+// photos: when the photo was taken, where, and with which camera.
+package exif
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrNoExif is returned when the image carries no EXIF block.
+var ErrNoExif = errors.New("no EXIF data")
+
+// maxExifSize bounds how much of the APP1 segment is read.
+const maxExifSize = 64 << 10
+
+// Info holds the parsed fields. Taken has no timezone information in EXIF,
+// so it is returned in UTC with the wall clock values as recorded.
+type Info struct {
+	Taken       time.Time
+	HasLocation bool
+	Latitude    float64
+	Longitude   float64
+	Make        string
+	Model       string
+}
+
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+)
+
+// Decode reads EXIF from the start of a JPEG stream. Only the bytes up to
+// the APP1 segment are consumed, so callers can pass a truncated download.
+func Decode(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, fmt.Errorf("not a JPEG image")
+	}
+
+	for {
+		var marker [2]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return nil, ErrNoExif
+		}
+		if marker[0] != 0xFF {
+			return nil, fmt.Errorf("corrupt JPEG marker")
+		}
+		// Start of scan: image data follows, no more metadata
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, ErrNoExif
+		}
+		var size uint16
+		if err := binary.Read(br, binary.BigEndian, &size); err != nil || size < 2 {
+			return nil, ErrNoExif
+		}
+		length := int(size) - 2
+		if marker[1] != 0xE1 {
+			if _, err := br.Discard(length); err != nil {
+				return nil, ErrNoExif
+			}
+			continue
+		}
+
+		segment := make([]byte, min(length, maxExifSize))
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return nil, fmt.Errorf("truncated EXIF segment: %w", err)
+		}
+		if len(segment) < 6 || string(segment[:6]) != "Exif\x00\x00" {
+			// Some APP1 segments hold XMP instead
+			if length > len(segment) {
+				br.Discard(length - len(segment))
+			}
+			continue
+		}
+		return parseTIFF(segment[6:])
+	}
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+func parseTIFF(data []byte) (*Info, error) {
+	if len(data) < 8 {
+		return nil, ErrNoExif
+	}
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid TIFF byte order")
+	}
+
+	info := &Info{}
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+	var dateTime string
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagMake:
+			info.Make = t.ascii(e)
+		case tagModel:
+			info.Model = t.ascii(e)
+		case tagDateTime:
+			dateTime = t.ascii(e)
+		case tagExifIFD:
+			if sub, err := t.readIFD(t.uint32(e)); err == nil {
+				for _, s := range sub {
+					if s.tag == tagDateTimeOriginal {
+						dateTime = t.ascii(s)
+					}
+				}
+			}
+		case tagGPSIFD:
+			if sub, err := t.readIFD(t.uint32(e)); err == nil {
+				t.parseGPS(sub, info)
+			}
+		}
+	}
+	if dateTime != "" {
+		info.Taken, _ = time.Parse("2006:01:02 15:04:05", dateTime)
+	}
+	return info, nil
+}
+
+func (t *tiff) readIFD(offset uint32) ([]ifdEntry, error) {
+	if int(offset)+2 > len(t.data) {
+		return nil, fmt.Errorf("IFD offset out of range")
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	entries := make([]ifdEntry, 0, count)
+	pos := int(offset) + 2
+	for i := 0; i < count && pos+12 <= len(t.data); i++ {
+		e := ifdEntry{
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+		}
+		size := int(e.count) * typeSize(e.typ)
+		if size <= 4 {
+			e.value = t.data[pos+8 : pos+8+size]
+		} else if off := int(t.order.Uint32(t.data[pos+8:])); off >= 0 && off+size <= len(t.data) {
+			e.value = t.data[off : off+size]
+		}
+		entries = append(entries, e)
+		pos += 12
+	}
+	return entries, nil
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 7: // BYTE, ASCII, UNDEFINED
+		return 1
+	case 3: // SHORT
+		return 2
+	case 4, 9: // LONG, SLONG
+		return 4
+	case 5, 10: // RATIONAL, SRATIONAL
+		return 8
+	default:
+		return 0
+	}
+}
+
+func (t *tiff) ascii(e ifdEntry) string {
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+func (t *tiff) uint32(e ifdEntry) uint32 {
+	switch {
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	}
+	return 0
+}
+
+// degrees converts a GPS degrees/minutes/seconds rational triple.
+func (t *tiff) degrees(e ifdEntry) (float64, bool) {
+	if e.typ != 5 || len(e.value) < 24 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num := t.order.Uint32(e.value[i*8:])
+		den := t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+func (t *tiff) parseGPS(entries []ifdEntry, info *Info) {
+	var lat, lon float64
+	var latOK, lonOK bool
+	latRef, lonRef := "N", "E"
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.ascii(e)
+		case tagGPSLatitude:
+			lat, latOK = t.degrees(e)
+		case tagGPSLongitudeRef:
+			lonRef = t.ascii(e)
+		case tagGPSLongitude:
+			lon, lonOK = t.degrees(e)
+		}
+	}
+	if !latOK || !lonOK || (lat == 0 && lon == 0) {
+		return
+	}
+	if latRef == "S" {
+		lat = -lat
+	}
+	if lonRef == "W" {
+		lon = -lon
+	}
+	info.HasLocation = true
+	info.Latitude = math.Round(lat*1e6) / 1e6
+	info.Longitude = math.Round(lon*1e6) / 1e6
+}
+
+// Segment returns a JPEG's EXIF segment, marker and length included, so it
+// can be carried over to a re-encoded copy; nil when there is none.
+func Segment(jpeg []byte) []byte {
+	var found []byte
+	eachExifSegment(jpeg, func(segment []byte) bool {
+		found = segment
+		return false
+	})
+	return found
+}
+
+// StripLocation blanks the GPS directory of a JPEG's EXIF block in place
+// and reports whether there was one. The directory is emptied and its
+// values zeroed, so the file keeps its size and layout and the other
+// fields (orientation, date, camera) survive.
+func StripLocation(jpeg []byte) bool {
+	stripped := false
+	eachExifSegment(jpeg, func(segment []byte) bool {
+		if stripGPS(segment[10:]) {
+			stripped = true
+		}
+		return true
+	})
+	return stripped
+}
+
+// eachExifSegment calls fn with each APP1 EXIF segment of a JPEG, from
+// its marker on, until fn returns false or the image data starts.
+func eachExifSegment(jpeg []byte, fn func(segment []byte) bool) {
+	if len(jpeg) < 4 || jpeg[0] != 0xFF || jpeg[1] != 0xD8 {
+		return
+	}
+	for pos := 2; pos+4 <= len(jpeg) && jpeg[pos] == 0xFF; {
+		marker := jpeg[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(jpeg[pos+2:]))
+		if end > len(jpeg) || end < pos+4 {
+			return
+		}
+		if marker == 0xE1 && end-pos >= 18 && string(jpeg[pos+4:pos+10]) == "Exif\x00\x00" && !fn(jpeg[pos:end]) {
+			return
+		}
+		pos = end
+	}
+}
+
+// stripGPS empties the GPS directory referenced from IFD0 of a TIFF block.
+// Zeroing the entry count and the entries also leaves the directory's
+// next-IFD pointer reading as 0.
+func stripGPS(data []byte) bool {
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return false
+	}
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return false
+	}
+	stripped := false
+	for _, e := range ifd0 {
+		if e.tag != tagGPSIFD {
+			continue
+		}
+		offset := int(t.uint32(e))
+		entries, err := t.readIFD(uint32(offset))
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+		for _, gps := range entries {
+			clear(gps.value)
+		}
+		clear(data[offset:min(offset+2+12*len(entries), len(data))])
+		stripped = true
+	}
+	return stripped
+}
+
+// DistanceKm returns the great-circle distance between two points.
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,160 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+type testEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+// buildJPEG assembles a JPEG with an EXIF segment holding IFD0 (make, exif
+// pointer, gps pointer), an Exif IFD and a GPS IFD.
+func buildJPEG(t *testing.T) []byte {
+	order := binary.LittleEndian
+	rational := func(vals ...uint32) []byte {
+		b := make([]byte, 0, len(vals)*4)
+		for _, v := range vals {
+			b = order.AppendUint32(b, v)
+		}
+		return b
+	}
+
+	var tiffData bytes.Buffer
+	tiffData.Write([]byte("II"))
+	binary.Write(&tiffData, order, uint16(42))
+	binary.Write(&tiffData, order, uint32(8))
+
+	// Lays out an IFD at the current offset with out-of-line values after it
+	writeIFD := func(entries []testEntry) {
+		start := tiffData.Len()
+		dataOff := start + 2 + len(entries)*12 + 4
+		var extra bytes.Buffer
+		binary.Write(&tiffData, order, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(&tiffData, order, e.tag)
+			binary.Write(&tiffData, order, e.typ)
+			binary.Write(&tiffData, order, e.count)
+			if len(e.data) <= 4 {
+				v := make([]byte, 4)
+				copy(v, e.data)
+				tiffData.Write(v)
+			} else {
+				binary.Write(&tiffData, order, uint32(dataOff+extra.Len()))
+				extra.Write(e.data)
+			}
+		}
+		binary.Write(&tiffData, order, uint32(0))
+		tiffData.Write(extra.Bytes())
+	}
+
+	ifd0Size := 2 + 3*12 + 4 + len("Pixel 9\x00")
+	exifOff := 8 + ifd0Size
+	exifSize := 2 + 12 + 4 + 20
+	gpsOff := exifOff + exifSize
+	writeIFD([]testEntry{
+		{tagMake, 2, 8, []byte("Pixel 9\x00")},
+		{tagExifIFD, 4, 1, order.AppendUint32(nil, uint32(exifOff))},
+		{tagGPSIFD, 4, 1, order.AppendUint32(nil, uint32(gpsOff))},
+	})
+	writeIFD([]testEntry{
+		{tagDateTimeOriginal, 2, 20, []byte("2026:03:14 18:02:33\x00")},
+	})
+	writeIFD([]testEntry{
+		{tagGPSLatitudeRef, 2, 2, []byte("N\x00")},
+		{tagGPSLatitude, 5, 3, rational(38, 1, 42, 1, 3000, 100)},
+		{tagGPSLongitudeRef, 2, 2, []byte("W\x00")},
+		{tagGPSLongitude, 5, 3, rational(9, 1, 8, 1, 0, 1)},
+	})
+
+	payload := append([]byte("Exif\x00\x00"), tiffData.Bytes()...)
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8})
+	// An unrelated APP0 segment first
+	jpeg.Write([]byte{0xFF, 0xE0, 0x00, 0x04, 'J', 'F'})
+	jpeg.Write([]byte{0xFF, 0xE1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(len(payload)+2))
+	jpeg.Write(payload)
+	jpeg.Write([]byte{0xFF, 0xDA, 0x00, 0x02})
+	return jpeg.Bytes()
+}
+
+// TestDecode verifies date, camera and GPS position are read from an EXIF block
+func TestDecode(t *testing.T) {
+	info, err := Decode(bytes.NewReader(buildJPEG(t)))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if info.Make != "Pixel 9" {
+		t.Errorf("Make = %q", info.Make)
+	}
+	if want := time.Date(2026, 3, 14, 18, 2, 33, 0, time.UTC); !info.Taken.Equal(want) {
+		t.Errorf("Taken = %v, want %v", info.Taken, want)
+	}
+	if !info.HasLocation || math.Abs(info.Latitude-38.7083) > 0.001 || math.Abs(info.Longitude+9.1333) > 0.001 {
+		t.Errorf("Unexpected location: %+v", info)
+	}
+}
+
+// TestDecode_NoExif verifies images without metadata report ErrNoExif
+func TestDecode_NoExif(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}))
+	if err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+	if _, err := Decode(bytes.NewReader([]byte("GIF89a"))); err == nil {
+		t.Errorf("Expected non-JPEG input to fail")
+	}
+}
+
+// TestSegment verifies the EXIF segment is found past other APP segments and can be decoded on its own
+func TestSegment(t *testing.T) {
+	segment := Segment(buildJPEG(t))
+	if len(segment) < 4 || segment[1] != 0xE1 {
+		t.Fatalf("unexpected segment: % x", segment[:min(len(segment), 4)])
+	}
+	info, err := Decode(bytes.NewReader(append([]byte{0xFF, 0xD8}, segment...)))
+	if err != nil || info.Make != "Pixel 9" {
+		t.Errorf("segment does not decode: %+v %v", info, err)
+	}
+	if Segment([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}) != nil {
+		t.Error("segment found in an image without EXIF")
+	}
+}
+
+// TestStripLocation verifies the GPS position is blanked in place while the camera and date are kept
+func TestStripLocation(t *testing.T) {
+	data := buildJPEG(t)
+	size := len(data)
+	if !StripLocation(data) {
+		t.Fatal("no location stripped")
+	}
+	if len(data) != size {
+		t.Errorf("size changed from %d to %d", size, len(data))
+	}
+	info, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if info.HasLocation || info.Make != "Pixel 9" || info.Taken.IsZero() {
+		t.Errorf("Unexpected info after strip: %+v", info)
+	}
+	if StripLocation(data) {
+		t.Error("stripped twice")
+	}
+}
+
+// TestDistanceKm verifies the haversine distance for a known pair of cities
+func TestDistanceKm(t *testing.T) {
+	// Lisbon to Porto is about 274 km
+	d := DistanceKm(38.7223, -9.1393, 41.1579, -8.6291)
+	if d < 270 || d > 280 {
+		t.Errorf("Unexpected distance: %.1f", d)
+	}
+}
@@ -0,0 +1,193 @@
+// Package features gates experimental subsystems behind named flags, so a
+// build can carry them compiled in while a deployment keeps them off. A
+// flag's state comes from, in order: an owner's runtime toggle, the
+// "features" section of the config, and the flag's built-in default.
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Flag names.
+const (
+	// Browser lets the agent drive a headless browser
+	Browser = "browser"
+	// Subagents lets the agent spawn subagents for background and
+	// delegated work
+	Subagents = "subagents"
+	// Streaming shows a long-running tool's output in the chat as it comes
+	Streaming = "streaming"
+	// PlanPreview holds three or more changes asked for at once as a plan
+	// for the user to approve before any of them runs
+	PlanPreview = "plan_preview"
+)
+
+// Flag describes a known feature flag.
+type Flag struct {
+	Name        string
+	Description string
+	// Default is the state when neither the config nor an owner set it
+	Default bool
+}
+
+// Known lists every flag, in the order they are shown.
+var Known = []Flag{
+	{Name: Browser, Description: "headless browser tool", Default: false},
+	{Name: Subagents, Description: "spawn and subagent tools", Default: true},
+	{Name: Streaming, Description: "live output of long-running tools", Default: true},
+	{Name: PlanPreview, Description: "approve multi-step changes as a plan first", Default: false},
+}
+
+// Lookup returns the known flag with the given name.
+func Lookup(name string) (Flag, bool) {
+	for _, f := range Known {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// Names returns the known flag names, sorted.
+func Names() []string {
+	names := make([]string, 0, len(Known))
+	for _, f := range Known {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// State is a flag's current state and where it comes from: "default",
+// "config" or "owner".
+type State struct {
+	Flag
+	Enabled bool
+	Source  string
+}
+
+// Flags holds the configured flag values and the owner's runtime toggles,
+// which are saved in the workspace and survive restarts. It is safe for
+// concurrent use; a nil Flags reports every flag at its default.
+type Flags struct {
+	path      string
+	mu        sync.RWMutex
+	config    map[string]bool
+	overrides map[string]bool
+}
+
+// New loads the runtime toggles saved in the workspace state directory.
+func New(workspace string) *Flags {
+	f := &Flags{
+		path:      filepath.Join(workspace, "state", "features.json"),
+		overrides: make(map[string]bool),
+	}
+	if data, err := os.ReadFile(f.path); err == nil {
+		json.Unmarshal(data, &f.overrides)
+	}
+	return f
+}
+
+// SetConfig replaces the values from the config. Unknown names have no
+// effect; config validation reports them.
+func (f *Flags) SetConfig(values map[string]bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = values
+}
+
+// Enabled reports whether the named flag is on. Unknown flags are off.
+func (f *Flags) Enabled(name string) bool {
+	return f.State(name).Enabled
+}
+
+// State returns the named flag's state.
+func (f *Flags) State(name string) State {
+	flag, ok := Lookup(name)
+	if !ok {
+		return State{Flag: Flag{Name: name}, Source: "default"}
+	}
+	if f == nil {
+		return State{Flag: flag, Enabled: flag.Default, Source: "default"}
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if on, ok := f.overrides[name]; ok {
+		return State{Flag: flag, Enabled: on, Source: "owner"}
+	}
+	if on, ok := f.config[name]; ok {
+		return State{Flag: flag, Enabled: on, Source: "config"}
+	}
+	return State{Flag: flag, Enabled: flag.Default, Source: "default"}
+}
+
+// All returns the state of every known flag.
+func (f *Flags) All() []State {
+	states := make([]State, 0, len(Known))
+	for _, flag := range Known {
+		states = append(states, f.State(flag.Name))
+	}
+	return states
+}
+
+// Toggle turns a flag on or off at runtime, overriding the config until
+// Reset.
+func (f *Flags) Toggle(name string, on bool) error {
+	if _, ok := Lookup(name); !ok {
+		return fmt.Errorf("unknown feature %q (known: %s)", name, strings.Join(Names(), ", "))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, had := f.overrides[name]
+	f.overrides[name] = on
+	if err := f.saveLocked(); err != nil {
+		if had {
+			f.overrides[name] = previous
+		} else {
+			delete(f.overrides, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Reset drops a runtime toggle, so the flag follows the config again.
+func (f *Flags) Reset(name string) error {
+	if _, ok := Lookup(name); !ok {
+		return fmt.Errorf("unknown feature %q (known: %s)", name, strings.Join(Names(), ", "))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.overrides[name]; !ok {
+		return nil
+	}
+	delete(f.overrides, name)
+	return f.saveLocked()
+}
+
+// saveLocked writes the toggles with temp file + rename so a crash never
+// leaves a truncated file. Must be called with the lock held.
+func (f *Flags) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(f.overrides, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal feature toggles: %w", err)
+	}
+	tempFile := f.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, f.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
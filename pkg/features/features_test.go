@@ -0,0 +1,41 @@
+package features
+
+import "testing"
+
+// TestFlags_OwnerToggleOverridesConfig verifies a runtime toggle wins over the config, survives a reload from disk, and reset falls back to the config then the default
+func TestFlags_OwnerToggleOverridesConfig(t *testing.T) {
+	workspace := t.TempDir()
+	flags := New(workspace)
+	if flags.Enabled(Browser) || !flags.Enabled(Subagents) || flags.Enabled("teleport") {
+		t.Fatal("unexpected defaults")
+	}
+	var none *Flags
+	if !none.Enabled(Streaming) {
+		t.Error("nil flags do not report defaults")
+	}
+
+	flags.SetConfig(map[string]bool{Subagents: false})
+	if s := flags.State(Subagents); s.Enabled || s.Source != "config" {
+		t.Errorf("config not applied: %+v", s)
+	}
+	if err := flags.Toggle(Subagents, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.Toggle("teleport", true); err == nil {
+		t.Error("unknown feature toggled")
+	}
+
+	reloaded := New(workspace)
+	reloaded.SetConfig(map[string]bool{Subagents: false})
+	if s := reloaded.State(Subagents); !s.Enabled || s.Source != "owner" {
+		t.Errorf("toggle not kept: %+v", s)
+	}
+	reloaded.Reset(Subagents)
+	if reloaded.Enabled(Subagents) {
+		t.Error("reset did not fall back to the config")
+	}
+	reloaded.SetConfig(nil)
+	if s := reloaded.State(Subagents); !s.Enabled || s.Source != "default" {
+		t.Errorf("default not restored: %+v", s)
+	}
+}
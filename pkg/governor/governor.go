@@ -0,0 +1,287 @@
+// Package governor caps how many heavy operations (video transcoding,
+// OCR, embedding batches) run at once, so a small board answering chats
+// is not brought to a crawl by a slideshow and three receipts arriving
+// together. Limits are sized from the RAM and CPUs found at startup; work
+// over the limit waits its turn for a while and is then turned down with
+// a message saying why.
+package governor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Kind is a type of heavy operation.
+type Kind string
+
+const (
+	Transcode  Kind = "transcoding"
+	OCR        Kind = "OCR"
+	Embeddings Kind = "embeddings"
+)
+
+// memoryCost is roughly how much RAM one operation of each kind takes,
+// used to size the per-kind limits.
+var memoryCost = map[Kind]int{
+	Transcode:  384,
+	OCR:        192,
+	Embeddings: 128,
+}
+
+const (
+	// DefaultMaxWait is how long work waits for a slot before it is
+	// turned down
+	DefaultMaxWait = 2 * time.Minute
+	// maxTotal bounds the automatic limit on big machines
+	maxTotal = 8
+)
+
+// Resources are what the device has to spare.
+type Resources struct {
+	// MemoryMB is the RAM available at startup; 0 when unknown
+	MemoryMB int
+	CPUs     int
+}
+
+func (r Resources) String() string {
+	if r.MemoryMB == 0 {
+		return fmt.Sprintf("%d CPUs", r.CPUs)
+	}
+	return fmt.Sprintf("%d MB RAM, %d CPUs", r.MemoryMB, r.CPUs)
+}
+
+// Detect reads the available memory from /proc/meminfo (MemAvailable,
+// else MemTotal) and counts the CPUs.
+func Detect() Resources {
+	r := Resources{CPUs: runtime.NumCPU()}
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return r
+	}
+	defer f.Close()
+	fields := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Fields(rest)
+		if len(parts) == 0 {
+			continue
+		}
+		if kb, err := strconv.Atoi(parts[0]); err == nil {
+			fields[name] = kb
+		}
+	}
+	if kb, ok := fields["MemAvailable"]; ok {
+		r.MemoryMB = kb / 1024
+	} else {
+		r.MemoryMB = fields["MemTotal"] / 1024
+	}
+	return r
+}
+
+// Limits bound the heavy operations in flight.
+type Limits struct {
+	// Total is how many run at once across kinds
+	Total int
+	// PerKind caps each kind below Total; kinds not listed get Total
+	PerKind map[Kind]int
+	// MaxQueue is how many may wait for a slot; more are turned down
+	// at once
+	MaxQueue int
+	// MaxWait is how long one waits before it is turned down
+	MaxWait time.Duration
+}
+
+// LimitsFor sizes the limits for r: half the CPUs, leaving the rest for
+// the agent and channels, and per kind no more than fits in half the
+// memory. total, when positive, replaces the automatic total.
+func LimitsFor(r Resources, total int) Limits {
+	if total <= 0 {
+		total = min(max(r.CPUs/2, 1), maxTotal)
+	}
+	l := Limits{Total: total, PerKind: map[Kind]int{}, MaxQueue: 4 * total, MaxWait: DefaultMaxWait}
+	for kind, cost := range memoryCost {
+		n := total
+		if r.MemoryMB > 0 {
+			n = min(n, max(r.MemoryMB/2/cost, 1))
+		}
+		l.PerKind[kind] = n
+	}
+	return l
+}
+
+// BusyError is returned when work is turned down because the device is
+// busy with other heavy operations.
+type BusyError struct {
+	Kind    Kind
+	Running int
+	Waiting int
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("the device is busy with other heavy work (%d running, %d waiting), so %s was not started; try again in a few minutes",
+		e.Running, e.Waiting, e.Kind)
+}
+
+// Governor hands out slots for heavy operations. A nil Governor never
+// limits anything.
+type Governor struct {
+	mu      sync.Mutex
+	limits  Limits
+	running map[Kind]int
+	total   int
+	waiting int
+	// freed is closed and replaced whenever a slot is given back
+	freed chan struct{}
+}
+
+// New creates a governor with limits l.
+func New(l Limits) *Governor {
+	return &Governor{limits: l, running: map[Kind]int{}, freed: make(chan struct{})}
+}
+
+// SetLimits replaces the limits. Operations already running keep their
+// slots.
+func (g *Governor) SetLimits(l Limits) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limits = l
+	g.wakeLocked()
+}
+
+// Acquire waits for a slot for an operation of kind and returns the func
+// that gives it back. It returns a *BusyError when too much is already
+// waiting or no slot frees up within the limits' MaxWait, and ctx's error
+// when ctx ends first.
+func (g *Governor) Acquire(ctx context.Context, kind Kind) (func(), error) {
+	if g == nil {
+		return func() {}, nil
+	}
+	g.mu.Lock()
+	if g.fitsLocked(kind) {
+		return g.takeLocked(kind), nil
+	}
+	if g.waiting >= g.limits.MaxQueue {
+		err := g.busyLocked(kind)
+		g.mu.Unlock()
+		return nil, err
+	}
+	g.waiting++
+	wait := g.limits.MaxWait
+	if wait <= 0 {
+		wait = DefaultMaxWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		freed := g.freed
+		g.mu.Unlock()
+		select {
+		case <-freed:
+		case <-timer.C:
+			g.mu.Lock()
+			g.waiting--
+			err := g.busyLocked(kind)
+			g.mu.Unlock()
+			return nil, err
+		case <-ctx.Done():
+			g.mu.Lock()
+			g.waiting--
+			g.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		g.mu.Lock()
+		if g.fitsLocked(kind) {
+			g.waiting--
+			return g.takeLocked(kind), nil
+		}
+	}
+}
+
+func (g *Governor) fitsLocked(kind Kind) bool {
+	if g.total >= g.limits.Total {
+		return false
+	}
+	if n, ok := g.limits.PerKind[kind]; ok && g.running[kind] >= n {
+		return false
+	}
+	return true
+}
+
+// takeLocked takes a slot and unlocks.
+func (g *Governor) takeLocked(kind Kind) func() {
+	g.running[kind]++
+	g.total++
+	g.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.running[kind]--
+			g.total--
+			g.wakeLocked()
+		})
+	}
+}
+
+func (g *Governor) wakeLocked() {
+	close(g.freed)
+	g.freed = make(chan struct{})
+}
+
+func (g *Governor) busyLocked(kind Kind) error {
+	logger.WarnCF("governor", "Heavy operation turned down", map[string]interface{}{
+		"kind":    string(kind),
+		"running": g.total,
+		"waiting": g.waiting,
+	})
+	return &BusyError{Kind: kind, Running: g.total, Waiting: g.waiting}
+}
+
+// Status describes the slots in use, for status reports.
+func (g *Governor) Status() string {
+	if g == nil {
+		return "unlimited"
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return fmt.Sprintf("%d/%d running, %d waiting", g.total, g.limits.Total, g.waiting)
+}
+
+var (
+	defaultMu sync.RWMutex
+	current   *Governor
+)
+
+// SetDefault makes g the governor Acquire uses.
+func SetDefault(g *Governor) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	current = g
+}
+
+// Default returns the governor Acquire uses, nil when none is set.
+func Default() *Governor {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return current
+}
+
+// Acquire waits for a slot from the default governor; with none set it
+// returns at once.
+func Acquire(ctx context.Context, kind Kind) (func(), error) {
+	return Default().Acquire(ctx, kind)
+}
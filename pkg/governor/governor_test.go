@@ -0,0 +1,64 @@
+package governor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLimitsFor_SmallBoard verifies a board with little RAM and CPU runs one heavy operation at a time
+func TestLimitsFor_SmallBoard(t *testing.T) {
+	l := LimitsFor(Resources{MemoryMB: 256, CPUs: 1}, 0)
+	if l.Total != 1 || l.PerKind[Transcode] != 1 || l.MaxQueue != 4 {
+		t.Errorf("unexpected limits %+v", l)
+	}
+	l = LimitsFor(Resources{MemoryMB: 1024, CPUs: 8}, 0)
+	if l.Total != 4 || l.PerKind[Transcode] != 1 || l.PerKind[Embeddings] != 4 {
+		t.Errorf("unexpected limits %+v", l)
+	}
+	if l := LimitsFor(Resources{CPUs: 2}, 3); l.Total != 3 || l.PerKind[OCR] != 3 {
+		t.Errorf("configured total ignored: %+v", l)
+	}
+}
+
+// TestGovernor_QueuesThenTurnsDown verifies work over the limit waits for a slot, is turned down with a BusyError when none frees in time, and at once when the queue is full
+func TestGovernor_QueuesThenTurnsDown(t *testing.T) {
+	g := New(Limits{Total: 2, PerKind: map[Kind]int{Transcode: 1}, MaxQueue: 1, MaxWait: 50 * time.Millisecond})
+	ctx := context.Background()
+	release, err := g.Acquire(ctx, Transcode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ocrRelease, err := g.Acquire(ctx, OCR)
+	if err != nil {
+		t.Fatal("another kind should fit under the total")
+	}
+	ocrRelease()
+
+	var busy *BusyError
+	if _, err := g.Acquire(ctx, Transcode); !errors.As(err, &busy) || busy.Running != 1 {
+		t.Fatalf("expected a BusyError, got %v", err)
+	}
+
+	got := make(chan error, 1)
+	go func() {
+		r, err := g.Acquire(ctx, Transcode)
+		if err == nil {
+			r()
+		}
+		got <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := g.Acquire(ctx, Transcode); !errors.As(err, &busy) || busy.Waiting != 1 {
+		t.Errorf("full queue not turned down at once: %v", err)
+	}
+	release()
+	release()
+	if err := <-got; err != nil {
+		t.Errorf("waiter not given the freed slot: %v", err)
+	}
+	if status := g.Status(); status != "0/2 running, 0 waiting" {
+		t.Errorf("status = %q", status)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
@@ -36,6 +37,7 @@ type HeartbeatService struct {
 	workspace string
 	bus       *bus.MessageBus
 	state     *state.Manager
+	profiles  *profile.Store
 	handler   HeartbeatHandler
 	interval  time.Duration
 	enabled   bool
@@ -69,6 +71,13 @@ func (hs *HeartbeatService) SetBus(msgBus *bus.MessageBus) {
 	hs.bus = msgBus
 }
 
+// SetProfiles sets the user profiles whose quiet hours suppress heartbeats.
+func (hs *HeartbeatService) SetProfiles(store *profile.Store) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.profiles = store
+}
+
 // SetHandler sets the heartbeat handler.
 func (hs *HeartbeatService) SetHandler(handler HeartbeatHandler) {
 	hs.mu.Lock()
@@ -92,7 +101,7 @@ func (hs *HeartbeatService) Start() error {
 	}
 
 	hs.stopChan = make(chan struct{})
-	go hs.runLoop(hs.stopChan)
+	go hs.runLoop(hs.stopChan, hs.interval)
 
 	logger.InfoCF("heartbeat", "Heartbeat service started", map[string]any{
 		"interval_minutes": hs.interval.Minutes(),
@@ -115,6 +124,32 @@ func (hs *HeartbeatService) Stop() {
 	hs.stopChan = nil
 }
 
+// Reconfigure applies a new interval and enabled flag, restarting the
+// ticker if the service was running or has just been enabled.
+func (hs *HeartbeatService) Reconfigure(intervalMinutes int, enabled bool) {
+	if intervalMinutes < minIntervalMinutes && intervalMinutes != 0 {
+		intervalMinutes = minIntervalMinutes
+	}
+	if intervalMinutes == 0 {
+		intervalMinutes = defaultIntervalMinutes
+	}
+	interval := time.Duration(intervalMinutes) * time.Minute
+
+	hs.mu.RLock()
+	unchanged := hs.interval == interval && hs.enabled == enabled
+	hs.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	hs.Stop()
+	hs.mu.Lock()
+	hs.interval = interval
+	hs.enabled = enabled
+	hs.mu.Unlock()
+	hs.Start()
+}
+
 // IsRunning returns whether the service is running
 func (hs *HeartbeatService) IsRunning() bool {
 	hs.mu.RLock()
@@ -123,8 +158,8 @@ func (hs *HeartbeatService) IsRunning() bool {
 }
 
 // runLoop runs the heartbeat ticker
-func (hs *HeartbeatService) runLoop(stopChan chan struct{}) {
-	ticker := time.NewTicker(hs.interval)
+func (hs *HeartbeatService) runLoop(stopChan chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Run first heartbeat after initial delay
@@ -147,6 +182,7 @@ func (hs *HeartbeatService) executeHeartbeat() {
 	hs.mu.RLock()
 	enabled := hs.enabled
 	handler := hs.handler
+	profiles := hs.profiles
 	if !hs.enabled || hs.stopChan == nil {
 		hs.mu.RUnlock()
 		return
@@ -174,6 +210,14 @@ func (hs *HeartbeatService) executeHeartbeat() {
 	lastChannel := hs.state.GetLastChannel()
 	channel, chatID := hs.parseLastChannel(lastChannel)
 
+	// Heartbeats are proactive; skip them while the user is in quiet hours
+	if channel != "" {
+		if _, quiet := profiles.QuietUntil(lastChannel, time.Now()); quiet {
+			logger.DebugC("heartbeat", "Skipping heartbeat during quiet hours")
+			return
+		}
+	}
+
 	// Debug log for channel resolution
 	hs.logInfo("Resolved channel: %s, chatID: %s (from lastChannel: %s)", channel, chatID, lastChannel)
 
@@ -0,0 +1,332 @@
+// Package httprec records the HTTP requests a tool call makes, with their
+// responses, to one JSON file per call in a debug directory, and replays
+// such a recording in tests to reproduce a bug offline. Authorization
+// headers, cookies, API keys and tokens are stripped before anything is
+// written. Recording is off unless SetDir is given a directory.
+package httprec
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxBody bounds how much of each request and response body is kept.
+const maxBody = 1 << 20
+
+var recording struct {
+	mu      sync.RWMutex
+	dir     string
+	install sync.Once
+}
+
+// SetDir turns recording on, one file per tool call in dir, or off when
+// dir is empty. The first call that turns it on wraps
+// http.DefaultTransport, which every picoclaw API client uses; requests
+// made outside a recorded call pass through untouched.
+func SetDir(dir string) {
+	recording.mu.Lock()
+	recording.dir = dir
+	recording.mu.Unlock()
+	if dir != "" {
+		install()
+	}
+}
+
+func install() {
+	recording.install.Do(func() {
+		http.DefaultTransport = &Transport{Base: http.DefaultTransport}
+	})
+}
+
+func currentDir() string {
+	recording.mu.RLock()
+	defer recording.mu.RUnlock()
+	return recording.dir
+}
+
+// Exchange is one recorded request and its response.
+type Exchange struct {
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	RequestHeader map[string]string `json:"request_header,omitempty"`
+	RequestBody   string            `json:"request_body,omitempty"`
+	// RequestBase64 is set when the request body was binary
+	RequestBase64  bool              `json:"request_base64,omitempty"`
+	Status         int               `json:"status,omitempty"`
+	ResponseHeader map[string]string `json:"response_header,omitempty"`
+	ResponseBody   string            `json:"response_body,omitempty"`
+	ResponseBase64 bool              `json:"response_base64,omitempty"`
+	// Truncated is set when a body was longer than what was kept
+	Truncated bool `json:"truncated,omitempty"`
+	// Error is the transport error, when no response came back
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Call is the recording of one tool call.
+type Call struct {
+	Tool      string          `json:"tool"`
+	Args      json.RawMessage `json:"args,omitempty"`
+	Started   time.Time       `json:"started"`
+	Exchanges []Exchange      `json:"exchanges"`
+
+	mu      sync.Mutex
+	dir     string
+	capture *Capture
+	done    bool
+}
+
+type callKey struct{}
+
+type captureKey struct{}
+
+// Capture collects the recordings of the tool calls made with a context
+// from WithCapture, whether or not recording to files is on.
+type Capture struct {
+	mu    sync.Mutex
+	calls []*Call
+}
+
+// WithCapture returns a context whose tool calls are recorded into the
+// returned Capture.
+func WithCapture(ctx context.Context) (context.Context, *Capture) {
+	install()
+	c := &Capture{}
+	return context.WithValue(ctx, captureKey{}, c), c
+}
+
+// Calls returns the recordings of the calls that made requests, in the
+// order they finished. It is nil-safe.
+func (c *Capture) Calls() []*Call {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Call(nil), c.calls...)
+}
+
+// Exchanges returns the requests of all captured calls, in order.
+func (c *Capture) Exchanges() []Exchange {
+	var all []Exchange
+	for _, call := range c.Calls() {
+		all = append(all, call.Exchanges...)
+	}
+	return all
+}
+
+// Start begins recording the tool call tool with args, if recording is
+// on or ctx is from WithCapture, and returns the context its requests must
+// be made with. The call is nil otherwise; Finish accepts that.
+func Start(ctx context.Context, tool string, args map[string]interface{}) (context.Context, *Call) {
+	dir := currentDir()
+	capture, _ := ctx.Value(captureKey{}).(*Capture)
+	if dir == "" && capture == nil {
+		return ctx, nil
+	}
+	c := &Call{Tool: tool, Started: time.Now(), dir: dir, capture: capture}
+	if data, err := json.Marshal(args); err == nil {
+		c.Args = json.RawMessage(logger.RedactSecrets(string(data)))
+		if !json.Valid(c.Args) {
+			c.Args = nil
+		}
+	}
+	return context.WithValue(ctx, callKey{}, c), c
+}
+
+func callFromContext(ctx context.Context) *Call {
+	c, _ := ctx.Value(callKey{}).(*Call)
+	return c
+}
+
+func (c *Call) add(ex Exchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.Exchanges = append(c.Exchanges, ex)
+	}
+}
+
+// Finish stops recording, hands the call to its Capture and writes it to
+// its directory, named after the time it started and the tool. Calls that
+// made no requests leave no file. It returns the file written, if any.
+func (c *Call) Finish() (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done || len(c.Exchanges) == 0 {
+		c.done = true
+		return "", nil
+	}
+	c.done = true
+	if c.capture != nil {
+		c.capture.mu.Lock()
+		c.capture.calls = append(c.capture.calls, c)
+		c.capture.mu.Unlock()
+	}
+	if c.dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.json", c.Started.Format("20060102-150405.000"), safeName(c.Tool))
+	path := filepath.Join(c.dir, name)
+	return path, os.WriteFile(path, data, 0600)
+}
+
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// Transport records the requests made with a context from Start.
+type Transport struct {
+	// Base makes the requests; nil means http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c := callFromContext(req.Context())
+	if c == nil {
+		return base.RoundTrip(req)
+	}
+
+	ex := Exchange{Method: req.Method, URL: SanitizeURL(req.URL), RequestHeader: sanitizeHeader(req.Header)}
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, maxBody+1))
+			body.Close()
+			ex.RequestBody, ex.RequestBase64 = encodeBody(data)
+			ex.Truncated = len(data) > maxBody
+		}
+	default:
+		// Streamed uploads are sent as they are rather than held in memory
+		ex.RequestBody = "[streamed body not recorded]"
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	ex.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		ex.Error = logger.RedactSecrets(err.Error())
+		c.add(ex)
+		return resp, err
+	}
+
+	ex.Status = resp.StatusCode
+	ex.ResponseHeader = sanitizeHeader(resp.Header)
+	data, rerr := io.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	if len(data) > maxBody {
+		ex.Truncated = true
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		data = data[:maxBody]
+	} else {
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	if rerr != nil {
+		ex.Error = logger.RedactSecrets(rerr.Error())
+	}
+	ex.ResponseBody, ex.ResponseBase64 = encodeBody(data)
+	c.add(ex)
+	return resp, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// encodeBody keeps text as it is, with secrets masked, and binary bodies
+// (images, PDFs) base64-encoded.
+func encodeBody(data []byte) (string, bool) {
+	if utf8.Valid(data) && !bytes.ContainsRune(data, 0) {
+		return logger.RedactSecrets(string(data)), false
+	}
+	return base64.StdEncoding.EncodeToString(data), true
+}
+
+func decodeBody(s string, b64 bool) []byte {
+	if !b64 {
+		return []byte(s)
+	}
+	data, _ := base64.StdEncoding.DecodeString(s)
+	return data
+}
+
+// sanitizeHeader flattens h, leaving out credentials and cookies.
+func sanitizeHeader(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if logger.IsSecretName(name) {
+			continue
+		}
+		out[name] = logger.RedactSecrets(strings.Join(values, ", "))
+	}
+	return out
+}
+
+// SanitizeURL returns u as recorded: query parameters named like secrets
+// (key, access_token...) are masked, in a stable order.
+func SanitizeURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	query := u.Query()
+	if len(query) == 0 {
+		return clean.String()
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, key := range keys {
+		for _, v := range query[key] {
+			if sb.Len() > 0 {
+				sb.WriteByte('&')
+			}
+			if logger.IsSecretName(key) {
+				v = "[redacted]"
+			}
+			sb.WriteString(url.QueryEscape(key) + "=" + url.QueryEscape(v))
+		}
+	}
+	clean.RawQuery = sb.String()
+	return clean.String()
+}
@@ -0,0 +1,91 @@
+package httprec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Load reads a recording written by Finish.
+func Load(path string) (*Call, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Call
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Replayer answers requests with the responses of a recording, without
+// touching the network.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+// Replay returns a transport that answers each request with the first
+// unused exchange of c recorded for the same method and URL (with secrets
+// masked as they were when recording). A request nothing was recorded for
+// fails.
+func (c *Call) Replay() *Replayer {
+	return &Replayer{exchanges: c.Exchanges, used: make([]bool, len(c.Exchanges))}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	target := SanitizeURL(req.URL)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, ex := range r.exchanges {
+		if r.used[i] || ex.Method != req.Method || ex.URL != target {
+			continue
+		}
+		r.used[i] = true
+		if ex.Error != "" && ex.Status == 0 {
+			return nil, errors.New(ex.Error)
+		}
+		body := decodeBody(ex.ResponseBody, ex.ResponseBase64)
+		resp := &http.Response{
+			Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+			StatusCode:    ex.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}
+		for name, value := range ex.ResponseHeader {
+			if name != "Content-Length" {
+				resp.Header.Set(name, value)
+			}
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("httprec: no recorded response for %s %s", req.Method, target)
+}
+
+// Unused lists the recorded exchanges no request has asked for yet.
+func (r *Replayer) Unused() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Exchange
+	for i, ex := range r.exchanges {
+		if !r.used[i] {
+			unused = append(unused, ex)
+		}
+	}
+	return unused
+}
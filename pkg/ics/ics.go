@@ -0,0 +1,227 @@
+// Package ics parses the events of iCalendar (RFC 5545) data, as attached
+// to meeting invitations and booking confirmations, and reads and writes
+// the tasks (VTODO) CalDAV task lists hold. Only what is needed to put an
+// event in a calendar or a task on a list is read; recurrence rules are
+// ignored.
+package ics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoEvents is returned when the data holds no VEVENT.
+var ErrNoEvents = errors.New("no events in calendar data")
+
+// Event is one VEVENT.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	// AllDay events have date-only Start/End (End exclusive)
+	AllDay bool
+	// Status is CONFIRMED, TENTATIVE or CANCELLED
+	Status string
+	// Method is the calendar's METHOD (REQUEST, CANCEL, PUBLISH...)
+	Method string
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold joins continuation lines (lines starting with a space or tab).
+func unfold(data string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func parseProperty(line string) (property, bool) {
+	// The value starts at the first colon outside a quoted parameter
+	inQuote := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, false
+	}
+	p := property{value: line[colon+1:], params: make(map[string]string)}
+	parts := strings.Split(line[:colon], ";")
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p, true
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// Parse returns the events in data. Floating times (no zone) are read in
+// loc; unknown TZID names fall back to loc too.
+func Parse(data string, loc *time.Location) ([]Event, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var events []Event
+	var method string
+	var current *Event
+	var duration time.Duration
+	depth := 0
+	for _, line := range unfold(data) {
+		p, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		switch p.name {
+		case "BEGIN":
+			if strings.EqualFold(p.value, "VEVENT") && current == nil {
+				current = &Event{}
+				duration = 0
+				depth = 0
+			} else if current != nil {
+				// Nested components (VALARM) have their own DESCRIPTION etc.
+				depth++
+			}
+			continue
+		case "END":
+			if current == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if strings.EqualFold(p.value, "VEVENT") {
+				if current.End.IsZero() && !current.Start.IsZero() {
+					switch {
+					case duration > 0:
+						current.End = current.Start.Add(duration)
+					case current.AllDay:
+						current.End = current.Start.AddDate(0, 0, 1)
+					default:
+						current.End = current.Start
+					}
+				}
+				if !current.Start.IsZero() {
+					events = append(events, *current)
+				}
+				current = nil
+			}
+			continue
+		case "METHOD":
+			method = strings.ToUpper(p.value)
+			continue
+		}
+		if current == nil || depth > 0 {
+			continue
+		}
+		switch p.name {
+		case "UID":
+			current.UID = p.value
+		case "SUMMARY":
+			current.Summary = unescape(p.value)
+		case "DESCRIPTION":
+			current.Description = unescape(p.value)
+		case "LOCATION":
+			current.Location = unescape(p.value)
+		case "STATUS":
+			current.Status = strings.ToUpper(p.value)
+		case "DTSTART":
+			t, allDay, err := parseTime(p, loc)
+			if err != nil {
+				return nil, fmt.Errorf("DTSTART: %w", err)
+			}
+			current.Start, current.AllDay = t, allDay
+		case "DTEND":
+			t, _, err := parseTime(p, loc)
+			if err != nil {
+				return nil, fmt.Errorf("DTEND: %w", err)
+			}
+			current.End = t
+		case "DURATION":
+			d, err := ParseDuration(p.value)
+			if err != nil {
+				return nil, err
+			}
+			duration = d
+		}
+	}
+	if len(events) == 0 {
+		return nil, ErrNoEvents
+	}
+	for i := range events {
+		events[i].Method = method
+	}
+	return events, nil
+}
+
+func parseTime(p property, loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(p.value)
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+var durationRe = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration parses an RFC 5545 duration such as PT1H30M or P1D.
+func ParseDuration(s string) (time.Duration, error) {
+	m := durationRe.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil || s == "P" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,120 @@
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const invitation = "BEGIN:VCALENDAR\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:abc-123@example.com\r\n" +
+	"SUMMARY:Quarterly review\\, Q3\r\n" +
+	"DTSTART;TZID=Europe/Paris:20261103T143000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"LOCATION:Room 4\\; 2nd floor\r\n" +
+	"DESCRIPTION:Agenda:\\n1. Numbers\\n2. Plan for the next quarter and a ver\r\n" +
+	" y long line\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Holiday\r\n" +
+	"DTSTART;VALUE=DATE:20261225\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// TestParse_Invitation verifies timezones, durations, escapes, folding and all-day events
+func TestParse_Invitation(t *testing.T) {
+	events, err := Parse(invitation, time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Summary != "Quarterly review, Q3" || ev.Location != "Room 4; 2nd floor" || ev.UID != "abc-123@example.com" {
+		t.Errorf("unexpected fields: %+v", ev)
+	}
+	if ev.Description != "Agenda:\n1. Numbers\n2. Plan for the next quarter and a very long line" {
+		t.Errorf("unexpected description %q", ev.Description)
+	}
+	if !ev.Start.Equal(time.Date(2026, 11, 3, 13, 30, 0, 0, time.UTC)) || ev.End.Sub(ev.Start) != 90*time.Minute {
+		t.Errorf("unexpected times %v - %v", ev.Start, ev.End)
+	}
+	if ev.Method != "REQUEST" {
+		t.Errorf("method = %q", ev.Method)
+	}
+	holiday := events[1]
+	if !holiday.AllDay || holiday.End.Sub(holiday.Start) != 24*time.Hour {
+		t.Errorf("unexpected all-day event: %+v", holiday)
+	}
+}
+
+// TestParse_NoEvents verifies calendars without VEVENTs are reported
+func TestParse_NoEvents(t *testing.T) {
+	if _, err := Parse("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", nil); err != ErrNoEvents {
+		t.Errorf("expected ErrNoEvents, got %v", err)
+	}
+}
+
+// TestParseDuration verifies RFC 5545 durations
+func TestParseDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"PT1H30M": 90 * time.Minute,
+		"P1D":     24 * time.Hour,
+		"P1W":     7 * 24 * time.Hour,
+		"-PT15M":  -15 * time.Minute,
+	} {
+		got, err := ParseDuration(in)
+		if err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseDuration("1 hour"); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
+
+// TestSetTodoDone_KeepsOtherProperties verifies ticking off a task rewrites only its status and stamps
+func TestSetTodoDone_KeepsOtherProperties(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\n" +
+		"UID:milk-1\r\nDTSTAMP:20260501T080000Z\r\nSUMMARY:Milk\\, 2 l\r\n" +
+		"DUE;VALUE=DATE:20260503\r\nSTATUS:NEEDS-ACTION\r\n" +
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Milk\r\nTRIGGER:-PT1H\r\nEND:VALARM\r\n" +
+		"END:VTODO\r\nEND:VCALENDAR\r\n"
+	now := time.Date(2026, 5, 2, 9, 30, 0, 0, time.UTC)
+
+	done := SetTodoDone(data, true, now)
+	todos, err := ParseTodos(done, time.UTC)
+	if err != nil || len(todos) != 1 {
+		t.Fatalf("ParseTodos: %v %+v", err, todos)
+	}
+	todo := todos[0]
+	if !todo.Done() || !todo.Completed.Equal(now) || todo.Summary != "Milk, 2 l" || todo.Due.Day() != 3 {
+		t.Errorf("unexpected task: %+v", todo)
+	}
+	for _, want := range []string{"BEGIN:VALARM", "TRIGGER:-PT1H", "DTSTAMP:20260502T093000Z", "PERCENT-COMPLETE:100"} {
+		if !strings.Contains(done, want) {
+			t.Errorf("missing %s in:\n%s", want, done)
+		}
+	}
+
+	undone, _ := ParseTodos(SetTodoDone(done, false, now), time.UTC)
+	if len(undone) != 1 || undone[0].Done() {
+		t.Errorf("task still done: %+v", undone)
+	}
+
+	long := FormatTodo(Todo{UID: "x", Summary: strings.Repeat("é", 60)}, now)
+	for _, line := range strings.Split(long, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line not folded: %q", line)
+		}
+	}
+	if parsed, _ := ParseTodos(long, time.UTC); len(parsed) != 1 || parsed[0].Summary != strings.Repeat("é", 60) {
+		t.Errorf("folded summary did not round trip: %+v", parsed)
+	}
+}
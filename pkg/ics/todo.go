@@ -0,0 +1,188 @@
+package ics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Todo is one VTODO: a task or reminder, as kept by Apple Reminders,
+// Nextcloud Tasks and other CalDAV task lists.
+type Todo struct {
+	UID         string
+	Summary     string
+	Description string
+	// Status is NEEDS-ACTION, IN-PROCESS, COMPLETED or CANCELLED
+	Status    string
+	Created   time.Time
+	Completed time.Time
+	Due       time.Time
+}
+
+// Done reports whether the task was ticked off.
+func (t Todo) Done() bool {
+	return t.Status == "COMPLETED" || !t.Completed.IsZero()
+}
+
+// ParseTodos returns the tasks in data. Floating times are read in loc.
+func ParseTodos(data string, loc *time.Location) ([]Todo, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var todos []Todo
+	var current *Todo
+	depth := 0
+	for _, line := range unfold(data) {
+		p, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+		switch p.name {
+		case "BEGIN":
+			if strings.EqualFold(p.value, "VTODO") && current == nil {
+				current = &Todo{}
+				depth = 0
+			} else if current != nil {
+				depth++
+			}
+			continue
+		case "END":
+			if current == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if strings.EqualFold(p.value, "VTODO") {
+				todos = append(todos, *current)
+				current = nil
+			}
+			continue
+		}
+		if current == nil || depth > 0 {
+			continue
+		}
+		switch p.name {
+		case "UID":
+			current.UID = p.value
+		case "SUMMARY":
+			current.Summary = unescape(p.value)
+		case "DESCRIPTION":
+			current.Description = unescape(p.value)
+		case "STATUS":
+			current.Status = strings.ToUpper(p.value)
+		case "CREATED", "COMPLETED", "DUE":
+			t, _, err := parseTime(p, loc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.name, err)
+			}
+			switch p.name {
+			case "CREATED":
+				current.Created = t
+			case "COMPLETED":
+				current.Completed = t
+			default:
+				current.Due = t
+			}
+		}
+	}
+	return todos, nil
+}
+
+// FormatTodo returns a calendar object holding t, ready to store on a
+// CalDAV server.
+func FormatTodo(t Todo, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//picoclaw//tasks//EN\r\nBEGIN:VTODO\r\n")
+	writeLine(&sb, "UID:"+t.UID)
+	writeLine(&sb, "DTSTAMP:"+utcStamp(now))
+	created := t.Created
+	if created.IsZero() {
+		created = now
+	}
+	writeLine(&sb, "CREATED:"+utcStamp(created))
+	writeLine(&sb, "SUMMARY:"+escape(t.Summary))
+	if t.Description != "" {
+		writeLine(&sb, "DESCRIPTION:"+escape(t.Description))
+	}
+	if !t.Due.IsZero() {
+		writeLine(&sb, "DUE:"+utcStamp(t.Due))
+	}
+	completed := t.Completed
+	if completed.IsZero() {
+		completed = now
+	}
+	for _, line := range statusLines(t.Done(), completed) {
+		writeLine(&sb, line)
+	}
+	sb.WriteString("END:VTODO\r\nEND:VCALENDAR\r\n")
+	return sb.String()
+}
+
+// SetTodoDone marks the first VTODO in data done or not done, keeping
+// every other property (alarms, due dates, notes) as the owning app wrote
+// it.
+func SetTodoDone(data string, done bool, now time.Time) string {
+	var out []string
+	inTodo, replaced := false, false
+	depth := 0
+	for _, line := range unfold(data) {
+		p, ok := parseProperty(line)
+		if ok && !replaced {
+			switch {
+			case p.name == "BEGIN" && strings.EqualFold(p.value, "VTODO") && !inTodo:
+				inTodo = true
+			case p.name == "BEGIN" && inTodo:
+				depth++
+			case p.name == "END" && inTodo && depth > 0:
+				depth--
+			case p.name == "END" && inTodo:
+				out = append(out, statusLines(done, now)...)
+				inTodo, replaced = false, true
+			case inTodo && depth == 0 && (p.name == "STATUS" || p.name == "COMPLETED" || p.name == "PERCENT-COMPLETE"):
+				continue
+			case inTodo && depth == 0 && (p.name == "DTSTAMP" || p.name == "LAST-MODIFIED"):
+				line = p.name + ":" + utcStamp(now)
+			}
+		}
+		out = append(out, line)
+	}
+	var sb strings.Builder
+	for _, line := range out {
+		writeLine(&sb, line)
+	}
+	return sb.String()
+}
+
+func statusLines(done bool, completed time.Time) []string {
+	if !done {
+		return []string{"STATUS:NEEDS-ACTION"}
+	}
+	return []string{"STATUS:COMPLETED", "COMPLETED:" + utcStamp(completed), "PERCENT-COMPLETE:100"}
+}
+
+func utcStamp(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+// writeLine writes one content line, folded at 75 octets as RFC 5545
+// asks, without splitting a UTF-8 sequence.
+func writeLine(sb *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		sb.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines lose one octet to the leading space
+		limit = 74
+	}
+	sb.WriteString(line + "\r\n")
+}
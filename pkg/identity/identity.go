@@ -0,0 +1,241 @@
+// Package identity links the accounts one person uses on different
+// channels ("telegram:123", "whatsapp:5511999990000",
+// "email:ana@example.com") so their profile, conversation and quotas
+// follow them from one to the other.
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// codeLifetime is how long a link code can be confirmed
+	codeLifetime = 10 * time.Minute
+	// maxAttempts is how many wrong codes cancel a pending link
+	maxAttempts = 5
+)
+
+// ErrNoPendingLink is returned when a code is confirmed without a link
+// having been started, or after it expired.
+var ErrNoPendingLink = errors.New("no link is waiting for a code; start one first")
+
+// pendingLink is a link waiting for the code sent to Target to be typed
+// in the chat of From.
+type pendingLink struct {
+	Target   string
+	Code     string
+	Expires  time.Time
+	Attempts int
+}
+
+// Store keeps which accounts belong to the same person. Each linked
+// account points to its person's primary account: the first one, whose
+// profile and conversation the others share.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.RWMutex
+	primary map[string]string
+	pending map[string]*pendingLink
+}
+
+// NewStore loads the links saved in the workspace state directory.
+func NewStore(workspace string) *Store {
+	s := &Store{
+		path:    filepath.Join(workspace, "state", "identities.json"),
+		now:     time.Now,
+		primary: make(map[string]string),
+		pending: make(map[string]*pendingLink),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.primary)
+	}
+	return s
+}
+
+// NormalizeAccount checks an account is "channel:id" and returns it with
+// the channel, and email addresses, lowercased.
+func NormalizeAccount(account string) (string, error) {
+	channel, id, ok := strings.Cut(strings.TrimSpace(account), ":")
+	channel = strings.ToLower(strings.TrimSpace(channel))
+	id = strings.TrimSpace(id)
+	if !ok || channel == "" || id == "" {
+		return "", fmt.Errorf("account %q should be channel:id, e.g. whatsapp:5511999990000 or email:ana@example.com", account)
+	}
+	if channel == "email" {
+		if !strings.Contains(id, "@") {
+			return "", fmt.Errorf("%q is not an email address", id)
+		}
+		id = strings.ToLower(id)
+	}
+	return channel + ":" + id, nil
+}
+
+// Resolve returns the primary account of the person behind account, or
+// account itself when it is not linked. A nil store resolves nothing, so
+// callers can use it unconditionally.
+func (s *Store) Resolve(account string) string {
+	if s == nil {
+		return account
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.primary[account]; ok {
+		return p
+	}
+	return account
+}
+
+// Accounts returns every account of the person behind account, primary
+// first.
+func (s *Store) Accounts(account string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.accountsLocked(s.resolveLocked(account))
+}
+
+func (s *Store) resolveLocked(account string) string {
+	if p, ok := s.primary[account]; ok {
+		return p
+	}
+	return account
+}
+
+func (s *Store) accountsLocked(primary string) []string {
+	var others []string
+	for account, p := range s.primary {
+		if p == primary && account != primary {
+			others = append(others, account)
+		}
+	}
+	sort.Strings(others)
+	return append([]string{primary}, others...)
+}
+
+// StartLink begins linking target to the person behind from and returns
+// the code to send to target. The link is made when the code is typed
+// back in from's chat, which shows the same person controls both.
+func (s *Store) StartLink(from, target string) (string, error) {
+	target, err := NormalizeAccount(target)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	person := s.resolveLocked(from)
+	if s.resolveLocked(target) == person {
+		return "", fmt.Errorf("%s is already linked", target)
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	s.pending[person] = &pendingLink{Target: target, Code: code, Expires: s.now().Add(codeLifetime)}
+	return code, nil
+}
+
+// Confirm links the account a code was sent to, when account types the
+// right code, and returns it. Wrong codes count against the link, which is
+// cancelled after a few.
+func (s *Store) Confirm(account, code string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	person := s.resolveLocked(account)
+	link, ok := s.pending[person]
+	if !ok || s.now().After(link.Expires) {
+		delete(s.pending, person)
+		return "", ErrNoPendingLink
+	}
+	if strings.TrimSpace(code) != link.Code {
+		link.Attempts++
+		if link.Attempts >= maxAttempts {
+			delete(s.pending, person)
+			return "", errors.New("wrong code; too many attempts, so the link was cancelled")
+		}
+		return "", errors.New("wrong code")
+	}
+	delete(s.pending, person)
+
+	// The target may be linked to someone else already: bring its whole
+	// group over, so one person never ends up split in two
+	previous := make(map[string]string, len(s.primary))
+	for k, v := range s.primary {
+		previous[k] = v
+	}
+	for _, a := range s.accountsLocked(s.resolveLocked(link.Target)) {
+		s.primary[a] = person
+	}
+	s.primary[person] = person
+	if err := s.saveLocked(); err != nil {
+		s.primary = previous
+		return "", err
+	}
+	return link.Target, nil
+}
+
+// Unlink detaches account from its person. When it was the primary
+// account, the next one takes over.
+func (s *Store) Unlink(account string) error {
+	account, err := NormalizeAccount(account)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	primary, ok := s.primary[account]
+	if !ok {
+		return fmt.Errorf("%s is not linked", account)
+	}
+	rest := s.accountsLocked(primary)
+	delete(s.primary, account)
+	var remaining []string
+	for _, a := range rest {
+		if a != account {
+			remaining = append(remaining, a)
+		}
+	}
+	switch {
+	case len(remaining) == 1:
+		// A person with one account needs no link
+		delete(s.primary, remaining[0])
+	case account == primary:
+		sort.Strings(remaining)
+		for _, a := range remaining {
+			s.primary[a] = remaining[0]
+		}
+	}
+	return s.saveLocked()
+}
+
+// saveLocked writes the links with temp file + rename so a crash never
+// leaves a truncated file. Must be called with the lock held.
+func (s *Store) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s.primary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal identities: %w", err)
+	}
+	tempFile := s.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, s.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
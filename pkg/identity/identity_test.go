@@ -0,0 +1,72 @@
+package identity
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStore_LinkConfirmAndUnlink verifies a code links an account to the person who asked, survives a reload, and unlinking the primary hands over to the next account
+func TestStore_LinkConfirmAndUnlink(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir)
+
+	code, err := s.StartLink("telegram:1", "WhatsApp:5511")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Confirm("telegram:1", "000000x"); err == nil {
+		t.Fatal("wrong code accepted")
+	}
+	if linked, err := s.Confirm("telegram:1", code); err != nil || linked != "whatsapp:5511" {
+		t.Fatalf("confirm: %q %v", linked, err)
+	}
+	if _, err := s.Confirm("telegram:1", code); err != ErrNoPendingLink {
+		t.Errorf("code reused: %v", err)
+	}
+
+	code, _ = s.StartLink("whatsapp:5511", "email:Ana@Example.com")
+	s.Confirm("whatsapp:5511", code)
+
+	s = NewStore(dir)
+	if got := s.Resolve("email:ana@example.com"); got != "telegram:1" {
+		t.Errorf("Resolve = %q, want the first account", got)
+	}
+	if got := s.Accounts("whatsapp:5511"); len(got) != 3 || got[0] != "telegram:1" {
+		t.Errorf("Accounts = %v", got)
+	}
+
+	if err := s.Unlink("telegram:1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Resolve("whatsapp:5511"); got != "email:ana@example.com" {
+		t.Errorf("new primary %q", got)
+	}
+	if got := s.Resolve("telegram:1"); got != "telegram:1" {
+		t.Errorf("unlinked account still resolves to %q", got)
+	}
+	s.Unlink("whatsapp:5511")
+	if got := s.Accounts("email:ana@example.com"); len(got) != 1 {
+		t.Errorf("a lone account kept a link: %v", got)
+	}
+}
+
+// TestStore_CodesExpireAndLockOut verifies old codes and repeated wrong guesses cancel a pending link
+func TestStore_CodesExpireAndLockOut(t *testing.T) {
+	s := NewStore(t.TempDir())
+	now := time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	code, _ := s.StartLink("telegram:1", "whatsapp:5511")
+	now = now.Add(11 * time.Minute)
+	if _, err := s.Confirm("telegram:1", code); err != ErrNoPendingLink {
+		t.Errorf("expired code: %v", err)
+	}
+
+	code, _ = s.StartLink("telegram:1", "whatsapp:5511")
+	for i := 0; i < maxAttempts; i++ {
+		s.Confirm("telegram:1", "wrong")
+	}
+	if _, err := s.Confirm("telegram:1", code); err != ErrNoPendingLink {
+		t.Errorf("link survived %d wrong codes: %v", maxAttempts, err)
+	}
+}
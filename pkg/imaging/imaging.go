@@ -0,0 +1,233 @@
+// Package imaging resizes, thumbnails and converts images for the chat
+// channels, the photo tools and the dashboard. It works with the formats
+// the standard library decodes (JPEG, PNG, GIF) and writes JPEG, so a
+// photo too large or of a type a channel refuses can still be sent as a
+// smaller copy instead of not at all.
+package imaging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/exif"
+)
+
+const (
+	// ThumbnailQuality is the JPEG quality of thumbnails and previews
+	ThumbnailQuality = 80
+	// sendQuality is the JPEG quality a converted photo starts at
+	sendQuality = 85
+	// minQuality is as low as quality goes while shrinking to fit
+	minQuality = 50
+	// maxSendEdge bounds the longer side of a converted photo; chat apps
+	// scale anything larger down again
+	maxSendEdge = 4096
+	// minSendEdge is the smallest a photo is shrunk to before giving up
+	minSendEdge = 320
+	// maxSource bounds the size of files decoded
+	maxSource = 64 << 20
+)
+
+// Open decodes the image file at path.
+func Open(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(io.LimitReader(f, maxSource))
+	return img, err
+}
+
+// Thumbnail downscales img so its longest edge is at most size pixels,
+// averaging the source pixels covered by each output pixel.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] =
+				uint8(r/n>>8), uint8(g/n>>8), uint8(bl/n>>8), uint8(a/n>>8)
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG. Transparent areas, which JPEG cannot
+// hold, are laid on white rather than coming out black.
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	if !opaque(img) {
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = flat
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// ContentType sniffs the MIME type of the file at path.
+func ContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	return http.DetectContentType(head[:n]), nil
+}
+
+// Fit returns a file with the image at path that a channel with caps
+// accepts: path itself when the channel takes it as it is, else a JPEG
+// copy written to dir, scaled down until it is within the channel's size
+// limit. It returns the channel's reason for refusing the original when
+// no copy can be made: the channel takes no JPEG, or the file is not an
+// image the standard decoders read (HEIC, RAW).
+func Fit(path string, caps bus.Capabilities, dir string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	ct, err := ContentType(path)
+	if err != nil {
+		return "", err
+	}
+	refused := caps.CanSend(ct, info.Size())
+	if refused == nil {
+		return path, nil
+	}
+	if !strings.HasPrefix(ct, "image/") || caps.CanSend("image/jpeg", 0) != nil {
+		return "", refused
+	}
+	img, err := Open(path)
+	if err != nil {
+		return "", refused
+	}
+	b := img.Bounds()
+	edge := min(max(b.Dx(), b.Dy()), maxSendEdge)
+	quality := sendQuality
+	var buf bytes.Buffer
+	for edge >= minSendEdge {
+		buf.Reset()
+		if err := EncodeJPEG(&buf, Thumbnail(img, edge), quality); err != nil {
+			return "", err
+		}
+		if caps.MaxFileBytes <= 0 || int64(buf.Len()) <= caps.MaxFileBytes {
+			return writeFile(dir, stem(path), buf.Bytes())
+		}
+		edge = edge * 3 / 4
+		quality = max(quality-10, minQuality)
+	}
+	return "", fmt.Errorf("%w, even scaled down", refused)
+}
+
+// Shrink re-encodes JPEG data at most maxEdge pixels on its longest side
+// (0 keeps the size) at quality (0 for the default send quality), keeping
+// its EXIF block so the date, camera and orientation survive. Data that
+// needs neither is returned as it is.
+func Shrink(data []byte, maxEdge, quality int) ([]byte, error) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	resize := maxEdge > 0 && max(cfg.Width, cfg.Height) > maxEdge
+	if !resize && quality <= 0 {
+		return data, nil
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if resize {
+		img = Thumbnail(img, maxEdge)
+	}
+	if quality <= 0 {
+		quality = sendQuality
+	}
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, img, quality); err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+	segment := exif.Segment(data)
+	if segment == nil {
+		return encoded, nil
+	}
+	out := make([]byte, 0, len(encoded)+len(segment))
+	out = append(out, encoded[:2]...)
+	out = append(out, segment...)
+	return append(out, encoded[2:]...), nil
+}
+
+// StripLocation returns a file with the photo at path without the GPS
+// position in its EXIF data: path itself when there is none, else a copy
+// written to dir. Only JPEG photos carry EXIF positions here; other files
+// are returned as they are.
+func StripLocation(path, dir string) (string, error) {
+	if ct, err := ContentType(path); err != nil || ct != "image/jpeg" {
+		return path, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !exif.StripLocation(data) {
+		return path, nil
+	}
+	return writeFile(dir, stem(path), data)
+}
+
+func stem(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// writeFile writes data to a new JPEG in dir named prefix-<random>.jpg.
+func writeFile(dir, prefix string, data []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	id := make([]byte, 6)
+	rand.Read(id)
+	path := filepath.Join(dir, prefix+"-"+hex.EncodeToString(id)+".jpg")
+	return path, os.WriteFile(path, data, 0644)
+}
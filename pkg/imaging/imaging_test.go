@@ -0,0 +1,85 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// writeNoisyPNG writes a w×h PNG of random pixels, which compresses badly.
+func writeNoisyPNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(1))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFit verifies an image a channel refuses for its type or size becomes a JPEG within the limit, and one that cannot be converted keeps the channel's reason
+func TestFit(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "scan.png")
+	writeNoisyPNG(t, src, 1200, 900)
+	info, _ := os.Stat(src)
+
+	accepts := bus.Capabilities{MaxFileBytes: info.Size() * 2, MediaTypes: []string{"image/png"}}
+	if got, err := Fit(src, accepts, dir); err != nil || got != src {
+		t.Errorf("accepted image was copied: %s %v", got, err)
+	}
+
+	limit := int64(150 << 10)
+	caps := bus.Capabilities{MaxFileBytes: limit, MediaTypes: []string{"image/jpeg"}}
+	got, err := Fit(src, caps, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := os.Stat(got)
+	if ct, _ := ContentType(got); ct != "image/jpeg" || out.Size() > limit || !strings.HasPrefix(filepath.Base(got), "scan-") {
+		t.Errorf("fitted %s is %s, %d bytes", got, ct, out.Size())
+	}
+
+	pngOnly := bus.Capabilities{MaxFileBytes: 1 << 10, MediaTypes: []string{"image/png"}}
+	if _, err := Fit(src, pngOnly, dir); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("channel without JPEG: %v", err)
+	}
+	heic := filepath.Join(dir, "photo.heic")
+	os.WriteFile(heic, []byte("\x00\x00\x00\x18ftypheic"), 0644)
+	if _, err := Fit(heic, caps, dir); err == nil {
+		t.Error("undecodable file fitted")
+	}
+}
+
+// TestEncodeJPEG_FlattensTransparency verifies transparent pixels come out white rather than black
+func TestEncodeJPEG_FlattensTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	path := filepath.Join(t.TempDir(), "clear.jpg")
+	f, _ := os.Create(path)
+	if err := EncodeJPEG(f, img, ThumbnailQuality); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	decoded, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := color.RGBAModel.Convert(decoded.At(4, 4)).RGBA(); r < 0xf000 {
+		t.Errorf("transparent pixel encoded as %v", decoded.At(4, 4))
+	}
+}
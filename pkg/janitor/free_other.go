@@ -0,0 +1,9 @@
+//go:build !linux
+
+package janitor
+
+// freeSpace is a stub for non-Linux platforms, where only the budget is
+// enforced.
+func freeSpace(dir string) (int64, bool) {
+	return 0, false
+}
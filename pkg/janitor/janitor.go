@@ -0,0 +1,307 @@
+// Package janitor keeps the directories picoclaw downloads into and caches
+// in (received media, artifacts, previews, transfer spools) within a disk
+// budget. When they grow past it, or the disk's free space drops below a
+// floor, the least recently used files go first. Downloads of a known
+// size are checked before they start, and the owners are told when one
+// cannot fit.
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// alertEvery bounds how often the owners hear about refused downloads.
+const alertEvery = 15 * time.Minute
+
+// Item is one file an area holds.
+type Item struct {
+	// ID is what the area's Remove takes: a path or an artifact reference
+	ID   string
+	Size int64
+	// Used is when the file was last written or read
+	Used time.Time
+}
+
+// Area is a set of files kept within the budget.
+type Area struct {
+	Name   string
+	Items  func() []Item
+	Remove func(Item) error
+}
+
+// Dir is an area of every file below dir, removed with os.Remove. Files
+// modified in the last minute are left out, as they may still be being
+// written.
+func Dir(name, dir string) Area {
+	return Area{
+		Name: name,
+		Items: func() []Item {
+			var items []Item
+			cutoff := time.Now().Add(-time.Minute)
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil || info.ModTime().After(cutoff) {
+					return nil
+				}
+				items = append(items, Item{ID: path, Size: info.Size(), Used: info.ModTime()})
+				return nil
+			})
+			return items
+		},
+		Remove: func(item Item) error {
+			return os.Remove(item.ID)
+		},
+	}
+}
+
+// Budget limits the disk picoclaw's temporary files may take.
+type Budget struct {
+	// MaxBytes caps the areas together; 0 means no cap
+	MaxBytes int64
+	// MinFreeBytes is the free space to keep on the disk; 0 means none
+	MinFreeBytes int64
+}
+
+// SpaceError is returned when a download cannot fit in the budget.
+type SpaceError struct {
+	Size  int64
+	Limit string
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf("a %s download would go over %s; ask the owner to make room", formatBytes(e.Size), e.Limit)
+}
+
+// Janitor enforces a Budget over a set of areas. A nil Janitor allows
+// everything.
+type Janitor struct {
+	mu        sync.Mutex
+	budget    Budget
+	areas     []Area
+	diskDir   string
+	freeSpace func(dir string) (int64, bool)
+	alert     func(text string)
+	lastAlert time.Time
+	now       func() time.Time
+}
+
+// New creates a janitor for areas; diskDir is a directory on the disk
+// whose free space is watched.
+func New(budget Budget, diskDir string, areas ...Area) *Janitor {
+	return &Janitor{budget: budget, areas: areas, diskDir: diskDir, freeSpace: freeSpace, now: time.Now}
+}
+
+// SetBudget replaces the budget.
+func (j *Janitor) SetBudget(b Budget) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.budget = b
+}
+
+// SetAlert sets how the owners are told about downloads that do not fit.
+func (j *Janitor) SetAlert(fn func(text string)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.alert = fn
+}
+
+// items lists every area's files, least recently used first.
+func (j *Janitor) items() ([]Item, []Area, int64) {
+	var all []Item
+	var owners []Area
+	var used int64
+	for _, area := range j.areas {
+		for _, item := range area.Items() {
+			all = append(all, item)
+			owners = append(owners, area)
+			used += item.Size
+		}
+	}
+	order := make([]int, len(all))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return all[order[a]].Used.Before(all[order[b]].Used) })
+	items := make([]Item, len(all))
+	areas := make([]Area, len(all))
+	for i, k := range order {
+		items[i], areas[i] = all[k], owners[k]
+	}
+	return items, areas, used
+}
+
+// Usage returns the bytes the areas take and the disk's free bytes, -1
+// when unknown.
+func (j *Janitor) Usage() (used, free int64) {
+	if j == nil {
+		return 0, -1
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, _, used = j.items()
+	free = -1
+	if f, ok := j.freeSpace(j.diskDir); ok {
+		free = f
+	}
+	return used, free
+}
+
+// Status describes the space used against the budget, for status
+// reports.
+func (j *Janitor) Status() string {
+	used, free := j.Usage()
+	out := formatBytes(used) + " used"
+	if j != nil {
+		j.mu.Lock()
+		budget := j.budget.MaxBytes
+		j.mu.Unlock()
+		if budget > 0 {
+			out += " of " + formatBytes(budget)
+		}
+	}
+	if free >= 0 {
+		out += ", " + formatBytes(free) + " free on disk"
+	}
+	return out
+}
+
+// Sweep removes least recently used files until the areas fit the budget
+// with room for extra more bytes, and returns how many files and bytes
+// went.
+func (j *Janitor) Sweep(extra int64) (int, int64) {
+	if j == nil {
+		return 0, 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sweepLocked(extra)
+}
+
+func (j *Janitor) sweepLocked(extra int64) (int, int64) {
+	items, areas, used := j.items()
+	free, knowsFree := j.freeSpace(j.diskDir)
+	over := func() bool {
+		if j.budget.MaxBytes > 0 && used+extra > j.budget.MaxBytes {
+			return true
+		}
+		return knowsFree && j.budget.MinFreeBytes > 0 && free-extra < j.budget.MinFreeBytes
+	}
+	removed, freed := 0, int64(0)
+	for i := 0; i < len(items) && over(); i++ {
+		if err := areas[i].Remove(items[i]); err != nil {
+			logger.DebugCF("janitor", "Could not remove file", map[string]interface{}{
+				"area":  areas[i].Name,
+				"file":  items[i].ID,
+				"error": err.Error(),
+			})
+			continue
+		}
+		used -= items[i].Size
+		free += items[i].Size
+		removed++
+		freed += items[i].Size
+	}
+	if removed > 0 {
+		logger.InfoCF("janitor", "Removed files to stay within the disk budget", map[string]interface{}{
+			"files": removed,
+			"bytes": freed,
+		})
+	}
+	return removed, freed
+}
+
+// Check makes room for a download of size bytes, removing older files if
+// needed. It returns a *SpaceError, and tells the owners, when the
+// download is larger than the whole budget or would leave less than the
+// free space floor.
+func (j *Janitor) Check(size int64) error {
+	if j == nil || size <= 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var limit string
+	if j.budget.MaxBytes > 0 && size > j.budget.MaxBytes {
+		limit = fmt.Sprintf("the %s disk budget for downloads", formatBytes(j.budget.MaxBytes))
+	} else {
+		j.sweepLocked(size)
+		if free, ok := j.freeSpace(j.diskDir); ok && j.budget.MinFreeBytes > 0 && free-size < j.budget.MinFreeBytes {
+			limit = fmt.Sprintf("the %s of free disk space to keep (%s free)", formatBytes(j.budget.MinFreeBytes), formatBytes(free))
+		}
+	}
+	if limit == "" {
+		return nil
+	}
+	err := &SpaceError{Size: size, Limit: limit}
+	logger.WarnCF("janitor", "Download refused", map[string]interface{}{"size": size, "limit": limit})
+	if j.alert != nil && j.now().Sub(j.lastAlert) >= alertEvery {
+		j.lastAlert = j.now()
+		j.alert(fmt.Sprintf("A %s download was refused: it would go over %s. Raise disk.budget_mb or free some space.", formatBytes(size), limit))
+	}
+	return err
+}
+
+// Run sweeps every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	j.Sweep(0)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.Sweep(0)
+		}
+	}
+}
+
+var (
+	defaultMu sync.RWMutex
+	current   *Janitor
+)
+
+// SetDefault makes j the janitor Check uses.
+func SetDefault(j *Janitor) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	current = j
+}
+
+// Default returns the janitor Check uses, nil when none is set.
+func Default() *Janitor {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return current
+}
+
+// Check makes room for a download with the default janitor; with none set
+// everything fits.
+func Check(size int64) error {
+	return Default().Check(size)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
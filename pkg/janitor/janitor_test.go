@@ -0,0 +1,60 @@
+package janitor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJanitor_EvictsLeastRecentlyUsedAndRefusesOversized verifies sweeps remove the oldest files first until the budget fits, and a download too big for the budget or free space is refused with one owner alert
+func TestJanitor_EvictsLeastRecentlyUsedAndRefusesOversized(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, make([]byte, size), 0644)
+		at := time.Now().Add(-age)
+		os.Chtimes(path, at, at)
+		return path
+	}
+	oldest := write("oldest.jpg", 400, 3*time.Hour)
+	middle := write("middle.jpg", 400, 2*time.Hour)
+	newest := write("newest.jpg", 400, time.Hour)
+	inFlight := write("partial.mp4", 400, 0)
+
+	var alerts []string
+	j := New(Budget{MaxBytes: 1000}, dir, Dir("media", dir))
+	free := int64(1 << 30)
+	j.freeSpace = func(string) (int64, bool) { return free, true }
+	j.SetAlert(func(text string) { alerts = append(alerts, text) })
+
+	if n, freed := j.Sweep(0); n != 1 || freed != 400 {
+		t.Errorf("sweep removed %d files, %d bytes", n, freed)
+	}
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Error("oldest file kept")
+	}
+	if err := j.Check(300); err != nil {
+		t.Fatalf("download that fits after eviction refused: %v", err)
+	}
+	for path, kept := range map[string]bool{middle: false, newest: true, inFlight: true} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("%s kept=%v", filepath.Base(path), err == nil)
+		}
+	}
+
+	var space *SpaceError
+	if err := j.Check(2000); !errors.As(err, &space) || !strings.Contains(err.Error(), "disk budget") {
+		t.Errorf("oversized download: %v", err)
+	}
+	j.SetBudget(Budget{MinFreeBytes: 1 << 20})
+	free = 1<<20 + 100
+	if err := j.Check(500); !errors.As(err, &space) || !strings.Contains(err.Error(), "free disk space") {
+		t.Errorf("download past the free space floor: %v", err)
+	}
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "budget_mb") {
+		t.Errorf("alerts = %q", alerts)
+	}
+}
@@ -0,0 +1,135 @@
+package locale
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageNames are the known languages, by code, as the model is told
+// to reply in them.
+var languageNames = map[string]string{
+	"en": "English",
+	"pt": "Portuguese",
+	"es": "Spanish",
+	"de": "German",
+	"fr": "French",
+	"zh": "Chinese",
+}
+
+// Name returns the English name of a language code, such as "Portuguese"
+// for "pt", or "" for an unknown one.
+func Name(lang string) string {
+	return languageNames[lang]
+}
+
+// commonWords are frequent short words of each language. Some belong to
+// several ("de", "que"); the ones that do not tell the languages apart.
+var commonWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "to", "of", "in", "it", "my", "me", "what", "can", "please", "for", "with",
+		"this", "that", "have", "do", "i", "be", "on", "at", "will", "how", "when", "not", "your", "we", "thanks", "hi", "hello",
+		"today", "tomorrow", "send", "show", "remind"},
+	"pt": {"o", "a", "os", "as", "de", "do", "da", "dos", "das", "que", "e", "é", "não", "um", "uma", "para", "com", "por",
+		"em", "no", "na", "eu", "você", "voce", "meu", "minha", "isso", "está", "tem", "mais", "mas", "se", "como", "quando",
+		"obrigado", "obrigada", "olá", "oi", "amanhã", "hoje", "manda", "mostra", "lembra", "me", "pra", "ao"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "es", "no", "un", "una", "para", "con", "por", "en", "yo", "mi",
+		"tú", "usted", "está", "esto", "eso", "pero", "como", "cuando", "gracias", "hola", "mañana", "hoy", "del", "al",
+		"muy", "qué", "me", "envía", "muestra", "recuérdame"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "ich", "du", "sie", "wir", "mit", "für", "auf", "zu",
+		"von", "mein", "meine", "bitte", "danke", "wie", "was", "wann", "heute", "morgen", "es", "den", "dem", "auch",
+		"hallo", "mir", "schick", "zeig", "erinnere"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "je", "tu", "vous", "nous", "pas", "pour", "avec",
+		"dans", "sur", "mon", "ma", "ce", "cette", "que", "qui", "merci", "bonjour", "salut", "aujourd'hui", "demain", "du",
+		"au", "il", "elle", "moi", "envoie", "montre", "rappelle"},
+}
+
+// letterHints are letters only some of the languages use.
+var letterHints = map[rune][]string{
+	'ã': {"pt"}, 'õ': {"pt"}, 'ç': {"pt", "fr"}, 'ê': {"pt", "fr"}, 'ô': {"pt", "fr"}, 'á': {"pt", "es"},
+	'í': {"pt", "es"}, 'ó': {"pt", "es"}, 'ú': {"pt", "es"}, 'é': {"pt", "es", "fr"}, 'à': {"pt", "fr"},
+	'ñ': {"es"}, '¿': {"es"}, '¡': {"es"},
+	'ß': {"de"}, 'ä': {"de"}, 'ö': {"de"}, 'ü': {"de"},
+	'è': {"fr"}, 'ù': {"fr"}, 'œ': {"fr"}, 'î': {"fr"}, 'û': {"fr"}, 'ë': {"fr"},
+}
+
+var wordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(commonWords))
+	for lang, words := range commonWords {
+		sets[lang] = make(map[string]bool, len(words))
+		for _, w := range words {
+			sets[lang][w] = true
+		}
+	}
+	return sets
+}()
+
+// Detect guesses which of the known languages text is written in, from
+// its script, common words and accented letters. It returns a language
+// code, or "" when the text is too short or too mixed to tell, as for
+// "ok", a link or an emoji.
+func Detect(text string) string {
+	han, letters := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+			letters++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+	if han >= 2 && han*3 >= letters {
+		return "zh"
+	}
+
+	scores := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, w := range words {
+		if strings.Contains(w, "http") || strings.Contains(w, "www") {
+			continue
+		}
+		for lang, set := range wordSets {
+			if set[w] {
+				scores[lang] += 2
+			}
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		for _, lang := range letterHints[r] {
+			scores[lang]++
+		}
+	}
+
+	best, second := "", 0
+	for _, lang := range []string{"en", "pt", "es", "de", "fr"} {
+		switch s := scores[lang]; {
+		case best == "" || s > scores[best]:
+			if best != "" {
+				second = scores[best]
+			}
+			best = lang
+		case s > second:
+			second = s
+		}
+	}
+	// Two distinctive words, or one and an accent, and a clear lead
+	if scores[best] < 4 || scores[best]-second < 2 {
+		return ""
+	}
+	return best
+}
+
+// ForLanguage returns the locale to format replies in for a conversation
+// in lang: tag when it already is in that language, keeping its region
+// ("pt-BR" for a pt-BR user writing Portuguese), lang itself otherwise,
+// with the clock and units preferences of tag.
+func ForLanguage(tag, lang string) string {
+	if lang == "" || Language(tag) == lang {
+		return tag
+	}
+	if _, ext, ok := strings.Cut(tag, "-u-"); ok {
+		return lang + "-u-" + ext
+	}
+	return lang
+}
@@ -0,0 +1,263 @@
+// Package locale formats what tools show the user, dates, numbers and the
+// fixed phrases of their replies ("Added 2 event(s) to the calendar"), in
+// the user's locale, so a pt-BR user does not get a Portuguese answer
+// wrapped around English tool output.
+//
+// Locales are BCP 47 tags such as "pt-BR". English, Portuguese, Spanish,
+// German, French and Chinese are known; any other tag, and an empty one
+// when no default is set, formats as English. Text meant for the model
+// rather than the user (instructions, error details) stays in English.
+package locale
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaults struct {
+	mu  sync.RWMutex
+	tag string
+}
+
+// SetDefault sets the locale used for an empty tag: users who have not
+// set one in their profile.
+func SetDefault(tag string) {
+	defaults.mu.Lock()
+	defaults.tag = strings.TrimSpace(tag)
+	defaults.mu.Unlock()
+}
+
+// Resolve returns tag, or the default locale when tag is empty.
+func Resolve(tag string) string {
+	if tag = strings.TrimSpace(tag); tag != "" {
+		return tag
+	}
+	defaults.mu.RLock()
+	defer defaults.mu.RUnlock()
+	return defaults.tag
+}
+
+// Language returns the language of tag that formatting is done in: "en",
+// "pt", "es", "de", "fr" or "zh".
+func Language(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(Resolve(tag), "_", "-"))
+	base, _, _ := strings.Cut(tag, "-")
+	if _, ok := weekdays[base]; ok {
+		return base
+	}
+	return "en"
+}
+
+// MonthFirst reports whether tag writes dates month first, as in the US.
+func MonthFirst(tag string) bool {
+	switch region(tag) {
+	case "en-us", "en-ph", "en-ca", "es-us", "fil-ph":
+		return true
+	}
+	return false
+}
+
+// region returns tag lowercased without its extensions: "en-us" for
+// "en-US-u-hc-h23".
+func region(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(Resolve(tag), "_", "-"))
+	tag, _, _ = strings.Cut(tag, "-u-")
+	return tag
+}
+
+// extension returns the value of a BCP 47 Unicode extension key in tag,
+// such as "h12" for "hc" in "en-GB-u-hc-h12".
+func extension(tag, key string) string {
+	_, ext, ok := strings.Cut(strings.ToLower(Resolve(tag)), "-u-")
+	if !ok {
+		return ""
+	}
+	parts := strings.Split(ext, "-")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == key {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// WithPreferences returns tag with a user's clock ("12h" or "24h") and
+// units ("metric" or "imperial") added as the BCP 47 hour cycle and
+// measurement system keys, so the formatters given the tag follow them.
+// Empty preferences keep the locale's own.
+func WithPreferences(tag, clock, units string) string {
+	var ext []string
+	switch strings.ToLower(clock) {
+	case "12h":
+		ext = append(ext, "hc", "h12")
+	case "24h":
+		ext = append(ext, "hc", "h23")
+	}
+	switch strings.ToLower(units) {
+	case "metric":
+		ext = append(ext, "ms", "metric")
+	case "imperial":
+		ext = append(ext, "ms", "ussystem")
+	}
+	if len(ext) == 0 {
+		return tag
+	}
+	base, _, _ := strings.Cut(Resolve(tag), "-u-")
+	if base == "" {
+		base = "und"
+	}
+	return base + "-u-" + strings.Join(ext, "-")
+}
+
+// Clock12 reports whether tag reads clocks in 12 hours.
+func Clock12(tag string) bool {
+	switch extension(tag, "hc") {
+	case "h11", "h12":
+		return true
+	case "h23", "h24":
+		return false
+	}
+	return Language(tag) == "en" && MonthFirst(tag)
+}
+
+// Imperial reports whether tag measures in US units.
+func Imperial(tag string) bool {
+	switch extension(tag, "ms") {
+	case "ussystem", "uksystem":
+		return true
+	case "metric":
+		return false
+	}
+	switch region(tag) {
+	case "en-us", "es-us", "en-lr", "my-mm":
+		return true
+	}
+	return false
+}
+
+// Temperature formats whole degrees given in Celsius: "21°C", or "70°F"
+// where tag measures in US units.
+func Temperature(celsius float64, tag string) string {
+	return TemperatureRange(celsius, celsius, tag)
+}
+
+// TemperatureRange formats a low and high in Celsius: "16–24°C", or
+// "61–75°F" where tag measures in US units. Equal ends give one value.
+func TemperatureRange(low, high float64, tag string) string {
+	unit := "°C"
+	if Imperial(tag) {
+		low, high, unit = low*9/5+32, high*9/5+32, "°F"
+	}
+	if math.Round(low) == math.Round(high) {
+		return fmt.Sprintf("%.0f%s", high, unit)
+	}
+	return fmt.Sprintf("%.0f–%.0f%s", low, high, unit)
+}
+
+var weekdays = map[string][7]string{
+	"en": {"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	"pt": {"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	"es": {"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	"de": {"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	"fr": {"dim", "lun", "mar", "mer", "jeu", "ven", "sam"},
+	"zh": {"周日", "周一", "周二", "周三", "周四", "周五", "周六"},
+}
+
+var months = map[string][12]string{
+	"en": {"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	"pt": {"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+	"es": {"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+	"de": {"Jan", "Feb", "März", "Apr", "Mai", "Juni", "Juli", "Aug", "Sept", "Okt", "Nov", "Dez"},
+	"fr": {"janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc"},
+}
+
+// Date formats a day with its weekday and year: "Mon 2 Jan 2006",
+// "seg 2 jan 2006", "2006年1月2日 周一".
+func Date(t time.Time, tag string) string {
+	return day(t, tag, true)
+}
+
+// Day formats a day with its weekday but no year: "Mon 2 Jan".
+func Day(t time.Time, tag string) string {
+	return day(t, tag, false)
+}
+
+func day(t time.Time, tag string, year bool) string {
+	lang := Language(tag)
+	wd := weekdays[lang][t.Weekday()]
+	if lang == "zh" {
+		s := fmt.Sprintf("%d月%d日 %s", t.Month(), t.Day(), wd)
+		if year {
+			s = fmt.Sprintf("%d年", t.Year()) + s
+		}
+		return s
+	}
+	mon := months[lang][t.Month()-1]
+	var s string
+	switch {
+	case lang == "de":
+		s = fmt.Sprintf("%s %d. %s", wd, t.Day(), mon)
+	case MonthFirst(tag):
+		s = fmt.Sprintf("%s %s %d", wd, mon, t.Day())
+		if year {
+			s += ","
+		}
+	default:
+		s = fmt.Sprintf("%s %d %s", wd, t.Day(), mon)
+	}
+	if year {
+		s += fmt.Sprintf(" %d", t.Year())
+	}
+	return s
+}
+
+// Time formats a time of day: "15:04", or "3:04 PM" where clocks are read
+// in 12 hours.
+func Time(t time.Time, tag string) string {
+	if Clock12(tag) {
+		return t.Format("3:04 PM")
+	}
+	return t.Format("15:04")
+}
+
+// DateTime formats a day and a time of day.
+func DateTime(t time.Time, tag string) string {
+	return Date(t, tag) + " " + Time(t, tag)
+}
+
+// separators are the thousands and decimal separators of each language.
+var separators = map[string][2]string{
+	"en": {",", "."},
+	"zh": {",", "."},
+	"pt": {".", ","},
+	"es": {".", ","},
+	"de": {".", ","},
+	"fr": {"\u202f", ","},
+}
+
+// Number formats f with decimals digits after the decimal separator and
+// its thousands grouped: "1,234.5" in English, "1.234,5" in Portuguese.
+func Number(f float64, decimals int, tag string) string {
+	sep := separators[Language(tag)]
+	s := strconv.FormatFloat(f, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	var sb strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteString(sep[0])
+		}
+		sb.WriteRune(r)
+	}
+	if frac != "" {
+		sb.WriteString(sep[1] + frac)
+	}
+	return sign + sb.String()
+}
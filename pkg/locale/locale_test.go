@@ -0,0 +1,128 @@
+package locale
+
+import (
+	"testing"
+	"time"
+)
+
+// Wednesday 6 May 2026, 15:30
+var when = time.Date(2026, 5, 6, 15, 30, 0, 0, time.UTC)
+
+// TestDateTime_Locales verifies dates and times follow each locale's order, names and clock
+func TestDateTime_Locales(t *testing.T) {
+	cases := map[string]string{
+		"":      "Wed 6 May 2026 15:30",
+		"en-GB": "Wed 6 May 2026 15:30",
+		"en-US": "Wed May 6, 2026 3:30 PM",
+		"pt-BR": "qua 6 mai 2026 15:30",
+		"es":    "mié 6 may 2026 15:30",
+		"de-DE": "Mi 6. Mai 2026 15:30",
+		"zh-CN": "2026年5月6日 周三 15:30",
+		"ja":    "Wed 6 May 2026 15:30",
+	}
+	for tag, want := range cases {
+		if got := DateTime(when, tag); got != want {
+			t.Errorf("DateTime(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+// TestWithPreferences_ClockAndUnits verifies a user's clock and units override their locale's in times and temperatures, and survive a switch of language
+func TestWithPreferences_ClockAndUnits(t *testing.T) {
+	gb := WithPreferences("en-GB", "12h", "imperial")
+	if gb != "en-GB-u-hc-h12-ms-ussystem" {
+		t.Fatalf("WithPreferences = %q", gb)
+	}
+	if got := DateTime(when, gb); got != "Wed 6 May 2026 3:30 PM" {
+		t.Errorf("12h en-GB: %q", got)
+	}
+	if got := TemperatureRange(16, 24, gb); got != "61–75°F" {
+		t.Errorf("imperial: %q", got)
+	}
+	us := WithPreferences("en-US", "24h", "metric")
+	if got := DateTime(when, us); got != "Wed May 6, 2026 15:30" {
+		t.Errorf("24h en-US: %q", got)
+	}
+	if got, want := Temperature(21, us), "21°C"; got != want {
+		t.Errorf("metric en-US: %q, want %q", got, want)
+	}
+	if got := Temperature(21, "en-US"); got != "70°F" {
+		t.Errorf("en-US default units: %q", got)
+	}
+	if got := ForLanguage(gb, "pt"); got != "pt-u-hc-h12-ms-ussystem" || Language(got) != "pt" {
+		t.Errorf("ForLanguage kept %q", got)
+	}
+	if got := WithPreferences("pt-BR", "", ""); got != "pt-BR" {
+		t.Errorf("no preferences: %q", got)
+	}
+}
+
+// TestNumber_Separators verifies thousands and decimal separators per language, including negative numbers
+func TestNumber_Separators(t *testing.T) {
+	cases := []struct {
+		f        float64
+		decimals int
+		tag      string
+		want     string
+	}{
+		{1234567.891, 2, "en", "1,234,567.89"},
+		{1234567.891, 2, "pt-BR", "1.234.567,89"},
+		{-1234.5, 1, "de", "-1.234,5"},
+		{999, 0, "es", "999"},
+		{1000, 0, "fr", "1\u202f000"},
+	}
+	for _, c := range cases {
+		if got := Number(c.f, c.decimals, c.tag); got != c.want {
+			t.Errorf("Number(%v, %d, %q) = %q, want %q", c.f, c.decimals, c.tag, got, c.want)
+		}
+	}
+}
+
+// TestT_DefaultAndFallback verifies phrases use the server default for an empty tag and English for unknown languages
+func TestT_DefaultAndFallback(t *testing.T) {
+	SetDefault("pt-BR")
+	defer SetDefault("")
+
+	if got, want := T("", "events.added", 2), "2 evento(s) adicionado(s) à agenda"; got != want {
+		t.Errorf("default locale: got %q, want %q", got, want)
+	}
+	if got, want := T("ja-JP", "events.added", 2), "Added 2 event(s) to the calendar"; got != want {
+		t.Errorf("unknown language: got %q, want %q", got, want)
+	}
+	if got, want := T("zh", "email.unread", 3, 2, "5月6日 周三 15:30"), "自 5月6日 周三 15:30 以来有 3 封未读邮件，共 2 个会话"; got != want {
+		t.Errorf("reordered arguments: got %q, want %q", got, want)
+	}
+}
+
+// TestDetect verifies the language of a message is told from its words, accents and script, and short or mixed text is left undecided
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"Can you send me the report for this week?":                 "en",
+		"Você pode me mandar o relatório da semana?":                "pt",
+		"¿Puedes enviarme el informe de la semana?":                 "es",
+		"Kannst du mir bitte den Bericht für diese Woche schicken?": "de",
+		"Peux-tu m'envoyer le rapport de la semaine ?":              "fr",
+		"请把这周的报告发给我":                                                "zh",
+		"amanhã às 10h com a Ana":                                   "pt",
+		"ok":                                                        "",
+		"👍":                                                         "",
+		"https://example.com/page":                                  "",
+		"Ana Souza":                                                 "",
+	}
+	for text, want := range cases {
+		if got := Detect(text); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	SetDefault("")
+	if got := ForLanguage("pt-BR", "pt"); got != "pt-BR" {
+		t.Errorf("ForLanguage(pt-BR, pt) = %q", got)
+	}
+	if got := ForLanguage("pt-BR", "en"); got != "en" {
+		t.Errorf("ForLanguage(pt-BR, en) = %q", got)
+	}
+	if got := ForLanguage("de-DE", ""); got != "de-DE" {
+		t.Errorf("ForLanguage(de-DE, \"\") = %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package locale
+
+import "fmt"
+
+// messages holds the fixed phrases of tool replies by key, as fmt formats
+// in English and their translations. A phrase missing in a language is
+// shown in English.
+var messages = map[string]map[string]string{
+	"events.added": {
+		"en": "Added %d event(s) to the calendar",
+		"pt": "%d evento(s) adicionado(s) à agenda",
+		"es": "Se añadieron %d evento(s) al calendario",
+		"de": "%d Termin(e) zum Kalender hinzugefügt",
+		"fr": "%d événement(s) ajouté(s) à l'agenda",
+		"zh": "已将 %d 个活动添加到日历",
+	},
+	"events.failed": {
+		"en": "%d failed",
+		"pt": "%d falharam",
+		"es": "%d fallaron",
+		"de": "%d fehlgeschlagen",
+		"fr": "%d en échec",
+		"zh": "%d 个失败",
+	},
+	"events.nothing_new": {
+		"en": "All proposed events are already in the calendar; nothing added.",
+		"pt": "Todos os eventos propostos já estão na agenda; nada foi adicionado.",
+		"es": "Todos los eventos propuestos ya están en el calendario; no se añadió nada.",
+		"de": "Alle vorgeschlagenen Termine sind schon im Kalender; nichts hinzugefügt.",
+		"fr": "Tous les événements proposés sont déjà dans l'agenda ; rien n'a été ajouté.",
+		"zh": "所有提议的活动都已在日历中，未添加任何内容。",
+	},
+	"events.in_calendar": {
+		"en": "already in calendar",
+		"pt": "já está na agenda",
+		"es": "ya está en el calendario",
+		"de": "schon im Kalender",
+		"fr": "déjà dans l'agenda",
+		"zh": "已在日历中",
+	},
+	"events.all_day": {
+		"en": "all day",
+		"pt": "dia inteiro",
+		"es": "todo el día",
+		"de": "ganztägig",
+		"fr": "toute la journée",
+		"zh": "全天",
+	},
+	"briefing.greeting": {
+		"en": "☀️ Good morning! Your briefing for %s",
+		"pt": "☀️ Bom dia! Seu resumo de %s",
+		"es": "☀️ ¡Buenos días! Tu resumen del %s",
+		"de": "☀️ Guten Morgen! Dein Überblick für %s",
+		"fr": "☀️ Bonjour ! Votre point du %s",
+		"zh": "☀️ 早上好！这是您 %s 的简报",
+	},
+	"briefing.unavailable": {
+		"en": "(unavailable: %v)",
+		"pt": "(indisponível: %v)",
+		"es": "(no disponible: %v)",
+		"de": "(nicht verfügbar: %v)",
+		"fr": "(indisponible : %v)",
+		"zh": "（不可用：%v）",
+	},
+	"email.none": {
+		"en": "No unread email since %s.",
+		"pt": "Nenhum e-mail não lido desde %s.",
+		"es": "No hay correos sin leer desde %s.",
+		"de": "Keine ungelesenen E-Mails seit %s.",
+		"fr": "Aucun e-mail non lu depuis %s.",
+		"zh": "自 %s 以来没有未读邮件。",
+	},
+	"email.unread": {
+		"en": "%d unread email(s) in %d conversation(s) since %s",
+		"pt": "%d e-mail(s) não lido(s) em %d conversa(s) desde %s",
+		"es": "%d correo(s) sin leer en %d conversación(es) desde %s",
+		"de": "%d ungelesene E-Mail(s) in %d Unterhaltung(en) seit %s",
+		"fr": "%d e-mail(s) non lu(s) dans %d conversation(s) depuis %s",
+		"zh": "自 %[3]s 以来有 %[1]d 封未读邮件，共 %[2]d 个会话",
+	},
+	"email.messages": {
+		"en": "%d messages",
+		"pt": "%d mensagens",
+		"es": "%d mensajes",
+		"de": "%d Nachrichten",
+		"fr": "%d messages",
+		"zh": "%d 封",
+	},
+	"email.archivable": {
+		"en": "Can be archived: %d email(s) from %s",
+		"pt": "Podem ser arquivados: %d e-mail(s) de %s",
+		"es": "Se pueden archivar: %d correo(s) de %s",
+		"de": "Kann archiviert werden: %d E-Mail(s) von %s",
+		"fr": "Peuvent être archivés : %d e-mail(s) de %s",
+		"zh": "可归档：来自 %[2]s 的 %[1]d 封邮件",
+	},
+	"list.more": {
+		"en": "…and %d more",
+		"pt": "…e mais %d",
+		"es": "…y %d más",
+		"de": "…und %d weitere",
+		"fr": "…et %d de plus",
+		"zh": "……还有 %d 个",
+	},
+	"list.and_more": {
+		"en": "%s and %d more",
+		"pt": "%s e mais %d",
+		"es": "%s y %d más",
+		"de": "%s und %d weitere",
+		"fr": "%s et %d de plus",
+		"zh": "%s 等另外 %d 个",
+	},
+}
+
+// T returns the phrase key in tag's language, formatted with args. An
+// unknown key is returned as is.
+func T(tag, key string, args ...interface{}) string {
+	phrases, ok := messages[key]
+	if !ok {
+		return key
+	}
+	format, ok := phrases[Language(tag)]
+	if !ok {
+		format = phrases["en"]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
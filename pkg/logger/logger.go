@@ -3,6 +3,7 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -30,14 +31,25 @@ var (
 		FATAL: "FATAL",
 	}
 
-	currentLevel = INFO
-	logger       *Logger
-	once         sync.Once
-	mu           sync.RWMutex
+	currentLevel    = INFO
+	componentLevels = map[string]LogLevel{}
+	consoleFormat   = FormatText
+	logger          *Logger
+	once            sync.Once
+	mu              sync.RWMutex
+)
+
+// Format selects how log lines are written to the console.
+type Format string
+
+const (
+	FormatText Format = "text"
+	// FormatJSON writes one JSON object per line, for log shippers
+	FormatJSON Format = "json"
 )
 
 type Logger struct {
-	file *os.File
+	file io.WriteCloser
 }
 
 type LogEntry struct {
@@ -67,11 +79,54 @@ func GetLevel() LogLevel {
 	return currentLevel
 }
 
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(strings.TrimSpace(name), levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(name), "warning") {
+		return WARN, nil
+	}
+	return INFO, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetComponentLevel overrides the level for one component, e.g. to debug
+// "telegram" while everything else stays at INFO.
+func SetComponentLevel(component string, level LogLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	componentLevels[component] = level
+}
+
+// ResetComponentLevels removes all per-component overrides.
+func ResetComponentLevels() {
+	mu.Lock()
+	defer mu.Unlock()
+	componentLevels = map[string]LogLevel{}
+}
+
+// SetFormat selects the console output format. The log file is always
+// JSON.
+func SetFormat(format Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	consoleFormat = format
+}
+
+// EnableFileLogging appends JSON log lines to filePath without limits.
 func EnableFileLogging(filePath string) error {
+	return EnableRotatingFileLogging(filePath, RotateOptions{})
+}
+
+// EnableRotatingFileLogging appends JSON log lines to filePath, rotating
+// and pruning it according to opts.
+func EnableRotatingFileLogging(filePath string, opts RotateOptions) error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, err := openRotatingFile(filePath, opts)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
@@ -96,10 +151,21 @@ func DisableFileLogging() {
 	}
 }
 
+func levelFor(component string) LogLevel {
+	if level, ok := componentLevels[component]; ok {
+		return level
+	}
+	return currentLevel
+}
+
 func logMessage(level LogLevel, component string, message string, fields map[string]interface{}) {
-	if level < currentLevel {
+	mu.RLock()
+	defer mu.RUnlock()
+	if level < levelFor(component) {
 		return
 	}
+	message = redactText(message)
+	fields = redactFields(fields)
 
 	entry := LogEntry{
 		Level:     logLevelNames[level],
@@ -116,11 +182,23 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 		}
 	}
 
-	if logger.file != nil {
-		jsonData, err := json.Marshal(entry)
-		if err == nil {
-			logger.file.WriteString(string(jsonData) + "\n")
+	var jsonData []byte
+	if logger.file != nil || consoleFormat == FormatJSON {
+		var err error
+		if jsonData, err = json.Marshal(entry); err != nil {
+			jsonData = nil
+		}
+	}
+	if logger.file != nil && jsonData != nil {
+		logger.file.Write(append(jsonData, '\n'))
+	}
+
+	if consoleFormat == FormatJSON && jsonData != nil {
+		log.Writer().Write(append(jsonData, '\n'))
+		if level == FATAL {
+			os.Exit(1)
 		}
+		return
 	}
 
 	var fieldStr string
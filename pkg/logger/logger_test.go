@@ -1,7 +1,11 @@
 package logger
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLogLevelFiltering(t *testing.T) {
@@ -137,3 +141,144 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]interface{}{"key": "value"})
 }
+
+func TestComponentLevelsAndFileOutput(t *testing.T) {
+	initialLevel := GetLevel()
+	defer SetLevel(initialLevel)
+	defer ResetComponentLevels()
+	defer DisableFileLogging()
+
+	path := filepath.Join(t.TempDir(), "picoclaw.log")
+	if err := EnableFileLogging(path); err != nil {
+		t.Fatalf("EnableFileLogging: %v", err)
+	}
+	SetLevel(WARN)
+	SetComponentLevel("telegram", DEBUG)
+
+	DebugC("telegram", "telegram debug")
+	DebugC("agent", "agent debug")
+	WarnC("agent", "agent warning")
+
+	data, _ := os.ReadFile(path)
+	log := string(data)
+	if !strings.Contains(log, `"message":"telegram debug"`) || !strings.Contains(log, `"message":"agent warning"`) {
+		t.Errorf("expected messages missing from log:\n%s", log)
+	}
+	if strings.Contains(log, "agent debug") {
+		t.Errorf("agent debug should be filtered:\n%s", log)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]LogLevel{"debug": DEBUG, "INFO": INFO, "warning": WARN, " error ": ERROR} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel accepted an unknown level")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "picoclaw.log")
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	r, err := openRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		r.Write([]byte("0123456789\n"))
+		now = now.Add(time.Minute)
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("got backups %v, want 2", backups)
+	}
+	if !strings.HasSuffix(backups[1], ".20261016-090300") {
+		t.Errorf("newest backup = %s", backups[1])
+	}
+	if data, _ := os.ReadFile(path); string(data) != "0123456789\n" {
+		t.Errorf("current file = %q", data)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	defer SetRedaction(RedactPolicy{Secrets: true})
+	defer DisableFileLogging()
+	path := filepath.Join(t.TempDir(), "picoclaw.log")
+	if err := EnableFileLogging(path); err != nil {
+		t.Fatal(err)
+	}
+	SetRedaction(RedactPolicy{Secrets: true, Emails: true, Content: true, Fields: []string{"phone"}})
+
+	WarnCF("tool", "Request with Authorization: Bearer abcdef1234567890 for alice@example.com", map[string]interface{}{
+		"preview":       "Dear Bob, the wire code is 1234",
+		"access_token":  "ya29.secret",
+		"phone":         "+351 900 000 000",
+		"url":           "https://x.test/?api_key=k3y-value&q=1",
+		"error":         "send failed for bob@example.org",
+		"content_chars": 42,
+	})
+
+	data, _ := os.ReadFile(path)
+	log := string(data)
+	for _, leaked := range []string{"abcdef1234567890", "alice@", "wire code", "ya29.secret", "900 000", "k3y-value", "bob@"} {
+		if strings.Contains(log, leaked) {
+			t.Errorf("%q leaked into log:\n%s", leaked, log)
+		}
+	}
+	for _, want := range []string{"***@example.com", `"preview":"[redacted: 31 chars]"`, "api_key=[redacted]", `"content_chars":42`} {
+		if !strings.Contains(log, want) {
+			t.Errorf("missing %q in log:\n%s", want, log)
+		}
+	}
+	if got := Redact("token=abcd1234 ok"); got != "token=[redacted] ok" {
+		t.Errorf("Redact = %q", got)
+	}
+}
+
+func TestRedaction_TokenCounts(t *testing.T) {
+	defer SetRedaction(RedactPolicy{Secrets: true})
+	SetRedaction(RedactPolicy{Secrets: true})
+
+	fields := redactFields(map[string]interface{}{
+		"max_tokens":        4096,
+		"prompt_tokens":     120,
+		"completion_tokens": "35",
+		"tokens_used":       int64(155),
+		"bot_token":         "123456:abc",
+		"accessToken":       "ya29.value",
+		"X-Api-Key":         "k3y",
+		"refresh_token":     map[string]string{"value": "r3fresh"},
+	})
+	for key, want := range map[string]interface{}{
+		"max_tokens":        4096,
+		"prompt_tokens":     120,
+		"completion_tokens": "35",
+		"tokens_used":       int64(155),
+		"bot_token":         "[redacted]",
+		"accessToken":       "[redacted]",
+		"X-Api-Key":         "[redacted]",
+		"refresh_token":     "[redacted]",
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %v, want %v", key, fields[key], want)
+		}
+	}
+	for _, name := range []string{"Authorization", "Set-Cookie", "client_secret", "apikey", "key", "APIKey"} {
+		if !IsSecretName(name) {
+			t.Errorf("%q is not a secret name", name)
+		}
+	}
+	for _, name := range []string{"max_tokens", "keyword", "monkey", "tokenizer"} {
+		if IsSecretName(name) {
+			t.Errorf("%q is a secret name", name)
+		}
+	}
+}
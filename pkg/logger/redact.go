@@ -0,0 +1,192 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// RedactPolicy says what to mask before a log line is written.
+type RedactPolicy struct {
+	// Secrets masks bearer tokens, API keys and fields named like secrets
+	Secrets bool
+	// Emails masks the local part of email addresses
+	Emails bool
+	// Content replaces message bodies, tool arguments and file contents
+	// (fields such as "content" and "preview") with their length
+	Content bool
+	// Fields are extra field names whose values are always masked
+	Fields []string
+	// Patterns are extra expressions masked wherever they appear
+	Patterns []*regexp.Regexp
+}
+
+var (
+	redaction = RedactPolicy{Secrets: true}
+
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`),
+		regexp.MustCompile(`(?i)\b(api[_-]?key|access[_-]?token|refresh[_-]?token|client[_-]?secret|password|secret|token)(["']?\s*[:=]\s*["']?)[^\s"'&,}]{4,}`),
+		// OpenAI/Anthropic style keys, Google access tokens, Telegram bot tokens
+		regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),
+		regexp.MustCompile(`\bya29\.[A-Za-z0-9._-]{16,}`),
+		regexp.MustCompile(`\b\d{8,10}:[A-Za-z0-9_-]{35}\b`),
+	}
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@([A-Za-z0-9-]+\.[A-Za-z0-9.-]+)`)
+
+	// secretFieldWords are matched against whole words of a name, so
+	// "bot_token" is masked and "max_tokens" is not
+	secretFieldWords = []string{"token", "secret", "password", "authorization", "apikey", "cookie"}
+	contentFields    = map[string]bool{
+		"content": true, "preview": true, "text": true, "body": true, "args": true,
+		"payload": true, "request": true, "response": true, "result": true,
+		"messages_json": true, "tools_json": true, "transcription_preview": true,
+	}
+)
+
+// SetRedaction replaces the redaction policy.
+func SetRedaction(policy RedactPolicy) {
+	mu.Lock()
+	defer mu.Unlock()
+	redaction = policy
+}
+
+// Redact applies the text rules of the current policy (secrets, emails,
+// extra patterns) to s, for text that leaves the process outside the
+// logger, such as trace attributes.
+func Redact(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return redactText(s)
+}
+
+// RedactSecrets masks tokens, keys and the extra patterns in s whatever
+// the policy says, for debug output that must never carry credentials.
+func RedactSecrets(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i, re := range secretPatterns {
+		if i == 1 {
+			s = re.ReplaceAllString(s, "$1$2[redacted]")
+			continue
+		}
+		s = re.ReplaceAllString(s, "[redacted]")
+	}
+	for _, re := range redaction.Patterns {
+		s = re.ReplaceAllString(s, "[redacted]")
+	}
+	return s
+}
+
+// IsSecretName reports whether a field, header or parameter called name
+// holds a secret, by the same words Redact masks fields by.
+func IsSecretName(name string) bool {
+	words := nameWords(name)
+	for i, w := range words {
+		// "api_key" and "X-Api-Key" are the word "apikey" split in two
+		if slices.Contains(secretFieldWords, w) || i > 0 && slices.Contains(secretFieldWords, words[i-1]+w) {
+			return true
+		}
+	}
+	return len(words) == 1 && words[0] == "key"
+}
+
+// nameWords splits a field, header or parameter name into lower-case
+// words at punctuation and case changes: "accessToken", "access_token"
+// and "Access-Token" are all "access" and "token".
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, strings.ToLower(string(word)))
+				word = word[:0]
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			// "apiKey" splits before K, "APIKey" too, "API" stays whole
+			if !unicode.IsUpper(prev) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				words = append(words, strings.ToLower(string(word)))
+				word = word[:0]
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, strings.ToLower(string(word)))
+	}
+	return words
+}
+
+func redactText(s string) string {
+	if redaction.Secrets {
+		for i, re := range secretPatterns {
+			if i == 1 {
+				// Keep the key name so the line still says what was there
+				s = re.ReplaceAllString(s, "$1$2[redacted]")
+				continue
+			}
+			s = re.ReplaceAllString(s, "[redacted]")
+		}
+	}
+	if redaction.Emails {
+		s = emailPattern.ReplaceAllString(s, "***@$1")
+	}
+	for _, re := range redaction.Patterns {
+		s = re.ReplaceAllString(s, "[redacted]")
+	}
+	return s
+}
+
+func redactFields(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return fields
+	}
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		out[k] = redactField(k, v)
+	}
+	return out
+}
+
+func redactField(key string, value interface{}) interface{} {
+	lower := strings.ToLower(key)
+	for _, f := range redaction.Fields {
+		if strings.EqualFold(f, key) {
+			return "[redacted]"
+		}
+	}
+
+	switch v := value.(type) {
+	case nil, bool, int, int64, int32, uint, uint64, float64, float32:
+		// Counts and flags are never credentials, whatever they are called
+		return value
+	case string:
+		if redaction.Secrets && IsSecretName(key) {
+			return "[redacted]"
+		}
+		if redaction.Content && contentFields[lower] {
+			return fmt.Sprintf("[redacted: %d chars]", len(v))
+		}
+		return redactText(v)
+	default:
+		if redaction.Secrets && IsSecretName(key) {
+			return "[redacted]"
+		}
+		s := fmt.Sprintf("%v", v)
+		if redaction.Content && contentFields[lower] {
+			return fmt.Sprintf("[redacted: %d chars]", len(s))
+		}
+		// Keep structured values as they are unless something was masked
+		if r := redactText(s); r != s {
+			return r
+		}
+		return value
+	}
+}
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions limits how much disk a log file may use. Zero values
+// disable the corresponding limit.
+type RotateOptions struct {
+	// MaxSize is the size in bytes at which the file is rotated
+	MaxSize int64
+	// MaxAge removes rotated files older than this
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files to keep
+	MaxBackups int
+}
+
+// rotatingFile appends to path and, once it grows past MaxSize, renames it
+// to path.YYYYMMDD-HHMMSS and starts a new one, pruning old backups.
+type rotatingFile struct {
+	path string
+	opts RotateOptions
+	now  func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, opts RotateOptions) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, opts: opts, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.prune()
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.opts.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSize {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the oversized file rather than dropping lines
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	backup := r.path + "." + r.now().Format("20060102-150405")
+	// Several rotations within a second must not overwrite each other
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s.%s-%d", r.path, r.now().Format("20060102-150405"), i)
+	}
+	renameErr := os.Rename(r.path, backup)
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	r.prune()
+	return renameErr
+}
+
+// prune deletes backups beyond MaxBackups or older than MaxAge.
+func (r *rotatingFile) prune() {
+	matches, _ := filepath.Glob(r.path + ".*")
+	var backups []string
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".tmp") {
+			backups = append(backups, m)
+		}
+	}
+	// Timestamped names sort oldest first
+	sort.Strings(backups)
+	cutoff := time.Time{}
+	if r.opts.MaxAge > 0 {
+		cutoff = r.now().Add(-r.opts.MaxAge)
+	}
+	for i, b := range backups {
+		tooMany := r.opts.MaxBackups > 0 && len(backups)-i > r.opts.MaxBackups
+		tooOld := false
+		if !cutoff.IsZero() {
+			if info, err := os.Stat(b); err == nil && info.ModTime().Before(cutoff) {
+				tooOld = true
+			}
+		}
+		if tooMany || tooOld {
+			os.Remove(b)
+		}
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,497 @@
+// Package mediaindex indexes photos and videos in local directories (for
+// example a camera SD card mounted on the device) into a SQLite database,
+// with EXIF metadata and small JPEG thumbnails, so they can be searched by
+// date and folder without rescanning the card.
+package mediaindex
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/exif"
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+// thumbSize is the longest edge of generated thumbnails, in pixels.
+const thumbSize = 320
+
+// maxThumbSource skips thumbnails for huge images, which would need more
+// memory to decode than a small board has.
+const maxThumbSource = 40 << 20
+
+var mediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".heic": "image/heic",
+	".webp": "image/webp",
+	".dng":  "image/x-adobe-dng",
+	".mp4":  "video/mp4",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".mkv":  "video/x-matroska",
+}
+
+// MimeType returns the media type of a file by extension, or "" when the
+// file is not a photo or video.
+func MimeType(path string) string {
+	return mediaTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+// Item is one indexed file.
+type Item struct {
+	ID          int64     `json:"id"`
+	Path        string    `json:"path"`
+	Folder      string    `json:"folder"`
+	Name        string    `json:"name"`
+	MimeType    string    `json:"mime_type"`
+	Size        int64     `json:"size"`
+	Taken       time.Time `json:"-"`
+	Camera      string    `json:"camera"`
+	HasLocation bool      `json:"-"`
+	Latitude    float64   `json:"lat"`
+	Longitude   float64   `json:"lon"`
+	Thumbnail   string    `json:"thumb"`
+	UploadedID  string    `json:"uploaded_id"`
+}
+
+// Query filters a search. Zero values match everything.
+type Query struct {
+	From   time.Time
+	To     time.Time
+	Folder string
+	Limit  int
+}
+
+// ScanStats summarizes a scan.
+type ScanStats struct {
+	Added     int
+	Updated   int
+	Removed   int
+	Unchanged int
+	// Offline lists roots that were not present (e.g. card not inserted);
+	// their entries are kept.
+	Offline []string
+}
+
+// Index is a SQLite-backed media index. It talks to the sqlite3 shell, like
+// the expense ledger, so the binary needs no cgo driver.
+type Index struct {
+	dbPath   string
+	thumbDir string
+	roots    []string
+	bin      string
+
+	mu       sync.Mutex
+	initOnce sync.Once
+	initErr  error
+	lastScan time.Time
+}
+
+// New creates an index stored at dbPath, with thumbnails under thumbDir,
+// covering the given root directories.
+func New(dbPath, thumbDir string, roots []string) *Index {
+	return &Index{dbPath: dbPath, thumbDir: thumbDir, roots: roots, bin: "sqlite3"}
+}
+
+// Roots returns the indexed directories.
+func (ix *Index) Roots() []string {
+	return ix.roots
+}
+
+// LastScan returns when the last scan finished (zero if never in this run).
+func (ix *Index) LastScan() time.Time {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.lastScan
+}
+
+func (ix *Index) query(ctx context.Context, sql string, out interface{}) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ix.bin, "-json", "-bail", ix.dbPath)
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3 failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out == nil || len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+		return fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+	return nil
+}
+
+func (ix *Index) init(ctx context.Context) error {
+	ix.initOnce.Do(func() {
+		if _, err := exec.LookPath(ix.bin); err != nil {
+			ix.initErr = fmt.Errorf("sqlite3 is not installed; the local media index needs it")
+			return
+		}
+		for _, dir := range []string{filepath.Dir(ix.dbPath), ix.thumbDir} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				ix.initErr = err
+				return
+			}
+		}
+		ix.initErr = ix.query(ctx, `CREATE TABLE IF NOT EXISTS media (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	path TEXT NOT NULL UNIQUE,
+	root TEXT NOT NULL,
+	folder TEXT NOT NULL,
+	name TEXT NOT NULL,
+	mime_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mtime INTEGER NOT NULL,
+	taken TEXT NOT NULL,
+	camera TEXT NOT NULL DEFAULT '',
+	has_location INTEGER NOT NULL DEFAULT 0,
+	lat REAL NOT NULL DEFAULT 0,
+	lon REAL NOT NULL DEFAULT 0,
+	thumb TEXT NOT NULL DEFAULT '',
+	uploaded_id TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS media_taken ON media(taken);
+CREATE INDEX IF NOT EXISTS media_folder ON media(folder);`, nil)
+	})
+	return ix.initErr
+}
+
+type fileState struct {
+	ID    int64  `json:"id"`
+	Path  string `json:"path"`
+	Root  string `json:"root"`
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	Thumb string `json:"thumb"`
+}
+
+// Scan walks the roots and brings the index up to date. Only new or
+// modified files are read, so rescanning a large card is cheap.
+func (ix *Index) Scan(ctx context.Context) (*ScanStats, error) {
+	if err := ix.init(ctx); err != nil {
+		return nil, err
+	}
+	var known []fileState
+	if err := ix.query(ctx, "SELECT id, path, root, size, mtime, thumb FROM media;", &known); err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]fileState, len(known))
+	for _, f := range known {
+		byPath[f.Path] = f
+	}
+
+	stats := &ScanStats{}
+	seen := make(map[string]bool)
+	online := make(map[string]bool)
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		sql := "BEGIN;\n" + strings.Join(batch, "\n") + "\nCOMMIT;"
+		batch = batch[:0]
+		return ix.query(ctx, sql, nil)
+	}
+
+	for _, root := range ix.roots {
+		root = filepath.Clean(root)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			stats.Offline = append(stats.Offline, root)
+			continue
+		}
+		online[root] = true
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable subdirectories are skipped, not fatal
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			mime := MimeType(path)
+			if mime == "" {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			seen[path] = true
+			prev, exists := byPath[path]
+			if exists && prev.Size == info.Size() && prev.MTime == info.ModTime().Unix() {
+				stats.Unchanged++
+				return nil
+			}
+
+			item := ix.describe(path, root, mime, info)
+			if exists {
+				stats.Updated++
+			} else {
+				stats.Added++
+			}
+			batch = append(batch, upsertSQL(item, root, info.ModTime().Unix()))
+			if len(batch) >= 200 {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	// Forget files that disappeared from roots that are present
+	for _, f := range known {
+		if seen[f.Path] || !online[f.Root] {
+			continue
+		}
+		stats.Removed++
+		batch = append(batch, fmt.Sprintf("DELETE FROM media WHERE id = %d;", f.ID))
+		if f.Thumb != "" {
+			os.Remove(f.Thumb)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	ix.mu.Lock()
+	ix.lastScan = time.Now()
+	ix.mu.Unlock()
+	return stats, nil
+}
+
+// describe reads the metadata of a file and writes its thumbnail.
+func (ix *Index) describe(path, root, mime string, info fs.FileInfo) *Item {
+	folder, _ := filepath.Rel(root, filepath.Dir(path))
+	item := &Item{
+		Path:     path,
+		Folder:   filepath.ToSlash(filepath.Join(filepath.Base(root), folder)),
+		Name:     filepath.Base(path),
+		MimeType: mime,
+		Size:     info.Size(),
+		Taken:    info.ModTime().UTC(),
+	}
+	if mime == "image/jpeg" {
+		if f, err := os.Open(path); err == nil {
+			if meta, err := exif.Decode(f); err == nil {
+				if !meta.Taken.IsZero() {
+					item.Taken = meta.Taken
+				}
+				item.Camera = strings.TrimSpace(meta.Make + " " + meta.Model)
+				item.HasLocation = meta.HasLocation
+				item.Latitude, item.Longitude = meta.Latitude, meta.Longitude
+			}
+			f.Close()
+		}
+	}
+	if strings.HasPrefix(mime, "image/") && info.Size() <= maxThumbSource {
+		thumb, err := ix.writeThumbnail(path)
+		if err == nil {
+			item.Thumbnail = thumb
+		} else if err != image.ErrFormat {
+			logger.DebugCF("mediaindex", "Thumbnail failed", map[string]interface{}{"path": path, "error": err.Error()})
+		}
+	}
+	return item
+}
+
+func upsertSQL(item *Item, root string, mtime int64) string {
+	loc := 0
+	if item.HasLocation {
+		loc = 1
+	}
+	return fmt.Sprintf(`INSERT INTO media (path, root, folder, name, mime_type, size, mtime, taken, camera, has_location, lat, lon, thumb)
+VALUES (%s, %s, %s, %s, %s, %d, %d, %s, %s, %d, %f, %f, %s)
+ON CONFLICT(path) DO UPDATE SET folder=excluded.folder, name=excluded.name, mime_type=excluded.mime_type,
+size=excluded.size, mtime=excluded.mtime, taken=excluded.taken, camera=excluded.camera,
+has_location=excluded.has_location, lat=excluded.lat, lon=excluded.lon, thumb=excluded.thumb;`,
+		store.Quote(item.Path), store.Quote(root), store.Quote(item.Folder), store.Quote(item.Name), store.Quote(item.MimeType),
+		item.Size, mtime, store.Quote(item.Taken.Format("2006-01-02T15:04:05")), store.Quote(item.Camera), loc,
+		item.Latitude, item.Longitude, store.Quote(item.Thumbnail))
+}
+
+// writeThumbnail stores a downscaled JPEG keyed by the source path. Formats
+// the standard library cannot decode (HEIC, RAW) return image.ErrFormat.
+func (ix *Index) writeThumbnail(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(path))
+	out := filepath.Join(ix.thumbDir, hex.EncodeToString(sum[:])+".jpg")
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, imaging.Thumbnail(img, thumbSize), imaging.ThumbnailQuality); err != nil {
+		return "", err
+	}
+	return out, os.WriteFile(out, buf.Bytes(), 0644)
+}
+
+type itemRow struct {
+	ID          int64   `json:"id"`
+	Path        string  `json:"path"`
+	Folder      string  `json:"folder"`
+	Name        string  `json:"name"`
+	MimeType    string  `json:"mime_type"`
+	Size        int64   `json:"size"`
+	Taken       string  `json:"taken"`
+	Camera      string  `json:"camera"`
+	HasLocation int     `json:"has_location"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Thumb       string  `json:"thumb"`
+	UploadedID  string  `json:"uploaded_id"`
+}
+
+func (r itemRow) toItem() Item {
+	taken, _ := time.Parse("2006-01-02T15:04:05", r.Taken)
+	return Item{
+		ID:          r.ID,
+		Path:        r.Path,
+		Folder:      r.Folder,
+		Name:        r.Name,
+		MimeType:    r.MimeType,
+		Size:        r.Size,
+		Taken:       taken,
+		Camera:      r.Camera,
+		HasLocation: r.HasLocation != 0,
+		Latitude:    r.Lat,
+		Longitude:   r.Lon,
+		Thumbnail:   r.Thumb,
+		UploadedID:  r.UploadedID,
+	}
+}
+
+const itemColumns = "id, path, folder, name, mime_type, size, taken, camera, has_location, lat, lon, thumb, uploaded_id"
+
+// Search returns items matching q, oldest first. To is inclusive of the
+// whole day when it has no time component.
+func (ix *Index) Search(ctx context.Context, q Query) ([]Item, error) {
+	if err := ix.init(ctx); err != nil {
+		return nil, err
+	}
+	var where []string
+	if !q.From.IsZero() {
+		where = append(where, "taken >= "+store.Quote(q.From.Format("2006-01-02T15:04:05")))
+	}
+	if !q.To.IsZero() {
+		to := q.To
+		if to.Hour() == 0 && to.Minute() == 0 && to.Second() == 0 {
+			to = to.Add(24*time.Hour - time.Second)
+		}
+		where = append(where, "taken <= "+store.Quote(to.Format("2006-01-02T15:04:05")))
+	}
+	if q.Folder != "" {
+		// Match the folder or anything below it, case-insensitively
+		f := strings.Trim(filepath.ToSlash(q.Folder), "/")
+		where = append(where, fmt.Sprintf("(folder = %s COLLATE NOCASE OR folder LIKE %s ESCAPE '\\' OR folder LIKE %s ESCAPE '\\')",
+			store.Quote(f), store.Quote(likeEscape(f)+"/%"), store.Quote("%/"+likeEscape(f))))
+	}
+	sql := "SELECT " + itemColumns + " FROM media"
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += " ORDER BY taken, path"
+	if q.Limit > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	var rows []itemRow
+	if err := ix.query(ctx, sql+";", &rows); err != nil {
+		return nil, err
+	}
+	items := make([]Item, len(rows))
+	for i, r := range rows {
+		items[i] = r.toItem()
+	}
+	return items, nil
+}
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Folders returns the indexed folders with their item counts.
+func (ix *Index) Folders(ctx context.Context) (map[string]int, error) {
+	if err := ix.init(ctx); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Folder string `json:"folder"`
+		N      int    `json:"n"`
+	}
+	if err := ix.query(ctx, "SELECT folder, COUNT(*) AS n FROM media GROUP BY folder;", &rows); err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(rows))
+	for _, r := range rows {
+		out[r.Folder] = r.N
+	}
+	return out, nil
+}
+
+// Get returns the items with the given IDs, in index order.
+func (ix *Index) Get(ctx context.Context, ids []int64) ([]Item, error) {
+	if err := ix.init(ctx); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = fmt.Sprint(id)
+	}
+	var rows []itemRow
+	sql := fmt.Sprintf("SELECT %s FROM media WHERE id IN (%s) ORDER BY taken, path;", itemColumns, strings.Join(list, ","))
+	if err := ix.query(ctx, sql, &rows); err != nil {
+		return nil, err
+	}
+	items := make([]Item, len(rows))
+	for i, r := range rows {
+		items[i] = r.toItem()
+	}
+	return items, nil
+}
+
+// MarkUploaded records the remote media item ID of an uploaded file, so it
+// is not uploaded twice.
+func (ix *Index) MarkUploaded(ctx context.Context, id int64, remoteID string) error {
+	if err := ix.init(ctx); err != nil {
+		return err
+	}
+	return ix.query(ctx, fmt.Sprintf("UPDATE media SET uploaded_id = %s WHERE id = %d;", store.Quote(remoteID), id), nil)
+}
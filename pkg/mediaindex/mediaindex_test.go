@@ -0,0 +1,138 @@
+package mediaindex
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeJPEG(t *testing.T, path string, w, h int, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestIndex_ScanSearchAndRescan verifies files are indexed with thumbnails, searched by date and folder, and rescanned incrementally
+func TestIndex_ScanSearchAndRescan(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	ctx := context.Background()
+	card := filepath.Join(t.TempDir(), "DCIM")
+	writeJPEG(t, filepath.Join(card, "100CANON", "IMG_1.jpg"), 640, 480, time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC))
+	writeJPEG(t, filepath.Join(card, "100CANON", "IMG_2.jpg"), 32, 32, time.Date(2026, 5, 3, 10, 0, 0, 0, time.UTC))
+	writeJPEG(t, filepath.Join(card, "101CANON", "IMG_3.jpg"), 32, 32, time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC))
+	os.WriteFile(filepath.Join(card, "100CANON", "notes.txt"), []byte("x"), 0644)
+	missing := filepath.Join(t.TempDir(), "usb")
+
+	state := t.TempDir()
+	ix := New(filepath.Join(state, "index.db"), filepath.Join(state, "thumbs"), []string{card, missing})
+
+	stats, err := ix.Scan(ctx)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if stats.Added != 3 || len(stats.Offline) != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	items, err := ix.Search(ctx, Query{From: time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 5, 3, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(items) != 2 || items[0].Name != "IMG_1.jpg" || items[1].Name != "IMG_2.jpg" {
+		t.Fatalf("unexpected date search result: %+v", items)
+	}
+	thumb, err := os.Open(items[0].Thumbnail)
+	if err != nil {
+		t.Fatalf("thumbnail missing: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(thumb)
+	thumb.Close()
+	if err != nil || cfg.Width != 320 || cfg.Height != 240 {
+		t.Errorf("unexpected thumbnail %dx%d (%v)", cfg.Width, cfg.Height, err)
+	}
+
+	items, _ = ix.Search(ctx, Query{Folder: "101canon"})
+	if len(items) != 1 || items[0].Folder != "DCIM/101CANON" {
+		t.Fatalf("unexpected folder search result: %+v", items)
+	}
+	if err := ix.MarkUploaded(ctx, items[0].ID, "remote1"); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(filepath.Join(card, "100CANON", "IMG_2.jpg"))
+	stats, err = ix.Scan(ctx)
+	if err != nil {
+		t.Fatalf("rescan: %v", err)
+	}
+	if stats.Added != 0 || stats.Unchanged != 2 || stats.Removed != 1 {
+		t.Fatalf("unexpected rescan stats: %+v", stats)
+	}
+	got, _ := ix.Get(ctx, []int64{items[0].ID})
+	if len(got) != 1 || got[0].UploadedID != "remote1" {
+		t.Errorf("upload record lost on rescan: %+v", got)
+	}
+}
+
+// TestIndex_NULCannotEndTheLiteral verifies a NUL in text from a file, such
+// as a camera name, or from a search does not let SQL after it run
+func TestIndex_NULCannotEndTheLiteral(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	ctx := context.Background()
+	card := t.TempDir()
+	writeJPEG(t, filepath.Join(card, "IMG_1.jpg"), 32, 32, time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC))
+	writeJPEG(t, filepath.Join(card, "IMG_2.jpg"), 32, 32, time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC))
+	state := t.TempDir()
+	ix := New(filepath.Join(state, "index.db"), filepath.Join(state, "thumbs"), []string{card})
+	if _, err := ix.Scan(ctx); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	items, err := ix.Search(ctx, Query{})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Search = %+v, %v", items, err)
+	}
+
+	injected := "'; DELETE FROM media; --"
+	if err := ix.MarkUploaded(ctx, items[0].ID, "r\x00"+injected); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := ix.Search(ctx, Query{Folder: "x\x00' OR 1=1 --"}); err != nil || len(found) != 0 {
+		t.Errorf("folder search with a NUL = %+v, %v", found, err)
+	}
+	got, err := ix.Get(ctx, []int64{items[0].ID, items[1].ID})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("items after the update: %+v, %v", got, err)
+	}
+	for _, item := range got {
+		if item.ID == items[0].ID && item.UploadedID != "r"+injected {
+			t.Errorf("uploaded id = %q", item.UploadedID)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWriteText verifies counters, gauges and histograms render in the Prometheus text format
+func TestWriteText(t *testing.T) {
+	calls := NewCounter("test_calls_total", "Calls.", "tool", "result")
+	calls.Inc("web", "ok")
+	calls.Add(2, "web", "ok")
+	calls.Inc(`say "hi"`, "error")
+	depth := 0.0
+	NewGaugeFunc("test_queue_depth", "Queue depth.", func() float64 { return depth })
+	depth = 7
+	latency := NewHistogram("test_duration_seconds", "Latency.", []float64{0.1, 1}, "tool")
+	latency.Observe(0.05, "web")
+	latency.Observe(0.5, "web")
+	latency.Observe(3, "web")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE test_calls_total counter",
+		`test_calls_total{tool="web",result="ok"} 3`,
+		`test_calls_total{tool="say \"hi\"",result="error"} 1`,
+		"# TYPE test_queue_depth gauge\ntest_queue_depth 7",
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{tool="web",le="0.1"} 1`,
+		`test_duration_seconds_bucket{tool="web",le="1"} 2`,
+		`test_duration_seconds_bucket{tool="web",le="+Inf"} 3`,
+		`test_duration_seconds_sum{tool="web"} 3.55`,
+		`test_duration_seconds_count{tool="web"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if calls.Value("web", "ok") != 3 {
+		t.Errorf("Value = %v", calls.Value("web", "ok"))
+	}
+}
@@ -0,0 +1,113 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// GoogleVision reads images with Cloud Vision's document text detection,
+// which handles handwriting and mixed scripts that tesseract garbles. The
+// image leaves the device, so it is opt-in.
+type GoogleVision struct {
+	apiBase string
+	apiKey  string
+	hints   []string
+	client  *http.Client
+}
+
+// NewGoogleVision creates an engine using apiKey. Languages, in either
+// ISO 639-1 or tesseract codes, are passed as hints; Vision detects the
+// language without them too.
+func NewGoogleVision(apiBase, apiKey string, languages []string) *GoogleVision {
+	if apiBase == "" {
+		apiBase = "https://vision.googleapis.com/v1"
+	}
+	hints := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		if lang = isoLanguage(lang); lang != "" && lang != "osd" {
+			hints = append(hints, lang)
+		}
+	}
+	return &GoogleVision{
+		apiBase: strings.TrimRight(apiBase, "/"),
+		apiKey:  apiKey,
+		hints:   hints,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (g *GoogleVision) IsAvailable() bool {
+	return g.apiKey != ""
+}
+
+func (g *GoogleVision) Recognize(ctx context.Context, imagePath string) (string, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	request := map[string]interface{}{
+		"image":    map[string]string{"content": base64.StdEncoding.EncodeToString(data)},
+		"features": []map[string]string{{"type": "DOCUMENT_TEXT_DETECTION"}},
+	}
+	if len(g.hints) > 0 {
+		request["imageContext"] = map[string]interface{}{"languageHints": g.hints}
+	}
+	body, err := json.Marshal(map[string]interface{}{"requests": []interface{}{request}})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	target := fmt.Sprintf("%s/images:annotate?key=%s", g.apiBase, url.QueryEscape(g.apiKey))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vision request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vision API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	var out struct {
+		Responses []struct {
+			FullTextAnnotation struct {
+				Text string `json:"text"`
+			} `json:"fullTextAnnotation"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(out.Responses) == 0 {
+		return "", nil
+	}
+	if e := out.Responses[0].Error; e != nil {
+		return "", fmt.Errorf("vision API error: %s", e.Message)
+	}
+	text := Clean(out.Responses[0].FullTextAnnotation.Text)
+	logger.DebugCF("ocr", "Image recognized by Google Vision", map[string]interface{}{
+		"path":        imagePath,
+		"text_length": len(text),
+	})
+	return text, nil
+}
@@ -0,0 +1,255 @@
+// Package ocr extracts text from images received on channels so tools can
+// work with photographed documents (receipts, posters, letters).
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/governor"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Engine recognizes the text in an image file.
+type Engine interface {
+	Recognize(ctx context.Context, imagePath string) (string, error)
+	IsAvailable() bool
+}
+
+// Config selects and tunes the engine; see config.OCRConfig.
+type Config struct {
+	Backend     string   // "tesseract" (default) or "google_vision"
+	Languages   []string // ISO 639-1 or tesseract codes: "pt", "por", "zh"
+	Handwriting bool     // hand what tesseract can't read to Google Vision
+	APIKey      string   // Google Cloud Vision API key
+	APIBase     string
+}
+
+// New creates the engine cfg describes. With Handwriting, tesseract still
+// reads printed text on the device, and only images it returns no legible
+// text for go to Google Vision, which also reads handwriting.
+func New(cfg Config) Engine {
+	if cfg.Backend == "google_vision" {
+		return NewGoogleVision(cfg.APIBase, cfg.APIKey, cfg.Languages)
+	}
+	tesseract := NewTesseract(cfg.Languages)
+	if cfg.Handwriting && cfg.APIKey != "" {
+		return &Fallback{Primary: tesseract, Secondary: NewGoogleVision(cfg.APIBase, cfg.APIKey, cfg.Languages)}
+	}
+	return tesseract
+}
+
+// languageCodes maps ISO 639-1 codes to tesseract's language packs, for
+// the languages receipts and notes most often come in. Chinese defaults to
+// simplified; "zh-tw" or "chi_tra" selects traditional.
+var languageCodes = map[string]string{
+	"en": "eng", "pt": "por", "es": "spa", "fr": "fra", "de": "deu",
+	"it": "ita", "nl": "nld", "pl": "pol", "ru": "rus", "uk": "ukr",
+	"tr": "tur", "ar": "ara", "hi": "hin", "ja": "jpn", "ko": "kor",
+	"zh": "chi_sim", "zh-cn": "chi_sim", "zh-tw": "chi_tra", "vi": "vie",
+	"id": "ind", "th": "tha", "el": "ell", "he": "heb", "sv": "swe",
+}
+
+// TesseractLanguage returns the tesseract pack for an ISO 639-1 or
+// tesseract code; unknown codes pass through lowercased.
+func TesseractLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if lang, ok := languageCodes[code]; ok {
+		return lang
+	}
+	return code
+}
+
+// isoLanguage is the reverse of TesseractLanguage, for APIs that take ISO
+// codes; unknown codes pass through.
+func isoLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	switch code {
+	case "chi_sim":
+		return "zh"
+	case "chi_tra":
+		return "zh-TW"
+	}
+	for iso, lang := range languageCodes {
+		if lang == code && !strings.Contains(iso, "-") {
+			return iso
+		}
+	}
+	return code
+}
+
+// Tesseract runs the tesseract CLI. It needs no network access, which
+// keeps photographed documents on the device.
+type Tesseract struct {
+	bin       string
+	languages []string
+
+	once      sync.Once
+	installed []string // languages requested and installed
+}
+
+// NewTesseract creates an engine for the given languages, as ISO 639-1
+// codes or tesseract's own (e.g. "pt" or "por"). An empty list uses
+// tesseract's default.
+func NewTesseract(languages []string) *Tesseract {
+	langs := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		if lang = TesseractLanguage(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return &Tesseract{bin: "tesseract", languages: langs}
+}
+
+func (t *Tesseract) IsAvailable() bool {
+	_, err := exec.LookPath(t.bin)
+	return err == nil
+}
+
+// Languages returns the configured languages whose packs are installed.
+// Asking tesseract for a missing pack fails the whole image, so those are
+// left out with a warning, e.g. to apt install tesseract-ocr-por.
+func (t *Tesseract) Languages(ctx context.Context) []string {
+	t.once.Do(func() {
+		if len(t.languages) == 0 {
+			return
+		}
+		out, err := exec.CommandContext(ctx, t.bin, "--list-langs").CombinedOutput()
+		if err != nil {
+			t.installed = t.languages
+			return
+		}
+		available := map[string]bool{}
+		for _, line := range strings.Split(string(out), "\n")[1:] {
+			available[strings.TrimSpace(line)] = true
+		}
+		var missing []string
+		for _, lang := range t.languages {
+			if available[lang] {
+				t.installed = append(t.installed, lang)
+			} else {
+				missing = append(missing, lang)
+			}
+		}
+		if len(missing) > 0 {
+			logger.WarnCF("ocr", "Tesseract language packs not installed, skipping them", map[string]interface{}{
+				"missing": strings.Join(missing, ", "),
+			})
+		}
+	})
+	return t.installed
+}
+
+func (t *Tesseract) Recognize(ctx context.Context, imagePath string) (string, error) {
+	release, err := governor.Acquire(ctx, governor.OCR)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	args := []string{imagePath, "stdout"}
+	if langs := t.Languages(ctx); len(langs) > 0 {
+		args = append(args, "-l", strings.Join(langs, "+"))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text := Clean(stdout.String())
+	logger.DebugCF("ocr", "Image recognized", map[string]interface{}{
+		"path":        imagePath,
+		"text_length": len(text),
+	})
+	return text, nil
+}
+
+// Clean trims OCR output: blank lines collapse and trailing spaces go, so
+// the text is compact enough to put into a prompt.
+func Clean(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimSpace(strings.ReplaceAll(line, "\f", ""))
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// Fallback reads with Primary and turns to Secondary when Primary fails or
+// finds no legible text, as tesseract does on handwriting.
+type Fallback struct {
+	Primary, Secondary Engine
+}
+
+func (f *Fallback) IsAvailable() bool {
+	return f.Primary.IsAvailable() || f.Secondary.IsAvailable()
+}
+
+func (f *Fallback) Recognize(ctx context.Context, imagePath string) (string, error) {
+	var text string
+	err := fmt.Errorf("not available")
+	if f.Primary.IsAvailable() {
+		text, err = f.Primary.Recognize(ctx, imagePath)
+		if err == nil && Legible(text) {
+			return text, nil
+		}
+	}
+	if !f.Secondary.IsAvailable() {
+		return text, err
+	}
+	second, err2 := f.Secondary.Recognize(ctx, imagePath)
+	if err2 != nil {
+		if err == nil {
+			// Keep what the primary found rather than nothing
+			return text, nil
+		}
+		return "", err2
+	}
+	logger.DebugCF("ocr", "Image read by fallback engine", map[string]interface{}{"path": imagePath})
+	return second, nil
+}
+
+// Legible reports whether OCR output looks like text rather than the
+// noise tesseract makes of handwriting: mostly letters and digits, with at
+// least one word of two or more letters. Scripts without spaces, like Chinese,
+// count each run of letters as a word.
+func Legible(text string) bool {
+	var letters, symbols, words int
+	for _, field := range strings.Fields(text) {
+		run := 0
+		for _, r := range field {
+			switch {
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				letters++
+				if unicode.IsLetter(r) {
+					run++
+				}
+			case unicode.IsPunct(r) || unicode.IsSymbol(r):
+				symbols++
+			}
+		}
+		if run >= 2 {
+			words++
+		}
+	}
+	return words >= 1 && letters >= 3*symbols
+}
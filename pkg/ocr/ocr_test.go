@@ -0,0 +1,103 @@
+package ocr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	in := "  ACME MARKET  \r\n\n\n123 Main St\f\n   \nTOTAL   12.50 \n\n"
+	want := "ACME MARKET\n\n123 Main St\n\nTOTAL   12.50"
+	if got := Clean(in); got != want {
+		t.Errorf("Clean() = %q, want %q", got, want)
+	}
+}
+
+// TestTesseractLanguage verifies ISO codes map to tesseract packs and tesseract codes pass through
+func TestTesseractLanguage(t *testing.T) {
+	cases := map[string]string{"pt": "por", "ES": "spa", "zh": "chi_sim", "zh-TW": "chi_tra", "por": "por", "chi_sim": "chi_sim"}
+	for in, want := range cases {
+		if got := TesseractLanguage(in); got != want {
+			t.Errorf("TesseractLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := isoLanguage("por"); got != "pt" {
+		t.Errorf("isoLanguage(por) = %q, want pt", got)
+	}
+}
+
+// TestLegible verifies printed text passes and handwriting noise does not
+func TestLegible(t *testing.T) {
+	for _, text := range []string{"TOTAL 12.50", "Recibo de compra\nValor R$ 35,90", "超市 收据 合计 ¥45"} {
+		if !Legible(text) {
+			t.Errorf("Legible(%q) = false", text)
+		}
+	}
+	for _, text := range []string{"", "~ '§ ,, | — ;", "_ . ' a \\ ~"} {
+		if Legible(text) {
+			t.Errorf("Legible(%q) = true", text)
+		}
+	}
+}
+
+type fakeEngine struct {
+	text  string
+	calls int
+}
+
+func (e *fakeEngine) IsAvailable() bool { return true }
+func (e *fakeEngine) Recognize(ctx context.Context, path string) (string, error) {
+	e.calls++
+	return e.text, nil
+}
+
+// TestFallback_SendsOnlyIllegibleImagesOn verifies the secondary engine is used only when the primary reads noise
+func TestFallback_SendsOnlyIllegibleImagesOn(t *testing.T) {
+	primary, secondary := &fakeEngine{text: "Lista de compras"}, &fakeEngine{text: "leite, pão"}
+	f := &Fallback{Primary: primary, Secondary: secondary}
+	if text, _ := f.Recognize(context.Background(), "a.jpg"); text != "Lista de compras" || secondary.calls != 0 {
+		t.Errorf("printed text: got %q, secondary calls %d", text, secondary.calls)
+	}
+	primary.text = "~ '§ ,, |"
+	if text, _ := f.Recognize(context.Background(), "b.jpg"); text != "leite, pão" || secondary.calls != 1 {
+		t.Errorf("handwriting: got %q, secondary calls %d", text, secondary.calls)
+	}
+}
+
+// TestGoogleVision_SendsHintsAndReadsText verifies the annotate request carries the image and ISO language hints
+func TestGoogleVision_SendsHintsAndReadsText(t *testing.T) {
+	var got struct {
+		Requests []struct {
+			Image        struct{ Content string }
+			Features     []struct{ Type string }
+			ImageContext struct{ LanguageHints []string }
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images:annotate" || r.URL.Query().Get("key") != "k" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"responses":[{"fullTextAnnotation":{"text":"Comprar pão\n\n\nLigar mãe\n"}}]}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "note.jpg")
+	os.WriteFile(path, []byte("jpeg"), 0644)
+	text, err := NewGoogleVision(srv.URL, "k", []string{"por", "zh"}).Recognize(context.Background(), path)
+	if err != nil || text != "Comprar pão\n\nLigar mãe" {
+		t.Fatalf("Recognize() = %q, %v", text, err)
+	}
+	req := got.Requests[0]
+	if req.Features[0].Type != "DOCUMENT_TEXT_DETECTION" || req.Image.Content != "anBlZw==" ||
+		strings.Join(req.ImageContext.LanguageHints, ",") != "pt,zh" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+}
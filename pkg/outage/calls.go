@@ -0,0 +1,54 @@
+package outage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+type callsKey struct{}
+
+// Calls collects the services that failed with an outage during one tool
+// call, so the failure can be put down to them.
+type Calls struct {
+	mu     sync.Mutex
+	failed []string
+}
+
+// WithCalls returns ctx collecting the calls Record sees into the Calls
+// returned.
+func WithCalls(ctx context.Context) (context.Context, *Calls) {
+	calls := &Calls{}
+	return context.WithValue(ctx, callsKey{}, calls), calls
+}
+
+// Failed returns the services that failed, in order.
+func (c *Calls) Failed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.failed...)
+}
+
+// Record reports a call to service that was answered with status, or
+// failed with err, to the default tracker and to the Calls in ctx.
+func Record(ctx context.Context, service string, status int, err error) {
+	if IsOutage(status, err) {
+		if err == nil {
+			err = fmt.Errorf("%d %s", status, http.StatusText(status))
+		}
+		Default().Failed(service, err)
+		if calls, ok := ctx.Value(callsKey{}).(*Calls); ok {
+			calls.mu.Lock()
+			if !slices.Contains(calls.failed, service) {
+				calls.failed = append(calls.failed, service)
+			}
+			calls.mu.Unlock()
+		}
+		return
+	}
+	if err == nil {
+		Default().Succeeded(service)
+	}
+}
@@ -0,0 +1,335 @@
+// Package outage tracks whether the services picoclaw relies on (Google
+// APIs, the AI model's backend, chat channels) are up, from health probes
+// and from the answers real calls get, so a failed call can be explained
+// as an outage instead of a raw 503 and retried once the service is back.
+package outage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// downAfter is how many failures in a row, of calls or probes, mark a
+// service down, so one stray 503 does not.
+const downAfter = 2
+
+// confirmWithin is how recent a probe must be for Confirm to trust it
+// instead of probing again.
+const confirmWithin = 30 * time.Second
+
+// Probe checks a service, returning an error when it is down.
+type Probe func(ctx context.Context) error
+
+// Status is the tracker's view of one service.
+type Status struct {
+	Service string    `json:"service"`
+	Up      bool      `json:"up"`
+	Since   time.Time `json:"since"` // when the current state began
+	Checked time.Time `json:"checked"`
+	// LastError is the failure that marked the service down
+	LastError string `json:"last_error,omitempty"`
+}
+
+type service struct {
+	status   Status
+	failures int // failures in a row
+	probe    Probe
+	probed   time.Time // when probe last ran
+}
+
+// Tracker keeps the status of each service it was told about. Services
+// start up; a success marks one up again at once.
+type Tracker struct {
+	timeout time.Duration
+	// online, when set, says whether the internet is reachable; while it
+	// is not, failures say nothing about any one service
+	online func() bool
+
+	mu        sync.Mutex
+	services  map[string]*service
+	listeners []func(service string, up bool)
+
+	kick chan struct{}
+}
+
+func New() *Tracker {
+	return &Tracker{
+		timeout:  10 * time.Second,
+		services: make(map[string]*service),
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// SetOnline sets how the tracker tells a lost connection from an outage.
+func (t *Tracker) SetOnline(online func() bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.online = online
+}
+
+// Watch adds name with the probe that checks it, or replaces its probe.
+// probe may be nil for services only known from their calls.
+func (t *Tracker) Watch(name string, probe Probe) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.serviceLocked(name).probe = probe
+}
+
+// Watching reports whether name was added.
+func (t *Tracker) Watching(name string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.services[name]
+	return ok
+}
+
+func (t *Tracker) serviceLocked(name string) *service {
+	s, ok := t.services[name]
+	if !ok {
+		s = &service{status: Status{Service: name, Up: true, Since: time.Now()}}
+		t.services[name] = s
+	}
+	return s
+}
+
+// OnChange calls fn whenever a service goes down or comes back.
+func (t *Tracker) OnChange(fn func(service string, up bool)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, fn)
+}
+
+// Succeeded records that a call to name worked.
+func (t *Tracker) Succeeded(name string) {
+	if t != nil {
+		t.record(name, nil)
+	}
+}
+
+// Failed records that a call to name failed with an outage error, and
+// asks for a probe soon.
+func (t *Tracker) Failed(name string, err error) {
+	if t == nil {
+		return
+	}
+	t.record(name, err)
+	select {
+	case t.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Down reports whether name is down and since when.
+func (t *Tracker) Down(name string) (bool, time.Time) {
+	if t == nil {
+		return false, time.Time{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.services[name]
+	if !ok || s.status.Up {
+		return false, time.Time{}
+	}
+	return true, s.status.Since
+}
+
+// Confirm probes name unless it was probed in the last seconds, after a
+// call to it failed, and reports whether it is down and since when.
+func (t *Tracker) Confirm(ctx context.Context, name string) (bool, time.Time) {
+	if t == nil {
+		return false, time.Time{}
+	}
+	t.mu.Lock()
+	s, ok := t.services[name]
+	var probe Probe
+	if ok && s.status.Up && time.Since(s.probed) > confirmWithin {
+		probe = s.probe
+		s.probed = time.Now()
+	}
+	t.mu.Unlock()
+	if probe != nil {
+		t.record(name, t.run(ctx, probe))
+	}
+	return t.Down(name)
+}
+
+// Statuses returns every service's status, by name.
+func (t *Tracker) Statuses() []Status {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Status, 0, len(t.services))
+	for _, s := range t.services {
+		out = append(out, s.status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out
+}
+
+// Check probes every service with a probe now.
+func (t *Tracker) Check(ctx context.Context) {
+	t.check(ctx, false)
+}
+
+// check probes the services with a probe, only those down when onlyDown.
+func (t *Tracker) check(ctx context.Context, onlyDown bool) {
+	t.mu.Lock()
+	probes := make(map[string]Probe)
+	for name, s := range t.services {
+		if s.probe != nil && (!onlyDown || !s.status.Up) {
+			probes[name] = s.probe
+			s.probed = time.Now()
+		}
+	}
+	t.mu.Unlock()
+	for name, probe := range probes {
+		t.record(name, t.run(ctx, probe))
+	}
+}
+
+func (t *Tracker) run(ctx context.Context, probe Probe) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return probe(ctx)
+}
+
+// Run probes every service each interval, and those down every
+// interval/4 and soon after a failed call, until ctx is done.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	fast := time.NewTicker(interval / 4)
+	defer fast.Stop()
+	next := time.Now().Add(interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.kick:
+			t.check(ctx, false)
+		case now := <-fast.C:
+			full := !now.Before(next)
+			if full {
+				next = now.Add(interval)
+			}
+			t.check(ctx, !full)
+		}
+	}
+}
+
+func (t *Tracker) record(name string, err error) {
+	t.mu.Lock()
+	if err != nil && t.online != nil && !t.online() {
+		t.mu.Unlock()
+		return
+	}
+	s := t.serviceLocked(name)
+	s.status.Checked = time.Now()
+	changed := false
+	if err == nil {
+		s.failures = 0
+		changed = !s.status.Up
+		s.status.LastError = ""
+	} else {
+		s.failures++
+		changed = s.status.Up && s.failures >= downAfter
+		if s.status.Up {
+			s.status.LastError = describe(err)
+		}
+	}
+	if changed {
+		s.status.Up = !s.status.Up
+		s.status.Since = time.Now()
+	}
+	up, lastError := s.status.Up, s.status.LastError
+	listeners := append([]func(string, bool){}, t.listeners...)
+	t.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if up {
+		logger.InfoCF("outage", "Service is back", map[string]interface{}{"service": name})
+	} else {
+		logger.WarnCF("outage", "Service appears to be down", map[string]interface{}{"service": name, "error": lastError})
+	}
+	for _, fn := range listeners {
+		fn(name, up)
+	}
+}
+
+// describe shortens err for status lines.
+func describe(err error) string {
+	msg := strings.Join(strings.Fields(err.Error()), " ")
+	if len(msg) > 120 {
+		msg = msg[:120] + "..."
+	}
+	return msg
+}
+
+// IsOutage reports whether an answer with status, or err when the call
+// got none, means the service is down rather than that the request was
+// wrong: no connection to it, a timeout, or a 500, 502, 503 or 504.
+// Cancelled calls are neither.
+func IsOutage(status int, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || IsOutageMessage(err.Error())
+	}
+	switch status {
+	case 500, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// IsOutageMessage reports whether an error message, from a client that
+// only gives text, names a server failure or an unreachable host.
+func IsOutageMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, s := range []string{
+		"status: 500", "status: 502", "status: 503", "status: 504", "status 500", "status 502", "status 503", "status 504",
+		"(500)", "(502)", "(503)", "(504)", "internal server error", "bad gateway", "service unavailable", "gateway timeout",
+		"overloaded", "dial tcp", "no such host", "connection refused", "i/o timeout", "connection reset",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	defaultMu sync.RWMutex
+	current   *Tracker
+)
+
+// SetDefault makes t the tracker Record reports to.
+func SetDefault(t *Tracker) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	current = t
+}
+
+// Default returns the tracker Record reports to, nil when none is set.
+func Default() *Tracker {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return current
+}
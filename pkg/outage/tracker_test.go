@@ -0,0 +1,49 @@
+package outage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestTracker_DownAfterRepeatedFailuresAndBackOnSuccess verifies one failure is tolerated, a failed probe confirms the outage, and a success ends it
+func TestTracker_DownAfterRepeatedFailuresAndBackOnSuccess(t *testing.T) {
+	healthy := false
+	tracker := New()
+	tracker.Watch("Gmail", func(ctx context.Context) error {
+		if healthy {
+			return nil
+		}
+		return errors.New("503 Service Unavailable")
+	})
+	var changes []bool
+	tracker.OnChange(func(service string, up bool) { changes = append(changes, up) })
+	SetDefault(tracker)
+	t.Cleanup(func() { SetDefault(nil) })
+
+	ctx, calls := WithCalls(context.Background())
+	Record(ctx, "Gmail", 404, nil)
+	Record(ctx, "Gmail", 503, nil)
+	if down, _ := tracker.Down("Gmail"); down {
+		t.Fatal("down after a single 503")
+	}
+	if failed := calls.Failed(); len(failed) != 1 || failed[0] != "Gmail" {
+		t.Fatalf("failed = %v", failed)
+	}
+	if down, since := tracker.Confirm(ctx, "Gmail"); !down || since.IsZero() {
+		t.Fatal("a failed probe should confirm the outage")
+	}
+	if s := tracker.Statuses(); len(s) != 1 || s[0].Up || s[0].LastError != "503 Service Unavailable" {
+		t.Errorf("statuses = %+v", s)
+	}
+
+	Record(ctx, "Gmail", 0, context.Canceled)
+	healthy = true
+	tracker.Check(ctx)
+	if down, _ := tracker.Down("Gmail"); down || len(changes) != 2 || changes[0] || !changes[1] {
+		t.Errorf("down = %v, changes = %v, want down then up", down, changes)
+	}
+	if IsOutage(0, errors.New("401: invalid API token")) {
+		t.Error("an auth error is not an outage")
+	}
+}
@@ -0,0 +1,237 @@
+// Package profile stores per-conversation user preferences: timezone,
+// locale, preferred language, quiet hours and how replies are written.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// Profile holds the preferences of the user behind one channel:chat_id.
+// Zero values mean "not set"; callers fall back to server defaults.
+type Profile struct {
+	// Timezone is an IANA name such as "America/Sao_Paulo"
+	Timezone string `json:"timezone,omitempty"`
+
+	// Locale is a BCP 47 tag such as "pt-BR", used for number and date formatting
+	Locale string `json:"locale,omitempty"`
+
+	// Language is the language replies should be written in, e.g. "Portuguese"
+	Language string `json:"language,omitempty"`
+
+	// FixedLanguage keeps replies in Language even when the user writes in
+	// another one; otherwise each reply follows the user's last message
+	FixedLanguage bool `json:"fixed_language,omitempty"`
+
+	// QuietStart and QuietEnd bound the quiet hours as "HH:MM" in the
+	// profile's timezone. The window may wrap midnight (22:00-07:00).
+	QuietStart string `json:"quiet_start,omitempty"`
+	QuietEnd   string `json:"quiet_end,omitempty"`
+
+	// Verbosity is "concise" or "detailed"; empty for normal replies
+	Verbosity string `json:"verbosity,omitempty"`
+
+	// NoEmoji keeps emoji out of replies and tool messages
+	NoEmoji bool `json:"no_emoji,omitempty"`
+
+	// Clock is "12h" or "24h"; empty follows the locale
+	Clock string `json:"clock,omitempty"`
+
+	// Units is "metric" or "imperial"; empty follows the locale
+	Units string `json:"units,omitempty"`
+}
+
+// IsZero reports whether no preference is set.
+func (p Profile) IsZero() bool {
+	return p == Profile{}
+}
+
+// Location returns the profile's timezone, or the server's local timezone
+// when unset or invalid.
+func (p Profile) Location() *time.Location {
+	if p.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// FormatLocale returns the locale to format dates, times and measures in
+// for the user: Locale with their clock and units preferences.
+func (p Profile) FormatLocale() string {
+	return locale.WithPreferences(p.Locale, p.Clock, p.Units)
+}
+
+// Validate checks that the timezone and quiet hours can be interpreted,
+// that a fixed language names one and that the style preferences are known.
+func (p Profile) Validate() error {
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q (use an IANA name like Europe/Berlin)", p.Timezone)
+		}
+	}
+	if p.FixedLanguage && p.Language == "" {
+		return fmt.Errorf("a fixed language needs the language to reply in")
+	}
+	for _, pref := range []struct{ name, value, allowed string }{
+		{"verbosity", p.Verbosity, "concise|detailed"},
+		{"clock", p.Clock, "12h|24h"},
+		{"units", p.Units, "metric|imperial"},
+	} {
+		if pref.value != "" && !slices.Contains(strings.Split(pref.allowed, "|"), pref.value) {
+			return fmt.Errorf("%s must be %s, got %q", pref.name, strings.ReplaceAll(pref.allowed, "|", " or "), pref.value)
+		}
+	}
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		return fmt.Errorf("quiet hours need both a start and an end")
+	}
+	if p.QuietStart != "" {
+		if _, err := parseClock(p.QuietStart); err != nil {
+			return err
+		}
+		if _, err := parseClock(p.QuietEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuietUntil reports whether t falls inside the quiet hours and, if so,
+// when they end.
+func (p Profile) QuietUntil(t time.Time) (time.Time, bool) {
+	start, err1 := parseClock(p.QuietStart)
+	end, err2 := parseClock(p.QuietEnd)
+	if err1 != nil || err2 != nil || start == end {
+		return time.Time{}, false
+	}
+
+	local := t.In(p.Location())
+	minute := local.Hour()*60 + local.Minute()
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	endToday := midnight.Add(time.Duration(end) * time.Minute)
+
+	if start < end {
+		if minute >= start && minute < end {
+			return endToday, true
+		}
+		return time.Time{}, false
+	}
+
+	// Window wraps midnight, e.g. 22:00-07:00
+	switch {
+	case minute >= start:
+		return endToday.AddDate(0, 0, 1), true
+	case minute < end:
+		return endToday, true
+	}
+	return time.Time{}, false
+}
+
+// parseClock converts "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Store persists profiles keyed by "channel:chat_id".
+type Store struct {
+	path     string
+	mu       sync.RWMutex
+	profiles map[string]Profile
+	resolve  func(chatKey string) string
+}
+
+// NewStore loads the profiles saved in the workspace state directory.
+func NewStore(workspace string) *Store {
+	s := &Store{
+		path:     filepath.Join(workspace, "state", "profiles.json"),
+		profiles: make(map[string]Profile),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.profiles)
+	}
+	return s
+}
+
+// SetResolver maps conversations to the key their profile is kept under,
+// so accounts linked to one person share a profile.
+func (s *Store) SetResolver(resolve func(chatKey string) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolve = resolve
+}
+
+func (s *Store) keyLocked(chatKey string) string {
+	if s.resolve == nil {
+		return chatKey
+	}
+	return s.resolve(chatKey)
+}
+
+// Get returns the profile for a conversation, or the zero profile.
+func (s *Store) Get(chatKey string) Profile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.profiles[s.keyLocked(chatKey)]
+}
+
+// Set validates and saves the profile for a conversation.
+func (s *Store) Set(chatKey string, p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chatKey = s.keyLocked(chatKey)
+	if p.IsZero() {
+		delete(s.profiles, chatKey)
+	} else {
+		s.profiles[chatKey] = p
+	}
+	return s.saveLocked()
+}
+
+// QuietUntil reports whether the conversation is in its quiet hours at t.
+// A nil store never is, so callers can use it unconditionally.
+func (s *Store) QuietUntil(chatKey string, t time.Time) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	return s.Get(chatKey).QuietUntil(t)
+}
+
+// saveLocked writes the profiles with temp file + rename so a crash never
+// leaves a truncated file. Must be called with the lock held.
+func (s *Store) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s.profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profiles: %w", err)
+	}
+	tempFile := s.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, s.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
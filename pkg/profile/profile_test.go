@@ -0,0 +1,74 @@
+package profile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietUntil_WrapsMidnight(t *testing.T) {
+	p := Profile{Timezone: "America/Sao_Paulo", QuietStart: "22:00", QuietEnd: "07:00"}
+	loc := p.Location()
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		quiet bool
+		until time.Time
+	}{
+		{"evening", time.Date(2026, 3, 10, 23, 30, 0, 0, loc), true, time.Date(2026, 3, 11, 7, 0, 0, 0, loc)},
+		{"early morning", time.Date(2026, 3, 11, 5, 0, 0, 0, loc), true, time.Date(2026, 3, 11, 7, 0, 0, 0, loc)},
+		{"end is exclusive", time.Date(2026, 3, 11, 7, 0, 0, 0, loc), false, time.Time{}},
+		{"daytime", time.Date(2026, 3, 11, 12, 0, 0, 0, loc), false, time.Time{}},
+		// 01:00 UTC is 22:00 in São Paulo
+		{"other timezone input", time.Date(2026, 3, 11, 1, 0, 0, 0, time.UTC), true, time.Date(2026, 3, 11, 7, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := p.QuietUntil(tt.at)
+			if quiet != tt.quiet {
+				t.Fatalf("QuietUntil(%v) quiet = %v, want %v", tt.at, quiet, tt.quiet)
+			}
+			if quiet && !until.Equal(tt.until) {
+				t.Errorf("QuietUntil(%v) = %v, want %v", tt.at, until, tt.until)
+			}
+		})
+	}
+}
+
+func TestQuietUntil_SameDayWindow(t *testing.T) {
+	p := Profile{Timezone: "UTC", QuietStart: "13:00", QuietEnd: "14:00"}
+	if _, quiet := p.QuietUntil(time.Date(2026, 1, 1, 12, 59, 0, 0, time.UTC)); quiet {
+		t.Error("12:59 should not be quiet")
+	}
+	until, quiet := p.QuietUntil(time.Date(2026, 1, 1, 13, 15, 0, 0, time.UTC))
+	if !quiet || until.Hour() != 14 {
+		t.Errorf("13:15 should be quiet until 14:00, got %v %v", until, quiet)
+	}
+}
+
+func TestStore_SetValidatesAndPersists(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir)
+
+	if err := s.Set("telegram:1", Profile{Timezone: "Mars/Olympus"}); err == nil {
+		t.Error("expected invalid timezone to be rejected")
+	}
+	if err := s.Set("telegram:1", Profile{QuietStart: "22:00"}); err == nil {
+		t.Error("expected half-open quiet hours to be rejected")
+	}
+
+	want := Profile{Timezone: "Europe/Berlin", Locale: "de-DE", Language: "German", QuietStart: "23:00", QuietEnd: "06:30"}
+	if err := s.Set("telegram:1", want); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if got := NewStore(dir).Get("telegram:1"); got != want {
+		t.Errorf("reloaded profile = %+v, want %+v", got, want)
+	}
+
+	var nilStore *Store
+	if _, quiet := nilStore.QuietUntil("telegram:1", time.Now()); quiet {
+		t.Error("nil store must never be quiet")
+	}
+}
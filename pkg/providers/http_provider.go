@@ -193,6 +193,30 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 	}, nil
 }
 
+// CheckHealth lists the backend's models: any answer but a server error
+// means it is up, even a 401 from a key that lacks the permission.
+func (p *HTTPProvider) CheckHealth(ctx context.Context) error {
+	if p.apiBase == "" {
+		return fmt.Errorf("API base not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", p.apiBase+"/models", nil)
+	if err != nil {
+		return err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func (p *HTTPProvider) GetDefaultModel() string {
 	return ""
 }
@@ -40,6 +40,12 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// HealthChecker is implemented by providers that can check their backend
+// is up without a paid request.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
 type ToolDefinition struct {
 	Type     string                 `json:"type"`
 	Function ToolFunctionDefinition `json:"function"`
@@ -0,0 +1,63 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// recordingProvider records the answers of a provider into the round of
+// the context it is called with.
+type recordingProvider struct {
+	providers.LLMProvider
+}
+
+// Record wraps p so that its answers are recorded into the round being
+// recorded, if any, when it is called with that round's context.
+func Record(p providers.LLMProvider) providers.LLMProvider {
+	return recordingProvider{p}
+}
+
+func (p recordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	resp, err := p.LLMProvider.Chat(ctx, messages, tools, model, options)
+	if err == nil {
+		FromContext(ctx).AddResponse(model, resp)
+	}
+	return resp, err
+}
+
+// Provider plays back the model's side of a round: each call gets the
+// next recorded response, whatever it asks.
+type Provider struct {
+	mu        sync.Mutex
+	responses []Response
+	next      int
+}
+
+func NewProvider(round *Round) *Provider {
+	return &Provider{responses: round.Responses}
+}
+
+func (p *Provider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next >= len(p.responses) {
+		return nil, fmt.Errorf("replay: the model was asked more than the %d times recorded", len(p.responses))
+	}
+	r := p.responses[p.next]
+	p.next++
+	return &providers.LLMResponse{Content: r.Content, ToolCalls: r.ToolCalls, FinishReason: "stop"}, nil
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return "replay"
+}
+
+// Unused is the number of recorded responses nobody asked for.
+func (p *Provider) Unused() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.responses) - p.next
+}
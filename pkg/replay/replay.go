@@ -0,0 +1,245 @@
+// Package replay records agent rounds (the user message, every model
+// response, every tool call with its result and HTTP traffic) to one JSON
+// file per round, and checks a re-run of such a round against the
+// recording. A round from a bug report becomes a regression test: the
+// model's side is scripted from the recording and the tools' requests are
+// answered from it, so only picoclaw's own code runs for real.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/httprec"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Version is the format of the rounds Recorder writes.
+const Version = 1
+
+// Round is one recorded agent round.
+type Round struct {
+	Version  int       `json:"version"`
+	Started  time.Time `json:"started"`
+	Channel  string    `json:"channel"`
+	ChatID   string    `json:"chat_id"`
+	SenderID string    `json:"sender_id,omitempty"`
+	Message  string    `json:"message"`
+	// Responses are the model's answers, in the order they came, including
+	// those to tools that call the model themselves
+	Responses []Response `json:"responses"`
+	Calls     []ToolCall `json:"calls"`
+	Reply     string     `json:"reply"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Response is one answer from the model.
+type Response struct {
+	Model     string               `json:"model"`
+	Content   string               `json:"content"`
+	ToolCalls []providers.ToolCall `json:"tool_calls,omitempty"`
+}
+
+// ToolCall is one tool call and what came of it.
+type ToolCall struct {
+	Tool    string                 `json:"tool"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Result  string                 `json:"result"`
+	IsError bool                   `json:"is_error,omitempty"`
+	// Media are the files the call produced for the user
+	Media     []string           `json:"media,omitempty"`
+	Exchanges []httprec.Exchange `json:"exchanges,omitempty"`
+}
+
+// Load reads a round written by a Recorder.
+func Load(path string) (*Round, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Round
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if r.Version > Version {
+		return nil, fmt.Errorf("%s: round format %d is newer than this picoclaw (%d)", path, r.Version, Version)
+	}
+	return &r, nil
+}
+
+// Exchanges returns the HTTP exchanges of all the round's tool calls, in
+// order, to answer a re-run's requests with.
+func (r *Round) Exchanges() []httprec.Exchange {
+	var all []httprec.Exchange
+	for _, c := range r.Calls {
+		all = append(all, c.Exchanges...)
+	}
+	return all
+}
+
+// Recorder collects a round as it runs. All its methods are nil-safe, so
+// callers need not check whether recording is on.
+type Recorder struct {
+	mu    sync.Mutex
+	dir   string
+	round Round
+}
+
+type recorderKey struct{}
+
+// Start begins recording a round and returns the context the round must
+// run with. Save writes it to dir; with dir empty the round is only kept
+// in memory, for Round.
+func Start(ctx context.Context, dir, channel, chatID, senderID, message string) (context.Context, *Recorder) {
+	r := &Recorder{dir: dir, round: Round{
+		Version:  Version,
+		Started:  time.Now(),
+		Channel:  channel,
+		ChatID:   chatID,
+		SenderID: senderID,
+		Message:  message,
+	}}
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+// FromContext returns the round being recorded, or nil.
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+// AddResponse records an answer from the model.
+func (r *Recorder) AddResponse(model string, resp *providers.LLMResponse) {
+	if r == nil || resp == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.round.Responses = append(r.round.Responses, Response{Model: model, Content: resp.Content, ToolCalls: resp.ToolCalls})
+}
+
+// AddToolCall records a tool call, its result, the files it produced and
+// the requests it made.
+func (r *Recorder) AddToolCall(tool string, args map[string]interface{}, result string, isError bool, media []string, exchanges []httprec.Exchange) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.round.Calls = append(r.round.Calls, ToolCall{Tool: tool, Args: args, Result: result, IsError: isError, Media: media, Exchanges: exchanges})
+}
+
+// Finish records how the round ended.
+func (r *Recorder) Finish(reply string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.round.Reply = reply
+	if err != nil {
+		r.round.Error = err.Error()
+	}
+}
+
+// Round returns a copy of what has been recorded so far.
+func (r *Recorder) Round() *Round {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	round := r.round
+	return &round
+}
+
+// Save writes the round to its directory, named after the time it started
+// and its channel, and returns the file written. Rounds without a tool
+// call are not worth a file and are skipped.
+func (r *Recorder) Save() (string, error) {
+	if r == nil || r.dir == "" {
+		return "", nil
+	}
+	round := r.Round()
+	if len(round.Calls) == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(round, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("%s-%s.json", round.Started.Format("20060102-150405.000"), safeName(round.Channel)))
+	return path, os.WriteFile(path, data, 0600)
+}
+
+func safeName(s string) string {
+	out := []rune(s)
+	for i, c := range out {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
+
+// Compare lists how a re-run differs from the recording: tool calls made
+// with other arguments or giving other results, calls missing or added,
+// and another reply. Nothing listed means the re-run matched.
+func Compare(recorded, rerun *Round) []string {
+	var diffs []string
+	n := max(len(recorded.Calls), len(rerun.Calls))
+	for i := 0; i < n; i++ {
+		switch {
+		case i >= len(rerun.Calls):
+			diffs = append(diffs, fmt.Sprintf("call %d: %s was not made", i+1, recorded.Calls[i].Tool))
+		case i >= len(recorded.Calls):
+			diffs = append(diffs, fmt.Sprintf("call %d: %s was not in the recording", i+1, rerun.Calls[i].Tool))
+		default:
+			want, got := recorded.Calls[i], rerun.Calls[i]
+			if want.Tool != got.Tool {
+				diffs = append(diffs, fmt.Sprintf("call %d: %s instead of %s", i+1, got.Tool, want.Tool))
+				continue
+			}
+			if !sameJSON(want.Args, got.Args) {
+				diffs = append(diffs, fmt.Sprintf("call %d (%s): arguments differ\n  recorded: %s\n  now:      %s", i+1, want.Tool, toJSON(want.Args), toJSON(got.Args)))
+			}
+			if want.IsError != got.IsError || want.Result != got.Result {
+				diffs = append(diffs, fmt.Sprintf("call %d (%s): result differs\n  recorded: %s\n  now:      %s", i+1, want.Tool, describe(want), describe(got)))
+			}
+		}
+	}
+	if recorded.Reply != rerun.Reply {
+		diffs = append(diffs, fmt.Sprintf("reply differs\n  recorded: %q\n  now:      %q", recorded.Reply, rerun.Reply))
+	}
+	if recorded.Error != rerun.Error {
+		diffs = append(diffs, fmt.Sprintf("error differs\n  recorded: %q\n  now:      %q", recorded.Error, rerun.Error))
+	}
+	return diffs
+}
+
+// sameJSON compares values the way they would be after a JSON round
+// trip, so a recorded 3 (float64) equals a live 3 (int).
+func sameJSON(a, b interface{}) bool {
+	var x, y interface{}
+	json.Unmarshal([]byte(toJSON(a)), &x)
+	json.Unmarshal([]byte(toJSON(b)), &y)
+	return reflect.DeepEqual(x, y)
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func describe(c ToolCall) string {
+	if c.IsError {
+		return "error: " + c.Result
+	}
+	return c.Result
+}
@@ -0,0 +1,70 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestRecorder_SavesOnlyRoundsWithToolCalls verifies rounds are saved and loaded intact, and chit-chat leaves no file
+func TestRecorder_SavesOnlyRoundsWithToolCalls(t *testing.T) {
+	dir := t.TempDir()
+	_, rec := Start(context.Background(), dir, "telegram", "7", "7", "hello")
+	rec.Finish("hi!", nil)
+	if path, err := rec.Save(); path != "" || err != nil {
+		t.Errorf("chit-chat saved to %q, %v", path, err)
+	}
+
+	ctx, rec := Start(context.Background(), dir, "telegram", "7", "7", "2+2?")
+	provider := Record(NewProvider(&Round{Responses: []Response{{Content: "4"}}}))
+	provider.Chat(ctx, nil, nil, "m", nil)
+	FromContext(ctx).AddToolCall("calculator", map[string]interface{}{"expression": "2+2"}, "4", false, nil, nil)
+	rec.Finish("", errors.New("boom"))
+	path, err := rec.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	round, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.Message != "2+2?" || len(round.Responses) != 1 || round.Responses[0].Model != "m" || round.Calls[0].Tool != "calculator" || round.Error != "boom" {
+		t.Errorf("loaded %+v", round)
+	}
+	if _, err := provider.Chat(ctx, nil, nil, "m", nil); err == nil {
+		t.Error("provider answered past the recording")
+	}
+}
+
+// TestCompare_ReportsDifferences verifies numbers compare across JSON types and changed, missing and added calls are listed
+func TestCompare_ReportsDifferences(t *testing.T) {
+	recorded := &Round{
+		Calls: []ToolCall{
+			{Tool: "calendar", Args: map[string]interface{}{"days": float64(3)}, Result: "2 events"},
+			{Tool: "gmail", Result: "sent"},
+		},
+		Reply: "done",
+	}
+	same := &Round{
+		Calls: []ToolCall{
+			{Tool: "calendar", Args: map[string]interface{}{"days": 3}, Result: "2 events"},
+			{Tool: "gmail", Result: "sent"},
+		},
+		Reply: "done",
+	}
+	if diffs := Compare(recorded, same); len(diffs) != 0 {
+		t.Errorf("identical rounds differ: %v", diffs)
+	}
+
+	changed := &Round{
+		Calls: []ToolCall{
+			{Tool: "calendar", Args: map[string]interface{}{"days": 3}, Result: "error", IsError: true},
+		},
+		Reply: "done",
+	}
+	diffs := Compare(recorded, changed)
+	if len(diffs) != 2 || !strings.Contains(diffs[0], "error: error") || !strings.Contains(diffs[1], "gmail was not made") {
+		t.Errorf("diffs = %v", diffs)
+	}
+}
@@ -0,0 +1,239 @@
+// Package screening decides whether an email attachment may leave the
+// mailbox, before picoclaw saves it to disk, uploads it to Drive or copies
+// it elsewhere. The checks are what a deployment configures: a size cap,
+// blocked or allowed file extensions, and optionally a ClamAV daemon and a
+// VirusTotal lookup of the file's SHA-256 hash. Gmail already refuses most
+// executables, but not archives that hide them, nor scripts it does not
+// know; on a shared gateway a file the model was talked into saving lands
+// next to everything else.
+package screening
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// virusTotalURL is where file hashes are looked up; tests point it at a
+// fake.
+var virusTotalURL = "https://www.virustotal.com/api/v3/files/"
+
+// Policy is what an attachment is screened against.
+type Policy struct {
+	// MaxBytes holds back larger attachments; 0 means no limit
+	MaxBytes int64
+	// Block are extensions (".exe") that are held back
+	Block []string
+	// Allow, when not empty, is the only extensions let through
+	Allow []string
+	// ClamAV is the clamd socket contents are scanned with: a path or
+	// "unix:<path>" for a Unix socket, otherwise host:port; "" for none
+	ClamAV string
+	// VirusTotalKey looks files up on VirusTotal by hash; "" for none
+	VirusTotalKey string
+}
+
+var (
+	mu     sync.RWMutex
+	policy Policy
+)
+
+// SetPolicy replaces the policy of every check from now on.
+func SetPolicy(p Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+}
+
+// Current returns the policy in force.
+func Current() Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return policy
+}
+
+// Scans reports whether contents are scanned, so callers that stream an
+// attachment know to have all of it at hand before passing it on.
+func (p Policy) Scans() bool {
+	return p.ClamAV != "" || p.VirusTotalKey != ""
+}
+
+// BlockedError is an attachment the policy held back.
+type BlockedError struct {
+	Name   string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s was held back by the attachment screening: %s", e.Name, e.Reason)
+}
+
+// Check screens an attachment by its name and size, before it is
+// downloaded. size is -1 when unknown.
+func Check(name string, size int64) error {
+	p := Current()
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case len(p.Allow) > 0 && !hasExt(p.Allow, ext):
+		return &BlockedError{Name: name, Reason: fmt.Sprintf("only %s files are allowed", strings.Join(p.Allow, ", "))}
+	case ext != "" && hasExt(p.Block, ext):
+		return &BlockedError{Name: name, Reason: ext + " files are blocked"}
+	case p.MaxBytes > 0 && size > p.MaxBytes:
+		return &BlockedError{Name: name, Reason: fmt.Sprintf("it is larger than the %d MB limit", p.MaxBytes>>20)}
+	}
+	return nil
+}
+
+func hasExt(exts []string, ext string) bool {
+	for _, e := range exts {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan screens the contents of an attachment, read from r to the end:
+// they are streamed to ClamAV and their hash looked up on VirusTotal, as
+// configured. A scanner that cannot be reached holds the file back too,
+// since the deployment asked for it to be scanned.
+func Scan(ctx context.Context, name string, r io.Reader) error {
+	p := Current()
+	if !p.Scans() {
+		return nil
+	}
+	hash := sha256.New()
+	r = io.TeeReader(r, hash)
+	if p.ClamAV != "" {
+		found, err := clamScan(ctx, p.ClamAV, r)
+		if err != nil {
+			return &BlockedError{Name: name, Reason: "the virus scanner failed: " + err.Error()}
+		}
+		if found != "" {
+			return &BlockedError{Name: name, Reason: "ClamAV found " + found}
+		}
+	} else if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	if p.VirusTotalKey != "" {
+		flagged, err := virusTotalLookup(ctx, p.VirusTotalKey, hex.EncodeToString(hash.Sum(nil)))
+		if err != nil {
+			return &BlockedError{Name: name, Reason: "the VirusTotal lookup failed: " + err.Error()}
+		}
+		if flagged > 0 {
+			return &BlockedError{Name: name, Reason: fmt.Sprintf("VirusTotal lists it as malicious (%d engines)", flagged)}
+		}
+	}
+	return nil
+}
+
+// clamScan streams r to clamd with INSTREAM and returns the signature it
+// found, "" for none.
+func clamScan(ctx context.Context, addr string, r io.Reader) (string, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") || strings.HasPrefix(addr, "/") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 32<<10)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := conn.Write(size); werr != nil {
+				return "", werr
+			}
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				return "", werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(conn, 4<<10))
+	if err != nil && len(reply) == 0 {
+		return "", err
+	}
+	// "stream: OK", "stream: Eicar-Signature FOUND" or "... ERROR"
+	answer := strings.TrimSpace(strings.TrimRight(string(reply), "\x00"))
+	answer = strings.TrimSpace(strings.TrimPrefix(answer, "stream:"))
+	switch {
+	case answer == "OK":
+		return "", nil
+	case strings.HasSuffix(answer, " FOUND"):
+		return strings.TrimSuffix(answer, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd: %s", answer)
+}
+
+// virusTotalLookup returns how many engines flag the file with hash as
+// malicious; a file VirusTotal has never seen counts as clean.
+func virusTotalLookup(ctx context.Context, key, hash string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, virusTotalURL+hash, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("x-apikey", key)
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("VirusTotal answered %s", resp.Status)
+	}
+	var report struct {
+		Data struct {
+			Attributes struct {
+				Stats struct {
+					Malicious int `json:"malicious"`
+				} `json:"last_analysis_stats"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return 0, fmt.Errorf("unexpected VirusTotal answer: %w", err)
+	}
+	return report.Data.Attributes.Stats.Malicious, nil
+}
@@ -0,0 +1,144 @@
+package screening
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func usePolicy(t *testing.T, p Policy) {
+	previous := Current()
+	SetPolicy(p)
+	t.Cleanup(func() { SetPolicy(previous) })
+}
+
+// TestCheck_ExtensionsAndSize verifies attachments are held back by blocked extension, by a missing allowed one and by size, and others pass
+func TestCheck_ExtensionsAndSize(t *testing.T) {
+	usePolicy(t, Policy{MaxBytes: 10 << 20, Block: []string{".exe", "js"}})
+	cases := map[string]bool{
+		"invoice.pdf":     true,
+		"setup.EXE":       false,
+		"invoice.pdf.exe": false,
+		"run.js":          false,
+		"README":          true,
+	}
+	for name, ok := range cases {
+		if err := Check(name, 1<<20); (err == nil) != ok {
+			t.Errorf("Check(%s) = %v, want allowed=%v", name, err, ok)
+		}
+	}
+	var blocked *BlockedError
+	if err := Check("video.mp4", 11<<20); !errors.As(err, &blocked) || !strings.Contains(blocked.Reason, "10 MB") {
+		t.Errorf("large attachment not held back: %v", err)
+	}
+	if err := Check("video.mp4", -1); err != nil {
+		t.Errorf("attachment of unknown size held back: %v", err)
+	}
+
+	usePolicy(t, Policy{Allow: []string{".pdf", ".jpg"}})
+	if err := Check("scan.JPG", 1); err != nil {
+		t.Errorf("allowed extension held back: %v", err)
+	}
+	if err := Check("sheet.xlsx", 1); err == nil {
+		t.Error("extension outside the allow list passed")
+	}
+}
+
+// fakeClamd answers INSTREAM scans like clamd, finding a signature in
+// files that contain "EICAR".
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var content []byte
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					chunk := make([]byte, n)
+					if _, err := io.ReadFull(r, chunk); err != nil {
+						return
+					}
+					content = append(content, chunk...)
+				}
+				if strings.Contains(string(content), "EICAR") {
+					conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestScan_ClamAVAndVirusTotal verifies contents are held back when ClamAV finds a signature or VirusTotal flags their hash, and when a scanner cannot be reached
+func TestScan_ClamAVAndVirusTotal(t *testing.T) {
+	ctx := context.Background()
+	usePolicy(t, Policy{ClamAV: fakeClamd(t)})
+	if err := Scan(ctx, "clean.pdf", strings.NewReader(strings.Repeat("%PDF ", 20000))); err != nil {
+		t.Errorf("clean file held back: %v", err)
+	}
+	if err := Scan(ctx, "bad.zip", strings.NewReader("X5O!P%@AP EICAR test")); err == nil || !strings.Contains(err.Error(), "Eicar-Signature") {
+		t.Errorf("infected file passed: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("known bad"))
+	bad := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-apikey") != "vt-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/"+bad) {
+			io.WriteString(w, `{"data":{"attributes":{"last_analysis_stats":{"malicious":41,"harmless":0}}}}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	previous := virusTotalURL
+	virusTotalURL = server.URL + "/files/"
+	defer func() { virusTotalURL = previous }()
+
+	usePolicy(t, Policy{VirusTotalKey: "vt-key"})
+	if err := Scan(ctx, "report.pdf", strings.NewReader("never seen")); err != nil {
+		t.Errorf("unknown file held back: %v", err)
+	}
+	if err := Scan(ctx, "report.pdf", strings.NewReader("known bad")); err == nil || !strings.Contains(err.Error(), "41 engines") {
+		t.Errorf("flagged file passed: %v", err)
+	}
+
+	usePolicy(t, Policy{VirusTotalKey: "wrong"})
+	if err := Scan(ctx, "report.pdf", strings.NewReader("never seen")); err == nil {
+		t.Error("file passed although the lookup failed")
+	}
+}
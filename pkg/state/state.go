@@ -21,6 +21,34 @@ type State struct {
 
 	// Timestamp is the last time this state was updated
 	Timestamp time.Time `json:"timestamp"`
+
+	// Chats holds per-conversation settings keyed by "channel:chat_id"
+	Chats map[string]ChatSettings `json:"chats,omitempty"`
+}
+
+// ChatSettings are preferences and state that apply to a single
+// conversation.
+type ChatSettings struct {
+	// VoiceReplies answers voice notes with a synthesized voice note
+	VoiceReplies bool `json:"voice_replies,omitempty"`
+	// HandedOver is when the conversation was handed over to a person;
+	// until it is handed back the agent relays messages instead of
+	// answering them
+	HandedOver time.Time `json:"handed_over,omitzero"`
+	// HandoverReason is why the agent handed the conversation over
+	HandoverReason string `json:"handover_reason,omitempty"`
+	// Persona is the agents.personas preset an owner gave the chat
+	Persona string `json:"persona,omitempty"`
+	// SetupStep is the setup wizard question the chat is answering
+	SetupStep string `json:"setup_step,omitempty"`
+	// SetupDone is set once the chat finished or left the setup wizard,
+	// so it is not started again on its own
+	SetupDone bool `json:"setup_done,omitempty"`
+	// SetupPending is the first message of a new chat, answered once the
+	// wizard it started is over
+	SetupPending string `json:"setup_pending,omitempty"`
+	// LocalOnly keeps the chat on the local model, turned on with /local
+	LocalOnly bool `json:"local_only,omitempty"`
 }
 
 // Manager manages persistent state with atomic saves.
@@ -114,6 +142,51 @@ func (sm *Manager) GetLastChatID() string {
 	return sm.state.LastChatID
 }
 
+// GetChatSettings returns the settings for a conversation. Conversations
+// without stored settings get the zero value.
+func (sm *Manager) GetChatSettings(chatKey string) ChatSettings {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.state.Chats[chatKey]
+}
+
+// AllChatSettings returns a copy of the settings of every conversation
+// that has any, keyed by "channel:chat_id".
+func (sm *Manager) AllChatSettings() map[string]ChatSettings {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	all := make(map[string]ChatSettings, len(sm.state.Chats))
+	for key, settings := range sm.state.Chats {
+		all[key] = settings
+	}
+	return all
+}
+
+// UpdateChatSettings applies fn to the settings of a conversation and saves
+// the state atomically.
+func (sm *Manager) UpdateChatSettings(chatKey string, fn func(*ChatSettings)) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.state.Chats == nil {
+		sm.state.Chats = make(map[string]ChatSettings)
+	}
+	settings := sm.state.Chats[chatKey]
+	fn(&settings)
+	if settings == (ChatSettings{}) {
+		delete(sm.state.Chats, chatKey)
+	} else {
+		sm.state.Chats[chatKey] = settings
+	}
+	sm.state.Timestamp = time.Now()
+
+	if err := sm.saveAtomic(); err != nil {
+		return fmt.Errorf("failed to save state atomically: %w", err)
+	}
+
+	return nil
+}
+
 // GetTimestamp returns the timestamp of the last state update.
 func (sm *Manager) GetTimestamp() time.Time {
 	sm.mu.RLock()
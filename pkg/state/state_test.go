@@ -214,3 +214,36 @@ func TestNewManager_EmptyWorkspace(t *testing.T) {
 		t.Error("Expected zero timestamp for new state")
 	}
 }
+
+func TestChatSettings_Persistence(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "state-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sm := NewManager(tmpDir)
+
+	if sm.GetChatSettings("telegram:42").VoiceReplies {
+		t.Error("Expected voice replies to be off by default")
+	}
+
+	err = sm.UpdateChatSettings("telegram:42", func(s *ChatSettings) { s.VoiceReplies = true })
+	if err != nil {
+		t.Fatalf("UpdateChatSettings failed: %v", err)
+	}
+
+	sm2 := NewManager(tmpDir)
+	if !sm2.GetChatSettings("telegram:42").VoiceReplies {
+		t.Error("Expected voice replies to persist")
+	}
+	if sm2.GetChatSettings("telegram:43").VoiceReplies {
+		t.Error("Expected settings to be per chat")
+	}
+
+	// Resetting to defaults drops the entry
+	sm2.UpdateChatSettings("telegram:42", func(s *ChatSettings) { s.VoiceReplies = false })
+	if _, ok := sm2.state.Chats["telegram:42"]; ok {
+		t.Error("Expected default settings to be removed from state")
+	}
+}
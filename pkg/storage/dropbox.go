@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// dropboxChunkSize is the size of each part of an upload session; files
+// up to it go in one request.
+const dropboxChunkSize = 8 << 20
+
+// Dropbox is a Dropbox account, or the app folder of one, reached with an
+// access token.
+type Dropbox struct {
+	token      string
+	apiURL     string
+	contentURL string
+	client     *http.Client
+	// upload has no timeout: a chunk on a slow link can take long, the
+	// context bounds it
+	upload *http.Client
+}
+
+func NewDropbox(token string) *Dropbox {
+	return &Dropbox{
+		token:      token,
+		apiURL:     "https://api.dropboxapi.com/2",
+		contentURL: "https://content.dropboxapi.com/2",
+		client:     &http.Client{Timeout: 60 * time.Second},
+		upload:     &http.Client{},
+	}
+}
+
+func (s *Dropbox) Kind() string {
+	return "Dropbox"
+}
+
+// dropboxPath turns a store path into Dropbox's form: "/a/b", and "" for
+// the root.
+func dropboxPath(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "/" + name
+}
+
+// dropboxArg encodes the arguments of a content request for the
+// Dropbox-API-Arg header, which must be ASCII.
+func dropboxArg(v interface{}) string {
+	data, _ := json.Marshal(v)
+	var sb strings.Builder
+	for _, r := range string(data) {
+		if r < utf8.RuneSelf {
+			sb.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&sb, `\u%04x`, u)
+		}
+	}
+	return sb.String()
+}
+
+// dropboxError turns a failed answer into an error; a missing path is
+// ErrNotFound.
+func dropboxError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	var apiErr struct {
+		Summary string `json:"error_summary"`
+	}
+	json.Unmarshal(body, &apiErr)
+	if resp.StatusCode == http.StatusConflict && strings.Contains(apiErr.Summary, "not_found") {
+		return ErrNotFound
+	}
+	if apiErr.Summary != "" {
+		return fmt.Errorf("Dropbox error (%d): %s", resp.StatusCode, apiErr.Summary)
+	}
+	return fmt.Errorf("Dropbox error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// rpc calls an endpoint that takes and returns JSON.
+func (s *Dropbox) rpc(ctx context.Context, endpoint string, args, out interface{}) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dropboxError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// content calls an endpoint that takes its arguments in a header and
+// sends or returns the file itself.
+func (s *Dropbox) content(ctx context.Context, client *http.Client, endpoint string, args interface{}, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.contentURL+endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Dropbox-API-Arg", dropboxArg(args))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.ContentLength = size
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, dropboxError(resp)
+	}
+	return resp, nil
+}
+
+type dropboxEntry struct {
+	Tag      string `json:".tag"`
+	Path     string `json:"path_display"`
+	Size     int64  `json:"size"`
+	Modified string `json:"server_modified"`
+}
+
+type dropboxListResult struct {
+	Entries []dropboxEntry `json:"entries"`
+	Cursor  string         `json:"cursor"`
+	HasMore bool           `json:"has_more"`
+}
+
+func (s *Dropbox) list(ctx context.Context, dir string, recursive bool, fn func(File) error) error {
+	var page dropboxListResult
+	err := s.rpc(ctx, "/files/list_folder", map[string]interface{}{"path": dropboxPath(dir), "recursive": recursive}, &page)
+	for err == nil {
+		for _, e := range page.Entries {
+			if e.Tag == "deleted" {
+				continue
+			}
+			f := File{Path: strings.TrimPrefix(e.Path, "/"), Size: e.Size, Dir: e.Tag == "folder"}
+			f.Modified, _ = time.Parse(time.RFC3339, e.Modified)
+			if recursive && f.Dir {
+				continue
+			}
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		if !page.HasMore {
+			return nil
+		}
+		cursor := page.Cursor
+		page = dropboxListResult{}
+		err = s.rpc(ctx, "/files/list_folder/continue", map[string]string{"cursor": cursor}, &page)
+	}
+	return err
+}
+
+func (s *Dropbox) List(ctx context.Context, dir string) ([]File, error) {
+	dir, err := Clean(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	err = s.list(ctx, dir, false, func(f File) error {
+		files = append(files, f)
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, err
+}
+
+func (s *Dropbox) Walk(ctx context.Context, dir string, fn func(File) error) error {
+	dir, err := Clean(dir)
+	if err != nil {
+		return err
+	}
+	err = s.list(ctx, dir, true, fn)
+	if err == ErrStopWalk {
+		return nil
+	}
+	return err
+}
+
+func (s *Dropbox) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	name, err := Clean(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.content(ctx, s.upload, "/files/download", map[string]string{"path": dropboxPath(name)}, nil, -1)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put uploads the file in parts of dropboxChunkSize through an upload
+// session, so only one part is held in memory whatever the size; small
+// files of known size go in one request.
+func (s *Dropbox) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	commit := map[string]interface{}{"path": dropboxPath(name), "mode": "overwrite", "mute": true}
+	if size >= 0 && size <= dropboxChunkSize {
+		resp, err := s.content(ctx, s.upload, "/files/upload", commit, r, size)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	buf := make([]byte, dropboxChunkSize)
+	var sessionID string
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		chunk := bytes.NewReader(buf[:n])
+		var resp *http.Response
+		switch {
+		case sessionID == "" && last:
+			// Turned out small after all
+			resp, err = s.content(ctx, s.upload, "/files/upload", commit, chunk, int64(n))
+		case sessionID == "":
+			resp, err = s.content(ctx, s.upload, "/files/upload_session/start", map[string]bool{"close": false}, chunk, int64(n))
+			if err == nil {
+				var started struct {
+					SessionID string `json:"session_id"`
+				}
+				err = json.NewDecoder(resp.Body).Decode(&started)
+				sessionID = started.SessionID
+			}
+		case last:
+			cursor := map[string]interface{}{"session_id": sessionID, "offset": offset}
+			resp, err = s.content(ctx, s.upload, "/files/upload_session/finish", map[string]interface{}{"cursor": cursor, "commit": commit}, chunk, int64(n))
+		default:
+			cursor := map[string]interface{}{"session_id": sessionID, "offset": offset}
+			resp, err = s.content(ctx, s.upload, "/files/upload_session/append_v2", map[string]interface{}{"cursor": cursor, "close": false}, chunk, int64(n))
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+		if last {
+			return nil
+		}
+		if sessionID == "" {
+			return fmt.Errorf("Dropbox did not start an upload session")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Local is a folder on the device, or a share mounted into it.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+func (s *Local) Kind() string {
+	return "local folder"
+}
+
+func (s *Local) abs(name string) (string, error) {
+	clean, err := Clean(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *Local) file(rel string, info fs.FileInfo) File {
+	f := File{Path: filepath.ToSlash(rel), Modified: info.ModTime(), Dir: info.IsDir()}
+	if !f.Dir {
+		f.Size = info.Size()
+	}
+	return f
+}
+
+func (s *Local) List(ctx context.Context, dir string) ([]File, error) {
+	abs, err := s.abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(abs)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rel, _ := filepath.Rel(s.root, abs)
+	var files []File
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, s.file(filepath.Join(rel, e.Name()), info))
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Walk skips hidden files and folders, such as .picoclaw-backup.
+func (s *Local) Walk(ctx context.Context, dir string, fn func(File) error) error {
+	abs, err := s.abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(abs); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	err = filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p != abs && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.root, p)
+		return fn(s.file(rel, info))
+	})
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+func (s *Local) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	abs, err := s.abs(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(abs)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Put writes through a temporary file, so a failed copy does not leave a
+// truncated file under the final name.
+func (s *Local) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	abs, err := s.abs(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(abs), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), abs)
+}
@@ -0,0 +1,119 @@
+// Package storage is where users outside Google keep their files and
+// photos: a local folder (a disk, or a mounted SMB/NFS share), a WebDAV
+// server such as Nextcloud or ownCloud, an S3-compatible bucket (AWS,
+// MinIO, Backblaze B2, Cloudflare R2...) or Dropbox. Every backend offers the same
+// few verbs, so the files and photos tools work the same on all of them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// File is a file or folder in a store.
+type File struct {
+	// Path is relative to the store's root, with "/" separators and no
+	// leading slash
+	Path     string
+	Size     int64
+	Modified time.Time
+	Dir      bool
+}
+
+// Name returns the last element of the path.
+func (f File) Name() string {
+	return path.Base(f.Path)
+}
+
+// Store is a file storage backend.
+type Store interface {
+	// Kind names the backend in messages: "local folder", "WebDAV", "S3",
+	// "Dropbox"
+	Kind() string
+	// List returns the entries directly inside dir ("" for the root)
+	List(ctx context.Context, dir string) ([]File, error)
+	// Walk calls fn for every file below dir, folders excluded, until fn
+	// returns an error; ErrStopWalk ends the walk without one
+	Walk(ctx context.Context, dir string, fn func(File) error) error
+	// Open reads a file
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Put writes a file, creating the folders above it; size is -1 when
+	// unknown
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+}
+
+// ErrNotFound is returned for a path that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrStopWalk ends a walk early without an error.
+var ErrStopWalk = errors.New("stop walk")
+
+// Config selects and sets up a backend.
+type Config struct {
+	// Backend is "local", "webdav", "s3" or "dropbox"
+	Backend string
+	// Root is the local folder
+	Root string
+	// URL is the WebDAV folder, e.g.
+	// https://cloud.example.com/remote.php/dav/files/ana/
+	URL      string
+	Username string
+	Password string
+	// Endpoint is the S3 API, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://minio.local:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Prefix keeps the store inside a part of the bucket, e.g. "photos/"
+	Prefix string
+	// Token is the Dropbox access token
+	Token string
+}
+
+// New returns the backend cfg selects.
+func New(cfg Config) (Store, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "local":
+		if cfg.Root == "" {
+			return nil, fmt.Errorf("local storage needs a root folder")
+		}
+		return NewLocal(cfg.Root), nil
+	case "webdav":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("WebDAV storage needs a url")
+		}
+		return NewWebDAV(cfg.URL, cfg.Username, cfg.Password), nil
+	case "s3":
+		if cfg.Endpoint == "" || cfg.Bucket == "" {
+			return nil, fmt.Errorf("S3 storage needs an endpoint and a bucket")
+		}
+		return NewS3(cfg.Endpoint, cfg.Region, cfg.Bucket, cfg.Prefix, cfg.AccessKey, cfg.SecretKey), nil
+	case "dropbox":
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("Dropbox storage needs an access token")
+		}
+		return NewDropbox(cfg.Token), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want local, webdav, s3 or dropbox)", cfg.Backend)
+	}
+}
+
+// Clean normalizes a path given by the user or the model to the form
+// File.Path uses, refusing ones that climb out of the root.
+func Clean(p string) (string, error) {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path %q leaves the storage root", p)
+		}
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+	return p, nil
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WebDAV is a folder on a WebDAV server: Nextcloud, ownCloud, a NAS, or
+// anything else that speaks it.
+type WebDAV struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+func NewWebDAV(folderURL, username, password string) *WebDAV {
+	base, err := url.Parse(strings.TrimRight(folderURL, "/") + "/")
+	if err != nil {
+		base = &url.URL{}
+	}
+	return &WebDAV{
+		base:     base,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (s *WebDAV) Kind() string {
+	return "WebDAV"
+}
+
+// url returns the address of a path below the base folder, each segment
+// escaped. Folders end in a slash.
+func (s *WebDAV) url(name string, dir bool) string {
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" {
+			parts = append(parts, url.PathEscape(part))
+		}
+	}
+	ref := strings.Join(parts, "/")
+	if dir && ref != "" {
+		ref += "/"
+	}
+	return strings.TrimSuffix(s.base.String(), "/") + "/" + ref
+}
+
+func (s *WebDAV) do(ctx context.Context, method, target string, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if size >= 0 && body != nil {
+		req.ContentLength = size
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func davError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("WebDAV error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+type davPropfind struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				Length       int64  `xml:"getcontentlength"`
+				LastModified string `xml:"getlastmodified"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (s *WebDAV) List(ctx context.Context, dir string) ([]File, error) {
+	dir, err := Clean(dir)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, "PROPFIND", s.url(dir, true), strings.NewReader(propfindBody), -1, map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "1",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, davError(resp)
+	}
+	var ms davPropfind
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse WebDAV listing: %w", err)
+	}
+	var files []File
+	for _, r := range ms.Responses {
+		rel, ok := s.relative(r.Href)
+		if !ok || rel == dir {
+			continue
+		}
+		f := File{Path: rel}
+		for _, ps := range r.Propstat {
+			if ps.Status != "" && !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			f.Dir = f.Dir || ps.Prop.ResourceType.Collection != nil
+			if ps.Prop.Length > 0 {
+				f.Size = ps.Prop.Length
+			}
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				f.Modified = t
+			}
+		}
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// relative turns an href from a listing, absolute or a path, into a path
+// below the base folder.
+func (s *WebDAV) relative(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	p, basePath := u.Path, s.base.Path
+	if !strings.HasPrefix(p, basePath) && strings.TrimSuffix(p, "/")+"/" != basePath {
+		return "", false
+	}
+	rel := strings.Trim(strings.TrimPrefix(p, basePath), "/")
+	return path.Clean("/" + rel)[1:], true
+}
+
+// Walk lists folder by folder, as many servers refuse Depth: infinity.
+func (s *WebDAV) Walk(ctx context.Context, dir string, fn func(File) error) error {
+	queue := []string{dir}
+	for len(queue) > 0 {
+		files, err := s.List(ctx, queue[0])
+		if err != nil {
+			return err
+		}
+		queue = queue[1:]
+		for _, f := range files {
+			if f.Dir {
+				queue = append(queue, f.Path)
+				continue
+			}
+			if err := fn(f); err == ErrStopWalk {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *WebDAV) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	name, err := Clean(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.url(name, false), nil, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, davError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *WebDAV) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	if err := s.mkdirAll(ctx, path.Dir(name)); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.url(name, false), r, size, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return davError(resp)
+	}
+	return nil
+}
+
+// mkdirAll creates dir and the folders above it. MKCOL on a folder that
+// exists answers 405, which is fine.
+func (s *WebDAV) mkdirAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		resp, err := s.do(ctx, "MKCOL", s.url(strings.Join(parts[:i+1], "/"), true), bytes.NewReader(nil), 0, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("WebDAV could not create folder %s (%d)", strings.Join(parts[:i+1], "/"), resp.StatusCode)
+		}
+	}
+	return nil
+}
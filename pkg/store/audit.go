@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry is one mutating tool call: who asked, what was done and
+// which objects it touched.
+type AuditEntry struct {
+	ID      int64
+	At      time.Time
+	Channel string
+	ChatID  string
+	// Sender is the user whose request led to the call
+	Sender string
+	Tool   string
+	Action string
+	// Args are the call's arguments as JSON, possibly truncated
+	Args string
+	// Result is the start of what the tool reported
+	Result string
+	// Refs are the IDs and paths of the objects affected
+	Refs   []string
+	Failed bool
+}
+
+// AuditFilter selects audit entries. Zero fields match everything.
+type AuditFilter struct {
+	Since   time.Time
+	Until   time.Time
+	Channel string
+	ChatID  string
+	Sender  string
+	Tool    string
+	// Text is looked for, case-insensitively, in the arguments, result and
+	// references
+	Text  string
+	Limit int
+}
+
+// Audit is the append-only trail of mutating tool calls. Triggers in the
+// schema refuse updates and deletes, so entries cannot be rewritten even
+// through the sqlite3 shell without dropping them first.
+type Audit struct {
+	db *DB
+}
+
+// Append adds an entry.
+func (a *Audit) Append(ctx context.Context, e AuditEntry) error {
+	at := e.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	failed := 0
+	if e.Failed {
+		failed = 1
+	}
+	return a.db.exec(ctx, fmt.Sprintf(`INSERT INTO audit (at, channel, chat_id, sender, tool, action, args, result, refs, failed)
+VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %d);`,
+		unixMilli(at), Quote(e.Channel), Quote(e.ChatID), Quote(e.Sender), Quote(e.Tool), Quote(e.Action),
+		Quote(e.Args), Quote(e.Result), Quote(strings.Join(e.Refs, "\n")), failed))
+}
+
+// Query returns the entries matching f, newest first.
+func (a *Audit) Query(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	conds := []string{"1 = 1"}
+	if !f.Since.IsZero() {
+		conds = append(conds, "at >= "+unixMilli(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "at < "+unixMilli(f.Until))
+	}
+	if f.Channel != "" {
+		conds = append(conds, "channel = "+Quote(f.Channel))
+	}
+	if f.ChatID != "" {
+		conds = append(conds, "chat_id = "+Quote(f.ChatID))
+	}
+	if f.Sender != "" {
+		conds = append(conds, "sender = "+Quote(f.Sender))
+	}
+	if f.Tool != "" {
+		conds = append(conds, "tool = "+Quote(f.Tool))
+	}
+	if f.Text != "" {
+		conds = append(conds, fmt.Sprintf("instr(lower(args || ' ' || result || ' ' || refs), lower(%s)) > 0", Quote(f.Text)))
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var rows []struct {
+		ID      int64  `json:"id"`
+		At      int64  `json:"at"`
+		Channel string `json:"channel"`
+		ChatID  string `json:"chat_id"`
+		Sender  string `json:"sender"`
+		Tool    string `json:"tool"`
+		Action  string `json:"action"`
+		Args    string `json:"args"`
+		Result  string `json:"result"`
+		Refs    string `json:"refs"`
+		Failed  int    `json:"failed"`
+	}
+	err := a.db.rows(ctx, fmt.Sprintf(`SELECT id, at, channel, chat_id, sender, tool, action, args, result, refs, failed
+FROM audit WHERE %s ORDER BY id DESC LIMIT %d;`, strings.Join(conds, " AND "), limit), &rows)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(rows))
+	for _, r := range rows {
+		var refs []string
+		if r.Refs != "" {
+			refs = strings.Split(r.Refs, "\n")
+		}
+		entries = append(entries, AuditEntry{
+			ID:      r.ID,
+			At:      fromMilli(r.At),
+			Channel: r.Channel,
+			ChatID:  r.ChatID,
+			Sender:  r.Sender,
+			Tool:    r.Tool,
+			Action:  r.Action,
+			Args:    r.Args,
+			Result:  r.Result,
+			Refs:    refs,
+			Failed:  r.Failed != 0,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// chatTables are the tables that keep rows about one chat, with the
+// condition picking them out. The audit log is not here: it is
+// append-only.
+var chatTables = []struct {
+	table string
+	where func(channel, chatID string) string
+}{
+	{"undo", byScope},
+	{"contact_group_members", byScope},
+	{"contact_groups", byScope},
+	{"outbox", byChat},
+	{"mail_outbox", byChat},
+	{"inbox", func(channel, chatID string) string {
+		return fmt.Sprintf("json_extract(body, '$.channel') = %s AND json_extract(body, '$.chat_id') = %s", Quote(channel), Quote(chatID))
+	}},
+	{"memory", byScope},
+}
+
+func byScope(channel, chatID string) string {
+	return "scope = " + Quote(channel+":"+chatID)
+}
+
+func byChat(channel, chatID string) string {
+	return fmt.Sprintf("channel = %s AND chat_id = %s", Quote(channel), Quote(chatID))
+}
+
+// ChatData returns the rows kept about the chat channel:chatID, by table,
+// leaving out tables with none.
+func (db *DB) ChatData(ctx context.Context, channel, chatID string) (map[string][]map[string]interface{}, error) {
+	data := map[string][]map[string]interface{}{}
+	for _, t := range chatTables {
+		var rows []map[string]interface{}
+		if err := db.rows(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s;", t.table, t.where(channel, chatID)), &rows); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.table, err)
+		}
+		if len(rows) > 0 {
+			data[t.table] = rows
+		}
+	}
+	return data, nil
+}
+
+// PurgeChat deletes the rows kept about the chat channel:chatID, audit
+// log excepted, and returns how many went.
+func (db *DB) PurgeChat(ctx context.Context, channel, chatID string) (int, error) {
+	var sb strings.Builder
+	sb.WriteString("BEGIN;\n")
+	for i, t := range chatTables {
+		if i > 0 {
+			sb.WriteString("UPDATE purged SET n = n + changes();\n")
+		} else {
+			sb.WriteString("CREATE TEMP TABLE purged (n INTEGER);\nINSERT INTO purged VALUES (0);\n")
+		}
+		fmt.Fprintf(&sb, "DELETE FROM %s WHERE %s;\n", t.table, t.where(channel, chatID))
+	}
+	sb.WriteString("UPDATE purged SET n = n + changes();\nCOMMIT;\nSELECT n AS removed FROM purged;")
+	var rows []struct {
+		Removed int `json:"removed"`
+	}
+	if err := db.rows(ctx, sb.String(), &rows); err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Removed, nil
+}
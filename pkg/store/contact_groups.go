@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GroupMember is one recipient of a contact group: a name with an email
+// address, a chat, or both.
+type GroupMember struct {
+	Name  string
+	Email string
+	// Chat is where messages to the member go ("telegram:123")
+	Chat string
+}
+
+// ContactGroup is a named set of recipients, such as "family" or "team".
+type ContactGroup struct {
+	Name    string
+	Members []GroupMember
+}
+
+// ContactGroups stores the recipient groups each chat has defined. Names
+// of groups and members are matched case-insensitively.
+type ContactGroups struct {
+	db *DB
+}
+
+// List returns scope's groups with their members, by name.
+func (g *ContactGroups) List(ctx context.Context, scope string) ([]ContactGroup, error) {
+	return g.load(ctx, scope, "")
+}
+
+// Get returns scope's group called name.
+func (g *ContactGroups) Get(ctx context.Context, scope, name string) (ContactGroup, bool, error) {
+	groups, err := g.load(ctx, scope, name)
+	if err != nil || len(groups) == 0 {
+		return ContactGroup{}, false, err
+	}
+	return groups[0], true, nil
+}
+
+func (g *ContactGroups) load(ctx context.Context, scope, name string) ([]ContactGroup, error) {
+	where := "g.scope = " + Quote(scope)
+	if name != "" {
+		where += " AND g.name = " + Quote(name)
+	}
+	var rows []struct {
+		Group  string `json:"group_name"`
+		Member string `json:"member"`
+		Email  string `json:"email"`
+		Chat   string `json:"chat"`
+	}
+	err := g.db.rows(ctx, fmt.Sprintf(`SELECT g.name AS group_name, COALESCE(m.name, '') AS member, COALESCE(m.email, '') AS email, COALESCE(m.chat, '') AS chat
+FROM contact_groups g LEFT JOIN contact_group_members m ON m.scope = g.scope AND m.group_name = g.name
+WHERE %s ORDER BY g.name, m.name;`, where), &rows)
+	if err != nil {
+		return nil, err
+	}
+	var groups []ContactGroup
+	for _, r := range rows {
+		if len(groups) == 0 || !strings.EqualFold(groups[len(groups)-1].Name, r.Group) {
+			groups = append(groups, ContactGroup{Name: r.Group})
+		}
+		if r.Member != "" {
+			last := &groups[len(groups)-1]
+			last.Members = append(last.Members, GroupMember{Name: r.Member, Email: r.Email, Chat: r.Chat})
+		}
+	}
+	return groups, nil
+}
+
+// Add creates scope's group called name if it does not exist and adds
+// members to it. A member already in the group is updated; an email or
+// chat it is given empty keeps the one stored.
+func (g *ContactGroups) Add(ctx context.Context, scope, name string, members []GroupMember) error {
+	now := unixMilli(time.Now())
+	var sb strings.Builder
+	sb.WriteString("BEGIN;\n")
+	fmt.Fprintf(&sb, "INSERT OR IGNORE INTO contact_groups (scope, name, created_at) VALUES (%s, %s, %s);\n", Quote(scope), Quote(name), now)
+	for _, m := range members {
+		fmt.Fprintf(&sb, `INSERT INTO contact_group_members (scope, group_name, name, email, chat, added_at) VALUES (%s, %s, %s, %s, %s, %s)
+ON CONFLICT (scope, group_name, name) DO UPDATE SET
+	email = CASE WHEN excluded.email != '' THEN excluded.email ELSE email END,
+	chat = CASE WHEN excluded.chat != '' THEN excluded.chat ELSE chat END;
+`, Quote(scope), Quote(name), Quote(m.Name), Quote(m.Email), Quote(m.Chat), now)
+	}
+	sb.WriteString("COMMIT;")
+	return g.db.exec(ctx, sb.String())
+}
+
+// Remove takes the named members out of scope's group and returns how
+// many were in it.
+func (g *ContactGroups) Remove(ctx context.Context, scope, name string, members []string) (int, error) {
+	quoted := make([]string, len(members))
+	for i, m := range members {
+		quoted[i] = Quote(m)
+	}
+	var rows []struct {
+		Removed int `json:"removed"`
+	}
+	err := g.db.rows(ctx, fmt.Sprintf("DELETE FROM contact_group_members WHERE scope = %s AND group_name = %s AND name IN (%s);\nSELECT changes() AS removed;",
+		Quote(scope), Quote(name), strings.Join(quoted, ", ")), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Removed, nil
+}
+
+// Delete removes scope's group called name with its members, reporting
+// whether it existed.
+func (g *ContactGroups) Delete(ctx context.Context, scope, name string) (bool, error) {
+	var rows []struct {
+		Removed int `json:"removed"`
+	}
+	err := g.db.rows(ctx, fmt.Sprintf(`BEGIN;
+DELETE FROM contact_group_members WHERE scope = %[1]s AND group_name = %[2]s;
+DELETE FROM contact_groups WHERE scope = %[1]s AND name = %[2]s;
+SELECT changes() AS removed;
+COMMIT;`, Quote(scope), Quote(name)), &rows)
+	if err != nil || len(rows) == 0 {
+		return false, err
+	}
+	return rows[0].Removed > 0, nil
+}
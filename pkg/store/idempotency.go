@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Idempotency records operations that must not run twice, such as sending
+// an email again after a retry or a restart.
+type Idempotency struct {
+	db *DB
+}
+
+// Claim reserves key for ttl. It returns true when the caller should go
+// ahead, false when the key was already claimed and has not expired.
+func (i *Idempotency) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	var rows []struct {
+		Changes int `json:"claimed"`
+	}
+	err := i.db.rows(ctx, fmt.Sprintf(`DELETE FROM idempotency WHERE key = %s AND expires_at <= %s;
+INSERT OR IGNORE INTO idempotency (key, created_at, expires_at) VALUES (%s, %s, %s);
+SELECT changes() AS claimed;`,
+		Quote(key), unixMilli(now), Quote(key), unixMilli(now), unixMilli(now.Add(ttl))), &rows)
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0 && rows[0].Changes > 0, nil
+}
+
+// Complete stores the result of a claimed operation, so a repeat can
+// report it instead of running again.
+func (i *Idempotency) Complete(ctx context.Context, key, result string) error {
+	return i.db.exec(ctx, fmt.Sprintf("UPDATE idempotency SET result = %s, done = 1 WHERE key = %s;", Quote(result), Quote(key)))
+}
+
+// Result returns the stored result of a completed operation.
+func (i *Idempotency) Result(ctx context.Context, key string) (string, bool, error) {
+	var rows []struct {
+		Result string `json:"result"`
+	}
+	err := i.db.rows(ctx, fmt.Sprintf("SELECT result FROM idempotency WHERE key = %s AND done = 1 AND expires_at > %s;",
+		Quote(key), unixMilli(time.Now())), &rows)
+	if err != nil || len(rows) == 0 {
+		return "", false, err
+	}
+	return rows[0].Result, true, nil
+}
+
+// Release drops a claim, for operations that failed and may be retried.
+func (i *Idempotency) Release(ctx context.Context, key string) error {
+	return i.db.exec(ctx, fmt.Sprintf("DELETE FROM idempotency WHERE key = %s;", Quote(key)))
+}
+
+// Prune removes expired records and returns how many there were.
+func (i *Idempotency) Prune(ctx context.Context) (int, error) {
+	var rows []struct {
+		Removed int `json:"removed"`
+	}
+	err := i.db.rows(ctx, fmt.Sprintf("DELETE FROM idempotency WHERE expires_at <= %s;\nSELECT changes() AS removed;",
+		unixMilli(time.Now())), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Removed, nil
+}
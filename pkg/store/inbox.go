@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// InboxItem is an inbound message that was received but not yet fully
+// handled.
+type InboxItem struct {
+	ID        int64
+	Message   bus.InboundMessage
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Inbox journals inbound messages while they are handled, so work cut
+// short by a crash, power loss or shutdown can be picked up on restart.
+type Inbox struct {
+	db *DB
+}
+
+// Add journals msg; attempts counts earlier tries at handling it.
+func (in *Inbox) Add(ctx context.Context, msg bus.InboundMessage, attempts int) (int64, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	var rows []struct {
+		ID int64 `json:"id"`
+	}
+	err = in.db.rows(ctx, fmt.Sprintf(`INSERT INTO inbox (body, attempts, created_at) VALUES (%s, %d, %s);
+SELECT last_insert_rowid() AS id;`, Quote(string(body)), attempts, unixMilli(time.Now())), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].ID, nil
+}
+
+// Done removes a handled message.
+func (in *Inbox) Done(ctx context.Context, id int64) error {
+	return in.db.exec(ctx, fmt.Sprintf("DELETE FROM inbox WHERE id = %d;", id))
+}
+
+// Pending returns the journaled messages, oldest first.
+func (in *Inbox) Pending(ctx context.Context) ([]InboxItem, error) {
+	var rows []struct {
+		ID        int64  `json:"id"`
+		Body      string `json:"body"`
+		Attempts  int    `json:"attempts"`
+		CreatedAt int64  `json:"created_at"`
+	}
+	if err := in.db.rows(ctx, "SELECT id, body, attempts, created_at FROM inbox ORDER BY id;", &rows); err != nil {
+		return nil, err
+	}
+	items := make([]InboxItem, 0, len(rows))
+	for _, r := range rows {
+		item := InboxItem{ID: r.ID, Attempts: r.Attempts, CreatedAt: fromMilli(r.CreatedAt)}
+		if err := json.Unmarshal([]byte(r.Body), &item.Message); err != nil {
+			return nil, fmt.Errorf("corrupt inbox entry %d: %w", r.ID, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
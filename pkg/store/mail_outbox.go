@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MailOutboxItem is a queued outgoing email. Message is the email as the
+// sender encoded it; Summary describes it to the user ("Lunch" to ana@…).
+// Statuses are the outbox's.
+type MailOutboxItem struct {
+	ID          int64
+	Channel     string
+	ChatID      string
+	Summary     string
+	Message     string
+	Status      string
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	NextAttempt time.Time
+}
+
+// MailOutbox queues emails that could not be sent right away, so they go
+// out once the network or the mail API is back, across restarts. Like
+// the chat outbox, failed attempts are retried at a time the caller picks
+// until it gives up.
+type MailOutbox struct {
+	db *DB
+}
+
+// Enqueue adds a pending email for the chat that sent it, first tried at
+// nextAttempt, and returns its ID.
+func (o *MailOutbox) Enqueue(ctx context.Context, channel, chatID, summary, message string, nextAttempt time.Time) (int64, error) {
+	var rows []struct {
+		ID int64 `json:"id"`
+	}
+	err := o.db.rows(ctx, fmt.Sprintf(`INSERT INTO mail_outbox (channel, chat_id, summary, message, created_at, next_attempt) VALUES (%s, %s, %s, %s, %s, %s);
+SELECT last_insert_rowid() AS id;`, Quote(channel), Quote(chatID), Quote(summary), Quote(message), unixMilli(time.Now()), unixMilli(nextAttempt)), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].ID, nil
+}
+
+// Pending returns up to limit pending emails that are due, oldest first.
+func (o *MailOutbox) Pending(ctx context.Context, now time.Time, limit int) ([]MailOutboxItem, error) {
+	return o.list(ctx, fmt.Sprintf("status = %s AND next_attempt <= %s", Quote(OutboxPending), unixMilli(now)), limit)
+}
+
+// Queued returns the emails of a chat still waiting to be sent, oldest
+// first.
+func (o *MailOutbox) Queued(ctx context.Context, channel, chatID string) ([]MailOutboxItem, error) {
+	return o.list(ctx, fmt.Sprintf("status = %s AND channel = %s AND chat_id = %s", Quote(OutboxPending), Quote(channel), Quote(chatID)), 100)
+}
+
+func (o *MailOutbox) list(ctx context.Context, where string, limit int) ([]MailOutboxItem, error) {
+	var rows []struct {
+		ID          int64  `json:"id"`
+		Channel     string `json:"channel"`
+		ChatID      string `json:"chat_id"`
+		Summary     string `json:"summary"`
+		Message     string `json:"message"`
+		Status      string `json:"status"`
+		Attempts    int    `json:"attempts"`
+		LastError   string `json:"last_error"`
+		CreatedAt   int64  `json:"created_at"`
+		NextAttempt int64  `json:"next_attempt"`
+	}
+	err := o.db.rows(ctx, fmt.Sprintf(`SELECT id, channel, chat_id, summary, message, status, attempts, last_error, created_at, next_attempt
+FROM mail_outbox WHERE %s ORDER BY id LIMIT %d;`, where, limit), &rows)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]MailOutboxItem, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, MailOutboxItem{
+			ID:          r.ID,
+			Channel:     r.Channel,
+			ChatID:      r.ChatID,
+			Summary:     r.Summary,
+			Message:     r.Message,
+			Status:      r.Status,
+			Attempts:    r.Attempts,
+			LastError:   r.LastError,
+			CreatedAt:   fromMilli(r.CreatedAt),
+			NextAttempt: fromMilli(r.NextAttempt),
+		})
+	}
+	return items, nil
+}
+
+// MarkSent records a sent email.
+func (o *MailOutbox) MarkSent(ctx context.Context, id int64) error {
+	return o.db.exec(ctx, fmt.Sprintf("UPDATE mail_outbox SET status = %s, attempts = attempts + 1 WHERE id = %d;", Quote(OutboxSent), id))
+}
+
+// MarkFailed records a failed attempt. The email is retried at retryAt,
+// or given up on when retryAt is zero.
+func (o *MailOutbox) MarkFailed(ctx context.Context, id int64, sendErr error, retryAt time.Time) error {
+	status := OutboxPending
+	if retryAt.IsZero() {
+		status = OutboxFailed
+	}
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+	return o.db.exec(ctx, fmt.Sprintf("UPDATE mail_outbox SET status = %s, attempts = attempts + 1, last_error = %s, next_attempt = %s WHERE id = %d;",
+		Quote(status), Quote(errText), unixMilli(retryAt), id))
+}
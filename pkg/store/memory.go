@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MemoryEntry is one remembered fact.
+type MemoryEntry struct {
+	Scope     string    `json:"scope"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Memory keeps facts by scope (a chat, a user, or "global") and key.
+type Memory struct {
+	db *DB
+}
+
+// Set stores value under scope and key, replacing any earlier value.
+func (m *Memory) Set(ctx context.Context, scope, key, value string) error {
+	return m.db.exec(ctx, fmt.Sprintf(`INSERT INTO memory (scope, key, value, updated_at) VALUES (%s, %s, %s, %s)
+ON CONFLICT(scope, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at;`,
+		Quote(scope), Quote(key), Quote(value), unixMilli(time.Now())))
+}
+
+// Get returns the value under scope and key.
+func (m *Memory) Get(ctx context.Context, scope, key string) (string, bool, error) {
+	entries, err := m.list(ctx, fmt.Sprintf("WHERE scope = %s AND key = %s", Quote(scope), Quote(key)))
+	if err != nil || len(entries) == 0 {
+		return "", false, err
+	}
+	return entries[0].Value, true, nil
+}
+
+// List returns the entries of a scope, by key.
+func (m *Memory) List(ctx context.Context, scope string) ([]MemoryEntry, error) {
+	return m.list(ctx, "WHERE scope = "+Quote(scope))
+}
+
+// Search returns entries in scope whose key or value contains text.
+func (m *Memory) Search(ctx context.Context, scope, text string) ([]MemoryEntry, error) {
+	like := Quote("%" + text + "%")
+	return m.list(ctx, fmt.Sprintf("WHERE scope = %s AND (key LIKE %s OR value LIKE %s)", Quote(scope), like, like))
+}
+
+// Delete removes one entry.
+func (m *Memory) Delete(ctx context.Context, scope, key string) error {
+	return m.db.exec(ctx, fmt.Sprintf("DELETE FROM memory WHERE scope = %s AND key = %s;", Quote(scope), Quote(key)))
+}
+
+// DeleteScope removes every entry of a scope.
+func (m *Memory) DeleteScope(ctx context.Context, scope string) error {
+	return m.db.exec(ctx, fmt.Sprintf("DELETE FROM memory WHERE scope = %s;", Quote(scope)))
+}
+
+func (m *Memory) list(ctx context.Context, where string) ([]MemoryEntry, error) {
+	var rows []struct {
+		Scope     string `json:"scope"`
+		Key       string `json:"key"`
+		Value     string `json:"value"`
+		UpdatedAt int64  `json:"updated_at"`
+	}
+	if err := m.db.rows(ctx, "SELECT scope, key, value, updated_at FROM memory "+where+" ORDER BY key;", &rows); err != nil {
+		return nil, err
+	}
+	entries := make([]MemoryEntry, 0, len(rows))
+	for _, r := range rows {
+		entries = append(entries, MemoryEntry{Scope: r.Scope, Key: r.Key, Value: r.Value, UpdatedAt: fromMilli(r.UpdatedAt)})
+	}
+	return entries, nil
+}
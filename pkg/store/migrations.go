@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// migration moves the schema from version-1 to version. Migrations are
+// append-only: once released, a migration is never edited; changes go in a
+// new one.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var migrations = []migration{
+	{1, "conversations", `
+CREATE TABLE messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX messages_session ON messages(session, id);
+CREATE TABLE summaries (
+	session TEXT PRIMARY KEY,
+	summary TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);`},
+	{2, "jobs", `
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	schedule TEXT NOT NULL DEFAULT '',
+	payload TEXT NOT NULL DEFAULT '{}',
+	enabled INTEGER NOT NULL DEFAULT 1,
+	next_run INTEGER NOT NULL DEFAULT 0,
+	last_run INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX jobs_next_run ON jobs(enabled, next_run);`},
+	{3, "memory", `
+CREATE TABLE memory (
+	scope TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (scope, key)
+);`},
+	{4, "idempotency", `
+CREATE TABLE idempotency (
+	key TEXT PRIMARY KEY,
+	result TEXT NOT NULL DEFAULT '',
+	done INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);`},
+	{5, "artifacts", `
+CREATE TABLE artifacts (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL,
+	mime_type TEXT NOT NULL DEFAULT '',
+	size INTEGER NOT NULL DEFAULT 0,
+	origin TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL DEFAULT 0
+);`},
+	{6, "outbox", `
+CREATE TABLE outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	channel TEXT NOT NULL,
+	chat_id TEXT NOT NULL,
+	content TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	next_attempt INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX outbox_pending ON outbox(status, next_attempt);`},
+	{7, "inbox", `
+CREATE TABLE inbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	body TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL
+);`},
+	{8, "undo", `
+CREATE TABLE undo (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	scope TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	description TEXT NOT NULL,
+	params TEXT NOT NULL DEFAULT '{}',
+	created_at INTEGER NOT NULL,
+	undone_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX undo_scope ON undo(scope, undone_at, id);`},
+	{9, "audit", `
+CREATE TABLE audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	at INTEGER NOT NULL,
+	channel TEXT NOT NULL DEFAULT '',
+	chat_id TEXT NOT NULL DEFAULT '',
+	sender TEXT NOT NULL DEFAULT '',
+	tool TEXT NOT NULL,
+	action TEXT NOT NULL DEFAULT '',
+	args TEXT NOT NULL DEFAULT '',
+	result TEXT NOT NULL DEFAULT '',
+	refs TEXT NOT NULL DEFAULT '',
+	failed INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX audit_at ON audit(at);
+CREATE TRIGGER audit_append_only_update BEFORE UPDATE ON audit
+BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;
+CREATE TRIGGER audit_append_only_delete BEFORE DELETE ON audit
+BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;`},
+	{10, "mail_outbox", `
+CREATE TABLE mail_outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	channel TEXT NOT NULL DEFAULT '',
+	chat_id TEXT NOT NULL DEFAULT '',
+	summary TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	next_attempt INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX mail_outbox_pending ON mail_outbox(status, next_attempt);`},
+	{11, "contact_groups", `
+CREATE TABLE contact_groups (
+	scope TEXT NOT NULL,
+	name TEXT NOT NULL COLLATE NOCASE,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (scope, name)
+);
+CREATE TABLE contact_group_members (
+	scope TEXT NOT NULL,
+	group_name TEXT NOT NULL COLLATE NOCASE,
+	name TEXT NOT NULL COLLATE NOCASE,
+	email TEXT NOT NULL DEFAULT '',
+	chat TEXT NOT NULL DEFAULT '',
+	added_at INTEGER NOT NULL,
+	PRIMARY KEY (scope, group_name, name)
+);`},
+}
+
+func (db *DB) userVersion(ctx context.Context) (int, error) {
+	var rows []struct {
+		Version int `json:"user_version"`
+	}
+	if err := db.query(ctx, "PRAGMA user_version;", &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Version, nil
+}
+
+// migrate applies the migrations the database has not seen, each in its
+// own transaction together with the version bump.
+func (db *DB) migrate(ctx context.Context) error {
+	current, err := db.userVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return fmt.Errorf("state database is at schema version %d, newer than this picoclaw (%d)", current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		sql := fmt.Sprintf("BEGIN;\n%s\nPRAGMA user_version = %d;\nCOMMIT;", m.sql, m.version)
+		if err := db.query(ctx, sql, nil); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Outbox statuses.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// OutboxItem is a queued outbound message.
+type OutboxItem struct {
+	ID          int64
+	Channel     string
+	ChatID      string
+	Content     string
+	Status      string
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	NextAttempt time.Time
+}
+
+// Outbox queues outbound messages so they survive restarts and channel
+// outages until delivered.
+type Outbox struct {
+	db *DB
+}
+
+// Enqueue adds a pending message and returns its ID.
+func (o *Outbox) Enqueue(ctx context.Context, channel, chatID, content string) (int64, error) {
+	var rows []struct {
+		ID int64 `json:"id"`
+	}
+	err := o.db.rows(ctx, fmt.Sprintf(`INSERT INTO outbox (channel, chat_id, content, created_at) VALUES (%s, %s, %s, %s);
+SELECT last_insert_rowid() AS id;`, Quote(channel), Quote(chatID), Quote(content), unixMilli(time.Now())), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].ID, nil
+}
+
+// Pending returns up to limit pending messages that are due, oldest first.
+func (o *Outbox) Pending(ctx context.Context, now time.Time, limit int) ([]OutboxItem, error) {
+	var rows []struct {
+		ID          int64  `json:"id"`
+		Channel     string `json:"channel"`
+		ChatID      string `json:"chat_id"`
+		Content     string `json:"content"`
+		Status      string `json:"status"`
+		Attempts    int    `json:"attempts"`
+		LastError   string `json:"last_error"`
+		CreatedAt   int64  `json:"created_at"`
+		NextAttempt int64  `json:"next_attempt"`
+	}
+	err := o.db.rows(ctx, fmt.Sprintf(`SELECT id, channel, chat_id, content, status, attempts, last_error, created_at, next_attempt
+FROM outbox WHERE status = %s AND next_attempt <= %s ORDER BY id LIMIT %d;`, Quote(OutboxPending), unixMilli(now), limit), &rows)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]OutboxItem, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, OutboxItem{
+			ID:          r.ID,
+			Channel:     r.Channel,
+			ChatID:      r.ChatID,
+			Content:     r.Content,
+			Status:      r.Status,
+			Attempts:    r.Attempts,
+			LastError:   r.LastError,
+			CreatedAt:   fromMilli(r.CreatedAt),
+			NextAttempt: fromMilli(r.NextAttempt),
+		})
+	}
+	return items, nil
+}
+
+// MarkSent records a delivered message.
+func (o *Outbox) MarkSent(ctx context.Context, id int64) error {
+	return o.db.exec(ctx, fmt.Sprintf("UPDATE outbox SET status = %s, attempts = attempts + 1 WHERE id = %d;", Quote(OutboxSent), id))
+}
+
+// MarkFailed records a failed attempt. The message is retried at retryAt,
+// or given up on when retryAt is zero.
+func (o *Outbox) MarkFailed(ctx context.Context, id int64, sendErr error, retryAt time.Time) error {
+	status := OutboxPending
+	if retryAt.IsZero() {
+		status = OutboxFailed
+	}
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+	return o.db.exec(ctx, fmt.Sprintf("UPDATE outbox SET status = %s, attempts = attempts + 1, last_error = %s, next_attempt = %s WHERE id = %d;",
+		Quote(status), Quote(errText), unixMilli(retryAt), id))
+}
+
+// Prune removes sent messages older than before and returns how many.
+func (o *Outbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	var rows []struct {
+		Removed int `json:"removed"`
+	}
+	err := o.db.rows(ctx, fmt.Sprintf("DELETE FROM outbox WHERE status = %s AND created_at < %s;\nSELECT changes() AS removed;",
+		Quote(OutboxSent), unixMilli(before)), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Removed, nil
+}
@@ -0,0 +1,164 @@
+// Package store is picoclaw's shared state database: one SQLite file with
+// versioned migrations and typed repositories for memory, idempotency
+// records, the inbound and outbound queues, the mail outbox, the undo
+// journal, the audit log and contact groups. Conversations, schedules and
+// artifacts keep their own files in the workspace; their tables from the
+// first migrations are left unused.
+//
+// Like the expense ledger and media index, it talks to the sqlite3 shell,
+// so the binary needs no cgo driver. The database is opened lazily; nothing
+// runs until a repository is first used.
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// busyTimeoutMS is how long a statement waits for a lock held by another
+// sqlite3 process before failing.
+const busyTimeoutMS = 5000
+
+// DB is the state database.
+type DB struct {
+	path string
+	bin  string
+
+	mu       sync.Mutex
+	initOnce sync.Once
+	initErr  error
+
+	Memory        *Memory
+	Idempotency   *Idempotency
+	Outbox        *Outbox
+	MailOutbox    *MailOutbox
+	Inbox         *Inbox
+	Undo          *Undo
+	Audit         *Audit
+	ContactGroups *ContactGroups
+}
+
+// Open returns the database stored at path. The file and its schema are
+// created on first use.
+func Open(path string) *DB {
+	db := &DB{path: path, bin: "sqlite3"}
+	db.Memory = &Memory{db: db}
+	db.Idempotency = &Idempotency{db: db}
+	db.Outbox = &Outbox{db: db}
+	db.MailOutbox = &MailOutbox{db: db}
+	db.Inbox = &Inbox{db: db}
+	db.Undo = &Undo{db: db}
+	db.Audit = &Audit{db: db}
+	db.ContactGroups = &ContactGroups{db: db}
+	return db
+}
+
+// WorkspacePath is where the gateway keeps the database.
+func WorkspacePath(workspace string) string {
+	return filepath.Join(workspace, "state", "picoclaw.db")
+}
+
+// Path returns the database file.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Version returns the schema version the database is at.
+func (db *DB) Version(ctx context.Context) (int, error) {
+	if err := db.init(ctx); err != nil {
+		return 0, err
+	}
+	return db.userVersion(ctx)
+}
+
+// Quote returns s as an SQL text literal for SQL run through the sqlite3
+// shell. Text goes in as hex, so no byte of it can end the literal or the
+// shell's input line (a NUL does); NULs are dropped, as SQLite's text
+// functions stop at them.
+func Quote(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	if s == "" {
+		return "''"
+	}
+	return "CAST(X'" + hex.EncodeToString([]byte(s)) + "' AS TEXT)"
+}
+
+func unixMilli(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func fromMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// query runs SQL (passed on stdin, never as arguments) and decodes the JSON
+// rows of the last statement into out. Calls are serialized so writers in
+// this process never contend for the file lock.
+func (db *DB) query(ctx context.Context, sql string, out interface{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, db.bin, "-json", "-bail", db.path)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf(".timeout %d\n%s", busyTimeoutMS, sql))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3 failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out == nil || len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+		return fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+	return nil
+}
+
+// exec runs SQL for its side effects after making sure the schema is
+// current.
+func (db *DB) exec(ctx context.Context, sql string) error {
+	if err := db.init(ctx); err != nil {
+		return err
+	}
+	return db.query(ctx, sql, nil)
+}
+
+// rows runs a query after making sure the schema is current.
+func (db *DB) rows(ctx context.Context, sql string, out interface{}) error {
+	if err := db.init(ctx); err != nil {
+		return err
+	}
+	return db.query(ctx, sql, out)
+}
+
+func (db *DB) init(ctx context.Context) error {
+	db.initOnce.Do(func() {
+		if _, err := exec.LookPath(db.bin); err != nil {
+			db.initErr = fmt.Errorf("sqlite3 is not installed; the state store needs it")
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+			db.initErr = err
+			return
+		}
+		db.initErr = db.migrate(ctx)
+	})
+	return db.initErr
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func openTest(t *testing.T) *DB {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	return Open(filepath.Join(t.TempDir(), "state", "picoclaw.db"))
+}
+
+// TestOpen_MigratesOnceToLatest verifies a new database reaches the latest schema and reopening is a no-op
+func TestOpen_MigratesOnceToLatest(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+	version, err := db.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := migrations[len(migrations)-1].version; version != latest {
+		t.Errorf("version = %d, want %d", version, latest)
+	}
+
+	reopened := Open(db.Path())
+	if v, err := reopened.Version(ctx); err != nil || v != version {
+		t.Errorf("reopen: version %d, err %v", v, err)
+	}
+}
+
+// TestIdempotency_ClaimOnce verifies a key is claimed once until released or expired
+func TestIdempotency_ClaimOnce(t *testing.T) {
+	idem := openTest(t).Idempotency
+	ctx := context.Background()
+	if ok, err := idem.Claim(ctx, "send:42", time.Hour); err != nil || !ok {
+		t.Fatalf("first claim = %v, %v", ok, err)
+	}
+	if ok, _ := idem.Claim(ctx, "send:42", time.Hour); ok {
+		t.Error("second claim should fail")
+	}
+	idem.Complete(ctx, "send:42", "message-id-1")
+	if r, ok, _ := idem.Result(ctx, "send:42"); !ok || r != "message-id-1" {
+		t.Errorf("Result = %q, %v", r, ok)
+	}
+	idem.Claim(ctx, "expired", -time.Second)
+	if ok, _ := idem.Claim(ctx, "expired", time.Hour); !ok {
+		t.Error("expired key should be claimable")
+	}
+}
+
+// TestMemoryOutbox verifies the remaining repositories store and return their records
+func TestMemoryOutbox(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+
+	db.Memory.Set(ctx, "chat:1", "dog", "Rex")
+	db.Memory.Set(ctx, "chat:1", "dog", "Max")
+	if v, ok, _ := db.Memory.Get(ctx, "chat:1", "dog"); !ok || v != "Max" {
+		t.Errorf("memory = %q, %v", v, ok)
+	}
+	if found, _ := db.Memory.Search(ctx, "chat:1", "ma"); len(found) != 1 {
+		t.Errorf("search found %d", len(found))
+	}
+
+	id, err := db.Outbox.Enqueue(ctx, "telegram", "1", "hello")
+	if err != nil || id == 0 {
+		t.Fatalf("Enqueue = %d, %v", id, err)
+	}
+	db.Outbox.MarkFailed(ctx, id, errors.New("timeout"), time.Now().Add(time.Hour))
+	if pending, _ := db.Outbox.Pending(ctx, time.Now(), 10); len(pending) != 0 {
+		t.Errorf("retry should wait, got %+v", pending)
+	}
+	pending, _ := db.Outbox.Pending(ctx, time.Now().Add(2*time.Hour), 10)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError != "timeout" {
+		t.Errorf("pending = %+v", pending)
+	}
+}
+
+// TestUndo_RecentSkipsUndoneAndOtherScopes verifies the journal lists a chat's open entries newest first
+func TestUndo_RecentSkipsUndoneAndOtherScopes(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+	first, err := db.Undo.Record(ctx, UndoRecord{Scope: "telegram:1", Kind: "drive.trash", Description: "uploaded a.pdf", Params: map[string]string{"file_id": "f1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := db.Undo.Record(ctx, UndoRecord{Scope: "telegram:1", Kind: "drive.trash", Description: "uploaded b.pdf", Params: map[string]string{"file_id": "f2"}})
+	db.Undo.Record(ctx, UndoRecord{Scope: "telegram:2", Kind: "drive.trash", Description: "uploaded c.pdf"})
+	db.Undo.Record(ctx, UndoRecord{Scope: "telegram:1", Kind: "drive.trash", Description: "old", CreatedAt: time.Now().Add(-48 * time.Hour)})
+
+	recent, err := db.Undo.Recent(ctx, "telegram:1", time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].ID != second || recent[1].Params["file_id"] != "f1" {
+		t.Fatalf("unexpected entries: %+v", recent)
+	}
+	if err := db.Undo.MarkUndone(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	recent, _ = db.Undo.Recent(ctx, "telegram:1", time.Now().Add(-time.Hour), 10)
+	if len(recent) != 1 || recent[0].ID != first {
+		t.Errorf("undone entry still listed: %+v", recent)
+	}
+	if n, err := db.Undo.Prune(ctx, time.Now().Add(-24*time.Hour)); err != nil || n != 1 {
+		t.Errorf("Prune removed %d, err %v", n, err)
+	}
+}
+
+// TestAudit_QueryAndAppendOnly verifies entries are filtered newest first and cannot be deleted
+func TestAudit_QueryAndAppendOnly(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+	week := time.Now().Add(-7 * 24 * time.Hour)
+	db.Audit.Append(ctx, AuditEntry{At: week.Add(-time.Hour), Sender: "u1", Tool: "message", Args: `{"content":"old"}`})
+	db.Audit.Append(ctx, AuditEntry{Sender: "u1", Tool: "message", Args: `{"content":"Hello Ana"}`, Refs: []string{"telegram:42"}})
+	db.Audit.Append(ctx, AuditEntry{Sender: "u2", Tool: "write_file", Refs: []string{"/ws/notes.md"}})
+	db.Audit.Append(ctx, AuditEntry{Sender: "u1", Tool: "contacts", Action: "create", Failed: true})
+
+	entries, err := db.Audit.Query(ctx, AuditFilter{Since: week, Sender: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Tool != "contacts" || !entries[0].Failed || entries[1].Refs[0] != "telegram:42" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries, _ := db.Audit.Query(ctx, AuditFilter{Text: "hello ana"}); len(entries) != 1 {
+		t.Errorf("text filter matched %d entries", len(entries))
+	}
+	if err := db.exec(ctx, "DELETE FROM audit;"); err == nil {
+		t.Error("audit entries could be deleted")
+	}
+}
+
+// TestContactGroups_AddUpdateRemove verifies groups keep their members per chat, updating a member keeps what it is not given, and names match in any case
+func TestContactGroups_AddUpdateRemove(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+	err := db.ContactGroups.Add(ctx, "telegram:1", "Family", []GroupMember{
+		{Name: "Ana", Email: "ana@example.com"},
+		{Name: "Bruno", Chat: "telegram:77"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ContactGroups.Add(ctx, "telegram:1", "team", nil)
+	db.ContactGroups.Add(ctx, "telegram:2", "family", []GroupMember{{Name: "Carla", Email: "carla@example.com"}})
+	if err := db.ContactGroups.Add(ctx, "telegram:1", "family", []GroupMember{{Name: "ana", Chat: "whatsapp:5511"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	group, ok, err := db.ContactGroups.Get(ctx, "telegram:1", "FAMILY")
+	if err != nil || !ok {
+		t.Fatalf("Get = %+v, %v, %v", group, ok, err)
+	}
+	if group.Name != "Family" || len(group.Members) != 2 || group.Members[0] != (GroupMember{Name: "Ana", Email: "ana@example.com", Chat: "whatsapp:5511"}) {
+		t.Fatalf("unexpected group: %+v", group)
+	}
+	groups, _ := db.ContactGroups.List(ctx, "telegram:1")
+	if len(groups) != 2 || groups[1].Name != "team" || len(groups[1].Members) != 0 {
+		t.Errorf("unexpected groups: %+v", groups)
+	}
+
+	if n, err := db.ContactGroups.Remove(ctx, "telegram:1", "family", []string{"bruno", "Zed"}); err != nil || n != 1 {
+		t.Errorf("Remove removed %d, err %v", n, err)
+	}
+	if deleted, err := db.ContactGroups.Delete(ctx, "telegram:1", "Family"); err != nil || !deleted {
+		t.Errorf("Delete = %v, %v", deleted, err)
+	}
+	if _, ok, _ := db.ContactGroups.Get(ctx, "telegram:1", "family"); ok {
+		t.Error("deleted group still found")
+	}
+	if other, ok, _ := db.ContactGroups.Get(ctx, "telegram:2", "family"); !ok || len(other.Members) != 1 {
+		t.Errorf("another chat's group was touched: %+v", other)
+	}
+}
+
+// TestQuote_NULCannotEndTheLiteral verifies a NUL in one value does not
+// let SQL in the next run: both are stored as text
+func TestQuote_NULCannotEndTheLiteral(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+	if err := db.Memory.Set(ctx, "global", "keep", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	injected := "', '', '', 0); DELETE FROM memory; --"
+	err := db.ContactGroups.Add(ctx, "telegram:1", "family", []GroupMember{{Name: "a\x00"}, {Name: injected}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := db.Memory.Get(ctx, "global", "keep"); err != nil || !ok || value != "kept" {
+		t.Fatalf("memory after the insert: %q, %v, %v", value, ok, err)
+	}
+	group, ok, err := db.ContactGroups.Get(ctx, "telegram:1", "Family")
+	if err != nil || !ok || len(group.Members) != 2 {
+		t.Fatalf("Get = %+v, %v, %v", group, ok, err)
+	}
+	names := []string{group.Members[0].Name, group.Members[1].Name}
+	if !(names[0] == "a" && names[1] == injected || names[1] == "a" && names[0] == injected) {
+		t.Errorf("members = %q", names)
+	}
+}
+
+// TestDB_ChatDataAndPurge verifies a chat's rows are exported by table and
+// deleted, other chats' rows and the audit log kept
+func TestDB_ChatDataAndPurge(t *testing.T) {
+	db := openTest(t)
+	ctx := context.Background()
+	for _, chat := range []string{"1", "2"} {
+		if _, err := db.Undo.Record(ctx, UndoRecord{Scope: "telegram:" + chat, Kind: "calendar.delete_event", Description: "Dentist"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.MailOutbox.Enqueue(ctx, "telegram", chat, "Lunch", "raw", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Inbox.Add(ctx, bus.InboundMessage{Channel: "telegram", ChatID: chat, Content: "hi"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.ContactGroups.Add(ctx, "telegram:1", "family", []GroupMember{{Name: "Ana"}})
+	db.Audit.Append(ctx, AuditEntry{Channel: "telegram", ChatID: "1", Tool: "calendar"})
+
+	data, err := db.ChatData(ctx, "telegram", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"undo", "mail_outbox", "inbox", "contact_groups", "contact_group_members"} {
+		if len(data[table]) != 1 {
+			t.Errorf("%s: %v", table, data[table])
+		}
+	}
+	removed, err := db.PurgeChat(ctx, "telegram", "1")
+	if err != nil || removed != 5 {
+		t.Fatalf("PurgeChat = %d, %v", removed, err)
+	}
+	if data, _ := db.ChatData(ctx, "telegram", "1"); len(data) != 0 {
+		t.Errorf("left after purge: %v", data)
+	}
+	if data, _ := db.ChatData(ctx, "telegram", "2"); len(data) != 3 {
+		t.Errorf("other chat: %v", data)
+	}
+	if entries, _ := db.Audit.Query(ctx, AuditFilter{Channel: "telegram", ChatID: "1"}); len(entries) != 1 {
+		t.Errorf("audit log: %v", entries)
+	}
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// UndoRecord is a mutation a tool made, with what it takes to reverse it.
+type UndoRecord struct {
+	ID int64
+	// Scope is the chat the mutation was made from ("telegram:123")
+	Scope string
+	// Kind names the compensating action, e.g. "calendar.delete_event"
+	Kind string
+	// Description says what was done, for listing
+	Description string
+	// Params are the compensating action's arguments
+	Params    map[string]string
+	CreatedAt time.Time
+}
+
+// Undo journals recent mutations so they can be reversed.
+type Undo struct {
+	db *DB
+}
+
+// Record adds an entry and returns its ID.
+func (u *Undo) Record(ctx context.Context, r UndoRecord) (int64, error) {
+	params, err := json.Marshal(r.Params)
+	if err != nil {
+		return 0, err
+	}
+	created := r.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	var rows []struct {
+		ID int64 `json:"id"`
+	}
+	err = u.db.rows(ctx, fmt.Sprintf(`INSERT INTO undo (scope, kind, description, params, created_at) VALUES (%s, %s, %s, %s, %s);
+SELECT last_insert_rowid() AS id;`, Quote(r.Scope), Quote(r.Kind), Quote(r.Description), Quote(string(params)), unixMilli(created)), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].ID, nil
+}
+
+// Recent returns up to limit entries for scope made after since that have
+// not been undone, newest first.
+func (u *Undo) Recent(ctx context.Context, scope string, since time.Time, limit int) ([]UndoRecord, error) {
+	var rows []struct {
+		ID          int64  `json:"id"`
+		Scope       string `json:"scope"`
+		Kind        string `json:"kind"`
+		Description string `json:"description"`
+		Params      string `json:"params"`
+		CreatedAt   int64  `json:"created_at"`
+	}
+	err := u.db.rows(ctx, fmt.Sprintf(`SELECT id, scope, kind, description, params, created_at FROM undo
+WHERE scope = %s AND undone_at = 0 AND created_at >= %s ORDER BY id DESC LIMIT %d;`, Quote(scope), unixMilli(since), limit), &rows)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]UndoRecord, 0, len(rows))
+	for _, r := range rows {
+		var params map[string]string
+		if err := json.Unmarshal([]byte(r.Params), &params); err != nil {
+			return nil, fmt.Errorf("undo entry %d: %w", r.ID, err)
+		}
+		records = append(records, UndoRecord{
+			ID:          r.ID,
+			Scope:       r.Scope,
+			Kind:        r.Kind,
+			Description: r.Description,
+			Params:      params,
+			CreatedAt:   fromMilli(r.CreatedAt),
+		})
+	}
+	return records, nil
+}
+
+// MarkUndone records that an entry was reversed, so it is not offered
+// again.
+func (u *Undo) MarkUndone(ctx context.Context, id int64) error {
+	return u.db.exec(ctx, fmt.Sprintf("UPDATE undo SET undone_at = %s WHERE id = %d;", unixMilli(time.Now()), id))
+}
+
+// Prune removes entries made before before and returns how many.
+func (u *Undo) Prune(ctx context.Context, before time.Time) (int, error) {
+	var rows []struct {
+		Removed int `json:"removed"`
+	}
+	err := u.db.rows(ctx, fmt.Sprintf("DELETE FROM undo WHERE created_at < %s;\nSELECT changes() AS removed;", unixMilli(before)), &rows)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Removed, nil
+}
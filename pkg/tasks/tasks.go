@@ -0,0 +1,491 @@
+// Package tasks runs long operations, such as backups and photo indexing,
+// as named background tasks a chat can ask about, pause, resume or cancel.
+// Tasks are persisted in the workspace: one still running when the process
+// stops starts again at the next start, so the kinds of work run here must
+// pick up where they left off when run again, as incremental backups do.
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Status is where a task stands.
+type Status string
+
+const (
+	Running  Status = "running"
+	Paused   Status = "paused"
+	Done     Status = "done"
+	Failed   Status = "failed"
+	Canceled Status = "canceled"
+)
+
+// keepFinished is how long finished tasks stay listed.
+const keepFinished = 7 * 24 * time.Hour
+
+// saveProgressEvery bounds how often progress alone is written to disk.
+const saveProgressEvery = 10 * time.Second
+
+// Task is one background operation.
+type Task struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+	// Data is what the kind's runner needs to run the task again
+	Data   map[string]string `json:"data,omitempty"`
+	Status Status            `json:"status"`
+	// Done and Total count the task's items; Total is 0 while unknown
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	Note  string `json:"note,omitempty"`
+	// Result is the runner's report of a finished task
+	Result   string    `json:"result,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+	Finished time.Time `json:"finished,omitempty"`
+	// Runs counts the times the task was started, resumes included
+	Runs int `json:"runs"`
+}
+
+// Active reports whether the task is running or paused.
+func (t Task) Active() bool {
+	return t.Status == Running || t.Status == Paused
+}
+
+// Run is handed to a runner: the task as it starts, and ways to report on it.
+type Run struct {
+	Task  Task
+	m     *Manager
+	quiet bool
+}
+
+// Progress records how far the task got; note describes what it is on.
+func (r *Run) Progress(done, total int, note string) {
+	r.m.progress(r.Task.ID, done, total, note)
+}
+
+// Quiet marks the outcome as not worth a message, such as a scheduled
+// backup that found nothing new. The result is still recorded.
+func (r *Run) Quiet() {
+	r.quiet = true
+}
+
+// Runner does the work of one kind of task until it is done or ctx is
+// canceled, and returns a report for the chat.
+type Runner func(ctx context.Context, run *Run) (string, error)
+
+// ErrRunning is returned when a task of the same name is already active in
+// the chat.
+var ErrRunning = errors.New("a task with that name is already running")
+
+// Manager runs tasks and keeps their state.
+type Manager struct {
+	path    string
+	mu      sync.Mutex
+	tasks   []*Task
+	runners map[string]Runner
+	cancels map[string]context.CancelFunc
+	// dones are closed when a task's run ends; waited are the tasks whose
+	// outcome a Wait is reporting, so it is not announced a second time
+	dones  map[string]chan struct{}
+	waited map[string]bool
+	saved  time.Time
+	notify func(Task)
+	ctx    context.Context
+	stop   context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager loads the tasks stored at path.
+func NewManager(path string) *Manager {
+	ctx, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		path:    path,
+		runners: make(map[string]Runner),
+		cancels: make(map[string]context.CancelFunc),
+		dones:   make(map[string]chan struct{}),
+		waited:  make(map[string]bool),
+		ctx:     ctx,
+		stop:    stop,
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &m.tasks); err != nil {
+			logger.WarnCF("tasks", "Ignoring unreadable task store", map[string]interface{}{"error": err.Error()})
+			m.tasks = nil
+		}
+	}
+	return m
+}
+
+// Handle sets the runner of a kind of task, replacing an earlier one, so
+// tools rebuilt on a config reload take their kinds over.
+func (m *Manager) Handle(kind string, runner Runner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runners[kind] = runner
+}
+
+// SetNotify sets what is called when a task finishes or fails, unless its
+// runner asked to stay quiet.
+func (m *Manager) SetNotify(fn func(Task)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = fn
+}
+
+// Start runs a new task in the background.
+func (m *Manager) Start(kind, name, channel, chatID string, data map[string]string) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.runners[kind]; !ok {
+		return Task{}, fmt.Errorf("unknown task kind %q", kind)
+	}
+	for _, t := range m.tasks {
+		if t.Active() && t.Channel == channel && t.ChatID == chatID && strings.EqualFold(t.Name, name) {
+			return *t, ErrRunning
+		}
+	}
+	now := time.Now()
+	t := &Task{
+		ID:      newID(),
+		Name:    name,
+		Kind:    kind,
+		Channel: channel,
+		ChatID:  chatID,
+		Data:    data,
+		Started: now,
+		Updated: now,
+	}
+	m.prune(now)
+	m.tasks = append(m.tasks, t)
+	m.launch(t)
+	return *t, nil
+}
+
+// Restore starts again the tasks that were running when the process last
+// stopped. Call it once the runners are set.
+func (m *Manager) Restore() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tasks {
+		if t.Status == Running && m.cancels[t.ID] == nil {
+			if _, ok := m.runners[t.Kind]; ok {
+				logger.InfoCF("tasks", "Resuming task", map[string]interface{}{"task": t.Name, "kind": t.Kind})
+				m.launch(t)
+			}
+		}
+	}
+}
+
+// launch runs t; m.mu must be held.
+func (m *Manager) launch(t *Task) {
+	runner := m.runners[t.Kind]
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancels[t.ID] = cancel
+	t.Status = Running
+	t.Error, t.Result = "", ""
+	t.Runs++
+	t.Updated = time.Now()
+	m.saveLocked()
+
+	run := &Run{Task: *t, m: m}
+	done := make(chan struct{})
+	m.dones[t.ID] = done
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(done)
+		defer cancel()
+		result, err := runner(ctx, run)
+		m.finish(t.ID, run.quiet, result, err)
+	}()
+}
+
+// finish records the outcome of a run. A run cut short by Pause or Cancel
+// keeps the status they set, and one cut short by Stop stays running, to
+// start again with the next process.
+func (m *Manager) finish(id string, quiet bool, result string, err error) {
+	m.mu.Lock()
+	t := m.find(id)
+	delete(m.cancels, id)
+	delete(m.dones, id)
+	if t == nil || t.Status != Running || m.ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	t.Updated, t.Finished = now, now
+	t.Result = result
+	if err != nil {
+		t.Status, t.Error = Failed, err.Error()
+	} else {
+		t.Status = Done
+		if t.Total > 0 {
+			t.Done = t.Total
+		}
+	}
+	m.saveLocked()
+	notify, done := m.notify, *t
+	if m.waited[id] {
+		notify = nil
+	}
+	m.mu.Unlock()
+
+	logger.InfoCF("tasks", "Task finished", map[string]interface{}{
+		"task":   done.Name,
+		"kind":   done.Kind,
+		"status": string(done.Status),
+	})
+	if notify != nil && (!quiet || err != nil) {
+		notify(done)
+	}
+}
+
+func (m *Manager) progress(id string, done, total int, note string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.find(id)
+	if t == nil || t.Status != Running {
+		return
+	}
+	t.Done, t.Total, t.Note = done, total, note
+	t.Updated = time.Now()
+	if time.Since(m.saved) >= saveProgressEvery {
+		m.saveLocked()
+	}
+}
+
+// Wait waits up to d for a task's run to end and returns the task. ok is
+// false when it is still running; it then reports when done, as any task.
+// Tools use it so that work which turns out to be quick is answered
+// directly.
+func (m *Manager) Wait(id string, d time.Duration) (task Task, ok bool) {
+	m.mu.Lock()
+	done := m.dones[id]
+	if done != nil {
+		m.waited[id] = true
+	}
+	m.mu.Unlock()
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(d):
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.waited, id)
+	t := m.find(id)
+	if t == nil {
+		return Task{}, false
+	}
+	return *t, t.Status != Running
+}
+
+// Pause stops a running task; Resume starts it again where it left off.
+func (m *Manager) Pause(id string) (Task, error) {
+	return m.halt(id, Paused)
+}
+
+// Cancel stops a running or paused task for good.
+func (m *Manager) Cancel(id string) (Task, error) {
+	return m.halt(id, Canceled)
+}
+
+func (m *Manager) halt(id string, status Status) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.find(id)
+	if t == nil {
+		return Task{}, fmt.Errorf("no task %s", id)
+	}
+	if t.Status != Running && (status == Paused || t.Status != Paused) {
+		return *t, fmt.Errorf("it is %s", t.Status)
+	}
+	t.Status = status
+	t.Updated = time.Now()
+	if status == Canceled {
+		t.Finished = t.Updated
+	}
+	if cancel := m.cancels[id]; cancel != nil {
+		cancel()
+	}
+	m.saveLocked()
+	return *t, nil
+}
+
+// Resume starts a paused task again.
+func (m *Manager) Resume(id string) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.find(id)
+	if t == nil {
+		return Task{}, fmt.Errorf("no task %s", id)
+	}
+	if t.Status != Paused {
+		return *t, fmt.Errorf("it is %s, not paused", t.Status)
+	}
+	if m.cancels[id] != nil {
+		return *t, errors.New("it is still stopping; try again in a moment")
+	}
+	if _, ok := m.runners[t.Kind]; !ok {
+		return *t, fmt.Errorf("%s tasks cannot run right now", t.Kind)
+	}
+	m.launch(t)
+	return *t, nil
+}
+
+// List returns a chat's tasks, newest first. Finished ones are left out
+// unless all is set.
+func (m *Manager) List(channel, chatID string, all bool) []Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Task
+	for _, t := range m.tasks {
+		if t.Channel == channel && t.ChatID == chatID && (all || t.Active()) {
+			out = append(out, *t)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Started.After(out[j].Started) })
+	return out
+}
+
+// Find looks a chat's task up by ID or by name. Names match ignoring case,
+// exactly or else as a part ("photo" finds "Photos backup"); the newest
+// match wins, active tasks before finished ones.
+func (m *Manager) Find(channel, chatID, query string) (Task, bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return Task{}, false
+	}
+	tasks := m.List(channel, chatID, true)
+	for _, match := range []func(Task) bool{
+		func(t Task) bool { return t.ID == query },
+		func(t Task) bool { return t.Active() && strings.ToLower(t.Name) == query },
+		func(t Task) bool { return t.Active() && strings.Contains(strings.ToLower(t.Name), query) },
+		func(t Task) bool { return strings.ToLower(t.Name) == query },
+		func(t Task) bool { return strings.Contains(strings.ToLower(t.Name), query) },
+	} {
+		for _, t := range tasks {
+			if match(t) {
+				return t, true
+			}
+		}
+	}
+	return Task{}, false
+}
+
+// Running reports whether a chat has an active task of kind named name.
+func (m *Manager) Running(kind, channel, chatID, name string) bool {
+	for _, t := range m.List(channel, chatID, false) {
+		if t.Kind == kind && strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop cancels the runs in progress and waits for them, leaving their
+// tasks running so that Restore starts them again next time.
+func (m *Manager) Stop() {
+	m.stop()
+	m.wg.Wait()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveLocked()
+}
+
+func (m *Manager) find(id string) *Task {
+	for _, t := range m.tasks {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// prune drops tasks finished long ago; m.mu must be held.
+func (m *Manager) prune(now time.Time) {
+	kept := m.tasks[:0]
+	for _, t := range m.tasks {
+		if t.Active() || now.Sub(t.Updated) < keepFinished {
+			kept = append(kept, t)
+		}
+	}
+	m.tasks = kept
+}
+
+// saveLocked writes the tasks to disk; m.mu must be held.
+func (m *Manager) saveLocked() {
+	m.saved = time.Now()
+	if m.path == "" {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(m.path), 0755)
+	if err == nil {
+		var data []byte
+		if data, err = json.MarshalIndent(m.tasks, "", "  "); err == nil {
+			tmp := m.path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0600); err == nil {
+				err = os.Rename(tmp, m.path)
+			}
+		}
+	}
+	if err != nil {
+		logger.WarnCF("tasks", "Failed to save tasks", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Describe renders a task for chat: name, status, progress and outcome.
+func Describe(t Task) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s [%s] %s", t.Name, t.ID, t.Status)
+	if t.Active() || t.Status == Canceled {
+		switch {
+		case t.Total > 0:
+			fmt.Fprintf(&sb, ", %d of %d (%d%%)", t.Done, t.Total, t.Done*100/t.Total)
+		case t.Done > 0:
+			fmt.Fprintf(&sb, ", %d done", t.Done)
+		}
+	}
+	if t.Status == Running && t.Note != "" {
+		sb.WriteString(", " + t.Note)
+	}
+	fmt.Fprintf(&sb, "; started %s", t.Started.Format("2006-01-02 15:04"))
+	if !t.Finished.IsZero() && !t.Active() {
+		fmt.Fprintf(&sb, ", ended %s", t.Finished.Format("2006-01-02 15:04"))
+	}
+	if t.Runs > 1 {
+		fmt.Fprintf(&sb, ", resumed %d time(s)", t.Runs-1)
+	}
+	if t.Error != "" {
+		sb.WriteString("\n  error: " + t.Error)
+	}
+	if t.Result != "" {
+		sb.WriteString("\n  " + strings.ReplaceAll(t.Result, "\n", "\n  "))
+	}
+	return sb.String()
+}
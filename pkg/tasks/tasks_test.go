@@ -0,0 +1,165 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stepRunner counts to total, one step per tick, starting from where the
+// previous run got to, as resumable work does.
+func stepRunner(total int, reached *atomic.Int32) Runner {
+	return func(ctx context.Context, run *Run) (string, error) {
+		for i := int(reached.Load()); i < total; i++ {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(5 * time.Millisecond):
+			}
+			reached.Store(int32(i + 1))
+			run.Progress(i+1, total, "step")
+		}
+		return "counted", nil
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// TestManager_PauseResumeCancel verifies a task can be paused, resumed where it stopped and canceled, and that only finished tasks are announced
+func TestManager_PauseResumeCancel(t *testing.T) {
+	m := NewManager(filepath.Join(t.TempDir(), "tasks.json"))
+	defer m.Stop()
+	var reached atomic.Int32
+	m.Handle("count", stepRunner(40, &reached))
+	announced := make(chan Task, 4)
+	m.SetNotify(func(task Task) { announced <- task })
+
+	task, err := m.Start("count", "Photos backup", "telegram", "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Start("count", "photos BACKUP", "telegram", "1", nil); err != ErrRunning {
+		t.Errorf("second start of the same task = %v", err)
+	}
+	waitFor(t, "progress", func() bool { return reached.Load() >= 5 })
+
+	if found, ok := m.Find("telegram", "1", "photo"); !ok || found.ID != task.ID || found.Total != 40 {
+		t.Fatalf("Find = %+v, %v", found, ok)
+	}
+	if _, ok := m.Find("telegram", "2", "photo"); ok {
+		t.Error("task found from another chat")
+	}
+
+	if _, err := m.Pause(task.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "pause", func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.cancels[task.ID] == nil
+	})
+	paused := reached.Load()
+	time.Sleep(30 * time.Millisecond)
+	if reached.Load() != paused {
+		t.Fatal("paused task kept running")
+	}
+	if _, err := m.Pause(task.ID); err == nil {
+		t.Error("pausing a paused task succeeded")
+	}
+
+	if _, err := m.Resume(task.ID); err != nil {
+		t.Fatal(err)
+	}
+	done, ok := m.Wait(task.ID, 5*time.Second)
+	if !ok || done.Status != Done || done.Result != "counted" || done.Runs != 2 || done.Done != 40 {
+		t.Fatalf("unexpected task after resume: %+v", done)
+	}
+	select {
+	case got := <-announced:
+		t.Errorf("task reported by Wait was announced too: %+v", got)
+	default:
+	}
+
+	reached.Store(0)
+	second, _ := m.Start("count", "Photos backup", "telegram", "1", nil)
+	waitFor(t, "progress", func() bool { return reached.Load() >= 2 })
+	if canceled, err := m.Cancel(second.ID); err != nil || canceled.Status != Canceled {
+		t.Fatalf("Cancel = %+v, %v", canceled, err)
+	}
+	if _, err := m.Resume(second.ID); err == nil {
+		t.Error("canceled task resumed")
+	}
+	if active := m.List("telegram", "1", false); len(active) != 0 {
+		t.Errorf("unexpected active tasks: %+v", active)
+	}
+	if all := m.List("telegram", "1", true); len(all) != 2 || all[0].ID != second.ID {
+		t.Errorf("unexpected task list: %+v", all)
+	}
+
+	m.Handle("fail", func(ctx context.Context, run *Run) (string, error) { return "", errors.New("disk full") })
+	m.Handle("quiet", func(ctx context.Context, run *Run) (string, error) { run.Quiet(); return "nothing new", nil })
+	m.Start("quiet", "Nightly backup", "telegram", "1", nil)
+	m.Start("fail", "Index", "telegram", "1", nil)
+	select {
+	case got := <-announced:
+		if got.Name != "Index" || got.Status != Failed || got.Error != "disk full" {
+			t.Errorf("unexpected announcement: %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("failure not announced")
+	}
+	// The quiet task is not announced, so wait for it to finish
+	waitFor(t, "the quiet task", func() bool {
+		quiet, _ := m.Find("telegram", "1", "nightly")
+		return quiet.Status != Running
+	})
+	if quiet, _ := m.Find("telegram", "1", "nightly"); quiet.Status != Done || quiet.Result != "nothing new" {
+		t.Errorf("unexpected quiet task: %+v", quiet)
+	}
+}
+
+// TestManager_RestoreAfterRestart verifies a task running at shutdown is kept as running and started again, where it left off, by the next manager
+func TestManager_RestoreAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	var reached atomic.Int32
+	m := NewManager(path)
+	m.Handle("count", stepRunner(30, &reached))
+	task, _ := m.Start("count", "Drive backup", "slack", "C1", map[string]string{"folder": "root1"})
+	waitFor(t, "progress", func() bool { return reached.Load() >= 3 })
+	m.Stop()
+
+	var runs []Task
+	next := NewManager(path)
+	defer next.Stop()
+	next.Handle("count", func(ctx context.Context, run *Run) (string, error) {
+		runs = append(runs, run.Task)
+		return stepRunner(30, &reached)(ctx, run)
+	})
+	stored, ok := next.Find("slack", "C1", task.ID)
+	if !ok || stored.Status != Running || stored.Done < 3 {
+		t.Fatalf("task not kept as running: %+v", stored)
+	}
+	next.Restore()
+	done, ok := next.Wait(task.ID, 5*time.Second)
+	if !ok || done.Status != Done || done.Runs != 2 {
+		t.Fatalf("unexpected task after restore: %+v", done)
+	}
+	if len(runs) != 1 || runs[0].Data["folder"] != "root1" {
+		t.Errorf("unexpected restored runs: %+v", runs)
+	}
+	if text := Describe(done); !strings.Contains(text, "Drive backup") || !strings.Contains(text, "resumed 1 time(s)") {
+		t.Errorf("unexpected description: %s", text)
+	}
+}
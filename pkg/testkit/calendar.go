@@ -0,0 +1,329 @@
+package testkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is an event in a fake calendar.
+type Event struct {
+	// ID is assigned by AddEvent when empty
+	ID string
+	// CalendarID defaults to "primary"
+	CalendarID  string
+	ICalUID     string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	// EventType is "focusTime", "outOfOffice" or "workingLocation" for
+	// those special events, empty for ordinary ones
+	EventType string
+	// WorkingLocation is "home" or the office or place label of a
+	// working location event
+	WorkingLocation string
+	// AutoDeclineMode is the autoDeclineMode of focus time and out of
+	// office events
+	AutoDeclineMode string
+	// Organizer is the organizer's email; empty means the account's own
+	Organizer string
+	Attendees []Attendee
+}
+
+// Attendee is someone invited to an Event. Self marks the account's own
+// entry; Response is needsAction, accepted, tentative or declined.
+type Attendee struct {
+	Email    string
+	Response string
+	Self     bool
+}
+
+// Calendar is an entry in the fake calendar list. Primary is always
+// listed first, colored "#039be5".
+type Calendar struct {
+	ID      string
+	Summary string
+	// Color is the background color, "#rrggbb"
+	Color string
+	// Hidden calendars are listed but not selected
+	Hidden bool
+}
+
+// AddCalendar adds a calendar to the calendar list.
+func (g *Google) AddCalendar(c Calendar) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calendars = append(g.calendars, c)
+}
+
+// AddEvent puts an event in a calendar and returns its ID.
+func (g *Google) AddEvent(e Event) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.addEvent(&e).ID
+}
+
+// Events returns a copy of the events in calendarID ("" for primary), in
+// start order.
+func (g *Google) Events(calendarID string) []Event {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var events []Event
+	for _, e := range g.events {
+		if e.CalendarID == calendarID {
+			events = append(events, *e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
+
+func (g *Google) addEvent(e *Event) *Event {
+	if e.ID == "" {
+		e.ID = g.newID("event")
+	}
+	if e.CalendarID == "" {
+		e.CalendarID = "primary"
+	}
+	if e.ICalUID == "" {
+		e.ICalUID = e.ID + "@google.com"
+	}
+	g.events = append(g.events, e)
+	return e
+}
+
+type calTime struct {
+	Date     string `json:"date,omitempty"`
+	DateTime string `json:"dateTime,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+func (t calTime) parse() (time.Time, bool) {
+	if t.Date != "" {
+		d, _ := time.Parse("2006-01-02", t.Date)
+		return d, true
+	}
+	d, _ := time.Parse(time.RFC3339, t.DateTime)
+	if loc, err := time.LoadLocation(t.TimeZone); err == nil && t.TimeZone != "" {
+		d = d.In(loc)
+	}
+	return d, false
+}
+
+type calEvent struct {
+	ID          string  `json:"id,omitempty"`
+	ICalUID     string  `json:"iCalUID,omitempty"`
+	Summary     string  `json:"summary"`
+	Description string  `json:"description,omitempty"`
+	Location    string  `json:"location,omitempty"`
+	Start       calTime `json:"start"`
+	End         calTime `json:"end"`
+	HTMLLink    string  `json:"htmlLink,omitempty"`
+	Status      string  `json:"status,omitempty"`
+
+	Organizer *calPerson    `json:"organizer,omitempty"`
+	Attendees []calAttendee `json:"attendees,omitempty"`
+
+	EventType                 string           `json:"eventType,omitempty"`
+	OutOfOfficeProperties     *calStatusProps  `json:"outOfOfficeProperties,omitempty"`
+	FocusTimeProperties       *calStatusProps  `json:"focusTimeProperties,omitempty"`
+	WorkingLocationProperties *calWorkLocation `json:"workingLocationProperties,omitempty"`
+}
+
+type calPerson struct {
+	Email string `json:"email"`
+	Self  bool   `json:"self,omitempty"`
+}
+
+type calAttendee struct {
+	Email          string `json:"email"`
+	Self           bool   `json:"self,omitempty"`
+	ResponseStatus string `json:"responseStatus,omitempty"`
+}
+
+type calStatusProps struct {
+	AutoDeclineMode string `json:"autoDeclineMode,omitempty"`
+}
+
+type calWorkLocation struct {
+	Type           string `json:"type"`
+	OfficeLocation *struct {
+		Label string `json:"label"`
+	} `json:"officeLocation,omitempty"`
+	CustomLocation *struct {
+		Label string `json:"label"`
+	} `json:"customLocation,omitempty"`
+}
+
+// workingLocation reads the location of a working location event the way
+// Event.WorkingLocation holds it.
+func (w *calWorkLocation) workingLocation() string {
+	switch {
+	case w == nil:
+		return ""
+	case w.OfficeLocation != nil:
+		return w.OfficeLocation.Label
+	case w.CustomLocation != nil:
+		return w.CustomLocation.Label
+	}
+	return "home"
+}
+
+func calResource(e *Event) calEvent {
+	toCal := func(t time.Time) calTime {
+		if e.AllDay {
+			return calTime{Date: t.Format("2006-01-02")}
+		}
+		return calTime{DateTime: t.Format(time.RFC3339)}
+	}
+	ev := calEvent{
+		ID:          e.ID,
+		ICalUID:     e.ICalUID,
+		Summary:     e.Summary,
+		Description: e.Description,
+		Location:    e.Location,
+		Start:       toCal(e.Start),
+		End:         toCal(e.End),
+		HTMLLink:    "https://www.google.com/calendar/event?eid=" + url.QueryEscape(e.ID),
+		Status:      "confirmed",
+		EventType:   e.EventType,
+		Organizer:   &calPerson{Email: "me@example.com", Self: true},
+	}
+	if e.Organizer != "" {
+		ev.Organizer = &calPerson{Email: e.Organizer}
+	}
+	for _, a := range e.Attendees {
+		ev.Attendees = append(ev.Attendees, calAttendee{Email: a.Email, Self: a.Self, ResponseStatus: a.Response})
+	}
+	switch e.EventType {
+	case "outOfOffice":
+		ev.OutOfOfficeProperties = &calStatusProps{AutoDeclineMode: e.AutoDeclineMode}
+	case "focusTime":
+		ev.FocusTimeProperties = &calStatusProps{AutoDeclineMode: e.AutoDeclineMode}
+	case "workingLocation":
+		ev.WorkingLocationProperties = &calWorkLocation{Type: "homeOffice"}
+		if e.WorkingLocation != "home" {
+			ev.WorkingLocationProperties = &calWorkLocation{Type: "customLocation", CustomLocation: &struct {
+				Label string `json:"label"`
+			}{e.WorkingLocation}}
+		}
+	}
+	return ev
+}
+
+func (g *Google) serveCalendar(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	if path == "/users/me/calendarList" && r.Method == http.MethodGet {
+		items := []map[string]interface{}{{
+			"id": "primary", "summary": "me@example.com", "backgroundColor": "#039be5", "primary": true, "selected": true,
+		}}
+		for _, c := range g.calendars {
+			items = append(items, map[string]interface{}{
+				"id": c.ID, "summary": c.Summary, "backgroundColor": c.Color, "selected": !c.Hidden,
+			})
+		}
+		writeJSON(w, map[string]interface{}{"kind": "calendar#calendarList", "items": items})
+		return
+	}
+	rest, ok := strings.CutPrefix(path, "/calendars/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "testkit: no fake for "+r.Method+" calendar "+path)
+		return
+	}
+	rawID, action, _ := strings.Cut(rest, "/")
+	calendarID, _ := url.PathUnescape(rawID)
+
+	switch {
+	case action == "events" && r.Method == http.MethodGet:
+		g.listEvents(w, r, calendarID)
+	case (action == "events" || action == "events/import") && r.Method == http.MethodPost:
+		var in calEvent
+		if err := json.Unmarshal(body, &in); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		start, allDay := in.Start.parse()
+		end, _ := in.End.parse()
+		e := &Event{
+			CalendarID:  calendarID,
+			ICalUID:     in.ICalUID,
+			Summary:     in.Summary,
+			Description: in.Description,
+			Location:    in.Location,
+			Start:       start,
+			End:         end,
+			AllDay:      allDay,
+
+			EventType:       in.EventType,
+			WorkingLocation: in.WorkingLocationProperties.workingLocation(),
+		}
+		if e.EventType == "default" {
+			e.EventType = ""
+		}
+		for _, a := range in.Attendees {
+			e.Attendees = append(e.Attendees, Attendee{Email: a.Email, Self: a.Self, Response: a.ResponseStatus})
+		}
+		for _, props := range []*calStatusProps{in.OutOfOfficeProperties, in.FocusTimeProperties} {
+			if props != nil {
+				e.AutoDeclineMode = props.AutoDeclineMode
+			}
+		}
+		// events.import updates the event with the same iCalUID
+		if action == "events/import" {
+			for _, existing := range g.events {
+				if existing.CalendarID == calendarID && existing.ICalUID == in.ICalUID {
+					e.ID = existing.ID
+					*existing = *e
+					writeJSON(w, calResource(existing))
+					return
+				}
+			}
+		}
+		writeJSON(w, calResource(g.addEvent(e)))
+	case strings.HasPrefix(action, "events/") && r.Method == http.MethodDelete:
+		eventID, _ := url.PathUnescape(strings.TrimPrefix(action, "events/"))
+		for i, e := range g.events {
+			if e.CalendarID == calendarID && e.ID == eventID {
+				g.events = append(g.events[:i], g.events[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Not Found")
+	default:
+		writeError(w, http.StatusNotFound, "testkit: no fake for "+r.Method+" calendar "+path)
+	}
+}
+
+func (g *Google) listEvents(w http.ResponseWriter, r *http.Request, calendarID string) {
+	q := r.URL.Query()
+	from, _ := time.Parse(time.RFC3339, q.Get("timeMin"))
+	to, _ := time.Parse(time.RFC3339, q.Get("timeMax"))
+	var matches []*Event
+	for _, e := range g.events {
+		if e.CalendarID != calendarID {
+			continue
+		}
+		if !to.IsZero() && !e.Start.Before(to) || !from.IsZero() && !e.End.After(from) {
+			continue
+		}
+		if text := q.Get("q"); text != "" && !containsFold(e.Summary+" "+e.Description+" "+e.Location, text) {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Start.Before(matches[j].Start) })
+	items := make([]calEvent, len(matches))
+	for i, e := range matches {
+		items[i] = calResource(e)
+	}
+	writeJSON(w, map[string]interface{}{"kind": "calendar#events", "items": items})
+}
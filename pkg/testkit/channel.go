@@ -0,0 +1,145 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// ChannelName is the channel simulated chats use.
+const ChannelName = "testkit"
+
+// Chat simulates a chat app connected to an agent through the message
+// bus: Send publishes a user message as a channel would, and replies the
+// agent publishes for this chat are collected for Expect.
+type Chat struct {
+	t      testing.TB
+	bus    *bus.MessageBus
+	chatID string
+
+	// Timeout bounds how long Expect waits for a reply
+	Timeout time.Duration
+	// SenderID is the user messages come from
+	SenderID string
+
+	mu      sync.Mutex
+	replies []bus.OutboundMessage
+	arrived chan struct{}
+}
+
+// NewChat starts collecting the replies published on msgBus for chatID.
+// Collection stops when the test ends. Only one Chat per bus should run,
+// since each outbound message is delivered to a single subscriber.
+func NewChat(t testing.TB, msgBus *bus.MessageBus, chatID string) *Chat {
+	t.Helper()
+	c := &Chat{
+		t:        t,
+		bus:      msgBus,
+		chatID:   chatID,
+		Timeout:  5 * time.Second,
+		SenderID: "testkit-user",
+		arrived:  make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	go c.collect(ctx, done)
+	return c
+}
+
+func (c *Chat) collect(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for {
+		msg, ok := c.bus.SubscribeOutbound(ctx)
+		if !ok {
+			return
+		}
+		if msg.Channel != ChannelName || msg.ChatID != c.chatID {
+			continue
+		}
+		c.mu.Lock()
+		c.replies = append(c.replies, msg)
+		c.mu.Unlock()
+		select {
+		case c.arrived <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Send publishes content as a message from SenderID in this chat.
+func (c *Chat) Send(content string) {
+	c.SendMessage(bus.InboundMessage{Content: content})
+}
+
+// SendMessage publishes msg, filling in the channel, chat, sender and
+// session key when they are empty.
+func (c *Chat) SendMessage(msg bus.InboundMessage) {
+	msg.Channel = ChannelName
+	msg.ChatID = c.chatID
+	if msg.SenderID == "" {
+		msg.SenderID = c.SenderID
+	}
+	if msg.SessionKey == "" {
+		msg.SessionKey = fmt.Sprintf("%s:%s", ChannelName, c.chatID)
+	}
+	c.bus.PublishInbound(msg)
+}
+
+// Next waits for the next reply not returned yet. It fails the test when
+// none arrives within Timeout.
+func (c *Chat) Next() bus.OutboundMessage {
+	c.t.Helper()
+	deadline := time.NewTimer(c.Timeout)
+	defer deadline.Stop()
+	for {
+		c.mu.Lock()
+		if len(c.replies) > 0 {
+			msg := c.replies[0]
+			c.replies = c.replies[1:]
+			c.mu.Unlock()
+			return msg
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.arrived:
+		case <-deadline.C:
+			c.t.Fatalf("testkit: no reply in chat %s after %s", c.chatID, c.Timeout)
+			return bus.OutboundMessage{}
+		}
+	}
+}
+
+// Expect waits for the next reply and returns its content.
+func (c *Chat) Expect() string {
+	c.t.Helper()
+	return c.Next().Content
+}
+
+// Ask sends content and waits for the reply.
+func (c *Chat) Ask(content string) string {
+	c.t.Helper()
+	c.Send(content)
+	return c.Expect()
+}
+
+// ExpectNone fails the test if a reply arrives within d.
+func (c *Chat) ExpectNone(d time.Duration) {
+	c.t.Helper()
+	select {
+	case <-c.arrived:
+	case <-time.After(d):
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.replies) > 0 {
+		c.t.Fatalf("testkit: unexpected reply in chat %s: %q", c.chatID, c.replies[0].Content)
+	}
+}
@@ -0,0 +1,737 @@
+package testkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Email is a message in the fake mailbox.
+type Email struct {
+	// ID is assigned by AddEmail when empty
+	ID      string
+	From    string
+	To      string
+	Cc      string
+	Subject string
+	// MessageID is the Message-ID header, "<ID@testkit>" when empty
+	MessageID string
+	// Body is the text/plain body; HTML, when set, is sent alongside it
+	Body   string
+	HTML   string
+	Date   time.Time
+	Labels []string
+	// Thread groups messages into one conversation; empty means the
+	// message starts its own
+	Thread string
+	// Attachments are served through the attachments endpoint, as Gmail
+	// does for all but the smallest files
+	Attachments []Attachment
+	// Raw is the message as a client sent it through messages.send
+	Raw []byte
+	// ListUnsubscribe and ListUnsubscribePost are the mailing-list
+	// headers, sent when set
+	ListUnsubscribe     string
+	ListUnsubscribePost string
+	// Headers are sent in addition to the ones above, e.g. Reply-To or
+	// Authentication-Results
+	Headers map[string]string
+}
+
+// Attachment is a file attached to an Email.
+type Attachment struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// AddEmail puts a message in the mailbox and returns its ID. A zero Date
+// becomes the current time.
+func (g *Google) AddEmail(e Email) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if e.ID == "" {
+		e.ID = g.newID("msg")
+	}
+	if e.Date.IsZero() {
+		e.Date = time.Now()
+	}
+	g.emails = append(g.emails, &e)
+	return e.ID
+}
+
+// SendAs is an address the account can send from, as in Gmail's
+// settings.sendAs.
+type SendAs struct {
+	Email       string
+	DisplayName string
+	ReplyTo     string
+	Default     bool
+	// Unverified aliases are listed but cannot be sent from
+	Unverified bool
+}
+
+// AddSendAs adds an address to the account's send-as list.
+func (g *Google) AddSendAs(a SendAs) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sendAs = append(g.sendAs, a)
+}
+
+// Filter is a Gmail filter created through settings.filters, or put in
+// place with AddFilter.
+type Filter struct {
+	ID           string
+	From         string
+	Query        string
+	AddLabels    []string
+	RemoveLabels []string
+	// Forward is the address matching mail is forwarded to
+	Forward string
+}
+
+// AddFilter puts a filter in the mailbox settings, as if the user (or
+// someone with their password) made it, and returns its ID.
+func (g *Google) AddFilter(f Filter) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f.ID = g.newID("filter")
+	g.filters = append(g.filters, f)
+	return f.ID
+}
+
+// SetAutoForwarding forwards all mail to address, which is added to the
+// verified forwarding addresses; "" turns forwarding off.
+func (g *Google) SetAutoForwarding(address string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.autoForward = address
+	if address != "" {
+		g.forwarding = append(g.forwarding, address)
+	}
+}
+
+func (g *Google) listFilters(w http.ResponseWriter) {
+	filters := make([]map[string]interface{}, len(g.filters))
+	for i, f := range g.filters {
+		action := map[string]interface{}{}
+		if len(f.AddLabels) > 0 {
+			action["addLabelIds"] = f.AddLabels
+		}
+		if len(f.RemoveLabels) > 0 {
+			action["removeLabelIds"] = f.RemoveLabels
+		}
+		if f.Forward != "" {
+			action["forward"] = f.Forward
+		}
+		criteria := map[string]string{}
+		if f.From != "" {
+			criteria["from"] = f.From
+		}
+		if f.Query != "" {
+			criteria["query"] = f.Query
+		}
+		filters[i] = map[string]interface{}{"id": f.ID, "criteria": criteria, "action": action}
+	}
+	writeJSON(w, map[string]interface{}{"filter": filters})
+}
+
+func (g *Google) getAutoForwarding(w http.ResponseWriter) {
+	if g.autoForward == "" {
+		writeJSON(w, map[string]interface{}{"enabled": false})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"enabled": true, "emailAddress": g.autoForward, "disposition": "archive"})
+}
+
+func (g *Google) listForwardingAddresses(w http.ResponseWriter) {
+	addresses := make([]map[string]string, len(g.forwarding))
+	for i, a := range g.forwarding {
+		addresses[i] = map[string]string{"forwardingEmail": a, "verificationStatus": "accepted"}
+	}
+	writeJSON(w, map[string]interface{}{"forwardingAddresses": addresses})
+}
+
+// Filters returns the filters created so far.
+func (g *Google) Filters() []Filter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Filter(nil), g.filters...)
+}
+
+func (g *Google) createFilter(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Criteria struct {
+			From string `json:"from"`
+		} `json:"criteria"`
+		Action struct {
+			AddLabelIDs    []string `json:"addLabelIds"`
+			RemoveLabelIDs []string `json:"removeLabelIds"`
+		} `json:"action"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Criteria.From == "" {
+		writeError(w, http.StatusBadRequest, "testkit: a filter needs criteria.from")
+		return
+	}
+	f := Filter{ID: g.newID("filter"), From: req.Criteria.From, AddLabels: req.Action.AddLabelIDs, RemoveLabels: req.Action.RemoveLabelIDs}
+	g.filters = append(g.filters, f)
+	writeJSON(w, map[string]interface{}{"id": f.ID, "criteria": req.Criteria, "action": req.Action})
+}
+
+// modifyEmail adds and removes labels, as messages.modify does.
+func (g *Google) modifyEmail(w http.ResponseWriter, id string, body []byte) {
+	e := g.findEmail(id)
+	if e == nil {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	var req struct {
+		AddLabelIDs    []string `json:"addLabelIds"`
+		RemoveLabelIDs []string `json:"removeLabelIds"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	labels := e.Labels
+	if labels == nil {
+		labels = []string{"INBOX"}
+	}
+	kept := []string{}
+	for _, l := range labels {
+		if !containsString(req.RemoveLabelIDs, l) {
+			kept = append(kept, l)
+		}
+	}
+	for _, l := range req.AddLabelIDs {
+		if !containsString(kept, l) {
+			kept = append(kept, l)
+		}
+	}
+	e.Labels = kept
+	writeJSON(w, gmailResource(e))
+}
+
+// Sent returns the messages sent through the API, oldest first.
+func (g *Google) Sent() []Email {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var sent []Email
+	for _, e := range g.emails {
+		if e.Raw != nil {
+			sent = append(sent, *e)
+		}
+	}
+	return sent
+}
+
+var gmailOrGroup = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// matchesGmailQuery implements the part of Gmail's search syntax the tools
+// use: free words match the subject, sender and body; from:, to:,
+// subject:, label:, filename: and has:attachment filter on fields,
+// is:unread/starred/important on the matching label, and after:/before:
+// on the date (seconds since the epoch or yyyy/mm/dd), and {a b} matches
+// when any of its terms does; other operators (newer_than:, in:, ...) are
+// ignored.
+func matchesGmailQuery(e *Email, query string) bool {
+	for _, group := range gmailOrGroup.FindAllStringSubmatch(query, -1) {
+		found := false
+		for _, term := range strings.Fields(group[1]) {
+			found = found || matchesGmailQuery(e, term)
+		}
+		if !found {
+			return false
+		}
+	}
+	query = gmailOrGroup.ReplaceAllString(query, " ")
+	for _, term := range strings.Fields(query) {
+		term = strings.Trim(term, `"()`)
+		key, value, hasOp := strings.Cut(term, ":")
+		if !hasOp {
+			if !containsFold(e.Subject+" "+e.From+" "+e.Body+" "+e.HTML, term) {
+				return false
+			}
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "from":
+			if !containsFold(e.From, value) {
+				return false
+			}
+		case "to":
+			if !containsFold(e.To, value) {
+				return false
+			}
+		case "subject":
+			if !containsFold(e.Subject, value) {
+				return false
+			}
+		case "label":
+			found := false
+			for _, l := range e.Labels {
+				found = found || strings.EqualFold(l, value)
+			}
+			if !found {
+				return false
+			}
+		case "is":
+			found := false
+			for _, l := range e.Labels {
+				found = found || strings.EqualFold(l, value)
+			}
+			if !found {
+				return false
+			}
+		case "has":
+			if value == "attachment" && len(e.Attachments) == 0 {
+				return false
+			}
+		case "after", "before":
+			var bound time.Time
+			if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+				bound = time.Unix(secs, 0)
+			} else if d, err := time.Parse("2006/01/02", value); err == nil {
+				bound = d
+			}
+			if key == "after" && !e.Date.After(bound) || key == "before" && !e.Date.Before(bound) {
+				return false
+			}
+		case "filename":
+			found := false
+			for _, a := range e.Attachments {
+				found = found || containsFold(a.Filename, value)
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (g *Google) serveGmail(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	const prefix = "/users/me/messages"
+	switch {
+	case r.Method == http.MethodGet && path == "/users/me/settings/sendAs":
+		g.listSendAs(w)
+		return
+	case r.Method == http.MethodPost && path == prefix+"/send":
+		g.sendEmail(w, body)
+		return
+	case r.Method == http.MethodPost && path == "/users/me/drafts":
+		g.createDraft(w, body)
+		return
+	case r.Method == http.MethodGet && path == "/users/me/labels":
+		g.listLabels(w)
+		return
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/users/me/threads/"):
+		g.getThread(w, strings.TrimPrefix(path, "/users/me/threads/"))
+		return
+	case r.Method == http.MethodGet && path == "/users/me/settings/filters":
+		g.listFilters(w)
+		return
+	case r.Method == http.MethodGet && path == "/users/me/settings/autoForwarding":
+		g.getAutoForwarding(w)
+		return
+	case r.Method == http.MethodGet && path == "/users/me/settings/forwardingAddresses":
+		g.listForwardingAddresses(w)
+		return
+	case r.Method == http.MethodPost && path == "/users/me/settings/filters":
+		g.createFilter(w, body)
+		return
+	case r.Method == http.MethodPost && strings.HasPrefix(path, prefix+"/") && strings.HasSuffix(path, "/modify"):
+		g.modifyEmail(w, strings.TrimSuffix(strings.TrimPrefix(path, prefix+"/"), "/modify"), body)
+		return
+	}
+	if r.Method != http.MethodGet || !strings.HasPrefix(path, prefix) {
+		writeError(w, http.StatusNotFound, "testkit: no fake for "+r.Method+" gmail "+path)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		g.listEmails(w, r)
+		return
+	}
+	parts := strings.Split(rest, "/")
+	e := g.findEmail(parts[0])
+	if e == nil {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	if len(parts) == 3 && parts[1] == "attachments" {
+		idx, err := strconv.Atoi(strings.TrimPrefix(parts[2], "att-"))
+		if err != nil || idx < 0 || idx >= len(e.Attachments) {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"data": base64.URLEncoding.EncodeToString(e.Attachments[idx].Data),
+			"size": len(e.Attachments[idx].Data),
+		})
+		return
+	}
+	writeJSON(w, gmailResource(e))
+}
+
+func (g *Google) listSendAs(w http.ResponseWriter) {
+	list := []map[string]interface{}{}
+	for _, a := range g.sendAs {
+		status := "accepted"
+		if a.Unverified {
+			status = "pending"
+		}
+		list = append(list, map[string]interface{}{
+			"sendAsEmail":        a.Email,
+			"displayName":        a.DisplayName,
+			"replyToAddress":     a.ReplyTo,
+			"isDefault":          a.Default,
+			"verificationStatus": status,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"sendAs": list})
+}
+
+// rawMessage is a message as clients pass it to messages.send and
+// drafts.create.
+type rawMessage struct {
+	Raw      string `json:"raw"`
+	ThreadID string `json:"threadId"`
+}
+
+// sendEmail stores a sent message, refusing a From address that is not
+// in the send-as list (when one is set up) as Gmail does.
+func (g *Google) sendEmail(w http.ResponseWriter, body []byte) {
+	var req rawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "testkit: bad send body: "+err.Error())
+		return
+	}
+	e, msg := parseRaw(w, req)
+	if e == nil {
+		return
+	}
+	from, _ := mail.ParseAddress(msg.Header.Get("From"))
+	// Without a From header Gmail sends from the default address
+	if len(g.sendAs) > 0 && msg.Header.Get("From") != "" {
+		allowed := false
+		for _, a := range g.sendAs {
+			allowed = allowed || (from != nil && strings.EqualFold(a.Email, from.Address) && !a.Unverified)
+		}
+		if !allowed {
+			writeError(w, http.StatusBadRequest, "Invalid From header")
+			return
+		}
+	}
+	e.ID = g.newID("msg")
+	e.Labels = []string{"SENT"}
+	g.emails = append(g.emails, e)
+	thread := e.Thread
+	if thread == "" {
+		thread = e.ID
+	}
+	writeJSON(w, map[string]interface{}{"id": e.ID, "threadId": thread, "labelIds": e.Labels})
+}
+
+// createDraft stores a draft; drafts are listed by Drafts and not sent.
+func (g *Google) createDraft(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Message rawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "testkit: bad draft body: "+err.Error())
+		return
+	}
+	e, _ := parseRaw(w, req.Message)
+	if e == nil {
+		return
+	}
+	e.ID = g.newID("draft")
+	e.Labels = []string{"DRAFT"}
+	g.drafts = append(g.drafts, e)
+	writeJSON(w, map[string]interface{}{"id": e.ID, "message": map[string]interface{}{"id": e.ID, "threadId": e.Thread}})
+}
+
+// Drafts returns the drafts created through the API, oldest first.
+func (g *Google) Drafts() []Email {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	drafts := make([]Email, len(g.drafts))
+	for i, e := range g.drafts {
+		drafts[i] = *e
+	}
+	return drafts
+}
+
+// getThread answers threads.get with the thread's messages, oldest first.
+func (g *Google) getThread(w http.ResponseWriter, id string) {
+	var messages []*Email
+	for _, e := range g.emails {
+		if e.Thread == id || e.Thread == "" && e.ID == id {
+			messages = append(messages, e)
+		}
+	}
+	if len(messages) == 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Date.Before(messages[j].Date) })
+	resources := make([]map[string]interface{}, len(messages))
+	for i, e := range messages {
+		resources[i] = gmailResource(e)
+	}
+	writeJSON(w, map[string]interface{}{"id": id, "messages": resources})
+}
+
+// parseRaw decodes a message a client passed, answering w with an error
+// and returning nil when it is malformed.
+func parseRaw(w http.ResponseWriter, req rawMessage) (*Email, *mail.Message) {
+	raw, err := base64.URLEncoding.DecodeString(req.Raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid raw message: "+err.Error())
+		return nil, nil
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid raw message: "+err.Error())
+		return nil, nil
+	}
+	text, _ := io.ReadAll(msg.Body)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	return &Email{
+		From:      msg.Header.Get("From"),
+		To:        msg.Header.Get("To"),
+		Cc:        msg.Header.Get("Cc"),
+		Subject:   subject,
+		MessageID: msg.Header.Get("Message-ID"),
+		Body:      string(text),
+		Date:      time.Now(),
+		Thread:    req.ThreadID,
+		Raw:       raw,
+	}, msg
+}
+
+// Labels returns the labels of message id, as changed through
+// messages.modify; nil means the message was never moved.
+func (g *Google) Labels(id string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if e := g.findEmail(id); e != nil {
+		return append([]string(nil), e.Labels...)
+	}
+	return nil
+}
+
+func (g *Google) findEmail(id string) *Email {
+	for _, e := range g.emails {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// listLabels lists the labels the mailbox's messages carry, each with its
+// name as its ID; INBOX and the other upper-case ones are system labels.
+func (g *Google) listLabels(w http.ResponseWriter) {
+	seen := map[string]bool{"INBOX": true}
+	for _, e := range g.emails {
+		for _, l := range e.Labels {
+			seen[l] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for l := range seen {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	labels := make([]map[string]string, len(names))
+	for i, l := range names {
+		kind := "user"
+		if l == strings.ToUpper(l) {
+			kind = "system"
+		}
+		labels[i] = map[string]string{"id": l, "name": l, "type": kind}
+	}
+	writeJSON(w, map[string]interface{}{"labels": labels})
+}
+
+func (g *Google) listEmails(w http.ResponseWriter, r *http.Request) {
+	max, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if max <= 0 {
+		max = 100
+	}
+	var matches []*Email
+	for _, e := range g.emails {
+		if matchesGmailQuery(e, r.URL.Query().Get("q")) {
+			matches = append(matches, e)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Date.After(matches[j].Date) })
+	if len(matches) > max {
+		matches = matches[:max]
+	}
+	ids := make([]map[string]string, len(matches))
+	for i, e := range matches {
+		thread := e.Thread
+		if thread == "" {
+			thread = e.ID
+		}
+		ids[i] = map[string]string{"id": e.ID, "threadId": thread}
+	}
+	writeJSON(w, map[string]interface{}{"messages": ids, "resultSizeEstimate": len(ids)})
+}
+
+type gmailBody struct {
+	Data         string `json:"data,omitempty"`
+	AttachmentID string `json:"attachmentId,omitempty"`
+	Size         int    `json:"size"`
+}
+
+type gmailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type gmailPart struct {
+	MimeType string        `json:"mimeType"`
+	Filename string        `json:"filename"`
+	Headers  []gmailHeader `json:"headers,omitempty"`
+	Body     gmailBody     `json:"body"`
+	Parts    []gmailPart   `json:"parts,omitempty"`
+}
+
+func textPart(mimeType, text string) gmailPart {
+	return gmailPart{MimeType: mimeType, Body: gmailBody{Data: base64.URLEncoding.EncodeToString([]byte(text)), Size: len(text)}}
+}
+
+// gmailResource renders e the way users.messages.get does with
+// format=full. The metadata format is the same minus bodies, which the
+// clients ignore anyway.
+func gmailResource(e *Email) map[string]interface{} {
+	payload := textPart("text/plain", e.Body)
+	if e.HTML != "" || len(e.Attachments) > 0 {
+		payload = gmailPart{MimeType: "multipart/mixed"}
+		if e.Body != "" {
+			payload.Parts = append(payload.Parts, textPart("text/plain", e.Body))
+		}
+		if e.HTML != "" {
+			payload.Parts = append(payload.Parts, textPart("text/html", e.HTML))
+		}
+		for i, a := range e.Attachments {
+			payload.Parts = append(payload.Parts, gmailPart{
+				MimeType: a.MimeType,
+				Filename: a.Filename,
+				Body:     gmailBody{AttachmentID: fmt.Sprintf("att-%d", i), Size: len(a.Data)},
+			})
+		}
+	}
+	messageID := e.MessageID
+	if messageID == "" {
+		messageID = "<" + e.ID + "@testkit>"
+	}
+	payload.Headers = []gmailHeader{
+		{"From", e.From},
+		{"To", e.To},
+		{"Cc", e.Cc},
+		{"Subject", e.Subject},
+		{"Message-ID", messageID},
+		{"Date", e.Date.Format(time.RFC1123Z)},
+	}
+	if e.ListUnsubscribe != "" {
+		payload.Headers = append(payload.Headers, gmailHeader{"List-Unsubscribe", e.ListUnsubscribe})
+	}
+	if e.ListUnsubscribePost != "" {
+		payload.Headers = append(payload.Headers, gmailHeader{"List-Unsubscribe-Post", e.ListUnsubscribePost})
+	}
+	names := make([]string, 0, len(e.Headers))
+	for name := range e.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		payload.Headers = append(payload.Headers, gmailHeader{name, e.Headers[name]})
+	}
+	snippet := e.Body
+	if len(snippet) > 100 {
+		snippet = snippet[:100]
+	}
+	labels := e.Labels
+	if labels == nil {
+		labels = []string{"INBOX"}
+	}
+	thread := e.Thread
+	if thread == "" {
+		thread = e.ID
+	}
+	return map[string]interface{}{
+		"id":           e.ID,
+		"threadId":     thread,
+		"labelIds":     labels,
+		"snippet":      snippet,
+		"internalDate": strconv.FormatInt(e.Date.UnixMilli(), 10),
+		"payload":      payload,
+	}
+}
+
+// serveBatch answers a Gmail batch call: a multipart/mixed body of
+// application/http sub-requests, each served as if sent on its own (and
+// subject to FailNext), answered in a multipart/mixed response.
+func (g *Google) serveBatch(w http.ResponseWriter, r *http.Request, body []byte) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != http.MethodPost || err != nil || params["boundary"] == "" {
+		writeError(w, http.StatusBadRequest, "testkit: batch calls are POSTs of multipart/mixed")
+		return
+	}
+	var out bytes.Buffer
+	mw := multipart.NewWriter(&out)
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "testkit: bad batch body: "+err.Error())
+			return
+		}
+		line, _ := bufio.NewReader(part).ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "/gmail/v1/") {
+			writeError(w, http.StatusBadRequest, "testkit: no fake for batch sub-request "+strings.TrimSpace(line))
+			return
+		}
+		sub := httptest.NewRequest(fields[0], fields[1], nil)
+		rec := httptest.NewRecorder()
+		if status := g.injectedFailure(sub.URL.Path); status != 0 {
+			writeError(rec, status, "injected failure")
+		} else {
+			g.serveGmail(rec, sub, strings.TrimPrefix(sub.URL.Path, "/gmail/v1"), nil)
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-ID", "<response-"+strings.Trim(part.Header.Get("Content-ID"), "<>")+">")
+		pw, _ := mw.CreatePart(header)
+		fmt.Fprintf(pw, "HTTP/1.1 %d %s\r\n", rec.Code, http.StatusText(rec.Code))
+		rec.Header().Write(pw)
+		fmt.Fprintf(pw, "\r\n%s", rec.Body.Bytes())
+	}
+	mw.Close()
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.Write(out.Bytes())
+}
@@ -0,0 +1,250 @@
+package testkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Google is a fake of the Google APIs picoclaw uses, backed by fixtures
+// held in memory. Writes made through the API (uploads, new events, new
+// albums) land in the same fixtures, so a test can assert on them.
+//
+// Requests reach it either through Install, which reroutes every
+// *.googleapis.com and *.googleusercontent.com request in the process, or
+// through a client built with Transport.
+type Google struct {
+	t      testing.TB
+	server *httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	requests []Request
+	failures map[failure]int
+
+	emails  []*Email
+	drafts  []*Email
+	sendAs  []SendAs
+	filters []Filter
+	// forwarding are the verified forwarding addresses, autoForward the
+	// one all mail goes to ("" when off)
+	forwarding  []string
+	autoForward string
+	apps        []App
+	files       []*File
+	events      []*Event
+	// calendars are the ones besides primary in the calendar list
+	calendars []Calendar
+	media     []*MediaItem
+	albums    []*Album
+	uploads   map[string]uploadedBytes
+	// sessions are resumable uploads in progress, by upload ID
+	sessions map[string]*uploadSession
+}
+
+// Request is a call the fake received.
+type Request struct {
+	Method string
+	// Host is the Google host the client addressed, e.g.
+	// "gmail.googleapis.com"
+	Host  string
+	Path  string
+	Query url.Values
+	Body  []byte
+}
+
+// NewGoogle starts a fake Google server that is shut down when the test
+// ends.
+func NewGoogle(t testing.TB) *Google {
+	t.Helper()
+	g := &Google{t: t, failures: map[failure]int{}, uploads: map[string]uploadedBytes{}, sessions: map[string]*uploadSession{}}
+	g.server = httptest.NewServer(http.HandlerFunc(g.serve))
+	t.Cleanup(g.server.Close)
+	return g
+}
+
+// URL is the base URL of the fake server.
+func (g *Google) URL() string {
+	return g.server.URL
+}
+
+// Transport returns a RoundTripper that sends Google requests to the fake
+// and everything else to base (http.DefaultTransport when nil).
+func (g *Google) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	target, _ := url.Parse(g.server.URL)
+	return &googleTransport{target: target, base: base}
+}
+
+// Install reroutes Google requests made with http.DefaultTransport (which
+// every picoclaw Google client uses) to the fake until the test ends.
+// Because it swaps a process-wide value, tests that call it must not run
+// in parallel.
+func (g *Google) Install() {
+	g.t.Helper()
+	previous := http.DefaultTransport
+	http.DefaultTransport = g.Transport(previous)
+	g.t.Cleanup(func() { http.DefaultTransport = previous })
+}
+
+// Requests returns the calls received so far, oldest first.
+func (g *Google) Requests() []Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Request(nil), g.requests...)
+}
+
+// FailNext makes the next n requests whose path (query included) contains
+// pathPart answer with status, to test error handling and retries. Chunks
+// of resumable uploads carry "upload_id=" in their query.
+func (g *Google) FailNext(pathPart string, n, status int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures[failure{pathPart, status}] = n
+}
+
+type failure struct {
+	pathPart string
+	status   int
+}
+
+type googleTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (rt *googleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if !strings.HasSuffix(host, ".googleapis.com") && !strings.HasSuffix(host, ".googleusercontent.com") {
+		return rt.base.RoundTrip(req)
+	}
+	out := req.Clone(req.Context())
+	out.URL.Scheme = rt.target.Scheme
+	out.URL.Host = rt.target.Host
+	out.Host = rt.target.Host
+	out.Header.Set("X-Testkit-Host", host)
+	return rt.base.RoundTrip(out)
+}
+
+func (g *Google) newID(prefix string) string {
+	g.nextID++
+	return fmt.Sprintf("%s-%d", prefix, g.nextID)
+}
+
+// serve answers under the lock into a recorder and sends the answer
+// after, so a client still reading a large download does not hold up
+// requests to the other services, as when copying from one to another.
+func (g *Google) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec := httptest.NewRecorder()
+	g.mu.Lock()
+	g.serveLocked(rec, r, body)
+	g.mu.Unlock()
+	for key, values := range rec.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+func (g *Google) serveLocked(w http.ResponseWriter, r *http.Request, body []byte) {
+	host := r.Header.Get("X-Testkit-Host")
+	g.requests = append(g.requests, Request{Method: r.Method, Host: host, Path: r.URL.Path, Query: r.URL.Query(), Body: body})
+	if status := g.injectedFailure(r.URL.RequestURI()); status != 0 {
+		writeError(w, status, "injected failure")
+		return
+	}
+	if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "Bearer ") && !strings.HasSuffix(host, ".googleusercontent.com") {
+		writeError(w, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/batch/"):
+		g.serveBatch(w, r, body)
+	case strings.HasPrefix(path, "/gmail/v1/"):
+		g.serveGmail(w, r, strings.TrimPrefix(path, "/gmail/v1"), body)
+	case strings.HasPrefix(path, "/drive/v3/"), strings.HasPrefix(path, "/upload/drive/v3/"):
+		g.serveDrive(w, r, path, body)
+	case strings.HasPrefix(path, "/calendar/v3/"):
+		g.serveCalendar(w, r, strings.TrimPrefix(path, "/calendar/v3"), body)
+	case strings.HasPrefix(path, "/v1/"):
+		g.servePhotos(w, r, strings.TrimPrefix(path, "/v1"), body)
+	case strings.HasPrefix(path, "/media/"):
+		g.serveMediaDownload(w, r, strings.TrimPrefix(path, "/media/"))
+	default:
+		writeError(w, http.StatusNotFound, "testkit: no fake for "+r.Method+" "+path)
+	}
+}
+
+// injectedFailure returns the status a FailNext set up for path, using
+// it up, or 0 when the request should be served.
+func (g *Google) injectedFailure(path string) int {
+	for f, n := range g.failures {
+		if n > 0 && strings.Contains(path, f.pathPart) {
+			g.failures[f] = n - 1
+			return f.status
+		}
+	}
+	return 0
+}
+
+// uploadSession is a resumable upload: the bytes received so far and,
+// once complete, the answer to give when asked again.
+type uploadSession struct {
+	total    int64
+	mimeType string
+	meta     []byte
+	data     []byte
+	final    []byte
+}
+
+func (g *Google) newSession(total int64, mimeType string, meta []byte) string {
+	id := g.newID("session")
+	g.sessions[id] = &uploadSession{total: total, mimeType: mimeType, meta: meta}
+	return id
+}
+
+// write stores chunk at offset, dropping anything received past it, as a
+// server does when a client resends after a lost answer.
+func (s *uploadSession) write(offset int64, chunk []byte) bool {
+	if offset > int64(len(s.data)) {
+		return false
+	}
+	s.data = append(s.data[:offset], chunk...)
+	return true
+}
+
+// Sessions returns the number of resumable uploads started so far.
+func (g *Google) Sessions() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.sessions)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the error format Google APIs use.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
+
+func containsFold(s, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
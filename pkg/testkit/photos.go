@@ -0,0 +1,438 @@
+package testkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaItem is a photo or video in the fake Photos library.
+type MediaItem struct {
+	// ID is assigned by AddMedia when empty
+	ID       string
+	Filename string
+	MimeType string
+	Created  time.Time
+	Data     []byte
+	// Categories are the content categories ("PETS", "RECEIPTS") search
+	// filters match
+	Categories  []string
+	CameraMake  string
+	CameraModel string
+	// Width and Height are reported in the metadata when set
+	Width, Height int
+	// Archived items are left out of library searches, though not album
+	// listings, unless the request sets includeArchivedMedia
+	Archived bool
+}
+
+// Album is an album in the fake Photos library.
+type Album struct {
+	ID    string
+	Title string
+	Items []string
+}
+
+type uploadedBytes struct {
+	mimeType string
+	data     []byte
+}
+
+// AddMedia puts an item in the library and returns its ID. A zero Created
+// becomes the current time; an empty MimeType becomes image/jpeg.
+func (g *Google) AddMedia(m MediaItem) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.addMedia(&m).ID
+}
+
+// Media returns a copy of every item in the library, uploads included.
+func (g *Google) Media() []MediaItem {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	items := make([]MediaItem, len(g.media))
+	for i, m := range g.media {
+		items[i] = *m
+	}
+	return items
+}
+
+// AddAlbum creates an album holding itemIDs and returns its ID.
+func (g *Google) AddAlbum(title string, itemIDs ...string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	a := &Album{ID: g.newID("album"), Title: title, Items: itemIDs}
+	g.albums = append(g.albums, a)
+	return a.ID
+}
+
+// Albums returns a copy of every album.
+func (g *Google) Albums() []Album {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	albums := make([]Album, len(g.albums))
+	for i, a := range g.albums {
+		albums[i] = *a
+		albums[i].Items = append([]string(nil), a.Items...)
+	}
+	return albums
+}
+
+func (g *Google) addMedia(m *MediaItem) *MediaItem {
+	if m.ID == "" {
+		m.ID = g.newID("media")
+	}
+	if m.Created.IsZero() {
+		m.Created = time.Now()
+	}
+	if m.MimeType == "" {
+		m.MimeType = "image/jpeg"
+	}
+	g.media = append(g.media, m)
+	return m
+}
+
+func (g *Google) findMedia(id string) *MediaItem {
+	for _, m := range g.media {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (g *Google) findAlbum(id string) *Album {
+	for _, a := range g.albums {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+func mediaResource(m *MediaItem) map[string]interface{} {
+	metadata := map[string]interface{}{"creationTime": m.Created.UTC().Format(time.RFC3339)}
+	if m.Width > 0 && m.Height > 0 {
+		metadata["width"] = strconv.Itoa(m.Width)
+		metadata["height"] = strconv.Itoa(m.Height)
+	}
+	kind := "photo"
+	if strings.HasPrefix(m.MimeType, "video/") {
+		kind = "video"
+	}
+	metadata[kind] = map[string]string{"cameraMake": m.CameraMake, "cameraModel": m.CameraModel}
+	return map[string]interface{}{
+		"id":         m.ID,
+		"filename":   m.Filename,
+		"mimeType":   m.MimeType,
+		"productUrl": "https://photos.google.com/lr/photo/" + m.ID,
+		// Downloads append "=d" or "=dv", which serveMediaDownload strips
+		"baseUrl":       "https://lh3.googleusercontent.com/media/" + m.ID,
+		"mediaMetadata": metadata,
+	}
+}
+
+func albumResource(a *Album) map[string]interface{} {
+	resource := map[string]interface{}{
+		"id":              a.ID,
+		"title":           a.Title,
+		"productUrl":      "https://photos.google.com/lr/album/" + a.ID,
+		"mediaItemsCount": strconv.Itoa(len(a.Items)),
+	}
+	if len(a.Items) > 0 {
+		// Albums default to their first item as cover
+		resource["coverPhotoBaseUrl"] = "https://lh3.googleusercontent.com/media/" + a.Items[0]
+	}
+	return resource
+}
+
+func (g *Google) servePhotos(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	switch {
+	case path == "/mediaItems:search" && r.Method == http.MethodPost:
+		g.searchMedia(w, body)
+	case path == "/mediaItems:batchCreate" && r.Method == http.MethodPost:
+		g.batchCreateMedia(w, body)
+	case strings.HasPrefix(path, "/mediaItems/") && r.Method == http.MethodGet:
+		m := g.findMedia(strings.TrimPrefix(path, "/mediaItems/"))
+		if m == nil {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return
+		}
+		writeJSON(w, mediaResource(m))
+	case path == "/albums" && r.Method == http.MethodGet:
+		albums := make([]map[string]interface{}, len(g.albums))
+		for i, a := range g.albums {
+			albums[i] = albumResource(a)
+		}
+		writeJSON(w, map[string]interface{}{"albums": albums})
+	case path == "/albums" && r.Method == http.MethodPost:
+		var req struct {
+			Album struct {
+				Title string `json:"title"`
+			} `json:"album"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a := &Album{ID: g.newID("album"), Title: req.Album.Title}
+		g.albums = append(g.albums, a)
+		writeJSON(w, albumResource(a))
+	case strings.HasPrefix(path, "/albums/") && strings.HasSuffix(path, ":batchAddMediaItems") && r.Method == http.MethodPost:
+		a := g.findAlbum(strings.TrimSuffix(strings.TrimPrefix(path, "/albums/"), ":batchAddMediaItems"))
+		if a == nil {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return
+		}
+		var req struct {
+			MediaItemIDs []string `json:"mediaItemIds"`
+		}
+		json.Unmarshal(body, &req)
+		if len(req.MediaItemIDs) > 50 {
+			writeError(w, http.StatusBadRequest, "at most 50 media items per request")
+			return
+		}
+		a.Items = append(a.Items, req.MediaItemIDs...)
+		writeJSON(w, map[string]interface{}{})
+	case strings.HasPrefix(path, "/albums/") && strings.HasSuffix(path, ":batchRemoveMediaItems") && r.Method == http.MethodPost:
+		a := g.findAlbum(strings.TrimSuffix(strings.TrimPrefix(path, "/albums/"), ":batchRemoveMediaItems"))
+		if a == nil {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return
+		}
+		var req struct {
+			MediaItemIDs []string `json:"mediaItemIds"`
+		}
+		json.Unmarshal(body, &req)
+		remove := map[string]bool{}
+		for _, id := range req.MediaItemIDs {
+			remove[id] = true
+		}
+		kept := a.Items[:0]
+		for _, id := range a.Items {
+			if !remove[id] {
+				kept = append(kept, id)
+			}
+		}
+		a.Items = kept
+		writeJSON(w, map[string]interface{}{})
+	case path == "/uploads" && r.Method == http.MethodPost && r.URL.Query().Get("upload_id") != "":
+		g.uploadPhotosChunk(w, r, body)
+	case path == "/uploads" && r.Method == http.MethodPost && r.Header.Get("X-Goog-Upload-Protocol") == "resumable":
+		total, _ := strconv.ParseInt(r.Header.Get("X-Goog-Upload-Raw-Size"), 10, 64)
+		id := g.newSession(total, r.Header.Get("X-Goog-Upload-Content-Type"), nil)
+		w.Header().Set("X-Goog-Upload-URL", "https://photoslibrary.googleapis.com/v1/uploads?upload_id="+id)
+		w.Header().Set("X-Goog-Upload-Chunk-Granularity", "262144")
+	case path == "/uploads" && r.Method == http.MethodPost:
+		token := g.newID("upload")
+		g.uploads[token] = uploadedBytes{mimeType: r.Header.Get("X-Goog-Upload-Content-Type"), data: body}
+		w.Write([]byte(token))
+	default:
+		writeError(w, http.StatusNotFound, "testkit: no fake for "+r.Method+" photos "+path)
+	}
+}
+
+type photosDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+func (d photosDate) time() time.Time {
+	return time.Date(d.Year, time.Month(d.Month), d.Day, 0, 0, 0, 0, time.Local)
+}
+
+func (g *Google) searchMedia(w http.ResponseWriter, body []byte) {
+	var req struct {
+		AlbumID   string `json:"albumId"`
+		PageSize  int    `json:"pageSize"`
+		PageToken string `json:"pageToken"`
+		Filters   struct {
+			DateFilter struct {
+				Ranges []struct {
+					StartDate photosDate `json:"startDate"`
+					EndDate   photosDate `json:"endDate"`
+				} `json:"ranges"`
+			} `json:"dateFilter"`
+			MediaTypeFilter struct {
+				MediaTypes []string `json:"mediaTypes"`
+			} `json:"mediaTypeFilter"`
+			ContentFilter struct {
+				IncludedContentCategories []string `json:"includedContentCategories"`
+			} `json:"contentFilter"`
+			IncludeArchivedMedia bool `json:"includeArchivedMedia"`
+		} `json:"filters"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var album *Album
+	if req.AlbumID != "" {
+		if album = g.findAlbum(req.AlbumID); album == nil {
+			writeError(w, http.StatusNotFound, "Requested entity was not found.")
+			return
+		}
+	}
+
+	var matches []*MediaItem
+	for _, m := range g.media {
+		if album != nil && !containsString(album.Items, m.ID) {
+			continue
+		}
+		if album == nil && m.Archived && !req.Filters.IncludeArchivedMedia {
+			continue
+		}
+		if ranges := req.Filters.DateFilter.Ranges; len(ranges) > 0 {
+			inRange := false
+			for _, rg := range ranges {
+				inRange = inRange || !m.Created.Before(rg.StartDate.time()) && m.Created.Before(rg.EndDate.time().AddDate(0, 0, 1))
+			}
+			if !inRange {
+				continue
+			}
+		}
+		if types := req.Filters.MediaTypeFilter.MediaTypes; len(types) > 0 && !containsString(types, "ALL_MEDIA") {
+			want := "PHOTO"
+			if strings.HasPrefix(m.MimeType, "video/") {
+				want = "VIDEO"
+			}
+			if !containsString(types, want) {
+				continue
+			}
+		}
+		if cats := req.Filters.ContentFilter.IncludedContentCategories; len(cats) > 0 {
+			found := false
+			for _, c := range m.Categories {
+				found = found || containsString(cats, c)
+			}
+			if !found {
+				continue
+			}
+		}
+		matches = append(matches, m)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Created.Before(matches[j].Created) })
+
+	pageSize := req.PageSize
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 25
+	}
+	offset, _ := strconv.Atoi(req.PageToken)
+	resp := map[string]interface{}{}
+	if offset < len(matches) {
+		end := min(offset+pageSize, len(matches))
+		items := make([]map[string]interface{}, 0, end-offset)
+		for _, m := range matches[offset:end] {
+			items = append(items, mediaResource(m))
+		}
+		resp["mediaItems"] = items
+		if end < len(matches) {
+			resp["nextPageToken"] = strconv.Itoa(end)
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (g *Google) batchCreateMedia(w http.ResponseWriter, body []byte) {
+	var req struct {
+		AlbumID       string `json:"albumId"`
+		NewMediaItems []struct {
+			SimpleMediaItem struct {
+				UploadToken string `json:"uploadToken"`
+				FileName    string `json:"fileName"`
+			} `json:"simpleMediaItem"`
+		} `json:"newMediaItems"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	album := g.findAlbum(req.AlbumID)
+	if req.AlbumID != "" && album == nil {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	var results []map[string]interface{}
+	for _, item := range req.NewMediaItems {
+		upload, ok := g.uploads[item.SimpleMediaItem.UploadToken]
+		if !ok {
+			results = append(results, map[string]interface{}{
+				"uploadToken": item.SimpleMediaItem.UploadToken,
+				"status":      map[string]interface{}{"code": 3, "message": "invalid upload token"},
+			})
+			continue
+		}
+		delete(g.uploads, item.SimpleMediaItem.UploadToken)
+		m := g.addMedia(&MediaItem{Filename: item.SimpleMediaItem.FileName, MimeType: upload.mimeType, Data: upload.data})
+		if album != nil {
+			album.Items = append(album.Items, m.ID)
+		}
+		results = append(results, map[string]interface{}{
+			"uploadToken": item.SimpleMediaItem.UploadToken,
+			"status":      map[string]interface{}{"message": "Success"},
+			"mediaItem":   mediaResource(m),
+		})
+	}
+	writeJSON(w, map[string]interface{}{"newMediaItemResults": results})
+}
+
+// uploadPhotosChunk takes a chunk of a resumable upload; the one marked
+// "finalize" completes it and is answered with the upload token.
+func (g *Google) uploadPhotosChunk(w http.ResponseWriter, r *http.Request, body []byte) {
+	s := g.sessions[r.URL.Query().Get("upload_id")]
+	if s == nil {
+		writeError(w, http.StatusNotFound, "upload session not found")
+		return
+	}
+	command := r.Header.Get("X-Goog-Upload-Command")
+	if command != "query" && s.final == nil {
+		offset, _ := strconv.ParseInt(r.Header.Get("X-Goog-Upload-Offset"), 10, 64)
+		if !s.write(offset, body) {
+			writeError(w, http.StatusBadRequest, "offset past the bytes received")
+			return
+		}
+		if strings.Contains(command, "finalize") {
+			if int64(len(s.data)) != s.total {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("finalized with %d of %d bytes", len(s.data), s.total))
+				return
+			}
+			token := g.newID("upload")
+			g.uploads[token] = uploadedBytes{mimeType: s.mimeType, data: s.data}
+			s.final = []byte(token)
+		}
+	}
+	w.Header().Set("X-Goog-Upload-Size-Received", strconv.Itoa(len(s.data)))
+	if s.final != nil {
+		w.Header().Set("X-Goog-Upload-Status", "final")
+		w.Write(s.final)
+		return
+	}
+	w.Header().Set("X-Goog-Upload-Status", "active")
+}
+
+func (g *Google) serveMediaDownload(w http.ResponseWriter, r *http.Request, ref string) {
+	id, _, _ := strings.Cut(ref, "=")
+	m := g.findMedia(id)
+	if m == nil {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	// ServeContent honors Range, for resumed downloads
+	w.Header().Set("Content-Type", m.MimeType)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(m.Data))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
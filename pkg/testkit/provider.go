@@ -0,0 +1,129 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// ErrScriptExhausted is returned by Provider when it has no reply left.
+var ErrScriptExhausted = errors.New("testkit: provider script exhausted")
+
+// Reply is one scripted LLM answer.
+type Reply struct {
+	Content   string
+	ToolCalls []providers.ToolCall
+	// Err, when set, is returned instead of a response
+	Err error
+}
+
+// Say is a plain text reply that ends the agent's turn.
+func Say(text string) Reply {
+	return Reply{Content: text}
+}
+
+// CallTool is a reply asking the agent to run one tool.
+func CallTool(name string, args map[string]interface{}) Reply {
+	return Reply{ToolCalls: []providers.ToolCall{{Type: "function", Name: name, Arguments: args}}}
+}
+
+// ProviderCall is a request the agent made to Provider.
+type ProviderCall struct {
+	Messages []providers.Message
+	Tools    []providers.ToolDefinition
+	Model    string
+}
+
+// LastMessage is the content of the last message in the request, which
+// after a tool call is the tool's result.
+func (c ProviderCall) LastMessage() string {
+	if len(c.Messages) == 0 {
+		return ""
+	}
+	return c.Messages[len(c.Messages)-1].Content
+}
+
+// HasTool reports whether the named tool was offered to the model.
+func (c ProviderCall) HasTool(name string) bool {
+	for _, t := range c.Tools {
+		if t.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider is a providers.LLMProvider that answers from a script, one
+// Reply per Chat call, and records what it was asked.
+type Provider struct {
+	mu      sync.Mutex
+	script  []Reply
+	calls   []ProviderCall
+	nextIDs int
+}
+
+// NewProvider returns a Provider that gives replies in order.
+func NewProvider(replies ...Reply) *Provider {
+	return &Provider{script: replies}
+}
+
+// Queue appends replies to the script.
+func (p *Provider) Queue(replies ...Reply) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script = append(p.script, replies...)
+}
+
+// Calls returns the requests received so far, oldest first.
+func (p *Provider) Calls() []ProviderCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProviderCall(nil), p.calls...)
+}
+
+// Remaining is the number of replies not used yet.
+func (p *Provider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.script)
+}
+
+func (p *Provider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, ProviderCall{
+		Messages: append([]providers.Message(nil), messages...),
+		Tools:    tools,
+		Model:    model,
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.script) == 0 {
+		return nil, ErrScriptExhausted
+	}
+	reply := p.script[0]
+	p.script = p.script[1:]
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+	resp := &providers.LLMResponse{Content: reply.Content, FinishReason: "stop"}
+	for _, tc := range reply.ToolCalls {
+		if tc.ID == "" {
+			p.nextIDs++
+			tc.ID = fmt.Sprintf("call_%d", p.nextIDs)
+		}
+		resp.ToolCalls = append(resp.ToolCalls, tc)
+	}
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return "testkit-model"
+}
@@ -0,0 +1,25 @@
+package testkit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/httprec"
+)
+
+// Replay answers the requests made with http.DefaultTransport from the
+// recording at path (written with debug.record_http on) until the test
+// ends, to reproduce a bug offline. Requests that were not recorded fail.
+// Like Install, it swaps a process-wide value.
+func Replay(t *testing.T, path string) *httprec.Replayer {
+	t.Helper()
+	call, err := httprec.Load(path)
+	if err != nil {
+		t.Fatalf("load recording: %v", err)
+	}
+	replayer := call.Replay()
+	previous := http.DefaultTransport
+	http.DefaultTransport = replayer
+	t.Cleanup(func() { http.DefaultTransport = previous })
+	return replayer
+}
@@ -0,0 +1,22 @@
+// Package testkit runs picoclaw tools and agent flows in tests without
+// live credentials or chat apps. Google is an in-memory fake of the Gmail,
+// Drive, Calendar and Photos APIs the Google tools call; Provider is a
+// scripted LLM; Chat drives an agent through the message bus like a
+// channel would.
+//
+// A test of a custom tool that reads mail looks like:
+//
+//	g := testkit.NewGoogle(t)
+//	g.Install()
+//	g.AddEmail(testkit.Email{From: "shop@example.com", Subject: "Your order", Body: "Shipped"})
+//	tool := mytool.New(testkit.Token)
+//	result := tool.Execute(ctx, map[string]interface{}{"query": "order"})
+package testkit
+
+import "context"
+
+// Token is a tools.TokenFunc that always succeeds. The fake Google
+// server accepts any bearer token.
+func Token(ctx context.Context) (string, error) {
+	return "testkit-token", nil
+}
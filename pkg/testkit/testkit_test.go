@@ -0,0 +1,186 @@
+package testkit_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TestGoogle_GmailSearchAndAttachments verifies the real Gmail client can search the fake mailbox and read attachments
+func TestGoogle_GmailSearchAndAttachments(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddEmail(testkit.Email{From: "news@example.com", Subject: "Weekly digest", Body: "Nothing new", Date: time.Now().Add(-time.Hour)})
+	id := g.AddEmail(testkit.Email{
+		From:    "Ana <ana@example.com>",
+		Subject: "Dinner on Friday",
+		Body:    "See invite",
+		Attachments: []testkit.Attachment{
+			{Filename: "invite.ics", MimeType: "text/calendar", Data: []byte("BEGIN:VCALENDAR\nEND:VCALENDAR")},
+		},
+	})
+
+	ctx := context.Background()
+	gmail := tools.NewGmailClient(testkit.Token)
+	summaries, err := gmail.SearchSummaries(ctx, "from:ana has:attachment", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].ID != id || summaries[0].Subject != "Dinner on Friday" {
+		t.Fatalf("unexpected search result: %+v", summaries)
+	}
+	msg, err := gmail.GetMessage(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "See invite" || len(msg.Calendars) != 1 || !strings.HasPrefix(msg.Calendars[0], "BEGIN:VCALENDAR") {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+}
+
+// TestGoogle_DriveCalendarAndPhotosWrites verifies writes land in the fixtures and idempotent APIs stay idempotent
+func TestGoogle_DriveCalendarAndPhotosWrites(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	ctx := context.Background()
+
+	drive := tools.NewGoogleDriveClient(testkit.Token)
+	folder, err := drive.EnsureFolder(ctx, "", "Invoices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := drive.EnsureFolder(ctx, "", "Invoices")
+	if again == nil || again.ID != folder.ID {
+		t.Fatalf("EnsureFolder created a second folder: %+v vs %+v", again, folder)
+	}
+	if _, err := drive.Upload(ctx, folder.ID, "march.pdf", "application/pdf", []byte("%PDF")); err != nil {
+		t.Fatal(err)
+	}
+	files := g.Files()
+	if len(files) != 2 || files[1].Parent != folder.ID || string(files[1].Content) != "%PDF" {
+		t.Errorf("unexpected files: %+v", files)
+	}
+
+	cal := tools.NewGoogleCalendarClient(testkit.Token)
+	start := time.Date(2026, 3, 6, 19, 0, 0, 0, time.UTC)
+	ev := tools.CalendarEvent{Summary: "Dinner", Start: start, End: start.Add(2 * time.Hour), ICalUID: "dinner@example.com"}
+	for i := 0; i < 2; i++ {
+		if _, err := cal.InsertEvent(ctx, "", ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed, err := cal.ListEvents(ctx, "", start.Add(-time.Hour), start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Summary != "Dinner" || !listed[0].Start.Equal(start) {
+		t.Errorf("unexpected events: %+v", listed)
+	}
+
+	photos := tools.NewGooglePhotosClient(testkit.Token)
+	album, err := photos.CreateAlbum(ctx, "Trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := photos.Upload(ctx, "beach.jpg", "image/jpeg", strings.NewReader("jpeg bytes"), album.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := photos.Download(ctx, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "jpeg bytes" {
+		t.Errorf("downloaded %q", data)
+	}
+	if albums := g.Albums(); len(albums) != 1 || len(albums[0].Items) != 1 || albums[0].Items[0] != item.ID {
+		t.Errorf("unexpected albums: %+v", albums)
+	}
+}
+
+// TestGoogle_FailNext verifies injected failures surface as API errors and then clear
+func TestGoogle_FailNext(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.FailNext("/users/me/messages", 1, 503)
+
+	gmail := tools.NewGmailClient(testkit.Token)
+	if _, err := gmail.Search(context.Background(), "", 5); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected a 503, got %v", err)
+	}
+	if _, err := gmail.Search(context.Background(), "", 5); err != nil {
+		t.Fatalf("failure did not clear: %v", err)
+	}
+	if n := len(g.Requests()); n != 2 {
+		t.Errorf("recorded %d requests, want 2", n)
+	}
+}
+
+// unreadTool is a custom tool reading the fake mailbox, as a plugin author would write one.
+type unreadTool struct{ gmail *tools.GmailClient }
+
+func (t *unreadTool) Name() string        { return "count_mail" }
+func (t *unreadTool) Description() string { return "Count mail matching a Gmail query" }
+func (t *unreadTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"query": map[string]interface{}{"type": "string"}},
+	}
+}
+
+func (t *unreadTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	query, _ := args["query"].(string)
+	ids, err := t.gmail.Search(ctx, query, 50)
+	if err != nil {
+		return tools.ErrorResult(err.Error())
+	}
+	return tools.NewToolResult(fmt.Sprintf("%d messages", len(ids)))
+}
+
+// TestChat_AgentRunsCustomToolAgainstFakes verifies a full round: chat message, scripted tool call, fake API, reply
+func TestChat_AgentRunsCustomToolAgainstFakes(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddEmail(testkit.Email{From: "bank@example.com", Subject: "Statement"})
+	g.AddEmail(testkit.Email{From: "bank@example.com", Subject: "Card payment"})
+
+	provider := testkit.NewProvider(
+		testkit.CallTool("count_mail", map[string]interface{}{"query": "from:bank"}),
+		testkit.Say("You have 2 messages from the bank."),
+	)
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+		Workspace:         t.TempDir(),
+		Model:             "test-model",
+		MaxTokens:         4096,
+		MaxToolIterations: 5,
+	}}}
+	msgBus := bus.NewMessageBus()
+	al := agent.NewAgentLoop(cfg, msgBus, provider)
+	al.RegisterTool(&unreadTool{gmail: tools.NewGmailClient(testkit.Token)})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+
+	chat := testkit.NewChat(t, msgBus, "chat-1")
+	if reply := chat.Ask("how much bank mail?"); reply != "You have 2 messages from the bank." {
+		t.Fatalf("reply = %q", reply)
+	}
+	calls := provider.Calls()
+	if len(calls) != 2 || !calls[0].HasTool("count_mail") || !strings.Contains(calls[1].LastMessage(), "2 messages") {
+		t.Errorf("unexpected provider calls: %+v", calls)
+	}
+	if provider.Remaining() != 0 {
+		t.Errorf("%d replies unused", provider.Remaining())
+	}
+}
@@ -0,0 +1,250 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+// AgendaTool shows a day or week of the user's calendars, as text or as
+// a picture of a calendar grid in each calendar's color, which reads
+// better on a phone than a long list.
+type AgendaTool struct {
+	calendar   *GoogleCalendarClient
+	profiles   *profile.Store
+	previewDir string
+	channel    string
+	chatID     string
+}
+
+// NewAgendaTool creates the tool. Rendered agendas are written to
+// previewDir.
+func NewAgendaTool(token TokenFunc, profiles *profile.Store, previewDir string) *AgendaTool {
+	return &AgendaTool{calendar: NewGoogleCalendarClient(token), profiles: profiles, previewDir: previewDir}
+}
+
+func (t *AgendaTool) Name() string {
+	return "agenda"
+}
+
+// Untrusted is true: the agenda lists event titles and places set by
+// whoever sent the invitations.
+func (t *AgendaTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *AgendaTool) Description() string {
+	return "Show the user's agenda for a day or a week across their calendars. format=image sends a picture of the calendar grid, in each calendar's color, which is easier to read on a phone than a long list; the event list is returned either way."
+}
+
+func (t *AgendaTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"view": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"day", "week"},
+				"description": "One day, or the week (Monday to Sunday) containing date (default day)",
+			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "The day, e.g. 2026-05-06, tomorrow or next Monday (default today)",
+			},
+			"calendars": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Calendar names or IDs to include (default: those shown in the user's Calendar)",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"text", "image"},
+				"description": "text lists events; image also sends a rendered agenda to the user (default text)",
+			},
+		},
+	}
+}
+
+func (t *AgendaTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *AgendaTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	var prof profile.Profile
+	if t.profiles != nil {
+		prof = t.profiles.Get(t.channel + ":" + t.chatID)
+	}
+	loc := prof.Location()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if dateStr, _ := args["date"].(string); dateStr != "" {
+		r, err := when.Parse(dateStr, now, prof.Locale)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		day = time.Date(r.Time.Year(), r.Time.Month(), r.Time.Day(), 0, 0, 0, 0, loc)
+	}
+	days := []time.Time{day}
+	if view, _ := args["view"].(string); view == "week" {
+		monday := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		days = days[:0]
+		for i := 0; i < 7; i++ {
+			days = append(days, monday.AddDate(0, 0, i))
+		}
+	}
+
+	calendars, err := t.calendar.ListCalendars(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list calendars: %v", err)).WithError(err)
+	}
+	calendars, err = pickCalendars(calendars, args["calendars"])
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	from, to := days[0], days[len(days)-1].AddDate(0, 0, 1)
+	entries, err := t.fetch(ctx, calendars, from, to)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read events: %v", err)).WithError(err)
+	}
+
+	text := formatAgenda(days, entries, len(calendars) > 1)
+	if format, _ := args["format"].(string); format != "image" {
+		return SilentResult(text)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, renderAgenda(days, entries)); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to render the agenda: %v", err)).WithError(err)
+	}
+	path, err := savePreview(t.previewDir, "agenda", ".png", buf.Bytes())
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the agenda image: %v", err)).WithError(err)
+	}
+	return &ToolResult{
+		ForLLM: text + "\n\nThe agenda was sent to the user as an image; don't repeat it in full.",
+		Media:  []string{path},
+	}
+}
+
+// pickCalendars narrows the calendar list to the names or IDs asked for,
+// or to the selected calendars when none are.
+func pickCalendars(all []CalendarInfo, wanted interface{}) ([]CalendarInfo, error) {
+	names, _ := wanted.([]interface{})
+	var picked []CalendarInfo
+	if len(names) == 0 {
+		for _, c := range all {
+			if c.Selected || c.Primary {
+				picked = append(picked, c)
+			}
+		}
+		return picked, nil
+	}
+	for _, n := range names {
+		name, _ := n.(string)
+		found := false
+		for _, c := range all {
+			if strings.EqualFold(c.Name, name) || c.ID == name || name == "primary" && c.Primary {
+				picked = append(picked, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := make([]string, len(all))
+			for i, c := range all {
+				known[i] = c.Name
+			}
+			return nil, fmt.Errorf("no calendar named %q; the calendars are: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return picked, nil
+}
+
+// fetch reads the events of each calendar concurrently and merges them in
+// start order.
+func (t *AgendaTool) fetch(ctx context.Context, calendars []CalendarInfo, from, to time.Time) ([]agendaEntry, error) {
+	results := make([][]agendaEntry, len(calendars))
+	errs := make([]error, len(calendars))
+	var wg sync.WaitGroup
+	for i, c := range calendars {
+		wg.Add(1)
+		go func(i int, c CalendarInfo) {
+			defer wg.Done()
+			events, err := t.calendar.ListEvents(ctx, c.ID, from, to)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", c.Name, err)
+				return
+			}
+			color := parseHexColor(c.Color)
+			for _, ev := range events {
+				noteMentions(ctx, eventMentions(ev)...)
+				if !ev.AllDay {
+					ev.Start, ev.End = ev.Start.In(from.Location()), ev.End.In(from.Location())
+				}
+				results[i] = append(results[i], agendaEntry{Event: ev, Calendar: c.Name, Color: color})
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	var entries []agendaEntry
+	for i := range calendars {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		entries = append(entries, results[i]...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Event, entries[j].Event
+		if a.AllDay != b.AllDay {
+			return a.AllDay
+		}
+		return a.Start.Before(b.Start)
+	})
+	return entries, nil
+}
+
+// formatAgenda lists the events day by day, naming the calendar of each
+// when there are several.
+func formatAgenda(days []time.Time, entries []agendaEntry, withCalendar bool) string {
+	var sb strings.Builder
+	for i, day := range days {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(day.Format("Mon 2 Jan 2006") + ":")
+		n := 0
+		for _, e := range entries {
+			if !onDay(e.Event, day) {
+				continue
+			}
+			n++
+			when := "all day"
+			if !e.Event.AllDay {
+				start, end := clipToDay(e.Event, day)
+				when = start.Format("15:04") + "–" + end.Format("15:04")
+			}
+			fmt.Fprintf(&sb, "\n  %s %s", when, e.Event.Summary)
+			if note := eventTypeNote(e.Event); note != "" && !strings.EqualFold(note, e.Event.Summary) {
+				fmt.Fprintf(&sb, " (%s)", note)
+			}
+			if e.Event.Location != "" {
+				fmt.Fprintf(&sb, " @ %s", e.Event.Location)
+			}
+			if withCalendar {
+				fmt.Fprintf(&sb, " [%s]", e.Calendar)
+			}
+		}
+		if n == 0 {
+			sb.WriteString("\n  nothing scheduled")
+		}
+	}
+	return sb.String()
+}
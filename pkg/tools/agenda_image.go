@@ -0,0 +1,293 @@
+package tools
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// font5x7 is a 5x7 pixel font for printable ASCII, one glyph per
+// character from ' ', five columns each, least significant bit at the top.
+// Anything else is drawn as '?'.
+var font5x7 = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x5F, 0x00, 0x00}, {0x00, 0x07, 0x00, 0x07, 0x00}, {0x14, 0x7F, 0x14, 0x7F, 0x14},
+	{0x24, 0x2A, 0x7F, 0x2A, 0x12}, {0x23, 0x13, 0x08, 0x64, 0x62}, {0x36, 0x49, 0x55, 0x22, 0x50}, {0x00, 0x05, 0x03, 0x00, 0x00},
+	{0x00, 0x1C, 0x22, 0x41, 0x00}, {0x00, 0x41, 0x22, 0x1C, 0x00}, {0x08, 0x2A, 0x1C, 0x2A, 0x08}, {0x08, 0x08, 0x3E, 0x08, 0x08},
+	{0x00, 0x50, 0x30, 0x00, 0x00}, {0x08, 0x08, 0x08, 0x08, 0x08}, {0x00, 0x60, 0x60, 0x00, 0x00}, {0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x3E, 0x51, 0x49, 0x45, 0x3E}, {0x00, 0x42, 0x7F, 0x40, 0x00}, {0x42, 0x61, 0x51, 0x49, 0x46}, {0x21, 0x41, 0x45, 0x4B, 0x31},
+	{0x18, 0x14, 0x12, 0x7F, 0x10}, {0x27, 0x45, 0x45, 0x45, 0x39}, {0x3C, 0x4A, 0x49, 0x49, 0x30}, {0x01, 0x71, 0x09, 0x05, 0x03},
+	{0x36, 0x49, 0x49, 0x49, 0x36}, {0x06, 0x49, 0x49, 0x29, 0x1E}, {0x00, 0x36, 0x36, 0x00, 0x00}, {0x00, 0x56, 0x36, 0x00, 0x00},
+	{0x08, 0x14, 0x22, 0x41, 0x00}, {0x14, 0x14, 0x14, 0x14, 0x14}, {0x00, 0x41, 0x22, 0x14, 0x08}, {0x02, 0x01, 0x51, 0x09, 0x06},
+	{0x32, 0x49, 0x79, 0x41, 0x3E}, {0x7E, 0x11, 0x11, 0x11, 0x7E}, {0x7F, 0x49, 0x49, 0x49, 0x36}, {0x3E, 0x41, 0x41, 0x41, 0x22},
+	{0x7F, 0x41, 0x41, 0x22, 0x1C}, {0x7F, 0x49, 0x49, 0x49, 0x41}, {0x7F, 0x09, 0x09, 0x01, 0x01}, {0x3E, 0x41, 0x41, 0x51, 0x32},
+	{0x7F, 0x08, 0x08, 0x08, 0x7F}, {0x00, 0x41, 0x7F, 0x41, 0x00}, {0x20, 0x40, 0x41, 0x3F, 0x01}, {0x7F, 0x08, 0x14, 0x22, 0x41},
+	{0x7F, 0x40, 0x40, 0x40, 0x40}, {0x7F, 0x02, 0x04, 0x02, 0x7F}, {0x7F, 0x04, 0x08, 0x10, 0x7F}, {0x3E, 0x41, 0x41, 0x41, 0x3E},
+	{0x7F, 0x09, 0x09, 0x09, 0x06}, {0x3E, 0x41, 0x51, 0x21, 0x5E}, {0x7F, 0x09, 0x19, 0x29, 0x46}, {0x46, 0x49, 0x49, 0x49, 0x31},
+	{0x01, 0x01, 0x7F, 0x01, 0x01}, {0x3F, 0x40, 0x40, 0x40, 0x3F}, {0x1F, 0x20, 0x40, 0x20, 0x1F}, {0x7F, 0x20, 0x18, 0x20, 0x7F},
+	{0x63, 0x14, 0x08, 0x14, 0x63}, {0x03, 0x04, 0x78, 0x04, 0x03}, {0x61, 0x51, 0x49, 0x45, 0x43}, {0x00, 0x7F, 0x41, 0x41, 0x00},
+	{0x02, 0x04, 0x08, 0x10, 0x20}, {0x00, 0x41, 0x41, 0x7F, 0x00}, {0x04, 0x02, 0x01, 0x02, 0x04}, {0x40, 0x40, 0x40, 0x40, 0x40},
+	{0x00, 0x01, 0x02, 0x04, 0x00}, {0x20, 0x54, 0x54, 0x54, 0x78}, {0x7F, 0x48, 0x44, 0x44, 0x38}, {0x38, 0x44, 0x44, 0x44, 0x20},
+	{0x38, 0x44, 0x44, 0x48, 0x7F}, {0x38, 0x54, 0x54, 0x54, 0x18}, {0x08, 0x7E, 0x09, 0x01, 0x02}, {0x08, 0x14, 0x54, 0x54, 0x3C},
+	{0x7F, 0x08, 0x04, 0x04, 0x78}, {0x00, 0x44, 0x7D, 0x40, 0x00}, {0x20, 0x40, 0x44, 0x3D, 0x00}, {0x00, 0x7F, 0x10, 0x28, 0x44},
+	{0x00, 0x41, 0x7F, 0x40, 0x00}, {0x7C, 0x04, 0x18, 0x04, 0x78}, {0x7C, 0x08, 0x04, 0x04, 0x78}, {0x38, 0x44, 0x44, 0x44, 0x38},
+	{0x7C, 0x14, 0x14, 0x14, 0x08}, {0x08, 0x14, 0x14, 0x18, 0x7C}, {0x7C, 0x08, 0x04, 0x04, 0x08}, {0x48, 0x54, 0x54, 0x54, 0x20},
+	{0x04, 0x3F, 0x44, 0x40, 0x20}, {0x3C, 0x40, 0x40, 0x20, 0x7C}, {0x1C, 0x20, 0x40, 0x20, 0x1C}, {0x3C, 0x40, 0x30, 0x40, 0x3C},
+	{0x44, 0x28, 0x10, 0x28, 0x44}, {0x0C, 0x50, 0x50, 0x50, 0x3C}, {0x44, 0x64, 0x54, 0x4C, 0x44}, {0x00, 0x08, 0x36, 0x41, 0x00},
+	{0x00, 0x00, 0x7F, 0x00, 0x00}, {0x00, 0x41, 0x36, 0x08, 0x00}, {0x08, 0x04, 0x08, 0x10, 0x08},
+}
+
+// Agenda image layout, in pixels. Text is the 5x7 font drawn at
+// textScale, so a character takes charWidth.
+const (
+	textScale    = 2
+	charWidth    = 6 * textScale
+	lineHeight   = 10 * textScale
+	hourHeight   = 48
+	timeAxis     = 64
+	dayWidthDay  = 560
+	dayWidthWeek = 200
+	headerHeight = 36
+)
+
+var (
+	agendaGrid    = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	agendaText    = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	agendaMuted   = color.RGBA{0x77, 0x77, 0x77, 0xff}
+	defaultColor  = color.RGBA{0x03, 0x9b, 0xe5, 0xff}
+	agendaLightFg = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// agendaEntry is an event placed on the agenda with its calendar's color.
+type agendaEntry struct {
+	Event    CalendarEvent
+	Calendar string
+	Color    color.RGBA
+}
+
+// drawText draws s at (x, y), cut with ".." to fit maxWidth pixels.
+func drawText(img draw.Image, x, y int, s string, c color.Color, maxWidth int) {
+	runes := []rune(s)
+	if fit := maxWidth / charWidth; len(runes) > fit {
+		if fit < 3 {
+			return
+		}
+		runes = append(runes[:fit-2], '.', '.')
+	}
+	for i, r := range runes {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		glyph := font5x7[r-' ']
+		for col := 0; col < 5; col++ {
+			for row := 0; row < 7; row++ {
+				if glyph[col]&(1<<row) == 0 {
+					continue
+				}
+				px := x + i*charWidth + col*textScale
+				py := y + row*textScale
+				draw.Draw(img, image.Rect(px, py, px+textScale, py+textScale), image.NewUniform(c), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+func fillRect(img draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// parseHexColor reads "#rrggbb", falling back to the default blue.
+func parseHexColor(s string) color.RGBA {
+	s = strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(s, 16, 32)
+	if len(s) != 6 || err != nil {
+		return defaultColor
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
+
+// textOn picks dark or light text, whichever reads better on bg.
+func textOn(bg color.RGBA) color.RGBA {
+	if 299*int(bg.R)+587*int(bg.G)+114*int(bg.B) > 150000 {
+		return agendaText
+	}
+	return agendaLightFg
+}
+
+// renderAgenda draws days side by side as columns on an hour grid, with
+// all-day events in a strip at the top, like a calendar app's day and
+// week views. Events that overlap share their column's width.
+func renderAgenda(days []time.Time, entries []agendaEntry) image.Image {
+	dayWidth := dayWidthDay
+	if len(days) > 1 {
+		dayWidth = dayWidthWeek
+	}
+
+	// Show working hours, widened to fit the events
+	first, last := 8, 18
+	allDayRows := 0
+	for _, day := range days {
+		rows := 0
+		for _, e := range entries {
+			if !onDay(e.Event, day) {
+				continue
+			}
+			if e.Event.AllDay {
+				rows++
+				continue
+			}
+			start, end := clipToDay(e.Event, day)
+			first = min(first, start.Hour())
+			endHour := end.Hour()
+			if end.Minute() > 0 || end.Second() > 0 {
+				endHour++
+			}
+			if end.Day() != day.Day() {
+				endHour = 24
+			}
+			last = max(last, endHour)
+		}
+		allDayRows = max(allDayRows, rows)
+	}
+	allDayHeight := 0
+	if allDayRows > 0 {
+		allDayHeight = allDayRows*(lineHeight+4) + 4
+	}
+	gridTop := headerHeight + allDayHeight
+	width := timeAxis + len(days)*dayWidth
+	height := gridTop + (last-first)*hourHeight + 1
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fillRect(img, img.Bounds(), color.White)
+	for h := first; h <= last; h++ {
+		y := gridTop + (h-first)*hourHeight
+		fillRect(img, image.Rect(timeAxis, y, width, y+1), agendaGrid)
+		if h < last {
+			drawText(img, 4, y+4, strconv.Itoa(h)+":00", agendaMuted, timeAxis-4)
+		}
+	}
+
+	for i, day := range days {
+		x := timeAxis + i*dayWidth
+		fillRect(img, image.Rect(x, headerHeight, x+1, height), agendaGrid)
+		drawText(img, x+6, 10, day.Format("Mon 2 Jan"), agendaText, dayWidth-8)
+
+		var timed []agendaEntry
+		row := 0
+		for _, e := range entries {
+			if !onDay(e.Event, day) {
+				continue
+			}
+			if !e.Event.AllDay {
+				timed = append(timed, e)
+				continue
+			}
+			y := headerHeight + row*(lineHeight+4) + 2
+			fillRect(img, image.Rect(x+2, y, x+dayWidth-2, y+lineHeight+2), e.Color)
+			drawText(img, x+6, y+3, e.Event.Summary, textOn(e.Color), dayWidth-12)
+			row++
+		}
+
+		lanes, lanesInGroup := assignLanes(timed, day)
+		for j, e := range timed {
+			start, end := clipToDay(e.Event, day)
+			y0 := gridTop + int(start.Sub(dayAt(day, first)).Minutes())*hourHeight/60
+			y1 := gridTop + int(end.Sub(dayAt(day, first)).Minutes())*hourHeight/60
+			y1 = max(y1, y0+lineHeight+4)
+			laneWidth := (dayWidth - 4) / lanesInGroup[j]
+			x0 := x + 2 + lanes[j]*laneWidth
+			fillRect(img, image.Rect(x0, y0+1, x0+laneWidth-2, y1-1), e.Color)
+			fg := textOn(e.Color)
+			drawText(img, x0+4, y0+4, e.Event.Summary, fg, laneWidth-8)
+			if y1-y0 >= 2*lineHeight+8 {
+				label := start.Format("15:04") + "-" + end.Format("15:04")
+				drawText(img, x0+4, y0+4+lineHeight, label, fg, laneWidth-8)
+			}
+		}
+	}
+	return img
+}
+
+// assignLanes spreads overlapping timed events across lanes. It returns
+// each event's lane and how many lanes its overlapping group uses.
+func assignLanes(timed []agendaEntry, day time.Time) ([]int, []int) {
+	order := make([]int, len(timed))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return timed[order[a]].Event.Start.Before(timed[order[b]].Event.Start) })
+
+	lanes := make([]int, len(timed))
+	counts := make([]int, len(timed))
+	var group []int
+	var laneEnds []time.Time
+	var groupEnd time.Time
+	flush := func() {
+		for _, i := range group {
+			counts[i] = len(laneEnds)
+		}
+		group, laneEnds = nil, nil
+	}
+	for _, i := range order {
+		start, end := clipToDay(timed[i].Event, day)
+		if len(group) > 0 && !start.Before(groupEnd) {
+			flush()
+		}
+		lane := -1
+		for l, le := range laneEnds {
+			if !start.Before(le) {
+				lane = l
+				break
+			}
+		}
+		if lane < 0 {
+			lane = len(laneEnds)
+			laneEnds = append(laneEnds, end)
+		} else {
+			laneEnds[lane] = end
+		}
+		lanes[i] = lane
+		group = append(group, i)
+		if end.After(groupEnd) || len(group) == 1 {
+			groupEnd = end
+		}
+	}
+	flush()
+	return lanes, counts
+}
+
+func dayAt(day time.Time, hour int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, day.Location())
+}
+
+// onDay reports whether ev shows on day.
+func onDay(ev CalendarEvent, day time.Time) bool {
+	if ev.AllDay {
+		d := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		start := time.Date(ev.Start.Year(), ev.Start.Month(), ev.Start.Day(), 0, 0, 0, 0, time.UTC)
+		end := time.Date(ev.End.Year(), ev.End.Month(), ev.End.Day(), 0, 0, 0, 0, time.UTC)
+		return !d.Before(start) && (d.Before(end) || d.Equal(start))
+	}
+	dayStart := dayAt(day, 0)
+	return ev.Start.Before(dayStart.AddDate(0, 0, 1)) && ev.End.After(dayStart) || ev.Start.Equal(dayStart)
+}
+
+// clipToDay returns the part of a timed event that falls on day, in the
+// day's time zone.
+func clipToDay(ev CalendarEvent, day time.Time) (time.Time, time.Time) {
+	dayStart := dayAt(day, 0)
+	start, end := ev.Start.In(day.Location()), ev.End.In(day.Location())
+	if start.Before(dayStart) {
+		start = dayStart
+	}
+	if next := dayStart.AddDate(0, 0, 1); end.After(next) {
+		end = next
+	}
+	if !end.After(start) {
+		end = start.Add(30 * time.Minute)
+	}
+	return start, end
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestAgendaTool_WeekImageInCalendarColors verifies a week agenda lists events from the selected calendars and renders them in their colors
+func TestAgendaTool_WeekImageInCalendarColors(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddCalendar(testkit.Calendar{ID: "work", Summary: "Work", Color: "#d50000"})
+	g.AddCalendar(testkit.Calendar{ID: "old", Summary: "Old", Color: "#000000", Hidden: true})
+	wed := time.Date(2026, 5, 6, 0, 0, 0, 0, time.Local)
+	g.AddEvent(testkit.Event{Summary: "Dentist", Start: wed.Add(9 * time.Hour), End: wed.Add(10 * time.Hour)})
+	g.AddEvent(testkit.Event{CalendarID: "work", Summary: "Standup", Start: wed.Add(9*time.Hour + 30*time.Minute), End: wed.Add(11 * time.Hour)})
+	g.AddEvent(testkit.Event{CalendarID: "work", Summary: "Offsite", Start: wed.AddDate(0, 0, 2), End: wed.AddDate(0, 0, 3), AllDay: true})
+	g.AddEvent(testkit.Event{CalendarID: "old", Summary: "Hidden", Start: wed.Add(12 * time.Hour), End: wed.Add(13 * time.Hour)})
+
+	tool := NewAgendaTool(testkit.Token, nil, t.TempDir())
+	result := tool.Execute(context.Background(), map[string]interface{}{"view": "week", "date": "2026-05-06", "format": "image"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	for _, want := range []string{"Mon 4 May 2026:\n  nothing scheduled", "09:00–10:00 Dentist [me@example.com]", "09:30–11:00 Standup [Work]", "Fri 8 May 2026:\n  all day Offsite [Work]"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("missing %q in:\n%s", want, result.ForLLM)
+		}
+	}
+	if strings.Contains(result.ForLLM, "Hidden") {
+		t.Error("hidden calendar included")
+	}
+	if len(result.Media) != 1 {
+		t.Fatalf("expected one image, got %v", result.Media)
+	}
+
+	f, err := os.Open(result.Media[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := img.Bounds().Dx(); w != timeAxis+7*dayWidthWeek {
+		t.Errorf("width %d", w)
+	}
+	// Wednesday 10:30, right half: only Standup, in Work red
+	x := timeAxis + 2*dayWidthWeek + dayWidthWeek*3/4
+	y := img.Bounds().Dy() - 1 - (18-10)*hourHeight + hourHeight/2
+	if c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA); c != (color.RGBA{0xd5, 0, 0, 0xff}) {
+		t.Errorf("expected Work red at Wednesday 10:30, got %v", c)
+	}
+
+	only := tool.Execute(context.Background(), map[string]interface{}{"date": "2026-05-06", "calendars": []interface{}{"work"}})
+	if strings.Contains(only.ForLLM, "Dentist") || !strings.Contains(only.ForLLM, "09:30–11:00 Standup") || len(only.Media) != 0 {
+		t.Errorf("unexpected day agenda: %s", only.ForLLM)
+	}
+}
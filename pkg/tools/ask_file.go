@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/embeddings"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	// askPassageChars is the size of the passages a document is cut into
+	askPassageChars = 1500
+	// askPassages is how many of the best passages the answer is written from
+	askPassages = 6
+)
+
+// askCitation matches a passage cited in an answer, e.g. [3].
+var askCitation = regexp.MustCompile(`\[(\d+)\]`)
+
+// AskFileTool answers a question about one document: it extracts the text
+// the way summarize does, cuts it into numbered passages, picks those
+// closest to the question and has the model answer from them alone,
+// citing the passages it used. Nothing is indexed ahead of time, so it
+// suits a document the user asks about once.
+type AskFileTool struct {
+	docs      *SummarizeTool
+	provider  providers.LLMProvider
+	model     string
+	embedders []embeddings.Embedder
+}
+
+// NewAskFileTool creates the tool. token enables Drive and Gmail sources
+// and may be nil; engine enables images and may be nil. Passages are
+// ranked with the offline embedder until SetEmbedders adds better ones.
+func NewAskFileTool(provider providers.LLMProvider, model, workspace string, restrict bool, token TokenFunc, engine ocr.Engine) *AskFileTool {
+	return &AskFileTool{
+		docs:      NewSummarizeTool(provider, model, workspace, restrict, token, engine),
+		provider:  provider,
+		model:     model,
+		embedders: []embeddings.Embedder{embeddings.NewLocal()},
+	}
+}
+
+// SetEmbedders ranks passages with primary, then fallback when it fails,
+// before the offline embedder. Either may be nil.
+func (t *AskFileTool) SetEmbedders(primary, fallback embeddings.Embedder) {
+	var embedders []embeddings.Embedder
+	for _, e := range []embeddings.Embedder{primary, fallback} {
+		if e != nil {
+			embedders = append(embedders, e)
+		}
+	}
+	t.embedders = append(embedders, embeddings.NewLocal())
+}
+
+func (t *AskFileTool) Name() string {
+	return "ask_file"
+}
+
+func (t *AskFileTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *AskFileTool) Description() string {
+	desc := "Answer a question about one document, with citations, without reading it into the conversation: a local file (PDF, text, HTML, image), a web page or PDF URL"
+	if t.docs.token != nil {
+		desc += ", a Google Drive file or a Gmail message"
+	}
+	return desc + ". Use it for one-off questions such as \"what is the notice period in this contract?\"; use summarize for an overview."
+}
+
+func (t *AskFileTool) Parameters() map[string]interface{} {
+	params := t.docs.Parameters()
+	props := params["properties"].(map[string]interface{})
+	delete(props, "focus")
+	delete(props, "length")
+	props["question"] = map[string]interface{}{
+		"type":        "string",
+		"description": "What to find out from the document",
+	}
+	params["required"] = []string{"question"}
+	return params
+}
+
+func (t *AskFileTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	question, _ := args["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return ErrorResult("question is required")
+	}
+	_, doc, result := t.docs.extract(ctx, args)
+	if result != nil {
+		return result
+	}
+	truncated := false
+	if len(doc.Text) > maxSummaryInputChars {
+		doc.Text = doc.Text[:maxSummaryInputChars]
+		truncated = true
+	}
+
+	passages := splitForSummary(doc.Text, askPassageChars)
+	picked, err := t.pick(ctx, question, passages)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to rank passages: %v", err)).WithError(err)
+	}
+	answer, err := t.answer(ctx, doc.Title, question, passages, picked)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("answering failed: %v", err)).WithError(err)
+	}
+	return NewToolResult(formatAnswer(doc.Title, answer, passages, picked, truncated))
+}
+
+// pick returns the numbers (from 0) of the passages closest to question,
+// in document order.
+func (t *AskFileTool) pick(ctx context.Context, question string, passages []string) ([]int, error) {
+	if len(passages) <= askPassages {
+		picked := make([]int, len(passages))
+		for i := range passages {
+			picked[i] = i
+		}
+		return picked, nil
+	}
+	var vectors [][]float32
+	var err error
+	for _, e := range t.embedders {
+		if vectors, err = e.Embed(ctx, append([]string{question}, passages...)); err == nil && len(vectors) == len(passages)+1 {
+			break
+		}
+		if err == nil {
+			err = fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(passages)+1)
+		}
+		logger.WarnCF("ask_file", "Embedder failed, trying the next one", map[string]interface{}{
+			"model": e.Model(),
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(passages))
+	scores := make([]float32, len(passages))
+	for i := range passages {
+		order[i] = i
+		scores[i] = embeddings.Cosine(vectors[0], vectors[i+1])
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	picked := order[:askPassages]
+	sort.Ints(picked)
+	return picked, nil
+}
+
+func (t *AskFileTool) answer(ctx context.Context, title, question string, passages []string, picked []int) (string, error) {
+	var sb strings.Builder
+	for _, i := range picked {
+		fmt.Fprintf(&sb, "[%d]\n%s\n\n", i+1, passages[i])
+	}
+	system := fmt.Sprintf("You answer questions about a document for a personal assistant. Document: %s. "+
+		"You are given numbered passages from it, the ones closest to the question. "+
+		"Answer only from them, briefly, and cite the passage each statement comes from by its number in brackets, e.g. [3]. "+
+		"If the passages do not answer the question, say so. Use the question's language. %s", title, quotedDocumentNote)
+	messages := []providers.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: QuoteUntrusted(t.Name(), strings.TrimSpace(sb.String())) + "\n\nQuestion: " + question},
+	}
+	resp, err := t.provider.Chat(ctx, messages, nil, t.model, map[string]interface{}{
+		"max_tokens":  1000,
+		"temperature": 0.1,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// formatAnswer adds the passages the answer cites, quoted briefly, so the
+// user can check them.
+func formatAnswer(title, answer string, passages []string, picked []int, truncated bool) string {
+	given := map[int]bool{}
+	for _, i := range picked {
+		given[i+1] = true
+	}
+	var cited []int
+	seen := map[int]bool{}
+	for _, m := range askCitation.FindAllStringSubmatch(answer, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if given[n] && !seen[n] {
+			seen[n] = true
+			cited = append(cited, n)
+		}
+	}
+	sort.Ints(cited)
+
+	header := fmt.Sprintf("Answer from %s (%d passages, %d read", title, len(passages), len(picked))
+	if truncated {
+		header += ", only the first part of the document was searched"
+	}
+	var sb strings.Builder
+	sb.WriteString(header + "):\n\n" + answer)
+	if len(cited) > 0 {
+		sb.WriteString("\n\nSources:")
+		for _, n := range cited {
+			fmt.Fprintf(&sb, "\n[%d] %q", n, truncateSnippet(passages[n-1], 200))
+		}
+	}
+	return sb.String()
+}
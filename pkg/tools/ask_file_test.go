@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestAskFileTool_AnswersFromClosestPassagesWithCitations verifies the passages about the question reach the model, numbered, and the ones the answer cites are quoted back
+func TestAskFileTool_AnswersFromClosestPassagesWithCitations(t *testing.T) {
+	workspace := t.TempDir()
+	var doc strings.Builder
+	for i := 0; i < 12; i++ {
+		doc.WriteString(strings.Repeat("The landlord maintains the garden and the shared stairwell. ", 24) + "\n\n")
+	}
+	doc.WriteString("The tenant pays a security deposit of two months rent, refunded within thirty days after moving out.\n\n")
+	for i := 0; i < 12; i++ {
+		doc.WriteString(strings.Repeat("Pets are allowed with written permission from the owner. ", 24) + "\n\n")
+	}
+	os.WriteFile(filepath.Join(workspace, "lease.txt"), []byte(doc.String()), 0644)
+
+	provider := testkit.NewProvider(testkit.Say("Two months of rent [13], refunded within thirty days [13]. Pets need permission [99]."))
+	tool := NewAskFileTool(provider, "test", workspace, true, nil, nil)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "lease.txt", "question": "How much is the security deposit?"})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	calls := provider.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected one LLM call, got %d", len(calls))
+	}
+	prompt := calls[0].LastMessage()
+	if !strings.Contains(prompt, "[13]\nThe tenant pays a security deposit") || !strings.Contains(prompt, "Question: How much is the security deposit?") {
+		t.Errorf("Expected the deposit passage numbered 13 and the question, got:\n%s", prompt)
+	}
+	if n := strings.Count(prompt, "\n\n[") + 1; n != askPassages {
+		t.Errorf("Expected %d passages given, got %d", askPassages, n)
+	}
+	if !strings.Contains(result.ForLLM, "Answer from lease.txt (24 passages, 6 read)") || !strings.Contains(result.ForLLM, "Sources:\n[13] \"The tenant pays") {
+		t.Errorf("Expected the cited passage quoted, got:\n%s", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "[99] ") {
+		t.Errorf("Expected a citation of a passage not given to be ignored, got:\n%s", result.ForLLM)
+	}
+
+	if result := tool.Execute(context.Background(), map[string]interface{}{"path": "lease.txt"}); !result.IsError {
+		t.Error("Expected an error without a question")
+	}
+}
@@ -0,0 +1,808 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+)
+
+const (
+	// attachmentReadTimeout bounds reading the text of one received file
+	// (pdftotext, OCR), which holds up the message it came with
+	attachmentReadTimeout = 30 * time.Second
+	// maxAttachmentText is how much of a text file is classified
+	maxAttachmentText = 64 << 10
+	// maxInboxItems bounds the files the inbox remembers
+	maxInboxItems = 500
+	maxInboxList  = 20
+)
+
+// Kinds of received files the inbox tells apart.
+const (
+	attachmentReceipt  = "receipt"
+	attachmentID       = "id_document"
+	attachmentContract = "contract"
+	attachmentPhoto    = "photo"
+	attachmentDocument = "document"
+	attachmentOther    = "other"
+)
+
+var attachmentKindNames = map[string]string{
+	attachmentReceipt:  "a receipt",
+	attachmentID:       "an ID document",
+	attachmentContract: "a contract",
+	attachmentPhoto:    "a photo",
+	attachmentDocument: "a document",
+	attachmentOther:    "a file",
+}
+
+var (
+	reReceiptFileName  = regexp.MustCompile(`(?i)receipt|recibo|fatura|factura|invoice|rechnung|quittung|ticket`)
+	reIDFileName       = regexp.MustCompile(`(?i)passport|passaporte|pasaporte|identity|id[-_ ]?card|licen[cs]e|cart[aã]o[-_ ]de[-_ ]cidad`)
+	reContractFileName = regexp.MustCompile(`(?i)contract|contrato|agreement|vertrag|lease|\bnda\b`)
+	// reMRZ finds the machine-readable lines of passports and ID cards
+	reMRZ = regexp.MustCompile(`[A-Z0-9<]{2}[A-Z<]{3}[A-Z0-9<]{20,}<<`)
+
+	receiptTerms = phrasePattern("total", "subtotal", "vat", "iva", "nif", "mwst", "tva", "cash", "change", "troco",
+		"multibanco", "receipt", "recibo", "fatura", "factura", "invoice", "thank you", "obrigado")
+	idTerms = phrasePattern("passport", "passaporte", "pasaporte", "reisepass", "identity card", "carte d'identit",
+		"cartão de cidadão", "documento de identidad", "personalausweis", "driving licence", "driver license",
+		"driver's license", "carta de condução", "date of birth", "data de nascimento", "fecha de nacimiento",
+		"geburtsdatum", "nationality", "nacionalidade", "nacionalidad", "date of expiry", "validade")
+	contractTerms = phrasePattern("agreement", "contract", "contrato", "vertrag", "hereinafter", "the parties",
+		"entre as partes", "las partes", "clause", "cláusula", "terms and conditions", "signature", "assinatura",
+		"unterschrift", "lease", "tenancy", "arrendamento", "landlord", "senhorio")
+)
+
+// phrasePattern matches any of phrases at the start of a word, in any case.
+func phrasePattern(phrases ...string) *regexp.Regexp {
+	quoted := make([]string, len(phrases))
+	for i, p := range phrases {
+		quoted[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)`)
+}
+
+// distinctMatches returns the different phrases of re found in text.
+func distinctMatches(re *regexp.Regexp, text string) []string {
+	seen := map[string]bool{}
+	var found []string
+	for _, m := range re.FindAllString(text, -1) {
+		if m = strings.ToLower(m); !seen[m] {
+			seen[m] = true
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// ClassifyAttachment guesses what a received file is from its name, type
+// and text (extracted from a PDF, read by OCR from an image, or the file
+// itself): receipt, id_document, contract, photo, document or other.
+// clue says what gave it away, in words of its own rather than the
+// file's, so it is safe to put before the model.
+func ClassifyAttachment(name, mimeType, text string) (kind, clue string) {
+	type evidence struct {
+		score int
+		clues []string
+	}
+	found := map[string]*evidence{attachmentReceipt: {}, attachmentID: {}, attachmentContract: {}}
+	for kind, re := range map[string]*regexp.Regexp{attachmentReceipt: reReceiptFileName, attachmentID: reIDFileName, attachmentContract: reContractFileName} {
+		if re.MatchString(name) {
+			found[kind].score += 3
+			found[kind].clues = append(found[kind].clues, "its name")
+		}
+	}
+	if text != "" {
+		for kind, re := range map[string]*regexp.Regexp{attachmentReceipt: receiptTerms, attachmentID: idTerms, attachmentContract: contractTerms} {
+			if terms := distinctMatches(re, text); len(terms) > 0 {
+				found[kind].score += len(terms)
+				for i, term := range terms {
+					terms[i] = strconv.Quote(term)
+				}
+				found[kind].clues = append(found[kind].clues, "the words "+strings.Join(terms, ", "))
+			}
+		}
+		if r := ParseReceipt(text); r.Total > 0 && reReceiptTotal.MatchString(text) {
+			found[attachmentReceipt].score += 2
+			found[attachmentReceipt].clues = append(found[attachmentReceipt].clues, "a total")
+		}
+		if reMRZ.MatchString(text) {
+			found[attachmentID].score += 3
+			found[attachmentID].clues = append(found[attachmentID].clues, "a machine-readable zone")
+		}
+	}
+
+	// Ties go to the rarer, more sensitive kinds
+	best := ""
+	for _, k := range []string{attachmentID, attachmentContract, attachmentReceipt} {
+		if e := found[k]; e.score >= 3 && (best == "" || e.score > found[best].score) {
+			best = k
+		}
+	}
+	if best != "" {
+		return best, "from " + strings.Join(found[best].clues, " and ")
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		return attachmentPhoto, "a video"
+	case strings.HasPrefix(mimeType, "image/") && len(strings.Fields(text)) < 15:
+		if text == "" {
+			return attachmentPhoto, "a picture; its text was not read, so look at it if unsure"
+		}
+		return attachmentPhoto, "a picture with little text"
+	case strings.HasPrefix(mimeType, "image/"), mimeType == "application/pdf", strings.HasPrefix(mimeType, "text/"),
+		ext == ".docx", ext == ".doc", ext == ".odt", ext == ".xlsx", ext == ".pptx":
+		return attachmentDocument, "no receipt, ID or contract wording found"
+	}
+	return attachmentOther, "an unrecognized file type"
+}
+
+// attachmentFiling is where a file goes: Destination "drive" (Folder is a
+// folder path under My Drive), "photos" (Folder is an album, "" for the
+// library only) or "expenses" (the amount is logged, and the file saved
+// in the Drive folder Folder when set).
+type attachmentFiling struct {
+	Destination string `json:"destination"`
+	Folder      string `json:"folder,omitempty"`
+}
+
+func (f attachmentFiling) String() string {
+	switch f.Destination {
+	case "photos":
+		if f.Folder != "" {
+			return fmt.Sprintf("add it to the Google Photos album %q", f.Folder)
+		}
+		return "upload it to Google Photos"
+	case "expenses":
+		if f.Folder != "" {
+			return fmt.Sprintf("log the expense and save it in the Drive folder %q", f.Folder)
+		}
+		return "log the expense"
+	}
+	if f.Folder == "" {
+		return "save it in My Drive"
+	}
+	return fmt.Sprintf("save it in the Drive folder %q", f.Folder)
+}
+
+// defaultAttachmentFilings are suggested until a user has filed a kind of
+// file themselves.
+var defaultAttachmentFilings = map[string]attachmentFiling{
+	attachmentReceipt:  {Destination: "expenses", Folder: "Receipts"},
+	attachmentID:       {Destination: "drive", Folder: "Documents/IDs"},
+	attachmentContract: {Destination: "drive", Folder: "Documents/Contracts"},
+	attachmentPhoto:    {Destination: "photos"},
+	attachmentDocument: {Destination: "drive", Folder: "Documents"},
+}
+
+// attachmentChoice counts how often a user filed a kind of file somewhere.
+type attachmentChoice struct {
+	attachmentFiling
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// receivedAttachment is a file a user sent, as the inbox classified it.
+type receivedAttachment struct {
+	Artifact string    `json:"artifact"`
+	Name     string    `json:"name"`
+	MimeType string    `json:"mime_type"`
+	Chat     string    `json:"chat"`
+	User     string    `json:"user"`
+	Kind     string    `json:"kind"`
+	Clue     string    `json:"clue,omitempty"`
+	Receipt  *Receipt  `json:"receipt,omitempty"`
+	Received time.Time `json:"received"`
+	// Filed says where the file went; empty while it waits
+	Filed string `json:"filed,omitempty"`
+}
+
+type attachmentInboxState struct {
+	Items []receivedAttachment `json:"items"`
+	// Preferences are the filings per user ("channel:sender") and kind
+	Preferences map[string]map[string][]attachmentChoice `json:"preferences,omitempty"`
+}
+
+// AttachmentInboxTool classifies every file users send in chat (receipt,
+// ID document, contract, photo, other document) from its name and text,
+// read with pdftotext or OCR, and suggests where to file it: Drive, Google
+// Photos or the expense log. Where a user files each kind is remembered,
+// so the next suggestion follows their habit. Files are taken from the
+// artifact store the channels put them in.
+type AttachmentInboxTool struct {
+	artifacts *artifacts.Store
+	ocr       ocr.Engine
+	token     TokenFunc
+	ledger    ExpenseLedger
+	currency  string
+	statePath string
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// NewAttachmentInboxTool creates the tool. token, ledger and engine may be
+// nil, which leaves out filing to Google, logging expenses and reading
+// images.
+func NewAttachmentInboxTool(store *artifacts.Store, workspace string, token TokenFunc, ledger ExpenseLedger, currency string, engine ocr.Engine) *AttachmentInboxTool {
+	if currency == "" {
+		currency = "USD"
+	}
+	return &AttachmentInboxTool{
+		artifacts: store,
+		ocr:       engine,
+		token:     token,
+		ledger:    ledger,
+		currency:  currency,
+		statePath: filepath.Join(workspace, "state", "attachments.json"),
+		now:       time.Now,
+	}
+}
+
+func (t *AttachmentInboxTool) Name() string {
+	return "attachments"
+}
+
+func (t *AttachmentInboxTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "file")
+}
+
+// Untrusted reports that listings carry file names and text read from
+// the files.
+func (t *AttachmentInboxTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "list")
+}
+
+func (t *AttachmentInboxTool) Description() string {
+	return "Inbox of the files the user sent in chat. Each file is classified when it arrives (receipt, ID document, contract, photo, document) and a place to file it suggested, following where this user filed that kind of file before. list shows the files of this chat not filed yet; file saves one to a Drive folder, to Google Photos (optionally an album) or logs it as an expense (receipts, with the amount read from them). Only file after the user agreed to the suggestion or said where. If the kind looks wrong, e.g. after looking at the image, pass the right kind."
+}
+
+func (t *AttachmentInboxTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"list", "file"},
+			},
+			"attachment": map[string]interface{}{
+				"type":        "string",
+				"description": "File to file, as artifact:ID (default: the last one received in this chat not filed yet)",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"drive", "photos", "expenses"},
+				"description": "Where to file it (default: the suggestion)",
+			},
+			"folder": map[string]interface{}{
+				"type":        "string",
+				"description": "Drive folder path such as \"Documents/Car\" (drive, expenses), or album title (photos)",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{attachmentReceipt, attachmentID, attachmentContract, attachmentPhoto, attachmentDocument, attachmentOther},
+				"description": "Corrected kind of file, remembered with the filing",
+			},
+			"amount": map[string]interface{}{
+				"type":        "number",
+				"description": "Expense amount, when it could not be read from the receipt",
+			},
+			"merchant": map[string]interface{}{
+				"type": "string",
+			},
+			"category": map[string]interface{}{
+				"type":        "string",
+				"description": "Expense category, e.g. \"groceries\"",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *AttachmentInboxTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	action, _ := args["action"].(string)
+	switch action {
+	case "list":
+		return t.list(channel + ":" + chatID)
+	case "file":
+		user := channel + ":" + SenderFromContext(ctx)
+		if SenderFromContext(ctx) == "" {
+			user = channel + ":" + chatID
+		}
+		return t.file(ctx, channel+":"+chatID, user, args)
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+// Receive classifies the files of a message received in a chat, which
+// the channel stored as artifacts (media are the artifacts' paths), and
+// returns a note for the agent per file with the suggested filing.
+func (t *AttachmentInboxTool) Receive(ctx context.Context, channel, chatID, senderID string, media []string) string {
+	var notes strings.Builder
+	var received []receivedAttachment
+	for _, path := range media {
+		a, ok := t.artifacts.Get(filepath.Base(filepath.Dir(path)))
+		if !ok || a.Path != path {
+			continue
+		}
+		item := t.classify(ctx, a)
+		item.Chat, item.User = channel+":"+chatID, channel+":"+senderID
+		received = append(received, item)
+	}
+	if len(received) == 0 {
+		return ""
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadLocked()
+	if err != nil {
+		logger.WarnCF("attachments", "Attachment inbox unavailable", map[string]interface{}{"error": err.Error()})
+		return ""
+	}
+	for _, item := range received {
+		state.Items = append(state.Items, item)
+		if item.Kind == attachmentOther {
+			continue
+		}
+		fmt.Fprintf(&notes, "\n[%s looks like %s (%s)", artifacts.Prefix+item.Artifact, attachmentKindNames[item.Kind], item.Clue)
+		if item.Receipt != nil {
+			fmt.Fprintf(&notes, ", total %.2f", item.Receipt.Total)
+		}
+		if filing, ok := t.suggestLocked(state, item.User, item.Kind); ok {
+			fmt.Fprintf(&notes, "; suggested filing: %s. Offer it, and use the attachments tool if the user agrees", filing)
+		}
+		notes.WriteString("]")
+	}
+	if err := t.saveLocked(state); err != nil {
+		logger.WarnCF("attachments", "Failed to save the attachment inbox", map[string]interface{}{"error": err.Error()})
+	}
+	return notes.String()
+}
+
+// classify reads a stored file's text and classifies it.
+func (t *AttachmentInboxTool) classify(ctx context.Context, a *artifacts.Artifact) receivedAttachment {
+	text := t.readText(ctx, a)
+	kind, clue := ClassifyAttachment(a.Name, a.MimeType, text)
+	item := receivedAttachment{Artifact: a.ID, Name: a.Name, MimeType: a.MimeType, Kind: kind, Clue: clue, Received: t.now()}
+	if kind == attachmentReceipt {
+		if r := ParseReceipt(text); r.Total > 0 {
+			item.Receipt = &r
+		}
+	}
+	return item
+}
+
+// readText extracts what text it can from a file; failures (no
+// pdftotext, no OCR, a photo without words) leave it empty.
+func (t *AttachmentInboxTool) readText(ctx context.Context, a *artifacts.Artifact) string {
+	ctx, cancel := context.WithTimeout(ctx, attachmentReadTimeout)
+	defer cancel()
+	var text string
+	var err error
+	switch {
+	case a.MimeType == "application/pdf":
+		text, err = pdfToText(ctx, a.Path)
+	case strings.HasPrefix(a.MimeType, "image/"):
+		if t.ocr == nil || !t.ocr.IsAvailable() {
+			return ""
+		}
+		text, err = t.ocr.Recognize(ctx, a.Path)
+	case strings.HasPrefix(a.MimeType, "text/"):
+		var f *os.File
+		if f, err = os.Open(a.Path); err == nil {
+			var data []byte
+			data, err = io.ReadAll(io.LimitReader(f, maxAttachmentText))
+			f.Close()
+			text = string(data)
+		}
+	}
+	if err != nil {
+		logger.DebugCF("attachments", "Could not read attachment text", map[string]interface{}{
+			"file":  a.Name,
+			"error": err.Error(),
+		})
+	}
+	return text
+}
+
+// suggestLocked picks where a user's file of kind should go: where they
+// filed that kind most often (the latest on a tie), or the default for
+// the kind, adjusted to what is set up.
+func (t *AttachmentInboxTool) suggestLocked(state *attachmentInboxState, user, kind string) (attachmentFiling, bool) {
+	if choices := state.Preferences[user][kind]; len(choices) > 0 {
+		best := choices[0]
+		for _, c := range choices[1:] {
+			if c.Count > best.Count || c.Count == best.Count && c.Last.After(best.Last) {
+				best = c
+			}
+		}
+		return best.attachmentFiling, true
+	}
+	filing, ok := defaultAttachmentFilings[kind]
+	if !ok {
+		return attachmentFiling{}, false
+	}
+	if filing.Destination == "expenses" && t.ledger == nil {
+		filing.Destination = "drive"
+	}
+	if t.token == nil {
+		if filing.Destination != "expenses" {
+			return attachmentFiling{}, false
+		}
+		filing.Folder = ""
+	}
+	return filing, true
+}
+
+func (t *AttachmentInboxTool) list(chat string) *ToolResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadLocked()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	var sb strings.Builder
+	shown, filed := 0, 0
+	for i := len(state.Items) - 1; i >= 0; i-- {
+		item := state.Items[i]
+		if item.Chat != chat {
+			continue
+		}
+		if item.Filed != "" {
+			filed++
+			continue
+		}
+		if shown++; shown > maxInboxList {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n- %s%s %s, received %s: %s", artifacts.Prefix, item.Artifact, item.Name, item.Received.Format("2 Jan 15:04"), item.Kind)
+		if item.Receipt != nil {
+			fmt.Fprintf(&sb, " (total %.2f", item.Receipt.Total)
+			if item.Receipt.Merchant != "" {
+				fmt.Fprintf(&sb, ", %s", item.Receipt.Merchant)
+			}
+			sb.WriteString(")")
+		}
+		if filing, ok := t.suggestLocked(state, item.User, item.Kind); ok {
+			fmt.Fprintf(&sb, "; suggested: %s", filing)
+		}
+	}
+	if shown == 0 {
+		return SilentResult(fmt.Sprintf("No files waiting to be filed in this chat (%d filed).", filed))
+	}
+	header := fmt.Sprintf("%d file(s) not filed yet", shown)
+	if shown > maxInboxList {
+		header += fmt.Sprintf(", the latest %d shown", maxInboxList)
+	}
+	return SilentResult(header + ":" + sb.String())
+}
+
+func (t *AttachmentInboxTool) file(ctx context.Context, chat, user string, args map[string]interface{}) *ToolResult {
+	t.mu.Lock()
+	state, err := t.loadLocked()
+	if err != nil {
+		t.mu.Unlock()
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	ref, _ := args["attachment"].(string)
+	ref = strings.TrimPrefix(strings.TrimSpace(ref), artifacts.Prefix)
+	var item *receivedAttachment
+	for i := len(state.Items) - 1; i >= 0 && item == nil; i-- {
+		if it := &state.Items[i]; (ref == "" && it.Chat == chat && it.Filed == "") || (ref != "" && it.Artifact == ref) {
+			item = it
+		}
+	}
+	var copied receivedAttachment
+	if item != nil {
+		copied = *item
+	}
+	t.mu.Unlock()
+
+	if item == nil && ref == "" {
+		return ErrorResult("no file waiting to be filed in this chat; give attachment")
+	}
+	if item != nil {
+		ref = copied.Artifact
+	}
+	a, ok := t.artifacts.Get(ref)
+	if !ok {
+		return ErrorResult("that file is no longer kept; ask the user to send it again")
+	}
+	if item == nil {
+		// A file another tool stored
+		copied = t.classify(ctx, a)
+		copied.Chat, copied.User = chat, user
+	}
+	if kind, _ := args["kind"].(string); kind != "" {
+		if _, known := attachmentKindNames[kind]; !known {
+			return ErrorResult(fmt.Sprintf("unknown kind %q", kind))
+		}
+		copied.Kind = kind
+	}
+
+	t.mu.Lock()
+	filing, suggested := t.suggestLocked(state, user, copied.Kind)
+	t.mu.Unlock()
+	if dest, _ := args["destination"].(string); dest != "" {
+		if dest != filing.Destination {
+			filing = attachmentFiling{Destination: dest}
+		}
+		suggested = true
+	}
+	if folder, ok := args["folder"].(string); ok {
+		filing.Folder = strings.Trim(strings.TrimSpace(folder), "/")
+	}
+	if !suggested {
+		return ErrorResult(fmt.Sprintf("no filing to suggest for %s; give destination", attachmentKindNames[copied.Kind]))
+	}
+
+	done, err := t.store(ctx, a, copied, filing, args)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("filing %s failed: %v", a.Name, err)).WithError(err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, err = t.loadLocked(); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	copied.Filed = done
+	replaced := false
+	for i := range state.Items {
+		if state.Items[i].Artifact == copied.Artifact {
+			state.Items[i], replaced = copied, true
+		}
+	}
+	if !replaced {
+		state.Items = append(state.Items, copied)
+	}
+	t.rememberLocked(state, user, copied.Kind, filing)
+	if err := t.saveLocked(state); err != nil {
+		logger.WarnCF("attachments", "Failed to save the attachment inbox", map[string]interface{}{"error": err.Error()})
+	}
+	return SilentResult(fmt.Sprintf("Filed %s (%s): %s.", a.Name, copied.Kind, done))
+}
+
+// store carries out a filing and describes what was done.
+func (t *AttachmentInboxTool) store(ctx context.Context, a *artifacts.Artifact, item receivedAttachment, filing attachmentFiling, args map[string]interface{}) (string, error) {
+	switch filing.Destination {
+	case "drive":
+		return t.saveToDrive(ctx, a, filing.Folder)
+	case "photos":
+		if t.token == nil {
+			return "", fmt.Errorf("Google Photos is not set up")
+		}
+		if !strings.HasPrefix(a.MimeType, "image/") && !strings.HasPrefix(a.MimeType, "video/") {
+			return "", fmt.Errorf("Google Photos only takes pictures and videos, not %s", a.MimeType)
+		}
+		photos := NewGooglePhotosClient(t.token)
+		albumID := ""
+		if filing.Folder != "" {
+			id, err := findOrCreateAlbum(ctx, photos, filing.Folder)
+			if err != nil {
+				return "", err
+			}
+			albumID = id
+		}
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := photos.Upload(ctx, a.Name, a.MimeType, f, albumID); err != nil {
+			return "", err
+		}
+		if filing.Folder != "" {
+			return fmt.Sprintf("added to the Google Photos album %q", filing.Folder), nil
+		}
+		return "uploaded to Google Photos", nil
+	case "expenses":
+		if t.ledger == nil {
+			return "", fmt.Errorf("the expense log is not set up")
+		}
+		var receipt Receipt
+		if item.Receipt != nil {
+			receipt = *item.Receipt
+		}
+		if amount, ok := args["amount"].(float64); ok && amount > 0 {
+			receipt.Total = amount
+		}
+		if receipt.Total <= 0 {
+			return "", fmt.Errorf("no total could be read from it; ask the user for the amount")
+		}
+		if merchant, _ := args["merchant"].(string); strings.TrimSpace(merchant) != "" {
+			receipt.Merchant = strings.TrimSpace(merchant)
+		}
+		if receipt.Date.IsZero() {
+			receipt.Date = t.now()
+		}
+		category, _ := args["category"].(string)
+		saved := ""
+		note := a.Name
+		if filing.Folder != "" && t.token != nil {
+			var err error
+			if saved, err = t.saveToDrive(ctx, a, filing.Folder); err != nil {
+				return "", err
+			}
+			note = saved
+		}
+		expense := &Expense{Date: receipt.Date, Cents: toCents(receipt.Total), Currency: t.currency,
+			Category: strings.TrimSpace(category), Merchant: receipt.Merchant, Note: note}
+		if err := t.ledger.Add(ctx, expense); err != nil {
+			return "", err
+		}
+		done := fmt.Sprintf("logged %s", formatCents(expense.Cents, expense.Currency))
+		if expense.Merchant != "" {
+			done += " at " + expense.Merchant
+		}
+		if saved != "" {
+			done += " and " + saved
+		}
+		return done, nil
+	}
+	return "", fmt.Errorf("unknown destination %q", filing.Destination)
+}
+
+func (t *AttachmentInboxTool) saveToDrive(ctx context.Context, a *artifacts.Artifact, folder string) (string, error) {
+	if t.token == nil {
+		return "", fmt.Errorf("Google Drive is not set up")
+	}
+	drive := NewGoogleDriveClient(t.token)
+	folderID, err := ensureDriveFolderPath(ctx, drive, folder)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return "", err
+	}
+	f, err := drive.Upload(ctx, folderID, a.Name, a.MimeType, data)
+	if err != nil {
+		return "", err
+	}
+	where := "My Drive"
+	if folder != "" {
+		where = fmt.Sprintf("the Drive folder %q", folder)
+	}
+	if f.WebViewLink != "" {
+		return fmt.Sprintf("saved in %s (%s)", where, f.WebViewLink), nil
+	}
+	return "saved in " + where, nil
+}
+
+// rememberLocked counts a filing towards the user's preferences.
+func (t *AttachmentInboxTool) rememberLocked(state *attachmentInboxState, user, kind string, filing attachmentFiling) {
+	if state.Preferences == nil {
+		state.Preferences = map[string]map[string][]attachmentChoice{}
+	}
+	if state.Preferences[user] == nil {
+		state.Preferences[user] = map[string][]attachmentChoice{}
+	}
+	choices := state.Preferences[user][kind]
+	for i, c := range choices {
+		if c.Destination == filing.Destination && strings.EqualFold(c.Folder, filing.Folder) {
+			choices[i].Count++
+			choices[i].Last = t.now()
+			return
+		}
+	}
+	state.Preferences[user][kind] = append(choices, attachmentChoice{attachmentFiling: filing, Count: 1, Last: t.now()})
+}
+
+func (t *AttachmentInboxTool) loadLocked() (*attachmentInboxState, error) {
+	state := &attachmentInboxState{}
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the attachment inbox: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse the attachment inbox: %w", err)
+	}
+	return state, nil
+}
+
+// saveLocked writes the state, forgetting files the artifact store no
+// longer keeps.
+func (t *AttachmentInboxTool) saveLocked(state *attachmentInboxState) error {
+	kept := state.Items[:0]
+	for _, item := range state.Items {
+		if _, ok := t.artifacts.Get(item.Artifact); ok {
+			kept = append(kept, item)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Received.Before(kept[j].Received) })
+	if len(kept) > maxInboxItems {
+		kept = kept[len(kept)-maxInboxItems:]
+	}
+	state.Items = kept
+	return saveJSONAtomic(t.statePath, state)
+}
+
+// chatUsers returns the users ("channel:sender") who sent files in the
+// chat, and the chat itself, which is the user in a direct chat.
+func (state *attachmentInboxState) chatUsers(chatKey string) map[string]bool {
+	users := map[string]bool{chatKey: true}
+	for _, item := range state.Items {
+		if item.Chat == chatKey {
+			users[item.User] = true
+		}
+	}
+	return users
+}
+
+// ChatData implements ChatDataStore: the files received in the chat and
+// where its users file each kind.
+func (t *AttachmentInboxTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	out := attachmentInboxState{Preferences: map[string]map[string][]attachmentChoice{}}
+	for _, item := range state.Items {
+		if item.Chat == chatKey {
+			out.Items = append(out.Items, item)
+		}
+	}
+	for user := range state.chatUsers(chatKey) {
+		if prefs, ok := state.Preferences[user]; ok {
+			out.Preferences[user] = prefs
+		}
+	}
+	if len(out.Items) == 0 && len(out.Preferences) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// PurgeChat implements ChatDataStore. The files themselves are artifacts,
+// deleted with the chat's.
+func (t *AttachmentInboxTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadLocked()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for user := range state.chatUsers(chatKey) {
+		if _, ok := state.Preferences[user]; ok {
+			delete(state.Preferences, user)
+			n++
+		}
+	}
+	kept := state.Items[:0]
+	for _, item := range state.Items {
+		if item.Chat == chatKey {
+			n++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	state.Items = kept
+	if n == 0 {
+		return 0, nil
+	}
+	return n, t.saveLocked(state)
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestClassifyAttachment verifies receipts, ID documents, contracts, photos and other files are told apart by name and text
+func TestClassifyAttachment(t *testing.T) {
+	tests := []struct {
+		name, mimeType, text string
+		want                 string
+	}{
+		{"IMG_0042.jpg", "image/jpeg", "PINGO DOCE\nLeite 1,29\nPao 0,80\nTOTAL 23,40\nIVA 1,20\nMultibanco", attachmentReceipt},
+		{"scan.jpg", "image/jpeg", "PASSPORT\nSurname SILVA\nP<PRTSILVA<<ANA<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<\nAB1234567<PRT8001014F3001012<<<<<<<<<<<<<<02", attachmentID},
+		{"doc.pdf", "application/pdf", "LEASE AGREEMENT\nThis agreement is made between the parties hereinafter the Landlord and the Tenant. Clause 1 ...", attachmentContract},
+		{"fatura-2026-10.pdf", "application/pdf", "", attachmentReceipt},
+		{"IMG_0043.jpg", "image/jpeg", "", attachmentPhoto},
+		{"beach.jpg", "image/jpeg", "SURF SHOP", attachmentPhoto},
+		{"notes.txt", "text/plain", "Shopping list: milk, bread", attachmentDocument},
+		{"clip.mp4", "video/mp4", "", attachmentPhoto},
+		{"backup.zip", "application/zip", "", attachmentOther},
+	}
+	for _, tt := range tests {
+		if got, clue := ClassifyAttachment(tt.name, tt.mimeType, tt.text); got != tt.want {
+			t.Errorf("%s: got %s (%s), want %s", tt.name, got, clue, tt.want)
+		}
+	}
+}
+
+// TestAttachmentInboxTool_SuggestsAndLearns verifies received files get a filing suggestion, filing saves them where asked, and the next file of the same kind is suggested the user's folder
+func TestAttachmentInboxTool_SuggestsAndLearns(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	store := artifacts.New(t.TempDir())
+	ledger := &memoryLedger{}
+	tool := NewAttachmentInboxTool(store, t.TempDir(), testkit.Token, ledger, "EUR", fakeOCR{"Tenancy agreement between the parties. Signature: ______"})
+	ctx := WithSender(WithChat(context.Background(), "telegram", "42"), "7")
+
+	receive := func(name, content string) (*artifacts.Artifact, string) {
+		a, err := store.Put(strings.NewReader(content), name, "", "telegram", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a, tool.Receive(ctx, "telegram", "42", "7", []string{a.Path})
+	}
+
+	lease, note := receive("IMG_0001.jpg", "jpeg")
+	if !strings.Contains(note, lease.Ref()+" looks like a contract") || !strings.Contains(note, `"Documents/Contracts"`) {
+		t.Fatalf("unexpected note: %s", note)
+	}
+	result := tool.Execute(ctx, map[string]interface{}{"action": "file", "folder": "Home/Lease"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	var saved bool
+	for _, f := range g.Files() {
+		saved = saved || f.Name == "IMG_0001.jpg"
+	}
+	if !saved {
+		t.Errorf("the contract was not uploaded: %+v", g.Files())
+	}
+	if _, note = receive("IMG_0002.jpg", "jpeg"); !strings.Contains(note, `"Home/Lease"`) {
+		t.Errorf("the next contract should go where the last one went: %s", note)
+	}
+
+	receipt, note := receive("compra.txt", "PINGO DOCE\nTOTAL 23,40\nIVA 1,20\n")
+	if !strings.Contains(note, "looks like a receipt") || !strings.Contains(note, "total 23.40") || !strings.Contains(note, "log the expense") {
+		t.Fatalf("unexpected note: %s", note)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if !strings.Contains(result.ForLLM, "2 file(s) not filed yet") || !strings.Contains(result.ForLLM, "PINGO DOCE") {
+		t.Errorf("unexpected list:\n%s", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"action": "file", "attachment": receipt.Ref(), "category": "groceries"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if len(ledger.expenses) != 1 || ledger.expenses[0].Cents != 2340 || ledger.expenses[0].Category != "groceries" {
+		t.Errorf("unexpected expenses: %+v", ledger.expenses)
+	}
+
+	tool.ocr = fakeOCR{}
+	photo, _ := receive("IMG_0003.jpg", "jpeg")
+	result = tool.Execute(ctx, map[string]interface{}{"action": "file", "attachment": photo.Ref(), "folder": "Holidays"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if albums := g.Albums(); len(albums) != 1 || albums[0].Title != "Holidays" || len(albums[0].Items) != 1 {
+		t.Errorf("expected the photo in a Holidays album, got %+v", albums)
+	}
+}
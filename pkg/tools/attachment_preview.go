@@ -0,0 +1,225 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/imaging"
+)
+
+// documentTypes are the documents the message tool sends besides images,
+// by extension: their MIME type and what to call them in a caption.
+var documentTypes = map[string]struct{ mime, kind string }{
+	".pdf":  {"application/pdf", "PDF"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "Word document"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "Excel spreadsheet"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "PowerPoint presentation"},
+	".odt":  {"application/vnd.oasis.opendocument.text", "OpenDocument text"},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet", "OpenDocument spreadsheet"},
+	".odp":  {"application/vnd.oasis.opendocument.presentation", "OpenDocument presentation"},
+}
+
+const (
+	// thumbnailSize bounds the longer side of a document thumbnail
+	thumbnailSize = 320
+	// maxPageScan is how much of a PDF is searched for page objects when
+	// pdfinfo is not installed
+	maxPageScan = 32 << 20
+)
+
+// attachmentPreview is what a caption says about one attachment.
+type attachmentPreview struct {
+	Name string
+	Kind string
+	Size int64
+	// Pages counts pages, or slides for presentations; 0 when unknown
+	Pages    int
+	PageWord string
+	// Width and Height are an image's dimensions
+	Width, Height int
+	// Thumbnail is a preview image file of a document, if one could be made
+	Thumbnail string
+}
+
+// String is the caption line for the attachment, such as
+// "report.pdf: PDF, 12 pages, 1.4 MB".
+func (p attachmentPreview) String() string {
+	parts := []string{p.Kind}
+	if p.Width > 0 && p.Height > 0 {
+		parts[0] = fmt.Sprintf("%s, %d×%d", p.Kind, p.Width, p.Height)
+	}
+	if p.Pages > 0 {
+		word := p.PageWord
+		if p.Pages != 1 {
+			word += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", p.Pages, word))
+	}
+	parts = append(parts, formatFileSize(p.Size))
+	return p.Name + ": " + strings.Join(parts, ", ")
+}
+
+// previewImage describes an image file.
+func previewImage(path, mimeType string, size int64) attachmentPreview {
+	p := attachmentPreview{
+		Name: filepath.Base(path),
+		Kind: strings.ToUpper(strings.TrimPrefix(mimeType, "image/")) + " image",
+		Size: size,
+	}
+	if f, err := os.Open(path); err == nil {
+		if cfg, _, err := image.DecodeConfig(f); err == nil {
+			p.Width, p.Height = cfg.Width, cfg.Height
+		}
+		f.Close()
+	}
+	return p
+}
+
+// previewDocument describes a document and, when thumbDir is set, renders
+// a thumbnail of its first page into it: with pdftoppm for PDFs, from the
+// preview image office files carry otherwise.
+func previewDocument(ctx context.Context, path string, size int64, thumbDir string) attachmentPreview {
+	ext := strings.ToLower(filepath.Ext(path))
+	p := attachmentPreview{Name: filepath.Base(path), Kind: documentTypes[ext].kind, Size: size, PageWord: "page"}
+	if ext == ".pptx" || ext == ".odp" {
+		p.PageWord = "slide"
+	}
+
+	var thumb []byte
+	if ext == ".pdf" {
+		p.Pages = pdfPages(ctx, path)
+		if thumbDir != "" {
+			thumb = pdfThumbnail(ctx, path)
+		}
+	} else {
+		p.Pages, thumb = officePreview(path)
+		if thumbDir == "" {
+			thumb = nil
+		}
+	}
+	if len(thumb) > 0 {
+		if img, _, err := image.Decode(bytes.NewReader(thumb)); err == nil {
+			var buf bytes.Buffer
+			if imaging.EncodeJPEG(&buf, imaging.Thumbnail(img, thumbnailSize), imaging.ThumbnailQuality) == nil {
+				p.Thumbnail, _ = savePreview(thumbDir, "document", ".jpg", buf.Bytes())
+			}
+		}
+	}
+	return p
+}
+
+var (
+	pdfInfoPages = regexp.MustCompile(`(?m)^Pages:\s+(\d+)`)
+	pdfPageObj   = regexp.MustCompile(`/Type\s*/Page([^a-zA-Z]|$)`)
+)
+
+// pdfPages counts a PDF's pages with pdfinfo, or by its page objects when
+// pdfinfo is missing; those can be hidden in compressed object streams, so
+// 0 means unknown.
+func pdfPages(ctx context.Context, path string) int {
+	if _, err := exec.LookPath("pdfinfo"); err == nil {
+		if out, err := exec.CommandContext(ctx, "pdfinfo", path).Output(); err == nil {
+			if m := pdfInfoPages.FindSubmatch(out); m != nil {
+				n, _ := strconv.Atoi(string(m[1]))
+				return n
+			}
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(io.LimitReader(f, maxPageScan))
+	return len(pdfPageObj.FindAllIndex(data, -1))
+}
+
+// pdfThumbnail renders a PDF's first page with pdftoppm (poppler-utils,
+// like pdftotext), or returns nil.
+func pdfThumbnail(ctx context.Context, path string) []byte {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, "pdftoppm", "-jpeg", "-f", "1", "-l", "1", "-scale-to", strconv.Itoa(thumbnailSize), path).Output()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+var (
+	ooxmlPages = regexp.MustCompile(`<(?:Pages|Slides)>(\d+)</`)
+	odfPages   = regexp.MustCompile(`meta:(?:page|object)-count="(\d+)"`)
+)
+
+// officePreview reads the page or slide count and the embedded preview
+// image of an Office Open XML or OpenDocument file.
+func officePreview(path string) (int, []byte) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, nil
+	}
+	defer r.Close()
+	pages := 0
+	var thumb []byte
+	for _, f := range r.File {
+		switch f.Name {
+		case "docProps/app.xml":
+			if m := ooxmlPages.FindSubmatch(readZipFile(f)); m != nil {
+				pages, _ = strconv.Atoi(string(m[1]))
+			}
+		case "meta.xml":
+			if m := odfPages.FindSubmatch(readZipFile(f)); m != nil {
+				pages, _ = strconv.Atoi(string(m[1]))
+			}
+		case "docProps/thumbnail.jpeg", "docProps/thumbnail.jpg", "docProps/thumbnail.png", "Thumbnails/thumbnail.png":
+			thumb = readZipFile(f)
+		}
+	}
+	return pages, thumb
+}
+
+func readZipFile(f *zip.File) []byte {
+	rc, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(io.LimitReader(rc, 4<<20))
+	return data
+}
+
+// attachmentCaption appends a line per attachment, and where they came
+// from, to the caption the model wrote.
+func attachmentCaption(content string, previews []attachmentPreview, source, link string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSpace(content))
+	if sb.Len() > 0 {
+		sb.WriteString("\n\n")
+	}
+	for i, p := range previews {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(p.String())
+	}
+	switch {
+	case source != "" && link != "":
+		fmt.Fprintf(&sb, "\nFrom %s: %s", source, link)
+	case source != "":
+		fmt.Fprintf(&sb, "\nFrom %s", source)
+	case link != "":
+		fmt.Fprintf(&sb, "\n%s", link)
+	}
+	return sb.String()
+}
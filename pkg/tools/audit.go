@@ -0,0 +1,371 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// MutatingTool is implemented by tools some of whose calls change things
+// outside the conversation: send messages, write files, create events.
+// Mutates reports whether a call with args does; the registry passes those
+// calls to its auditor. Tools that do not implement it are read-only.
+type MutatingTool interface {
+	Mutates(args map[string]interface{}) bool
+}
+
+// actionIn reports whether args["action"] is one of actions, for tools
+// whose mutating calls are picked by action.
+func actionIn(args map[string]interface{}, actions ...string) bool {
+	action, _ := args["action"].(string)
+	for _, a := range actions {
+		if action == a {
+			return true
+		}
+	}
+	return false
+}
+
+type auditRefsKey struct{}
+
+// auditRefs collects the objects a mutating call touched.
+type auditRefs struct {
+	mu   sync.Mutex
+	refs []string
+}
+
+// noteAuditRef records ref (an ID or path) as touched by the current call,
+// if it is audited.
+func noteAuditRef(ctx context.Context, refs ...string) {
+	a, _ := ctx.Value(auditRefsKey{}).(*auditRefs)
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ref := range refs {
+		if ref != "" {
+			a.refs = append(a.refs, ref)
+		}
+	}
+}
+
+// list returns the noted refs followed by ID and path arguments, without
+// repeats.
+func (a *auditRefs) list(args map[string]interface{}) []string {
+	a.mu.Lock()
+	refs := append([]string(nil), a.refs...)
+	a.mu.Unlock()
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		if key == "id" || key == "path" || strings.HasSuffix(key, "_id") || strings.HasSuffix(key, "_ids") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch v := args[key].(type) {
+		case string:
+			refs = append(refs, v)
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					refs = append(refs, s)
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	unique := refs[:0]
+	for _, ref := range refs {
+		if ref != "" && !seen[ref] {
+			seen[ref] = true
+			unique = append(unique, ref)
+		}
+	}
+	return unique
+}
+
+// Sizes kept of an audited call's arguments and result.
+const (
+	auditArgsLen   = 1000
+	auditResultLen = 300
+)
+
+// NewAuditEntry turns a finished mutating call into an audit entry.
+// Arguments are redacted like log lines.
+func NewAuditEntry(exec ToolExecution) store.AuditEntry {
+	action, _ := exec.Args["action"].(string)
+	args, _ := json.Marshal(exec.Args)
+	entry := store.AuditEntry{
+		At:      exec.Started,
+		Channel: exec.Channel,
+		ChatID:  exec.ChatID,
+		Sender:  exec.Sender,
+		Tool:    exec.Tool,
+		Action:  action,
+		Args:    utils.Truncate(logger.Redact(string(args)), auditArgsLen),
+		Refs:    exec.Refs,
+	}
+	if exec.Result != nil {
+		entry.Result = utils.Truncate(logger.Redact(exec.Result.ForLLM), auditResultLen)
+		entry.Failed = exec.Result.IsError
+	}
+	return entry
+}
+
+// ParseAuditSince reads how far back to look: "today", a number of days
+// ("7d"), a duration ("12h") or a date ("2026-03-01"). Empty means the
+// last 7 days.
+func ParseAuditSince(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "":
+		return now.AddDate(0, 0, -7), nil
+	case s == "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case s == "yesterday":
+		y, m, d := now.AddDate(0, 0, -1).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case strings.HasSuffix(s, "d"):
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && days > 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot read %q as a time: use today, 7d, 12h or a date like 2026-03-01", s)
+}
+
+// FormatAuditEntries renders entries one per line, in loc.
+func FormatAuditEntries(entries []store.AuditEntry, loc *time.Location) string {
+	if len(entries) == 0 {
+		return "No recorded actions."
+	}
+	var sb strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		name := e.Tool
+		if e.Action != "" {
+			name += " " + e.Action
+		}
+		fmt.Fprintf(&sb, "%s %s", e.At.In(loc).Format("2006-01-02 15:04"), name)
+		if e.Channel != "" {
+			fmt.Fprintf(&sb, " (from %s:%s", e.Channel, e.ChatID)
+			if e.Sender != "" {
+				fmt.Fprintf(&sb, ", asked by %s", e.Sender)
+			}
+			sb.WriteByte(')')
+		}
+		if e.Failed {
+			sb.WriteString(" FAILED")
+		}
+		if len(e.Refs) > 0 {
+			fmt.Fprintf(&sb, "\n  on: %s", strings.Join(e.Refs, ", "))
+		}
+		if e.Result != "" {
+			fmt.Fprintf(&sb, "\n  result: %s", e.Result)
+		}
+	}
+	return sb.String()
+}
+
+// recapKinds group audited calls for the day's recap, by tool and, where
+// it matters, action; the first match wins and the rest are "other".
+var recapKinds = []struct {
+	title string
+	match func(e store.AuditEntry) bool
+}{
+	{"✉️ Emails sent", func(e store.AuditEntry) bool {
+		return e.Tool == "gmail" && (e.Action == "send" || e.Action == "reply")
+	}},
+	{"💬 Messages sent", func(e store.AuditEntry) bool {
+		return e.Tool == "message" || e.Tool == "whatsapp_broadcast"
+	}},
+	{"⏰ Reminders set", func(e store.AuditEntry) bool {
+		return (e.Tool == "cron" || e.Tool == "critical_reminder") && e.Action == "add"
+	}},
+	{"📅 Events added", func(e store.AuditEntry) bool {
+		return (e.Tool == "calendar_import" || e.Tool == "extract_events") && e.Action == "confirm"
+	}},
+	{"📁 Files filed", func(e store.AuditEntry) bool {
+		switch e.Tool {
+		case "write_file", "edit_file", "append_file", "attachments", "invoice_inbox":
+			return true
+		case "gmail":
+			return e.Action == "save_to_drive"
+		}
+		return e.Action == "upload"
+	}},
+}
+
+// FormatAuditRecap summarizes entries by kind, oldest first with a line
+// per action, or returns "" when there are none.
+func FormatAuditRecap(entries []store.AuditEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	groups := make([][]store.AuditEntry, len(recapKinds)+1)
+	var failed []store.AuditEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Failed {
+			failed = append(failed, e)
+			continue
+		}
+		kind := len(recapKinds)
+		for k, rk := range recapKinds {
+			if rk.match(e) {
+				kind = k
+				break
+			}
+		}
+		groups[kind] = append(groups[kind], e)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d actions", len(entries))
+	section := func(title string, entries []store.AuditEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n\n%s (%d)", title, len(entries))
+		for _, e := range entries {
+			line, _, _ := strings.Cut(e.Result, "\n")
+			if line == "" {
+				line = e.Tool
+				if e.Action != "" {
+					line += " " + e.Action
+				}
+			}
+			fmt.Fprintf(&sb, "\n- %s", utils.Truncate(line, 100))
+		}
+	}
+	for k, rk := range recapKinds {
+		section(rk.title, groups[k])
+	}
+	section("🔧 Other", groups[len(recapKinds)])
+	section("⚠️ Failed", failed)
+	return sb.String()
+}
+
+// AuditTool answers questions about what picoclaw did on the user's
+// behalf from the audit log.
+type AuditTool struct {
+	log *store.Audit
+}
+
+func NewAuditTool(log *store.Audit) *AuditTool {
+	return &AuditTool{log: log}
+}
+
+func (t *AuditTool) Name() string {
+	return "audit"
+}
+
+func (t *AuditTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *AuditTool) Description() string {
+	return "Look up the log of actions taken on the user's behalf (messages sent, files written, events created, uploads, contact changes), to answer questions like \"what did you send on my behalf this week?\". Only actions the current user asked for are shown. action=recap summarizes today's actions by kind."
+}
+
+func (t *AuditTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "recap"},
+				"description": "list shows each action (default); recap summarizes them by kind",
+			},
+			"since": map[string]interface{}{
+				"type":        "string",
+				"description": "How far back to look: today, yesterday, 7d, 12h or a date like 2026-03-01 (default 7d, today for recap)",
+			},
+			"tool": map[string]interface{}{
+				"type":        "string",
+				"description": "Only actions by this tool, e.g. message, write_file, contacts",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Only actions whose details mention this text (a name, file or ID)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum entries (default 20)",
+			},
+		},
+	}
+}
+
+func (t *AuditTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	since, _ := args["since"].(string)
+	if action == "recap" {
+		return t.recap(ctx, since)
+	}
+	from, err := ParseAuditSince(since, time.Now())
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	filter := store.AuditFilter{Since: from, Sender: SenderFromContext(ctx), Limit: 20}
+	filter.Tool, _ = args["tool"].(string)
+	filter.Text, _ = args["query"].(string)
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		filter.Limit = min(int(l), 200)
+	}
+	entries, err := t.log.Query(ctx, filter)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the audit log: %v", err)).WithError(err)
+	}
+	return SilentResult(FormatAuditEntries(entries, time.Local))
+}
+
+// recap summarizes the actions since (default today) for the user asking
+// or, in a scheduled run, for the chat it runs in. A day without actions
+// gives an empty result, so a scheduled recap stays quiet.
+func (t *AuditTool) recap(ctx context.Context, since string) *ToolResult {
+	if since == "" {
+		since = "today"
+	}
+	from, err := ParseAuditSince(since, time.Now())
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	filter := store.AuditFilter{Since: from, Sender: SenderFromContext(ctx), Limit: 200}
+	if filter.Sender == "" {
+		filter.Channel, filter.ChatID = ChatFromContext(ctx)
+		if filter.Channel == "" || filter.ChatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+	}
+	entries, err := t.log.Query(ctx, filter)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the audit log: %v", err)).WithError(err)
+	}
+	recap := FormatAuditRecap(entries)
+	if recap == "" && filter.Sender != "" {
+		recap = "No recorded actions."
+	}
+	return SilentResult(recap)
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+// TestRegistry_AuditsOnlyMutatingCalls verifies the auditor sees mutating calls with sender and refs, and skips reads
+func TestRegistry_AuditsOnlyMutatingCalls(t *testing.T) {
+	dir := t.TempDir()
+	registry := NewToolRegistry()
+	registry.Register(NewWriteFileTool(dir, true))
+	registry.Register(NewReadFileTool(dir, true))
+	var audited []ToolExecution
+	registry.SetAuditor(func(e ToolExecution) { audited = append(audited, e) })
+
+	ctx := WithSender(context.Background(), "u1")
+	path := filepath.Join(dir, "a.txt")
+	registry.ExecuteWithContext(ctx, "write_file", map[string]interface{}{"path": path, "content": "x"}, "telegram", "42", nil)
+	registry.ExecuteWithContext(ctx, "read_file", map[string]interface{}{"path": path}, "telegram", "42", nil)
+
+	if len(audited) != 1 {
+		t.Fatalf("audited %d calls, want 1", len(audited))
+	}
+	e := NewAuditEntry(audited[0])
+	if e.Tool != "write_file" || e.Sender != "u1" || e.Channel != "telegram" || len(e.Refs) != 1 || e.Refs[0] != path || e.Failed {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+}
+
+// TestAuditTool_ShowsOnlyTheSendersActions verifies the tool filters by the asking user and time window
+func TestAuditTool_ShowsOnlyTheSendersActions(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	db := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	ctx := context.Background()
+	db.Audit.Append(ctx, store.AuditEntry{Sender: "u1", Tool: "message", Channel: "telegram", ChatID: "42", Result: "Message sent to telegram:99", Refs: []string{"telegram:99"}})
+	db.Audit.Append(ctx, store.AuditEntry{Sender: "u2", Tool: "write_file", Refs: []string{"/ws/b.txt"}})
+	db.Audit.Append(ctx, store.AuditEntry{At: time.Now().AddDate(0, 0, -10), Sender: "u1", Tool: "contacts", Action: "create"})
+
+	result := NewAuditTool(db.Audit).Execute(WithSender(ctx, "u1"), map[string]interface{}{"since": "7d"})
+	if result.IsError || !strings.Contains(result.ForLLM, "message (from telegram:42, asked by u1)") ||
+		strings.Contains(result.ForLLM, "b.txt") || strings.Contains(result.ForLLM, "contacts") {
+		t.Errorf("unexpected audit output:\n%s", result.ForLLM)
+	}
+}
+
+// TestParseAuditSince verifies the accepted ways to say how far back to look
+func TestParseAuditSince(t *testing.T) {
+	now := time.Date(2026, 3, 6, 15, 30, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"":           now.AddDate(0, 0, -7),
+		"today":      time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC),
+		"3d":         now.AddDate(0, 0, -3),
+		"12h":        now.Add(-12 * time.Hour),
+		"2026-03-01": time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for in, want := range cases {
+		if got, err := ParseAuditSince(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("ParseAuditSince(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseAuditSince("last tuesday", now); err == nil {
+		t.Error("expected an error for an unreadable time")
+	}
+}
+
+// TestAuditTool_DailyRecap verifies the daily_recap automation runs every evening and sends the chat's actions of the day grouped by kind, and nothing on a quiet day
+func TestAuditTool_DailyRecap(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	db := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	ctx := context.Background()
+	for _, e := range []store.AuditEntry{
+		{Tool: "gmail", Action: "reply", Result: "Reply sent to ana@example.com"},
+		{Tool: "cron", Action: "add", Result: "Reminder set for 18:00: call the dentist"},
+		{Tool: "attachments", Action: "file", Result: "Filed invoice.pdf to Drive/Invoices"},
+		{Tool: "contacts", Action: "create"},
+		{Tool: "message", Result: "could not reach the bridge", Failed: true},
+		{At: time.Now().AddDate(0, 0, -2), Tool: "write_file", Result: "wrote old.txt"},
+	} {
+		e.Channel, e.ChatID = "telegram", "42"
+		db.Audit.Append(ctx, e)
+	}
+	db.Audit.Append(ctx, store.AuditEntry{Channel: "telegram", ChatID: "7", Tool: "gmail", Action: "send", Result: "Email sent to bob@example.com"})
+
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	registry := NewToolRegistry()
+	registry.Register(NewAuditTool(db.Audit))
+	automations := NewAutomationsTool(registry, t.TempDir(), nil)
+	automations.SetScheduler(cs)
+	if r := automations.Execute(WithChat(ctx, "telegram", "42"), map[string]interface{}{"action": "enable", "name": "daily_recap"}); r.IsError {
+		t.Fatalf("enable daily_recap: %s", r.ForLLM)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Schedule.Expr != "0 21 * * *" {
+		t.Fatalf("Expected a recap every day at 21:00, got %+v", jobs)
+	}
+
+	out, err := automations.ExecuteJob(ctx, &jobs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"End-of-day recap\n\n5 actions",
+		"✉️ Emails sent (1)\n- Reply sent to ana@example.com",
+		"⏰ Reminders set (1)\n- Reminder set for 18:00: call the dentist",
+		"📁 Files filed (1)\n- Filed invoice.pdf to Drive/Invoices",
+		"🔧 Other (1)\n- contacts create",
+		"⚠️ Failed (1)\n- could not reach the bridge",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the recap:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "bob@example.com") || strings.Contains(out, "old.txt") {
+		t.Errorf("Expected only the chat's actions of today:\n%s", out)
+	}
+
+	quiet := jobs[0]
+	quiet.Payload.To = "99"
+	if out, err := automations.ExecuteJob(ctx, &quiet); err != nil || out != "" {
+		t.Errorf("Expected nothing sent on a quiet day, got %q, %v", out, err)
+	}
+}
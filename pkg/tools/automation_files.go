@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/automation"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// automationFileSource tags the cron jobs made from automation files.
+const automationFileSource = "automation_file"
+
+// SetDefinitions gives the tool the schedules and rules defined in
+// automation files, to run and list beside the gallery.
+func (t *AutomationsTool) SetDefinitions(defs *automation.Store) {
+	t.mu.Lock()
+	t.defs = defs
+	t.mu.Unlock()
+	t.SyncDefinitions()
+}
+
+// SyncDefinitions makes the scheduler's jobs match the schedules in the
+// automation files: jobs of removed or edited schedules are dropped and
+// new ones added, leaving unchanged ones, and their run history, alone.
+// File schedules are plain reminders or agent turns, run like the ones
+// created from chat.
+func (t *AutomationsTool) SyncDefinitions() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.scheduler == nil || t.defs == nil {
+		return
+	}
+	wanted := map[string]automation.Schedule{}
+	for _, s := range t.defs.Current().Schedules {
+		wanted[s.Digest()] = s
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Data["source"] != automationFileSource {
+			continue
+		}
+		if _, ok := wanted[job.Payload.Data["digest"]]; ok {
+			delete(wanted, job.Payload.Data["digest"])
+			continue
+		}
+		t.scheduler.RemoveJob(job.ID)
+	}
+	for digest, s := range wanted {
+		schedule := cron.CronSchedule{Kind: "cron", Expr: s.Cron, TZ: s.Timezone}
+		if s.Every != "" {
+			everyMS := s.Interval().Milliseconds()
+			schedule = cron.CronSchedule{Kind: "every", EveryMS: &everyMS}
+		}
+		message := s.Message
+		if message == "" {
+			message = s.Prompt
+		}
+		_, err := t.scheduler.AddJobWithPayload(s.Name, schedule, cron.CronPayload{
+			Message: message,
+			Deliver: s.Message != "",
+			Channel: s.Channel(),
+			To:      s.ChatID(),
+			Data:    map[string]string{"source": automationFileSource, "schedule": s.Name, "file": s.File, "digest": digest},
+		})
+		if err != nil {
+			logger.WarnCF("automation", "Could not schedule automation file entry",
+				map[string]interface{}{"schedule": s.Name, "file": s.File, "error": err.Error()})
+		}
+	}
+}
+
+// describeDefinitions lists the schedules, rules and event rules from
+// automation files that apply to chatKey. Callers hold t.mu.
+func (t *AutomationsTool) describeDefinitions(chatKey string) string {
+	if t.defs == nil {
+		return ""
+	}
+	var sb strings.Builder
+	set := t.defs.Current()
+	for _, s := range set.Schedules {
+		if s.Chat != chatKey {
+			continue
+		}
+		when := "cron " + s.Cron
+		if s.Every != "" {
+			when = "every " + s.Every
+		}
+		fmt.Fprintf(&sb, "\n- schedule %s (%s%s, from %s)", s.Name, when, tzSuffix(s.Timezone), s.File)
+	}
+	for _, r := range set.Rules {
+		applies := len(r.Chats) == 0
+		for _, c := range r.Chats {
+			applies = applies || c == chatKey
+		}
+		if applies {
+			fmt.Fprintf(&sb, "\n- rule %s (messages matching %q, from %s)", r.Name, r.Match, r.File)
+		}
+	}
+	for _, r := range set.Events {
+		if slices.Contains(r.Chats, chatKey) {
+			from := "events"
+			if r.Source != "" {
+				from = r.Source + " events"
+			}
+			fmt.Fprintf(&sb, "\n- event rule %s (%s matching %q, from %s)", r.Name, from, r.Match, r.File)
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	out := "\n\nFrom automation files in " + t.defs.Dir() + ":" + sb.String()
+	if err := t.defs.Err(); err != nil {
+		out += "\n(the latest edit was not loaded: " + err.Error() + ")"
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/automation"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// TestAutomationsTool_SyncsFileSchedules verifies file schedules become jobs, unchanged ones are kept on reload and edited or removed ones replaced, and file templates cannot be overwritten from chat
+func TestAutomationsTool_SyncsFileSchedules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "mine.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`
+schedules:
+  - {name: standup, chat: "telegram:42", cron: "45 8 * * 1-5", message: Standup soon}
+  - {name: review, chat: "telegram:42", every: 168h, prompt: Summarize my week}
+templates:
+  - {name: running late, text: "Running {eta} late"}
+`)
+	defs := automation.NewStore(dir)
+	if err := defs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	cs.AddJob("chat reminder", cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *"}, "water plants", true, "telegram", "42")
+	tool := NewAutomationsTool(NewToolRegistry(), t.TempDir(), nil)
+	tool.SetDefinitions(defs)
+	tool.SetScheduler(cs)
+	defs.OnChange(func(*automation.Set) { tool.SyncDefinitions() })
+
+	jobs := map[string]cron.CronJob{}
+	for _, job := range cs.ListJobs(true) {
+		jobs[job.Name] = job
+	}
+	if len(jobs) != 3 || !jobs["standup"].Payload.Deliver || jobs["review"].Payload.Deliver || *jobs["review"].Schedule.EveryMS != 168*3600*1000 || jobs["review"].Payload.To != "42" {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	write(`
+schedules:
+  - {name: standup, chat: "telegram:42", cron: "45 8 * * 1-5", message: Standup soon}
+  - {name: lunch, chat: "telegram:42", cron: "0 12 * * *", message: Lunch}
+`)
+	if err := defs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for _, job := range cs.ListJobs(true) {
+		names[job.Name] = job.ID
+	}
+	if len(names) != 3 || names["standup"] != jobs["standup"].ID || names["lunch"] == "" || names["chat reminder"] == "" {
+		t.Errorf("jobs after reload %v", names)
+	}
+
+	write("templates:\n  - {name: running late, text: \"Late by {eta}\"}\n")
+	defs.Reload()
+	templates := NewTemplateStore(t.TempDir())
+	templates.SetDefinitions(defs)
+	if tpl, ok := templates.Get("Running late template"); !ok || tpl.File != "mine.yaml" {
+		t.Errorf("file template not found: %+v", tpl)
+	}
+	if err := templates.Save("running late", "x", ""); err == nil {
+		t.Error("file template overwritten from chat")
+	}
+	if len(cs.ListJobs(true)) != 1 {
+		t.Errorf("removed schedules still have jobs: %+v", cs.ListJobs(true))
+	}
+}
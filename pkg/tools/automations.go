@@ -0,0 +1,472 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/automation"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const automationJobKind = "automation"
+
+// automationSettings are the few choices an automation takes when it is
+// enabled; anything left empty keeps the defaults of the tools it wires.
+type automationSettings struct {
+	Time        string `json:"time,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	From        string `json:"from,omitempty"`
+}
+
+// automationStep is one tool call made to enable or disable an
+// automation, with arguments built from the settings.
+type automationStep struct {
+	tool string
+	args func(s automationSettings, now time.Time) map[string]interface{}
+}
+
+// Automation is a prepackaged combination of existing tools, schedules
+// and rules, set up with sensible defaults in one go.
+type Automation struct {
+	Name    string
+	Title   string
+	Summary string
+	// Requires are the tools the automation wires; it is offered only
+	// when all of them are registered
+	Requires []string
+	enable   []automationStep
+	disable  []automationStep
+	// run, when set, is called by the automation's own job, at Time on
+	// weekdays, and its output sent to the chat under Title; an empty
+	// output sends nothing
+	run         *automationStep
+	defaultTime string
+	// daily runs the job every day instead of on weekdays
+	daily bool
+}
+
+func staticArgs(args map[string]interface{}) func(automationSettings, time.Time) map[string]interface{} {
+	return func(automationSettings, time.Time) map[string]interface{} { return args }
+}
+
+// automationGallery is every automation the tool offers, in display order.
+var automationGallery = []Automation{
+	{
+		Name:     "daily_briefing",
+		Title:    "Daily briefing",
+		Summary:  "a morning message with today's calendar, important email, weather, reminders and news",
+		Requires: []string{"briefing"},
+		enable: []automationStep{{tool: "briefing", args: func(s automationSettings, _ time.Time) map[string]interface{} {
+			args := map[string]interface{}{"action": "schedule"}
+			if s.Time != "" {
+				args["time"] = s.Time
+			}
+			return args
+		}}},
+		disable: []automationStep{{tool: "briefing", args: staticArgs(map[string]interface{}{"action": "remove"})}},
+	},
+	{
+		Name:     "invoice_filing",
+		Title:    "Invoice filing",
+		Summary:  "every 6 hours, invoices and receipts from email are saved to Drive and logged as expenses",
+		Requires: []string{"invoice_inbox"},
+		enable: []automationStep{{tool: "invoice_inbox", args: staticArgs(map[string]interface{}{
+			"action": "schedule", "every_hours": float64(6),
+		})}},
+		disable: []automationStep{{tool: "invoice_inbox", args: staticArgs(map[string]interface{}{"action": "unschedule"})}},
+	},
+	{
+		Name:     "bill_reminders",
+		Title:    "Bill reminders",
+		Summary:  "every 6 hours, bills in email are tracked with their due dates, with a reminder before each is due and the month's obligations at the start of every month",
+		Requires: []string{"bills"},
+		enable: []automationStep{{tool: "bills", args: staticArgs(map[string]interface{}{
+			"action": "schedule", "every_hours": float64(6),
+		})}},
+		disable: []automationStep{{tool: "bills", args: staticArgs(map[string]interface{}{"action": "unschedule"})}},
+	},
+	{
+		Name:     "travel_itinerary",
+		Title:    "Travel itineraries",
+		Summary:  "every 6 hours, new flight, train, hotel and car confirmations are added to a shareable Google Doc per trip, with the calendar and weather",
+		Requires: []string{"itinerary"},
+		enable: []automationStep{{tool: "itinerary", args: staticArgs(map[string]interface{}{
+			"action": "schedule", "every_hours": float64(6),
+		})}},
+		disable: []automationStep{{tool: "itinerary", args: staticArgs(map[string]interface{}{"action": "unschedule"})}},
+	},
+	{
+		Name:     "photo_backup",
+		Title:    "Photo backup",
+		Summary:  "Google Photos copied every night to the backup disk, from the start of this year unless told otherwise",
+		Requires: []string{"backup"},
+		enable: []automationStep{{tool: "backup", args: func(s automationSettings, now time.Time) map[string]interface{} {
+			args := map[string]interface{}{"action": "add", "name": "photo backup", "source": "photos"}
+			args["from"] = s.From
+			if s.From == "" {
+				args["from"] = fmt.Sprintf("%d-01-01", now.Year())
+			}
+			if s.Destination != "" {
+				args["destination"] = s.Destination
+			}
+			if s.Time != "" {
+				args["time"] = s.Time
+			}
+			return args
+		}}},
+		disable: []automationStep{{tool: "backup", args: staticArgs(map[string]interface{}{"action": "remove", "name": "photo backup"})}},
+	},
+	{
+		Name:        "inbox_zero",
+		Title:       "Inbox zero",
+		Summary:     "on weekday evenings, the day's unread email ranked, with what to reply to, read or archive",
+		Requires:    []string{"gmail"},
+		run:         &automationStep{tool: "gmail", args: staticArgs(map[string]interface{}{"action": "digest", "since": "24h"})},
+		defaultTime: "17:30",
+	},
+	{
+		Name:        "daily_recap",
+		Title:       "End-of-day recap",
+		Summary:     "every evening, what was done on your behalf that day: emails and messages sent, reminders set, events added and files filed",
+		Requires:    []string{"audit"},
+		run:         &automationStep{tool: "audit", args: staticArgs(map[string]interface{}{"action": "recap", "since": "today"})},
+		defaultTime: "21:00",
+		daily:       true,
+	},
+}
+
+func findAutomation(name string) *Automation {
+	key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+	for i := range automationGallery {
+		if automationGallery[i].Name == key {
+			return &automationGallery[i]
+		}
+	}
+	return nil
+}
+
+// enabledAutomation is an automation a chat turned on.
+type enabledAutomation struct {
+	Since    time.Time          `json:"since"`
+	Settings automationSettings `json:"settings"`
+}
+
+// AutomationsTool lists the automation gallery and enables or disables
+// automations per chat. It sets them up by calling the tools they wire
+// through the registry, so each user's roles and confirmations apply as
+// if they had asked for every step themselves.
+type AutomationsTool struct {
+	registry  *ToolRegistry
+	profiles  *profile.Store
+	scheduler *cron.CronService
+	defs      *automation.Store
+	path      string
+	mu        sync.Mutex
+	enabled   map[string]map[string]*enabledAutomation
+	now       func() time.Time
+}
+
+func NewAutomationsTool(registry *ToolRegistry, workspace string, profiles *profile.Store) *AutomationsTool {
+	t := &AutomationsTool{
+		registry: registry,
+		profiles: profiles,
+		path:     filepath.Join(workspace, "state", "automations.json"),
+		enabled:  make(map[string]map[string]*enabledAutomation),
+		now:      time.Now,
+	}
+	if data, err := os.ReadFile(t.path); err == nil {
+		json.Unmarshal(data, &t.enabled)
+	}
+	return t
+}
+
+func (t *AutomationsTool) Name() string {
+	return "automations"
+}
+
+func (t *AutomationsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "enable", "disable")
+}
+
+func (t *AutomationsTool) Description() string {
+	return "Ready-made automations the user can turn on in one step: daily_briefing, invoice_filing, bill_reminders, photo_backup, inbox_zero and daily_recap. list shows them, what each does and which are on in this chat; enable sets one up with sensible defaults (time, destination and from adjust it); disable undoes it. Use it for requests like \"set up a photo backup\" or \"what automations are there?\"."
+}
+
+func (t *AutomationsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "enable", "disable"},
+				"description": "Action to perform",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Automation name (enable, disable), e.g. \"photo_backup\"",
+			},
+			"time": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: time of day HH:MM in the user's timezone, for automations that run daily",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: photo_backup directory, inside an allowed backup destination",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: photo_backup first day YYYY-MM-DD (default: January 1st this year)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *AutomationsTool) JobKinds() []string {
+	return []string{automationJobKind}
+}
+
+func (t *AutomationsTool) SetScheduler(cs *cron.CronService) {
+	t.mu.Lock()
+	t.scheduler = cs
+	t.mu.Unlock()
+	t.SyncDefinitions()
+}
+
+// missing returns the tools a needs that are not registered.
+func (t *AutomationsTool) missing(a *Automation) []string {
+	var missing []string
+	for _, name := range a.Requires {
+		if _, ok := t.registry.Get(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func (t *AutomationsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	if action == "list" {
+		return SilentResult(t.list(chatKey))
+	}
+	if action != "enable" && action != "disable" {
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+
+	name, _ := args["name"].(string)
+	a := findAutomation(name)
+	if a == nil {
+		return ErrorResult(fmt.Sprintf("no automation named %q; use action=list to see them", name))
+	}
+	if missing := t.missing(a); len(missing) > 0 {
+		return ErrorResult(fmt.Sprintf("%s needs the %s tool, which is not enabled here", a.Title, strings.Join(missing, ", ")))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := t.enabled[chatKey][a.Name]
+
+	if action == "disable" {
+		if current == nil {
+			return SilentResult(fmt.Sprintf("%s is not on in this chat", a.Title))
+		}
+		errs := t.teardown(ctx, a, channel, chatID)
+		delete(t.enabled[chatKey], a.Name)
+		if err := saveJSONAtomic(t.path, t.enabled); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if len(errs) > 0 {
+			return SilentResult(fmt.Sprintf("%s turned off, with problems: %s", a.Title, strings.Join(errs, "; ")))
+		}
+		return SilentResult(fmt.Sprintf("%s turned off", a.Title))
+	}
+
+	settings := automationSettings{}
+	if current != nil {
+		settings = current.Settings
+	}
+	for key, field := range map[string]*string{"time": &settings.Time, "destination": &settings.Destination, "from": &settings.From} {
+		if v, ok := args[key].(string); ok && strings.TrimSpace(v) != "" {
+			*field = strings.TrimSpace(v)
+		}
+	}
+	if settings.Time != "" {
+		if _, err := time.Parse("15:04", settings.Time); err != nil {
+			return ErrorResult(fmt.Sprintf("invalid time %q (expected HH:MM)", settings.Time))
+		}
+	}
+	if a.run != nil && t.scheduler == nil {
+		return ErrorResult("automations are not available (scheduler not running)")
+	}
+
+	// Enabling again applies new settings: take the old setup down first
+	if current != nil {
+		t.teardown(ctx, a, channel, chatID)
+	}
+	now := t.now()
+	var done []string
+	for i, step := range a.enable {
+		result := t.registry.ExecuteWithContext(ctx, step.tool, step.args(settings, now), channel, chatID, nil)
+		if result.IsError {
+			// Undo the steps that worked, so a half set up automation is not left behind
+			for _, undo := range a.disable[:min(i, len(a.disable))] {
+				t.registry.ExecuteWithContext(ctx, undo.tool, undo.args(settings, now), channel, chatID, nil)
+			}
+			delete(t.enabled[chatKey], a.Name)
+			saveJSONAtomic(t.path, t.enabled)
+			return ErrorResult(fmt.Sprintf("could not turn on %s: %s", a.Title, result.ForLLM)).WithError(result.Err)
+		}
+		done = append(done, result.ForLLM)
+	}
+	if a.run != nil {
+		job, err := t.schedule(a, settings, channel, chatID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("could not turn on %s: %v", a.Title, err)).WithError(err)
+		}
+		days := "on weekdays"
+		if a.daily {
+			days = "every day"
+		}
+		done = append(done, fmt.Sprintf("Runs %s at %s%s (id: %s)", days, job.Payload.Data["time"], tzSuffix(job.Schedule.TZ), job.ID))
+	}
+
+	if t.enabled[chatKey] == nil {
+		t.enabled[chatKey] = make(map[string]*enabledAutomation)
+	}
+	t.enabled[chatKey][a.Name] = &enabledAutomation{Since: now, Settings: settings}
+	if err := saveJSONAtomic(t.path, t.enabled); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return SilentResult(fmt.Sprintf("%s is on: %s.\n%s", a.Title, a.Summary, strings.Join(done, "\n")))
+}
+
+// teardown runs an automation's disable steps and removes its jobs for
+// the chat, returning what failed.
+func (t *AutomationsTool) teardown(ctx context.Context, a *Automation, channel, chatID string) []string {
+	var errs []string
+	for _, step := range a.disable {
+		if result := t.registry.ExecuteWithContext(ctx, step.tool, step.args(automationSettings{}, t.now()), channel, chatID, nil); result.IsError {
+			errs = append(errs, result.ForLLM)
+		}
+	}
+	if t.scheduler != nil {
+		for _, job := range t.scheduler.ListJobs(true) {
+			if job.Payload.Kind == automationJobKind && job.Payload.Channel == channel && job.Payload.To == chatID &&
+				job.Payload.Data["automation"] == a.Name {
+				t.scheduler.RemoveJob(job.ID)
+			}
+		}
+	}
+	return errs
+}
+
+// schedule adds the job that runs an automation on weekdays, or every
+// day.
+func (t *AutomationsTool) schedule(a *Automation, settings automationSettings, channel, chatID string) (*cron.CronJob, error) {
+	at := settings.Time
+	if at == "" {
+		at = a.defaultTime
+	}
+	clock, _ := time.Parse("15:04", at)
+	var tz string
+	if t.profiles != nil {
+		tz = t.profiles.Get(channel + ":" + chatID).Timezone
+	}
+	days := "1-5"
+	if a.daily {
+		days = "*"
+	}
+	expr := fmt.Sprintf("%d %d * * %s", clock.Minute(), clock.Hour(), days)
+	return t.scheduler.AddJobWithPayload(a.Title, cron.CronSchedule{Kind: "cron", Expr: expr, TZ: tz}, cron.CronPayload{
+		Kind:    automationJobKind,
+		Message: a.Title,
+		Channel: channel,
+		To:      chatID,
+		Data:    map[string]string{"automation": a.Name, "time": at},
+	})
+}
+
+// list describes the gallery, marking the automations on in the chat and
+// the ones this installation cannot offer.
+func (t *AutomationsTool) list(chatKey string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sb strings.Builder
+	sb.WriteString("Automations:")
+	for i := range automationGallery {
+		a := &automationGallery[i]
+		fmt.Fprintf(&sb, "\n- %s (%s): %s", a.Name, a.Title, a.Summary)
+		if on := t.enabled[chatKey][a.Name]; on != nil {
+			fmt.Fprintf(&sb, " [on since %s%s]", on.Since.Format("2006-01-02"), describeSettings(on.Settings))
+		} else if missing := t.missing(a); len(missing) > 0 {
+			fmt.Fprintf(&sb, " [unavailable: needs %s]", strings.Join(missing, ", "))
+		}
+	}
+	sb.WriteString(t.describeDefinitions(chatKey))
+	return sb.String()
+}
+
+func describeSettings(s automationSettings) string {
+	var parts []string
+	for _, kv := range [][2]string{{"time", s.Time}, {"destination", s.Destination}, {"from", s.From}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+" "+kv[1])
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "; " + strings.Join(parts, ", ")
+}
+
+// ExecuteJob implements ScheduledTool. It runs the automation's step in
+// the chat it was enabled for and sends the output under its title.
+func (t *AutomationsTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	a := findAutomation(job.Payload.Data["automation"])
+	if a == nil || a.run == nil {
+		return "", fmt.Errorf("unknown automation %q", job.Payload.Data["automation"])
+	}
+	result := t.registry.ExecuteWithContext(ctx, a.run.tool, a.run.args(automationSettings{}, t.now()), job.Payload.Channel, job.Payload.To, nil)
+	if result.IsError {
+		return "", fmt.Errorf("%s: %s", a.Title, result.ForLLM)
+	}
+	if result.ForLLM == "" {
+		return "", nil
+	}
+	return a.Title + "\n\n" + result.ForLLM, nil
+}
+
+// ChatData implements ChatDataStore: the automations on in the chat.
+func (t *AutomationsTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.enabled[chatKey]) == 0 {
+		return nil, nil
+	}
+	return snapshot(t.enabled[chatKey])
+}
+
+// PurgeChat implements ChatDataStore. What an automation set up is kept
+// by the tools it wired, which purge their own.
+func (t *AutomationsTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.enabled[chatKey])
+	if n == 0 {
+		return 0, nil
+	}
+	delete(t.enabled, chatKey)
+	return n, saveJSONAtomic(t.path, t.enabled)
+}
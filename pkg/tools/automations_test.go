@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestAutomationsTool_EnableRunAndDisable verifies automations are set up through the tools they wire with defaults, run on their own schedule and are taken down again
+func TestAutomationsTool_EnableRunAndDisable(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddEmail(testkit.Email{From: "ana@example.com", Subject: "Lunch on Friday?", Body: "Are you free?", Labels: []string{"INBOX", "UNREAD"}, Date: time.Now().Add(-time.Hour)})
+
+	dest := t.TempDir()
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	registry := NewToolRegistry()
+	backup := NewBackupTool(testkit.Token, []string{dest}, t.TempDir(), nil, bus.NewMessageBus())
+	backup.SetScheduler(cs)
+	registry.Register(backup)
+	registry.Register(NewGmailTool(testkit.Token))
+
+	workspace := t.TempDir()
+	tool := NewAutomationsTool(registry, workspace, nil)
+	tool.SetScheduler(cs)
+	tool.now = func() time.Time { return time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC) }
+	registry.Register(tool)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "enable", "name": "photo backup"})
+	if r.IsError {
+		t.Fatalf("enable photo_backup: %s", r.ForLLM)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Payload.Data["from"] != "2026-01-01" || jobs[0].Payload.Data["destination"] != dest {
+		t.Fatalf("unexpected backup jobs: %+v", jobs)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "enable", "name": "inbox_zero", "time": "18:00"}); r.IsError {
+		t.Fatalf("enable inbox_zero: %s", r.ForLLM)
+	}
+	var inboxJob *cron.CronJob
+	for _, job := range cs.ListJobs(true) {
+		if job.Payload.Kind == automationJobKind {
+			job := job
+			inboxJob = &job
+		}
+	}
+	if inboxJob == nil || inboxJob.Schedule.Expr != "0 18 * * 1-5" {
+		t.Fatalf("inbox zero not scheduled: %+v", inboxJob)
+	}
+	out, err := tool.ExecuteJob(context.Background(), inboxJob)
+	if err != nil || !strings.HasPrefix(out, "Inbox zero\n\n") || !strings.Contains(out, "Lunch on Friday?") {
+		t.Fatalf("ExecuteJob = %q, %v", out, err)
+	}
+
+	list := NewAutomationsTool(registry, workspace, nil).Execute(ctx, map[string]interface{}{"action": "list"}).ForLLM
+	for _, want := range []string{"photo_backup (Photo backup)", "[on since 2026-10-16]", "[on since 2026-10-16; time 18:00]", "daily_briefing (Daily briefing)", "[unavailable: needs briefing]"} {
+		if !strings.Contains(list, want) {
+			t.Errorf("list lacks %q:\n%s", want, list)
+		}
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "enable", "name": "daily_briefing"}); !r.IsError {
+		t.Error("automation without its tool enabled")
+	}
+
+	for _, name := range []string{"photo_backup", "inbox_zero"} {
+		if r := tool.Execute(ctx, map[string]interface{}{"action": "disable", "name": name}); r.IsError || strings.Contains(r.ForLLM, "problems") {
+			t.Fatalf("disable %s: %s", name, r.ForLLM)
+		}
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 0 {
+		t.Errorf("jobs left after disabling: %+v", jobs)
+	}
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tasks"
+)
+
+// BackgroundTool is implemented by tools whose long operations run as
+// tasks. SetTasks is called with the agent's task manager, again whenever
+// the tools are rebuilt, and registers the tool's runners with it.
+type BackgroundTool interface {
+	SetTasks(m *tasks.Manager)
+}
+
+// BackgroundTasksTool lets a chat follow the long operations running for
+// it, such as backups and photo index scans, and pause, resume or cancel
+// them.
+type BackgroundTasksTool struct {
+	tasks *tasks.Manager
+}
+
+func NewBackgroundTasksTool(m *tasks.Manager) *BackgroundTasksTool {
+	return &BackgroundTasksTool{tasks: m}
+}
+
+func (t *BackgroundTasksTool) Name() string {
+	return "background_tasks"
+}
+
+func (t *BackgroundTasksTool) Description() string {
+	return "Follow the long operations running in the background for this chat (backups, photo index scans): list them, tell how one is going (\"how's the photo backup going?\"), or pause, resume and cancel one. Paused and interrupted tasks pick up where they left off."
+}
+
+func (t *BackgroundTasksTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "pause", "resume", "cancel")
+}
+
+func (t *BackgroundTasksTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "status", "pause", "resume", "cancel"},
+				"description": "Action to perform",
+			},
+			"task": map[string]interface{}{
+				"type":        "string",
+				"description": "Task ID, or part of its name such as \"photo\" (status, pause, resume, cancel)",
+			},
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Also list tasks finished in the last week (list)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *BackgroundTasksTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	action, _ := args["action"].(string)
+
+	if action == "list" {
+		all, _ := args["all"].(bool)
+		list := t.tasks.List(channel, chatID, all)
+		if len(list) == 0 {
+			if all {
+				return SilentResult("No background tasks this week")
+			}
+			return SilentResult("Nothing is running in the background")
+		}
+		var sb strings.Builder
+		sb.WriteString("Background tasks:\n")
+		for _, task := range list {
+			sb.WriteString("- " + tasks.Describe(task) + "\n")
+		}
+		return SilentResult(strings.TrimSuffix(sb.String(), "\n"))
+	}
+
+	query, _ := args["task"].(string)
+	task, ok := t.tasks.Find(channel, chatID, query)
+	if !ok {
+		if strings.TrimSpace(query) == "" {
+			return ErrorResult("task is required")
+		}
+		return ErrorResult(fmt.Sprintf("no background task matching %q; use action=list to see them", query))
+	}
+
+	var err error
+	switch action {
+	case "status":
+		return SilentResult(tasks.Describe(task))
+	case "pause":
+		task, err = t.tasks.Pause(task.ID)
+	case "resume":
+		task, err = t.tasks.Resume(task.ID)
+	case "cancel":
+		task, err = t.tasks.Cancel(task.ID)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("cannot %s %s: %v", action, task.Name, err))
+	}
+	return SilentResult(tasks.Describe(task))
+}
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/tasks"
+)
+
+// TestBackgroundTasksTool_StatusPauseCancel verifies a chat's task is found by part of its name, reports its progress and can be paused, resumed and canceled
+func TestBackgroundTasksTool_StatusPauseCancel(t *testing.T) {
+	m := tasks.NewManager(filepath.Join(t.TempDir(), "tasks.json"))
+	defer m.Stop()
+	m.Handle("copy", func(ctx context.Context, run *tasks.Run) (string, error) {
+		run.Progress(120, 480, "2026/10/IMG_0042.jpg")
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	if _, err := m.Start("copy", "photos backup", "telegram", "1", nil); err != nil {
+		t.Fatal(err)
+	}
+	tool := NewBackgroundTasksTool(m)
+	ctx := WithChat(context.Background(), "telegram", "1")
+
+	var r *ToolResult
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if r = tool.Execute(ctx, map[string]interface{}{"action": "status", "task": "photo"}); strings.Contains(r.ForLLM, "120 of 480") {
+			break
+		}
+	}
+	if r.IsError || !strings.Contains(r.ForLLM, "photos backup") || !strings.Contains(r.ForLLM, "120 of 480 (25%), 2026/10/IMG_0042.jpg") {
+		t.Fatalf("unexpected status: %s", r.ForLLM)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "pause", "task": "photos backup"}); r.IsError || !strings.Contains(r.ForLLM, "paused") {
+		t.Fatalf("unexpected pause: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "pause", "task": "photo"}); !r.IsError {
+		t.Errorf("paused task paused again: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(r.ForLLM, "photos backup") {
+		t.Errorf("paused task not listed: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "cancel", "task": "photo"}); r.IsError || !strings.Contains(r.ForLLM, "canceled") {
+		t.Fatalf("unexpected cancel: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "list"}); r.ForLLM != "Nothing is running in the background" {
+		t.Errorf("unexpected list: %s", r.ForLLM)
+	}
+	if r := tool.Execute(WithChat(context.Background(), "telegram", "2"), map[string]interface{}{"action": "status", "task": "photo"}); !r.IsError {
+		t.Errorf("task found from another chat: %s", r.ForLLM)
+	}
+}
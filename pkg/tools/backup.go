@@ -0,0 +1,792 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/backup"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/tasks"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+	"github.com/sipeed/picoclaw/pkg/webhooks"
+)
+
+const backupJobKind = "backup_run"
+
+// backupRunTimeout bounds a single run; the next run picks up where it stopped.
+const backupRunTimeout = 6 * time.Hour
+
+// driveExportFormats maps Google editor files to the Office format and file
+// extension they are backed up as.
+var driveExportFormats = map[string][2]string{
+	"application/vnd.google-apps.document":     {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"},
+	"application/vnd.google-apps.spreadsheet":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+	"application/vnd.google-apps.presentation": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"},
+	"application/vnd.google-apps.drawing":      {"application/pdf", ".pdf"},
+}
+
+// DriveBackupSource lists a Drive folder recursively. Binary files are
+// downloaded as-is (resumable with Range requests); Docs, Sheets and Slides
+// are exported to Office formats.
+type DriveBackupSource struct {
+	token    TokenFunc
+	folderID string
+	baseURL  string
+	client   *http.Client
+}
+
+func NewDriveBackupSource(token TokenFunc, folderID string) *DriveBackupSource {
+	return &DriveBackupSource{
+		token:    token,
+		folderID: folderID,
+		baseURL:  "https://www.googleapis.com/drive/v3",
+		client:   newGoogleHTTPClient(30 * time.Second),
+	}
+}
+
+func (s *DriveBackupSource) do(ctx context.Context, path string, out interface{}) error {
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, s.client, http.MethodGet, s.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, nil, out)
+}
+
+type driveFile struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+	Size         string `json:"size"`
+	MD5          string `json:"md5Checksum"`
+	ModifiedTime string `json:"modifiedTime"`
+}
+
+func (s *DriveBackupSource) children(ctx context.Context, folderID string) ([]driveFile, error) {
+	var files []driveFile
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("q", fmt.Sprintf("'%s' in parents and trashed = false", strings.ReplaceAll(folderID, "'", "\\'")))
+		q.Set("fields", "nextPageToken, files(id, name, mimeType, size, md5Checksum, modifiedTime)")
+		q.Set("pageSize", "1000")
+		q.Set("supportsAllDrives", "true")
+		q.Set("includeItemsFromAllDrives", "true")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		var resp struct {
+			Files         []driveFile `json:"files"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		if err := s.do(ctx, "/files?"+q.Encode(), &resp); err != nil {
+			return nil, err
+		}
+		files = append(files, resp.Files...)
+		if resp.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+func (s *DriveBackupSource) List(ctx context.Context) ([]backup.Entry, error) {
+	var root driveFile
+	if err := s.do(ctx, "/files/"+url.PathEscape(s.folderID)+"?fields=id,name,mimeType&supportsAllDrives=true", &root); err != nil {
+		return nil, err
+	}
+	if root.MimeType != "application/vnd.google-apps.folder" {
+		return nil, fmt.Errorf("%s is not a folder", root.Name)
+	}
+
+	var entries []backup.Entry
+	used := make(map[string]bool)
+	type folder struct{ id, path string }
+	queue := []folder{{root.ID, backup.SafeName(root.Name)}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		files, err := s.children(ctx, current.id)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := backup.SafeName(f.Name)
+			if f.MimeType == "application/vnd.google-apps.folder" {
+				queue = append(queue, folder{f.ID, current.path + "/" + name})
+				continue
+			}
+
+			entry := backup.Entry{ID: f.ID, Size: -1, Version: f.ModifiedTime}
+			if export, ok := driveExportFormats[f.MimeType]; ok {
+				if !strings.HasSuffix(strings.ToLower(name), export[1]) {
+					name += export[1]
+				}
+			} else if strings.HasPrefix(f.MimeType, "application/vnd.google-apps.") {
+				// Forms, sites and shortcuts have no downloadable content
+				continue
+			} else {
+				fmt.Sscanf(f.Size, "%d", &entry.Size)
+				entry.Resumable = true
+				if f.MD5 != "" {
+					entry.Version = f.MD5
+					entry.MD5 = f.MD5
+				}
+			}
+
+			// Drive allows duplicate names in a folder; keep both copies
+			p := current.path + "/" + name
+			if used[p] {
+				ext := path.Ext(name)
+				p = current.path + "/" + strings.TrimSuffix(name, ext) + " (" + f.ID[:min(6, len(f.ID))] + ")" + ext
+			}
+			used[p] = true
+			entry.Path = p
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *DriveBackupSource) Open(ctx context.Context, entry backup.Entry, offset int64) (io.ReadCloser, error) {
+	token, err := s.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reqURL := s.baseURL + "/files/" + url.PathEscape(entry.ID) + "?alt=media&supportsAllDrives=true"
+	if !entry.Resumable {
+		for _, export := range driveExportFormats {
+			if strings.HasSuffix(entry.Path, export[1]) {
+				reqURL = s.baseURL + "/files/" + url.PathEscape(entry.ID) + "/export?mimeType=" + url.QueryEscape(export[0])
+				break
+			}
+		}
+	}
+	return transfer.Open(ctx, transfer.Download{
+		Name:   entry.Path,
+		Size:   entry.Size,
+		MD5:    entry.MD5,
+		Offset: offset,
+		Open:   openDownload(reqURL, token),
+	})
+}
+
+// PhotosBackupSource lists photos and videos taken in a date range, or
+// in an album, stored as YYYY/MM/filename. An empty to date means "up to
+// today", so a scheduled job keeps picking up new photos. Each entry
+// records what the Photos API leaves out of the original.
+type PhotosBackupSource struct {
+	photos  *GooglePhotosClient
+	albumID string
+	from    time.Time
+	to      time.Time
+	now     func() time.Time
+}
+
+func NewPhotosBackupSource(photos *GooglePhotosClient, from, to time.Time) *PhotosBackupSource {
+	return &PhotosBackupSource{photos: photos, from: from, to: to, now: time.Now}
+}
+
+// NewPhotosAlbumBackupSource lists an album's items taken between from
+// and to; zero dates leave that side open.
+func NewPhotosAlbumBackupSource(photos *GooglePhotosClient, albumID string, from, to time.Time) *PhotosBackupSource {
+	return &PhotosBackupSource{photos: photos, albumID: albumID, from: from, to: to, now: time.Now}
+}
+
+func (s *PhotosBackupSource) items(ctx context.Context) ([]PhotoItem, error) {
+	to := s.to
+	if to.IsZero() {
+		to = s.now()
+	}
+	if s.albumID == "" {
+		// Archived items are hidden from the library view, not discarded,
+		// so they belong in a backup
+		return s.photos.SearchMedia(ctx, s.from, to, []string{"ALL_MEDIA"}, true, 0)
+	}
+	// The API takes no date filter with an album
+	all, err := s.photos.SearchAlbum(ctx, s.albumID, 0)
+	if err != nil {
+		return nil, err
+	}
+	end := to.AddDate(0, 0, 1)
+	items := all[:0]
+	for _, item := range all {
+		if item.Created.Before(s.from) || !item.Created.Before(end) {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s *PhotosBackupSource) List(ctx context.Context) ([]backup.Entry, error) {
+	items, err := s.items(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]backup.Entry, 0, len(items))
+	used := make(map[string]bool)
+	for _, item := range items {
+		p := backup.JoinSafe(item.Created.Format("2006"), item.Created.Format("01"), item.Filename)
+		if used[p] {
+			ext := path.Ext(p)
+			p = strings.TrimSuffix(p, ext) + "_" + item.ID[len(item.ID)-min(6, len(item.ID)):] + ext
+		}
+		used[p] = true
+		// Library items never change, so the ID is the version
+		entries = append(entries, backup.Entry{ID: item.ID, Path: p, Size: -1, Version: item.ID, Fidelity: photosFidelity(item.MimeType)})
+	}
+	return entries, nil
+}
+
+func (s *PhotosBackupSource) Open(ctx context.Context, entry backup.Entry, offset int64) (io.ReadCloser, error) {
+	return s.photos.Download(ctx, entry.ID)
+}
+
+// BackupTool manages scheduled backups of Drive folders and Photos albums
+// or date ranges to a local disk, mounted share or Drive folder, and
+// reports on them in chat.
+type BackupTool struct {
+	engine       *backup.Engine
+	token        TokenFunc
+	photos       *GooglePhotosClient
+	drive        *GoogleDriveClient
+	destinations []string
+	workspace    string
+	profiles     *profile.Store
+	bus          *bus.MessageBus
+	scheduler    *cron.CronService
+	tasks        *tasks.Manager
+	mu           sync.Mutex
+	channel      string
+	chatID       string
+	driveURL     string
+	// runCtx is the parent of background runs; tests replace it
+	runCtx context.Context
+	wg     sync.WaitGroup
+}
+
+// NewBackupTool creates the tool. destinations are the directories (local
+// disks, mount points of SMB/NFS shares) backups may be written under;
+// backups into Drive keep their manifests in workspace.
+func NewBackupTool(token TokenFunc, destinations []string, workspace string, profiles *profile.Store, msgBus *bus.MessageBus) *BackupTool {
+	return &BackupTool{
+		engine:       backup.NewEngine(),
+		token:        token,
+		photos:       NewGooglePhotosClient(token),
+		drive:        NewGoogleDriveClient(token),
+		destinations: destinations,
+		workspace:    workspace,
+		profiles:     profiles,
+		bus:          msgBus,
+		driveURL:     "https://www.googleapis.com/drive/v3",
+		runCtx:       context.Background(),
+	}
+}
+
+func (t *BackupTool) Name() string {
+	return "backup"
+}
+
+func (t *BackupTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "run", "remove")
+}
+
+func (t *BackupTool) Description() string {
+	return "Back up Google Drive folders or Google Photos (albums or a date range) to a local disk, NAS share or Google Drive folder, incrementally and on a schedule, with a manifest recording how faithful each copy is. Add a backup job, run it now, check status, list or remove jobs. Allowed destinations: " +
+		strings.Join(append(append([]string(nil), t.destinations...), "drive", "drive:<folder ID>"), ", ")
+}
+
+func (t *BackupTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"add", "list", "run", "status", "remove"},
+				"description": "Action to perform",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Backup job name, e.g. \"work docs\"",
+			},
+			"source": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"drive", "photos"},
+				"description": "What to back up (add)",
+			},
+			"folder_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Drive folder ID (source=drive)",
+			},
+			"album": map[string]interface{}{
+				"type":        "string",
+				"description": "Photos album title or ID to back up instead of the whole library (source=photos)",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "First day YYYY-MM-DD (source=photos; optional with an album)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Last day YYYY-MM-DD (source=photos); omit to keep backing up new photos",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to back up into, inside an allowed destination; or \"drive\" for a \"picoclaw archive\" folder in My Drive, or \"drive:<folder ID>\"",
+			},
+			"time": map[string]interface{}{
+				"type":        "string",
+				"description": "Run time HH:MM in the user's timezone (default 03:00)",
+			},
+			"every": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"day", "week", "month"},
+				"description": "How often to run (default day); weekly runs on Sundays, monthly on the 1st",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *BackupTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *BackupTool) JobKinds() []string {
+	return []string{backupJobKind}
+}
+
+func (t *BackupTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+// SetTasks implements BackgroundTool: runs become tasks the chat can
+// follow, pause and cancel, and that survive a restart.
+func (t *BackupTool) SetTasks(m *tasks.Manager) {
+	t.tasks = m
+	m.Handle(backupJobKind, t.runTask)
+}
+
+// allowedDestination resolves dest and checks it is under a configured
+// root. Drive folders are always allowed: they are the user's own.
+func (t *BackupTool) allowedDestination(dest string) (string, error) {
+	dest = strings.TrimSpace(dest)
+	if isDriveDestination(dest) {
+		return dest, nil
+	}
+	if len(t.destinations) == 0 {
+		return "", fmt.Errorf("no backup destinations are configured (tools.backup.destinations)")
+	}
+	if dest == "" {
+		return filepath.Clean(t.destinations[0]), nil
+	}
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range t.destinations {
+		rootAbs, err := filepath.Abs(root)
+		if err == nil && isWithinWorkspace(abs, rootAbs) {
+			return abs, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not inside an allowed destination (%s)", dest, strings.Join(t.destinations, ", "))
+}
+
+func (t *BackupTool) findJob(channel, chatID, name string) *cron.CronJob {
+	for _, job := range t.jobs(channel, chatID) {
+		if strings.EqualFold(job.Payload.Data["name"], name) {
+			return &job
+		}
+	}
+	return nil
+}
+
+func (t *BackupTool) jobs(channel, chatID string) []cron.CronJob {
+	if t.scheduler == nil {
+		return nil
+	}
+	var jobs []cron.CronJob
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == backupJobKind && job.Payload.Channel == channel && job.Payload.To == chatID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// destination builds the backup destination described by job data.
+func (t *BackupTool) destination(data map[string]string) backup.Destination {
+	dest := data["destination"]
+	if isDriveDestination(dest) {
+		return NewDriveBackupDestination(t.drive, strings.TrimPrefix(strings.TrimPrefix(dest, "drive"), ":"), t.workspace)
+	}
+	return backup.Dir(dest)
+}
+
+// source builds the backup source described by job data.
+func (t *BackupTool) source(data map[string]string) (backup.Source, error) {
+	switch data["source"] {
+	case "drive":
+		src := NewDriveBackupSource(t.token, data["folder_id"])
+		src.baseURL = t.driveURL
+		return src, nil
+	case "photos":
+		var from, to time.Time
+		var err error
+		if data["from"] != "" || data["album_id"] == "" {
+			if from, err = time.Parse("2006-01-02", data["from"]); err != nil {
+				return nil, fmt.Errorf("invalid from date %q", data["from"])
+			}
+		}
+		if data["to"] != "" {
+			if to, err = time.Parse("2006-01-02", data["to"]); err != nil {
+				return nil, fmt.Errorf("invalid to date %q", data["to"])
+			}
+		}
+		if data["album_id"] != "" {
+			return NewPhotosAlbumBackupSource(t.photos, data["album_id"], from, to), nil
+		}
+		return NewPhotosBackupSource(t.photos, from, to), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", data["source"])
+	}
+}
+
+func describeBackup(data map[string]string) string {
+	what := "Drive folder " + data["folder_id"]
+	if data["source"] == "photos" {
+		to := data["to"]
+		if to == "" {
+			to = "ongoing"
+		}
+		what = fmt.Sprintf("Photos %s to %s", data["from"], to)
+		if data["album_id"] != "" {
+			what = fmt.Sprintf("Photos album %q", data["album"])
+			if data["from"] != "" || data["to"] != "" {
+				what += fmt.Sprintf(" (%s to %s)", data["from"], to)
+			}
+		}
+	}
+	dest := data["destination"]
+	if isDriveDestination(dest) {
+		dest = "Google Drive"
+		if id := strings.TrimPrefix(data["destination"], "drive:"); id != "drive" {
+			dest += " folder " + id
+		} else {
+			dest += " (" + driveArchiveFolder + ")"
+		}
+	}
+	every := data["every"]
+	if every == "" {
+		every = "day"
+	}
+	return fmt.Sprintf("%s: %s -> %s, every %s at %s", data["name"], what, dest, every, data["time"])
+}
+
+// backupSchedule is the cron expression for a run at clock every day,
+// week (Sundays) or month (the 1st).
+func backupSchedule(clock time.Time, every string) (string, error) {
+	switch every {
+	case "", "day":
+		return fmt.Sprintf("%d %d * * *", clock.Minute(), clock.Hour()), nil
+	case "week":
+		return fmt.Sprintf("%d %d * * 0", clock.Minute(), clock.Hour()), nil
+	case "month":
+		return fmt.Sprintf("%d %d 1 * *", clock.Minute(), clock.Hour()), nil
+	default:
+		return "", fmt.Errorf("invalid every %q (day, week or month)", every)
+	}
+}
+
+// findAlbum resolves an album title (case-insensitive) or ID.
+func (t *BackupTool) findAlbum(ctx context.Context, album string) (*PhotoAlbum, error) {
+	albums, err := t.photos.ListAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, a := range albums {
+		if a.ID == album || strings.EqualFold(a.Title, album) {
+			return &albums[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no Photos album named %q", album)
+}
+
+func (t *BackupTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	if t.scheduler == nil {
+		return ErrorResult("backups are not available (scheduler not running)")
+	}
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+
+	switch action {
+	case "add":
+		if name == "" {
+			return ErrorResult("name is required")
+		}
+		if t.findJob(t.channel, t.chatID, name) != nil {
+			return ErrorResult(fmt.Sprintf("a backup named %q already exists; remove it first", name))
+		}
+		dest, _ := args["destination"].(string)
+		dest, err := t.allowedDestination(dest)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		data := map[string]string{"name": name, "destination": dest, "time": "03:00"}
+		data["source"], _ = args["source"].(string)
+		data["folder_id"], _ = args["folder_id"].(string)
+		data["from"], _ = args["from"].(string)
+		data["to"], _ = args["to"].(string)
+		data["every"], _ = args["every"].(string)
+		if v, ok := args["time"].(string); ok && v != "" {
+			data["time"] = strings.TrimSpace(v)
+		}
+		if data["source"] == "drive" && data["folder_id"] == "" {
+			return ErrorResult("folder_id is required for Drive backups")
+		}
+		if album, _ := args["album"].(string); data["source"] == "photos" && strings.TrimSpace(album) != "" {
+			found, err := t.findAlbum(ctx, strings.TrimSpace(album))
+			if err != nil {
+				return ErrorResult(err.Error()).WithError(err)
+			}
+			data["album_id"], data["album"] = found.ID, found.Title
+		}
+		if _, err := t.source(data); err != nil {
+			return ErrorResult(err.Error())
+		}
+		clock, err := time.Parse("15:04", data["time"])
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid time %q (expected HH:MM)", data["time"]))
+		}
+
+		var tz string
+		if t.profiles != nil {
+			tz = t.profiles.Get(t.channel + ":" + t.chatID).Timezone
+		}
+		expr, err := backupSchedule(clock, data["every"])
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		job, err := t.scheduler.AddJobWithPayload("Backup: "+name, cron.CronSchedule{Kind: "cron", Expr: expr, TZ: tz},
+			cron.CronPayload{
+				Kind:    backupJobKind,
+				Message: "Backup: " + name,
+				Channel: t.channel,
+				To:      t.chatID,
+				Data:    data,
+			})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule backup: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Backup scheduled (id: %s)\n%s%s\nUse action=run to start the first copy now.",
+			job.ID, describeBackup(data), tzSuffix(tz)))
+
+	case "list":
+		jobs := t.jobs(t.channel, t.chatID)
+		if len(jobs) == 0 {
+			return SilentResult("No backups configured for this chat")
+		}
+		var sb strings.Builder
+		sb.WriteString("Backups:\n")
+		for _, job := range jobs {
+			fmt.Fprintf(&sb, "- %s\n  last run: %s\n", describeBackup(job.Payload.Data), t.lastRun(job.Payload.Data))
+		}
+		return SilentResult(strings.TrimSuffix(sb.String(), "\n"))
+
+	case "status":
+		job := t.findJob(t.channel, t.chatID, name)
+		if job == nil {
+			return ErrorResult(fmt.Sprintf("no backup named %q", name))
+		}
+		data := job.Payload.Data
+		manifest, _ := t.destination(data).LoadManifest(data["name"])
+		files := 0
+		if manifest != nil {
+			files = len(manifest.Files)
+		}
+		running := ""
+		if t.engine.IsRunning(backupKey(job)) {
+			running = "\nA run is in progress."
+		}
+		if t.tasks != nil {
+			if task, ok := t.tasks.Find(t.channel, t.chatID, backupTaskName(name)); ok && task.Active() {
+				running = "\nTask: " + tasks.Describe(task)
+			}
+		}
+		return SilentResult(fmt.Sprintf("%s\nFiles in backup: %d\nLast run: %s%s",
+			describeBackup(data), files, t.lastRun(data), running))
+
+	case "run":
+		job := t.findJob(t.channel, t.chatID, name)
+		if job == nil {
+			return ErrorResult(fmt.Sprintf("no backup named %q", name))
+		}
+		if t.engine.IsRunning(backupKey(job)) {
+			return SilentResult(fmt.Sprintf("Backup %s is already running", name))
+		}
+		if err := t.start(job, true); err == tasks.ErrRunning {
+			return SilentResult(fmt.Sprintf("Backup %s is already running or paused; resume it with the background_tasks tool", name))
+		} else if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to start backup: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Backup %s started in the background; I'll report here when it finishes.", name))
+
+	case "remove":
+		job := t.findJob(t.channel, t.chatID, name)
+		if job == nil {
+			return ErrorResult(fmt.Sprintf("no backup named %q", name))
+		}
+		t.scheduler.RemoveJob(job.ID)
+		return SilentResult(fmt.Sprintf("Backup %s removed. Files already copied to %s were kept.", name, job.Payload.Data["destination"]))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// backupKey names a job's manifest and running state. Manifests live in
+// the destination, so two chats sharing a destination share history by name.
+func backupKey(job *cron.CronJob) string {
+	return job.Payload.Data["name"]
+}
+
+func (t *BackupTool) lastRun(data map[string]string) string {
+	manifest, err := t.destination(data).LoadManifest(data["name"])
+	if err != nil {
+		return "unknown (" + err.Error() + ")"
+	}
+	return backup.FormatStats(manifest.LastRun)
+}
+
+// ExecuteJob implements ScheduledTool. Runs can take hours, so the copy
+// happens in the background and reports when done instead of blocking the
+// scheduler.
+func (t *BackupTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	if t.engine.IsRunning(backupKey(job)) {
+		return "", nil
+	}
+	if err := t.start(job, false); err != nil && err != tasks.ErrRunning {
+		return "", err
+	}
+	return "", nil
+}
+
+// start runs a backup in the background, as a task when a task manager
+// is set. Scheduled runs only report when something changed or failed, to
+// keep the chat quiet, and their uploads to Drive keep to the transfer
+// windows; runs asked for in a chat start at once.
+func (t *BackupTool) start(job *cron.CronJob, always bool) error {
+	data := job.Payload.Data
+	channel, chatID := job.Payload.Channel, job.Payload.To
+	if t.tasks != nil {
+		taskData := make(map[string]string, len(data)+1)
+		for k, v := range data {
+			taskData[k] = v
+		}
+		if always {
+			taskData["always"] = "true"
+		}
+		_, err := t.tasks.Start(backupJobKind, backupTaskName(data["name"]), channel, chatID, taskData)
+		return err
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		stats, err := t.runOnce(t.runCtx, data, channel, chatID, always)
+		var msg string
+		switch {
+		case err == backup.ErrAlreadyRunning, err != nil && t.runCtx.Err() != nil:
+			return
+		case err != nil:
+			msg = fmt.Sprintf("⚠️ Backup %s failed: %v", data["name"], err)
+		case always || stats.Copied > 0 || stats.Failed > 0:
+			msg = fmt.Sprintf("💾 Backup %s %s", data["name"], backup.FormatStats(stats))
+		}
+		if msg != "" && t.bus != nil {
+			t.bus.PublishOutbound(bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: msg})
+		}
+	}()
+	return nil
+}
+
+// backupTaskName is how a backup's runs are listed among the chat's tasks.
+func backupTaskName(name string) string {
+	return name + " backup"
+}
+
+// runTask runs a backup started through the task manager, reporting each
+// file as progress.
+func (t *BackupTool) runTask(ctx context.Context, run *tasks.Run) (string, error) {
+	data := run.Task.Data
+	always := data["always"] == "true"
+	ctx = backup.WithProgress(ctx, func(done, total int, path string) {
+		run.Progress(done, total, path)
+	})
+	stats, err := t.runOnce(ctx, data, run.Task.Channel, run.Task.ChatID, always)
+	if err != nil {
+		return "", err
+	}
+	if !always && stats.Copied == 0 && stats.Failed == 0 {
+		run.Quiet()
+	}
+	return backup.FormatStats(stats), nil
+}
+
+// runOnce copies one backup run, waiting for a transfer window first
+// unless always, and announces the outcome to webhooks.
+func (t *BackupTool) runOnce(ctx context.Context, data map[string]string, channel, chatID string, always bool) (*backup.Stats, error) {
+	if !always && isDriveDestination(data["destination"]) {
+		// The wait for a window does not count against the run's time
+		ctx = transfer.Background(ctx)
+		if _, err := transfer.WaitForWindow(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, backupRunTimeout)
+	defer cancel()
+
+	src, err := t.source(data)
+	var stats *backup.Stats
+	if err == nil {
+		stats, err = t.engine.RunTo(ctx, data["name"], src, t.destination(data))
+	}
+	if err == backup.ErrAlreadyRunning {
+		return nil, err
+	}
+	logger.InfoCF("backup", "Backup run finished", map[string]interface{}{
+		"job":   data["name"],
+		"error": fmt.Sprint(err),
+	})
+	finished := map[string]interface{}{
+		"name":        data["name"],
+		"destination": data["destination"],
+		"channel":     channel,
+		"chat_id":     chatID,
+	}
+	if err != nil {
+		finished["error"] = err.Error()
+	} else {
+		finished["stats"] = stats
+	}
+	webhooks.Emit(webhooks.BackupFinished, finished)
+	return stats, err
+}
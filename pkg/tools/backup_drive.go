@@ -0,0 +1,212 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/backup"
+)
+
+// driveArchiveFolder is created in My Drive for backups to "drive" without
+// a folder ID.
+const driveArchiveFolder = "picoclaw archive"
+
+// Fidelity notes for Photos items. The Library API serves photos with
+// their EXIF minus location, and videos re-encoded rather than the
+// uploaded file; there is no way to get the originals but Google Takeout.
+const (
+	photoFidelity = "photos without location metadata (the Photos API strips it)"
+	videoFidelity = "videos re-encoded by the Photos API (not the original file)"
+)
+
+// photosFidelity returns how the Photos API's copy of an item of
+// mimeType differs from the original.
+func photosFidelity(mimeType string) string {
+	if strings.HasPrefix(mimeType, "video/") {
+		return videoFidelity
+	}
+	return photoFidelity
+}
+
+// isDriveDestination reports whether a backup destination is a Drive
+// folder: "drive" or "drive:<folder ID>".
+func isDriveDestination(dest string) bool {
+	return dest == "drive" || strings.HasPrefix(dest, "drive:")
+}
+
+// DriveBackupDestination writes a backup into a Drive folder, mirroring
+// the entry paths as subfolders. Files are spooled to a local temp file
+// first, since sources such as Photos don't know sizes in advance, then
+// uploaded in resumable chunks. The manifest is kept in the workspace,
+// and a copy is uploaded into the folder after each run so the archive
+// describes itself.
+type DriveBackupDestination struct {
+	drive        *GoogleDriveClient
+	folderID     string
+	manifestDir  string
+	spoolDir     string
+	mu           sync.Mutex
+	folders      map[string]string // entry directory -> Drive folder ID
+	manifestFile string
+}
+
+// NewDriveBackupDestination writes into folderID, or a "picoclaw archive"
+// folder in My Drive when empty. Manifests go in workspace/state/backups.
+func NewDriveBackupDestination(drive *GoogleDriveClient, folderID, workspace string) *DriveBackupDestination {
+	return &DriveBackupDestination{
+		drive:       drive,
+		folderID:    folderID,
+		manifestDir: filepath.Join(workspace, "state", "backups"),
+		spoolDir:    filepath.Join(workspace, "cache", "backup-spool"),
+		folders:     make(map[string]string),
+	}
+}
+
+func (d *DriveBackupDestination) Prepare(ctx context.Context) error {
+	if d.folderID == "" {
+		folder, err := d.drive.EnsureFolder(ctx, "", driveArchiveFolder)
+		if err != nil {
+			return fmt.Errorf("Drive is not available: %w", err)
+		}
+		d.folderID = folder.ID
+	} else {
+		var folder driveFileJSON
+		if err := d.drive.do(ctx, http.MethodGet, "/files/"+url.PathEscape(d.folderID)+"?fields=id,name,mimeType&supportsAllDrives=true", nil, &folder); err != nil {
+			return fmt.Errorf("Drive folder %s is not available: %w", d.folderID, err)
+		}
+		if folder.MimeType != "application/vnd.google-apps.folder" {
+			return fmt.Errorf("%s is not a Drive folder", folder.Name)
+		}
+	}
+	d.folders[""] = d.folderID
+	if err := os.MkdirAll(d.manifestDir, 0755); err != nil {
+		return err
+	}
+	return os.MkdirAll(d.spoolDir, 0755)
+}
+
+func (d *DriveBackupDestination) manifestPath(job string) string {
+	return filepath.Join(d.manifestDir, backup.SafeName(job)+".json")
+}
+
+func (d *DriveBackupDestination) LoadManifest(job string) (*backup.Manifest, error) {
+	return backup.ReadManifest(d.manifestPath(job), job)
+}
+
+func (d *DriveBackupDestination) SaveManifest(m *backup.Manifest) error {
+	return backup.WriteManifest(d.manifestPath(m.Job), m)
+}
+
+// Has trusts the manifest: checking every file in Drive would cost a
+// request each.
+func (d *DriveBackupDestination) Has(ctx context.Context, prev backup.ManifestEntry) bool {
+	return prev.Ref != ""
+}
+
+func (d *DriveBackupDestination) Write(ctx context.Context, src backup.Source, entry backup.Entry, prev *backup.ManifestEntry) (backup.Stored, error) {
+	dir, name := path.Split(entry.Path)
+	parentID, err := d.folder(ctx, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return backup.Stored{}, err
+	}
+
+	spool, err := os.CreateTemp(d.spoolDir, "entry-*")
+	if err != nil {
+		return backup.Stored{}, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	rc, err := src.Open(ctx, entry, 0)
+	if err != nil {
+		return backup.Stored{}, err
+	}
+	size, err := io.Copy(spool, rc)
+	rc.Close()
+	if err != nil {
+		return backup.Stored{}, err
+	}
+	if entry.Size >= 0 && size != entry.Size {
+		return backup.Stored{}, fmt.Errorf("size mismatch: got %d of %d bytes", size, entry.Size)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return backup.Stored{}, err
+	}
+
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	file, err := d.drive.UploadStream(ctx, parentID, name, mimeType, spool, size)
+	if err != nil {
+		return backup.Stored{}, err
+	}
+	if prev != nil && prev.Ref != "" {
+		// The old copy goes to the trash, where it can still be restored
+		d.drive.Trash(ctx, prev.Ref)
+	}
+	return backup.Stored{Size: size, Bytes: size, Ref: file.ID}, nil
+}
+
+// folder returns the Drive folder for an entry directory ("2024/05"),
+// creating the missing levels.
+func (d *DriveBackupDestination) folder(ctx context.Context, dir string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id, ok := d.folders[dir]; ok {
+		return id, nil
+	}
+	parentID := d.folderID
+	walked := ""
+	for _, part := range strings.Split(dir, "/") {
+		walked = strings.TrimPrefix(walked+"/"+part, "/")
+		if id, ok := d.folders[walked]; ok {
+			parentID = id
+			continue
+		}
+		folder, err := d.drive.EnsureFolder(ctx, parentID, part)
+		if err != nil {
+			return "", err
+		}
+		d.folders[walked] = folder.ID
+		parentID = folder.ID
+	}
+	return parentID, nil
+}
+
+// Finish uploads the manifest into the folder as "<job> manifest.json",
+// replacing the previous run's.
+func (d *DriveBackupDestination) Finish(ctx context.Context, m *backup.Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := backup.SafeName(m.Job) + " manifest.json"
+	if d.manifestFile == "" {
+		files, err := d.drive.ListFolder(ctx, d.folderID)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.Name == name {
+				d.manifestFile = f.ID
+				break
+			}
+		}
+	}
+	if d.manifestFile != "" {
+		return d.drive.UpdateContent(ctx, d.manifestFile, "application/json", data)
+	}
+	file, err := d.drive.Upload(ctx, d.folderID, name, "application/json", data)
+	if err != nil {
+		return err
+	}
+	d.manifestFile = file.ID
+	return nil
+}
@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// TestBackupTool_DriveScheduledRun verifies a Drive folder is backed up, Docs are exported and reruns are incremental
+func TestBackupTool_DriveScheduledRun(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/files/root1":
+			w.Write([]byte(`{"id":"root1","name":"Work","mimeType":"application/vnd.google-apps.folder"}`))
+		case r.URL.Path == "/files" && strings.Contains(r.URL.Query().Get("q"), "'root1' in parents"):
+			w.Write([]byte(`{"files":[
+				{"id":"f1","name":"notes.txt","mimeType":"text/plain","size":"5","md5Checksum":"5d41402abc4b2a76b9719d911017c592"},
+				{"id":"d1","name":"Plan","mimeType":"application/vnd.google-apps.document","modifiedTime":"2026-10-01T00:00:00Z"},
+				{"id":"sub","name":"Old: stuff","mimeType":"application/vnd.google-apps.folder"}]}`))
+		case r.URL.Path == "/files" && strings.Contains(r.URL.Query().Get("q"), "'sub' in parents"):
+			w.Write([]byte(`{"files":[{"id":"f2","name":"a.bin","mimeType":"application/octet-stream","size":"3","md5Checksum":"c1111bd512b29e821b120b86446026b8"}]}`))
+		case r.URL.Path == "/files/f1":
+			downloads++
+			w.Write([]byte("hello"))
+		case r.URL.Path == "/files/f2":
+			downloads++
+			w.Write([]byte("bin"))
+		case r.URL.Path == "/files/d1/export":
+			downloads++
+			if !strings.Contains(r.URL.Query().Get("mimeType"), "wordprocessingml") {
+				t.Errorf("unexpected export format %q", r.URL.Query().Get("mimeType"))
+			}
+			w.Write([]byte("docx"))
+		default:
+			t.Errorf("unexpected request %s", r.URL.String())
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dest := t.TempDir()
+	msgBus := bus.NewMessageBus()
+	tool := NewBackupTool(func(ctx context.Context) (string, error) { return "tok", nil }, []string{dest}, t.TempDir(), nil, msgBus)
+	tool.driveURL = server.URL
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "42")
+
+	if r := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "add", "name": "work", "source": "drive", "folder_id": "root1", "destination": "/etc",
+	}); !r.IsError {
+		t.Fatal("destination outside the allowed roots should be rejected")
+	}
+	r := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "add", "name": "work", "source": "drive", "folder_id": "root1", "time": "02:30",
+	})
+	if r.IsError {
+		t.Fatalf("add failed: %s", r.ForLLM)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Schedule.Expr != "30 2 * * *" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+
+	if out, err := tool.ExecuteJob(context.Background(), &jobs[0]); err != nil || out != "" {
+		t.Fatalf("ExecuteJob = %q, %v", out, err)
+	}
+	tool.wg.Wait()
+
+	for path, want := range map[string]string{
+		"Work/notes.txt":        "hello",
+		"Work/Plan.docx":        "docx",
+		"Work/Old_ stuff/a.bin": "bin",
+	} {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(path)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, want)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || msg.ChatID != "42" || !strings.Contains(msg.Content, "3 copied") {
+		t.Fatalf("unexpected report: %+v", msg)
+	}
+
+	// Nothing changed: the second scheduled run copies nothing and stays quiet
+	tool.ExecuteJob(context.Background(), &jobs[0])
+	tool.wg.Wait()
+	if downloads != 3 {
+		t.Errorf("expected 3 downloads in total, got %d", downloads)
+	}
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "status", "name": "work"})
+	if !strings.Contains(r.ForLLM, "Files in backup: 3") || !strings.Contains(r.ForLLM, "3 unchanged") {
+		t.Errorf("unexpected status: %s", r.ForLLM)
+	}
+}
+
+// TestBackupTool_PhotosAlbumToDrive verifies an album is archived into Drive folders with a manifest recording fidelity
+func TestBackupTool_PhotosAlbumToDrive(t *testing.T) {
+	var uploads []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := func(id, mime, name string) string {
+			return `{"id":"` + id + `","mimeType":"` + mime + `","filename":"` + name + `","baseUrl":"` + server.URL + `/base/` + id +
+				`","mediaMetadata":{"creationTime":"2026-05-03T10:00:00Z"}}`
+		}
+		switch {
+		case r.URL.Path == "/photos/albums":
+			w.Write([]byte(`{"albums":[{"id":"al1","title":"Lisbon trip"}]}`))
+		case r.URL.Path == "/photos/mediaItems:search":
+			w.Write([]byte(`{"mediaItems":[` + item("p1", "image/jpeg", "a.jpg") + `,` + item("v1", "video/mp4", "b.mp4") + `]}`))
+		case r.URL.Path == "/photos/mediaItems/p1":
+			w.Write([]byte(item("p1", "image/jpeg", "a.jpg")))
+		case r.URL.Path == "/photos/mediaItems/v1":
+			w.Write([]byte(item("v1", "video/mp4", "b.mp4")))
+		case r.URL.Path == "/base/p1=d":
+			w.Write([]byte("jpeg"))
+		case r.URL.Path == "/base/v1=dv":
+			w.Write([]byte("mp4"))
+		case r.URL.Path == "/drive/files/arch":
+			w.Write([]byte(`{"id":"arch","name":"Archive","mimeType":"application/vnd.google-apps.folder"}`))
+		case r.URL.Path == "/drive/files" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"files":[]}`))
+		case r.URL.Path == "/drive/files" && r.Method == http.MethodPost:
+			w.Write([]byte(`{"id":"folder"}`))
+		case r.URL.Path == "/upload/files":
+			body, _ := io.ReadAll(r.Body)
+			uploads = append(uploads, string(body))
+			w.Write([]byte(`{"id":"up` + strconv.Itoa(len(uploads)) + `"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.String())
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	workspace := t.TempDir()
+	msgBus := bus.NewMessageBus()
+	tool := NewBackupTool(func(ctx context.Context) (string, error) { return "tok", nil }, nil, workspace, nil, msgBus)
+	tool.photos.baseURL = server.URL + "/photos"
+	tool.drive.baseURL = server.URL + "/drive"
+	tool.drive.uploadURL = server.URL + "/upload"
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "42")
+
+	r := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "add", "name": "lisbon", "source": "photos", "album": "lisbon TRIP", "destination": "drive:arch", "every": "week",
+	})
+	if r.IsError || !strings.Contains(r.ForLLM, `Photos album "Lisbon trip" -> Google Drive folder arch, every week`) {
+		t.Fatalf("add: %s", r.ForLLM)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Schedule.Expr != "0 3 * * 0" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+	tool.ExecuteJob(context.Background(), &jobs[0])
+	tool.wg.Wait()
+
+	// Two media files and the manifest
+	if len(uploads) != 3 || !strings.Contains(uploads[0], "jpeg") || !strings.Contains(uploads[2], `"fidelity": "videos re-encoded`) {
+		t.Fatalf("unexpected uploads: %q", uploads)
+	}
+	m, err := tool.destination(jobs[0].Payload.Data).LoadManifest("lisbon")
+	if err != nil || m.Files["p1"].Ref != "up1" || m.Files["p1"].Fidelity != photoFidelity || m.Files["p1"].Path != "2026/05/a.jpg" {
+		t.Fatalf("unexpected manifest: %+v, %v", m, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || !strings.Contains(msg.Content, "2 copied") || !strings.Contains(msg.Content, "~ 1 photos without location metadata") {
+		t.Fatalf("unexpected report: %+v", msg)
+	}
+
+	// Copies recorded in the manifest are not uploaded again; only the
+	// manifest is
+	tool.ExecuteJob(context.Background(), &jobs[0])
+	tool.wg.Wait()
+	if len(uploads) != 4 || !strings.Contains(uploads[3], `"job": "lisbon"`) {
+		t.Errorf("rerun uploaded %d files, want only the manifest", len(uploads)-3)
+	}
+}
@@ -1,6 +1,10 @@
 package tools
 
-import "context"
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
 
 // Tool is the interface that all tools must implement.
 type Tool interface {
@@ -17,6 +21,38 @@ type ContextualTool interface {
 	SetContext(channel, chatID string)
 }
 
+type chatKey struct{}
+
+// WithChat records the chat a tool call is made for. The registry adds it
+// to every call made with a channel and chat ID, so tools that default to
+// the current chat can read it per call instead of from shared fields,
+// which concurrent conversations would overwrite.
+func WithChat(ctx context.Context, channel, chatID string) context.Context {
+	return context.WithValue(ctx, chatKey{}, [2]string{channel, chatID})
+}
+
+// ChatFromContext returns the chat recorded by WithChat, or empty strings.
+func ChatFromContext(ctx context.Context) (channel, chatID string) {
+	chat, _ := ctx.Value(chatKey{}).([2]string)
+	return chat[0], chat[1]
+}
+
+type localeKey struct{}
+
+// WithLocale records the locale of the user a tool call is made for, so
+// tools can format dates, numbers and their replies with the locale
+// package in the user's language.
+func WithLocale(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, localeKey{}, tag)
+}
+
+// LocaleFromContext returns the locale recorded by WithLocale, or "",
+// which the locale package reads as the server default.
+func LocaleFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(localeKey{}).(string)
+	return tag
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -69,6 +105,27 @@ type AsyncTool interface {
 	SetCallback(cb AsyncCallback)
 }
 
+// ScheduledTool is an optional interface for tools that schedule their own
+// cron jobs (e.g. price alerts) and handle them when they fire.
+//
+// The gateway injects the cron service via SetScheduler and routes jobs whose
+// payload kind is listed in JobKinds to ExecuteJob.
+type ScheduledTool interface {
+	Tool
+	JobKinds() []string
+	SetScheduler(cs *cron.CronService)
+	ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error)
+}
+
+// ConfigurableTool is an optional interface for tools that take settings
+// from the config file (tools.policies.<name>.settings), such as a default
+// calendar or a size limit. Configure is called once after the tool is
+// built and before it is used; unknown keys are ignored.
+type ConfigurableTool interface {
+	Tool
+	Configure(settings ToolSettings) error
+}
+
 func ToolToSchema(tool Tool) map[string]interface{} {
 	return map[string]interface{}{
 		"type": "function",
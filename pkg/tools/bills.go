@@ -0,0 +1,686 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	billsJobKind = "bills"
+	// billsQuery finds bills, invoices and payment confirmations; runs add
+	// a date window
+	billsQuery = "{subject:bill subject:invoice subject:statement subject:due subject:payment subject:fatura subject:factura subject:rechnung}"
+	// billsFirstRunWindow is how far back the first run looks
+	billsFirstRunWindow = "newer_than:45d"
+	// maxBillMessages bounds the emails read per run
+	maxBillMessages = 30
+	// billRetention is how long bills are kept after they were due, so a
+	// month can be compared with the one before
+	billRetention = 400 * 24 * time.Hour
+)
+
+const billsPrompt = `You read emails that may be bills. Return ONLY a JSON object (no prose, no code fences):
+{"kind": "bill|paid|none", "payee": "...", "amount": 0, "currency": "ISO code or empty", "due": "YYYY-MM-DD or empty", "reference": "invoice or account reference or empty", "autopay": false}
+Rules:
+- "bill": an invoice, bill or statement asking the user to pay an amount. amount is the total to pay; due is the payment due date.
+- "paid": a confirmation that a bill was paid or charged; payee, amount and reference say which.
+- autopay is true when the email says the amount will be charged or debited automatically.
+- payee is the company or person to pay, short ("EDP", "Vodafone"), the same way every month.
+- "none" for receipts of purchases already paid, marketing, newsletters and anything else. Never invent amounts or dates.`
+
+// bill is one amount to pay, read from an email.
+type bill struct {
+	ID        string `json:"id"`
+	Payee     string `json:"payee"`
+	Cents     int64  `json:"cents"`
+	Currency  string `json:"currency"`
+	Due       string `json:"due"` // YYYY-MM-DD, "" when the email gave none
+	Reference string `json:"reference,omitempty"`
+	Autopay   bool   `json:"autopay,omitempty"`
+	Subject   string `json:"subject"`
+	// Source is the Gmail message the bill came from
+	Source   string    `json:"source"`
+	Paid     time.Time `json:"paid,omitempty"`
+	Reminded bool      `json:"reminded,omitempty"`
+	Overdue  bool      `json:"overdue,omitempty"`
+}
+
+type billsState struct {
+	Bills     []*bill              `json:"bills"`
+	Processed map[string]time.Time `json:"processed"`
+	LastRun   time.Time            `json:"last_run"`
+	// Summarized is the last month ("2006-01") whose obligations were sent
+	Summarized string `json:"summarized,omitempty"`
+}
+
+// BillsOptions configures the bill tracker.
+type BillsOptions struct {
+	// Query replaces the Gmail search for bills
+	Query string
+	// RemindDays is how many days before the due date to remind
+	RemindDays int
+	// Currency is assumed when a bill does not say
+	Currency string
+}
+
+// BillsTool finds bills and invoices in Gmail, keeps their amounts and due
+// dates, and, scheduled in a chat, reminds before each is due and sends
+// the month's obligations at the start of every month. Payment
+// confirmations mark the bill they are for as paid.
+type BillsTool struct {
+	gmail     *GmailClient
+	provider  providers.LLMProvider
+	model     string
+	profiles  *profile.Store
+	opts      BillsOptions
+	statePath string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+func NewBillsTool(token TokenFunc, provider providers.LLMProvider, model, workspace string, opts BillsOptions, profiles *profile.Store) *BillsTool {
+	if opts.Query == "" {
+		opts.Query = billsQuery
+	}
+	if opts.RemindDays <= 0 {
+		opts.RemindDays = 3
+	}
+	if opts.Currency == "" {
+		opts.Currency = "USD"
+	}
+	return &BillsTool{
+		gmail:     NewGmailClient(token),
+		provider:  provider,
+		model:     model,
+		profiles:  profiles,
+		opts:      opts,
+		statePath: filepath.Join(workspace, "state", "bills.json"),
+		now:       time.Now,
+	}
+}
+
+func (t *BillsTool) Name() string {
+	return "bills"
+}
+
+func (t *BillsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "scan", "paid", "schedule", "unschedule")
+}
+
+// Untrusted reports that bills found and listed carry text read from
+// emails.
+func (t *BillsTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "scan", "list", "summary")
+}
+
+func (t *BillsTool) Description() string {
+	return "Bills and invoices from email: find them in Gmail with the amount and due date, list what is unpaid, mark one paid, or summarize a month's obligations (what is due, paid and still to pay). " +
+		fmt.Sprintf("Schedule it in this chat to check email every few hours, get a reminder %d day(s) before each bill is due and the month's obligations when a month starts.", t.opts.RemindDays)
+}
+
+func (t *BillsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"scan", "list", "paid", "summary", "schedule", "unschedule"},
+				"description": "Action to perform",
+			},
+			"bill": map[string]interface{}{
+				"type":        "string",
+				"description": "paid: bill ID or payee (the oldest unpaid bill of that payee)",
+			},
+			"month": map[string]interface{}{
+				"type":        "string",
+				"description": "summary: YYYY-MM (default: this month)",
+			},
+			"every_hours": map[string]interface{}{
+				"type":        "integer",
+				"description": "schedule: how often to look for new bills (default 6)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *BillsTool) JobKinds() []string {
+	return []string{billsJobKind}
+}
+
+func (t *BillsTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *BillsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	prof := t.profile(channel + ":" + chatID)
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "scan":
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		state, err := t.loadState()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		report, err := t.scan(ctx, state, prof)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("bill scan failed: %v", err)).WithError(err)
+		}
+		if err := saveJSONAtomic(t.statePath, state); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if report == "" {
+			report = "No new bills."
+		}
+		return NewToolResult(report)
+
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("bill scheduling is not available (scheduler not running)")
+		}
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		hours := 6
+		if h, ok := args["every_hours"].(float64); ok && h >= 1 {
+			hours = int(h)
+		}
+		t.unschedule()
+		everyMS := (time.Duration(hours) * time.Hour).Milliseconds()
+		job, err := t.scheduler.AddJobWithPayload("Bills", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    billsJobKind,
+			Message: "Bills",
+			Channel: channel,
+			To:      chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Bills checked every %dh (id: %s); new bills, reminders %d day(s) before they are due and each month's obligations will be sent here.",
+			hours, job.ID, t.opts.RemindDays))
+
+	case "unschedule":
+		if t.scheduler == nil {
+			return ErrorResult("bill scheduling is not available (scheduler not running)")
+		}
+		if t.unschedule() == 0 {
+			return SilentResult("Bills were not scheduled")
+		}
+		return SilentResult("Bill schedule removed")
+
+	case "list":
+		t.mu.Lock()
+		state, err := t.loadState()
+		t.mu.Unlock()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		var lines []string
+		for _, b := range state.Bills {
+			if b.Paid.IsZero() {
+				lines = append(lines, t.describe(b, prof))
+			}
+		}
+		if len(lines) == 0 {
+			return SilentResult("No unpaid bills. Run scan to look for new ones in Gmail.")
+		}
+		return SilentResult("Unpaid bills:\n- " + strings.Join(lines, "\n- "))
+
+	case "paid":
+		ref, _ := args["bill"].(string)
+		if strings.TrimSpace(ref) == "" {
+			return ErrorResult("bill is required for paid")
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		state, err := t.loadState()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		b := findBill(state.Bills, ref)
+		if b == nil {
+			return ErrorResult(fmt.Sprintf("no unpaid bill matching %q; list shows them", ref))
+		}
+		b.Paid = t.now()
+		if err := saveJSONAtomic(t.statePath, state); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult("Marked paid: " + t.describe(b, prof))
+
+	case "summary":
+		month, _ := args["month"].(string)
+		month = strings.TrimSpace(month)
+		if month == "" {
+			month = t.now().In(prof.Location()).Format("2006-01")
+		}
+		first, err := time.ParseInLocation("2006-01", month, prof.Location())
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid month %q, use YYYY-MM", month))
+		}
+		t.mu.Lock()
+		state, err := t.loadState()
+		t.mu.Unlock()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(t.summary(state, first, prof))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// unschedule removes existing bill jobs; the mailbox is the user's, so
+// one schedule is enough.
+func (t *BillsTool) unschedule() int {
+	removed := 0
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == billsJobKind && t.scheduler.RemoveJob(job.ID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ExecuteJob implements ScheduledTool. It reads new bills, then sends the
+// month's obligations when a month has started, reminders for bills due
+// soon and a note on bills gone overdue; "" when there is nothing to say.
+func (t *BillsTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	prof := t.profile(job.Payload.Channel + ":" + job.Payload.To)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	report, err := t.scan(ctx, state, prof)
+	if err != nil {
+		// Reminders for the bills already known still go out
+		report = fmt.Sprintf("⚠️ Checking email for bills failed: %v", err)
+	}
+	month := t.now().In(prof.Location())
+	if key := month.Format("2006-01"); state.Summarized != key {
+		state.Summarized = key
+		parts = append(parts, "📅 "+t.summary(state, time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, prof.Location()), prof))
+	}
+	if report != "" {
+		parts = append(parts, report)
+	}
+	if reminders := t.remind(state, prof); reminders != "" {
+		parts = append(parts, reminders)
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+func (t *BillsTool) profile(chat string) profile.Profile {
+	if t.profiles == nil || chat == ":" {
+		return profile.Profile{}
+	}
+	return t.profiles.Get(chat)
+}
+
+// scan reads new bill emails into state and reports the bills added and
+// paid ("" when none).
+func (t *BillsTool) scan(ctx context.Context, state *billsState, prof profile.Profile) (string, error) {
+	window := billsFirstRunWindow
+	if !state.LastRun.IsZero() {
+		// Gmail's after: is by day and emails can arrive late
+		window = "after:" + state.LastRun.AddDate(0, 0, -2).Format("2006/01/02")
+	}
+	started := t.now()
+	ids, err := t.gmail.Search(ctx, fmt.Sprintf("(%s) %s", t.opts.Query, window), maxBillMessages)
+	if err != nil {
+		return "", fmt.Errorf("failed to search Gmail: %w", err)
+	}
+	var added, paid, failures []string
+	for _, id := range ids {
+		if _, done := state.Processed[id]; done {
+			continue
+		}
+		msg, err := t.gmail.GetMessage(ctx, id)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("reading email %s: %v", id, err))
+			continue
+		}
+		kind, b, err := t.extract(ctx, msg, prof)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%q: %v", msg.Subject, err))
+			continue
+		}
+		state.Processed[id] = t.now()
+		switch kind {
+		case "bill":
+			if state.add(b) {
+				added = append(added, t.describe(b, prof))
+			}
+		case "paid":
+			if existing := state.match(b); existing != nil && existing.Paid.IsZero() {
+				existing.Paid = msg.Received
+				if existing.Paid.IsZero() {
+					existing.Paid = t.now()
+				}
+				paid = append(paid, t.describe(existing, prof))
+			}
+		}
+	}
+
+	for id, at := range state.Processed {
+		if started.Sub(at) > invoiceProcessedRetention {
+			delete(state.Processed, id)
+		}
+	}
+	kept := state.Bills[:0]
+	for _, b := range state.Bills {
+		if due, err := time.Parse("2006-01-02", b.Due); err != nil || started.Sub(due) < billRetention {
+			kept = append(kept, b)
+		}
+	}
+	state.Bills = kept
+	state.LastRun = started
+
+	var sb strings.Builder
+	if len(added) > 0 {
+		fmt.Fprintf(&sb, "🧾 New bills:\n- %s", strings.Join(added, "\n- "))
+	}
+	if len(paid) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "✅ Paid:\n- %s", strings.Join(paid, "\n- "))
+	}
+	if len(failures) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⚠️ %d problem(s):\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return sb.String(), nil
+}
+
+// extract asks the model whether an email is a bill or a payment
+// confirmation, and for its details.
+func (t *BillsTool) extract(ctx context.Context, msg *GmailMessage, prof profile.Profile) (string, *bill, error) {
+	loc := prof.Location()
+	text := fmt.Sprintf("From: %s\nSubject: %s\nDate: %s\n\n%s", msg.From, msg.Subject, msg.Date, msg.Text)
+	if len(text) > maxExtractChars {
+		text = text[:maxExtractChars]
+	}
+	messages := []providers.Message{
+		{Role: "system", Content: billsPrompt + "\n\n" + quotedDocumentNote},
+		{Role: "user", Content: fmt.Sprintf("Today is %s.\n\n%s", t.now().In(loc).Format("Monday 2006-01-02"), QuoteUntrusted(t.Name(), text))},
+	}
+	resp, err := t.provider.Chat(ctx, messages, nil, t.model, map[string]interface{}{
+		"max_tokens":  400,
+		"temperature": 0,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	raw := resp.Content
+	start, end := strings.Index(raw, "{"), strings.LastIndex(raw, "}")
+	if start < 0 || end < start {
+		return "", nil, fmt.Errorf("model returned no bill")
+	}
+	var e struct {
+		Kind      string  `json:"kind"`
+		Payee     string  `json:"payee"`
+		Amount    float64 `json:"amount"`
+		Currency  string  `json:"currency"`
+		Due       string  `json:"due"`
+		Reference string  `json:"reference"`
+		Autopay   bool    `json:"autopay"`
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &e); err != nil {
+		return "", nil, fmt.Errorf("model returned an invalid bill: %w", err)
+	}
+	kind := strings.ToLower(strings.TrimSpace(e.Kind))
+	b := &bill{
+		Payee:     strings.TrimSpace(e.Payee),
+		Cents:     toCents(e.Amount),
+		Currency:  strings.ToUpper(strings.TrimSpace(e.Currency)),
+		Reference: strings.TrimSpace(e.Reference),
+		Autopay:   e.Autopay,
+		Subject:   msg.Subject,
+		Source:    msg.ID,
+	}
+	if b.Payee == "" {
+		b.Payee = msg.From
+	}
+	if b.Currency == "" {
+		b.Currency = t.opts.Currency
+	}
+	if due, err := time.Parse("2006-01-02", strings.TrimSpace(e.Due)); err == nil {
+		b.Due = due.Format("2006-01-02")
+	}
+	if kind == "bill" && b.Cents <= 0 {
+		// Nothing to pay, e.g. a statement with a zero balance
+		kind = "none"
+	}
+	return kind, b, nil
+}
+
+// add records a new bill, or updates the one it repeats (a reminder from
+// the biller, a corrected invoice). It reports whether the bill is new.
+func (s *billsState) add(b *bill) bool {
+	if existing := s.match(b); existing != nil {
+		existing.Cents, existing.Currency, existing.Autopay = b.Cents, b.Currency, existing.Autopay || b.Autopay
+		if b.Due != "" && b.Due != existing.Due {
+			existing.Due, existing.Reminded, existing.Overdue = b.Due, false, false
+		}
+		return false
+	}
+	b.ID = billID(b, s.Bills)
+	s.Bills = append(s.Bills, b)
+	sort.SliceStable(s.Bills, func(i, j int) bool { return billBefore(s.Bills[i], s.Bills[j]) })
+	return true
+}
+
+// match finds the bill an email is about: the same payee and reference,
+// or without a reference the same due date or amount while unpaid.
+func (s *billsState) match(b *bill) *bill {
+	for _, existing := range s.Bills {
+		if !strings.EqualFold(existing.Payee, b.Payee) {
+			continue
+		}
+		if b.Reference != "" && existing.Reference != "" {
+			if strings.EqualFold(existing.Reference, b.Reference) {
+				return existing
+			}
+			continue
+		}
+		if (b.Due != "" && existing.Due == b.Due) || (existing.Paid.IsZero() && b.Cents > 0 && existing.Cents == b.Cents) {
+			return existing
+		}
+	}
+	return nil
+}
+
+// billID names a bill after its payee and due date, e.g.
+// "edp-2026-10-20", numbered when taken.
+func billID(b *bill, bills []*bill) string {
+	slug := strings.ToLower(strings.Join(strings.Fields(b.Payee), "-"))
+	if slug == "" {
+		slug = "bill"
+	}
+	when := b.Due
+	if when == "" {
+		when = "nodue"
+	}
+	id := slug + "-" + when
+	for n := 2; ; n++ {
+		taken := false
+		for _, other := range bills {
+			taken = taken || other.ID == id
+		}
+		if !taken {
+			return id
+		}
+		id = fmt.Sprintf("%s-%s-%d", slug, when, n)
+	}
+}
+
+// billBefore orders bills by due date, bills without one last.
+func billBefore(a, b *bill) bool {
+	if (a.Due == "") != (b.Due == "") {
+		return b.Due == ""
+	}
+	return a.Due < b.Due
+}
+
+// findBill picks an unpaid bill by ID, or the one due first of a payee.
+func findBill(bills []*bill, ref string) *bill {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	for _, b := range bills {
+		if b.ID == ref {
+			return b
+		}
+	}
+	for _, b := range bills {
+		if b.Paid.IsZero() && strings.Contains(strings.ToLower(b.Payee), ref) {
+			return b
+		}
+	}
+	return nil
+}
+
+// remind returns the reminders for unpaid bills now due within RemindDays
+// and for those gone overdue, each sent once.
+func (t *BillsTool) remind(state *billsState, prof profile.Profile) string {
+	today := t.now().In(prof.Location()).Format("2006-01-02")
+	soon := t.now().In(prof.Location()).AddDate(0, 0, t.opts.RemindDays).Format("2006-01-02")
+	var due, overdue []string
+	for _, b := range state.Bills {
+		if !b.Paid.IsZero() || b.Due == "" || b.Autopay {
+			continue
+		}
+		switch {
+		case b.Due < today && !b.Overdue:
+			b.Overdue, b.Reminded = true, true
+			overdue = append(overdue, t.describe(b, prof))
+		case b.Due >= today && b.Due <= soon && !b.Reminded:
+			b.Reminded = true
+			due = append(due, t.describe(b, prof))
+		}
+	}
+	var sb strings.Builder
+	if len(due) > 0 {
+		fmt.Fprintf(&sb, "⏰ Bills due soon:\n- %s", strings.Join(due, "\n- "))
+	}
+	if len(overdue) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⚠️ Overdue:\n- %s", strings.Join(overdue, "\n- "))
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\nSay \"paid\" with the bill once it is settled.")
+	}
+	return sb.String()
+}
+
+// summary lists the bills due in the month starting at first, with what
+// is paid and still to pay by currency, and the payees billed the month
+// before who have not billed yet.
+func (t *BillsTool) summary(state *billsState, first time.Time, prof profile.Profile) string {
+	from, to := first.Format("2006-01-02"), first.AddDate(0, 1, 0).Format("2006-01-02")
+	prevFrom := first.AddDate(0, -1, 0).Format("2006-01-02")
+	total, open := map[string]int64{}, map[string]int64{}
+	var currencies []string
+	var lines []string
+	billed := map[string]bool{}
+	for _, b := range state.Bills {
+		if b.Due < from || b.Due >= to {
+			continue
+		}
+		billed[strings.ToLower(b.Payee)] = true
+		lines = append(lines, t.describe(b, prof))
+		if _, ok := total[b.Currency]; !ok {
+			currencies = append(currencies, b.Currency)
+		}
+		total[b.Currency] += b.Cents
+		if b.Paid.IsZero() {
+			open[b.Currency] += b.Cents
+		}
+	}
+	var expected []string
+	for _, b := range state.Bills {
+		key := strings.ToLower(b.Payee)
+		if b.Due >= prevFrom && b.Due < from && !billed[key] {
+			billed[key] = true
+			expected = append(expected, fmt.Sprintf("%s (last time %s)", b.Payee, formatCents(b.Cents, b.Currency)))
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Bills for %s:", first.Format("January 2006"))
+	if len(lines) == 0 {
+		sb.WriteString(" none due yet.")
+	} else {
+		sb.WriteString("\n- " + strings.Join(lines, "\n- "))
+		sort.Strings(currencies)
+		for _, cur := range currencies {
+			fmt.Fprintf(&sb, "\nTotal %s, paid %s, to pay %s", formatCents(total[cur], cur), formatCents(total[cur]-open[cur], cur), formatCents(open[cur], cur))
+		}
+	}
+	if len(expected) > 0 {
+		sb.WriteString("\nExpected, billed last month: " + strings.Join(expected, ", "))
+	}
+	return sb.String()
+}
+
+func (t *BillsTool) describe(b *bill, prof profile.Profile) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", b.Payee, formatCents(b.Cents, b.Currency))
+	if due, err := time.ParseInLocation("2006-01-02", b.Due, prof.Location()); err == nil {
+		sb.WriteString(", due " + locale.Date(due, prof.FormatLocale()))
+	}
+	if b.Reference != "" {
+		sb.WriteString(" (ref " + b.Reference + ")")
+	}
+	switch {
+	case !b.Paid.IsZero():
+		sb.WriteString(" ✓ paid")
+	case b.Autopay:
+		sb.WriteString(" [autopay]")
+	}
+	sb.WriteString(" [" + b.ID + "]")
+	return sb.String()
+}
+
+func (t *BillsTool) loadState() (*billsState, error) {
+	state := &billsState{Processed: make(map[string]time.Time)}
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bill state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse bill state: %w", err)
+	}
+	if state.Processed == nil {
+		state.Processed = make(map[string]time.Time)
+	}
+	return state, nil
+}
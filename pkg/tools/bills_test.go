@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestBillsTool_TracksRemindsAndSummarizes verifies a bill email is tracked with its amount and due date, reminded once before it is due, marked paid by the payment confirmation and counted in the month's obligations
+func TestBillsTool_TracksRemindsAndSummarizes(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	due := time.Now().AddDate(0, 0, 2)
+	g.AddEmail(testkit.Email{From: "faturas@edp.pt", Subject: "Your EDP bill for September", Body: "Total 42,50 EUR", Date: time.Now()})
+	g.AddEmail(testkit.Email{From: "news@shop.example", Subject: "Weekly deals", Body: "Sale", Date: time.Now()})
+
+	provider := &staticProvider{reply: `{"kind": "bill", "payee": "EDP", "amount": 42.5, "currency": "eur", "due": "` + due.Format("2006-01-02") + `", "reference": "FT 123"}`}
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool := NewBillsTool(testkit.Token, provider, "test", t.TempDir(), BillsOptions{}, nil)
+	tool.SetScheduler(cs)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "scan"})
+	if r.IsError || !strings.Contains(r.ForLLM, "🧾 New bills:\n- EDP 42.50 EUR, due ") || provider.calls != 1 {
+		t.Fatalf("scan: %+v after %d model calls", r, provider.calls)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "schedule"}); r.IsError {
+		t.Fatalf("schedule: %+v", r)
+	}
+	jobs := cs.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != billsJobKind {
+		t.Fatalf("Expected one bills job, got %+v", jobs)
+	}
+
+	out, err := tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil || !strings.HasPrefix(out, "📅 Bills for ") || !strings.Contains(out, "⏰ Bills due soon:\n- EDP 42.50 EUR") {
+		t.Fatalf("Expected the month's bills and a reminder, got %q, %v", out, err)
+	}
+	if out, _ := tool.ExecuteJob(context.Background(), &jobs[0]); out != "" {
+		t.Errorf("Expected nothing sent twice, got %q", out)
+	}
+
+	g.AddEmail(testkit.Email{From: "faturas@edp.pt", Subject: "Payment received", Body: "Thank you", Date: time.Now()})
+	provider.reply = `{"kind": "paid", "payee": "EDP", "amount": 42.5, "reference": "FT 123"}`
+	if out, _ := tool.ExecuteJob(context.Background(), &jobs[0]); !strings.Contains(out, "✅ Paid:\n- EDP 42.50 EUR") {
+		t.Errorf("Expected the payment noted, got %q", out)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.HasPrefix(r.ForLLM, "No unpaid bills") {
+		t.Errorf("list: %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "summary", "month": due.Format("2006-01")})
+	if !strings.Contains(r.ForLLM, "EDP 42.50 EUR") || !strings.Contains(r.ForLLM, "Total 42.50 EUR, paid 42.50 EUR, to pay 0.00 EUR") {
+		t.Errorf("summary: %s", r.ForLLM)
+	}
+}
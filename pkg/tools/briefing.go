@@ -0,0 +1,512 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const briefingJobKind = "daily_briefing"
+
+// DefaultBriefingSections is the order sections appear in when the user does
+// not choose.
+var DefaultBriefingSections = []string{"calendar", "email", "weather", "reminders", "news"}
+
+// BriefingRequest describes the briefing being composed.
+type BriefingRequest struct {
+	Channel  string
+	ChatID   string
+	Now      time.Time
+	Location *time.Location
+	// Locale is the user's locale tag, for the locale package
+	Locale string
+	// Options holds per-briefing settings such as weather_location and news_topics
+	Options map[string]string
+}
+
+// BriefingSection contributes one block to the daily briefing. Render
+// returns "" when there is nothing to report.
+type BriefingSection interface {
+	Name() string
+	Title() string
+	Render(ctx context.Context, req BriefingRequest) (string, error)
+}
+
+// BriefingTool composes a morning message from registered sections and
+// schedules it once a day per chat.
+type BriefingTool struct {
+	profiles  *profile.Store
+	scheduler *cron.CronService
+	sections  map[string]BriefingSection
+	defaults  BriefingDefaults
+	mu        sync.RWMutex
+	channel   string
+	chatID    string
+	now       func() time.Time
+}
+
+// BriefingDefaults are used for options the user did not set.
+type BriefingDefaults struct {
+	Time            string
+	Sections        []string
+	WeatherLocation string
+	NewsTopics      []string
+}
+
+func NewBriefingTool(profiles *profile.Store, defaults BriefingDefaults) *BriefingTool {
+	if defaults.Time == "" {
+		defaults.Time = "07:30"
+	}
+	if len(defaults.Sections) == 0 {
+		defaults.Sections = DefaultBriefingSections
+	}
+	t := &BriefingTool{
+		profiles: profiles,
+		sections: make(map[string]BriefingSection),
+		defaults: defaults,
+		now:      time.Now,
+	}
+	t.RegisterSection(&remindersSection{tool: t})
+	t.RegisterSection(NewWeatherSection())
+	return t
+}
+
+// RegisterSection makes a section available to briefings. Tools backed by
+// accounts (calendar, email) register theirs when configured.
+func (t *BriefingTool) RegisterSection(section BriefingSection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sections[section.Name()] = section
+}
+
+func (t *BriefingTool) section(name string) (BriefingSection, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s, ok := t.sections[name]
+	return s, ok
+}
+
+func (t *BriefingTool) Name() string {
+	return "briefing"
+}
+
+func (t *BriefingTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "schedule", "remove")
+}
+
+// Untrusted reports that a preview carries email subjects, event titles
+// and headlines.
+func (t *BriefingTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "preview")
+}
+
+func (t *BriefingTool) Description() string {
+	return "Daily morning briefing: one message combining calendar, important unread email, weather, today's reminders and news. Schedule it at a time of day (user's timezone), choose sections, preview it now, or remove it."
+}
+
+func (t *BriefingTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"schedule", "preview", "status", "remove"},
+				"description": "Action to perform",
+			},
+			"time": map[string]interface{}{
+				"type":        "string",
+				"description": "Time of day as HH:MM in the user's timezone (schedule). Default " + t.defaults.Time,
+			},
+			"sections": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": DefaultBriefingSections},
+				"description": "Sections to include, in order",
+			},
+			"weather_location": map[string]interface{}{
+				"type":        "string",
+				"description": "City for the weather section, e.g. Lisbon",
+			},
+			"news_topics": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Topics for the news section",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *BriefingTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *BriefingTool) JobKinds() []string {
+	return []string{briefingJobKind}
+}
+
+func (t *BriefingTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *BriefingTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+
+	switch action {
+	case "preview":
+		existing := t.findJob(t.channel, t.chatID)
+		data := t.options(args, existing)
+		return SilentResult(t.compose(ctx, t.channel, t.chatID, data))
+
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("briefings are not available (scheduler not running)")
+		}
+		existing := t.findJob(t.channel, t.chatID)
+		data := t.options(args, existing)
+		clock, err := time.Parse("15:04", data["time"])
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid time %q (expected HH:MM)", data["time"]))
+		}
+		if existing != nil {
+			t.scheduler.RemoveJob(existing.ID)
+		}
+
+		var tz string
+		if t.profiles != nil {
+			tz = t.profiles.Get(t.channel + ":" + t.chatID).Timezone
+		}
+		expr := fmt.Sprintf("%d %d * * *", clock.Minute(), clock.Hour())
+		job, err := t.scheduler.AddJobWithPayload("Daily briefing", cron.CronSchedule{Kind: "cron", Expr: expr, TZ: tz},
+			cron.CronPayload{
+				Kind:    briefingJobKind,
+				Message: "Daily briefing",
+				Channel: t.channel,
+				To:      t.chatID,
+				Data:    data,
+			})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule briefing: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Daily briefing scheduled at %s%s (id: %s)\n%s",
+			data["time"], tzSuffix(tz), job.ID, t.describe(data)))
+
+	case "status":
+		job := t.findJob(t.channel, t.chatID)
+		if job == nil {
+			return SilentResult("No daily briefing scheduled for this chat")
+		}
+		return SilentResult(fmt.Sprintf("Daily briefing at %s%s (id: %s)\n%s",
+			job.Payload.Data["time"], tzSuffix(job.Schedule.TZ), job.ID, t.describe(job.Payload.Data)))
+
+	case "remove":
+		job := t.findJob(t.channel, t.chatID)
+		if job == nil {
+			return ErrorResult("no daily briefing scheduled for this chat")
+		}
+		t.scheduler.RemoveJob(job.ID)
+		return SilentResult("Daily briefing removed")
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func tzSuffix(tz string) string {
+	if tz == "" {
+		return ""
+	}
+	return " " + tz
+}
+
+// findJob returns the chat's briefing job; there is at most one per chat.
+func (t *BriefingTool) findJob(channel, chatID string) *cron.CronJob {
+	if t.scheduler == nil {
+		return nil
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == briefingJobKind && job.Payload.Channel == channel && job.Payload.To == chatID {
+			return &job
+		}
+	}
+	return nil
+}
+
+// options merges explicit arguments over the existing job's settings and
+// the configured defaults into job data.
+func (t *BriefingTool) options(args map[string]interface{}, existing *cron.CronJob) map[string]string {
+	data := map[string]string{
+		"time":             t.defaults.Time,
+		"sections":         strings.Join(t.defaults.Sections, "|"),
+		"weather_location": t.defaults.WeatherLocation,
+		"news_topics":      strings.Join(t.defaults.NewsTopics, "|"),
+	}
+	if existing != nil {
+		for k, v := range existing.Payload.Data {
+			data[k] = v
+		}
+	}
+	if v, ok := args["time"].(string); ok && v != "" {
+		data["time"] = strings.TrimSpace(v)
+	}
+	if v, ok := stringListArg(args, "sections"); ok {
+		data["sections"] = strings.Join(v, "|")
+	}
+	if v, ok := args["weather_location"].(string); ok {
+		data["weather_location"] = strings.TrimSpace(v)
+	}
+	if v, ok := stringListArg(args, "news_topics"); ok {
+		data["news_topics"] = strings.Join(v, "|")
+	}
+	return data
+}
+
+func (t *BriefingTool) describe(data map[string]string) string {
+	var available, missing []string
+	for _, name := range splitList(data["sections"]) {
+		if _, ok := t.section(name); ok {
+			available = append(available, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	desc := "Sections: " + strings.Join(available, ", ")
+	if len(missing) > 0 {
+		desc += "\nNot configured (skipped): " + strings.Join(missing, ", ")
+	}
+	return desc
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "|")
+}
+
+// compose renders every configured section. A failing section is reported
+// inline so the rest of the briefing still arrives.
+func (t *BriefingTool) compose(ctx context.Context, channel, chatID string, data map[string]string) string {
+	loc, tag := time.Local, LocaleFromContext(ctx)
+	if t.profiles != nil {
+		prof := t.profiles.Get(channel + ":" + chatID)
+		loc = prof.Location()
+		if prof.Locale != "" {
+			tag = prof.Locale
+		}
+		tag = locale.WithPreferences(tag, prof.Clock, prof.Units)
+	}
+	req := BriefingRequest{
+		Channel:  channel,
+		ChatID:   chatID,
+		Now:      t.now().In(loc),
+		Location: loc,
+		Locale:   tag,
+		Options:  data,
+	}
+
+	var sb strings.Builder
+	sb.WriteString(locale.T(tag, "briefing.greeting", locale.Day(req.Now, tag)) + "\n")
+	for _, name := range splitList(data["sections"]) {
+		section, ok := t.section(name)
+		if !ok {
+			continue
+		}
+		body, err := section.Render(ctx, req)
+		if err != nil {
+			body = locale.T(tag, "briefing.unavailable", err)
+		}
+		if body == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s\n%s\n", section.Title(), strings.TrimRight(body, "\n"))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// ExecuteJob implements ScheduledTool.
+func (t *BriefingTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.compose(ctx, job.Payload.Channel, job.Payload.To, job.Payload.Data), nil
+}
+
+// remindersSection lists the chat's scheduled jobs that fire before the end
+// of the day.
+type remindersSection struct {
+	tool *BriefingTool
+}
+
+func (s *remindersSection) Name() string  { return "reminders" }
+func (s *remindersSection) Title() string { return "⏰ Reminders today" }
+
+func (s *remindersSection) Render(ctx context.Context, req BriefingRequest) (string, error) {
+	if s.tool.scheduler == nil {
+		return "", nil
+	}
+	y, m, d := req.Now.Date()
+	endOfDay := time.Date(y, m, d+1, 0, 0, 0, 0, req.Location)
+
+	type due struct {
+		at   time.Time
+		name string
+	}
+	var items []due
+	for _, job := range s.tool.scheduler.ListJobs(false) {
+		if job.Payload.Kind == briefingJobKind || job.Payload.Channel != req.Channel || job.Payload.To != req.ChatID {
+			continue
+		}
+		if job.State.NextRunAtMS == nil {
+			continue
+		}
+		at := time.UnixMilli(*job.State.NextRunAtMS).In(req.Location)
+		if at.Before(endOfDay) {
+			items = append(items, due{at: at, name: job.Payload.Message})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].at.Before(items[j].at) })
+
+	var sb strings.Builder
+	for _, item := range items {
+		fmt.Fprintf(&sb, "- %s %s\n", item.at.Format("15:04"), item.name)
+	}
+	return sb.String(), nil
+}
+
+// WeatherSection reports today's weather from wttr.in (no API key needed).
+type WeatherSection struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewWeatherSection() *WeatherSection {
+	return &WeatherSection{
+		client:  &http.Client{Timeout: 15 * time.Second},
+		baseURL: "https://wttr.in",
+	}
+}
+
+func (s *WeatherSection) Name() string  { return "weather" }
+func (s *WeatherSection) Title() string { return "🌤 Weather" }
+
+// wttrTemperature formats a low and high wttr.in gives in Celsius in the
+// units of tag, as given when they are not numbers.
+func wttrTemperature(low, high, tag string) string {
+	l, err1 := strconv.ParseFloat(low, 64)
+	h, err2 := strconv.ParseFloat(high, 64)
+	if err1 != nil || err2 != nil {
+		if low == high {
+			return low + "°C"
+		}
+		return low + "–" + high + "°C"
+	}
+	return locale.TemperatureRange(l, h, tag)
+}
+
+func (s *WeatherSection) Render(ctx context.Context, req BriefingRequest) (string, error) {
+	location := req.Options["weather_location"]
+	if location == "" {
+		return "", nil
+	}
+
+	var resp struct {
+		CurrentCondition []struct {
+			TempC       string `json:"temp_C"`
+			FeelsLikeC  string `json:"FeelsLikeC"`
+			WeatherDesc []struct {
+				Value string `json:"value"`
+			} `json:"weatherDesc"`
+		} `json:"current_condition"`
+		Weather []struct {
+			MaxTempC string `json:"maxtempC"`
+			MinTempC string `json:"mintempC"`
+			Hourly   []struct {
+				ChanceOfRain string `json:"chanceofrain"`
+			} `json:"hourly"`
+		} `json:"weather"`
+	}
+	reqURL := fmt.Sprintf("%s/%s?format=j1", s.baseURL, url.PathEscape(location))
+	if err := getJSON(ctx, s.client, reqURL, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.CurrentCondition) == 0 {
+		return "", fmt.Errorf("no weather data for %s", location)
+	}
+
+	now := resp.CurrentCondition[0]
+	desc := ""
+	if len(now.WeatherDesc) > 0 {
+		desc = strings.TrimSpace(now.WeatherDesc[0].Value)
+	}
+	line := fmt.Sprintf("%s: %s, %s (feels like %s)", location, desc,
+		wttrTemperature(now.TempC, now.TempC, req.Locale), wttrTemperature(now.FeelsLikeC, now.FeelsLikeC, req.Locale))
+	if len(resp.Weather) > 0 {
+		today := resp.Weather[0]
+		line += "\nToday " + wttrTemperature(today.MinTempC, today.MaxTempC, req.Locale)
+		maxRain := 0
+		for _, h := range today.Hourly {
+			var chance int
+			fmt.Sscanf(h.ChanceOfRain, "%d", &chance)
+			if chance > maxRain {
+				maxRain = chance
+			}
+		}
+		if maxRain >= 30 {
+			line += fmt.Sprintf(", %d%% chance of rain", maxRain)
+		}
+	}
+	return line, nil
+}
+
+// NewsSection adds top headlines for the briefing's topics.
+type NewsSection struct {
+	news *NewsTool
+}
+
+func NewNewsSection(news *NewsTool) *NewsSection {
+	return &NewsSection{news: news}
+}
+
+func (s *NewsSection) Name() string  { return "news" }
+func (s *NewsSection) Title() string { return "📰 News" }
+
+func (s *NewsSection) Render(ctx context.Context, req BriefingRequest) (string, error) {
+	topics := splitList(req.Options["news_topics"])
+	if len(topics) == 0 {
+		topics = []string{""}
+	}
+	perTopic := 5 / len(topics)
+	if perTopic < 2 {
+		perTopic = 2
+	}
+
+	seen := make(map[string]bool)
+	var sb strings.Builder
+	for _, topic := range topics {
+		items, err := s.news.Headlines(ctx, topic, "", perTopic)
+		if err != nil {
+			return "", err
+		}
+		for _, h := range items {
+			if key := headlineKey(h.Title); !seen[key] {
+				seen[key] = true
+				fmt.Fprintf(&sb, "- %s\n", h.Title)
+			}
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+type staticSection struct {
+	name, body string
+}
+
+func (s staticSection) Name() string  { return s.name }
+func (s staticSection) Title() string { return "## " + s.name }
+func (s staticSection) Render(ctx context.Context, req BriefingRequest) (string, error) {
+	return s.body, nil
+}
+
+// TestBriefingTool_PreviewComposesSections verifies sections render in the chosen order and empty ones are skipped
+func TestBriefingTool_PreviewComposesSections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Lisbon" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"current_condition":[{"temp_C":"18","FeelsLikeC":"17","weatherDesc":[{"value":"Sunny"}]}],
+			"weather":[{"maxtempC":"22","mintempC":"14","hourly":[{"chanceofrain":"10"},{"chanceofrain":"60"}]}]}`))
+	}))
+	defer server.Close()
+
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool := NewBriefingTool(nil, BriefingDefaults{})
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "42")
+	weather := NewWeatherSection()
+	weather.baseURL = server.URL
+	tool.RegisterSection(weather)
+	tool.RegisterSection(staticSection{name: "calendar", body: "09:00 Standup"})
+	tool.RegisterSection(staticSection{name: "email", body: ""})
+
+	at := time.Now().Add(time.Minute).UnixMilli()
+	tool.now = func() time.Time { return time.UnixMilli(at) }
+	cs.AddJob("Call mom", cron.CronSchedule{Kind: "at", AtMS: &at}, "Call mom", true, "telegram", "42")
+	cs.AddJob("Other chat", cron.CronSchedule{Kind: "at", AtMS: &at}, "Other chat", true, "telegram", "7")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":           "preview",
+		"sections":         []interface{}{"weather", "email", "calendar", "reminders"},
+		"weather_location": "Lisbon",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	out := result.ForLLM
+	for _, want := range []string{"Sunny, 18°C", "60% chance of rain", "09:00 Standup", "Call mom"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in briefing:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "## email") || strings.Contains(out, "Other chat") {
+		t.Errorf("Unexpected content in briefing:\n%s", out)
+	}
+	if strings.Index(out, "Sunny") > strings.Index(out, "Standup") {
+		t.Errorf("Sections out of order:\n%s", out)
+	}
+}
+
+// TestBriefingTool_ScheduleReplacesExisting verifies one briefing per chat in the user's timezone
+func TestBriefingTool_ScheduleReplacesExisting(t *testing.T) {
+	profiles := profile.NewStore(t.TempDir())
+	profiles.Set("telegram:42", profile.Profile{Timezone: "Asia/Tokyo"})
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool := NewBriefingTool(profiles, BriefingDefaults{})
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "42")
+
+	tool.Execute(context.Background(), map[string]interface{}{"action": "schedule", "time": "07:00"})
+	result := tool.Execute(context.Background(), map[string]interface{}{"action": "schedule", "time": "06:45"})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Not configured (skipped): calendar, email") {
+		t.Errorf("Expected missing sections to be reported, got: %s", result.ForLLM)
+	}
+
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 {
+		t.Fatalf("Expected a single briefing job, got %d", len(jobs))
+	}
+	if jobs[0].Schedule.Expr != "45 6 * * *" || jobs[0].Schedule.TZ != "Asia/Tokyo" {
+		t.Errorf("Unexpected schedule: %+v", jobs[0].Schedule)
+	}
+}
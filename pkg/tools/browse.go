@@ -0,0 +1,390 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+)
+
+// browsePageSize is how many entries one listing shows.
+const browsePageSize = 20
+
+// browseEntry is a numbered line of a listing. Ref is the Drive file ID or
+// the path in the store.
+type browseEntry struct {
+	Ref      string
+	Name     string
+	Folder   bool
+	Size     int64
+	Modified time.Time
+	Link     string
+}
+
+// browseFolder is a folder on the way from the root to where the user is.
+type browseFolder struct {
+	Ref  string
+	Name string
+}
+
+// browseState is where one conversation is: the source, the folders
+// opened from its root, the current folder's entries and the page shown.
+type browseState struct {
+	Source  string
+	Trail   []browseFolder
+	Entries []browseEntry
+	Page    int
+}
+
+// BrowseTool lets the user walk Google Drive and storage folders with
+// short commands instead of file IDs: the current folder is listed with
+// numbers and "open 3", "up" or "download 2" refer to them. Each
+// conversation keeps its own place.
+type BrowseTool struct {
+	drive     *GoogleDriveClient
+	stores    map[string]storage.Store
+	workspace string
+
+	mu     sync.Mutex
+	states map[string]*browseState
+}
+
+// NewBrowseTool saves downloads in the workspace's downloads folder.
+func NewBrowseTool(workspace string) *BrowseTool {
+	return &BrowseTool{stores: map[string]storage.Store{}, workspace: workspace, states: map[string]*browseState{}}
+}
+
+func (t *BrowseTool) SetDrive(drive *GoogleDriveClient) { t.drive = drive }
+
+// AddStore makes store a source, switched to by its name.
+func (t *BrowseTool) AddStore(name string, store storage.Store) {
+	t.stores[strings.ToLower(name)] = store
+}
+
+// Sources lists the names of the sources set up, Drive first.
+func (t *BrowseTool) Sources() []string {
+	var names []string
+	if t.drive != nil {
+		names = append(names, "drive")
+	}
+	stores := make([]string, 0, len(t.stores))
+	for name := range t.stores {
+		stores = append(stores, name)
+	}
+	sort.Strings(stores)
+	return append(names, stores...)
+}
+
+func (t *BrowseTool) Name() string {
+	return "browse"
+}
+
+func (t *BrowseTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *BrowseTool) Description() string {
+	return "Browse folders with short commands, the way a file manager works, for when the user navigates rather than searches. " +
+		"Sources: " + strings.Join(t.Sources(), ", ") + ". " +
+		"Pass the user's command as it is: \"ls\" shows the current folder with numbered entries, \"open 3\" (or just \"3\") opens entry 3, \"up\" goes to the parent folder, " +
+		"\"download 2\" sends file 2 to the user, \"more\" and \"back\" page through long folders, \"home\" returns to the top and a source name switches to it. " +
+		"The place is kept per conversation. Show the listing to the user as it is."
+}
+
+func (t *BrowseTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "ls, open N, N, up, download N, more, back, home, or a source name: " + strings.Join(t.Sources(), ", "),
+			},
+		},
+		"required": []string{"command"},
+	}
+}
+
+func (t *BrowseTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	command, _ := args["command"].(string)
+	fields := strings.Fields(strings.ToLower(command))
+	verb, arg := "ls", ""
+	if len(fields) > 0 {
+		verb = fields[0]
+	}
+	if len(fields) > 1 {
+		arg = fields[1]
+	}
+	if _, err := strconv.Atoi(verb); err == nil {
+		verb, arg = "open", verb
+	}
+
+	channel, chatID := ChatFromContext(ctx)
+	key := channel + ":" + chatID
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.states[key]
+
+	if t.hasSource(verb) {
+		state = &browseState{Source: verb}
+		t.states[key] = state
+		return t.show(ctx, state, true)
+	}
+	if state == nil {
+		sources := t.Sources()
+		if len(sources) == 0 {
+			return ErrorResult("no folders are set up to browse")
+		}
+		state = &browseState{Source: sources[0]}
+		t.states[key] = state
+		if verb == "ls" || verb == "home" {
+			return t.show(ctx, state, true)
+		}
+		// Numbers only mean something once a folder has been listed
+		if result := t.show(ctx, state, true); result.IsError {
+			return result
+		}
+		return ErrorResult("Nothing was listed in this conversation yet, so there is nothing to " + verb + ". The top folder is listed now:\n\n" + t.listing(state))
+	}
+
+	switch verb {
+	case "ls", "list", "dir":
+		return t.show(ctx, state, true)
+	case "home", "top":
+		state.Trail = nil
+		return t.show(ctx, state, true)
+	case "up", "..", "cd..":
+		if len(state.Trail) == 0 {
+			return ErrorResult("Already at the top of " + state.Source + ".")
+		}
+		state.Trail = state.Trail[:len(state.Trail)-1]
+		return t.show(ctx, state, true)
+	case "more", "next":
+		if (state.Page+1)*browsePageSize >= len(state.Entries) {
+			return ErrorResult("That was the last page.")
+		}
+		state.Page++
+		return t.show(ctx, state, false)
+	case "back", "prev", "previous":
+		if state.Page == 0 {
+			return ErrorResult("This is the first page.")
+		}
+		state.Page--
+		return t.show(ctx, state, false)
+	case "open", "cd", "o":
+		entry, result := pickBrowseEntry(state, arg)
+		if result != nil {
+			return result
+		}
+		if !entry.Folder {
+			return SilentResult(describeBrowseEntry(entry, arg))
+		}
+		state.Trail = append(state.Trail, browseFolder{Ref: entry.Ref, Name: entry.Name})
+		return t.show(ctx, state, true)
+	case "download", "get", "send", "d":
+		entry, result := pickBrowseEntry(state, arg)
+		if result != nil {
+			return result
+		}
+		if entry.Folder {
+			return ErrorResult(fmt.Sprintf("%s is a folder; open %s to see inside it.", entry.Name, arg))
+		}
+		return t.download(ctx, state, entry)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown command %q; use ls, open N, up, download N, more, back, home or one of: %s", command, strings.Join(t.Sources(), ", ")))
+	}
+}
+
+func (t *BrowseTool) hasSource(name string) bool {
+	if name == "drive" {
+		return t.drive != nil
+	}
+	_, ok := t.stores[name]
+	return ok
+}
+
+// show lists the current folder, reading it again when reload is set.
+func (t *BrowseTool) show(ctx context.Context, state *browseState, reload bool) *ToolResult {
+	if reload {
+		entries, err := t.list(ctx, state)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list %s: %v", t.where(state), err)).WithError(err)
+		}
+		state.Entries, state.Page = entries, 0
+	}
+	return SilentResult(t.listing(state))
+}
+
+// list reads the current folder, folders first and then files, each by
+// name.
+func (t *BrowseTool) list(ctx context.Context, state *browseState) ([]browseEntry, error) {
+	dir := ""
+	if len(state.Trail) > 0 {
+		dir = state.Trail[len(state.Trail)-1].Ref
+	}
+	var entries []browseEntry
+	if state.Source == "drive" {
+		files, err := t.drive.ListFolder(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			entries = append(entries, browseEntry{
+				Ref:      f.ID,
+				Name:     f.Name,
+				Folder:   f.MimeType == "application/vnd.google-apps.folder",
+				Size:     f.Size,
+				Modified: f.ModifiedTime,
+				Link:     f.WebViewLink,
+			})
+		}
+	} else {
+		files, err := t.stores[state.Source].List(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			entries = append(entries, browseEntry{Ref: f.Path, Name: f.Name(), Folder: f.Dir, Size: f.Size, Modified: f.Modified})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Folder != entries[j].Folder {
+			return entries[i].Folder
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries, nil
+}
+
+// where names the current folder, e.g. "drive › Reports › 2024".
+func (t *BrowseTool) where(state *browseState) string {
+	parts := []string{state.Source}
+	for _, f := range state.Trail {
+		parts = append(parts, f.Name)
+	}
+	return strings.Join(parts, " › ")
+}
+
+// listing renders the current page of state's folder.
+func (t *BrowseTool) listing(state *browseState) string {
+	var sb strings.Builder
+	sb.WriteString("📂 " + t.where(state))
+	pages := (len(state.Entries) + browsePageSize - 1) / browsePageSize
+	if pages > 1 {
+		fmt.Fprintf(&sb, " (page %d/%d)", state.Page+1, pages)
+	}
+	if len(state.Entries) == 0 {
+		sb.WriteString("\n(empty folder)")
+	}
+	first := state.Page * browsePageSize
+	for i := first; i < len(state.Entries) && i < first+browsePageSize; i++ {
+		e := state.Entries[i]
+		if e.Folder {
+			fmt.Fprintf(&sb, "\n%d. 📁 %s", i+1, e.Name)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, e.Name)
+		if e.Size > 0 {
+			fmt.Fprintf(&sb, ", %s", formatFileSize(e.Size))
+		}
+		if !e.Modified.IsZero() {
+			fmt.Fprintf(&sb, ", %s", e.Modified.In(time.Local).Format("2 Jan 2006"))
+		}
+	}
+	commands := []string{"open N", "download N"}
+	if len(state.Trail) > 0 {
+		commands = append(commands, "up")
+	}
+	if state.Page+1 < pages {
+		commands = append(commands, "more")
+	}
+	if state.Page > 0 {
+		commands = append(commands, "back")
+	}
+	sb.WriteString("\n\n" + strings.Join(commands, " · "))
+	return sb.String()
+}
+
+// pickBrowseEntry finds entry number arg of the current folder.
+func pickBrowseEntry(state *browseState, arg string) (browseEntry, *ToolResult) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return browseEntry{}, ErrorResult("give the number of the entry, e.g. open 3")
+	}
+	if n < 1 || n > len(state.Entries) {
+		return browseEntry{}, ErrorResult(fmt.Sprintf("there is no entry %d here; the folder has %d", n, len(state.Entries)))
+	}
+	return state.Entries[n-1], nil
+}
+
+func describeBrowseEntry(e browseEntry, n string) string {
+	var sb strings.Builder
+	sb.WriteString(e.Name)
+	if e.Size > 0 {
+		fmt.Fprintf(&sb, ", %s", formatFileSize(e.Size))
+	}
+	if !e.Modified.IsZero() {
+		fmt.Fprintf(&sb, ", modified %s", e.Modified.In(time.Local).Format("2 Jan 2006 15:04"))
+	}
+	if e.Link != "" {
+		fmt.Fprintf(&sb, "\n%s [drive_file_id=%s]", e.Link, e.Ref)
+	}
+	fmt.Fprintf(&sb, "\n\nIt is a file: download %s sends it.", n)
+	return sb.String()
+}
+
+// download saves a file to the workspace's downloads folder and sends it
+// to the user.
+func (t *BrowseTool) download(ctx context.Context, state *browseState, e browseEntry) *ToolResult {
+	name := e.Name
+	var body io.ReadCloser
+	var err error
+	if state.Source == "drive" {
+		var file *DriveFile
+		file, body, err = t.drive.Open(ctx, e.Ref)
+		if err == nil {
+			// Docs are exported, with the extension of their format
+			name = file.Name
+		}
+	} else {
+		body, err = t.stores[state.Source].Open(ctx, e.Ref)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrorResult(fmt.Sprintf("%s is gone; ls to list the folder again", e.Name))
+		}
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("download failed: %v", err)).WithError(err)
+	}
+	defer body.Close()
+
+	dir := filepath.Join(t.workspace, "downloads")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to create downloads folder: %v", err))
+	}
+	target := freeFileName(dir, path.Base(name))
+	out, err := os.Create(target)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save %s: %v", name, err))
+	}
+	n, err := io.Copy(out, io.LimitReader(body, maxStorageDownload+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxStorageDownload {
+		err = fmt.Errorf("file is larger than %s", formatFileSize(maxStorageDownload))
+	}
+	if err != nil {
+		os.Remove(target)
+		return ErrorResult(fmt.Sprintf("download failed: %v", err)).WithError(err)
+	}
+	return &ToolResult{ForLLM: fmt.Sprintf("Sent %s (%s) to the user.", name, formatFileSize(n)), Media: []string{target}}
+}
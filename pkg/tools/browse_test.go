@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestBrowseTool_NavigatesDriveByNumber verifies folders open and close by their listed number, files are sent on download, and each chat keeps its own place
+func TestBrowseTool_NavigatesDriveByNumber(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	reports := g.AddFolder("", "Reports")
+	g.AddFile(testkit.File{Name: "budget.csv", MimeType: "text/csv", Parent: reports, Content: []byte("rent,900")})
+	g.AddFile(testkit.File{Name: "avatar.png", MimeType: "image/png", Content: []byte("png")})
+
+	workspace := t.TempDir()
+	tool := NewBrowseTool(workspace)
+	tool.SetDrive(NewGoogleDriveClient(testkit.Token))
+	alice := WithChat(context.Background(), "telegram", "1")
+	bob := WithChat(context.Background(), "telegram", "2")
+
+	res := tool.Execute(alice, map[string]interface{}{"command": "ls"})
+	if res.IsError || !strings.Contains(res.ForLLM, "📂 drive\n1. 📁 Reports\n2. avatar.png") {
+		t.Fatalf("Expected My Drive listed folders first, got %q", res.ForLLM)
+	}
+	res = tool.Execute(alice, map[string]interface{}{"command": "open 1"})
+	if res.IsError || !strings.Contains(res.ForLLM, "drive › Reports\n1. budget.csv") || !strings.Contains(res.ForLLM, "up") {
+		t.Fatalf("Expected the Reports folder, got %q", res.ForLLM)
+	}
+	if res := tool.Execute(bob, map[string]interface{}{"command": "ls"}); strings.Contains(res.ForLLM, "drive › Reports") {
+		t.Errorf("Expected another chat to start at the top, got %q", res.ForLLM)
+	}
+
+	res = tool.Execute(alice, map[string]interface{}{"command": "download 1"})
+	if res.IsError || len(res.Media) != 1 {
+		t.Fatalf("Expected budget.csv sent, got %+v", res)
+	}
+	if data, _ := os.ReadFile(res.Media[0]); string(data) != "rent,900" || filepath.Dir(res.Media[0]) != filepath.Join(workspace, "downloads") {
+		t.Errorf("Expected the file saved in downloads, got %s: %q", res.Media[0], data)
+	}
+	if res := tool.Execute(alice, map[string]interface{}{"command": "open 5"}); !res.IsError {
+		t.Errorf("Expected an error for an entry that is not listed, got %q", res.ForLLM)
+	}
+
+	res = tool.Execute(alice, map[string]interface{}{"command": "up"})
+	if res.IsError || !strings.Contains(res.ForLLM, "📂 drive\n") {
+		t.Errorf("Expected My Drive again, got %q", res.ForLLM)
+	}
+	if res := tool.Execute(alice, map[string]interface{}{"command": "up"}); !res.IsError {
+		t.Errorf("Expected no way up from the top, got %q", res.ForLLM)
+	}
+}
+
+// TestBrowseTool_PagesStoreFolders verifies a storage source is switched to by name and long folders are paged
+func TestBrowseTool_PagesStoreFolders(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < browsePageSize+5; i++ {
+		os.WriteFile(filepath.Join(root, "scan"+string(rune('a'+i))+".pdf"), []byte("pdf"), 0644)
+	}
+	tool := NewBrowseTool(t.TempDir())
+	tool.AddStore("files", storage.NewLocal(root))
+	ctx := WithChat(context.Background(), "telegram", "1")
+
+	res := tool.Execute(ctx, map[string]interface{}{"command": "files"})
+	if res.IsError || !strings.Contains(res.ForLLM, "(page 1/2)") || !strings.Contains(res.ForLLM, "more") {
+		t.Fatalf("Expected the first of two pages, got %q", res.ForLLM)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"command": "more"})
+	if res.IsError || !strings.Contains(res.ForLLM, "(page 2/2)") || !strings.Contains(res.ForLLM, "\n25. scany.pdf") {
+		t.Fatalf("Expected the second page numbered on, got %q", res.ForLLM)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"command": "3"})
+	if res.IsError || !strings.Contains(res.ForLLM, "scanc.pdf") || !strings.Contains(res.ForLLM, "download 3") {
+		t.Errorf("Expected a bare number to open the entry, got %q", res.ForLLM)
+	}
+}
@@ -0,0 +1,538 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxExpressionLength = 2000
+	maxExpressionDepth  = 64
+)
+
+// CalculatorTool evaluates arithmetic expressions and date math exactly so
+// the model doesn't have to do arithmetic itself. Evaluation is a pure
+// in-process parser: no code execution, bounded input size and nesting.
+type CalculatorTool struct {
+	now func() time.Time
+}
+
+func NewCalculatorTool() *CalculatorTool {
+	return &CalculatorTool{now: time.Now}
+}
+
+func (t *CalculatorTool) Name() string {
+	return "calculate"
+}
+
+func (t *CalculatorTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *CalculatorTool) Description() string {
+	return "Evaluate math expressions exactly (+ - * / % ^, parentheses, sqrt, abs, round, floor, ceil, log, ln, exp, sin, cos, tan, min, max, sum, avg, median, pi, e) and do date math (days between dates, add days/months/years to a date). Always use this instead of mental arithmetic."
+}
+
+func (t *CalculatorTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"eval", "date_diff", "date_add"},
+				"description": "eval: math expression; date_diff: time between start and end; date_add: shift date by an amount",
+			},
+			"expression": map[string]interface{}{
+				"type":        "string",
+				"description": "Math expression (eval), e.g. '(1200 * 0.15) + sqrt(16)' or 'avg(3, 5, 10)'",
+			},
+			"start": map[string]interface{}{
+				"type":        "string",
+				"description": "Start date (date_diff), YYYY-MM-DD, RFC3339 or 'today'",
+			},
+			"end": map[string]interface{}{
+				"type":        "string",
+				"description": "End date (date_diff), YYYY-MM-DD, RFC3339 or 'today'",
+			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "Base date (date_add), YYYY-MM-DD, RFC3339 or 'today'",
+			},
+			"years": map[string]interface{}{
+				"type":        "integer",
+				"description": "Years to add, may be negative (date_add)",
+			},
+			"months": map[string]interface{}{
+				"type":        "integer",
+				"description": "Months to add, may be negative (date_add)",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "Days to add, may be negative (date_add)",
+			},
+			"hours": map[string]interface{}{
+				"type":        "integer",
+				"description": "Hours to add, may be negative (date_add)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *CalculatorTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	switch action {
+	case "eval":
+		expr, _ := args["expression"].(string)
+		if strings.TrimSpace(expr) == "" {
+			return ErrorResult("expression is required for eval")
+		}
+		value, err := EvalExpression(expr)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("evaluation failed: %v", err))
+		}
+		return SilentResult(fmt.Sprintf("%s = %s", expr, formatNumber(value)))
+	case "date_diff":
+		return t.dateDiff(args)
+	case "date_add":
+		return t.dateAdd(args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *CalculatorTool) parseDate(s string) (time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "", "today":
+		now := t.now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), false, nil
+	case "now":
+		return t.now(), true, nil
+	}
+	if d, err := time.ParseInLocation("2006-01-02", s, t.now().Location()); err == nil {
+		return d, false, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if d, err := time.ParseInLocation(layout, s, t.now().Location()); err == nil {
+			return d, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("unrecognized date %q (use YYYY-MM-DD or RFC3339)", s)
+}
+
+func (t *CalculatorTool) dateDiff(args map[string]interface{}) *ToolResult {
+	startStr, _ := args["start"].(string)
+	endStr, _ := args["end"].(string)
+	start, startHasTime, err := t.parseDate(startStr)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	end, endHasTime, err := t.parseDate(endStr)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	if startHasTime || endHasTime {
+		d := end.Sub(start)
+		return SilentResult(fmt.Sprintf("%s → %s: %s (%.2f hours)",
+			start.Format(time.RFC3339), end.Format(time.RFC3339), d.Round(time.Minute), d.Hours()))
+	}
+
+	// Count calendar days in UTC so DST shifts don't produce 23h "days".
+	su := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	eu := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(eu.Sub(su).Hours() / 24)
+	weeks, rem := days/7, days%7
+	return SilentResult(fmt.Sprintf("%s (%s) → %s (%s): %d days (%d weeks %d days)",
+		start.Format("2006-01-02"), start.Weekday(), end.Format("2006-01-02"), end.Weekday(), days, weeks, rem))
+}
+
+func (t *CalculatorTool) dateAdd(args map[string]interface{}) *ToolResult {
+	dateStr, _ := args["date"].(string)
+	base, hasTime, err := t.parseDate(dateStr)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	intArg := func(key string) int {
+		if v, ok := args[key].(float64); ok {
+			return int(v)
+		}
+		return 0
+	}
+	hours := intArg("hours")
+	result := base.AddDate(intArg("years"), intArg("months"), intArg("days")).Add(time.Duration(hours) * time.Hour)
+
+	if hasTime || hours != 0 {
+		return SilentResult(fmt.Sprintf("%s (%s)", result.Format(time.RFC3339), result.Weekday()))
+	}
+	return SilentResult(fmt.Sprintf("%s (%s)", result.Format("2006-01-02"), result.Weekday()))
+}
+
+func formatNumber(v float64) string {
+	if math.Abs(v) >= 1e15 || (v != 0 && math.Abs(v) < 1e-9) {
+		return strconv.FormatFloat(v, 'g', 15, 64)
+	}
+	// Round to 12 significant digits to hide float noise such as
+	// 0.1+0.2 = 0.30000000000000004.
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// EvalExpression evaluates an arithmetic expression. It supports + - * / %
+// ^ (right associative), unary minus, parentheses, the constants pi and e,
+// and a fixed set of math and aggregate functions.
+func EvalExpression(expr string) (float64, error) {
+	if len(expr) > maxExpressionLength {
+		return 0, fmt.Errorf("expression too long (max %d characters)", maxExpressionLength)
+	}
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return 0, err
+	}
+	p := &exprParser{tokens: tokens}
+	v, err := p.parseExpr(0)
+	if err != nil {
+		return 0, err
+	}
+	if p.pos < len(p.tokens) {
+		return 0, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return v, nil
+}
+
+type exprTokenKind int
+
+const (
+	tokNumber exprTokenKind = iota
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value float64
+}
+
+func tokenizeExpression(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == '_') {
+				j++
+			}
+			// exponent: 1e6, 2.5E-3
+			if j < len(runes) && (runes[j] == 'e' || runes[j] == 'E') {
+				k := j + 1
+				if k < len(runes) && (runes[k] == '+' || runes[k] == '-') {
+					k++
+				}
+				if k < len(runes) && unicode.IsDigit(runes[k]) {
+					for k < len(runes) && unicode.IsDigit(runes[k]) {
+						k++
+					}
+					j = k
+				}
+			}
+			text := string(runes[i:j])
+			v, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", text)
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: text, value: v})
+			i = j
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: strings.ToLower(string(runes[i:j]))})
+			i = j
+		case strings.ContainsRune("+-*/%^(),", r):
+			tokens = append(tokens, exprToken{kind: tokOp, text: string(r)})
+			i++
+		case r == '×':
+			tokens = append(tokens, exprToken{kind: tokOp, text: "*"})
+			i++
+		case r == '÷':
+			tokens = append(tokens, exprToken{kind: tokOp, text: "/"})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peekOp() string {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokOp {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+func (p *exprParser) expect(op string) error {
+	if p.peekOp() != op {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q, got %q", op, p.tokens[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
+
+// parseExpr: term (('+'|'-') term)*
+func (p *exprParser) parseExpr(depth int) (float64, error) {
+	if depth > maxExpressionDepth {
+		return 0, fmt.Errorf("expression nested too deeply")
+	}
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peekOp()
+		if op != "+" && op != "-" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm(depth)
+		if err != nil {
+			return 0, err
+		}
+		if op == "+" {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+// parseTerm: unary (('*'|'/'|'%') unary)*
+func (p *exprParser) parseTerm(depth int) (float64, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peekOp()
+		if op != "*" && op != "/" && op != "%" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "*":
+			left *= right
+		case "/":
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left /= right
+		case "%":
+			if right == 0 {
+				return 0, fmt.Errorf("modulo by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+// parseUnary: ('-'|'+') unary | power
+func (p *exprParser) parseUnary(depth int) (float64, error) {
+	if depth > maxExpressionDepth {
+		return 0, fmt.Errorf("expression nested too deeply")
+	}
+	switch p.peekOp() {
+	case "-":
+		p.pos++
+		v, err := p.parseUnary(depth + 1)
+		return -v, err
+	case "+":
+		p.pos++
+		return p.parseUnary(depth + 1)
+	}
+	return p.parsePower(depth)
+}
+
+// parsePower: primary ('^' unary)?  — right associative, so 2^3^2 = 2^9
+// and -2^2 = -4.
+func (p *exprParser) parsePower(depth int) (float64, error) {
+	base, err := p.parsePrimary(depth)
+	if err != nil {
+		return 0, err
+	}
+	if p.peekOp() != "^" {
+		return base, nil
+	}
+	p.pos++
+	exp, err := p.parseUnary(depth + 1)
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exp), nil
+}
+
+func (p *exprParser) parsePrimary(depth int) (float64, error) {
+	if p.pos >= len(p.tokens) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch tok.kind {
+	case tokNumber:
+		return tok.value, nil
+	case tokIdent:
+		if p.peekOp() == "(" {
+			p.pos++
+			var args []float64
+			if p.peekOp() != ")" {
+				for {
+					v, err := p.parseExpr(depth + 1)
+					if err != nil {
+						return 0, err
+					}
+					args = append(args, v)
+					if p.peekOp() != "," {
+						break
+					}
+					p.pos++
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return 0, err
+			}
+			return callExprFunc(tok.text, args)
+		}
+		switch tok.text {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+		return 0, fmt.Errorf("unknown identifier %q", tok.text)
+	default:
+		if tok.text == "(" {
+			v, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return 0, err
+			}
+			return v, p.expect(")")
+		}
+		return 0, fmt.Errorf("unexpected %q", tok.text)
+	}
+}
+
+var unaryExprFuncs = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log2":  math.Log2,
+	"exp":   math.Exp,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+}
+
+func callExprFunc(name string, args []float64) (float64, error) {
+	if fn, ok := unaryExprFuncs[name]; ok {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s takes exactly one argument", name)
+		}
+		return fn(args[0]), nil
+	}
+
+	switch name {
+	case "round":
+		// round(x) or round(x, decimals)
+		if len(args) == 1 {
+			return math.Round(args[0]), nil
+		}
+		if len(args) == 2 {
+			scale := math.Pow(10, math.Trunc(args[1]))
+			return math.Round(args[0]*scale) / scale, nil
+		}
+		return 0, fmt.Errorf("round takes one or two arguments")
+	case "pow":
+		if len(args) != 2 {
+			return 0, fmt.Errorf("pow takes two arguments")
+		}
+		return math.Pow(args[0], args[1]), nil
+	}
+
+	if len(args) == 0 {
+		return 0, fmt.Errorf("unknown function %q or missing arguments", name)
+	}
+	switch name {
+	case "min":
+		v := args[0]
+		for _, a := range args[1:] {
+			v = math.Min(v, a)
+		}
+		return v, nil
+	case "max":
+		v := args[0]
+		for _, a := range args[1:] {
+			v = math.Max(v, a)
+		}
+		return v, nil
+	case "sum":
+		var s float64
+		for _, a := range args {
+			s += a
+		}
+		return s, nil
+	case "avg", "mean":
+		var s float64
+		for _, a := range args {
+			s += a
+		}
+		return s / float64(len(args)), nil
+	case "median":
+		sorted := append([]float64(nil), args...)
+		sort.Float64s(sorted)
+		mid := len(sorted) / 2
+		if len(sorted)%2 == 0 {
+			return (sorted[mid-1] + sorted[mid]) / 2, nil
+		}
+		return sorted[mid], nil
+	}
+	return 0, fmt.Errorf("unknown function %q", name)
+}
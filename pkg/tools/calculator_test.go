@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"2 ^ 3 ^ 2", "512"},
+		{"-2 ^ 2", "-4"},
+		{"10 % 4", "2"},
+		{"0.1 + 0.2", "0.3"},
+		{"1_000 * 1.5e3", "1500000"},
+		{"sqrt(16) + abs(-3)", "7"},
+		{"round(2.34567, 2)", "2.35"},
+		{"avg(3, 5, 10)", "6"},
+		{"median(5, 1, 3, 2)", "2.5"},
+		{"max(1, 7, 3) - min(4, 2)", "5"},
+		{"1200 × 15 ÷ 100", "180"},
+	}
+
+	for _, tt := range tests {
+		v, err := EvalExpression(tt.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.expr, err)
+			continue
+		}
+		if got := formatNumber(v); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalExpression_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"1 / 0",
+		"2 +",
+		"(1 + 2",
+		"foo(1)",
+		"os.exit(1)",
+		strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100),
+	} {
+		if _, err := EvalExpression(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+// TestCalculatorTool_DateMath verifies day counting and date shifting
+func TestCalculatorTool_DateMath(t *testing.T) {
+	tool := NewCalculatorTool()
+	tool.now = func() time.Time { return time.Date(2026, 1, 31, 15, 0, 0, 0, time.UTC) }
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "date_diff",
+		"start":  "today",
+		"end":    "2026-03-01",
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "29 days") {
+		t.Errorf("Expected 29 days, got: %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"action": "date_add",
+		"date":   "2026-01-31",
+		"days":   float64(45),
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "2026-03-17 (Tuesday)") {
+		t.Errorf("Expected 2026-03-17 (Tuesday), got: %s", result.ForLLM)
+	}
+}
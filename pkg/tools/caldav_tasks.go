@@ -0,0 +1,301 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/ics"
+)
+
+// CalDAVTasksSync keeps each named list as a CalDAV task list (a calendar
+// collection of VTODOs) with the same display name, so lists show up in
+// Apple Reminders, Nextcloud Tasks, Thunderbird and the like. List IDs are
+// collection paths and item IDs are task paths, both on the server.
+type CalDAVTasksSync struct {
+	homeURL  string
+	username string
+	password string
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewCalDAVTasksSync uses the calendar home at homeURL, e.g.
+// https://cloud.example.com/remote.php/dav/calendars/ana/, where new task
+// lists are created.
+func NewCalDAVTasksSync(homeURL, username, password string) *CalDAVTasksSync {
+	return &CalDAVTasksSync{
+		homeURL:  strings.TrimRight(homeURL, "/") + "/",
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 20 * time.Second},
+		now:      time.Now,
+	}
+}
+
+// resolve turns a path from the server into a URL.
+func (s *CalDAVTasksSync) resolve(href string) (string, error) {
+	base, err := url.Parse(s.homeURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (s *CalDAVTasksSync) request(ctx context.Context, method, href string, body []byte, headers map[string]string) (*http.Response, error) {
+	target, err := s.resolve(href)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// caldavExpect checks the status of resp, closing it, and returns a CalDAV
+// error for any other.
+func caldavExpect(resp *http.Response, ok ...int) error {
+	defer resp.Body.Close()
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return fmt.Errorf("CalDAV error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+type calDAVMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				DisplayName  string `xml:"displayname"`
+				ResourceType struct {
+					Calendar *struct{} `xml:"calendar"`
+				} `xml:"resourcetype"`
+				Components *struct {
+					Comps []struct {
+						Name string `xml:"name,attr"`
+					} `xml:"comp"`
+				} `xml:"supported-calendar-component-set"`
+				ETag         string `xml:"getetag"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (s *CalDAVTasksSync) multistatus(ctx context.Context, method, href, body string) (*calDAVMultistatus, error) {
+	resp, err := s.request(ctx, method, href, []byte(body), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "1",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("CalDAV error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var ms calDAVMultistatus
+	if err := xml.Unmarshal(data, &ms); err != nil {
+		return nil, fmt.Errorf("failed to parse CalDAV response: %w", err)
+	}
+	return &ms, nil
+}
+
+func (s *CalDAVTasksSync) EnsureList(ctx context.Context, title string) (string, error) {
+	ms, err := s.multistatus(ctx, "PROPFIND", s.homeURL, `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:resourcetype/><d:displayname/><c:supported-calendar-component-set/></d:prop>
+</d:propfind>`)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			p := ps.Prop
+			if p.ResourceType.Calendar == nil || !strings.EqualFold(strings.TrimSpace(p.DisplayName), title) {
+				continue
+			}
+			// Servers that leave out the component set accept everything
+			tasks := p.Components == nil
+			if p.Components != nil {
+				for _, c := range p.Components.Comps {
+					tasks = tasks || strings.EqualFold(c.Name, "VTODO")
+				}
+			}
+			if tasks {
+				return r.Href, nil
+			}
+		}
+	}
+
+	var name bytes.Buffer
+	xml.EscapeText(&name, []byte(title))
+	href := s.homeURL + calendarSlug(title) + "-" + newContactID()[:6] + "/"
+	resp, err := s.request(ctx, "MKCALENDAR", href, []byte(`<?xml version="1.0" encoding="utf-8"?>
+<c:mkcalendar xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:set><d:prop>
+    <d:displayname>`+name.String()+`</d:displayname>
+    <c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>
+  </d:prop></d:set>
+</c:mkcalendar>`), map[string]string{"Content-Type": "application/xml; charset=utf-8"})
+	if err != nil {
+		return "", err
+	}
+	if err := caldavExpect(resp, http.StatusCreated); err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(href)
+	return u.Path, nil
+}
+
+// calendarSlug makes a collection name from a list title: "Packing list"
+// becomes "packing-list".
+func calendarSlug(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(sb.String(), "-")
+	if slug == "" {
+		return "list"
+	}
+	return slug
+}
+
+func (s *CalDAVTasksSync) Items(ctx context.Context, listID string) ([]ListItem, error) {
+	ms, err := s.multistatus(ctx, "REPORT", listID, `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter>
+</c:calendar-query>`)
+	if err != nil {
+		return nil, err
+	}
+	var items []ListItem
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.Prop.CalendarData == "" {
+				continue
+			}
+			todos, err := ics.ParseTodos(ps.Prop.CalendarData, time.Local)
+			if err != nil || len(todos) == 0 {
+				continue
+			}
+			todo := todos[0]
+			if strings.TrimSpace(todo.Summary) == "" || todo.Status == "CANCELLED" {
+				continue
+			}
+			items = append(items, ListItem{
+				Text:     todo.Summary,
+				Checked:  todo.Done(),
+				AddedAt:  todo.Created,
+				RemoteID: r.Href,
+			})
+		}
+	}
+	return items, nil
+}
+
+func (s *CalDAVTasksSync) AddItem(ctx context.Context, listID, text string) (string, error) {
+	uid := newContactID()
+	collection, err := s.resolve(listID)
+	if err != nil {
+		return "", err
+	}
+	href := strings.TrimRight(collection, "/") + "/" + uid + ".ics"
+	resp, err := s.request(ctx, http.MethodPut, href, []byte(ics.FormatTodo(ics.Todo{UID: uid, Summary: text}, s.now())), map[string]string{
+		"Content-Type":  "text/calendar; charset=utf-8",
+		"If-None-Match": "*",
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := caldavExpect(resp, http.StatusCreated, http.StatusNoContent, http.StatusOK); err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(href)
+	return u.Path, nil
+}
+
+// SetChecked rewrites only the status of the task, so alarms, due dates
+// and notes added in other apps survive. The If-Match keeps a concurrent
+// edit from being overwritten.
+func (s *CalDAVTasksSync) SetChecked(ctx context.Context, listID, itemID string, checked bool) error {
+	resp, err := s.request(ctx, http.MethodGet, itemID, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return caldavExpect(resp, http.StatusOK)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read task: %w", err)
+	}
+	headers := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		headers["If-Match"] = etag
+	}
+	resp, err = s.request(ctx, http.MethodPut, itemID, []byte(ics.SetTodoDone(string(data), checked, s.now())), headers)
+	if err != nil {
+		return err
+	}
+	return caldavExpect(resp, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+}
+
+func (s *CalDAVTasksSync) RemoveItem(ctx context.Context, listID, itemID string) error {
+	resp, err := s.request(ctx, http.MethodDelete, itemID, nil, nil)
+	if err != nil {
+		return err
+	}
+	// Someone else deleting it first is fine
+	return caldavExpect(resp, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+func (s *CalDAVTasksSync) DeleteList(ctx context.Context, listID string) error {
+	resp, err := s.request(ctx, http.MethodDelete, listID, nil, nil)
+	if err != nil {
+		return err
+	}
+	return caldavExpect(resp, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
@@ -0,0 +1,519 @@
+package tools
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	// maxImportEvents bounds one import
+	maxImportEvents = 500
+	// maxImportPreview is how many events a preview lists one by one
+	maxImportPreview = 40
+	// importTTL is how long a preview can be confirmed
+	importTTL = 24 * time.Hour
+	// defaultImportMinutes is the length of events without an end or
+	// duration
+	defaultImportMinutes = 60
+)
+
+// importColumns maps the header names a schedule may use to the fields
+// they fill. Names are compared lowercase, with "_" and "-" read as
+// spaces and anything in brackets dropped, so "Duration (min)" is
+// "duration".
+var importColumns = map[string][]string{
+	"title":       {"title", "summary", "event", "name", "subject", "class", "session", "lesson", "activity"},
+	"start":       {"start", "starts", "begin", "begins", "from", "when", "start datetime", "start date time"},
+	"date":        {"date", "day", "start date"},
+	"time":        {"time", "start time", "hour"},
+	"end":         {"end", "ends", "end time", "end date", "until", "to", "finish"},
+	"duration":    {"duration", "length", "minutes", "mins"},
+	"attendees":   {"attendees", "guests", "emails", "email", "participants", "invitees", "students", "invite"},
+	"location":    {"location", "place", "room", "where", "venue"},
+	"description": {"description", "notes", "details", "comments"},
+}
+
+var bracketPattern = regexp.MustCompile(`\s*[(\[].*?[)\]]`)
+
+// calendarImport is a previewed import waiting for confirmation.
+type calendarImport struct {
+	ID      string
+	ChatKey string
+	Source  string
+	Events  []CalendarEvent
+	// Duplicate marks events already in the calendar with the same title
+	// and start
+	Duplicate []bool
+	Created   time.Time
+}
+
+// CalendarImportTool bulk-creates events from a schedule kept in a Google
+// Sheet, a CSV file or pasted CSV, for people who plan many sessions at
+// once, like coaches and teachers. A preview comes first and creates
+// nothing; confirming creates the events, and when one fails those
+// already created are removed again, so an import lands whole or not at
+// all.
+type CalendarImportTool struct {
+	calendar   *GoogleCalendarClient
+	drive      *GoogleDriveClient
+	calendarID string
+	workspace  string
+	restrict   bool
+	profiles   *profile.Store
+	mu         sync.Mutex
+	imports    map[string]*calendarImport
+	now        func() time.Time
+}
+
+func NewCalendarImportTool(token TokenFunc, calendarID, workspace string, restrict bool, profiles *profile.Store) *CalendarImportTool {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	return &CalendarImportTool{
+		calendar:   NewGoogleCalendarClient(token),
+		drive:      NewGoogleDriveClient(token),
+		calendarID: calendarID,
+		workspace:  workspace,
+		restrict:   restrict,
+		profiles:   profiles,
+		imports:    make(map[string]*calendarImport),
+		now:        time.Now,
+	}
+}
+
+func (t *CalendarImportTool) Name() string {
+	return "calendar_import"
+}
+
+func (t *CalendarImportTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "confirm")
+}
+
+func (t *CalendarImportTool) ActionScopes() map[string][]string {
+	return map[string][]string{"confirm": googleScopes("calendar.events", "calendar")}
+}
+
+func (t *CalendarImportTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "preview")
+}
+
+func (t *CalendarImportTool) Description() string {
+	return "Bulk-create Google Calendar events from a schedule: a Google Sheet or CSV file in Drive (file_id), a CSV file in the workspace (path) or pasted CSV (csv). The first row names the columns: a title, a start (or a date and a time), and optionally an end or a duration in minutes, attendees (email addresses, separated by commas or semicolons), location and notes. action=preview parses it without creating anything and lists the events, rows that could not be read and events already in the calendar; show it to the user, then call action=confirm with the import_id only after they agree. Attendees get email invitations. If creating any event fails, the ones already created are removed again."
+}
+
+func (t *CalendarImportTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"preview", "confirm"},
+				"description": "preview reads the schedule without changing anything; confirm creates the events",
+			},
+			"file_id": map[string]interface{}{
+				"type":        "string",
+				"description": "preview: drive_file_id of a Google Sheet (its first sheet is read) or CSV file",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "preview: path of a CSV file in the workspace",
+			},
+			"csv": map[string]interface{}{
+				"type":        "string",
+				"description": "preview: CSV text the user pasted, header row first",
+			},
+			"default_minutes": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("preview: length of events without an end or duration (default %d)", defaultImportMinutes),
+			},
+			"import_id": map[string]interface{}{
+				"type":        "string",
+				"description": "confirm: the import_id of the preview",
+			},
+			"include_duplicates": map[string]interface{}{
+				"type":        "boolean",
+				"description": "confirm: also create events the preview found already in the calendar",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *CalendarImportTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	switch action {
+	case "preview":
+		return t.preview(ctx, chatKey, args)
+	case "confirm":
+		return t.confirm(ctx, chatKey, args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *CalendarImportTool) preview(ctx context.Context, chatKey string, args map[string]interface{}) *ToolResult {
+	var prof profile.Profile
+	if t.profiles != nil {
+		prof = t.profiles.Get(chatKey)
+	}
+	fileID, _ := args["file_id"].(string)
+	fileID = strings.TrimPrefix(strings.TrimSpace(fileID), "drive_file_id=")
+	path, _ := args["path"].(string)
+	text, _ := args["csv"].(string)
+
+	var source string
+	switch {
+	case fileID != "":
+		file, content, err := t.drive.ReadText(ctx, fileID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the schedule from Drive: %v", err)).WithError(err)
+		}
+		source, text = file.Name, content
+	case strings.TrimSpace(path) != "":
+		resolved, err := validatePath(path, t.workspace, t.restrict)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		data, err := os.ReadFile(resolved)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read %s: %v", path, err)).WithError(err)
+		}
+		source, text = path, string(data)
+	case strings.TrimSpace(text) != "":
+		source = "the pasted schedule"
+	default:
+		return ErrorResult("file_id, path or csv is required")
+	}
+
+	minutes := defaultImportMinutes
+	if m, ok := args["default_minutes"].(float64); ok && m > 0 {
+		minutes = int(m)
+	}
+	events, rowErrors, err := parseImportCSV(text, t.now().In(prof.Location()), prof.Locale, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("cannot import %s: %v", source, err))
+	}
+	if len(events) == 0 {
+		return ErrorResult(fmt.Sprintf("no events could be read from %s:\n%s", source, strings.Join(rowErrors, "\n")))
+	}
+
+	imp := &calendarImport{
+		ID:        newPlanID(),
+		ChatKey:   chatKey,
+		Source:    source,
+		Events:    events,
+		Duplicate: t.markDuplicates(ctx, events),
+		Created:   t.now(),
+	}
+	t.mu.Lock()
+	for id, old := range t.imports {
+		if t.now().Sub(old.Created) > importTTL {
+			delete(t.imports, id)
+		}
+	}
+	t.imports[imp.ID] = imp
+	t.mu.Unlock()
+
+	tag := LocaleFromContext(ctx)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Preview of %d event(s) from %s (import_id=%s); nothing was created yet:", len(events), source, imp.ID)
+	var duplicates []string
+	for i, ev := range events {
+		if imp.Duplicate[i] {
+			duplicates = append(duplicates, strconv.Itoa(i+1))
+		}
+		if i >= maxImportPreview {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%d. %s, %s", i+1, ev.Summary, describeEventTime(ev, tag))
+		if ev.Location != "" {
+			fmt.Fprintf(&sb, ", at %s", ev.Location)
+		}
+		if len(ev.Attendees) > 0 {
+			emails := make([]string, len(ev.Attendees))
+			for j, a := range ev.Attendees {
+				emails[j] = a.Email
+			}
+			fmt.Fprintf(&sb, ", inviting %s", strings.Join(emails, ", "))
+		}
+		if imp.Duplicate[i] {
+			sb.WriteString(" (already in the calendar)")
+		}
+	}
+	if len(events) > maxImportPreview {
+		fmt.Fprintf(&sb, "\n…and %d more.", len(events)-maxImportPreview)
+	}
+	if len(duplicates) > 0 {
+		fmt.Fprintf(&sb, "\nEvent(s) %s are already in the calendar and will be skipped unless confirmed with include_duplicates=true.", strings.Join(duplicates, ", "))
+	}
+	if len(rowErrors) > 0 {
+		fmt.Fprintf(&sb, "\nRows that could not be read and will be left out:\n%s", strings.Join(rowErrors, "\n"))
+	}
+	return SilentResult(sb.String())
+}
+
+// markDuplicates reports which events the calendar already has, by title
+// and start. When the calendar cannot be read nothing is marked.
+func (t *CalendarImportTool) markDuplicates(ctx context.Context, events []CalendarEvent) []bool {
+	marks := make([]bool, len(events))
+	from, to := events[0].Start, events[0].End
+	for _, ev := range events {
+		if ev.Start.Before(from) {
+			from = ev.Start
+		}
+		if ev.End.After(to) {
+			to = ev.End
+		}
+	}
+	existing, err := t.calendar.ListEvents(ctx, t.calendarID, from, to)
+	if err != nil {
+		return marks
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, ev := range existing {
+		seen[importKey(ev)] = true
+	}
+	for i, ev := range events {
+		marks[i] = seen[importKey(ev)]
+	}
+	return marks
+}
+
+func importKey(ev CalendarEvent) string {
+	return strings.ToLower(strings.TrimSpace(ev.Summary)) + "\x00" + ev.Start.Format("2006-01-02T15:04")
+}
+
+// confirm creates the previewed events in order. If one fails, the ones
+// created so far are cancelled again, attendees told, so the calendar is
+// left as it was.
+func (t *CalendarImportTool) confirm(ctx context.Context, chatKey string, args map[string]interface{}) *ToolResult {
+	id, _ := args["import_id"].(string)
+	id = strings.TrimPrefix(strings.TrimSpace(id), "import_id=")
+	t.mu.Lock()
+	imp, ok := t.imports[id]
+	if ok && (imp.ChatKey != chatKey || t.now().Sub(imp.Created) > importTTL) {
+		ok = false
+	}
+	if ok {
+		// Taken out while it runs, so a second confirm cannot import twice
+		delete(t.imports, id)
+	}
+	t.mu.Unlock()
+	if !ok {
+		return ErrorResult(fmt.Sprintf("import %q not found or expired; run action=preview again", id))
+	}
+	includeDuplicates, _ := args["include_duplicates"].(bool)
+
+	var created []*CalendarEvent
+	skipped, invited := 0, 0
+	for i, ev := range imp.Events {
+		if imp.Duplicate[i] && !includeDuplicates {
+			skipped++
+			continue
+		}
+		result, err := t.calendar.InsertEvent(ctx, t.calendarID, ev)
+		if err != nil {
+			return t.rollback(ctx, ev, err, created)
+		}
+		created = append(created, result)
+		invited += len(ev.Attendees)
+	}
+
+	msg := fmt.Sprintf("Added %d event(s) from %s to the calendar.", len(created), imp.Source)
+	if invited > 0 {
+		msg += fmt.Sprintf(" %d invitation(s) were emailed to the attendees.", invited)
+	}
+	if skipped > 0 {
+		msg += fmt.Sprintf(" %d event(s) already in the calendar were skipped.", skipped)
+	}
+	return NewToolResult(msg)
+}
+
+// rollback removes the events created before failed could not be.
+func (t *CalendarImportTool) rollback(ctx context.Context, failed CalendarEvent, cause error, created []*CalendarEvent) *ToolResult {
+	var left []string
+	for i := len(created) - 1; i >= 0; i-- {
+		// Cancelling tells attendees, who were already invited
+		if err := t.calendar.CancelEvent(ctx, t.calendarID, created[i].ID); err != nil {
+			left = append(left, fmt.Sprintf("%s (%s) %s", created[i].Summary, created[i].Start.Format("2 Jan 15:04"), created[i].HTMLLink))
+		}
+	}
+	msg := fmt.Sprintf("Creating %q failed: %v. ", failed.Summary, cause)
+	switch {
+	case len(created) == 0:
+		msg += "Nothing was added to the calendar."
+	case len(left) == 0:
+		msg += fmt.Sprintf("The %d event(s) created before it were removed again, so the calendar is as it was.", len(created))
+	default:
+		msg += fmt.Sprintf("Removing the events created before it also failed for %d of them, which are still in the calendar:\n%s", len(left), strings.Join(left, "\n"))
+	}
+	return ErrorResult(msg).WithError(cause)
+}
+
+// parseImportCSV reads a schedule: a header row naming the columns, then
+// one event per row. Rows that cannot be read are returned as messages
+// naming their row number, counting the header as row 1.
+func parseImportCSV(text string, now time.Time, locale string, defaultLength time.Duration) ([]CalendarEvent, []string, error) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = sniffDelimiter(text)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) < 2 {
+		return nil, nil, fmt.Errorf("expected a header row and at least one event")
+	}
+	cols := map[string]int{}
+	for i, name := range rows[0] {
+		name = strings.ToLower(bracketPattern.ReplaceAllString(name, ""))
+		name = strings.Join(strings.Fields(strings.NewReplacer("_", " ", "-", " ").Replace(name)), " ")
+		for field, aliases := range importColumns {
+			if _, taken := cols[field]; !taken && containsFold(aliases, name) {
+				cols[field] = i
+			}
+		}
+	}
+	if _, ok := cols["title"]; !ok {
+		return nil, nil, fmt.Errorf("no title column; name one title, event or class")
+	}
+	_, hasStart := cols["start"]
+	_, hasDate := cols["date"]
+	if !hasStart && !hasDate {
+		return nil, nil, fmt.Errorf("no start or date column")
+	}
+	if len(rows)-1 > maxImportEvents {
+		return nil, nil, fmt.Errorf("%d rows is more than the %d events one import can create; split the schedule", len(rows)-1, maxImportEvents)
+	}
+
+	var events []CalendarEvent
+	var rowErrors []string
+	for i, row := range rows[1:] {
+		cell := func(field string) string {
+			if c, ok := cols[field]; ok && c < len(row) {
+				return strings.TrimSpace(row[c])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		ev, err := importRow(cell, now, locale, defaultLength)
+		if err != nil {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: %v", i+2, err))
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, rowErrors, nil
+}
+
+// importRow builds the event of one row. A start without a time of day
+// makes an all-day event.
+func importRow(cell func(string) string, now time.Time, locale string, defaultLength time.Duration) (CalendarEvent, error) {
+	ev := CalendarEvent{Summary: cell("title"), Location: cell("location"), Description: cell("description")}
+	if ev.Summary == "" {
+		return ev, fmt.Errorf("no title")
+	}
+	startText := cell("start")
+	if startText == "" {
+		startText = strings.TrimSpace(cell("date") + " " + cell("time"))
+	}
+	if startText == "" {
+		return ev, fmt.Errorf("no start")
+	}
+	start, err := when.Parse(startText, now, locale)
+	if err != nil {
+		return ev, err
+	}
+	ev.Start, ev.AllDay = start.Time, !start.HasTime
+
+	switch endText, length := cell("end"), cell("duration"); {
+	case endText != "":
+		end, err := when.Parse(endText, ev.Start, locale)
+		if err != nil {
+			return ev, err
+		}
+		switch {
+		case ev.AllDay && !end.HasTime:
+			// Calendar all-day ranges end the day after the last day
+			ev.End = end.Time.AddDate(0, 0, 1)
+		case ev.AllDay || !end.HasTime:
+			return ev, fmt.Errorf("start %q and end %q must both have a time of day, or both be dates", startText, endText)
+		default:
+			ev.End = end.Time
+		}
+	case ev.AllDay:
+		ev.End = ev.Start.AddDate(0, 0, 1)
+	case length != "":
+		d, err := parseImportDuration(length)
+		if err != nil {
+			return ev, err
+		}
+		ev.End = ev.Start.Add(d)
+	default:
+		ev.End = ev.Start.Add(defaultLength)
+	}
+	if !ev.End.After(ev.Start) {
+		return ev, fmt.Errorf("ends before it starts")
+	}
+
+	for _, field := range strings.FieldsFunc(cell("attendees"), func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+		addr, err := mail.ParseAddress(strings.TrimSpace(field))
+		if err != nil {
+			return ev, fmt.Errorf("%q is not an email address", strings.TrimSpace(field))
+		}
+		ev.Attendees = append(ev.Attendees, EventAttendee{Email: addr.Address, Name: addr.Name})
+	}
+	return ev, nil
+}
+
+// parseImportDuration reads a length such as "45", meaning minutes,
+// "1:30", "90 min", "1h30m" or "2 hours".
+func parseImportDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.ParseFloat(s, 64); err == nil && n > 0 {
+		return time.Duration(n * float64(time.Minute)), nil
+	}
+	if h, m, ok := strings.Cut(s, ":"); ok {
+		hours, err1 := strconv.Atoi(h)
+		minutes, err2 := strconv.Atoi(m)
+		if err1 == nil && err2 == nil && hours*60+minutes > 0 {
+			return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+		}
+	}
+	compact := strings.NewReplacer(" ", "", "hours", "h", "hour", "h", "hrs", "h", "hr", "h", "minutes", "m", "minute", "m", "mins", "m", "min", "m").Replace(s)
+	if d, err := time.ParseDuration(compact); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("cannot read %q as a duration; use minutes, e.g. 45", s)
+}
+
+// sniffDelimiter picks the separator of the header row: commas, or the
+// semicolons spreadsheets use where the comma is the decimal mark, or
+// tabs.
+func sniffDelimiter(text string) rune {
+	header, _, _ := strings.Cut(text, "\n")
+	best, count := ',', strings.Count(header, ",")
+	for _, r := range []rune{';', '\t'} {
+		if n := strings.Count(header, string(r)); n > count {
+			best, count = r, n
+		}
+	}
+	return best
+}
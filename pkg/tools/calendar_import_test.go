@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestCalendarImportTool_PreviewAndConfirm verifies a Sheet is previewed without creating anything, unreadable rows and events already in the calendar are reported, and confirming creates the rest with invitations
+func TestCalendarImportTool_PreviewAndConfirm(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	loc := time.Local
+	g.AddEvent(testkit.Event{Summary: "U10 training", Start: time.Date(2026, 11, 3, 17, 0, 0, 0, loc), End: time.Date(2026, 11, 3, 18, 0, 0, 0, loc)})
+	sheet := g.AddFile(testkit.File{
+		Name:     "Autumn schedule",
+		MimeType: "application/vnd.google-apps.spreadsheet",
+		Content: []byte("Class;Date;Start time;Duration (min);Students;Room\n" +
+			"U10 training;2026-11-03;17:00;60;;Pitch 2\n" +
+			"U12 training;2026-11-04;18:30;90;ana@example.com; Pitch 1\n" +
+			"Parents meeting;2026-11-05;;;\"rui@example.com, ines@example.com\";Clubhouse\n" +
+			";2026-11-06;10:00;;;\n" +
+			"Match;someday;;;;\n"),
+	})
+	tool := NewCalendarImportTool(testkit.Token, "", t.TempDir(), true, nil)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "preview", "file_id": sheet})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	for _, want := range []string{"Preview of 3 event(s) from Autumn schedule", "(already in the calendar)", "inviting ana@example.com", "row 5: no title", "row 6:"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("expected %q in the preview:\n%s", want, result.ForLLM)
+		}
+	}
+	if n := len(g.Events("primary")); n != 1 {
+		t.Fatalf("preview created events: %d in the calendar", n)
+	}
+
+	id := result.ForLLM[strings.Index(result.ForLLM, "import_id=")+len("import_id="):]
+	id = id[:strings.Index(id, ")")]
+	result = tool.Execute(ctx, map[string]interface{}{"action": "confirm", "import_id": id})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Added 2 event(s)") || !strings.Contains(result.ForLLM, "3 invitation(s)") || !strings.Contains(result.ForLLM, "1 event(s) already in the calendar were skipped") {
+		t.Errorf("unexpected confirmation: %s", result.ForLLM)
+	}
+	events := g.Events("primary")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	u12 := events[1]
+	if u12.Summary != "U12 training" || u12.End.Sub(u12.Start) != 90*time.Minute || u12.Location != "Pitch 1" || len(u12.Attendees) != 1 {
+		t.Errorf("unexpected U12 event: %+v", u12)
+	}
+	if meeting := events[2]; !meeting.AllDay || len(meeting.Attendees) != 2 {
+		t.Errorf("expected an all-day meeting with two attendees, got %+v", meeting)
+	}
+	if again := tool.Execute(ctx, map[string]interface{}{"action": "confirm", "import_id": id}); !again.IsError {
+		t.Errorf("expected a second confirm to fail, got: %s", again.ForLLM)
+	}
+}
+
+// TestCalendarImportTool_RollsBack verifies events created before a failure are removed again
+func TestCalendarImportTool_RollsBack(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	tool := NewCalendarImportTool(testkit.Token, "", t.TempDir(), true, nil)
+	ctx := WithChat(context.Background(), "telegram", "42")
+	csv := "title,start,end,attendees\nLesson 1,2026-11-03 09:00,10:00,\nLesson 2,2026-11-04 09:00,10:00,ana@example.com\n"
+	result := tool.Execute(ctx, map[string]interface{}{"action": "preview", "csv": csv})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	id := result.ForLLM[strings.Index(result.ForLLM, "import_id=")+len("import_id="):]
+	id = id[:strings.Index(id, ")")]
+
+	// Lesson 2 is the one sent with invitations
+	g.FailNext("sendUpdates=all", 1, http.StatusBadRequest)
+	result = tool.Execute(ctx, map[string]interface{}{"action": "confirm", "import_id": id})
+	if !result.IsError || !strings.Contains(result.ForLLM, `Creating "Lesson 2" failed`) || !strings.Contains(result.ForLLM, "removed again") {
+		t.Errorf("expected a rolled back import, got: %s", result.ForLLM)
+	}
+	if events := g.Events("primary"); len(events) != 0 {
+		t.Errorf("expected the calendar as it was, got %+v", events)
+	}
+}
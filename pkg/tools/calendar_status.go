@@ -0,0 +1,245 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+// calendarStatusTypes maps the tool's type argument to event types.
+var calendarStatusTypes = map[string]string{
+	"focus_time":       EventFocusTime,
+	"out_of_office":    EventOutOfOffice,
+	"working_location": EventWorkingLocation,
+}
+
+// CalendarStatusTool marks time in the user's primary Google Calendar as
+// focus time or out of office, and sets where they work, using Calendar's
+// own event types rather than ordinary events: those set the user's
+// status, can decline conflicting meetings and show up as such to
+// colleagues. They are only available to Google Workspace accounts.
+type CalendarStatusTool struct {
+	calendar *GoogleCalendarClient
+	profiles *profile.Store
+	now      func() time.Time
+}
+
+func NewCalendarStatusTool(token TokenFunc, profiles *profile.Store) *CalendarStatusTool {
+	return &CalendarStatusTool{calendar: NewGoogleCalendarClient(token), profiles: profiles, now: time.Now}
+}
+
+func (t *CalendarStatusTool) Name() string {
+	return "calendar_status"
+}
+
+func (t *CalendarStatusTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "set")
+}
+
+// Untrusted reports that listings carry event titles.
+func (t *CalendarStatusTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "list")
+}
+
+func (t *CalendarStatusTool) ActionScopes() map[string][]string {
+	return map[string][]string{"set": googleScopes("calendar.events", "calendar")}
+}
+
+func (t *CalendarStatusTool) Description() string {
+	return "Block focus time, mark the user out of office, or set where they work (home, an office, another place) in Google Calendar, using Calendar's special event types instead of plain events. Use it for requests like \"block focus time tomorrow morning\", \"mark me OOO Friday\" or \"I'm working from home Thursday\". action=list shows these entries for a period. Needs a Google Workspace account."
+}
+
+func (t *CalendarStatusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"set", "list"},
+				"description": "set creates the entry; list shows existing ones",
+			},
+			"type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"focus_time", "out_of_office", "working_location"},
+				"description": "What to mark (set), or which kind to list (default all)",
+			},
+			"start": map[string]interface{}{
+				"type":        "string",
+				"description": "set: when it starts, e.g. \"tomorrow 9am\", \"Friday\" (a day without a time covers the whole day). list: the period, e.g. \"this week\" (default the next 7 days)",
+			},
+			"end": map[string]interface{}{
+				"type":        "string",
+				"description": "set: when it ends, e.g. \"12:00\" or \"next Tuesday\" (a day is included). Default: 2 hours of focus time, or the end of the start day",
+			},
+			"location": map[string]interface{}{
+				"type":        "string",
+				"description": "working_location: \"home\", an office name (\"Lisbon office\") or another place (default home)",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Title shown in the calendar (default: Focus time, Out of office, or the location)",
+			},
+			"decline": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Decline meetings that conflict (default: yes for out of office, no for focus time)",
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "out_of_office: message sent with declined invitations",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *CalendarStatusTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	var prof profile.Profile
+	if t.profiles != nil {
+		channel, chatID := ChatFromContext(ctx)
+		prof = t.profiles.Get(channel + ":" + chatID)
+	}
+	now := t.now().In(prof.Location())
+
+	action, _ := args["action"].(string)
+	switch action {
+	case "set":
+		ev, err := statusEvent(args, now, prof.Locale)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		created, err := t.calendar.InsertEvent(ctx, "primary", ev)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to add to the calendar (focus time, out of office and working location need a Google Workspace account): %v", err)).WithError(err)
+		}
+		msg := fmt.Sprintf("Marked %s: %s", eventTypeNote(*created), describeEventTime(*created, LocaleFromContext(ctx)))
+		if ev.AutoDecline {
+			msg += ", declining conflicting meetings"
+		}
+		return NewToolResult(msg + " " + created.HTMLLink)
+
+	case "list":
+		span, _ := args["start"].(string)
+		from, to := now, now.AddDate(0, 0, 7)
+		if strings.TrimSpace(span) != "" {
+			var err error
+			if from, to, err = when.Range(span, now, prof.Locale); err != nil {
+				return ErrorResult(err.Error())
+			}
+		}
+		wanted := ""
+		if kind, _ := args["type"].(string); kind != "" {
+			if wanted = calendarStatusTypes[kind]; wanted == "" {
+				return ErrorResult(fmt.Sprintf("unknown type %q", kind))
+			}
+		}
+		events, err := t.calendar.ListEvents(ctx, "primary", from, to)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the calendar: %v", err)).WithError(err)
+		}
+		var lines []string
+		for _, ev := range events {
+			if ev.Type == "" || wanted != "" && ev.Type != wanted {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("- %s: %s", eventTypeNote(ev), describeEventTime(ev, LocaleFromContext(ctx))))
+		}
+		if len(lines) == 0 {
+			return SilentResult("No focus time, out of office or working location entries in that period.")
+		}
+		return SilentResult(strings.Join(lines, "\n"))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// statusEvent builds the event to create from the set arguments. Out of
+// office for whole days runs midnight to midnight, as Calendar itself
+// does; a working location for whole days is an all-day event.
+func statusEvent(args map[string]interface{}, now time.Time, locale string) (CalendarEvent, error) {
+	kind, _ := args["type"].(string)
+	ev := CalendarEvent{Type: calendarStatusTypes[kind]}
+	if ev.Type == "" {
+		return ev, fmt.Errorf("type must be focus_time, out_of_office or working_location")
+	}
+	startText, _ := args["start"].(string)
+	if strings.TrimSpace(startText) == "" {
+		return ev, fmt.Errorf("start is required")
+	}
+	start, err := when.Parse(startText, now, locale)
+	if err != nil {
+		return ev, err
+	}
+	ev.Start = start.Time
+
+	// dayEnd is the end of the day the end argument names, or of the start day
+	dayEnd := midnightAfter(start.Time)
+	hasEnd := false
+	if endText, _ := args["end"].(string); strings.TrimSpace(endText) != "" {
+		end, err := when.Parse(endText, start.Time, locale)
+		if err != nil {
+			return ev, err
+		}
+		hasEnd = true
+		if end.HasTime {
+			ev.End = end.Time
+		} else {
+			dayEnd = midnightAfter(end.Time)
+		}
+	}
+
+	switch {
+	case !ev.End.IsZero():
+	case ev.Type == EventWorkingLocation && !start.HasTime:
+		ev.AllDay = true
+		ev.End = dayEnd
+	case ev.Type == EventFocusTime && !start.HasTime:
+		return ev, fmt.Errorf("focus time needs a time of day, e.g. \"%s 9am\"", strings.TrimSpace(startText))
+	case ev.Type == EventFocusTime && !hasEnd:
+		ev.End = ev.Start.Add(2 * time.Hour)
+	default:
+		ev.End = dayEnd
+	}
+	if !ev.End.After(ev.Start) {
+		return ev, fmt.Errorf("end must be after start")
+	}
+
+	ev.WorkingLocation, _ = args["location"].(string)
+	ev.WorkingLocation = strings.TrimSpace(ev.WorkingLocation)
+	if ev.Type == EventWorkingLocation && ev.WorkingLocation == "" {
+		ev.WorkingLocation = "home"
+	}
+	ev.AutoDecline = ev.Type == EventOutOfOffice
+	if decline, ok := args["decline"].(bool); ok && ev.Type != EventWorkingLocation {
+		ev.AutoDecline = decline
+	}
+	ev.DeclineMessage, _ = args["message"].(string)
+
+	ev.Summary, _ = args["title"].(string)
+	if ev.Summary = strings.TrimSpace(ev.Summary); ev.Summary == "" {
+		switch ev.Type {
+		case EventFocusTime:
+			ev.Summary = "Focus time"
+		case EventOutOfOffice:
+			ev.Summary = "Out of office"
+		default:
+			ev.Summary = ev.WorkingLocation
+			if strings.EqualFold(ev.Summary, "home") {
+				ev.Summary = "Home"
+			}
+		}
+	}
+	return ev, nil
+}
+
+func midnightOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func midnightAfter(t time.Time) time.Time {
+	return midnightOf(t).AddDate(0, 0, 1)
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestCalendarStatusTool_Set verifies focus time, out of office and working location requests create Calendar's special event types with sensible spans
+func TestCalendarStatusTool_Set(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	tool := NewCalendarStatusTool(testkit.Token, nil)
+	// Wednesday 6 May 2026
+	tool.now = func() time.Time { return time.Date(2026, 5, 6, 10, 0, 0, 0, time.Local) }
+	ctx := context.Background()
+	at := func(day, hour int) time.Time { return time.Date(2026, 5, day, hour, 0, 0, 0, time.Local) }
+
+	for _, args := range []map[string]interface{}{
+		{"action": "set", "type": "focus_time", "start": "tomorrow 9am"},
+		{"action": "set", "type": "out_of_office", "start": "Friday", "message": "Back Monday"},
+		{"action": "set", "type": "working_location", "start": "Thursday", "end": "Friday"},
+	} {
+		if r := tool.Execute(ctx, args); r.IsError {
+			t.Fatalf("%v: %s", args, r.ForLLM)
+		}
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "set", "type": "focus_time", "start": "Friday"}); !r.IsError {
+		t.Errorf("focus time without a time of day was accepted: %s", r.ForLLM)
+	}
+
+	events := g.Events("")
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(events), events)
+	}
+	byType := map[string]testkit.Event{}
+	for _, e := range events {
+		byType[e.EventType] = e
+	}
+	focus, home, ooo := byType["focusTime"], byType["workingLocation"], byType["outOfOffice"]
+	if focus.EventType != "focusTime" || !focus.Start.Equal(at(7, 9)) || !focus.End.Equal(at(7, 11)) || focus.Summary != "Focus time" {
+		t.Errorf("unexpected focus time: %+v", focus)
+	}
+	if focus.AutoDeclineMode != "declineNone" {
+		t.Errorf("focus time declines meetings by default: %q", focus.AutoDeclineMode)
+	}
+	if home.EventType != "workingLocation" || !home.AllDay || home.WorkingLocation != "home" || home.End.Format("2006-01-02") != "2026-05-09" {
+		t.Errorf("unexpected working location: %+v", home)
+	}
+	if ooo.EventType != "outOfOffice" || ooo.AllDay || !ooo.Start.Equal(at(8, 0)) || !ooo.End.Equal(at(9, 0)) || ooo.AutoDeclineMode != "declineAllConflictingInvitations" {
+		t.Errorf("unexpected out of office: %+v", ooo)
+	}
+
+	list := tool.Execute(ctx, map[string]interface{}{"action": "list", "type": "out_of_office"})
+	if list.IsError || !strings.Contains(list.ForLLM, "out of office: Fri 8 May 2026") || strings.Contains(list.ForLLM, "focus") {
+		t.Errorf("unexpected list: %s", list.ForLLM)
+	}
+}
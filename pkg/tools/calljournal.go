@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// CallJournal keeps the results of the changes made while handling a
+// message, so when the message is handled again after a crash or restart
+// the calls that already went through are not made twice.
+type CallJournal interface {
+	// Done returns the result recorded under key, if any
+	Done(ctx context.Context, key string) (string, bool)
+	// Record stores the result of a call that went through
+	Record(ctx context.Context, key, result string)
+}
+
+// journaledRound is the journal of one message's round.
+type journaledRound struct {
+	journal CallJournal
+	round   string
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+type journaledRoundKey struct{}
+
+// WithCallJournal records the changing calls made with the returned
+// context under round, which must stay the same when the message is
+// handled again.
+func WithCallJournal(ctx context.Context, journal CallJournal, round string) context.Context {
+	return context.WithValue(ctx, journaledRoundKey{}, &journaledRound{journal: journal, round: round, seen: map[string]int{}})
+}
+
+func journaledRoundFromContext(ctx context.Context) *journaledRound {
+	r, _ := ctx.Value(journaledRoundKey{}).(*journaledRound)
+	return r
+}
+
+// key names a call by its tool, its arguments and how many identical
+// calls came before it in the round, as a replayed round may make its
+// calls in another order.
+func (r *journaledRound) key(name string, args map[string]interface{}) string {
+	data, _ := json.Marshal(args)
+	sum := sha256.Sum256(data)
+	call := name + ":" + hex.EncodeToString(sum[:8])
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen[call]++
+	return fmt.Sprintf("round:%s:%s:%d", r.round, call, r.seen[call])
+}
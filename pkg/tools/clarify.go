@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clarificationWindow is how long a question waits for the user's pick.
+const clarificationWindow = 10 * time.Minute
+
+// maxChoices bounds the options offered at once; more are not readable as
+// buttons and rarely help.
+const maxChoices = 8
+
+// Choice is one option offered when a call is ambiguous. Args are merged
+// into the original call's arguments when the user picks it.
+type Choice struct {
+	Label string
+	Args  map[string]interface{}
+}
+
+// Clarification asks the user to pick among candidates instead of the tool
+// guessing: three contacts called Ana, two files named report.pdf.
+type Clarification struct {
+	Question string
+	Choices  []Choice
+}
+
+// ClarifyResult is returned by a tool that cannot tell which of choices
+// the user means. In a chat, the registry asks the user and runs the call
+// again with the pick; elsewhere the model sees the options.
+func ClarifyResult(question string, choices []Choice) *ToolResult {
+	if len(choices) > maxChoices {
+		choices = choices[:maxChoices]
+	}
+	c := &Clarification{Question: question, Choices: choices}
+	return &ToolResult{
+		ForLLM:  c.text() + "\nAsk the user which one they mean; do not guess.",
+		Silent:  true,
+		Clarify: c,
+	}
+}
+
+// Labels returns the options to show, nil for no clarification.
+func (c *Clarification) Labels() []string {
+	if c == nil {
+		return nil
+	}
+	labels := make([]string, len(c.Choices))
+	for i, choice := range c.Choices {
+		labels[i] = choice.Label
+	}
+	return labels
+}
+
+// text is the question with its options numbered.
+func (c *Clarification) text() string {
+	var sb strings.Builder
+	sb.WriteString(c.Question)
+	for i, choice := range c.Choices {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, choice.Label)
+	}
+	return sb.String()
+}
+
+// Pick is the option a user chose, with the call it completes.
+type Pick struct {
+	Tool     string
+	Args     map[string]interface{}
+	Label    string
+	Question string
+}
+
+// Clarifications holds, per chat, the question a user was asked to pick an
+// option for. The user's next message answers it: a number or an option's
+// name picks it, anything else drops the question.
+type Clarifications struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*pendingClarification
+}
+
+type pendingClarification struct {
+	tool    string
+	args    map[string]interface{}
+	clarify *Clarification
+	expires time.Time
+}
+
+func NewClarifications() *Clarifications {
+	return &Clarifications{now: time.Now, pending: map[string]*pendingClarification{}}
+}
+
+// ask remembers a call waiting for the user in chat to pick an option,
+// replacing any earlier question there.
+func (c *Clarifications) ask(chat, tool string, args map[string]interface{}, clarify *Clarification) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[chat] = &pendingClarification{tool: tool, args: args, clarify: clarify, expires: c.now().Add(clarificationWindow)}
+}
+
+// Answer takes a user's message in chat as the reply to the question
+// waiting there, if any, and returns the call to run when it picks an
+// option.
+func (c *Clarifications) Answer(chat, reply string) (*Pick, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	p, ok := c.pending[chat]
+	delete(c.pending, chat)
+	c.mu.Unlock()
+	if !ok || !c.now().Before(p.expires) {
+		return nil, false
+	}
+	i := matchChoice(reply, p.clarify.Choices)
+	if i < 0 {
+		return nil, false
+	}
+	choice := p.clarify.Choices[i]
+	args := make(map[string]interface{}, len(p.args)+len(choice.Args))
+	for k, v := range p.args {
+		args[k] = v
+	}
+	for k, v := range choice.Args {
+		args[k] = v
+	}
+	return &Pick{Tool: p.tool, Args: args, Label: choice.Label, Question: p.clarify.Question}, true
+}
+
+// matchChoice finds the option a reply picks: its number, its label, or
+// the only label containing the reply. It returns -1 for none.
+func matchChoice(reply string, choices []Choice) int {
+	reply = strings.ToLower(strings.Trim(strings.TrimSpace(reply), ".)#"))
+	if n, err := strconv.Atoi(reply); err == nil {
+		if n >= 1 && n <= len(choices) {
+			return n - 1
+		}
+		return -1
+	}
+	for i, choice := range choices {
+		if strings.ToLower(choice.Label) == reply {
+			return i
+		}
+	}
+	if len([]rune(reply)) < 3 {
+		return -1
+	}
+	found := -1
+	for i, choice := range choices {
+		if strings.Contains(strings.ToLower(choice.Label), reply) {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
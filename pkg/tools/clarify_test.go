@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestRegistry_ClarifyAsksAndResumesWithPick verifies an ambiguous call shows the user numbered options and the pick reruns it with the chosen arguments
+func TestRegistry_ClarifyAsksAndResumesWithPick(t *testing.T) {
+	dir := newRecipientDirectory(t,
+		Contact{Name: "Ana Silva", Emails: []string{"ana.silva@example.com"}},
+		Contact{Name: "Ana Costa", Emails: []string{"ana.costa@example.com"}},
+	)
+	clarifications := NewClarifications()
+	registry := NewToolRegistry()
+	registry.Register(NewContactsTool(dir))
+	registry.SetClarifications(clarifications)
+	args := map[string]interface{}{"action": "resolve", "query": "Ana"}
+
+	// Without a chat the model gets the options
+	if result := registry.Execute(context.Background(), "contacts", args); result.Clarify != nil || !strings.Contains(result.ForLLM, "Ask the user") {
+		t.Errorf("unexpected result without a chat: %+v", result)
+	}
+
+	result := registry.ExecuteWithContext(context.Background(), "contacts", args, "telegram", "42", nil)
+	if result.Silent || !strings.Contains(result.ForUser, "2. Ana") || len(result.Clarify.Labels()) != 2 || !strings.Contains(result.ForLLM, "Don't call contacts again") {
+		t.Fatalf("question not shown: %+v", result)
+	}
+	pick, ok := clarifications.Answer("telegram:42", "costa")
+	if !ok || pick.Tool != "contacts" || pick.Args["query"] != "ana.costa@example.com" || pick.Args["action"] != "resolve" {
+		t.Fatalf("pick = %+v, %v", pick, ok)
+	}
+	result = registry.ExecuteWithContext(context.Background(), pick.Tool, pick.Args, "telegram", "42", nil)
+	if result.Clarify != nil || !strings.Contains(result.ForLLM, "is ana.costa@example.com") {
+		t.Errorf("picked call: %+v", result)
+	}
+
+	// A reply that picks nothing drops the question
+	registry.ExecuteWithContext(context.Background(), "contacts", args, "telegram", "42", nil)
+	if _, ok := clarifications.Answer("telegram:42", "3"); ok {
+		t.Error("out of range number picked an option")
+	}
+	if _, ok := clarifications.Answer("telegram:42", "1"); ok {
+		t.Error("question still pending after an unrelated reply")
+	}
+}
@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+// ContactGroupsTool manages named recipient groups, such as "family" or
+// "team", that the message tool can broadcast to and gmail can send to.
+// Groups belong to the chat they were made in.
+type ContactGroupsTool struct {
+	groups *store.ContactGroups
+}
+
+func NewContactGroupsTool(groups *store.ContactGroups) *ContactGroupsTool {
+	return &ContactGroupsTool{groups: groups}
+}
+
+func (t *ContactGroupsTool) Name() string {
+	return "contact_groups"
+}
+
+func (t *ContactGroupsTool) Description() string {
+	return "Manage named groups of recipients, such as \"family\" or \"team\": list them, show one, add or update members (a name with an email address, a chat, or both), remove members, or delete a group. Send to a group with the message tool's group argument, or by putting \"group:<name>\" in gmail's to or cc."
+}
+
+func (t *ContactGroupsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "remove", "delete")
+}
+
+func (t *ContactGroupsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "show", "add", "remove", "delete"},
+				"description": "Action to perform; add creates the group if needed",
+			},
+			"group": map[string]interface{}{
+				"type":        "string",
+				"description": "Group name (show, add, remove, delete)",
+			},
+			"members": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":  map[string]interface{}{"type": "string"},
+						"email": map[string]interface{}{"type": "string", "description": "Email address, for gmail"},
+						"chat":  map[string]interface{}{"type": "string", "description": "Chat as <channel>:<chat_id>, e.g. telegram:123456, for the message tool"},
+					},
+					"required": []string{"name"},
+				},
+				"description": "add: members to add or update; remove: members to remove (only name is needed)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ContactGroupsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	scope := channel + ":" + chatID
+	action, _ := args["action"].(string)
+
+	if action == "list" {
+		groups, err := t.groups.List(ctx, scope)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read contact groups: %v", err)).WithError(err)
+		}
+		if len(groups) == 0 {
+			return SilentResult("No contact groups yet")
+		}
+		var sb strings.Builder
+		sb.WriteString("Contact groups:")
+		for _, g := range groups {
+			sb.WriteString("\n- " + describeGroup(g))
+		}
+		return SilentResult(sb.String())
+	}
+
+	name, _ := args["group"].(string)
+	name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "group:"))
+	if name == "" {
+		return ErrorResult("group is required")
+	}
+
+	switch action {
+	case "show":
+		group, err := findGroup(ctx, t.groups, name)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(describeGroup(group))
+	case "add":
+		members, err := groupMembersArg(args)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if err := t.groups.Add(ctx, scope, name, members); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save the %s group: %v", name, err)).WithError(err)
+		}
+		group, _, err := t.groups.Get(ctx, scope, name)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the %s group: %v", name, err)).WithError(err)
+		}
+		return SilentResult("Saved. " + describeGroup(group))
+	case "remove":
+		list, _ := args["members"].([]interface{})
+		var names []string
+		for _, item := range list {
+			switch v := item.(type) {
+			case string:
+				names = append(names, strings.TrimSpace(v))
+			case map[string]interface{}:
+				n, _ := v["name"].(string)
+				names = append(names, strings.TrimSpace(n))
+			}
+		}
+		if len(names) == 0 {
+			return ErrorResult("members is required for remove")
+		}
+		removed, err := t.groups.Remove(ctx, scope, name, names)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to update the %s group: %v", name, err)).WithError(err)
+		}
+		if removed == 0 {
+			return ErrorResult(fmt.Sprintf("none of %s is in the %s group", strings.Join(names, ", "), name))
+		}
+		return SilentResult(fmt.Sprintf("Removed %d member(s) from %s", removed, name))
+	case "delete":
+		deleted, err := t.groups.Delete(ctx, scope, name)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to delete the %s group: %v", name, err)).WithError(err)
+		}
+		if !deleted {
+			return ErrorResult(fmt.Sprintf("no contact group named %q", name))
+		}
+		return SilentResult(fmt.Sprintf("Deleted the %s group", name))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// groupMembersArg reads and checks the members argument of add.
+func groupMembersArg(args map[string]interface{}) ([]store.GroupMember, error) {
+	list, _ := args["members"].([]interface{})
+	var members []store.GroupMember
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("each member is an object with name and an email or chat")
+		}
+		var m store.GroupMember
+		m.Name, _ = entry["name"].(string)
+		m.Email, _ = entry["email"].(string)
+		m.Chat, _ = entry["chat"].(string)
+		m.Name, m.Email, m.Chat = strings.TrimSpace(m.Name), strings.TrimSpace(m.Email), strings.TrimSpace(m.Chat)
+		if m.Name == "" {
+			return nil, fmt.Errorf("each member needs a name")
+		}
+		if m.Email == "" && m.Chat == "" {
+			return nil, fmt.Errorf("%s needs an email or a chat", m.Name)
+		}
+		if m.Email != "" {
+			addr, err := mail.ParseAddress(m.Email)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an email address; find it with the contacts tool (action=resolve) or ask the user", m.Email)
+			}
+			m.Email = addr.Address
+		}
+		if m.Chat != "" {
+			if channel, chatID, ok := strings.Cut(m.Chat, ":"); !ok || channel == "" || chatID == "" {
+				return nil, fmt.Errorf("chat %q is not <channel>:<chat_id>", m.Chat)
+			}
+		}
+		members = append(members, m)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("members is required for add")
+	}
+	return members, nil
+}
+
+// findGroup returns the calling chat's contact group called name, with or
+// without a "group:" prefix.
+func findGroup(ctx context.Context, groups *store.ContactGroups, name string) (store.ContactGroup, error) {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" {
+		return store.ContactGroup{}, fmt.Errorf("contact groups need an active conversation")
+	}
+	name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "group:"))
+	group, ok, err := groups.Get(ctx, channel+":"+chatID, name)
+	if err != nil {
+		return store.ContactGroup{}, fmt.Errorf("failed to read contact groups: %w", err)
+	}
+	if !ok {
+		return store.ContactGroup{}, fmt.Errorf("no contact group named %q; see the contact_groups tool", name)
+	}
+	return group, nil
+}
+
+// describeGroup lists a group's members with how each is reached.
+func describeGroup(g store.ContactGroup) string {
+	if len(g.Members) == 0 {
+		return g.Name + ": no members"
+	}
+	parts := make([]string, len(g.Members))
+	for i, m := range g.Members {
+		var reach []string
+		if m.Email != "" {
+			reach = append(reach, m.Email)
+		}
+		if m.Chat != "" {
+			reach = append(reach, m.Chat)
+		}
+		parts[i] = m.Name
+		if len(reach) > 0 {
+			parts[i] += " (" + strings.Join(reach, ", ") + ")"
+		}
+	}
+	return fmt.Sprintf("%s: %s", g.Name, strings.Join(parts, "; "))
+}
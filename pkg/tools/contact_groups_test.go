@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestContactGroups_BroadcastAndEmail verifies a group saved from a chat is broadcast to by the message tool, member by member, and expands into gmail's To and CC lists
+func TestContactGroups_BroadcastAndEmail(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	db := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	ctx := WithChat(context.Background(), "telegram", "1")
+	groups := NewContactGroupsTool(db.ContactGroups)
+
+	r := groups.Execute(ctx, map[string]interface{}{"action": "add", "group": "family", "members": []interface{}{
+		map[string]interface{}{"name": "Ana", "email": "ana@example.com", "chat": "telegram:11"},
+		map[string]interface{}{"name": "Bruno", "chat": "whatsapp:22"},
+		map[string]interface{}{"name": "Carla", "email": "Carla <carla@example.com>"},
+	}})
+	if r.IsError || r.ForLLM != "Saved. family: Ana (ana@example.com, telegram:11); Bruno (whatsapp:22); Carla (carla@example.com)" {
+		t.Fatalf("unexpected add: %s", r.ForLLM)
+	}
+	if r := groups.Execute(ctx, map[string]interface{}{"action": "add", "group": "team", "members": []interface{}{
+		map[string]interface{}{"name": "Dan"},
+	}}); !r.IsError {
+		t.Errorf("member with no email or chat was saved: %s", r.ForLLM)
+	}
+	if r := groups.Execute(WithChat(context.Background(), "telegram", "2"), map[string]interface{}{"action": "list"}); r.ForLLM != "No contact groups yet" {
+		t.Errorf("group seen from another chat: %s", r.ForLLM)
+	}
+
+	message := NewMessageTool()
+	message.SetGroups(db.ContactGroups)
+	var sent []string
+	message.SetSendCallback(func(channel, chatID, content string) error {
+		sent = append(sent, channel+":"+chatID+" "+content)
+		return nil
+	})
+	r = message.Execute(ctx, map[string]interface{}{"content": "Dinner at 8", "group": "Family"})
+	if r.IsError || len(sent) != 2 || sent[0] != "telegram:11 Dinner at 8" || sent[1] != "whatsapp:22 Dinner at 8" {
+		t.Fatalf("unexpected broadcast %v: %s", sent, r.ForLLM)
+	}
+	if !strings.Contains(r.ForLLM, "sent to 2 of the 3 members of family: Ana, Bruno") || !strings.Contains(r.ForLLM, "No chat saved for Carla") {
+		t.Errorf("unexpected broadcast result: %s", r.ForLLM)
+	}
+	if r := message.Execute(ctx, map[string]interface{}{"content": "x", "group": "work"}); !r.IsError {
+		t.Errorf("unknown group accepted: %s", r.ForLLM)
+	}
+
+	g := testkit.NewGoogle(t)
+	g.Install()
+	gmail := NewGmailTool(testkit.Token)
+	gmail.SetGroups(db.ContactGroups)
+	r = gmail.Execute(ctx, map[string]interface{}{"action": "send", "to": []interface{}{"group:family"}, "cc": "ana@example.com, boss@example.com", "subject": "Trip", "body": "Plans attached."})
+	if r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	mails := g.Sent()
+	if len(mails) != 1 || mails[0].To != `"Ana" <ana@example.com>, "Carla" <carla@example.com>` || !strings.Contains(mails[0].Cc, "boss@example.com") {
+		t.Fatalf("unexpected email: %+v", mails)
+	}
+	if !strings.Contains(r.ForLLM, "Left out Bruno") {
+		t.Errorf("member without an address not reported: %s", r.ForLLM)
+	}
+	if r := gmail.Execute(ctx, map[string]interface{}{"action": "send", "to": "mom", "body": "hi"}); !r.IsError || !strings.Contains(r.ForLLM, "contacts") {
+		t.Errorf("a name as recipient was not refused: %s", r.ForLLM)
+	}
+}
@@ -0,0 +1,907 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenFunc returns a valid OAuth access token, refreshing it if needed.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Contact is a person from any of the configured address books.
+type Contact struct {
+	ID           string   `json:"id"`
+	Source       string   `json:"source"`
+	Name         string   `json:"name"`
+	Emails       []string `json:"emails,omitempty"`
+	Phones       []string `json:"phones,omitempty"`
+	Organization string   `json:"organization,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+	etag         string
+}
+
+func (c *Contact) format() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s [%s:%s]", c.Name, c.Source, c.ID)
+	if c.Organization != "" {
+		fmt.Fprintf(&sb, " — %s", c.Organization)
+	}
+	if len(c.Emails) > 0 {
+		fmt.Fprintf(&sb, "\n  email: %s", strings.Join(c.Emails, ", "))
+	}
+	if len(c.Phones) > 0 {
+		fmt.Fprintf(&sb, "\n  phone: %s", strings.Join(c.Phones, ", "))
+	}
+	if c.Notes != "" {
+		fmt.Fprintf(&sb, "\n  notes: %s", c.Notes)
+	}
+	return sb.String()
+}
+
+func (c *Contact) matches(query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return true
+	}
+	fields := append([]string{c.Name, c.Organization, c.Notes}, c.Emails...)
+	fields = append(fields, c.Phones...)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
+	}
+	// "ana silva" should match "Ana Maria Silva"
+	name := strings.ToLower(c.Name)
+	for _, word := range strings.Fields(query) {
+		if !strings.Contains(name, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContactSource is an address book backend. Save creates the contact when
+// ID is empty and updates it otherwise.
+type ContactSource interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]Contact, error)
+	Get(ctx context.Context, id string) (*Contact, error)
+	Save(ctx context.Context, c *Contact) (*Contact, error)
+}
+
+// LocalAddressBook stores contacts in a JSON file in the workspace.
+type LocalAddressBook struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLocalAddressBook(path string) *LocalAddressBook {
+	return &LocalAddressBook{path: path}
+}
+
+func (b *LocalAddressBook) Name() string {
+	return "local"
+}
+
+func (b *LocalAddressBook) load() ([]Contact, error) {
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var contacts []Contact
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return nil, fmt.Errorf("failed to parse address book: %w", err)
+	}
+	return contacts, nil
+}
+
+func (b *LocalAddressBook) save(contacts []Contact) error {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(contacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0600)
+}
+
+func (b *LocalAddressBook) Search(ctx context.Context, query string, limit int) ([]Contact, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	contacts, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	var result []Contact
+	for _, c := range contacts {
+		if c.matches(query) {
+			c.Source = b.Name()
+			result = append(result, c)
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (b *LocalAddressBook) Get(ctx context.Context, id string) (*Contact, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	contacts, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contacts {
+		if c.ID == id {
+			c.Source = b.Name()
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("contact %s not found", id)
+}
+
+func (b *LocalAddressBook) Save(ctx context.Context, c *Contact) (*Contact, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	contacts, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	saved := *c
+	saved.Source = b.Name()
+	if saved.ID == "" {
+		saved.ID = newContactID()
+		contacts = append(contacts, saved)
+	} else {
+		found := false
+		for i := range contacts {
+			if contacts[i].ID == saved.ID {
+				contacts[i] = saved
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("contact %s not found", saved.ID)
+		}
+	}
+
+	if err := b.save(contacts); err != nil {
+		return nil, fmt.Errorf("failed to save address book: %w", err)
+	}
+	return &saved, nil
+}
+
+func newContactID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// GooglePeopleSource reads and writes Google Contacts via the People API.
+type GooglePeopleSource struct {
+	token   TokenFunc
+	baseURL string
+	client  *http.Client
+}
+
+func NewGooglePeopleSource(token TokenFunc) *GooglePeopleSource {
+	return &GooglePeopleSource{
+		token:   token,
+		baseURL: "https://people.googleapis.com/v1",
+		client:  newGoogleHTTPClient(15 * time.Second),
+	}
+}
+
+func (s *GooglePeopleSource) Name() string {
+	return "google"
+}
+
+const googlePersonFields = "names,emailAddresses,phoneNumbers,organizations,biographies"
+
+type googlePerson struct {
+	ResourceName string `json:"resourceName,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	Names        []struct {
+		DisplayName      string `json:"displayName,omitempty"`
+		UnstructuredName string `json:"unstructuredName,omitempty"`
+	} `json:"names,omitempty"`
+	EmailAddresses []struct {
+		Value string `json:"value"`
+	} `json:"emailAddresses,omitempty"`
+	PhoneNumbers []struct {
+		Value string `json:"value"`
+	} `json:"phoneNumbers,omitempty"`
+	Organizations []struct {
+		Name string `json:"name,omitempty"`
+	} `json:"organizations,omitempty"`
+	Biographies []struct {
+		Value string `json:"value"`
+	} `json:"biographies,omitempty"`
+}
+
+func (p *googlePerson) toContact() Contact {
+	c := Contact{
+		ID:     strings.TrimPrefix(p.ResourceName, "people/"),
+		Source: "google",
+		etag:   p.ETag,
+	}
+	if len(p.Names) > 0 {
+		c.Name = p.Names[0].DisplayName
+	}
+	for _, e := range p.EmailAddresses {
+		c.Emails = append(c.Emails, e.Value)
+	}
+	for _, ph := range p.PhoneNumbers {
+		c.Phones = append(c.Phones, ph.Value)
+	}
+	if len(p.Organizations) > 0 {
+		c.Organization = p.Organizations[0].Name
+	}
+	if len(p.Biographies) > 0 {
+		c.Notes = p.Biographies[0].Value
+	}
+	return c
+}
+
+func googlePersonFromContact(c *Contact) map[string]interface{} {
+	person := map[string]interface{}{
+		"names": []map[string]string{{"unstructuredName": c.Name}},
+	}
+	var emails, phones []map[string]string
+	for _, e := range c.Emails {
+		emails = append(emails, map[string]string{"value": e})
+	}
+	for _, ph := range c.Phones {
+		phones = append(phones, map[string]string{"value": ph})
+	}
+	person["emailAddresses"] = emails
+	person["phoneNumbers"] = phones
+	if c.Organization != "" {
+		person["organizations"] = []map[string]string{{"name": c.Organization}}
+	}
+	if c.Notes != "" {
+		person["biographies"] = []map[string]string{{"value": c.Notes}}
+	}
+	if c.etag != "" {
+		person["etag"] = c.etag
+	}
+	return person
+}
+
+func (s *GooglePeopleSource) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, s.client, method, s.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+func (s *GooglePeopleSource) Search(ctx context.Context, query string, limit int) ([]Contact, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("readMask", googlePersonFields)
+	if limit > 0 {
+		params.Set("pageSize", fmt.Sprintf("%d", limit))
+	}
+
+	var resp struct {
+		Results []struct {
+			Person googlePerson `json:"person"`
+		} `json:"results"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/people:searchContacts?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	contacts := make([]Contact, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		contacts = append(contacts, r.Person.toContact())
+	}
+	return contacts, nil
+}
+
+func (s *GooglePeopleSource) Get(ctx context.Context, id string) (*Contact, error) {
+	var person googlePerson
+	path := "/people/" + url.PathEscape(id) + "?personFields=" + googlePersonFields
+	if err := s.do(ctx, http.MethodGet, path, nil, &person); err != nil {
+		return nil, err
+	}
+	c := person.toContact()
+	return &c, nil
+}
+
+func (s *GooglePeopleSource) Save(ctx context.Context, c *Contact) (*Contact, error) {
+	var person googlePerson
+	if c.ID == "" {
+		if err := s.do(ctx, http.MethodPost, "/people:createContact", googlePersonFromContact(c), &person); err != nil {
+			return nil, err
+		}
+	} else {
+		path := "/people/" + url.PathEscape(c.ID) + ":updateContact?updatePersonFields=" + googlePersonFields
+		if err := s.do(ctx, http.MethodPatch, path, googlePersonFromContact(c), &person); err != nil {
+			return nil, err
+		}
+	}
+	saved := person.toContact()
+	return &saved, nil
+}
+
+// CardDAVSource talks to a single CardDAV address book collection
+// (Nextcloud, iCloud, Fastmail, Radicale...).
+type CardDAVSource struct {
+	collectionURL string
+	username      string
+	password      string
+	client        *http.Client
+}
+
+func NewCardDAVSource(collectionURL, username, password string) *CardDAVSource {
+	return &CardDAVSource{
+		collectionURL: strings.TrimRight(collectionURL, "/") + "/",
+		username:      username,
+		password:      password,
+		client:        &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (s *CardDAVSource) Name() string {
+	return "carddav"
+}
+
+func (s *CardDAVSource) request(ctx context.Context, method, reqURL string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return s.client.Do(req)
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ETag        string `xml:"getetag"`
+				AddressData string `xml:"address-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (s *CardDAVSource) report(ctx context.Context, body string) ([]Contact, error) {
+	resp, err := s.request(ctx, "REPORT", s.collectionURL, []byte(body), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "1",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CardDAV error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var ms davMultistatus
+	if err := xml.Unmarshal(data, &ms); err != nil {
+		return nil, fmt.Errorf("failed to parse CardDAV response: %w", err)
+	}
+
+	var contacts []Contact
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.Prop.AddressData == "" {
+				continue
+			}
+			c := parseVCard(ps.Prop.AddressData)
+			c.ID = r.Href
+			c.Source = s.Name()
+			c.etag = ps.Prop.ETag
+			contacts = append(contacts, c)
+		}
+	}
+	return contacts, nil
+}
+
+func (s *CardDAVSource) Search(ctx context.Context, query string, limit int) ([]Contact, error) {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(query))
+
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:prop><D:getetag/><C:address-data/></D:prop>
+  <C:filter test="anyof">
+    <C:prop-filter name="FN"><C:text-match collation="i;unicode-casemap" match-type="contains">` + escaped.String() + `</C:text-match></C:prop-filter>
+    <C:prop-filter name="EMAIL"><C:text-match collation="i;unicode-casemap" match-type="contains">` + escaped.String() + `</C:text-match></C:prop-filter>
+  </C:filter>
+</C:addressbook-query>`
+
+	contacts, err := s.report(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(contacts) > limit {
+		contacts = contacts[:limit]
+	}
+	return contacts, nil
+}
+
+func (s *CardDAVSource) Get(ctx context.Context, id string) (*Contact, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<C:addressbook-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:prop><D:getetag/><C:address-data/></D:prop>
+  <D:href>` + id + `</D:href>
+</C:addressbook-multiget>`
+
+	contacts, err := s.report(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(contacts) == 0 {
+		return nil, fmt.Errorf("contact %s not found", id)
+	}
+	return &contacts[0], nil
+}
+
+func (s *CardDAVSource) Save(ctx context.Context, c *Contact) (*Contact, error) {
+	saved := *c
+	saved.Source = s.Name()
+	headers := map[string]string{"Content-Type": "text/vcard; charset=utf-8"}
+
+	var target string
+	uid := ""
+	if saved.ID == "" {
+		uid = newContactID()
+		target = s.collectionURL + uid + ".vcf"
+		headers["If-None-Match"] = "*"
+	} else {
+		// IDs are hrefs; resolve relative to the collection.
+		base, err := url.Parse(s.collectionURL)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := url.Parse(saved.ID)
+		if err != nil {
+			return nil, err
+		}
+		target = base.ResolveReference(ref).String()
+		uid = strings.TrimSuffix(filepath.Base(ref.Path), ".vcf")
+		if saved.etag != "" {
+			headers["If-Match"] = saved.etag
+		}
+	}
+
+	resp, err := s.request(ctx, http.MethodPut, target, []byte(formatVCard(&saved, uid)), headers)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("CardDAV error (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if saved.ID == "" {
+		u, _ := url.Parse(target)
+		saved.ID = u.Path
+	}
+	saved.etag = resp.Header.Get("ETag")
+	return &saved, nil
+}
+
+// parseVCard extracts the fields we care about from a vCard 3.0/4.0 body.
+func parseVCard(data string) Contact {
+	var c Contact
+	// Unfold continuation lines (RFC 6350 3.2)
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.ToUpper(line[:colon])
+		if semi := strings.Index(name, ";"); semi >= 0 {
+			name = name[:semi]
+		}
+		// Drop "item1." style group prefixes
+		if dot := strings.LastIndex(name, "."); dot >= 0 {
+			name = name[dot+1:]
+		}
+		value := vcardUnescape(line[colon+1:])
+
+		switch name {
+		case "FN":
+			c.Name = value
+		case "EMAIL":
+			c.Emails = append(c.Emails, value)
+		case "TEL":
+			c.Phones = append(c.Phones, strings.TrimPrefix(value, "tel:"))
+		case "ORG":
+			c.Organization = strings.TrimRight(strings.ReplaceAll(value, ";", " "), " ")
+		case "NOTE":
+			c.Notes = value
+		}
+	}
+	return c
+}
+
+func vcardUnescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+func vcardEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+func formatVCard(c *Contact, uid string) string {
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VCARD\r\nVERSION:3.0\r\n")
+	fmt.Fprintf(&sb, "UID:%s\r\n", uid)
+	fmt.Fprintf(&sb, "FN:%s\r\n", vcardEscape(c.Name))
+	fmt.Fprintf(&sb, "N:%s;;;;\r\n", vcardEscape(c.Name))
+	for _, e := range c.Emails {
+		fmt.Fprintf(&sb, "EMAIL;TYPE=INTERNET:%s\r\n", vcardEscape(e))
+	}
+	for _, p := range c.Phones {
+		fmt.Fprintf(&sb, "TEL:%s\r\n", vcardEscape(p))
+	}
+	if c.Organization != "" {
+		fmt.Fprintf(&sb, "ORG:%s\r\n", vcardEscape(c.Organization))
+	}
+	if c.Notes != "" {
+		fmt.Fprintf(&sb, "NOTE:%s\r\n", vcardEscape(c.Notes))
+	}
+	sb.WriteString("END:VCARD\r\n")
+	return sb.String()
+}
+
+// ContactDirectory searches all configured address books at once. Other
+// tools use it to turn a person's name into an email address or phone number.
+type ContactDirectory struct {
+	sources []ContactSource
+}
+
+func NewContactDirectory(sources ...ContactSource) *ContactDirectory {
+	return &ContactDirectory{sources: sources}
+}
+
+func (d *ContactDirectory) Source(name string) ContactSource {
+	for _, s := range d.sources {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Search queries every source and merges entries that share an email
+// address or phone number. Failing sources are skipped unless all fail.
+func (d *ContactDirectory) Search(ctx context.Context, query string, limit int) ([]Contact, error) {
+	var all []Contact
+	var errs []string
+	for _, s := range d.sources {
+		items, err := s.Search(ctx, query, limit)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", s.Name(), err))
+			continue
+		}
+		all = append(all, items...)
+	}
+	if len(all) == 0 && len(errs) > 0 && len(errs) == len(d.sources) {
+		return nil, fmt.Errorf("contact lookup failed: %s", strings.Join(errs, "; "))
+	}
+
+	merged := mergeContacts(all)
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged, nil
+}
+
+func normalizePhone(p string) string {
+	var sb strings.Builder
+	for _, r := range p {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func mergeContacts(items []Contact) []Contact {
+	var result []Contact
+	index := make(map[string]int)
+	for _, c := range items {
+		var keys []string
+		for _, e := range c.Emails {
+			keys = append(keys, "e:"+strings.ToLower(e))
+		}
+		for _, p := range c.Phones {
+			if n := normalizePhone(p); len(n) >= 6 {
+				keys = append(keys, "p:"+n)
+			}
+		}
+
+		target := -1
+		for _, k := range keys {
+			if i, ok := index[k]; ok {
+				target = i
+				break
+			}
+		}
+		if target < 0 {
+			result = append(result, c)
+			target = len(result) - 1
+		} else {
+			existing := &result[target]
+			existing.Emails = appendUnique(existing.Emails, c.Emails...)
+			existing.Phones = appendUnique(existing.Phones, c.Phones...)
+			if existing.Organization == "" {
+				existing.Organization = c.Organization
+			}
+		}
+		for _, k := range keys {
+			index[k] = target
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+	return result
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		dup := false
+		for _, existing := range list {
+			if strings.EqualFold(existing, v) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ContactsTool exposes the contact directory to the agent.
+type ContactsTool struct {
+	directory *ContactDirectory
+}
+
+func NewContactsTool(directory *ContactDirectory) *ContactsTool {
+	return &ContactsTool{directory: directory}
+}
+
+func (t *ContactsTool) Name() string {
+	return "contacts"
+}
+
+func (t *ContactsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "create", "update")
+}
+
+func (t *ContactsTool) Description() string {
+	return "Search the user's contacts (Google Contacts, CardDAV, local address book) by name, email or phone, and create or update contacts. Before sending mail or messages to someone named in the request (\"email mom\"), use action=resolve to get their address instead of guessing one, and ask the user when it reports several matches."
+}
+
+func (t *ContactsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"search", "resolve", "get", "create", "update"},
+				"description": "Action to perform",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Name, email or phone fragment (search), or how the user referred to the person, e.g. \"mom\" or \"Ana\" (resolve)",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{RecipientEmail, RecipientPhone},
+				"description": "Address to resolve to (resolve, default email)",
+			},
+			"source": map[string]interface{}{
+				"type":        "string",
+				"description": "Address book: google, carddav or local (get/create/update; create defaults to local)",
+			},
+			"contact_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Contact ID as shown in search results (get/update)",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Full name (create/update)",
+			},
+			"emails": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Email addresses (create/update; replaces the existing list)",
+			},
+			"phones": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Phone numbers (create/update; replaces the existing list)",
+			},
+			"organization": map[string]interface{}{
+				"type":        "string",
+				"description": "Company (create/update)",
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "Free-form notes (create/update)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func stringListArg(args map[string]interface{}, key string) ([]string, bool) {
+	raw, ok := args[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	var result []string
+	for _, v := range raw {
+		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+			result = append(result, strings.TrimSpace(s))
+		}
+	}
+	return result, true
+}
+
+func (t *ContactsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	switch action {
+	case "search":
+		query, _ := args["query"].(string)
+		if query == "" {
+			return ErrorResult("query is required for search")
+		}
+		contacts, err := t.directory.Search(ctx, query, 10)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if len(contacts) == 0 {
+			return SilentResult(fmt.Sprintf("No contacts matching %q", query))
+		}
+		lines := make([]string, 0, len(contacts))
+		for i := range contacts {
+			lines = append(lines, contacts[i].format())
+			noteMentions(ctx, contactMentions(contacts[i])...)
+		}
+		return SilentResult(strings.Join(lines, "\n"))
+	case "resolve":
+		query, _ := args["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return ErrorResult("query is required for resolve")
+		}
+		kind, _ := args["kind"].(string)
+		if kind == "" {
+			kind = RecipientEmail
+		}
+		if kind != RecipientEmail && kind != RecipientPhone {
+			return ErrorResult(fmt.Sprintf("unknown kind %q (use email or phone)", kind))
+		}
+		res, err := t.directory.ResolveRecipient(ctx, query, kind)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		// Resolving the picked address itself returns it as the match
+		if clarify := res.Clarify(func(address string) map[string]interface{} {
+			return map[string]interface{}{"query": address}
+		}); clarify != nil {
+			return clarify
+		}
+		if res.Match != nil {
+			noteMentions(ctx, contactMentions(res.Match.Contact)...)
+		}
+		return SilentResult(res.Describe())
+	case "get", "create", "update":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+
+	sourceName, _ := args["source"].(string)
+	if sourceName == "" && action == "create" {
+		sourceName = "local"
+	}
+	source := t.directory.Source(sourceName)
+	if source == nil {
+		return ErrorResult(fmt.Sprintf("unknown or unconfigured contact source %q", sourceName))
+	}
+
+	id, _ := args["contact_id"].(string)
+	var contact *Contact
+	if action == "create" {
+		contact = &Contact{}
+	} else {
+		if id == "" {
+			return ErrorResult("contact_id is required")
+		}
+		existing, err := source.Get(ctx, id)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to load contact: %v", err)).WithError(err)
+		}
+		if action == "get" {
+			noteMentions(ctx, contactMentions(*existing)...)
+			return SilentResult(existing.format())
+		}
+		contact = existing
+	}
+
+	if v, ok := args["name"].(string); ok && v != "" {
+		contact.Name = v
+	}
+	if v, ok := stringListArg(args, "emails"); ok {
+		contact.Emails = v
+	}
+	if v, ok := stringListArg(args, "phones"); ok {
+		contact.Phones = v
+	}
+	if v, ok := args["organization"].(string); ok {
+		contact.Organization = v
+	}
+	if v, ok := args["notes"].(string); ok {
+		contact.Notes = v
+	}
+	if contact.Name == "" {
+		return ErrorResult("name is required")
+	}
+
+	saved, err := source.Save(ctx, contact)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save contact: %v", err)).WithError(err)
+	}
+	noteMentions(ctx, contactMentions(*saved)...)
+	return SilentResult(fmt.Sprintf("Contact saved:\n%s", saved.format()))
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestContactsTool_CreateAndSearchLocal verifies contacts saved locally can be found by partial name
+func TestContactsTool_CreateAndSearchLocal(t *testing.T) {
+	book := NewLocalAddressBook(filepath.Join(t.TempDir(), "contacts.json"))
+	tool := NewContactsTool(NewContactDirectory(book))
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "create",
+		"name":   "Ana Maria Silva",
+		"emails": []interface{}{"ana@example.com"},
+		"phones": []interface{}{"+55 11 99999-0000"},
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"action": "search",
+		"query":  "ana silva",
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "ana@example.com") {
+		t.Errorf("Expected contact in results, got: %s", result.ForLLM)
+	}
+}
+
+// TestContactDirectory_MergesAcrossSources verifies duplicates are merged by email or phone
+func TestContactDirectory_MergesAcrossSources(t *testing.T) {
+	dir := t.TempDir()
+	a := NewLocalAddressBook(filepath.Join(dir, "a.json"))
+	b := NewLocalAddressBook(filepath.Join(dir, "b.json"))
+	ctx := context.Background()
+	a.Save(ctx, &Contact{Name: "Bob Lee", Emails: []string{"bob@example.com"}})
+	b.Save(ctx, &Contact{Name: "Bob Lee", Emails: []string{"BOB@example.com"}, Phones: []string{"555-123-456"}})
+
+	contacts, err := NewContactDirectory(a, b).Search(ctx, "bob", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(contacts) != 1 {
+		t.Fatalf("Expected merged contact, got %+v", contacts)
+	}
+	if len(contacts[0].Phones) != 1 || len(contacts[0].Emails) != 1 {
+		t.Errorf("Expected phone merged without duplicate email, got %+v", contacts[0])
+	}
+}
+
+// TestCardDAVSource_Search verifies addressbook-query results are parsed from vCards
+func TestCardDAVSource_Search(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != "REPORT" || !strings.Contains(string(body), "carol") {
+			t.Errorf("Unexpected request %s: %s", r.Method, body)
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">
+ <d:response><d:href>/dav/book/carol.vcf</d:href>
+  <d:propstat><d:prop><d:getetag>"e1"</d:getetag>
+   <card:address-data>BEGIN:VCARD
+VERSION:3.0
+FN:Carol Diaz
+item1.EMAIL;TYPE=INTERNET:carol@example.com
+TEL;TYPE=CELL:+1 555 0100
+ORG:Acme;Sales
+NOTE:Met at the\, conference
+END:VCARD
+</card:address-data></d:prop></d:propstat>
+ </d:response>
+</d:multistatus>`))
+	}))
+	defer server.Close()
+
+	contacts, err := NewCardDAVSource(server.URL+"/dav/book", "", "").Search(context.Background(), "carol", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(contacts) != 1 {
+		t.Fatalf("Expected one contact, got %+v", contacts)
+	}
+	c := contacts[0]
+	if c.Name != "Carol Diaz" || c.ID != "/dav/book/carol.vcf" || c.Organization != "Acme Sales" {
+		t.Errorf("Unexpected contact: %+v", c)
+	}
+	if len(c.Emails) != 1 || c.Emails[0] != "carol@example.com" || c.Notes != "Met at the, conference" {
+		t.Errorf("Unexpected contact fields: %+v", c)
+	}
+}
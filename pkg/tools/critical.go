@@ -0,0 +1,571 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const criticalJobKind = "critical_reminder"
+
+// ChatDeliverer sends a message to a chat right away and reports whether
+// the channel took it. The bus sends in the background and cannot tell.
+type ChatDeliverer interface {
+	Deliver(ctx context.Context, channel, chatID, content string) error
+}
+
+// criticalMailer sends the email fallback; GmailClient implements it.
+type criticalMailer interface {
+	Send(ctx context.Context, e OutgoingEmail) (id, threadID string, err error)
+}
+
+// NotificationPolicy is where a chat's critical reminders go when the chat
+// itself fails or nobody answers there: Fallbacks in order, each given
+// AckMinutes (0 for the default) before the next is tried. A fallback is
+// "email:<address>", "sms:<phone>" or "<channel>:<chat ID>".
+type NotificationPolicy struct {
+	Fallbacks  []string `json:"fallbacks"`
+	AckMinutes int      `json:"ack_minutes,omitempty"`
+}
+
+// pendingCritical is a critical reminder that went out and was not
+// acknowledged yet. Routes are the chat and its fallbacks when it fired;
+// Step is the last one it was sent to.
+type pendingCritical struct {
+	Chat    string    `json:"chat"`
+	Message string    `json:"message"`
+	Routes  []string  `json:"routes"`
+	Step    int       `json:"step"`
+	Ack     int       `json:"ack_minutes"`
+	SentAt  time.Time `json:"sent_at"`
+	Failed  []string  `json:"failed,omitempty"`
+}
+
+// CriticalReminders keeps the notification policies of each chat and the
+// critical reminders waiting for an answer. The agent acknowledges them
+// when the user writes in the chat or in a fallback chat they reached.
+type CriticalReminders struct {
+	path string
+	mu   sync.Mutex
+	data struct {
+		Policies map[string]*NotificationPolicy `json:"policies"`
+		Pending  map[string]*pendingCritical    `json:"pending"`
+	}
+}
+
+// NewCriticalReminders loads the policies and pending reminders saved in
+// the workspace.
+func NewCriticalReminders(workspace string) *CriticalReminders {
+	s := &CriticalReminders{path: filepath.Join(workspace, "state", "critical.json")}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.data)
+	}
+	if s.data.Policies == nil {
+		s.data.Policies = make(map[string]*NotificationPolicy)
+	}
+	if s.data.Pending == nil {
+		s.data.Pending = make(map[string]*pendingCritical)
+	}
+	return s
+}
+
+// Policy returns the policy of a chat.
+func (s *CriticalReminders) Policy(chatKey string) (NotificationPolicy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.data.Policies[chatKey]; ok {
+		return *p, true
+	}
+	return NotificationPolicy{}, false
+}
+
+// SetPolicy replaces the policy of a chat; a nil policy removes it.
+func (s *CriticalReminders) SetPolicy(chatKey string, p *NotificationPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p == nil {
+		delete(s.data.Policies, chatKey)
+	} else {
+		s.data.Policies[chatKey] = p
+	}
+	return saveJSONAtomic(s.path, s.data)
+}
+
+// Acknowledge marks the reminders that reached chatKey, as the chat they
+// were set in or a fallback chat, as seen, so no further fallback is
+// tried. It returns how many there were.
+func (s *CriticalReminders) Acknowledge(chatKey string) int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, p := range s.data.Pending {
+		for i := 0; i <= p.Step && i < len(p.Routes); i++ {
+			if p.Routes[i] == chatKey {
+				delete(s.data.Pending, id)
+				n++
+				break
+			}
+		}
+	}
+	if n > 0 {
+		saveJSONAtomic(s.path, s.data)
+	}
+	return n
+}
+
+func (s *CriticalReminders) pending(id string) (pendingCritical, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.data.Pending[id]; ok {
+		return *p, true
+	}
+	return pendingCritical{}, false
+}
+
+func (s *CriticalReminders) savePending(id string, p *pendingCritical) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p == nil {
+		delete(s.data.Pending, id)
+	} else {
+		s.data.Pending[id] = p
+	}
+	return saveJSONAtomic(s.path, s.data)
+}
+
+// parseFallback checks a fallback route and returns it normalized.
+func parseFallback(route string) (string, error) {
+	kind, target, ok := strings.Cut(strings.TrimSpace(route), ":")
+	kind, target = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(target)
+	if !ok || kind == "" || target == "" {
+		return "", fmt.Errorf("fallback %q must be email:<address>, sms:<phone> or <channel>:<chat ID>", route)
+	}
+	switch kind {
+	case "email":
+		if !strings.Contains(target, "@") {
+			return "", fmt.Errorf("fallback %q is not an email address", route)
+		}
+	case "sms":
+		if len(normalizePhone(target)) < 7 {
+			return "", fmt.Errorf("fallback %q is not a phone number with country code", route)
+		}
+		target = "+" + normalizePhone(target)
+	}
+	return kind + ":" + target, nil
+}
+
+// CriticalReminderTool schedules reminders that must not be missed: they
+// go to the chat first and then, when it fails or nobody answers within
+// the window, to each fallback of the chat's notification policy.
+type CriticalReminderTool struct {
+	store      *CriticalReminders
+	deliverer  ChatDeliverer
+	profiles   *profile.Store
+	defaultAck time.Duration
+	mail       criticalMailer
+	sms        SMSSender
+	scheduler  *cron.CronService
+	now        func() time.Time
+}
+
+// NewCriticalReminderTool creates the tool. defaultAck is how long to wait
+// for an answer before trying the next fallback when the policy does not
+// say.
+func NewCriticalReminderTool(store *CriticalReminders, deliverer ChatDeliverer, profiles *profile.Store, defaultAck time.Duration) *CriticalReminderTool {
+	return &CriticalReminderTool{
+		store:      store,
+		deliverer:  deliverer,
+		profiles:   profiles,
+		defaultAck: defaultAck,
+		now:        time.Now,
+	}
+}
+
+// SetEmail enables email fallbacks, sent from the user's Gmail account.
+func (t *CriticalReminderTool) SetEmail(mail *GmailClient) {
+	if mail != nil {
+		t.mail = mail
+	}
+}
+
+// SetSMS enables SMS fallbacks.
+func (t *CriticalReminderTool) SetSMS(sms SMSSender) {
+	t.sms = sms
+}
+
+func (t *CriticalReminderTool) Name() string {
+	return "critical_reminder"
+}
+
+func (t *CriticalReminderTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *CriticalReminderTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "cancel", "set_policy", "clear_policy")
+}
+
+func (t *CriticalReminderTool) Description() string {
+	return "Reminders that must not be missed (medication, a flight, a deadline). They are sent to this chat even in quiet hours; if sending fails or the user does not reply within the window, they go to the next fallback of the chat's notification policy (email, SMS or another chat), one after another until the user replies. Use set_policy to choose the fallbacks, add to schedule a reminder. Use the cron tool for ordinary reminders."
+}
+
+func (t *CriticalReminderTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"add", "list", "cancel", "set_policy", "show_policy", "clear_policy"},
+				"description": "add schedules a critical reminder, list shows the scheduled and unanswered ones, cancel removes one, set_policy/show_policy/clear_policy manage the fallbacks",
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "For add: what to remind of",
+			},
+			"at": map[string]interface{}{
+				"type":        "string",
+				"description": "For add: when, as the user said it ('tomorrow at 8', 'in 2 hours') or as 2006-01-02 15:04, in the user's timezone",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "For cancel: the reminder ID from list",
+			},
+			"fallbacks": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "For set_policy: where to try next, in order: \"email:<address>\", \"sms:<phone with country code>\" or \"<channel>:<chat ID>\" (e.g. \"whatsapp:5511999990000@s.whatsapp.net\")",
+			},
+			"ack_minutes": map[string]interface{}{
+				"type":        "integer",
+				"description": "For set_policy: minutes to wait for a reply before trying the next fallback",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *CriticalReminderTool) JobKinds() []string {
+	return []string{criticalJobKind}
+}
+
+func (t *CriticalReminderTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *CriticalReminderTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("critical reminders need a chat to start from")
+	}
+	chatKey := channel + ":" + chatID
+
+	switch action {
+	case "set_policy":
+		fallbacks, _ := stringListArg(args, "fallbacks")
+		if len(fallbacks) == 0 {
+			return ErrorResult("fallbacks is required for set_policy")
+		}
+		policy := &NotificationPolicy{}
+		for _, f := range fallbacks {
+			route, err := parseFallback(f)
+			if err != nil {
+				return ErrorResult(err.Error())
+			}
+			switch {
+			case strings.HasPrefix(route, "email:") && t.mail == nil:
+				return ErrorResult("email fallbacks need Gmail to be set up")
+			case strings.HasPrefix(route, "sms:") && t.sms == nil:
+				return ErrorResult("SMS fallbacks need an SMS account in the config (tools.critical.sms)")
+			case route == chatKey:
+				return ErrorResult(fmt.Sprintf("%s is this chat, which is always tried first", f))
+			}
+			policy.Fallbacks = append(policy.Fallbacks, route)
+		}
+		if minutes, ok := args["ack_minutes"].(float64); ok {
+			if minutes < 1 {
+				return ErrorResult("ack_minutes must be at least 1")
+			}
+			policy.AckMinutes = int(minutes)
+		}
+		if err := t.store.SetPolicy(chatKey, policy); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save the policy: %v", err)).WithError(err)
+		}
+		return SilentResult("Notification policy saved. " + t.describePolicy(*policy))
+
+	case "show_policy":
+		policy, ok := t.store.Policy(chatKey)
+		if !ok {
+			return SilentResult("No notification policy: critical reminders only go to this chat.")
+		}
+		return SilentResult(t.describePolicy(policy))
+
+	case "clear_policy":
+		if err := t.store.SetPolicy(chatKey, nil); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save the policy: %v", err)).WithError(err)
+		}
+		return SilentResult("Notification policy removed: critical reminders only go to this chat.")
+
+	case "add":
+		return t.add(args, channel, chatID)
+
+	case "list":
+		return SilentResult(t.list(chatKey))
+
+	case "cancel":
+		id, _ := args["id"].(string)
+		if id == "" {
+			return ErrorResult("id is required for cancel")
+		}
+		if p, ok := t.store.pending(id); ok && p.Chat == chatKey {
+			t.store.savePending(id, nil)
+			t.removeJobs(id)
+			return SilentResult(fmt.Sprintf("Stopped critical reminder %s", id))
+		}
+		if t.scheduler != nil {
+			for _, job := range t.scheduler.ListJobs(true) {
+				if job.ID == id && job.Payload.Kind == criticalJobKind && job.Payload.Channel+":"+job.Payload.To == chatKey {
+					t.scheduler.RemoveJob(id)
+					return SilentResult(fmt.Sprintf("Cancelled critical reminder %s", id))
+				}
+			}
+		}
+		return ErrorResult(fmt.Sprintf("no critical reminder %s in this chat", id))
+	}
+	return ErrorResult(fmt.Sprintf("unknown action %q", action))
+}
+
+func (t *CriticalReminderTool) describePolicy(p NotificationPolicy) string {
+	return fmt.Sprintf("Critical reminders go to this chat, then %s, waiting %s for a reply before each next step.",
+		strings.Join(p.Fallbacks, ", then "), formatETA(t.ackWindow(p.AckMinutes)))
+}
+
+func (t *CriticalReminderTool) ackWindow(minutes int) time.Duration {
+	if minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return t.defaultAck
+}
+
+func (t *CriticalReminderTool) add(args map[string]interface{}, channel, chatID string) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("critical reminders are not available (scheduler not running)")
+	}
+	message, _ := args["message"].(string)
+	message = strings.TrimSpace(message)
+	atText, _ := args["at"].(string)
+	if message == "" || strings.TrimSpace(atText) == "" {
+		return ErrorResult("message and at are required for add")
+	}
+	prof := t.profiles.Get(channel + ":" + chatID)
+	now := t.now().In(prof.Location())
+	r, err := when.Parse(atText, now, prof.Locale)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if !r.HasTime {
+		r.Time = r.Time.Add(9 * time.Hour)
+	}
+	if !r.Time.After(now) {
+		return ErrorResult(fmt.Sprintf("%s is in the past", r.Time.Format("Mon 2 Jan 2006 15:04")))
+	}
+	atMS := r.Time.UnixMilli()
+	job, err := t.scheduler.AddJobWithPayload(utils.Truncate(message, 30), cron.CronSchedule{Kind: "at", AtMS: &atMS}, cron.CronPayload{
+		Kind:    criticalJobKind,
+		Message: message,
+		Channel: channel,
+		To:      chatID,
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to schedule the reminder: %v", err)).WithError(err)
+	}
+	out := fmt.Sprintf("Critical reminder %s set for %s.", job.ID, r.Time.Format("Mon 2 Jan 2006 15:04 MST"))
+	if policy, ok := t.store.Policy(channel + ":" + chatID); ok {
+		out += " If it is not answered, it goes to " + strings.Join(policy.Fallbacks, ", then ") + "."
+	} else {
+		out += " There is no notification policy, so it only goes to this chat; set one with set_policy to add fallbacks."
+	}
+	return SilentResult(out)
+}
+
+func (t *CriticalReminderTool) list(chatKey string) string {
+	var lines []string
+	if t.scheduler != nil {
+		for _, job := range t.scheduler.ListJobs(false) {
+			if job.Payload.Kind != criticalJobKind || job.Payload.Data["id"] != "" || job.Payload.Channel+":"+job.Payload.To != chatKey {
+				continue
+			}
+			due := ""
+			if job.State.NextRunAtMS != nil {
+				due = time.UnixMilli(*job.State.NextRunAtMS).In(t.profiles.Get(chatKey).Location()).Format("Mon 2 Jan 15:04")
+			}
+			lines = append(lines, fmt.Sprintf("- %s: %s (due %s)", job.ID, job.Payload.Message, due))
+		}
+	}
+	t.store.mu.Lock()
+	for id, p := range t.store.data.Pending {
+		if p.Chat == chatKey {
+			lines = append(lines, fmt.Sprintf("- %s: %s (not answered; last sent to %s at %s)", id, p.Message, p.Routes[p.Step], p.SentAt.Format("15:04")))
+		}
+	}
+	t.store.mu.Unlock()
+	if len(lines) == 0 {
+		return "No critical reminders."
+	}
+	sort.Strings(lines)
+	return "Critical reminders:\n" + strings.Join(lines, "\n")
+}
+
+// removeJobs drops the follow-ups scheduled for a pending reminder.
+func (t *CriticalReminderTool) removeJobs(id string) {
+	if t.scheduler == nil {
+		return
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == criticalJobKind && job.Payload.Data["id"] == id {
+			t.scheduler.RemoveJob(job.ID)
+		}
+	}
+}
+
+// ExecuteJob implements ScheduledTool. A reminder coming due goes to its
+// chat; a follow-up, when the reminder is still unanswered, goes to the
+// next fallback. The reminder is sent here, so nothing is returned.
+func (t *CriticalReminderTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	id := job.Payload.Data["id"]
+	var p pendingCritical
+	next := 0
+	if id == "" {
+		id = job.ID
+		chatKey := job.Payload.Channel + ":" + job.Payload.To
+		policy, _ := t.store.Policy(chatKey)
+		p = pendingCritical{
+			Chat:    chatKey,
+			Message: job.Payload.Message,
+			Routes:  append([]string{chatKey}, policy.Fallbacks...),
+			Ack:     int(t.ackWindow(policy.AckMinutes) / time.Minute),
+		}
+	} else {
+		var ok bool
+		if p, ok = t.store.pending(id); !ok {
+			// Answered since the last step
+			return "", nil
+		}
+		next = p.Step + 1
+	}
+
+	for i := next; i < len(p.Routes); i++ {
+		err := t.send(ctx, &p, i)
+		if err != nil {
+			logger.WarnCF("critical", "Critical reminder not delivered, trying the next fallback", map[string]interface{}{
+				"id":    id,
+				"route": p.Routes[i],
+				"error": err.Error(),
+			})
+			p.Failed = append(p.Failed, p.Routes[i])
+			continue
+		}
+		p.Step, p.SentAt = i, t.now()
+		if i == len(p.Routes)-1 {
+			// Nowhere left to go: stop waiting for the answer
+			return "", t.store.savePending(id, nil)
+		}
+		if err := t.store.savePending(id, &p); err != nil {
+			return "", err
+		}
+		atMS := p.SentAt.Add(time.Duration(p.Ack) * time.Minute).UnixMilli()
+		_, err = t.scheduler.AddJobWithPayload(job.Name, cron.CronSchedule{Kind: "at", AtMS: &atMS}, cron.CronPayload{
+			Kind:    criticalJobKind,
+			Message: p.Message,
+			Channel: job.Payload.Channel,
+			To:      job.Payload.To,
+			Data:    map[string]string{"id": id},
+		})
+		return "", err
+	}
+	t.store.savePending(id, nil)
+	return "", fmt.Errorf("critical reminder %q could not be delivered anywhere (tried %s)", utils.Truncate(p.Message, 30), strings.Join(p.Failed, ", "))
+}
+
+// send delivers the reminder on route i of p.
+func (t *CriticalReminderTool) send(ctx context.Context, p *pendingCritical, i int) error {
+	text := "⏰ " + p.Message
+	if i > 0 {
+		text = fmt.Sprintf("⏰ Reminder not answered in %s: %s\nReply here to stop further reminders.", p.Chat, p.Message)
+	}
+	kind, target, _ := strings.Cut(p.Routes[i], ":")
+	switch kind {
+	case "email":
+		if t.mail == nil {
+			return errors.New("email is not set up")
+		}
+		_, _, err := t.mail.Send(ctx, OutgoingEmail{
+			To:      []string{target},
+			Subject: "Reminder: " + utils.Truncate(p.Message, 60),
+			Body:    fmt.Sprintf("%s\n\nThis reminder was not answered in %s. Reply there to stop further reminders.", p.Message, p.Chat),
+		})
+		return err
+	case "sms":
+		if t.sms == nil {
+			return errors.New("SMS is not set up")
+		}
+		return t.sms.SendSMS(ctx, target, "Reminder: "+p.Message)
+	default:
+		return t.deliverer.Deliver(ctx, kind, target, text)
+	}
+}
+
+// ChatData implements ChatDataStore: the chat's notification policy and
+// the critical reminders set in it still waiting for an answer.
+func (s *CriticalReminders) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []pendingCritical
+	for _, p := range s.data.Pending {
+		if p.Chat == chatKey {
+			pending = append(pending, *p)
+		}
+	}
+	policy := s.data.Policies[chatKey]
+	if policy == nil && len(pending) == 0 {
+		return nil, nil
+	}
+	return snapshot(map[string]interface{}{"policy": policy, "pending": pending})
+}
+
+// PurgeChat implements ChatDataStore.
+func (s *CriticalReminders) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	if _, ok := s.data.Policies[chatKey]; ok {
+		delete(s.data.Policies, chatKey)
+		n++
+	}
+	for id, p := range s.data.Pending {
+		if p.Chat == chatKey {
+			delete(s.data.Pending, id)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, saveJSONAtomic(s.path, s.data)
+}
@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+type fakeDeliverer struct {
+	failing map[string]bool
+	sent    []string
+}
+
+func (d *fakeDeliverer) Deliver(ctx context.Context, channel, chatID, content string) error {
+	if d.failing[channel] {
+		return errors.New("channel down")
+	}
+	d.sent = append(d.sent, channel+":"+chatID)
+	return nil
+}
+
+type fakeSMS struct {
+	sent []string
+}
+
+func (s *fakeSMS) SendSMS(ctx context.Context, to, body string) error {
+	s.sent = append(s.sent, to+" "+body)
+	return nil
+}
+
+func newCriticalTestTool(t *testing.T, deliverer *fakeDeliverer) (*CriticalReminderTool, *cron.CronService, *fakeSMS) {
+	t.Helper()
+	dir := t.TempDir()
+	tool := NewCriticalReminderTool(NewCriticalReminders(dir), deliverer, profile.NewStore(dir), 15*time.Minute)
+	sms := &fakeSMS{}
+	tool.SetSMS(sms)
+	cs := cron.NewCronService(filepath.Join(dir, "cron.json"), nil)
+	tool.SetScheduler(cs)
+	return tool, cs, sms
+}
+
+// criticalFollowUp returns the follow-up job scheduled for a reminder.
+func criticalFollowUp(t *testing.T, cs *cron.CronService, id string) *cron.CronJob {
+	t.Helper()
+	for _, job := range cs.ListJobs(true) {
+		if job.Payload.Kind == criticalJobKind && job.Payload.Data["id"] == id {
+			return &job
+		}
+	}
+	t.Fatalf("no follow-up scheduled for %s", id)
+	return nil
+}
+
+// TestCriticalReminderTool_FallsBackWhenUnanswered verifies an unanswered reminder goes to the next fallback after the window
+func TestCriticalReminderTool_FallsBackWhenUnanswered(t *testing.T) {
+	deliverer := &fakeDeliverer{}
+	tool, cs, sms := newCriticalTestTool(t, deliverer)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action":      "set_policy",
+		"fallbacks":   []interface{}{"sms:+55 11 99999-0000", "whatsapp:5511999990000@s.whatsapp.net"},
+		"ack_minutes": float64(10),
+	})
+	if result.IsError {
+		t.Fatalf("set_policy failed: %s", result.ForLLM)
+	}
+
+	due := &cron.CronJob{ID: "r1", Payload: cron.CronPayload{Kind: criticalJobKind, Message: "Take the medicine", Channel: "telegram", To: "42"}}
+	if _, err := tool.ExecuteJob(context.Background(), due); err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if len(deliverer.sent) != 1 || deliverer.sent[0] != "telegram:42" {
+		t.Fatalf("Expected the reminder in the chat first, got %v", deliverer.sent)
+	}
+	followUp := criticalFollowUp(t, cs, "r1")
+	wait := time.Until(time.UnixMilli(*followUp.Schedule.AtMS))
+	if wait < 9*time.Minute || wait > 10*time.Minute {
+		t.Errorf("Expected the follow-up in 10 minutes, got %v", wait)
+	}
+
+	if _, err := tool.ExecuteJob(context.Background(), followUp); err != nil {
+		t.Fatalf("ExecuteJob() follow-up error: %v", err)
+	}
+	if len(sms.sent) != 1 || !strings.HasPrefix(sms.sent[0], "+5511999990000 ") || !strings.Contains(sms.sent[0], "Take the medicine") {
+		t.Errorf("Expected an SMS to the fallback number, got %v", sms.sent)
+	}
+}
+
+// TestCriticalReminderTool_AnswerStopsFallbacks verifies a reply in the chat acknowledges the reminder
+func TestCriticalReminderTool_AnswerStopsFallbacks(t *testing.T) {
+	deliverer := &fakeDeliverer{}
+	tool, cs, sms := newCriticalTestTool(t, deliverer)
+	tool.store.SetPolicy("telegram:42", &NotificationPolicy{Fallbacks: []string{"sms:+5511999990000"}})
+
+	due := &cron.CronJob{ID: "r1", Payload: cron.CronPayload{Kind: criticalJobKind, Message: "Flight at 7", Channel: "telegram", To: "42"}}
+	tool.ExecuteJob(context.Background(), due)
+	followUp := criticalFollowUp(t, cs, "r1")
+
+	if n := tool.store.Acknowledge("telegram:42"); n != 1 {
+		t.Fatalf("Expected one reminder acknowledged, got %d", n)
+	}
+	tool.ExecuteJob(context.Background(), followUp)
+	if len(sms.sent) != 0 {
+		t.Errorf("Expected no SMS after the answer, got %v", sms.sent)
+	}
+}
+
+// TestCriticalReminderTool_FailedDeliveryFallsBackAtOnce verifies a chat that cannot be reached is skipped right away
+func TestCriticalReminderTool_FailedDeliveryFallsBackAtOnce(t *testing.T) {
+	deliverer := &fakeDeliverer{failing: map[string]bool{"telegram": true}}
+	tool, _, sms := newCriticalTestTool(t, deliverer)
+	tool.store.SetPolicy("telegram:42", &NotificationPolicy{Fallbacks: []string{"sms:+5511999990000"}})
+
+	due := &cron.CronJob{ID: "r1", Payload: cron.CronPayload{Kind: criticalJobKind, Message: "Pay the rent", Channel: "telegram", To: "42"}}
+	if _, err := tool.ExecuteJob(context.Background(), due); err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if len(sms.sent) != 1 {
+		t.Errorf("Expected the SMS fallback right away, got %v", sms.sent)
+	}
+}
+
+// TestCriticalReminderTool_RejectsUnavailableFallbacks verifies email fallbacks need Gmail and routes are checked
+func TestCriticalReminderTool_RejectsUnavailableFallbacks(t *testing.T) {
+	tool, _, _ := newCriticalTestTool(t, &fakeDeliverer{})
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "set_policy", "fallbacks": []interface{}{"email:me@example.com"}})
+	if !result.IsError || !strings.Contains(result.ForLLM, "Gmail") {
+		t.Errorf("Expected a Gmail error, got: %s", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"action": "set_policy", "fallbacks": []interface{}{"pager"}})
+	if !result.IsError {
+		t.Errorf("Expected an invalid route error, got: %s", result.ForLLM)
+	}
+}
@@ -3,12 +3,16 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/webhooks"
+	"github.com/sipeed/picoclaw/pkg/when"
 )
 
 // JobExecutor is the interface for executing cron jobs through the agent
@@ -16,6 +20,10 @@ type JobExecutor interface {
 	ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
 }
 
+// JobKindHandler runs a tool-owned cron job. A non-empty return value is
+// delivered to the job's channel/chat.
+type JobKindHandler func(ctx context.Context, job *cron.CronJob) (string, error)
+
 // CronTool provides scheduling capabilities for the agent
 type CronTool struct {
 	cronService *cron.CronService
@@ -24,6 +32,9 @@ type CronTool struct {
 	execTool    *ExecTool
 	channel     string
 	chatID      string
+	handlers    map[string]JobKindHandler
+	profiles    *profile.Store
+	digest      *NotificationDigest
 	mu          sync.RWMutex
 }
 
@@ -37,17 +48,46 @@ func NewCronTool(cronService *cron.CronService, executor JobExecutor, msgBus *bu
 		executor:    executor,
 		msgBus:      msgBus,
 		execTool:    execTool,
+		handlers:    make(map[string]JobKindHandler),
 	}
 }
 
+// RegisterJobHandler routes jobs whose payload kind matches to handler
+// instead of the default agent-turn processing.
+func (t *CronTool) RegisterJobHandler(kind string, handler JobKindHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[kind] = handler
+}
+
+// SetProfiles makes cron expressions follow the user's timezone and holds
+// job output back during the user's quiet hours.
+func (t *CronTool) SetProfiles(store *profile.Store) {
+	t.profiles = store
+}
+
+// SetDigest lets chats in digest mode collect job output that is not
+// urgent into periodic summaries.
+func (t *CronTool) SetDigest(digest *NotificationDigest) {
+	t.digest = digest
+}
+
 // Name returns the tool name
 func (t *CronTool) Name() string {
 	return "cron"
 }
 
+func (t *CronTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *CronTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "remove", "enable", "disable")
+}
+
 // Description returns the tool description
 func (t *CronTool) Description() string {
-	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
+	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at' for one-time reminders, in the user's words (e.g., 'next Tuesday at 3pm', 'tomorrow morning', 'in 10 minutes'), or 'at_seconds' for a delay in seconds. Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
 }
 
 // Parameters returns the tool parameters schema
@@ -68,6 +108,10 @@ func (t *CronTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: Shell command to execute directly (e.g., 'df -h'). If set, the agent will run this command and report output instead of just showing the message. 'deliver' will be forced to false for commands.",
 			},
+			"at": map[string]interface{}{
+				"type":        "string",
+				"description": "One-time reminder: when to trigger, as the user said it ('next Tuesday at 3pm', 'tomorrow at 9', 'in 2 hours', 'May 20 at 18:00') or as 2006-01-02 15:04, in the user's timezone.",
+			},
 			"at_seconds": map[string]interface{}{
 				"type":        "integer",
 				"description": "One-time reminder: seconds from now when to trigger (e.g., 600 for 10 minutes later). Use this for one-time reminders like 'remind me in 10 minutes'.",
@@ -84,6 +128,10 @@ func (t *CronTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Job ID (for remove/enable/disable)",
 			},
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional (add): in a Telegram forum group, the ID of the topic to deliver to instead of the current one; \"0\" means the group's General topic",
+			},
 			"deliver": map[string]interface{}{
 				"type":        "boolean",
 				"description": "If true, send message directly to channel. If false, let agent process message (for complex tasks). Default: true",
@@ -140,14 +188,40 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 	}
 
 	var schedule cron.CronSchedule
+	// due says when a one-time job fires, for the confirmation
+	due := ""
 
-	// Check for at_seconds (one-time), every_seconds (recurring), or cron_expr
+	// Check for at / at_seconds (one-time), every_seconds (recurring), or cron_expr
+	atText, hasAtText := args["at"].(string)
 	atSeconds, hasAt := args["at_seconds"].(float64)
 	everySeconds, hasEvery := args["every_seconds"].(float64)
 	cronExpr, hasCron := args["cron_expr"].(string)
 
-	// Priority: at_seconds > every_seconds > cron_expr
-	if hasAt {
+	// Priority: at > at_seconds > every_seconds > cron_expr
+	if hasAtText && atText != "" {
+		var prof profile.Profile
+		if t.profiles != nil {
+			prof = t.profiles.Get(channel + ":" + chatID)
+		}
+		now := time.Now().In(prof.Location())
+		r, err := when.Parse(atText, now, prof.Locale)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if !r.HasTime {
+			// A day without a time: remind in the morning
+			r.Time = r.Time.Add(9 * time.Hour)
+		}
+		if !r.Time.After(now) {
+			return ErrorResult(fmt.Sprintf("%s is in the past", r.Time.Format("Mon 2 Jan 2006 15:04")))
+		}
+		atMS := r.Time.UnixMilli()
+		due = r.Time.Format("Mon 2 Jan 2006 15:04 MST")
+		schedule = cron.CronSchedule{
+			Kind: "at",
+			AtMS: &atMS,
+		}
+	} else if hasAt {
 		atMS := time.Now().UnixMilli() + int64(atSeconds)*1000
 		schedule = cron.CronSchedule{
 			Kind: "at",
@@ -164,8 +238,11 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 			Kind: "cron",
 			Expr: cronExpr,
 		}
+		if t.profiles != nil {
+			schedule.TZ = t.profiles.Get(channel + ":" + chatID).Timezone
+		}
 	} else {
-		return ErrorResult("one of at_seconds, every_seconds, or cron_expr is required")
+		return ErrorResult("one of at, at_seconds, every_seconds, or cron_expr is required")
 	}
 
 	// Read deliver parameter, default to true
@@ -183,6 +260,20 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 		deliver = false
 	}
 
+	// Forum topics share their group's ID before the "/", so a schedule
+	// made in one topic can be delivered in another of the same group
+	if topic, ok := args["topic"].(string); ok && strings.TrimSpace(topic) != "" {
+		topic = strings.TrimSpace(topic)
+		if strings.Contains(topic, "/") {
+			return ErrorResult(fmt.Sprintf("invalid topic %q", topic))
+		}
+		group, _, _ := strings.Cut(chatID, "/")
+		chatID = group
+		if topic != "0" {
+			chatID = group + "/" + topic
+		}
+	}
+
 	// Truncate message for job name (max 30 chars)
 	messagePreview := utils.Truncate(message, 30)
 
@@ -204,6 +295,9 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 		t.cronService.UpdateJob(job)
 	}
 
+	if due != "" {
+		return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s), due %s", job.Name, job.ID, due))
+	}
 	return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s)", job.Name, job.ID))
 }
 
@@ -276,6 +370,29 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 		chatID = "direct"
 	}
 
+	// Tool-owned job kinds (price alerts, etc.)
+	t.mu.RLock()
+	handler, ok := t.handlers[job.Payload.Kind]
+	t.mu.RUnlock()
+	if ok {
+		output, err := handler(ctx, job)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+		if output != "" {
+			t.notify(job.Payload.Kind, channel, chatID, output)
+		}
+		return "ok"
+	}
+
+	webhooks.Emit(webhooks.ReminderFired, map[string]interface{}{
+		"job_id":  job.ID,
+		"name":    job.Name,
+		"message": job.Payload.Message,
+		"channel": channel,
+		"chat_id": chatID,
+	})
+
 	// Execute command if present
 	if job.Payload.Command != "" {
 		args := map[string]interface{}{
@@ -290,24 +407,23 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 			output = fmt.Sprintf("Scheduled command '%s' executed:\n%s", job.Payload.Command, result.ForLLM)
 		}
 
-		t.msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: output,
-		})
+		t.publish(channel, chatID, output)
 		return "ok"
 	}
 
 	// If deliver=true, send message directly without agent processing
 	if job.Payload.Deliver {
-		t.msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: job.Payload.Message,
-		})
+		t.notify(job.Payload.Kind, channel, chatID, job.Payload.Message)
 		return "ok"
 	}
 
+	// Agent turns usually end in a message to the user, so run them once
+	// the quiet hours are over.
+	if until, quiet := t.profiles.QuietUntil(channel+":"+chatID, time.Now()); quiet {
+		t.deferJob(until, job.Payload.Message, false, channel, chatID)
+		return "deferred (quiet hours)"
+	}
+
 	// For deliver=false, process through agent (for complex tasks)
 	sessionKey := fmt.Sprintf("cron-%s", job.ID)
 
@@ -328,3 +444,72 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 	_ = response // Will be sent by AgentLoop
 	return "ok"
 }
+
+// notify sends the output of a job of kind to the chat, or keeps it for
+// the chat's digest when the chat batches that kind of notification.
+func (t *CronTool) notify(kind, channel, chatID, content string) {
+	if t.digest.Hold(channel+":"+chatID, kind, content) {
+		return
+	}
+	t.publish(channel, chatID, content)
+}
+
+// publish delivers scheduled output to the chat, holding it back until the
+// end of the user's quiet hours.
+func (t *CronTool) publish(channel, chatID, content string) {
+	if until, quiet := t.profiles.QuietUntil(channel+":"+chatID, time.Now()); quiet {
+		t.deferJob(until, content, true, channel, chatID)
+		return
+	}
+	t.msgBus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: content,
+	})
+}
+
+// deferJob schedules a one-time job at the end of the quiet hours.
+func (t *CronTool) deferJob(until time.Time, message string, deliver bool, channel, chatID string) {
+	atMS := until.UnixMilli()
+	_, err := t.cronService.AddJob(utils.Truncate(message, 30), cron.CronSchedule{Kind: "at", AtMS: &atMS},
+		message, deliver, channel, chatID)
+	if err != nil {
+		// Better to break the quiet hours than to lose the message
+		t.msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: message,
+		})
+	}
+}
+
+// chatJobs returns the jobs scheduled for the chat: its reminders and the
+// schedules tools keep for it.
+func (t *CronTool) chatJobs(chatKey string) []cron.CronJob {
+	var jobs []cron.CronJob
+	for _, job := range t.cronService.ListJobs(true) {
+		if job.Payload.Channel+":"+job.Payload.To == chatKey {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// ChatData implements ChatDataStore: the chat's scheduled jobs.
+func (t *CronTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	if jobs := t.chatJobs(chatKey); len(jobs) > 0 {
+		return jobs, nil
+	}
+	return nil, nil
+}
+
+// PurgeChat implements ChatDataStore.
+func (t *CronTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	n := 0
+	for _, job := range t.chatJobs(chatKey) {
+		if t.cronService.RemoveJob(job.ID) {
+			n++
+		}
+	}
+	return n, nil
+}
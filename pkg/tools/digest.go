@@ -0,0 +1,430 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const digestJobKind = "notification_digest"
+
+const (
+	// defaultDigestEvery is how often a digest is sent when the user does
+	// not say
+	defaultDigestEvery = 3 * time.Hour
+	// minDigestEvery keeps digests from becoming pings again
+	minDigestEvery = 15 * time.Minute
+	// maxDigestItems bounds what a chat's digest holds; the oldest items
+	// are dropped beyond it
+	maxDigestItems = 50
+	// maxDigestItemLen bounds each item's text in the summary
+	maxDigestItemLen = 600
+)
+
+// notificationCategories names the proactive messages a digest can hold
+// back, by the kind of the job sending them. Kinds not listed, such as
+// critical reminders, always go out at once.
+var notificationCategories = map[string]string{
+	"":                   "reminders",
+	newsDigestJobKind:    "news",
+	trackingWatchJobKind: "tracking",
+	priceAlertJobKind:    "price_alerts",
+	itineraryJobKind:     "travel",
+	invoiceInboxJobKind:  "invoices",
+	billsJobKind:         "bills",
+	habitNudgeJobKind:    "habits",
+	backupJobKind:        "backups",
+	reportJobKind:        "reports",
+	briefingJobKind:      "briefings",
+	meetingNotesJobKind:  "meetings",
+	automationJobKind:    "automations",
+	mailDigestKind:       "mail",
+}
+
+// defaultUrgent are the categories sent at once in digest mode unless the
+// user chooses others: they lose their point when late.
+var defaultUrgent = []string{"reminders", "price_alerts", "meetings"}
+
+// digestCategories lists the category names, sorted.
+func digestCategories() []string {
+	names := make([]string, 0, len(notificationCategories))
+	for _, name := range notificationCategories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isDigestCategory(name string) bool {
+	for _, category := range notificationCategories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
+
+// digestItem is a notification held for the next digest.
+type digestItem struct {
+	Category string    `json:"category"`
+	Content  string    `json:"content"`
+	At       time.Time `json:"at"`
+}
+
+// digestChat is a chat's digest mode: how often it gets a summary, the
+// categories still sent at once and what is waiting.
+type digestChat struct {
+	EveryMinutes int          `json:"every_minutes"`
+	Urgent       []string     `json:"urgent"`
+	JobID        string       `json:"job_id,omitempty"`
+	Pending      []digestItem `json:"pending,omitempty"`
+	Dropped      int          `json:"dropped,omitempty"`
+}
+
+func (c *digestChat) urgent(category string) bool {
+	for _, u := range c.Urgent {
+		if u == category {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationDigest holds low-priority proactive messages for chats in
+// digest mode and hands them out as one periodic summary, and holds them
+// for chats in a focus session until it ends. The scheduler asks it about
+// every message a job sends.
+type NotificationDigest struct {
+	path      string
+	focusPath string
+	now       func() time.Time
+	mu        sync.Mutex
+	chats     map[string]*digestChat
+	focus     map[string]*focusHold
+}
+
+// NewNotificationDigest loads the digest settings and held messages saved
+// in the workspace.
+func NewNotificationDigest(workspace string) *NotificationDigest {
+	d := &NotificationDigest{
+		path:      filepath.Join(workspace, "state", "digest.json"),
+		focusPath: filepath.Join(workspace, "state", "focus.json"),
+		now:       time.Now,
+		chats:     make(map[string]*digestChat),
+		focus:     make(map[string]*focusHold),
+	}
+	if data, err := os.ReadFile(d.path); err == nil {
+		json.Unmarshal(data, &d.chats)
+	}
+	if data, err := os.ReadFile(d.focusPath); err == nil {
+		json.Unmarshal(data, &d.focus)
+	}
+	return d
+}
+
+// Hold keeps content, sent by a job of jobKind, for the chat's next
+// digest, or for the end of its focus session. It reports false when the
+// message should go out now: the chat is neither in digest mode nor
+// focusing, or the category is urgent or not digestible.
+func (d *NotificationDigest) Hold(chatKey, jobKind, content string) bool {
+	if d == nil || strings.TrimSpace(content) == "" {
+		return false
+	}
+	category, ok := notificationCategories[jobKind]
+	if !ok {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.chats[chatKey]
+	if f := d.focus[chatKey]; f != nil && d.now().Before(f.Until) {
+		return d.holdForFocus(f, c, category, content)
+	}
+	if c == nil || c.urgent(category) {
+		return false
+	}
+	c.Pending = append(c.Pending, digestItem{Category: category, Content: content, At: d.now()})
+	if extra := len(c.Pending) - maxDigestItems; extra > 0 {
+		c.Pending = append(c.Pending[:0:0], c.Pending[extra:]...)
+		c.Dropped += extra
+	}
+	if err := saveJSONAtomic(d.path, d.chats); err != nil {
+		// Not held if it cannot be kept
+		c.Pending = c.Pending[:len(c.Pending)-1]
+		return false
+	}
+	return true
+}
+
+// Flush returns the summary of what the chat's digest holds and empties
+// it; empty when nothing is waiting.
+func (d *NotificationDigest) Flush(chatKey string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.chats[chatKey]
+	if c == nil || len(c.Pending) == 0 {
+		return ""
+	}
+	summary := digestSummary(c.Pending, c.Dropped)
+	c.Pending, c.Dropped = nil, 0
+	saveJSONAtomic(d.path, d.chats)
+	return summary
+}
+
+// digestSummary groups items by category, in the order each first came.
+func digestSummary(items []digestItem, dropped int) string {
+	var order []string
+	byCategory := map[string][]digestItem{}
+	for _, item := range items {
+		if _, seen := byCategory[item.Category]; !seen {
+			order = append(order, item.Category)
+		}
+		byCategory[item.Category] = append(byCategory[item.Category], item)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Digest: %d update", len(items))
+	if len(items) != 1 {
+		sb.WriteString("s")
+	}
+	fmt.Fprintf(&sb, " since %s", items[0].At.Format("Jan 2 15:04"))
+	for _, category := range order {
+		list := byCategory[category]
+		fmt.Fprintf(&sb, "\n\n%s (%d)", digestTitle(category), len(list))
+		for _, item := range list {
+			fmt.Fprintf(&sb, "\n• %s", utils.Truncate(strings.TrimSpace(item.Content), maxDigestItemLen))
+		}
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&sb, "\n\n(%d older updates were dropped)", dropped)
+	}
+	return sb.String()
+}
+
+func digestTitle(category string) string {
+	title := strings.ReplaceAll(category, "_", " ")
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+// DigestTool turns a chat's digest mode on and off. In digest mode,
+// proactive messages of categories that are not urgent are collected and
+// sent as one summary every so often instead of one ping each.
+type DigestTool struct {
+	digest    *NotificationDigest
+	scheduler *cron.CronService
+}
+
+func NewDigestTool(digest *NotificationDigest) *DigestTool {
+	return &DigestTool{digest: digest}
+}
+
+func (t *DigestTool) Name() string {
+	return "notification_digest"
+}
+
+func (t *DigestTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "on", "off")
+}
+
+func (t *DigestTool) Description() string {
+	return "Batch the low-priority notifications sent to this chat (news, tracking updates, backups, reports...) into one summary every few hours instead of separate pings. on turns digest mode on or changes it (every, urgent); urgent lists the categories still sent at once (default: reminders, price_alerts, meetings). off sends what is waiting and turns it off; send_now sends what is waiting; status shows the settings. Use it for requests like \"stop pinging me for every package update\" or \"bundle my notifications\"."
+}
+
+func (t *DigestTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"status", "on", "off", "send_now"},
+				"description": "Action to perform",
+			},
+			"every": map[string]interface{}{
+				"type":        "string",
+				"description": "For on: how often the digest is sent, e.g. \"3h\" or \"90m\" (default 3h, at least 15m)",
+			},
+			"urgent": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": digestCategories()},
+				"description": "For on: categories still sent at once; an empty list batches all of them",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *DigestTool) JobKinds() []string {
+	return []string{digestJobKind}
+}
+
+func (t *DigestTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *DigestTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	switch action {
+	case "status":
+		return SilentResult(t.status(chatKey))
+	case "send_now":
+		if summary := t.digest.Flush(chatKey); summary != "" {
+			return UserResult(summary)
+		}
+		return SilentResult("Nothing is waiting for the digest.")
+	case "off":
+		return t.off(chatKey)
+	case "on":
+		return t.on(args, channel, chatID)
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *DigestTool) on(args map[string]interface{}, channel, chatID string) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("digests are not available (scheduler not running)")
+	}
+	chatKey := channel + ":" + chatID
+	d := t.digest
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.chats[chatKey]
+	if c == nil {
+		c = &digestChat{EveryMinutes: int(defaultDigestEvery / time.Minute), Urgent: defaultUrgent}
+	}
+	every := time.Duration(c.EveryMinutes) * time.Minute
+	if s, _ := args["every"].(string); strings.TrimSpace(s) != "" {
+		parsed, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil || parsed < minDigestEvery {
+			return ErrorResult(fmt.Sprintf("invalid every %q: use a duration of at least 15m, such as 3h", s))
+		}
+		every = parsed
+	}
+	if _, ok := args["urgent"]; ok {
+		urgent, _ := stringListArg(args, "urgent")
+		for _, u := range urgent {
+			if !isDigestCategory(u) {
+				return ErrorResult(fmt.Sprintf("unknown category %q (categories: %s)", u, strings.Join(digestCategories(), ", ")))
+			}
+		}
+		c.Urgent = append([]string{}, urgent...)
+	}
+
+	if c.JobID == "" || every != time.Duration(c.EveryMinutes)*time.Minute {
+		if c.JobID != "" {
+			t.scheduler.RemoveJob(c.JobID)
+		}
+		everyMS := every.Milliseconds()
+		job, err := t.scheduler.AddJobWithPayload("Notification digest", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    digestJobKind,
+			Message: "Notification digest",
+			Channel: channel,
+			To:      chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("could not schedule the digest: %v", err)).WithError(err)
+		}
+		c.JobID = job.ID
+	}
+	c.EveryMinutes = int(every / time.Minute)
+	d.chats[chatKey] = c
+	if err := saveJSONAtomic(d.path, d.chats); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return SilentResult("Digest mode is on. " + describeDigest(c))
+}
+
+func (t *DigestTool) off(chatKey string) *ToolResult {
+	summary := t.digest.Flush(chatKey)
+	d := t.digest
+	d.mu.Lock()
+	c := d.chats[chatKey]
+	if c == nil {
+		d.mu.Unlock()
+		return SilentResult("Digest mode is not on in this chat.")
+	}
+	if c.JobID != "" && t.scheduler != nil {
+		t.scheduler.RemoveJob(c.JobID)
+	}
+	delete(d.chats, chatKey)
+	err := saveJSONAtomic(d.path, d.chats)
+	d.mu.Unlock()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if summary != "" {
+		return &ToolResult{ForLLM: "Digest mode is off; the waiting updates were sent.", ForUser: summary}
+	}
+	return SilentResult("Digest mode is off; notifications are sent as they come again.")
+}
+
+func (t *DigestTool) status(chatKey string) string {
+	d := t.digest
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.chats[chatKey]
+	if c == nil {
+		return "Digest mode is off: notifications are sent as they come. Categories: " + strings.Join(digestCategories(), ", ")
+	}
+	return fmt.Sprintf("Digest mode is on. %s %d update(s) waiting.", describeDigest(c), len(c.Pending))
+}
+
+func describeDigest(c *digestChat) string {
+	urgent := "none"
+	if len(c.Urgent) > 0 {
+		urgent = strings.Join(c.Urgent, ", ")
+	}
+	return fmt.Sprintf("A summary is sent every %s; sent at once: %s.", formatETA(time.Duration(c.EveryMinutes)*time.Minute), urgent)
+}
+
+// ExecuteJob implements ScheduledTool. It sends the chat's digest, if
+// anything is waiting.
+func (t *DigestTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.digest.Flush(job.Payload.Channel + ":" + job.Payload.To), nil
+}
+
+// ChatData implements ChatDataStore: the chat's digest settings and the
+// messages held for it.
+func (d *NotificationDigest) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, f := d.chats[chatKey], d.focus[chatKey]
+	if c == nil && f == nil {
+		return nil, nil
+	}
+	return snapshot(map[string]interface{}{"digest": c, "focus": f})
+}
+
+// PurgeChat implements ChatDataStore. Held messages are dropped unsent.
+func (d *NotificationDigest) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	if c, ok := d.chats[chatKey]; ok {
+		n += 1 + len(c.Pending)
+		delete(d.chats, chatKey)
+		if err := saveJSONAtomic(d.path, d.chats); err != nil {
+			return n, err
+		}
+	}
+	if f, ok := d.focus[chatKey]; ok {
+		n += 1 + len(f.Pending)
+		delete(d.focus, chatKey)
+		if err := saveJSONAtomic(d.focusPath, d.focus); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// TestDigestTool_BatchesLowPriorityNotifications verifies news and tracking output is held for the digest while urgent reminders go out at once, and the digest job sends one summary
+func TestDigestTool_BatchesLowPriorityNotifications(t *testing.T) {
+	workspace := t.TempDir()
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	msgBus := bus.NewMessageBus()
+	digest := NewNotificationDigest(workspace)
+	tool := NewDigestTool(digest)
+	tool.SetScheduler(cs)
+	cronTool := NewCronTool(cs, nil, msgBus, workspace, true, 0)
+	cronTool.SetDigest(digest)
+	for _, kind := range []string{newsDigestJobKind, trackingWatchJobKind} {
+		cronTool.RegisterJobHandler(kind, func(ctx context.Context, job *cron.CronJob) (string, error) {
+			return job.Payload.Message, nil
+		})
+	}
+	cronTool.RegisterJobHandler(digestJobKind, tool.ExecuteJob)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "on", "every": "2h"}); r.IsError || !strings.Contains(r.ForLLM, "every 2 h") {
+		t.Fatalf("on: %+v", r)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != digestJobKind || *jobs[0].Schedule.EveryMS != (2*time.Hour).Milliseconds() {
+		t.Fatalf("digest job not scheduled: %+v", jobs)
+	}
+
+	fire := func(kind, message string) {
+		cronTool.ExecuteJob(context.Background(), &cron.CronJob{ID: "x", Payload: cron.CronPayload{
+			Kind: kind, Message: message, Deliver: kind == "", Channel: "telegram", To: "42",
+		}})
+	}
+	fire(newsDigestJobKind, "Headlines: rates unchanged")
+	fire(trackingWatchJobKind, "Parcel LX123 out for delivery")
+	fire("", "Take the pills")
+
+	recv, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, ok := msgBus.SubscribeOutbound(recv); !ok || msg.Content != "Take the pills" {
+		t.Fatalf("urgent reminder not sent at once: %+v", msg)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "status"}); !strings.Contains(r.ForLLM, "2 update(s) waiting") {
+		t.Errorf("status: %s", r.ForLLM)
+	}
+
+	fire(digestJobKind, "Notification digest")
+	msg, ok := msgBus.SubscribeOutbound(recv)
+	if !ok || !strings.HasPrefix(msg.Content, "Digest: 2 updates") || !strings.Contains(msg.Content, "News (1)\n• Headlines") || !strings.Contains(msg.Content, "Tracking (1)") {
+		t.Fatalf("unexpected digest: %+v", msg)
+	}
+
+	// Urgent overrides and turning off
+	tool.Execute(ctx, map[string]interface{}{"action": "on", "urgent": []interface{}{"tracking"}})
+	fire(trackingWatchJobKind, "Parcel LX123 delivered")
+	if msg, ok := msgBus.SubscribeOutbound(recv); !ok || msg.Content != "Parcel LX123 delivered" {
+		t.Errorf("urgent category held: %+v", msg)
+	}
+	fire(newsDigestJobKind, "More headlines")
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "off"}); !strings.Contains(r.ForUser, "More headlines") || len(cs.ListJobs(true)) != 0 {
+		t.Errorf("off: %+v, jobs %d", r, len(cs.ListJobs(true)))
+	}
+}
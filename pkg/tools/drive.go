@@ -0,0 +1,711 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/dlp"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+// DriveFile is a file or folder in Google Drive.
+type DriveFile struct {
+	ID           string
+	Name         string
+	MimeType     string
+	WebViewLink  string
+	ModifiedTime time.Time
+	// ViewedTime is when the user last opened the file, if ever
+	ViewedTime time.Time
+	// Size is the storage the file uses; 0 for folders and Google Docs
+	Size    int64
+	Starred bool
+	// SharedBy and SharedTime say who shared the file with the user and
+	// when, for files in "Shared with me"
+	SharedBy   string
+	SharedTime time.Time
+	// Version goes up with every change to the file, its content or its
+	// metadata; ModifiedBy is who made the last one. Both are only set
+	// when asked for.
+	Version    string
+	ModifiedBy string
+}
+
+// GoogleDriveClient searches and writes Google Drive. Writes only need the
+// drive.file scope (files the app created); Search needs drive.readonly to
+// see the rest of the user's files.
+type GoogleDriveClient struct {
+	token     TokenFunc
+	baseURL   string
+	uploadURL string
+	client    *http.Client
+}
+
+func NewGoogleDriveClient(token TokenFunc) *GoogleDriveClient {
+	return &GoogleDriveClient{
+		token:     token,
+		baseURL:   "https://www.googleapis.com/drive/v3",
+		uploadURL: "https://www.googleapis.com/upload/drive/v3",
+		client:    newGoogleHTTPClient(2 * time.Minute),
+	}
+}
+
+func (c *GoogleDriveClient) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, c.client, method, c.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+type driveFileJSON struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+	WebViewLink  string `json:"webViewLink"`
+	ModifiedTime string `json:"modifiedTime"`
+	ViewedTime   string `json:"viewedByMeTime"`
+	Starred      bool   `json:"starred"`
+	MD5          string `json:"md5Checksum"`
+	SharedTime   string `json:"sharedWithMeTime"`
+	SharingUser  struct {
+		DisplayName string `json:"displayName"`
+		Email       string `json:"emailAddress"`
+	} `json:"sharingUser"`
+	LastModifyingUser struct {
+		DisplayName string `json:"displayName"`
+		Email       string `json:"emailAddress"`
+	} `json:"lastModifyingUser"`
+	// Drive sends int64 fields as strings
+	Size           json.Number `json:"size"`
+	QuotaBytesUsed json.Number `json:"quotaBytesUsed"`
+	Version        json.Number `json:"version"`
+}
+
+func (f driveFileJSON) toDriveFile() *DriveFile {
+	modified, _ := time.Parse(time.RFC3339, f.ModifiedTime)
+	viewed, _ := time.Parse(time.RFC3339, f.ViewedTime)
+	size, err := f.QuotaBytesUsed.Int64()
+	if err != nil || size == 0 {
+		size, _ = f.Size.Int64()
+	}
+	shared, _ := time.Parse(time.RFC3339, f.SharedTime)
+	sharedBy := f.SharingUser.DisplayName
+	if sharedBy == "" {
+		sharedBy = f.SharingUser.Email
+	}
+	modifiedBy := f.LastModifyingUser.DisplayName
+	if modifiedBy == "" {
+		modifiedBy = f.LastModifyingUser.Email
+	}
+	return &DriveFile{ID: f.ID, Name: f.Name, MimeType: f.MimeType, WebViewLink: f.WebViewLink, ModifiedTime: modified,
+		ViewedTime: viewed, Size: size, Starred: f.Starred, SharedBy: sharedBy, SharedTime: shared,
+		Version: f.Version.String(), ModifiedBy: modifiedBy}
+}
+
+func driveQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// EnsureFolder returns the folder named name inside parentID ("" for My
+// Drive), creating it if needed.
+func (c *GoogleDriveClient) EnsureFolder(ctx context.Context, parentID, name string) (*DriveFile, error) {
+	if parentID == "" {
+		parentID = "root"
+	}
+	found, err := c.FindFolder(ctx, parentID, name)
+	if err != nil || found != nil {
+		return found, err
+	}
+	var created driveFileJSON
+	payload := map[string]interface{}{
+		"name":     name,
+		"mimeType": "application/vnd.google-apps.folder",
+		"parents":  []string{parentID},
+	}
+	if err := c.do(ctx, http.MethodPost, "/files?supportsAllDrives=true&fields=id,name,mimeType,webViewLink", payload, &created); err != nil {
+		return nil, err
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoTrashDriveFile,
+		Description: fmt.Sprintf("created Drive folder %q", name),
+		Params:      map[string]string{"file_id": created.ID},
+	})
+	return created.toDriveFile(), nil
+}
+
+// FindFolder returns the folder named name inside parentID ("" for My
+// Drive), or nil if there is none.
+func (c *GoogleDriveClient) FindFolder(ctx context.Context, parentID, name string) (*DriveFile, error) {
+	if parentID == "" {
+		parentID = "root"
+	}
+	q := url.Values{}
+	q.Set("q", fmt.Sprintf("name = %s and %s in parents and mimeType = 'application/vnd.google-apps.folder' and trashed = false",
+		driveQuote(name), driveQuote(parentID)))
+	q.Set("fields", "files(id, name, mimeType, webViewLink)")
+	q.Set("supportsAllDrives", "true")
+	q.Set("includeItemsFromAllDrives", "true")
+	var found struct {
+		Files []driveFileJSON `json:"files"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/files?"+q.Encode(), nil, &found); err != nil {
+		return nil, err
+	}
+	if len(found.Files) == 0 {
+		return nil, nil
+	}
+	return found.Files[0].toDriveFile(), nil
+}
+
+// ListFolder returns everything directly inside folderID ("" for My
+// Drive), with sizes, reading as many pages as it takes.
+func (c *GoogleDriveClient) ListFolder(ctx context.Context, folderID string) ([]DriveFile, error) {
+	if folderID == "" {
+		folderID = "root"
+	}
+	var files []DriveFile
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("q", fmt.Sprintf("%s in parents and trashed = false", driveQuote(folderID)))
+		q.Set("fields", "nextPageToken, files(id, name, mimeType, webViewLink, modifiedTime, size, quotaBytesUsed)")
+		q.Set("pageSize", "1000")
+		q.Set("supportsAllDrives", "true")
+		q.Set("includeItemsFromAllDrives", "true")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		var resp struct {
+			NextPageToken string          `json:"nextPageToken"`
+			Files         []driveFileJSON `json:"files"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/files?"+q.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, f := range resp.Files {
+			files = append(files, *f.toDriveFile())
+		}
+		if resp.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// Upload creates a file in parentID ("" for My Drive). Files up to a few
+// megabytes, such as invoices, go in one multipart request; larger ones
+// through a resumable session, in chunks that survive a dropped
+// connection. Drive's checksum of the stored file is checked either way.
+func (c *GoogleDriveClient) Upload(ctx context.Context, parentID, name, mimeType string, data []byte) (*DriveFile, error) {
+	return c.upload(ctx, parentID, name, mimeType, "", data)
+}
+
+// UploadConverted is Upload into a Google Docs format: data, such as HTML
+// or CSV, becomes a Doc or Sheet of googleType that can be edited in
+// Drive.
+func (c *GoogleDriveClient) UploadConverted(ctx context.Context, parentID, name, mimeType, googleType string, data []byte) (*DriveFile, error) {
+	return c.upload(ctx, parentID, name, mimeType, googleType, data)
+}
+
+// UpdateContent replaces the content of fileID with data. A Google Doc or
+// Sheet is converted again from data, as UploadConverted does. Files
+// people may also edit in Drive are written with SafeUpdate instead.
+func (c *GoogleDriveClient) UpdateContent(ctx context.Context, fileID, mimeType string, data []byte) error {
+	_, err := c.updateContent(ctx, fileID, mimeType, data)
+	return err
+}
+
+// updateContent is UpdateContent, returning the file's new version.
+func (c *GoogleDriveClient) updateContent(ctx context.Context, fileID, mimeType string, data []byte) (string, error) {
+	if err := checkOutgoingFile(ctx, "Google Drive", fileID, int64(len(data)), data); err != nil {
+		return "", err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	reqURL := c.uploadURL + "/files/" + url.PathEscape(fileID) + "?uploadType=media&supportsAllDrives=true&fields=id,version"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, reqURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", mimeType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("update failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("update failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var updated driveFileJSON
+	json.Unmarshal(body, &updated)
+	return updated.Version.String(), nil
+}
+
+func (c *GoogleDriveClient) upload(ctx context.Context, parentID, name, mimeType, googleType string, data []byte) (*DriveFile, error) {
+	if err := checkOutgoingFile(ctx, "Google Drive", name, int64(len(data)), data); err != nil {
+		return nil, err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	meta := map[string]interface{}{"name": name}
+	if parentID != "" {
+		meta["parents"] = []string{parentID}
+	}
+	if googleType != "" {
+		meta["mimeType"] = googleType
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	var respBody []byte
+	if len(data) >= resumableThreshold {
+		respBody, err = c.uploadResumable(ctx, token, name, mimeType, metaJSON, bytes.NewReader(data), int64(len(data)))
+	} else if err = transfer.Pace(ctx, int64(len(data))); err == nil {
+		respBody, err = c.uploadMultipart(ctx, token, mimeType, metaJSON, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var created driveFileJSON
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return nil, fmt.Errorf("failed to parse upload response: %w", err)
+	}
+	if sum := md5.Sum(data); created.MD5 != "" && !strings.EqualFold(created.MD5, hex.EncodeToString(sum[:])) {
+		// Do not leave a corrupt copy behind
+		c.Trash(ctx, created.ID)
+		return nil, fmt.Errorf("upload of %s: %w", name, transfer.ErrChecksum)
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoTrashDriveFile,
+		Description: fmt.Sprintf("uploaded %q to Drive", name),
+		Params:      map[string]string{"file_id": created.ID},
+	})
+	return created.toDriveFile(), nil
+}
+
+const driveUploadFields = "fields=id,name,mimeType,webViewLink,md5Checksum,version"
+
+func (c *GoogleDriveClient) uploadMultipart(ctx context.Context, token, mimeType string, metaJSON, data []byte) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	part.Write(metaJSON)
+	part, _ = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {mimeType}})
+	part.Write(data)
+	mw.Close()
+
+	reqURL := c.uploadURL + "/files?uploadType=multipart&supportsAllDrives=true&" + driveUploadFields
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// UploadStream is Upload for a file read from r, of size bytes, that is
+// not in memory: it goes through a resumable session holding about one
+// chunk at a time, so files larger than the device's memory can be
+// copied into Drive.
+func (c *GoogleDriveClient) UploadStream(ctx context.Context, parentID, name, mimeType string, r io.Reader, size int64) (*DriveFile, error) {
+	if size < resumableThreshold {
+		data, err := io.ReadAll(io.LimitReader(r, resumableThreshold))
+		if err != nil {
+			return nil, err
+		}
+		return c.Upload(ctx, parentID, name, mimeType, data)
+	}
+	if err := checkOutgoingFile(ctx, "Google Drive", name, size, nil); err != nil {
+		return nil, err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	meta := map[string]interface{}{"name": name}
+	if parentID != "" {
+		meta["parents"] = []string{parentID}
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	sum := md5.New()
+	respBody, err := c.uploadResumable(ctx, token, name, mimeType, metaJSON, io.TeeReader(r, sum), size)
+	if err != nil {
+		return nil, err
+	}
+	var created driveFileJSON
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return nil, fmt.Errorf("failed to parse upload response: %w", err)
+	}
+	if created.MD5 != "" && !strings.EqualFold(created.MD5, hex.EncodeToString(sum.Sum(nil))) {
+		c.Trash(ctx, created.ID)
+		return nil, fmt.Errorf("upload of %s: %w", name, transfer.ErrChecksum)
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoTrashDriveFile,
+		Description: fmt.Sprintf("uploaded %q to Drive", name),
+		Params:      map[string]string{"file_id": created.ID},
+	})
+	return created.toDriveFile(), nil
+}
+
+// uploadResumable opens a resumable session and hands it to the transfer
+// manager, which sends the chunks. A reader that is not an io.ReaderAt is
+// read once, as a stream.
+func (c *GoogleDriveClient) uploadResumable(ctx context.Context, token, name, mimeType string, metaJSON []byte, r io.Reader, size int64) ([]byte, error) {
+	reqURL := c.uploadURL + "/files?uploadType=resumable&supportsAllDrives=true&" + driveUploadFields
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(metaJSON))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Type", mimeType)
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Location") == "" {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("upload failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	session := &driveUploadSession{url: resp.Header.Get("Location"), token: token}
+	if ra, ok := r.(io.ReaderAt); ok {
+		return transfer.Upload(ctx, name, ra, size, session)
+	}
+	return transfer.UploadStream(ctx, name, r, size, session)
+}
+
+// Open fetches a file's metadata and starts downloading it. Binary files
+// come as they are, resuming after a dropped connection and checked
+// against Drive's checksum; Docs, Sheets and Slides are exported to
+// Office formats, whose name gets the matching extension and whose size
+// is not known (-1).
+func (c *GoogleDriveClient) Open(ctx context.Context, fileID string) (*DriveFile, io.ReadCloser, error) {
+	var meta driveFileJSON
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"?supportsAllDrives=true&fields=id,name,mimeType,size,md5Checksum,webViewLink", nil, &meta); err != nil {
+		return nil, nil, err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	file := meta.toDriveFile()
+	d := transfer.Download{Name: file.Name, Size: file.Size, MD5: meta.MD5}
+	reqURL := c.baseURL + "/files/" + url.PathEscape(fileID) + "?alt=media&supportsAllDrives=true"
+	if export, ok := driveExportFormats[meta.MimeType]; ok {
+		reqURL = c.baseURL + "/files/" + url.PathEscape(fileID) + "/export?mimeType=" + url.QueryEscape(export[0])
+		file.Name = strings.TrimSuffix(file.Name, export[1]) + export[1]
+		file.MimeType = export[0]
+		d = transfer.Download{Name: file.Name, Size: -1}
+	} else if strings.HasPrefix(meta.MimeType, "application/vnd.google-apps.") {
+		return nil, nil, fmt.Errorf("%s is a %s, which cannot be downloaded", file.Name, strings.TrimPrefix(meta.MimeType, "application/vnd.google-apps."))
+	}
+	d.Open = openDownload(reqURL, token)
+	body, err := transfer.Open(ctx, d)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, body, nil
+}
+
+// maxPDFExport is the most Drive exports from a Google Doc.
+const maxPDFExport = 10 << 20
+
+// ConvertToPDF has Drive lay out an HTML page as a PDF: it is imported as
+// a temporary Google Doc, exported and deleted again, so nothing of it is
+// left in Drive or the undo history.
+func (c *GoogleDriveClient) ConvertToPDF(ctx context.Context, name string, html []byte) ([]byte, error) {
+	if err := checkOutgoingFile(ctx, "Google Drive", name, int64(len(html)), html); err != nil {
+		return nil, err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metaJSON, _ := json.Marshal(map[string]interface{}{"name": name, "mimeType": googleDocType})
+	respBody, err := c.uploadMultipart(ctx, token, "text/html", metaJSON, html)
+	if err != nil {
+		return nil, err
+	}
+	var doc driveFileJSON
+	if err := json.Unmarshal(respBody, &doc); err != nil || doc.ID == "" {
+		return nil, fmt.Errorf("failed to parse upload response: %s", strings.TrimSpace(string(respBody)))
+	}
+	defer func() {
+		if err := c.Delete(context.WithoutCancel(ctx), doc.ID); err != nil {
+			logger.WarnCF("tools", "Failed to delete a temporary Doc", map[string]interface{}{"file_id": doc.ID, "error": err.Error()})
+		}
+	}()
+
+	reqURL := c.baseURL + "/files/" + url.PathEscape(doc.ID) + "/export?mimeType=application%2Fpdf"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("export failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPDFExport+1))
+	if err != nil {
+		return nil, fmt.Errorf("export failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if len(data) > maxPDFExport {
+		return nil, fmt.Errorf("%s is larger than the %s Drive exports", name, formatFileSize(maxPDFExport))
+	}
+	return data, nil
+}
+
+// Trash moves a file or folder to the trash, where it stays restorable
+// for 30 days.
+func (c *GoogleDriveClient) Trash(ctx context.Context, fileID string) error {
+	return c.do(ctx, http.MethodPatch, "/files/"+url.PathEscape(fileID)+"?supportsAllDrives=true", map[string]interface{}{"trashed": true}, nil)
+}
+
+// Delete removes a file the app made for good, without the trash.
+func (c *GoogleDriveClient) Delete(ctx context.Context, fileID string) error {
+	return c.do(ctx, http.MethodDelete, "/files/"+url.PathEscape(fileID)+"?supportsAllDrives=true", nil, nil)
+}
+
+// Share gives email read access to fileID; Drive emails them the link.
+func (c *GoogleDriveClient) Share(ctx context.Context, fileID, email string) error {
+	payload := map[string]string{"type": "user", "role": "reader", "emailAddress": email}
+	return c.do(ctx, http.MethodPost, "/files/"+url.PathEscape(fileID)+"/permissions?supportsAllDrives=true&sendNotificationEmail=true", payload, nil)
+}
+
+// StorageQuota is the storage of the Google account, which Drive, Gmail
+// and Google Photos share.
+type StorageQuota struct {
+	// Limit is 0 for accounts without one
+	Limit int64
+	Usage int64
+	// Drive is the part Drive files take; the rest is Gmail and Photos
+	Drive int64
+}
+
+// String describes the quota, such as "12.1 GB of 15.0 GB used (80%);
+// Gmail and Photos take 9.0 GB".
+func (q StorageQuota) String() string {
+	out := formatFileSize(q.Usage) + " used, no limit"
+	if q.Limit > 0 {
+		out = fmt.Sprintf("%s of %s used (%d%%)", formatFileSize(q.Usage), formatFileSize(q.Limit), q.Usage*100/q.Limit)
+	}
+	if q.Drive > 0 && q.Usage > q.Drive {
+		out += fmt.Sprintf("; Gmail and Photos take %s", formatFileSize(q.Usage-q.Drive))
+	}
+	return out
+}
+
+// StorageQuota returns the account's storage use. Any Drive scope,
+// drive.file included, may read it.
+func (c *GoogleDriveClient) StorageQuota(ctx context.Context) (*StorageQuota, error) {
+	var about struct {
+		StorageQuota struct {
+			Limit        string `json:"limit"`
+			Usage        string `json:"usage"`
+			UsageInDrive string `json:"usageInDrive"`
+		} `json:"storageQuota"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/about?fields=storageQuota", nil, &about); err != nil {
+		return nil, err
+	}
+	q := &StorageQuota{}
+	q.Limit, _ = strconv.ParseInt(about.StorageQuota.Limit, 10, 64)
+	q.Usage, _ = strconv.ParseInt(about.StorageQuota.Usage, 10, 64)
+	q.Drive, _ = strconv.ParseInt(about.StorageQuota.UsageInDrive, 10, 64)
+	return q, nil
+}
+
+// checkOutgoingFile runs an upload past the content policy in ctx, if
+// any. size is -1 when unknown.
+func checkOutgoingFile(ctx context.Context, destination, name string, size int64, data []byte) error {
+	return dlp.FromContext(ctx).Check(dlp.Item{
+		Kind:        dlp.KindUpload,
+		Destination: destination,
+		Attachments: []dlp.Attachment{{Name: name, Size: size, Data: data}},
+	}, nil)
+}
+
+// Search returns files whose name or content matches query, in Drive's
+// relevance order (full-text queries cannot be sorted).
+func (c *GoogleDriveClient) Search(ctx context.Context, query string, max int) ([]DriveFile, error) {
+	q := url.Values{}
+	q.Set("q", fmt.Sprintf("fullText contains %s and trashed = false", driveQuote(query)))
+	q.Set("fields", "files(id, name, mimeType, webViewLink, modifiedTime)")
+	q.Set("pageSize", fmt.Sprint(max))
+	q.Set("supportsAllDrives", "true")
+	q.Set("includeItemsFromAllDrives", "true")
+	var resp struct {
+		Files []driveFileJSON `json:"files"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/files?"+q.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	files := make([]DriveFile, len(resp.Files))
+	for i, f := range resp.Files {
+		files[i] = *f.toDriveFile()
+	}
+	return files, nil
+}
+
+// SearchNames returns files whose name contains every one of words, most
+// recently modified first. Drive matches words by prefix, so "budg" finds
+// "Budget 2026".
+func (c *GoogleDriveClient) SearchNames(ctx context.Context, words []string, max int) ([]DriveFile, error) {
+	clauses := []string{"trashed = false"}
+	for _, w := range words {
+		clauses = append(clauses, "name contains "+driveQuote(w))
+	}
+	return c.list(ctx, strings.Join(clauses, " and "), "modifiedTime desc", driveListFields, max)
+}
+
+// Starred returns the files the user starred, most recently modified
+// first.
+func (c *GoogleDriveClient) Starred(ctx context.Context, max int) ([]DriveFile, error) {
+	return c.list(ctx, "starred = true and trashed = false", "modifiedTime desc", driveListFields, max)
+}
+
+// Recent returns the files the user opened or changed most recently,
+// folders left out, as Drive's "Recent" view does.
+func (c *GoogleDriveClient) Recent(ctx context.Context, max int) ([]DriveFile, error) {
+	return c.list(ctx, "trashed = false and mimeType != 'application/vnd.google-apps.folder'", "recency desc", driveListFields, max)
+}
+
+// SharedWithMe returns the files others shared with the user, most
+// recently shared first, with who shared them.
+func (c *GoogleDriveClient) SharedWithMe(ctx context.Context, max int) ([]DriveFile, error) {
+	return c.list(ctx, "sharedWithMe and trashed = false", "sharedWithMeTime desc", driveSharedFields, max)
+}
+
+const (
+	// driveListFields are the fields of each file list asks for
+	driveListFields = "id, name, mimeType, webViewLink, modifiedTime, viewedByMeTime, starred, size, quotaBytesUsed"
+	// driveSharedFields add who shared a file and when
+	driveSharedFields = driveListFields + ", sharedWithMeTime, sharingUser"
+)
+
+// list returns up to max files matching query, in orderBy order.
+func (c *GoogleDriveClient) list(ctx context.Context, query, orderBy, fields string, max int) ([]DriveFile, error) {
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("orderBy", orderBy)
+	q.Set("fields", "files("+fields+")")
+	q.Set("pageSize", fmt.Sprint(max))
+	q.Set("supportsAllDrives", "true")
+	q.Set("includeItemsFromAllDrives", "true")
+	var resp struct {
+		Files []driveFileJSON `json:"files"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/files?"+q.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	files := make([]DriveFile, len(resp.Files))
+	for i, f := range resp.Files {
+		files[i] = *f.toDriveFile()
+	}
+	return files, nil
+}
+
+// SetStarred stars or unstars a file. Files the app did not create need
+// the full drive scope.
+func (c *GoogleDriveClient) SetStarred(ctx context.Context, fileID string, starred bool) (*DriveFile, error) {
+	var updated driveFileJSON
+	path := "/files/" + url.PathEscape(fileID) + "?supportsAllDrives=true&fields=id,name,mimeType,webViewLink,starred"
+	if err := c.do(ctx, http.MethodPatch, path, map[string]interface{}{"starred": starred}, &updated); err != nil {
+		return nil, err
+	}
+	verb := "starred"
+	if !starred {
+		verb = "unstarred"
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoStarDriveFile,
+		Description: fmt.Sprintf("%s Drive file %q", verb, updated.Name),
+		Params:      map[string]string{"file_id": fileID, "starred": strconv.FormatBool(!starred)},
+	})
+	return updated.toDriveFile(), nil
+}
+
+// Get returns a file's metadata.
+func (c *GoogleDriveClient) Get(ctx context.Context, fileID string) (*DriveFile, error) {
+	var meta driveFileJSON
+	path := "/files/" + url.PathEscape(fileID) + "?supportsAllDrives=true&fields=" + url.QueryEscape(driveSharedFields)
+	if err := c.do(ctx, http.MethodGet, path, nil, &meta); err != nil {
+		return nil, err
+	}
+	return meta.toDriveFile(), nil
+}
+
+// AddShortcut puts a shortcut to targetID in parentID ("" for My Drive),
+// which is how a file shared with the user gets a place in their folders.
+// Shortcuts made by the app only need the drive.file scope.
+func (c *GoogleDriveClient) AddShortcut(ctx context.Context, targetID, parentID, name string) (*DriveFile, error) {
+	if parentID == "" {
+		parentID = "root"
+	}
+	var created driveFileJSON
+	payload := map[string]interface{}{
+		"name":            name,
+		"mimeType":        "application/vnd.google-apps.shortcut",
+		"parents":         []string{parentID},
+		"shortcutDetails": map[string]string{"targetId": targetID},
+	}
+	if err := c.do(ctx, http.MethodPost, "/files?supportsAllDrives=true&fields=id,name,mimeType,webViewLink", payload, &created); err != nil {
+		return nil, err
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoTrashDriveFile,
+		Description: fmt.Sprintf("added a Drive shortcut to %q", name),
+		Params:      map[string]string{"file_id": created.ID},
+	})
+	return created.toDriveFile(), nil
+}
@@ -0,0 +1,439 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDiffBytes bounds each version read for a comparison, and text
+	// files read with ReadText
+	maxDiffBytes = 2 << 20
+	// maxDiffEdits is how many changed lines a comparison works through
+	// before calling two versions too different to compare
+	maxDiffEdits = 4000
+	// maxDiffOutput bounds the report; later changes are only counted
+	maxDiffOutput = 6000
+	// maxDiffLine is how much of a changed line the report shows
+	maxDiffLine = 400
+)
+
+// DriveRevision is a stored version of a Drive file. Google Docs, Sheets
+// and Slides revisions are read through ExportLinks, by format.
+type DriveRevision struct {
+	ID          string
+	Modified    time.Time
+	Author      string
+	MimeType    string
+	ExportLinks map[string]string
+}
+
+// Revisions returns the versions Drive keeps of a file, oldest first; the
+// last one is the current content.
+func (c *GoogleDriveClient) Revisions(ctx context.Context, fileID string) ([]DriveRevision, error) {
+	var revisions []DriveRevision
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("fields", "nextPageToken, revisions(id, modifiedTime, mimeType, exportLinks, lastModifyingUser(displayName, emailAddress))")
+		q.Set("pageSize", "1000")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		var resp struct {
+			NextPageToken string `json:"nextPageToken"`
+			Revisions     []struct {
+				ID                string            `json:"id"`
+				ModifiedTime      string            `json:"modifiedTime"`
+				MimeType          string            `json:"mimeType"`
+				ExportLinks       map[string]string `json:"exportLinks"`
+				LastModifyingUser struct {
+					DisplayName  string `json:"displayName"`
+					EmailAddress string `json:"emailAddress"`
+				} `json:"lastModifyingUser"`
+			} `json:"revisions"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/revisions?"+q.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Revisions {
+			modified, _ := time.Parse(time.RFC3339, r.ModifiedTime)
+			author := r.LastModifyingUser.DisplayName
+			if author == "" {
+				author = r.LastModifyingUser.EmailAddress
+			}
+			revisions = append(revisions, DriveRevision{ID: r.ID, Modified: modified, Author: author, MimeType: r.MimeType, ExportLinks: r.ExportLinks})
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].Modified.Before(revisions[j].Modified) })
+	return revisions, nil
+}
+
+// RevisionText returns the text of one version of a file of type
+// mimeType: Google Docs editor files exported as text or CSV, and text
+// files as they are. Other files (PDFs, Office documents, images) have
+// no text to compare.
+func (c *GoogleDriveClient) RevisionText(ctx context.Context, fileID, mimeType string, rev DriveRevision) (string, error) {
+	reqURL := c.baseURL + "/files/" + url.PathEscape(fileID) + "/revisions/" + url.PathEscape(rev.ID) + "?alt=media"
+	if export, ok := googleExportTypes[mimeType]; ok {
+		link := rev.ExportLinks[export]
+		u, err := url.Parse(link)
+		if link == "" || err != nil {
+			return "", fmt.Errorf("Drive offers no %s export of the version of %s", export, rev.Modified.In(time.Local).Format("2 Jan 15:04"))
+		}
+		// The link carries the user's token, so it must stay with Google
+		if host := u.Hostname(); u.Scheme != "https" || (host != "docs.google.com" && !strings.HasSuffix(host, ".googleapis.com")) {
+			return "", fmt.Errorf("unexpected export link %s", link)
+		}
+		reqURL = link
+	} else if !isTextMimeType(mimeType) {
+		return "", fmt.Errorf("only Google Docs, Sheets, Slides and text files can be compared, not %s", mimeType)
+	}
+
+	return c.getText(ctx, reqURL)
+}
+
+// ReadText returns a file's text: Google Docs editor files exported as
+// text (Sheets as CSV of the first sheet) and text files as they are.
+func (c *GoogleDriveClient) ReadText(ctx context.Context, fileID string) (*DriveFile, string, error) {
+	var meta driveFileJSON
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"?supportsAllDrives=true&fields=id,name,mimeType,webViewLink,version,modifiedTime,lastModifyingUser", nil, &meta); err != nil {
+		return nil, "", err
+	}
+	reqURL := c.baseURL + "/files/" + url.PathEscape(fileID) + "?alt=media&supportsAllDrives=true"
+	if export, ok := googleExportTypes[meta.MimeType]; ok {
+		reqURL = c.baseURL + "/files/" + url.PathEscape(fileID) + "/export?mimeType=" + url.QueryEscape(export)
+	} else if !isTextMimeType(meta.MimeType) {
+		return nil, "", fmt.Errorf("%s is a %s file, which has no text to read", meta.Name, meta.MimeType)
+	}
+	text, err := c.getText(ctx, reqURL)
+	if err != nil {
+		return nil, "", err
+	}
+	return meta.toDriveFile(), text, nil
+}
+
+// getText downloads a text of at most maxDiffBytes.
+func (c *GoogleDriveClient) getText(ctx context.Context, reqURL string) (string, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDiffBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &APIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if len(data) > maxDiffBytes {
+		return "", fmt.Errorf("the file is larger than %s", formatFileSize(maxDiffBytes))
+	}
+	return string(data), nil
+}
+
+func isTextMimeType(mimeType string) bool {
+	switch mimeType {
+	case "application/json", "application/xml", "application/x-yaml", "application/yaml", "application/javascript", "application/x-sh":
+		return true
+	}
+	return strings.HasPrefix(mimeType, "text/")
+}
+
+// diffOp is one line (or word) of a diff: kept (' '), removed ('-') or
+// added ('+').
+type diffOp struct {
+	Kind byte
+	Text string
+}
+
+// diffStrings compares a and b with Myers' algorithm and returns the
+// shortest edit turning a into b. ok is false when that takes more than
+// maxEdits insertions and deletions.
+func diffStrings(a, b []string, maxEdits int) (ops []diffOp, ok bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds v[-d..d] after d edits, to walk the path back
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return diffBacktrack(a, b, trace, d), true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	return nil, false
+}
+
+func diffBacktrack(a, b []string, trace [][]int, d int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// diffLines splits exported text into the lines worth comparing:
+// trailing spaces and blank lines, which Docs exports between every
+// paragraph, are dropped.
+func diffLines(text string) []string {
+	text = strings.TrimPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "\ufeff")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimRight(line, " \t"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// wordDiff shows how line old became new, marking removed words [-so-]
+// and added ones {+so+}. similar is false when the lines share less than
+// half their words, which reads better as one line removed and another
+// added.
+func wordDiff(old, new string) (diff string, similar bool) {
+	oldWords, newWords := strings.Fields(old), strings.Fields(new)
+	ops, ok := diffStrings(oldWords, newWords, 200)
+	if !ok {
+		return "", false
+	}
+	var sb strings.Builder
+	kept := 0
+	for i := 0; i < len(ops); {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		kind := ops[i].Kind
+		var words []string
+		for ; i < len(ops) && ops[i].Kind == kind; i++ {
+			words = append(words, ops[i].Text)
+		}
+		switch kind {
+		case '-':
+			fmt.Fprintf(&sb, "[-%s-]", strings.Join(words, " "))
+		case '+':
+			fmt.Fprintf(&sb, "{+%s+}", strings.Join(words, " "))
+		default:
+			kept += len(words)
+			sb.WriteString(strings.Join(words, " "))
+		}
+	}
+	return truncateSnippet(sb.String(), 2*maxDiffLine), 2*kept >= max(len(oldWords), len(newWords))
+}
+
+// FormatTextDiff summarizes how text old became new: a count of edited,
+// added and removed lines, then each change after the line it follows.
+// Edited lines are shown word by word.
+func FormatTextDiff(old, new string) string {
+	ops, ok := diffStrings(diffLines(old), diffLines(new), maxDiffEdits)
+	if !ok {
+		return fmt.Sprintf("The versions differ in more than %d lines, too much to compare line by line; the document was largely rewritten.", maxDiffEdits)
+	}
+	var sb strings.Builder
+	edited, added, removed, hidden := 0, 0, 0, 0
+	after := ""
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			after = ops[i].Text
+			i++
+			continue
+		}
+		var dels, ins []string
+		for ; i < len(ops) && ops[i].Kind != ' '; i++ {
+			if ops[i].Kind == '-' {
+				dels = append(dels, ops[i].Text)
+			} else {
+				ins = append(ins, ops[i].Text)
+			}
+		}
+		// Lines replaced one for one are edits, if they stayed similar
+		pairs := min(len(dels), len(ins))
+		var edits, gone, fresh []string
+		for j := 0; j < pairs; j++ {
+			if diff, similar := wordDiff(dels[j], ins[j]); similar {
+				edits = append(edits, diff)
+			} else {
+				gone, fresh = append(gone, dels[j]), append(fresh, ins[j])
+			}
+		}
+		gone, fresh = append(gone, dels[pairs:]...), append(fresh, ins[pairs:]...)
+		edited += len(edits)
+		removed += len(gone)
+		added += len(fresh)
+
+		var hunk strings.Builder
+		if after == "" {
+			hunk.WriteString("\n\nAt the start:")
+		} else {
+			fmt.Fprintf(&hunk, "\n\nAfter %q:", truncateSnippet(after, 80))
+		}
+		for _, diff := range edits {
+			fmt.Fprintf(&hunk, "\n~ %s", diff)
+		}
+		for _, line := range gone {
+			fmt.Fprintf(&hunk, "\n- %s", truncateSnippet(line, maxDiffLine))
+		}
+		for _, line := range fresh {
+			fmt.Fprintf(&hunk, "\n+ %s", truncateSnippet(line, maxDiffLine))
+		}
+		if sb.Len()+hunk.Len() > maxDiffOutput {
+			hidden++
+		} else {
+			sb.WriteString(hunk.String())
+		}
+	}
+	if edited+added+removed == 0 {
+		return "No changes to the text (formatting changes are not compared)."
+	}
+	summary := fmt.Sprintf("%d line(s) edited, %d added, %d removed. Edits mark removed words [-like this-] and added ones {+like this+}.", edited, added, removed)
+	if hidden > 0 {
+		fmt.Fprintf(&sb, "\n\n…and %d more change(s) not shown.", hidden)
+	}
+	return summary + sb.String()
+}
+
+// pickRevision finds the version ref names: a revision ID, or a time
+// ("yesterday", "3d", "2026-05-02", RFC 3339), meaning the last version
+// saved by then. Before the first version, the first one is used.
+func pickRevision(revisions []DriveRevision, ref string, now time.Time) (int, error) {
+	ref = strings.TrimSpace(ref)
+	for i, r := range revisions {
+		if r.ID == ref {
+			return i, nil
+		}
+	}
+	at, err := time.Parse(time.RFC3339, ref)
+	if err != nil {
+		if at, err = ParseAuditSince(ref, now); err != nil {
+			return 0, fmt.Errorf("%q is neither a revision ID nor a time: %v", ref, err)
+		}
+	}
+	i := sort.Search(len(revisions), func(i int) bool { return revisions[i].Modified.After(at) })
+	return max(i-1, 0), nil
+}
+
+// diff compares two versions of a Doc, Sheet, Slides deck or text file:
+// by default the current one with the one before it.
+func (t *DriveTool) diff(ctx context.Context, args map[string]interface{}) *ToolResult {
+	fileID, _ := args["file_id"].(string)
+	fileID = strings.TrimPrefix(strings.TrimSpace(fileID), "drive_file_id=")
+	if fileID == "" {
+		return ErrorResult("file_id is required")
+	}
+	var meta driveFileJSON
+	if err := t.drive.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"?supportsAllDrives=true&fields=id,name,mimeType", nil, &meta); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to find the file: %v", err)).WithError(err)
+	}
+	revisions, err := t.drive.Revisions(ctx, fileID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list the versions of %s (it needs the drive.readonly scope): %v", meta.Name, err)).WithError(err)
+	}
+	if len(revisions) < 2 {
+		return SilentResult(fmt.Sprintf("%s has no earlier version to compare with.", meta.Name))
+	}
+
+	now := t.now()
+	to := len(revisions) - 1
+	if ref, _ := args["to"].(string); strings.TrimSpace(ref) != "" {
+		if to, err = pickRevision(revisions, ref, now); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	from := max(to-1, 0)
+	if ref, _ := args["from"].(string); strings.TrimSpace(ref) != "" {
+		if from, err = pickRevision(revisions, ref, now); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	if from == to {
+		return SilentResult(fmt.Sprintf("%s was not changed between those times: both are the version of %s.", meta.Name, describeRevision(revisions[to], to == len(revisions)-1)))
+	}
+	if from > to {
+		from, to = to, from
+	}
+
+	texts := make([]string, 2)
+	for i, idx := range []int{from, to} {
+		if texts[i], err = t.drive.RevisionText(ctx, fileID, meta.MimeType, revisions[idx]); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the version of %s: %v", describeRevision(revisions[idx], false), err)).WithError(err)
+		}
+	}
+	report := fmt.Sprintf("Changes to %s from the version of %s to the version of %s:\n%s", meta.Name,
+		describeRevision(revisions[from], false), describeRevision(revisions[to], to == len(revisions)-1), FormatTextDiff(texts[0], texts[1]))
+	return SilentResult(report)
+}
+
+func describeRevision(r DriveRevision, current bool) string {
+	s := r.Modified.In(time.Local).Format("2 Jan 2006 15:04")
+	if r.Author != "" {
+		s += " by " + r.Author
+	}
+	if current {
+		s += " (current)"
+	}
+	return s
+}
@@ -0,0 +1,605 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// driveTreeTTL is how long a walked folder tree is reused
+	driveTreeTTL = 15 * time.Minute
+	// maxDriveTreeFolders bounds how many folders one walk lists, each
+	// costing at least one request
+	maxDriveTreeFolders = 500
+	// maxDriveTreeChildren is how many entries of a folder the tree shows
+	maxDriveTreeChildren = 10
+)
+
+// driveNode is a file or folder in a walked tree. Size and Files of a
+// folder add up everything below it.
+type driveNode struct {
+	File     DriveFile
+	Path     string
+	Folder   bool
+	Size     int64
+	Files    int
+	Children []*driveNode
+}
+
+// driveTree is the result of one walk.
+type driveTree struct {
+	Root   *driveNode
+	Walked time.Time
+	// Partial is set when the walk stopped at maxDriveTreeFolders
+	Partial bool
+}
+
+// DriveTool reports on the user's Google Drive. action=tree walks a
+// folder and answers "what's eating my Drive space?" with a size-annotated
+// tree and the largest files in it. Walks are cached for a few minutes, so
+// drilling into a subfolder does not list everything again. action=starred
+// and action=recent list the files the user cares about, and star and
+// unstar change which those are. action=search finds files by name or
+// content, trying file name fragments when nothing matches. action=diff compares two versions of a
+// Doc or text file. action=shared_with_me triages what others shared:
+// add_shortcut files one into a folder and hide leaves it out of later
+// listings. Drive has no API to hide a shared file, so hidden files are
+// kept in workspace/state/drive_shared.json.
+type DriveTool struct {
+	drive     *GoogleDriveClient
+	statePath string
+	stateMu   sync.Mutex
+	mu        sync.Mutex
+	cache     map[string]*driveTree
+	now       func() time.Time
+}
+
+// driveSharedState is what DriveTool keeps of "Shared with me".
+type driveSharedState struct {
+	// Hidden maps the files the user hid to their names
+	Hidden map[string]string `json:"hidden"`
+	// LastLook is when the user last listed them, to mark what is new
+	LastLook time.Time `json:"last_look"`
+}
+
+func NewDriveTool(token TokenFunc, workspace string) *DriveTool {
+	return &DriveTool{
+		drive:     NewGoogleDriveClient(token),
+		statePath: filepath.Join(workspace, "state", "drive_shared.json"),
+		cache:     make(map[string]*driveTree),
+		now:       time.Now,
+	}
+}
+
+func (t *DriveTool) Name() string {
+	return "drive"
+}
+
+func (t *DriveTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "diff")
+}
+
+func (t *DriveTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "star", "unstar", "add_shortcut", "hide", "unhide")
+}
+
+func (t *DriveTool) ActionScopes() map[string][]string {
+	write := googleScopes("drive.file", "drive")
+	return map[string][]string{"star": write, "unstar": write, "add_shortcut": write, "hide": write, "unhide": write}
+}
+
+func (t *DriveTool) Description() string {
+	return "Explore the user's Google Drive. action=tree walks a folder (default My Drive) and shows its subfolders and files with their sizes up to a depth, biggest first, followed by the largest files anywhere inside it. Use it to answer \"what's taking up my Drive space?\". action=starred lists the user's starred files and action=recent the files they opened or changed last: start there when the user mentions \"that doc\" or \"my spreadsheet\". action=search finds files whose name or content matches query; when nothing does it tries file names with the query's words and fragments, and when too much does it keeps the files with the query in their name, saying what it tried. action=star and action=unstar star or unstar a file by drive_file_id. action=diff compares two versions of a Google Doc, Sheet, Slides deck or text file (file_id) and lists the edited, added and removed lines, word by word: by default the current version against the one before it, or give from/to as a time (\"yesterday\", \"3d\", a date) to answer \"what changed in the contract since yesterday?\". action=shared_with_me lists the files others shared with the user, newest first, with who shared them and the ones new since the last look marked; files the user hid are left out unless hidden=true. To triage them, action=add_shortcut puts a shortcut to a shared file (file_id) in a folder (default My Drive) so it stays at hand, and action=hide leaves a file out of later listings (picoclaw only: it stays shared in Drive); action=unhide brings it back."
+}
+
+func (t *DriveTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"tree", "starred", "recent", "search", "star", "unstar", "diff", "shared_with_me", "add_shortcut", "hide", "unhide"},
+				"description": "Action to perform",
+			},
+			"folder": map[string]interface{}{
+				"type":        "string",
+				"description": "tree, add_shortcut: Drive folder ID or path like \"Photos/2024\" (default: My Drive)",
+			},
+			"depth": map[string]interface{}{
+				"type":        "integer",
+				"description": "Folder levels to show (default 2, max 5); sizes always include everything below",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "search: words in the file's name or content",
+			},
+			"top": map[string]interface{}{
+				"type":        "integer",
+				"description": "tree: how many of the largest files to list (default 10); starred, recent, search, shared_with_me: how many files to list (default 20)",
+			},
+			"file_id": map[string]interface{}{
+				"type":        "string",
+				"description": "star, unstar, diff, add_shortcut, hide, unhide: the drive_file_id of the file",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "diff: the older version, as the time it was current (\"yesterday\", \"3d\", \"2026-05-02\", RFC 3339) or a revision ID (default: the version before to)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "diff: the newer version, same forms as from (default: the current version)",
+			},
+			"hidden": map[string]interface{}{
+				"type":        "boolean",
+				"description": "shared_with_me: list the files the user hid instead",
+			},
+			"refresh": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Walk the folder again instead of using the result of the last few minutes",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *DriveTool) Examples() []ToolExample {
+	return []ToolExample{
+		{Request: "What takes up space in my photos from 2024?", Args: map[string]interface{}{"action": "tree", "folder": "Photos/2024", "depth": 1, "top": 5}},
+		{Request: "Star the budget sheet", Args: map[string]interface{}{"action": "star", "file_id": "1AbCdEf"}},
+		{Request: "What changed in the budget since last week?", Args: map[string]interface{}{"action": "diff", "file_id": "1AbCdEf", "from": "7d"}},
+		{Request: "Keep the shared roadmap in my Work folder", Args: map[string]interface{}{"action": "add_shortcut", "file_id": "1AbCdEf", "folder": "Work"}},
+	}
+}
+
+func (t *DriveTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "tree":
+		return t.tree(ctx, args)
+	case "starred", "recent":
+		return t.list(ctx, action, args)
+	case "search":
+		return t.search(ctx, args)
+	case "diff":
+		return t.diff(ctx, args)
+	case "shared_with_me":
+		return t.shared(ctx, args)
+	case "add_shortcut":
+		return t.addShortcut(ctx, args)
+	case "hide", "unhide":
+		return t.hide(ctx, action, args)
+	case "star", "unstar":
+		fileID, _ := args["file_id"].(string)
+		fileID = strings.TrimPrefix(strings.TrimSpace(fileID), "drive_file_id=")
+		if fileID == "" {
+			return ErrorResult("file_id is required")
+		}
+		f, err := t.drive.SetStarred(ctx, fileID, action == "star")
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to %s the file (files picoclaw did not create need the full drive scope): %v", action, err)).WithError(err)
+		}
+		if action == "star" {
+			return NewToolResult(fmt.Sprintf("Starred %s.", f.Name))
+		}
+		return NewToolResult(fmt.Sprintf("Unstarred %s.", f.Name))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *DriveTool) list(ctx context.Context, action string, args map[string]interface{}) *ToolResult {
+	limit := 20
+	if n, ok := args["top"].(float64); ok && n >= 1 {
+		limit = min(int(n), 100)
+	}
+	var files []DriveFile
+	var err error
+	if action == "starred" {
+		files, err = t.drive.Starred(ctx, limit)
+	} else {
+		files, err = t.drive.Recent(ctx, limit)
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list Drive: %v", err)).WithError(err)
+	}
+	if len(files) == 0 {
+		if action == "starred" {
+			return SilentResult("No starred files in Drive.")
+		}
+		return SilentResult("No recent files in Drive.")
+	}
+	var sb strings.Builder
+	if action == "starred" {
+		sb.WriteString("Starred files, most recently modified first:")
+	} else {
+		sb.WriteString("Recent files, last opened or changed first:")
+	}
+	for i, f := range files {
+		noteMentions(ctx, fileMention(f))
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, f.Name)
+		if f.Starred && action == "recent" {
+			sb.WriteString(" ★")
+		}
+		last := f.ModifiedTime
+		verb := "modified"
+		if f.ViewedTime.After(last) && action == "recent" {
+			last, verb = f.ViewedTime, "opened"
+		}
+		if !last.IsZero() {
+			fmt.Fprintf(&sb, ", %s %s", verb, last.In(time.Local).Format("2 Jan 2006"))
+		}
+		if f.Size > 0 {
+			fmt.Fprintf(&sb, ", %s", formatFileSize(f.Size))
+		}
+		fmt.Fprintf(&sb, " [drive_file_id=%s] %s", f.ID, f.WebViewLink)
+	}
+	return SilentResult(sb.String())
+}
+
+// search finds files by name or content, refined when it finds nothing
+// or too much.
+func (t *DriveTool) search(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	if query = strings.TrimSpace(query); query == "" {
+		return ErrorResult("query is required")
+	}
+	limit := 20
+	if n, ok := args["top"].(float64); ok && n >= 1 {
+		limit = min(int(n), 100)
+	}
+	files, note, err := refineDriveSearch(ctx, t.drive, query, limit)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to search Drive: %v", err)).WithError(err)
+	}
+	if len(files) == 0 {
+		return SilentResult(strings.TrimSpace(fmt.Sprintf("No files in Drive match %q. %s", query, note)))
+	}
+	var sb strings.Builder
+	if note != "" {
+		sb.WriteString(note + "\n")
+	}
+	fmt.Fprintf(&sb, "%d file(s):", len(files))
+	for i, f := range files {
+		noteMentions(ctx, fileMention(f))
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, f.Name)
+		if !f.ModifiedTime.IsZero() {
+			fmt.Fprintf(&sb, ", modified %s", f.ModifiedTime.In(time.Local).Format("2 Jan 2006"))
+		}
+		fmt.Fprintf(&sb, " [drive_file_id=%s] %s", f.ID, f.WebViewLink)
+	}
+	return SilentResult(sb.String())
+}
+
+// shared lists "Shared with me", or the files hidden from it.
+func (t *DriveTool) shared(ctx context.Context, args map[string]interface{}) *ToolResult {
+	limit := 20
+	if n, ok := args["top"].(float64); ok && n >= 1 {
+		limit = min(int(n), 100)
+	}
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	state, err := t.loadShared()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	if hidden, _ := args["hidden"].(bool); hidden {
+		if len(state.Hidden) == 0 {
+			return SilentResult("No hidden shared files.")
+		}
+		ids := make([]string, 0, len(state.Hidden))
+		for id := range state.Hidden {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return state.Hidden[ids[i]] < state.Hidden[ids[j]] })
+		var sb strings.Builder
+		sb.WriteString("Hidden shared files:")
+		for i, id := range ids {
+			fmt.Fprintf(&sb, "\n%d. %s [drive_file_id=%s]", i+1, state.Hidden[id], id)
+		}
+		return SilentResult(sb.String())
+	}
+
+	// Ask for enough to fill the listing after leaving out the hidden ones
+	files, err := t.drive.SharedWithMe(ctx, min(limit+len(state.Hidden), 100))
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list Drive: %v", err)).WithError(err)
+	}
+	var sb strings.Builder
+	shown, fresh := 0, 0
+	for _, f := range files {
+		if _, ok := state.Hidden[f.ID]; ok || shown == limit {
+			continue
+		}
+		shown++
+		fmt.Fprintf(&sb, "\n%d. %s", shown, f.Name)
+		if f.SharedBy != "" {
+			fmt.Fprintf(&sb, ", shared by %s", f.SharedBy)
+		}
+		if !f.SharedTime.IsZero() {
+			fmt.Fprintf(&sb, " on %s", f.SharedTime.In(time.Local).Format("2 Jan 2006"))
+		}
+		if !state.LastLook.IsZero() && f.SharedTime.After(state.LastLook) {
+			sb.WriteString(" 🆕")
+			fresh++
+		}
+		fmt.Fprintf(&sb, " [drive_file_id=%s] %s", f.ID, f.WebViewLink)
+	}
+	state.LastLook = t.now()
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if shown == 0 {
+		return SilentResult("Nothing shared with the user in Drive, hidden files aside.")
+	}
+	header := "Shared with the user, most recently shared first"
+	if fresh > 0 {
+		header += fmt.Sprintf(" (%d new since the last look)", fresh)
+	}
+	return SilentResult(header + ":" + sb.String())
+}
+
+// addShortcut files a shared file into a folder of the user's Drive.
+func (t *DriveTool) addShortcut(ctx context.Context, args map[string]interface{}) *ToolResult {
+	fileID, _ := args["file_id"].(string)
+	fileID = strings.TrimPrefix(strings.TrimSpace(fileID), "drive_file_id=")
+	if fileID == "" {
+		return ErrorResult("file_id is required")
+	}
+	folder, _ := args["folder"].(string)
+	parent, err := t.findFolder(ctx, folder)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to find the Drive folder: %v", err)).WithError(err)
+	}
+	target, err := t.drive.Get(ctx, fileID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to find the file: %v", err)).WithError(err)
+	}
+	if _, err := t.drive.AddShortcut(ctx, target.ID, parent.File.ID, target.Name); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to add the shortcut: %v", err)).WithError(err)
+	}
+	return NewToolResult(fmt.Sprintf("Added a shortcut to %s in %s.", target.Name, parent.Path))
+}
+
+// hide leaves a shared file out of later listings, or brings it back.
+func (t *DriveTool) hide(ctx context.Context, action string, args map[string]interface{}) *ToolResult {
+	fileID, _ := args["file_id"].(string)
+	fileID = strings.TrimPrefix(strings.TrimSpace(fileID), "drive_file_id=")
+	if fileID == "" {
+		return ErrorResult("file_id is required")
+	}
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	state, err := t.loadShared()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if action == "unhide" {
+		name, ok := state.Hidden[fileID]
+		if !ok {
+			return ErrorResult(fmt.Sprintf("%s is not hidden", fileID))
+		}
+		delete(state.Hidden, fileID)
+		if err := saveJSONAtomic(t.statePath, state); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("%s is listed again.", name))
+	}
+	f, err := t.drive.Get(ctx, fileID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to find the file: %v", err)).WithError(err)
+	}
+	state.Hidden[fileID] = f.Name
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return NewToolResult(fmt.Sprintf("Hid %s from the shared files; it is still shared in Drive.", f.Name))
+}
+
+// loadShared reads the state; callers hold t.stateMu.
+func (t *DriveTool) loadShared() (*driveSharedState, error) {
+	state := &driveSharedState{Hidden: map[string]string{}}
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Drive state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse Drive state: %w", err)
+	}
+	if state.Hidden == nil {
+		state.Hidden = map[string]string{}
+	}
+	return state, nil
+}
+
+func (t *DriveTool) tree(ctx context.Context, args map[string]interface{}) *ToolResult {
+	depth, top := 2, 10
+	if d, ok := args["depth"].(float64); ok && d >= 1 {
+		depth = min(int(d), 5)
+	}
+	if n, ok := args["top"].(float64); ok && n >= 0 {
+		top = min(int(n), 50)
+	}
+	refresh, _ := args["refresh"].(bool)
+
+	folder, _ := args["folder"].(string)
+	root, err := t.findFolder(ctx, folder)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to find the Drive folder: %v", err)).WithError(err)
+	}
+
+	t.mu.Lock()
+	tree, ok := t.cache[root.File.ID]
+	t.mu.Unlock()
+	if !ok || refresh || t.now().Sub(tree.Walked) > driveTreeTTL {
+		tree, err = t.walk(ctx, root)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list Drive: %v", err)).WithError(err)
+		}
+		t.mu.Lock()
+		for id, cached := range t.cache {
+			if t.now().Sub(cached.Walked) > driveTreeTTL {
+				delete(t.cache, id)
+			}
+		}
+		t.cache[root.File.ID] = tree
+		t.mu.Unlock()
+	}
+	return SilentResult(formatDriveTree(tree, depth, top))
+}
+
+// findFolder resolves a folder argument to the root of a walk: an ID is
+// used as is, a path is looked up one level at a time.
+func (t *DriveTool) findFolder(ctx context.Context, folder string) (*driveNode, error) {
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+	switch {
+	case folder == "" || strings.EqualFold(folder, "My Drive"):
+		return &driveNode{File: DriveFile{ID: "root", Name: "My Drive"}, Path: "My Drive", Folder: true}, nil
+	case driveIDPattern.MatchString(folder):
+		return &driveNode{File: DriveFile{ID: folder, Name: folder}, Path: "folder " + folder, Folder: true}, nil
+	}
+	parentID := "root"
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		f, err := t.drive.FindFolder(ctx, parentID, part)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil {
+			return nil, fmt.Errorf("no folder %q in %s", part, strings.TrimSuffix(folder, "/"+part))
+		}
+		parentID = f.ID
+	}
+	return &driveNode{File: DriveFile{ID: parentID, Name: folder}, Path: folder, Folder: true}, nil
+}
+
+// walk lists root and every folder below it, breadth first, adding up
+// sizes on the way back.
+func (t *DriveTool) walk(ctx context.Context, root *driveNode) (*driveTree, error) {
+	tree := &driveTree{Root: root, Walked: t.now()}
+	queue := []*driveNode{root}
+	listed := 0
+	for len(queue) > 0 {
+		if listed == maxDriveTreeFolders {
+			tree.Partial = true
+			break
+		}
+		node := queue[0]
+		queue = queue[1:]
+		files, err := t.drive.ListFolder(ctx, node.File.ID)
+		if err != nil {
+			if node == root {
+				return nil, err
+			}
+			// Keep the rest of the report; this folder just counts as empty
+			tree.Partial = true
+			continue
+		}
+		listed++
+		for _, f := range files {
+			child := &driveNode{File: f, Path: node.Path + "/" + f.Name, Folder: f.MimeType == "application/vnd.google-apps.folder"}
+			if child.Folder {
+				queue = append(queue, child)
+			} else {
+				child.Size, child.Files = f.Size, 1
+			}
+			node.Children = append(node.Children, child)
+		}
+	}
+	sumDriveNode(root)
+	return tree, nil
+}
+
+func sumDriveNode(n *driveNode) {
+	if !n.Folder {
+		return
+	}
+	n.Size, n.Files = 0, 0
+	for _, c := range n.Children {
+		sumDriveNode(c)
+		n.Size += c.Size
+		n.Files += c.Files
+	}
+	sort.SliceStable(n.Children, func(i, j int) bool { return n.Children[i].Size > n.Children[j].Size })
+}
+
+func formatDriveTree(tree *driveTree, depth, top int) string {
+	root := tree.Root
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s in %d file(s)", root.Path, formatFileSize(root.Size), root.Files)
+	if tree.Partial {
+		fmt.Fprintf(&sb, " (partial: only the first %d folders could be listed)", maxDriveTreeFolders)
+	}
+	writeDriveChildren(&sb, root, "", depth)
+
+	if top > 0 {
+		var files []*driveNode
+		var collect func(n *driveNode)
+		collect = func(n *driveNode) {
+			for _, c := range n.Children {
+				if c.Folder {
+					collect(c)
+				} else if c.Size > 0 {
+					files = append(files, c)
+				}
+			}
+		}
+		collect(root)
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+		if len(files) > top {
+			files = files[:top]
+		}
+		if len(files) > 0 {
+			sb.WriteString("\n\nLargest files:")
+			for i, f := range files {
+				fmt.Fprintf(&sb, "\n%d. %s, %s [drive_file_id=%s]", i+1, f.Path, formatFileSize(f.Size), f.File.ID)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// writeDriveChildren draws n's biggest entries, and those of its
+// subfolders down to depth levels, collapsing the rest into one line.
+func writeDriveChildren(sb *strings.Builder, n *driveNode, indent string, depth int) {
+	if depth == 0 {
+		return
+	}
+	shown := n.Children
+	var rest []*driveNode
+	if len(shown) > maxDriveTreeChildren {
+		shown, rest = shown[:maxDriveTreeChildren], shown[maxDriveTreeChildren:]
+	}
+	for i, c := range shown {
+		last := i == len(shown)-1 && len(rest) == 0
+		branch, next := "├─ ", "│  "
+		if last {
+			branch, next = "└─ ", "   "
+		}
+		if c.Folder {
+			fmt.Fprintf(sb, "\n%s%s%s/ %s, %d file(s)", indent, branch, c.File.Name, formatFileSize(c.Size), c.Files)
+			writeDriveChildren(sb, c, indent+next, depth-1)
+		} else {
+			fmt.Fprintf(sb, "\n%s%s%s %s", indent, branch, c.File.Name, formatFileSize(c.Size))
+		}
+	}
+	if len(rest) > 0 {
+		var size int64
+		for _, c := range rest {
+			size += c.Size
+		}
+		fmt.Fprintf(sb, "\n%s└─ … %d more, %s", indent, len(rest), formatFileSize(size))
+	}
+}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestDriveTool_Tree verifies folder sizes add up everything below them, the tree stops at the depth asked, and the largest files are listed
+func TestDriveTool_Tree(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	photos := g.AddFolder("", "Photos")
+	y2024 := g.AddFolder(photos, "2024")
+	trip := g.AddFolder(y2024, "Trip")
+	g.AddFile(testkit.File{Name: "beach.mov", Parent: trip, Content: make([]byte, 3<<20)})
+	g.AddFile(testkit.File{Name: "cat.jpg", Parent: y2024, Content: make([]byte, 200<<10)})
+	g.AddFile(testkit.File{Name: "backup.zip", Content: make([]byte, 2<<20)})
+	g.AddFile(testkit.File{Name: "old.zip", Content: make([]byte, 5<<20), Trashed: true})
+	docs := g.AddFolder("", "Docs")
+	for i := 0; i < 12; i++ {
+		g.AddFile(testkit.File{Name: "note.txt", Parent: docs, Content: []byte("hello")})
+	}
+	tool := NewDriveTool(testkit.Token, t.TempDir())
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "tree", "depth": float64(2), "top": float64(2)})
+	if r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	for _, want := range []string{
+		"My Drive: 5.2 MB in 15 file(s)",
+		"├─ Photos/ 3.2 MB, 2 file(s)\n│  └─ 2024/ 3.2 MB, 2 file(s)\n├─ backup.zip",
+		"└─ Docs/ 60 bytes, 12 file(s)\n   ├─ note.txt 5 bytes",
+		"   └─ … 2 more, 10 bytes",
+		"Largest files:\n1. My Drive/Photos/2024/Trip/beach.mov, 3.0 MB",
+		"2. My Drive/backup.zip, 2.0 MB",
+	} {
+		if !strings.Contains(r.ForLLM, want) {
+			t.Errorf("missing %q in:\n%s", want, r.ForLLM)
+		}
+	}
+	if strings.Contains(r.ForLLM, "Trip/ ") || strings.Contains(r.ForLLM, "old.zip") {
+		t.Errorf("tree went past the depth or listed trash:\n%s", r.ForLLM)
+	}
+
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "tree", "folder": "Photos/2024", "depth": float64(3)})
+	if r.IsError || !strings.HasPrefix(r.ForLLM, "Photos/2024: 3.2 MB in 2 file(s)\n├─ Trip/ 3.0 MB, 1 file(s)\n│  └─ beach.mov 3.0 MB\n└─ cat.jpg 200 KB") {
+		t.Fatalf("unexpected subfolder tree:\n%s", r.ForLLM)
+	}
+	if r := tool.Execute(context.Background(), map[string]interface{}{"action": "tree", "folder": "Photos/1999"}); !r.IsError {
+		t.Errorf("missing folder not reported: %s", r.ForLLM)
+	}
+}
+
+// TestDriveTool_StarredAndRecent verifies the starred and recent views list the right files in order, and star/unstar change a file's star
+func TestDriveTool_StarredAndRecent(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := func(d int) time.Time { return time.Date(2026, 5, d, 12, 0, 0, 0, time.UTC) }
+	budget := g.AddFile(testkit.File{Name: "Budget 2026", Modified: day(1), Viewed: day(6), Starred: true})
+	g.AddFile(testkit.File{Name: "Lease.pdf", Modified: day(3), Starred: true})
+	notes := g.AddFile(testkit.File{Name: "Notes", Modified: day(5)})
+	g.AddFolder("", "Archive")
+	g.AddFile(testkit.File{Name: "Old draft", Modified: day(4), Starred: true, Trashed: true})
+	tool := NewDriveTool(testkit.Token, t.TempDir())
+	ctx := context.Background()
+
+	starred := tool.Execute(ctx, map[string]interface{}{"action": "starred"})
+	if starred.IsError || !strings.Contains(starred.ForLLM, "1. Lease.pdf") || !strings.Contains(starred.ForLLM, "2. Budget 2026") || strings.Contains(starred.ForLLM, "Old draft") {
+		t.Errorf("unexpected starred list: %s", starred.ForLLM)
+	}
+	recent := tool.Execute(ctx, map[string]interface{}{"action": "recent", "top": float64(2)})
+	if recent.IsError || !strings.Contains(recent.ForLLM, "1. Budget 2026 ★, opened 6 May 2026") || !strings.Contains(recent.ForLLM, "2. Notes, modified 5 May 2026") || strings.Contains(recent.ForLLM, "Archive") {
+		t.Errorf("unexpected recent list: %s", recent.ForLLM)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "star", "file_id": "drive_file_id=" + notes}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "unstar", "file_id": budget}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	for _, f := range g.Files() {
+		if f.ID == notes && !f.Starred || f.ID == budget && f.Starred {
+			t.Errorf("star not changed: %+v", f)
+		}
+	}
+}
+
+// TestDriveTool_Diff verifies a Doc is compared against the version current at the time asked, edits shown word by word, and that by default the last two versions are compared
+func TestDriveTool_Diff(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Now()
+	id := g.AddFile(testkit.File{
+		Name:     "Contract",
+		MimeType: "application/vnd.google-apps.document",
+		Revisions: []testkit.Revision{
+			{Content: []byte("\ufeffServices agreement\r\n\r\nPayment due in 30 days.\r\n\r\nTerm: one year.\r\n"), Modified: now.AddDate(0, 0, -3), Author: "Ana"},
+			{Content: []byte("Services agreement\n\nPayment due in 30 days.\n\nTerm: one year.\n\nGoverning law: Portugal.\n"), Modified: now.Add(-2 * time.Hour), Author: "Ana"},
+		},
+		Content:  []byte("Services agreement\n\nPayment due in 45 days.\n\nGoverning law: Portugal.\n"),
+		Modified: now.Add(-time.Hour),
+	})
+	tool := NewDriveTool(testkit.Token, t.TempDir())
+	ctx := context.Background()
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "diff", "file_id": id, "from": "yesterday"})
+	if r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	for _, want := range []string{
+		"1 line(s) edited, 1 added, 1 removed",
+		"After \"Services agreement\":\n~ Payment due in [-30-] {+45+} days.\n- Term: one year.\n+ Governing law: Portugal.",
+		"(current)",
+	} {
+		if !strings.Contains(r.ForLLM, want) {
+			t.Errorf("expected %q in:\n%s", want, r.ForLLM)
+		}
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "diff", "file_id": id})
+	if r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	if !strings.Contains(r.ForLLM, "1 line(s) edited, 0 added, 1 removed") || strings.Contains(r.ForLLM, "+ Governing law") {
+		t.Errorf("expected the last edit only:\n%s", r.ForLLM)
+	}
+}
+
+// TestDriveTool_SharedWithMe verifies shared files are listed newest first with who shared them and what is new marked, hidden files are left out until unhidden, and a shortcut files one into a folder
+func TestDriveTool_SharedWithMe(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := func(d int) time.Time { return time.Date(2026, 5, d, 12, 0, 0, 0, time.UTC) }
+	roadmap := g.AddFile(testkit.File{Name: "Roadmap", SharedBy: "Ana", Shared: day(2)})
+	minutes := g.AddFile(testkit.File{Name: "Minutes", SharedBy: "Bob", Shared: day(4)})
+	g.AddFile(testkit.File{Name: "Old deck", SharedBy: "Bob", Shared: day(1), Trashed: true})
+	g.AddFile(testkit.File{Name: "Mine.txt"})
+	work := g.AddFolder("", "Work")
+	tool := NewDriveTool(testkit.Token, t.TempDir())
+	ctx := context.Background()
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "shared_with_me"})
+	if r.IsError || !strings.Contains(r.ForLLM, "1. Minutes, shared by Bob on 4 May 2026") || !strings.Contains(r.ForLLM, "2. Roadmap, shared by Ana") ||
+		strings.Contains(r.ForLLM, "Mine.txt") || strings.Contains(r.ForLLM, "Old deck") || strings.Contains(r.ForLLM, "🆕") {
+		t.Fatalf("unexpected shared list: %s", r.ForLLM)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "hide", "file_id": "drive_file_id=" + minutes}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	g.AddFile(testkit.File{Name: "Budget", SharedBy: "Ana", Shared: time.Now().Add(time.Hour)})
+	r = tool.Execute(ctx, map[string]interface{}{"action": "shared_with_me"})
+	if r.IsError || strings.Contains(r.ForLLM, "Minutes") || !strings.Contains(r.ForLLM, "(1 new since the last look)") || !strings.Contains(r.ForLLM, "1. Budget, shared by Ana") {
+		t.Errorf("hidden file listed or new file not marked: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "shared_with_me", "hidden": true}); !strings.Contains(r.ForLLM, "1. Minutes [drive_file_id="+minutes+"]") {
+		t.Errorf("hidden file not listed: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "unhide", "file_id": minutes}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "shared_with_me"}); !strings.Contains(r.ForLLM, "Minutes") {
+		t.Errorf("unhidden file not listed: %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "add_shortcut", "file_id": roadmap, "folder": "Work"})
+	if r.IsError || r.ForLLM != "Added a shortcut to Roadmap in Work." {
+		t.Fatalf("unexpected result: %s", r.ForLLM)
+	}
+	var shortcut *testkit.File
+	for _, f := range g.Files() {
+		if f.ShortcutTo != "" {
+			shortcut = &f
+		}
+	}
+	if shortcut == nil || shortcut.ShortcutTo != roadmap || shortcut.Parent != work || shortcut.Name != "Roadmap" {
+		t.Errorf("unexpected shortcut: %+v", shortcut)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "add_shortcut", "file_id": "missing"}); !r.IsError {
+		t.Errorf("shortcut to a missing file not reported: %s", r.ForLLM)
+	}
+}
+
+// TestDriveTool_SearchRefines verifies a search that finds nothing tries file name fragments and says so, and one that finds too much keeps the files with the query in their name
+func TestDriveTool_SearchRefines(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddFile(testkit.File{Name: "Q4_budget-v2.xlsx", Modified: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)})
+	g.AddFile(testkit.File{Name: "Trip notes", Content: []byte("budget for the trip")})
+	g.AddFile(testkit.File{Name: "Team budget", Content: []byte("budget lines")})
+	tool := NewDriveTool(testkit.Token, t.TempDir())
+	ctx := context.Background()
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "search", "query": "budget spreadsheet v2"})
+	if r.IsError || !strings.Contains(r.ForLLM, "names with budget and spreadsheet and v2 (0), names with spreadsheet (0), names with budget (") || !strings.Contains(r.ForLLM, "Q4_budget-v2.xlsx") {
+		t.Errorf("Expected file name fragments tried, got %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "search", "query": "budget", "top": float64(3)})
+	if !strings.Contains(r.ForLLM, "only the 2 with it in their name are listed") || strings.Contains(r.ForLLM, "Trip notes") {
+		t.Errorf("Expected a crowded search noted, got %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "search", "query": "zebra"})
+	if !strings.HasPrefix(r.ForLLM, `No files in Drive match "zebra". Also tried names with zebra (0).`) {
+		t.Errorf("Expected what was tried reported, got %s", r.ForLLM)
+	}
+}
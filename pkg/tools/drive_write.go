@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DriveConflictError is returned by SafeUpdate when a file was changed in
+// Drive since the app last wrote it, in a way that cannot be merged with
+// the app's own change.
+type DriveConflictError struct {
+	Name       string
+	ModifiedBy string
+	Modified   time.Time
+	// Version is the file's version with the other change
+	Version string
+}
+
+func (e *DriveConflictError) Error() string {
+	return fmt.Sprintf("%s was %s since it was last written", e.Name, e.Edit())
+}
+
+// Edit says who changed the file and when, e.g. "edited in Drive by Ana
+// at 3 Mar 14:05".
+func (e *DriveConflictError) Edit() string {
+	by := e.ModifiedBy
+	if by == "" {
+		by = "someone"
+	}
+	return fmt.Sprintf("edited in Drive by %s at %s", by, e.Modified.In(time.Local).Format("2 Jan 15:04"))
+}
+
+// SafeUpdate replaces the text of fileID, a Google Doc or text file that
+// held base at version when the app last wrote it, with text, without
+// overwriting what people changed in Drive since. When the file still
+// holds base, text is written as it is. When only one side added to the
+// end, the other's addition is kept after it. Any other change is a
+// *DriveConflictError and nothing is written.
+//
+// It returns the text written and the version to pass next time, which
+// is empty when others' changes were merged in, as the file then holds
+// more than text.
+func (c *GoogleDriveClient) SafeUpdate(ctx context.Context, fileID, mimeType, base, version, text string) (written, newVersion string, err error) {
+	if version != "" {
+		var meta driveFileJSON
+		if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"?supportsAllDrives=true&fields=version", nil, &meta); err != nil {
+			return "", "", err
+		}
+		if meta.Version.String() == version {
+			newVersion, err := c.updateContent(ctx, fileID, mimeType, []byte(text))
+			return text, newVersion, err
+		}
+	}
+	// Changed since, if only its sharing: compare what it says
+	file, current, err := c.ReadText(ctx, fileID)
+	if err != nil {
+		return "", "", err
+	}
+	written, ok := mergeDriveText(base, current, text)
+	if !ok {
+		return "", "", &DriveConflictError{Name: file.Name, ModifiedBy: file.ModifiedBy, Modified: file.ModifiedTime, Version: file.Version}
+	}
+	newVersion, err = c.updateContent(ctx, fileID, mimeType, []byte(written))
+	if err != nil {
+		return "", "", err
+	}
+	if written != text {
+		newVersion = ""
+	}
+	return written, newVersion, nil
+}
+
+// mergeDriveText merges the app's change from base to text with the file's
+// current text, when the file is unchanged or one side only appended.
+func mergeDriveText(base, current, text string) (string, bool) {
+	current = normalizeDocText(current)
+	normBase := normalizeDocText(base)
+	switch {
+	case current == normBase:
+		return text, true
+	case strings.HasPrefix(text, base):
+		// The app appended: add its part to what the file says now
+		return current + "\n" + text[len(base):], true
+	case strings.HasPrefix(current, normBase):
+		// Someone appended: keep their part after the new text
+		return strings.TrimRight(text, "\n") + current[len(normBase):] + "\n", true
+	}
+	return "", false
+}
+
+// normalizeDocText undoes what exporting a Doc as text adds: a byte order
+// mark, CRLF line ends and trailing blank lines.
+func normalizeDocText(s string) string {
+	s = strings.TrimPrefix(s, "\ufeff")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.TrimRight(s, " \n")
+}
@@ -0,0 +1,22 @@
+package tools
+
+import "testing"
+
+// TestMergeDriveText verifies an unchanged file takes the new text, appends on either side are combined, and other edits conflict
+func TestMergeDriveText(t *testing.T) {
+	tests := []struct {
+		name, base, current, text, want string
+		ok                              bool
+	}{
+		{"unchanged", "a\nb\n", "\ufeffa\r\nb\r\n", "a\nc\n", "a\nc\n", true},
+		{"app appends", "a\n", "A\n", "a\n\n## b\n", "A\n\n## b\n", true},
+		{"person appends", "a\nb\n", "a\nb\nnote\n", "a\nc\n", "a\nc\nnote\n", true},
+		{"both rewrite", "a\nb\n", "x\nb\n", "a\nc\n", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := mergeDriveText(tt.base, tt.current, tt.text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: mergeDriveText() = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -22,10 +23,23 @@ func NewEditFileTool(allowedDir string, restrict bool) *EditFileTool {
 	}
 }
 
+// Configure takes "workspace".
+func (t *EditFileTool) Configure(settings ToolSettings) error {
+	return configureWorkspace(settings, &t.allowedDir)
+}
+
 func (t *EditFileTool) Name() string {
 	return "edit_file"
 }
 
+func (t *EditFileTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *EditFileTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *EditFileTool) Description() string {
 	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file."
 }
@@ -97,6 +111,7 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 	if err := os.WriteFile(resolvedPath, []byte(newContent), 0644); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
 	}
+	recordFileUndo(ctx, resolvedPath, "edited", content)
 
 	return SilentResult(fmt.Sprintf("File edited: %s", path))
 }
@@ -110,10 +125,23 @@ func NewAppendFileTool(workspace string, restrict bool) *AppendFileTool {
 	return &AppendFileTool{workspace: workspace, restrict: restrict}
 }
 
+// Configure takes "workspace".
+func (t *AppendFileTool) Configure(settings ToolSettings) error {
+	return configureWorkspace(settings, &t.workspace)
+}
+
 func (t *AppendFileTool) Name() string {
 	return "append_file"
 }
 
+func (t *AppendFileTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *AppendFileTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *AppendFileTool) Description() string {
 	return "Append content to the end of a file"
 }
@@ -151,6 +179,11 @@ func (t *AppendFileTool) Execute(ctx context.Context, args map[string]interface{
 		return ErrorResult(err.Error())
 	}
 
+	var size int64
+	info, statErr := os.Stat(resolvedPath)
+	if statErr == nil {
+		size = info.Size()
+	}
 	f, err := os.OpenFile(resolvedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to open file: %v", err))
@@ -160,6 +193,11 @@ func (t *AppendFileTool) Execute(ctx context.Context, args map[string]interface{
 	if _, err := f.WriteString(content); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to append to file: %v", err))
 	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoTruncateFile,
+		Description: "appended to " + resolvedPath,
+		Params:      map[string]string{"path": resolvedPath, "existed": strconv.FormatBool(statErr == nil), "size": strconv.FormatInt(size, 10)},
+	})
 
 	return SilentResult(fmt.Sprintf("Appended to %s", path))
 }
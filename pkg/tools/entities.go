@@ -0,0 +1,616 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entity kinds.
+const (
+	EntityPerson = "person"
+	EntityFile   = "file"
+	EntityEvent  = "event"
+)
+
+// maxEntitiesPerChat caps the entities kept for a chat; the ones seen
+// longest ago go first.
+const maxEntitiesPerChat = 200
+
+// entityContextSize is how many recent entities the prompt lists.
+const entityContextSize = 8
+
+// Mention is a person, file or event a tool came across: a contact, the
+// sender of an email, an event's attendee, a Drive file.
+type Mention struct {
+	Kind  string
+	Name  string
+	Email string
+	Phone string
+	// Ref identifies a file or event for the tools, e.g.
+	// "drive_file_id=..."
+	Ref string
+}
+
+// Entity is one person, file or event as known across tools, with every
+// name, address and ID they were seen under in a chat.
+type Entity struct {
+	ID      string    `json:"id"`
+	Chat    string    `json:"chat"`
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Aliases []string  `json:"aliases,omitempty"`
+	Emails  []string  `json:"emails,omitempty"`
+	Phones  []string  `json:"phones,omitempty"`
+	Refs    []string  `json:"refs,omitempty"`
+	Sources []string  `json:"sources,omitempty"`
+	Seen    time.Time `json:"seen"`
+}
+
+// String describes the entity on one line, with its addresses and IDs.
+func (e Entity) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s", e.ID, e.Kind, e.Name)
+	if len(e.Aliases) > 0 {
+		fmt.Fprintf(&sb, " (also %s)", strings.Join(e.Aliases, ", "))
+	}
+	var known []string
+	known = append(known, e.Emails...)
+	known = append(known, e.Phones...)
+	known = append(known, e.Refs...)
+	if len(known) > 0 {
+		fmt.Fprintf(&sb, ": %s", strings.Join(known, ", "))
+	}
+	if len(e.Sources) > 0 {
+		fmt.Fprintf(&sb, " [seen in %s]", strings.Join(e.Sources, ", "))
+	}
+	return sb.String()
+}
+
+// matches reports whether m is about this entity: the same email or phone
+// for people, the same ref for files and events, or else the same name.
+func (e *Entity) matches(m Mention) bool {
+	if e.Kind != m.Kind {
+		return false
+	}
+	for _, email := range e.Emails {
+		if m.Email != "" && strings.EqualFold(email, m.Email) {
+			return true
+		}
+	}
+	if m.Phone != "" && e.hasPhone(m.Phone) {
+		return true
+	}
+	for _, ref := range e.Refs {
+		if m.Ref != "" && ref == m.Ref {
+			return true
+		}
+	}
+	if m.Name == "" || m.Ref != "" && len(e.Refs) > 0 {
+		return false
+	}
+	return e.named(m.Name)
+}
+
+func (e *Entity) named(name string) bool {
+	if strings.EqualFold(e.Name, name) {
+		return true
+	}
+	for _, alias := range e.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// absorb adds what m knows that the entity does not.
+func (e *Entity) absorb(m Mention) {
+	switch {
+	case m.Name == "" || e.named(m.Name):
+	case e.Name == "" || strings.Contains(e.Name, "@") && !strings.Contains(m.Name, "@"):
+		if e.Name != "" {
+			e.Aliases = appendUnique(e.Aliases, e.Name)
+		}
+		e.Name = m.Name
+	default:
+		e.Aliases = appendUnique(e.Aliases, m.Name)
+	}
+	if m.Email != "" {
+		e.Emails = appendUnique(e.Emails, strings.ToLower(m.Email))
+	}
+	if m.Phone != "" && !e.hasPhone(m.Phone) {
+		e.Phones = append(e.Phones, m.Phone)
+	}
+	if m.Ref != "" {
+		e.Refs = appendUnique(e.Refs, m.Ref)
+	}
+}
+
+func (e *Entity) hasPhone(phone string) bool {
+	digits := normalizePhone(phone)
+	if digits == "" {
+		return false
+	}
+	for _, p := range e.Phones {
+		if normalizePhone(p) == digits {
+			return true
+		}
+	}
+	return false
+}
+
+// EntityBook links the people, files and events tools mention into one
+// entity each per chat, so "send it to her" can be resolved to the file
+// and the person talked about last, whichever tool they came from.
+type EntityBook struct {
+	path string
+	now  func() time.Time
+	mu   sync.Mutex
+	data struct {
+		Next     int      `json:"next"`
+		Entities []Entity `json:"entities"`
+	}
+}
+
+// NewEntityBook loads the entities saved in the workspace.
+func NewEntityBook(workspace string) *EntityBook {
+	b := &EntityBook{path: filepath.Join(workspace, "state", "entities.json"), now: time.Now}
+	if data, err := os.ReadFile(b.path); err == nil {
+		json.Unmarshal(data, &b.data)
+	}
+	return b
+}
+
+// Link records what source mentioned in chat, merging each mention into
+// the entity it is about or adding a new one.
+func (b *EntityBook) Link(chat, source string, mentions []Mention) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	changed := false
+	for _, m := range mentions {
+		m.Kind, m.Name, m.Email, m.Phone, m.Ref = strings.TrimSpace(m.Kind), strings.TrimSpace(m.Name), strings.TrimSpace(m.Email), strings.TrimSpace(m.Phone), strings.TrimSpace(m.Ref)
+		if m.Kind == "" || m.Name == "" && m.Email == "" && m.Phone == "" && m.Ref == "" {
+			continue
+		}
+		var entity *Entity
+		for i := range b.data.Entities {
+			if e := &b.data.Entities[i]; e.Chat == chat && e.matches(m) {
+				entity = e
+				break
+			}
+		}
+		if entity == nil {
+			b.data.Next++
+			b.data.Entities = append(b.data.Entities, Entity{ID: "e" + strconv.Itoa(b.data.Next), Chat: chat, Kind: m.Kind})
+			entity = &b.data.Entities[len(b.data.Entities)-1]
+			if m.Name == "" {
+				entity.Name = m.Email
+				if entity.Name == "" {
+					entity.Name = m.Phone
+				}
+			}
+		}
+		entity.absorb(m)
+		entity.Sources = appendUnique(entity.Sources, source)
+		entity.Seen = now
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	b.trimLocked(chat)
+	return saveJSONAtomic(b.path, &b.data)
+}
+
+// trimLocked drops the chat's entities seen longest ago past
+// maxEntitiesPerChat.
+func (b *EntityBook) trimLocked(chat string) {
+	var seen []time.Time
+	for _, e := range b.data.Entities {
+		if e.Chat == chat {
+			seen = append(seen, e.Seen)
+		}
+	}
+	if len(seen) <= maxEntitiesPerChat {
+		return
+	}
+	sort.Slice(seen, func(i, j int) bool { return seen[i].After(seen[j]) })
+	cutoff := seen[maxEntitiesPerChat-1]
+	kept := b.data.Entities[:0]
+	for _, e := range b.data.Entities {
+		if e.Chat == chat && e.Seen.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	b.data.Entities = kept
+}
+
+// Recent returns the chat's entities of kind, or of every kind when kind
+// is empty, seen most recently first.
+func (b *EntityBook) Recent(chat, kind string) []Entity {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var list []Entity
+	// Newest first among those seen in the same call
+	for i := len(b.data.Entities) - 1; i >= 0; i-- {
+		if e := b.data.Entities[i]; e.Chat == chat && (kind == "" || e.Kind == kind) {
+			list = append(list, e)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Seen.After(list[j].Seen) })
+	return list
+}
+
+// Find returns the chat's entities of kind (any when empty) whose ID,
+// name, alias, address or ref contains query, seen most recently first.
+func (b *EntityBook) Find(chat, kind, query string) []Entity {
+	query = strings.ToLower(strings.TrimSpace(query))
+	var found []Entity
+	for _, e := range b.Recent(chat, kind) {
+		if query == "" || e.ID == query || e.contains(query) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// contains reports whether a name, alias, address or ref of the entity
+// contains query, lowercased.
+func (e *Entity) contains(query string) bool {
+	fields := append([]string{e.Name}, e.Aliases...)
+	fields = append(fields, e.Emails...)
+	fields = append(fields, e.Refs...)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
+	}
+	// A number may be given without its country code
+	if digits := normalizePhone(query); len(digits) >= 6 {
+		for _, p := range e.Phones {
+			if strings.HasSuffix(normalizePhone(p), digits) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Merge folds the chat's entity from into into, for two entries the user
+// says are the same, and returns the result.
+func (b *EntityBook) Merge(chat, into, from string) (Entity, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var keep, drop *Entity
+	for i := range b.data.Entities {
+		e := &b.data.Entities[i]
+		if e.Chat != chat {
+			continue
+		}
+		switch e.ID {
+		case into:
+			keep = e
+		case from:
+			drop = e
+		}
+	}
+	if keep == nil || drop == nil || into == from {
+		return Entity{}, fmt.Errorf("merge needs two different entity IDs from this chat, e.g. e3 and e7")
+	}
+	if keep.Kind != drop.Kind {
+		return Entity{}, fmt.Errorf("%s is a %s and %s a %s", keep.ID, keep.Kind, drop.ID, drop.Kind)
+	}
+	keep.absorb(Mention{Kind: drop.Kind, Name: drop.Name})
+	for _, alias := range drop.Aliases {
+		keep.absorb(Mention{Kind: drop.Kind, Name: alias})
+	}
+	for _, email := range drop.Emails {
+		keep.absorb(Mention{Kind: drop.Kind, Email: email})
+	}
+	for _, phone := range drop.Phones {
+		keep.absorb(Mention{Kind: drop.Kind, Phone: phone})
+	}
+	for _, ref := range drop.Refs {
+		keep.absorb(Mention{Kind: drop.Kind, Ref: ref})
+	}
+	keep.Sources = appendUnique(keep.Sources, drop.Sources...)
+	if drop.Seen.After(keep.Seen) {
+		keep.Seen = drop.Seen
+	}
+	merged := *keep
+	b.removeLocked(func(e Entity) bool { return e.Chat == chat && e.ID == from })
+	return merged, saveJSONAtomic(b.path, &b.data)
+}
+
+// Forget deletes the chat's entity id, reporting whether it existed.
+func (b *EntityBook) Forget(chat, id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.removeLocked(func(e Entity) bool { return e.Chat == chat && e.ID == id }) == 0 {
+		return false, nil
+	}
+	return true, saveJSONAtomic(b.path, &b.data)
+}
+
+// Purge deletes all of the chat's entities and returns how many there
+// were.
+func (b *EntityBook) Purge(chat string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	removed := b.removeLocked(func(e Entity) bool { return e.Chat == chat })
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, saveJSONAtomic(b.path, &b.data)
+}
+
+func (b *EntityBook) removeLocked(drop func(Entity) bool) int {
+	kept := b.data.Entities[:0]
+	for _, e := range b.data.Entities {
+		if !drop(e) {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(b.data.Entities) - len(kept)
+	b.data.Entities = kept
+	return removed
+}
+
+// Context lists the chat's most recently mentioned entities for the
+// system prompt, empty when there are none.
+func (b *EntityBook) Context(chat string) string {
+	list := b.Recent(chat, "")
+	if len(list) == 0 {
+		return ""
+	}
+	if len(list) > entityContextSize {
+		list = list[:entityContextSize]
+	}
+	var sb strings.Builder
+	for _, e := range list {
+		sb.WriteString("\n- " + e.String())
+	}
+	return sb.String()
+}
+
+type mentionsKey struct{}
+
+// mentionList collects the mentions of one tool call.
+type mentionList struct {
+	mu   sync.Mutex
+	list []Mention
+}
+
+func withMentions(ctx context.Context) (context.Context, *mentionList) {
+	l := &mentionList{}
+	return context.WithValue(ctx, mentionsKey{}, l), l
+}
+
+func (l *mentionList) take() []Mention {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := l.list
+	l.list = nil
+	return list
+}
+
+// noteMentions records the people, files or events the current call came
+// across, for entity linking.
+func noteMentions(ctx context.Context, mentions ...Mention) {
+	l, _ := ctx.Value(mentionsKey{}).(*mentionList)
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.list = append(l.list, mentions...)
+}
+
+// personMention reads an address such as "Ana Souza <ana@example.com>"
+// or a bare email address.
+func personMention(address string) Mention {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		return Mention{Kind: EntityPerson, Name: addr.Name, Email: addr.Address}
+	}
+	if address = strings.TrimSpace(address); strings.Contains(address, "@") {
+		return Mention{Kind: EntityPerson, Email: address}
+	}
+	return Mention{Kind: EntityPerson, Name: address}
+}
+
+// addressMentions reads a header list of addresses, like To or Cc.
+func addressMentions(header string) []Mention {
+	list, err := mail.ParseAddressList(header)
+	if err != nil {
+		return nil
+	}
+	mentions := make([]Mention, len(list))
+	for i, addr := range list {
+		mentions[i] = Mention{Kind: EntityPerson, Name: addr.Name, Email: addr.Address}
+	}
+	return mentions
+}
+
+// contactMentions is the person behind a contact, by every address.
+func contactMentions(c Contact) []Mention {
+	m := Mention{Kind: EntityPerson, Name: c.Name}
+	var mentions []Mention
+	for _, email := range c.Emails {
+		m.Email = email
+		mentions = append(mentions, m)
+	}
+	m.Email = ""
+	for _, phone := range c.Phones {
+		m.Phone = phone
+		mentions = append(mentions, m)
+	}
+	if len(mentions) == 0 {
+		mentions = append(mentions, m)
+	}
+	return mentions
+}
+
+// eventMentions is an event and the other people invited to it.
+func eventMentions(ev CalendarEvent) []Mention {
+	mentions := []Mention{{Kind: EntityEvent, Name: ev.Summary, Ref: eventRef(ev)}}
+	for _, a := range ev.Attendees {
+		if !a.Self {
+			mentions = append(mentions, Mention{Kind: EntityPerson, Name: a.Name, Email: a.Email})
+		}
+	}
+	return mentions
+}
+
+func eventRef(ev CalendarEvent) string {
+	if ev.ID == "" {
+		return ""
+	}
+	return "event_id=" + ev.ID
+}
+
+// fileMention is a Drive file.
+func fileMention(f DriveFile) Mention {
+	return Mention{Kind: EntityFile, Name: f.Name, Ref: "drive_file_id=" + f.ID}
+}
+
+// EntitiesTool lets the agent look up who and what a follow-up refers to
+// ("send it to her", "move that meeting") among the people, files and
+// events the tools came across in the chat, and fix wrong links.
+type EntitiesTool struct {
+	book *EntityBook
+}
+
+func NewEntitiesTool(book *EntityBook) *EntitiesTool {
+	return &EntitiesTool{book: book}
+}
+
+func (t *EntitiesTool) Name() string {
+	return "entities"
+}
+
+func (t *EntitiesTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *EntitiesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "merge", "forget")
+}
+
+func (t *EntitiesTool) Description() string {
+	return "People, files and events mentioned by tools in this chat (a contact, an email's sender, an event's attendees, a Drive file), each linked into one entry with every name, address and ID seen for it. resolve finds what a follow-up refers to (\"send it to her\", \"move that meeting\"): give a name, address or part of one, or only a kind to get the latest of that kind, and use the addresses and IDs it returns instead of searching again. If two entries are the same person, merge them; forget drops a wrong one."
+}
+
+func (t *EntitiesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"resolve", "list", "merge", "forget"},
+				"description": "Action to perform",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "resolve: a name, email, phone or ID, e.g. \"Ana\" (empty for the latest of kind)",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{EntityPerson, EntityFile, EntityEvent},
+				"description": "resolve, list: only entities of this kind",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "merge: the entity to keep; forget: the entity to drop, e.g. \"e3\"",
+			},
+			"other": map[string]interface{}{
+				"type":        "string",
+				"description": "merge: the entity folded into id",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *EntitiesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chat := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	kind, _ := args["kind"].(string)
+	id, _ := args["id"].(string)
+	id = strings.ToLower(strings.TrimSpace(id))
+
+	switch action {
+	case "resolve":
+		query, _ := args["query"].(string)
+		found := t.book.Find(chat, kind, query)
+		if len(found) == 0 {
+			if strings.TrimSpace(query) == "" {
+				return SilentResult("Nothing of that kind was mentioned in this chat yet.")
+			}
+			return SilentResult(fmt.Sprintf("Nothing mentioned in this chat matches %q. Look it up with the contacts, gmail, calendar or drive tools, or ask the user.", query))
+		}
+		if strings.TrimSpace(query) == "" {
+			return SilentResult("Latest: " + found[0].String())
+		}
+		if len(found) == 1 {
+			return SilentResult(found[0].String())
+		}
+		if len(found) > 5 {
+			found = found[:5]
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%q matches %d entries, the latest first. Ask the user if it is not clear which one they mean:", query, len(found))
+		for _, e := range found {
+			sb.WriteString("\n- " + e.String())
+		}
+		return SilentResult(sb.String())
+
+	case "list":
+		list := t.book.Recent(chat, kind)
+		if len(list) == 0 {
+			return SilentResult("Nothing mentioned in this chat yet.")
+		}
+		if len(list) > 30 {
+			list = list[:30]
+		}
+		var sb strings.Builder
+		sb.WriteString("Mentioned, the latest first:")
+		for _, e := range list {
+			sb.WriteString("\n- " + e.String())
+		}
+		return SilentResult(sb.String())
+
+	case "merge":
+		other, _ := args["other"].(string)
+		merged, err := t.book.Merge(chat, id, strings.ToLower(strings.TrimSpace(other)))
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult("Merged: " + merged.String())
+
+	case "forget":
+		forgot, err := t.book.Forget(chat, id)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if !forgot {
+			return ErrorResult(fmt.Sprintf("no entity %q in this chat; use action=list to see them", id))
+		}
+		return SilentResult(fmt.Sprintf("Forgot %s", id))
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
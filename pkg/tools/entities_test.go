@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// mailTool reports the sender of an email it read and the file attached
+type mailTool struct{}
+
+func (mailTool) Name() string        { return "mail" }
+func (mailTool) Description() string { return "reads mail" }
+func (mailTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (mailTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	noteMentions(ctx,
+		personMention("Ana <ANA.SILVA@example.com>"),
+		Mention{Kind: EntityFile, Name: "lease.pdf", Ref: "drive_file_id=f1"})
+	return SilentResult("Email from Ana with lease.pdf")
+}
+
+// TestEntities_LinkAcrossToolsAndResolve verifies mentions of the same person from different tools become one entity, and follow-ups resolve to the latest person or file
+func TestEntities_LinkAcrossToolsAndResolve(t *testing.T) {
+	dir := newRecipientDirectory(t,
+		Contact{Name: "Ana Silva", Emails: []string{"ana.silva@example.com"}, Phones: []string{"+55 11 91234-5678"}},
+		Contact{Name: "Bruno Costa", Emails: []string{"bruno@example.com"}},
+	)
+	workspace := t.TempDir()
+	book := NewEntityBook(workspace)
+	registry := NewToolRegistry()
+	registry.Register(NewContactsTool(dir))
+	registry.Register(mailTool{})
+	registry.Register(NewEntitiesTool(book))
+	registry.SetEntities(book)
+	ctx := context.Background()
+	call := func(name string, args map[string]interface{}) string {
+		return registry.ExecuteWithContext(ctx, name, args, "telegram", "42", nil).ForLLM
+	}
+
+	call("contacts", map[string]interface{}{"action": "search", "query": "example.com"})
+	call("mail", nil)
+
+	people := book.Recent("telegram:42", EntityPerson)
+	if len(people) != 2 {
+		t.Fatalf("expected Ana and Bruno, got %v", people)
+	}
+	ana := people[0]
+	if ana.Name != "Ana Silva" || len(ana.Emails) != 1 || len(ana.Phones) != 1 || strings.Join(ana.Sources, ",") != "contacts,mail" || strings.Join(ana.Aliases, ",") != "Ana" {
+		t.Errorf("unexpected entity %+v", ana)
+	}
+
+	if got := call("entities", map[string]interface{}{"action": "resolve", "kind": "person"}); !strings.Contains(got, "Ana Silva") || !strings.Contains(got, "ana.silva@example.com") {
+		t.Errorf("latest person resolved to %q", got)
+	}
+	if got := call("entities", map[string]interface{}{"action": "resolve", "kind": "file"}); !strings.Contains(got, "drive_file_id=f1") {
+		t.Errorf("latest file resolved to %q", got)
+	}
+	if got := call("entities", map[string]interface{}{"action": "resolve", "query": "11 91234 5678"}); !strings.Contains(got, ana.ID) {
+		t.Errorf("phone resolved to %q", got)
+	}
+	if book.Context("telegram:99") != "" || !strings.Contains(book.Context("telegram:42"), "lease.pdf") {
+		t.Error("the prompt lists the wrong chat's entities")
+	}
+
+	bruno := people[1]
+	if got := call("entities", map[string]interface{}{"action": "merge", "id": ana.ID, "other": bruno.ID}); !strings.Contains(got, "bruno@example.com") {
+		t.Errorf("merge gave %q", got)
+	}
+	if n := len(book.Recent("telegram:42", EntityPerson)); n != 1 {
+		t.Errorf("expected one person after merging, got %d", n)
+	}
+	if reloaded := NewEntityBook(workspace); len(reloaded.Recent("telegram:42", "")) != 2 {
+		t.Error("entities were not saved")
+	}
+}
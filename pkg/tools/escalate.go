@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Escalator hands a conversation over to a person. The agent implements it
+// by sending a snapshot to the escalation owner chat and relaying the
+// chat's messages there until the person hands it back.
+type Escalator interface {
+	Escalate(ctx context.Context, channel, chatID, reason, summary string) error
+}
+
+// EscalateTool lets the model hand the current conversation to a person
+// when it cannot or should not answer: a complaint, a decision only the
+// human it fronts can make, or a user asking for a person.
+type EscalateTool struct {
+	escalator Escalator
+}
+
+func NewEscalateTool(escalator Escalator) *EscalateTool {
+	return &EscalateTool{escalator: escalator}
+}
+
+func (t *EscalateTool) Name() string {
+	return "escalate"
+}
+
+func (t *EscalateTool) Description() string {
+	return "Hand this conversation over to a person. Use it when the user asks for a human, when a decision or commitment is not yours to make, or when the user is upset and you cannot resolve it. The person gets a snapshot of the conversation and answers from then on; you stop receiving this chat's messages until they hand it back. After calling it, tell the user briefly that someone will get back to them here."
+}
+
+func (t *EscalateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Why a person is needed, in one short sentence",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "What the user wants and what was already tried or promised, so the person can pick up without rereading everything",
+			},
+		},
+		"required": []string{"reason"},
+	}
+}
+
+func (t *EscalateTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *EscalateTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	reason, _ := args["reason"].(string)
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrorResult("reason is required")
+	}
+	summary, _ := args["summary"].(string)
+
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("escalate only works in a chat")
+	}
+	if err := t.escalator.Escalate(ctx, channel, chatID, reason, strings.TrimSpace(summary)); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to hand the conversation over: %v", err)).WithError(err)
+	}
+	return NewToolResult("The conversation was handed over to a person, who will reply in this chat. Tell the user briefly, without promising a time, and do not keep helping with the request.")
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ToolExample is one well-formed call of a tool: what it asks for, in the
+// user's words, and the arguments that do it.
+type ToolExample struct {
+	Request string
+	Args    map[string]interface{}
+}
+
+// ExampleTool is an optional interface for tools whose arguments are easy
+// to get wrong, such as search syntax, paths or which fields go with which
+// action. The agent shows the model the examples with the result of the
+// tool's first call in a conversation, so the calls after it follow them
+// without every prompt carrying them.
+type ExampleTool interface {
+	Tool
+	Examples() []ToolExample
+}
+
+// ExamplesHeader starts the examples FormatExamples writes for the tool
+// called name; the agent looks for it to show them once per conversation.
+func ExamplesHeader(name string) string {
+	return fmt.Sprintf("[Examples of well-formed %s calls:", name)
+}
+
+// FormatExamples writes the examples of tool for the model, or "" when it
+// has none.
+func FormatExamples(tool Tool) string {
+	t, ok := tool.(ExampleTool)
+	if !ok {
+		return ""
+	}
+	examples := t.Examples()
+	if len(examples) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(ExamplesHeader(tool.Name()))
+	for _, ex := range examples {
+		args, _ := json.Marshal(ex.Args)
+		fmt.Fprintf(&sb, "\n- %s: %s", ex.Request, args)
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
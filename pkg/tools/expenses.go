@@ -0,0 +1,670 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+// Expense is one ledger entry. Amounts are kept in cents to avoid float
+// rounding in totals.
+type Expense struct {
+	ID       string
+	Date     time.Time
+	Cents    int64
+	Currency string
+	Category string
+	Merchant string
+	Note     string
+}
+
+// ExpenseLedger stores expenses.
+type ExpenseLedger interface {
+	Add(ctx context.Context, e *Expense) error
+	// List returns expenses dated in [from, to).
+	List(ctx context.Context, from, to time.Time) ([]Expense, error)
+}
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func formatCents(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency)
+}
+
+// SQLiteLedger keeps expenses in a local SQLite database through the
+// sqlite3 command-line shell, which keeps the binary free of a cgo driver.
+type SQLiteLedger struct {
+	path     string
+	bin      string
+	initOnce sync.Once
+	initErr  error
+}
+
+func NewSQLiteLedger(path string) *SQLiteLedger {
+	return &SQLiteLedger{path: path, bin: "sqlite3"}
+}
+
+// query runs SQL (passed on stdin, never as arguments) and decodes the JSON
+// rows of the last statement into out.
+func (l *SQLiteLedger) query(ctx context.Context, sql string, out interface{}) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, l.bin, "-json", "-bail", l.path)
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3 failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out == nil || len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+		return fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+	return nil
+}
+
+func (l *SQLiteLedger) init(ctx context.Context) error {
+	l.initOnce.Do(func() {
+		if _, err := exec.LookPath(l.bin); err != nil {
+			l.initErr = fmt.Errorf("sqlite3 is not installed; install it or use the google_sheets backend")
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			l.initErr = err
+			return
+		}
+		l.initErr = l.query(ctx, `CREATE TABLE IF NOT EXISTS expenses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	date TEXT NOT NULL,
+	amount_cents INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	category TEXT NOT NULL,
+	merchant TEXT NOT NULL DEFAULT '',
+	note TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS expenses_date ON expenses(date);`, nil)
+	})
+	return l.initErr
+}
+
+func (l *SQLiteLedger) Add(ctx context.Context, e *Expense) error {
+	if err := l.init(ctx); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf(`INSERT INTO expenses (date, amount_cents, currency, category, merchant, note) VALUES (%s, %d, %s, %s, %s, %s);
+SELECT last_insert_rowid() AS id;`,
+		store.Quote(e.Date.Format("2006-01-02")), e.Cents, store.Quote(e.Currency), store.Quote(e.Category),
+		store.Quote(e.Merchant), store.Quote(e.Note))
+	var rows []struct {
+		ID int64 `json:"id"`
+	}
+	if err := l.query(ctx, sql, &rows); err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		e.ID = strconv.FormatInt(rows[0].ID, 10)
+	}
+	return nil
+}
+
+func (l *SQLiteLedger) List(ctx context.Context, from, to time.Time) ([]Expense, error) {
+	if err := l.init(ctx); err != nil {
+		return nil, err
+	}
+	sql := fmt.Sprintf(`SELECT id, date, amount_cents, currency, category, merchant, note FROM expenses
+WHERE date >= %s AND date < %s ORDER BY date, id;`,
+		store.Quote(from.Format("2006-01-02")), store.Quote(to.Format("2006-01-02")))
+	var rows []struct {
+		ID       int64  `json:"id"`
+		Date     string `json:"date"`
+		Cents    int64  `json:"amount_cents"`
+		Currency string `json:"currency"`
+		Category string `json:"category"`
+		Merchant string `json:"merchant"`
+		Note     string `json:"note"`
+	}
+	if err := l.query(ctx, sql, &rows); err != nil {
+		return nil, err
+	}
+	expenses := make([]Expense, 0, len(rows))
+	for _, r := range rows {
+		date, _ := time.Parse("2006-01-02", r.Date)
+		expenses = append(expenses, Expense{
+			ID:       strconv.FormatInt(r.ID, 10),
+			Date:     date,
+			Cents:    r.Cents,
+			Currency: r.Currency,
+			Category: r.Category,
+			Merchant: r.Merchant,
+			Note:     r.Note,
+		})
+	}
+	return expenses, nil
+}
+
+// GoogleSheetLedger appends expenses as rows (date, amount, currency,
+// category, merchant, note) to a sheet the user can also edit by hand.
+type GoogleSheetLedger struct {
+	token         TokenFunc
+	spreadsheetID string
+	sheet         string
+	baseURL       string
+	client        *http.Client
+}
+
+func NewGoogleSheetLedger(token TokenFunc, spreadsheetID, sheet string) *GoogleSheetLedger {
+	if sheet == "" {
+		sheet = "Expenses"
+	}
+	return &GoogleSheetLedger{
+		token:         token,
+		spreadsheetID: spreadsheetID,
+		sheet:         sheet,
+		baseURL:       "https://sheets.googleapis.com/v4",
+		client:        newGoogleHTTPClient(15 * time.Second),
+	}
+}
+
+func (l *GoogleSheetLedger) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := l.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, l.client, method, l.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+func (l *GoogleSheetLedger) rangePath() string {
+	return fmt.Sprintf("/spreadsheets/%s/values/%s", url.PathEscape(l.spreadsheetID), url.PathEscape(l.sheet+"!A:F"))
+}
+
+func (l *GoogleSheetLedger) Add(ctx context.Context, e *Expense) error {
+	row := []interface{}{
+		e.Date.Format("2006-01-02"),
+		float64(e.Cents) / 100,
+		e.Currency,
+		e.Category,
+		e.Merchant,
+		e.Note,
+	}
+	var resp struct {
+		Updates struct {
+			UpdatedRange string `json:"updatedRange"`
+		} `json:"updates"`
+	}
+	// RAW keeps the date as ISO text regardless of the sheet's locale
+	err := l.do(ctx, http.MethodPost, l.rangePath()+":append?valueInputOption=RAW&insertDataOption=INSERT_ROWS",
+		map[string]interface{}{"values": [][]interface{}{row}}, &resp)
+	if err != nil {
+		return err
+	}
+	e.ID = resp.Updates.UpdatedRange
+	return nil
+}
+
+func (l *GoogleSheetLedger) List(ctx context.Context, from, to time.Time) ([]Expense, error) {
+	var resp struct {
+		Values [][]interface{} `json:"values"`
+	}
+	if err := l.do(ctx, http.MethodGet, l.rangePath()+"?valueRenderOption=UNFORMATTED_VALUE", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var expenses []Expense
+	for i, row := range resp.Values {
+		cell := func(n int) string {
+			if n < len(row) {
+				return strings.TrimSpace(fmt.Sprint(row[n]))
+			}
+			return ""
+		}
+		// Rows that do not start with a date (headers, notes) are skipped
+		date, err := time.Parse("2006-01-02", cell(0))
+		if err != nil || date.Before(from) || !date.Before(to) {
+			continue
+		}
+		amount, err := strconv.ParseFloat(cell(1), 64)
+		if err != nil {
+			continue
+		}
+		expenses = append(expenses, Expense{
+			ID:       fmt.Sprintf("row %d", i+1),
+			Date:     date,
+			Cents:    toCents(amount),
+			Currency: cell(2),
+			Category: cell(3),
+			Merchant: cell(4),
+			Note:     cell(5),
+		})
+	}
+	return expenses, nil
+}
+
+// Receipt holds what could be read from OCR'd receipt text. Zero fields
+// were not found.
+type Receipt struct {
+	Merchant string
+	Total    float64
+	Date     time.Time
+}
+
+var (
+	reReceiptAmount = regexp.MustCompile(`\d{1,3}(?:[.,' ]\d{3})*[.,]\d{2}\b|\b\d+[.,]\d{2}\b`)
+	reReceiptTotal  = regexp.MustCompile(`(?i)\b(total|amount due|balance due|to pay|summe|gesamt|importe|montant|valor)\b`)
+	reReceiptNot    = regexp.MustCompile(`(?i)sub\s*-?total|tax|vat|iva|mwst|change|troco|cambio|tip`)
+	reISODate       = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	reNumericDate   = regexp.MustCompile(`\b(\d{1,2})[/.-](\d{1,2})[/.-](\d{2,4})\b`)
+	reHasLetters    = regexp.MustCompile(`[A-Za-zÀ-ÿ]{3,}`)
+)
+
+// parseReceiptAmount reads "1.234,56", "1,234.56" or "12.50": the last
+// separator followed by two digits is the decimal point.
+func parseReceiptAmount(s string) (float64, bool) {
+	s = strings.NewReplacer(" ", "", "'", "").Replace(s)
+	if len(s) < 4 {
+		return 0, false
+	}
+	intPart := strings.NewReplacer(".", "", ",", "").Replace(s[:len(s)-3])
+	v, err := strconv.ParseFloat(intPart+"."+s[len(s)-2:], 64)
+	return v, err == nil
+}
+
+// ParseReceipt extracts merchant, total and date from OCR text. The total
+// comes from "total"-like lines (ignoring subtotals and tax); without one
+// the largest amount on the receipt is used.
+func ParseReceipt(text string) Receipt {
+	var r Receipt
+	var largest, bestTotal float64
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if r.Merchant == "" && reHasLetters.MatchString(line) && !reReceiptAmount.MatchString(line) {
+			r.Merchant = line
+		}
+
+		amounts := reReceiptAmount.FindAllString(line, -1)
+		for _, a := range amounts {
+			if v, ok := parseReceiptAmount(a); ok && v > largest {
+				largest = v
+			}
+		}
+		if len(amounts) > 0 && reReceiptTotal.MatchString(line) && !reReceiptNot.MatchString(line) {
+			if v, ok := parseReceiptAmount(amounts[len(amounts)-1]); ok && v > bestTotal {
+				bestTotal = v
+			}
+		}
+
+		if r.Date.IsZero() {
+			r.Date = parseReceiptDate(line)
+		}
+	}
+
+	r.Total = bestTotal
+	if r.Total == 0 {
+		r.Total = largest
+	}
+	return r
+}
+
+func parseReceiptDate(line string) time.Time {
+	if m := reISODate.FindStringSubmatch(line); m != nil {
+		if d, err := time.Parse("2006-01-02", m[0]); err == nil {
+			return d
+		}
+	}
+	m := reNumericDate.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}
+	}
+	a, _ := strconv.Atoi(m[1])
+	b, _ := strconv.Atoi(m[2])
+	year, _ := strconv.Atoi(m[3])
+	if year < 100 {
+		year += 2000
+	}
+	// Day-first unless that is impossible (US receipts)
+	day, month := a, b
+	if month > 12 && day <= 12 {
+		day, month = b, a
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// ExpenseTool logs expenses, reads photographed receipts and summarizes
+// spending per month.
+type ExpenseTool struct {
+	ledger   ExpenseLedger
+	currency string
+	profiles *profile.Store
+	channel  string
+	chatID   string
+	now      func() time.Time
+}
+
+func NewExpenseTool(ledger ExpenseLedger, currency string, profiles *profile.Store) *ExpenseTool {
+	if currency == "" {
+		currency = "USD"
+	}
+	return &ExpenseTool{ledger: ledger, currency: strings.ToUpper(currency), profiles: profiles, now: time.Now}
+}
+
+func (t *ExpenseTool) Name() string {
+	return "expenses"
+}
+
+func (t *ExpenseTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "log", "scan_receipt")
+}
+
+// ActionScopes asks for Sheets access only when expenses go to a Google
+// Sheet.
+func (t *ExpenseTool) ActionScopes() map[string][]string {
+	if _, ok := t.ledger.(*GoogleSheetLedger); !ok {
+		return nil
+	}
+	write := googleScopes("spreadsheets")
+	return map[string][]string{"log": write, "scan_receipt": write}
+}
+
+func (t *ExpenseTool) Description() string {
+	return "Track expenses: log an expense (amount, category, merchant, date), log one from a photographed receipt (pass the [image text: ...] of the photo as receipt_text), list a month's expenses, or get a monthly summary by category."
+}
+
+func (t *ExpenseTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"log", "scan_receipt", "list", "summary"},
+				"description": "Action to perform",
+			},
+			"amount": map[string]interface{}{
+				"type":        "number",
+				"description": "Amount spent (log; overrides the receipt total for scan_receipt)",
+			},
+			"currency": map[string]interface{}{
+				"type":        "string",
+				"description": "ISO currency code, default " + t.currency,
+			},
+			"category": map[string]interface{}{
+				"type":        "string",
+				"description": "Category such as groceries, restaurants, transport, utilities",
+			},
+			"merchant": map[string]interface{}{
+				"type":        "string",
+				"description": "Where the money was spent",
+			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "Date as YYYY-MM-DD, default today",
+			},
+			"note": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional note",
+			},
+			"receipt_text": map[string]interface{}{
+				"type":        "string",
+				"description": "OCR text of a receipt photo (scan_receipt)",
+			},
+			"month": map[string]interface{}{
+				"type":        "string",
+				"description": "Month as YYYY-MM for list/summary, default the current month",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ExpenseTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// today returns the current date in the user's timezone.
+func (t *ExpenseTool) today() time.Time {
+	now := t.now()
+	if t.profiles != nil {
+		now = now.In(t.profiles.Get(t.channel + ":" + t.chatID).Location())
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (t *ExpenseTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	switch action {
+	case "log":
+		amount, ok := args["amount"].(float64)
+		if !ok || amount == 0 {
+			return ErrorResult("amount is required for log")
+		}
+		e, err := t.expenseFromArgs(args, amount, time.Time{}, "")
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return t.add(ctx, e, "")
+
+	case "scan_receipt":
+		text, _ := args["receipt_text"].(string)
+		if strings.TrimSpace(text) == "" {
+			return ErrorResult("receipt_text is required for scan_receipt")
+		}
+		receipt := ParseReceipt(text)
+		amount := receipt.Total
+		if a, ok := args["amount"].(float64); ok && a != 0 {
+			amount = a
+		}
+		if amount == 0 {
+			return ErrorResult("could not find a total on the receipt; ask the user for the amount and use action=log")
+		}
+		e, err := t.expenseFromArgs(args, amount, receipt.Date, receipt.Merchant)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return t.add(ctx, e, " (read from receipt; ask the user to correct anything that looks wrong)")
+
+	case "list", "summary":
+		from, err := t.monthArg(args)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		to := from.AddDate(0, 1, 0)
+		expenses, err := t.ledger.List(ctx, from, to)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read expenses: %v", err)).WithError(err)
+		}
+		if action == "list" {
+			return SilentResult(formatExpenseList(from, expenses))
+		}
+		previous, err := t.ledger.List(ctx, from.AddDate(0, -1, 0), from)
+		if err != nil {
+			previous = nil
+		}
+		return SilentResult(formatExpenseSummary(from, expenses, previous))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *ExpenseTool) expenseFromArgs(args map[string]interface{}, amount float64, date time.Time, merchant string) (*Expense, error) {
+	e := &Expense{
+		Date:     date,
+		Cents:    toCents(amount),
+		Currency: t.currency,
+		Category: "uncategorized",
+		Merchant: merchant,
+	}
+	if v, ok := args["date"].(string); ok && v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", v)
+		}
+		e.Date = d
+	}
+	if e.Date.IsZero() {
+		e.Date = t.today()
+	}
+	if v, ok := args["currency"].(string); ok && v != "" {
+		e.Currency = strings.ToUpper(strings.TrimSpace(v))
+	}
+	if v, ok := args["category"].(string); ok && v != "" {
+		e.Category = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v, ok := args["merchant"].(string); ok && v != "" {
+		e.Merchant = strings.TrimSpace(v)
+	}
+	if v, ok := args["note"].(string); ok {
+		e.Note = strings.TrimSpace(v)
+	}
+	return e, nil
+}
+
+func (t *ExpenseTool) add(ctx context.Context, e *Expense, suffix string) *ToolResult {
+	if err := t.ledger.Add(ctx, e); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to log expense: %v", err)).WithError(err)
+	}
+	desc := fmt.Sprintf("Logged %s", formatCents(e.Cents, e.Currency))
+	if e.Merchant != "" {
+		desc += " at " + e.Merchant
+	}
+	desc += fmt.Sprintf(" on %s [%s]", e.Date.Format("2006-01-02"), e.Category)
+	return SilentResult(desc + suffix)
+}
+
+func (t *ExpenseTool) monthArg(args map[string]interface{}) (time.Time, error) {
+	if v, ok := args["month"].(string); ok && v != "" {
+		m, err := time.Parse("2006-01", v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid month %q (expected YYYY-MM)", v)
+		}
+		return m, nil
+	}
+	today := t.today()
+	return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+func formatExpenseList(month time.Time, expenses []Expense) string {
+	if len(expenses) == 0 {
+		return fmt.Sprintf("No expenses in %s", month.Format("January 2006"))
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Expenses in %s:\n", month.Format("January 2006"))
+	for _, e := range expenses {
+		fmt.Fprintf(&sb, "- %s %s [%s]", e.Date.Format("Jan 2"), formatCents(e.Cents, e.Currency), e.Category)
+		if e.Merchant != "" {
+			fmt.Fprintf(&sb, " %s", e.Merchant)
+		}
+		if e.Note != "" {
+			fmt.Fprintf(&sb, " — %s", e.Note)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// formatExpenseSummary totals a month by currency and category and compares
+// it with the previous month.
+func formatExpenseSummary(month time.Time, expenses, previous []Expense) string {
+	if len(expenses) == 0 {
+		return fmt.Sprintf("No expenses in %s", month.Format("January 2006"))
+	}
+
+	totals := make(map[string]int64)
+	prevTotals := make(map[string]int64)
+	byCategory := make(map[string]map[string]int64)
+	byMerchant := make(map[string]int64)
+	for _, e := range expenses {
+		totals[e.Currency] += e.Cents
+		if byCategory[e.Currency] == nil {
+			byCategory[e.Currency] = make(map[string]int64)
+		}
+		byCategory[e.Currency][e.Category] += e.Cents
+		if e.Merchant != "" {
+			byMerchant[e.Merchant+"\x00"+e.Currency] += e.Cents
+		}
+	}
+	for _, e := range previous {
+		prevTotals[e.Currency] += e.Cents
+	}
+
+	currencies := make([]string, 0, len(totals))
+	for c := range totals {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Spending in %s (%d expenses):\n", month.Format("January 2006"), len(expenses))
+	for _, cur := range currencies {
+		fmt.Fprintf(&sb, "\nTotal: %s", formatCents(totals[cur], cur))
+		if prev := prevTotals[cur]; prev > 0 {
+			change := float64(totals[cur]-prev) / float64(prev) * 100
+			fmt.Fprintf(&sb, " (%+.0f%% vs %s)", change, month.AddDate(0, -1, 0).Format("January"))
+		}
+		sb.WriteString("\n")
+
+		cats := byCategory[cur]
+		names := make([]string, 0, len(cats))
+		for name := range cats {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return cats[names[i]] > cats[names[j]] })
+		for _, name := range names {
+			fmt.Fprintf(&sb, "- %s: %s (%.0f%%)\n", name, formatCents(cats[name], cur),
+				float64(cats[name])/float64(totals[cur])*100)
+		}
+	}
+
+	if len(byMerchant) > 0 {
+		keys := make([]string, 0, len(byMerchant))
+		for k := range byMerchant {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return byMerchant[keys[i]] > byMerchant[keys[j]] })
+		if len(keys) > 3 {
+			keys = keys[:3]
+		}
+		sb.WriteString("\nTop merchants:\n")
+		for _, k := range keys {
+			merchant, cur, _ := strings.Cut(k, "\x00")
+			fmt.Fprintf(&sb, "- %s: %s\n", merchant, formatCents(byMerchant[k], cur))
+		}
+	}
+	return sb.String()
+}
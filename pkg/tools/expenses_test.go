@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseReceipt verifies totals, dates and merchants are read from OCR text in common formats
+func TestParseReceipt(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		merchant string
+		total    float64
+		date     string
+	}{
+		{
+			name:     "US receipt",
+			text:     "TRADER JOE'S\n#123 Main St\n03/14/2026 18:02\nBANANAS 1.99\nSUBTOTAL 41.20\nTAX 3.30\nTOTAL 44.50\nCASH 50.00\nCHANGE 5.50",
+			merchant: "TRADER JOE'S",
+			total:    44.50,
+			date:     "2026-03-14",
+		},
+		{
+			name:     "European receipt",
+			text:     "Pingo Doce\nNIF 500829993\nData: 02.03.2026\nIVA 23% 12,34\nTotal a pagar 1.234,56\n",
+			merchant: "Pingo Doce",
+			total:    1234.56,
+			date:     "2026-03-02",
+		},
+		{
+			name:     "no total line",
+			text:     "Corner Cafe\n2026-01-05\nCoffee 3.50\nCake 4.25",
+			merchant: "Corner Cafe",
+			total:    4.25,
+			date:     "2026-01-05",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ParseReceipt(tt.text)
+			if r.Merchant != tt.merchant {
+				t.Errorf("merchant = %q, want %q", r.Merchant, tt.merchant)
+			}
+			if r.Total != tt.total {
+				t.Errorf("total = %v, want %v", r.Total, tt.total)
+			}
+			if got := r.Date.Format("2006-01-02"); got != tt.date {
+				t.Errorf("date = %s, want %s", got, tt.date)
+			}
+		})
+	}
+}
+
+// TestExpenseTool_SQLiteLedgerSummary verifies expenses logged to SQLite come back in the monthly summary
+func TestExpenseTool_SQLiteLedgerSummary(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	ledger := NewSQLiteLedger(filepath.Join(t.TempDir(), "expenses.db"))
+	tool := NewExpenseTool(ledger, "eur", nil)
+	tool.now = func() time.Time { return time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	for _, args := range []map[string]interface{}{
+		{"action": "log", "amount": 30.0, "category": "Groceries", "merchant": "O'Brien's Market"},
+		{"action": "log", "amount": 12.5, "category": "restaurants", "date": "2026-03-02"},
+		{"action": "scan_receipt", "receipt_text": "Pingo Doce\n05/03/2026\nTotal 17,50", "category": "groceries"},
+		{"action": "log", "amount": 40.0, "category": "groceries", "date": "2026-02-10"},
+	} {
+		if result := tool.Execute(ctx, args); result.IsError {
+			t.Fatalf("%v failed: %s", args, result.ForLLM)
+		}
+	}
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "summary"})
+	if result.IsError {
+		t.Fatalf("summary failed: %s", result.ForLLM)
+	}
+	for _, want := range []string{"(3 expenses)", "Total: 60.00 EUR (+50% vs February)", "groceries: 47.50 EUR", "O'Brien's Market: 30.00 EUR"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in summary:\n%s", want, result.ForLLM)
+		}
+	}
+}
+
+// TestSQLiteLedger_NULCannotEndTheLiteral verifies a NUL in one field does
+// not let SQL in the next run: both are stored as text
+func TestSQLiteLedger_NULCannotEndTheLiteral(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	ledger := NewSQLiteLedger(filepath.Join(t.TempDir(), "expenses.db"))
+	ctx := context.Background()
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	if err := ledger.Add(ctx, &Expense{Date: day, Cents: 100, Currency: "EUR", Category: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	injected := "'); DELETE FROM expenses; --"
+	if err := ledger.Add(ctx, &Expense{Date: day, Cents: 200, Currency: "EUR", Category: "a\x00", Note: injected}); err != nil {
+		t.Fatal(err)
+	}
+	expenses, err := ledger.List(ctx, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != 2 {
+		t.Fatalf("expenses = %+v, want both", expenses)
+	}
+	for _, e := range expenses {
+		if e.Cents == 200 && (e.Category != "a" || e.Note != injected) {
+			t.Errorf("stored %q / %q", e.Category, e.Note)
+		}
+	}
+}
+
+// TestGoogleSheetLedger_AppendAndList verifies rows are appended raw and read back, skipping the header
+func TestGoogleSheetLedger_AppendAndList(t *testing.T) {
+	var appended [][]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("Missing auth header")
+		}
+		switch r.Method {
+		case http.MethodPost:
+			if r.URL.Query().Get("valueInputOption") != "RAW" {
+				t.Errorf("Expected RAW input, got %s", r.URL.RawQuery)
+			}
+			var body struct {
+				Values [][]interface{} `json:"values"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			appended = body.Values
+			w.Write([]byte(`{"updates":{"updatedRange":"Expenses!A5:F5"}}`))
+		default:
+			w.Write([]byte(`{"values":[["Date","Amount","Currency"],["2026-03-01",9.9,"USD","books","Shop"],["2026-04-01",1,"USD"]]}`))
+		}
+	}))
+	defer server.Close()
+
+	ledger := NewGoogleSheetLedger(func(ctx context.Context) (string, error) { return "tok", nil }, "sheet-id", "")
+	ledger.baseURL = server.URL
+	ctx := context.Background()
+
+	e := &Expense{Date: time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC), Cents: 1250, Currency: "USD", Category: "food"}
+	if err := ledger.Add(ctx, e); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if e.ID != "Expenses!A5:F5" || len(appended) != 1 || appended[0][0] != "2026-03-03" || appended[0][1] != 12.5 {
+		t.Errorf("Unexpected append: id=%s rows=%v", e.ID, appended)
+	}
+
+	expenses, err := ledger.List(ctx, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(expenses) != 1 || expenses[0].Cents != 990 || expenses[0].Merchant != "Shop" {
+		t.Errorf("Unexpected expenses: %+v", expenses)
+	}
+}
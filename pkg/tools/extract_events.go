@@ -0,0 +1,538 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/ics"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	// eventProposalTTL is how long proposed events can be confirmed
+	eventProposalTTL = 24 * time.Hour
+	// maxExtractChars bounds the email text sent for extraction
+	maxExtractChars = 20000
+)
+
+const extractEventsPrompt = `You extract calendar events from an email. Return ONLY a JSON array (no prose, no code fences). Each element:
+{"kind": "flight|train|reservation|delivery|invitation|appointment|other", "title": "...", "start": "YYYY-MM-DDTHH:MM or YYYY-MM-DD", "end": "same formats or empty", "timezone": "IANA zone of the place where it happens, or empty if unknown", "location": "...", "notes": "..."}
+Rules:
+- Only include events the recipient will attend or must be present for. Ignore marketing, past events and mere mentions.
+- Flights and trains: one event per leg, title like "Flight AF 1234 CDG → JFK", start/end in the local times printed on the ticket, timezone of the departure; put the booking reference, seat and terminal in notes.
+- Deliveries: an all-day event on the expected date (date only), title like "Delivery: <what> (<carrier>)".
+- Hotel or restaurant reservations: check-in/arrival time if given, otherwise date only.
+- Never invent dates or times that are not in the email. Return [] if there is nothing to add.`
+
+// posterHint is added to the extraction prompt when the text was read
+// from a photo rather than an email.
+const posterHint = `The text below was read by OCR from a photo of a poster, flyer or printed invitation, not from an email: expect broken lines and misread characters. Propose the event the poster advertises (kind "other" unless it is clearly an invitation), with its name as title and the venue as location; put the organizer, price and ticket link in notes. A date printed without a year is its next occurrence after today.`
+
+// extractedEvent is one event as returned by the extraction prompt.
+type extractedEvent struct {
+	Kind     string `json:"kind"`
+	Title    string `json:"title"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+	Location string `json:"location"`
+	Notes    string `json:"notes"`
+}
+
+// EventProposal holds events extracted from one email until the user
+// confirms them.
+type EventProposal struct {
+	ID      string
+	ChatKey string
+	Source  string
+	Events  []CalendarEvent
+	// Existing marks events that already appear in the calendar
+	Existing []bool
+	Created  time.Time
+}
+
+// ExtractEventsTool reads an email (or pasted text), proposes the calendar
+// events in it and adds the ones the user confirms. Calendar attachments
+// (.ics) are used as-is; other emails go through an extraction prompt.
+type ExtractEventsTool struct {
+	gmail      *GmailClient
+	calendar   *GoogleCalendarClient
+	provider   providers.LLMProvider
+	model      string
+	calendarID string
+	profiles   *profile.Store
+	ocr        ocr.Engine
+	workspace  string
+	restrict   bool
+	mu         sync.Mutex
+	proposals  map[string]*EventProposal
+	travel     *TravelPlanner
+	channel    string
+	chatID     string
+	now        func() time.Time
+}
+
+func NewExtractEventsTool(token TokenFunc, provider providers.LLMProvider, model, calendarID string, profiles *profile.Store) *ExtractEventsTool {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	return &ExtractEventsTool{
+		gmail:      NewGmailClient(token),
+		calendar:   NewGoogleCalendarClient(token),
+		provider:   provider,
+		model:      model,
+		calendarID: calendarID,
+		profiles:   profiles,
+		proposals:  make(map[string]*EventProposal),
+		now:        time.Now,
+	}
+}
+
+// SetOCR lets propose read events from images in the workspace (posters,
+// flyers, tickets the user photographed).
+func (t *ExtractEventsTool) SetOCR(engine ocr.Engine, workspace string, restrict bool) {
+	t.ocr = engine
+	t.workspace = workspace
+	t.restrict = restrict
+}
+
+// SetTravel has confirm work out the travel time to events with a
+// location, and block it or warn when it cannot be made.
+func (t *ExtractEventsTool) SetTravel(p *TravelPlanner) {
+	t.travel = p
+}
+
+func (t *ExtractEventsTool) Name() string {
+	return "extract_events"
+}
+
+func (t *ExtractEventsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "confirm")
+}
+
+// Untrusted is true: proposals and the events made from them carry text
+// read from the message or file.
+func (t *ExtractEventsTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ExtractEventsTool) ActionScopes() map[string][]string {
+	return map[string][]string{"confirm": googleScopes("calendar.events", "calendar")}
+}
+
+func (t *ExtractEventsTool) Description() string {
+	return "Find calendar events in an email (flight or train bookings, invitations, reservations, deliveries) and add them to Google Calendar. Run action=propose with an email_id, a Gmail search query, pasted text, or a photographed poster or flyer (image_text with the [image text: ...] of the user's photo, or image with a file path); show the proposed events to the user; then call action=confirm with the proposal_id (and optionally which events) only after they agree."
+}
+
+// Configure takes "calendar_id", the calendar confirmed events are added to.
+func (t *ExtractEventsTool) Configure(settings ToolSettings) error {
+	calendarID, err := settings.String("calendar_id")
+	if err == nil && calendarID != "" {
+		t.calendarID = calendarID
+	}
+	return err
+}
+
+func (t *ExtractEventsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"propose", "confirm"},
+				"description": "propose extracts events without changing anything; confirm adds them",
+			},
+			"email_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Gmail message ID (propose)",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Gmail search query; the newest match is used, e.g. \"from:airfrance booking\" (propose)",
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "Email or message text pasted by the user (propose)",
+			},
+			"image_text": map[string]interface{}{
+				"type":        "string",
+				"description": "Text read from a photo the user sent, the [image text: ...] part of their message, when it shows a poster, flyer or invitation (propose)",
+			},
+			"image": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of a poster, flyer or ticket image to read (propose)",
+			},
+			"proposal_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Proposal to confirm",
+			},
+			"events": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "integer"},
+				"description": "Numbers of the proposed events to add (default all new ones)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ExtractEventsTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *ExtractEventsTool) location(chatKey string) *time.Location {
+	if t.profiles == nil {
+		return time.Local
+	}
+	return t.profiles.Get(chatKey).Location()
+}
+
+func (t *ExtractEventsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	chatKey := t.channel + ":" + t.chatID
+
+	switch action {
+	case "propose":
+		emailID, _ := args["email_id"].(string)
+		query, _ := args["query"].(string)
+		text, _ := args["text"].(string)
+		imageText, _ := args["image_text"].(string)
+		image, _ := args["image"].(string)
+		loc := t.location(chatKey)
+
+		var source, hint string
+		var calendars []string
+		switch {
+		case emailID != "" || query != "":
+			if emailID == "" {
+				ids, err := t.gmail.Search(ctx, query, 1)
+				if err != nil {
+					return ErrorResult(fmt.Sprintf("email search failed: %v", err)).WithError(err)
+				}
+				if len(ids) == 0 {
+					return ErrorResult(fmt.Sprintf("no email matches %q", query))
+				}
+				emailID = ids[0]
+			}
+			msg, err := t.gmail.GetMessage(ctx, emailID)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("failed to read email: %v", err)).WithError(err)
+			}
+			source = fmt.Sprintf("email %q from %s", msg.Subject, msg.From)
+			text = fmt.Sprintf("From: %s\nDate: %s\nSubject: %s\n\n%s", msg.From, msg.Date, msg.Subject, msg.Text)
+			calendars = msg.Calendars
+		case image != "":
+			recognized, err := t.readImage(ctx, image)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("failed to read the image: %v", err)).WithError(err)
+			}
+			if recognized == "" {
+				return SilentResult("No text could be read from the image; ask the user for the event details or a sharper photo.")
+			}
+			source, hint, text = "poster image", posterHint, recognized
+		case strings.TrimSpace(imageText) != "":
+			source, hint, text = "poster image", posterHint, imageText
+		case strings.TrimSpace(text) != "":
+			source = "pasted text"
+		default:
+			return ErrorResult("email_id, query, text, image_text or image is required")
+		}
+
+		events, err := t.fromCalendars(calendars, loc)
+		if err != nil || len(events) == 0 {
+			events, err = t.fromText(ctx, text, hint, loc)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("extraction failed: %v", err)).WithError(err)
+			}
+		}
+		if len(events) == 0 {
+			return SilentResult(fmt.Sprintf("No events found in %s", source))
+		}
+
+		proposal := &EventProposal{
+			ID:       newPlanID(),
+			ChatKey:  chatKey,
+			Source:   source,
+			Events:   events,
+			Existing: t.markExisting(ctx, events),
+			Created:  t.now(),
+		}
+		t.mu.Lock()
+		for id, p := range t.proposals {
+			if t.now().Sub(p.Created) > eventProposalTTL {
+				delete(t.proposals, id)
+			}
+		}
+		t.proposals[proposal.ID] = proposal
+		t.mu.Unlock()
+		return SilentResult(formatEventProposal(proposal, LocaleFromContext(ctx)))
+
+	case "confirm":
+		id, _ := args["proposal_id"].(string)
+		t.mu.Lock()
+		proposal, ok := t.proposals[id]
+		t.mu.Unlock()
+		if !ok || proposal.ChatKey != chatKey || t.now().Sub(proposal.Created) > eventProposalTTL {
+			return ErrorResult(fmt.Sprintf("proposal %q not found or expired; run action=propose again", id))
+		}
+
+		selected := make(map[int]bool)
+		if raw, ok := args["events"].([]interface{}); ok && len(raw) > 0 {
+			for _, v := range raw {
+				n, _ := v.(float64)
+				if int(n) < 1 || int(n) > len(proposal.Events) {
+					return ErrorResult(fmt.Sprintf("event %v is not in the proposal (1-%d)", v, len(proposal.Events)))
+				}
+				selected[int(n)-1] = true
+			}
+		} else {
+			for i := range proposal.Events {
+				if !proposal.Existing[i] {
+					selected[i] = true
+				}
+			}
+		}
+		if len(selected) == 0 {
+			return SilentResult(locale.T(LocaleFromContext(ctx), "events.nothing_new"))
+		}
+
+		var lines, failures []string
+		for i, ev := range proposal.Events {
+			if !selected[i] {
+				continue
+			}
+			created, err := t.calendar.InsertEvent(ctx, t.calendarID, ev)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", ev.Summary, err))
+				continue
+			}
+			line := fmt.Sprintf("- %s, %s %s", ev.Summary, describeEventTime(ev, LocaleFromContext(ctx)), created.HTMLLink)
+			if t.travel != nil {
+				ev.ID = created.ID
+				if note := t.travel.Arrange(ctx, t.calendarID, ev, LocaleFromContext(ctx)); note != "" {
+					line += "\n  " + note
+				}
+			}
+			lines = append(lines, line)
+		}
+		t.mu.Lock()
+		delete(t.proposals, id)
+		t.mu.Unlock()
+
+		var sb strings.Builder
+		tag := LocaleFromContext(ctx)
+		sb.WriteString(locale.T(tag, "events.added", len(lines)))
+		if len(lines) > 0 {
+			sb.WriteString(":\n" + strings.Join(lines, "\n"))
+		}
+		if len(failures) > 0 {
+			fmt.Fprintf(&sb, "\n%s:\n- %s", locale.T(tag, "events.failed", len(failures)), strings.Join(failures, "\n- "))
+		}
+		return NewToolResult(sb.String())
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// fromCalendars converts .ics attachments. Cancellations are left out: they
+// describe an event to remove, not one to add.
+func (t *ExtractEventsTool) fromCalendars(calendars []string, loc *time.Location) ([]CalendarEvent, error) {
+	var events []CalendarEvent
+	var lastErr error
+	for _, data := range calendars {
+		parsed, err := ics.Parse(data, loc)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, ev := range parsed {
+			if ev.Method == "CANCEL" || ev.Status == "CANCELLED" {
+				continue
+			}
+			events = append(events, CalendarEvent{
+				Summary:     ev.Summary,
+				Description: ev.Description,
+				Location:    ev.Location,
+				Start:       ev.Start,
+				End:         ev.End,
+				AllDay:      ev.AllDay,
+				ICalUID:     ev.UID,
+			})
+		}
+	}
+	if len(events) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return events, nil
+}
+
+// readImage OCRs an image file the tool is allowed to read.
+func (t *ExtractEventsTool) readImage(ctx context.Context, path string) (string, error) {
+	if t.ocr == nil || !t.ocr.IsAvailable() {
+		return "", fmt.Errorf("images need OCR, which is not available (install tesseract and enable ocr)")
+	}
+	resolved, err := validatePath(path, t.workspace, t.restrict)
+	if err != nil {
+		return "", err
+	}
+	return t.ocr.Recognize(ctx, resolved)
+}
+
+// fromText asks the model for the events in text; hint, if any, tells it
+// where the text comes from.
+func (t *ExtractEventsTool) fromText(ctx context.Context, text, hint string, loc *time.Location) ([]CalendarEvent, error) {
+	if len(text) > maxExtractChars {
+		text = text[:maxExtractChars]
+	}
+	prompt := extractEventsPrompt
+	if hint != "" {
+		prompt += "\n" + hint
+	}
+	today := t.now().In(loc).Format("Monday 2006-01-02")
+	messages := []providers.Message{
+		{Role: "system", Content: prompt + "\n\n" + quotedDocumentNote},
+		{Role: "user", Content: fmt.Sprintf("Today is %s (user timezone %s).\n\n%s", today, loc.String(), QuoteUntrusted(t.Name(), text))},
+	}
+	resp, err := t.provider.Chat(ctx, messages, nil, t.model, map[string]interface{}{
+		"max_tokens":  1500,
+		"temperature": 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw := resp.Content
+	start, end := strings.Index(raw, "["), strings.LastIndex(raw, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("model returned no event list")
+	}
+	var extracted []extractedEvent
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &extracted); err != nil {
+		return nil, fmt.Errorf("model returned invalid events: %w", err)
+	}
+
+	var events []CalendarEvent
+	for _, e := range extracted {
+		ev, err := e.toCalendarEvent(loc, t.now())
+		if err != nil {
+			// A partial answer is still useful; skip what can't be placed
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (e extractedEvent) toCalendarEvent(userLoc *time.Location, now time.Time) (CalendarEvent, error) {
+	loc := userLoc
+	if e.Timezone != "" {
+		if l, err := time.LoadLocation(e.Timezone); err == nil {
+			loc = l
+		}
+	}
+	ev := CalendarEvent{Summary: strings.TrimSpace(e.Title), Location: e.Location, Description: e.Notes}
+	if ev.Summary == "" {
+		return ev, fmt.Errorf("event without title")
+	}
+	parse := func(s string) (time.Time, bool, error) {
+		s = strings.TrimSpace(s)
+		if len(s) == len("2006-01-02") {
+			t, err := time.ParseInLocation("2006-01-02", s, loc)
+			return t, true, err
+		}
+		for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", time.RFC3339} {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return t, false, nil
+			}
+		}
+		// Models sometimes copy the text's own words ("Saturday 8pm")
+		r, err := when.Parse(s, now.In(loc), "")
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid time %q", s)
+		}
+		return r.Time, !r.HasTime, nil
+	}
+
+	var err error
+	if ev.Start, ev.AllDay, err = parse(e.Start); err != nil {
+		return ev, err
+	}
+	if e.End != "" {
+		end, endAllDay, err := parse(e.End)
+		if err == nil && endAllDay == ev.AllDay && !end.Before(ev.Start) {
+			ev.End = end
+			if ev.AllDay {
+				// Calendar all-day ranges end the day after the last day
+				ev.End = ev.End.AddDate(0, 0, 1)
+			}
+		}
+	}
+	if ev.End.IsZero() {
+		if ev.AllDay {
+			ev.End = ev.Start.AddDate(0, 0, 1)
+		} else {
+			ev.End = ev.Start.Add(time.Hour)
+		}
+	}
+	return ev, nil
+}
+
+// markExisting flags proposed events already in the calendar (same title
+// and start), e.g. when the same confirmation email is processed twice.
+func (t *ExtractEventsTool) markExisting(ctx context.Context, events []CalendarEvent) []bool {
+	existing := make([]bool, len(events))
+	from, to := events[0].Start, events[0].End
+	for _, ev := range events[1:] {
+		if ev.Start.Before(from) {
+			from = ev.Start
+		}
+		if ev.End.After(to) {
+			to = ev.End
+		}
+	}
+	current, err := t.calendar.ListEvents(ctx, t.calendarID, from.Add(-time.Minute), to.Add(time.Minute))
+	if err != nil {
+		// Not fatal: the user just won't see the hint
+		return existing
+	}
+	for i, ev := range events {
+		for _, c := range current {
+			sameStart := c.Start.Equal(ev.Start) || (ev.AllDay && c.AllDay && c.Start.Format("2006-01-02") == ev.Start.Format("2006-01-02"))
+			if sameStart && (strings.EqualFold(c.Summary, ev.Summary) || (ev.ICalUID != "" && c.ICalUID == ev.ICalUID)) {
+				existing[i] = true
+				break
+			}
+		}
+	}
+	return existing
+}
+
+func formatEventProposal(p *EventProposal, tag string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Proposal %s, %d event(s) from %s:\n", p.ID, len(p.Events), p.Source)
+	for i, ev := range p.Events {
+		fmt.Fprintf(&sb, "%d. %s, %s", i+1, ev.Summary, describeEventTime(ev, tag))
+		if ev.Location != "" {
+			sb.WriteString(" @ " + ev.Location)
+		}
+		if p.Existing[i] {
+			sb.WriteString(" (" + locale.T(tag, "events.in_calendar") + ")")
+		}
+		sb.WriteString("\n")
+		if ev.Description != "" {
+			sb.WriteString("   " + strings.ReplaceAll(utils.Truncate(ev.Description, 200), "\n", " ") + "\n")
+		}
+	}
+	sb.WriteString("Nothing has been added yet. Ask the user to confirm, then call action=confirm with this proposal_id.")
+	return sb.String()
+}
@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// staticProvider answers every call with a fixed reply
+type staticProvider struct {
+	reply string
+	calls int
+}
+
+func (p *staticProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	return &providers.LLMResponse{Content: p.reply}, nil
+}
+
+func (p *staticProvider) GetDefaultModel() string { return "test" }
+
+func newExtractEventsTestServer(t *testing.T, payload map[string]interface{}, inserted *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gmail/users/me/messages":
+			w.Write([]byte(`{"messages":[{"id":"m1"}]}`))
+		case r.URL.Path == "/gmail/users/me/messages/m1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "m1", "payload": payload})
+		case strings.HasSuffix(r.URL.Path, "/events") && r.Method == http.MethodGet:
+			w.Write([]byte(`{"items":[]}`))
+		case strings.HasPrefix(r.URL.Path, "/cal/calendars/primary/events") && r.Method == http.MethodPost:
+			var ev map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&ev)
+			ev["path"] = r.URL.Path
+			*inserted = append(*inserted, ev)
+			w.Write([]byte(`{"id":"e1","htmlLink":"https://calendar/e1"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newTestExtractEventsTool(server *httptest.Server, provider providers.LLMProvider) *ExtractEventsTool {
+	tool := NewExtractEventsTool(func(ctx context.Context) (string, error) { return "tok", nil }, provider, "test", "", nil)
+	tool.gmail.baseURL = server.URL + "/gmail"
+	tool.calendar.baseURL = server.URL + "/cal"
+	tool.now = func() time.Time { return time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC) }
+	tool.SetContext("telegram", "42")
+	return tool
+}
+
+var proposalIDRe = regexp.MustCompile(`Proposal (\w+)`)
+
+// TestExtractEventsTool_ICSInvitation verifies .ics attachments are used directly and imported by UID after confirmation
+func TestExtractEventsTool_ICSInvitation(t *testing.T) {
+	invite := "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:inv-1\r\nSUMMARY:Design review\r\n" +
+		"DTSTART:20261103T140000Z\r\nDTEND:20261103T150000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	payload := map[string]interface{}{
+		"mimeType": "multipart/mixed",
+		"headers":  []map[string]string{{"name": "Subject", "value": "Invitation: Design review"}},
+		"parts": []map[string]interface{}{
+			{"mimeType": "text/plain", "body": map[string]string{"data": base64.URLEncoding.EncodeToString([]byte("You are invited"))}},
+			{"mimeType": "text/calendar", "filename": "invite.ics", "body": map[string]string{"data": base64.URLEncoding.EncodeToString([]byte(invite))}},
+		},
+	}
+	var inserted []map[string]interface{}
+	server := newExtractEventsTestServer(t, payload, &inserted)
+	defer server.Close()
+	provider := &staticProvider{reply: "[]"}
+	tool := newTestExtractEventsTool(server, provider)
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "propose", "email_id": "m1"})
+	if r.IsError || !strings.Contains(r.ForLLM, "1. Design review") {
+		t.Fatalf("unexpected proposal: %s", r.ForLLM)
+	}
+	if provider.calls != 0 {
+		t.Errorf("the model should not be used when an .ics is attached")
+	}
+	if len(inserted) != 0 {
+		t.Fatal("nothing should be added before confirmation")
+	}
+
+	id := proposalIDRe.FindStringSubmatch(r.ForLLM)[1]
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "confirm", "proposal_id": id})
+	if r.IsError || !strings.Contains(r.ForLLM, "Added 1 event") {
+		t.Fatalf("unexpected confirm result: %s", r.ForLLM)
+	}
+	if len(inserted) != 1 || inserted[0]["path"] != "/cal/calendars/primary/events/import" || inserted[0]["iCalUID"] != "inv-1" {
+		t.Fatalf("unexpected inserted events: %+v", inserted)
+	}
+
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "confirm", "proposal_id": id})
+	if !r.IsError {
+		t.Error("a proposal should only be confirmed once")
+	}
+}
+
+// TestExtractEventsTool_FlightFromText verifies model extraction places flight legs in the departure timezone
+func TestExtractEventsTool_FlightFromText(t *testing.T) {
+	var inserted []map[string]interface{}
+	server := newExtractEventsTestServer(t, nil, &inserted)
+	defer server.Close()
+	provider := &staticProvider{reply: "```json\n[" +
+		`{"kind":"flight","title":"Flight AF 22 CDG → JFK","start":"2026-11-20T10:30","end":"2026-11-20T13:05","timezone":"Europe/Paris","notes":"PNR XY12Z"},` +
+		`{"kind":"delivery","title":"Delivery: boots (UPS)","start":"2026-11-18"},` +
+		`{"kind":"other","title":"","start":"soon"}` + "]\n```"}
+	tool := newTestExtractEventsTool(server, provider)
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "propose", "text": "Your booking AF 22..."})
+	if r.IsError || !strings.Contains(r.ForLLM, "2 event(s)") || !strings.Contains(r.ForLLM, "Fri 20 Nov 2026 10:30") {
+		t.Fatalf("unexpected proposal: %s", r.ForLLM)
+	}
+	id := proposalIDRe.FindStringSubmatch(r.ForLLM)[1]
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "confirm", "proposal_id": id, "events": []interface{}{float64(1)}})
+	if r.IsError || len(inserted) != 1 {
+		t.Fatalf("unexpected confirm: %s (%d inserted)", r.ForLLM, len(inserted))
+	}
+	start := inserted[0]["start"].(map[string]interface{})
+	if start["dateTime"] != "2026-11-20T10:30:00+01:00" || start["timeZone"] != "Europe/Paris" {
+		t.Errorf("unexpected start %+v", start)
+	}
+}
+
+// TestExtractEventsTool_PosterImage verifies a photographed poster is read by OCR and proposed as an event for confirmation
+func TestExtractEventsTool_PosterImage(t *testing.T) {
+	var inserted []map[string]interface{}
+	server := newExtractEventsTestServer(t, nil, &inserted)
+	defer server.Close()
+	provider := &promptRecorder{reply: `[{"kind":"other","title":"Jazz Night: Trio Azul","start":"Saturday 20:30","location":"Blue Note Café"}]`}
+	tool := newTestExtractEventsTool(server, provider)
+
+	workspace := t.TempDir()
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "propose", "image": "poster.jpg"})
+	if !r.IsError || !strings.Contains(r.ForLLM, "OCR") {
+		t.Fatalf("expected an error without OCR, got %s", r.ForLLM)
+	}
+
+	tool.SetOCR(fakeOCR{text: "JAZZ NIGHT\nTrio Azul\nSat 20:30 - Blue Note Cafe"}, workspace, true)
+	if r := tool.Execute(context.Background(), map[string]interface{}{"action": "propose", "image": "/etc/passwd"}); !r.IsError {
+		t.Fatalf("read an image outside the workspace: %s", r.ForLLM)
+	}
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "propose", "image": "poster.jpg"})
+	if r.IsError || !strings.Contains(r.ForLLM, "from poster image") || !strings.Contains(r.ForLLM, "Sat 17 Oct 2026 20:30–21:30 UTC @ Blue Note Café") {
+		t.Fatalf("unexpected proposal: %s", r.ForLLM)
+	}
+	if !strings.Contains(provider.system, "poster") || !strings.Contains(provider.user, "Trio Azul") {
+		t.Errorf("OCR text or poster hint missing from the prompt: %q / %q", provider.system, provider.user)
+	}
+
+	id := proposalIDRe.FindStringSubmatch(r.ForLLM)[1]
+	r = tool.Execute(context.Background(), map[string]interface{}{"action": "confirm", "proposal_id": id})
+	if r.IsError || len(inserted) != 1 || inserted[0]["summary"] != "Jazz Night: Trio Azul" {
+		t.Fatalf("unexpected confirm: %s (%+v)", r.ForLLM, inserted)
+	}
+}
+
+// promptRecorder answers with a fixed reply and keeps the last prompt
+type promptRecorder struct {
+	reply        string
+	system, user string
+}
+
+func (p *promptRecorder) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.system, p.user = messages[0].Content, messages[len(messages)-1].Content
+	return &providers.LLMResponse{Content: p.reply}, nil
+}
+
+func (p *promptRecorder) GetDefaultModel() string { return "test" }
@@ -0,0 +1,490 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/mediaindex"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/storage"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	defaultFilesLimit = 20
+	maxFilesLimit     = 100
+	// maxFilesScanned bounds a search over a large store; results then
+	// cover only the files seen so far
+	maxFilesScanned = 20000
+	// maxStorageDownload bounds what download copies into the workspace
+	maxStorageDownload = 200 << 20
+	// maxPreviewSource skips preview tiles for images too large to decode
+	// on a small board
+	maxPreviewSource = 20 << 20
+)
+
+// FilesTool gives access to files kept outside Google: a local folder,
+// a WebDAV server such as Nextcloud, or an S3-compatible bucket. The same
+// tool serves as the photos tool for those users, with albums being the
+// top-level folders and searches limited to photos and videos.
+type FilesTool struct {
+	store      storage.Store
+	photos     bool
+	profiles   *profile.Store
+	workspace  string
+	restrict   bool
+	previewDir string
+}
+
+// NewFilesTool creates the files tool over store. Uploads are read from,
+// and downloads saved to, the workspace.
+func NewFilesTool(store storage.Store, profiles *profile.Store, workspace string, restrict bool) *FilesTool {
+	return &FilesTool{store: store, profiles: profiles, workspace: workspace, restrict: restrict}
+}
+
+// NewStoragePhotosTool creates a photos tool over store, for users whose
+// photos are not in Google Photos. Collages are written to previewDir.
+func NewStoragePhotosTool(store storage.Store, profiles *profile.Store, workspace string, restrict bool, previewDir string) *FilesTool {
+	return &FilesTool{store: store, photos: true, profiles: profiles, workspace: workspace, restrict: restrict, previewDir: previewDir}
+}
+
+func (t *FilesTool) Name() string {
+	if t.photos {
+		return "photos"
+	}
+	return "files"
+}
+
+func (t *FilesTool) Description() string {
+	if t.photos {
+		return fmt.Sprintf("Browse the user's photos in their %s: list albums (top-level folders, optionally matching a title), find photos and videos by date range and words in the file name, upload a workspace file to an album, or download one into the workspace and send it to the user. Search results come with a preview collage of thumbnails unless preview=false.", t.store.Kind())
+	}
+	return fmt.Sprintf("Work with the user's files in their %s: list a folder, search by words in the name and modification date, upload a workspace file, or download a file into the workspace (downloads/) and send it to the user.", t.store.Kind())
+}
+
+func (t *FilesTool) Parameters() map[string]interface{} {
+	props := map[string]interface{}{
+		"query": map[string]interface{}{
+			"type":        "string",
+			"description": "search: words that must all appear in the file name",
+		},
+		"from": map[string]interface{}{
+			"type":        "string",
+			"description": "search: first day modified, e.g. 2026-05-02, or a span such as \"last week\", \"March\" or \"yesterday\"",
+		},
+		"to": map[string]interface{}{
+			"type":        "string",
+			"description": "search: last day (default: the end of from)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Maximum results (default %d, at most %d)", defaultFilesLimit, maxFilesLimit),
+		},
+		"local_path": map[string]interface{}{
+			"type":        "string",
+			"description": "upload: the workspace file or artifact to upload",
+		},
+		"name": map[string]interface{}{
+			"type":        "string",
+			"description": "upload: file name to store it under (default: the local file's name)",
+		},
+		"send": map[string]interface{}{
+			"type":        "boolean",
+			"description": "download: send the file to the user (default true)",
+		},
+	}
+	if t.photos {
+		props["action"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"albums", "search", "upload", "download"},
+			"description": "albums lists albums; search finds media; upload adds a file to an album; download fetches one",
+		}
+		props["query"].(map[string]interface{})["description"] = "albums: words in the album title. search: words in the file name"
+		props["album"] = map[string]interface{}{
+			"type":        "string",
+			"description": "search: only this album. upload: the album to add to (default: the top level)",
+		}
+		props["path"] = map[string]interface{}{
+			"type":        "string",
+			"description": "download: the photo's path as listed",
+		}
+		props["media_type"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"photo", "video", "all"},
+			"description": "search: which media (default all)",
+		}
+		props["preview"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Send a collage of thumbnails to the user (default true)",
+		}
+	} else {
+		props["action"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"list", "search", "upload", "download"},
+			"description": "list shows a folder; search finds files below path; upload stores a workspace file in the path folder; download fetches the file at path",
+		}
+		props["path"] = map[string]interface{}{
+			"type":        "string",
+			"description": "list/search/upload: a folder (default: the top level). download: the file's path as listed",
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+		"required":   []string{"action"},
+	}
+}
+
+func (t *FilesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "upload")
+}
+
+func (t *FilesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch {
+	case action == "list" && !t.photos:
+		p, _ := args["path"].(string)
+		return t.list(ctx, p)
+	case action == "albums" && t.photos:
+		return t.albums(ctx, args)
+	case action == "search":
+		return t.search(ctx, args)
+	case action == "upload":
+		return t.upload(ctx, args)
+	case action == "download":
+		return t.download(ctx, args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *FilesTool) list(ctx context.Context, dir string) *ToolResult {
+	files, err := t.store.List(ctx, dir)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrorResult(fmt.Sprintf("no folder %q in the %s", dir, t.store.Kind()))
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list %s: %v", t.store.Kind(), err)).WithError(err)
+	}
+	if len(files) == 0 {
+		return SilentResult("The folder is empty.")
+	}
+	loc := t.location(ctx)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d entries:", len(files))
+	for _, f := range files {
+		if f.Dir {
+			fmt.Fprintf(&sb, "\n📁 %s/", f.Path)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s, %s", f.Path, formatFileSize(f.Size))
+		if !f.Modified.IsZero() {
+			fmt.Fprintf(&sb, ", %s", f.Modified.In(loc).Format("2 Jan 2006 15:04"))
+		}
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *FilesTool) albums(ctx context.Context, args map[string]interface{}) *ToolResult {
+	entries, err := t.store.List(ctx, "")
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list albums: %v", err)).WithError(err)
+	}
+	q, _ := args["query"].(string)
+	q = strings.ToLower(strings.TrimSpace(q))
+	var names []string
+	for _, e := range entries {
+		if e.Dir && (q == "" || strings.Contains(strings.ToLower(e.Name()), q)) {
+			names = append(names, e.Path)
+		}
+	}
+	if len(names) == 0 {
+		return SilentResult("No matching albums.")
+	}
+	return SilentResult(fmt.Sprintf("%d album(s):\n%s", len(names), strings.Join(names, "\n")))
+}
+
+func (t *FilesTool) search(ctx context.Context, args map[string]interface{}) *ToolResult {
+	limit := defaultFilesLimit
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), maxFilesLimit)
+	}
+	dir, _ := args["path"].(string)
+	if t.photos {
+		dir, _ = args["album"].(string)
+	}
+	query, _ := args["query"].(string)
+	words := strings.Fields(strings.ToLower(query))
+
+	prof := t.profile(ctx)
+	var from, end time.Time
+	if fromStr, _ := args["from"].(string); fromStr != "" {
+		now := time.Now().In(prof.Location())
+		var err error
+		if from, end, err = when.Range(fromStr, now, prof.Locale); err != nil {
+			return ErrorResult("from: " + err.Error())
+		}
+		if toStr, _ := args["to"].(string); toStr != "" {
+			if _, end, err = when.Range(toStr, now, prof.Locale); err != nil {
+				return ErrorResult("to: " + err.Error())
+			}
+		}
+		if !end.After(from) {
+			return ErrorResult("to must be on or after from")
+		}
+	} else if !t.photos && len(words) == 0 {
+		return ErrorResult("give a query, from/to dates, or both")
+	}
+	mediaType, _ := args["media_type"].(string)
+
+	var found []storage.File
+	scanned := 0
+	err := t.store.Walk(ctx, dir, func(f storage.File) error {
+		if scanned++; scanned > maxFilesScanned {
+			return storage.ErrStopWalk
+		}
+		if t.photos && !matchesMediaType(f.Path, mediaType) {
+			return nil
+		}
+		if !from.IsZero() && (f.Modified.Before(from) || !f.Modified.Before(end)) {
+			return nil
+		}
+		name := strings.ToLower(f.Name())
+		for _, w := range words {
+			if !strings.Contains(name, w) {
+				return nil
+			}
+		}
+		found = append(found, f)
+		return nil
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrorResult(fmt.Sprintf("no folder %q in the %s", dir, t.store.Kind()))
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("search failed: %v", err)).WithError(err)
+	}
+	if len(found) == 0 {
+		return SilentResult("No matching files.")
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Modified.After(found[j].Modified) })
+	total := len(found)
+	if total > limit {
+		found = found[:limit]
+	}
+
+	loc := prof.Location()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d match(es), newest first", total)
+	if total > len(found) {
+		fmt.Fprintf(&sb, ", showing %d", len(found))
+	}
+	sb.WriteString(":")
+	for i, f := range found {
+		fmt.Fprintf(&sb, "\n%d. %s, %s, %s", i+1, f.Path, formatFileSize(f.Size), f.Modified.In(loc).Format("Mon 2 Jan 2006 15:04"))
+	}
+	if scanned > maxFilesScanned {
+		fmt.Fprintf(&sb, "\n(stopped after %d files; narrow the search with path or album to cover the rest)", maxFilesScanned)
+	}
+	text := sb.String()
+
+	preview := t.photos
+	if p, ok := args["preview"].(bool); ok {
+		preview = preview && p
+	}
+	if !preview {
+		return SilentResult(text)
+	}
+	previewPath, shown, err := t.writePreview(ctx, found)
+	if err != nil || shown == 0 {
+		return SilentResult(text)
+	}
+	return &ToolResult{
+		ForLLM: text + fmt.Sprintf("\n\nA collage of the first %d photos was sent to the user, in this order.", shown),
+		Media:  []string{previewPath},
+	}
+}
+
+// matchesMediaType reports whether a file is a photo or video of the kind
+// asked for: "photo", "video", or "" and "all" for either.
+func matchesMediaType(name, mediaType string) bool {
+	mime := mediaindex.MimeType(name)
+	switch mediaType {
+	case "photo":
+		return strings.HasPrefix(mime, "image/")
+	case "video":
+		return strings.HasPrefix(mime, "video/")
+	default:
+		return mime != ""
+	}
+}
+
+func (t *FilesTool) upload(ctx context.Context, args map[string]interface{}) *ToolResult {
+	local, _ := args["local_path"].(string)
+	if local == "" {
+		return ErrorResult("local_path is required for upload")
+	}
+	resolved, err := validatePath(local, t.workspace, t.restrict)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to open %s: %v", local, err))
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return ErrorResult(fmt.Sprintf("%s is not a file", local))
+	}
+
+	dir, _ := args["path"].(string)
+	if t.photos {
+		dir, _ = args["album"].(string)
+		if mediaindex.MimeType(resolved) == "" {
+			return ErrorResult(fmt.Sprintf("%s is not a photo or video", local))
+		}
+	}
+	name, _ := args["name"].(string)
+	if name == "" {
+		name = filepath.Base(resolved)
+	}
+	dest, err := storage.Clean(path.Join(dir, name))
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if err := t.store.Put(ctx, dest, f, info.Size()); err != nil {
+		return ErrorResult(fmt.Sprintf("upload failed: %v", err)).WithError(err)
+	}
+	return NewToolResult(fmt.Sprintf("Uploaded %s (%s) to %s in the %s.", local, formatFileSize(info.Size()), dest, t.store.Kind()))
+}
+
+func (t *FilesTool) download(ctx context.Context, args map[string]interface{}) *ToolResult {
+	name, _ := args["path"].(string)
+	if name == "" {
+		return ErrorResult("path is required for download")
+	}
+	r, err := t.store.Open(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrorResult(fmt.Sprintf("no file %q in the %s", name, t.store.Kind()))
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("download failed: %v", err)).WithError(err)
+	}
+	defer r.Close()
+
+	dir := filepath.Join(t.workspace, "downloads")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to create downloads folder: %v", err))
+	}
+	target := freeFileName(dir, path.Base(name))
+	out, err := os.Create(target)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save %s: %v", name, err))
+	}
+	n, err := io.Copy(out, io.LimitReader(r, maxStorageDownload+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxStorageDownload {
+		err = fmt.Errorf("file is larger than %s", formatFileSize(maxStorageDownload))
+	}
+	if err != nil {
+		os.Remove(target)
+		return ErrorResult(fmt.Sprintf("download failed: %v", err)).WithError(err)
+	}
+
+	rel, _ := filepath.Rel(t.workspace, target)
+	text := fmt.Sprintf("Saved %s (%s) to %s in the workspace.", name, formatFileSize(n), filepath.ToSlash(rel))
+	if send, ok := args["send"].(bool); ok && !send {
+		return SilentResult(text)
+	}
+	return &ToolResult{ForLLM: text + " It was sent to the user.", Media: []string{target}}
+}
+
+// freeFileName returns dir/name, or dir/name-2.ext and so on when that is
+// taken.
+func freeFileName(dir, name string) string {
+	target := filepath.Join(dir, name)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			return target
+		}
+		target = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+	}
+}
+
+// writePreview reads up to previewTiles of the photos concurrently and
+// saves a collage of them. Videos and images that cannot be decoded, such
+// as HEIC, are left out.
+func (t *FilesTool) writePreview(ctx context.Context, files []storage.File) (string, int, error) {
+	var picks []storage.File
+	for _, f := range files {
+		if mime := mediaindex.MimeType(f.Path); (mime == "image/jpeg" || mime == "image/png") && f.Size <= maxPreviewSource {
+			picks = append(picks, f)
+		}
+		if len(picks) == previewTiles {
+			break
+		}
+	}
+	images := make([]image.Image, len(picks))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, previewFetchers)
+	for i, f := range picks {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r, err := t.store.Open(ctx, name)
+			if err != nil {
+				return
+			}
+			defer r.Close()
+			images[i], _, _ = image.Decode(io.LimitReader(r, maxPreviewSource))
+		}(i, f.Path)
+	}
+	wg.Wait()
+
+	var tiles []image.Image
+	for _, img := range images {
+		if img != nil {
+			tiles = append(tiles, img)
+		}
+	}
+	if len(tiles) == 0 {
+		return "", 0, nil
+	}
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, collage(tiles, previewCell), imaging.ThumbnailQuality); err != nil {
+		return "", 0, err
+	}
+	p, err := savePreview(t.previewDir, "photos", ".jpg", buf.Bytes())
+	return p, len(tiles), err
+}
+
+func (t *FilesTool) profile(ctx context.Context) profile.Profile {
+	if t.profiles == nil {
+		return profile.Profile{}
+	}
+	channel, chatID := ChatFromContext(ctx)
+	return t.profiles.Get(channel + ":" + chatID)
+}
+
+func (t *FilesTool) location(ctx context.Context) *time.Location {
+	return t.profile(ctx).Location()
+}
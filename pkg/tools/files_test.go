@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+)
+
+// TestFilesTool_SearchUploadDownload verifies files are found by name and date, uploaded from the workspace and downloaded back to the chat
+func TestFilesTool_SearchUploadDownload(t *testing.T) {
+	root, workspace := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(root, "Taxes"), 0755)
+	os.WriteFile(filepath.Join(root, "Taxes", "return 2025.pdf"), []byte("pdf"), 0644)
+	os.WriteFile(filepath.Join(root, "Taxes", "receipts.zip"), []byte("zip"), 0644)
+	old := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(root, "Taxes", "receipts.zip"), old, old)
+
+	tool := NewFilesTool(storage.NewLocal(root), nil, workspace, true)
+	ctx := context.Background()
+
+	res := tool.Execute(ctx, map[string]interface{}{"action": "search", "query": "Return"})
+	if res.IsError || !strings.Contains(res.ForLLM, "Taxes/return 2025.pdf") || strings.Contains(res.ForLLM, "receipts") {
+		t.Fatalf("search by name: %s", res.ForLLM)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"action": "search", "from": "2024-03-01"})
+	if res.IsError || !strings.Contains(res.ForLLM, "1 match") || !strings.Contains(res.ForLLM, "receipts.zip") {
+		t.Fatalf("search by date: %s", res.ForLLM)
+	}
+
+	os.WriteFile(filepath.Join(workspace, "report.txt"), []byte("quarterly"), 0644)
+	if !tool.Mutates(map[string]interface{}{"action": "upload"}) {
+		t.Error("upload should count as a change")
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"action": "upload", "local_path": "report.txt", "path": "Work/Q2"})
+	if res.IsError {
+		t.Fatalf("upload: %s", res.ForLLM)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "Work", "Q2", "report.txt")); string(data) != "quarterly" {
+		t.Errorf("uploaded %q", data)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"action": "upload", "local_path": "/etc/hostname"})
+	if !res.IsError {
+		t.Error("a file outside the workspace was uploaded")
+	}
+
+	res = tool.Execute(ctx, map[string]interface{}{"action": "download", "path": "Taxes/return 2025.pdf"})
+	if res.IsError || len(res.Media) != 1 {
+		t.Fatalf("download: %s %v", res.ForLLM, res.Media)
+	}
+	if data, _ := os.ReadFile(res.Media[0]); string(data) != "pdf" || filepath.Dir(res.Media[0]) != filepath.Join(workspace, "downloads") {
+		t.Errorf("downloaded %s: %q", res.Media[0], data)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"action": "download", "path": "Taxes/return 2025.pdf", "send": false})
+	if res.IsError || len(res.Media) != 0 || !strings.Contains(res.ForLLM, "return 2025-2.pdf") {
+		t.Errorf("second download: %s %v", res.ForLLM, res.Media)
+	}
+}
+
+// TestStoragePhotosTool_AlbumsAndPreview verifies albums are top-level folders and searches keep to media, with a collage of the photos found
+func TestStoragePhotosTool_AlbumsAndPreview(t *testing.T) {
+	root, workspace := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(root, "Beach"), 0755)
+	os.MkdirAll(filepath.Join(root, "Paris"), 0755)
+	os.WriteFile(filepath.Join(root, "Beach", "IMG_1.jpg"), stripesJPEG(t, 64, 48, 4), 0644)
+	os.WriteFile(filepath.Join(root, "Beach", "clip.mp4"), []byte("video"), 0644)
+	os.WriteFile(filepath.Join(root, "Beach", "notes.txt"), []byte("text"), 0644)
+
+	tool := NewStoragePhotosTool(storage.NewLocal(root), nil, workspace, true, filepath.Join(workspace, "previews"))
+	if tool.Name() != "photos" {
+		t.Fatalf("name %q", tool.Name())
+	}
+	ctx := context.Background()
+
+	res := tool.Execute(ctx, map[string]interface{}{"action": "albums", "query": "bea"})
+	if res.IsError || !strings.Contains(res.ForLLM, "Beach") || strings.Contains(res.ForLLM, "Paris") {
+		t.Fatalf("albums: %s", res.ForLLM)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"action": "search", "album": "Beach"})
+	if res.IsError || !strings.Contains(res.ForLLM, "2 match") || strings.Contains(res.ForLLM, "notes.txt") {
+		t.Fatalf("search: %s", res.ForLLM)
+	}
+	if len(res.Media) != 1 || !strings.Contains(res.ForLLM, "collage of the first 1") {
+		t.Errorf("expected a collage of the one photo, got %v: %s", res.Media, res.ForLLM)
+	}
+	res = tool.Execute(ctx, map[string]interface{}{"action": "search", "album": "Beach", "media_type": "video", "preview": false})
+	if !strings.Contains(res.ForLLM, "1 match") || !strings.Contains(res.ForLLM, "clip.mp4") || len(res.Media) != 0 {
+		t.Errorf("video search: %s %v", res.ForLLM, res.Media)
+	}
+
+	os.WriteFile(filepath.Join(workspace, "notes.txt"), []byte("x"), 0644)
+	if res := tool.Execute(ctx, map[string]interface{}{"action": "upload", "local_path": "notes.txt", "album": "Paris"}); !res.IsError {
+		t.Error("a text file was added to an album")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
 )
 
 // validatePath ensures the given path is within the workspace if restrict is true.
@@ -14,6 +16,15 @@ func validatePath(path, workspace string, restrict bool) (string, error) {
 		return path, nil
 	}
 
+	// Artifact references name files in the workspace's artifact store
+	if artifacts.IsRef(path) {
+		resolved, err := artifacts.Lookup(artifacts.WorkspaceDir(workspace), path)
+		if err != nil {
+			return "", err
+		}
+		path = resolved
+	}
+
 	absWorkspace, err := filepath.Abs(workspace)
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve workspace path: %w", err)
@@ -77,19 +88,64 @@ func isWithinWorkspace(candidate, workspace string) bool {
 	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
 }
 
+// configureWorkspace applies the "workspace" setting shared by the file
+// tools: a directory the tool works in instead of the agent workspace.
+func configureWorkspace(settings ToolSettings, workspace *string) error {
+	dir, err := settings.String("workspace")
+	if err != nil || dir == "" {
+		return err
+	}
+	if strings.HasPrefix(dir, "~") {
+		home, _ := os.UserHomeDir()
+		dir = home + dir[1:]
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("workspace: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("workspace: %s is not a directory", dir)
+	}
+	*workspace = dir
+	return nil
+}
+
 type ReadFileTool struct {
 	workspace string
 	restrict  bool
+	maxBytes  int64
 }
 
 func NewReadFileTool(workspace string, restrict bool) *ReadFileTool {
 	return &ReadFileTool{workspace: workspace, restrict: restrict}
 }
 
+// Configure takes "workspace" and "max_bytes", the largest file read_file
+// will return (no limit by default).
+func (t *ReadFileTool) Configure(settings ToolSettings) error {
+	maxBytes, err := settings.Int("max_bytes")
+	if err != nil {
+		return err
+	}
+	if maxBytes < 0 {
+		return fmt.Errorf("max_bytes: must not be negative, got %d", maxBytes)
+	}
+	t.maxBytes = int64(maxBytes)
+	return configureWorkspace(settings, &t.workspace)
+}
+
 func (t *ReadFileTool) Name() string {
 	return "read_file"
 }
 
+func (t *ReadFileTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ReadFileTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *ReadFileTool) Description() string {
 	return "Read the contents of a file"
 }
@@ -100,7 +156,7 @@ func (t *ReadFileTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"path": map[string]interface{}{
 				"type":        "string",
-				"description": "Path to the file to read",
+				"description": "Path to the file to read, or an artifact reference (artifact:ID)",
 			},
 		},
 		"required": []string{"path"},
@@ -118,6 +174,12 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult(err.Error())
 	}
 
+	if t.maxBytes > 0 {
+		if info, err := os.Stat(resolvedPath); err == nil && info.Size() > t.maxBytes {
+			return ErrorResult(fmt.Sprintf("file is %d bytes, larger than the %d byte limit", info.Size(), t.maxBytes))
+		}
+	}
+
 	content, err := os.ReadFile(resolvedPath)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
@@ -135,10 +197,23 @@ func NewWriteFileTool(workspace string, restrict bool) *WriteFileTool {
 	return &WriteFileTool{workspace: workspace, restrict: restrict}
 }
 
+// Configure takes "workspace".
+func (t *WriteFileTool) Configure(settings ToolSettings) error {
+	return configureWorkspace(settings, &t.workspace)
+}
+
 func (t *WriteFileTool) Name() string {
 	return "write_file"
 }
 
+func (t *WriteFileTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *WriteFileTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *WriteFileTool) Description() string {
 	return "Write content to a file"
 }
@@ -181,9 +256,12 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}
 		return ErrorResult(fmt.Sprintf("failed to create directory: %v", err))
 	}
 
+	// Kept so the write can be undone; nil when the file is new
+	previous, _ := os.ReadFile(resolvedPath)
 	if err := os.WriteFile(resolvedPath, []byte(content), 0644); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
 	}
+	recordFileUndo(ctx, resolvedPath, "wrote", previous)
 
 	return SilentResult(fmt.Sprintf("File written: %s", path))
 }
@@ -197,10 +275,19 @@ func NewListDirTool(workspace string, restrict bool) *ListDirTool {
 	return &ListDirTool{workspace: workspace, restrict: restrict}
 }
 
+// Configure takes "workspace".
+func (t *ListDirTool) Configure(settings ToolSettings) error {
+	return configureWorkspace(settings, &t.workspace)
+}
+
 func (t *ListDirTool) Name() string {
 	return "list_dir"
 }
 
+func (t *ListDirTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *ListDirTool) Description() string {
 	return "List files and directories in a path"
 }
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
 )
 
 // TestFilesystemTool_ReadFile_Success verifies successful file reading
@@ -39,6 +41,27 @@ func TestFilesystemTool_ReadFile_Success(t *testing.T) {
 	}
 }
 
+// TestFilesystemTool_ReadFile_Artifact verifies artifact references resolve to the stored file
+func TestFilesystemTool_ReadFile_Artifact(t *testing.T) {
+	workspace := t.TempDir()
+	store := artifacts.New(artifacts.WorkspaceDir(workspace))
+	a, err := store.Put(strings.NewReader("artifact content"), "notes.txt", "", "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool := NewReadFileTool(workspace, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": a.Ref()})
+	if result.IsError || !strings.Contains(result.ForLLM, "artifact content") {
+		t.Fatalf("unexpected result: %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "artifact:zzzzzz"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "not found") {
+		t.Errorf("expected a not found error, got: %s", result.ForLLM)
+	}
+}
+
 // TestFilesystemTool_ReadFile_NotFound verifies error handling for missing file
 func TestFilesystemTool_ReadFile_NotFound(t *testing.T) {
 	tool := &ReadFileTool{}
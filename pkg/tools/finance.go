@@ -0,0 +1,674 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+const priceAlertJobKind = "price_alert"
+
+// Quote is the latest price for a symbol.
+type Quote struct {
+	Symbol    string
+	Price     float64
+	Currency  string
+	ChangePct float64 // 24h / previous-close change in percent
+}
+
+// PricePoint is one sample in a price history.
+type PricePoint struct {
+	Time  time.Time
+	Price float64
+}
+
+// PriceProvider is implemented by market data backends.
+type PriceProvider interface {
+	Quote(ctx context.Context, symbol string) (*Quote, error)
+	History(ctx context.Context, symbol string, days int) ([]PricePoint, error)
+}
+
+func getJSON(ctx context.Context, client *http.Client, reqURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// YahooFinanceProvider reads stock/ETF prices from the public Yahoo chart API.
+type YahooFinanceProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewYahooFinanceProvider() *YahooFinanceProvider {
+	return &YahooFinanceProvider{
+		baseURL: "https://query1.finance.yahoo.com",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type yahooChartResponse struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				Currency           string  `json:"currency"`
+				Symbol             string  `json:"symbol"`
+				RegularMarketPrice float64 `json:"regularMarketPrice"`
+				ChartPreviousClose float64 `json:"chartPreviousClose"`
+			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Close []*float64 `json:"close"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+func (p *YahooFinanceProvider) chart(ctx context.Context, symbol, rangeParam string) (*yahooChartResponse, error) {
+	reqURL := fmt.Sprintf("%s/v8/finance/chart/%s?range=%s&interval=1d",
+		p.baseURL, url.PathEscape(strings.ToUpper(symbol)), rangeParam)
+
+	var resp yahooChartResponse
+	if err := getJSON(ctx, p.client, reqURL, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Chart.Error != nil {
+		return nil, fmt.Errorf("%s", resp.Chart.Error.Description)
+	}
+	if len(resp.Chart.Result) == 0 {
+		return nil, fmt.Errorf("no data for %s", symbol)
+	}
+	return &resp, nil
+}
+
+func (p *YahooFinanceProvider) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	resp, err := p.chart(ctx, symbol, "5d")
+	if err != nil {
+		return nil, err
+	}
+	meta := resp.Chart.Result[0].Meta
+
+	quote := &Quote{
+		Symbol:   meta.Symbol,
+		Price:    meta.RegularMarketPrice,
+		Currency: meta.Currency,
+	}
+	if meta.ChartPreviousClose > 0 {
+		quote.ChangePct = (meta.RegularMarketPrice - meta.ChartPreviousClose) / meta.ChartPreviousClose * 100
+	}
+	return quote, nil
+}
+
+func (p *YahooFinanceProvider) History(ctx context.Context, symbol string, days int) ([]PricePoint, error) {
+	var rangeParam string
+	switch {
+	case days <= 5:
+		rangeParam = "5d"
+	case days <= 31:
+		rangeParam = "1mo"
+	case days <= 93:
+		rangeParam = "3mo"
+	case days <= 186:
+		rangeParam = "6mo"
+	case days <= 366:
+		rangeParam = "1y"
+	default:
+		rangeParam = "5y"
+	}
+
+	resp, err := p.chart(ctx, symbol, rangeParam)
+	if err != nil {
+		return nil, err
+	}
+	result := resp.Chart.Result[0]
+	if len(result.Indicators.Quote) == 0 {
+		return nil, fmt.Errorf("no price history for %s", symbol)
+	}
+
+	closes := result.Indicators.Quote[0].Close
+	points := make([]PricePoint, 0, len(result.Timestamp))
+	for i, ts := range result.Timestamp {
+		if i >= len(closes) || closes[i] == nil {
+			continue
+		}
+		points = append(points, PricePoint{Time: time.Unix(ts, 0), Price: *closes[i]})
+	}
+	return points, nil
+}
+
+// cryptoTickerIDs maps common tickers to CoinGecko coin IDs.
+var cryptoTickerIDs = map[string]string{
+	"btc":  "bitcoin",
+	"eth":  "ethereum",
+	"sol":  "solana",
+	"ada":  "cardano",
+	"xrp":  "ripple",
+	"doge": "dogecoin",
+	"dot":  "polkadot",
+	"ltc":  "litecoin",
+	"bnb":  "binancecoin",
+	"usdt": "tether",
+	"usdc": "usd-coin",
+	"trx":  "tron",
+	"avax": "avalanche-2",
+	"link": "chainlink",
+}
+
+// CoinGeckoProvider reads crypto prices from the public CoinGecko API.
+type CoinGeckoProvider struct {
+	baseURL  string
+	currency string
+	client   *http.Client
+}
+
+func NewCoinGeckoProvider(currency string) *CoinGeckoProvider {
+	if currency == "" {
+		currency = "usd"
+	}
+	return &CoinGeckoProvider{
+		baseURL:  "https://api.coingecko.com/api/v3",
+		currency: strings.ToLower(currency),
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func coinID(symbol string) string {
+	s := strings.ToLower(strings.TrimSpace(symbol))
+	if id, ok := cryptoTickerIDs[s]; ok {
+		return id
+	}
+	return s
+}
+
+func (p *CoinGeckoProvider) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	id := coinID(symbol)
+	reqURL := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s&include_24hr_change=true",
+		p.baseURL, url.QueryEscape(id), p.currency)
+
+	var resp map[string]map[string]float64
+	if err := getJSON(ctx, p.client, reqURL, &resp); err != nil {
+		return nil, err
+	}
+	prices, ok := resp[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin %q", symbol)
+	}
+
+	return &Quote{
+		Symbol:    strings.ToUpper(symbol),
+		Price:     prices[p.currency],
+		Currency:  strings.ToUpper(p.currency),
+		ChangePct: prices[p.currency+"_24h_change"],
+	}, nil
+}
+
+func (p *CoinGeckoProvider) History(ctx context.Context, symbol string, days int) ([]PricePoint, error) {
+	reqURL := fmt.Sprintf("%s/coins/%s/market_chart?vs_currency=%s&days=%d",
+		p.baseURL, url.PathEscape(coinID(symbol)), p.currency, days)
+
+	var resp struct {
+		Prices [][2]float64 `json:"prices"`
+	}
+	if err := getJSON(ctx, p.client, reqURL, &resp); err != nil {
+		return nil, err
+	}
+
+	points := make([]PricePoint, 0, len(resp.Prices))
+	for _, pr := range resp.Prices {
+		points = append(points, PricePoint{Time: time.UnixMilli(int64(pr[0])), Price: pr[1]})
+	}
+	return points, nil
+}
+
+// FinanceTool provides quotes, PNG price charts and price alerts.
+type FinanceTool struct {
+	stocks        PriceProvider
+	crypto        PriceProvider
+	workspace     string
+	checkInterval time.Duration
+	scheduler     *cron.CronService
+	channel       string
+	chatID        string
+}
+
+func NewFinanceTool(stocks, crypto PriceProvider, workspace string, checkInterval time.Duration) *FinanceTool {
+	if checkInterval <= 0 {
+		checkInterval = 15 * time.Minute
+	}
+	return &FinanceTool{
+		stocks:        stocks,
+		crypto:        crypto,
+		workspace:     workspace,
+		checkInterval: checkInterval,
+	}
+}
+
+func (t *FinanceTool) Name() string {
+	return "finance"
+}
+
+func (t *FinanceTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "alert_add", "alert_remove")
+}
+
+func (t *FinanceTool) Description() string {
+	return "Get stock and crypto prices, render a price history chart (PNG), and manage price alerts that notify the user when a price crosses a threshold."
+}
+
+func (t *FinanceTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"quote", "chart", "alert_add", "alert_list", "alert_remove"},
+				"description": "Action to perform",
+			},
+			"symbol": map[string]interface{}{
+				"type":        "string",
+				"description": "Ticker symbol, e.g. AAPL, PETR4.SA, BTC, ethereum",
+			},
+			"asset": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"stock", "crypto"},
+				"description": "Asset type. Defaults to crypto for known coin tickers, stock otherwise.",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "History length for chart (default 30)",
+			},
+			"above": map[string]interface{}{
+				"type":        "number",
+				"description": "Alert when price rises to or above this value (alert_add)",
+			},
+			"below": map[string]interface{}{
+				"type":        "number",
+				"description": "Alert when price falls to or below this value (alert_add)",
+			},
+			"alert_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Alert ID (alert_remove)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *FinanceTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// JobKinds implements ScheduledTool.
+func (t *FinanceTool) JobKinds() []string {
+	return []string{priceAlertJobKind}
+}
+
+// SetScheduler implements ScheduledTool.
+func (t *FinanceTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *FinanceTool) providerFor(symbol, asset string) (PriceProvider, string, error) {
+	if asset == "" {
+		asset = "stock"
+		if _, ok := cryptoTickerIDs[strings.ToLower(symbol)]; ok {
+			asset = "crypto"
+		}
+	}
+
+	var provider PriceProvider
+	switch asset {
+	case "stock":
+		provider = t.stocks
+	case "crypto":
+		provider = t.crypto
+	default:
+		return nil, "", fmt.Errorf("unknown asset type %q", asset)
+	}
+	if provider == nil {
+		return nil, "", fmt.Errorf("no %s data provider configured", asset)
+	}
+	return provider, asset, nil
+}
+
+func (t *FinanceTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	switch action {
+	case "alert_list":
+		return t.listAlerts()
+	case "alert_remove":
+		return t.removeAlert(args)
+	}
+
+	symbol, _ := args["symbol"].(string)
+	if symbol == "" {
+		return ErrorResult("symbol is required")
+	}
+	asset, _ := args["asset"].(string)
+	provider, asset, err := t.providerFor(symbol, asset)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	switch action {
+	case "quote":
+		quote, err := provider.Quote(ctx, symbol)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("quote failed: %v", err)).WithError(err)
+		}
+		return SilentResult(formatQuote(quote))
+	case "chart":
+		return t.chart(ctx, provider, symbol, args)
+	case "alert_add":
+		return t.addAlert(symbol, asset, args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func formatQuote(q *Quote) string {
+	return fmt.Sprintf("%s: %s %s (%+.2f%%)", q.Symbol, formatPrice(q.Price), q.Currency, q.ChangePct)
+}
+
+// formatPrice keeps cents for regular prices and more decimals the
+// smaller a sub-unit price (small-cap coins) is, never an exponent.
+func formatPrice(v float64) string {
+	decimals := 8
+	switch a := math.Abs(v); {
+	case a >= 1 || a == 0:
+		decimals = 2
+	case a >= 0.01:
+		decimals = 4
+	case a >= 0.0001:
+		decimals = 6
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+func (t *FinanceTool) chart(ctx context.Context, provider PriceProvider, symbol string, args map[string]interface{}) *ToolResult {
+	days := 30
+	if d, ok := args["days"].(float64); ok && int(d) > 0 {
+		days = int(d)
+	}
+
+	points, err := provider.History(ctx, symbol, days)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("history failed: %v", err)).WithError(err)
+	}
+	if len(points) < 2 {
+		return ErrorResult(fmt.Sprintf("not enough price history for %s", symbol))
+	}
+
+	dir := filepath.Join(t.workspace, "charts")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to create chart directory: %v", err))
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%dd-%s.png",
+		strings.ToLower(strings.ReplaceAll(symbol, "/", "_")), days, time.Now().Format("20060102-150405")))
+
+	if err := renderPriceChart(path, points, 800, 400); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to render chart: %v", err))
+	}
+
+	first, last := points[0], points[len(points)-1]
+	low, high := first.Price, first.Price
+	for _, p := range points {
+		low = min(low, p.Price)
+		high = max(high, p.Price)
+	}
+	change := (last.Price - first.Price) / first.Price * 100
+
+	return SilentResult(fmt.Sprintf(
+		"Chart for %s over %d days saved to %s\nFrom %s to %s: %.4g -> %.4g (%+.2f%%), low %.4g, high %.4g",
+		strings.ToUpper(symbol), days, path,
+		first.Time.Format("2006-01-02"), last.Time.Format("2006-01-02"),
+		first.Price, last.Price, change, low, high))
+}
+
+// renderPriceChart draws a minimal line chart (no text) and writes it as PNG.
+func renderPriceChart(path string, points []PricePoint, width, height int) error {
+	const margin = 20
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	bg := color.RGBA{255, 255, 255, 255}
+	grid := color.RGBA{225, 225, 225, 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, bg)
+		}
+	}
+
+	low, high := points[0].Price, points[0].Price
+	for _, p := range points {
+		low = min(low, p.Price)
+		high = max(high, p.Price)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	plotW := float64(width - 2*margin)
+	plotH := float64(height - 2*margin)
+	toXY := func(i int, price float64) (int, int) {
+		x := margin + int(float64(i)/float64(len(points)-1)*plotW)
+		y := height - margin - int((price-low)/(high-low)*plotH)
+		return x, y
+	}
+
+	// Horizontal grid lines at quarters
+	for q := 0; q <= 4; q++ {
+		y := margin + int(float64(q)/4*plotH)
+		for x := margin; x < width-margin; x++ {
+			img.Set(x, y, grid)
+		}
+	}
+
+	lineColor := color.RGBA{22, 163, 74, 255} // green when up
+	if points[len(points)-1].Price < points[0].Price {
+		lineColor = color.RGBA{220, 38, 38, 255} // red when down
+	}
+
+	prevX, prevY := toXY(0, points[0].Price)
+	for i := 1; i < len(points); i++ {
+		x, y := toXY(i, points[i].Price)
+		drawLine(img, prevX, prevY, x, y, lineColor)
+		drawLine(img, prevX, prevY+1, x, y+1, lineColor)
+		prevX, prevY = x, y
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+// drawLine draws a line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx := absInt(x1 - x0)
+	dy := -absInt(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (t *FinanceTool) addAlert(symbol, asset string, args map[string]interface{}) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("price alerts are not available (scheduler not running)")
+	}
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+
+	above, hasAbove := args["above"].(float64)
+	below, hasBelow := args["below"].(float64)
+	if !hasAbove && !hasBelow {
+		return ErrorResult("one of above or below is required for alert_add")
+	}
+
+	data := map[string]string{
+		"symbol": symbol,
+		"asset":  asset,
+	}
+	var condition []string
+	if hasAbove {
+		data["above"] = strconv.FormatFloat(above, 'f', -1, 64)
+		condition = append(condition, fmt.Sprintf(">= %g", above))
+	}
+	if hasBelow {
+		data["below"] = strconv.FormatFloat(below, 'f', -1, 64)
+		condition = append(condition, fmt.Sprintf("<= %g", below))
+	}
+
+	everyMS := t.checkInterval.Milliseconds()
+	name := fmt.Sprintf("Price alert %s %s", strings.ToUpper(symbol), strings.Join(condition, " or "))
+	job, err := t.scheduler.AddJobWithPayload(name, cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+		Kind:    priceAlertJobKind,
+		Message: name,
+		Channel: t.channel,
+		To:      t.chatID,
+		Data:    data,
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to add alert: %v", err))
+	}
+
+	return SilentResult(fmt.Sprintf("%s (id: %s), checked every %s", name, job.ID, t.checkInterval))
+}
+
+func (t *FinanceTool) listAlerts() *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("price alerts are not available (scheduler not running)")
+	}
+
+	var sb strings.Builder
+	for _, job := range t.scheduler.ListJobs(false) {
+		if job.Payload.Kind != priceAlertJobKind {
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s (id: %s)\n", job.Name, job.ID)
+	}
+	if sb.Len() == 0 {
+		return SilentResult("No active price alerts")
+	}
+	return SilentResult("Active price alerts:\n" + sb.String())
+}
+
+func (t *FinanceTool) removeAlert(args map[string]interface{}) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("price alerts are not available (scheduler not running)")
+	}
+	id, _ := args["alert_id"].(string)
+	if id == "" {
+		return ErrorResult("alert_id is required for alert_remove")
+	}
+	if !t.scheduler.RemoveJob(id) {
+		return ErrorResult(fmt.Sprintf("alert %s not found", id))
+	}
+	return SilentResult(fmt.Sprintf("Price alert %s removed", id))
+}
+
+// ExecuteJob implements ScheduledTool. It checks a price alert and returns a
+// notification once the threshold is crossed, removing the alert.
+func (t *FinanceTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	data := job.Payload.Data
+	symbol := data["symbol"]
+	provider, _, err := t.providerFor(symbol, data["asset"])
+	if err != nil {
+		return "", err
+	}
+
+	quote, err := provider.Quote(ctx, symbol)
+	if err != nil {
+		return "", err
+	}
+
+	triggered := false
+	if v, err := strconv.ParseFloat(data["above"], 64); err == nil && quote.Price >= v {
+		triggered = true
+	}
+	if v, err := strconv.ParseFloat(data["below"], 64); err == nil && quote.Price <= v {
+		triggered = true
+	}
+	if !triggered {
+		return "", nil
+	}
+
+	if t.scheduler != nil {
+		t.scheduler.RemoveJob(job.ID)
+	}
+	return fmt.Sprintf("📈 %s triggered — %s", job.Name, formatQuote(quote)), nil
+}
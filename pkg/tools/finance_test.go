@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+type stubPriceProvider struct {
+	price   float64
+	history []PricePoint
+}
+
+func (p *stubPriceProvider) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	return &Quote{Symbol: strings.ToUpper(symbol), Price: p.price, Currency: "USD", ChangePct: 1.5}, nil
+}
+
+func (p *stubPriceProvider) History(ctx context.Context, symbol string, days int) ([]PricePoint, error) {
+	return p.history, nil
+}
+
+// TestFinanceTool_QuoteRoutesCrypto verifies known coin tickers use the crypto provider
+func TestFinanceTool_QuoteRoutesCrypto(t *testing.T) {
+	stocks := &stubPriceProvider{price: 190}
+	crypto := &stubPriceProvider{price: 65000}
+	tool := NewFinanceTool(stocks, crypto, t.TempDir(), time.Minute)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "quote",
+		"symbol": "btc",
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "65000") {
+		t.Errorf("Expected crypto price, got: %s", result.ForLLM)
+	}
+}
+
+// TestFormatPrice verifies prices get a fixed number of decimals by their magnitude, never an exponent
+func TestFormatPrice(t *testing.T) {
+	tests := []struct {
+		price float64
+		want  string
+	}{
+		{0, "0.00"},
+		{65000, "65000.00"},
+		{190.456, "190.46"},
+		{1, "1.00"},
+		{-3.5, "-3.50"},
+		{0.5, "0.5000"},
+		{0.0123, "0.0123"},
+		{0.0012346, "0.001235"},
+		{0.00001234, "0.00001234"},
+		{-0.25, "-0.2500"},
+	}
+	for _, tt := range tests {
+		if got := formatPrice(tt.price); got != tt.want {
+			t.Errorf("formatPrice(%v) = %q, want %q", tt.price, got, tt.want)
+		}
+	}
+}
+
+// TestFinanceTool_ChartWritesPNG verifies a chart file is rendered into the workspace
+func TestFinanceTool_ChartWritesPNG(t *testing.T) {
+	now := time.Now()
+	provider := &stubPriceProvider{history: []PricePoint{
+		{Time: now.AddDate(0, 0, -2), Price: 10},
+		{Time: now.AddDate(0, 0, -1), Price: 12},
+		{Time: now, Price: 11},
+	}}
+	workspace := t.TempDir()
+	tool := NewFinanceTool(provider, nil, workspace, time.Minute)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "chart",
+		"symbol": "AAPL",
+		"days":   float64(3),
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(workspace, "charts", "aapl-3d-*.png"))
+	if len(matches) != 1 {
+		t.Fatalf("Expected one chart file, got %v", matches)
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil || !strings.HasPrefix(string(data), "\x89PNG") {
+		t.Errorf("Expected PNG file, err=%v", err)
+	}
+}
+
+// TestFinanceTool_AlertLifecycle verifies alerts are scheduled and removed once triggered
+func TestFinanceTool_AlertLifecycle(t *testing.T) {
+	provider := &stubPriceProvider{price: 100}
+	tool := NewFinanceTool(provider, nil, t.TempDir(), time.Minute)
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "42")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "alert_add",
+		"symbol": "AAPL",
+		"above":  float64(150),
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	jobs := cs.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != priceAlertJobKind {
+		t.Fatalf("Expected one price alert job, got %+v", jobs)
+	}
+	job := jobs[0]
+	if job.Payload.Channel != "telegram" || job.Payload.To != "42" {
+		t.Errorf("Expected alert bound to session, got %s:%s", job.Payload.Channel, job.Payload.To)
+	}
+
+	// Below threshold: no notification, job kept
+	msg, err := tool.ExecuteJob(context.Background(), &job)
+	if err != nil || msg != "" {
+		t.Fatalf("Expected no trigger, got %q (err=%v)", msg, err)
+	}
+
+	provider.price = 151
+	msg, err = tool.ExecuteJob(context.Background(), &job)
+	if err != nil || !strings.Contains(msg, "AAPL") {
+		t.Fatalf("Expected trigger message, got %q (err=%v)", msg, err)
+	}
+	if len(cs.ListJobs(true)) != 0 {
+		t.Error("Expected triggered alert to be removed")
+	}
+}
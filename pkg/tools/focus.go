@@ -0,0 +1,315 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const (
+	focusJobKind = "focus_end"
+	// defaultFocusMinutes is one pomodoro
+	defaultFocusMinutes = 25
+	maxFocusMinutes     = 240
+)
+
+// focusHold is a chat's focus session as the digest sees it: until when
+// notifications that are not urgent are held, and those held so far.
+type focusHold struct {
+	Until   time.Time    `json:"until"`
+	Pending []digestItem `json:"pending,omitempty"`
+	Dropped int          `json:"dropped,omitempty"`
+}
+
+// holdForFocus keeps content for the end of the chat's focus session
+// unless its category is urgent: for the chat's digest when it is in
+// digest mode, by default otherwise. Callers hold d.mu.
+func (d *NotificationDigest) holdForFocus(f *focusHold, c *digestChat, category, content string) bool {
+	if c != nil && c.urgent(category) || c == nil && slices.Contains(defaultUrgent, category) {
+		return false
+	}
+	f.Pending = append(f.Pending, digestItem{Category: category, Content: content, At: d.now()})
+	if extra := len(f.Pending) - maxDigestItems; extra > 0 {
+		f.Pending = append(f.Pending[:0:0], f.Pending[extra:]...)
+		f.Dropped += extra
+	}
+	if err := saveJSONAtomic(d.focusPath, d.focus); err != nil {
+		// Not held if it cannot be kept
+		f.Pending = f.Pending[:len(f.Pending)-1]
+		return false
+	}
+	return true
+}
+
+// StartFocus holds the chat's notifications that are not urgent until
+// until.
+func (d *NotificationDigest) StartFocus(chatKey string, until time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.focus[chatKey] = &focusHold{Until: until}
+	if err := saveJSONAtomic(d.focusPath, d.focus); err != nil {
+		delete(d.focus, chatKey)
+		return err
+	}
+	return nil
+}
+
+// Focus reports whether the chat is in a focus session, until when, and
+// how many notifications it holds.
+func (d *NotificationDigest) Focus(chatKey string) (time.Time, int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f := d.focus[chatKey]
+	if f == nil {
+		return time.Time{}, 0, false
+	}
+	return f.Until, len(f.Pending), true
+}
+
+// EndFocus ends the chat's focus session and returns the summary of what
+// it held; empty when nothing was.
+func (d *NotificationDigest) EndFocus(chatKey string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f := d.focus[chatKey]
+	if f == nil {
+		return ""
+	}
+	delete(d.focus, chatKey)
+	saveJSONAtomic(d.focusPath, d.focus)
+	if len(f.Pending) == 0 {
+		return ""
+	}
+	return digestSummary(f.Pending, f.Dropped)
+}
+
+// FocusTool runs focus sessions, pomodoro style: for the session's length
+// the chat's proactive notifications that are not urgent are held, a
+// focus time event can block the user's Google Calendar, and when the
+// time is up the user is told, with what was held.
+type FocusTool struct {
+	digest    *NotificationDigest
+	profiles  *profile.Store
+	calendar  *GoogleCalendarClient
+	scheduler *cron.CronService
+	now       func() time.Time
+}
+
+func NewFocusTool(digest *NotificationDigest, profiles *profile.Store) *FocusTool {
+	return &FocusTool{digest: digest, profiles: profiles, now: time.Now}
+}
+
+// SetCalendar lets sessions add a focus time event to the user's primary
+// calendar.
+func (t *FocusTool) SetCalendar(calendar *GoogleCalendarClient) {
+	t.calendar = calendar
+}
+
+func (t *FocusTool) Name() string {
+	return "focus"
+}
+
+func (t *FocusTool) WorksOffline(args map[string]interface{}) bool {
+	calendar, _ := args["calendar"].(bool)
+	return !calendar
+}
+
+func (t *FocusTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "start", "stop")
+}
+
+func (t *FocusTool) Description() string {
+	return fmt.Sprintf("Focus sessions (pomodoro). start begins a timer of minutes (default %d): until it ends, proactive notifications to this chat that are not urgent (news, tracking, reports...) are held, and the user is told when the time is up, with what was held. Reminders and the other urgent categories of the notification digest still come through. calendar=true also blocks the time as focus time in Google Calendar, declining new invitations. stop ends the session early, status shows the time left. Use it for \"focus for 50 minutes on the report\" or \"start a pomodoro\".", defaultFocusMinutes)
+}
+
+func (t *FocusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"start", "stop", "status"},
+				"description": "Action to perform",
+			},
+			"minutes": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("start: length of the session (default %d, max %d)", defaultFocusMinutes, maxFocusMinutes),
+			},
+			"task": map[string]interface{}{
+				"type":        "string",
+				"description": "start: what the user is focusing on, for the report and the calendar event",
+			},
+			"calendar": map[string]interface{}{
+				"type":        "boolean",
+				"description": "start: also add a focus time event to Google Calendar for the session",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *FocusTool) JobKinds() []string {
+	return []string{focusJobKind}
+}
+
+func (t *FocusTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *FocusTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	if t.scheduler == nil {
+		return ErrorResult("focus sessions are not available (scheduler not running)")
+	}
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	switch action {
+	case "start":
+		return t.start(ctx, args, channel, chatID)
+	case "stop":
+		return t.stop(ctx, chatKey)
+	case "status":
+		job := t.session(chatKey)
+		if job == nil {
+			return SilentResult("No focus session is running.")
+		}
+		until, held, _ := t.digest.Focus(chatKey)
+		left := max(until.Sub(t.now()), 0).Round(time.Minute)
+		return SilentResult(fmt.Sprintf("Focusing%s until %s (%s left); %d notification(s) held.",
+			focusTask(job), until.In(t.profiles.Get(chatKey).Location()).Format("15:04"), formatETA(left), held))
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *FocusTool) start(ctx context.Context, args map[string]interface{}, channel, chatID string) *ToolResult {
+	chatKey := channel + ":" + chatID
+	if job := t.session(chatKey); job != nil {
+		until, _, _ := t.digest.Focus(chatKey)
+		return ErrorResult(fmt.Sprintf("a focus session%s is already running until %s; stop it first",
+			focusTask(job), until.In(t.profiles.Get(chatKey).Location()).Format("15:04")))
+	}
+	minutes := defaultFocusMinutes
+	if n, ok := args["minutes"].(float64); ok {
+		if n < 1 || n > maxFocusMinutes {
+			return ErrorResult(fmt.Sprintf("minutes must be between 1 and %d", maxFocusMinutes))
+		}
+		minutes = int(n)
+	}
+	task, _ := args["task"].(string)
+	task = strings.TrimSpace(task)
+	now := t.now()
+	until := now.Add(time.Duration(minutes) * time.Minute)
+
+	eventID := ""
+	if calendar, _ := args["calendar"].(bool); calendar {
+		if t.calendar == nil {
+			return ErrorResult("Calendar focus time needs the calendar tools (tools.events); start the session without calendar")
+		}
+		summary := "Focus time"
+		if task != "" {
+			summary = "Focus: " + task
+		}
+		ev, err := t.calendar.InsertEvent(ctx, "primary", CalendarEvent{Summary: summary, Start: now, End: until, Type: EventFocusTime, AutoDecline: true})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to add the focus time to Calendar: %v", err)).WithError(err)
+		}
+		eventID = ev.ID
+	}
+	undo := func() {
+		t.digest.EndFocus(chatKey)
+		if eventID != "" {
+			t.calendar.DeleteEvent(ctx, "primary", eventID)
+		}
+	}
+
+	if err := t.digest.StartFocus(chatKey, until); err != nil {
+		undo()
+		return ErrorResult(fmt.Sprintf("failed to start the focus session: %v", err)).WithError(err)
+	}
+	atMS := until.UnixMilli()
+	_, err := t.scheduler.AddJobWithPayload("Focus session", cron.CronSchedule{Kind: "at", AtMS: &atMS}, cron.CronPayload{
+		Kind:    focusJobKind,
+		Message: task,
+		Channel: channel,
+		To:      chatID,
+		Data:    map[string]string{"event_id": eventID, "minutes": strconv.Itoa(minutes)},
+	})
+	if err != nil {
+		undo()
+		return ErrorResult(fmt.Sprintf("failed to schedule the end of the session: %v", err)).WithError(err)
+	}
+
+	out := fmt.Sprintf("Focus session started until %s (%d min). Notifications that are not urgent are held until then, and the end will be reported here.",
+		until.In(t.profiles.Get(chatKey).Location()).Format("15:04"), minutes)
+	if eventID != "" {
+		out += " The time is blocked as focus time in Google Calendar."
+	}
+	return SilentResult(out)
+}
+
+func (t *FocusTool) stop(ctx context.Context, chatKey string) *ToolResult {
+	job := t.session(chatKey)
+	if job == nil {
+		return SilentResult("No focus session is running.")
+	}
+	t.scheduler.RemoveJob(job.ID)
+	held := t.digest.EndFocus(chatKey)
+	out := fmt.Sprintf("Focus session%s stopped after %s.", focusTask(job), formatETA(t.now().Sub(time.UnixMilli(job.CreatedAtMS)).Round(time.Minute)))
+	if eventID := job.Payload.Data["event_id"]; eventID != "" && t.calendar != nil {
+		if err := t.calendar.DeleteEvent(ctx, "primary", eventID); err != nil {
+			out += fmt.Sprintf(" The focus time could not be removed from Calendar: %v.", err)
+		} else {
+			out += " Its focus time was removed from Calendar."
+		}
+	}
+	if held != "" {
+		return &ToolResult{ForLLM: out + " The held notifications were sent.", ForUser: held}
+	}
+	return SilentResult(out)
+}
+
+// session returns the job ending the chat's focus session, or nil when
+// none is running.
+func (t *FocusTool) session(chatKey string) *cron.CronJob {
+	for _, job := range t.scheduler.ListJobs(false) {
+		if job.Payload.Kind == focusJobKind && job.Payload.Channel+":"+job.Payload.To == chatKey {
+			return &job
+		}
+	}
+	return nil
+}
+
+// focusTask names a session's task for a sentence, e.g. ` on "the report"`.
+func focusTask(job *cron.CronJob) string {
+	if job.Payload.Message == "" {
+		return ""
+	}
+	return fmt.Sprintf(" on %q", job.Payload.Message)
+}
+
+// ExecuteJob implements ScheduledTool. It ends the session and reports it,
+// with the notifications held meanwhile.
+func (t *FocusTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	held := t.digest.EndFocus(job.Payload.Channel + ":" + job.Payload.To)
+	out := "✅ Focus session done"
+	if job.Payload.Message != "" {
+		out += ": " + job.Payload.Message
+	}
+	if minutes := job.Payload.Data["minutes"]; minutes != "" {
+		out += " (" + minutes + " min)"
+	}
+	out += ". Time for a short break."
+	if held != "" {
+		out += "\n\n" + held
+	}
+	return out, nil
+}
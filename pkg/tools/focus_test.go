@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestFocusTool_HoldsNotificationsUntilTheEnd verifies a session blocks focus time in Calendar, holds news while reminders still go out, reports the end with what was held, and that stopping early removes the event and the job
+func TestFocusTool_HoldsNotificationsUntilTheEnd(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	workspace := t.TempDir()
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	msgBus := bus.NewMessageBus()
+	digest := NewNotificationDigest(workspace)
+	tool := NewFocusTool(digest, profile.NewStore(workspace))
+	tool.SetScheduler(cs)
+	tool.SetCalendar(NewGoogleCalendarClient(testkit.Token))
+	cronTool := NewCronTool(cs, nil, msgBus, workspace, true, 0)
+	cronTool.SetDigest(digest)
+	cronTool.RegisterJobHandler(newsDigestJobKind, func(ctx context.Context, job *cron.CronJob) (string, error) {
+		return job.Payload.Message, nil
+	})
+	cronTool.RegisterJobHandler(focusJobKind, tool.ExecuteJob)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "start", "minutes": float64(50), "task": "quarterly report", "calendar": true})
+	if r.IsError || !strings.Contains(r.ForLLM, "(50 min)") || !strings.Contains(r.ForLLM, "focus time in Google Calendar") {
+		t.Fatalf("start: %+v", r)
+	}
+	events := g.Events("")
+	if len(events) != 1 || events[0].EventType != "focusTime" || events[0].Summary != "Focus: quarterly report" || events[0].End.Sub(events[0].Start) != 50*time.Minute {
+		t.Fatalf("unexpected focus time: %+v", events)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "start"}); !r.IsError {
+		t.Errorf("second session started: %s", r.ForLLM)
+	}
+
+	fire := func(kind, message string) {
+		jobs := cs.ListJobs(false)
+		job := &cron.CronJob{ID: "x", Payload: cron.CronPayload{Kind: kind, Message: message, Deliver: kind == "", Channel: "telegram", To: "42"}}
+		if kind == focusJobKind {
+			// The scheduler deletes one-time jobs once they ran
+			job = &jobs[0]
+			defer cs.RemoveJob(job.ID)
+		}
+		cronTool.ExecuteJob(context.Background(), job)
+	}
+	fire(newsDigestJobKind, "Headlines: rates unchanged")
+	fire("", "Take the pills")
+
+	recv, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, ok := msgBus.SubscribeOutbound(recv); !ok || msg.Content != "Take the pills" {
+		t.Fatalf("urgent reminder not sent at once: %+v", msg)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "status"}); !strings.Contains(r.ForLLM, `Focusing on "quarterly report"`) || !strings.Contains(r.ForLLM, "1 notification(s) held") {
+		t.Errorf("status: %s", r.ForLLM)
+	}
+
+	fire(focusJobKind, "")
+	msg, ok := msgBus.SubscribeOutbound(recv)
+	if !ok || !strings.HasPrefix(msg.Content, "✅ Focus session done: quarterly report (50 min).") || !strings.Contains(msg.Content, "News (1)\n• Headlines") {
+		t.Fatalf("unexpected end of session: %+v", msg)
+	}
+	fire(newsDigestJobKind, "More headlines")
+	if msg, ok := msgBus.SubscribeOutbound(recv); !ok || msg.Content != "More headlines" {
+		t.Fatalf("news still held after the session: %+v", msg)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "start", "calendar": true}); r.IsError || !strings.Contains(r.ForLLM, "(25 min)") {
+		t.Fatalf("start: %+v", r)
+	}
+	r = tool.Execute(ctx, map[string]interface{}{"action": "stop"})
+	if r.IsError || !strings.Contains(r.ForLLM, "removed from Calendar") {
+		t.Fatalf("stop: %+v", r)
+	}
+	if len(g.Events("")) != 1 || len(cs.ListJobs(true)) != 0 {
+		t.Errorf("event or job left behind: %+v %+v", g.Events(""), cs.ListJobs(true))
+	}
+	if _, _, focusing := digest.Focus("telegram:42"); focusing {
+		t.Error("chat still focusing after stop")
+	}
+}
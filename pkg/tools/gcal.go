@@ -0,0 +1,463 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// CalendarEvent is an event in a Google Calendar. AllDay events use the
+// dates of Start and End (End exclusive).
+type CalendarEvent struct {
+	ID          string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	// ICalUID identifies the event across calendars (invitations keep it)
+	ICalUID  string
+	HTMLLink string
+	// Type is one of the Event* kinds; empty is EventDefault
+	Type string
+	// WorkingLocation is where the user works, for EventWorkingLocation:
+	// "home", or the name of an office or other place
+	WorkingLocation string
+	// AutoDecline declines invitations that conflict with focus time or
+	// out of office, with DeclineMessage for out of office
+	AutoDecline    bool
+	DeclineMessage string
+	// Organizer is the email address of whoever set the meeting up
+	Organizer string
+	// Attendees are the people invited, the user included; empty for
+	// events only the user is in
+	Attendees []EventAttendee
+	// Free events are marked "show me as available" and block no time
+	Free bool
+}
+
+// EventAttendee is someone invited to an event. Response is Calendar's
+// responseStatus: needsAction, accepted, tentative or declined.
+type EventAttendee struct {
+	Email    string
+	Name     string
+	Response string
+	// Self marks the user's own entry
+	Self     bool
+	Optional bool
+}
+
+// MyResponse is the user's answer to the invitation, or "" when the event
+// has no attendee list (it is their own).
+func (e CalendarEvent) MyResponse() string {
+	for _, a := range e.Attendees {
+		if a.Self {
+			return a.Response
+		}
+	}
+	return ""
+}
+
+// Google Calendar event types. Besides ordinary events, Workspace accounts
+// can mark time as focus time or out of office, which change the user's
+// status and can decline conflicting meetings, and say where they work
+// each day.
+const (
+	EventDefault         = "default"
+	EventFocusTime       = "focusTime"
+	EventOutOfOffice     = "outOfOffice"
+	EventWorkingLocation = "workingLocation"
+)
+
+// GoogleCalendarClient wraps the Calendar API v3.
+type GoogleCalendarClient struct {
+	token   TokenFunc
+	baseURL string
+	client  *http.Client
+}
+
+func NewGoogleCalendarClient(token TokenFunc) *GoogleCalendarClient {
+	return &GoogleCalendarClient{
+		token:   token,
+		baseURL: "https://www.googleapis.com/calendar/v3",
+		client:  newGoogleHTTPClient(30 * time.Second),
+	}
+}
+
+func (c *GoogleCalendarClient) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, c.client, method, c.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+type gcalTime struct {
+	Date     string `json:"date,omitempty"`
+	DateTime string `json:"dateTime,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type gcalEvent struct {
+	ID          string   `json:"id,omitempty"`
+	ICalUID     string   `json:"iCalUID,omitempty"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description,omitempty"`
+	Location    string   `json:"location,omitempty"`
+	Start       gcalTime `json:"start"`
+	End         gcalTime `json:"end"`
+	HTMLLink    string   `json:"htmlLink,omitempty"`
+
+	Organizer *gcalPerson    `json:"organizer,omitempty"`
+	Attendees []gcalAttendee `json:"attendees,omitempty"`
+
+	EventType                 string               `json:"eventType,omitempty"`
+	Transparency              string               `json:"transparency,omitempty"`
+	Visibility                string               `json:"visibility,omitempty"`
+	OutOfOfficeProperties     *gcalStatusProps     `json:"outOfOfficeProperties,omitempty"`
+	FocusTimeProperties       *gcalStatusProps     `json:"focusTimeProperties,omitempty"`
+	WorkingLocationProperties *gcalWorkingLocation `json:"workingLocationProperties,omitempty"`
+}
+
+// gcalStatusProps are the properties of focus time and out of office
+// events.
+type gcalStatusProps struct {
+	AutoDeclineMode string `json:"autoDeclineMode,omitempty"`
+	DeclineMessage  string `json:"declineMessage,omitempty"`
+	ChatStatus      string `json:"chatStatus,omitempty"`
+}
+
+type gcalWorkingLocation struct {
+	Type           string          `json:"type"`
+	HomeOffice     *struct{}       `json:"homeOffice,omitempty"`
+	OfficeLocation *gcalPlaceLabel `json:"officeLocation,omitempty"`
+	CustomLocation *gcalPlaceLabel `json:"customLocation,omitempty"`
+}
+
+type gcalPlaceLabel struct {
+	Label string `json:"label"`
+}
+
+type gcalPerson struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName,omitempty"`
+	Self        bool   `json:"self,omitempty"`
+}
+
+type gcalAttendee struct {
+	gcalPerson
+	ResponseStatus string `json:"responseStatus,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+}
+
+func toGcalTime(t time.Time, allDay bool) gcalTime {
+	if allDay {
+		return gcalTime{Date: t.Format("2006-01-02")}
+	}
+	gt := gcalTime{DateTime: t.Format(time.RFC3339)}
+	// A named zone keeps the event at the right wall time across DST changes
+	if name := t.Location().String(); name != "Local" && name != "UTC" && name != "" {
+		gt.TimeZone = name
+	}
+	return gt
+}
+
+func (g gcalTime) toTime() (time.Time, bool) {
+	if g.Date != "" {
+		t, _ := time.Parse("2006-01-02", g.Date)
+		return t, true
+	}
+	t, _ := time.Parse(time.RFC3339, g.DateTime)
+	if loc, err := time.LoadLocation(g.TimeZone); err == nil && g.TimeZone != "" {
+		t = t.In(loc)
+	}
+	return t, false
+}
+
+func (e gcalEvent) toCalendarEvent() CalendarEvent {
+	start, allDay := e.Start.toTime()
+	end, _ := e.End.toTime()
+	ev := CalendarEvent{
+		ID:          e.ID,
+		Summary:     e.Summary,
+		Description: e.Description,
+		Location:    e.Location,
+		Start:       start,
+		End:         end,
+		AllDay:      allDay,
+		ICalUID:     e.ICalUID,
+		HTMLLink:    e.HTMLLink,
+		Free:        e.Transparency == "transparent",
+	}
+	if e.Organizer != nil {
+		ev.Organizer = e.Organizer.Email
+	}
+	for _, a := range e.Attendees {
+		ev.Attendees = append(ev.Attendees, EventAttendee{
+			Email:    a.Email,
+			Name:     a.DisplayName,
+			Response: a.ResponseStatus,
+			Self:     a.Self,
+			Optional: a.Optional,
+		})
+	}
+	if e.EventType != "" && e.EventType != EventDefault {
+		ev.Type = e.EventType
+	}
+	props := e.OutOfOfficeProperties
+	if props == nil {
+		props = e.FocusTimeProperties
+	}
+	if props != nil {
+		ev.AutoDecline = props.AutoDeclineMode != "" && props.AutoDeclineMode != "declineNone"
+		ev.DeclineMessage = props.DeclineMessage
+	}
+	if wl := e.WorkingLocationProperties; wl != nil {
+		switch {
+		case wl.HomeOffice != nil || wl.Type == "homeOffice":
+			ev.WorkingLocation = "home"
+		case wl.OfficeLocation != nil:
+			ev.WorkingLocation = wl.OfficeLocation.Label
+		case wl.CustomLocation != nil:
+			ev.WorkingLocation = wl.CustomLocation.Label
+		}
+	}
+	return ev
+}
+
+// setEventType fills in the properties Google requires for ev's type.
+func (e *gcalEvent) setEventType(ev CalendarEvent) {
+	decline := "declineNone"
+	switch ev.Type {
+	case "", EventDefault:
+		return
+	case EventOutOfOffice:
+		if ev.AutoDecline {
+			decline = "declineAllConflictingInvitations"
+		}
+		e.OutOfOfficeProperties = &gcalStatusProps{AutoDeclineMode: decline, DeclineMessage: ev.DeclineMessage}
+	case EventFocusTime:
+		if ev.AutoDecline {
+			decline = "declineOnlyNewConflictingInvitations"
+		}
+		e.FocusTimeProperties = &gcalStatusProps{AutoDeclineMode: decline, ChatStatus: "doNotDisturb"}
+	case EventWorkingLocation:
+		// Working location events must not block time or be private
+		e.Transparency, e.Visibility = "transparent", "public"
+		place := strings.TrimSpace(ev.WorkingLocation)
+		switch lower := strings.ToLower(place); {
+		case lower == "" || lower == "home" || lower == "home office" || lower == "wfh":
+			e.WorkingLocationProperties = &gcalWorkingLocation{Type: "homeOffice", HomeOffice: &struct{}{}}
+		case strings.Contains(lower, "office"):
+			e.WorkingLocationProperties = &gcalWorkingLocation{Type: "officeLocation", OfficeLocation: &gcalPlaceLabel{Label: place}}
+		default:
+			e.WorkingLocationProperties = &gcalWorkingLocation{Type: "customLocation", CustomLocation: &gcalPlaceLabel{Label: place}}
+		}
+	}
+	e.EventType = ev.Type
+}
+
+// InsertEvent creates an event. When ICalUID is set the event is imported
+// under that UID, so the same invitation cannot be added twice. Attendees
+// are emailed the invitation.
+func (c *GoogleCalendarClient) InsertEvent(ctx context.Context, calendarID string, ev CalendarEvent) (*CalendarEvent, error) {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	payload := gcalEvent{
+		ICalUID:     ev.ICalUID,
+		Summary:     ev.Summary,
+		Description: ev.Description,
+		Location:    ev.Location,
+		Start:       toGcalTime(ev.Start, ev.AllDay),
+		End:         toGcalTime(ev.End, ev.AllDay),
+	}
+	for _, a := range ev.Attendees {
+		payload.Attendees = append(payload.Attendees, gcalAttendee{gcalPerson: gcalPerson{Email: a.Email, DisplayName: a.Name}, Optional: a.Optional})
+	}
+	payload.setEventType(ev)
+	path := "/calendars/" + url.PathEscape(calendarID) + "/events"
+	if ev.ICalUID != "" {
+		// events.import is idempotent on iCalUID, unlike events.insert
+		path += "/import"
+	} else if len(ev.Attendees) > 0 {
+		path += "?sendUpdates=all"
+	}
+	var created gcalEvent
+	if err := c.do(ctx, http.MethodPost, path, payload, &created); err != nil {
+		return nil, err
+	}
+	result := created.toCalendarEvent()
+	when := result.Start.Format("Mon 2 Jan 15:04")
+	if result.AllDay {
+		when = result.Start.Format("Mon 2 Jan")
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoDeleteEvent,
+		Description: fmt.Sprintf("added event %q on %s", result.Summary, when),
+		Params:      map[string]string{"calendar_id": calendarID, "event_id": result.ID},
+	})
+	return &result, nil
+}
+
+// DeleteEvent removes an event.
+func (c *GoogleCalendarClient) DeleteEvent(ctx context.Context, calendarID, eventID string) error {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	return c.do(ctx, http.MethodDelete, "/calendars/"+url.PathEscape(calendarID)+"/events/"+url.PathEscape(eventID), nil, nil)
+}
+
+// CancelEvent removes an event and emails its attendees that it was
+// cancelled.
+func (c *GoogleCalendarClient) CancelEvent(ctx context.Context, calendarID, eventID string) error {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	return c.do(ctx, http.MethodDelete, "/calendars/"+url.PathEscape(calendarID)+"/events/"+url.PathEscape(eventID)+"?sendUpdates=all", nil, nil)
+}
+
+// ListEvents returns the single events (recurring ones expanded) that
+// overlap [from, to), in start order.
+func (c *GoogleCalendarClient) ListEvents(ctx context.Context, calendarID string, from, to time.Time) ([]CalendarEvent, error) {
+	return c.SearchEvents(ctx, calendarID, "", from, to)
+}
+
+// SearchEvents is ListEvents restricted to events whose text (title,
+// description, location, attendees) matches query.
+func (c *GoogleCalendarClient) SearchEvents(ctx context.Context, calendarID, query string, from, to time.Time) ([]CalendarEvent, error) {
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	var events []CalendarEvent
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("timeMin", from.Format(time.RFC3339))
+		q.Set("timeMax", to.Format(time.RFC3339))
+		q.Set("singleEvents", "true")
+		q.Set("orderBy", "startTime")
+		q.Set("maxResults", "250")
+		if query != "" {
+			q.Set("q", query)
+		}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		var resp struct {
+			Items         []gcalEvent `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/calendars/"+url.PathEscape(calendarID)+"/events?"+q.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			events = append(events, item.toCalendarEvent())
+		}
+		if resp.NextPageToken == "" {
+			return events, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// CalendarInfo is a calendar in the user's calendar list.
+type CalendarInfo struct {
+	ID      string
+	Name    string
+	Color   string // background color, "#rrggbb"
+	Primary bool
+	// Selected calendars are the ones shown in the Calendar UI
+	Selected bool
+}
+
+// ListCalendars returns the user's calendar list, with the names and
+// colors the user chose.
+func (c *GoogleCalendarClient) ListCalendars(ctx context.Context) ([]CalendarInfo, error) {
+	var calendars []CalendarInfo
+	pageToken := ""
+	for {
+		path := "/users/me/calendarList?maxResults=250"
+		if pageToken != "" {
+			path += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		var resp struct {
+			Items []struct {
+				ID              string `json:"id"`
+				Summary         string `json:"summary"`
+				SummaryOverride string `json:"summaryOverride"`
+				BackgroundColor string `json:"backgroundColor"`
+				Primary         bool   `json:"primary"`
+				Selected        bool   `json:"selected"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Items {
+			name := item.SummaryOverride
+			if name == "" {
+				name = item.Summary
+			}
+			calendars = append(calendars, CalendarInfo{
+				ID:       item.ID,
+				Name:     name,
+				Color:    item.BackgroundColor,
+				Primary:  item.Primary,
+				Selected: item.Selected,
+			})
+		}
+		if resp.NextPageToken == "" {
+			return calendars, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// eventTypeNote says what a focus time, out of office or working location
+// event marks, or "" for an ordinary event.
+func eventTypeNote(ev CalendarEvent) string {
+	switch ev.Type {
+	case EventFocusTime:
+		return "focus time"
+	case EventOutOfOffice:
+		return "out of office"
+	case EventWorkingLocation:
+		switch ev.WorkingLocation {
+		case "":
+			return "working location"
+		case "home":
+			return "working from home"
+		}
+		return "working at " + ev.WorkingLocation
+	}
+	return ""
+}
+
+// describeEventTime renders an event's time for chat, in the locale tag.
+func describeEventTime(ev CalendarEvent, tag string) string {
+	allDay := locale.T(tag, "events.all_day")
+	if ev.AllDay {
+		last := ev.End.AddDate(0, 0, -1)
+		if !last.After(ev.Start) {
+			return fmt.Sprintf("%s (%s)", locale.Date(ev.Start, tag), allDay)
+		}
+		return fmt.Sprintf("%s – %s (%s)", locale.Day(ev.Start, tag), locale.Date(last, tag), allDay)
+	}
+	zone := ev.Start.Format("MST")
+	if ev.End.IsZero() || ev.End.Equal(ev.Start) {
+		return fmt.Sprintf("%s %s", locale.DateTime(ev.Start, tag), zone)
+	}
+	if ev.End.YearDay() == ev.Start.YearDay() && ev.End.Year() == ev.Start.Year() && ev.End.Location() == ev.Start.Location() {
+		return fmt.Sprintf("%s–%s %s", locale.DateTime(ev.Start, tag), locale.Time(ev.End, tag), zone)
+	}
+	return fmt.Sprintf("%s %s → %s %s %s", locale.DateTime(ev.Start, tag), zone, locale.Day(ev.End, tag), locale.Time(ev.End, tag), ev.End.Format("MST"))
+}
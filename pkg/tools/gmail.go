@@ -0,0 +1,515 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/screening"
+)
+
+// GmailMessage is a message with its readable body and calendar
+// attachments.
+type GmailMessage struct {
+	ID       string
+	ThreadID string
+	Subject  string
+	From     string
+	To       string
+	Cc       string
+	ReplyTo  string
+	Date     string
+	// MessageID and References are the headers a reply refers to
+	MessageID  string
+	References string
+	// ListUnsubscribe and ListUnsubscribePost are the mailing-list headers
+	// of RFC 2369 and RFC 8058, empty for personal mail
+	ListUnsubscribe     string
+	ListUnsubscribePost string
+	// AuthResults are the Authentication-Results headers with the SPF,
+	// DKIM and DMARC verdicts, newest first; ReturnPath is the envelope
+	// sender
+	AuthResults []string
+	ReturnPath  string
+	// Received is when Gmail received the message
+	Received time.Time
+	// Text is the plain text body, or the HTML body stripped of markup
+	Text string
+	// HTML is the HTML body, when there is one
+	HTML string
+	// Calendars holds the contents of text/calendar parts and .ics files
+	Calendars []string
+	// Attachments lists the files attached to the message
+	Attachments []GmailAttachment
+}
+
+// GmailAttachment is a file attached to a message. Small attachments come
+// inline; larger ones are fetched with Attachment.
+type GmailAttachment struct {
+	Filename     string
+	MimeType     string
+	Size         int
+	attachmentID string
+	data         string
+}
+
+// GmailClient wraps the parts of the Gmail API the tools read from.
+type GmailClient struct {
+	token   TokenFunc
+	baseURL string
+	client  *http.Client
+	// retryDelay is the first pause before sub-requests of a batch call
+	// refused for rate limits are sent again
+	retryDelay time.Duration
+}
+
+func NewGmailClient(token TokenFunc) *GmailClient {
+	return &GmailClient{
+		token:   token,
+		baseURL: "https://gmail.googleapis.com/gmail/v1",
+		client:  newGoogleHTTPClient(30 * time.Second),
+
+		retryDelay: time.Second,
+	}
+}
+
+func (c *GmailClient) do(ctx context.Context, path string, out interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, c.client, http.MethodGet, c.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, nil, out)
+}
+
+type gmailPart struct {
+	MimeType string `json:"mimeType"`
+	Filename string `json:"filename"`
+	Headers  []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"headers"`
+	Body struct {
+		Data         string `json:"data"`
+		AttachmentID string `json:"attachmentId"`
+		Size         int    `json:"size"`
+	} `json:"body"`
+	Parts []gmailPart `json:"parts"`
+}
+
+func decodeGmailData(data string) string {
+	decoded, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		decoded, _ = base64.RawURLEncoding.DecodeString(data)
+	}
+	return string(decoded)
+}
+
+// findGmailBody returns the first part with the given MIME type, depth first.
+func findGmailBody(part gmailPart, mimeType string) string {
+	if part.MimeType == mimeType && part.Body.Data != "" && part.Filename == "" {
+		return decodeGmailData(part.Body.Data)
+	}
+	for _, p := range part.Parts {
+		if body := findGmailBody(p, mimeType); body != "" {
+			return body
+		}
+	}
+	return ""
+}
+
+func isCalendarPart(part gmailPart) bool {
+	switch strings.ToLower(part.MimeType) {
+	case "text/calendar", "application/ics":
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(part.Filename), ".ics")
+}
+
+// GmailDateQuery returns the search terms limiting a Gmail query to
+// [from, to); either may be zero. Seconds since the epoch are used rather
+// than dates, which Gmail reads in Pacific time.
+func GmailDateQuery(from, to time.Time) string {
+	var terms []string
+	if !from.IsZero() {
+		terms = append(terms, fmt.Sprintf("after:%d", from.Unix()-1))
+	}
+	if !to.IsZero() {
+		terms = append(terms, fmt.Sprintf("before:%d", to.Unix()))
+	}
+	return strings.Join(terms, " ")
+}
+
+// Search returns the IDs of the newest messages matching a Gmail query
+// (the same syntax as the search box).
+func (c *GmailClient) Search(ctx context.Context, query string, max int) ([]string, error) {
+	var resp struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	path := fmt.Sprintf("/users/me/messages?q=%s&maxResults=%d", url.QueryEscape(query), max)
+	if err := c.do(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(resp.Messages))
+	for i, m := range resp.Messages {
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
+
+// GmailLabel is a label of the mailbox: a system one such as IMPORTANT or
+// CATEGORY_UPDATES, or one the user made, whose ID differs from its name.
+type GmailLabel struct {
+	ID   string
+	Name string
+	// Type is "system" or "user"
+	Type string
+}
+
+// Labels lists the mailbox's labels.
+func (c *GmailClient) Labels(ctx context.Context) ([]GmailLabel, error) {
+	var resp struct {
+		Labels []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"labels"`
+	}
+	if err := c.do(ctx, "/users/me/labels", &resp); err != nil {
+		return nil, err
+	}
+	labels := make([]GmailLabel, len(resp.Labels))
+	for i, l := range resp.Labels {
+		labels[i] = GmailLabel{ID: l.ID, Name: l.Name, Type: l.Type}
+	}
+	return labels, nil
+}
+
+// GmailSummary is a message as listed in search results.
+type GmailSummary struct {
+	ID       string
+	ThreadID string
+	Subject  string
+	From     string
+	Snippet  string
+	Received time.Time
+	// Labels are Gmail label IDs: UNREAD, IMPORTANT, CATEGORY_PROMOTIONS...
+	Labels []string
+	// Bulk is set for mailing-list mail (it has a List-Unsubscribe header)
+	Bulk bool
+}
+
+// SearchSummaries is Search with the headers and snippet of each match,
+// newest first. The matches are read through the batch endpoint, so a
+// page of results costs a couple of requests rather than one per message.
+func (c *GmailClient) SearchSummaries(ctx context.Context, query string, max int) ([]GmailSummary, error) {
+	ids, err := c.Search(ctx, query, max)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(ids))
+	for i, id := range ids {
+		paths[i] = "/users/me/messages/" + url.PathEscape(id) + "?format=metadata&metadataHeaders=Subject&metadataHeaders=From&metadataHeaders=List-Unsubscribe"
+	}
+	summaries := make([]GmailSummary, len(ids))
+	err = c.batchGet(ctx, paths, func(i int, body []byte) error {
+		var raw gmailMetadata
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		raw.ID = ids[i]
+		summaries[i] = raw.summary()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// gmailMetadata is a message as the metadata format returns it.
+type gmailMetadata struct {
+	ID           string    `json:"id"`
+	ThreadID     string    `json:"threadId"`
+	LabelIDs     []string  `json:"labelIds"`
+	Snippet      string    `json:"snippet"`
+	InternalDate string    `json:"internalDate"`
+	Payload      gmailPart `json:"payload"`
+}
+
+func (raw gmailMetadata) summary() GmailSummary {
+	s := GmailSummary{ID: raw.ID, ThreadID: raw.ThreadID, Labels: raw.LabelIDs, Snippet: html.UnescapeString(raw.Snippet)}
+	if ms, err := strconv.ParseInt(raw.InternalDate, 10, 64); err == nil {
+		s.Received = time.UnixMilli(ms)
+	}
+	for _, h := range raw.Payload.Headers {
+		switch strings.ToLower(h.Name) {
+		case "subject":
+			s.Subject = h.Value
+		case "from":
+			s.From = h.Value
+		case "list-unsubscribe":
+			s.Bulk = true
+		}
+	}
+	return s
+}
+
+// Thread lists the messages of a conversation, oldest first. Messages the
+// user sent carry the SENT label.
+func (c *GmailClient) Thread(ctx context.Context, threadID string) ([]GmailSummary, error) {
+	var resp struct {
+		Messages []gmailMetadata `json:"messages"`
+	}
+	path := "/users/me/threads/" + url.PathEscape(threadID) + "?format=metadata&metadataHeaders=Subject&metadataHeaders=From"
+	if err := c.do(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	messages := make([]GmailSummary, len(resp.Messages))
+	for i, m := range resp.Messages {
+		messages[i] = m.summary()
+	}
+	return messages, nil
+}
+
+// GetMessage fetches a message with its body, attachment list and
+// calendar attachments.
+func (c *GmailClient) GetMessage(ctx context.Context, id string) (*GmailMessage, error) {
+	var raw struct {
+		ID           string    `json:"id"`
+		ThreadID     string    `json:"threadId"`
+		InternalDate string    `json:"internalDate"`
+		Payload      gmailPart `json:"payload"`
+	}
+	if err := c.do(ctx, "/users/me/messages/"+url.PathEscape(id)+"?format=full", &raw); err != nil {
+		return nil, err
+	}
+	msg := &GmailMessage{ID: id, ThreadID: raw.ThreadID}
+	if ms, err := strconv.ParseInt(raw.InternalDate, 10, 64); err == nil {
+		msg.Received = time.UnixMilli(ms)
+	}
+	for _, h := range raw.Payload.Headers {
+		switch strings.ToLower(h.Name) {
+		case "subject":
+			msg.Subject = h.Value
+		case "from":
+			msg.From = h.Value
+		case "to":
+			msg.To = h.Value
+		case "cc":
+			msg.Cc = h.Value
+		case "reply-to":
+			msg.ReplyTo = h.Value
+		case "date":
+			msg.Date = h.Value
+		case "message-id":
+			msg.MessageID = h.Value
+		case "references":
+			msg.References = h.Value
+		case "list-unsubscribe":
+			msg.ListUnsubscribe = h.Value
+		case "list-unsubscribe-post":
+			msg.ListUnsubscribePost = h.Value
+		case "authentication-results":
+			msg.AuthResults = append(msg.AuthResults, h.Value)
+		case "return-path":
+			msg.ReturnPath = h.Value
+		}
+	}
+	msg.HTML = findGmailBody(raw.Payload, "text/html")
+	msg.Text = findGmailBody(raw.Payload, "text/plain")
+	if msg.Text == "" {
+		msg.Text = extractHTMLText(msg.HTML)
+	}
+
+	var walk func(part gmailPart) error
+	walk = func(part gmailPart) error {
+		var att *GmailAttachment
+		if part.Filename != "" {
+			att = &GmailAttachment{
+				Filename:     part.Filename,
+				MimeType:     part.MimeType,
+				Size:         part.Body.Size,
+				attachmentID: part.Body.AttachmentID,
+				data:         part.Body.Data,
+			}
+			msg.Attachments = append(msg.Attachments, *att)
+		}
+		if isCalendarPart(part) {
+			if att == nil {
+				att = &GmailAttachment{data: part.Body.Data, attachmentID: part.Body.AttachmentID}
+			}
+			data, err := c.Attachment(ctx, msg.ID, *att)
+			if err != nil {
+				return fmt.Errorf("failed to fetch %s: %w", part.Filename, err)
+			}
+			msg.Calendars = append(msg.Calendars, string(data))
+		}
+		for _, p := range part.Parts {
+			if err := walk(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(raw.Payload); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// OpenAttachment is Attachment for large files: the answer is decoded as
+// it arrives instead of being read whole, so a 25 MB attachment costs a
+// few kilobytes of memory. The attachment is screened by its name and
+// size first; its contents are the caller's to screen.
+func (c *GmailClient) OpenAttachment(ctx context.Context, id string, att GmailAttachment) (io.ReadCloser, error) {
+	if err := screening.Check(att.Filename, int64(att.Size)); err != nil {
+		return nil, err
+	}
+	if att.data != "" || att.attachmentID == "" {
+		return io.NopCloser(strings.NewReader(decodeGmailData(att.data))), nil
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path := "/users/me/messages/" + url.PathEscape(id) + "/attachments/" + url.PathEscape(att.attachmentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	// No client timeout: the context bounds the download
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("Gmail error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	br := bufio.NewReader(resp.Body)
+	if err := skipToJSONString(br, "data"); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected attachment answer: %w", err)
+	}
+	data := base64.NewDecoder(base64.RawURLEncoding, &gmailDataReader{r: br})
+	return struct {
+		io.Reader
+		io.Closer
+	}{data, resp.Body}, nil
+}
+
+// skipToJSONString reads r up to the opening quote of the string value of
+// key. It suits flat objects whose other values hold no quoted key, as
+// Gmail's attachment answer ({"attachmentId", "size", "data"}).
+func skipToJSONString(r *bufio.Reader, key string) error {
+	want := `"` + key + `"`
+	matched := 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("no %q field", key)
+		}
+		switch {
+		case b == want[matched]:
+			matched++
+		case b == want[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+		if matched < len(want) {
+			continue
+		}
+		for {
+			if b, err = r.ReadByte(); err != nil {
+				return err
+			}
+			if b == '"' {
+				return nil
+			}
+			if b != ':' && b != ' ' && b != '\n' && b != '\r' && b != '\t' {
+				matched = 0
+				break
+			}
+		}
+	}
+}
+
+// gmailDataReader passes base64url text on up to its closing quote,
+// dropping the padding so it decodes as RawURLEncoding.
+type gmailDataReader struct {
+	r    *bufio.Reader
+	done bool
+}
+
+func (g *gmailDataReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && !g.done {
+		b, err := g.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+		switch b {
+		case '"':
+			g.done = true
+		case '=':
+		default:
+			p[n] = b
+			n++
+		}
+	}
+	if n == 0 && g.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// DownloadAttachment is Attachment for attachments about to be saved or
+// passed on: they are screened by name and size before the download and
+// by their contents after it.
+func (c *GmailClient) DownloadAttachment(ctx context.Context, id string, att GmailAttachment) ([]byte, error) {
+	if err := screening.Check(att.Filename, int64(att.Size)); err != nil {
+		return nil, err
+	}
+	data, err := c.Attachment(ctx, id, att)
+	if err != nil {
+		return nil, err
+	}
+	if err := screening.Scan(ctx, att.Filename, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Attachment returns the content of an attachment of message id.
+func (c *GmailClient) Attachment(ctx context.Context, id string, att GmailAttachment) ([]byte, error) {
+	if att.data != "" || att.attachmentID == "" {
+		return []byte(decodeGmailData(att.data)), nil
+	}
+	var resp struct {
+		Data string `json:"data"`
+	}
+	path := "/users/me/messages/" + url.PathEscape(id) + "/attachments/" + url.PathEscape(att.attachmentID)
+	if err := c.do(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(decodeGmailData(resp.Data)), nil
+}
@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// gmailBatchSize is how many sub-requests go in one batch call. Gmail
+	// takes up to 100, but throttles batches over 50 on busy mailboxes.
+	gmailBatchSize = 50
+	// gmailBatchRetries is how many more times sub-requests refused for
+	// rate limits or server errors are sent before giving up
+	gmailBatchRetries = 3
+)
+
+// gmailBatchResult is the answer to one sub-request of a batch call.
+type gmailBatchResult struct {
+	status int
+	body   []byte
+}
+
+// retryable reports whether the sub-request was refused for its rate or
+// lost to a server error, and is worth sending again after a pause.
+func (r gmailBatchResult) retryable() bool {
+	switch {
+	case r.status == 0, r.status == http.StatusTooManyRequests, r.status >= 500:
+		return true
+	case r.status == http.StatusForbidden:
+		// Gmail reports per-user limits as 403 rateLimitExceeded or
+		// userRateLimitExceeded
+		return bytes.Contains(r.body, []byte("ateLimitExceeded"))
+	}
+	return false
+}
+
+// batchGet fetches paths (relative to the API base, as for do) through
+// the batch endpoint, gmailBatchSize to a call, and hands each response
+// body to decode with its index in paths. Sub-requests refused for rate
+// limits are retried with growing pauses; any other failure is returned.
+func (c *GmailClient) batchGet(ctx context.Context, paths []string, decode func(i int, body []byte) error) error {
+	pending := make([]int, len(paths))
+	for i := range pending {
+		pending[i] = i
+	}
+	delay := c.retryDelay
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		var retry []int
+		for start := 0; start < len(pending); start += gmailBatchSize {
+			chunk := pending[start:min(start+gmailBatchSize, len(pending))]
+			sub := make([]string, len(chunk))
+			for j, i := range chunk {
+				sub[j] = paths[i]
+			}
+			results, err := c.sendBatch(ctx, sub)
+			if err != nil {
+				return err
+			}
+			for j, r := range results {
+				i := chunk[j]
+				switch {
+				case r.status >= 200 && r.status < 300:
+					if err := decode(i, r.body); err != nil {
+						return err
+					}
+				case r.retryable() && attempt < gmailBatchRetries:
+					retry = append(retry, i)
+				default:
+					return fmt.Errorf("API error (%d): %s", r.status, strings.TrimSpace(string(r.body)))
+				}
+			}
+		}
+		pending = retry
+	}
+	return nil
+}
+
+// sendBatch makes one batch call of GET sub-requests and returns their
+// results in order. When the whole call is refused for rate limits, every
+// sub-request gets that result, so they are retried together.
+func (c *GmailClient) sendBatch(ctx context.Context, paths []string) ([]gmailBatchResult, error) {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, p := range paths {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-ID", fmt.Sprintf("<item-%d>", i))
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(part, "GET %s%s\r\n\r\n", base.Path, p)
+	}
+	mw.Close()
+
+	batchURL := base.Scheme + "://" + base.Host + "/batch" + base.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, batchURL, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	results := make([]gmailBatchResult, len(paths))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		whole := gmailBatchResult{status: resp.StatusCode, body: respBody}
+		if !whole.retryable() {
+			return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+		for i := range results {
+			results[i] = whole
+		}
+		return results, nil
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, fmt.Errorf("failed to parse batch response: unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch response: %w", err)
+		}
+		// Answers are labelled "<response-item-N>"
+		id := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		i, err := strconv.Atoi(id[strings.LastIndex(id, "-")+1:])
+		if err != nil || i < 0 || i >= len(results) {
+			continue
+		}
+		sub, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch response: %w", err)
+		}
+		subBody, err := io.ReadAll(sub.Body)
+		sub.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch response: %w", err)
+		}
+		results[i] = gmailBatchResult{status: sub.StatusCode, body: subBody}
+	}
+	return results, nil
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestGmail_SearchSummariesBatchesAndRetriesRateLimits verifies summaries come from batch calls, in order, with rate-limited sub-requests retried
+func TestGmail_SearchSummariesBatchesAndRetriesRateLimits(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Now()
+	var ids []string
+	for i := 0; i < gmailBatchSize+5; i++ {
+		ids = append(ids, g.AddEmail(testkit.Email{From: "shop@example.com", Subject: fmt.Sprintf("Order %d", i), Date: now.Add(-time.Duration(i) * time.Minute)}))
+	}
+	g.FailNext("/messages/"+ids[3], 1, 429)
+
+	client := NewGmailClient(testkit.Token)
+	client.retryDelay = time.Millisecond
+	summaries, err := client.SearchSummaries(context.Background(), "from:shop", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != len(ids) {
+		t.Fatalf("got %d summaries, want %d", len(summaries), len(ids))
+	}
+	for i, s := range summaries {
+		if s.ID != ids[i] || s.Subject != fmt.Sprintf("Order %d", i) {
+			t.Fatalf("summary %d = %+v", i, s)
+		}
+	}
+	// One search, two batches, and one more for the rate-limited message
+	if n := len(g.Requests()); n != 4 {
+		t.Errorf("made %d requests, want 4", n)
+	}
+}
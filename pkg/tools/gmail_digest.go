@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// maxDigestMessages bounds how many unread messages a digest reads.
+const maxDigestMessages = 100
+
+// Suggested actions for a digest entry.
+const (
+	DigestReply   = "reply"
+	DigestRead    = "read"
+	DigestArchive = "archive"
+)
+
+// DigestEntry is one conversation (or a run of mail from one bulk sender)
+// in an email digest.
+type DigestEntry struct {
+	Sender  string
+	Subject string
+	// EmailID is the newest message, for the gmail tool and summarize
+	EmailID  string
+	Count    int
+	Latest   time.Time
+	Score    int
+	Suggest  string
+	Snippet  string
+	Messages []GmailSummary
+}
+
+// EmailDigest is the unread mail since a point in time, grouped and
+// ranked, most important first.
+type EmailDigest struct {
+	Since   time.Time
+	Unread  int
+	Entries []DigestEntry
+}
+
+// urgentWords raise a message's importance when they appear in its subject.
+var urgentWords = []string{"urgent", "asap", "action required", "action needed", "deadline", "due", "overdue",
+	"invoice", "payment", "today", "tomorrow", "reminder", "final notice", "security alert", "verify"}
+
+// automatedSenders are address fragments of mail no one reads replies to.
+var automatedSenders = []string{"noreply", "no-reply", "donotreply", "do-not-reply", "notifications@",
+	"notification@", "newsletter", "mailer-daemon", "news@", "marketing", "updates@"}
+
+// Digest reads the unread inbox mail received since since, groups it by
+// conversation (bulk mail by sender) and ranks each group using Gmail's
+// labels and a few heuristics: starred, important and personal mail goes
+// up, promotions, social updates and newsletters go down, and so do
+// automated senders. Each group gets a suggested action.
+func (c *GmailClient) Digest(ctx context.Context, since time.Time) (*EmailDigest, error) {
+	query := strings.TrimSpace("is:unread in:inbox " + GmailDateQuery(since, time.Time{}))
+	summaries, err := c.SearchSummaries(ctx, query, maxDigestMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*DigestEntry)
+	var order []string
+	for _, s := range summaries {
+		key := "thread:" + s.ThreadID
+		if s.ThreadID == "" {
+			key = "msg:" + s.ID
+		}
+		if isBulkMail(s) {
+			key = "sender:" + strings.ToLower(senderAddress(s.From))
+		}
+		entry, ok := groups[key]
+		if !ok {
+			entry = &DigestEntry{Sender: senderName(s.From)}
+			groups[key] = entry
+			order = append(order, key)
+		}
+		entry.Messages = append(entry.Messages, s)
+		entry.Count++
+		if s.Received.After(entry.Latest) || entry.EmailID == "" {
+			entry.Latest = s.Received
+			entry.EmailID = s.ID
+			entry.Subject = s.Subject
+			entry.Snippet = s.Snippet
+		}
+	}
+
+	digest := &EmailDigest{Since: since, Unread: len(summaries)}
+	for _, key := range order {
+		entry := groups[key]
+		entry.Score, entry.Suggest = rankDigestEntry(entry)
+		digest.Entries = append(digest.Entries, *entry)
+	}
+	sort.SliceStable(digest.Entries, func(i, j int) bool {
+		a, b := digest.Entries[i], digest.Entries[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Latest.After(b.Latest)
+	})
+	return digest, nil
+}
+
+// rankDigestEntry scores a group from its messages' labels, sender and
+// subject, and suggests what to do with it.
+func rankDigestEntry(e *DigestEntry) (int, string) {
+	score := 0
+	bulk, automated, question := false, false, false
+	labels := make(map[string]bool)
+	for _, m := range e.Messages {
+		for _, l := range m.Labels {
+			labels[l] = true
+		}
+		bulk = bulk || isBulkMail(m)
+		automated = automated || isAutomatedSender(m.From)
+		question = question || strings.Contains(m.Subject, "?")
+	}
+	if labels["STARRED"] {
+		score += 4
+	}
+	if labels["IMPORTANT"] {
+		score += 3
+	}
+	if labels["CATEGORY_PERSONAL"] {
+		score += 2
+	}
+	switch {
+	case labels["CATEGORY_PROMOTIONS"]:
+		score -= 3
+	case labels["CATEGORY_SOCIAL"]:
+		score -= 2
+	case labels["CATEGORY_UPDATES"], labels["CATEGORY_FORUMS"]:
+		score--
+	}
+	if automated || bulk {
+		score -= 2
+	}
+	subject := strings.ToLower(e.Subject)
+	for _, word := range urgentWords {
+		if strings.Contains(subject, word) {
+			score += 2
+			break
+		}
+	}
+	if question && !automated {
+		score++
+	}
+	if e.Count > 1 && !bulk {
+		// A conversation that keeps going is waiting on someone
+		score++
+	}
+
+	switch {
+	case score <= -1:
+		return score, DigestArchive
+	case !automated && !bulk && (question || score >= 3):
+		return score, DigestReply
+	}
+	return score, DigestRead
+}
+
+// isBulkMail reports whether a message is newsletter or promotional mail,
+// which is grouped by sender rather than by conversation.
+func isBulkMail(s GmailSummary) bool {
+	if s.Bulk {
+		return true
+	}
+	for _, l := range s.Labels {
+		if l == "CATEGORY_PROMOTIONS" || l == "CATEGORY_SOCIAL" {
+			return true
+		}
+	}
+	return false
+}
+
+func isAutomatedSender(from string) bool {
+	addr := strings.ToLower(senderAddress(from))
+	for _, fragment := range automatedSenders {
+		if strings.Contains(addr, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func senderAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+func senderName(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if addr.Name != "" {
+			return addr.Name
+		}
+		return addr.Address
+	}
+	return from
+}
+
+// FormatEmailDigest renders a digest for chat: the groups worth reading in
+// rank order with their suggested action, then the ones that can be
+// archived in one line, in the locale tag. limit caps the ranked list (0
+// means no cap).
+func FormatEmailDigest(d *EmailDigest, loc *time.Location, tag string, limit int) string {
+	since := d.Since.In(loc)
+	sinceText := locale.Day(since, tag) + " " + locale.Time(since, tag)
+	if d.Unread == 0 {
+		return locale.T(tag, "email.none", sinceText)
+	}
+	var keep, archive []DigestEntry
+	for _, e := range d.Entries {
+		if e.Suggest == DigestArchive {
+			archive = append(archive, e)
+		} else {
+			keep = append(keep, e)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(locale.T(tag, "email.unread", d.Unread, len(d.Entries), sinceText))
+	shown := keep
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+	for i, e := range shown {
+		fmt.Fprintf(&sb, "\n%d. %s: %s", i+1, e.Sender, e.Subject)
+		if e.Count > 1 {
+			fmt.Fprintf(&sb, " (%s)", locale.T(tag, "email.messages", e.Count))
+		}
+		fmt.Fprintf(&sb, " → %s [email_id=%s]", e.Suggest, e.EmailID)
+	}
+	if rest := len(keep) - len(shown); rest > 0 {
+		sb.WriteString("\n" + locale.T(tag, "list.more", rest))
+	}
+	if len(archive) > 0 {
+		senders := make([]string, 0, len(archive))
+		messages := 0
+		for _, e := range archive {
+			messages += e.Count
+			if len(senders) < 5 {
+				senders = append(senders, e.Sender)
+			}
+		}
+		from := strings.Join(senders, ", ")
+		if len(archive) > len(senders) {
+			from = locale.T(tag, "list.and_more", from, len(archive)-len(senders))
+		}
+		sb.WriteString("\n" + locale.T(tag, "email.archivable", messages, from))
+	}
+	return sb.String()
+}
+
+// EmailSection adds the unread email digest to the daily briefing.
+type EmailSection struct {
+	gmail *GmailClient
+}
+
+func NewEmailSection(token TokenFunc) *EmailSection {
+	return &EmailSection{gmail: NewGmailClient(token)}
+}
+
+func (s *EmailSection) Name() string  { return "email" }
+func (s *EmailSection) Title() string { return "📧 Email" }
+
+// Render covers the last day of unread mail, the five groups that matter
+// most, and what can be archived.
+func (s *EmailSection) Render(ctx context.Context, req BriefingRequest) (string, error) {
+	digest, err := s.gmail.Digest(ctx, req.Now.Add(-24*time.Hour))
+	if err != nil {
+		return "", err
+	}
+	if digest.Unread == 0 {
+		return "", nil
+	}
+	return FormatEmailDigest(digest, req.Location, req.Locale, 5), nil
+}
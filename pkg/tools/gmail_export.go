@@ -0,0 +1,357 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/screening"
+)
+
+const (
+	// defaultExportEmails and maxExportEmails bound how many emails one
+	// export_pdf takes
+	defaultExportEmails = 50
+	maxExportEmails     = 200
+	// maxExportFailures is how many failed emails the report names
+	maxExportFailures = 10
+	// maxExportZip bounds a zip export, which is made in memory
+	maxExportZip = 100 << 20
+)
+
+// Formats of export_pdf.
+const (
+	exportPDFs     = "pdfs"
+	exportCombined = "combined"
+	exportZip      = "zip"
+)
+
+var htmlBodyPattern = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+
+// exportSink takes the files of an export as they are made.
+type exportSink interface {
+	add(ctx context.Context, name, mimeType string, data []byte) error
+	// finish ends the export and says where it went
+	finish(ctx context.Context) (string, error)
+}
+
+// exportPDF saves the emails matching a query as PDFs, laid out by Drive,
+// into a Drive folder or the workspace: one PDF each, one PDF with all of
+// them, or a zip of the PDFs, with their attachments when asked.
+func (t *GmailTool) exportPDF(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	if query = strings.TrimSpace(query); query == "" {
+		return ErrorResult("query is required for export_pdf, e.g. \"from:landlord@example.com after:2025/01/01\"")
+	}
+	limit := defaultExportEmails
+	if n, ok := args["limit"].(float64); ok && n >= 1 {
+		limit = min(int(n), maxExportEmails)
+	}
+	format, _ := args["format"].(string)
+	if format == "" {
+		format = exportPDFs
+	}
+	if format != exportPDFs && format != exportCombined && format != exportZip {
+		return ErrorResult(fmt.Sprintf("unknown format %q: use pdfs, combined or zip", format))
+	}
+	destination, _ := args["destination"].(string)
+	switch destination {
+	case "":
+		destination = "drive"
+	case "drive":
+	case "local":
+		if t.workspace == "" {
+			return ErrorResult("local exports are not available; export to Drive instead")
+		}
+	default:
+		return ErrorResult(fmt.Sprintf("unknown destination %q: use drive or local", destination))
+	}
+	withAttachments, _ := args["include_attachments"].(bool)
+	name, _ := args["name"].(string)
+	if name = strings.TrimSpace(name); name == "" {
+		name = "Emails " + time.Now().Format("2006-01-02")
+	}
+	name = sanitizeArchiveName(strings.TrimSuffix(strings.TrimSuffix(name, ".pdf"), ".zip"))
+
+	ids, err := t.gmail.Search(ctx, query, limit)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to search Gmail: %v", err)).WithError(err)
+	}
+	if len(ids) == 0 {
+		return SilentResult(fmt.Sprintf("No emails match %q; nothing was exported.", query))
+	}
+	var failures []string
+	var msgs []*GmailMessage
+	for _, id := range ids {
+		msg, err := t.gmail.GetMessage(ctx, id)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("email %s: %v", id, err))
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	// Records read oldest first
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Received.Before(msgs[j].Received) })
+
+	folder, _ := args["folder"].(string)
+	var sink exportSink
+	if destination == "drive" {
+		folderID, folderName, err := t.resolveFolder(ctx, folder)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to find the Drive folder: %v", err)).WithError(err)
+		}
+		sink = &driveExportSink{drive: t.drive, folderID: folderID, folderName: folderName}
+	} else {
+		dir := filepath.Join(t.workspace, "exports")
+		for _, part := range strings.Split(folder, "/") {
+			if part = strings.TrimSpace(part); part != "" && part != "." && part != ".." {
+				dir = filepath.Join(dir, sanitizeArchiveName(part))
+			}
+		}
+		sink = &dirExportSink{dir: dir, workspace: t.workspace}
+	}
+	if format == exportZip {
+		sink = newZipExportSink(sink, name+".zip")
+	}
+
+	exported := 0
+	var combined strings.Builder
+	names := map[string]int{}
+	for _, msg := range msgs {
+		fileName := uniqueExportName(names, sanitizeArchiveName(fmt.Sprintf("%s %s", msg.Received.In(time.Local).Format("2006-01-02"), emailSubject(msg))))
+		if format == exportCombined {
+			if exported > 0 {
+				combined.WriteString(`<p style="page-break-before: always"></p>`)
+			}
+			combined.WriteString(emailHTML(msg))
+		} else {
+			pdf, err := t.drive.ConvertToPDF(ctx, fileName, []byte("<html><head><meta charset=\"utf-8\"></head><body>"+emailHTML(msg)+"</body></html>"))
+			if err == nil {
+				err = sink.add(ctx, fileName+".pdf", "application/pdf", pdf)
+			}
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%q: %v", emailSubject(msg), err))
+				continue
+			}
+		}
+		exported++
+		if withAttachments {
+			failures = append(failures, t.exportAttachments(ctx, sink, names, fileName, msg)...)
+		}
+	}
+	if format == exportCombined && exported > 0 {
+		pdf, err := t.drive.ConvertToPDF(ctx, name, []byte("<html><head><meta charset=\"utf-8\"></head><body>"+combined.String()+"</body></html>"))
+		if err == nil {
+			err = sink.add(ctx, name+".pdf", "application/pdf", pdf)
+		}
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to make the combined PDF: %v; try format=pdfs, or fewer emails", err)).WithError(err)
+		}
+	}
+	if exported == 0 {
+		return ErrorResult(fmt.Sprintf("No emails could be exported:\n- %s", strings.Join(failures, "\n- ")))
+	}
+	where, err := sink.finish(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the export: %v", err)).WithError(err)
+	}
+	var sb strings.Builder
+	switch format {
+	case exportCombined:
+		fmt.Fprintf(&sb, "Exported %d email(s) matching %q as one PDF, oldest first, to %s.", exported, query, where)
+	case exportZip:
+		fmt.Fprintf(&sb, "Exported %d email(s) matching %q as PDFs in a zip, to %s.", exported, query, where)
+	default:
+		fmt.Fprintf(&sb, "Exported %d email(s) matching %q as one PDF each, to %s.", exported, query, where)
+	}
+	if len(ids) == limit {
+		fmt.Fprintf(&sb, " More emails may match; only the newest %d were taken.", limit)
+	}
+	if len(failures) > 0 {
+		shown := failures[:min(len(failures), maxExportFailures)]
+		fmt.Fprintf(&sb, "\n⚠️ %d problem(s):\n- %s", len(failures), strings.Join(shown, "\n- "))
+	}
+	return SilentResult(sb.String())
+}
+
+// exportAttachments adds msg's attachments to sink, named after the
+// email's PDF, and returns what could not be added.
+func (t *GmailTool) exportAttachments(ctx context.Context, sink exportSink, names map[string]int, prefix string, msg *GmailMessage) []string {
+	var failures []string
+	for _, att := range msg.Attachments {
+		var blocked *screening.BlockedError
+		if err := screening.Check(att.Filename, int64(att.Size)); errors.As(err, &blocked) {
+			failures = append(failures, fmt.Sprintf("%s of %q: %s", att.Filename, emailSubject(msg), blocked.Reason))
+			continue
+		}
+		data, err := t.gmail.DownloadAttachment(ctx, msg.ID, att)
+		if err == nil {
+			ext := filepath.Ext(att.Filename)
+			fileName := uniqueExportName(names, sanitizeArchiveName(prefix+" - "+strings.TrimSuffix(att.Filename, ext))) + ext
+			err = sink.add(ctx, fileName, att.MimeType, data)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s of %q: %v", att.Filename, emailSubject(msg), err))
+		}
+	}
+	return failures
+}
+
+// uniqueExportName returns name, or name with a number when the export
+// already has a file of that name.
+func uniqueExportName(names map[string]int, name string) string {
+	names[name]++
+	if n := names[name]; n > 1 {
+		return fmt.Sprintf("%s (%d)", name, n)
+	}
+	return name
+}
+
+func emailSubject(msg *GmailMessage) string {
+	if msg.Subject == "" {
+		return "(no subject)"
+	}
+	return msg.Subject
+}
+
+// emailHTML is an email as a record: its headers, then its body, the HTML
+// one when there is one.
+func emailHTML(msg *GmailMessage) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<h2>%s</h2>\n<table>\n", html.EscapeString(emailSubject(msg)))
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, "<tr><td><b>%s</b></td><td>%s</td></tr>\n", label, html.EscapeString(value))
+		}
+	}
+	row("From", msg.From)
+	row("To", msg.To)
+	row("Cc", msg.Cc)
+	date := msg.Date
+	if !msg.Received.IsZero() {
+		date = msg.Received.In(time.Local).Format("Mon 2 Jan 2006 15:04 MST")
+	}
+	row("Date", date)
+	if len(msg.Attachments) > 0 {
+		var names []string
+		for _, att := range msg.Attachments {
+			names = append(names, fmt.Sprintf("%s (%s)", att.Filename, formatFileSize(int64(att.Size))))
+		}
+		row("Attachments", strings.Join(names, ", "))
+	}
+	sb.WriteString("</table>\n<hr>\n")
+	if msg.HTML != "" {
+		body := msg.HTML
+		if m := htmlBodyPattern.FindStringSubmatch(body); m != nil {
+			body = m[1]
+		}
+		sb.WriteString(body)
+	} else {
+		for _, para := range strings.Split(msg.Text, "\n\n") {
+			fmt.Fprintf(&sb, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(para), "\n", "<br>"))
+		}
+	}
+	return sb.String()
+}
+
+// driveExportSink uploads an export's files into a Drive folder.
+type driveExportSink struct {
+	drive      *GoogleDriveClient
+	folderID   string
+	folderName string
+	last       *DriveFile
+	files      int
+}
+
+func (s *driveExportSink) add(ctx context.Context, name, mimeType string, data []byte) error {
+	file, err := s.drive.Upload(ctx, s.folderID, name, mimeType, data)
+	if err != nil {
+		return err
+	}
+	s.last = file
+	s.files++
+	return nil
+}
+
+func (s *driveExportSink) finish(ctx context.Context) (string, error) {
+	if s.files == 1 {
+		return fmt.Sprintf("Drive (%s): %s", s.folderName, s.last.WebViewLink), nil
+	}
+	return fmt.Sprintf("the Drive folder %s (%d files)", s.folderName, s.files), nil
+}
+
+// dirExportSink writes an export's files into a workspace folder.
+type dirExportSink struct {
+	dir       string
+	workspace string
+	last      string
+	files     int
+}
+
+func (s *dirExportSink) add(ctx context.Context, name, mimeType string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	path := freeFileName(s.dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	s.last = path
+	s.files++
+	return nil
+}
+
+func (s *dirExportSink) finish(ctx context.Context) (string, error) {
+	if s.files == 1 {
+		rel, _ := filepath.Rel(s.workspace, s.last)
+		return fmt.Sprintf("the workspace file %s (the message tool can send it)", rel), nil
+	}
+	rel, _ := filepath.Rel(s.workspace, s.dir)
+	return fmt.Sprintf("the workspace folder %s (%d files)", rel, s.files), nil
+}
+
+// zipExportSink collects an export's files into a zip, which goes to the
+// sink behind it when the export is done.
+type zipExportSink struct {
+	next exportSink
+	name string
+	buf  bytes.Buffer
+	zw   *zip.Writer
+}
+
+func newZipExportSink(next exportSink, name string) *zipExportSink {
+	s := &zipExportSink{next: next, name: name}
+	s.zw = zip.NewWriter(&s.buf)
+	return s
+}
+
+func (s *zipExportSink) add(ctx context.Context, name, mimeType string, data []byte) error {
+	if s.buf.Len()+len(data) > maxExportZip {
+		return fmt.Errorf("the zip would be larger than %s", formatFileSize(maxExportZip))
+	}
+	w, err := s.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (s *zipExportSink) finish(ctx context.Context) (string, error) {
+	if err := s.zw.Close(); err != nil {
+		return "", err
+	}
+	if err := s.next.add(ctx, s.name, "application/zip", s.buf.Bytes()); err != nil {
+		return "", err
+	}
+	return s.next.finish(ctx)
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestGmailTool_ExportPDF verifies matching emails become one PDF each in the Drive folder, with their attachments, and no temporary Docs are left behind
+func TestGmailTool_ExportPDF(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddEmail(testkit.Email{From: "landlord@example.com", Subject: "Rent increase", Body: "Rent goes up in May.", Date: time.Now().AddDate(0, -2, 0),
+		Attachments: []testkit.Attachment{{Filename: "notice.pdf", MimeType: "application/pdf", Data: []byte("%PDF notice")}}})
+	g.AddEmail(testkit.Email{From: "landlord@example.com", Subject: "Boiler repair", HTML: "<html><body><p>The <b>boiler</b> is fixed.</p></body></html>", Body: "The boiler is fixed.", Date: time.Now().AddDate(0, -1, 0)})
+	g.AddEmail(testkit.Email{From: "shop@example.com", Subject: "Sale", Body: "50% off", Date: time.Now()})
+
+	tool := NewGmailTool(testkit.Token)
+	result := tool.Execute(context.Background(), map[string]interface{}{"action": "export_pdf", "query": "from:landlord@example.com", "folder": "Legal/Lease", "include_attachments": true})
+	if result.IsError {
+		t.Fatalf("export_pdf failed: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Exported 2 email(s)") || !strings.Contains(result.ForLLM, "Legal/Lease") {
+		t.Errorf("Unexpected report: %s", result.ForLLM)
+	}
+	byName := map[string]string{}
+	for _, f := range g.Files() {
+		if f.MimeType == googleDocType {
+			t.Errorf("Expected the temporary Doc deleted, found %s", f.Name)
+		}
+		byName[f.Name] = string(f.Content)
+	}
+	day := time.Now().AddDate(0, -2, 0).Format("2006-01-02")
+	rent := byName[day+" Rent increase.pdf"]
+	if !strings.Contains(rent, "landlord@example.com") || !strings.Contains(rent, "<p>Rent goes up in May.</p>") || !strings.Contains(rent, "notice.pdf") {
+		t.Errorf("Expected the headers and text in the first PDF, got files %v", byName)
+	}
+	if !strings.Contains(byName[time.Now().AddDate(0, -1, 0).Format("2006-01-02")+" Boiler repair.pdf"], "The <b>boiler</b> is fixed.") {
+		t.Errorf("Expected the HTML body in the second PDF, got files %v", byName)
+	}
+	if byName[day+" Rent increase - notice.pdf"] != "%PDF notice" {
+		t.Errorf("Expected the attachment saved next to its email, got files %v", byName)
+	}
+}
+
+// TestGmailTool_ExportPDFLocalZip verifies a zip export lands in the workspace with one PDF per email, oldest first
+func TestGmailTool_ExportPDFLocalZip(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddEmail(testkit.Email{From: "accountant@example.com", Subject: "Q2 figures", Body: "Attached", Date: time.Now().AddDate(0, 0, -1)})
+	g.AddEmail(testkit.Email{From: "accountant@example.com", Subject: "Q1 figures", Body: "Attached", Date: time.Now().AddDate(0, 0, -5)})
+
+	workspace := t.TempDir()
+	tool := NewGmailTool(testkit.Token)
+	args := map[string]interface{}{"action": "export_pdf", "query": "from:accountant@example.com", "format": "zip", "destination": "local", "folder": "../taxes", "name": "Accountant"}
+	if result := tool.Execute(context.Background(), args); !result.IsError {
+		t.Errorf("Expected local exports refused without a workspace, got: %s", result.ForLLM)
+	}
+	tool.SetWorkspace(workspace)
+	result := tool.Execute(context.Background(), args)
+	if result.IsError {
+		t.Fatalf("export_pdf failed: %s", result.ForLLM)
+	}
+	data, err := os.ReadFile(filepath.Join(workspace, "exports", "taxes", "Accountant.zip"))
+	if err != nil {
+		t.Fatalf("Expected the zip in workspace/exports/taxes: %v (%s)", err, result.ForLLM)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Bad zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name[len("2006-01-02 "):])
+	}
+	if strings.Join(names, ",") != "Q1 figures.pdf,Q2 figures.pdf" {
+		t.Errorf("Expected the PDFs oldest first, got %v", names)
+	}
+	if files := g.Files(); len(files) != 0 {
+		t.Errorf("Expected nothing left in Drive, got %+v", files)
+	}
+}
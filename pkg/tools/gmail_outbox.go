@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+const (
+	// mailRetryFirst is the wait before the first retry; it doubles after
+	// each failure up to mailRetryMax
+	mailRetryFirst = time.Minute
+	mailRetryMax   = time.Hour
+	// mailMaxAttempts is when a queued email is given up on, about a day
+	// after it was queued
+	mailMaxAttempts = 30
+)
+
+// MailOutbox holds emails Gmail could not take because the network or the
+// API was unavailable, and sends them later with backoff, telling the chat
+// that sent each one when it finally goes out or is given up on. The
+// queue lives in the state store, so it survives restarts.
+type MailOutbox struct {
+	queue *store.MailOutbox
+	bus   *bus.MessageBus
+	now   func() time.Time
+
+	mu    sync.RWMutex
+	token TokenFunc
+}
+
+// NewMailOutbox returns an outbox stored in queue. token authorizes
+// sending; nil leaves queued mail waiting until SetToken. Notices go to
+// msgBus, or nowhere when it is nil.
+func NewMailOutbox(queue *store.MailOutbox, token TokenFunc, msgBus *bus.MessageBus) *MailOutbox {
+	return &MailOutbox{queue: queue, bus: msgBus, token: token, now: time.Now}
+}
+
+// SetToken replaces the Google token after a config reload.
+func (o *MailOutbox) SetToken(token TokenFunc) {
+	o.mu.Lock()
+	o.token = token
+	o.mu.Unlock()
+}
+
+// queuedEmail is what is stored for an email.
+type queuedEmail struct {
+	Email OutgoingEmail `json:"email"`
+}
+
+// Queue stores e for a later attempt after sendErr, for the chat in ctx.
+func (o *MailOutbox) Queue(ctx context.Context, e OutgoingEmail, sendErr error) (int64, error) {
+	data, err := json.Marshal(queuedEmail{Email: e})
+	if err != nil {
+		return 0, err
+	}
+	channel, chatID := ChatFromContext(ctx)
+	id, err := o.queue.Enqueue(context.WithoutCancel(ctx), channel, chatID, describeOutgoing(e), string(data), o.now().Add(mailRetryFirst))
+	if err != nil {
+		return 0, err
+	}
+	logger.InfoCF("tools", "Email queued for a later attempt", map[string]interface{}{
+		"id":    id,
+		"error": sendErr.Error(),
+	})
+	return id, nil
+}
+
+// Queued lists the emails of the chat in ctx that are waiting to be sent.
+func (o *MailOutbox) Queued(ctx context.Context) ([]store.MailOutboxItem, error) {
+	channel, chatID := ChatFromContext(ctx)
+	return o.queue.Queued(ctx, channel, chatID)
+}
+
+// Run sends due emails every interval until ctx is done.
+func (o *MailOutbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.Deliver(ctx)
+		}
+	}
+}
+
+// Deliver tries every due email once and returns how many were sent.
+func (o *MailOutbox) Deliver(ctx context.Context) int {
+	o.mu.RLock()
+	token := o.token
+	o.mu.RUnlock()
+	if token == nil {
+		return 0
+	}
+	items, err := o.queue.Pending(ctx, o.now(), 50)
+	if err != nil {
+		logger.DebugCF("tools", "Mail outbox unavailable", map[string]interface{}{"error": err.Error()})
+		return 0
+	}
+	gmail := NewGmailClient(token)
+	sent := 0
+	for _, item := range items {
+		var q queuedEmail
+		if err := json.Unmarshal([]byte(item.Message), &q); err != nil {
+			o.queue.MarkFailed(ctx, item.ID, err, time.Time{})
+			continue
+		}
+		_, _, err := gmail.Send(ctx, q.Email)
+		switch {
+		case err == nil:
+			o.queue.MarkSent(ctx, item.ID)
+			o.notify(item, fmt.Sprintf("✉️ Sent the queued email %s.", item.Summary))
+			sent++
+		case retryableSend(err) && item.Attempts+1 < mailMaxAttempts:
+			o.queue.MarkFailed(ctx, item.ID, err, o.now().Add(mailRetryDelay(item.Attempts+1)))
+		default:
+			o.queue.MarkFailed(ctx, item.ID, err, time.Time{})
+			o.notify(item, fmt.Sprintf("✗ Gave up sending the queued email %s after %d attempt(s): %v", item.Summary, item.Attempts+1, err))
+		}
+	}
+	return sent
+}
+
+func (o *MailOutbox) notify(item store.MailOutboxItem, msg string) {
+	if o.bus == nil || item.Channel == "" || item.ChatID == "" {
+		return
+	}
+	o.bus.PublishOutbound(bus.OutboundMessage{Channel: item.Channel, ChatID: item.ChatID, Content: msg})
+}
+
+// mailRetryDelay is the wait after the given number of failed retries:
+// twice the first wait after one, four times after two, up to the cap.
+func mailRetryDelay(attempts int) time.Duration {
+	delay := mailRetryFirst
+	for i := 0; i < attempts && delay < mailRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, mailRetryMax)
+}
+
+// retryableSend reports whether a send failed for a reason that may pass:
+// no network, a timeout, or Gmail answering that it is overloaded or
+// down. Refusals such as a bad address or a missing scope are final.
+func retryableSend(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusRequestTimeout || apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// describeOutgoing names an email for notices: "Lunch" to ana@example.com.
+func describeOutgoing(e OutgoingEmail) string {
+	subject := e.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	return fmt.Sprintf("%q to %s", subject, strings.Join(append(append([]string(nil), e.To...), e.Cc...), ", "))
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestMailOutbox_QueuesAndRetries verifies a send Gmail cannot take is queued, retried with backoff and reported to the chat once it goes out or is refused
+func TestMailOutbox_QueuesAndRetries(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddSendAs(testkit.SendAs{Email: "ana@gmail.example", Default: true})
+	db := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	msgBus := bus.NewMessageBus()
+	outbox := NewMailOutbox(db.MailOutbox, testkit.Token, msgBus)
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+	tool := NewGmailTool(testkit.Token)
+	tool.SetOutbox(outbox)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	g.FailNext("settings/sendAs", 1, 503)
+	g.FailNext("messages/send", 2, 503)
+	result := tool.Execute(ctx, map[string]interface{}{"action": "send", "to": "client@example.com", "subject": "Invoice", "body": "Attached."})
+	if result.IsError || !strings.Contains(result.ForLLM, "queued") {
+		t.Fatalf("send while Gmail is down: %s", result.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "outbox"}); !strings.Contains(r.ForLLM, `"Invoice" to <client@example.com>`) {
+		t.Errorf("outbox: %s", r.ForLLM)
+	}
+
+	if sent := outbox.Deliver(context.Background()); sent != 0 {
+		t.Errorf("delivered %d before the retry was due", sent)
+	}
+	now = now.Add(mailRetryFirst)
+	if sent := outbox.Deliver(context.Background()); sent != 0 || len(g.Sent()) != 0 {
+		t.Errorf("the second failure should be retried later, sent %d", sent)
+	}
+	now = now.Add(mailRetryFirst)
+	if sent := outbox.Deliver(context.Background()); sent != 0 {
+		t.Errorf("the retry after a failed retry should wait %v", mailRetryDelay(1))
+	}
+	now = now.Add(mailRetryDelay(1) - mailRetryFirst)
+	if sent := outbox.Deliver(context.Background()); sent != 1 || len(g.Sent()) != 1 {
+		t.Fatalf("delivered %d, want the queued email", sent)
+	}
+	notices := msgBus.DrainOutbound()
+	if len(notices) != 1 || notices[0].ChatID != "42" || !strings.Contains(notices[0].Content, "Sent the queued email \"Invoice\"") {
+		t.Errorf("notices = %+v", notices)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "outbox"}); !strings.Contains(r.ForLLM, "No emails") {
+		t.Errorf("outbox after sending: %s", r.ForLLM)
+	}
+
+	// A refusal is final: the chat is told at once instead of retrying
+	g.FailNext("messages/send", 1, 503)
+	tool.Execute(ctx, map[string]interface{}{"action": "send", "to": "client@example.com", "subject": "Again", "body": "x"})
+	g.FailNext("messages/send", 1, 400)
+	now = now.Add(mailRetryFirst)
+	outbox.Deliver(context.Background())
+	notices = msgBus.DrainOutbound()
+	if len(notices) != 1 || !strings.Contains(notices[0].Content, "Gave up sending the queued email \"Again\"") {
+		t.Errorf("notices = %+v", notices)
+	}
+
+	g.FailNext("messages/send", 1, 400)
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "send", "to": "client@example.com", "body": "x"}); !r.IsError {
+		t.Errorf("a refused send should fail rather than be queued: %s", r.ForLLM)
+	}
+}
@@ -0,0 +1,272 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// SendAsAddress is an address the account can send mail from: the Gmail
+// address itself or an alias set up under "Send mail as" in Gmail's
+// settings.
+type SendAsAddress struct {
+	Email       string
+	DisplayName string
+	// ReplyTo is where replies should go, when the alias sets one
+	ReplyTo  string
+	Default  bool
+	Verified bool
+}
+
+func (a SendAsAddress) String() string {
+	if a.DisplayName == "" {
+		return a.Email
+	}
+	return (&mail.Address{Name: a.DisplayName, Address: a.Email}).String()
+}
+
+// SendAs lists the addresses the account can send from.
+func (c *GmailClient) SendAs(ctx context.Context) ([]SendAsAddress, error) {
+	var resp struct {
+		SendAs []struct {
+			SendAsEmail        string `json:"sendAsEmail"`
+			DisplayName        string `json:"displayName"`
+			ReplyToAddress     string `json:"replyToAddress"`
+			IsDefault          bool   `json:"isDefault"`
+			IsPrimary          bool   `json:"isPrimary"`
+			VerificationStatus string `json:"verificationStatus"`
+		} `json:"sendAs"`
+	}
+	if err := c.do(ctx, "/users/me/settings/sendAs", &resp); err != nil {
+		return nil, err
+	}
+	addresses := make([]SendAsAddress, len(resp.SendAs))
+	for i, a := range resp.SendAs {
+		addresses[i] = SendAsAddress{
+			Email:       a.SendAsEmail,
+			DisplayName: a.DisplayName,
+			ReplyTo:     a.ReplyToAddress,
+			Default:     a.IsDefault,
+			// The primary address has no verification status
+			Verified: a.IsPrimary || a.VerificationStatus == "" || a.VerificationStatus == "accepted",
+		}
+	}
+	return addresses, nil
+}
+
+// OutgoingEmail is a plain text message to send. A zero From sends from
+// the account's default address.
+type OutgoingEmail struct {
+	From    SendAsAddress
+	To      []string
+	Cc      []string
+	Subject string
+	Body    string
+	// InReplyTo, References and ThreadID make the message a reply in an
+	// existing conversation
+	InReplyTo  string
+	References string
+	ThreadID   string
+}
+
+// raw renders e as an RFC 5322 message.
+func (e OutgoingEmail) raw(now time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+	if e.From.Email != "" {
+		header("From", e.From.String())
+		header("Reply-To", e.From.ReplyTo)
+	}
+	header("To", strings.Join(e.To, ", "))
+	header("Cc", strings.Join(e.Cc, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", e.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("In-Reply-To", e.InReplyTo)
+	header("References", e.References)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(e.Body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// Send sends e and returns the new message's ID and conversation.
+func (c *GmailClient) Send(ctx context.Context, e OutgoingEmail) (id, threadID string, err error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	payload := map[string]string{"raw": base64.URLEncoding.EncodeToString(e.raw(time.Now()))}
+	if e.ThreadID != "" {
+		payload["threadId"] = e.ThreadID
+	}
+	var resp struct {
+		ID       string `json:"id"`
+		ThreadID string `json:"threadId"`
+	}
+	err = doJSONRequest(ctx, c.client, http.MethodPost, c.baseURL+"/users/me/messages/send",
+		map[string]string{"Authorization": "Bearer " + token}, payload, &resp)
+	if err != nil {
+		return "", "", err
+	}
+	return resp.ID, resp.ThreadID, nil
+}
+
+// CreateDraft saves e in the account's drafts without sending it and
+// returns the draft's ID. It needs the gmail.compose scope.
+func (c *GmailClient) CreateDraft(ctx context.Context, e OutgoingEmail) (string, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	message := map[string]string{"raw": base64.URLEncoding.EncodeToString(e.raw(time.Now()))}
+	if e.ThreadID != "" {
+		message["threadId"] = e.ThreadID
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	err = doJSONRequest(ctx, c.client, http.MethodPost, c.baseURL+"/users/me/drafts",
+		map[string]string{"Authorization": "Bearer " + token}, map[string]interface{}{"message": message}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// pickSendAs finds the address alias names among the account's send-as
+// addresses, by address or display name. An empty alias picks the
+// default address.
+func pickSendAs(addresses []SendAsAddress, alias string) (SendAsAddress, error) {
+	alias = strings.TrimSpace(alias)
+	if parsed, err := mail.ParseAddress(alias); err == nil {
+		alias = parsed.Address
+	}
+	for _, a := range addresses {
+		if alias == "" && a.Default || alias != "" && (strings.EqualFold(a.Email, alias) || strings.EqualFold(a.DisplayName, alias)) {
+			if !a.Verified {
+				return SendAsAddress{}, fmt.Errorf("%s is not verified in Gmail's \"Send mail as\" settings yet", a.Email)
+			}
+			return a, nil
+		}
+	}
+	if alias == "" {
+		return SendAsAddress{}, nil
+	}
+	names := make([]string, len(addresses))
+	for i, a := range addresses {
+		names[i] = a.Email
+	}
+	return SendAsAddress{}, fmt.Errorf("%s is not one of the account's send-as addresses: %s", alias, strings.Join(names, ", "))
+}
+
+// replyFrom picks the send-as address a message was written to, so a
+// reply to mail sent to an alias goes out from that alias.
+func replyFrom(addresses []SendAsAddress, msg *GmailMessage) (SendAsAddress, bool) {
+	recipients, _ := mail.ParseAddressList(joinNonEmpty(", ", msg.To, msg.Cc))
+	for _, r := range recipients {
+		for _, a := range addresses {
+			if strings.EqualFold(a.Email, r.Address) && a.Verified {
+				return a, true
+			}
+		}
+	}
+	return SendAsAddress{}, false
+}
+
+// recipients reads the to or cc argument, a list or a comma-separated
+// string, and checks that each entry is an address rather than a name.
+// A "group:<name>" entry, or a bare name that is one of the chat's contact
+// groups, stands for the addresses of the group's members; the members
+// left out for having no email address are returned too.
+func (t *GmailTool) recipients(ctx context.Context, args map[string]interface{}, key string) ([]string, []string, error) {
+	var addresses, missing []string
+	seen := map[string]bool{}
+	add := func(addr string) {
+		if k := strings.ToLower(addr); !seen[k] {
+			seen[k] = true
+			addresses = append(addresses, addr)
+		}
+	}
+	for _, entry := range recipientEntries(args, key) {
+		addr, err := parseRecipient(entry)
+		if err == nil {
+			add(addr)
+			continue
+		}
+		prefixed := strings.HasPrefix(entry, "group:")
+		if t.groups == nil {
+			if prefixed {
+				return nil, nil, fmt.Errorf("contact groups are not enabled")
+			}
+			return nil, nil, err
+		}
+		group, gerr := findGroup(ctx, t.groups, entry)
+		if gerr != nil {
+			if prefixed {
+				return nil, nil, gerr
+			}
+			return nil, nil, err
+		}
+		found := false
+		for _, m := range group.Members {
+			if m.Email == "" {
+				missing = append(missing, m.Name)
+				continue
+			}
+			found = true
+			add((&mail.Address{Name: m.Name, Address: m.Email}).String())
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("no one in the %s group has an email address; add them with the contact_groups tool", group.Name)
+		}
+	}
+	return addresses, missing, nil
+}
+
+// recipientEntries returns the non-empty entries of the to or cc argument.
+func recipientEntries(args map[string]interface{}, key string) []string {
+	entries, _ := stringListArg(args, key)
+	if s, ok := args[key].(string); ok {
+		entries = strings.Split(s, ",")
+	}
+	var out []string
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// parseRecipient checks that entry is an email address rather than a
+// name.
+func parseRecipient(entry string) (string, error) {
+	addr, err := mail.ParseAddress(entry)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an email address; find it with the contacts tool (action=resolve) or ask the user", entry)
+	}
+	return addr.String(), nil
+}
+
+// replySubject prefixes "Re: " unless the subject already has it.
+func replySubject(subject string) string {
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
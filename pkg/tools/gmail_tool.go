@@ -0,0 +1,535 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/screening"
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+// driveIDPattern matches Drive file and folder IDs, as opposed to folder
+// paths like "Receipts/2026".
+var driveIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+
+// GmailTool works with Gmail messages the other tools found: it lists a
+// message's attachments and saves them to Drive, digests the unread inbox,
+// and sends mail and replies from the account's address or one of its
+// send-as aliases. Attachments go from
+// Gmail to Drive inside picoclaw, so their content never passes through
+// the model or the workspace. Mail that cannot be sent while the network
+// or Gmail is down waits in the outbox, when one is set.
+type GmailTool struct {
+	gmail  *GmailClient
+	drive  *GoogleDriveClient
+	outbox *MailOutbox
+	groups *store.ContactGroups
+	// links follows unsubscribe links, which come from senders
+	links *http.Client
+	// workspace is where local exports go; none without it
+	workspace string
+}
+
+func NewGmailTool(token TokenFunc) *GmailTool {
+	return &GmailTool{gmail: NewGmailClient(token), drive: NewGoogleDriveClient(token), links: egress.Client(30 * time.Second)}
+}
+
+// SetOutbox queues mail that cannot be sent right away in outbox instead
+// of failing.
+func (t *GmailTool) SetOutbox(outbox *MailOutbox) {
+	t.outbox = outbox
+}
+
+// SetWorkspace lets export_pdf save into workspace/exports.
+func (t *GmailTool) SetWorkspace(workspace string) {
+	t.workspace = workspace
+}
+
+// SetGroups lets to and cc name the chat's contact groups.
+func (t *GmailTool) SetGroups(groups *store.ContactGroups) {
+	t.groups = groups
+}
+
+func (t *GmailTool) Name() string {
+	return "gmail"
+}
+
+func (t *GmailTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "digest", "attachments", "triage_suspicious", "export_pdf")
+}
+
+func (t *GmailTool) Mutates(args map[string]interface{}) bool {
+	if move, _ := args["move_to_spam"].(bool); move && actionIn(args, "triage_suspicious") {
+		return true
+	}
+	return actionIn(args, "save_to_drive", "send", "reply", "unsubscribe", "export_pdf")
+}
+
+func (t *GmailTool) ActionScopes() map[string][]string {
+	send := append(googleScopes("gmail.send", "gmail.compose", "gmail.modify"), "https://mail.google.com/")
+	drive := googleScopes("drive.file", "drive")
+	return map[string][]string{"send": send, "reply": send, "save_to_drive": drive, "export_pdf": drive}
+}
+
+// WorksOffline reports whether the call can run without a connection:
+// listing the outbox, or sending when the outbox queues what Gmail cannot
+// take yet.
+func (t *GmailTool) WorksOffline(args map[string]interface{}) bool {
+	return actionIn(args, "outbox") || (t.outbox != nil && actionIn(args, "send"))
+}
+
+func (t *GmailTool) Description() string {
+	return "Work with Gmail. action=digest summarizes unread inbox mail since a time, grouped by conversation and ranked by importance, with a suggested action (reply, read, archive) for each. For a message found by search_everything or the digest (email_id=...): action=attachments lists its attachments; action=save_to_drive copies one attachment (or all of them) straight into a Google Drive folder and returns the new file's ID and link. Use this instead of downloading the file yourself. action=export_pdf saves the emails matching query as PDFs, for records to hand to an accountant or lawyer: one PDF each (format=pdfs), one PDF with all of them oldest first (format=combined) or a zip of the PDFs (format=zip), into a Drive folder or, with destination=local, the workspace; include_attachments=true saves their attachments next to them. action=send sends a plain text email and action=reply answers email_id in its conversation; from_alias picks which of the user's addresses it comes from (action=aliases lists them). A reply without from_alias goes out from the address the email was sent to. action=unsubscribe leaves the mailing list email_id came from, using its List-Unsubscribe header (one-click or by email; a sender that only offers a web page gets its link returned instead), and with archive_future=true also adds a filter that keeps the sender's future mail out of the inbox. action=triage_suspicious checks messages for phishing (email_id, comma-separated for several, or a query, default unread inbox mail of the last 3 days): failed SPF/DKIM/DMARC, a Reply-To or Return-Path at another domain, links to other domains, bare IPs, look-alike or shortened links and risky attachments, and reports a low/medium/high risk with the reasons; move_to_spam=true moves the high-risk ones to spam, so only set it when the user asked. When the network or Gmail is down, send and reply queue the email and send it later, telling the user when it goes out; action=outbox lists what is waiting. Only send what the user asked for, to addresses they gave or the contacts tool resolved."
+}
+
+func (t *GmailTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"digest", "attachments", "save_to_drive", "export_pdf", "send", "reply", "aliases", "outbox", "unsubscribe", "triage_suspicious"},
+				"description": "Action to perform",
+			},
+			"email_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Gmail message ID (attachments, save_to_drive, reply, unsubscribe; triage_suspicious takes several, comma-separated)",
+			},
+			"since": map[string]interface{}{
+				"type":        "string",
+				"description": "digest: start time, RFC 3339 or like \"yesterday\", \"3d\", \"12h\" (default: last 24 hours)",
+			},
+			"to": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "send: recipient email addresses; \"group:<name>\" stands for a contact group's members (see the contact_groups tool)",
+			},
+			"cc": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "send, reply: email addresses to copy, or \"group:<name>\" for a contact group",
+			},
+			"subject": map[string]interface{}{
+				"type":        "string",
+				"description": "send: subject line (a reply keeps the original's)",
+			},
+			"body": map[string]interface{}{
+				"type":        "string",
+				"description": "send, reply: plain text body",
+			},
+			"from_alias": map[string]interface{}{
+				"type":        "string",
+				"description": "send, reply: the user's address or send-as alias to send from, by address or name (default: the account's default address; for a reply, the address the email was sent to)",
+			},
+			"attachment": map[string]interface{}{
+				"type":        "string",
+				"description": "save_to_drive: the attachment's file name or its number from action=attachments (default: every attachment)",
+			},
+			"folder": map[string]interface{}{
+				"type":        "string",
+				"description": "save_to_drive, export_pdf: Drive folder ID, or a folder path like \"Receipts/2026\" that is created if missing (default: My Drive); for a local export_pdf, the folder in workspace/exports",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "save_to_drive: file name in Drive, when saving one attachment (default: its name in the email); export_pdf: name of the combined PDF or the zip (default: \"Emails\" and today's date)",
+			},
+			"archive_future": map[string]interface{}{
+				"type":        "boolean",
+				"description": "unsubscribe: also create a filter archiving future mail from the sender",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "triage_suspicious without email_id: Gmail search for the messages to check (default: unread inbox mail of the last 3 days); export_pdf: Gmail search for the emails to export, e.g. \"from:landlord@example.com after:2025/01/01\"",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "triage_suspicious: maximum messages to check (default 10, at most 30); export_pdf: maximum emails to export, newest first (default 50, at most 200)",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"pdfs", "combined", "zip"},
+				"description": "export_pdf: one PDF per email (default), one combined PDF, or a zip of the PDFs",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"drive", "local"},
+				"description": "export_pdf: where the export goes (default drive)",
+			},
+			"include_attachments": map[string]interface{}{
+				"type":        "boolean",
+				"description": "export_pdf: also save each email's attachments",
+			},
+			"move_to_spam": map[string]interface{}{
+				"type":        "boolean",
+				"description": "triage_suspicious: move high-risk messages to spam",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *GmailTool) Examples() []ToolExample {
+	return []ToolExample{
+		{Request: "Save the invoice from that email to Drive", Args: map[string]interface{}{"action": "save_to_drive", "email_id": "18c2f", "attachment": "invoice.pdf", "folder": "Receipts/2026"}},
+		{Request: "Tell Ana I'll be late", Args: map[string]interface{}{"action": "send", "to": []string{"ana@example.com"}, "subject": "Running late", "body": "Hi Ana, I'll be about 15 minutes late."}},
+		{Request: "Put all the emails with my landlord from last year in a PDF for my lawyer", Args: map[string]interface{}{"action": "export_pdf", "query": "from:landlord@example.com OR to:landlord@example.com after:2025/01/01 before:2026/01/01", "format": "combined", "folder": "Legal/Lease"}},
+		{Request: "Is anything from my bank this week phishing?", Args: map[string]interface{}{"action": "triage_suspicious", "query": "from:mybank.com newer_than:7d"}},
+	}
+}
+
+func (t *GmailTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "digest":
+		return t.digest(ctx, args)
+	case "send":
+		return t.send(ctx, args)
+	case "aliases":
+		return t.aliases(ctx)
+	case "outbox":
+		return t.queued(ctx)
+	case "triage_suspicious":
+		return t.triage(ctx, args)
+	case "export_pdf":
+		return t.exportPDF(ctx, args)
+	}
+	emailID, _ := args["email_id"].(string)
+	emailID = strings.TrimPrefix(strings.TrimSpace(emailID), "email_id=")
+	if emailID == "" {
+		return ErrorResult("email_id is required")
+	}
+
+	switch action {
+	case "attachments":
+		msg, err := t.gmail.GetMessage(ctx, emailID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the email: %v", err)).WithError(err)
+		}
+		noteMentions(ctx, personMention(msg.From))
+		if len(msg.Attachments) == 0 {
+			return SilentResult(fmt.Sprintf("%q has no attachments.", msg.Subject))
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Attachments of %q from %s:", msg.Subject, msg.From)
+		for i, att := range msg.Attachments {
+			fmt.Fprintf(&sb, "\n%d. %s (%s, %s)", i+1, att.Filename, att.MimeType, formatFileSize(int64(att.Size)))
+			var blocked *screening.BlockedError
+			if err := screening.Check(att.Filename, int64(att.Size)); errors.As(err, &blocked) {
+				sb.WriteString(" - cannot be saved: " + blocked.Reason)
+			}
+		}
+		return SilentResult(sb.String())
+	case "save_to_drive":
+		return t.saveToDrive(ctx, emailID, args)
+	case "reply":
+		return t.reply(ctx, emailID, args)
+	case "unsubscribe":
+		return t.unsubscribe(ctx, emailID, args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *GmailTool) digest(ctx context.Context, args map[string]interface{}) *ToolResult {
+	since, _ := args["since"].(string)
+	since = strings.TrimSpace(since)
+	from, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		if since == "" {
+			since = "24h"
+		}
+		if from, err = ParseAuditSince(since, time.Now()); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	digest, err := t.gmail.Digest(ctx, from)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the inbox: %v", err)).WithError(err)
+	}
+	return SilentResult(FormatEmailDigest(digest, time.Local, LocaleFromContext(ctx), 0))
+}
+
+func (t *GmailTool) aliases(ctx context.Context) *ToolResult {
+	addresses, err := t.gmail.SendAs(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the send-as addresses: %v", err)).WithError(err)
+	}
+	var sb strings.Builder
+	sb.WriteString("The user can send from:")
+	for _, a := range addresses {
+		fmt.Fprintf(&sb, "\n- %s", a)
+		if a.Default {
+			sb.WriteString(" (default)")
+		}
+		if a.ReplyTo != "" {
+			fmt.Fprintf(&sb, ", replies to %s", a.ReplyTo)
+		}
+		if !a.Verified {
+			sb.WriteString(" (not verified, cannot be used)")
+		}
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *GmailTool) send(ctx context.Context, args map[string]interface{}) *ToolResult {
+	to, missing, err := t.recipients(ctx, args, "to")
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if len(to) == 0 {
+		return ErrorResult("to is required for send")
+	}
+	cc, missingCc, err := t.recipients(ctx, args, "cc")
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	subject, _ := args["subject"].(string)
+	body, _ := args["body"].(string)
+	if strings.TrimSpace(subject) == "" && strings.TrimSpace(body) == "" {
+		return ErrorResult("subject or body is required for send")
+	}
+	from, err := t.sender(ctx, args, nil)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	result := t.deliver(ctx, OutgoingEmail{From: from, To: to, Cc: cc, Subject: strings.TrimSpace(subject), Body: body})
+	return noteMissingRecipients(result, append(missing, missingCc...))
+}
+
+// noteMissingRecipients tells the model which group members an email did
+// not go to for having no address.
+func noteMissingRecipients(result *ToolResult, missing []string) *ToolResult {
+	if len(missing) > 0 && !result.IsError {
+		result.ForLLM += fmt.Sprintf(" Left out %s: no email address saved in their contact group.", strings.Join(missing, ", "))
+	}
+	return result
+}
+
+func (t *GmailTool) reply(ctx context.Context, emailID string, args map[string]interface{}) *ToolResult {
+	body, _ := args["body"].(string)
+	if strings.TrimSpace(body) == "" {
+		return ErrorResult("body is required for reply")
+	}
+	cc, missing, err := t.recipients(ctx, args, "cc")
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	msg, err := t.gmail.GetMessage(ctx, emailID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the email: %v", err)).WithError(err)
+	}
+	to := msg.ReplyTo
+	if to == "" {
+		to = msg.From
+	}
+	from, err := t.sender(ctx, args, msg)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	result := t.deliver(ctx, OutgoingEmail{
+		From:       from,
+		To:         []string{to},
+		Cc:         cc,
+		Subject:    replySubject(msg.Subject),
+		Body:       body,
+		InReplyTo:  msg.MessageID,
+		References: strings.TrimSpace(msg.References + " " + msg.MessageID),
+		ThreadID:   msg.ThreadID,
+	})
+	return noteMissingRecipients(result, missing)
+}
+
+// sender picks the address to send from: from_alias, checked against the
+// account's send-as addresses, or for a reply to original the address it
+// was sent to, or else the default address.
+func (t *GmailTool) sender(ctx context.Context, args map[string]interface{}, original *GmailMessage) (SendAsAddress, error) {
+	alias, _ := args["from_alias"].(string)
+	addresses, err := t.gmail.SendAs(ctx)
+	if err != nil && t.outbox != nil && retryableSend(err) {
+		// Offline: queue from the address given, which Gmail checks when
+		// the email is finally sent
+		if strings.TrimSpace(alias) == "" {
+			return SendAsAddress{}, nil
+		}
+		if addr, perr := mail.ParseAddress(alias); perr == nil {
+			return SendAsAddress{Email: addr.Address, DisplayName: addr.Name, Verified: true}, nil
+		}
+	}
+	if err != nil {
+		return SendAsAddress{}, fmt.Errorf("failed to read the send-as addresses: %w", err)
+	}
+	if strings.TrimSpace(alias) == "" && original != nil {
+		if a, ok := replyFrom(addresses, original); ok {
+			return a, nil
+		}
+	}
+	return pickSendAs(addresses, alias)
+}
+
+func (t *GmailTool) deliver(ctx context.Context, email OutgoingEmail) *ToolResult {
+	for _, addr := range append(email.To, email.Cc...) {
+		noteMentions(ctx, personMention(addr))
+	}
+	if _, _, err := t.gmail.Send(ctx, email); err != nil {
+		if t.outbox == nil || !retryableSend(err) {
+			return ErrorResult(fmt.Sprintf("failed to send the email: %v", err)).WithError(err)
+		}
+		if _, qerr := t.outbox.Queue(ctx, email, err); qerr != nil {
+			return ErrorResult(fmt.Sprintf("failed to send the email (%v) and could not queue it: %v", err, qerr)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Gmail is unreachable right now (%v), so %s is queued in the outbox. It will be retried with increasing waits and the user will be told when it goes out or if it cannot be sent.",
+			err, describeOutgoing(email)))
+	}
+	from := email.From.Email
+	if from == "" {
+		from = "the default address"
+	}
+	return SilentResult(fmt.Sprintf("Sent %q from %s to %s.", email.Subject, from, strings.Join(append(email.To, email.Cc...), ", ")))
+}
+
+func (t *GmailTool) queued(ctx context.Context) *ToolResult {
+	if t.outbox == nil {
+		return SilentResult("No outbox is set up; emails are sent right away or fail.")
+	}
+	items, err := t.outbox.Queued(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the outbox: %v", err)).WithError(err)
+	}
+	if len(items) == 0 {
+		return SilentResult("No emails are waiting to be sent.")
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d email(s) waiting to be sent:", len(items))
+	for _, item := range items {
+		fmt.Fprintf(&sb, "\n- %s, queued %s, next try %s", item.Summary,
+			item.CreatedAt.Format("2 Jan 15:04"), item.NextAttempt.Format("15:04"))
+		if item.LastError != "" {
+			fmt.Fprintf(&sb, " (last error: %s)", item.LastError)
+		}
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *GmailTool) saveToDrive(ctx context.Context, emailID string, args map[string]interface{}) *ToolResult {
+	msg, err := t.gmail.GetMessage(ctx, emailID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the email: %v", err)).WithError(err)
+	}
+	which, _ := args["attachment"].(string)
+	selected, err := pickAttachments(msg.Attachments, which)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	if name != "" && len(selected) > 1 {
+		return ErrorResult("name can only be given when saving one attachment")
+	}
+
+	folder, _ := args["folder"].(string)
+	folderID, folderName, err := t.resolveFolder(ctx, folder)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to find the Drive folder: %v", err)).WithError(err)
+	}
+
+	var sb strings.Builder
+	saved := 0
+	for _, att := range selected {
+		fileName := att.Filename
+		if name != "" {
+			fileName = name
+		}
+		file, err := t.saveAttachment(ctx, emailID, att, folderID, fileName)
+		if err != nil {
+			fmt.Fprintf(&sb, "Could not save %s: %v\n", att.Filename, err)
+			continue
+		}
+		saved++
+		fmt.Fprintf(&sb, "Saved %s to %s: drive_file_id=%s %s\n", file.Name, folderName, file.ID, file.WebViewLink)
+	}
+	if saved == 0 {
+		return ErrorResult(strings.TrimSpace(sb.String()))
+	}
+	return SilentResult(strings.TrimSpace(sb.String()))
+}
+
+func (t *GmailTool) saveAttachment(ctx context.Context, emailID string, att GmailAttachment, folderID, name string) (*DriveFile, error) {
+	data, err := t.gmail.DownloadAttachment(ctx, emailID, att)
+	if err != nil {
+		return nil, err
+	}
+	return t.drive.Upload(ctx, folderID, name, att.MimeType, data)
+}
+
+// pickAttachments selects attachments by file name or 1-based number, or
+// all of them when which is empty.
+func pickAttachments(atts []GmailAttachment, which string) ([]GmailAttachment, error) {
+	if len(atts) == 0 {
+		return nil, fmt.Errorf("the email has no attachments")
+	}
+	which = strings.TrimSpace(which)
+	if which == "" {
+		return atts, nil
+	}
+	if n, err := strconv.Atoi(which); err == nil {
+		if n < 1 || n > len(atts) {
+			return nil, fmt.Errorf("the email has %d attachment(s); there is no number %d", len(atts), n)
+		}
+		return atts[n-1 : n], nil
+	}
+	for _, att := range atts {
+		if strings.EqualFold(att.Filename, which) {
+			return []GmailAttachment{att}, nil
+		}
+	}
+	names := make([]string, len(atts))
+	for i, att := range atts {
+		names[i] = att.Filename
+	}
+	return nil, fmt.Errorf("no attachment named %q; the email has: %s", which, strings.Join(names, ", "))
+}
+
+// resolveFolder turns a folder argument into a Drive folder ID and a name
+// to report: an ID is used as is, a path is found or created one level at
+// a time.
+func (t *GmailTool) resolveFolder(ctx context.Context, folder string) (id, name string, err error) {
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+	switch {
+	case folder == "":
+		return "", "My Drive", nil
+	case driveIDPattern.MatchString(folder):
+		return folder, "folder " + folder, nil
+	}
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		f, err := t.drive.EnsureFolder(ctx, id, part)
+		if err != nil {
+			return "", "", err
+		}
+		id = f.ID
+	}
+	return id, folder, nil
+}
+
+// formatFileSize renders a size in bytes for a chat: "340 KB", "2.4 MB".
+func formatFileSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,303 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/screening"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestGmailTool_SaveToDrive verifies an attachment is copied into a Drive folder path, created as needed, and its ID and link returned
+func TestGmailTool_SaveToDrive(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	id := g.AddEmail(testkit.Email{
+		From:    "billing@power.example",
+		Subject: "Your March bill",
+		Body:    "Attached.",
+		Attachments: []testkit.Attachment{
+			{Filename: "logo.png", MimeType: "image/png", Data: []byte("\x89PNG")},
+			{Filename: "bill-march.pdf", MimeType: "application/pdf", Data: []byte("%PDF-1.7 bill")},
+		},
+	})
+	tool := NewGmailTool(testkit.Token)
+	ctx := context.Background()
+
+	list := tool.Execute(ctx, map[string]interface{}{"action": "attachments", "email_id": id})
+	if list.IsError || !strings.Contains(list.ForLLM, "2. bill-march.pdf (application/pdf") {
+		t.Fatalf("unexpected list: %s", list.ForLLM)
+	}
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "save_to_drive", "email_id": "email_id=" + id, "attachment": "2", "folder": "Bills/2026"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	folders := map[string]testkit.File{}
+	var saved *testkit.File
+	for _, f := range g.Files() {
+		if f.MimeType == "application/vnd.google-apps.folder" {
+			folders[f.Name] = f
+		} else {
+			f := f
+			saved = &f
+		}
+	}
+	if saved == nil || saved.Name != "bill-march.pdf" || string(saved.Content) != "%PDF-1.7 bill" {
+		t.Fatalf("attachment not saved: %+v", saved)
+	}
+	if folders["2026"].Parent != folders["Bills"].ID || saved.Parent != folders["2026"].ID {
+		t.Errorf("saved outside Bills/2026: %+v %+v", folders, saved)
+	}
+	if !strings.Contains(result.ForLLM, "drive_file_id="+saved.ID) || !strings.Contains(result.ForLLM, "https://drive.google.com/file/d/"+saved.ID) {
+		t.Errorf("ID or link missing: %s", result.ForLLM)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "save_to_drive", "email_id": id, "attachment": "invoice.pdf"}); !r.IsError || !strings.Contains(r.ForLLM, "logo.png, bill-march.pdf") {
+		t.Errorf("unknown attachment not reported: %s", r.ForLLM)
+	}
+}
+
+// TestGmailTool_SaveToDriveScreened verifies attachments the screening policy holds back are flagged in the listing and not copied to Drive, while the rest are
+func TestGmailTool_SaveToDriveScreened(t *testing.T) {
+	previous := screening.Current()
+	screening.SetPolicy(screening.Policy{MaxBytes: 1 << 20, Block: []string{".exe"}})
+	defer screening.SetPolicy(previous)
+	g := testkit.NewGoogle(t)
+	g.Install()
+	id := g.AddEmail(testkit.Email{
+		From:    "Courier <track@parcel.example>",
+		Subject: "Your parcel",
+		Attachments: []testkit.Attachment{
+			{Filename: "label.pdf.exe", MimeType: "application/octet-stream", Data: []byte("MZ")},
+			{Filename: "photos.zip", MimeType: "application/zip", Data: make([]byte, 2<<20)},
+			{Filename: "label.pdf", MimeType: "application/pdf", Data: []byte("%PDF-1.7 label")},
+		},
+	})
+	tool := NewGmailTool(testkit.Token)
+	ctx := context.Background()
+
+	list := tool.Execute(ctx, map[string]interface{}{"action": "attachments", "email_id": id})
+	if !strings.Contains(list.ForLLM, "label.pdf.exe (application/octet-stream, 2 bytes) - cannot be saved: .exe files are blocked") ||
+		!strings.Contains(list.ForLLM, "cannot be saved: it is larger than the 1 MB limit") || strings.Contains(list.ForLLM, "label.pdf (application/pdf, 14 bytes) -") {
+		t.Errorf("unexpected list: %s", list.ForLLM)
+	}
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "save_to_drive", "email_id": id})
+	if result.IsError || !strings.Contains(result.ForLLM, "Could not save label.pdf.exe") || !strings.Contains(result.ForLLM, "Could not save photos.zip") {
+		t.Fatalf("unexpected result: %s", result.ForLLM)
+	}
+	var saved []string
+	for _, f := range g.Files() {
+		saved = append(saved, f.Name)
+	}
+	if len(saved) != 1 || saved[0] != "label.pdf" {
+		t.Errorf("saved %v, want only label.pdf", saved)
+	}
+}
+
+// TestGmailTool_Digest verifies unread mail is grouped by conversation, ranked by labels and heuristics, and given suggested actions
+func TestGmailTool_Digest(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Now()
+	unread := func(labels ...string) []string { return append([]string{"INBOX", "UNREAD"}, labels...) }
+	g.AddEmail(testkit.Email{From: "Old <old@example.com>", Subject: "Last week", Date: now.Add(-72 * time.Hour), Labels: unread()})
+	g.AddEmail(testkit.Email{From: "Read <read@example.com>", Subject: "Already seen", Date: now.Add(-time.Hour), Labels: []string{"INBOX"}})
+	g.AddEmail(testkit.Email{From: "Shop <deals@shop.example>", Subject: "50% off", Date: now.Add(-5 * time.Hour), Labels: unread("CATEGORY_PROMOTIONS")})
+	g.AddEmail(testkit.Email{From: "Shop <deals@shop.example>", Subject: "Last chance", Date: now.Add(-2 * time.Hour), Labels: unread("CATEGORY_PROMOTIONS")})
+	g.AddEmail(testkit.Email{From: "GitHub <notifications@github.com>", Subject: "New issue opened", Date: now.Add(-4 * time.Hour), Labels: unread("CATEGORY_UPDATES")})
+	g.AddEmail(testkit.Email{From: "Ana <ana@example.com>", Subject: "Dinner on Friday?", Thread: "t-ana", Date: now.Add(-6 * time.Hour), Labels: unread("IMPORTANT")})
+	latest := g.AddEmail(testkit.Email{From: "Ana <ana@example.com>", Subject: "Re: Dinner on Friday?", Thread: "t-ana", Date: now.Add(-3 * time.Hour), Labels: unread("IMPORTANT")})
+	g.AddEmail(testkit.Email{From: "Landlord <rent@flat.example>", Subject: "Rent payment due", Date: now.Add(-time.Hour), Labels: unread()})
+	tool := NewGmailTool(testkit.Token)
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "digest", "since": "1d"})
+	if r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	lines := strings.Split(r.ForLLM, "\n")
+	want := []string{
+		"6 unread email(s) in 4 conversation(s)",
+		"1. Ana: Re: Dinner on Friday? (2 messages) → reply [email_id=" + latest + "]",
+		"2. Landlord: Rent payment due → read",
+		"Can be archived: 3 email(s) from GitHub, Shop",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected digest:\n%s", r.ForLLM)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("line %d = %q, want %q", i, lines[i], w)
+		}
+	}
+}
+
+// TestGmailTool_SendAs verifies mail goes out from a requested alias with its Reply-To, unknown aliases are refused, and replies default to the alias the email was sent to
+func TestGmailTool_SendAs(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.AddSendAs(testkit.SendAs{Email: "ana@gmail.example", DisplayName: "Ana Souza", Default: true})
+	g.AddSendAs(testkit.SendAs{Email: "ana@studio.example", DisplayName: "Ana at Studio", ReplyTo: "hello@studio.example"})
+	g.AddSendAs(testkit.SendAs{Email: "old@studio.example", Unverified: true})
+	tool := NewGmailTool(testkit.Token)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action": "send", "to": []interface{}{"client@example.com"}, "subject": "Orçamento", "body": "Segue o orçamento.", "from_alias": "Ana at Studio",
+	})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	sent := g.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	raw := string(sent[0].Raw)
+	if !strings.Contains(raw, "From: \"Ana at Studio\" <ana@studio.example>") || !strings.Contains(raw, "Reply-To: hello@studio.example") {
+		t.Errorf("alias headers missing:\n%s", raw)
+	}
+	if sent[0].Subject != "Orçamento" || sent[0].To != "<client@example.com>" {
+		t.Errorf("unexpected message: %+v", sent[0])
+	}
+
+	for _, alias := range []string{"someone@else.example", "old@studio.example"} {
+		r := tool.Execute(ctx, map[string]interface{}{"action": "send", "to": "client@example.com", "body": "hi", "from_alias": alias})
+		if !r.IsError {
+			t.Errorf("sending from %s was not refused", alias)
+		}
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "send", "to": "mom", "body": "hi"}); !r.IsError || !strings.Contains(r.ForLLM, "contacts") {
+		t.Errorf("a name as recipient was not refused: %s", r.ForLLM)
+	}
+
+	id := g.AddEmail(testkit.Email{
+		From: "Client <client@example.com>", To: "ana@studio.example", Subject: "Question", Body: "Can we meet?",
+		Thread: "thread-7", MessageID: "<q1@example.com>",
+	})
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "reply", "email_id": id, "body": "Sure, Friday?"}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	sent = g.Sent()
+	reply := sent[len(sent)-1]
+	raw = string(reply.Raw)
+	if !strings.Contains(raw, "<ana@studio.example>") || !strings.Contains(raw, "In-Reply-To: <q1@example.com>") {
+		t.Errorf("reply not sent from the addressed alias in the conversation:\n%s", raw)
+	}
+	if reply.Thread != "thread-7" || reply.Subject != "Re: Question" {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+}
+
+// TestGmailTool_Unsubscribe verifies one-click links are posted, mailto links emailed, page-only links handed back, and future mail filtered on request
+func TestGmailTool_Unsubscribe(t *testing.T) {
+	var posted string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPost && r.Header.Get("Cookie") == "" {
+			posted = r.URL.Path + " " + string(body)
+		}
+	}))
+	defer srv.Close()
+	g := testkit.NewGoogle(t)
+	g.Install()
+	tool := NewGmailTool(testkit.Token)
+	tool.links = srv.Client()
+	ctx := context.Background()
+
+	id := g.AddEmail(testkit.Email{
+		From: "Shop <news@shop.example>", Subject: "Sale!",
+		ListUnsubscribe:     "<mailto:leave@shop.example?subject=stop>, <" + srv.URL + "/unsub/42>",
+		ListUnsubscribePost: "List-Unsubscribe=One-Click",
+	})
+	result := tool.Execute(ctx, map[string]interface{}{"action": "unsubscribe", "email_id": id, "archive_future": true})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if posted != "/unsub/42 List-Unsubscribe=One-Click" {
+		t.Errorf("one-click request = %q", posted)
+	}
+	if len(g.Sent()) != 0 {
+		t.Error("an email was sent although one-click was offered")
+	}
+	filters := g.Filters()
+	if len(filters) != 1 || filters[0].From != "news@shop.example" || len(filters[0].RemoveLabels) != 1 || filters[0].RemoveLabels[0] != "INBOX" {
+		t.Errorf("unexpected filters: %+v", filters)
+	}
+
+	id = g.AddEmail(testkit.Email{From: "list@club.example", Subject: "Weekly", ListUnsubscribe: "<mailto:leave@club.example?subject=stop>, <https://club.example/leave>"})
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "unsubscribe", "email_id": id}); result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if sent := g.Sent(); len(sent) != 1 || !strings.Contains(sent[0].To, "leave@club.example") || sent[0].Subject != "stop" {
+		t.Errorf("unexpected unsubscribe email: %+v", sent)
+	}
+
+	id = g.AddEmail(testkit.Email{From: "news@paper.example", Subject: "Today", ListUnsubscribe: "<https://paper.example/prefs>"})
+	result = tool.Execute(ctx, map[string]interface{}{"action": "unsubscribe", "email_id": id})
+	if result.IsError || !strings.Contains(result.ForLLM, "https://paper.example/prefs") {
+		t.Errorf("expected the page link handed back, got: %s", result.ForLLM)
+	}
+
+	id = g.AddEmail(testkit.Email{From: "friend@example.com", Subject: "Hi"})
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "unsubscribe", "email_id": id}); !result.IsError {
+		t.Errorf("expected an error for personal mail, got: %s", result.ForLLM)
+	}
+}
+
+// TestGmailTool_TriageSuspicious verifies failed authentication, a foreign Reply-To and a disguised link rate a message high risk and move it to spam, while signed mail from the sender's own domain stays put
+func TestGmailTool_TriageSuspicious(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	tool := NewGmailTool(testkit.Token)
+	ctx := context.Background()
+
+	phish := g.AddEmail(testkit.Email{
+		From:    "PayPal <service@paypa1-support.example>",
+		Subject: "Your account has been suspended",
+		Body:    "Verify your account within 24 hours.",
+		HTML:    `<p>Verify your account within 24 hours: <a href="http://198.51.100.7/login">paypal.com/login</a></p>`,
+		Headers: map[string]string{
+			"Reply-To":               "recovery@mailbox.example",
+			"Authentication-Results": "mx.google.com; spf=fail smtp.mailfrom=paypa1-support.example; dkim=none; dmarc=fail header.from=paypa1-support.example",
+		},
+	})
+	legit := g.AddEmail(testkit.Email{
+		From:    "Bank <alerts@mybank.example>",
+		Subject: "Your statement is ready",
+		HTML:    `<p>See <a href="https://www.mybank.example/statements">your statement</a>.</p>`,
+		Headers: map[string]string{
+			"Return-Path":            "<bounces@mail.mybank.example>",
+			"Authentication-Results": "mx.google.com; spf=pass smtp.mailfrom=mail.mybank.example; dkim=pass header.i=@mybank.example; dmarc=pass header.from=mybank.example",
+		},
+	})
+
+	args := map[string]interface{}{"action": "triage_suspicious", "email_id": phish + ", " + legit, "move_to_spam": true}
+	if !tool.Mutates(args) || !tool.Untrusted(args) {
+		t.Error("expected moving to spam to count as a change and the report as untrusted")
+	}
+	result := tool.Execute(ctx, args)
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	report := result.ForLLM
+	for _, want := range []string{"1 high, 0 medium, 1 low risk", "DMARC failed", "replies go to recovery@mailbox.example", "a link shows paypal.com but goes to", "moved to spam"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in the report:\n%s", want, report)
+		}
+	}
+	if strings.Index(report, phish) > strings.Index(report, legit) {
+		t.Errorf("expected the riskiest message first:\n%s", report)
+	}
+	if labels := g.Labels(phish); len(labels) != 1 || labels[0] != "SPAM" {
+		t.Errorf("phishing labels = %v, want [SPAM]", labels)
+	}
+	if labels := g.Labels(legit); labels != nil {
+		t.Errorf("legitimate mail was moved: %v", labels)
+	}
+}
@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultTriageQuery is what triage_suspicious looks at without an
+	// email_id or query: recent unread inbox mail
+	defaultTriageQuery = "in:inbox is:unread newer_than:3d"
+	defaultTriageLimit = 10
+	maxTriageLimit     = 30
+	// triageHighRisk and triageMediumRisk are the scores from which a
+	// message is rated high or medium risk
+	triageHighRisk   = 6
+	triageMediumRisk = 3
+)
+
+var (
+	// authVerdictPattern finds the spf=, dkim= and dmarc= verdicts of an
+	// Authentication-Results header
+	authVerdictPattern = regexp.MustCompile(`(?i)\b(spf|dkim|dmarc)=([a-z]+)`)
+	// anchorPattern finds the links of an HTML body with their text
+	anchorPattern = regexp.MustCompile(`(?is)<a\s[^>]*?href\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+	// textURLPattern finds bare URLs in plain text
+	textURLPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'()\[\]]+`)
+	// shownURLPattern matches link text that is itself an address, such
+	// as "paypal.com/login" or "https://www.mybank.com"
+	shownURLPattern = regexp.MustCompile(`(?i)^(?:https?://)?((?:[a-z0-9-]+\.)+[a-z]{2,})(?:[/:?#]\S*)?$`)
+	// nameAddressPattern finds an address in a sender's display name
+	nameAddressPattern = regexp.MustCompile(`(?i)[^\s@<>"]+@((?:[a-z0-9-]+\.)+[a-z]{2,})`)
+	tagPattern         = regexp.MustCompile(`<[^>]*>`)
+)
+
+// urlShorteners hide where a link goes.
+var urlShorteners = []string{"bit.ly", "tinyurl.com", "t.co", "goo.gl", "is.gd", "ow.ly", "buff.ly", "rebrand.ly", "cutt.ly", "shorturl.at"}
+
+// riskyAttachmentExts are attachment types that run code or open a page
+// when clicked, which real invoices and statements never are.
+var riskyAttachmentExts = []string{".exe", ".scr", ".js", ".vbs", ".bat", ".cmd", ".com", ".jar", ".msi", ".hta", ".lnk", ".iso", ".img", ".html", ".htm", ".svg"}
+
+// pressurePhrases are the urgent asks phishing mail leans on.
+var pressurePhrases = []string{"verify your account", "confirm your identity", "account will be suspended", "account has been suspended",
+	"unusual sign-in", "password expires", "update your payment", "gift card", "wire transfer", "act now", "within 24 hours", "final notice"}
+
+// Modify adds and removes labels of a message; moving it to spam is
+// adding SPAM and removing INBOX. It needs the gmail.modify scope.
+func (c *GmailClient) Modify(ctx context.Context, id string, add, remove []string) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{"addLabelIds": add, "removeLabelIds": remove}
+	return doJSONRequest(ctx, c.client, http.MethodPost, c.baseURL+"/users/me/messages/"+url.PathEscape(id)+"/modify",
+		map[string]string{"Authorization": "Bearer " + token}, payload, nil)
+}
+
+// phishingAssessment is the verdict on one message: a score and the
+// reasons behind it.
+type phishingAssessment struct {
+	Score   int
+	Reasons []string
+}
+
+func (a *phishingAssessment) add(points int, reason string) {
+	a.Score += points
+	a.Reasons = append(a.Reasons, reason)
+}
+
+// Risk rates the score as "high", "medium" or "low".
+func (a phishingAssessment) Risk() string {
+	switch {
+	case a.Score >= triageHighRisk:
+		return "high"
+	case a.Score >= triageMediumRisk:
+		return "medium"
+	}
+	return "low"
+}
+
+// assessPhishing scores a message on what its headers and links give
+// away: failed SPF, DKIM or DMARC checks, replies or bounces that go to
+// another domain than the sender's, and links to raw IP addresses,
+// punycode look-alikes, shorteners or a domain other than the one the
+// link text shows. It reads no more than the message, so the verdict is
+// a hint for the user rather than a filter.
+func assessPhishing(msg *GmailMessage) phishingAssessment {
+	var a phishingAssessment
+	sender := emailDomain(msg.From)
+
+	verdicts := map[string]string{}
+	if len(msg.AuthResults) > 0 {
+		// The newest header is the receiving server's; older ones can be
+		// forged by the sender
+		for _, m := range authVerdictPattern.FindAllStringSubmatch(msg.AuthResults[0], -1) {
+			check := strings.ToLower(m[1])
+			if _, seen := verdicts[check]; !seen {
+				verdicts[check] = strings.ToLower(m[2])
+			}
+		}
+	}
+	switch verdicts["dmarc"] {
+	case "fail":
+		a.add(4, "DMARC failed: the sender's domain does not vouch for this message")
+	case "", "none":
+		if verdicts["spf"] != "pass" && verdicts["dkim"] != "pass" {
+			a.add(1, "no passing SPF, DKIM or DMARC check")
+		}
+	}
+	switch verdicts["spf"] {
+	case "fail":
+		a.add(2, "SPF failed: sent from a server the sender's domain does not allow")
+	case "softfail":
+		a.add(1, "SPF soft-failed")
+	}
+	if verdicts["dkim"] == "fail" {
+		a.add(2, "DKIM failed: the signature does not match, so the message may have been altered")
+	}
+
+	if msg.ReplyTo != "" && sender != "" {
+		if domain := emailDomain(msg.ReplyTo); domain != "" && !sameSite(domain, sender) {
+			a.add(3, fmt.Sprintf("replies go to %s, not to the sender's domain %s", msg.ReplyTo, sender))
+		}
+	}
+	if msg.ReturnPath != "" && sender != "" && verdicts["dmarc"] != "pass" {
+		if domain := emailDomain(msg.ReturnPath); domain != "" && !sameSite(domain, sender) {
+			a.add(1, fmt.Sprintf("bounces go to %s, not to %s", domain, sender))
+		}
+	}
+	if addr, err := mail.ParseAddress(msg.From); err == nil && addr.Name != "" {
+		// "service@paypal.com <x@evil.example>"
+		if m := nameAddressPattern.FindStringSubmatch(addr.Name); m != nil && !sameSite(strings.ToLower(m[1]), sender) {
+			a.add(3, fmt.Sprintf("the sender's name shows %s but the address is at %s", m[0], sender))
+		}
+	}
+
+	a.assessLinks(msg, sender)
+
+	for _, att := range msg.Attachments {
+		ext := strings.ToLower(path.Ext(att.Filename))
+		for _, risky := range riskyAttachmentExts {
+			if ext == risky {
+				a.add(3, fmt.Sprintf("attachment %s can run code or open a page when clicked", att.Filename))
+				break
+			}
+		}
+	}
+
+	text := strings.ToLower(msg.Subject + "\n" + msg.Text)
+	pressure := 0
+	for _, phrase := range pressurePhrases {
+		if strings.Contains(text, phrase) && pressure < 2 {
+			a.add(1, fmt.Sprintf("pressures the reader (%q)", phrase))
+			pressure++
+		}
+	}
+	return a
+}
+
+// assessLinks scores the message's links, each problem once.
+func (a *phishingAssessment) assessLinks(msg *GmailMessage, sender string) {
+	type link struct{ href, text string }
+	var links []link
+	for _, m := range anchorPattern.FindAllStringSubmatch(msg.HTML, -1) {
+		text := strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(m[2], "")))
+		links = append(links, link{html.UnescapeString(m[1]), text})
+	}
+	if msg.HTML == "" {
+		for _, u := range textURLPattern.FindAllString(msg.Text, -1) {
+			links = append(links, link{href: u})
+		}
+	}
+
+	seen := map[string]bool{}
+	flag := func(points int, reason string) {
+		if !seen[reason] {
+			seen[reason] = true
+			a.add(points, reason)
+		}
+	}
+	foreign := map[string]bool{}
+	for _, l := range links {
+		u, err := url.Parse(l.href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if m := shownURLPattern.FindStringSubmatch(l.text); m != nil && !sameSite(strings.ToLower(m[1]), host) {
+			flag(3, fmt.Sprintf("a link shows %s but goes to %s", m[1], host))
+		}
+		if net.ParseIP(host) != nil {
+			flag(3, fmt.Sprintf("links to a bare IP address (%s)", host))
+			continue
+		}
+		if strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--") {
+			flag(2, fmt.Sprintf("links to an internationalized domain that can imitate another (%s)", host))
+		}
+		for _, s := range urlShorteners {
+			if host == s {
+				flag(1, fmt.Sprintf("hides a link behind the shortener %s", host))
+			}
+		}
+		if sender != "" && !sameSite(host, sender) {
+			foreign[baseDomain(host)] = true
+		}
+	}
+	if len(foreign) > 0 {
+		domains := make([]string, 0, len(foreign))
+		for d := range foreign {
+			domains = append(domains, d)
+		}
+		sort.Strings(domains)
+		a.Reasons = append(a.Reasons, fmt.Sprintf("links go to %s (sender: %s)", strings.Join(domains, ", "), sender))
+	}
+}
+
+// emailDomain returns the lowercase domain of an address such as
+// "Ana <ana@example.com>" or "<bounce@mail.example.com>".
+func emailDomain(address string) string {
+	address = strings.TrimSpace(address)
+	if addr, err := mail.ParseAddress(address); err == nil {
+		address = addr.Address
+	}
+	address = strings.Trim(address, "<> ")
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(address[at+1:])
+}
+
+// baseDomain cuts a host down to the domain its owner registered, so
+// mail.example.com and example.com compare equal. Two-letter country
+// domains with a short second level, such as co.uk, keep three labels.
+func baseDomain(host string) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(host), "."), ".")
+	keep := 2
+	if n := len(labels); n >= 3 && len(labels[n-1]) == 2 && len(labels[n-2]) <= 3 {
+		keep = 3
+	}
+	if len(labels) <= keep {
+		return strings.Join(labels, ".")
+	}
+	return strings.Join(labels[len(labels)-keep:], ".")
+}
+
+func sameSite(a, b string) bool {
+	return baseDomain(a) == baseDomain(b)
+}
+
+// triage rates the messages email_id names, or those a search finds,
+// for phishing risk and reports why, riskiest first. With
+// move_to_spam=true, high-risk messages are moved to spam.
+func (t *GmailTool) triage(ctx context.Context, args map[string]interface{}) *ToolResult {
+	var ids []string
+	if emailID, _ := args["email_id"].(string); strings.TrimSpace(emailID) != "" {
+		for _, id := range strings.Split(emailID, ",") {
+			if id = strings.TrimPrefix(strings.TrimSpace(id), "email_id="); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		query, _ := args["query"].(string)
+		if query = strings.TrimSpace(query); query == "" {
+			query = defaultTriageQuery
+		}
+		limit := defaultTriageLimit
+		if l, ok := args["limit"].(float64); ok && l > 0 {
+			limit = min(int(l), maxTriageLimit)
+		}
+		var err error
+		if ids, err = t.gmail.Search(ctx, query, limit); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to search Gmail: %v", err)).WithError(err)
+		}
+		if len(ids) == 0 {
+			return SilentResult(fmt.Sprintf("No messages match %q, so there is nothing to check.", query))
+		}
+	}
+	moveToSpam, _ := args["move_to_spam"].(bool)
+
+	type verdict struct {
+		msg *GmailMessage
+		phishingAssessment
+		moved bool
+		err   error
+	}
+	var verdicts []verdict
+	var failed []string
+	for _, id := range ids {
+		msg, err := t.gmail.GetMessage(ctx, id)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", id, err))
+			continue
+		}
+		v := verdict{msg: msg, phishingAssessment: assessPhishing(msg)}
+		if moveToSpam && v.Risk() == "high" {
+			v.err = t.gmail.Modify(ctx, id, []string{"SPAM"}, []string{"INBOX"})
+			v.moved = v.err == nil
+		}
+		verdicts = append(verdicts, v)
+	}
+	sort.SliceStable(verdicts, func(i, j int) bool { return verdicts[i].Score > verdicts[j].Score })
+
+	var sb strings.Builder
+	counts := map[string]int{}
+	for _, v := range verdicts {
+		counts[v.Risk()]++
+	}
+	fmt.Fprintf(&sb, "Checked %d message(s): %d high, %d medium, %d low risk.", len(verdicts), counts["high"], counts["medium"], counts["low"])
+	for _, v := range verdicts {
+		fmt.Fprintf(&sb, "\n\n%s risk (score %d): %q from %s [email_id=%s]", strings.ToUpper(v.Risk()[:1])+v.Risk()[1:], v.Score, v.msg.Subject, v.msg.From, v.msg.ID)
+		for _, reason := range v.Reasons {
+			fmt.Fprintf(&sb, "\n- %s", reason)
+		}
+		switch {
+		case v.moved:
+			sb.WriteString("\n→ moved to spam")
+		case v.err != nil:
+			fmt.Fprintf(&sb, "\n→ moving to spam failed: %v", v.err)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&sb, "\n\nCould not read: %s", strings.Join(failed, ", "))
+	}
+	if counts["high"] > 0 && !moveToSpam {
+		sb.WriteString("\n\nHigh-risk messages were left where they are; offer to move them to spam (move_to_spam=true with their email_id).")
+	}
+	return SilentResult(sb.String())
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// unsubscribeTargets splits a List-Unsubscribe header ("<mailto:...>,
+// <https://...>") into its mailto and https links. Plain http links are
+// dropped: RFC 8058 wants one-click unsubscribing over https, and a link
+// that only opens a page is given to the user rather than followed.
+func unsubscribeTargets(header string) (mailto, web []*url.URL) {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "<") || !strings.HasSuffix(part, ">") {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(part[1 : len(part)-1]))
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "mailto":
+			if u.Opaque != "" {
+				mailto = append(mailto, u)
+			}
+		case "https":
+			if u.Host != "" {
+				web = append(web, u)
+			}
+		}
+	}
+	return mailto, web
+}
+
+// oneClick reports whether a List-Unsubscribe-Post header offers RFC 8058
+// one-click unsubscribing.
+func oneClick(header string) bool {
+	return strings.EqualFold(strings.ReplaceAll(header, " ", ""), "List-Unsubscribe=One-Click")
+}
+
+// ArchiveFrom creates a filter that skips the inbox for future mail from
+// sender and returns its ID. It needs the gmail.settings.basic scope.
+func (c *GmailClient) ArchiveFrom(ctx context.Context, sender string) (string, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	payload := map[string]interface{}{
+		"criteria": map[string]string{"from": sender},
+		"action":   map[string]interface{}{"removeLabelIds": []string{"INBOX"}},
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	err = doJSONRequest(ctx, c.client, http.MethodPost, c.baseURL+"/users/me/settings/filters",
+		map[string]string{"Authorization": "Bearer " + token}, payload, &resp)
+	return resp.ID, err
+}
+
+// unsubscribe leaves the mailing list email_id came from, the safest way
+// the sender offers: a one-click POST (no cookies, nothing rendered), or
+// else an email to the list's unsubscribe address. A sender that only
+// offers a web page gets its link handed to the user, since such pages
+// can ask for more than a click.
+func (t *GmailTool) unsubscribe(ctx context.Context, emailID string, args map[string]interface{}) *ToolResult {
+	msg, err := t.gmail.GetMessage(ctx, emailID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the email: %v", err)).WithError(err)
+	}
+	if msg.ListUnsubscribe == "" {
+		return ErrorResult(fmt.Sprintf("%q from %s has no List-Unsubscribe header; it is not list mail, or the sender only offers a link in the body", msg.Subject, msg.From))
+	}
+	sender := msg.From
+	if addr, err := mail.ParseAddress(msg.From); err == nil {
+		sender = addr.Address
+	}
+
+	mailto, web := unsubscribeTargets(msg.ListUnsubscribe)
+	var done string
+	switch {
+	case len(web) > 0 && oneClick(msg.ListUnsubscribePost):
+		if err := t.postOneClick(ctx, web[0]); err != nil {
+			return ErrorResult(fmt.Sprintf("unsubscribing from %s failed: %v", sender, err)).WithError(err)
+		}
+		done = fmt.Sprintf("Unsubscribed from %s with its one-click link.", sender)
+	case len(mailto) > 0:
+		email := unsubscribeEmail(mailto[0])
+		if _, _, err := t.gmail.Send(ctx, email); err != nil {
+			return ErrorResult(fmt.Sprintf("sending the unsubscribe email to %s failed: %v", email.To[0], err)).WithError(err)
+		}
+		done = fmt.Sprintf("Sent an unsubscribe request to %s for mail from %s; lists usually stop within a few days.", email.To[0], sender)
+	case len(web) > 0:
+		done = fmt.Sprintf("%s only offers an unsubscribe page, which may ask for confirmation, so it was not opened. Give the user this link: %s", sender, web[0])
+	default:
+		return ErrorResult(fmt.Sprintf("the List-Unsubscribe header of %q has no usable link: %s", msg.Subject, msg.ListUnsubscribe))
+	}
+
+	if archive, _ := args["archive_future"].(bool); archive {
+		if _, err := t.gmail.ArchiveFrom(ctx, sender); err != nil {
+			return ErrorResult(fmt.Sprintf("%s But the filter archiving future mail from %s could not be created: %v", done, sender, err)).WithError(err)
+		}
+		done += fmt.Sprintf(" Future mail from %s will skip the inbox.", sender)
+	}
+	return SilentResult(done)
+}
+
+// postOneClick sends the RFC 8058 one-click request.
+func (t *GmailTool) postOneClick(ctx context.Context, u *url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader("List-Unsubscribe=One-Click"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.links.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %d", u.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// unsubscribeEmail builds the email a mailto: unsubscribe link asks for,
+// with the subject and body it names, if any.
+func unsubscribeEmail(u *url.URL) OutgoingEmail {
+	to, _ := url.PathUnescape(u.Opaque)
+	q, _ := url.ParseQuery(u.RawQuery)
+	subject := q.Get("subject")
+	if subject == "" {
+		subject = "unsubscribe"
+	}
+	return OutgoingEmail{To: []string{to}, Subject: subject, Body: q.Get("body")}
+}
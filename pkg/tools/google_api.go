@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxGoogleAPIResponse bounds the response text the model gets.
+const maxGoogleAPIResponse = 16000
+
+// GoogleAPIEndpoint is a Google REST endpoint google_api may call: a
+// method and a URL template in which {name} stands for one path segment,
+// as in OpenAPI paths, e.g.
+// "https://tasks.googleapis.com/tasks/v1/lists/{tasklist}/tasks".
+type GoogleAPIEndpoint struct {
+	Method      string
+	URL         string
+	Description string
+}
+
+// googleAPIRoute is an endpoint compiled for matching.
+type googleAPIRoute struct {
+	GoogleAPIEndpoint
+	host string
+	path *regexp.Regexp
+}
+
+var templateParamPattern = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// compileGoogleAPIEndpoint checks an endpoint and builds its matcher.
+func compileGoogleAPIEndpoint(e GoogleAPIEndpoint) (googleAPIRoute, error) {
+	e.Method = strings.ToUpper(strings.TrimSpace(e.Method))
+	switch e.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return googleAPIRoute{}, fmt.Errorf("endpoint %s: unsupported method %q", e.URL, e.Method)
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Host, ".googleapis.com") || u.RawQuery != "" || u.Fragment != "" {
+		return googleAPIRoute{}, fmt.Errorf("endpoint %q must be an https://*.googleapis.com URL without a query", e.URL)
+	}
+	// {name} matches one segment, or part of one as in "{fileId}:copy";
+	// everything else must match as is
+	pattern, last := "^", 0
+	for _, loc := range templateParamPattern.FindAllStringIndex(u.Path, -1) {
+		pattern += regexp.QuoteMeta(u.Path[last:loc[0]]) + `[^/]+`
+		last = loc[1]
+	}
+	pattern += regexp.QuoteMeta(u.Path[last:]) + "$"
+	return googleAPIRoute{GoogleAPIEndpoint: e, host: u.Host, path: regexp.MustCompile(pattern)}, nil
+}
+
+// GoogleAPITool calls Google REST endpoints the config allows and no
+// others, for features no dedicated tool covers yet. Requests carry the
+// user's Google token, so each URL is checked against the allowed
+// templates segment by segment: no other host, no extra path, no
+// encoded slashes or dot segments smuggled into a parameter.
+type GoogleAPITool struct {
+	token  TokenFunc
+	routes []googleAPIRoute
+	client *http.Client
+}
+
+// NewGoogleAPITool creates the tool for endpoints, failing on one that is
+// not an https://*.googleapis.com URL template with a supported method.
+func NewGoogleAPITool(token TokenFunc, endpoints []GoogleAPIEndpoint) (*GoogleAPITool, error) {
+	t := &GoogleAPITool{token: token, client: newGoogleHTTPClient(30 * time.Second)}
+	for _, e := range endpoints {
+		route, err := compileGoogleAPIEndpoint(e)
+		if err != nil {
+			return nil, err
+		}
+		t.routes = append(t.routes, route)
+	}
+	return t, nil
+}
+
+func (t *GoogleAPITool) Name() string {
+	return "google_api"
+}
+
+// Mutates reports whether the call may change something: anything but
+// GET.
+func (t *GoogleAPITool) Mutates(args map[string]interface{}) bool {
+	method, _ := args["method"].(string)
+	return !strings.EqualFold(strings.TrimSpace(method), http.MethodGet)
+}
+
+func (t *GoogleAPITool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *GoogleAPITool) Description() string {
+	var sb strings.Builder
+	sb.WriteString("Call a Google REST API endpoint directly, for what no other tool covers. Only these endpoints are allowed ({name} is one path segment you fill in; add query parameters such as fields= or pageSize= as needed):")
+	for _, r := range t.routes {
+		fmt.Fprintf(&sb, "\n- %s %s", r.Method, r.URL)
+		if r.Description != "" {
+			sb.WriteString(": " + r.Description)
+		}
+	}
+	sb.WriteString("\nPrefer the dedicated tools when one fits. Only make calls that change something when the user asked for that change.")
+	return sb.String()
+}
+
+func (t *GoogleAPITool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"method": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			},
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "Full URL of an allowed endpoint with its {name} segments filled in, plus any query string",
+			},
+			"body": map[string]interface{}{
+				"type":        "object",
+				"description": "JSON request body (POST, PUT, PATCH)",
+			},
+		},
+		"required": []string{"method", "url"},
+	}
+}
+
+// match returns the endpoint allowing method on u, or an error saying why
+// none does.
+func (t *GoogleAPITool) match(method string, u *url.URL) (*googleAPIRoute, error) {
+	if u.Scheme != "https" || u.User != nil || u.Fragment != "" {
+		return nil, fmt.Errorf("the URL must be a plain https URL")
+	}
+	path := u.EscapedPath()
+	lower := strings.ToLower(path)
+	if strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") || strings.Contains(path, "//") {
+		return nil, fmt.Errorf("the path must not contain encoded slashes or empty segments")
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if s, _ := url.PathUnescape(segment); s == "." || s == ".." {
+			return nil, fmt.Errorf("the path must not contain . or .. segments")
+		}
+	}
+	allowedMethods := false
+	for i, r := range t.routes {
+		if r.host != u.Host || !r.path.MatchString(path) {
+			continue
+		}
+		if r.Method == method {
+			return &t.routes[i], nil
+		}
+		allowedMethods = true
+	}
+	if allowedMethods {
+		return nil, fmt.Errorf("%s is not allowed on %s", method, u.Host+path)
+	}
+	return nil, fmt.Errorf("%s is not one of the allowed endpoints", u.Host+path)
+}
+
+func (t *GoogleAPITool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	method, _ := args["method"].(string)
+	method = strings.ToUpper(strings.TrimSpace(method))
+	rawURL, _ := args["url"].(string)
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid url: %v", err))
+	}
+	if _, err := t.match(method, u); err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	var body io.Reader
+	if payload, ok := args["body"]; ok && payload != nil {
+		if method == http.MethodGet || method == http.MethodDelete {
+			return ErrorResult(fmt.Sprintf("%s requests take no body", method))
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid body: %v", err))
+		}
+		body = bytes.NewReader(data)
+	}
+	token, err := t.token(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("Google authorization failed: %v", err)).WithError(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("request failed: %v", err)).WithError(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*maxGoogleAPIResponse))
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the response: %v", err)).WithError(err)
+	}
+
+	text := strings.TrimSpace(string(data))
+	var compact bytes.Buffer
+	if json.Compact(&compact, data) == nil {
+		text = compact.String()
+	}
+	if len(text) > maxGoogleAPIResponse {
+		text = text[:maxGoogleAPIResponse] + "… (truncated; ask for less with fields= or pageSize=)"
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := &APIError{Status: resp.StatusCode, Body: text}
+		return ErrorResult(fmt.Sprintf("%s %s failed: %v", method, u.Host+u.Path, err)).WithError(err)
+	}
+	if text == "" {
+		text = "(empty response)"
+	}
+	return SilentResult(fmt.Sprintf("%s %s → %d\n%s", method, u.Host+u.Path, resp.StatusCode, text))
+}
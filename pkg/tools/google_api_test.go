@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestGoogleAPITool_AllowedEndpoints verifies calls to configured endpoints go through with their body, and anything else (another path, method or host, or a parameter smuggling in a path) is refused before a request is made
+func TestGoogleAPITool_AllowedEndpoints(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	id := g.AddFile(testkit.File{Name: "Budget.txt", MimeType: "text/plain", Content: []byte("rent")})
+	tool, err := NewGoogleAPITool(testkit.Token, []GoogleAPIEndpoint{
+		{Method: "GET", URL: "https://www.googleapis.com/drive/v3/files/{fileId}", Description: "file metadata"},
+		{Method: "post", URL: "https://www.googleapis.com/drive/v3/files/{fileId}/permissions"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tool.Description(), "GET https://www.googleapis.com/drive/v3/files/{fileId}: file metadata") {
+		t.Errorf("endpoints missing from the description:\n%s", tool.Description())
+	}
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"method": "GET", "url": "https://www.googleapis.com/drive/v3/files/" + id + "?fields=name"})
+	if result.IsError || !strings.Contains(result.ForLLM, "Budget.txt") {
+		t.Fatalf("GET failed:\n%s", result.ForLLM)
+	}
+	args := map[string]interface{}{
+		"method": "POST",
+		"url":    "https://www.googleapis.com/drive/v3/files/" + id + "/permissions",
+		"body":   map[string]interface{}{"type": "user", "role": "reader", "emailAddress": "ana@example.com"},
+	}
+	if !tool.Mutates(args) {
+		t.Error("POST should count as a change")
+	}
+	if result = tool.Execute(ctx, args); result.IsError {
+		t.Fatalf("POST failed:\n%s", result.ForLLM)
+	}
+	if files := g.Files(); len(files) != 1 || len(files[0].SharedWith) != 1 {
+		t.Errorf("expected the file shared with ana, got %+v", files)
+	}
+
+	requests := len(g.Requests())
+	for _, bad := range []struct{ method, url string }{
+		{"GET", "https://www.googleapis.com/drive/v3/files"},
+		{"DELETE", "https://www.googleapis.com/drive/v3/files/" + id},
+		{"GET", "https://gmail.googleapis.com/drive/v3/files/" + id},
+		{"GET", "http://www.googleapis.com/drive/v3/files/" + id},
+		{"GET", "https://www.googleapis.com/drive/v3/files/..%2Fabout"},
+		{"GET", "https://www.googleapis.com/drive/v3/files/.."},
+		{"GET", "https://www.googleapis.com/drive/v3/files/" + id + "/revisions"},
+		{"GET", "https://attacker@www.googleapis.com/drive/v3/files/" + id},
+	} {
+		if result := tool.Execute(ctx, map[string]interface{}{"method": bad.method, "url": bad.url}); !result.IsError {
+			t.Errorf("%s %s was allowed:\n%s", bad.method, bad.url, result.ForLLM)
+		}
+	}
+	if n := len(g.Requests()); n != requests {
+		t.Errorf("refused calls reached Google: %d request(s)", n-requests)
+	}
+
+	if _, err := NewGoogleAPITool(testkit.Token, []GoogleAPIEndpoint{{Method: "GET", URL: "https://example.com/v1/{id}"}}); err == nil {
+		t.Error("an endpoint outside googleapis.com was accepted")
+	}
+}
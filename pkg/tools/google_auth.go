@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// GoogleTokenRefresh replaces an access token Google rejected, returning
+// the new one. stale is the token that was refused, so a caller that lost
+// a race gets the token another caller already refreshed.
+type GoogleTokenRefresh func(ctx context.Context, stale string) (string, error)
+
+var googleRefresh struct {
+	mu sync.RWMutex
+	fn GoogleTokenRefresh
+}
+
+// SetGoogleTokenRefresh sets how Google clients recover from a 401: the
+// token is refreshed and the request retried once. nil turns retries off.
+func SetGoogleTokenRefresh(fn GoogleTokenRefresh) {
+	googleRefresh.mu.Lock()
+	defer googleRefresh.mu.Unlock()
+	googleRefresh.fn = fn
+}
+
+func currentGoogleRefresh() GoogleTokenRefresh {
+	googleRefresh.mu.RLock()
+	defer googleRefresh.mu.RUnlock()
+	return googleRefresh.fn
+}
+
+// newGoogleHTTPClient is the HTTP client the Google API clients share the
+// behavior of: a cached token Google no longer accepts (revoked, or
+// expired early) is refreshed and the call retried, instead of failing
+// the tool call.
+func newGoogleHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: googleAuthTransport{}}
+}
+
+// googleAuthTransport retries a request to a Google API once with a fresh
+// token when it is answered 401. Requests whose body cannot be replayed
+// (streamed uploads) are not retried.
+type googleAuthTransport struct {
+	// base defaults to http.DefaultTransport, looked up on each request
+	base http.RoundTripper
+}
+
+// RoundTrip also reports each answer to the outage tracker, so a Google
+// service failing with 503s is known to be down.
+func (t googleAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTrip(req)
+	recordGoogleCall(req, resp, err)
+	return resp, err
+}
+
+func (t googleAuthTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	stale, bearer := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	refresh := currentGoogleRefresh()
+	// Only ever send a Google token to Google
+	if !bearer || refresh == nil || !strings.HasSuffix(req.URL.Hostname(), ".googleapis.com") ||
+		req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	fresh, rerr := refresh(req.Context(), stale)
+	if rerr != nil || fresh == "" || fresh == stale {
+		reason := "token unchanged"
+		if rerr != nil {
+			reason = rerr.Error()
+		}
+		logger.WarnCF("tools", "Google refused the token and it could not be refreshed", map[string]interface{}{
+			"host":  req.URL.Host,
+			"error": reason,
+		})
+		return resp, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", "Bearer "+fresh)
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	logger.DebugCF("tools", "Retrying Google request with a refreshed token", map[string]interface{}{"host": req.URL.Host})
+	return base.RoundTrip(retry)
+}
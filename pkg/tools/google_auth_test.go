@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestGoogleClients_RetryOnceAfter401 verifies a refused token is refreshed and the call, body included, retried once
+func TestGoogleClients_RetryOnceAfter401(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	var stale []string
+	SetGoogleTokenRefresh(func(ctx context.Context, token string) (string, error) {
+		stale = append(stale, token)
+		return "fresh-token", nil
+	})
+	t.Cleanup(func() { SetGoogleTokenRefresh(nil) })
+
+	cal := NewGoogleCalendarClient(testkit.Token)
+	start := time.Date(2026, 5, 6, 9, 0, 0, 0, time.UTC)
+	g.FailNext("/calendars/primary/events", 1, http.StatusUnauthorized)
+	if _, err := cal.InsertEvent(context.Background(), "", CalendarEvent{Summary: "Dentist", Start: start, End: start.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if events := g.Events(""); len(events) != 1 || events[0].Summary != "Dentist" {
+		t.Errorf("event not created once: %+v", events)
+	}
+	if len(stale) != 1 || stale[0] != "testkit-token" {
+		t.Errorf("refresh calls: %v", stale)
+	}
+
+	// A token that keeps being refused fails after one retry
+	g.FailNext("/calendars/primary/events", 2, http.StatusUnauthorized)
+	if _, err := cal.ListEvents(context.Background(), "", start, start.Add(time.Hour)); err == nil {
+		t.Error("expected the second 401 to fail the call")
+	}
+	if len(stale) != 2 {
+		t.Errorf("expected one more refresh, got %v", stale)
+	}
+
+	// Other hosts never see a Google token
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer fresh-token" {
+			t.Error("Google token sent to another host")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	other := NewGoogleCalendarClient(testkit.Token)
+	other.baseURL = server.URL
+	other.ListEvents(context.Background(), "", start, start.Add(time.Hour))
+	if len(stale) != 2 {
+		t.Errorf("refresh called for another host: %v", stale)
+	}
+}
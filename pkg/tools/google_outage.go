@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/outage"
+)
+
+// googleProbeURLs are endpoints of each Google service that answer
+// without a token, with a 401 while the service is up, so probing them
+// costs no quota and needs no credentials.
+var googleProbeURLs = map[string]string{
+	"Gmail":           "https://gmail.googleapis.com/gmail/v1/users/me/profile",
+	"Google Drive":    "https://www.googleapis.com/drive/v3/about",
+	"Google Calendar": "https://www.googleapis.com/calendar/v3/users/me/calendarList",
+	"Google Photos":   "https://photoslibrary.googleapis.com/v1/albums",
+	"Google Contacts": "https://people.googleapis.com/v1/people/me",
+	"Google Tasks":    "https://tasks.googleapis.com/tasks/v1/users/@me/lists",
+	"Google Sheets":   "https://sheets.googleapis.com/v4/spreadsheets/probe",
+	"Google Keep":     "https://keep.googleapis.com/v1/notes",
+	"Google APIs":     "https://www.googleapis.com/discovery/v1/apis",
+}
+
+// googleService names the Google service u belongs to, as users know it.
+func googleService(u *url.URL) string {
+	host, path := u.Hostname(), u.Path
+	switch {
+	case host == "gmail.googleapis.com" || strings.HasPrefix(path, "/gmail/"):
+		return "Gmail"
+	case strings.HasPrefix(path, "/drive/") || strings.HasPrefix(path, "/upload/drive/"):
+		return "Google Drive"
+	case strings.HasPrefix(path, "/calendar/"):
+		return "Google Calendar"
+	case host == "photoslibrary.googleapis.com":
+		return "Google Photos"
+	case host == "people.googleapis.com":
+		return "Google Contacts"
+	case host == "tasks.googleapis.com" || strings.HasPrefix(path, "/tasks/"):
+		return "Google Tasks"
+	case host == "sheets.googleapis.com":
+		return "Google Sheets"
+	case host == "keep.googleapis.com":
+		return "Google Keep"
+	}
+	return "Google APIs"
+}
+
+// recordGoogleCall reports how a request to a Google API went to the
+// outage tracker, adding the service's probe the first time it is used.
+func recordGoogleCall(req *http.Request, resp *http.Response, err error) {
+	service := googleService(req.URL)
+	if tracker := outage.Default(); tracker != nil && !tracker.Watching(service) {
+		tracker.Watch(service, googleProbe(googleProbeURLs[service]))
+	}
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	outage.Record(req.Context(), service, status, err)
+}
+
+// googleProbe checks a Google service by requesting probeURL without a
+// token: any answer but a server error means it is up.
+func googleProbe(probeURL string) outage.Probe {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if outage.IsOutage(resp.StatusCode, nil) {
+			return fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		return nil
+	}
+}
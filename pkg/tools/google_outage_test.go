@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/outage"
+)
+
+// fakeDriveTool lists or uploads through the Google HTTP client.
+type fakeDriveTool struct {
+	baseURL  string
+	uploaded []string
+}
+
+func (t *fakeDriveTool) Name() string        { return "drive" }
+func (t *fakeDriveTool) Description() string { return "drive" }
+func (t *fakeDriveTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t *fakeDriveTool) Mutates(args map[string]interface{}) bool { return actionIn(args, "upload") }
+func (t *fakeDriveTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	err := doJSONRequest(ctx, newGoogleHTTPClient(0), http.MethodGet, t.baseURL+"/drive/v3/files", nil, nil, nil)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if actionIn(args, "upload") {
+		t.uploaded = append(t.uploaded, "report.pdf")
+		return NewToolResult("Uploaded report.pdf")
+	}
+	return NewToolResult("no files")
+}
+
+// TestRegistry_OutageExplainsFailuresAndReplaysChanges verifies a tool failing while its Google service is down is reported as an outage, changes wait for the service, and run once the probe finds it back
+func TestRegistry_OutageExplainsFailuresAndReplaysChanges(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "backend unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	tracker := outage.New()
+	tracker.Watch("Google Drive", func(ctx context.Context) error {
+		if down.Load() {
+			return errors.New("503 Service Unavailable")
+		}
+		return nil
+	})
+	outage.SetDefault(tracker)
+	t.Cleanup(func() { outage.SetDefault(nil) })
+
+	msgBus := bus.NewMessageBus()
+	deferred := NewDeferredActions(t.TempDir(), msgBus)
+	drive := &fakeDriveTool{baseURL: server.URL}
+	registry := NewToolRegistry()
+	registry.Register(drive)
+	registry.SetOutages(tracker, deferred)
+	ctx := context.Background()
+
+	result := registry.ExecuteWithContext(ctx, "drive", map[string]interface{}{"action": "list"}, "telegram", "42", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "Google Drive appears to be down (since ") || strings.Contains(result.ForLLM, "503") {
+		t.Fatalf("list = %+v", result)
+	}
+	result = registry.ExecuteWithContext(ctx, "drive", map[string]interface{}{"action": "upload"}, "telegram", "42", nil)
+	if result.IsError || !strings.Contains(result.ForLLM, "saved") {
+		t.Fatalf("upload not deferred: %+v", result)
+	}
+	if pending := deferred.Pending(); len(pending) != 1 || pending[0].Service != "Google Drive" {
+		t.Fatalf("pending = %+v", pending)
+	}
+	if ran := deferred.Replay(ctx, registry); ran != 0 || len(deferred.Pending()) != 1 {
+		t.Fatalf("replayed %d calls while Drive is down", ran)
+	}
+
+	down.Store(false)
+	tracker.Check(ctx)
+	if isDown, _ := tracker.Down("Google Drive"); isDown {
+		t.Fatal("Drive still down after a good probe")
+	}
+	if ran := deferred.Replay(ctx, registry); ran != 1 || len(drive.uploaded) != 1 {
+		t.Fatalf("replayed %d calls, uploaded %v", ran, drive.uploaded)
+	}
+	out := msgBus.DrainOutbound()
+	if len(out) != 1 || !strings.HasPrefix(out[0].Content, "🌐 Google Drive is back.") || !strings.Contains(out[0].Content, "Uploaded report.pdf") {
+		t.Errorf("unexpected report: %+v", out)
+	}
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ScopedTool is implemented by tools some of whose actions need Google
+// OAuth scopes beyond reading. ActionScopes maps each such action to the
+// scopes any one of which lets it run; with SetGoogleScopes, the registry
+// leaves the actions the granted scopes do not cover out of the tool's
+// schema and refuses them.
+type ScopedTool interface {
+	ActionScopes() map[string][]string
+}
+
+// googleScopes expands short scope names such as "gmail.send".
+func googleScopes(names ...string) []string {
+	scopes := make([]string, len(names))
+	for i, name := range names {
+		scopes[i] = "https://www.googleapis.com/auth/" + name
+	}
+	return scopes
+}
+
+// scopedActions returns the actions of tool that none of the granted
+// scopes allow, sorted. A nil granted allows everything.
+func scopedActions(tool Tool, granted map[string]bool) []string {
+	scoped, ok := tool.(ScopedTool)
+	if !ok || granted == nil {
+		return nil
+	}
+	var missing []string
+	for action, scopes := range scoped.ActionScopes() {
+		allowed := false
+		for _, scope := range scopes {
+			if granted[scope] {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			missing = append(missing, action)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// withoutActions returns a copy of a tool's parameters whose action enum
+// leaves out actions, and the actions it took out.
+func withoutActions(params map[string]interface{}, actions []string) (map[string]interface{}, []string) {
+	props, _ := params["properties"].(map[string]interface{})
+	action, _ := props["action"].(map[string]interface{})
+	enum, _ := action["enum"].([]string)
+	if enum == nil {
+		return params, nil
+	}
+	kept := make([]string, 0, len(enum))
+	var removed []string
+	for _, a := range enum {
+		if slices.Contains(actions, a) {
+			removed = append(removed, a)
+		} else {
+			kept = append(kept, a)
+		}
+	}
+	if len(removed) == 0 {
+		return params, nil
+	}
+
+	narrowed := make(map[string]interface{}, len(action))
+	for k, v := range action {
+		narrowed[k] = v
+	}
+	narrowed["enum"] = kept
+	newProps := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		newProps[k] = v
+	}
+	newProps["action"] = narrowed
+	out := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		out[k] = v
+	}
+	out["properties"] = newProps
+	return out, removed
+}
+
+// scopeRefusal explains why a call needing a scope that was not granted
+// does not run.
+func scopeRefusal(name, action string, scopes []string) *ToolResult {
+	short := make([]string, len(scopes))
+	for i, s := range scopes {
+		short[i] = strings.TrimPrefix(s, "https://www.googleapis.com/auth/")
+	}
+	return ErrorResult(fmt.Sprintf("%s %s is turned off: it needs Google access that was not granted (%s). Tell the user; the owner can grant it with `picoclaw auth login --provider google --scopes full`.",
+		name, action, strings.Join(short, " or "))).WithError(fmt.Errorf("google scope not granted"))
+}
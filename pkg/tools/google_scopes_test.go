@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestToolRegistry_GoogleScopes verifies the actions the granted Google scopes do not allow are left out of the schema, noted in the description and refused, and come back with wider scopes
+func TestToolRegistry_GoogleScopes(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	r := NewToolRegistry()
+	r.Register(NewGmailTool(testkit.Token))
+
+	gmailDef := func() (string, []string) {
+		for _, def := range r.ToProviderDefs() {
+			if def.Function.Name == "gmail" {
+				props := def.Function.Parameters["properties"].(map[string]interface{})
+				return def.Function.Description, props["action"].(map[string]interface{})["enum"].([]string)
+			}
+		}
+		t.Fatal("gmail not offered")
+		return "", nil
+	}
+
+	r.SetGoogleScopes(config.GoogleScopePresets["read-only"])
+	desc, enum := gmailDef()
+	if slices.Contains(enum, "send") || slices.Contains(enum, "reply") || slices.Contains(enum, "save_to_drive") || !slices.Contains(enum, "digest") {
+		t.Errorf("read-only actions: %v", enum)
+	}
+	if !strings.Contains(desc, "Turned off for lack of Google access: action save_to_drive, export_pdf, send, reply.") {
+		t.Errorf("description does not note the turned-off actions: %s", desc)
+	}
+	result := r.ExecuteWithContext(context.Background(), "gmail",
+		map[string]interface{}{"action": "send", "to": "ana@example.com", "subject": "Hi", "body": "Hello"}, "telegram", "1", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "gmail.send") || !strings.Contains(result.ForLLM, "--scopes full") {
+		t.Errorf("send not refused: %s", result.ForLLM)
+	}
+	if len(g.Sent()) != 0 {
+		t.Errorf("mail sent without the scope: %v", g.Sent())
+	}
+
+	r.SetGoogleScopes(config.GoogleScopePresets["standard"])
+	if _, enum := gmailDef(); slices.Contains(enum, "send") || !slices.Contains(enum, "save_to_drive") {
+		t.Errorf("standard actions: %v", enum)
+	}
+
+	r.SetGoogleScopes(nil)
+	if desc, enum := gmailDef(); !slices.Contains(enum, "send") || strings.Contains(desc, "Turned off") {
+		t.Errorf("actions held back without scopes: %v", enum)
+	}
+}
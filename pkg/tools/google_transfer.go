@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+// resumableThreshold is the size from which uploads go through the
+// resumable protocols; below it one request is cheaper than a session.
+const resumableThreshold = 5 << 20
+
+// transferStatus turns a failed answer into a transfer.StatusError, which
+// tells the transfer manager whether resuming is worth it.
+func transferStatus(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return &transfer.StatusError{Status: resp.StatusCode, Body: string(body)}
+}
+
+// driveUploadSession is a Drive resumable upload: chunks are PUT to the
+// session URL with a Content-Range, and Drive answers 308 with the range
+// it holds until the last one.
+type driveUploadSession struct {
+	url   string
+	token string
+}
+
+func (s *driveUploadSession) put(ctx context.Context, chunk []byte, contentRange string) (int64, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url, bytes.NewReader(chunk))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Range", contentRange)
+	// No client timeout: a chunk on a slow link can take long, the context
+	// bounds the transfer
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return 0, body, err
+	case http.StatusPermanentRedirect:
+		// "Range: bytes=0-1048575" is what Drive holds; none means nothing
+		_, last, ok := strings.Cut(resp.Header.Get("Range"), "-")
+		if !ok {
+			return 0, nil, nil
+		}
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unexpected Range %q", resp.Header.Get("Range"))
+		}
+		return end + 1, nil, nil
+	}
+	return 0, nil, transferStatus(resp)
+}
+
+func (s *driveUploadSession) Send(ctx context.Context, chunk []byte, offset, total int64, last bool) (int64, []byte, error) {
+	contentRange := fmt.Sprintf("bytes */%d", total)
+	if len(chunk) > 0 {
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, total)
+	}
+	return s.put(ctx, chunk, contentRange)
+}
+
+func (s *driveUploadSession) Query(ctx context.Context, total int64) (int64, []byte, error) {
+	return s.put(ctx, nil, fmt.Sprintf("bytes */%d", total))
+}
+
+// photosUploadSession is a Photos resumable upload: chunks are POSTed to
+// the session URL with their offset, the last one with "finalize", whose
+// answer is the upload token.
+type photosUploadSession struct {
+	url   string
+	token string
+}
+
+func (s *photosUploadSession) post(ctx context.Context, command string, chunk []byte, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("X-Goog-Upload-Command", command)
+	if command != "query" {
+		req.Header.Set("X-Goog-Upload-Offset", strconv.FormatInt(offset, 10))
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (s *photosUploadSession) Send(ctx context.Context, chunk []byte, offset, total int64, last bool) (int64, []byte, error) {
+	command := "upload"
+	if last {
+		command = "upload, finalize"
+	}
+	resp, err := s.post(ctx, command, chunk, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, transferStatus(resp)
+	}
+	if !last {
+		return offset + int64(len(chunk)), nil, nil
+	}
+	token, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return total, token, err
+}
+
+func (s *photosUploadSession) Query(ctx context.Context, total int64) (int64, []byte, error) {
+	resp, err := s.post(ctx, "query", nil, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, transferStatus(resp)
+	}
+	if resp.Header.Get("X-Goog-Upload-Status") == "final" {
+		token, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return total, token, err
+	}
+	received, err := strconv.ParseInt(resp.Header.Get("X-Goog-Upload-Size-Received"), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unexpected upload status %q", resp.Header.Get("X-Goog-Upload-Size-Received"))
+	}
+	return received, nil, nil
+}
+
+// openDownload is a transfer.Download opener for a GET that honors Range
+// requests, as Drive media and Photos base URLs do.
+func openDownload(reqURL, token string) func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	return func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		if err := egress.CheckDownloadURL(reqURL); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		want := http.StatusOK
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			want = http.StatusPartialContent
+		}
+		// No client timeout: videos can take long, the context bounds the transfer
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != want {
+			defer resp.Body.Close()
+			return nil, transferStatus(resp)
+		}
+		return resp.Body, nil
+	}
+}
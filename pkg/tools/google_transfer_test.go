@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+// TestGoogleUploads_ResumableAfterFailedChunk verifies large Drive and Photos uploads go in chunks and survive a failed one
+func TestGoogleUploads_ResumableAfterFailedChunk(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	transfer.SetOptions(transfer.Options{ChunkSize: 1 << 20, RetryDelay: time.Millisecond})
+	t.Cleanup(func() { transfer.SetOptions(transfer.Options{}) })
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("picoclaw"), (resumableThreshold+100)/8)
+
+	g.FailNext("upload_id=", 1, 503)
+	file, err := NewGoogleDriveClient(testkit.Token).Upload(ctx, "", "video.mp4", "video/mp4", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := g.Files()
+	if len(files) != 1 || files[0].ID != file.ID || !bytes.Equal(files[0].Content, data) {
+		t.Fatalf("Drive holds %d files, content intact: %v", len(files), len(files) == 1 && bytes.Equal(files[0].Content, data))
+	}
+
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	os.WriteFile(path, data, 0644)
+	f, _ := os.Open(path)
+	defer f.Close()
+	g.FailNext("upload_id=", 1, 503)
+	item, err := NewGooglePhotosClient(testkit.Token).Upload(ctx, "clip.mp4", "video/mp4", f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	media := g.Media()
+	if len(media) != 1 || media[0].ID != item.ID || !bytes.Equal(media[0].Data, data) {
+		t.Fatalf("unexpected library: %d items", len(media))
+	}
+	if n := g.Sessions(); n != 2 {
+		t.Errorf("started %d resumable sessions, want 2", n)
+	}
+	// Per upload: six 1 MiB chunks, the failed attempt and a status query
+	chunks := 0
+	for _, r := range g.Requests() {
+		if r.Query.Get("upload_id") != "" {
+			chunks++
+		}
+	}
+	if chunks != 16 {
+		t.Errorf("sent %d session requests, want 16", chunks)
+	}
+}
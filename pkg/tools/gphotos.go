@@ -0,0 +1,546 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/exif"
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+// PhotoItem is a media item in the user's Google Photos library.
+type PhotoItem struct {
+	ID         string
+	Filename   string
+	MimeType   string
+	Created    time.Time
+	BaseURL    string
+	ProductURL string
+	Camera     string
+	// Width and Height are the original's size in pixels
+	Width, Height int
+	// Bytes is how much was uploaded and SourceBytes the size of the file
+	// before it was downscaled; both are only set on items Upload returns
+	Bytes, SourceBytes int64
+}
+
+// PhotoAlbum is a Google Photos album.
+type PhotoAlbum struct {
+	ID         string
+	Title      string
+	ProductURL string
+	Count      int
+	// CoverURL is the base URL of the cover photo, valid for an hour
+	CoverURL string
+}
+
+// GooglePhotosClient wraps the Photos Library API. Google only lets an app
+// add items to albums the app created, so organizing works on albums made
+// here.
+type GooglePhotosClient struct {
+	token   TokenFunc
+	baseURL string
+	client  *http.Client
+}
+
+func NewGooglePhotosClient(token TokenFunc) *GooglePhotosClient {
+	return &GooglePhotosClient{
+		token:   token,
+		baseURL: "https://photoslibrary.googleapis.com/v1",
+		client:  newGoogleHTTPClient(30 * time.Second),
+	}
+}
+
+func (c *GooglePhotosClient) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, c.client, method, c.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+type photosDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+func toPhotosDate(t time.Time) photosDate {
+	return photosDate{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+}
+
+type photosMediaItem struct {
+	ID            string `json:"id"`
+	ProductURL    string `json:"productUrl"`
+	BaseURL       string `json:"baseUrl"`
+	MimeType      string `json:"mimeType"`
+	Filename      string `json:"filename"`
+	MediaMetadata struct {
+		CreationTime string `json:"creationTime"`
+		Width        string `json:"width"`
+		Height       string `json:"height"`
+		Photo        *struct {
+			CameraMake  string `json:"cameraMake"`
+			CameraModel string `json:"cameraModel"`
+		} `json:"photo"`
+	} `json:"mediaMetadata"`
+}
+
+func (m photosMediaItem) toPhotoItem() PhotoItem {
+	created, _ := time.Parse(time.RFC3339, m.MediaMetadata.CreationTime)
+	item := PhotoItem{
+		ID:         m.ID,
+		Filename:   m.Filename,
+		MimeType:   m.MimeType,
+		Created:    created,
+		BaseURL:    m.BaseURL,
+		ProductURL: m.ProductURL,
+	}
+	item.Width, _ = strconv.Atoi(m.MediaMetadata.Width)
+	item.Height, _ = strconv.Atoi(m.MediaMetadata.Height)
+	if p := m.MediaMetadata.Photo; p != nil {
+		item.Camera = joinNonEmpty(" ", p.CameraMake, p.CameraModel)
+	}
+	return item
+}
+
+// SearchByDate returns the photos taken between from and to (inclusive
+// calendar days), oldest first. limit caps the result (0 = no cap).
+func (c *GooglePhotosClient) SearchByDate(ctx context.Context, from, to time.Time, limit int) ([]PhotoItem, error) {
+	return c.SearchMedia(ctx, from, to, []string{"PHOTO"}, false, limit)
+}
+
+// SearchMedia is SearchByDate for the given media types ("PHOTO", "VIDEO",
+// or "ALL_MEDIA"). Archived items are left out unless includeArchived is
+// set, as in the Photos app's own views.
+func (c *GooglePhotosClient) SearchMedia(ctx context.Context, from, to time.Time, mediaTypes []string, includeArchived bool, limit int) ([]PhotoItem, error) {
+	return c.SearchMediaIn(ctx, from, to, mediaTypes, nil, includeArchived, limit)
+}
+
+// SearchMediaIn is SearchMedia limited to items in any of the content
+// categories, when given. The API only orders date searches without
+// them, so those results are sorted here instead.
+func (c *GooglePhotosClient) SearchMediaIn(ctx context.Context, from, to time.Time, mediaTypes, categories []string, includeArchived bool, limit int) ([]PhotoItem, error) {
+	var items []PhotoItem
+	pageToken := ""
+	for {
+		filters := map[string]interface{}{
+			"dateFilter": map[string]interface{}{
+				"ranges": []map[string]interface{}{{"startDate": toPhotosDate(from), "endDate": toPhotosDate(to)}},
+			},
+			"mediaTypeFilter":      map[string]interface{}{"mediaTypes": mediaTypes},
+			"includeArchivedMedia": includeArchived,
+		}
+		req := map[string]interface{}{"pageSize": 100, "filters": filters}
+		if len(categories) > 0 {
+			filters["contentFilter"] = map[string]interface{}{"includedContentCategories": categories}
+		} else {
+			req["orderBy"] = "MediaMetadata.creation_time"
+		}
+		if pageToken != "" {
+			req["pageToken"] = pageToken
+		}
+		var resp struct {
+			MediaItems    []photosMediaItem `json:"mediaItems"`
+			NextPageToken string            `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/mediaItems:search", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, m := range resp.MediaItems {
+			items = append(items, m.toPhotoItem())
+			if limit > 0 && len(items) >= limit {
+				break
+			}
+		}
+		if resp.NextPageToken == "" || limit > 0 && len(items) >= limit {
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Created.Before(items[j].Created) })
+			return items, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// SearchCategories returns recent items Google classified into any of the
+// content categories (e.g. "PETS", "RECEIPTS"), newest first. The Library
+// API has no free-text search; categories are the closest thing. Archived
+// items are left out unless includeArchived is set.
+func (c *GooglePhotosClient) SearchCategories(ctx context.Context, categories []string, includeArchived bool, limit int) ([]PhotoItem, error) {
+	req := map[string]interface{}{
+		"pageSize": min(limit, 100),
+		"filters": map[string]interface{}{
+			"contentFilter":        map[string]interface{}{"includedContentCategories": categories},
+			"includeArchivedMedia": includeArchived,
+		},
+	}
+	var resp struct {
+		MediaItems []photosMediaItem `json:"mediaItems"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/mediaItems:search", req, &resp); err != nil {
+		return nil, err
+	}
+	items := make([]PhotoItem, 0, len(resp.MediaItems))
+	for _, m := range resp.MediaItems {
+		items = append(items, m.toPhotoItem())
+	}
+	return items, nil
+}
+
+// SearchAlbum returns the items of an album in the album's order. The API
+// takes no other filters with an album.
+func (c *GooglePhotosClient) SearchAlbum(ctx context.Context, albumID string, limit int) ([]PhotoItem, error) {
+	var items []PhotoItem
+	pageToken := ""
+	for {
+		req := map[string]interface{}{"albumId": albumID, "pageSize": 100}
+		if pageToken != "" {
+			req["pageToken"] = pageToken
+		}
+		var resp struct {
+			MediaItems    []photosMediaItem `json:"mediaItems"`
+			NextPageToken string            `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/mediaItems:search", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, m := range resp.MediaItems {
+			items = append(items, m.toPhotoItem())
+			if limit > 0 && len(items) >= limit {
+				return items, nil
+			}
+		}
+		if resp.NextPageToken == "" {
+			return items, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// Get fetches one media item. Base URLs expire after an hour, so long
+// running jobs fetch a fresh one right before downloading.
+func (c *GooglePhotosClient) Get(ctx context.Context, id string) (*PhotoItem, error) {
+	var m photosMediaItem
+	if err := c.do(ctx, http.MethodGet, "/mediaItems/"+url.PathEscape(id), nil, &m); err != nil {
+		return nil, err
+	}
+	item := m.toPhotoItem()
+	return &item, nil
+}
+
+// ListAlbums returns the albums in the library.
+func (c *GooglePhotosClient) ListAlbums(ctx context.Context) ([]PhotoAlbum, error) {
+	var albums []PhotoAlbum
+	pageToken := ""
+	for {
+		path := "/albums?pageSize=50"
+		if pageToken != "" {
+			path += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		var resp struct {
+			Albums []struct {
+				ID              string `json:"id"`
+				Title           string `json:"title"`
+				ProductURL      string `json:"productUrl"`
+				MediaItemsCount string `json:"mediaItemsCount"`
+				CoverURL        string `json:"coverPhotoBaseUrl"`
+			} `json:"albums"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, a := range resp.Albums {
+			var count int
+			fmt.Sscanf(a.MediaItemsCount, "%d", &count)
+			albums = append(albums, PhotoAlbum{ID: a.ID, Title: a.Title, ProductURL: a.ProductURL, Count: count, CoverURL: a.CoverURL})
+		}
+		if resp.NextPageToken == "" {
+			return albums, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// CreateAlbum creates an album with the given title.
+func (c *GooglePhotosClient) CreateAlbum(ctx context.Context, title string) (*PhotoAlbum, error) {
+	var resp struct {
+		ID         string `json:"id"`
+		Title      string `json:"title"`
+		ProductURL string `json:"productUrl"`
+	}
+	payload := map[string]interface{}{"album": map[string]string{"title": title}}
+	if err := c.do(ctx, http.MethodPost, "/albums", payload, &resp); err != nil {
+		return nil, err
+	}
+	return &PhotoAlbum{ID: resp.ID, Title: resp.Title, ProductURL: resp.ProductURL}, nil
+}
+
+// AddToAlbum adds media items to an album, 50 per request (the API limit).
+func (c *GooglePhotosClient) AddToAlbum(ctx context.Context, albumID string, itemIDs []string) error {
+	for start := 0; start < len(itemIDs); start += 50 {
+		end := min(start+50, len(itemIDs))
+		path := "/albums/" + url.PathEscape(albumID) + ":batchAddMediaItems"
+		if err := c.do(ctx, http.MethodPost, path, map[string]interface{}{"mediaItemIds": itemIDs[start:end]}, nil); err != nil {
+			return err
+		}
+	}
+	if len(itemIDs) > 0 {
+		recordUndo(ctx, UndoAction{
+			Kind:        UndoRemoveFromAlbum,
+			Description: fmt.Sprintf("added %d photos to an album", len(itemIDs)),
+			Params:      map[string]string{"album_id": albumID, "item_ids": strings.Join(itemIDs, ",")},
+		})
+	}
+	return nil
+}
+
+// RemoveFromAlbum takes media items out of an album, 50 per request. The
+// API allows this only for albums the app created.
+func (c *GooglePhotosClient) RemoveFromAlbum(ctx context.Context, albumID string, itemIDs []string) error {
+	for start := 0; start < len(itemIDs); start += 50 {
+		end := min(start+50, len(itemIDs))
+		path := "/albums/" + url.PathEscape(albumID) + ":batchRemoveMediaItems"
+		if err := c.do(ctx, http.MethodPost, path, map[string]interface{}{"mediaItemIds": itemIDs[start:end]}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadExif downloads the start of the original file and parses its EXIF
+// block. Google may strip the location from downloads, in which case
+// HasLocation is false.
+func (c *GooglePhotosClient) ReadExif(ctx context.Context, item PhotoItem) (*exif.Info, error) {
+	if err := egress.CheckDownloadURL(item.BaseURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, item.BaseURL+"=d", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed (%d)", resp.StatusCode)
+	}
+	// EXIF lives in the first segment; no need to fetch the whole image
+	return exif.Decode(io.LimitReader(resp.Body, 256<<10))
+}
+
+// Download opens the original file of a media item (videos included),
+// refreshing its base URL first. The download continues where it stopped
+// if the connection drops.
+func (c *GooglePhotosClient) Download(ctx context.Context, id string) (io.ReadCloser, error) {
+	item, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	suffix := "=d"
+	if strings.HasPrefix(item.MimeType, "video/") {
+		suffix = "=dv"
+	}
+	return transfer.Open(ctx, transfer.Download{
+		Name: item.Filename,
+		Size: -1,
+		Open: openDownload(item.BaseURL+suffix, ""),
+	})
+}
+
+// PhotoUploadQuality downscales JPEG photos before they are uploaded to
+// Google Photos, where originals count against the account's storage.
+type PhotoUploadQuality struct {
+	// MaxDimension bounds the longer side in pixels; 0 keeps the size
+	MaxDimension int
+	// Quality is the JPEG quality, 1-100, photos are re-encoded at; 0
+	// re-encodes only photos that are downscaled
+	Quality int
+}
+
+// maxShrinkSource bounds the photos downscaled before upload; larger
+// files are uploaded as they are rather than decoded in memory.
+const maxShrinkSource = 48 << 20
+
+var photoUpload struct {
+	mu      sync.RWMutex
+	quality PhotoUploadQuality
+}
+
+// SetPhotoUploadQuality sets how photos are downscaled before upload; the
+// zero value uploads originals.
+func SetPhotoUploadQuality(q PhotoUploadQuality) {
+	photoUpload.mu.Lock()
+	defer photoUpload.mu.Unlock()
+	photoUpload.quality = q
+}
+
+func currentPhotoUploadQuality() PhotoUploadQuality {
+	photoUpload.mu.RLock()
+	defer photoUpload.mu.RUnlock()
+	return photoUpload.quality
+}
+
+// Upload sends a file's bytes and creates a media item from them, in the
+// given album when albumID is set (the album must be app-created). Large
+// files (an *os.File or other io.ReaderAt of known size) go in resumable
+// chunks. JPEG photos are downscaled first as SetPhotoUploadQuality says.
+func (c *GooglePhotosClient) Upload(ctx context.Context, filename, mimeType string, r io.Reader, albumID string) (*PhotoItem, error) {
+	size := int64(-1)
+	if f, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	sourceSize := size
+	if q := currentPhotoUploadQuality(); (q.MaxDimension > 0 || q.Quality > 0) && mimeType == "image/jpeg" && size > 0 && size <= maxShrinkSource {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if small, err := imaging.Shrink(data, q.MaxDimension, q.Quality); err == nil && len(small) < len(data) {
+			data = small
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	item, err := c.UploadSized(ctx, filename, mimeType, r, size, albumID)
+	if err != nil {
+		return nil, err
+	}
+	item.Bytes, item.SourceBytes = size, sourceSize
+	return item, nil
+}
+
+// UploadSized is Upload for a reader whose size is known from elsewhere,
+// such as a download from another service; -1 means unknown. Large files
+// go in resumable chunks even when r can only be read once.
+func (c *GooglePhotosClient) UploadSized(ctx context.Context, filename, mimeType string, r io.Reader, size int64, albumID string) (*PhotoItem, error) {
+	if err := checkOutgoingFile(ctx, "Google Photos", filename, size, nil); err != nil {
+		return nil, err
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var uploadToken []byte
+	if size >= resumableThreshold {
+		uploadToken, err = c.uploadResumable(ctx, token, filename, mimeType, r, size)
+	} else if err = transfer.Pace(ctx, max(size, 0)); err == nil {
+		uploadToken, err = c.uploadRaw(ctx, token, mimeType, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]interface{}{
+		"newMediaItems": []map[string]interface{}{{
+			"simpleMediaItem": map[string]string{"uploadToken": string(uploadToken), "fileName": filename},
+		}},
+	}
+	if albumID != "" {
+		payload["albumId"] = albumID
+	}
+	var created struct {
+		NewMediaItemResults []struct {
+			Status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"status"`
+			MediaItem photosMediaItem `json:"mediaItem"`
+		} `json:"newMediaItemResults"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/mediaItems:batchCreate", payload, &created); err != nil {
+		return nil, err
+	}
+	if len(created.NewMediaItemResults) == 0 {
+		return nil, fmt.Errorf("upload of %s returned no media item", filename)
+	}
+	result := created.NewMediaItemResults[0]
+	if result.Status.Code != 0 {
+		return nil, fmt.Errorf("could not create %s: %s", filename, result.Status.Message)
+	}
+	item := result.MediaItem.toPhotoItem()
+	return &item, nil
+}
+
+func (c *GooglePhotosClient) uploadRaw(ctx context.Context, token, mimeType string, r io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/uploads", r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Goog-Upload-Content-Type", mimeType)
+	req.Header.Set("X-Goog-Upload-Protocol", "raw")
+	// No client timeout: uploads of videos can take long
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// uploadResumable opens a resumable upload session and hands it to the
+// transfer manager, which sends the chunks. A reader that is not an
+// io.ReaderAt is read once, as a stream.
+func (c *GooglePhotosClient) uploadResumable(ctx context.Context, token, filename, mimeType string, r io.Reader, size int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/uploads", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Goog-Upload-Command", "start")
+	req.Header.Set("X-Goog-Upload-Content-Type", mimeType)
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Raw-Size", strconv.FormatInt(size, 10))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Goog-Upload-URL") == "" {
+		return nil, fmt.Errorf("upload failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	session := &photosUploadSession{url: resp.Header.Get("X-Goog-Upload-URL"), token: token}
+	if ra, ok := r.(io.ReaderAt); ok {
+		return transfer.Upload(ctx, filename, ra, size, session)
+	}
+	return transfer.UploadStream(ctx, filename, r, size, session)
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	out := ""
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		if out != "" {
+			out += sep
+		}
+		out += p
+	}
+	return out
+}
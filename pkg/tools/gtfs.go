@@ -0,0 +1,359 @@
+package tools
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransitDeparture is a departure from a stop in a timetable.
+type TransitDeparture struct {
+	Stop     string
+	Line     string
+	Headsign string
+	Time     time.Time
+}
+
+// GTFSFeed reads next departures from a static GTFS feed: the zip a
+// transit agency publishes, or its unzipped folder. Stops, routes, trips
+// and service calendars are loaded once, and again when the feed changes;
+// stop_times.txt, by far the largest file, is scanned on each lookup and
+// only the rows of the stops asked about are kept.
+type GTFSFeed struct {
+	path  string
+	mu    sync.Mutex
+	index *gtfsIndex
+}
+
+type gtfsIndex struct {
+	modTime  time.Time
+	loc      *time.Location
+	stops    map[string]gtfsStop
+	routes   map[string]string
+	trips    map[string]gtfsTrip
+	services map[string]*gtfsService
+}
+
+type gtfsStop struct {
+	Name   string
+	Parent string
+}
+
+type gtfsTrip struct {
+	Route    string
+	Service  string
+	Headsign string
+}
+
+// gtfsService is when a service runs: on Days (Sunday first) between
+// Start and End, as YYYYMMDD, plus the Added and less the Removed dates.
+type gtfsService struct {
+	Days       [7]bool
+	Start, End string
+	Added      map[string]bool
+	Removed    map[string]bool
+}
+
+func (s *gtfsService) runs(day time.Time) bool {
+	date := day.Format("20060102")
+	switch {
+	case s.Removed[date]:
+		return false
+	case s.Added[date]:
+		return true
+	}
+	return s.Start <= date && date <= s.End && s.Days[day.Weekday()]
+}
+
+func NewGTFSFeed(path string) *GTFSFeed {
+	return &GTFSFeed{path: path}
+}
+
+// open returns one file of the feed.
+func (f *GTFSFeed) open(name string) (io.ReadCloser, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return os.Open(filepath.Join(f.path, name))
+	}
+	zr, err := zip.OpenReader(f.path)
+	if err != nil {
+		return nil, err
+	}
+	for _, zf := range zr.File {
+		if path.Base(zf.Name) == name {
+			rc, err := zf.Open()
+			if err != nil {
+				zr.Close()
+				return nil, err
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{rc, closerFunc(func() error { rc.Close(); return zr.Close() })}, nil
+		}
+	}
+	zr.Close()
+	return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+}
+
+type closerFunc func() error
+
+func (c closerFunc) Close() error { return c() }
+
+// scan calls fn with each row of one file of the feed; get returns the
+// row's value of a column, "" when the file has no such column. Files
+// that are optional may be missing.
+func (f *GTFSFeed) scan(name string, optional bool, fn func(get func(column string) string)) error {
+	file, err := f.open(name)
+	if errors.Is(err, os.ErrNotExist) && optional {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the GTFS feed: %w", err)
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+	var row []string
+	get := func(column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	for {
+		row, err = r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		fn(get)
+	}
+}
+
+// load returns the feed's index, reading it again when the feed changed.
+func (f *GTFSFeed) load() (*gtfsIndex, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the GTFS feed: %w", err)
+	}
+	if f.index != nil && f.index.modTime.Equal(info.ModTime()) {
+		return f.index, nil
+	}
+	idx := &gtfsIndex{
+		modTime:  info.ModTime(),
+		loc:      time.Local,
+		stops:    make(map[string]gtfsStop),
+		routes:   make(map[string]string),
+		trips:    make(map[string]gtfsTrip),
+		services: make(map[string]*gtfsService),
+	}
+	service := func(id string) *gtfsService {
+		s := idx.services[id]
+		if s == nil {
+			s = &gtfsService{Added: map[string]bool{}, Removed: map[string]bool{}}
+			idx.services[id] = s
+		}
+		return s
+	}
+	files := []struct {
+		name     string
+		optional bool
+		row      func(get func(string) string)
+	}{
+		{"agency.txt", true, func(get func(string) string) {
+			if loc, err := time.LoadLocation(get("agency_timezone")); err == nil && idx.loc == time.Local {
+				idx.loc = loc
+			}
+		}},
+		{"stops.txt", false, func(get func(string) string) {
+			idx.stops[get("stop_id")] = gtfsStop{Name: get("stop_name"), Parent: get("parent_station")}
+		}},
+		{"routes.txt", false, func(get func(string) string) {
+			name := get("route_short_name")
+			if name == "" {
+				name = get("route_long_name")
+			}
+			idx.routes[get("route_id")] = name
+		}},
+		{"trips.txt", false, func(get func(string) string) {
+			idx.trips[get("trip_id")] = gtfsTrip{Route: get("route_id"), Service: get("service_id"), Headsign: get("trip_headsign")}
+		}},
+		{"calendar.txt", true, func(get func(string) string) {
+			s := service(get("service_id"))
+			for i, day := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+				s.Days[i] = get(day) == "1"
+			}
+			s.Start, s.End = get("start_date"), get("end_date")
+		}},
+		{"calendar_dates.txt", true, func(get func(string) string) {
+			s := service(get("service_id"))
+			switch get("exception_type") {
+			case "1":
+				s.Added[get("date")] = true
+			case "2":
+				s.Removed[get("date")] = true
+			}
+		}},
+	}
+	for _, file := range files {
+		if err := f.scan(file.name, file.optional, file.row); err != nil {
+			return nil, err
+		}
+	}
+	f.index = idx
+	return idx, nil
+}
+
+// matchStops finds the stops named by stop: its stop_id, or the stops
+// whose name is stop, or failing that contains it, with the platforms of
+// the stations among them. Several different names matching is an error
+// listing them, for the user to pick one.
+func (idx *gtfsIndex) matchStops(stop string) (map[string]bool, error) {
+	stop = strings.TrimSpace(stop)
+	if _, ok := idx.stops[stop]; ok {
+		return idx.withPlatforms(map[string]bool{stop: true}), nil
+	}
+	exact, partial := map[string]bool{}, map[string]bool{}
+	names := map[string]bool{}
+	for id, s := range idx.stops {
+		switch {
+		case strings.EqualFold(s.Name, stop):
+			exact[id] = true
+		case strings.Contains(strings.ToLower(s.Name), strings.ToLower(stop)):
+			partial[id] = true
+			names[s.Name] = true
+		}
+	}
+	if len(exact) > 0 {
+		return idx.withPlatforms(exact), nil
+	}
+	if len(partial) == 0 {
+		return nil, fmt.Errorf("no stop matching %q in the timetable", stop)
+	}
+	if len(names) > 1 {
+		list := make([]string, 0, len(names))
+		for name := range names {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		if len(list) > 8 {
+			list = append(list[:8], "…")
+		}
+		return nil, fmt.Errorf("several stops match %q: %s", stop, strings.Join(list, ", "))
+	}
+	return idx.withPlatforms(partial), nil
+}
+
+func (idx *gtfsIndex) withPlatforms(ids map[string]bool) map[string]bool {
+	for id, s := range idx.stops {
+		if ids[s.Parent] {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// gtfsSeconds reads a GTFS time, "H:MM:SS" past the start of the service
+// day, which may be 24:00:00 or later for trips running past midnight.
+func gtfsSeconds(s string) (int, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return h*3600 + m*60 + sec, true
+}
+
+// Departures returns the next n departures from stop at or after after,
+// within a day, of line only when it is set.
+func (f *GTFSFeed) Departures(stop, line string, after time.Time, n int) ([]TransitDeparture, error) {
+	idx, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	stops, err := idx.matchStops(stop)
+	if err != nil {
+		return nil, err
+	}
+	local := after.In(idx.loc)
+	// Trips of yesterday's service run past midnight into today
+	var days []time.Time
+	for d := -1; d <= 1; d++ {
+		days = append(days, time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, idx.loc))
+	}
+	until := after.Add(24 * time.Hour)
+	var deps []TransitDeparture
+	err = f.scan("stop_times.txt", false, func(get func(string) string) {
+		stopID := get("stop_id")
+		if !stops[stopID] {
+			return
+		}
+		trip, ok := idx.trips[get("trip_id")]
+		if !ok || line != "" && !strings.EqualFold(idx.routes[trip.Route], strings.TrimSpace(line)) {
+			return
+		}
+		at := get("departure_time")
+		if at == "" {
+			at = get("arrival_time")
+		}
+		secs, ok := gtfsSeconds(at)
+		service := idx.services[trip.Service]
+		if !ok || service == nil {
+			return
+		}
+		headsign := get("stop_headsign")
+		if headsign == "" {
+			headsign = trip.Headsign
+		}
+		for _, day := range days {
+			t := day.Add(time.Duration(secs) * time.Second)
+			if t.Before(after) || !t.Before(until) || !service.runs(day) {
+				continue
+			}
+			deps = append(deps, TransitDeparture{Stop: idx.stops[stopID].Name, Line: idx.routes[trip.Route], Headsign: headsign, Time: t})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(deps, func(i, j int) bool { return deps[i].Time.Before(deps[j].Time) })
+	if len(deps) > n {
+		deps = deps[:n]
+	}
+	return deps, nil
+}
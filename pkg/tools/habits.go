@@ -0,0 +1,486 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const habitNudgeJobKind = "habit_nudge"
+
+// Habit is something the user checks in on daily (a workout, medication
+// taken) or a metric they record (weight, hours slept).
+type Habit struct {
+	Name    string       `json:"name"`
+	Metric  bool         `json:"metric,omitempty"`
+	Unit    string       `json:"unit,omitempty"`
+	Entries []HabitEntry `json:"entries"`
+}
+
+// HabitEntry is one day's check-in. Date is in the user's timezone.
+type HabitEntry struct {
+	Date  string   `json:"date"`
+	Value *float64 `json:"value,omitempty"`
+	Note  string   `json:"note,omitempty"`
+}
+
+// HabitTool records habit check-ins and metrics per chat, reports streaks
+// and schedules nudges through the cron service.
+type HabitTool struct {
+	path      string
+	profiles  *profile.Store
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	habits    map[string]map[string]*Habit
+	channel   string
+	chatID    string
+	now       func() time.Time
+}
+
+func NewHabitTool(workspace string, profiles *profile.Store) *HabitTool {
+	t := &HabitTool{
+		path:     filepath.Join(workspace, "state", "habits.json"),
+		profiles: profiles,
+		habits:   make(map[string]map[string]*Habit),
+		now:      time.Now,
+	}
+	if data, err := os.ReadFile(t.path); err == nil {
+		json.Unmarshal(data, &t.habits)
+	}
+	return t
+}
+
+func (t *HabitTool) Name() string {
+	return "habits"
+}
+
+func (t *HabitTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *HabitTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "log", "nudge", "remove_nudge", "delete")
+}
+
+func (t *HabitTool) Description() string {
+	return "Track habits and health metrics: log daily check-ins (workout, meditation, medication taken) or values (weight, sleep hours), see streaks and trends, and schedule a daily nudge that only fires if the habit hasn't been logged yet that day."
+}
+
+func (t *HabitTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"log", "status", "history", "nudge", "remove_nudge", "delete"},
+				"description": "log a check-in or value, status of all habits today, history of one habit, nudge schedules a daily reminder, remove_nudge cancels it, delete forgets a habit",
+			},
+			"habit": map[string]interface{}{
+				"type":        "string",
+				"description": "Habit or metric name, e.g. \"meditation\", \"weight\", \"vitamin D\"",
+			},
+			"value": map[string]interface{}{
+				"type":        "number",
+				"description": "Value for metrics (log), e.g. 72.4 for weight. Omit for plain check-ins",
+			},
+			"unit": map[string]interface{}{
+				"type":        "string",
+				"description": "Unit for a metric on first log, e.g. kg, h",
+			},
+			"note": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional note for the check-in",
+			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "Day of the check-in as YYYY-MM-DD (default today)",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "How many days of history to show (default 30)",
+			},
+			"time": map[string]interface{}{
+				"type":        "string",
+				"description": "Nudge time as HH:MM in the user's timezone",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *HabitTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *HabitTool) JobKinds() []string {
+	return []string{habitNudgeJobKind}
+}
+
+func (t *HabitTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func habitKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func (t *HabitTool) location(chatKey string) *time.Location {
+	if t.profiles == nil {
+		return time.Local
+	}
+	return t.profiles.Get(chatKey).Location()
+}
+
+func (t *HabitTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chatKey := t.channel + ":" + t.chatID
+	name, _ := args["habit"].(string)
+	key := habitKey(name)
+	today := t.now().In(t.location(chatKey))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	book := t.habits[chatKey]
+
+	if action == "status" {
+		return SilentResult(t.formatStatus(book, today))
+	}
+	if key == "" {
+		return ErrorResult(fmt.Sprintf("habit is required for %s", action))
+	}
+	habit := book[key]
+
+	switch action {
+	case "log":
+		date := today.Format("2006-01-02")
+		if v, ok := args["date"].(string); ok && v != "" {
+			d, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("invalid date %q (expected YYYY-MM-DD)", v))
+			}
+			date = d.Format("2006-01-02")
+		}
+		entry := HabitEntry{Date: date}
+		if v, ok := args["value"].(float64); ok {
+			entry.Value = &v
+		}
+		entry.Note, _ = args["note"].(string)
+
+		if habit == nil {
+			habit = &Habit{Name: strings.TrimSpace(name), Metric: entry.Value != nil}
+			habit.Unit, _ = args["unit"].(string)
+			if book == nil {
+				book = make(map[string]*Habit)
+				t.habits[chatKey] = book
+			}
+			book[key] = habit
+		}
+		if habit.Metric && entry.Value == nil {
+			return ErrorResult(fmt.Sprintf("%s is a metric; value is required", habit.Name))
+		}
+		// One entry per day: a second log replaces the first
+		replaced := false
+		for i := range habit.Entries {
+			if habit.Entries[i].Date == date {
+				habit.Entries[i] = entry
+				replaced = true
+			}
+		}
+		if !replaced {
+			habit.Entries = append(habit.Entries, entry)
+			sort.Slice(habit.Entries, func(i, j int) bool { return habit.Entries[i].Date < habit.Entries[j].Date })
+		}
+		if err := t.saveLocked(); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save habits: %v", err)).WithError(err)
+		}
+
+		msg := fmt.Sprintf("Logged %s for %s", habit.Name, date)
+		if entry.Value != nil {
+			msg = fmt.Sprintf("Logged %s: %s for %s", habit.Name, formatHabitValue(*entry.Value, habit.Unit), date)
+		}
+		current, longest := habitStreaks(habit, today)
+		msg += fmt.Sprintf(". Streak: %d day(s) (best %d).", current, longest)
+		return SilentResult(msg)
+
+	case "history":
+		if habit == nil {
+			return ErrorResult(fmt.Sprintf("no habit named %q", name))
+		}
+		days := 30
+		if v, ok := args["days"].(float64); ok && v > 0 {
+			days = int(v)
+		}
+		return SilentResult(formatHabitHistory(habit, today, days))
+
+	case "nudge":
+		if t.scheduler == nil {
+			return ErrorResult("habit nudges are not available (scheduler not running)")
+		}
+		clockStr, _ := args["time"].(string)
+		clock, err := time.Parse("15:04", strings.TrimSpace(clockStr))
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid time %q (expected HH:MM)", clockStr))
+		}
+		if existing := t.findNudge(t.channel, t.chatID, key); existing != nil {
+			t.scheduler.RemoveJob(existing.ID)
+		}
+		displayName := strings.TrimSpace(name)
+		if habit != nil {
+			displayName = habit.Name
+		}
+
+		var tz string
+		if t.profiles != nil {
+			tz = t.profiles.Get(chatKey).Timezone
+		}
+		expr := fmt.Sprintf("%d %d * * *", clock.Minute(), clock.Hour())
+		job, err := t.scheduler.AddJobWithPayload("Habit nudge: "+displayName, cron.CronSchedule{Kind: "cron", Expr: expr, TZ: tz},
+			cron.CronPayload{
+				Kind:    habitNudgeJobKind,
+				Message: "Habit nudge: " + displayName,
+				Channel: t.channel,
+				To:      t.chatID,
+				Data:    map[string]string{"habit": key, "name": displayName, "time": clock.Format("15:04")},
+			})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule nudge: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Daily nudge for %s at %s%s unless already logged (id: %s)",
+			displayName, clock.Format("15:04"), tzSuffix(tz), job.ID))
+
+	case "remove_nudge":
+		job := t.findNudge(t.channel, t.chatID, key)
+		if job == nil {
+			return ErrorResult(fmt.Sprintf("no nudge scheduled for %s", name))
+		}
+		t.scheduler.RemoveJob(job.ID)
+		return SilentResult(fmt.Sprintf("Nudge for %s removed", name))
+
+	case "delete":
+		if habit == nil {
+			return ErrorResult(fmt.Sprintf("no habit named %q", name))
+		}
+		delete(book, key)
+		if job := t.findNudge(t.channel, t.chatID, key); job != nil {
+			t.scheduler.RemoveJob(job.ID)
+		}
+		if err := t.saveLocked(); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save habits: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Deleted %s and its %d entries", habit.Name, len(habit.Entries)))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *HabitTool) findNudge(channel, chatID, key string) *cron.CronJob {
+	if t.scheduler == nil {
+		return nil
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == habitNudgeJobKind && job.Payload.Channel == channel &&
+			job.Payload.To == chatID && job.Payload.Data["habit"] == key {
+			return &job
+		}
+	}
+	return nil
+}
+
+// ExecuteJob implements ScheduledTool. The nudge stays silent when the
+// habit was already logged today.
+func (t *HabitTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	chatKey := job.Payload.Channel + ":" + job.Payload.To
+	today := t.now().In(t.location(chatKey))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	habit := t.habits[chatKey][job.Payload.Data["habit"]]
+	if habit == nil {
+		return fmt.Sprintf("⏰ Time for %s! Tell me when it's done and I'll start tracking your streak.", job.Payload.Data["name"]), nil
+	}
+	if habitDone(habit, today.Format("2006-01-02")) {
+		return "", nil
+	}
+	current, _ := habitStreaks(habit, today)
+	if habit.Metric {
+		return fmt.Sprintf("⏰ Reminder to record your %s today.", habit.Name), nil
+	}
+	if current > 0 {
+		return fmt.Sprintf("⏰ %s not logged yet today. Keep your %d-day streak going!", habit.Name, current), nil
+	}
+	return fmt.Sprintf("⏰ %s not logged yet today.", habit.Name), nil
+}
+
+func habitDone(h *Habit, date string) bool {
+	for _, e := range h.Entries {
+		if e.Date == date {
+			return true
+		}
+	}
+	return false
+}
+
+// habitStreaks returns the current run of consecutive days (still alive if
+// yesterday was logged but today not yet) and the longest run ever.
+func habitStreaks(h *Habit, today time.Time) (current, longest int) {
+	days := make(map[string]bool, len(h.Entries))
+	for _, e := range h.Entries {
+		days[e.Date] = true
+	}
+
+	day := today
+	if !days[day.Format("2006-01-02")] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for days[day.Format("2006-01-02")] {
+		current++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	run := 0
+	var prev time.Time
+	for _, e := range h.Entries {
+		d, err := time.Parse("2006-01-02", e.Date)
+		if err != nil {
+			continue
+		}
+		if run > 0 && d.Equal(prev.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		prev = d
+		if run > longest {
+			longest = run
+		}
+	}
+	return current, longest
+}
+
+func formatHabitValue(v float64, unit string) string {
+	s := formatNumber(v)
+	if unit != "" {
+		s += " " + unit
+	}
+	return s
+}
+
+func (t *HabitTool) formatStatus(book map[string]*Habit, today time.Time) string {
+	if len(book) == 0 {
+		return "No habits tracked yet."
+	}
+	keys := make([]string, 0, len(book))
+	for key := range book {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	date := today.Format("2006-01-02")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Habits for %s:\n", date)
+	for _, key := range keys {
+		h := book[key]
+		mark := "✗"
+		if habitDone(h, date) {
+			mark = "✓"
+		}
+		if h.Metric {
+			last := h.Entries[len(h.Entries)-1]
+			fmt.Fprintf(&sb, "%s %s: last %s on %s\n", mark, h.Name, formatHabitValue(*last.Value, h.Unit), last.Date)
+			continue
+		}
+		current, longest := habitStreaks(h, today)
+		fmt.Fprintf(&sb, "%s %s: streak %d day(s), best %d\n", mark, h.Name, current, longest)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func formatHabitHistory(h *Habit, today time.Time, days int) string {
+	from := today.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	var entries []HabitEntry
+	for _, e := range h.Entries {
+		if e.Date >= from && e.Date <= today.Format("2006-01-02") {
+			entries = append(entries, e)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s, last %d days:\n", h.Name, days)
+	if len(entries) == 0 {
+		sb.WriteString("No entries.")
+		return sb.String()
+	}
+
+	if h.Metric {
+		lo, hi, sum := math.Inf(1), math.Inf(-1), 0.0
+		for _, e := range entries {
+			v := *e.Value
+			lo, hi, sum = math.Min(lo, v), math.Max(hi, v), sum+v
+		}
+		first, last := *entries[0].Value, *entries[len(entries)-1].Value
+		fmt.Fprintf(&sb, "Latest %s, average %s, range %s to %s, change %+.1f since %s\n",
+			formatHabitValue(last, h.Unit), formatHabitValue(math.Round(sum/float64(len(entries))*10)/10, h.Unit),
+			formatHabitValue(lo, h.Unit), formatHabitValue(hi, h.Unit), last-first, entries[0].Date)
+	} else {
+		current, longest := habitStreaks(h, today)
+		fmt.Fprintf(&sb, "Done %d of %d days (%d%%). Streak %d, best %d\n",
+			len(entries), days, len(entries)*100/days, current, longest)
+	}
+
+	for _, e := range entries {
+		line := "- " + e.Date
+		if e.Value != nil {
+			line += ": " + formatHabitValue(*e.Value, h.Unit)
+		}
+		if e.Note != "" {
+			line += " (" + e.Note + ")"
+		}
+		sb.WriteString(line + "\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// saveLocked persists the habits. Must be called with the lock held.
+func (t *HabitTool) saveLocked() error {
+	return saveJSONAtomic(t.path, t.habits)
+}
+
+// ChatData implements ChatDataStore: the chat's habits and their entries.
+func (t *HabitTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.habits[chatKey]) == 0 {
+		return nil, nil
+	}
+	return snapshot(t.habits[chatKey])
+}
+
+// PurgeChat implements ChatDataStore. Nudges go with the chat's jobs.
+func (t *HabitTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.habits[chatKey])
+	if n == 0 {
+		return 0, nil
+	}
+	delete(t.habits, chatKey)
+	return n, t.saveLocked()
+}
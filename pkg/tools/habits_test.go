@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// TestHabitTool_LogAndStreaks verifies check-ins build streaks and metrics report trends
+func TestHabitTool_LogAndStreaks(t *testing.T) {
+	tool := NewHabitTool(t.TempDir(), nil)
+	tool.SetContext("telegram", "42")
+	tool.now = func() time.Time { return time.Date(2026, 3, 10, 20, 0, 0, 0, time.Local) }
+	ctx := context.Background()
+
+	for _, date := range []string{"2026-03-01", "2026-03-02", "2026-03-03", "2026-03-07", "2026-03-08", "2026-03-09"} {
+		tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "Meditation", "date": date})
+	}
+	result := tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "meditation"})
+	if !strings.Contains(result.ForLLM, "Streak: 4 day(s) (best 4)") {
+		t.Errorf("Unexpected streak: %s", result.ForLLM)
+	}
+
+	tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "weight", "value": 72.4, "unit": "kg", "date": "2026-03-01"})
+	tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "weight", "value": 71.9, "unit": "kg"})
+	result = tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "weight"})
+	if !result.IsError {
+		t.Errorf("Expected metric without value to fail")
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "history", "habit": "weight", "days": 14.0})
+	if !strings.Contains(result.ForLLM, "Latest 71.9 kg") || !strings.Contains(result.ForLLM, "change -0.5 since 2026-03-01") {
+		t.Errorf("Unexpected metric history:\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "status"})
+	if !strings.Contains(result.ForLLM, "✓ Meditation: streak 4 day(s), best 4") || !strings.Contains(result.ForLLM, "✓ weight: last 71.9 kg on 2026-03-10") {
+		t.Errorf("Unexpected status:\n%s", result.ForLLM)
+	}
+}
+
+// TestHabitTool_NudgeSkipsWhenLogged verifies the nudge job only speaks up when the habit is still open
+func TestHabitTool_NudgeSkipsWhenLogged(t *testing.T) {
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool := NewHabitTool(t.TempDir(), nil)
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "42")
+	now := time.Date(2026, 3, 10, 21, 0, 0, 0, time.Local)
+	tool.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "Vitamin D", "date": "2026-03-09"})
+	tool.Execute(ctx, map[string]interface{}{"action": "nudge", "habit": "vitamin d", "time": "20:00"})
+	result := tool.Execute(ctx, map[string]interface{}{"action": "nudge", "habit": "vitamin d", "time": "21:00"})
+	if result.IsError {
+		t.Fatalf("nudge failed: %s", result.ForLLM)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Schedule.Expr != "0 21 * * *" {
+		t.Fatalf("Expected a single rescheduled nudge, got %+v", jobs)
+	}
+
+	out, _ := tool.ExecuteJob(ctx, &jobs[0])
+	if !strings.Contains(out, "Keep your 1-day streak going") {
+		t.Errorf("Expected a nudge, got %q", out)
+	}
+
+	tool.Execute(ctx, map[string]interface{}{"action": "log", "habit": "Vitamin D"})
+	if out, _ := tool.ExecuteJob(ctx, &jobs[0]); out != "" {
+		t.Errorf("Expected no nudge after logging, got %q", out)
+	}
+}
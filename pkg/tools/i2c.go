@@ -20,6 +20,14 @@ func (t *I2CTool) Name() string {
 	return "i2c"
 }
 
+func (t *I2CTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *I2CTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "write")
+}
+
 func (t *I2CTool) Description() string {
 	return "Interact with I2C bus devices for reading sensors and controlling peripherals. Actions: detect (list buses), scan (find devices on a bus), read (read bytes from device), write (send bytes to device). Linux only."
 }
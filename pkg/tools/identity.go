@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/identity"
+)
+
+// LinkCodeSender delivers a link code to an account: a chat message for
+// chat accounts, an email for "email:" ones.
+type LinkCodeSender func(ctx context.Context, account, text string) error
+
+// IdentityTool links the user's accounts on other channels to the one
+// they are talking from, so their profile, conversation and quotas
+// follow them. Linking sends a one-time code to the other account, which
+// the user types back here.
+type IdentityTool struct {
+	store *identity.Store
+	send  LinkCodeSender
+}
+
+func NewIdentityTool(store *identity.Store, send LinkCodeSender) *IdentityTool {
+	return &IdentityTool{store: store, send: send}
+}
+
+func (t *IdentityTool) Name() string {
+	return "identity"
+}
+
+func (t *IdentityTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *IdentityTool) Description() string {
+	return "Link the user's accounts across channels so they are recognized as the same person everywhere. Actions: link (send a one-time code to another account, e.g. whatsapp:5511999990000 or email:ana@example.com), confirm (check the code the user received and typed here), unlink (detach one of their accounts), show (list their linked accounts)."
+}
+
+func (t *IdentityTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"link", "confirm", "unlink", "show"},
+			},
+			"account": map[string]interface{}{
+				"type":        "string",
+				"description": "For link and unlink: the account as channel:id, e.g. telegram:123456, whatsapp:5511999990000 or email:ana@example.com",
+			},
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "For confirm: the six-digit code the user received",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *IdentityTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "link", "confirm", "unlink")
+}
+
+func (t *IdentityTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("identity only works in a chat")
+	}
+	current := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	account, _ := args["account"].(string)
+
+	switch action {
+	case "show":
+		accounts := t.store.Accounts(current)
+		if len(accounts) == 1 {
+			return NewToolResult(fmt.Sprintf("No other accounts are linked to %s.", current))
+		}
+		return NewToolResult("Linked accounts (the first one holds the shared profile and conversation):\n" + strings.Join(accounts, "\n"))
+	case "link":
+		if account == "" {
+			return ErrorResult("account is required for link")
+		}
+		code, err := t.store.StartLink(current, account)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		target, _ := identity.NormalizeAccount(account)
+		text := fmt.Sprintf("Your picoclaw link code is %s. Type it in the chat where you asked to link %s; it expires in 10 minutes. If you did not ask for this, ignore it.", code, target)
+		if err := t.send(ctx, target, text); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to send the code to %s: %v", target, err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("A six-digit code was sent to %s. Ask the user to type it here; it expires in 10 minutes. Never say the code yourself.", target))
+	case "confirm":
+		code, _ := args["code"].(string)
+		if strings.TrimSpace(code) == "" {
+			return ErrorResult("code is required for confirm")
+		}
+		linked, err := t.store.Confirm(current, code)
+		if err != nil {
+			if errors.Is(err, identity.ErrNoPendingLink) {
+				return ErrorResult(err.Error())
+			}
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Linked %s to %s: profile, conversation and quotas are now shared.", linked, current))
+	case "unlink":
+		if account == "" {
+			return ErrorResult("account is required for unlink")
+		}
+		target, err := identity.NormalizeAccount(account)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if t.store.Resolve(target) != t.store.Resolve(current) {
+			return ErrorResult(fmt.Sprintf("%s is not one of this user's linked accounts", target))
+		}
+		if err := t.store.Unlink(target); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Unlinked %s.", target))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q", action))
+	}
+}
@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+// TestIdentityTool_LinkWithCode verifies the code goes to the other account, only this chat can confirm it, and linked accounts then share a profile
+func TestIdentityTool_LinkWithCode(t *testing.T) {
+	dir := t.TempDir()
+	ids := identity.NewStore(dir)
+	profiles := profile.NewStore(dir)
+	profiles.SetResolver(ids.Resolve)
+
+	var sentTo, sentText string
+	tool := NewIdentityTool(ids, func(ctx context.Context, account, text string) error {
+		sentTo, sentText = account, text
+		return nil
+	})
+	telegram := WithChat(context.Background(), "telegram", "123")
+	whatsapp := WithChat(context.Background(), "whatsapp", "5511")
+
+	res := tool.Execute(telegram, map[string]interface{}{"action": "link", "account": "WhatsApp:5511"})
+	if res.IsError || sentTo != "whatsapp:5511" {
+		t.Fatalf("link: %s (sent to %q)", res.ForLLM, sentTo)
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(sentText)
+	if code == "" || strings.Contains(res.ForLLM, code) {
+		t.Fatalf("code %q missing from the message or shown to the model: %s", code, res.ForLLM)
+	}
+
+	// The code proves control of WhatsApp, so it must be typed on Telegram
+	if res := tool.Execute(whatsapp, map[string]interface{}{"action": "confirm", "code": code}); !res.IsError {
+		t.Error("code confirmed from the account it was sent to")
+	}
+	if res := tool.Execute(telegram, map[string]interface{}{"action": "confirm", "code": code}); res.IsError {
+		t.Fatalf("confirm: %s", res.ForLLM)
+	}
+
+	profiles.Set("whatsapp:5511", profile.Profile{Timezone: "America/Sao_Paulo"})
+	if got := profiles.Get("telegram:123").Timezone; got != "America/Sao_Paulo" {
+		t.Errorf("profile not shared: %q", got)
+	}
+	if res := tool.Execute(whatsapp, map[string]interface{}{"action": "show"}); !strings.Contains(res.ForLLM, "telegram:123") {
+		t.Errorf("show: %s", res.ForLLM)
+	}
+
+	stranger := WithChat(context.Background(), "telegram", "999")
+	if res := tool.Execute(stranger, map[string]interface{}{"action": "unlink", "account": "whatsapp:5511"}); !res.IsError {
+		t.Error("someone else unlinked the account")
+	}
+	if res := tool.Execute(telegram, map[string]interface{}{"action": "unlink", "account": "whatsapp:5511"}); res.IsError {
+		t.Fatalf("unlink: %s", res.ForLLM)
+	}
+	if got := profiles.Get("whatsapp:5511").Timezone; got != "" {
+		t.Errorf("unlinked account still sees the profile: %q", got)
+	}
+}
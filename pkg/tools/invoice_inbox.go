@@ -0,0 +1,468 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+)
+
+const (
+	invoiceInboxJobKind = "invoice_inbox"
+	// invoiceFirstRunWindow is how far back the first run looks
+	invoiceFirstRunWindow = "newer_than:60d"
+	// maxInvoiceMessages bounds one rule's work per run
+	maxInvoiceMessages = 25
+	// invoiceProcessedRetention is how long handled message IDs are kept;
+	// later runs only search after the last run anyway
+	invoiceProcessedRetention = 180 * 24 * time.Hour
+)
+
+// defaultInvoiceAttachments matches the files treated as invoices when a
+// rule does not say otherwise.
+var defaultInvoiceAttachments = regexp.MustCompile(`(?i)\.(pdf|png|jpe?g)$`)
+
+// InvoiceRule selects invoice emails with a Gmail query and says how to
+// file them.
+type InvoiceRule struct {
+	Name string
+	// Query uses Gmail search syntax, e.g. "from:billing@example.com"
+	Query string
+	// Vendor names the saved files and ledger entries (default: Name)
+	Vendor   string
+	Category string
+	// Attachments is a regexp on attachment names (default: PDFs and images)
+	Attachments string
+}
+
+// InvoiceInboxOptions configures the pipeline.
+type InvoiceInboxOptions struct {
+	// FolderID is the Drive folder invoices are saved to ("" for My Drive)
+	FolderID string
+	Currency string
+	Rules    []InvoiceRule
+}
+
+type invoiceInboxState struct {
+	Processed map[string]time.Time `json:"processed"`
+	LastRun   time.Time            `json:"last_run"`
+}
+
+// InvoiceInboxTool files invoices and receipts arriving by email: matching
+// attachments are saved to Drive as "YYYY-MM Vendor.pdf" and, when a
+// ledger is configured, the amount is logged as an expense.
+type InvoiceInboxTool struct {
+	gmail     *GmailClient
+	drive     *GoogleDriveClient
+	ledger    ExpenseLedger
+	ocr       ocr.Engine
+	opts      InvoiceInboxOptions
+	patterns  []*regexp.Regexp
+	statePath string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	channel   string
+	chatID    string
+	now       func() time.Time
+}
+
+// NewInvoiceInboxTool creates the tool. ledger and engine may be nil, which
+// disables expense logging and reading amounts from images.
+func NewInvoiceInboxTool(token TokenFunc, workspace string, opts InvoiceInboxOptions, ledger ExpenseLedger, engine ocr.Engine) *InvoiceInboxTool {
+	if opts.Currency == "" {
+		opts.Currency = "USD"
+	}
+	t := &InvoiceInboxTool{
+		gmail:     NewGmailClient(token),
+		drive:     NewGoogleDriveClient(token),
+		ledger:    ledger,
+		ocr:       engine,
+		opts:      opts,
+		statePath: filepath.Join(workspace, "state", "invoice_inbox.json"),
+		now:       time.Now,
+	}
+	for _, rule := range opts.Rules {
+		pattern := defaultInvoiceAttachments
+		if rule.Attachments != "" {
+			re, err := regexp.Compile("(?i)" + rule.Attachments)
+			if err != nil {
+				logger.WarnCF("invoices", "Invalid attachment pattern; using the default", map[string]interface{}{
+					"rule":  rule.Name,
+					"error": err.Error(),
+				})
+			} else {
+				pattern = re
+			}
+		}
+		t.patterns = append(t.patterns, pattern)
+	}
+	return t
+}
+
+func (t *InvoiceInboxTool) Name() string {
+	return "invoice_inbox"
+}
+
+func (t *InvoiceInboxTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "run", "schedule", "unschedule")
+}
+
+func (t *InvoiceInboxTool) Description() string {
+	names := make([]string, len(t.opts.Rules))
+	for i, r := range t.opts.Rules {
+		names[i] = r.Name
+	}
+	return "Invoice inbox automation: find invoice/receipt emails matching the configured rules (" + strings.Join(names, ", ") +
+		"), save their attachments to Google Drive as \"YYYY-MM Vendor\" and log the amounts as expenses. Run it now, schedule it to run every few hours in this chat, stop the schedule, or show the status."
+}
+
+func (t *InvoiceInboxTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"run", "schedule", "unschedule", "status"},
+				"description": "Action to perform",
+			},
+			"every_hours": map[string]interface{}{
+				"type":        "integer",
+				"description": "How often to check for new invoices (schedule, default 6)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *InvoiceInboxTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *InvoiceInboxTool) JobKinds() []string {
+	return []string{invoiceInboxJobKind}
+}
+
+func (t *InvoiceInboxTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *InvoiceInboxTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "run":
+		report, err := t.run(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invoice run failed: %v", err)).WithError(err)
+		}
+		if report == "" {
+			report = "No new invoices"
+		}
+		return NewToolResult(report)
+
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("invoice scheduling is not available (scheduler not running)")
+		}
+		if t.channel == "" || t.chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		hours := 6
+		if h, ok := args["every_hours"].(float64); ok && h >= 1 {
+			hours = int(h)
+		}
+		t.unschedule()
+		everyMS := (time.Duration(hours) * time.Hour).Milliseconds()
+		job, err := t.scheduler.AddJobWithPayload("Invoice inbox", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    invoiceInboxJobKind,
+			Message: "Invoice inbox",
+			Channel: t.channel,
+			To:      t.chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Invoice inbox scheduled every %dh (id: %s); new invoices will be reported here.", hours, job.ID))
+
+	case "unschedule":
+		if t.scheduler == nil {
+			return ErrorResult("invoice scheduling is not available (scheduler not running)")
+		}
+		if t.unschedule() == 0 {
+			return SilentResult("The invoice inbox was not scheduled")
+		}
+		return SilentResult("Invoice inbox schedule removed")
+
+	case "status":
+		state, err := t.loadState()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		var sb strings.Builder
+		sb.WriteString("Rules:\n")
+		for _, r := range t.opts.Rules {
+			fmt.Fprintf(&sb, "- %s: %q -> %s\n", r.Name, r.Query, t.vendor(r, ""))
+		}
+		last := "never"
+		if !state.LastRun.IsZero() {
+			last = state.LastRun.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(&sb, "Last run: %s; %d email(s) filed", last, len(state.Processed))
+		if t.scheduler != nil {
+			for _, job := range t.scheduler.ListJobs(false) {
+				if job.Payload.Kind == invoiceInboxJobKind && job.Schedule.EveryMS != nil {
+					fmt.Fprintf(&sb, "\nScheduled every %s", time.Duration(*job.Schedule.EveryMS)*time.Millisecond)
+				}
+			}
+		}
+		return SilentResult(sb.String())
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// unschedule removes existing invoice jobs; there is one pipeline, so one
+// schedule.
+func (t *InvoiceInboxTool) unschedule() int {
+	removed := 0
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == invoiceInboxJobKind && t.scheduler.RemoveJob(job.ID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ExecuteJob implements ScheduledTool. It reports only when something was
+// filed or failed.
+func (t *InvoiceInboxTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.run(ctx)
+}
+
+func (t *InvoiceInboxTool) loadState() (*invoiceInboxState, error) {
+	state := &invoiceInboxState{Processed: make(map[string]time.Time)}
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read invoice state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse invoice state: %w", err)
+	}
+	if state.Processed == nil {
+		state.Processed = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// vendor names the sender: the rule's vendor, the rule name, or the
+// sender's display name.
+func (t *InvoiceInboxTool) vendor(rule InvoiceRule, from string) string {
+	if rule.Vendor != "" {
+		return rule.Vendor
+	}
+	if rule.Name != "" {
+		return rule.Name
+	}
+	if addr, err := mail.ParseAddress(from); err == nil && addr.Name != "" {
+		return addr.Name
+	}
+	return from
+}
+
+// run processes new matching emails and returns a report ("" when nothing
+// happened).
+func (t *InvoiceInboxTool) run(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.opts.Rules) == 0 {
+		return "", fmt.Errorf("no invoice rules configured (tools.invoices.rules)")
+	}
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+
+	window := invoiceFirstRunWindow
+	if !state.LastRun.IsZero() {
+		// Overlap a little: Gmail's after: is by day and emails can arrive late
+		window = "after:" + state.LastRun.AddDate(0, 0, -2).Format("2006/01/02")
+	}
+	started := t.now()
+
+	var filed, failures []string
+	for i, rule := range t.opts.Rules {
+		ids, err := t.gmail.Search(ctx, fmt.Sprintf("(%s) has:attachment %s", rule.Query, window), maxInvoiceMessages)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: search failed: %v", rule.Name, err))
+			continue
+		}
+		for _, id := range ids {
+			if _, done := state.Processed[id]; done {
+				continue
+			}
+			lines, err := t.fileMessage(ctx, rule, t.patterns[i], id)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", rule.Name, err))
+				// Leave it unprocessed so the next run retries
+				continue
+			}
+			filed = append(filed, lines...)
+			state.Processed[id] = t.now()
+		}
+	}
+
+	for id, at := range state.Processed {
+		if started.Sub(at) > invoiceProcessedRetention {
+			delete(state.Processed, id)
+		}
+	}
+	state.LastRun = started
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+
+	if len(filed) == 0 && len(failures) == 0 {
+		return "", nil
+	}
+	var sb strings.Builder
+	if len(filed) > 0 {
+		fmt.Fprintf(&sb, "🧾 Filed %d invoice(s):\n- %s", len(filed), strings.Join(filed, "\n- "))
+	}
+	if len(failures) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⚠️ %d problem(s):\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return sb.String(), nil
+}
+
+// fileMessage saves the matching attachments of one email and logs them.
+func (t *InvoiceInboxTool) fileMessage(ctx context.Context, rule InvoiceRule, pattern *regexp.Regexp, id string) ([]string, error) {
+	msg, err := t.gmail.GetMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var matching []GmailAttachment
+	for _, att := range msg.Attachments {
+		if pattern.MatchString(att.Filename) {
+			matching = append(matching, att)
+		}
+	}
+	if len(matching) == 0 {
+		// Nothing to file (e.g. only a logo attached); done with this email
+		return nil, nil
+	}
+
+	vendor := t.vendor(rule, msg.From)
+	var lines []string
+	for n, att := range matching {
+		data, err := t.gmail.DownloadAttachment(ctx, id, att)
+		if err != nil {
+			return lines, fmt.Errorf("%s: %w", att.Filename, err)
+		}
+		receipt := t.readReceipt(ctx, att, data)
+		date := msg.Received
+		if !receipt.Date.IsZero() {
+			date = receipt.Date
+		}
+
+		name := invoiceFileName(date, vendor, att.Filename, n, len(matching))
+		file, err := t.drive.Upload(ctx, t.opts.FolderID, name, att.MimeType, data)
+		if err != nil {
+			return lines, fmt.Errorf("%s: %w", name, err)
+		}
+		line := name
+		if file.WebViewLink != "" {
+			line += " " + file.WebViewLink
+		}
+
+		if t.ledger != nil {
+			if receipt.Total > 0 {
+				category := rule.Category
+				if category == "" {
+					category = "bills"
+				}
+				expense := &Expense{
+					Date:     date,
+					Cents:    toCents(receipt.Total),
+					Currency: t.opts.Currency,
+					Category: category,
+					Merchant: vendor,
+					Note:     "invoice " + name,
+				}
+				if err := t.ledger.Add(ctx, expense); err != nil {
+					line += " (not logged: " + err.Error() + ")"
+				} else {
+					line += ", logged " + formatCents(expense.Cents, expense.Currency)
+				}
+			} else {
+				line += " (amount not found; not logged)"
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// readReceipt extracts the invoice text (pdftotext, OCR) and parses the
+// total and date. Failures just mean no amount.
+func (t *InvoiceInboxTool) readReceipt(ctx context.Context, att GmailAttachment, data []byte) Receipt {
+	ext := strings.ToLower(filepath.Ext(att.Filename))
+	isPDF := ext == ".pdf" || att.MimeType == "application/pdf"
+	isImage := strings.HasPrefix(att.MimeType, "image/")
+	if !isPDF && (!isImage || t.ocr == nil || !t.ocr.IsAvailable()) {
+		return Receipt{}
+	}
+	f, err := os.CreateTemp("", "picoclaw-invoice-*"+ext)
+	if err != nil {
+		return Receipt{}
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	f.Close()
+	if err != nil {
+		return Receipt{}
+	}
+
+	var text string
+	if isPDF {
+		text, err = pdfToText(ctx, f.Name())
+	} else {
+		text, err = t.ocr.Recognize(ctx, f.Name())
+	}
+	if err != nil {
+		logger.DebugCF("invoices", "Could not read invoice text", map[string]interface{}{
+			"file":  att.Filename,
+			"error": err.Error(),
+		})
+		return Receipt{}
+	}
+	return ParseReceipt(text)
+}
+
+// invoiceFileName builds "2026-10 Vendor.pdf", numbering files when one
+// email carries several invoices.
+func invoiceFileName(date time.Time, vendor, original string, index, count int) string {
+	vendor = strings.TrimSpace(strings.NewReplacer("/", "-", "\\", "-").Replace(vendor))
+	name := date.Format("2006-01") + " " + vendor
+	if count > 1 {
+		name += fmt.Sprintf(" %d", index+1)
+	}
+	return name + strings.ToLower(filepath.Ext(original))
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeOCR struct{ text string }
+
+func (f fakeOCR) Recognize(ctx context.Context, imagePath string) (string, error) { return f.text, nil }
+func (f fakeOCR) IsAvailable() bool                                               { return true }
+
+type memoryLedger struct{ expenses []Expense }
+
+func (l *memoryLedger) Add(ctx context.Context, e *Expense) error {
+	l.expenses = append(l.expenses, *e)
+	return nil
+}
+
+func (l *memoryLedger) List(ctx context.Context, from, to time.Time) ([]Expense, error) {
+	return l.expenses, nil
+}
+
+// TestInvoiceInboxTool_FilesAndLogsOnce verifies matching attachments are saved to Drive, logged and not filed twice
+func TestInvoiceInboxTool_FilesAndLogsOnce(t *testing.T) {
+	var queries, uploads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gmail/users/me/messages":
+			queries = append(queries, r.URL.Query().Get("q"))
+			w.Write([]byte(`{"messages":[{"id":"m1"}]}`))
+		case r.URL.Path == "/gmail/users/me/messages/m1":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"internalDate": "1790000000000",
+				"payload": map[string]interface{}{
+					"headers": []map[string]string{{"name": "From", "value": "ACME Billing <billing@acme.test>"}},
+					"parts": []map[string]interface{}{
+						{"mimeType": "image/png", "filename": "logo.gif", "body": map[string]string{"data": "eA=="}},
+						{"mimeType": "image/jpeg", "filename": "Invoice-0042.JPG", "body": map[string]interface{}{"attachmentId": "a1", "size": 5}},
+					},
+				},
+			})
+		case r.URL.Path == "/gmail/users/me/messages/m1/attachments/a1":
+			json.NewEncoder(w).Encode(map[string]string{"data": base64.URLEncoding.EncodeToString([]byte("image"))})
+		case r.URL.Path == "/upload/files":
+			body, _ := io.ReadAll(r.Body)
+			uploads = append(uploads, string(body))
+			w.Write([]byte(`{"id":"d1","webViewLink":"https://drive/d1"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ledger := &memoryLedger{}
+	opts := InvoiceInboxOptions{
+		FolderID: "folder1",
+		Currency: "EUR",
+		Rules:    []InvoiceRule{{Name: "acme", Query: "from:billing@acme.test", Vendor: "ACME", Category: "software"}},
+	}
+	tool := NewInvoiceInboxTool(func(ctx context.Context) (string, error) { return "tok", nil }, t.TempDir(), opts, ledger,
+		fakeOCR{text: "ACME Corp\nSubtotal 35.00\nTotal 42.50\nDate 2026-09-30"})
+	tool.gmail.baseURL = server.URL + "/gmail"
+	tool.drive.uploadURL = server.URL + "/upload"
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "run"})
+	if r.IsError || !strings.Contains(r.ForLLM, "2026-09 ACME.jpg https://drive/d1, logged 42.50 EUR") {
+		t.Fatalf("unexpected report: %s", r.ForLLM)
+	}
+	if len(uploads) != 1 || !strings.Contains(uploads[0], `"parents":["folder1"]`) || !strings.Contains(uploads[0], "image") {
+		t.Fatalf("unexpected uploads: %q", uploads)
+	}
+	if len(ledger.expenses) != 1 || ledger.expenses[0].Category != "software" || ledger.expenses[0].Cents != 4250 {
+		t.Fatalf("unexpected ledger: %+v", ledger.expenses)
+	}
+	if !strings.Contains(queries[0], "newer_than:60d") {
+		t.Errorf("first run should look back 60 days: %q", queries[0])
+	}
+
+	// The same email is found again but already filed
+	out, err := tool.ExecuteJob(context.Background(), nil)
+	if err != nil || out != "" || len(uploads) != 1 {
+		t.Fatalf("second run = %q, %v (%d uploads)", out, err, len(uploads))
+	}
+	if !strings.Contains(queries[1], "after:") {
+		t.Errorf("later runs should search after the last run: %q", queries[1])
+	}
+}
+
+// TestInvoiceFileName verifies names are normalized and numbered
+func TestInvoiceFileName(t *testing.T) {
+	date := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	if got := invoiceFileName(date, " Foo/Bar ", "x.PDF", 0, 1); got != "2026-03 Foo-Bar.pdf" {
+		t.Errorf("got %q", got)
+	}
+	if got := invoiceFileName(date, "Foo", "x.pdf", 1, 2); got != "2026-03 Foo 2.pdf" {
+		t.Errorf("got %q", got)
+	}
+}
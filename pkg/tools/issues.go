@@ -0,0 +1,637 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Issue is a provider-neutral view of a tracker issue.
+type Issue struct {
+	Key    string
+	Title  string
+	State  string
+	URL    string
+	Assign string
+}
+
+// IssueDraft describes an issue to be created.
+type IssueDraft struct {
+	Title       string
+	Description string
+	Labels      []string
+}
+
+// IssueProject binds a user-facing project alias to a tracker project.
+type IssueProject struct {
+	Name      string
+	Provider  string
+	Project   string
+	IssueType string
+	Labels    []string
+}
+
+// IssueTracker is implemented by each issue tracker backend (Jira, Linear).
+type IssueTracker interface {
+	Search(ctx context.Context, project IssueProject, query string, limit int) ([]Issue, error)
+	Create(ctx context.Context, project IssueProject, draft IssueDraft) (*Issue, error)
+	Transition(ctx context.Context, project IssueProject, key, state string) error
+	Comment(ctx context.Context, project IssueProject, key, body string) error
+}
+
+// JiraTracker talks to the Jira Cloud REST API v3 using basic auth (email + API token).
+type JiraTracker struct {
+	baseURL  string
+	email    string
+	apiToken string
+	client   *http.Client
+}
+
+func NewJiraTracker(baseURL, email, apiToken string) *JiraTracker {
+	return &JiraTracker{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		email:    email,
+		apiToken: apiToken,
+		client:   &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (j *JiraTracker) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, j.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(j.email, j.apiToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Jira API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (j *JiraTracker) browseURL(key string) string {
+	return j.baseURL + "/browse/" + key
+}
+
+// jiraDoc wraps plain text in the Atlassian Document Format required by API v3.
+func jiraDoc(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "doc",
+		"version": 1,
+		"content": []interface{}{
+			map[string]interface{}{
+				"type": "paragraph",
+				"content": []interface{}{
+					map[string]interface{}{"type": "text", "text": text},
+				},
+			},
+		},
+	}
+}
+
+func (j *JiraTracker) Search(ctx context.Context, project IssueProject, query string, limit int) ([]Issue, error) {
+	jql := fmt.Sprintf("project = %q", project.Project)
+	if query != "" {
+		jql += fmt.Sprintf(" AND text ~ %q", query)
+	}
+	jql += " ORDER BY updated DESC"
+
+	params := url.Values{}
+	params.Set("jql", jql)
+	params.Set("maxResults", fmt.Sprintf("%d", limit))
+	params.Set("fields", "summary,status,assignee")
+
+	var resp struct {
+		Issues []struct {
+			Key    string `json:"key"`
+			Fields struct {
+				Summary string `json:"summary"`
+				Status  struct {
+					Name string `json:"name"`
+				} `json:"status"`
+				Assignee *struct {
+					DisplayName string `json:"displayName"`
+				} `json:"assignee"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	if err := j.do(ctx, http.MethodGet, "/rest/api/3/search?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	issues := make([]Issue, 0, len(resp.Issues))
+	for _, it := range resp.Issues {
+		issue := Issue{
+			Key:   it.Key,
+			Title: it.Fields.Summary,
+			State: it.Fields.Status.Name,
+			URL:   j.browseURL(it.Key),
+		}
+		if it.Fields.Assignee != nil {
+			issue.Assign = it.Fields.Assignee.DisplayName
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func (j *JiraTracker) Create(ctx context.Context, project IssueProject, draft IssueDraft) (*Issue, error) {
+	issueType := project.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+
+	fields := map[string]interface{}{
+		"project":   map[string]interface{}{"key": project.Project},
+		"summary":   draft.Title,
+		"issuetype": map[string]interface{}{"name": issueType},
+	}
+	if draft.Description != "" {
+		fields["description"] = jiraDoc(draft.Description)
+	}
+	if len(draft.Labels) > 0 {
+		fields["labels"] = draft.Labels
+	}
+
+	var resp struct {
+		Key string `json:"key"`
+	}
+	if err := j.do(ctx, http.MethodPost, "/rest/api/3/issue", map[string]interface{}{"fields": fields}, &resp); err != nil {
+		return nil, err
+	}
+
+	return &Issue{Key: resp.Key, Title: draft.Title, URL: j.browseURL(resp.Key)}, nil
+}
+
+func (j *JiraTracker) Transition(ctx context.Context, project IssueProject, key, state string) error {
+	var resp struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	path := "/rest/api/3/issue/" + url.PathEscape(key) + "/transitions"
+	if err := j.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return err
+	}
+
+	available := make([]string, 0, len(resp.Transitions))
+	for _, tr := range resp.Transitions {
+		if strings.EqualFold(tr.Name, state) || strings.EqualFold(tr.To.Name, state) {
+			body := map[string]interface{}{"transition": map[string]interface{}{"id": tr.ID}}
+			return j.do(ctx, http.MethodPost, path, body, nil)
+		}
+		available = append(available, tr.To.Name)
+	}
+	return fmt.Errorf("no transition to %q for %s (available: %s)", state, key, strings.Join(available, ", "))
+}
+
+func (j *JiraTracker) Comment(ctx context.Context, project IssueProject, key, body string) error {
+	path := "/rest/api/3/issue/" + url.PathEscape(key) + "/comment"
+	return j.do(ctx, http.MethodPost, path, map[string]interface{}{"body": jiraDoc(body)}, nil)
+}
+
+// LinearTracker talks to the Linear GraphQL API using a personal API key.
+type LinearTracker struct {
+	apiURL string
+	apiKey string
+	client *http.Client
+}
+
+func NewLinearTracker(apiKey string) *LinearTracker {
+	return &LinearTracker{
+		apiURL: "https://api.linear.app/graphql",
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (l *LinearTracker) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", l.apiKey)
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Linear API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(envelope.Errors) > 0 {
+		return fmt.Errorf("Linear API error: %s", envelope.Errors[0].Message)
+	}
+	if out != nil {
+		if err := json.Unmarshal(envelope.Data, out); err != nil {
+			return fmt.Errorf("failed to parse response data: %w", err)
+		}
+	}
+	return nil
+}
+
+type linearIssueNode struct {
+	Identifier string `json:"identifier"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	State      struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Assignee *struct {
+		Name string `json:"name"`
+	} `json:"assignee"`
+}
+
+func (n linearIssueNode) toIssue() Issue {
+	issue := Issue{Key: n.Identifier, Title: n.Title, State: n.State.Name, URL: n.URL}
+	if n.Assignee != nil {
+		issue.Assign = n.Assignee.Name
+	}
+	return issue
+}
+
+func (l *LinearTracker) Search(ctx context.Context, project IssueProject, query string, limit int) ([]Issue, error) {
+	filter := map[string]interface{}{
+		"team": map[string]interface{}{"key": map[string]interface{}{"eq": project.Project}},
+	}
+	if query != "" {
+		filter["title"] = map[string]interface{}{"containsIgnoreCase": query}
+	}
+
+	var resp struct {
+		Issues struct {
+			Nodes []linearIssueNode `json:"nodes"`
+		} `json:"issues"`
+	}
+	err := l.query(ctx, `query($filter: IssueFilter, $first: Int) {
+  issues(filter: $filter, first: $first, orderBy: updatedAt) {
+    nodes { identifier title url state { name } assignee { name } }
+  }
+}`, map[string]interface{}{"filter": filter, "first": limit}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]Issue, 0, len(resp.Issues.Nodes))
+	for _, n := range resp.Issues.Nodes {
+		issues = append(issues, n.toIssue())
+	}
+	return issues, nil
+}
+
+func (l *LinearTracker) teamID(ctx context.Context, teamKey string) (string, error) {
+	var resp struct {
+		Teams struct {
+			Nodes []struct {
+				ID string `json:"id"`
+			} `json:"nodes"`
+		} `json:"teams"`
+	}
+	err := l.query(ctx, `query($key: String!) { teams(filter: { key: { eq: $key } }) { nodes { id } } }`,
+		map[string]interface{}{"key": teamKey}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Teams.Nodes) == 0 {
+		return "", fmt.Errorf("Linear team %q not found", teamKey)
+	}
+	return resp.Teams.Nodes[0].ID, nil
+}
+
+func (l *LinearTracker) Create(ctx context.Context, project IssueProject, draft IssueDraft) (*Issue, error) {
+	teamID, err := l.teamID(ctx, project.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]interface{}{
+		"teamId": teamID,
+		"title":  draft.Title,
+	}
+	if draft.Description != "" {
+		input["description"] = draft.Description
+	}
+
+	var resp struct {
+		IssueCreate struct {
+			Success bool            `json:"success"`
+			Issue   linearIssueNode `json:"issue"`
+		} `json:"issueCreate"`
+	}
+	err = l.query(ctx, `mutation($input: IssueCreateInput!) {
+  issueCreate(input: $input) {
+    success
+    issue { identifier title url state { name } assignee { name } }
+  }
+}`, map[string]interface{}{"input": input}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IssueCreate.Success {
+		return nil, fmt.Errorf("Linear rejected issue creation")
+	}
+
+	issue := resp.IssueCreate.Issue.toIssue()
+	return &issue, nil
+}
+
+func (l *LinearTracker) Transition(ctx context.Context, project IssueProject, key, state string) error {
+	var resp struct {
+		Issue struct {
+			ID   string `json:"id"`
+			Team struct {
+				States struct {
+					Nodes []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"nodes"`
+				} `json:"states"`
+			} `json:"team"`
+		} `json:"issue"`
+	}
+	err := l.query(ctx, `query($id: String!) {
+  issue(id: $id) { id team { states { nodes { id name } } } }
+}`, map[string]interface{}{"id": key}, &resp)
+	if err != nil {
+		return err
+	}
+
+	available := make([]string, 0, len(resp.Issue.Team.States.Nodes))
+	for _, st := range resp.Issue.Team.States.Nodes {
+		if strings.EqualFold(st.Name, state) {
+			return l.query(ctx, `mutation($id: String!, $stateId: String!) {
+  issueUpdate(id: $id, input: { stateId: $stateId }) { success }
+}`, map[string]interface{}{"id": resp.Issue.ID, "stateId": st.ID}, nil)
+		}
+		available = append(available, st.Name)
+	}
+	return fmt.Errorf("no state %q for %s (available: %s)", state, key, strings.Join(available, ", "))
+}
+
+func (l *LinearTracker) Comment(ctx context.Context, project IssueProject, key, body string) error {
+	return l.query(ctx, `mutation($issueId: String!, $body: String!) {
+  commentCreate(input: { issueId: $issueId, body: $body }) { success }
+}`, map[string]interface{}{"issueId": key, "body": body}, nil)
+}
+
+// IssuesTool exposes configured Jira/Linear projects to the agent.
+type IssuesTool struct {
+	projects []IssueProject
+	trackers map[string]IssueTracker // keyed by provider name
+}
+
+func NewIssuesTool(projects []IssueProject, trackers map[string]IssueTracker) *IssuesTool {
+	return &IssuesTool{
+		projects: projects,
+		trackers: trackers,
+	}
+}
+
+func (t *IssuesTool) Name() string {
+	return "issues"
+}
+
+func (t *IssuesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "create", "transition", "comment")
+}
+
+// Untrusted reports that searches return issue titles and text anyone
+// with access to the tracker wrote.
+func (t *IssuesTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "search")
+}
+
+func (t *IssuesTool) Description() string {
+	names := make([]string, 0, len(t.projects))
+	for _, p := range t.projects {
+		names = append(names, fmt.Sprintf("%s (%s)", p.Name, p.Provider))
+	}
+	return "Search, create, transition and comment on issues in Jira/Linear. Configured projects: " + strings.Join(names, ", ")
+}
+
+func (t *IssuesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"search", "create", "transition", "comment"},
+				"description": "Action to perform",
+			},
+			"project": map[string]interface{}{
+				"type":        "string",
+				"description": "Configured project name. Defaults to the first configured project.",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Free-text query (for search)",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Issue title (for create)",
+			},
+			"description": map[string]interface{}{
+				"type":        "string",
+				"description": "Issue description (for create)",
+			},
+			"issue": map[string]interface{}{
+				"type":        "string",
+				"description": "Issue key, e.g. OPS-123 or ENG-42 (for transition/comment)",
+			},
+			"state": map[string]interface{}{
+				"type":        "string",
+				"description": "Target workflow state, e.g. 'In Progress' or 'Done' (for transition)",
+			},
+			"comment": map[string]interface{}{
+				"type":        "string",
+				"description": "Comment text (for comment)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum results for search (1-50, default 10)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *IssuesTool) resolveProject(name string) (IssueProject, IssueTracker, error) {
+	if len(t.projects) == 0 {
+		return IssueProject{}, nil, fmt.Errorf("no issue tracker projects configured")
+	}
+
+	project := t.projects[0]
+	if name != "" {
+		found := false
+		for _, p := range t.projects {
+			if strings.EqualFold(p.Name, name) || strings.EqualFold(p.Project, name) {
+				project = p
+				found = true
+				break
+			}
+		}
+		if !found {
+			return IssueProject{}, nil, fmt.Errorf("unknown project %q", name)
+		}
+	}
+
+	tracker, ok := t.trackers[project.Provider]
+	if !ok {
+		return IssueProject{}, nil, fmt.Errorf("provider %q for project %s is not configured", project.Provider, project.Name)
+	}
+	return project, tracker, nil
+}
+
+func (t *IssuesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	projectName, _ := args["project"].(string)
+	project, tracker, err := t.resolveProject(projectName)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	switch action {
+	case "search":
+		return t.search(ctx, project, tracker, args)
+	case "create":
+		return t.create(ctx, project, tracker, args)
+	case "transition":
+		key, _ := args["issue"].(string)
+		state, _ := args["state"].(string)
+		if key == "" || state == "" {
+			return ErrorResult("issue and state are required for transition")
+		}
+		if err := tracker.Transition(ctx, project, key, state); err != nil {
+			return ErrorResult(fmt.Sprintf("transition failed: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("%s moved to %s", key, state))
+	case "comment":
+		key, _ := args["issue"].(string)
+		body, _ := args["comment"].(string)
+		if key == "" || body == "" {
+			return ErrorResult("issue and comment are required for comment")
+		}
+		if err := tracker.Comment(ctx, project, key, body); err != nil {
+			return ErrorResult(fmt.Sprintf("comment failed: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Comment added to %s", key))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *IssuesTool) search(ctx context.Context, project IssueProject, tracker IssueTracker, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	limit := 10
+	if l, ok := args["limit"].(float64); ok && int(l) > 0 && int(l) <= 50 {
+		limit = int(l)
+	}
+
+	issues, err := tracker.Search(ctx, project, query, limit)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("search failed: %v", err)).WithError(err)
+	}
+	if len(issues) == 0 {
+		return SilentResult(fmt.Sprintf("No issues found in %s", project.Name))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Issues in %s:\n", project.Name)
+	for _, issue := range issues {
+		fmt.Fprintf(&sb, "- %s [%s] %s", issue.Key, issue.State, issue.Title)
+		if issue.Assign != "" {
+			fmt.Fprintf(&sb, " (assignee: %s)", issue.Assign)
+		}
+		if issue.URL != "" {
+			fmt.Fprintf(&sb, "\n  %s", issue.URL)
+		}
+		sb.WriteString("\n")
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *IssuesTool) create(ctx context.Context, project IssueProject, tracker IssueTracker, args map[string]interface{}) *ToolResult {
+	title, _ := args["title"].(string)
+	if title == "" {
+		return ErrorResult("title is required for create")
+	}
+	description, _ := args["description"].(string)
+
+	issue, err := tracker.Create(ctx, project, IssueDraft{
+		Title:       title,
+		Description: description,
+		Labels:      project.Labels,
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("create failed: %v", err)).WithError(err)
+	}
+	return SilentResult(fmt.Sprintf("Created %s: %s\n%s", issue.Key, issue.Title, issue.URL))
+}
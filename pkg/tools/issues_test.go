@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestIssuesTool_JiraSearch verifies JQL construction and result formatting
+func TestIssuesTool_JiraSearch(t *testing.T) {
+	var gotJQL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "me@example.com" || pass != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		gotJQL = r.URL.Query().Get("jql")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issues":[{"key":"OPS-1","fields":{"summary":"Disk full","status":{"name":"To Do"},"assignee":{"displayName":"Ana"}}}]}`))
+	}))
+	defer server.Close()
+
+	tool := NewIssuesTool(
+		[]IssueProject{{Name: "ops", Provider: "jira", Project: "OPS"}},
+		map[string]IssueTracker{"jira": NewJiraTracker(server.URL, "me@example.com", "tok")},
+	)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "search",
+		"query":  "disk",
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !strings.Contains(gotJQL, `project = "OPS"`) || !strings.Contains(gotJQL, `text ~ "disk"`) {
+		t.Errorf("Unexpected JQL: %s", gotJQL)
+	}
+	if !strings.Contains(result.ForLLM, "OPS-1") || !strings.Contains(result.ForLLM, "Ana") {
+		t.Errorf("Expected issue in result, got: %s", result.ForLLM)
+	}
+}
+
+// TestIssuesTool_JiraTransitionByStateName verifies transitions are matched by target state
+func TestIssuesTool_JiraTransitionByStateName(t *testing.T) {
+	var posted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"transitions":[{"id":"11","name":"Start","to":{"name":"In Progress"}},{"id":"31","name":"Finish","to":{"name":"Done"}}]}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&posted)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tool := NewIssuesTool(
+		[]IssueProject{{Name: "ops", Provider: "jira", Project: "OPS"}},
+		map[string]IssueTracker{"jira": NewJiraTracker(server.URL, "me@example.com", "tok")},
+	)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "transition",
+		"issue":  "OPS-1",
+		"state":  "done",
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	transition, _ := posted["transition"].(map[string]interface{})
+	if transition["id"] != "31" {
+		t.Errorf("Expected transition id 31, got %v", posted)
+	}
+}
+
+// TestIssuesTool_LinearCreate verifies team lookup followed by issueCreate
+func TestIssuesTool_LinearCreate(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "lin_key" {
+			t.Errorf("Expected API key header, got %q", r.Header.Get("Authorization"))
+		}
+		var req struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Query, "teams") {
+			w.Write([]byte(`{"data":{"teams":{"nodes":[{"id":"team-1"}]}}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"issueCreate":{"success":true,"issue":{"identifier":"ENG-7","title":"Fix login","url":"https://linear.app/x/ENG-7","state":{"name":"Backlog"}}}}}`))
+	}))
+	defer server.Close()
+
+	tracker := NewLinearTracker("lin_key")
+	tracker.apiURL = server.URL
+
+	tool := NewIssuesTool(
+		[]IssueProject{{Name: "eng", Provider: "linear", Project: "ENG"}},
+		map[string]IssueTracker{"linear": tracker},
+	)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":  "create",
+		"project": "eng",
+		"title":   "Fix login",
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 API calls, got %d", calls)
+	}
+	if !strings.Contains(result.ForLLM, "ENG-7") {
+		t.Errorf("Expected created key in result, got: %s", result.ForLLM)
+	}
+}
+
+// TestIssuesTool_UnknownProject verifies project validation
+func TestIssuesTool_UnknownProject(t *testing.T) {
+	tool := NewIssuesTool(
+		[]IssueProject{{Name: "ops", Provider: "jira", Project: "OPS"}},
+		map[string]IssueTracker{"jira": NewJiraTracker("http://unused", "", "")},
+	)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":  "search",
+		"project": "nope",
+	})
+
+	if !result.IsError {
+		t.Error("Expected error for unknown project")
+	}
+}
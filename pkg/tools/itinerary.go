@@ -0,0 +1,761 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	itineraryJobKind = "itinerary"
+	// itineraryQuery finds booking confirmations; runs add a date window
+	itineraryQuery = "{subject:confirmation subject:confirmed subject:itinerary subject:booking subject:reservation subject:e-ticket subject:boarding}"
+	// itineraryFirstRunWindow is how far back the first run looks
+	itineraryFirstRunWindow = "newer_than:60d"
+	// maxItineraryMessages bounds the emails read per run
+	maxItineraryMessages = 30
+	// tripGap is how far apart bookings can be and still be one trip
+	tripGap = 2 * 24 * time.Hour
+	// forecastDays is how far ahead wttr.in forecasts
+	forecastDays = 3
+	// itineraryRetention is how long trips are kept after they end
+	itineraryRetention = 90 * 24 * time.Hour
+)
+
+const itineraryPrompt = `You read travel booking emails. Return ONLY a JSON array (no prose, no code fences). Each element:
+{"kind": "flight|train|bus|ferry|hotel|car|activity|cancelled", "title": "...", "start": "YYYY-MM-DDTHH:MM or YYYY-MM-DD", "end": "same formats or empty", "timezone": "IANA zone of where it starts, or empty if unknown", "city": "...", "location": "...", "reference": "booking reference or empty", "notes": "..."}
+Rules:
+- One element per flight or train leg, hotel stay, car rental or booked activity. Title like "Flight TP 1234 LIS → JFK", "Hotel Avenida (2 nights)", "Car rental Hertz".
+- city is where the booking takes the traveller: the arrival city of a journey, the city of a hotel, rental or activity.
+- Hotels: start is check-in, end is check-out. Put seats, terminals, room type and addresses in notes.
+- A cancellation is one element of kind "cancelled" with the reference (and title) of what was cancelled.
+- Ignore marketing, receipts for anything else and bookings that already took place. Never invent dates or times. Return [] if there is nothing.`
+
+// itineraryItem is one booking in a trip, read from a confirmation email.
+type itineraryItem struct {
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	AllDay    bool      `json:"all_day,omitempty"`
+	City      string    `json:"city,omitempty"`
+	Location  string    `json:"location,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	// Source is the Gmail message the booking came from
+	Source string `json:"source"`
+}
+
+// trip is a run of bookings close together, with the Doc it is written
+// to.
+type trip struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	City    string          `json:"city"`
+	Start   time.Time       `json:"start"`
+	End     time.Time       `json:"end"`
+	Items   []itineraryItem `json:"items"`
+	DocID   string          `json:"doc_id,omitempty"`
+	DocLink string          `json:"doc_link,omitempty"`
+	// Rendered is the Doc's text when it was last written
+	Rendered string `json:"rendered,omitempty"`
+	// DocVersion is the Doc's version when it held Rendered; Held is the
+	// version with edits made in Drive that the last sync did not
+	// overwrite, and was reported for
+	DocVersion string `json:"doc_version,omitempty"`
+	Held       string `json:"held,omitempty"`
+}
+
+type itineraryState struct {
+	Trips     []*trip              `json:"trips"`
+	Processed map[string]time.Time `json:"processed"`
+	LastRun   time.Time            `json:"last_run"`
+}
+
+// ItineraryOptions configures the itinerary builder.
+type ItineraryOptions struct {
+	// Query replaces the Gmail search for confirmation emails
+	Query string
+	// FolderID is the Drive folder trip Docs go to ("" for My Drive)
+	FolderID   string
+	CalendarID string
+}
+
+// ItineraryTool gathers flight, train, hotel and car confirmations from
+// Gmail into trips, and keeps a Google Doc per trip with the bookings day
+// by day, the calendar entries of those days and the forecast at the
+// destination. A schedule in a chat keeps the Docs current as new
+// confirmations arrive.
+type ItineraryTool struct {
+	gmail      *GmailClient
+	calendar   *GoogleCalendarClient
+	drive      *GoogleDriveClient
+	provider   providers.LLMProvider
+	model      string
+	profiles   *profile.Store
+	opts       ItineraryOptions
+	weather    *http.Client
+	weatherURL string
+	statePath  string
+	scheduler  *cron.CronService
+	mu         sync.Mutex
+	now        func() time.Time
+}
+
+func NewItineraryTool(token TokenFunc, provider providers.LLMProvider, model, workspace string, opts ItineraryOptions, profiles *profile.Store) *ItineraryTool {
+	if opts.Query == "" {
+		opts.Query = itineraryQuery
+	}
+	if opts.CalendarID == "" {
+		opts.CalendarID = "primary"
+	}
+	return &ItineraryTool{
+		gmail:      NewGmailClient(token),
+		calendar:   NewGoogleCalendarClient(token),
+		drive:      NewGoogleDriveClient(token),
+		provider:   provider,
+		model:      model,
+		profiles:   profiles,
+		opts:       opts,
+		weather:    &http.Client{Timeout: 15 * time.Second},
+		weatherURL: "https://wttr.in",
+		statePath:  filepath.Join(workspace, "state", "itineraries.json"),
+		now:        time.Now,
+	}
+}
+
+func (t *ItineraryTool) Name() string {
+	return "itinerary"
+}
+
+func (t *ItineraryTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "sync", "share", "schedule", "unschedule")
+}
+
+// Untrusted reports that trips carry text read from confirmation emails.
+func (t *ItineraryTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "sync", "list", "show", "share")
+}
+
+func (t *ItineraryTool) Description() string {
+	return "Travel itineraries: gather flight, train, hotel and car rental confirmation emails into trips, each with a Google Doc listing the bookings day by day with that day's calendar entries and the destination's weather. " +
+		"Sync now, schedule syncing in this chat so new confirmations update the Docs, list trips, show one, or share its Doc with someone by email. " +
+		"Docs edited in Drive are not overwritten; sync says which ones, and sync with overwrite replaces them only once the user agrees."
+}
+
+func (t *ItineraryTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"sync", "list", "show", "share", "schedule", "unschedule"},
+				"description": "Action to perform",
+			},
+			"trip": map[string]interface{}{
+				"type":        "string",
+				"description": "show/share: trip ID or destination (default: the next trip)",
+			},
+			"email": map[string]interface{}{
+				"type":        "string",
+				"description": "share: address to give read access to the trip's Doc",
+			},
+			"overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "sync: replace trip Docs edited in Drive since they were last written, dropping those edits",
+			},
+			"every_hours": map[string]interface{}{
+				"type":        "integer",
+				"description": "schedule: how often to look for new confirmations (default 6)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ItineraryTool) JobKinds() []string {
+	return []string{itineraryJobKind}
+}
+
+func (t *ItineraryTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *ItineraryTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	loc := t.location(channel + ":" + chatID)
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "sync":
+		overwrite, _ := args["overwrite"].(bool)
+		report, err := t.sync(ctx, loc, overwrite)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("itinerary sync failed: %v", err)).WithError(err)
+		}
+		if report == "" {
+			report = "No new travel confirmations; itineraries are up to date."
+		}
+		return NewToolResult(report)
+
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("itinerary scheduling is not available (scheduler not running)")
+		}
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		hours := 6
+		if h, ok := args["every_hours"].(float64); ok && h >= 1 {
+			hours = int(h)
+		}
+		t.unschedule()
+		everyMS := (time.Duration(hours) * time.Hour).Milliseconds()
+		job, err := t.scheduler.AddJobWithPayload("Travel itineraries", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    itineraryJobKind,
+			Message: "Travel itineraries",
+			Channel: channel,
+			To:      chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Itineraries sync every %dh (id: %s); changes to trips will be reported here.", hours, job.ID))
+
+	case "unschedule":
+		if t.scheduler == nil {
+			return ErrorResult("itinerary scheduling is not available (scheduler not running)")
+		}
+		if t.unschedule() == 0 {
+			return SilentResult("Itinerary syncing was not scheduled")
+		}
+		return SilentResult("Itinerary sync schedule removed")
+
+	case "list":
+		t.mu.Lock()
+		state, err := t.loadState()
+		t.mu.Unlock()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if len(state.Trips) == 0 {
+			return SilentResult("No trips found yet. Run sync to read travel confirmations from Gmail.")
+		}
+		var sb strings.Builder
+		sb.WriteString("Trips:")
+		for _, tr := range state.Trips {
+			fmt.Fprintf(&sb, "\n- %s [%s]: %s, %d booking(s)", tr.Name, tr.ID, tripDates(tr, loc), len(tr.Items))
+			if tr.DocLink != "" {
+				sb.WriteString(" " + tr.DocLink)
+			}
+		}
+		return SilentResult(sb.String())
+
+	case "show", "share":
+		ref, _ := args["trip"].(string)
+		t.mu.Lock()
+		state, err := t.loadState()
+		t.mu.Unlock()
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		tr := findTrip(state.Trips, ref, t.now())
+		if tr == nil {
+			return ErrorResult(fmt.Sprintf("no trip matching %q; list shows the trips", ref))
+		}
+		if action == "show" {
+			text := tr.Rendered
+			if text == "" {
+				text = t.render(ctx, tr, loc)
+			}
+			if tr.DocLink != "" {
+				text += "\nDoc: " + tr.DocLink
+			}
+			return SilentResult(text)
+		}
+		email, _ := args["email"].(string)
+		email = strings.TrimSpace(email)
+		if email == "" {
+			return ErrorResult("email is required for share")
+		}
+		if tr.DocID == "" {
+			return ErrorResult(fmt.Sprintf("%s has no Doc yet; run sync first", tr.Name))
+		}
+		if err := t.drive.Share(ctx, tr.DocID, email); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to share the itinerary: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Shared the itinerary for %s with %s (read only); Drive emailed them the link: %s", tr.Name, email, tr.DocLink))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// unschedule removes existing itinerary jobs; the trips are the user's,
+// so one schedule is enough.
+func (t *ItineraryTool) unschedule() int {
+	removed := 0
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == itineraryJobKind && t.scheduler.RemoveJob(job.ID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ExecuteJob implements ScheduledTool. It reports only trips that
+// changed.
+func (t *ItineraryTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.sync(ctx, t.location(job.Payload.Channel+":"+job.Payload.To), false)
+}
+
+func (t *ItineraryTool) location(chat string) *time.Location {
+	if t.profiles == nil || chat == ":" {
+		return time.Local
+	}
+	return t.profiles.Get(chat).Location()
+}
+
+// sync reads new confirmation emails into trips and rewrites the Docs of
+// trips that changed, or whose forecast may have. Docs edited in Drive
+// are left as they are unless overwrite.
+func (t *ItineraryTool) sync(ctx context.Context, loc *time.Location, overwrite bool) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	window := itineraryFirstRunWindow
+	if !state.LastRun.IsZero() {
+		// Gmail's after: is by day and emails can arrive late
+		window = "after:" + state.LastRun.AddDate(0, 0, -2).Format("2006/01/02")
+	}
+	started := t.now()
+
+	ids, err := t.gmail.Search(ctx, fmt.Sprintf("(%s) %s", t.opts.Query, window), maxItineraryMessages)
+	if err != nil {
+		return "", fmt.Errorf("failed to search Gmail: %w", err)
+	}
+	changed := map[*trip][]string{}
+	var failures []string
+	for _, id := range ids {
+		if _, done := state.Processed[id]; done {
+			continue
+		}
+		msg, err := t.gmail.GetMessage(ctx, id)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("reading email %s: %v", id, err))
+			continue
+		}
+		items, err := t.extract(ctx, msg, loc)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%q: %v", msg.Subject, err))
+			continue
+		}
+		for _, item := range items {
+			if tr, line := state.apply(item); tr != nil {
+				changed[tr] = append(changed[tr], line)
+			}
+		}
+		state.Processed[id] = t.now()
+	}
+
+	// Trips in the forecast window get their weather refreshed
+	var lines []string
+	for _, tr := range state.Trips {
+		soon := tr.Start.Before(started.AddDate(0, 0, forecastDays)) && tr.End.After(started)
+		held := overwrite && tr.Held != ""
+		if len(changed[tr]) == 0 && !soon && !held && tr.DocID != "" {
+			continue
+		}
+		rendered := t.render(ctx, tr, loc)
+		if rendered == tr.Rendered && tr.DocID != "" {
+			continue
+		}
+		if err := t.writeDoc(ctx, tr, rendered, overwrite); err != nil {
+			var conflict *DriveConflictError
+			if errors.As(err, &conflict) {
+				// Told once for each edit, not at every sync
+				if conflict.Version != tr.Held {
+					tr.Held = conflict.Version
+					failures = append(failures, fmt.Sprintf("%s: the Doc was %s, so it was not updated; sync with overwrite replaces it, dropping those edits", tr.Name, conflict.Edit()))
+				}
+				continue
+			}
+			failures = append(failures, fmt.Sprintf("%s: writing the Doc failed: %v", tr.Name, err))
+			continue
+		}
+		if len(changed[tr]) > 0 {
+			lines = append(lines, fmt.Sprintf("%s (%s): %s %s", tr.Name, tripDates(tr, loc), strings.Join(changed[tr], "; "), tr.DocLink))
+		}
+	}
+
+	for id, at := range state.Processed {
+		if started.Sub(at) > invoiceProcessedRetention {
+			delete(state.Processed, id)
+		}
+	}
+	kept := state.Trips[:0]
+	for _, tr := range state.Trips {
+		if started.Sub(tr.End) < itineraryRetention {
+			kept = append(kept, tr)
+		}
+	}
+	state.Trips = kept
+	state.LastRun = started
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if len(lines) > 0 {
+		fmt.Fprintf(&sb, "🧳 Itineraries updated:\n- %s", strings.Join(lines, "\n- "))
+	}
+	if len(failures) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⚠️ %d problem(s):\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return sb.String(), nil
+}
+
+// extract asks the model for the bookings in a confirmation email.
+func (t *ItineraryTool) extract(ctx context.Context, msg *GmailMessage, loc *time.Location) ([]itineraryItem, error) {
+	text := fmt.Sprintf("From: %s\nSubject: %s\nDate: %s\n\n%s", msg.From, msg.Subject, msg.Date, msg.Text)
+	if len(text) > maxExtractChars {
+		text = text[:maxExtractChars]
+	}
+	messages := []providers.Message{
+		{Role: "system", Content: itineraryPrompt + "\n\n" + quotedDocumentNote},
+		{Role: "user", Content: fmt.Sprintf("Today is %s (user timezone %s).\n\n%s", t.now().In(loc).Format("Monday 2006-01-02"), loc.String(), QuoteUntrusted(t.Name(), text))},
+	}
+	resp, err := t.provider.Chat(ctx, messages, nil, t.model, map[string]interface{}{
+		"max_tokens":  1500,
+		"temperature": 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw := resp.Content
+	start, end := strings.Index(raw, "["), strings.LastIndex(raw, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("model returned no booking list")
+	}
+	var extracted []struct {
+		extractedEvent
+		City      string `json:"city"`
+		Reference string `json:"reference"`
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &extracted); err != nil {
+		return nil, fmt.Errorf("model returned invalid bookings: %w", err)
+	}
+
+	var items []itineraryItem
+	for _, e := range extracted {
+		item := itineraryItem{Kind: strings.ToLower(strings.TrimSpace(e.Kind)), Title: strings.TrimSpace(e.Title),
+			City: strings.TrimSpace(e.City), Reference: strings.TrimSpace(e.Reference), Source: msg.ID}
+		if item.Kind == "cancelled" {
+			if item.Reference != "" || item.Title != "" {
+				items = append(items, item)
+			}
+			continue
+		}
+		ev, err := e.toCalendarEvent(loc, t.now())
+		if err != nil {
+			continue
+		}
+		item.Start, item.End, item.AllDay = ev.Start, ev.End, ev.AllDay
+		item.Location, item.Notes = ev.Location, ev.Description
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// apply adds a booking to the trip it falls in, starting a trip when none
+// is near, or removes a cancelled one. It returns the trip changed and
+// what happened to it, or nil when nothing did.
+func (s *itineraryState) apply(item itineraryItem) (*trip, string) {
+	if item.Kind == "cancelled" {
+		for _, tr := range s.Trips {
+			for i, existing := range tr.Items {
+				if (item.Reference != "" && strings.EqualFold(existing.Reference, item.Reference)) ||
+					(item.Reference == "" && strings.EqualFold(existing.Title, item.Title)) {
+					tr.Items = append(tr.Items[:i], tr.Items[i+1:]...)
+					tr.span()
+					return tr, "cancelled " + existing.Title
+				}
+			}
+		}
+		return nil, ""
+	}
+	for _, tr := range s.Trips {
+		if item.Start.Before(tr.Start.Add(-tripGap)) || item.Start.After(tr.End.Add(tripGap)) {
+			continue
+		}
+		for i, existing := range tr.Items {
+			if existing.Start.Equal(item.Start) && (strings.EqualFold(existing.Title, item.Title) ||
+				(item.Reference != "" && strings.EqualFold(existing.Reference, item.Reference) && existing.Kind == item.Kind)) {
+				// The same booking again, e.g. a check-in reminder
+				tr.Items[i] = item
+				return nil, ""
+			}
+		}
+		tr.Items = append(tr.Items, item)
+		tr.span()
+		return tr, "added " + item.Title
+	}
+
+	tr := &trip{City: item.City, Items: []itineraryItem{item}}
+	tr.span()
+	tr.Name = "Trip to " + item.City
+	if item.City == "" {
+		tr.Name = "Trip"
+	}
+	tr.Name += " (" + tr.Start.Format("Jan 2006") + ")"
+	tr.ID = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(item.City), " ", "-"))
+	if tr.ID == "" {
+		tr.ID = "trip"
+	}
+	tr.ID += "-" + tr.Start.Format("2006-01-02")
+	s.Trips = append(s.Trips, tr)
+	sort.Slice(s.Trips, func(i, j int) bool { return s.Trips[i].Start.Before(s.Trips[j].Start) })
+	return tr, "added " + item.Title
+}
+
+// span sorts a trip's bookings and sets its dates from them.
+func (tr *trip) span() {
+	sort.SliceStable(tr.Items, func(i, j int) bool { return tr.Items[i].Start.Before(tr.Items[j].Start) })
+	if len(tr.Items) == 0 {
+		tr.End = tr.Start
+		return
+	}
+	tr.Start, tr.End = tr.Items[0].Start, tr.Items[0].End
+	for _, item := range tr.Items {
+		if item.End.After(tr.End) {
+			tr.End = item.End
+		}
+	}
+}
+
+// findTrip picks a trip by ID or destination, or the next one (the
+// current one while travelling) when ref is empty.
+func findTrip(trips []*trip, ref string, now time.Time) *trip {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	for _, tr := range trips {
+		if ref != "" && (tr.ID == ref || strings.Contains(strings.ToLower(tr.Name), ref)) {
+			return tr
+		}
+	}
+	if ref != "" {
+		return nil
+	}
+	for _, tr := range trips {
+		if tr.End.After(now) {
+			return tr
+		}
+	}
+	if len(trips) > 0 {
+		return trips[len(trips)-1]
+	}
+	return nil
+}
+
+func tripDates(tr *trip, loc *time.Location) string {
+	start, end := tr.Start.In(loc), tr.End.In(loc)
+	if start.Format("2006-01-02") == end.Format("2006-01-02") {
+		return start.Format("Mon 2 Jan")
+	}
+	return start.Format("Mon 2 Jan") + " – " + end.Format("Mon 2 Jan")
+}
+
+// dayForecast is the weather for one day at a place.
+type dayForecast struct {
+	MinC, MaxC string
+	Desc       string
+	RainChance int
+}
+
+// forecast fetches the next days' weather at city from wttr.in, by date.
+func (t *ItineraryTool) forecast(ctx context.Context, city string) (map[string]dayForecast, error) {
+	var resp struct {
+		Weather []struct {
+			Date     string `json:"date"`
+			MaxTempC string `json:"maxtempC"`
+			MinTempC string `json:"mintempC"`
+			Hourly   []struct {
+				ChanceOfRain string `json:"chanceofrain"`
+				WeatherDesc  []struct {
+					Value string `json:"value"`
+				} `json:"weatherDesc"`
+			} `json:"hourly"`
+		} `json:"weather"`
+	}
+	if err := getJSON(ctx, t.weather, fmt.Sprintf("%s/%s?format=j1", t.weatherURL, url.PathEscape(city)), &resp); err != nil {
+		return nil, err
+	}
+	days := make(map[string]dayForecast)
+	for _, w := range resp.Weather {
+		day := dayForecast{MinC: w.MinTempC, MaxC: w.MaxTempC}
+		for i, h := range w.Hourly {
+			var chance int
+			fmt.Sscanf(h.ChanceOfRain, "%d", &chance)
+			if chance > day.RainChance {
+				day.RainChance = chance
+			}
+			// The midday reading describes the day best
+			if (day.Desc == "" || i == len(w.Hourly)/2) && len(h.WeatherDesc) > 0 {
+				day.Desc = strings.TrimSpace(h.WeatherDesc[0].Value)
+			}
+		}
+		days[w.Date] = day
+	}
+	return days, nil
+}
+
+// render writes a trip day by day: its bookings, the other calendar
+// entries of those days and, for days in the forecast, the weather at
+// the place the traveller is that day.
+func (t *ItineraryTool) render(ctx context.Context, tr *trip, loc *time.Location) string {
+	var events []CalendarEvent
+	if evs, err := t.calendar.ListEvents(ctx, t.opts.CalendarID, tr.Start.Add(-12*time.Hour), tr.End.Add(12*time.Hour)); err == nil {
+		events = evs
+	}
+	forecasts := map[string]map[string]dayForecast{}
+	horizon := t.now().AddDate(0, 0, forecastDays)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n%s\n", tr.Name, tripDates(tr, loc))
+	city := tr.City
+	first := time.Date(tr.Start.In(loc).Year(), tr.Start.In(loc).Month(), tr.Start.In(loc).Day(), 0, 0, 0, 0, loc)
+	for day := first; !day.After(tr.End.In(loc)); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		var lines []string
+		for _, item := range tr.Items {
+			if item.Start.Before(next) && !item.Start.Before(day) {
+				lines = append(lines, describeItem(item, loc))
+				if item.City != "" {
+					city = item.City
+				}
+			}
+		}
+		for _, ev := range events {
+			if ev.AllDay || !ev.Start.Before(next) || ev.Start.Before(day) || tripHasBooking(tr, ev) {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s %s (calendar)", ev.Start.In(loc).Format("15:04"), ev.Summary))
+		}
+		if city != "" && day.Before(horizon) && !next.Before(t.now()) {
+			if _, ok := forecasts[city]; !ok {
+				forecasts[city], _ = t.forecast(ctx, city)
+			}
+			if f, ok := forecasts[city][day.Format("2006-01-02")]; ok {
+				weather := fmt.Sprintf("Weather in %s: %s, %s", city, f.Desc, wttrTemperature(f.MinC, f.MaxC, LocaleFromContext(ctx)))
+				if f.RainChance >= 30 {
+					weather += fmt.Sprintf(", %d%% chance of rain", f.RainChance)
+				}
+				lines = append(lines, weather)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s\n", day.Format("Monday 2 January"))
+		for _, line := range lines {
+			sb.WriteString("- " + line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// tripHasBooking reports whether a calendar event is one of the trip's
+// bookings, e.g. a flight Gmail or extract_events added.
+func tripHasBooking(tr *trip, ev CalendarEvent) bool {
+	for _, item := range tr.Items {
+		if item.Start.Equal(ev.Start) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeItem(item itineraryItem, loc *time.Location) string {
+	var sb strings.Builder
+	if !item.AllDay {
+		// Local times at the place, as printed on tickets
+		sb.WriteString(item.Start.Format("15:04") + " ")
+	}
+	sb.WriteString(item.Title)
+	if !item.AllDay && item.End.After(item.Start) && item.Kind != "hotel" && item.End.Sub(item.Start) < 24*time.Hour {
+		sb.WriteString(" → " + item.End.Format("15:04"))
+	}
+	if item.Kind == "hotel" && !item.End.IsZero() {
+		sb.WriteString(", check-out " + item.End.In(loc).Format("Mon 2 Jan"))
+	}
+	if item.Location != "" {
+		sb.WriteString(" — " + item.Location)
+	}
+	if item.Reference != "" {
+		sb.WriteString(" (ref " + item.Reference + ")")
+	}
+	if item.Notes != "" {
+		sb.WriteString(". " + item.Notes)
+	}
+	return sb.String()
+}
+
+// writeDoc creates or updates the trip's Google Doc. Edits made to it in
+// Drive are kept, or are a *DriveConflictError, unless overwrite.
+func (t *ItineraryTool) writeDoc(ctx context.Context, tr *trip, text string, overwrite bool) error {
+	var version string
+	var err error
+	switch {
+	case tr.DocID == "":
+		doc, err := t.drive.UploadConverted(ctx, t.opts.FolderID, "Itinerary: "+tr.Name, "text/plain", googleDocType, []byte(text))
+		if err != nil {
+			return err
+		}
+		tr.DocID, tr.DocLink, version = doc.ID, doc.WebViewLink, doc.Version
+	case overwrite:
+		version, err = t.drive.updateContent(ctx, tr.DocID, "text/plain", []byte(text))
+	default:
+		_, version, err = t.drive.SafeUpdate(ctx, tr.DocID, "text/plain", tr.Rendered, tr.DocVersion, text)
+	}
+	if err != nil {
+		return err
+	}
+	tr.Rendered, tr.DocVersion, tr.Held = text, version, ""
+	return nil
+}
+
+func (t *ItineraryTool) loadState() (*itineraryState, error) {
+	state := &itineraryState{Processed: make(map[string]time.Time)}
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read itinerary state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse itinerary state: %w", err)
+	}
+	if state.Processed == nil {
+		state.Processed = make(map[string]time.Time)
+	}
+	return state, nil
+}
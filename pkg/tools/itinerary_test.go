@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestItineraryTool_BuildsTripDoc verifies confirmations become one trip whose Doc has the bookings, the calendar and the forecast, and that a cancellation updates it
+func TestItineraryTool_BuildsTripDoc(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := time.Now().AddDate(0, 0, 2)
+	date := day.Format("2006-01-02")
+	g.AddEmail(testkit.Email{From: "tap@flytap.com", Subject: "Booking confirmation ABC123", Body: "Flight TP 1350", Date: time.Now()})
+	g.AddEmail(testkit.Email{From: "news@shop.example", Subject: "Weekly deals", Body: "Sale", Date: time.Now()})
+	g.AddEvent(testkit.Event{Summary: "Dinner with Rui", Start: time.Date(day.Year(), day.Month(), day.Day(), 20, 0, 0, 0, time.Local),
+		End: time.Date(day.Year(), day.Month(), day.Day(), 22, 0, 0, 0, time.Local)})
+
+	weather := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Lisbon" {
+			t.Errorf("Unexpected forecast for %s", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"weather":[{"date":%q,"maxtempC":"24","mintempC":"16","hourly":[{"chanceofrain":"10","weatherDesc":[{"value":"Sunny"}]}]}]}`, date)
+	}))
+	defer weather.Close()
+
+	provider := &staticProvider{reply: fmt.Sprintf(`[
+		{"kind": "flight", "title": "Flight TP 1350 LHR → LIS", "start": "%sT09:10", "end": "%sT11:45", "city": "Lisbon", "location": "Heathrow T2", "reference": "ABC123"},
+		{"kind": "hotel", "title": "Hotel Avenida", "start": "%s", "end": "%s", "city": "Lisbon", "reference": "H-77"}
+	]`, date, date, date, day.AddDate(0, 0, 2).Format("2006-01-02"))}
+	tool := NewItineraryTool(testkit.Token, provider, "test", t.TempDir(), ItineraryOptions{}, nil)
+	tool.weather, tool.weatherURL = weather.Client(), weather.URL
+
+	ctx := WithChat(context.Background(), "telegram", "42")
+	result := tool.Execute(ctx, map[string]interface{}{"action": "sync"})
+	if result.IsError {
+		t.Fatalf("sync failed: %s", result.ForLLM)
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected only the confirmation read, got %d model calls", provider.calls)
+	}
+	if !strings.Contains(result.ForLLM, "Trip to Lisbon") || !strings.Contains(result.ForLLM, "Flight TP 1350") {
+		t.Errorf("Expected the new trip reported, got: %s", result.ForLLM)
+	}
+	docs := g.Files()
+	if len(docs) != 1 || docs[0].MimeType != googleDocType {
+		t.Fatalf("Expected one trip Doc, got %+v", docs)
+	}
+	doc := string(docs[0].Content)
+	for _, want := range []string{"09:10 Flight TP 1350 LHR → LIS → 11:45", "Hotel Avenida", "20:00 Dinner with Rui (calendar)", "Weather in Lisbon: Sunny, 16–24°C"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected %q in the Doc:\n%s", want, doc)
+		}
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "share", "trip": "lisbon", "email": "ana@example.com"})
+	if result.IsError {
+		t.Fatalf("share failed: %s", result.ForLLM)
+	}
+	if shared := g.Files()[0].SharedWith; len(shared) != 1 || shared[0] != "ana@example.com" {
+		t.Errorf("Expected the Doc shared with ana, got %v", shared)
+	}
+
+	g.AddEmail(testkit.Email{From: "hotels@example.com", Subject: "Reservation cancelled H-77", Body: "Cancelled", Date: time.Now()})
+	provider.reply = `[{"kind": "cancelled", "title": "Hotel Avenida", "reference": "H-77"}]`
+	if result = tool.Execute(ctx, map[string]interface{}{"action": "sync"}); !strings.Contains(result.ForLLM, "cancelled Hotel Avenida") {
+		t.Errorf("Expected the cancellation reported, got: %s", result.ForLLM)
+	}
+	if doc := string(g.Files()[0].Content); strings.Contains(doc, "Hotel Avenida") {
+		t.Errorf("Expected the hotel gone from the Doc:\n%s", doc)
+	}
+}
+
+// TestItineraryTool_KeepsDriveEdits verifies notes added to a trip Doc in Drive survive a sync, a rewritten Doc is reported once instead of overwritten, and overwrite replaces it
+func TestItineraryTool_KeepsDriveEdits(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	date := time.Now().AddDate(0, 0, 30).Format("2006-01-02")
+	g.AddEmail(testkit.Email{From: "tap@flytap.com", Subject: "Booking confirmation ABC123", Body: "Flight TP 1350", Date: time.Now()})
+	provider := &staticProvider{reply: fmt.Sprintf(`[
+		{"kind": "flight", "title": "Flight TP 1350 LHR → LIS", "start": "%sT09:10", "city": "Lisbon", "reference": "ABC123"},
+		{"kind": "hotel", "title": "Hotel Avenida", "start": "%s", "city": "Lisbon", "reference": "H-77"}
+	]`, date, date)}
+	tool := NewItineraryTool(testkit.Token, provider, "test", t.TempDir(), ItineraryOptions{}, nil)
+	ctx := WithChat(context.Background(), "telegram", "42")
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "sync"}); result.IsError {
+		t.Fatalf("sync failed: %s", result.ForLLM)
+	}
+	doc := g.Files()[0]
+
+	// Ana adds a note at the end; the cancellation keeps it
+	g.EditFile(doc.ID, append(doc.Content, "\nBring the adapter\n"...), "Ana")
+	g.AddEmail(testkit.Email{From: "hotels@example.com", Subject: "Reservation cancelled H-77", Body: "Cancelled", Date: time.Now()})
+	provider.reply = `[{"kind": "cancelled", "title": "Hotel Avenida", "reference": "H-77"}]`
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "sync"}); strings.Contains(result.ForLLM, "Ana") {
+		t.Errorf("Expected an appended note merged, got: %s", result.ForLLM)
+	}
+	content := string(g.Files()[0].Content)
+	if strings.Contains(content, "Hotel Avenida") || !strings.Contains(content, "Flight TP 1350") || !strings.HasSuffix(content, "Bring the adapter\n") {
+		t.Errorf("Expected the hotel gone and the note kept:\n%s", content)
+	}
+
+	// Ana rewrites it; a change before the flight leaves her version alone
+	g.EditFile(doc.ID, []byte("Lisbon, my way"), "Ana")
+	g.AddEmail(testkit.Email{From: "cars@example.com", Subject: "Car rental confirmation R-9", Body: "Car", Date: time.Now()})
+	provider.reply = fmt.Sprintf(`[{"kind": "car", "title": "Car rental Lisbon airport", "start": "%sT08:00", "city": "Lisbon", "reference": "R-9"}]`, date)
+	result := tool.Execute(ctx, map[string]interface{}{"action": "sync"})
+	if !strings.Contains(result.ForLLM, "edited in Drive by Ana") || !strings.Contains(result.ForLLM, "overwrite") {
+		t.Errorf("Expected the edit reported, got: %s", result.ForLLM)
+	}
+	if content := string(g.Files()[0].Content); content != "Lisbon, my way" {
+		t.Errorf("Expected Ana's version kept, got:\n%s", content)
+	}
+	if result = tool.Execute(ctx, map[string]interface{}{"action": "sync"}); strings.Contains(result.ForLLM, "Ana") {
+		t.Errorf("Expected the edit reported once, got: %s", result.ForLLM)
+	}
+
+	if result = tool.Execute(ctx, map[string]interface{}{"action": "sync", "overwrite": true}); result.IsError || strings.Contains(result.ForLLM, "Ana") {
+		t.Fatalf("sync with overwrite failed: %s", result.ForLLM)
+	}
+	if content := string(g.Files()[0].Content); !strings.Contains(content, "Car rental Lisbon airport") {
+		t.Errorf("Expected the Doc replaced, got:\n%s", content)
+	}
+}
@@ -0,0 +1,463 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// KeepItem is one line of a Keep checklist.
+type KeepItem struct {
+	Text    string
+	Checked bool
+}
+
+// KeepNote is a Google Keep note: text, or a checklist when Items is set.
+type KeepNote struct {
+	// Name is the note's resource name, "notes/<id>"
+	Name    string
+	Title   string
+	Text    string
+	Items   []KeepItem
+	Updated time.Time
+	// Shared is set when someone besides the owner can edit the note
+	Shared bool
+}
+
+// KeepClient wraps the Google Keep API. The API is only open to Google
+// Workspace accounts and has no way to edit a note once created; notes
+// can be listed, created and deleted.
+type KeepClient struct {
+	token   TokenFunc
+	baseURL string
+	client  *http.Client
+}
+
+func NewKeepClient(token TokenFunc) *KeepClient {
+	return &KeepClient{
+		token:   token,
+		baseURL: "https://keep.googleapis.com/v1",
+		client:  newGoogleHTTPClient(30 * time.Second),
+	}
+}
+
+func (c *KeepClient) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, c.client, method, c.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+type keepText struct {
+	Text string `json:"text"`
+}
+
+type keepListItem struct {
+	Text    keepText `json:"text"`
+	Checked bool     `json:"checked,omitempty"`
+}
+
+type keepNoteJSON struct {
+	Name       string `json:"name,omitempty"`
+	Title      string `json:"title,omitempty"`
+	UpdateTime string `json:"updateTime,omitempty"`
+	Body       struct {
+		Text *keepText `json:"text,omitempty"`
+		List *struct {
+			ListItems []keepListItem `json:"listItems"`
+		} `json:"list,omitempty"`
+	} `json:"body"`
+	Permissions []struct {
+		Role string `json:"role"`
+	} `json:"permissions,omitempty"`
+}
+
+func (n keepNoteJSON) toKeepNote() KeepNote {
+	note := KeepNote{Name: n.Name, Title: n.Title, Shared: len(n.Permissions) > 1}
+	note.Updated, _ = time.Parse(time.RFC3339, n.UpdateTime)
+	if n.Body.Text != nil {
+		note.Text = n.Body.Text.Text
+	}
+	if n.Body.List != nil {
+		for _, item := range n.Body.List.ListItems {
+			note.Items = append(note.Items, KeepItem{Text: item.Text.Text, Checked: item.Checked})
+		}
+	}
+	return note
+}
+
+// List returns every note not in the trash, reading all pages.
+func (c *KeepClient) List(ctx context.Context) ([]KeepNote, error) {
+	var notes []KeepNote
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("filter", "trashed = false")
+		q.Set("pageSize", "100")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		var resp struct {
+			Notes         []keepNoteJSON `json:"notes"`
+			NextPageToken string         `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/notes?"+q.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, n := range resp.Notes {
+			notes = append(notes, n.toKeepNote())
+		}
+		if resp.NextPageToken == "" {
+			return notes, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// Create adds a note: a checklist when note.Items is set, text otherwise.
+func (c *KeepClient) Create(ctx context.Context, note KeepNote) (*KeepNote, error) {
+	var payload keepNoteJSON
+	payload.Title = note.Title
+	if len(note.Items) > 0 {
+		payload.Body.List = &struct {
+			ListItems []keepListItem `json:"listItems"`
+		}{}
+		for _, item := range note.Items {
+			payload.Body.List.ListItems = append(payload.Body.List.ListItems, keepListItem{Text: keepText{item.Text}, Checked: item.Checked})
+		}
+	} else {
+		payload.Body.Text = &keepText{note.Text}
+	}
+	var created keepNoteJSON
+	if err := c.do(ctx, http.MethodPost, "/notes", payload, &created); err != nil {
+		return nil, err
+	}
+	result := created.toKeepNote()
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoDeleteKeepNote,
+		Description: fmt.Sprintf("created Keep note %q", keepNoteLabel(result)),
+		Params:      map[string]string{"name": result.Name},
+	})
+	return &result, nil
+}
+
+// Delete removes a note for good; the API has no trash.
+func (c *KeepClient) Delete(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/"+name, nil, nil)
+}
+
+// KeepTool lists, searches and creates Google Keep notes and checklists,
+// for users who keep quick notes in Keep rather than in Drive documents.
+// Keep's API cannot pin notes, so pins are kept by picoclaw: pinned notes
+// come first in list and search results here, not in the Keep app.
+type KeepTool struct {
+	keep *KeepClient
+	path string
+	mu   sync.Mutex
+	pins map[string]bool
+}
+
+// NewKeepTool loads the pinned notes saved in the workspace.
+func NewKeepTool(token TokenFunc, workspace string) *KeepTool {
+	t := &KeepTool{
+		keep: NewKeepClient(token),
+		path: filepath.Join(workspace, "state", "keep_pins.json"),
+		pins: make(map[string]bool),
+	}
+	if data, err := os.ReadFile(t.path); err == nil {
+		var names []string
+		if json.Unmarshal(data, &names) == nil {
+			for _, name := range names {
+				t.pins[name] = true
+			}
+		}
+	}
+	return t
+}
+
+func (t *KeepTool) Name() string {
+	return "keep"
+}
+
+func (t *KeepTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "create", "pin", "unpin")
+}
+
+// Untrusted reports that listings carry note text, which shared notes
+// let others write.
+func (t *KeepTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "list", "search")
+}
+
+func (t *KeepTool) ActionScopes() map[string][]string {
+	write := googleScopes("keep")
+	return map[string][]string{"create": write, "pin": write, "unpin": write}
+}
+
+func (t *KeepTool) Description() string {
+	return "Google Keep notes and checklists. action=list shows recent notes (pinned first), action=search finds notes whose title, text or checklist items mention a query, action=create adds a text note or a checklist (items), action=pin/unpin keeps a note at the top of these results. Keep notes cannot be edited after creation; to change one, create a new note."
+}
+
+func (t *KeepTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "search", "create", "pin", "unpin"},
+				"description": "Action to perform",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "search: words to look for",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "create: note title",
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "create: note text",
+			},
+			"items": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "create: checklist items, one entry per item (makes the note a checklist)",
+			},
+			"note": map[string]interface{}{
+				"type":        "string",
+				"description": "pin/unpin: the note's name (notes/...) or its title",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "list/search: maximum notes (default 20)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *KeepTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	limit := 20
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), 100)
+	}
+
+	switch action {
+	case "list", "search":
+		query, _ := args["query"].(string)
+		query = strings.TrimSpace(query)
+		if action == "search" && query == "" {
+			return ErrorResult("query is required for search")
+		}
+		notes, err := t.keep.List(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list Keep notes: %v", err)).WithError(err)
+		}
+		if query != "" {
+			var matches []KeepNote
+			for _, n := range notes {
+				if keepNoteMatches(n, query) {
+					matches = append(matches, n)
+				}
+			}
+			notes = matches
+		}
+		if len(notes) == 0 {
+			if query != "" {
+				return SilentResult(fmt.Sprintf("No Keep notes mention %q.", query))
+			}
+			return SilentResult("No Keep notes.")
+		}
+		t.sortNotes(notes)
+		total := len(notes)
+		if total > limit {
+			notes = notes[:limit]
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d note(s)", total)
+		if total > len(notes) {
+			fmt.Fprintf(&sb, ", newest %d shown", len(notes))
+		}
+		sb.WriteString(":")
+		for _, n := range notes {
+			sb.WriteString("\n" + t.formatNote(n))
+		}
+		return SilentResult(sb.String())
+
+	case "create":
+		title, _ := args["title"].(string)
+		text, _ := args["text"].(string)
+		items, _ := stringListArg(args, "items")
+		note := KeepNote{Title: strings.TrimSpace(title), Text: strings.TrimSpace(text)}
+		for _, item := range items {
+			if item = strings.TrimSpace(item); item != "" {
+				note.Items = append(note.Items, KeepItem{Text: item})
+			}
+		}
+		if note.Text != "" && len(note.Items) > 0 {
+			return ErrorResult("a Keep note is either text or a checklist; give text or items, not both")
+		}
+		if note.Title == "" && note.Text == "" && len(note.Items) == 0 {
+			return ErrorResult("title, text or items is required")
+		}
+		created, err := t.keep.Create(ctx, note)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to create the Keep note: %v", err)).WithError(err)
+		}
+		kind := "note"
+		if len(created.Items) > 0 {
+			kind = fmt.Sprintf("checklist with %d item(s)", len(created.Items))
+		}
+		return NewToolResult(fmt.Sprintf("Created Keep %s %q (%s)", kind, keepNoteLabel(*created), created.Name))
+
+	case "pin", "unpin":
+		ref, _ := args["note"].(string)
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			return ErrorResult("note is required")
+		}
+		note, err := t.findNote(ctx, ref)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		t.mu.Lock()
+		if action == "pin" {
+			t.pins[note.Name] = true
+		} else {
+			delete(t.pins, note.Name)
+		}
+		err = t.saveLocked()
+		t.mu.Unlock()
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save pins: %v", err)).WithError(err)
+		}
+		verb := "Pinned"
+		if action == "unpin" {
+			verb = "Unpinned"
+		}
+		return SilentResult(fmt.Sprintf("%s %q", verb, keepNoteLabel(*note)))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// findNote resolves a note by resource name or by title (exact first,
+// then the one title that contains ref).
+func (t *KeepTool) findNote(ctx context.Context, ref string) (*KeepNote, error) {
+	notes, err := t.keep.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Keep notes: %v", err)
+	}
+	var partial []KeepNote
+	for _, n := range notes {
+		if n.Name == ref || n.Name == "notes/"+ref || strings.EqualFold(n.Title, ref) {
+			return &n, nil
+		}
+		if n.Title != "" && strings.Contains(strings.ToLower(n.Title), strings.ToLower(ref)) {
+			partial = append(partial, n)
+		}
+	}
+	switch len(partial) {
+	case 0:
+		return nil, fmt.Errorf("no Keep note named %q", ref)
+	case 1:
+		return &partial[0], nil
+	}
+	titles := make([]string, len(partial))
+	for i, n := range partial {
+		titles[i] = fmt.Sprintf("%q (%s)", n.Title, n.Name)
+	}
+	return nil, fmt.Errorf("%q matches several notes: %s", ref, strings.Join(titles, ", "))
+}
+
+// sortNotes puts pinned notes first, then the most recently updated.
+func (t *KeepTool) sortNotes(notes []KeepNote) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sort.SliceStable(notes, func(i, j int) bool {
+		pi, pj := t.pins[notes[i].Name], t.pins[notes[j].Name]
+		if pi != pj {
+			return pi
+		}
+		return notes[i].Updated.After(notes[j].Updated)
+	})
+}
+
+func (t *KeepTool) formatNote(n KeepNote) string {
+	t.mu.Lock()
+	pinned := t.pins[n.Name]
+	t.mu.Unlock()
+	var sb strings.Builder
+	sb.WriteString("- ")
+	if pinned {
+		sb.WriteString("📌 ")
+	}
+	sb.WriteString(keepNoteLabel(n))
+	if n.Shared {
+		sb.WriteString(" (shared)")
+	}
+	fmt.Fprintf(&sb, " [%s]", n.Name)
+	if n.Text != "" && n.Title != "" {
+		sb.WriteString(": " + strings.ReplaceAll(utils.Truncate(n.Text, 200), "\n", " "))
+	}
+	for _, item := range n.Items {
+		box := "☐"
+		if item.Checked {
+			box = "☑"
+		}
+		fmt.Fprintf(&sb, "\n  %s %s", box, item.Text)
+	}
+	return sb.String()
+}
+
+func (t *KeepTool) saveLocked() error {
+	names := make([]string, 0, len(t.pins))
+	for name := range t.pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return saveJSONAtomic(t.path, names)
+}
+
+// keepNoteLabel names a note for chat: its title, or the start of its
+// text when it has none.
+func keepNoteLabel(n KeepNote) string {
+	switch {
+	case n.Title != "":
+		return n.Title
+	case n.Text != "":
+		return utils.Truncate(strings.ReplaceAll(n.Text, "\n", " "), 60)
+	case len(n.Items) > 0:
+		return n.Items[0].Text + "…"
+	}
+	return "(untitled)"
+}
+
+func keepNoteMatches(n KeepNote, query string) bool {
+	text := n.Title + " " + n.Text
+	for _, item := range n.Items {
+		text += " " + item.Text
+	}
+	text = strings.ToLower(text)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
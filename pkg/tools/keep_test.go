@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestKeepTool_ChecklistsSearchAndPins verifies checklists are created through the Keep API, search covers items, and pins survive a restart
+func TestKeepTool_ChecklistsSearchAndPins(t *testing.T) {
+	notes := []map[string]interface{}{
+		{"name": "notes/a", "title": "Wifi", "updateTime": "2026-10-10T09:00:00Z", "body": map[string]interface{}{"text": map[string]string{"text": "guest / hunter2"}}},
+		{"name": "notes/b", "title": "Camping", "updateTime": "2026-10-12T09:00:00Z", "permissions": []map[string]string{{"role": "OWNER"}, {"role": "WRITER"}},
+			"body": map[string]interface{}{"list": map[string]interface{}{"listItems": []map[string]interface{}{
+				{"text": map[string]string{"text": "tent"}, "checked": true},
+				{"text": map[string]string{"text": "head torch"}},
+			}}}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/notes":
+			if r.URL.Query().Get("filter") != "trashed = false" {
+				t.Errorf("filter = %q", r.URL.Query().Get("filter"))
+			}
+			if r.URL.Query().Get("pageToken") == "" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"notes": notes[:1], "nextPageToken": "p2"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"notes": notes[1:]})
+		case r.Method == http.MethodPost && r.URL.Path == "/notes":
+			var note map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&note)
+			note["name"] = "notes/c"
+			notes = append(notes, note)
+			json.NewEncoder(w).Encode(note)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	workspace := t.TempDir()
+	newTool := func() *KeepTool {
+		tool := NewKeepTool(func(ctx context.Context) (string, error) { return "tok", nil }, workspace)
+		tool.keep.baseURL = server.URL
+		return tool
+	}
+	tool := newTool()
+	ctx := context.Background()
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "create", "title": "Groceries", "items": []interface{}{"eggs", " ", "milk"}})
+	if r.IsError || !strings.Contains(r.ForLLM, `checklist with 2 item(s) "Groceries" (notes/c)`) {
+		t.Fatalf("unexpected create: %s", r.ForLLM)
+	}
+	items := notes[2]["body"].(map[string]interface{})["list"].(map[string]interface{})["listItems"].([]interface{})
+	if len(items) != 2 || items[1].(map[string]interface{})["text"].(map[string]interface{})["text"] != "milk" {
+		t.Errorf("unexpected checklist sent: %+v", notes[2])
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "create", "text": "x", "items": []interface{}{"y"}}); !r.IsError {
+		t.Error("text and items together were accepted")
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "search", "query": "torch"})
+	if r.IsError || !strings.Contains(r.ForLLM, "1 note(s):\n- Camping (shared) [notes/b]\n  ☑ tent\n  ☐ head torch") {
+		t.Fatalf("unexpected search: %s", r.ForLLM)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "pin", "note": "wifi"}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+	r = newTool().Execute(ctx, map[string]interface{}{"action": "list", "limit": float64(2)})
+	if r.IsError || !strings.HasPrefix(r.ForLLM, "3 note(s), newest 2 shown:\n- 📌 Wifi [notes/a]: guest / hunter2\n- Camping") {
+		t.Fatalf("pinned note not first after a restart: %s", r.ForLLM)
+	}
+}
@@ -0,0 +1,598 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ListItem is one entry on a named list. RemoteID is set once the item
+// exists on the sync backend.
+type ListItem struct {
+	Text     string    `json:"text"`
+	Checked  bool      `json:"checked,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+	RemoteID string    `json:"remote_id,omitempty"`
+}
+
+// NamedList is a list such as "groceries" or "packing" kept for one chat.
+type NamedList struct {
+	Title    string     `json:"title"`
+	Items    []ListItem `json:"items"`
+	RemoteID string     `json:"remote_id,omitempty"`
+}
+
+// ListSync mirrors lists to a service other people can edit (Google Tasks),
+// so the list stays shared with a partner or the household.
+type ListSync interface {
+	EnsureList(ctx context.Context, title string) (string, error)
+	Items(ctx context.Context, listID string) ([]ListItem, error)
+	AddItem(ctx context.Context, listID, text string) (string, error)
+	SetChecked(ctx context.Context, listID, itemID string, checked bool) error
+	RemoveItem(ctx context.Context, listID, itemID string) error
+	DeleteList(ctx context.Context, listID string) error
+}
+
+// GoogleTasksSync keeps each named list as a Google Tasks list with the
+// same title. Lists with the same name in different chats share one
+// task list. (Google Keep has no API for personal accounts, so Tasks is
+// the Google backend.)
+type GoogleTasksSync struct {
+	token   TokenFunc
+	baseURL string
+	client  *http.Client
+}
+
+func NewGoogleTasksSync(token TokenFunc) *GoogleTasksSync {
+	return &GoogleTasksSync{
+		token:   token,
+		baseURL: "https://tasks.googleapis.com/tasks/v1",
+		client:  newGoogleHTTPClient(15 * time.Second),
+	}
+}
+
+func (g *GoogleTasksSync) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	token, err := g.token(ctx)
+	if err != nil {
+		return err
+	}
+	return doJSONRequest(ctx, g.client, method, g.baseURL+path,
+		map[string]string{"Authorization": "Bearer " + token}, payload, out)
+}
+
+func (g *GoogleTasksSync) EnsureList(ctx context.Context, title string) (string, error) {
+	pageToken := ""
+	for {
+		var resp struct {
+			Items []struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		path := "/users/@me/lists?maxResults=100"
+		if pageToken != "" {
+			path += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		if err := g.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return "", err
+		}
+		for _, l := range resp.Items {
+			if strings.EqualFold(l.Title, title) {
+				return l.ID, nil
+			}
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/users/@me/lists", map[string]string{"title": title}, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (g *GoogleTasksSync) Items(ctx context.Context, listID string) ([]ListItem, error) {
+	var items []ListItem
+	pageToken := ""
+	for {
+		var resp struct {
+			Items []struct {
+				ID      string `json:"id"`
+				Title   string `json:"title"`
+				Status  string `json:"status"`
+				Updated string `json:"updated"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		// showHidden is needed to see items ticked off in Google's own apps
+		path := fmt.Sprintf("/lists/%s/tasks?showCompleted=true&showHidden=true&maxResults=100", url.PathEscape(listID))
+		if pageToken != "" {
+			path += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		if err := g.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Items {
+			if strings.TrimSpace(t.Title) == "" {
+				continue
+			}
+			updated, _ := time.Parse(time.RFC3339, t.Updated)
+			items = append(items, ListItem{
+				Text:     t.Title,
+				Checked:  t.Status == "completed",
+				AddedAt:  updated,
+				RemoteID: t.ID,
+			})
+		}
+		if resp.NextPageToken == "" {
+			return items, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+func (g *GoogleTasksSync) AddItem(ctx context.Context, listID, text string) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	path := fmt.Sprintf("/lists/%s/tasks", url.PathEscape(listID))
+	if err := g.do(ctx, http.MethodPost, path, map[string]string{"title": text}, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (g *GoogleTasksSync) SetChecked(ctx context.Context, listID, itemID string, checked bool) error {
+	patch := map[string]interface{}{"status": "needsAction", "completed": nil}
+	if checked {
+		patch = map[string]interface{}{"status": "completed"}
+	}
+	path := fmt.Sprintf("/lists/%s/tasks/%s", url.PathEscape(listID), url.PathEscape(itemID))
+	return g.do(ctx, http.MethodPatch, path, patch, nil)
+}
+
+func (g *GoogleTasksSync) RemoveItem(ctx context.Context, listID, itemID string) error {
+	path := fmt.Sprintf("/lists/%s/tasks/%s", url.PathEscape(listID), url.PathEscape(itemID))
+	return g.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+func (g *GoogleTasksSync) DeleteList(ctx context.Context, listID string) error {
+	return g.do(ctx, http.MethodDelete, "/users/@me/lists/"+url.PathEscape(listID), nil, nil)
+}
+
+// ListTool manages named lists (shopping, packing, ...) for the current
+// chat, optionally mirrored to a shared backend.
+type ListTool struct {
+	path    string
+	sync    ListSync
+	mu      sync.Mutex
+	lists   map[string]map[string]*NamedList
+	channel string
+	chatID  string
+}
+
+// NewListTool loads the lists saved in the workspace. syncer may be nil to
+// keep lists local.
+func NewListTool(workspace string, syncer ListSync) *ListTool {
+	t := &ListTool{
+		path:  filepath.Join(workspace, "state", "lists.json"),
+		sync:  syncer,
+		lists: make(map[string]map[string]*NamedList),
+	}
+	if data, err := os.ReadFile(t.path); err == nil {
+		json.Unmarshal(data, &t.lists)
+	}
+	return t
+}
+
+func (t *ListTool) Name() string {
+	return "lists"
+}
+
+func (t *ListTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ListTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "remove", "check", "uncheck", "clear_checked", "delete")
+}
+
+func (t *ListTool) Description() string {
+	desc := "Keep named lists for this chat (shopping, groceries, packing, todo...). Add, remove, check off and show items. Use it for requests like \"add eggs to the shopping list\" or \"what's on the packing list?\"."
+	switch t.sync.(type) {
+	case nil:
+	case *CalDAVTasksSync:
+		desc += " Lists are shared as CalDAV task lists (e.g. Apple Reminders, Nextcloud Tasks), so items added or ticked off there show up here too."
+	default:
+		desc += " Lists are shared through Google Tasks, so items added or ticked off there show up here too."
+	}
+	return desc
+}
+
+func (t *ListTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"add", "remove", "check", "uncheck", "show", "clear_checked", "delete", "all"},
+				"description": "add/remove/check/uncheck items, show a list, clear_checked removes ticked items, delete drops the whole list, all shows every list",
+			},
+			"list": map[string]interface{}{
+				"type":        "string",
+				"description": "List name, e.g. \"shopping\" or \"packing\" (default: shopping)",
+			},
+			"items": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Items to add/remove/check, one entry per item (e.g. [\"eggs\", \"2 l milk\"])",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ListTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// listKey normalizes a list name so "Shopping list" and "shopping" match.
+func listKey(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	name = strings.TrimSuffix(name, " list")
+	if name == "" {
+		name = "shopping"
+	}
+	return name
+}
+
+func listTitle(key string) string {
+	r, size := utf8.DecodeRuneInString(key)
+	return string(unicode.ToUpper(r)) + key[size:]
+}
+
+// findListItem matches case-insensitively, then by unique substring
+// ("milk" finds "2 l milk").
+func findListItem(items []ListItem, text string) int {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for i, item := range items {
+		if strings.ToLower(item.Text) == text {
+			return i
+		}
+	}
+	found := -1
+	for i, item := range items {
+		if strings.Contains(strings.ToLower(item.Text), text) {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+func (t *ListTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chatKey := t.channel + ":" + t.chatID
+	action, _ := args["action"].(string)
+	listName, _ := args["list"].(string)
+	key := listKey(listName)
+	items, _ := stringListArg(args, "items")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch action {
+	case "all":
+		return SilentResult(t.formatAll(chatKey))
+	case "add", "remove", "check", "uncheck", "show", "clear_checked", "delete":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+
+	chatLists := t.lists[chatKey]
+	if chatLists == nil {
+		chatLists = make(map[string]*NamedList)
+		t.lists[chatKey] = chatLists
+	}
+	list := chatLists[key]
+	if list == nil {
+		if action != "add" {
+			return SilentResult(fmt.Sprintf("There is no %s list yet. Add items to create it.", key))
+		}
+		list = &NamedList{Title: listTitle(key)}
+		chatLists[key] = list
+	}
+
+	var syncErrs []string
+	syncErr := func(err error) {
+		if err != nil {
+			syncErrs = append(syncErrs, err.Error())
+		}
+	}
+	if t.sync != nil {
+		syncErr(t.pull(ctx, list))
+	}
+
+	var summary string
+	switch action {
+	case "add":
+		if len(items) == 0 {
+			return ErrorResult("items is required for add")
+		}
+		var added, existing []string
+		for _, text := range items {
+			if i := findListItem(list.Items, text); i >= 0 && strings.EqualFold(list.Items[i].Text, text) {
+				if list.Items[i].Checked {
+					list.Items[i].Checked = false
+					syncErr(t.pushChecked(ctx, list, list.Items[i]))
+					added = append(added, text)
+				} else {
+					existing = append(existing, text)
+				}
+				continue
+			}
+			item := ListItem{Text: text, AddedAt: time.Now()}
+			if t.sync != nil && list.RemoteID != "" {
+				id, err := t.sync.AddItem(ctx, list.RemoteID, text)
+				syncErr(err)
+				item.RemoteID = id
+			}
+			list.Items = append(list.Items, item)
+			added = append(added, text)
+		}
+		summary = fmt.Sprintf("Added to %s: %s.", key, strings.Join(added, ", "))
+		if len(added) == 0 {
+			summary = ""
+		}
+		if len(existing) > 0 {
+			summary = strings.TrimSpace(summary + fmt.Sprintf(" Already on the list: %s.", strings.Join(existing, ", ")))
+		}
+
+	case "remove", "check", "uncheck":
+		if len(items) == 0 {
+			return ErrorResult(fmt.Sprintf("items is required for %s", action))
+		}
+		var done, missing []string
+		for _, text := range items {
+			i := findListItem(list.Items, text)
+			if i < 0 {
+				missing = append(missing, text)
+				continue
+			}
+			item := list.Items[i]
+			done = append(done, item.Text)
+			if action == "remove" {
+				list.Items = append(list.Items[:i], list.Items[i+1:]...)
+				if t.sync != nil && item.RemoteID != "" {
+					syncErr(t.sync.RemoveItem(ctx, list.RemoteID, item.RemoteID))
+				}
+				continue
+			}
+			list.Items[i].Checked = action == "check"
+			syncErr(t.pushChecked(ctx, list, list.Items[i]))
+		}
+		verb := map[string]string{"remove": "Removed", "check": "Checked off", "uncheck": "Unchecked"}[action]
+		if len(done) > 0 {
+			summary = fmt.Sprintf("%s: %s.", verb, strings.Join(done, ", "))
+		}
+		if len(missing) > 0 {
+			summary = strings.TrimSpace(summary + fmt.Sprintf(" Not found on the %s list: %s.", key, strings.Join(missing, ", ")))
+		}
+
+	case "clear_checked":
+		kept := list.Items[:0]
+		cleared := 0
+		for _, item := range list.Items {
+			if !item.Checked {
+				kept = append(kept, item)
+				continue
+			}
+			cleared++
+			if t.sync != nil && item.RemoteID != "" {
+				syncErr(t.sync.RemoveItem(ctx, list.RemoteID, item.RemoteID))
+			}
+		}
+		list.Items = kept
+		summary = fmt.Sprintf("Cleared %d checked item(s).", cleared)
+
+	case "delete":
+		if t.sync != nil && list.RemoteID != "" {
+			syncErr(t.sync.DeleteList(ctx, list.RemoteID))
+		}
+		delete(chatLists, key)
+		if err := t.saveLocked(); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save lists: %v", err)).WithError(err)
+		}
+		return SilentResult(withSyncErrors(fmt.Sprintf("Deleted the %s list.", key), syncErrs))
+
+	}
+
+	if err := t.saveLocked(); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save lists: %v", err)).WithError(err)
+	}
+
+	out := formatNamedList(list)
+	if summary != "" {
+		out = summary + "\n\n" + out
+	}
+	return SilentResult(withSyncErrors(out, syncErrs))
+}
+
+// pull merges the backend's copy into the local list: edits made elsewhere
+// win, items deleted elsewhere go away, and items that never made it to
+// the backend (e.g. added while offline) are pushed now.
+func (t *ListTool) pull(ctx context.Context, list *NamedList) error {
+	if list.RemoteID == "" {
+		id, err := t.sync.EnsureList(ctx, list.Title)
+		if err != nil {
+			return err
+		}
+		list.RemoteID = id
+	}
+	remote, err := t.sync.Items(ctx, list.RemoteID)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]ListItem, len(remote))
+	for _, item := range remote {
+		byID[item.RemoteID] = item
+	}
+	merged := make([]ListItem, 0, len(remote)+len(list.Items))
+	for _, item := range list.Items {
+		if item.RemoteID == "" {
+			id, err := t.sync.AddItem(ctx, list.RemoteID, item.Text)
+			if err != nil {
+				return err
+			}
+			item.RemoteID = id
+			if item.Checked {
+				if err := t.sync.SetChecked(ctx, list.RemoteID, id, true); err != nil {
+					return err
+				}
+			}
+			merged = append(merged, item)
+			continue
+		}
+		r, ok := byID[item.RemoteID]
+		if !ok {
+			continue
+		}
+		item.Text, item.Checked = r.Text, r.Checked
+		delete(byID, item.RemoteID)
+		merged = append(merged, item)
+	}
+	for _, item := range remote {
+		if _, ok := byID[item.RemoteID]; ok {
+			merged = append(merged, item)
+		}
+	}
+	list.Items = merged
+	return nil
+}
+
+func (t *ListTool) pushChecked(ctx context.Context, list *NamedList, item ListItem) error {
+	if t.sync == nil || item.RemoteID == "" {
+		return nil
+	}
+	return t.sync.SetChecked(ctx, list.RemoteID, item.RemoteID, item.Checked)
+}
+
+func (t *ListTool) formatAll(chatKey string) string {
+	chatLists := t.lists[chatKey]
+	if len(chatLists) == 0 {
+		return "No lists yet."
+	}
+	keys := make([]string, 0, len(chatLists))
+	for key := range chatLists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("Lists:\n")
+	for _, key := range keys {
+		list := chatLists[key]
+		open := 0
+		for _, item := range list.Items {
+			if !item.Checked {
+				open++
+			}
+		}
+		fmt.Fprintf(&sb, "- %s: %d open, %d total\n", key, open, len(list.Items))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func formatNamedList(list *NamedList) string {
+	if len(list.Items) == 0 {
+		return fmt.Sprintf("%s list is empty.", list.Title)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s list:\n", list.Title)
+	for _, item := range list.Items {
+		mark := " "
+		if item.Checked {
+			mark = "x"
+		}
+		fmt.Fprintf(&sb, "- [%s] %s\n", mark, item.Text)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func withSyncErrors(out string, errs []string) string {
+	if len(errs) == 0 {
+		return out
+	}
+	return out + "\n\n(Saved locally; sync failed: " + strings.Join(errs, "; ") + ")"
+}
+
+// saveLocked persists the lists. Must be called with the lock held.
+func (t *ListTool) saveLocked() error {
+	return saveJSONAtomic(t.path, t.lists)
+}
+
+// saveJSONAtomic writes v as indented JSON with temp file + rename, so a
+// crash never leaves a truncated state file behind.
+func saveJSONAtomic(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
+
+// ChatData implements ChatDataStore: the chat's lists.
+func (t *ListTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.lists[chatKey]) == 0 {
+		return nil, nil
+	}
+	return snapshot(t.lists[chatKey])
+}
+
+// PurgeChat implements ChatDataStore. Copies synced to Google Tasks are
+// the user's own and stay there.
+func (t *ListTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.lists[chatKey])
+	if n == 0 {
+		return 0, nil
+	}
+	delete(t.lists, chatKey)
+	return n, t.saveLocked()
+}
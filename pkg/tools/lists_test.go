@@ -0,0 +1,246 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeListSync struct {
+	lists  map[string]string
+	items  map[string][]ListItem
+	nextID int
+}
+
+func newFakeListSync() *fakeListSync {
+	return &fakeListSync{lists: map[string]string{}, items: map[string][]ListItem{}}
+}
+
+func (f *fakeListSync) id() string {
+	f.nextID++
+	return fmt.Sprintf("id%d", f.nextID)
+}
+
+func (f *fakeListSync) EnsureList(ctx context.Context, title string) (string, error) {
+	if id, ok := f.lists[title]; ok {
+		return id, nil
+	}
+	f.lists[title] = f.id()
+	return f.lists[title], nil
+}
+
+func (f *fakeListSync) Items(ctx context.Context, listID string) ([]ListItem, error) {
+	return append([]ListItem(nil), f.items[listID]...), nil
+}
+
+func (f *fakeListSync) AddItem(ctx context.Context, listID, text string) (string, error) {
+	id := f.id()
+	f.items[listID] = append(f.items[listID], ListItem{Text: text, RemoteID: id})
+	return id, nil
+}
+
+func (f *fakeListSync) SetChecked(ctx context.Context, listID, itemID string, checked bool) error {
+	for i := range f.items[listID] {
+		if f.items[listID][i].RemoteID == itemID {
+			f.items[listID][i].Checked = checked
+		}
+	}
+	return nil
+}
+
+func (f *fakeListSync) RemoveItem(ctx context.Context, listID, itemID string) error {
+	items := f.items[listID][:0]
+	for _, item := range f.items[listID] {
+		if item.RemoteID != itemID {
+			items = append(items, item)
+		}
+	}
+	f.items[listID] = items
+	return nil
+}
+
+func (f *fakeListSync) DeleteList(ctx context.Context, listID string) error {
+	delete(f.items, listID)
+	return nil
+}
+
+// TestListTool_AddCheckRemove verifies the basic list operations and that lists persist per chat
+func TestListTool_AddCheckRemove(t *testing.T) {
+	workspace := t.TempDir()
+	tool := NewListTool(workspace, nil)
+	tool.SetContext("telegram", "42")
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"action": "add", "list": "Shopping list", "items": []interface{}{"eggs", "2 l milk", "bread"}})
+	result := tool.Execute(ctx, map[string]interface{}{"action": "add", "items": []interface{}{"Eggs"}})
+	if !strings.Contains(result.ForLLM, "Already on the list: Eggs") {
+		t.Errorf("Expected duplicate to be reported, got: %s", result.ForLLM)
+	}
+
+	tool.Execute(ctx, map[string]interface{}{"action": "check", "items": []interface{}{"milk"}})
+	result = tool.Execute(ctx, map[string]interface{}{"action": "remove", "list": "shopping", "items": []interface{}{"bread", "apples"}})
+	if !strings.Contains(result.ForLLM, "Removed: bread.") || !strings.Contains(result.ForLLM, "Not found on the shopping list: apples.") {
+		t.Errorf("Unexpected remove result: %s", result.ForLLM)
+	}
+
+	reloaded := NewListTool(workspace, nil)
+	reloaded.SetContext("telegram", "42")
+	result = reloaded.Execute(ctx, map[string]interface{}{"action": "show", "list": "shopping"})
+	if result.ForLLM != "Shopping list:\n- [ ] eggs\n- [x] 2 l milk" {
+		t.Errorf("Unexpected list after reload:\n%s", result.ForLLM)
+	}
+
+	reloaded.SetContext("telegram", "7")
+	result = reloaded.Execute(ctx, map[string]interface{}{"action": "show"})
+	if !strings.Contains(result.ForLLM, "no shopping list yet") {
+		t.Errorf("Expected lists to be per chat, got: %s", result.ForLLM)
+	}
+}
+
+// TestListTool_SyncMergesRemoteChanges verifies edits made on the shared backend are picked up
+func TestListTool_SyncMergesRemoteChanges(t *testing.T) {
+	remote := newFakeListSync()
+	tool := NewListTool(t.TempDir(), remote)
+	tool.SetContext("telegram", "42")
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"action": "add", "list": "groceries", "items": []interface{}{"eggs", "milk"}})
+	listID := remote.lists["Groceries"]
+	if len(remote.items[listID]) != 2 {
+		t.Fatalf("Expected items to be pushed, got %+v", remote.items)
+	}
+
+	// Someone else ticks off eggs, deletes milk and adds coffee
+	remote.SetChecked(ctx, listID, remote.items[listID][0].RemoteID, true)
+	remote.RemoveItem(ctx, listID, remote.items[listID][1].RemoteID)
+	remote.AddItem(ctx, listID, "coffee")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "show", "list": "groceries"})
+	if result.ForLLM != "Groceries list:\n- [x] eggs\n- [ ] coffee" {
+		t.Errorf("Unexpected merged list:\n%s", result.ForLLM)
+	}
+
+	tool.Execute(ctx, map[string]interface{}{"action": "clear_checked", "list": "groceries"})
+	if len(remote.items[listID]) != 1 || remote.items[listID][0].Text != "coffee" {
+		t.Errorf("Expected checked items to be removed remotely, got %+v", remote.items[listID])
+	}
+}
+
+// TestGoogleTasksSync_EnsureList verifies an existing task list is reused before creating one
+func TestGoogleTasksSync_EnsureList(t *testing.T) {
+	created := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("pageToken") == "":
+			w.Write([]byte(`{"items":[{"id":"a","title":"Work"}],"nextPageToken":"p2"}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"items":[{"id":"b","title":"shopping"}]}`))
+		default:
+			created = true
+			w.Write([]byte(`{"id":"new"}`))
+		}
+	}))
+	defer server.Close()
+
+	sync := NewGoogleTasksSync(func(ctx context.Context) (string, error) { return "tok", nil })
+	sync.baseURL = server.URL
+
+	id, err := sync.EnsureList(context.Background(), "Shopping")
+	if err != nil {
+		t.Fatalf("EnsureList failed: %v", err)
+	}
+	if id != "b" || created {
+		t.Errorf("Expected existing list b, got %q (created=%v)", id, created)
+	}
+}
+
+// TestCalDAVTasksSync_RoundTrip verifies a task list is created once, and tasks are added, ticked off and removed on the server
+func TestCalDAVTasksSync_RoundTrip(t *testing.T) {
+	var mu sync.Mutex
+	calendars := map[string]string{"/cal/ana/work/": "Work"}
+	tasks := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case "PROPFIND":
+			var sb strings.Builder
+			sb.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+			for href, name := range calendars {
+				fmt.Fprintf(&sb, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:displayname>%s</d:displayname>`+
+					`<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>`+
+					`<c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>`+
+					`</d:prop></d:propstat></d:response>`, href, name)
+			}
+			sb.WriteString(`</d:multistatus>`)
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write([]byte(sb.String()))
+		case "MKCALENDAR":
+			if !strings.Contains(string(body), `<c:comp name="VTODO"/>`) {
+				t.Errorf("calendar created without VTODO support: %s", body)
+			}
+			calendars[r.URL.Path] = "Groceries"
+			w.WriteHeader(http.StatusCreated)
+		case "REPORT":
+			var sb strings.Builder
+			sb.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+			for href, data := range tasks {
+				if strings.HasPrefix(href, r.URL.Path) {
+					var escaped bytes.Buffer
+					xml.EscapeText(&escaped, []byte(data))
+					fmt.Fprintf(&sb, `<d:response><d:href>%s</d:href><d:propstat><d:prop><c:calendar-data>%s</c:calendar-data></d:prop></d:propstat></d:response>`, href, escaped.String())
+				}
+			}
+			sb.WriteString(`</d:multistatus>`)
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write([]byte(sb.String()))
+		case http.MethodPut:
+			tasks[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			w.Header().Set("ETag", `"1"`)
+			w.Write([]byte(tasks[r.URL.Path]))
+		case http.MethodDelete:
+			delete(tasks, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	remote := NewCalDAVTasksSync(server.URL+"/cal/ana", "ana", "app-password")
+	tool := NewListTool(t.TempDir(), remote)
+	tool.SetContext("telegram", "42")
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"action": "add", "list": "groceries", "items": []interface{}{"eggs", "milk"}})
+	tool.Execute(ctx, map[string]interface{}{"action": "check", "list": "groceries", "items": []interface{}{"eggs"}})
+	if len(calendars) != 2 || len(tasks) != 2 {
+		t.Fatalf("expected one new task list with two tasks, got %v %v", calendars, tasks)
+	}
+	id, err := remote.EnsureList(ctx, "groceries")
+	if err != nil || calendars[id] != "Groceries" {
+		t.Fatalf("EnsureList did not find the list: %q %v", id, err)
+	}
+	items, err := remote.Items(ctx, id)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Items: %v %+v", err, items)
+	}
+	for _, item := range items {
+		if item.Checked != (item.Text == "eggs") {
+			t.Errorf("unexpected task state: %+v", item)
+		}
+	}
+
+	tool.Execute(ctx, map[string]interface{}{"action": "clear_checked", "list": "groceries"})
+	if len(tasks) != 1 {
+		t.Errorf("expected the ticked off task to be deleted, got %v", tasks)
+	}
+}
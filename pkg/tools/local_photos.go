@@ -0,0 +1,405 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/mediaindex"
+	"github.com/sipeed/picoclaw/pkg/tasks"
+)
+
+const (
+	// localPhotosRescanAfter triggers an automatic rescan before searching
+	localPhotosRescanAfter = 10 * time.Minute
+	maxLocalPhotoResults   = 200
+	// maxLocalPhotoUploads bounds one upload call; larger sets take several
+	maxLocalPhotoUploads = 50
+	// localPhotosScanWait is how long a scan run as a task is waited for
+	// before it is left to report in the chat when done
+	localPhotosScanWait = 20 * time.Second
+	localPhotosScanKind = "local_photos_scan"
+)
+
+// LocalPhotosTool searches photos and videos on device storage (an SD card,
+// a USB disk) through a SQLite index, and uploads them to Google Photos.
+type LocalPhotosTool struct {
+	index        *mediaindex.Index
+	photos       *GooglePhotosClient
+	drive        *GoogleDriveClient
+	tasks        *tasks.Manager
+	defaultAlbum string
+}
+
+// NewLocalPhotosTool creates the tool. photos may be nil, which disables
+// uploads.
+func NewLocalPhotosTool(index *mediaindex.Index, photos *GooglePhotosClient) *LocalPhotosTool {
+	return &LocalPhotosTool{index: index, photos: photos}
+}
+
+// SetDrive lets uploads report the Google account's storage, which
+// Photos shares with Drive and Gmail.
+func (t *LocalPhotosTool) SetDrive(drive *GoogleDriveClient) {
+	t.drive = drive
+}
+
+// SetTasks implements BackgroundTool: a scan of a large card goes on in
+// the background as a task instead of holding the reply up.
+func (t *LocalPhotosTool) SetTasks(m *tasks.Manager) {
+	t.tasks = m
+	m.Handle(localPhotosScanKind, func(ctx context.Context, run *tasks.Run) (string, error) {
+		stats, err := t.index.Scan(ctx)
+		if err != nil {
+			return "", err
+		}
+		return formatScanStats(stats), nil
+	})
+}
+
+func (t *LocalPhotosTool) Name() string {
+	return "local_photos"
+}
+
+func (t *LocalPhotosTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *LocalPhotosTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "upload")
+}
+
+func (t *LocalPhotosTool) ActionScopes() map[string][]string {
+	if t.photos == nil {
+		return nil
+	}
+	return map[string][]string{"upload": googleScopes("photoslibrary", "photoslibrary.appendonly")}
+}
+
+func (t *LocalPhotosTool) Description() string {
+	desc := "Search photos and videos stored on this device (" + strings.Join(t.index.Roots(), ", ") +
+		") by date and folder, list folders, or rescan after a card is inserted."
+	if t.photos != nil {
+		desc += " Upload selected files (by id from search results) to Google Photos, optionally into an album; the result says how much storage they took."
+		if t.drive != nil {
+			desc += " storage shows how much of the Google account's storage is used before a large upload."
+		}
+	}
+	return desc
+}
+
+// Configure takes "default_album", the album uploads go to when none is
+// given.
+func (t *LocalPhotosTool) Configure(settings ToolSettings) error {
+	album, err := settings.String("default_album")
+	t.defaultAlbum = strings.TrimSpace(album)
+	return err
+}
+
+func (t *LocalPhotosTool) Parameters() map[string]interface{} {
+	actions := []string{"search", "folders", "scan"}
+	if t.photos != nil {
+		actions = append(actions, "upload")
+		if t.drive != nil {
+			actions = append(actions, "storage")
+		}
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        actions,
+				"description": "Action to perform",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "First day taken, YYYY-MM-DD (search)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Last day taken, YYYY-MM-DD (search)",
+			},
+			"folder": map[string]interface{}{
+				"type":        "string",
+				"description": "Folder name or path, e.g. \"DCIM/100CANON\" (search)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum results (default 50)",
+			},
+			"ids": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "integer"},
+				"description": "Item ids to upload",
+			},
+			"album": map[string]interface{}{
+				"type":        "string",
+				"description": "Google Photos album title to upload into; created if missing (upload)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *LocalPhotosTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "scan":
+		if channel, chatID := ChatFromContext(ctx); t.tasks != nil && channel != "" {
+			return t.scanInBackground(channel, chatID)
+		}
+		stats, err := t.index.Scan(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("scan failed: %v", err)).WithError(err)
+		}
+		return SilentResult(formatScanStats(stats))
+
+	case "folders":
+		if err := t.refresh(ctx); err != nil {
+			return ErrorResult(fmt.Sprintf("scan failed: %v", err)).WithError(err)
+		}
+		folders, err := t.index.Folders(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list folders: %v", err)).WithError(err)
+		}
+		if len(folders) == 0 {
+			return SilentResult("No photos or videos indexed")
+		}
+		names := make([]string, 0, len(folders))
+		for name := range folders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var sb strings.Builder
+		sb.WriteString("Folders:\n")
+		for _, name := range names {
+			fmt.Fprintf(&sb, "- %s (%d)\n", name, folders[name])
+		}
+		return SilentResult(strings.TrimSuffix(sb.String(), "\n"))
+
+	case "search":
+		q := mediaindex.Query{Limit: 50}
+		for key, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+			if s, _ := args[key].(string); s != "" {
+				d, err := time.Parse("2006-01-02", s)
+				if err != nil {
+					return ErrorResult(fmt.Sprintf("invalid %s date %q (expected YYYY-MM-DD)", key, s))
+				}
+				*dst = d
+			}
+		}
+		q.Folder, _ = args["folder"].(string)
+		if l, ok := args["limit"].(float64); ok && l > 0 {
+			q.Limit = min(int(l), maxLocalPhotoResults)
+		}
+		if err := t.refresh(ctx); err != nil {
+			return ErrorResult(fmt.Sprintf("scan failed: %v", err)).WithError(err)
+		}
+		items, err := t.index.Search(ctx, q)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("search failed: %v", err)).WithError(err)
+		}
+		if len(items) == 0 {
+			return SilentResult("No matching photos or videos")
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d item(s):\n", len(items))
+		for _, item := range items {
+			fmt.Fprintf(&sb, "- [%d] %s %s/%s", item.ID, item.Taken.Format("2006-01-02 15:04"), item.Folder, item.Name)
+			if item.Camera != "" {
+				sb.WriteString(" · " + item.Camera)
+			}
+			if item.HasLocation {
+				fmt.Fprintf(&sb, " · %.4f,%.4f", item.Latitude, item.Longitude)
+			}
+			if item.UploadedID != "" {
+				sb.WriteString(" · uploaded")
+			}
+			sb.WriteString("\n")
+		}
+		if len(items) == q.Limit {
+			sb.WriteString("(more results may exist; narrow the dates or raise limit)")
+		}
+		return SilentResult(strings.TrimSuffix(sb.String(), "\n"))
+
+	case "upload":
+		if t.photos == nil {
+			return ErrorResult("uploads need Google Photos access (tools.photos.enabled)")
+		}
+		raw, _ := args["ids"].([]interface{})
+		var ids []int64
+		for _, v := range raw {
+			if f, ok := v.(float64); ok {
+				ids = append(ids, int64(f))
+			}
+		}
+		if len(ids) == 0 {
+			return ErrorResult("ids are required")
+		}
+		if len(ids) > maxLocalPhotoUploads {
+			return ErrorResult(fmt.Sprintf("at most %d files per upload; split the selection", maxLocalPhotoUploads))
+		}
+		items, err := t.index.Get(ctx, ids)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to load items: %v", err)).WithError(err)
+		}
+		albumTitle, _ := args["album"].(string)
+		if strings.TrimSpace(albumTitle) == "" {
+			albumTitle = t.defaultAlbum
+		}
+		return t.upload(ctx, items, strings.TrimSpace(albumTitle))
+
+	case "storage":
+		if t.photos == nil || t.drive == nil {
+			return ErrorResult("storage needs Google Photos and Drive to be enabled")
+		}
+		return NewToolResult(t.storageReport(ctx))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// scanInBackground runs a scan as a task, answering with its result if it
+// finishes quickly.
+func (t *LocalPhotosTool) scanInBackground(channel, chatID string) *ToolResult {
+	task, err := t.tasks.Start(localPhotosScanKind, "photo index scan", channel, chatID, nil)
+	if err == tasks.ErrRunning {
+		return SilentResult("A scan is already running: " + tasks.Describe(task))
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("scan failed: %v", err)).WithError(err)
+	}
+	task, done := t.tasks.Wait(task.ID, localPhotosScanWait)
+	switch {
+	case !done:
+		return SilentResult("The scan is taking a while and goes on in the background; I'll report here when it is done. Its progress can be asked for with the background_tasks tool.")
+	case task.Status == tasks.Failed:
+		return ErrorResult("scan failed: " + task.Error).WithError(errors.New(task.Error))
+	}
+	return SilentResult(task.Result)
+}
+
+// refresh rescans when the index is stale, so a newly inserted card shows
+// up without an explicit scan.
+func (t *LocalPhotosTool) refresh(ctx context.Context) error {
+	if time.Since(t.index.LastScan()) < localPhotosRescanAfter {
+		return nil
+	}
+	_, err := t.index.Scan(ctx)
+	return err
+}
+
+func (t *LocalPhotosTool) upload(ctx context.Context, items []mediaindex.Item, albumTitle string) *ToolResult {
+	var albumID, albumURL string
+	if albumTitle != "" {
+		albums, err := t.photos.ListAlbums(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list albums: %v", err)).WithError(err)
+		}
+		for _, a := range albums {
+			if strings.EqualFold(a.Title, albumTitle) {
+				albumID, albumURL = a.ID, a.ProductURL
+				break
+			}
+		}
+		if albumID == "" {
+			album, err := t.photos.CreateAlbum(ctx, albumTitle)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("failed to create album: %v", err)).WithError(err)
+			}
+			albumID, albumURL = album.ID, album.ProductURL
+		}
+	}
+
+	var uploaded, skipped int
+	var sent, source int64
+	var failures []string
+	for _, item := range items {
+		if ctx.Err() != nil {
+			failures = append(failures, "interrupted: "+ctx.Err().Error())
+			break
+		}
+		if item.UploadedID != "" {
+			skipped++
+			continue
+		}
+		f, err := os.Open(item.Path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", item.Name, err))
+			continue
+		}
+		remote, err := t.photos.Upload(ctx, item.Name, item.MimeType, f, albumID)
+		f.Close()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", item.Name, err))
+			continue
+		}
+		if err := t.index.MarkUploaded(ctx, item.ID, remote.ID); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: uploaded but not recorded: %v", item.Name, err))
+		}
+		uploaded++
+		sent += max(remote.Bytes, 0)
+		source += max(remote.SourceBytes, 0)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Uploaded %d file(s) to Google Photos", uploaded)
+	if albumTitle != "" {
+		fmt.Fprintf(&sb, " (album %q %s)", albumTitle, albumURL)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(&sb, "; %d already uploaded", skipped)
+	}
+	if uploaded > 0 {
+		fmt.Fprintf(&sb, "\nStorage taken: %s", formatFileSize(sent))
+		if source > sent {
+			fmt.Fprintf(&sb, " (%s before downscaling)", formatFileSize(source))
+		}
+		if t.drive != nil {
+			if q, err := t.drive.StorageQuota(ctx); err == nil {
+				fmt.Fprintf(&sb, "\nGoogle account storage: %s", q)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&sb, "\n%d failed:\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return NewToolResult(sb.String())
+}
+
+// storageReport describes the account's storage and how uploads are
+// downscaled to save it.
+func (t *LocalPhotosTool) storageReport(ctx context.Context) string {
+	var sb strings.Builder
+	if q, err := t.drive.StorageQuota(ctx); err != nil {
+		fmt.Fprintf(&sb, "Could not read the Google account storage: %v", err)
+	} else {
+		fmt.Fprintf(&sb, "Google account storage: %s", q)
+	}
+	q := currentPhotoUploadQuality()
+	switch {
+	case q.MaxDimension > 0 && q.Quality > 0:
+		fmt.Fprintf(&sb, "\nJPEG photos are uploaded at most %d px on their longest side, at quality %d.", q.MaxDimension, q.Quality)
+	case q.MaxDimension > 0:
+		fmt.Fprintf(&sb, "\nJPEG photos are uploaded at most %d px on their longest side.", q.MaxDimension)
+	case q.Quality > 0:
+		fmt.Fprintf(&sb, "\nJPEG photos are uploaded re-encoded at quality %d.", q.Quality)
+	default:
+		sb.WriteString("\nPhotos are uploaded as originals; the owner can set tools.photos.upload to downscale them.")
+	}
+	return sb.String()
+}
+
+func formatScanStats(s *mediaindex.ScanStats) string {
+	msg := fmt.Sprintf("Scan complete: %d new, %d updated, %d removed, %d unchanged", s.Added, s.Updated, s.Removed, s.Unchanged)
+	if len(s.Offline) > 0 {
+		msg += "\nNot present (kept in index): " + strings.Join(s.Offline, ", ")
+	}
+	return msg
+}
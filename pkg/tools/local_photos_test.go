@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/mediaindex"
+)
+
+// TestLocalPhotosTool_SearchAndUpload verifies indexed files are found and uploaded once into a new album
+func TestLocalPhotosTool_SearchAndUpload(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	card := filepath.Join(t.TempDir(), "DCIM")
+	os.MkdirAll(filepath.Join(card, "100GOPRO"), 0755)
+	os.WriteFile(filepath.Join(card, "100GOPRO", "GX01.mp4"), []byte("video-bytes"), 0644)
+
+	var uploads []string
+	var albumForItem string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/albums":
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`{"albums":[]}`))
+				return
+			}
+			w.Write([]byte(`{"id":"alb1","title":"Surf","productUrl":"https://photos/alb1"}`))
+		case "/uploads":
+			body, _ := io.ReadAll(r.Body)
+			uploads = append(uploads, r.Header.Get("X-Goog-Upload-Content-Type")+":"+string(body))
+			w.Write([]byte("upload-token-1"))
+		case "/mediaItems:batchCreate":
+			var req struct {
+				AlbumID       string `json:"albumId"`
+				NewMediaItems []struct {
+					SimpleMediaItem struct {
+						UploadToken string `json:"uploadToken"`
+					} `json:"simpleMediaItem"`
+				} `json:"newMediaItems"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			albumForItem = req.AlbumID
+			if req.NewMediaItems[0].SimpleMediaItem.UploadToken != "upload-token-1" {
+				t.Errorf("unexpected upload token")
+			}
+			w.Write([]byte(`{"newMediaItemResults":[{"status":{"message":"Success"},"mediaItem":{"id":"m1"}}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	photos := NewGooglePhotosClient(func(ctx context.Context) (string, error) { return "tok", nil })
+	photos.baseURL = server.URL
+	state := t.TempDir()
+	index := mediaindex.New(filepath.Join(state, "index.db"), filepath.Join(state, "thumbs"), []string{card})
+	tool := NewLocalPhotosTool(index, photos)
+	ctx := context.Background()
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "search", "folder": "100GOPRO"})
+	if r.IsError || !strings.Contains(r.ForLLM, "[1]") || !strings.Contains(r.ForLLM, "GX01.mp4") {
+		t.Fatalf("unexpected search result: %s", r.ForLLM)
+	}
+
+	upload := map[string]interface{}{"action": "upload", "ids": []interface{}{float64(1)}, "album": "Surf"}
+	r = tool.Execute(ctx, upload)
+	if r.IsError || !strings.Contains(r.ForLLM, "Uploaded 1 file") {
+		t.Fatalf("unexpected upload result: %s", r.ForLLM)
+	}
+	if len(uploads) != 1 || uploads[0] != "video/mp4:video-bytes" || albumForItem != "alb1" {
+		t.Fatalf("unexpected uploads %v into %q", uploads, albumForItem)
+	}
+
+	r = tool.Execute(ctx, upload)
+	if !strings.Contains(r.ForLLM, "1 already uploaded") || len(uploads) != 1 {
+		t.Errorf("file uploaded twice: %s", r.ForLLM)
+	}
+}
+
+// TestLocalPhotosTool_UploadDownscalesAndReportsStorage verifies JPEG photos are downscaled before upload with their EXIF kept, and the result reports the storage taken and the account's quota
+func TestLocalPhotosTool_UploadDownscalesAndReportsStorage(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	SetPhotoUploadQuality(PhotoUploadQuality{MaxDimension: 200, Quality: 70})
+	t.Cleanup(func() { SetPhotoUploadQuality(PhotoUploadQuality{}) })
+
+	card := filepath.Join(t.TempDir(), "DCIM")
+	os.MkdirAll(card, 0755)
+	img := image.NewRGBA(image.Rect(0, 0, 1600, 1200))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	// An EXIF segment naming the camera, right after SOI
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x0f\x01\x02\x00\x04\x00\x00\x00Pix\x00\x00\x00\x00\x00")
+	segment := append([]byte{0xFF, 0xE1, 0, byte(2 + 6 + len(tiff))}, append([]byte("Exif\x00\x00"), tiff...)...)
+	original := append(append([]byte{0xFF, 0xD8}, segment...), buf.Bytes()[2:]...)
+	os.WriteFile(filepath.Join(card, "IMG_1.jpg"), original, 0644)
+
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/uploads":
+			uploaded, _ = io.ReadAll(r.Body)
+			w.Write([]byte("tok-1"))
+		case "/mediaItems:batchCreate":
+			w.Write([]byte(`{"newMediaItemResults":[{"status":{"message":"Success"},"mediaItem":{"id":"m1"}}]}`))
+		case "/about":
+			w.Write([]byte(`{"storageQuota":{"limit":"16106127360","usage":"12884901888","usageInDrive":"3221225472"}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	token := func(ctx context.Context) (string, error) { return "tok", nil }
+	photos := NewGooglePhotosClient(token)
+	photos.baseURL = server.URL
+	drive := NewGoogleDriveClient(token)
+	drive.baseURL = server.URL
+	state := t.TempDir()
+	index := mediaindex.New(filepath.Join(state, "index.db"), filepath.Join(state, "thumbs"), []string{card})
+	tool := NewLocalPhotosTool(index, photos)
+	tool.SetDrive(drive)
+	ctx := context.Background()
+	tool.Execute(ctx, map[string]interface{}{"action": "scan"})
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "upload", "ids": []interface{}{float64(1)}})
+	if r.IsError || !strings.Contains(r.ForLLM, "before downscaling") || !strings.Contains(r.ForLLM, "12.0 GB of 15.0 GB used (80%); Gmail and Photos take 9.0 GB") {
+		t.Fatalf("unexpected upload result: %s", r.ForLLM)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(uploaded))
+	if err != nil || cfg.Width != 200 || len(uploaded) >= len(original) {
+		t.Fatalf("upload not downscaled: %+v %v, %d bytes", cfg, err, len(uploaded))
+	}
+	if !bytes.Contains(uploaded[:64], []byte("Exif\x00\x00")) {
+		t.Error("EXIF not kept")
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "storage"}); !strings.Contains(r.ForLLM, "at most 200 px") {
+		t.Errorf("unexpected storage report: %s", r.ForLLM)
+	}
+}
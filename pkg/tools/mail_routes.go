@@ -0,0 +1,633 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	mailRoutesJobKind = "mail_routes"
+	// mailDigestKind is the kind mail routed to the notification digest is
+	// held under; it is not a job of its own
+	mailDigestKind = "mail_digest"
+	// maxRoutedMessages bounds the new messages read per label and check
+	maxRoutedMessages = 50
+	// mailSeenRetention is how long routed message IDs are kept; checks
+	// only search a little before the last one anyway
+	mailSeenRetention = 7 * 24 * time.Hour
+	// mailCheckOverlap is searched again before the last check, for mail
+	// labeled by a filter after it arrived
+	mailCheckOverlap = 10 * time.Minute
+)
+
+// mailRoutePeriods are the routes that batch mail into a summary, and how
+// often the summary is sent.
+var mailRoutePeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// mailRouteNames are the routes a label can take: now sends each email at
+// once, digest holds it for the chat's notification digest (sent at once
+// when the chat is not in digest mode), daily and weekly batch it into a
+// summary and mute drops it.
+var mailRouteNames = []string{"now", "digest", "daily", "weekly", "mute"}
+
+// MailRoutesOptions configures the router.
+type MailRoutesOptions struct {
+	// Every is how often new mail is checked for chats with rules
+	Every time.Duration
+}
+
+// mailRule routes mail carrying Label. Rules are tried in the order they
+// were made; an email goes where the first one matching it says.
+type mailRule struct {
+	Label string `json:"label"`
+	Route string `json:"route"`
+}
+
+// mailRouteChat is what a chat gets mail routed to it by.
+type mailRouteChat struct {
+	Rules     []mailRule           `json:"rules"`
+	LastCheck time.Time            `json:"last_check"`
+	Seen      map[string]time.Time `json:"seen,omitempty"`
+	// Batches holds the mail of the daily and weekly routes until Due
+	Batches map[string][]digestItem `json:"batches,omitempty"`
+	Due     map[string]time.Time    `json:"due,omitempty"`
+}
+
+type mailRoutesState struct {
+	Chats map[string]*mailRouteChat `json:"chats"`
+}
+
+// MailRoutesTool routes new Gmail mail by label: "anything labeled
+// Finance, tell me on Telegram at once; Newsletters, once a week". A
+// schedule per chat with rules looks for newly labeled mail and sends,
+// holds or drops each email as its label's rule says. Rules can send to
+// another of the user's linked accounts, so one made on WhatsApp can
+// notify on Telegram.
+type MailRoutesTool struct {
+	gmail      *GmailClient
+	digest     *NotificationDigest
+	identities *identity.Store
+	opts       MailRoutesOptions
+	statePath  string
+	scheduler  *cron.CronService
+	mu         sync.Mutex
+	now        func() time.Time
+}
+
+// NewMailRoutesTool creates the tool. State is kept in
+// workspace/state/mail_routes.json. digest and identities may be nil,
+// which sends digest-routed mail at once and keeps rules to the chat
+// they were made in.
+func NewMailRoutesTool(token TokenFunc, workspace string, opts MailRoutesOptions, digest *NotificationDigest, identities *identity.Store) *MailRoutesTool {
+	if opts.Every <= 0 {
+		opts.Every = 10 * time.Minute
+	}
+	return &MailRoutesTool{
+		gmail:      NewGmailClient(token),
+		digest:     digest,
+		identities: identities,
+		opts:       opts,
+		statePath:  filepath.Join(workspace, "state", "mail_routes.json"),
+		now:        time.Now,
+	}
+}
+
+func (t *MailRoutesTool) Name() string {
+	return "mail_routes"
+}
+
+func (t *MailRoutesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "remove")
+}
+
+// Untrusted reports that checks carry the subjects and senders of the
+// mail routed.
+func (t *MailRoutesTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "check")
+}
+
+func (t *MailRoutesTool) Description() string {
+	return "Route new Gmail mail by label: add a rule sending mail with a label to this chat at once (now), into the notification digest (digest), as a daily or weekly summary, or nowhere (mute); " +
+		"to sends it to another of the user's linked accounts instead, e.g. \"telegram\". In each chat the first rule an email matches wins. list shows the rules, remove drops a label's rule, check looks for new mail now. " +
+		"Use it for requests like \"anything labeled Finance, ping me on Telegram right away; newsletters once a week\"."
+}
+
+func (t *MailRoutesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"add", "remove", "list", "check"},
+				"description": "Action to perform",
+			},
+			"label": map[string]interface{}{
+				"type":        "string",
+				"description": "add, remove: the Gmail label, e.g. \"Finance\", or a system one such as IMPORTANT or CATEGORY_UPDATES",
+			},
+			"route": map[string]interface{}{
+				"type":        "string",
+				"enum":        mailRouteNames,
+				"description": "add: where the label's mail goes",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "add: the channel of another linked account of the user to notify there, e.g. \"telegram\" (default: this chat)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *MailRoutesTool) JobKinds() []string {
+	return []string{mailRoutesJobKind}
+}
+
+func (t *MailRoutesTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *MailRoutesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chat := channel + ":" + chatID
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "add":
+		msg, err := t.add(ctx, chat, args)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "remove":
+		label, _ := args["label"].(string)
+		msg, err := t.remove(chat, label)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "list":
+		msg, err := t.list(chat)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "check":
+		report, err := t.check(ctx, chat)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to check for new mail: %v", err)).WithError(err)
+		}
+		if report == "" {
+			return SilentResult("No new mail to send now.")
+		}
+		return UserResult(report)
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// accounts returns the chats of the person behind chat.
+func (t *MailRoutesTool) accounts(chat string) []string {
+	if t.identities == nil {
+		return []string{chat}
+	}
+	return t.identities.Accounts(chat)
+}
+
+// destination returns the chat of the person behind chat on channel to,
+// or chat itself when to is empty.
+func (t *MailRoutesTool) destination(chat, to string) (string, error) {
+	to = strings.ToLower(strings.TrimSpace(to))
+	if to == "" {
+		return chat, nil
+	}
+	for _, account := range t.accounts(chat) {
+		if channel, _, _ := strings.Cut(account, ":"); channel == to {
+			return account, nil
+		}
+	}
+	return "", fmt.Errorf("no %s account is linked to this chat; link it with the identity tool first, or leave to empty to be notified here", to)
+}
+
+// label returns the mailbox's name for label, matched case-insensitively.
+func (t *MailRoutesTool) label(ctx context.Context, label string) (string, error) {
+	labels, err := t.gmail.Labels(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list Gmail labels: %w", err)
+	}
+	var names []string
+	for _, l := range labels {
+		if strings.EqualFold(l.Name, label) {
+			return l.Name, nil
+		}
+		if l.Type == "user" {
+			names = append(names, l.Name)
+		}
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("there is no Gmail label %q; your labels: %s", label, strings.Join(names, ", "))
+}
+
+func (t *MailRoutesTool) add(ctx context.Context, chat string, args map[string]interface{}) (string, error) {
+	if t.scheduler == nil {
+		return "", fmt.Errorf("mail routing is not available (scheduler not running)")
+	}
+	label, _ := args["label"].(string)
+	route, _ := args["route"].(string)
+	to, _ := args["to"].(string)
+	if strings.TrimSpace(label) == "" {
+		return "", fmt.Errorf("label is required")
+	}
+	valid := false
+	for _, name := range mailRouteNames {
+		valid = valid || name == route
+	}
+	if !valid {
+		return "", fmt.Errorf("route must be one of %s", strings.Join(mailRouteNames, ", "))
+	}
+	dest, err := t.destination(chat, to)
+	if err != nil {
+		return "", err
+	}
+	name, err := t.label(ctx, strings.TrimSpace(label))
+	if err != nil {
+		return "", err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	// A label has one rule per person: a new one replaces the old, which
+	// may send to another of their accounts
+	for _, account := range t.accounts(chat) {
+		if c := state.Chats[account]; c != nil {
+			c.Rules = withoutLabel(c.Rules, name)
+		}
+	}
+	c := state.Chats[dest]
+	if c == nil {
+		// Mail from before the first rule is not news
+		c = &mailRouteChat{LastCheck: t.now()}
+		state.Chats[dest] = c
+	}
+	c.Rules = append(c.Rules, mailRule{Label: name, Route: route})
+	if period, ok := mailRoutePeriods[route]; ok {
+		if c.Due == nil {
+			c.Due = map[string]time.Time{}
+		}
+		if _, ok := c.Due[route]; !ok {
+			c.Due[route] = t.now().Add(period)
+		}
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	t.unscheduleIdle(state, t.accounts(chat))
+	if err := t.schedule(dest); err != nil {
+		return "", err
+	}
+
+	where := "this chat"
+	if dest != chat {
+		where = dest
+	}
+	return fmt.Sprintf("New mail labeled %s %s (to %s). Mail is checked every %s.", name, describeMailRoute(route), where, formatETA(t.opts.Every)), nil
+}
+
+func withoutLabel(rules []mailRule, label string) []mailRule {
+	var kept []mailRule
+	for _, r := range rules {
+		if !strings.EqualFold(r.Label, label) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func describeMailRoute(route string) string {
+	switch route {
+	case "now":
+		return "is sent at once"
+	case "digest":
+		return "goes into the notification digest"
+	case "mute":
+		return "is not notified"
+	}
+	return "is sent as a " + route + " summary"
+}
+
+func (t *MailRoutesTool) remove(chat, label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return "", fmt.Errorf("label is required")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	removed := false
+	for _, account := range t.accounts(chat) {
+		c := state.Chats[account]
+		if c == nil {
+			continue
+		}
+		rules := withoutLabel(c.Rules, label)
+		removed = removed || len(rules) < len(c.Rules)
+		c.Rules = rules
+	}
+	if !removed {
+		return fmt.Sprintf("There is no rule for %s.", label), nil
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	t.unscheduleIdle(state, t.accounts(chat))
+	return fmt.Sprintf("Mail labeled %s is no longer routed; what is waiting in its summary is still sent.", label), nil
+}
+
+func (t *MailRoutesTool) list(chat string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, account := range t.accounts(chat) {
+		c := state.Chats[account]
+		if c == nil {
+			continue
+		}
+		for _, r := range c.Rules {
+			line := fmt.Sprintf("- %s %s", r.Label, describeMailRoute(r.Route))
+			if account != chat {
+				line += " (to " + account + ")"
+			}
+			lines = append(lines, line)
+		}
+		for route, items := range c.Batches {
+			if len(items) > 0 {
+				lines = append(lines, fmt.Sprintf("  %d email(s) waiting for the %s summary of %s", len(items), route, c.Due[route].Format("Mon Jan 2 15:04")))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "No mail routing rules. Other mail is not notified.", nil
+	}
+	return "Mail routing rules (the first one an email matches in a chat wins):\n" + strings.Join(lines, "\n"), nil
+}
+
+// schedule starts the chat's check, unless it has one.
+func (t *MailRoutesTool) schedule(chat string) error {
+	channel, chatID, _ := strings.Cut(chat, ":")
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == mailRoutesJobKind && job.Payload.Channel == channel && job.Payload.To == chatID {
+			return nil
+		}
+	}
+	everyMS := t.opts.Every.Milliseconds()
+	_, err := t.scheduler.AddJobWithPayload("Mail routes", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+		Kind:    mailRoutesJobKind,
+		Message: "Mail routes",
+		Channel: channel,
+		To:      chatID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule the mail check: %w", err)
+	}
+	return nil
+}
+
+// unschedule removes the chat's check, once it has nothing left to send.
+func (t *MailRoutesTool) unschedule(chat string) {
+	if t.scheduler == nil {
+		return
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == mailRoutesJobKind && job.Payload.Channel+":"+job.Payload.To == chat {
+			t.scheduler.RemoveJob(job.ID)
+		}
+	}
+}
+
+// unscheduleIdle removes the check of those of chats left without rules
+// or summaries to send.
+func (t *MailRoutesTool) unscheduleIdle(state *mailRoutesState, chats []string) {
+	for _, chat := range chats {
+		if c := state.Chats[chat]; c != nil && len(c.Rules) == 0 && len(c.Due) == 0 {
+			t.unschedule(chat)
+		}
+	}
+}
+
+// ExecuteJob implements ScheduledTool. It sends mail routed to now and
+// the summaries that are due, and says nothing otherwise.
+func (t *MailRoutesTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.check(ctx, job.Payload.Channel+":"+job.Payload.To)
+}
+
+// check routes the mail labeled since the chat's last check and returns
+// what to send now, "" when there is nothing.
+func (t *MailRoutesTool) check(ctx context.Context, chat string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	c := state.Chats[chat]
+	if c == nil {
+		return "", nil
+	}
+	if c.Seen == nil {
+		c.Seen = map[string]time.Time{}
+	}
+	if c.Batches == nil {
+		c.Batches = map[string][]digestItem{}
+	}
+	now := t.now()
+	window := GmailDateQuery(c.LastCheck.Add(-mailCheckOverlap), time.Time{})
+
+	var immediate, failures []string
+	for _, rule := range c.Rules {
+		messages, err := t.gmail.SearchSummaries(ctx, gmailLabelQuery(rule.Label)+" "+window, maxRoutedMessages)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", rule.Label, err))
+			continue
+		}
+		// Oldest first, so batches and pings read in order
+		for i := len(messages) - 1; i >= 0; i-- {
+			m := messages[i]
+			if _, done := c.Seen[m.ID]; done {
+				continue
+			}
+			c.Seen[m.ID] = now
+			line := routedMailLine(m)
+			switch rule.Route {
+			case "now":
+				immediate = append(immediate, fmt.Sprintf("📧 %s: %s", rule.Label, line))
+			case "digest":
+				if !t.digest.Hold(chat, mailDigestKind, rule.Label+": "+line) {
+					immediate = append(immediate, fmt.Sprintf("📧 %s: %s", rule.Label, line))
+				}
+			case "daily", "weekly":
+				c.Batches[rule.Route] = append(c.Batches[rule.Route], digestItem{Category: rule.Label, Content: line, At: m.Received})
+			}
+		}
+	}
+	for id, at := range c.Seen {
+		if now.Sub(at) > mailSeenRetention {
+			delete(c.Seen, id)
+		}
+	}
+	if len(failures) == 0 {
+		c.LastCheck = now
+	}
+
+	var summaries []string
+	for _, route := range []string{"daily", "weekly"} {
+		due, ok := c.Due[route]
+		if !ok || now.Before(due) {
+			continue
+		}
+		if items := c.Batches[route]; len(items) > 0 {
+			summaries = append(summaries, fmt.Sprintf("📬 %s mail %s", strings.ToUpper(route[:1])+route[1:], digestSummary(items, 0)))
+		}
+		delete(c.Batches, route)
+		if routeInUse(c.Rules, route) {
+			for !now.Before(due) {
+				due = due.Add(mailRoutePeriods[route])
+			}
+			c.Due[route] = due
+		} else {
+			delete(c.Due, route)
+		}
+	}
+	if len(c.Rules) == 0 && len(c.Due) == 0 {
+		delete(state.Chats, chat)
+		t.unschedule(chat)
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.Join(immediate, "\n"))
+	for _, summary := range summaries {
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(summary)
+	}
+	if len(failures) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⚠️ Could not check %d label(s):\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return sb.String(), nil
+}
+
+func routeInUse(rules []mailRule, route string) bool {
+	for _, r := range rules {
+		if r.Route == route {
+			return true
+		}
+	}
+	return false
+}
+
+// gmailLabelQuery searches for mail with label; Gmail writes spaces and
+// slashes in label names as dashes in queries.
+func gmailLabelQuery(label string) string {
+	return "label:" + strings.NewReplacer(" ", "-", "/", "-").Replace(label)
+}
+
+// routedMailLine describes one email for a notification or summary.
+func routedMailLine(m GmailSummary) string {
+	line := senderName(m.From) + ": " + m.Subject
+	if snippet := strings.TrimSpace(m.Snippet); snippet != "" {
+		line += " — " + utils.Truncate(snippet, 120)
+	}
+	return line
+}
+
+// loadState reads the state; callers hold t.mu.
+func (t *MailRoutesTool) loadState() (*mailRoutesState, error) {
+	state := &mailRoutesState{}
+	data, err := os.ReadFile(t.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read mail routes: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse mail routes: %w", err)
+		}
+	}
+	if state.Chats == nil {
+		state.Chats = make(map[string]*mailRouteChat)
+	}
+	return state, nil
+}
+
+// ChatData implements ChatDataStore: the chat's rules and the mail held
+// for it.
+func (t *MailRoutesTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if chat := state.Chats[chatKey]; chat != nil {
+		return chat, nil
+	}
+	return nil, nil
+}
+
+// PurgeChat implements ChatDataStore. The check schedule goes with the
+// chat's jobs.
+func (t *MailRoutesTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return 0, err
+	}
+	chat := state.Chats[chatKey]
+	if chat == nil {
+		return 0, nil
+	}
+	delete(state.Chats, chatKey)
+	n := len(chat.Rules)
+	for _, batch := range chat.Batches {
+		n += len(batch)
+	}
+	return n, saveJSONAtomic(t.statePath, state)
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestMailRoutesTool_RoutesByLabel verifies new mail goes where its first matching label rule says: at once to a linked account, into the digest, into a weekly summary, or nowhere
+func TestMailRoutesTool_RoutesByLabel(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	start := time.Now()
+	clock := start
+	g.AddEmail(testkit.Email{From: "Bank <bank@example.com>", Subject: "Old statement", Date: start.Add(-time.Hour), Labels: []string{"INBOX", "Finance"}})
+
+	// Mail that arrives after the rules are made
+	g.AddEmail(testkit.Email{From: "Bank <bank@example.com>", Subject: "Statement ready", Date: start.Add(time.Minute), Labels: []string{"INBOX", "Finance"}})
+	g.AddEmail(testkit.Email{From: "Shop <deals@example.com>", Subject: "50% off", Date: start.Add(time.Minute), Labels: []string{"Promotions", "Newsletters"}})
+	g.AddEmail(testkit.Email{From: "Weekly <news@example.com>", Subject: "Issue 12", Date: start.Add(2 * time.Minute), Labels: []string{"Newsletters"}})
+	g.AddEmail(testkit.Email{From: "GitHub <noreply@github.com>", Subject: "New release", Date: start.Add(2 * time.Minute), Labels: []string{"Updates"}})
+	workspace := t.TempDir()
+	identities := identity.NewStore(workspace)
+	code, err := identities.StartLink("whatsapp:2", "telegram:1")
+	if err != nil {
+		t.Fatalf("StartLink() error: %v", err)
+	}
+	if _, err := identities.Confirm("whatsapp:2", code); err != nil {
+		t.Fatalf("Confirm() error: %v", err)
+	}
+	digest := NewNotificationDigest(workspace)
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	digests := NewDigestTool(digest)
+	digests.SetScheduler(cs)
+	ctx := WithChat(context.Background(), "whatsapp", "2")
+	if result := digests.Execute(ctx, map[string]interface{}{"action": "on"}); result.IsError {
+		t.Fatalf("digest on failed: %s", result.ForLLM)
+	}
+
+	tool := NewMailRoutesTool(testkit.Token, workspace, MailRoutesOptions{}, digest, identities)
+	tool.SetScheduler(cs)
+	tool.now = func() time.Time { return clock }
+	for _, rule := range []map[string]interface{}{
+		{"label": "finance", "route": "now", "to": "telegram"},
+		{"label": "Promotions", "route": "mute"},
+		{"label": "Newsletters", "route": "weekly"},
+		{"label": "Updates", "route": "digest"},
+	} {
+		rule["action"] = "add"
+		if result := tool.Execute(ctx, rule); result.IsError {
+			t.Fatalf("add %v failed: %s", rule, result.ForLLM)
+		}
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "add", "label": "Travel", "route": "now"}); !result.IsError || !strings.Contains(result.ForLLM, "Finance, Newsletters") {
+		t.Errorf("Expected an unknown label refused with the labels there are, got %q", result.ForLLM)
+	}
+
+	clock = start.Add(10 * time.Minute)
+
+	jobs := map[string]*cron.CronJob{}
+	for _, job := range cs.ListJobs(true) {
+		if job.Payload.Kind == mailRoutesJobKind {
+			jobs[job.Payload.Channel+":"+job.Payload.To] = &job
+		}
+	}
+	if len(jobs) != 2 || jobs["telegram:1"] == nil || jobs["whatsapp:2"] == nil {
+		t.Fatalf("Expected a check for each chat with rules, got %v", jobs)
+	}
+	report, err := tool.ExecuteJob(context.Background(), jobs["telegram:1"])
+	if err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if !strings.HasPrefix(report, "📧 Finance: Bank: Statement ready") || strings.Contains(report, "Old statement") {
+		t.Errorf("Expected only the new Finance email on Telegram, got %q", report)
+	}
+	if report, _ := tool.ExecuteJob(context.Background(), jobs["whatsapp:2"]); report != "" {
+		t.Errorf("Expected nothing sent at once on WhatsApp, got %q", report)
+	}
+	if held := digest.Flush("whatsapp:2"); !strings.Contains(held, "Mail (1)") || !strings.Contains(held, "Updates: GitHub: New release") {
+		t.Errorf("Expected the Updates email in the digest, got %q", held)
+	}
+
+	clock = start.Add(8 * 24 * time.Hour)
+	report, _ = tool.ExecuteJob(context.Background(), jobs["whatsapp:2"])
+	if !strings.HasPrefix(report, "📬 Weekly mail Digest: 1 update") || !strings.Contains(report, "Newsletters (1)\n• Weekly: Issue 12") {
+		t.Errorf("Expected the weekly summary without the muted email, got %q", report)
+	}
+
+	list := tool.Execute(WithChat(context.Background(), "telegram", "1"), map[string]interface{}{"action": "list"})
+	if !strings.Contains(list.ForLLM, "- Updates goes into the notification digest (to whatsapp:2)\n- Finance is sent at once") {
+		t.Errorf("Expected the rules of both accounts listed, got %q", list.ForLLM)
+	}
+}
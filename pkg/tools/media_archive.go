@@ -0,0 +1,326 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mediaindex"
+)
+
+// MediaArchiveRule sends the media received in some chats to Google
+// Photos or Drive. Album, Folder and Name may use the placeholders
+// {date} (2026-05-02), {time} (153005), {year}, {month}, {day}, {channel},
+// {chat}, {sender} and {n}, the position of the file in its message.
+type MediaArchiveRule struct {
+	// Channel limits the rule to one channel, e.g. "telegram"; empty
+	// matches every channel
+	Channel string
+	// Chats limits the rule to these chat IDs; empty matches every chat
+	Chats []string
+	// Destination is "photos" or "drive"
+	Destination string
+	// Album is the Google Photos album to add to; empty leaves the
+	// media in the library only
+	Album string
+	// Folder is a "/"-separated folder path under My Drive
+	Folder string
+	// Name is the file name, without extension
+	Name string
+}
+
+// defaultArchiveName names archived files when a rule does not.
+const defaultArchiveName = "{date}_{time}_{channel}_{n}"
+
+// archiveUploads bounds concurrent archive uploads, so a burst of photos
+// in a group chat does not saturate a slow uplink.
+const archiveUploads = 2
+
+// MediaArchiver archives the photos, videos and files people send in the
+// chats its rules name, so picoclaw can keep a family or team chat's
+// media in Google Photos or Drive without being asked each time. Uploads
+// happen in the background; failures are logged, not sent to the chat.
+type MediaArchiver struct {
+	now   func() time.Time
+	slots chan struct{}
+
+	mu      sync.Mutex
+	token   TokenFunc
+	rules   []MediaArchiveRule
+	albums  map[string]string
+	folders map[string]string
+}
+
+// NewMediaArchiver returns an archiver for rules. token authorizes the
+// uploads; nil turns archiving off.
+func NewMediaArchiver(token TokenFunc, rules []MediaArchiveRule) *MediaArchiver {
+	a := &MediaArchiver{now: time.Now, slots: make(chan struct{}, archiveUploads)}
+	a.SetConfig(token, rules)
+	return a
+}
+
+// SetConfig replaces the token and rules after a config reload.
+func (a *MediaArchiver) SetConfig(token TokenFunc, rules []MediaArchiveRule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = token
+	a.rules = rules
+	a.albums = map[string]string{}
+	a.folders = map[string]string{}
+}
+
+// Matches returns the rules that apply to a chat.
+func (a *MediaArchiver) Matches(channel, chatID string) []MediaArchiveRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == nil {
+		return nil
+	}
+	var matched []MediaArchiveRule
+	for _, r := range a.rules {
+		if r.Channel != "" && !strings.EqualFold(r.Channel, channel) {
+			continue
+		}
+		if len(r.Chats) > 0 && !containsString(r.Chats, chatID) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive uploads the files of one received message wherever the rules
+// for its chat say, and returns how many uploads succeeded.
+func (a *MediaArchiver) Archive(ctx context.Context, channel, chatID, senderID string, media []string) int {
+	rules := a.Matches(channel, chatID)
+	if len(rules) == 0 || len(media) == 0 {
+		return 0
+	}
+	a.mu.Lock()
+	token := a.token
+	a.mu.Unlock()
+
+	received := a.now()
+	archived := 0
+	for _, rule := range rules {
+		for i, file := range media {
+			if rule.Destination == "photos" && mediaindex.MimeType(file) == "" {
+				// Photos only takes pictures and videos; documents are left alone
+				continue
+			}
+			fields := archiveFields(received, channel, chatID, senderID, i+1)
+			select {
+			case a.slots <- struct{}{}:
+			case <-ctx.Done():
+				return archived
+			}
+			err := a.upload(ctx, token, rule, file, fields)
+			<-a.slots
+			if err != nil {
+				logger.WarnCF("tools", "Media archive upload failed", map[string]interface{}{
+					"channel":     channel,
+					"chat_id":     chatID,
+					"destination": rule.Destination,
+					"file":        filepath.Base(file),
+					"error":       err.Error(),
+				})
+				continue
+			}
+			archived++
+		}
+	}
+	return archived
+}
+
+func (a *MediaArchiver) upload(ctx context.Context, token TokenFunc, rule MediaArchiveRule, file string, fields map[string]string) error {
+	ext := strings.ToLower(filepath.Ext(file))
+	pattern := rule.Name
+	if pattern == "" {
+		pattern = defaultArchiveName
+	}
+	name := sanitizeArchiveName(expandArchiveName(pattern, fields)) + ext
+	mime := mediaindex.MimeType(file)
+
+	switch rule.Destination {
+	case "photos":
+		photos := NewGooglePhotosClient(token)
+		albumID := ""
+		if rule.Album != "" {
+			id, err := a.album(ctx, photos, expandArchiveName(rule.Album, fields))
+			if err != nil {
+				return err
+			}
+			albumID = id
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = photos.Upload(ctx, name, mime, f, albumID)
+		return err
+	case "drive":
+		drive := NewGoogleDriveClient(token)
+		folderID, err := a.folder(ctx, drive, expandArchiveName(rule.Folder, fields))
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = drive.Upload(ctx, folderID, name, mime, data)
+		return err
+	default:
+		return fmt.Errorf("unknown destination %q", rule.Destination)
+	}
+}
+
+// album finds or creates the album titled title, remembering its ID.
+func (a *MediaArchiver) album(ctx context.Context, photos *GooglePhotosClient, title string) (string, error) {
+	a.mu.Lock()
+	id, ok := a.albums[title]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	id, err := findOrCreateAlbum(ctx, photos, title)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	a.albums[title] = id
+	a.mu.Unlock()
+	return id, nil
+}
+
+// folder finds or creates a folder path under My Drive, remembering its
+// ID.
+func (a *MediaArchiver) folder(ctx context.Context, drive *GoogleDriveClient, folderPath string) (string, error) {
+	folderPath = strings.Trim(path.Clean("/"+folderPath), "/")
+	if folderPath == "" {
+		return "", nil
+	}
+	a.mu.Lock()
+	id, ok := a.folders[folderPath]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	parent, err := ensureDriveFolderPath(ctx, drive, folderPath)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	a.folders[folderPath] = parent
+	a.mu.Unlock()
+	return parent, nil
+}
+
+// findOrCreateAlbum returns the ID of the album titled title (any case),
+// creating it when there is none.
+func findOrCreateAlbum(ctx context.Context, photos *GooglePhotosClient, title string) (string, error) {
+	albums, err := photos.ListAlbums(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, al := range albums {
+		if strings.EqualFold(al.Title, title) {
+			return al.ID, nil
+		}
+	}
+	created, err := photos.CreateAlbum(ctx, title)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// ensureDriveFolderPath finds or creates each folder of a "/"-separated
+// path under My Drive and returns the ID of the last one, or "" for My
+// Drive itself.
+func ensureDriveFolderPath(ctx context.Context, drive *GoogleDriveClient, folderPath string) (string, error) {
+	folderPath = strings.Trim(path.Clean("/"+folderPath), "/")
+	if folderPath == "" {
+		return "", nil
+	}
+	parent := ""
+	for _, part := range strings.Split(folderPath, "/") {
+		f, err := drive.EnsureFolder(ctx, parent, part)
+		if err != nil {
+			return "", err
+		}
+		parent = f.ID
+	}
+	return parent, nil
+}
+
+func archiveFields(received time.Time, channel, chatID, senderID string, n int) map[string]string {
+	return map[string]string{
+		"date":    received.Format("2006-01-02"),
+		"time":    received.Format("150405"),
+		"year":    received.Format("2006"),
+		"month":   received.Format("01"),
+		"day":     received.Format("02"),
+		"channel": channel,
+		"chat":    chatID,
+		"sender":  senderID,
+		"n":       fmt.Sprint(n),
+	}
+}
+
+// expandArchiveName fills in the {placeholders} of pattern; unknown ones
+// are kept as written.
+func expandArchiveName(pattern string, fields map[string]string) string {
+	var sb strings.Builder
+	for {
+		open := strings.Index(pattern, "{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(pattern[open:], "}")
+		if end < 0 {
+			break
+		}
+		key := pattern[open+1 : open+end]
+		sb.WriteString(pattern[:open])
+		if v, ok := fields[key]; ok {
+			sb.WriteString(v)
+		} else {
+			sb.WriteString(pattern[open : open+end+1])
+		}
+		pattern = pattern[open+end+1:]
+	}
+	sb.WriteString(pattern)
+	return sb.String()
+}
+
+// sanitizeArchiveName keeps a file name free of path separators and the
+// characters Drive clients on other systems reject.
+func sanitizeArchiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if strings.TrimSpace(name) == "" {
+		return "media"
+	}
+	return name
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestMediaArchiver_PhotosAndDrive verifies media from matching chats goes to the album and the dated Drive folder with date-based names, and other chats are left alone
+func TestMediaArchiver_PhotosAndDrive(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "abc123-IMG_0001.JPG")
+	doc := filepath.Join(dir, "def456-menu.pdf")
+	os.WriteFile(photo, []byte("jpeg"), 0644)
+	os.WriteFile(doc, []byte("pdf"), 0644)
+
+	a := NewMediaArchiver(testkit.Token, []MediaArchiveRule{
+		{Channel: "telegram", Chats: []string{"-100"}, Destination: "photos", Album: "Family chat"},
+		{Channel: "telegram", Chats: []string{"-100"}, Destination: "drive", Folder: "Chats/{year}/{month}", Name: "{date}_{sender}_{n}"},
+	})
+	a.now = func() time.Time { return time.Date(2026, 5, 2, 15, 30, 5, 0, time.Local) }
+	ctx := context.Background()
+
+	if n := a.Archive(ctx, "telegram", "-200", "ana", []string{photo}); n != 0 {
+		t.Fatalf("archived %d files from a chat no rule names", n)
+	}
+	// The document is not media, so only Drive takes it
+	if n := a.Archive(ctx, "telegram", "-100", "ana", []string{photo, doc}); n != 3 {
+		t.Fatalf("archived %d uploads, want 3", n)
+	}
+
+	media := g.Media()
+	if len(media) != 1 || media[0].Filename != "2026-05-02_153005_telegram_1.jpg" {
+		t.Fatalf("unexpected Photos library: %+v", media)
+	}
+	albums := g.Albums()
+	if len(albums) != 1 || albums[0].Title != "Family chat" || len(albums[0].Items) != 1 {
+		t.Errorf("unexpected albums: %+v", albums)
+	}
+
+	folders := map[string]string{}
+	var names []string
+	for _, f := range g.Files() {
+		if f.MimeType == "application/vnd.google-apps.folder" {
+			folders[f.ID] = f.Name
+			continue
+		}
+		names = append(names, folders[f.Parent]+"/"+f.Name)
+	}
+	if len(folders) != 3 || len(names) != 2 || names[0] != "05/2026-05-02_ana_1.jpg" || names[1] != "05/2026-05-02_ana_2.pdf" {
+		t.Errorf("unexpected Drive files %v in folders %v", names, folders)
+	}
+
+	// A second message reuses the album and folders
+	a.Archive(ctx, "telegram", "-100", "ana", []string{photo})
+	if len(g.Albums()) != 1 {
+		t.Errorf("album created twice: %+v", g.Albums())
+	}
+
+	a.SetConfig(nil, nil)
+	if n := a.Archive(ctx, "telegram", "-100", "ana", []string{photo}); n != 0 {
+		t.Errorf("archived %d files with archiving off", n)
+	}
+}
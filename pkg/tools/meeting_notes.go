@@ -0,0 +1,704 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const (
+	meetingNotesJobKind = "meeting_notes"
+	// meetingLookback bounds how far back a check looks for ended
+	// meetings, so a device that was off does not prompt for old ones
+	meetingLookback = 3 * time.Hour
+	// meetingNotesRetention is how long meetings that got no notes are
+	// remembered
+	meetingNotesRetention = 30 * 24 * time.Hour
+)
+
+// voiceTranscription unwraps the text channels put in place of a voice
+// note.
+var voiceTranscription = regexp.MustCompile(`(?s)^\s*\[voice transcription:\s*(.*?)\]\s*$`)
+
+// ChatRecorder adds a message the assistant sent on its own to a chat's
+// history, so the model knows what the user is answering.
+type ChatRecorder interface {
+	Remember(channel, chatID, content string)
+}
+
+// MeetingNotesOptions configures the workflow.
+type MeetingNotesOptions struct {
+	CalendarID string
+	// Docs keeps a Google Doc copy of each note, in FolderID ("" for My
+	// Drive)
+	Docs     bool
+	FolderID string
+	// Every is how often schedules check for meetings that ended
+	Every time.Duration
+}
+
+// meetingNote is a meeting the user was asked about or took notes for.
+// Path is relative to the notes directory and empty until notes come in.
+type meetingNote struct {
+	EventID   string    `json:"event_id"`
+	Title     string    `json:"title"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Link      string    `json:"link,omitempty"`
+	Attendees []string  `json:"attendees,omitempty"`
+	Chat      string    `json:"chat,omitempty"`
+	Prompted  time.Time `json:"prompted,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	DocID     string    `json:"doc_id,omitempty"`
+	DocLink   string    `json:"doc_link,omitempty"`
+	// DocVersion is the Doc's version when it last matched the file
+	DocVersion string    `json:"doc_version,omitempty"`
+	Emailed    time.Time `json:"emailed,omitempty"`
+}
+
+type meetingNotesState struct {
+	Notes map[string]*meetingNote `json:"notes"`
+	// Last is the meeting each chat was last asked about, which notes
+	// without a meeting named go to
+	Last map[string]string `json:"last"`
+	// Checked is when each chat's schedule last looked for meetings
+	Checked map[string]time.Time `json:"checked"`
+}
+
+// MeetingNotesTool asks for notes after meetings end and keeps them as
+// Markdown files in the workspace, one per meeting, headed with the event
+// and its attendees. The user can answer with text or a voice note, add
+// more later, and have the notes emailed to the attendees.
+type MeetingNotesTool struct {
+	calendar  *GoogleCalendarClient
+	gmail     *GmailClient
+	drive     *GoogleDriveClient
+	recorder  ChatRecorder
+	profiles  *profile.Store
+	opts      MeetingNotesOptions
+	dir       string
+	statePath string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// NewMeetingNotesTool creates the tool. Notes go to workspace/meetings.
+func NewMeetingNotesTool(token TokenFunc, workspace string, opts MeetingNotesOptions, profiles *profile.Store) *MeetingNotesTool {
+	if opts.CalendarID == "" {
+		opts.CalendarID = "primary"
+	}
+	if opts.Every <= 0 {
+		opts.Every = 15 * time.Minute
+	}
+	t := &MeetingNotesTool{
+		calendar:  NewGoogleCalendarClient(token),
+		profiles:  profiles,
+		opts:      opts,
+		dir:       filepath.Join(workspace, "meetings"),
+		statePath: filepath.Join(workspace, "state", "meeting_notes.json"),
+		now:       time.Now,
+	}
+	if opts.Docs {
+		t.drive = NewGoogleDriveClient(token)
+	}
+	return t
+}
+
+// SetGmail enables emailing notes to the attendees.
+func (t *MeetingNotesTool) SetGmail(gmail *GmailClient) { t.gmail = gmail }
+
+// SetRecorder makes the prompts part of the chat's history.
+func (t *MeetingNotesTool) SetRecorder(recorder ChatRecorder) { t.recorder = recorder }
+
+func (t *MeetingNotesTool) Name() string {
+	return "meeting_notes"
+}
+
+func (t *MeetingNotesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "email", "schedule", "unschedule")
+}
+
+// Untrusted reports that notes and meetings shown carry event titles,
+// attendees and the notes' text.
+func (t *MeetingNotesTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "show", "list")
+}
+
+func (t *MeetingNotesTool) Description() string {
+	desc := "Meeting notes: when scheduled in a chat, asks for notes after each calendar meeting with other people ends. " +
+		"Use add with the user's notes (typed or a voice transcription) when they answer or want to note something about a meeting; notes are appended to a Markdown note per meeting"
+	if t.drive != nil {
+		desc += " and a Google Doc"
+	}
+	desc += ". Show or list notes"
+	if t.gmail != nil {
+		desc += ", or email them to the meeting's attendees when the user asks"
+	}
+	return desc + "."
+}
+
+func (t *MeetingNotesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"add", "show", "list", "email", "schedule", "unschedule"},
+				"description": "Action to perform",
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "add: the notes, as the user gave them",
+			},
+			"event": map[string]interface{}{
+				"type":        "string",
+				"description": "Event ID or words from the meeting's title (default: the meeting last asked about in this chat)",
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "email: a line to put above the notes",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *MeetingNotesTool) JobKinds() []string {
+	return []string{meetingNotesJobKind}
+}
+
+func (t *MeetingNotesTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *MeetingNotesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chat := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	ref, _ := args["event"].(string)
+
+	switch action {
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("meeting notes scheduling is not available (scheduler not running)")
+		}
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		t.unschedule(chat)
+		everyMS := t.opts.Every.Milliseconds()
+		job, err := t.scheduler.AddJobWithPayload("Meeting notes", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    meetingNotesJobKind,
+			Message: "Meeting notes",
+			Channel: channel,
+			To:      chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Meeting notes scheduled (id: %s); after each meeting with other people ends, the user will be asked for notes here.", job.ID))
+
+	case "unschedule":
+		if t.scheduler == nil {
+			return ErrorResult("meeting notes scheduling is not available (scheduler not running)")
+		}
+		if t.unschedule(chat) == 0 {
+			return SilentResult("Meeting notes were not scheduled in this chat")
+		}
+		return SilentResult("Meeting notes schedule removed; no more prompts after meetings")
+
+	case "add":
+		notes, _ := args["notes"].(string)
+		if m := voiceTranscription.FindStringSubmatch(notes); m != nil {
+			notes = m[1]
+		}
+		notes = strings.TrimSpace(notes)
+		if notes == "" {
+			return ErrorResult("notes is required for add")
+		}
+		note, err := t.find(ctx, chat, ref)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		msg, err := t.add(ctx, chat, note, notes)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to save the notes: %v", err)).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "show":
+		note, err := t.find(ctx, chat, ref)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if note.Path == "" {
+			return SilentResult(fmt.Sprintf("There are no notes for %q yet.", note.Title))
+		}
+		data, err := os.ReadFile(filepath.Join(t.dir, note.Path))
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the notes: %v", err)).WithError(err)
+		}
+		return SilentResult(string(data))
+
+	case "list":
+		return SilentResult(t.list())
+
+	case "email":
+		if t.gmail == nil {
+			return ErrorResult("emailing notes needs the Gmail tools enabled")
+		}
+		note, err := t.find(ctx, chat, ref)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		message, _ := args["message"].(string)
+		msg, err := t.email(ctx, note, message)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// unschedule removes the chat's meeting notes job.
+func (t *MeetingNotesTool) unschedule(chat string) int {
+	removed := 0
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == meetingNotesJobKind && job.Payload.Channel+":"+job.Payload.To == chat && t.scheduler.RemoveJob(job.ID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ExecuteJob implements ScheduledTool. It asks for notes on the meetings
+// that ended since the last check, and says nothing when none did.
+func (t *MeetingNotesTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	channel, chatID := job.Payload.Channel, job.Payload.To
+	chat := channel + ":" + chatID
+	now := t.now()
+
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	since := state.Checked[chat]
+	if since.IsZero() {
+		since = now.Add(-t.opts.Every)
+	}
+	if since.Before(now.Add(-meetingLookback)) {
+		since = now.Add(-meetingLookback)
+	}
+	// A meeting that ended after since started before now; look back far
+	// enough to catch long ones
+	events, err := t.calendar.ListEvents(ctx, t.opts.CalendarID, since.Add(-12*time.Hour), now)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the calendar: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, err = t.loadState(); err != nil {
+		return "", err
+	}
+	var ended []*meetingNote
+	for _, ev := range events {
+		if !ev.End.After(since) || ev.End.After(now) || !wantsMeetingNotes(ev) {
+			continue
+		}
+		if prev, ok := state.Notes[ev.ID]; ok && (!prev.Prompted.IsZero() || prev.Path != "") {
+			continue
+		}
+		note := meetingFromEvent(ev)
+		note.Chat, note.Prompted = chat, now
+		state.Notes[ev.ID] = note
+		ended = append(ended, note)
+	}
+	state.Checked[chat] = now
+	if len(ended) > 0 {
+		sort.Slice(ended, func(i, j int) bool { return ended[i].End.Before(ended[j].End) })
+		state.Last[chat] = ended[len(ended)-1].EventID
+	}
+	if err := t.saveState(state); err != nil {
+		return "", err
+	}
+	if len(ended) == 0 {
+		return "", nil
+	}
+
+	loc := t.location(chat)
+	var sb strings.Builder
+	if len(ended) == 1 {
+		fmt.Fprintf(&sb, "%q (%s) just ended. Any notes? Reply with text or a voice note and I'll add them to the meeting's notes.", ended[0].Title, ended[0].Start.In(loc).Format("15:04"))
+	} else {
+		sb.WriteString("These meetings ended:")
+		for _, n := range ended {
+			fmt.Fprintf(&sb, "\n- %s (%s)", n.Title, n.Start.In(loc).Format("15:04"))
+		}
+		fmt.Fprintf(&sb, "\nAny notes? Replies go to %q unless you name another one.", ended[len(ended)-1].Title)
+	}
+	prompt := sb.String()
+	if t.recorder != nil {
+		t.recorder.Remember(channel, chatID, prompt)
+	}
+	return prompt, nil
+}
+
+// wantsMeetingNotes reports whether an event is a meeting worth asking
+// about: timed, ordinary, not declined, and with someone besides the user.
+func wantsMeetingNotes(ev CalendarEvent) bool {
+	if ev.AllDay || (ev.Type != "" && ev.Type != EventDefault) || ev.MyResponse() == "declined" {
+		return false
+	}
+	for _, a := range ev.Attendees {
+		if !a.Self && a.Response != "declined" {
+			return true
+		}
+	}
+	return false
+}
+
+func meetingFromEvent(ev CalendarEvent) *meetingNote {
+	note := &meetingNote{EventID: ev.ID, Title: ev.Summary, Start: ev.Start, End: ev.End, Link: ev.HTMLLink}
+	if note.Title == "" {
+		note.Title = "Meeting"
+	}
+	for _, a := range ev.Attendees {
+		if !a.Self && a.Email != "" {
+			note.Attendees = append(note.Attendees, a.Email)
+		}
+	}
+	return note
+}
+
+// find picks the meeting ref names: an event ID, words from a title of a
+// meeting already known, or else one searched for in the last two weeks
+// of the calendar. An empty ref is the meeting the chat was last asked
+// about.
+func (t *MeetingNotesTool) find(ctx context.Context, chat, ref string) (*meetingNote, error) {
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		if note, ok := state.Notes[state.Last[chat]]; ok {
+			return note, nil
+		}
+		return nil, fmt.Errorf("no meeting was asked about in this chat; name the meeting with event")
+	}
+	if note, ok := state.Notes[ref]; ok {
+		return note, nil
+	}
+	var best *meetingNote
+	for _, note := range state.Notes {
+		if strings.Contains(strings.ToLower(note.Title), strings.ToLower(ref)) && (best == nil || note.End.After(best.End)) {
+			best = note
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+
+	now := t.now()
+	events, err := t.calendar.SearchEvents(ctx, t.opts.CalendarID, ref, now.AddDate(0, 0, -14), now.Add(24*time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search the calendar: %w", err)
+	}
+	var match *CalendarEvent
+	for i, ev := range events {
+		if ev.AllDay || ev.Start.After(now) {
+			continue
+		}
+		if match == nil || ev.Start.After(match.Start) {
+			match = &events[i]
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no meeting matching %q in the last two weeks", ref)
+	}
+	return meetingFromEvent(*match), nil
+}
+
+// add appends notes to the meeting's Markdown file, creating it with a
+// header the first time, and mirrors the file to its Doc.
+func (t *MeetingNotesTool) add(ctx context.Context, chat string, note *meetingNote, notes string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	if saved, ok := state.Notes[note.EventID]; ok {
+		note = saved
+	}
+	loc := t.location(chat)
+	if note.Path == "" {
+		note.Path = freeFileName(t.dir, sanitizeArchiveName(fmt.Sprintf("%s %s", note.Start.In(loc).Format("2006-01-02"), note.Title))+".md")
+		note.Path = filepath.Base(note.Path)
+	}
+	path := filepath.Join(t.dir, note.Path)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	base := string(data)
+	if len(data) == 0 {
+		data = []byte(meetingHeader(note, loc))
+	}
+	data = append(data, fmt.Sprintf("\n## %s\n\n%s\n", t.now().In(loc).Format("2006-01-02 15:04"), notes)...)
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	msg := fmt.Sprintf("Added to the notes for %q (%s).", note.Title, filepath.Join("meetings", note.Path))
+	if t.drive != nil {
+		if note.DocID == "" {
+			doc, err := t.drive.UploadConverted(ctx, t.opts.FolderID, strings.TrimSuffix(note.Path, ".md"), "text/plain", googleDocType, data)
+			if err == nil {
+				note.DocID, note.DocLink, note.DocVersion = doc.ID, doc.WebViewLink, doc.Version
+			}
+			if err != nil {
+				msg += fmt.Sprintf(" The Google Doc could not be created: %v", err)
+			}
+		} else if written, version, err := t.drive.SafeUpdate(ctx, note.DocID, "text/plain", base, note.DocVersion, string(data)); err != nil {
+			msg += fmt.Sprintf(" The Google Doc could not be updated: %v", err)
+		} else {
+			note.DocVersion = version
+			if written != string(data) {
+				// Edits made in the Doc are kept, and the file gets them too
+				if err := os.WriteFile(path, []byte(written), 0644); err != nil {
+					return "", err
+				}
+				msg += " Edits made in the Google Doc were kept."
+			}
+		}
+		if note.DocLink != "" {
+			msg += " Doc: " + note.DocLink
+		}
+	}
+	if note.Chat == "" {
+		note.Chat = chat
+	}
+	state.Notes[note.EventID] = note
+	state.Last[chat] = note.EventID
+	if err := t.saveState(state); err != nil {
+		return "", err
+	}
+	return msg, nil
+}
+
+// meetingHeader starts a meeting's note with what the event says.
+func meetingHeader(note *meetingNote, loc *time.Location) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", note.Title)
+	fmt.Fprintf(&sb, "- When: %s – %s\n", note.Start.In(loc).Format("Mon 2 Jan 2006 15:04"), note.End.In(loc).Format("15:04 MST"))
+	if note.Link != "" {
+		fmt.Fprintf(&sb, "- Event: %s\n", note.Link)
+	}
+	if len(note.Attendees) > 0 {
+		fmt.Fprintf(&sb, "- Attendees: %s\n", strings.Join(note.Attendees, ", "))
+	}
+	return sb.String()
+}
+
+// email sends the meeting's notes to its attendees.
+func (t *MeetingNotesTool) email(ctx context.Context, note *meetingNote, message string) (string, error) {
+	if note.Path == "" {
+		return "", fmt.Errorf("there are no notes for %q yet", note.Title)
+	}
+	if len(note.Attendees) == 0 {
+		return "", fmt.Errorf("%q has no other attendees to email", note.Title)
+	}
+	data, err := os.ReadFile(filepath.Join(t.dir, note.Path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the notes: %w", err)
+	}
+	body := string(data)
+	if note.DocLink != "" {
+		body += "\nGoogle Doc: " + note.DocLink + "\n"
+	}
+	if message = strings.TrimSpace(message); message != "" {
+		body = message + "\n\n" + body
+	}
+	subject := fmt.Sprintf("Notes: %s (%s)", note.Title, note.Start.In(t.location(note.Chat)).Format("2 Jan 2006"))
+	if _, _, err := t.gmail.Send(ctx, OutgoingEmail{To: note.Attendees, Subject: subject, Body: body}); err != nil {
+		return "", fmt.Errorf("failed to email the notes: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, err := t.loadState(); err == nil {
+		if saved, ok := state.Notes[note.EventID]; ok {
+			saved.Emailed = t.now()
+			t.saveState(state)
+		}
+	}
+	return fmt.Sprintf("Emailed the notes for %q to %s.", note.Title, strings.Join(note.Attendees, ", ")), nil
+}
+
+// list describes the meetings with notes, newest first.
+func (t *MeetingNotesTool) list() string {
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return err.Error()
+	}
+	var notes []*meetingNote
+	for _, note := range state.Notes {
+		if note.Path != "" {
+			notes = append(notes, note)
+		}
+	}
+	if len(notes) == 0 {
+		return "No meeting notes yet."
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Start.After(notes[j].Start) })
+	if len(notes) > 20 {
+		notes = notes[:20]
+	}
+	var sb strings.Builder
+	sb.WriteString("Meeting notes:")
+	for _, note := range notes {
+		fmt.Fprintf(&sb, "\n- %s: meetings/%s", note.Title, note.Path)
+		if !note.Emailed.IsZero() {
+			sb.WriteString(" (emailed)")
+		}
+		fmt.Fprintf(&sb, " [event %s]", note.EventID)
+	}
+	return sb.String()
+}
+
+// location is the chat's time zone, or the device's.
+func (t *MeetingNotesTool) location(chat string) *time.Location {
+	if t.profiles == nil || chat == "" {
+		return time.Local
+	}
+	return t.profiles.Get(chat).Location()
+}
+
+// loadState reads the state; callers hold t.mu.
+func (t *MeetingNotesTool) loadState() (*meetingNotesState, error) {
+	state := &meetingNotesState{}
+	data, err := os.ReadFile(t.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read meeting notes state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse meeting notes state: %w", err)
+		}
+	}
+	if state.Notes == nil {
+		state.Notes = make(map[string]*meetingNote)
+	}
+	if state.Last == nil {
+		state.Last = make(map[string]string)
+	}
+	if state.Checked == nil {
+		state.Checked = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// saveState writes the state, forgetting old meetings that got no notes;
+// callers hold t.mu.
+func (t *MeetingNotesTool) saveState(state *meetingNotesState) error {
+	cutoff := t.now().Add(-meetingNotesRetention)
+	for id, note := range state.Notes {
+		if note.Path == "" && note.End.Before(cutoff) {
+			delete(state.Notes, id)
+		}
+	}
+	return saveJSONAtomic(t.statePath, state)
+}
+
+// chatNotes returns the meetings asked about in the chat.
+func (state *meetingNotesState) chatNotes(chatKey string) []*meetingNote {
+	var notes []*meetingNote
+	for _, note := range state.Notes {
+		if note.Chat == chatKey {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Start.Before(notes[j].Start) })
+	return notes
+}
+
+// ChatData implements ChatDataStore: the meetings asked about in the chat,
+// with their notes.
+func (t *MeetingNotesTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return nil, err
+	}
+	type exported struct {
+		*meetingNote
+		Notes string `json:"notes,omitempty"`
+	}
+	var out []exported
+	for _, note := range state.chatNotes(chatKey) {
+		e := exported{meetingNote: note}
+		if note.Path != "" {
+			if data, err := os.ReadFile(filepath.Join(t.dir, note.Path)); err == nil {
+				e.Notes = string(data)
+			}
+		}
+		out = append(out, e)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// PurgeChat implements ChatDataStore, deleting the notes files too. Docs
+// in Drive are the user's and stay.
+func (t *MeetingNotesTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return 0, err
+	}
+	notes := state.chatNotes(chatKey)
+	_, asked := state.Last[chatKey]
+	if len(notes) == 0 && !asked {
+		return 0, nil
+	}
+	for _, note := range notes {
+		if note.Path != "" {
+			if err := os.Remove(filepath.Join(t.dir, note.Path)); err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+		}
+		delete(state.Notes, note.EventID)
+	}
+	delete(state.Last, chatKey)
+	delete(state.Checked, chatKey)
+	return len(notes), t.saveState(state)
+}
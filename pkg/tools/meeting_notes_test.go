@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+type fakeRecorder struct {
+	remembered []string
+}
+
+func (r *fakeRecorder) Remember(channel, chatID, content string) {
+	r.remembered = append(r.remembered, channel+":"+chatID+" "+content)
+}
+
+// TestMeetingNotesTool_PromptsAndEmails verifies a meeting that ended is asked about once, the answer is saved to its note and Doc, and the note goes to the attendees
+func TestMeetingNotesTool_PromptsAndEmails(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Now()
+	id := g.AddEvent(testkit.Event{
+		Summary:   "Budget review",
+		Start:     now.Add(-40 * time.Minute),
+		End:       now.Add(-5 * time.Minute),
+		Attendees: []testkit.Attendee{{Email: "me@example.com", Response: "accepted", Self: true}, {Email: "ana@example.com", Response: "accepted"}},
+	})
+	g.AddEvent(testkit.Event{Summary: "Focus", Start: now.Add(-40 * time.Minute), End: now.Add(-5 * time.Minute)})
+
+	workspace := t.TempDir()
+	tool := NewMeetingNotesTool(testkit.Token, workspace, MeetingNotesOptions{Docs: true}, nil)
+	tool.SetGmail(NewGmailClient(testkit.Token))
+	recorder := &fakeRecorder{}
+	tool.SetRecorder(recorder)
+
+	job := &cron.CronJob{Payload: cron.CronPayload{Kind: meetingNotesJobKind, Channel: "telegram", To: "42"}}
+	prompt, err := tool.ExecuteJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if !strings.Contains(prompt, "Budget review") || strings.Contains(prompt, "Focus") {
+		t.Errorf("Expected a prompt for the meeting only, got %q", prompt)
+	}
+	if len(recorder.remembered) != 1 || !strings.HasPrefix(recorder.remembered[0], "telegram:42 ") {
+		t.Errorf("Expected the prompt in the chat's history, got %v", recorder.remembered)
+	}
+	if again, _ := tool.ExecuteJob(context.Background(), job); again != "" {
+		t.Errorf("Expected no second prompt, got %q", again)
+	}
+
+	ctx := WithChat(context.Background(), "telegram", "42")
+	for _, notes := range []string{"[voice transcription: Cut travel by ten percent]", "Ana sends the forecast"} {
+		result := tool.Execute(ctx, map[string]interface{}{"action": "add", "notes": notes})
+		if result.IsError {
+			t.Fatalf("add failed: %s", result.ForLLM)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(workspace, "meetings", "*Budget review.md"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one note file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	note := string(data)
+	if !strings.Contains(note, "ana@example.com") || !strings.Contains(note, "Cut travel by ten percent\n") || strings.Contains(note, "voice transcription") || !strings.Contains(note, "Ana sends the forecast") {
+		t.Errorf("Unexpected note:\n%s", note)
+	}
+	docs := g.Files()
+	if len(docs) != 1 || docs[0].MimeType != googleDocType || string(docs[0].Content) != note {
+		t.Errorf("Expected one Doc with the whole note, got %+v", docs)
+	}
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "email", "event": id})
+	if result.IsError {
+		t.Fatalf("email failed: %s", result.ForLLM)
+	}
+	sent := g.Sent()
+	if len(sent) != 1 || !strings.Contains(sent[0].To, "ana@example.com") || strings.Contains(sent[0].To, "me@example.com") || !strings.HasPrefix(sent[0].Subject, "Notes: Budget review") {
+		t.Errorf("Expected the notes emailed to the other attendee, got %+v", sent)
+	}
+}
+
+// TestMeetingNotesTool_FindsMeetingByTitle verifies notes can go to a meeting nobody was asked about
+func TestMeetingNotesTool_FindsMeetingByTitle(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	yesterday := time.Now().AddDate(0, 0, -1)
+	g.AddEvent(testkit.Event{Summary: "Design sync", Start: yesterday, End: yesterday.Add(time.Hour)})
+
+	tool := NewMeetingNotesTool(testkit.Token, t.TempDir(), MeetingNotesOptions{}, nil)
+	ctx := WithChat(context.Background(), "telegram", "42")
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "add", "notes": "Ship it"}); !result.IsError {
+		t.Errorf("Expected an error without a meeting, got: %s", result.ForLLM)
+	}
+	result := tool.Execute(ctx, map[string]interface{}{"action": "add", "notes": "Ship it", "event": "design"})
+	if result.IsError {
+		t.Fatalf("add failed: %s", result.ForLLM)
+	}
+	if result = tool.Execute(ctx, map[string]interface{}{"action": "show"}); !strings.Contains(result.ForLLM, "# Design sync") || !strings.Contains(result.ForLLM, "Ship it") {
+		t.Errorf("Expected the note of the meeting just used, got: %s", result.ForLLM)
+	}
+}
+
+// TestMeetingNotesTool_KeepsDocEdits verifies notes added after the Doc was edited in Drive go after those edits, which the note file gets too
+func TestMeetingNotesTool_KeepsDocEdits(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	yesterday := time.Now().AddDate(0, 0, -1)
+	g.AddEvent(testkit.Event{Summary: "Design sync", Start: yesterday, End: yesterday.Add(time.Hour)})
+
+	workspace := t.TempDir()
+	tool := NewMeetingNotesTool(testkit.Token, workspace, MeetingNotesOptions{Docs: true}, nil)
+	ctx := WithChat(context.Background(), "telegram", "42")
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "add", "notes": "Ship it on Fridya", "event": "design"}); result.IsError {
+		t.Fatalf("add failed: %s", result.ForLLM)
+	}
+	doc := g.Files()[0]
+	g.EditFile(doc.ID, []byte(strings.Replace(string(doc.Content), "Fridya", "Friday", 1)), "Ana")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "add", "notes": "Rui reviews first"})
+	if result.IsError || !strings.Contains(result.ForLLM, "were kept") {
+		t.Fatalf("Expected the Doc's edits kept, got: %s", result.ForLLM)
+	}
+	content := string(g.Files()[0].Content)
+	if !strings.Contains(content, "Ship it on Friday") || !strings.Contains(content, "Rui reviews first") {
+		t.Errorf("Expected the fix and the new notes in the Doc:\n%s", content)
+	}
+	files, _ := filepath.Glob(filepath.Join(workspace, "meetings", "*Design sync.md"))
+	if data, _ := os.ReadFile(files[0]); string(data) != content {
+		t.Errorf("Expected the note file to match the Doc, got:\n%s", data)
+	}
+}
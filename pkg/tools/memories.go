@@ -0,0 +1,463 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMemoryCategory is where memories go when no category is given.
+const defaultMemoryCategory = "general"
+
+// memoryCategories are the categories offered to the model; others are
+// accepted as given.
+var memoryCategories = []string{"general", "preferences", "personal", "health", "finance", "work", "contacts"}
+
+// Memory is something the agent remembers about the user of one chat.
+type Memory struct {
+	ID       string    `json:"id"`
+	Chat     string    `json:"chat"`
+	Category string    `json:"category"`
+	Text     string    `json:"text"`
+	Created  time.Time `json:"created"`
+}
+
+// MemoryBook keeps what the agent remembers about each chat's user, by
+// category, so users can see it, forget parts of it and decide how long
+// each category is kept. Memories past their category's retention are
+// dropped the next time the chat's memories are read.
+type MemoryBook struct {
+	path     string
+	now      func() time.Time
+	mu       sync.Mutex
+	defaults map[string]int // category -> days kept, from the config
+	data     struct {
+		Next     int                       `json:"next"`
+		Memories []Memory                  `json:"memories"`
+		Policies map[string]map[string]int `json:"retention,omitempty"` // chat -> category -> days
+	}
+}
+
+// NewMemoryBook loads the memories saved in the workspace.
+func NewMemoryBook(workspace string) *MemoryBook {
+	b := &MemoryBook{path: filepath.Join(workspace, "state", "memories.json"), now: time.Now}
+	if data, err := os.ReadFile(b.path); err == nil {
+		json.Unmarshal(data, &b.data)
+	}
+	if b.data.Policies == nil {
+		b.data.Policies = make(map[string]map[string]int)
+	}
+	return b
+}
+
+// SetRetentionDefaults sets how many days memories of each category are
+// kept in chats that did not choose; 0 or missing keeps them.
+func (b *MemoryBook) SetRetentionDefaults(days map[string]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.defaults = make(map[string]int, len(days))
+	for category, d := range days {
+		b.defaults[memoryCategory(category)] = d
+	}
+}
+
+func memoryCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return defaultMemoryCategory
+	}
+	return category
+}
+
+// retentionLocked returns the days memories of category are kept in chat,
+// 0 for always.
+func (b *MemoryBook) retentionLocked(chat, category string) int {
+	if days, ok := b.data.Policies[chat][category]; ok {
+		return days
+	}
+	return b.defaults[category]
+}
+
+// expireLocked drops the chat's memories past their retention and reports
+// whether any were.
+func (b *MemoryBook) expireLocked(chat string) bool {
+	now := b.now()
+	kept := b.data.Memories[:0]
+	for _, m := range b.data.Memories {
+		if days := b.retentionLocked(m.Chat, m.Category); m.Chat == chat && days > 0 && now.Sub(m.Created) > time.Duration(days)*24*time.Hour {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	expired := len(kept) < len(b.data.Memories)
+	b.data.Memories = kept
+	return expired
+}
+
+func (b *MemoryBook) saveLocked() error {
+	return saveJSONAtomic(b.path, &b.data)
+}
+
+// Remember stores text about the chat's user under category.
+func (b *MemoryBook) Remember(chat, category, text string) (Memory, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Memory{}, fmt.Errorf("nothing to remember")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireLocked(chat)
+	b.data.Next++
+	m := Memory{ID: "m" + strconv.Itoa(b.data.Next), Chat: chat, Category: memoryCategory(category), Text: text, Created: b.now()}
+	b.data.Memories = append(b.data.Memories, m)
+	return m, b.saveLocked()
+}
+
+// ForChat returns the chat's memories, oldest first, after dropping the
+// expired ones.
+func (b *MemoryBook) ForChat(chat string) []Memory {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.expireLocked(chat) {
+		b.saveLocked()
+	}
+	var list []Memory
+	for _, m := range b.data.Memories {
+		if m.Chat == chat {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// forget removes the chat's memories drop picks and returns them.
+func (b *MemoryBook) forget(chat string, drop func(Memory) bool) ([]Memory, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var removed []Memory
+	kept := b.data.Memories[:0]
+	for _, m := range b.data.Memories {
+		if m.Chat == chat && drop(m) {
+			removed = append(removed, m)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	b.data.Memories = kept
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, b.saveLocked()
+}
+
+// Forget deletes one of the chat's memories by ID.
+func (b *MemoryBook) Forget(chat, id string) ([]Memory, error) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	return b.forget(chat, func(m Memory) bool { return m.ID == id })
+}
+
+// ForgetTopic deletes the chat's memories in the category named topic or
+// mentioning it.
+func (b *MemoryBook) ForgetTopic(chat, topic string) ([]Memory, error) {
+	topic = strings.ToLower(strings.TrimSpace(topic))
+	if len([]rune(topic)) < 3 {
+		return nil, fmt.Errorf("a topic of at least 3 letters is required")
+	}
+	return b.forget(chat, func(m Memory) bool {
+		return m.Category == topic || strings.Contains(strings.ToLower(m.Text), topic)
+	})
+}
+
+// Purge deletes all of the chat's memories and retention choices.
+func (b *MemoryBook) Purge(chat string) ([]Memory, error) {
+	removed, err := b.forget(chat, func(Memory) bool { return true })
+	if err != nil {
+		return removed, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.data.Policies[chat]; ok {
+		delete(b.data.Policies, chat)
+		return removed, b.saveLocked()
+	}
+	return removed, nil
+}
+
+// SetRetention keeps the chat's memories of category for days, 0 for
+// always, and drops the ones already older.
+func (b *MemoryBook) SetRetention(chat, category string, days int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.data.Policies[chat] == nil {
+		b.data.Policies[chat] = make(map[string]int)
+	}
+	b.data.Policies[chat][memoryCategory(category)] = days
+	b.expireLocked(chat)
+	return b.saveLocked()
+}
+
+// Retention returns the days each category's memories are kept in chat,
+// for the categories with a limit.
+func (b *MemoryBook) Retention(chat string) map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := map[string]int{}
+	for category, days := range b.defaults {
+		if days > 0 {
+			out[category] = days
+		}
+	}
+	for category, days := range b.data.Policies[chat] {
+		if days > 0 {
+			out[category] = days
+		} else {
+			delete(out, category)
+		}
+	}
+	return out
+}
+
+// Context returns the chat's memories for the system prompt, empty when
+// there are none.
+func (b *MemoryBook) Context(chat string) string {
+	list := b.ForChat(chat)
+	if len(list) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, m := range list {
+		fmt.Fprintf(&sb, "\n- [%s, %s] %s", m.ID, m.Category, m.Text)
+	}
+	return sb.String()
+}
+
+// MemoryTool lets the agent remember facts about the user and the user
+// see and delete them: one memory, a topic, or everything kept for the
+// chat, including the conversation history.
+type MemoryTool struct {
+	book      *MemoryBook
+	workspace string
+	// clearHistory deletes the chat's conversation history and summary
+	clearHistory func(channel, chatID string) error
+}
+
+func NewMemoryTool(book *MemoryBook, workspace string, clearHistory func(channel, chatID string) error) *MemoryTool {
+	return &MemoryTool{book: book, workspace: workspace, clearHistory: clearHistory}
+}
+
+func (t *MemoryTool) Name() string {
+	return "memory"
+}
+
+func (t *MemoryTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *MemoryTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "remember", "forget", "forget_topic", "purge", "set_retention")
+}
+
+func (t *MemoryTool) Description() string {
+	return "What you remember about the user of this chat. remember stores a fact worth keeping (a preference, a birthday, a doctor's name) under a category; list shows what is kept and for how long. forget deletes one memory by ID; forget_topic deletes every memory about a topic, and lines mentioning it in the workspace notes; purge deletes everything kept for this chat, conversation history included (ask the user to confirm first, then call with confirm=true). set_retention keeps a category's memories only for some days. Use it for \"remember that...\", \"what do you know about me?\" and \"forget my address\"."
+}
+
+func (t *MemoryTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"remember", "list", "forget", "forget_topic", "purge", "set_retention"},
+				"description": "Action to perform",
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "For remember: the fact, written so it makes sense on its own",
+			},
+			"category": map[string]interface{}{
+				"type":        "string",
+				"description": "For remember and set_retention: " + strings.Join(memoryCategories, ", ") + " (default general)",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "For forget: the memory ID, e.g. \"m12\"",
+			},
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "For forget_topic: a category or a word the memories mention, e.g. \"address\"",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "For set_retention: days to keep the category's memories; 0 keeps them",
+			},
+			"confirm": map[string]interface{}{
+				"type":        "boolean",
+				"description": "For purge: true once the user has confirmed",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *MemoryTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chat := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	category, _ := args["category"].(string)
+
+	switch action {
+	case "remember":
+		text, _ := args["text"].(string)
+		m, err := t.book.Remember(chat, category, text)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		out := fmt.Sprintf("Remembered (%s, %s).", m.ID, m.Category)
+		if days := t.book.Retention(chat)[m.Category]; days > 0 {
+			out += fmt.Sprintf(" %s memories are kept for %d days.", m.Category, days)
+		}
+		return SilentResult(out)
+
+	case "list":
+		return SilentResult(t.list(chat))
+
+	case "forget":
+		id, _ := args["id"].(string)
+		removed, err := t.book.Forget(chat, id)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if len(removed) == 0 {
+			return ErrorResult(fmt.Sprintf("no memory %q in this chat; use action=list to see them", id))
+		}
+		return SilentResult(fmt.Sprintf("Forgot %s: %s", removed[0].ID, removed[0].Text))
+
+	case "forget_topic":
+		topic, _ := args["topic"].(string)
+		removed, err := t.book.ForgetTopic(chat, topic)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		lines, err := scrubWorkspaceNotes(t.workspace, topic)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("forgot %d memories, but the notes could not be cleaned: %v", len(removed), err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Forgot %d memories about %q and removed %d lines mentioning it from the workspace notes.", len(removed), topic, lines))
+
+	case "purge":
+		if confirm, _ := args["confirm"].(bool); !confirm {
+			return SilentResult(fmt.Sprintf("This deletes the %d memories kept for this chat and its conversation history. Ask the user to confirm, then call again with confirm=true.", len(t.book.ForChat(chat))))
+		}
+		removed, err := t.book.Purge(chat)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if t.clearHistory != nil {
+			if err := t.clearHistory(channel, chatID); err != nil {
+				return ErrorResult(fmt.Sprintf("deleted %d memories, but not the conversation history: %v", len(removed), err)).WithError(err)
+			}
+		}
+		return SilentResult(fmt.Sprintf("Deleted %d memories and the conversation history of this chat. Nothing said before now is remembered.", len(removed)))
+
+	case "set_retention":
+		days, ok := args["days"].(float64)
+		if !ok || days < 0 {
+			return ErrorResult("days is required: 0 or more")
+		}
+		if err := t.book.SetRetention(chat, category, int(days)); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if days == 0 {
+			return SilentResult(fmt.Sprintf("%s memories are kept until forgotten.", memoryCategory(category)))
+		}
+		return SilentResult(fmt.Sprintf("%s memories are kept for %d days; older ones were deleted.", memoryCategory(category), int(days)))
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *MemoryTool) list(chat string) string {
+	memories := t.book.ForChat(chat)
+	var sb strings.Builder
+	if len(memories) == 0 {
+		sb.WriteString("Nothing is remembered about this chat's user.")
+	} else {
+		sb.WriteString("Remembered:")
+		for _, m := range memories {
+			fmt.Fprintf(&sb, "\n- %s [%s, %s] %s", m.ID, m.Category, m.Created.Format("2006-01-02"), m.Text)
+		}
+	}
+	retention := t.book.Retention(chat)
+	if len(retention) > 0 {
+		categories := make([]string, 0, len(retention))
+		for category := range retention {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		sb.WriteString("\nRetention:")
+		for _, category := range categories {
+			fmt.Fprintf(&sb, " %s %d days;", category, retention[category])
+		}
+	}
+	return sb.String()
+}
+
+// scrubWorkspaceNotes removes the lines mentioning topic from MEMORY.md
+// and the daily notes, and the cached embeddings of their text, returning
+// how many lines went.
+func scrubWorkspaceNotes(workspace, topic string) (int, error) {
+	topic = strings.ToLower(strings.TrimSpace(topic))
+	memoryDir := filepath.Join(workspace, "memory")
+	files, err := filepath.Glob(filepath.Join(memoryDir, "[0-9][0-9][0-9][0-9][0-9][0-9]", "*.md"))
+	if err != nil {
+		return 0, err
+	}
+	files = append(files, filepath.Join(memoryDir, "MEMORY.md"))
+	removed := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		lines := strings.Split(string(data), "\n")
+		kept := lines[:0]
+		for _, line := range lines {
+			if strings.Contains(strings.ToLower(line), topic) {
+				removed++
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if len(kept) == len(lines) {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(kept, "\n")), 0644); err != nil {
+			return removed, err
+		}
+	}
+	if removed > 0 {
+		DropEmbeddingsCaches(workspace)
+	}
+	return removed, nil
+}
+
+// DropEmbeddingsCaches deletes the cached embeddings of the notes and
+// memory. Vectors of removed text are dropped when the notes are next
+// ranked; deleting the caches drops them now.
+func DropEmbeddingsCaches(workspace string) {
+	for _, name := range []string{"memory", "notes"} {
+		os.Remove(filepath.Join(workspace, "cache", "embeddings", name+".json"))
+	}
+}
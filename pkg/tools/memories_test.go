@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMemoryTool_ForgetsAndExpires verifies memories can be forgotten one by one, by topic (workspace notes included) or all at once for a chat, and expire per category
+func TestMemoryTool_ForgetsAndExpires(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "memory"), 0755)
+	os.WriteFile(filepath.Join(workspace, "memory", "MEMORY.md"), []byte("# Notes\n- Ana lives at Rua Augusta 12\n- Ana prefers mornings\n"), 0644)
+
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	book := NewMemoryBook(workspace)
+	book.now = func() time.Time { return now }
+	book.SetRetentionDefaults(map[string]int{"Health": 30})
+	cleared := ""
+	tool := NewMemoryTool(book, workspace, func(channel, chatID string) error {
+		cleared = channel + ":" + chatID
+		return nil
+	})
+	ctx := WithChat(context.Background(), "telegram", "42")
+	run := func(args map[string]interface{}) *ToolResult {
+		t.Helper()
+		r := tool.Execute(ctx, args)
+		if r.IsError {
+			t.Fatalf("%v: %s", args, r.ForLLM)
+		}
+		return r
+	}
+
+	run(map[string]interface{}{"action": "remember", "text": "Lives at Rua Augusta 12", "category": "personal"})
+	run(map[string]interface{}{"action": "remember", "text": "Allergic to penicillin", "category": "health"})
+	run(map[string]interface{}{"action": "remember", "text": "Likes green tea"})
+	tool.Execute(WithChat(context.Background(), "telegram", "7"), map[string]interface{}{"action": "remember", "text": "Other user"})
+	if got := book.Context("telegram:42"); !strings.Contains(got, "[m2, health] Allergic") || strings.Contains(got, "Other user") {
+		t.Fatalf("context = %q", got)
+	}
+
+	run(map[string]interface{}{"action": "forget", "id": "M3"})
+	r := run(map[string]interface{}{"action": "forget_topic", "topic": "augusta"})
+	if !strings.Contains(r.ForLLM, "Forgot 1 memories") || !strings.Contains(r.ForLLM, "removed 1 lines") {
+		t.Errorf("forget_topic: %s", r.ForLLM)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workspace, "memory", "MEMORY.md")); strings.Contains(string(data), "Augusta") || !strings.Contains(string(data), "mornings") {
+		t.Errorf("notes not scrubbed: %q", data)
+	}
+
+	// Health memories expire after the default 30 days
+	now = now.Add(31 * 24 * time.Hour)
+	if list := book.ForChat("telegram:42"); len(list) != 0 {
+		t.Errorf("expired memories kept: %+v", list)
+	}
+
+	run(map[string]interface{}{"action": "remember", "text": "Birthday March 3", "category": "personal"})
+	if r := run(map[string]interface{}{"action": "purge"}); !strings.Contains(r.ForLLM, "confirm") || len(book.ForChat("telegram:42")) != 1 {
+		t.Fatalf("purge without confirm: %s", r.ForLLM)
+	}
+	run(map[string]interface{}{"action": "purge", "confirm": true})
+	if len(book.ForChat("telegram:42")) != 0 || cleared != "telegram:42" || len(book.ForChat("telegram:7")) != 1 {
+		t.Errorf("purge left memories or history (cleared %q)", cleared)
+	}
+}
@@ -3,15 +3,71 @@ package tools
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/store"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
+// MediaCallback sends images with an optional caption.
+type MediaCallback func(channel, chatID, caption string, media []string) error
+
+// MessageTool sends messages to chats. The chat to send to by default is
+// the one the call is made for (see WithChat), so one instance serves
+// conversations processed in parallel.
 type MessageTool struct {
-	sendCallback   SendCallback
+	sendCallback  SendCallback
+	mediaCallback MediaCallback
+	capabilities  func(channel string) (bus.Capabilities, bool)
+	// documentDir is where documents may be sent from; "" allows images only
+	documentDir string
+	previewDir  string
+	templates   *TemplateStore
+	profiles    *profile.Store
+	groups      *store.ContactGroups
+
+	mu             sync.RWMutex
 	defaultChannel string
 	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+}
+
+// MessageRound tracks the chats the message tool sent to while one
+// incoming message was processed, so the final reply is not sent twice.
+type MessageRound struct {
+	mu   sync.Mutex
+	sent map[string]bool
+}
+
+type messageRoundKey struct{}
+
+// WithMessageRound starts tracking sends for the processing of one
+// message; calls made with the returned context are counted in the round.
+func WithMessageRound(ctx context.Context) (context.Context, *MessageRound) {
+	round := &MessageRound{sent: map[string]bool{}}
+	return context.WithValue(ctx, messageRoundKey{}, round), round
+}
+
+// SentTo reports whether a message was sent to the chat during the round.
+func (r *MessageRound) SentTo(channel, chatID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sent[channel+":"+chatID]
+}
+
+func (r *MessageRound) markSent(channel, chatID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent[channel+":"+chatID] = true
 }
 
 func NewMessageTool() *MessageTool {
@@ -22,8 +78,21 @@ func (t *MessageTool) Name() string {
 	return "message"
 }
 
+func (t *MessageTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
+// KeepsLocal reports whether the message goes to the chat it was asked
+// for in, so replies still work in local-only chats.
+func (t *MessageTool) KeepsLocal(args map[string]interface{}) bool {
+	group, _ := args["group"].(string)
+	channel, _ := args["channel"].(string)
+	chatID, _ := args["chat_id"].(string)
+	return strings.TrimSpace(group) == "" && channel == "" && chatID == ""
+}
+
 func (t *MessageTool) Description() string {
-	return "Send a message to user on a chat channel. Use this when you want to communicate something."
+	return "Send a message to user on a chat channel. Use this when you want to communicate something. media attaches image files, such as a rendered agenda, or PDF and Office documents from the workspace; an image the chat refuses for its type or size is sent as a smaller JPEG; each gets a caption line with its type, size and pages or dimensions, and documents a thumbnail of their first page. Pass source and link when the file came from a tool or web page. template sends a saved message template (see the templates tool), filled in from vars. group broadcasts to the chats of a contact group's members, such as \"family\"."
 }
 
 func (t *MessageTool) Parameters() map[string]interface{} {
@@ -32,7 +101,7 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"content": map[string]interface{}{
 				"type":        "string",
-				"description": "The message content to send",
+				"description": "The message content to send; with template, extra text added after it (may be empty)",
 			},
 			"channel": map[string]interface{}{
 				"type":        "string",
@@ -40,64 +109,382 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 			},
 			"chat_id": map[string]interface{}{
 				"type":        "string",
-				"description": "Optional: target chat/user ID",
+				"description": "Optional: target chat/user ID; a Telegram forum topic is <group ID>/<topic ID>",
+			},
+			"media": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Optional: paths of image or document files to send, with content as the caption",
+			},
+			"source": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: where the attachments came from, such as \"Google Drive\" or the tool that made them",
+			},
+			"link": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: the original link of the attachments, shown in the caption",
+			},
+			"preview": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: add the attachment details and document thumbnails (default true)",
+			},
+			"template": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: name of a saved message template to send, e.g. \"running late\"",
+			},
+			"group": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: name of a contact group (see the contact_groups tool) to send to each member's chat instead of one chat",
+			},
+			"vars": map[string]interface{}{
+				"type":        "object",
+				"description": "Optional: values for the template's placeholders, e.g. {\"name\": \"Ana Souza\", \"eta\": \"15 min\"}; eta may be minutes, a duration or a clock time",
 			},
 		},
 		"required": []string{"content"},
 	}
 }
 
+// SetContext sets the chat used when neither the arguments nor the call's
+// context name one, for callers that run the tool directly.
 func (t *MessageTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
-}
-
-// HasSentInRound returns true if the message tool sent a message during the current round.
-func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetMediaCallback enables the media argument.
+func (t *MessageTool) SetMediaCallback(callback MediaCallback) {
+	t.mediaCallback = callback
+}
+
+// SetCapabilities sets how to look up what a channel can deliver, so
+// images it would refuse or drop are reported instead of sent.
+func (t *MessageTool) SetCapabilities(lookup func(channel string) (bus.Capabilities, bool)) {
+	t.capabilities = lookup
+}
+
+// SetDocuments lets media include PDF and Office documents from inside
+// workspace, not only images, and writes their thumbnails, and the copies
+// of images resized for a channel, to previewDir.
+func (t *MessageTool) SetDocuments(workspace, previewDir string) {
+	t.documentDir = workspace
+	t.previewDir = previewDir
+}
+
+// SetGroups enables the group argument, which sends to the chats of a
+// contact group's members.
+func (t *MessageTool) SetGroups(groups *store.ContactGroups) {
+	t.groups = groups
+}
+
+// SetTemplates enables the template argument. profiles gives the sender's
+// timezone for {time} and {eta_time}; it may be nil.
+func (t *MessageTool) SetTemplates(store *TemplateStore, profiles *profile.Store) {
+	t.templates = store
+	t.profiles = profiles
+}
+
+// fromTemplate builds the message from the named template, with note
+// added after it. Placeholders left without a value are an error, so a
+// half-filled message is never sent.
+func (t *MessageTool) fromTemplate(ctx context.Context, name string, args map[string]interface{}, note string) (string, error) {
+	if t.templates == nil {
+		return "", fmt.Errorf("message templates are not enabled")
+	}
+	tpl, ok := t.templates.Get(name)
+	if !ok {
+		return "", fmt.Errorf("no template named %q", name)
+	}
+	vars := map[string]string{}
+	if given, ok := args["vars"].(map[string]interface{}); ok {
+		for k, v := range given {
+			switch v := v.(type) {
+			case string:
+				vars[k] = v
+			case float64:
+				vars[k] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	}
+	now := time.Now()
+	if t.profiles != nil {
+		if channel, chatID := ChatFromContext(ctx); channel != "" {
+			now = now.In(t.profiles.Get(channel + ":" + chatID).Location())
+		}
+	}
+	text, missing := expandTemplate(tpl.Text, vars, now)
+	if len(missing) > 0 {
+		return "", fmt.Errorf("the %q template needs a value for %s; pass them in vars", tpl.Name, strings.Join(missing, ", "))
+	}
+	if note = strings.TrimSpace(note); note != "" {
+		text += "\n" + note
+	}
+	return text, nil
+}
+
+// checkMedia makes sure each path is an image file, or a document in the
+// workspace when documents are enabled, so media cannot be used to send
+// arbitrary files out of the device, and that the channel takes its type
+// and size when caps are known. Images the channel refuses are replaced by
+// a JPEG copy it takes, where one can be made. It returns the files to
+// send and what the caption says about each, with document thumbnails
+// made when preview is set.
+func (t *MessageTool) checkMedia(ctx context.Context, paths []string, caps bus.Capabilities, known, preview bool) ([]string, []attachmentPreview, error) {
+	var send []string
+	var previews []attachmentPreview
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		head := make([]byte, 512)
+		n, _ := f.Read(head)
+		f.Close()
+		ct := http.DetectContentType(head[:n])
+		doc, isDoc := documentTypes[strings.ToLower(filepath.Ext(path))]
+		switch {
+		case strings.HasPrefix(ct, "image/"):
+		case isDoc && t.documentDir != "":
+			if _, err := validatePath(path, t.documentDir, true); err != nil {
+				return nil, nil, fmt.Errorf("%s: documents can only be sent from the workspace", filepath.Base(path))
+			}
+			ct = doc.mime
+		case isDoc:
+			return nil, nil, fmt.Errorf("%s is not an image, and sending documents is not enabled", path)
+		default:
+			return nil, nil, fmt.Errorf("%s is not an image or a PDF or Office document", path)
+		}
+		size := info.Size()
+		if known {
+			if err := caps.CanSend(ct, size); err != nil {
+				if !strings.HasPrefix(ct, "image/") {
+					return nil, nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+				}
+				fitted, err := imaging.Fit(path, caps, t.imageDir())
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+				}
+				path, ct = fitted, "image/jpeg"
+				if info, err := os.Stat(path); err == nil {
+					size = info.Size()
+				}
+			}
+		}
+		send = append(send, path)
+		if !preview {
+			continue
+		}
+		if strings.HasPrefix(ct, "image/") {
+			previews = append(previews, previewImage(path, ct, size))
+			continue
+		}
+		thumbDir := t.previewDir
+		if known && caps.CanSend("image/jpeg", 0) != nil {
+			thumbDir = ""
+		}
+		previews = append(previews, previewDocument(ctx, path, size, thumbDir))
+	}
+	return send, previews, nil
+}
+
+// imageDir is where images resized for a channel are written.
+func (t *MessageTool) imageDir() string {
+	if t.previewDir != "" {
+		return t.previewDir
+	}
+	return filepath.Join(os.TempDir(), "picoclaw_previews")
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	content, ok := args["content"].(string)
-	if !ok {
+	template, _ := args["template"].(string)
+	if !ok && template == "" {
 		return &ToolResult{ForLLM: "content is required", IsError: true}
 	}
+	if template != "" {
+		text, err := t.fromTemplate(ctx, template, args, content)
+		if err != nil {
+			return &ToolResult{ForLLM: err.Error(), IsError: true, Err: err}
+		}
+		content = text
+	}
+
+	var media []string
+	if list, ok := args["media"].([]interface{}); ok {
+		for _, item := range list {
+			if path, ok := item.(string); ok && path != "" {
+				media = append(media, path)
+			}
+		}
+	}
+	if len(media) > 0 && t.mediaCallback == nil {
+		return &ToolResult{ForLLM: "Sending media is not configured", IsError: true}
+	}
+
+	if group, _ := args["group"].(string); strings.TrimSpace(group) != "" {
+		return t.broadcast(ctx, group, content, media, args)
+	}
 
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
+	ctxChannel, ctxChatID := ChatFromContext(ctx)
+	if ctxChannel == "" {
+		t.mu.RLock()
+		ctxChannel, ctxChatID = t.defaultChannel, t.defaultChatID
+		t.mu.RUnlock()
+	}
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = ctxChannel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = ctxChatID
 	}
 
 	if channel == "" || chatID == "" {
 		return &ToolResult{ForLLM: "No target channel/chat specified", IsError: true}
 	}
 
+	text, files, err := t.prepare(ctx, channel, content, media, args)
+	if err != nil {
+		return &ToolResult{ForLLM: fmt.Sprintf("cannot send media: %v", err), IsError: true, Err: err}
+	}
 	if t.sendCallback == nil {
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
-
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	if err := t.send(ctx, channel, chatID, text, files); err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
 			Err:     err,
 		}
 	}
-
-	t.sentInRound = true
 	// Silent: user already received the message directly
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
 		Silent: true,
 	}
 }
+
+// broadcast sends the message to the chat of each member of the calling
+// chat's contact group. Members with no chat are left out and named in
+// the result, as are those the message could not reach.
+func (t *MessageTool) broadcast(ctx context.Context, name, content string, media []string, args map[string]interface{}) *ToolResult {
+	if t.groups == nil {
+		return &ToolResult{ForLLM: "contact groups are not enabled", IsError: true}
+	}
+	if t.sendCallback == nil {
+		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
+	}
+	group, err := findGroup(ctx, t.groups, name)
+	if err != nil {
+		return &ToolResult{ForLLM: err.Error(), IsError: true, Err: err}
+	}
+
+	// Attachments are checked once per channel the group's chats are on
+	type prepared struct {
+		text  string
+		files []string
+		err   error
+	}
+	byChannel := map[string]prepared{}
+	var sent, noChat, failed []string
+	for _, m := range group.Members {
+		channel, chatID, ok := strings.Cut(m.Chat, ":")
+		if !ok {
+			noChat = append(noChat, m.Name)
+			continue
+		}
+		p, ok := byChannel[channel]
+		if !ok {
+			p.text, p.files, p.err = t.prepare(ctx, channel, content, media, args)
+			byChannel[channel] = p
+		}
+		if p.err == nil {
+			p.err = t.send(ctx, channel, chatID, p.text, p.files)
+		}
+		if p.err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", m.Name, p.err))
+			continue
+		}
+		sent = append(sent, m.Name)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Message sent to %d of the %d members of %s", len(sent), len(group.Members), group.Name)
+	if len(sent) > 0 {
+		sb.WriteString(": " + strings.Join(sent, ", "))
+	}
+	if len(noChat) > 0 {
+		fmt.Fprintf(&sb, "\nNo chat saved for %s; add one with the contact_groups tool", strings.Join(noChat, ", "))
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&sb, "\nCould not send to %s", strings.Join(failed, ", "))
+	}
+	return &ToolResult{ForLLM: sb.String(), Silent: true, IsError: len(sent) == 0}
+}
+
+// prepare checks media for channel and, when previews are wanted, adds
+// their details to the caption and the document thumbnails to the files.
+func (t *MessageTool) prepare(ctx context.Context, channel, content string, media []string, args map[string]interface{}) (string, []string, error) {
+	if len(media) == 0 {
+		return content, nil, nil
+	}
+	var caps bus.Capabilities
+	known := false
+	if t.capabilities != nil {
+		caps, known = t.capabilities(channel)
+	}
+	preview := true
+	if p, ok := args["preview"].(bool); ok {
+		preview = p
+	}
+	media, previews, err := t.checkMedia(ctx, media, caps, known, preview)
+	if err != nil {
+		return "", nil, err
+	}
+	if preview {
+		source, _ := args["source"].(string)
+		link, _ := args["link"].(string)
+		content = attachmentCaption(content, previews, source, link)
+		// Thumbnails go first, so the preview shows above the document
+		var thumbs []string
+		for _, p := range previews {
+			if p.Thumbnail != "" {
+				thumbs = append(thumbs, p.Thumbnail)
+			}
+		}
+		media = append(thumbs, media...)
+	}
+	return content, media, nil
+}
+
+// send delivers a prepared message to one chat and notes it in the round
+// and the audit.
+func (t *MessageTool) send(ctx context.Context, channel, chatID, content string, media []string) error {
+	var err error
+	if len(media) > 0 {
+		err = t.mediaCallback(channel, chatID, content, media)
+	} else {
+		err = t.sendCallback(channel, chatID, content)
+	}
+	if err != nil {
+		return err
+	}
+	if round, ok := ctx.Value(messageRoundKey{}).(*MessageRound); ok {
+		round.markSent(channel, chatID)
+	}
+	noteAuditRef(ctx, channel+":"+chatID)
+	return nil
+}
@@ -1,9 +1,21 @@
 package tools
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -257,3 +269,214 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+// TestMessageTool_Execute_MediaImagesOnly verifies media goes through the media callback and only image files are accepted
+func TestMessageTool_Execute_MediaImagesOnly(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "1")
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+	var sent []string
+	tool.SetMediaCallback(func(channel, chatID, caption string, media []string) error {
+		sent = media
+		return nil
+	})
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "agenda.png")
+	os.WriteFile(image, []byte("\x89PNG\r\n\x1a\n0000"), 0644)
+	secret := filepath.Join(dir, "config.json")
+	os.WriteFile(secret, []byte(`{"token":"x"}`), 0644)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"content": "", "media": []interface{}{image}})
+	if result.IsError || len(sent) != 1 || sent[0] != image {
+		t.Fatalf("image not sent: %s %v", result.ForLLM, sent)
+	}
+	sent = nil
+	result = tool.Execute(context.Background(), map[string]interface{}{"content": "here", "media": []interface{}{secret}})
+	if !result.IsError || sent != nil {
+		t.Errorf("non-image accepted: %s", result.ForLLM)
+	}
+}
+
+// TestMessageTool_ConcurrentChatsKeepTheirOwnTarget verifies parallel calls for different chats send to and count against their own chat
+func TestMessageTool_ConcurrentChatsKeepTheirOwnTarget(t *testing.T) {
+	tool := NewMessageTool()
+	var mu sync.Mutex
+	sent := map[string][]string{}
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[channel+":"+chatID] = append(sent[channel+":"+chatID], content)
+		return nil
+	})
+	registry := NewToolRegistry()
+	registry.Register(tool)
+
+	rounds := make([]*MessageRound, 8)
+	var wg sync.WaitGroup
+	for i := range rounds {
+		ctx, round := WithMessageRound(context.Background())
+		rounds[i] = round
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chatID := strconv.Itoa(i)
+			for n := 0; n < 20; n++ {
+				if i%2 == 1 {
+					// Odd chats only message a third party
+					registry.ExecuteWithContext(ctx, "message", map[string]interface{}{"content": "for-" + chatID, "chat_id": "other"}, "telegram", chatID, nil)
+					continue
+				}
+				registry.ExecuteWithContext(ctx, "message", map[string]interface{}{"content": "for-" + chatID}, "telegram", chatID, nil)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, round := range rounds {
+		chatID := strconv.Itoa(i)
+		if i%2 == 1 {
+			if round.SentTo("telegram", chatID) || !round.SentTo("telegram", "other") {
+				t.Errorf("chat %s: round misreported a third-party send", chatID)
+			}
+			continue
+		}
+		if !round.SentTo("telegram", chatID) || round.SentTo("telegram", strconv.Itoa(i+2)) {
+			t.Errorf("chat %s: round does not match what it sent", chatID)
+		}
+		for _, content := range sent["telegram:"+chatID] {
+			if content != "for-"+chatID {
+				t.Fatalf("chat %s received %q", chatID, content)
+			}
+		}
+		if len(sent["telegram:"+chatID]) != 20 {
+			t.Errorf("chat %s got %d messages", chatID, len(sent["telegram:"+chatID]))
+		}
+	}
+}
+
+// TestMessageTool_Execute_MediaFollowsChannelCapabilities verifies images a channel would drop or refuse are reported instead of sent
+func TestMessageTool_Execute_MediaFollowsChannelCapabilities(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+	sent := 0
+	tool.SetMediaCallback(func(channel, chatID, caption string, media []string) error {
+		sent++
+		return nil
+	})
+	tool.SetCapabilities(func(channel string) (bus.Capabilities, bool) {
+		if channel == "telegram" {
+			return bus.Capabilities{MaxFileBytes: 64, MediaTypes: []string{"image/png"}}, true
+		}
+		return bus.Capabilities{}, channel == "slack"
+	})
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.png")
+	os.WriteFile(small, []byte("\x89PNG\r\n\x1a\n0000"), 0644)
+	large := filepath.Join(dir, "large.png")
+	os.WriteFile(large, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...), 0644)
+
+	send := func(channel, path string) *ToolResult {
+		return tool.Execute(context.Background(), map[string]interface{}{"content": "", "channel": channel, "chat_id": "1", "media": []interface{}{path}})
+	}
+	if r := send("telegram", small); r.IsError {
+		t.Fatalf("small image refused: %s", r.ForLLM)
+	}
+	if r := send("telegram", large); !r.IsError || !strings.Contains(r.ForLLM, "large.png") {
+		t.Errorf("oversized image accepted: %s", r.ForLLM)
+	}
+	if r := send("slack", small); !r.IsError || !strings.Contains(r.ForLLM, "only receive text") {
+		t.Errorf("text-only channel accepted an image: %s", r.ForLLM)
+	}
+	// Channels the lookup does not know keep the old behavior
+	if r := send("cli", small); r.IsError {
+		t.Errorf("unknown channel refused: %s", r.ForLLM)
+	}
+	if sent != 2 {
+		t.Errorf("sent %d times", sent)
+	}
+}
+
+// TestMessageTool_Execute_MediaResizedForChannel verifies an image a channel refuses for its type or size is sent as a JPEG copy it takes
+func TestMessageTool_Execute_MediaResizedForChannel(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+	var sent []string
+	var caption string
+	tool.SetMediaCallback(func(channel, chatID, c string, media []string) error {
+		sent, caption = media, c
+		return nil
+	})
+	tool.SetCapabilities(func(channel string) (bus.Capabilities, bool) {
+		return bus.Capabilities{MaxFileBytes: 2 << 10, MediaTypes: []string{"image/jpeg"}}, true
+	})
+	dir := t.TempDir()
+	tool.SetDocuments(dir, filepath.Join(dir, "previews"))
+	src := filepath.Join(dir, "chart.png")
+	f, _ := os.Create(src)
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 2000, 1000)))
+	f.Close()
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"content": "", "channel": "whatsapp", "chat_id": "1", "media": []interface{}{src}})
+	if r.IsError || len(sent) != 1 || sent[0] == src {
+		t.Fatalf("not resized: %s %v", r.ForLLM, sent)
+	}
+	if info, err := os.Stat(sent[0]); err != nil || info.Size() > 2<<10 || !strings.Contains(caption, "JPEG image") {
+		t.Errorf("sent %s (%v), caption %q", sent[0], err, caption)
+	}
+}
+
+// TestMessageTool_Execute_DocumentPreview verifies documents from the workspace are sent after a thumbnail with a caption describing them, and documents elsewhere are refused
+func TestMessageTool_Execute_DocumentPreview(t *testing.T) {
+	workspace := t.TempDir()
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "1")
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+	tool.SetDocuments(workspace, filepath.Join(workspace, "cache", "previews"))
+	var caption string
+	var sent []string
+	tool.SetMediaCallback(func(channel, chatID, c string, media []string) error {
+		caption, sent = c, media
+		return nil
+	})
+
+	var thumb bytes.Buffer
+	png.Encode(&thumb, image.NewRGBA(image.Rect(0, 0, 40, 60)))
+	var doc bytes.Buffer
+	zw := zip.NewWriter(&doc)
+	w, _ := zw.Create("docProps/app.xml")
+	io.WriteString(w, `<Properties><Pages>3</Pages></Properties>`)
+	w, _ = zw.Create("docProps/thumbnail.png")
+	w.Write(thumb.Bytes())
+	zw.Close()
+	path := filepath.Join(workspace, "downloads", "report.docx")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, doc.Bytes(), 0644)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"content": "Here is the report",
+		"media":   []interface{}{path},
+		"source":  "Google Drive",
+		"link":    "https://drive.google.com/file/d/abc",
+	})
+	if result.IsError {
+		t.Fatalf("document refused: %s", result.ForLLM)
+	}
+	if len(sent) != 2 || sent[1] != path || !strings.HasSuffix(sent[0], ".jpg") {
+		t.Fatalf("media = %v, want a thumbnail then the document", sent)
+	}
+	for _, want := range []string{"Here is the report\n\n", "report.docx: Word document, 3 pages, ", "From Google Drive: https://drive.google.com/file/d/abc"} {
+		if !strings.Contains(caption, want) {
+			t.Errorf("caption %q lacks %q", caption, want)
+		}
+	}
+
+	outside := filepath.Join(t.TempDir(), "secret.pdf")
+	os.WriteFile(outside, []byte("%PDF-1.4\n"), 0644)
+	sent = nil
+	result = tool.Execute(context.Background(), map[string]interface{}{"content": "", "media": []interface{}{outside}})
+	if !result.IsError || sent != nil {
+		t.Errorf("document outside the workspace accepted: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,10 @@
+package tools
+
+import "github.com/sipeed/picoclaw/pkg/metrics"
+
+var (
+	toolCalls = metrics.NewCounter("picoclaw_tool_calls_total",
+		"Tool executions by tool and result (ok, error, async).", "tool", "result")
+	toolDuration = metrics.NewHistogram("picoclaw_tool_duration_seconds",
+		"Tool execution time.", nil, "tool")
+)
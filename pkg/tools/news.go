@@ -0,0 +1,610 @@
+package tools
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/egress"
+)
+
+const newsDigestJobKind = "news_digest"
+
+// Headline is a single news item.
+type Headline struct {
+	Title     string
+	URL       string
+	Source    string
+	Published time.Time
+}
+
+// NewsProvider is implemented by news backends. topic and region are both
+// optional; region is an ISO 3166 country code.
+type NewsProvider interface {
+	Name() string
+	Headlines(ctx context.Context, topic, region string, limit int) ([]Headline, error)
+}
+
+// NewsAPIProvider reads headlines from newsapi.org.
+type NewsAPIProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewNewsAPIProvider(apiKey string) *NewsAPIProvider {
+	return &NewsAPIProvider{
+		apiKey:  apiKey,
+		baseURL: "https://newsapi.org/v2",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *NewsAPIProvider) Name() string {
+	return "newsapi"
+}
+
+func (p *NewsAPIProvider) Headlines(ctx context.Context, topic, region string, limit int) ([]Headline, error) {
+	params := url.Values{}
+	params.Set("apiKey", p.apiKey)
+	params.Set("pageSize", fmt.Sprintf("%d", limit))
+
+	// top-headlines requires a country, category or query; everything is
+	// used for topic-only searches since it covers far more sources.
+	endpoint := "/top-headlines"
+	switch {
+	case region != "":
+		params.Set("country", strings.ToLower(region))
+		if topic != "" {
+			params.Set("q", topic)
+		}
+	case topic != "":
+		endpoint = "/everything"
+		params.Set("q", topic)
+		params.Set("sortBy", "publishedAt")
+	default:
+		params.Set("language", "en")
+	}
+
+	var resp struct {
+		Status   string `json:"status"`
+		Message  string `json:"message"`
+		Articles []struct {
+			Title       string `json:"title"`
+			URL         string `json:"url"`
+			PublishedAt string `json:"publishedAt"`
+			Source      struct {
+				Name string `json:"name"`
+			} `json:"source"`
+		} `json:"articles"`
+	}
+	if err := getJSON(ctx, p.client, p.baseURL+endpoint+"?"+params.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status == "error" {
+		return nil, fmt.Errorf("newsapi: %s", resp.Message)
+	}
+
+	headlines := make([]Headline, 0, len(resp.Articles))
+	for _, a := range resp.Articles {
+		published, _ := time.Parse(time.RFC3339, a.PublishedAt)
+		headlines = append(headlines, Headline{
+			Title:     a.Title,
+			URL:       a.URL,
+			Source:    a.Source.Name,
+			Published: published,
+		})
+	}
+	return headlines, nil
+}
+
+// GDELTProvider reads articles from the free GDELT DOC 2.0 API.
+type GDELTProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewGDELTProvider() *GDELTProvider {
+	return &GDELTProvider{
+		baseURL: "https://api.gdeltproject.org/api/v2/doc/doc",
+		client:  &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (p *GDELTProvider) Name() string {
+	return "gdelt"
+}
+
+func (p *GDELTProvider) Headlines(ctx context.Context, topic, region string, limit int) ([]Headline, error) {
+	query := topic
+	if query == "" {
+		query = "news"
+	}
+	if region != "" {
+		query += " sourcecountry:" + strings.ToUpper(region)
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("mode", "artlist")
+	params.Set("format", "json")
+	params.Set("sort", "datedesc")
+	params.Set("maxrecords", fmt.Sprintf("%d", limit))
+
+	var resp struct {
+		Articles []struct {
+			URL      string `json:"url"`
+			Title    string `json:"title"`
+			SeenDate string `json:"seendate"`
+			Domain   string `json:"domain"`
+		} `json:"articles"`
+	}
+	if err := getJSON(ctx, p.client, p.baseURL+"?"+params.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	headlines := make([]Headline, 0, len(resp.Articles))
+	for _, a := range resp.Articles {
+		published, _ := time.Parse("20060102T150405Z", a.SeenDate)
+		headlines = append(headlines, Headline{
+			Title:     a.Title,
+			URL:       a.URL,
+			Source:    a.Domain,
+			Published: published,
+		})
+	}
+	return headlines, nil
+}
+
+// RSSProvider aggregates a fixed list of RSS 2.0 / Atom feeds. Topics are
+// matched against item titles and descriptions; region is ignored.
+type RSSProvider struct {
+	feeds  []string
+	client *http.Client
+}
+
+func NewRSSProvider(feeds []string) *RSSProvider {
+	return &RSSProvider{
+		feeds:  feeds,
+		client: egress.Client(15 * time.Second),
+	}
+}
+
+func (p *RSSProvider) Name() string {
+	return "rss"
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	// Atom
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title   string `xml:"title"`
+		Summary string `xml:"summary"`
+		Updated string `xml:"updated"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func parseFeedTime(s string) time.Time {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (p *RSSProvider) fetch(ctx context.Context, feedURL string) (*rssDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed %s returned %d", feedURL, resp.StatusCode)
+	}
+
+	var doc rssDocument
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 5<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed %s: %w", feedURL, err)
+	}
+	return &doc, nil
+}
+
+func (p *RSSProvider) Headlines(ctx context.Context, topic, region string, limit int) ([]Headline, error) {
+	topic = strings.ToLower(topic)
+	matches := func(texts ...string) bool {
+		if topic == "" {
+			return true
+		}
+		for _, s := range texts {
+			if strings.Contains(strings.ToLower(s), topic) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var headlines []Headline
+	var lastErr error
+	for _, feedURL := range p.feeds {
+		doc, err := p.fetch(ctx, feedURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, item := range doc.Channel.Items {
+			if matches(item.Title, item.Description) {
+				headlines = append(headlines, Headline{
+					Title:     strings.TrimSpace(item.Title),
+					URL:       strings.TrimSpace(item.Link),
+					Source:    doc.Channel.Title,
+					Published: parseFeedTime(item.PubDate),
+				})
+			}
+		}
+		for _, entry := range doc.Entries {
+			if !matches(entry.Title, entry.Summary) {
+				continue
+			}
+			link := ""
+			if len(entry.Links) > 0 {
+				link = entry.Links[0].Href
+			}
+			headlines = append(headlines, Headline{
+				Title:     strings.TrimSpace(entry.Title),
+				URL:       link,
+				Source:    doc.Title,
+				Published: parseFeedTime(entry.Updated),
+			})
+		}
+	}
+	if len(headlines) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return headlines, nil
+}
+
+// headlineKey normalizes a title so the same story syndicated by several
+// outlets (different punctuation, " - Source" suffixes) collapses to one key.
+func headlineKey(title string) string {
+	if i := strings.LastIndex(title, " - "); i > len(title)/2 {
+		title = title[:i]
+	}
+	var sb strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// dedupeHeadlines drops repeated stories by URL or normalized title and
+// returns the rest newest first.
+func dedupeHeadlines(items []Headline, limit int) []Headline {
+	seen := make(map[string]bool)
+	result := make([]Headline, 0, len(items))
+	for _, h := range items {
+		key := headlineKey(h.Title)
+		if h.Title == "" || seen[key] || (h.URL != "" && seen[h.URL]) {
+			continue
+		}
+		seen[key] = true
+		if h.URL != "" {
+			seen[h.URL] = true
+		}
+		result = append(result, h)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Published.After(result[j].Published)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// NewsTool returns deduplicated headlines from all configured providers and
+// schedules recurring topic digests.
+type NewsTool struct {
+	providers  []NewsProvider
+	maxResults int
+	scheduler  *cron.CronService
+	channel    string
+	chatID     string
+}
+
+func NewNewsTool(providers []NewsProvider, maxResults int) *NewsTool {
+	if maxResults <= 0 {
+		maxResults = 10
+	}
+	return &NewsTool{
+		providers:  providers,
+		maxResults: maxResults,
+	}
+}
+
+func (t *NewsTool) Name() string {
+	return "news"
+}
+
+func (t *NewsTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "headlines")
+}
+
+func (t *NewsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "digest_add", "digest_remove")
+}
+
+func (t *NewsTool) Description() string {
+	return "Get current news headlines by topic and/or region, and manage scheduled news digests (e.g. a daily morning briefing on chosen topics)."
+}
+
+func (t *NewsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"headlines", "digest_add", "digest_list", "digest_remove"},
+				"description": "Action to perform",
+			},
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "Topic or keywords, e.g. 'climate', 'AI regulation' (headlines)",
+			},
+			"topics": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Topics to cover in a scheduled digest (digest_add)",
+			},
+			"region": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional two-letter country code, e.g. us, br, gb",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of headlines per topic",
+			},
+			"cron_expr": map[string]interface{}{
+				"type":        "string",
+				"description": "Digest schedule as a cron expression, e.g. '0 8 * * *' for every day at 8am (digest_add)",
+			},
+			"digest_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Digest ID (digest_remove)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *NewsTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// JobKinds implements ScheduledTool.
+func (t *NewsTool) JobKinds() []string {
+	return []string{newsDigestJobKind}
+}
+
+// SetScheduler implements ScheduledTool.
+func (t *NewsTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+// Headlines queries every provider and merges the results. A provider error
+// only fails the call if no provider returned anything.
+func (t *NewsTool) Headlines(ctx context.Context, topic, region string, count int) ([]Headline, error) {
+	if len(t.providers) == 0 {
+		return nil, fmt.Errorf("no news providers configured")
+	}
+
+	var all []Headline
+	var errs []string
+	for _, p := range t.providers {
+		items, err := p.Headlines(ctx, topic, region, count)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+		all = append(all, items...)
+	}
+	if len(all) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all news providers failed: %s", strings.Join(errs, "; "))
+	}
+	return dedupeHeadlines(all, count), nil
+}
+
+func formatHeadlines(items []Headline) string {
+	var sb strings.Builder
+	for i, h := range items {
+		fmt.Fprintf(&sb, "%d. %s", i+1, h.Title)
+		if h.Source != "" {
+			fmt.Fprintf(&sb, " (%s)", h.Source)
+		}
+		if h.URL != "" {
+			fmt.Fprintf(&sb, "\n   %s", h.URL)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func (t *NewsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	count := t.maxResults
+	if c, ok := args["count"].(float64); ok && int(c) > 0 && int(c) <= 50 {
+		count = int(c)
+	}
+	region, _ := args["region"].(string)
+
+	switch action {
+	case "headlines":
+		topic, _ := args["topic"].(string)
+		items, err := t.Headlines(ctx, topic, region, count)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("news lookup failed: %v", err)).WithError(err)
+		}
+		if len(items) == 0 {
+			return SilentResult("No headlines found")
+		}
+		return SilentResult(formatHeadlines(items))
+	case "digest_add":
+		return t.addDigest(args, region, count)
+	case "digest_list":
+		return t.listDigests()
+	case "digest_remove":
+		return t.removeDigest(args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *NewsTool) addDigest(args map[string]interface{}, region string, count int) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("digests are not available (scheduler not running)")
+	}
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	expr, _ := args["cron_expr"].(string)
+	if expr == "" {
+		return ErrorResult("cron_expr is required for digest_add")
+	}
+
+	var topics []string
+	if raw, ok := args["topics"].([]interface{}); ok {
+		for _, v := range raw {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				topics = append(topics, strings.TrimSpace(s))
+			}
+		}
+	}
+	if topic, ok := args["topic"].(string); ok && topic != "" && len(topics) == 0 {
+		topics = []string{topic}
+	}
+
+	name := "News digest"
+	if len(topics) > 0 {
+		name += ": " + strings.Join(topics, ", ")
+	}
+	job, err := t.scheduler.AddJobWithPayload(name, cron.CronSchedule{Kind: "cron", Expr: expr}, cron.CronPayload{
+		Kind:    newsDigestJobKind,
+		Message: name,
+		Channel: t.channel,
+		To:      t.chatID,
+		Data: map[string]string{
+			"topics": strings.Join(topics, "|"),
+			"region": region,
+			"count":  fmt.Sprintf("%d", count),
+		},
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to add digest: %v", err))
+	}
+
+	return SilentResult(fmt.Sprintf("%s scheduled (id: %s, cron: %s)", name, job.ID, expr))
+}
+
+func (t *NewsTool) listDigests() *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("digests are not available (scheduler not running)")
+	}
+
+	var sb strings.Builder
+	for _, job := range t.scheduler.ListJobs(false) {
+		if job.Payload.Kind != newsDigestJobKind {
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s [%s] (id: %s)\n", job.Name, job.Schedule.Expr, job.ID)
+	}
+	if sb.Len() == 0 {
+		return SilentResult("No scheduled news digests")
+	}
+	return SilentResult("Scheduled news digests:\n" + sb.String())
+}
+
+func (t *NewsTool) removeDigest(args map[string]interface{}) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("digests are not available (scheduler not running)")
+	}
+	id, _ := args["digest_id"].(string)
+	if id == "" {
+		return ErrorResult("digest_id is required for digest_remove")
+	}
+	if !t.scheduler.RemoveJob(id) {
+		return ErrorResult(fmt.Sprintf("digest %s not found", id))
+	}
+	return SilentResult(fmt.Sprintf("News digest %s removed", id))
+}
+
+// ExecuteJob implements ScheduledTool and renders a digest with a section
+// per topic. Stories already listed under an earlier topic are skipped.
+func (t *NewsTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	data := job.Payload.Data
+	count := t.maxResults
+	fmt.Sscanf(data["count"], "%d", &count)
+
+	topics := []string{""}
+	if data["topics"] != "" {
+		topics = strings.Split(data["topics"], "|")
+	}
+
+	seen := make(map[string]bool)
+	var sb strings.Builder
+	sb.WriteString("📰 News digest\n")
+	for _, topic := range topics {
+		items, err := t.Headlines(ctx, topic, data["region"], count)
+		if err != nil {
+			return "", err
+		}
+		var fresh []Headline
+		for _, h := range items {
+			if key := headlineKey(h.Title); !seen[key] {
+				seen[key] = true
+				fresh = append(fresh, h)
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		title := "Top stories"
+		if topic != "" {
+			title = topic
+		}
+		fmt.Fprintf(&sb, "\n*%s*\n%s", title, formatHeadlines(fresh))
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+type stubNewsProvider struct {
+	name  string
+	items []Headline
+}
+
+func (p *stubNewsProvider) Name() string {
+	return p.name
+}
+
+func (p *stubNewsProvider) Headlines(ctx context.Context, topic, region string, limit int) ([]Headline, error) {
+	return p.items, nil
+}
+
+// TestNewsTool_DedupesAcrossProviders verifies syndicated stories collapse into one headline
+func TestNewsTool_DedupesAcrossProviders(t *testing.T) {
+	now := time.Now()
+	a := &stubNewsProvider{name: "a", items: []Headline{
+		{Title: "Rates held steady - Reuters", URL: "https://a/1", Published: now.Add(-time.Hour)},
+		{Title: "Launch delayed", URL: "https://a/2", Published: now},
+	}}
+	b := &stubNewsProvider{name: "b", items: []Headline{
+		{Title: "Rates held steady!", URL: "https://b/9", Published: now.Add(-2 * time.Hour)},
+	}}
+	tool := NewNewsTool([]NewsProvider{a, b}, 10)
+
+	items, err := tool.Headlines(context.Background(), "", "", 10)
+	if err != nil {
+		t.Fatalf("Headlines failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 unique headlines, got %+v", items)
+	}
+	if items[0].Title != "Launch delayed" {
+		t.Errorf("Expected newest first, got %q", items[0].Title)
+	}
+}
+
+// TestRSSProvider_FiltersByTopic verifies RSS items are matched against the topic
+func TestRSSProvider_FiltersByTopic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><rss><channel><title>Feed</title>
+			<item><title>Solar power record</title><link>https://x/1</link><pubDate>Mon, 02 Mar 2026 10:00:00 +0000</pubDate></item>
+			<item><title>Football results</title><link>https://x/2</link></item>
+			</channel></rss>`))
+	}))
+	defer server.Close()
+
+	items, err := NewRSSProvider([]string{server.URL}).Headlines(context.Background(), "solar", "", 10)
+	if err != nil {
+		t.Fatalf("Headlines failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Source != "Feed" || items[0].Published.IsZero() {
+		t.Errorf("Expected one parsed solar headline, got %+v", items)
+	}
+}
+
+// TestNewsTool_DigestJob verifies digests are scheduled and rendered per topic
+func TestNewsTool_DigestJob(t *testing.T) {
+	provider := &stubNewsProvider{name: "a", items: []Headline{{Title: "Big news", URL: "https://a/1"}}}
+	tool := NewNewsTool([]NewsProvider{provider}, 5)
+	cs := cron.NewCronService(t.TempDir()+"/jobs.json", nil)
+	tool.SetScheduler(cs)
+	tool.SetContext("telegram", "7")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":    "digest_add",
+		"topics":    []interface{}{"tech", "markets"},
+		"cron_expr": "0 8 * * *",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	jobs := cs.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != newsDigestJobKind {
+		t.Fatalf("Expected one digest job, got %+v", jobs)
+	}
+
+	msg, err := tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil {
+		t.Fatalf("ExecuteJob failed: %v", err)
+	}
+	// The same story is only listed under the first topic
+	if strings.Count(msg, "Big news") != 1 || !strings.Contains(msg, "tech") {
+		t.Errorf("Unexpected digest: %q", msg)
+	}
+}
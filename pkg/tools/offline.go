@@ -0,0 +1,241 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxDeferredCalls bounds the calls kept for when the connection is back.
+const maxDeferredCalls = 100
+
+// OfflineTool is implemented by tools that need no internet connection,
+// for every call or for some arguments, so they keep working in offline
+// mode.
+type OfflineTool interface {
+	WorksOffline(args map[string]interface{}) bool
+}
+
+// Connectivity reports whether the internet is reachable and since when;
+// *connectivity.Monitor implements it.
+type Connectivity interface {
+	Online() (bool, time.Time)
+}
+
+// worksOffline reports whether tool can run without a connection.
+func worksOffline(tool Tool, args map[string]interface{}) bool {
+	t, ok := tool.(OfflineTool)
+	return ok && t.WorksOffline(args)
+}
+
+// offlineRefusal tells the model a tool cannot run now, so it explains
+// that to the user instead of retrying into timeouts.
+func offlineRefusal(name string, since time.Time) *ToolResult {
+	return ErrorResult(fmt.Sprintf("There has been no internet connection since %s, so %s can't run right now. Don't retry: tell the user plainly what you couldn't do. Files, notes, lists and reminders still work.",
+		since.Format("15:04"), name))
+}
+
+// DeferredCall is a tool call that changes something, made while offline
+// or while the service it needs was down, and kept to run once the
+// connection or the service is back.
+type DeferredCall struct {
+	Tool     string                 `json:"tool"`
+	Args     map[string]interface{} `json:"args"`
+	Channel  string                 `json:"channel"`
+	ChatID   string                 `json:"chat_id"`
+	SenderID string                 `json:"sender_id,omitempty"`
+	// Service is the service whose outage the call waits out; empty
+	// when it waits for the connection
+	Service string    `json:"service,omitempty"`
+	Queued  time.Time `json:"queued"`
+}
+
+// DeferredActions holds changes asked for while offline, such as creating
+// an event or uploading a file, and runs them when the connection returns,
+// telling each chat how they went. The calls are saved in the workspace,
+// so they survive restarts.
+type DeferredActions struct {
+	path string
+	bus  *bus.MessageBus
+
+	mu    sync.Mutex
+	calls []DeferredCall
+}
+
+// NewDeferredActions loads the calls saved in workspace.
+func NewDeferredActions(workspace string, msgBus *bus.MessageBus) *DeferredActions {
+	d := &DeferredActions{
+		path: filepath.Join(workspace, "state", "deferred.json"),
+		bus:  msgBus,
+	}
+	if data, err := os.ReadFile(d.path); err == nil {
+		if err := json.Unmarshal(data, &d.calls); err != nil {
+			logger.WarnCF("tools", "Failed to load deferred actions", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return d
+}
+
+// Add keeps call for later, failing when too many are waiting.
+func (d *DeferredActions) Add(call DeferredCall) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.calls) >= maxDeferredCalls {
+		return fmt.Errorf("%d changes are already waiting for the connection", len(d.calls))
+	}
+	d.calls = append(d.calls, call)
+	return saveJSONAtomic(d.path, d.calls)
+}
+
+// Pending returns the calls waiting, oldest first.
+func (d *DeferredActions) Pending() []DeferredCall {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeferredCall(nil), d.calls...)
+}
+
+// Replay runs the waiting calls through registry and tells each chat
+// what was done. A call that finds the connection gone again stays
+// queued with the ones after it, and one whose service is still down
+// stays queued too. It returns how many calls ran.
+func (d *DeferredActions) Replay(ctx context.Context, registry *ToolRegistry) int {
+	d.mu.Lock()
+	calls := d.calls
+	d.calls = nil
+	d.mu.Unlock()
+
+	reports := map[string][]string{}
+	waited := map[string]map[string]bool{}
+	var kept []DeferredCall
+	ran := 0
+	for i, call := range calls {
+		if online, _ := registry.online(); !online {
+			kept = append(kept, calls[i:]...)
+			break
+		}
+		if down, _ := registry.serviceDown(call.Service); down {
+			kept = append(kept, call)
+			continue
+		}
+		callCtx := WithSender(ctx, call.SenderID)
+		result := registry.run(callCtx, call.Tool, call.Args, call.Channel, call.ChatID, nil)
+		ran++
+		line := firstLine(result.ForUser)
+		if result.IsError {
+			line = "failed: " + firstLine(result.ForLLM)
+		} else if line == "" {
+			line = firstLine(result.ForLLM)
+		}
+		if line == "" {
+			line = "done"
+		}
+		line = utils.Truncate(line, 150)
+		key := call.Channel + "\x00" + call.ChatID
+		reports[key] = append(reports[key], fmt.Sprintf("• %s (asked %s): %s", describeCall(call), call.Queued.Format("Jan 2 15:04"), line))
+		if waited[key] == nil {
+			waited[key] = map[string]bool{}
+		}
+		waited[key][call.Service] = true
+	}
+	d.requeue(kept)
+	d.mu.Lock()
+	if err := saveJSONAtomic(d.path, d.calls); err != nil {
+		logger.WarnCF("tools", "Failed to save deferred actions", map[string]interface{}{"error": err.Error()})
+	}
+	d.mu.Unlock()
+
+	keys := make([]string, 0, len(reports))
+	for key := range reports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		channel, chatID, _ := strings.Cut(key, "\x00")
+		d.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: backHeader(waited[key]) + "\n" + strings.Join(reports[key], "\n"),
+		})
+	}
+	return ran
+}
+
+// backHeader opens the report to a chat whose calls waited for services,
+// "" standing for the connection.
+func backHeader(services map[string]bool) string {
+	if len(services) == 1 {
+		for service := range services {
+			if service != "" {
+				return fmt.Sprintf("🌐 %s is back. What was waiting for it:", service)
+			}
+		}
+		return "🌐 Back online. What was waiting for the connection:"
+	}
+	return "🌐 Back online. What was waiting:"
+}
+
+// requeue puts calls back in front of any added meanwhile.
+func (d *DeferredActions) requeue(calls []DeferredCall) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(append([]DeferredCall(nil), calls...), d.calls...)
+}
+
+// describeCall names a deferred call for the user: "calendar create".
+func describeCall(call DeferredCall) string {
+	if action, _ := call.Args["action"].(string); action != "" {
+		return call.Tool + " " + action
+	}
+	return call.Tool
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// ChatData implements ChatDataStore: the chat's calls still waiting.
+func (d *DeferredActions) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	var calls []DeferredCall
+	for _, call := range d.Pending() {
+		if call.Channel+":"+call.ChatID == chatKey {
+			calls = append(calls, call)
+		}
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	return snapshot(calls)
+}
+
+// PurgeChat implements ChatDataStore. The calls are dropped without
+// running.
+func (d *DeferredActions) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	kept := d.calls[:0:0]
+	for _, call := range d.calls {
+		if call.Channel+":"+call.ChatID != chatKey {
+			kept = append(kept, call)
+		}
+	}
+	n := len(d.calls) - len(kept)
+	if n == 0 {
+		return 0, nil
+	}
+	d.calls = kept
+	return n, saveJSONAtomic(d.path, d.calls)
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type fakeConnectivity struct{ up bool }
+
+func (c *fakeConnectivity) Online() (bool, time.Time) { return c.up, time.Now() }
+
+// fakeCalendar needs the internet; create changes something, list does not.
+type fakeCalendar struct{ created []string }
+
+func (t *fakeCalendar) Name() string        { return "calendar" }
+func (t *fakeCalendar) Description() string { return "calendar" }
+func (t *fakeCalendar) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t *fakeCalendar) Mutates(args map[string]interface{}) bool { return actionIn(args, "create") }
+func (t *fakeCalendar) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if actionIn(args, "create") {
+		title, _ := args["title"].(string)
+		t.created = append(t.created, title)
+		return NewToolResult("Event created: " + title)
+	}
+	return NewToolResult("no events")
+}
+
+// TestRegistry_OfflineDefersChangesAndReplaysThem verifies that offline,
+// local tools run, reads are refused, changes wait and run once back online
+func TestRegistry_OfflineDefersChangesAndReplaysThem(t *testing.T) {
+	dir := t.TempDir()
+	msgBus := bus.NewMessageBus()
+	conn := &fakeConnectivity{}
+	calendar := &fakeCalendar{}
+	deferred := NewDeferredActions(dir, msgBus)
+	registry := NewToolRegistry()
+	registry.Register(calendar)
+	registry.Register(NewListDirTool(dir, true))
+	registry.SetConnectivity(conn, deferred)
+	ctx := WithSender(context.Background(), "u1")
+
+	if result := registry.ExecuteWithContext(ctx, "list_dir", map[string]interface{}{"path": dir}, "telegram", "42", nil); result.IsError {
+		t.Errorf("list_dir refused offline: %s", result.ForLLM)
+	}
+	if result := registry.ExecuteWithContext(ctx, "calendar", map[string]interface{}{"action": "list"}, "telegram", "42", nil); !result.IsError || !strings.Contains(result.ForLLM, "no internet connection") {
+		t.Errorf("read not refused offline: %+v", result)
+	}
+	result := registry.ExecuteWithContext(ctx, "calendar", map[string]interface{}{"action": "create", "title": "Dentist"}, "telegram", "42", nil)
+	if result.IsError || !strings.Contains(result.ForLLM, "saved") || len(calendar.created) != 0 {
+		t.Fatalf("change not deferred: %+v, created %v", result, calendar.created)
+	}
+
+	// The deferred call survives a restart
+	deferred = NewDeferredActions(dir, msgBus)
+	if pending := deferred.Pending(); len(pending) != 1 || pending[0].SenderID != "u1" {
+		t.Fatalf("pending after reload = %+v", pending)
+	}
+
+	conn.up = true
+	if ran := deferred.Replay(context.Background(), registry); ran != 1 {
+		t.Fatalf("replayed %d calls, want 1", ran)
+	}
+	if len(calendar.created) != 1 || calendar.created[0] != "Dentist" || len(deferred.Pending()) != 0 {
+		t.Errorf("created %v, pending %v", calendar.created, deferred.Pending())
+	}
+	out := msgBus.DrainOutbound()
+	if len(out) != 1 || out[0].ChatID != "42" || !strings.Contains(out[0].Content, "calendar create") || !strings.Contains(out[0].Content, "Event created: Dentist") {
+		t.Errorf("unexpected report: %+v", out)
+	}
+}
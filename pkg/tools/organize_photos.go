@@ -0,0 +1,377 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/exif"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const (
+	maxOrganizePhotos = 5000
+	// maxExifLookups bounds how many originals are fetched for locations
+	maxExifLookups = 500
+	// photoPlanTTL is how long a dry-run plan can be executed
+	photoPlanTTL = time.Hour
+)
+
+// PhotoAlbumPlan is one album a plan will create or fill.
+type PhotoAlbumPlan struct {
+	Title    string
+	ItemIDs  []string
+	From, To time.Time
+	Samples  []string
+	// ExistingID is set when an album with this title already exists
+	ExistingID string
+}
+
+// PhotoPlan is the dry-run result of an organize request.
+type PhotoPlan struct {
+	ID         string
+	ChatKey    string
+	Albums     []PhotoAlbumPlan
+	Unassigned int
+	Created    time.Time
+}
+
+// OrganizePhotosTool sorts a date range of Google Photos into albums by
+// month or by trip. It always plans first and only changes the library
+// when a plan is executed.
+type OrganizePhotosTool struct {
+	photos   *GooglePhotosClient
+	profiles *profile.Store
+	mu       sync.Mutex
+	plans    map[string]*PhotoPlan
+	channel  string
+	chatID   string
+}
+
+func NewOrganizePhotosTool(photos *GooglePhotosClient, profiles *profile.Store) *OrganizePhotosTool {
+	return &OrganizePhotosTool{
+		photos:   photos,
+		profiles: profiles,
+		plans:    make(map[string]*PhotoPlan),
+	}
+}
+
+func (t *OrganizePhotosTool) Name() string {
+	return "organize_photos"
+}
+
+func (t *OrganizePhotosTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "execute")
+}
+
+func (t *OrganizePhotosTool) Description() string {
+	return "Sort Google Photos from a date range into albums, one per month or one per trip (bursts of photos separated by quiet days or long distances). Always run action=plan first and show the user the plan; only call action=execute with the plan_id after they confirm."
+}
+
+func (t *OrganizePhotosTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"plan", "execute"},
+				"description": "plan computes albums without changing anything; execute applies a plan",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "First day, YYYY-MM-DD (plan)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Last day, YYYY-MM-DD (plan)",
+			},
+			"group_by": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"month", "trip"},
+				"description": "How to group photos (default month)",
+			},
+			"gap_hours": map[string]interface{}{
+				"type":        "number",
+				"description": "Trip mode: hours without photos that end a trip (default 36)",
+			},
+			"min_photos": map[string]interface{}{
+				"type":        "integer",
+				"description": "Trip mode: smallest group that counts as a trip (default 10)",
+			},
+			"use_location": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Trip mode: also split where consecutive photos are far apart, using EXIF GPS (slower)",
+			},
+			"album_prefix": map[string]interface{}{
+				"type":        "string",
+				"description": "Text put before each album title, e.g. \"Family\"",
+			},
+			"plan_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Plan to execute",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *OrganizePhotosTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *OrganizePhotosTool) location(chatKey string) *time.Location {
+	if t.profiles == nil {
+		return time.Local
+	}
+	return t.profiles.Get(chatKey).Location()
+}
+
+func (t *OrganizePhotosTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	chatKey := t.channel + ":" + t.chatID
+
+	switch action {
+	case "plan":
+		loc := t.location(chatKey)
+		fromStr, _ := args["from"].(string)
+		toStr, _ := args["to"].(string)
+		from, err := time.ParseInLocation("2006-01-02", fromStr, loc)
+		if err != nil {
+			return ErrorResult("from is required as YYYY-MM-DD")
+		}
+		to, err := time.ParseInLocation("2006-01-02", toStr, loc)
+		if err != nil || to.Before(from) {
+			return ErrorResult("to is required as YYYY-MM-DD, on or after from")
+		}
+
+		items, err := t.photos.SearchByDate(ctx, from, to, maxOrganizePhotos)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("photo search failed: %v", err)).WithError(err)
+		}
+		if len(items) == 0 {
+			return SilentResult(fmt.Sprintf("No photos between %s and %s.", fromStr, toStr))
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Created.Before(items[j].Created) })
+
+		groupBy, _ := args["group_by"].(string)
+		prefix, _ := args["album_prefix"].(string)
+		var groups [][]PhotoItem
+		var titles []string
+		var note string
+		if groupBy == "trip" {
+			gap := 36 * time.Hour
+			if v, ok := args["gap_hours"].(float64); ok && v > 0 {
+				gap = time.Duration(v * float64(time.Hour))
+			}
+			minPhotos := 10
+			if v, ok := args["min_photos"].(float64); ok && v > 0 {
+				minPhotos = int(v)
+			}
+			var locations map[string]*exif.Info
+			if useLocation, _ := args["use_location"].(bool); useLocation {
+				locations, note = t.lookupLocations(ctx, items)
+			}
+			groups = groupPhotosByTrip(items, gap, minPhotos, locations)
+			for _, g := range groups {
+				titles = append(titles, tripTitle(g, loc))
+			}
+		} else {
+			groups = groupPhotosByMonth(items, loc)
+			for _, g := range groups {
+				titles = append(titles, g[0].Created.In(loc).Format("2006-01 January"))
+			}
+		}
+
+		existing := map[string]string{}
+		if albums, err := t.photos.ListAlbums(ctx); err == nil {
+			for _, a := range albums {
+				existing[strings.ToLower(a.Title)] = a.ID
+			}
+		}
+
+		plan := &PhotoPlan{ID: newPlanID(), ChatKey: chatKey, Created: time.Now()}
+		assigned := 0
+		for i, g := range groups {
+			title := strings.TrimSpace(prefix + " " + titles[i])
+			p := PhotoAlbumPlan{
+				Title:      title,
+				From:       g[0].Created.In(loc),
+				To:         g[len(g)-1].Created.In(loc),
+				ExistingID: existing[strings.ToLower(title)],
+			}
+			for j, item := range g {
+				p.ItemIDs = append(p.ItemIDs, item.ID)
+				if j < 3 {
+					p.Samples = append(p.Samples, item.Filename)
+				}
+			}
+			assigned += len(g)
+			plan.Albums = append(plan.Albums, p)
+		}
+		plan.Unassigned = len(items) - assigned
+		if len(plan.Albums) == 0 {
+			return SilentResult(fmt.Sprintf("Found %d photos but none formed an album with these settings. Try a smaller min_photos or a larger gap_hours.", len(items)))
+		}
+
+		t.mu.Lock()
+		for id, p := range t.plans {
+			if time.Since(p.Created) > photoPlanTTL {
+				delete(t.plans, id)
+			}
+		}
+		t.plans[plan.ID] = plan
+		t.mu.Unlock()
+
+		out := formatPhotoPlan(plan, len(items))
+		if note != "" {
+			out += "\n" + note
+		}
+		return SilentResult(out)
+
+	case "execute":
+		planID, _ := args["plan_id"].(string)
+		t.mu.Lock()
+		plan := t.plans[planID]
+		if plan != nil && (plan.ChatKey != chatKey || time.Since(plan.Created) > photoPlanTTL) {
+			plan = nil
+		}
+		delete(t.plans, planID)
+		t.mu.Unlock()
+		if plan == nil {
+			return ErrorResult("plan not found or expired; run action=plan again")
+		}
+
+		var sb strings.Builder
+		done := 0
+		for _, p := range plan.Albums {
+			albumID := p.ExistingID
+			if albumID == "" {
+				album, err := t.photos.CreateAlbum(ctx, p.Title)
+				if err != nil {
+					fmt.Fprintf(&sb, "✗ %s: could not create album: %v\n", p.Title, err)
+					continue
+				}
+				albumID = album.ID
+			}
+			if err := t.photos.AddToAlbum(ctx, albumID, p.ItemIDs); err != nil {
+				fmt.Fprintf(&sb, "✗ %s: %v\n", p.Title, err)
+				continue
+			}
+			done++
+			fmt.Fprintf(&sb, "✓ %s: %d photos\n", p.Title, len(p.ItemIDs))
+		}
+		return SilentResult(fmt.Sprintf("Organized %d of %d albums:\n%s", done, len(plan.Albums), strings.TrimSuffix(sb.String(), "\n")))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func newPlanID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// lookupLocations reads EXIF for up to maxExifLookups photos. Failures are
+// skipped: a photo without a location just doesn't split a trip.
+func (t *OrganizePhotosTool) lookupLocations(ctx context.Context, items []PhotoItem) (map[string]*exif.Info, string) {
+	locations := make(map[string]*exif.Info)
+	for i, item := range items {
+		if i >= maxExifLookups {
+			return locations, fmt.Sprintf("Locations were read for the first %d photos only.", maxExifLookups)
+		}
+		info, err := t.photos.ReadExif(ctx, item)
+		if err == nil && info.HasLocation {
+			locations[item.ID] = info
+		}
+	}
+	if len(locations) == 0 {
+		return locations, "No GPS data was found in these photos; trips were split by time only."
+	}
+	return locations, ""
+}
+
+func groupPhotosByMonth(items []PhotoItem, loc *time.Location) [][]PhotoItem {
+	var groups [][]PhotoItem
+	lastKey := ""
+	for _, item := range items {
+		key := item.Created.In(loc).Format("2006-01")
+		if key != lastKey {
+			groups = append(groups, nil)
+			lastKey = key
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], item)
+	}
+	return groups
+}
+
+// tripJumpKm is how far apart two consecutive photos must be to start a new
+// trip even without a time gap (e.g. flying on to the next city).
+const tripJumpKm = 300
+
+// groupPhotosByTrip clusters photos separated by more than gap (or by a
+// long jump in location) and keeps clusters of at least minPhotos.
+func groupPhotosByTrip(items []PhotoItem, gap time.Duration, minPhotos int, locations map[string]*exif.Info) [][]PhotoItem {
+	var clusters [][]PhotoItem
+	var lastLoc *exif.Info
+	for i, item := range items {
+		split := i == 0 || item.Created.Sub(items[i-1].Created) > gap
+		if loc := locations[item.ID]; loc != nil {
+			if lastLoc != nil && exif.DistanceKm(lastLoc.Latitude, lastLoc.Longitude, loc.Latitude, loc.Longitude) > tripJumpKm {
+				split = true
+			}
+			lastLoc = loc
+		}
+		if split {
+			clusters = append(clusters, nil)
+		}
+		clusters[len(clusters)-1] = append(clusters[len(clusters)-1], item)
+	}
+
+	var trips [][]PhotoItem
+	for _, c := range clusters {
+		if len(c) >= minPhotos {
+			trips = append(trips, c)
+		}
+	}
+	return trips
+}
+
+func tripTitle(group []PhotoItem, loc *time.Location) string {
+	first, last := group[0].Created.In(loc), group[len(group)-1].Created.In(loc)
+	switch {
+	case first.Format("2006-01-02") == last.Format("2006-01-02"):
+		return "Trip " + first.Format("2 Jan 2006")
+	case first.Year() == last.Year() && first.Month() == last.Month():
+		return fmt.Sprintf("Trip %d-%s", first.Day(), last.Format("2 Jan 2006"))
+	case first.Year() == last.Year():
+		return fmt.Sprintf("Trip %s - %s", first.Format("2 Jan"), last.Format("2 Jan 2006"))
+	default:
+		return fmt.Sprintf("Trip %s - %s", first.Format("2 Jan 2006"), last.Format("2 Jan 2006"))
+	}
+}
+
+func formatPhotoPlan(plan *PhotoPlan, total int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Plan %s (dry run, nothing changed yet): %d photos into %d albums\n", plan.ID, total-plan.Unassigned, len(plan.Albums))
+	for _, p := range plan.Albums {
+		verb := "new album"
+		if p.ExistingID != "" {
+			verb = "add to existing album"
+		}
+		fmt.Fprintf(&sb, "- %s (%s): %d photos, %s to %s, e.g. %s\n", p.Title, verb, len(p.ItemIDs),
+			p.From.Format("2006-01-02"), p.To.Format("2006-01-02"), strings.Join(p.Samples, ", "))
+	}
+	if plan.Unassigned > 0 {
+		fmt.Fprintf(&sb, "%d photos don't belong to any album and stay as they are.\n", plan.Unassigned)
+	}
+	fmt.Fprintf(&sb, "To apply, call execute with plan_id=%s (valid for %d minutes).", plan.ID, int(photoPlanTTL.Minutes()))
+	return sb.String()
+}
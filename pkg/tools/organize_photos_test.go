@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOrganizePhotosTool_TripPlanAndExecute verifies photos are clustered into trips, planned, then applied
+func TestOrganizePhotosTool_TripPlanAndExecute(t *testing.T) {
+	var items []map[string]interface{}
+	add := func(start time.Time, n int) {
+		for i := 0; i < n; i++ {
+			ts := start.Add(time.Duration(i) * 2 * time.Hour)
+			items = append(items, map[string]interface{}{
+				"id":            fmt.Sprintf("p%d", len(items)),
+				"filename":      fmt.Sprintf("IMG_%d.jpg", len(items)),
+				"mediaMetadata": map[string]interface{}{"creationTime": ts.UTC().Format(time.RFC3339)},
+			})
+		}
+	}
+	add(time.Date(2026, 3, 12, 9, 0, 0, 0, time.UTC), 12) // 12-13 Mar
+	add(time.Date(2026, 3, 20, 10, 0, 0, 0, time.UTC), 2) // too small for a trip
+	add(time.Date(2026, 4, 2, 8, 0, 0, 0, time.UTC), 10)  // 2-3 Apr
+
+	var created []string
+	added := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/mediaItems:search":
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["pageToken"] == nil {
+				json.NewEncoder(w).Encode(map[string]interface{}{"mediaItems": items[:15], "nextPageToken": "next"})
+			} else {
+				json.NewEncoder(w).Encode(map[string]interface{}{"mediaItems": items[15:]})
+			}
+		case r.URL.Path == "/albums" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"albums":[{"id":"old","title":"Trip 2-3 Apr 2026"}]}`))
+		case r.URL.Path == "/albums" && r.Method == http.MethodPost:
+			var req struct {
+				Album struct{ Title string } `json:"album"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			created = append(created, req.Album.Title)
+			w.Write([]byte(`{"id":"new1"}`))
+		case strings.HasSuffix(r.URL.Path, ":batchAddMediaItems"):
+			var req struct {
+				MediaItemIDs []string `json:"mediaItemIds"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			added[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/albums/"), ":batchAddMediaItems")] += len(req.MediaItemIDs)
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewGooglePhotosClient(func(ctx context.Context) (string, error) { return "tok", nil })
+	client.baseURL = server.URL
+	tool := NewOrganizePhotosTool(client, nil)
+	tool.SetContext("telegram", "42")
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action": "plan", "from": "2026-03-01", "to": "2026-04-30", "group_by": "trip",
+	})
+	if result.IsError {
+		t.Fatalf("plan failed: %s", result.ForLLM)
+	}
+	if len(created) != 0 || len(added) != 0 {
+		t.Fatalf("Plan must not change the library")
+	}
+	for _, want := range []string{"22 photos into 2 albums", "(new album): 12 photos", "Trip 2-3 Apr 2026 (add to existing album): 10 photos", "2 photos don't belong"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in plan:\n%s", want, result.ForLLM)
+		}
+	}
+
+	planID := regexp.MustCompile(`plan_id=(\w+)`).FindStringSubmatch(result.ForLLM)[1]
+	tool.SetContext("telegram", "7")
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "execute", "plan_id": planID}); !result.IsError {
+		t.Errorf("Expected another chat not to execute the plan")
+	}
+
+	// The failed attempt above consumed the plan, so plan again from the right chat
+	tool.SetContext("telegram", "42")
+	result = tool.Execute(ctx, map[string]interface{}{"action": "plan", "from": "2026-03-01", "to": "2026-04-30", "group_by": "trip"})
+	planID = regexp.MustCompile(`plan_id=(\w+)`).FindStringSubmatch(result.ForLLM)[1]
+	result = tool.Execute(ctx, map[string]interface{}{"action": "execute", "plan_id": planID})
+	if result.IsError || !strings.Contains(result.ForLLM, "Organized 2 of 2 albums") {
+		t.Fatalf("execute failed: %s", result.ForLLM)
+	}
+	if len(created) != 1 || created[0] != "Trip 12-13 Mar 2026" || added["new1"] != 12 || added["old"] != 10 {
+		t.Errorf("Unexpected changes: created=%v added=%v", created, added)
+	}
+}
+
+// TestGroupPhotosByMonth verifies month boundaries follow the user's timezone
+func TestGroupPhotosByMonth(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	items := []PhotoItem{
+		{ID: "a", Created: time.Date(2026, 1, 31, 10, 0, 0, 0, time.UTC)},
+		{ID: "b", Created: time.Date(2026, 1, 31, 20, 0, 0, 0, time.UTC)}, // Feb 1 in Tokyo
+	}
+	if got := len(groupPhotosByMonth(items, time.UTC)); got != 1 {
+		t.Errorf("Expected 1 group in UTC, got %d", got)
+	}
+	if got := len(groupPhotosByMonth(items, tokyo)); got != 2 {
+		t.Errorf("Expected 2 groups in Tokyo, got %d", got)
+	}
+}
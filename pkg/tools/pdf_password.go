@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pdfPasswordWindow is how long a request for a PDF's password waits
+	// for the reply.
+	pdfPasswordWindow = 30 * time.Minute
+	// pdfPasswordTTL is how long a password is kept after it opened a
+	// file, so follow-up questions about it need not ask again.
+	pdfPasswordTTL = time.Hour
+)
+
+// PDFPasswordError is returned by pdfToText for a PDF it cannot open
+// without a password, or with the one the user gave.
+type PDFPasswordError struct {
+	hash string
+	// Wrong is set when a password was given but did not open the file
+	Wrong bool
+}
+
+func (e *PDFPasswordError) Error() string {
+	if e.Wrong {
+		return "the password given for this PDF does not open it"
+	}
+	return "the PDF is password-protected"
+}
+
+// PDFPasswords asks users for the passwords of protected PDFs, such as
+// bank statements and payslips, and keeps each answer in memory for an
+// hour, by the file's SHA-256. The reply is taken off the chat before it
+// is logged, journaled or shown to the model, and the password is never
+// written anywhere.
+type PDFPasswords struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*pendingPassword
+	known   map[string]knownPassword
+}
+
+type pendingPassword struct {
+	tool    string
+	args    map[string]interface{}
+	hash    string
+	expires time.Time
+}
+
+type knownPassword struct {
+	password string
+	expires  time.Time
+}
+
+// PasswordRetry is a call that failed on a protected PDF, to run again
+// now that the user sent its password.
+type PasswordRetry struct {
+	Tool string
+	Args map[string]interface{}
+}
+
+func NewPDFPasswords() *PDFPasswords {
+	return &PDFPasswords{now: time.Now, pending: map[string]*pendingPassword{}, known: map[string]knownPassword{}}
+}
+
+// ask remembers a call waiting for the password of the file with hash,
+// replacing any earlier request in chat.
+func (p *PDFPasswords) ask(chat, tool string, args map[string]interface{}, hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[chat] = &pendingPassword{tool: tool, args: args, hash: hash, expires: p.now().Add(pdfPasswordWindow)}
+}
+
+// Answer takes a user's message in chat as the password asked for there,
+// if any: it is kept for the file and the call to run again is returned.
+// "cancel" drops the request and returns a nil retry.
+func (p *PDFPasswords) Answer(chat, reply string) (*PasswordRetry, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, ok := p.pending[chat]
+	delete(p.pending, chat)
+	if !ok || !p.now().Before(pending.expires) {
+		return nil, false
+	}
+	password := strings.TrimSpace(reply)
+	if strings.EqualFold(password, "cancel") {
+		return nil, true
+	}
+	p.known[pending.hash] = knownPassword{password: password, expires: p.now().Add(pdfPasswordTTL)}
+	return &PasswordRetry{Tool: pending.tool, Args: pending.args}, true
+}
+
+// lookup returns the password kept for the file with hash.
+func (p *PDFPasswords) lookup(hash string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for h, known := range p.known {
+		if !p.now().Before(known.expires) {
+			delete(p.known, h)
+		}
+	}
+	known, ok := p.known[hash]
+	return known.password, ok
+}
+
+// forget drops a password that turned out wrong.
+func (p *PDFPasswords) forget(hash string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.known, hash)
+}
+
+type pdfPasswordsKey struct{}
+
+// withPDFPasswords lets pdfToText open the protected files whose
+// passwords users gave.
+func withPDFPasswords(ctx context.Context, p *PDFPasswords) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, pdfPasswordsKey{}, p)
+}
+
+func pdfPasswordsFromContext(ctx context.Context) *PDFPasswords {
+	p, _ := ctx.Value(pdfPasswordsKey{}).(*PDFPasswords)
+	return p
+}
+
+// fileSHA256 identifies a file by content, so a password given for a PDF
+// also opens it when downloaded again to another temp file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
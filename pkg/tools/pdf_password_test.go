@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePDFToText stands in for pdftotext: the PDF only opens with -upw s3cret.
+const fakePDFToText = `#!/bin/sh
+for a in "$@"; do
+	[ "$prev" = "-upw" ] && pw="$a"
+	prev="$a"
+done
+if [ "$pw" = "s3cret" ]; then
+	echo "Payslip October, net pay 2100.00"
+	exit 0
+fi
+echo "Command Line Error: Incorrect password" >&2
+exit 1
+`
+
+// TestPDFPasswords_AskAndRetry verifies a protected PDF makes the registry ask the user for its password, a wrong one asks again, the right one opens it for the call and later ones, and the password never reaches the model
+func TestPDFPasswords_AskAndRetry(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "pdftotext"), []byte(fakePDFToText), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "payslip.pdf"), []byte("%PDF-1.7 encrypted"), 0o644)
+
+	provider := &recordingProvider{}
+	passwords := NewPDFPasswords()
+	registry := NewToolRegistry()
+	registry.Register(NewSummarizeTool(provider, "test", workspace, true, nil, nil))
+	registry.SetPDFPasswords(passwords)
+	args := map[string]interface{}{"path": "payslip.pdf"}
+
+	result := registry.ExecuteWithContext(context.Background(), "summarize", args, "telegram", "42", nil)
+	if result.IsError || !strings.HasPrefix(result.ForUser, "🔒 This PDF is password-protected.") || !strings.Contains(result.ForLLM, "Never ask for the password yourself") {
+		t.Fatalf("Expected the user asked for the password, got %+v", result)
+	}
+	if _, ok := passwords.Answer("telegram:7", "s3cret"); ok {
+		t.Error("Expected another chat's message not taken as the password")
+	}
+
+	retry, ok := passwords.Answer("telegram:42", "guess")
+	if !ok || retry.Tool != "summarize" {
+		t.Fatalf("Expected the call to retry, got %+v, %v", retry, ok)
+	}
+	result = registry.ExecuteWithContext(context.Background(), retry.Tool, retry.Args, "telegram", "42", nil)
+	if !strings.HasPrefix(result.ForUser, "🔒 That password did not open the PDF.") {
+		t.Fatalf("Expected the password asked again, got %+v", result)
+	}
+
+	retry, _ = passwords.Answer("telegram:42", " s3cret ")
+	result = registry.ExecuteWithContext(context.Background(), retry.Tool, retry.Args, "telegram", "42", nil)
+	if result.IsError || len(provider.inputs) != 1 || !strings.Contains(provider.inputs[0], "net pay 2100.00") {
+		t.Fatalf("Expected the PDF opened and summarized, got %+v, inputs %q", result, provider.inputs)
+	}
+	if strings.Contains(result.ForLLM, "s3cret") || strings.Contains(provider.inputs[0], "s3cret") {
+		t.Error("The password reached the model")
+	}
+
+	// The summary is cached by the text, so it is read again to find it
+	if result := registry.ExecuteWithContext(context.Background(), "summarize", args, "telegram", "42", nil); result.IsError || result.ForUser != "" || !strings.Contains(result.ForLLM, "cached") {
+		t.Errorf("Expected the kept password to open the file again, got %+v", result)
+	}
+	if retry, ok := passwords.Answer("telegram:42", "s3cret"); ok || retry != nil {
+		t.Errorf("Expected no request left waiting, got %+v", retry)
+	}
+}
@@ -0,0 +1,495 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const (
+	maxDuplicatePhotos = 5000
+	// maxDuplicateHashes bounds how many thumbnails compare_images fetches
+	maxDuplicateHashes = 1000
+	// sameMomentWindow is how close two shots must be to count as taken at
+	// the same moment
+	sameMomentWindow = 2 * time.Second
+	// lookAlikeDistance is the largest number of differing hash bits for
+	// two photos to count as looking alike
+	lookAlikeDistance = 6
+	// duplicateReportGroups bounds the groups listed in one report
+	duplicateReportGroups = 30
+)
+
+// copySuffix matches what apps and people add to the name of a copy:
+// "IMG_1234 (1)", "IMG_1234-copy", "IMG_1234 copy 2", "IMG_1234-edited".
+var copySuffix = regexp.MustCompile(`(\s*\(\d+\)|[-_ ]copy(\s*\d+)?|[-_ ]edited|~\d+)$`)
+
+// DuplicateGroup is a set of photos that are likely the same picture.
+type DuplicateGroup struct {
+	// Keep is the photo the report suggests keeping: the largest, and the
+	// one without a copy suffix among equals
+	Keep    PhotoItem
+	Others  []PhotoItem
+	Reasons []string
+}
+
+// DuplicateScan is the result of a scan, kept so an album of the suspects
+// can be made from it.
+type DuplicateScan struct {
+	ID       string
+	ChatKey  string
+	From, To time.Time
+	Groups   []DuplicateGroup
+	Created  time.Time
+}
+
+// PhotoDuplicatesTool finds likely duplicates in a date range of Google
+// Photos: copies with the same name and size, shots taken at the same
+// moment, and, when asked, photos whose thumbnails look alike. The
+// Library API cannot delete, so the result is a report to act on in the
+// Photos app and, on request, an album holding the suspected copies.
+type PhotoDuplicatesTool struct {
+	photos   *GooglePhotosClient
+	profiles *profile.Store
+	client   *http.Client
+	mu       sync.Mutex
+	scans    map[string]*DuplicateScan
+}
+
+func NewPhotoDuplicatesTool(photos *GooglePhotosClient, profiles *profile.Store) *PhotoDuplicatesTool {
+	return &PhotoDuplicatesTool{
+		photos:   photos,
+		profiles: profiles,
+		client:   &http.Client{Timeout: 15 * time.Second},
+		scans:    make(map[string]*DuplicateScan),
+	}
+}
+
+func (t *PhotoDuplicatesTool) Name() string {
+	return "photo_duplicates"
+}
+
+func (t *PhotoDuplicatesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "album")
+}
+
+func (t *PhotoDuplicatesTool) ActionScopes() map[string][]string {
+	return map[string][]string{"album": googleScopes("photoslibrary", "photoslibrary.appendonly")}
+}
+
+func (t *PhotoDuplicatesTool) Description() string {
+	return "Find likely duplicate photos in Google Photos for a date range: copies with the same name and size, shots taken at the same moment, and with compare_images=true photos that look alike. action=scan returns a review list with the copy to keep and the ones to remove; Google does not let apps delete photos, so the user removes them in the Photos app. action=album with the scan_id puts the suspected copies in an album for review, after the user asks for it."
+}
+
+func (t *PhotoDuplicatesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"scan", "album"},
+				"description": "scan finds duplicates without changing anything; album gathers the suspected copies of a scan into a new album",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "First day, YYYY-MM-DD (scan)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Last day, YYYY-MM-DD (scan)",
+			},
+			"compare_images": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Scan: also download small thumbnails and compare what the photos look like, to catch resized or re-saved copies (slower)",
+			},
+			"scan_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Scan to make the album from",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Album title (default \"Suspected duplicates\" and the date range)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PhotoDuplicatesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chatKey := channel + ":" + chatID
+	loc := time.Local
+	if t.profiles != nil {
+		loc = t.profiles.Get(chatKey).Location()
+	}
+
+	action, _ := args["action"].(string)
+	switch action {
+	case "scan":
+		fromStr, _ := args["from"].(string)
+		toStr, _ := args["to"].(string)
+		from, err := time.ParseInLocation("2006-01-02", fromStr, loc)
+		if err != nil {
+			return ErrorResult("from is required as YYYY-MM-DD")
+		}
+		to, err := time.ParseInLocation("2006-01-02", toStr, loc)
+		if err != nil || to.Before(from) {
+			return ErrorResult("to is required as YYYY-MM-DD, on or after from")
+		}
+
+		items, err := t.photos.SearchByDate(ctx, from, to, maxDuplicatePhotos)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("photo search failed: %v", err)).WithError(err)
+		}
+		if len(items) == 0 {
+			return SilentResult(fmt.Sprintf("No photos between %s and %s.", fromStr, toStr))
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Created.Before(items[j].Created) })
+
+		var hashes map[string]uint64
+		var note string
+		if compare, _ := args["compare_images"].(bool); compare {
+			hashes, note = t.hashThumbnails(ctx, items)
+		}
+		groups := findDuplicates(items, hashes)
+		if len(groups) == 0 {
+			out := fmt.Sprintf("No likely duplicates among %d photos between %s and %s.", len(items), fromStr, toStr)
+			if hashes == nil {
+				out += " Run again with compare_images=true to also compare what the photos look like."
+			}
+			return SilentResult(strings.TrimSpace(out + " " + note))
+		}
+
+		scan := &DuplicateScan{ID: newPlanID(), ChatKey: chatKey, From: from, To: to, Groups: groups, Created: time.Now()}
+		t.mu.Lock()
+		for id, s := range t.scans {
+			if time.Since(s.Created) > photoPlanTTL {
+				delete(t.scans, id)
+			}
+		}
+		t.scans[scan.ID] = scan
+		t.mu.Unlock()
+
+		out := formatDuplicateScan(scan, len(items))
+		if note != "" {
+			out += "\n" + note
+		}
+		return SilentResult(out)
+
+	case "album":
+		scanID, _ := args["scan_id"].(string)
+		t.mu.Lock()
+		scan := t.scans[scanID]
+		if scan != nil && (scan.ChatKey != chatKey || time.Since(scan.Created) > photoPlanTTL) {
+			scan = nil
+		}
+		t.mu.Unlock()
+		if scan == nil {
+			return ErrorResult("scan not found or expired; run action=scan again")
+		}
+
+		var ids []string
+		for _, g := range scan.Groups {
+			for _, item := range g.Others {
+				ids = append(ids, item.ID)
+			}
+		}
+		title, _ := args["title"].(string)
+		if title = strings.TrimSpace(title); title == "" {
+			title = fmt.Sprintf("Suspected duplicates %s – %s", scan.From.Format("2 Jan 2006"), scan.To.Format("2 Jan 2006"))
+		}
+		album, err := t.photos.CreateAlbum(ctx, title)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("could not create album: %v", err)).WithError(err)
+		}
+		if err := t.photos.AddToAlbum(ctx, album.ID, ids); err != nil {
+			return ErrorResult(fmt.Sprintf("created album %q but could not add the photos: %v", title, err)).WithError(err)
+		}
+		t.mu.Lock()
+		delete(t.scans, scanID)
+		t.mu.Unlock()
+		return NewToolResult(fmt.Sprintf("Put %d suspected duplicates in the album %q: %s\nThe copies to keep are not in it, so after checking them the user can select all in the album and delete them in the Photos app.",
+			len(ids), title, album.ProductURL))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// findDuplicates groups items that share a name and size, were taken at
+// the same moment with the same size, or, for items in hashes, look
+// alike. items must be sorted by creation time.
+func findDuplicates(items []PhotoItem, hashes map[string]uint64) []DuplicateGroup {
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	reasons := map[int]map[string]bool{}
+	link := func(i, j int, reason string) {
+		ri, rj := find(i), find(j)
+		if ri != rj {
+			parent[rj] = ri
+			for r := range reasons[rj] {
+				if reasons[ri] == nil {
+					reasons[ri] = map[string]bool{}
+				}
+				reasons[ri][r] = true
+			}
+			delete(reasons, rj)
+		}
+		if reasons[ri] == nil {
+			reasons[ri] = map[string]bool{}
+		}
+		reasons[ri][reason] = true
+	}
+
+	byName := map[string][]int{}
+	for i, item := range items {
+		byName[duplicateName(item.Filename)] = append(byName[duplicateName(item.Filename)], i)
+	}
+	for _, idx := range byName {
+		for a := 0; a < len(idx); a++ {
+			for b := a + 1; b < len(idx); b++ {
+				if sameSize(items[idx[a]], items[idx[b]]) {
+					link(idx[a], idx[b], "same name and size")
+				}
+			}
+		}
+	}
+	for i := range items {
+		for j := i + 1; j < len(items) && items[j].Created.Sub(items[i].Created) <= sameMomentWindow; j++ {
+			if sameSize(items[i], items[j]) {
+				link(i, j, "taken at the same moment")
+			}
+		}
+	}
+	if hashes != nil {
+		var hashed []int
+		for i, item := range items {
+			if _, ok := hashes[item.ID]; ok {
+				hashed = append(hashed, i)
+			}
+		}
+		for a := 0; a < len(hashed); a++ {
+			for b := a + 1; b < len(hashed); b++ {
+				i, j := hashed[a], hashed[b]
+				if bits.OnesCount64(hashes[items[i].ID]^hashes[items[j].ID]) <= lookAlikeDistance {
+					link(i, j, "look alike")
+				}
+			}
+		}
+	}
+
+	members := map[int][]PhotoItem{}
+	var roots []int
+	for i, item := range items {
+		r := find(i)
+		if members[r] == nil {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], item)
+	}
+	var groups []DuplicateGroup
+	for _, r := range roots {
+		g := members[r]
+		if len(g) < 2 {
+			continue
+		}
+		keep := 0
+		for k := 1; k < len(g); k++ {
+			if betterOriginal(g[k], g[keep]) {
+				keep = k
+			}
+		}
+		group := DuplicateGroup{Keep: g[keep]}
+		for k, item := range g {
+			if k != keep {
+				group.Others = append(group.Others, item)
+			}
+		}
+		for reason := range reasons[find(r)] {
+			group.Reasons = append(group.Reasons, reason)
+		}
+		sort.Strings(group.Reasons)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// duplicateName is a filename reduced to what copies of it share: no
+// extension, case or copy suffix.
+func duplicateName(filename string) string {
+	name := strings.ToLower(strings.TrimSuffix(filename, path.Ext(filename)))
+	for {
+		trimmed := strings.TrimSpace(copySuffix.ReplaceAllString(name, ""))
+		if trimmed == name || trimmed == "" {
+			return name
+		}
+		name = trimmed
+	}
+}
+
+func sameSize(a, b PhotoItem) bool {
+	return a.Width > 0 && a.Height > 0 && a.Width == b.Width && a.Height == b.Height
+}
+
+// betterOriginal reports whether a is more likely the one to keep than b:
+// it is larger, or as large and named without a copy suffix, or older.
+func betterOriginal(a, b PhotoItem) bool {
+	if pa, pb := a.Width*a.Height, b.Width*b.Height; pa != pb {
+		return pa > pb
+	}
+	if ca, cb := isCopyName(a.Filename), isCopyName(b.Filename); ca != cb {
+		return cb
+	}
+	return a.Created.Before(b.Created)
+}
+
+func isCopyName(filename string) bool {
+	return duplicateName(filename) != strings.ToLower(strings.TrimSuffix(filename, path.Ext(filename)))
+}
+
+// hashThumbnails fetches a small thumbnail of up to maxDuplicateHashes
+// items and returns their difference hashes by item ID, with a note on
+// what could not be compared.
+func (t *PhotoDuplicatesTool) hashThumbnails(ctx context.Context, items []PhotoItem) (map[string]uint64, string) {
+	todo := items
+	var note string
+	if len(todo) > maxDuplicateHashes {
+		todo = todo[:maxDuplicateHashes]
+		note = fmt.Sprintf("Compared the look of the first %d photos only; scan a shorter range to compare the rest.", maxDuplicateHashes)
+	}
+	hashes := make(map[string]uint64, len(todo))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := 0
+	sem := make(chan struct{}, previewFetchers)
+	for _, item := range todo {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item PhotoItem) {
+			defer func() { <-sem; wg.Done() }()
+			hash, err := t.thumbnailHash(ctx, item.BaseURL)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				return
+			}
+			hashes[item.ID] = hash
+		}(item)
+	}
+	wg.Wait()
+	if failed > 0 {
+		note = strings.TrimSpace(note + fmt.Sprintf(" Could not download %d thumbnail(s) to compare.", failed))
+	}
+	return hashes, note
+}
+
+func (t *PhotoDuplicatesTool) thumbnailHash(ctx context.Context, baseURL string) (uint64, error) {
+	if err := egress.CheckDownloadURL(baseURL); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"=w64-h64", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("thumbnail failed (%d)", resp.StatusCode)
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return 0, err
+	}
+	return differenceHash(img), nil
+}
+
+// differenceHash is a perceptual hash of img: it shrinks the image to 9x8
+// gray cells and sets one bit per pair of neighbours where the left cell
+// is brighter. Resized, recompressed or lightly edited copies of a photo
+// differ in a few bits at most.
+func differenceHash(img image.Image) uint64 {
+	b := img.Bounds()
+	var cells [8][9]uint64
+	var counts [8][9]uint64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := (y - b.Min.Y) * 8 / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx := (x - b.Min.X) * 9 / b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA()
+			cells[cy][cx] += (299*uint64(r) + 587*uint64(g) + 114*uint64(bl)) / 1000
+			counts[cy][cx]++
+		}
+	}
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left, right := cells[y][x], cells[y][x+1]
+			if counts[y][x] > 0 {
+				left /= counts[y][x]
+			}
+			if counts[y][x+1] > 0 {
+				right /= counts[y][x+1]
+			}
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func formatDuplicateScan(scan *DuplicateScan, scanned int) string {
+	suspects := 0
+	for _, g := range scan.Groups {
+		suspects += len(g.Others)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Scan %s: %d group(s) of likely duplicates among %d photos, %d suspected copies.\n",
+		scan.ID, len(scan.Groups), scanned, suspects)
+	for i, g := range scan.Groups {
+		if i == duplicateReportGroups {
+			fmt.Fprintf(&sb, "…and %d more group(s)\n", len(scan.Groups)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "%d. %s\n   keep %s %s\n", i+1, strings.Join(g.Reasons, ", "), describeDuplicate(g.Keep), g.Keep.ProductURL)
+		for _, item := range g.Others {
+			fmt.Fprintf(&sb, "   remove %s %s\n", describeDuplicate(item), item.ProductURL)
+		}
+	}
+	sb.WriteString("Google does not let apps delete photos: the user removes the copies in the Photos app. Offer action=album with this scan_id to gather the suspected copies in one album.")
+	return sb.String()
+}
+
+func describeDuplicate(item PhotoItem) string {
+	s := item.Filename
+	if item.Width > 0 && item.Height > 0 {
+		s += fmt.Sprintf(" (%d×%d)", item.Width, item.Height)
+	}
+	return s
+}
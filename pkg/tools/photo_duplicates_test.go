@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// stripesJPEG encodes a w×h image of vertical stripes, period pixels wide.
+func stripesJPEG(t *testing.T, w, h, period int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if (x/period)%2 == 1 {
+				v = 255 - v
+			}
+			img.Set(x, y, color.Gray{Y: v})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestPhotoDuplicatesTool_ScanAndAlbum verifies copies are found by name, moment and look, the larger original is kept, and only the copies go in the album
+func TestPhotoDuplicatesTool_ScanAndAlbum(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC)
+	pattern := stripesJPEG(t, 64, 48, 7)
+	other := stripesJPEG(t, 64, 48, 20)
+	add := func(name string, created time.Time, w, h int, data []byte) string {
+		return g.AddMedia(testkit.MediaItem{Filename: name, Created: created, Width: w, Height: h, Data: data})
+	}
+	add("IMG_0001.jpg", day, 4032, 3024, other)
+	nameCopy := add("IMG_0001 (1).jpg", day.Add(time.Hour), 4032, 3024, other)
+	add("IMG_0002.jpg", day.Add(2*time.Hour), 4032, 3024, pattern)
+	burst := add("IMG_0003.jpg", day.Add(2*time.Hour+time.Second), 4032, 3024, pattern)
+	resized := add("IMG-20260502-WA0007.jpg", day.Add(5*time.Hour), 1600, 1200, pattern)
+	add("IMG_0004.jpg", day.Add(6*time.Hour), 3024, 4032, stripesJPEG(t, 48, 64, 3))
+
+	tool := NewPhotoDuplicatesTool(NewGooglePhotosClient(testkit.Token), nil)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "scan", "from": "2026-05-02", "to": "2026-05-02"})
+	if result.IsError {
+		t.Fatalf("scan failed: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "2 group(s)") || strings.Contains(result.ForLLM, "WA0007") {
+		t.Errorf("scan without images should find the name copy and the burst only:\n%s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "keep IMG_0001.jpg") || !strings.Contains(result.ForLLM, "remove IMG_0001 (1).jpg") {
+		t.Errorf("the copy suffix should decide between equal photos:\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "scan", "from": "2026-05-02", "to": "2026-05-02", "compare_images": true})
+	if result.IsError {
+		t.Fatalf("scan with images failed: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "look alike") || !strings.Contains(result.ForLLM, "remove IMG-20260502-WA0007.jpg (1600×1200)") || strings.Contains(result.ForLLM, "IMG_0004") {
+		t.Errorf("scan with images should add the resized copy only:\n%s", result.ForLLM)
+	}
+	scanID := strings.Fields(strings.TrimPrefix(result.ForLLM, "Scan "))[0]
+	scanID = strings.TrimSuffix(scanID, ":")
+
+	if r := tool.Execute(WithChat(context.Background(), "telegram", "7"), map[string]interface{}{"action": "album", "scan_id": scanID}); !r.IsError {
+		t.Errorf("another chat must not use the scan")
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"action": "album", "scan_id": scanID})
+	if result.IsError {
+		t.Fatalf("album failed: %s", result.ForLLM)
+	}
+	albums := g.Albums()
+	if len(albums) != 1 || albums[0].Title != "Suspected duplicates 2 May 2026 – 2 May 2026" {
+		t.Fatalf("albums = %+v", albums)
+	}
+	got := map[string]bool{}
+	for _, id := range albums[0].Items {
+		got[id] = true
+	}
+	// The burst pair and the resized copy are one group: IMG_0002 is kept
+	// as the older of the two full size shots
+	if len(got) != 3 || !got[nameCopy] || !got[burst] || !got[resized] {
+		t.Errorf("album items = %v, want %s, %s and %s", albums[0].Items, nameCopy, burst, resized)
+	}
+}
@@ -0,0 +1,404 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/imaging"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	defaultPhotosLimit = 12
+	maxPhotosLimit     = 50
+	// previewTiles bounds how many thumbnails go in a preview collage
+	previewTiles = 12
+	// previewCell is the side of one collage tile in pixels
+	previewCell = 200
+	// previewFetchers bounds concurrent thumbnail downloads
+	previewFetchers = 6
+	// previewTTL is how long collages are kept in the cache
+	previewTTL = 24 * time.Hour
+)
+
+// PhotosTool lists Google Photos albums and finds media by date or
+// content category. Results come with a collage of thumbnails sent to the
+// chat, so the user can see what was found rather than read IDs.
+type PhotosTool struct {
+	photos     *GooglePhotosClient
+	profiles   *profile.Store
+	previewDir string
+	client     *http.Client
+	channel    string
+	chatID     string
+}
+
+// NewPhotosTool creates the tool. Collages are written to previewDir.
+func NewPhotosTool(photos *GooglePhotosClient, profiles *profile.Store, previewDir string) *PhotosTool {
+	return &PhotosTool{
+		photos:     photos,
+		profiles:   profiles,
+		previewDir: previewDir,
+		client:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (t *PhotosTool) Name() string {
+	return "photos"
+}
+
+func (t *PhotosTool) Description() string {
+	return "Browse Google Photos: list albums (optionally matching a title), or find photos and videos by date range or content category (e.g. pets, receipts, beach). A search that finds nothing is retried with nearby dates, the whole month, broader categories and archived items, and says what it tried; one that finds too much is narrowed to the categories in query. Results include links and IDs, and a preview collage of thumbnails is sent to the user unless preview=false. Archived items are left out unless include_archived=true; items in the Locked Folder can never be seen by apps."
+}
+
+func (t *PhotosTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"albums", "search"},
+				"description": "albums lists albums; search finds media",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "albums: words in the album title. search: content categories such as \"dogs\", \"receipts\", \"beach\"; with from, they only narrow a date search that finds too much",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "search: first day, e.g. 2026-05-02, or a span such as \"last week\", \"March\" or \"yesterday\"",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "search: last day (default: the end of from)",
+			},
+			"media_type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"photo", "video", "all"},
+				"description": "search by date: which media (default all)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum results (default %d, at most %d)", defaultPhotosLimit, maxPhotosLimit),
+			},
+			"include_archived": map[string]interface{}{
+				"type":        "boolean",
+				"description": "search: also return items the user archived (default false, as in the Photos app)",
+			},
+			"preview": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Send a collage of thumbnails to the user (default true)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PhotosTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *PhotosTool) profile() profile.Profile {
+	if t.profiles == nil {
+		return profile.Profile{}
+	}
+	return t.profiles.Get(t.channel + ":" + t.chatID)
+}
+
+func (t *PhotosTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	query, _ := args["query"].(string)
+	limit := defaultPhotosLimit
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), maxPhotosLimit)
+	}
+	preview := true
+	if p, ok := args["preview"].(bool); ok {
+		preview = p
+	}
+
+	var text string
+	var thumbs []string
+	switch action {
+	case "albums":
+		albums, err := t.photos.ListAlbums(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list albums: %v", err)).WithError(err)
+		}
+		q := strings.ToLower(strings.TrimSpace(query))
+		var sb strings.Builder
+		n := 0
+		for _, a := range albums {
+			if q != "" && !strings.Contains(strings.ToLower(a.Title), q) {
+				continue
+			}
+			if n == limit {
+				fmt.Fprintf(&sb, "\n(more albums not shown)")
+				break
+			}
+			n++
+			fmt.Fprintf(&sb, "\n%d. %s: %d items %s (id: %s)", n, a.Title, a.Count, a.ProductURL, a.ID)
+			if a.CoverURL != "" {
+				thumbs = append(thumbs, a.CoverURL)
+			}
+		}
+		if n == 0 {
+			return SilentResult("No matching albums.")
+		}
+		text = fmt.Sprintf("%d album(s) (%s):", n, lockedFolderNote) + sb.String()
+	case "search":
+		prof := t.profile()
+		search, err := parsePhotoSearch(prof, args, query)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		items, note, err := refinePhotoSearch(ctx, t.photos, search, limit, prof.FormatLocale())
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("photo search failed: %v", err)).WithError(err)
+		}
+		archived, _ := args["include_archived"].(bool)
+		if len(items) == 0 {
+			return SilentResult(strings.TrimSpace("No matching photos or videos. " + note + " " + photosScopeNote(archived)))
+		}
+		loc := prof.Location()
+		var sb strings.Builder
+		if note != "" {
+			sb.WriteString(note + "\n")
+		}
+		fmt.Fprintf(&sb, "%d item(s) (%s):", len(items), photosScopeNote(archived))
+		for i, item := range items {
+			fmt.Fprintf(&sb, "\n%d. %s, %s", i+1, item.Filename, item.Created.In(loc).Format("Mon 2 Jan 2006 15:04"))
+			if item.Camera != "" {
+				fmt.Fprintf(&sb, ", %s", item.Camera)
+			}
+			fmt.Fprintf(&sb, " %s (id: %s)", item.ProductURL, item.ID)
+			if item.BaseURL != "" {
+				thumbs = append(thumbs, item.BaseURL)
+			}
+		}
+		text = sb.String()
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+
+	if !preview || len(thumbs) == 0 {
+		return SilentResult(text)
+	}
+	path, shown, err := t.writePreview(ctx, thumbs)
+	if err != nil || shown == 0 {
+		// The listing is still useful without pictures
+		return SilentResult(text)
+	}
+	return &ToolResult{
+		ForLLM: text + fmt.Sprintf("\n\nA collage of the first %d was sent to the user, in this order.", shown),
+		Media:  []string{path},
+	}
+}
+
+// lockedFolderNote explains results that seem to miss items: the Library
+// API never exposes the Locked Folder.
+const lockedFolderNote = "items in the Locked Folder are never visible to apps"
+
+// photosScopeNote says what a search covered, so the model can explain
+// why an item the user remembers is missing.
+func photosScopeNote(includeArchived bool) string {
+	if includeArchived {
+		return "archived items included; " + lockedFolderNote
+	}
+	return "archived items left out, search again with include_archived=true to add them; " + lockedFolderNote
+}
+
+// photosArgError is a problem with the arguments rather than the API.
+type photosArgError string
+
+func (e photosArgError) Error() string { return string(e) }
+
+// searchPhotos finds media by the from/to dates in args, read in the
+// user's timezone and locale, or else by the categories query names.
+func searchPhotos(ctx context.Context, photos *GooglePhotosClient, prof profile.Profile, args map[string]interface{}, query string, limit int) ([]PhotoItem, error) {
+	search, err := parsePhotoSearch(prof, args, query)
+	if err != nil {
+		return nil, err
+	}
+	return search.run(ctx, photos, limit)
+}
+
+// photoSearch is one search of the library: by dates when byDate is set,
+// else by categories.
+type photoSearch struct {
+	byDate     bool
+	from, to   time.Time // days, to inclusive
+	mediaType  string
+	categories []string
+	archived   bool
+	// named are the categories the query names in a date search, which
+	// only narrow it when it finds too much
+	named []string
+}
+
+func parsePhotoSearch(prof profile.Profile, args map[string]interface{}, query string) (photoSearch, error) {
+	search := photoSearch{mediaType: "ALL_MEDIA"}
+	search.archived, _ = args["include_archived"].(bool)
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if c, ok := photoCategories[word]; ok && !seen[c] {
+			seen[c] = true
+			search.categories = append(search.categories, c)
+		}
+	}
+	fromStr, _ := args["from"].(string)
+	if fromStr == "" {
+		if len(search.categories) == 0 {
+			return search, photosArgError("give from/to dates, or a query naming a category such as pets, food, receipts, beach, travel")
+		}
+		return search, nil
+	}
+
+	now := time.Now().In(prof.Location())
+	from, end, err := when.Range(fromStr, now, prof.Locale)
+	if err != nil {
+		return search, photosArgError("from: " + err.Error())
+	}
+	if toStr, _ := args["to"].(string); toStr != "" {
+		if _, end, err = when.Range(toStr, now, prof.Locale); err != nil {
+			return search, photosArgError("to: " + err.Error())
+		}
+	}
+	// SearchMedia takes the last day itself
+	search.byDate, search.from, search.to = true, from, end.Add(-time.Nanosecond)
+	if search.to.Before(from) {
+		return search, photosArgError("to must be on or after from")
+	}
+	switch args["media_type"] {
+	case "photo":
+		search.mediaType = "PHOTO"
+	case "video":
+		search.mediaType = "VIDEO"
+	}
+	search.named, search.categories = search.categories, nil
+	return search, nil
+}
+
+func (s photoSearch) run(ctx context.Context, photos *GooglePhotosClient, limit int) ([]PhotoItem, error) {
+	if !s.byDate {
+		return photos.SearchCategories(ctx, s.categories, s.archived, limit)
+	}
+	return photos.SearchMediaIn(ctx, s.from, s.to, []string{s.mediaType}, s.categories, s.archived, limit)
+}
+
+// writePreview fetches up to previewTiles thumbnails concurrently and
+// saves them as one collage in their order. It returns the file and how
+// many tiles it holds; thumbnails that fail to load are left out.
+func (t *PhotosTool) writePreview(ctx context.Context, baseURLs []string) (string, int, error) {
+	if len(baseURLs) > previewTiles {
+		baseURLs = baseURLs[:previewTiles]
+	}
+	images := make([]image.Image, len(baseURLs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, previewFetchers)
+	for i, u := range baseURLs {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			images[i], _ = t.fetchThumbnail(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	var tiles []image.Image
+	for _, img := range images {
+		if img != nil {
+			tiles = append(tiles, img)
+		}
+	}
+	if len(tiles) == 0 {
+		return "", 0, nil
+	}
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, collage(tiles, previewCell), imaging.ThumbnailQuality); err != nil {
+		return "", 0, err
+	}
+	path, err := savePreview(t.previewDir, "photos", ".jpg", buf.Bytes())
+	return path, len(tiles), err
+}
+
+// savePreview writes an image made to show the user to a new file in dir,
+// clearing out ones older than previewTTL.
+func savePreview(dir, prefix, ext string, data []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	prunePreviews(dir, time.Now().Add(-previewTTL))
+	id := make([]byte, 6)
+	rand.Read(id)
+	path := filepath.Join(dir, prefix+"-"+hex.EncodeToString(id)+ext)
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// fetchThumbnail downloads a square crop of a media item; Photos scales
+// it server side from the base URL parameters.
+func (t *PhotosTool) fetchThumbnail(ctx context.Context, baseURL string) (image.Image, error) {
+	if err := egress.CheckDownloadURL(baseURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s=w%d-h%d-c", baseURL, previewCell, previewCell), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("thumbnail failed (%d)", resp.StatusCode)
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, 4<<20))
+	return img, err
+}
+
+// collage lays tiles out in a grid of cell-sized squares, up to four per
+// row, each scaled to fit and centered.
+func collage(tiles []image.Image, cell int) image.Image {
+	cols := min(len(tiles), 4)
+	rows := (len(tiles) + cols - 1) / cols
+	const gap = 4
+	out := image.NewRGBA(image.Rect(0, 0, cols*cell+(cols-1)*gap, rows*cell+(rows-1)*gap))
+	draw.Draw(out, out.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, tile := range tiles {
+		thumb := imaging.Thumbnail(tile, cell)
+		b := thumb.Bounds()
+		x := (i%cols)*(cell+gap) + (cell-b.Dx())/2
+		y := (i/cols)*(cell+gap) + (cell-b.Dy())/2
+		draw.Draw(out, image.Rect(x, y, x+b.Dx(), y+b.Dy()), thumb, b.Min, draw.Src)
+	}
+	return out
+}
+
+// prunePreviews removes collages older than cutoff.
+func prunePreviews(dir string, cutoff time.Time) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+func testJPEG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestPhotosTool_SearchAndAlbumsAttachCollage verifies listings fetch thumbnails and attach one collage in result order
+func TestPhotosTool_SearchAndAlbumsAttachCollage(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC)
+	var ids []string
+	for i, c := range []color.Color{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{255, 255, 0, 255}, color.RGBA{0, 255, 255, 255}} {
+		ids = append(ids, g.AddMedia(testkit.MediaItem{
+			Filename:    "IMG_" + string(rune('A'+i)) + ".jpg",
+			MimeType:    "image/jpeg",
+			Created:     day.Add(time.Duration(i) * time.Hour),
+			Data:        testJPEG(t, c),
+			CameraMake:  "Pixel",
+			CameraModel: "8",
+		}))
+	}
+	g.AddAlbum("Beach day", ids[:2]...)
+	g.AddAlbum("Paperwork")
+
+	dir := t.TempDir()
+	tool := NewPhotosTool(NewGooglePhotosClient(testkit.Token), nil, dir)
+	result := tool.Execute(context.Background(), map[string]interface{}{"action": "search", "from": "2026-05-02"})
+	if result.IsError || !strings.Contains(result.ForLLM, "5 item(s)") || !strings.Contains(result.ForLLM, "IMG_A.jpg") {
+		t.Fatalf("unexpected search result: %s", result.ForLLM)
+	}
+	if len(result.Media) != 1 {
+		t.Fatalf("expected one collage, got %v", result.Media)
+	}
+	f, err := os.Open(result.Media[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 5 tiles: two rows of four columns
+	if cfg.Width != 4*previewCell+3*4 || cfg.Height != 2*previewCell+4 {
+		t.Errorf("collage is %dx%d", cfg.Width, cfg.Height)
+	}
+
+	albums := tool.Execute(context.Background(), map[string]interface{}{"action": "albums", "query": "beach"})
+	if albums.IsError || !strings.Contains(albums.ForLLM, "Beach day: 2 items") || strings.Contains(albums.ForLLM, "Paperwork") {
+		t.Fatalf("unexpected albums result: %s", albums.ForLLM)
+	}
+	if len(albums.Media) != 1 {
+		t.Errorf("expected album cover collage, got %v", albums.Media)
+	}
+
+	plain := tool.Execute(context.Background(), map[string]interface{}{"action": "albums", "preview": false})
+	if len(plain.Media) != 0 || !strings.Contains(plain.ForLLM, "2 album(s)") {
+		t.Errorf("unexpected plain listing: %s %v", plain.ForLLM, plain.Media)
+	}
+}
+
+// TestPhotosTool_ArchivedOnlyWhenAsked verifies archived items are left out by default and the result says how to include them
+func TestPhotosTool_ArchivedOnlyWhenAsked(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC)
+	g.AddMedia(testkit.MediaItem{Filename: "shown.jpg", MimeType: "image/jpeg", Created: day, Categories: []string{"PETS"}})
+	g.AddMedia(testkit.MediaItem{Filename: "archived.jpg", MimeType: "image/jpeg", Created: day, Categories: []string{"PETS"}, Archived: true})
+
+	tool := NewPhotosTool(NewGooglePhotosClient(testkit.Token), nil, t.TempDir())
+	for _, args := range []map[string]interface{}{
+		{"action": "search", "from": "2026-05-02", "preview": false},
+		{"action": "search", "query": "dogs", "preview": false},
+	} {
+		result := tool.Execute(context.Background(), args)
+		if strings.Contains(result.ForLLM, "archived.jpg") || !strings.Contains(result.ForLLM, "include_archived=true") || !strings.Contains(result.ForLLM, "Locked Folder") {
+			t.Errorf("default search: %s", result.ForLLM)
+		}
+		args["include_archived"] = true
+		result = tool.Execute(context.Background(), args)
+		if !strings.Contains(result.ForLLM, "2 item(s)") || !strings.Contains(result.ForLLM, "archived items included") {
+			t.Errorf("search with archived: %s", result.ForLLM)
+		}
+	}
+}
+
+// TestPhotosTool_RefinesSearches verifies a date search that finds nothing widens to nearby days and says what it tried, a category search falls back to broader categories, and a date search that finds too much is narrowed to the categories asked for
+func TestPhotosTool_RefinesSearches(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	day := time.Date(2026, 5, 2, 10, 0, 0, 0, time.Local)
+	g.AddMedia(testkit.MediaItem{Filename: "beach.jpg", MimeType: "image/jpeg", Created: day.AddDate(0, 0, 2), Categories: []string{"TRAVEL"}})
+	g.AddMedia(testkit.MediaItem{Filename: "parrot.jpg", MimeType: "image/jpeg", Created: day.AddDate(0, 0, 20), Categories: []string{"ANIMALS"}})
+	g.AddMedia(testkit.MediaItem{Filename: "lunch.jpg", MimeType: "image/jpeg", Created: day.AddDate(0, 0, 2), Categories: []string{"FOOD"}})
+	tool := NewPhotosTool(NewGooglePhotosClient(testkit.Token), nil, t.TempDir())
+	ctx := context.Background()
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "search", "from": "2026-05-02", "media_type": "photo", "preview": false})
+	if !strings.Contains(r.ForLLM, "Nothing matched as asked, so variations were tried: photos and videos (0), 3 days either side, ") || !strings.Contains(r.ForLLM, "2 item(s)") || !strings.Contains(r.ForLLM, "beach.jpg") {
+		t.Errorf("Expected nearby days tried, got %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "search", "query": "dogs", "preview": false})
+	if !strings.Contains(r.ForLLM, "also animals (1)") || !strings.Contains(r.ForLLM, "parrot.jpg") {
+		t.Errorf("Expected broader categories tried, got %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "search", "from": "2026-05-04", "query": "food", "limit": float64(2), "preview": false})
+	if !strings.Contains(r.ForLLM, "only the ones classified as food are listed") || !strings.Contains(r.ForLLM, "1 item(s)") || strings.Contains(r.ForLLM, "beach.jpg") {
+		t.Errorf("Expected the search narrowed to food, got %s", r.ForLLM)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "search", "from": "2025-01-10", "preview": false})
+	if !strings.HasPrefix(r.ForLLM, "No matching photos or videos. Also tried 3 days either side") || !strings.Contains(r.ForLLM, "archived items too (0)") {
+		t.Errorf("Expected what was tried reported, got %s", r.ForLLM)
+	}
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlanStep is one call of a plan held for the user's approval.
+type PlanStep struct {
+	Tool string
+	Args map[string]interface{}
+}
+
+// Describe names the step for the user: the tool and action, then the
+// short arguments that say what it changes, e.g. "calendar create (title:
+// Dentist, start: 2026-05-02 10:00)".
+func (s PlanStep) Describe() string {
+	name := s.Tool
+	if action, _ := s.Args["action"].(string); action != "" {
+		name += " " + action
+	}
+	keys := make([]string, 0, len(s.Args))
+	for key := range s.Args {
+		if key != "action" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var details []string
+	for _, key := range keys {
+		var value string
+		switch v := s.Args[key].(type) {
+		case string:
+			value = v
+		case float64, bool:
+			value = fmt.Sprint(v)
+		default:
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+		if value = strings.Join(strings.Fields(value), " "); value == "" {
+			continue
+		}
+		if r := []rune(value); len(r) > 40 {
+			value = string(r[:40]) + "…"
+		}
+		details = append(details, key+": "+value)
+	}
+	if len(details) == 0 {
+		return name
+	}
+	return name + " (" + strings.Join(details, ", ") + ")"
+}
+
+// Plans holds, per chat, the changes the model asked for in one go until
+// the user approves them as a plan, and lets the user stop a plan while it
+// runs. The user's next message answers a held plan: a yes hands it over
+// to run, anything else drops it.
+type Plans struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*heldPlan
+	// running is set per chat while a plan runs, to true once the user
+	// asked to stop it
+	running map[string]bool
+}
+
+type heldPlan struct {
+	steps   []PlanStep
+	expires time.Time
+}
+
+func NewPlans() *Plans {
+	return &Plans{now: time.Now, pending: map[string]*heldPlan{}, running: map[string]bool{}}
+}
+
+// Hold keeps steps as the plan waiting for the user in chat, replacing any
+// earlier one, and returns it numbered for the user.
+func (p *Plans) Hold(chat string, steps []PlanStep) string {
+	p.mu.Lock()
+	p.pending[chat] = &heldPlan{steps: steps, expires: p.now().Add(confirmationWindow)}
+	p.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("📋 Plan:")
+	for i, step := range steps {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, step.Describe())
+	}
+	sb.WriteString("\n\nReply yes to run it step by step (say stop to abort while it runs), or anything else to drop it.")
+	return sb.String()
+}
+
+// Answer takes a user's message in chat as the reply to the plan waiting
+// there. It reports whether a plan was waiting, and returns its steps when
+// the reply was a yes; the plan is then counted as running until Finish.
+func (p *Plans) Answer(chat, reply string) ([]PlanStep, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.pending[chat]
+	if !ok {
+		return nil, false
+	}
+	delete(p.pending, chat)
+	if !p.now().Before(plan.expires) {
+		return nil, false
+	}
+	if !isAffirmative(reply) {
+		return nil, true
+	}
+	p.running[chat] = false
+	return plan.steps, true
+}
+
+// Stop takes a user's message in chat as a request to stop the plan
+// running there, and reports whether it was one. The step under way
+// finishes; the rest are skipped.
+func (p *Plans) Stop(chat, message string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.running[chat]; !ok || !isStop(message) {
+		return false
+	}
+	p.running[chat] = true
+	return true
+}
+
+// Stopped reports whether the user asked to stop the plan running in chat.
+func (p *Plans) Stopped(chat string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running[chat]
+}
+
+// Finish marks the plan in chat as no longer running.
+func (p *Plans) Finish(chat string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.running, chat)
+}
+
+// isStop recognizes a request to stop, in the languages isAffirmative
+// knows.
+func isStop(message string) bool {
+	message = strings.ToLower(strings.Trim(strings.TrimSpace(message), ".!✋🛑 /"))
+	switch message {
+	case "stop", "abort", "cancel", "halt", "stop it", "stop the plan",
+		"para", "parar", "pare", "cancelar", "detente", "arrête", "stopp", "停", "停止", "取消":
+		return true
+	}
+	return false
+}
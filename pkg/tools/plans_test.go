@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+)
+
+// TestPlans_StopOnlyWhileRunning verifies a stop counts only for a plan that is running, and a plan is answered once
+func TestPlans_StopOnlyWhileRunning(t *testing.T) {
+	plans := NewPlans()
+	steps := []PlanStep{{Tool: "calendar", Args: map[string]interface{}{"action": "delete", "event_id": "e1"}}}
+	plans.Hold("telegram:1", steps)
+	if plans.Stop("telegram:1", "stop") {
+		t.Error("Expected a stop to mean nothing before the plan runs")
+	}
+	got, ok := plans.Answer("telegram:1", "Yes!")
+	if !ok || len(got) != 1 {
+		t.Fatalf("Answer() = %v, %v", got, ok)
+	}
+	if _, ok := plans.Answer("telegram:1", "yes"); ok {
+		t.Error("Expected the plan answered only once")
+	}
+	if plans.Stop("telegram:1", "stop please") || plans.Stopped("telegram:1") {
+		t.Error("Expected only a plain stop to count")
+	}
+	if !plans.Stop("telegram:1", "/stop") || !plans.Stopped("telegram:1") {
+		t.Error("Expected the running plan stopped")
+	}
+	plans.Finish("telegram:1")
+	if plans.Stop("telegram:1", "stop") {
+		t.Error("Expected nothing to stop once the plan finished")
+	}
+}
@@ -0,0 +1,806 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/embeddings"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const (
+	podcastJobKind = "podcast_check"
+	// maxPodcastDownload bounds an episode's audio file
+	maxPodcastDownload = 500 << 20
+	// maxTranscribeUpload is the largest file the transcription API takes;
+	// longer episodes are cut into podcastSegmentSeconds parts with ffmpeg
+	maxTranscribeUpload   = 25 << 20
+	podcastSegmentSeconds = 600
+	// maxNewEpisodes is how many new episodes of a podcast one check
+	// summarizes; older ones are only listed
+	maxNewEpisodes = 2
+	// maxSeenEpisodes bounds the episode IDs kept per subscription
+	maxSeenEpisodes = 300
+)
+
+// Transcriber turns an audio file into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioFilePath string) (*voice.TranscriptionResponse, error)
+}
+
+// podcastEpisode is an episode as its feed lists it.
+type podcastEpisode struct {
+	ID        string
+	Title     string
+	AudioURL  string
+	Published time.Time
+	Duration  string
+}
+
+// podcastSubscription is a podcast a chat follows; Seen holds the IDs of
+// the episodes already out when they were last checked.
+type podcastSubscription struct {
+	URL   string   `json:"url"`
+	Title string   `json:"title"`
+	Seen  []string `json:"seen"`
+}
+
+type podcastChat struct {
+	JobID string                 `json:"job_id"`
+	Feeds []*podcastSubscription `json:"feeds"`
+}
+
+type podcastState struct {
+	Chats map[string]*podcastChat `json:"chats"`
+}
+
+// podcastTranscript is an episode's transcript and summaries by length,
+// kept so each episode is downloaded and transcribed once.
+type podcastTranscript struct {
+	Podcast    string            `json:"podcast"`
+	Title      string            `json:"title"`
+	Transcript string            `json:"transcript"`
+	Summaries  map[string]string `json:"summaries,omitempty"`
+	Created    time.Time         `json:"created"`
+}
+
+// PodcastOptions configures the podcast tool.
+type PodcastOptions struct {
+	// Every is how often subscriptions are checked for new episodes
+	Every time.Duration
+}
+
+// PodcastTool follows podcasts per chat. New episodes are downloaded,
+// transcribed and summarized when the chat's check finds them, and any
+// episode can be summarized or asked about; transcripts are kept in
+// workspace/podcasts so that happens once per episode. Episodes too large
+// for the transcription API in one go are cut into parts with ffmpeg.
+type PodcastTool struct {
+	docs        *SummarizeTool
+	ask         *AskFileTool
+	transcriber Transcriber
+	opts        PodcastOptions
+	statePath   string
+	dir         string
+	client      *http.Client
+	scheduler   *cron.CronService
+	mu          sync.Mutex
+	// bin is the ffmpeg executable
+	bin string
+}
+
+// NewPodcastTool creates the tool; provider and model write the summaries
+// and answers.
+func NewPodcastTool(provider providers.LLMProvider, model string, transcriber Transcriber, workspace string, opts PodcastOptions) *PodcastTool {
+	if opts.Every <= 0 {
+		opts.Every = 6 * time.Hour
+	}
+	return &PodcastTool{
+		docs:        NewSummarizeTool(provider, model, workspace, true, nil, nil),
+		ask:         NewAskFileTool(provider, model, workspace, true, nil, nil),
+		transcriber: transcriber,
+		opts:        opts,
+		statePath:   filepath.Join(workspace, "state", "podcasts.json"),
+		dir:         filepath.Join(workspace, "podcasts"),
+		client:      egress.Client(10 * time.Minute),
+		bin:         "ffmpeg",
+	}
+}
+
+// SetEmbedders ranks transcript passages for questions as ask_file does.
+func (t *PodcastTool) SetEmbedders(primary, fallback embeddings.Embedder) {
+	t.ask.SetEmbedders(primary, fallback)
+}
+
+func (t *PodcastTool) Name() string {
+	return "podcasts"
+}
+
+func (t *PodcastTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "episodes", "summarize", "ask")
+}
+
+func (t *PodcastTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "subscribe", "unsubscribe")
+}
+
+func (t *PodcastTool) Description() string {
+	return "Podcasts. subscribe follows a podcast by its RSS feed URL in this chat: each new episode is transcribed and its summary sent here. unsubscribe stops, list shows the podcasts followed. episodes lists a podcast's latest episodes, numbered from 1 for the newest. summarize summarizes an episode (default the newest) and ask answers a question about one from its transcript, e.g. \"what did they say about interest rates in the last Planet Money?\". A podcast is named by its title (or words from it) or feed URL, an episode by its number or words from its title. Transcribing an episode for the first time takes a few minutes."
+}
+
+func (t *PodcastTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"subscribe", "unsubscribe", "list", "episodes", "summarize", "ask"},
+				"description": "Action to perform",
+			},
+			"podcast": map[string]interface{}{
+				"type":        "string",
+				"description": "The podcast: its feed URL (required for subscribe, and usable with any action) or title",
+			},
+			"episode": map[string]interface{}{
+				"type":        "string",
+				"description": "summarize/ask: the episode's number in episodes (1 = newest, the default) or words from its title",
+			},
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "ask: what to find out from the episode",
+			},
+			"length": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"short", "medium", "detailed"},
+				"description": "summarize: summary length (default medium)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PodcastTool) JobKinds() []string {
+	return []string{podcastJobKind}
+}
+
+func (t *PodcastTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *PodcastTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	podcast, _ := args["podcast"].(string)
+	podcast = strings.TrimSpace(podcast)
+	switch action {
+	case "subscribe", "unsubscribe":
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		if podcast == "" {
+			return ErrorResult("podcast is required")
+		}
+		if action == "unsubscribe" {
+			return t.unsubscribe(chatKey, podcast)
+		}
+		return t.subscribe(ctx, channel, chatID, podcast)
+	case "list":
+		return t.list(chatKey)
+	case "episodes", "summarize", "ask":
+		feedURL, err := t.feedURL(chatKey, podcast)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		title, episodes, err := t.fetch(ctx, feedURL)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read the podcast feed: %v", err)).WithError(err)
+		}
+		if action == "episodes" {
+			return SilentResult(t.describeEpisodes(feedURL, title, episodes))
+		}
+		episodeArg, _ := args["episode"].(string)
+		ep, err := pickEpisode(episodes, episodeArg)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if action == "summarize" {
+			length, _ := args["length"].(string)
+			if length == "" {
+				length = "medium"
+			}
+			summary, err := t.summary(ctx, feedURL, title, ep, length)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("failed to summarize the episode: %v", err)).WithError(err)
+			}
+			return NewToolResult(fmt.Sprintf("Summary of %s: %s:\n\n%s", title, ep.Title, summary))
+		}
+		question, _ := args["question"].(string)
+		if question = strings.TrimSpace(question); question == "" {
+			return ErrorResult("question is required")
+		}
+		return t.answer(ctx, feedURL, title, ep, question)
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *PodcastTool) subscribe(ctx context.Context, channel, chatID, feedURL string) *ToolResult {
+	if !strings.HasPrefix(feedURL, "http://") && !strings.HasPrefix(feedURL, "https://") {
+		return ErrorResult("subscribe needs the podcast's RSS feed URL")
+	}
+	if t.scheduler == nil {
+		return ErrorResult("podcast subscriptions are not available (scheduler not running)")
+	}
+	title, episodes, err := t.fetch(ctx, feedURL)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the podcast feed: %v", err)).WithError(err)
+	}
+	chatKey := channel + ":" + chatID
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	c := state.Chats[chatKey]
+	if c == nil {
+		c = &podcastChat{}
+		state.Chats[chatKey] = c
+	}
+	for _, f := range c.Feeds {
+		if f.URL == feedURL {
+			return SilentResult(fmt.Sprintf("Already subscribed to %s in this chat.", f.Title))
+		}
+	}
+	if c.JobID == "" {
+		everyMS := t.opts.Every.Milliseconds()
+		job, err := t.scheduler.AddJobWithPayload("New podcast episodes", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    podcastJobKind,
+			Message: "New podcast episodes",
+			Channel: channel,
+			To:      chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("could not schedule the checks: %v", err)).WithError(err)
+		}
+		c.JobID = job.ID
+	}
+	sub := &podcastSubscription{URL: feedURL, Title: title}
+	for _, ep := range episodes {
+		sub.Seen = append(sub.Seen, ep.ID)
+	}
+	c.Feeds = append(c.Feeds, sub)
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	out := fmt.Sprintf("Subscribed to %s (%d episodes out). New episodes are checked for every %s and their summaries sent here.", title, len(episodes), formatETA(t.opts.Every))
+	if len(episodes) > 0 {
+		out += fmt.Sprintf(" The latest is %q; ask to summarize it if you want it now.", episodes[0].Title)
+	}
+	return SilentResult(out)
+}
+
+func (t *PodcastTool) unsubscribe(chatKey, podcast string) *ToolResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	c := state.Chats[chatKey]
+	sub := c.find(podcast)
+	if sub == nil {
+		return ErrorResult(fmt.Sprintf("not subscribed to a podcast matching %q in this chat", podcast))
+	}
+	c.Feeds = slices.DeleteFunc(c.Feeds, func(f *podcastSubscription) bool { return f == sub })
+	if len(c.Feeds) == 0 {
+		if t.scheduler != nil {
+			t.scheduler.RemoveJob(c.JobID)
+		}
+		delete(state.Chats, chatKey)
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return SilentResult(fmt.Sprintf("Unsubscribed from %s.", sub.Title))
+}
+
+func (t *PodcastTool) list(chatKey string) *ToolResult {
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	c := state.Chats[chatKey]
+	if c == nil || len(c.Feeds) == 0 {
+		return SilentResult("No podcast subscriptions in this chat.")
+	}
+	var sb strings.Builder
+	sb.WriteString("Podcasts followed in this chat:")
+	for _, f := range c.Feeds {
+		fmt.Fprintf(&sb, "\n- %s (%s)", f.Title, f.URL)
+	}
+	return SilentResult(sb.String())
+}
+
+// find returns the chat's subscription whose URL is podcast or whose
+// title contains it, or nil.
+func (c *podcastChat) find(podcast string) *podcastSubscription {
+	if c == nil {
+		return nil
+	}
+	for _, f := range c.Feeds {
+		if f.URL == podcast {
+			return f
+		}
+	}
+	for _, f := range c.Feeds {
+		if strings.Contains(strings.ToLower(f.Title), strings.ToLower(podcast)) {
+			return f
+		}
+	}
+	return nil
+}
+
+// feedURL resolves podcast, a feed URL or the title of one the chat
+// follows; empty is the chat's only subscription.
+func (t *PodcastTool) feedURL(chatKey, podcast string) (string, error) {
+	if strings.HasPrefix(podcast, "http://") || strings.HasPrefix(podcast, "https://") {
+		return podcast, nil
+	}
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	c := state.Chats[chatKey]
+	if podcast == "" {
+		if c != nil && len(c.Feeds) == 1 {
+			return c.Feeds[0].URL, nil
+		}
+		return "", fmt.Errorf("podcast is required: a feed URL or the title of a podcast followed in this chat")
+	}
+	if sub := c.find(podcast); sub != nil {
+		return sub.URL, nil
+	}
+	return "", fmt.Errorf("no podcast matching %q is followed in this chat; give its feed URL", podcast)
+}
+
+// podcastFeedXML is the part of a podcast RSS feed that is read.
+type podcastFeedXML struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title     string `xml:"title"`
+			GUID      string `xml:"guid"`
+			PubDate   string `xml:"pubDate"`
+			Duration  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// fetch reads a feed's title and its episodes with audio, newest first.
+func (t *PodcastTool) fetch(ctx context.Context, feedURL string) (string, []podcastEpisode, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("feed %s returned %d", feedURL, resp.StatusCode)
+	}
+	var doc podcastFeedXML
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 20<<20)).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("failed to parse feed %s: %w", feedURL, err)
+	}
+	var episodes []podcastEpisode
+	for _, item := range doc.Channel.Items {
+		audio := strings.TrimSpace(item.Enclosure.URL)
+		if audio == "" {
+			continue
+		}
+		id := strings.TrimSpace(item.GUID)
+		if id == "" {
+			id = audio
+		}
+		episodes = append(episodes, podcastEpisode{
+			ID:        id,
+			Title:     strings.TrimSpace(item.Title),
+			AudioURL:  audio,
+			Published: parseFeedTime(item.PubDate),
+			Duration:  strings.TrimSpace(item.Duration),
+		})
+	}
+	sort.SliceStable(episodes, func(i, j int) bool { return episodes[i].Published.After(episodes[j].Published) })
+	title := strings.TrimSpace(doc.Channel.Title)
+	if title == "" {
+		title = feedURL
+	}
+	return title, episodes, nil
+}
+
+func (t *PodcastTool) describeEpisodes(feedURL, title string, episodes []podcastEpisode) string {
+	if len(episodes) == 0 {
+		return fmt.Sprintf("%s has no episodes with audio.", title)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Latest episodes of %s (✓ transcribed):", title)
+	for i, ep := range episodes[:min(len(episodes), 10)] {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, ep.Title)
+		if !ep.Published.IsZero() {
+			fmt.Fprintf(&sb, " (%s", ep.Published.Format("2006-01-02"))
+			if ep.Duration != "" {
+				fmt.Fprintf(&sb, ", %s", ep.Duration)
+			}
+			sb.WriteString(")")
+		}
+		if _, err := os.Stat(t.transcriptPath(feedURL, ep)); err == nil {
+			sb.WriteString(" ✓")
+		}
+	}
+	return sb.String()
+}
+
+// pickEpisode returns the episode numbered episode (1 = newest) or with
+// the words of episode in its title; the newest when it is empty.
+func pickEpisode(episodes []podcastEpisode, episode string) (podcastEpisode, error) {
+	if len(episodes) == 0 {
+		return podcastEpisode{}, fmt.Errorf("the podcast has no episodes with audio")
+	}
+	episode = strings.TrimSpace(episode)
+	if episode == "" {
+		return episodes[0], nil
+	}
+	if n, err := strconv.Atoi(episode); err == nil {
+		if n < 1 || n > len(episodes) {
+			return podcastEpisode{}, fmt.Errorf("episode must be between 1 and %d", len(episodes))
+		}
+		return episodes[n-1], nil
+	}
+	words := strings.Fields(strings.ToLower(episode))
+	for _, ep := range episodes {
+		title := strings.ToLower(ep.Title)
+		matched := true
+		for _, w := range words {
+			if !strings.Contains(title, w) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return ep, nil
+		}
+	}
+	return podcastEpisode{}, fmt.Errorf("no episode matching %q", episode)
+}
+
+func (t *PodcastTool) transcriptPath(feedURL string, ep podcastEpisode) string {
+	sum := sha256.Sum256([]byte(feedURL + "\n" + ep.ID))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:12])+".json")
+}
+
+// transcript returns the episode's transcript, downloading and
+// transcribing it the first time.
+func (t *PodcastTool) transcript(ctx context.Context, feedURL, podcast string, ep podcastEpisode) (*podcastTranscript, error) {
+	path := t.transcriptPath(feedURL, ep)
+	if data, err := os.ReadFile(path); err == nil {
+		var cached podcastTranscript
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return &cached, nil
+		}
+	}
+	if t.transcriber == nil {
+		return nil, fmt.Errorf("transcription needs a Groq API key (providers.groq.api_key)")
+	}
+	audio, err := t.download(ctx, ep.AudioURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the episode: %w", err)
+	}
+	defer os.Remove(audio)
+	text, err := t.transcribe(ctx, audio)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("the episode has no speech to transcribe")
+	}
+	tr := &podcastTranscript{Podcast: podcast, Title: ep.Title, Transcript: text, Created: time.Now()}
+	if err := saveJSONAtomic(path, tr); err != nil {
+		logger.WarnCF("podcasts", "Failed to keep the transcript", map[string]interface{}{"episode": ep.Title, "error": err.Error()})
+	}
+	return tr, nil
+}
+
+func (t *PodcastTool) download(ctx context.Context, audioURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, audioURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %d", audioURL, resp.StatusCode)
+	}
+	ext := filepath.Ext(strings.SplitN(filepath.Base(audioURL), "?", 2)[0])
+	if ext == "" || len(ext) > 5 {
+		ext = ".mp3"
+	}
+	f, err := os.CreateTemp("", "picoclaw-podcast-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxPodcastDownload+1))
+	if err == nil && n > maxPodcastDownload {
+		err = fmt.Errorf("the episode is larger than %d MB", maxPodcastDownload>>20)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// transcribe turns the audio into text, in parts cut with ffmpeg when it
+// is installed, which also makes them small enough to upload; without it
+// only files the API takes in one go can be transcribed.
+func (t *PodcastTool) transcribe(ctx context.Context, audio string) (string, error) {
+	parts := []string{audio}
+	if _, err := exec.LookPath(t.bin); err == nil {
+		dir, err := os.MkdirTemp("", "picoclaw-podcast-parts-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		cmd := exec.CommandContext(ctx, t.bin, "-y", "-loglevel", "error", "-i", audio,
+			"-vn", "-ac", "1", "-ar", "16000", "-b:a", "32k",
+			"-f", "segment", "-segment_time", strconv.Itoa(podcastSegmentSeconds), filepath.Join(dir, "part%03d.mp3"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		if parts, _ = filepath.Glob(filepath.Join(dir, "part*.mp3")); len(parts) == 0 {
+			return "", fmt.Errorf("ffmpeg found no audio in the episode")
+		}
+		sort.Strings(parts)
+	} else if info, err := os.Stat(audio); err != nil {
+		return "", err
+	} else if info.Size() > maxTranscribeUpload {
+		return "", fmt.Errorf("the episode is larger than %d MB, which needs ffmpeg to be cut into parts and it is not installed on this device", maxTranscribeUpload>>20)
+	}
+	texts := make([]string, 0, len(parts))
+	for i, part := range parts {
+		resp, err := t.transcriber.Transcribe(ctx, part)
+		if err != nil {
+			return "", fmt.Errorf("transcription of part %d/%d failed: %w", i+1, len(parts), err)
+		}
+		texts = append(texts, strings.TrimSpace(resp.Text))
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// summary returns the episode's summary of length, written once per
+// episode and length.
+func (t *PodcastTool) summary(ctx context.Context, feedURL, podcast string, ep podcastEpisode, length string) (string, error) {
+	tr, err := t.transcript(ctx, feedURL, podcast, ep)
+	if err != nil {
+		return "", err
+	}
+	if s := tr.Summaries[length]; s != "" {
+		return s, nil
+	}
+	text := tr.Transcript
+	if len(text) > maxSummaryInputChars {
+		text = text[:maxSummaryInputChars]
+	}
+	s, _, err := t.docs.summarize(ctx, &extractedDocument{Title: podcast + ": " + ep.Title + " (podcast transcript)", Text: text}, "", length)
+	if err != nil {
+		return "", err
+	}
+	if tr.Summaries == nil {
+		tr.Summaries = make(map[string]string)
+	}
+	tr.Summaries[length] = s
+	if err := saveJSONAtomic(t.transcriptPath(feedURL, ep), tr); err != nil {
+		logger.WarnCF("podcasts", "Failed to keep the summary", map[string]interface{}{"episode": ep.Title, "error": err.Error()})
+	}
+	return s, nil
+}
+
+// answer answers question from the passages of the episode's transcript
+// closest to it, as ask_file does for documents.
+func (t *PodcastTool) answer(ctx context.Context, feedURL, podcast string, ep podcastEpisode, question string) *ToolResult {
+	tr, err := t.transcript(ctx, feedURL, podcast, ep)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to transcribe the episode: %v", err)).WithError(err)
+	}
+	text, truncated := tr.Transcript, false
+	if len(text) > maxSummaryInputChars {
+		text, truncated = text[:maxSummaryInputChars], true
+	}
+	title := podcast + ": " + ep.Title
+	passages := splitForSummary(text, askPassageChars)
+	picked, err := t.ask.pick(ctx, question, passages)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to rank passages: %v", err)).WithError(err)
+	}
+	answer, err := t.ask.answer(ctx, title+" (podcast transcript)", question, passages, picked)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("answering failed: %v", err)).WithError(err)
+	}
+	return NewToolResult(formatAnswer(title, answer, passages, picked, truncated))
+}
+
+// ExecuteJob implements ScheduledTool. It looks for new episodes of the
+// chat's podcasts and returns their summaries.
+func (t *PodcastTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	chatKey := job.Payload.Channel + ":" + job.Payload.To
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	c := state.Chats[chatKey]
+	if c == nil {
+		return "", nil
+	}
+	var reports []string
+	seen := make(map[string][]string)
+	for _, sub := range c.Feeds {
+		title, episodes, err := t.fetch(ctx, sub.URL)
+		if err != nil {
+			logger.WarnCF("podcasts", "Failed to check a podcast", map[string]interface{}{"podcast": sub.Title, "error": err.Error()})
+			continue
+		}
+		known := make(map[string]bool, len(sub.Seen))
+		for _, id := range sub.Seen {
+			known[id] = true
+		}
+		var fresh []podcastEpisode
+		for _, ep := range episodes {
+			if !known[ep.ID] {
+				fresh = append(fresh, ep)
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		for i, ep := range fresh {
+			if i >= maxNewEpisodes {
+				reports = append(reports, fmt.Sprintf("🎙️ Also new in %s: %s", title, ep.Title))
+				continue
+			}
+			// Transcribing takes long, so the lock is not held meanwhile
+			summary, err := t.summary(ctx, sub.URL, title, ep, "medium")
+			if err != nil {
+				logger.WarnCF("podcasts", "Failed to summarize a new episode", map[string]interface{}{"episode": ep.Title, "error": err.Error()})
+				reports = append(reports, fmt.Sprintf("🎙️ New episode of %s: %s (it could not be summarized: %v)", title, ep.Title, err))
+				continue
+			}
+			reports = append(reports, fmt.Sprintf("🎙️ New episode of %s: %s\n\n%s", title, ep.Title, summary))
+		}
+		ids := make([]string, 0, len(episodes))
+		for _, ep := range episodes {
+			ids = append(ids, ep.ID)
+		}
+		seen[sub.URL] = ids
+	}
+	if len(seen) > 0 {
+		// Subscriptions may have changed while episodes were transcribed
+		t.mu.Lock()
+		if state, err = t.loadState(); err == nil && state.Chats[chatKey] != nil {
+			for _, sub := range state.Chats[chatKey].Feeds {
+				if ids, ok := seen[sub.URL]; ok {
+					sub.Seen = mergeSeen(ids, sub.Seen)
+				}
+			}
+			err = saveJSONAtomic(t.statePath, state)
+		}
+		t.mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(reports, "\n\n"), nil
+}
+
+// mergeSeen adds the episode IDs of the feed now to those seen before,
+// newest first, keeping maxSeenEpisodes.
+func mergeSeen(now, before []string) []string {
+	merged := append([]string(nil), now...)
+	in := make(map[string]bool, len(now))
+	for _, id := range now {
+		in[id] = true
+	}
+	for _, id := range before {
+		if !in[id] {
+			merged = append(merged, id)
+		}
+	}
+	if len(merged) > maxSeenEpisodes {
+		merged = merged[:maxSeenEpisodes]
+	}
+	return merged
+}
+
+// loadState reads the subscriptions; callers hold t.mu.
+func (t *PodcastTool) loadState() (*podcastState, error) {
+	state := &podcastState{}
+	data, err := os.ReadFile(t.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read podcast subscriptions: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse podcast subscriptions: %w", err)
+		}
+	}
+	if state.Chats == nil {
+		state.Chats = make(map[string]*podcastChat)
+	}
+	return state, nil
+}
+
+// ChatData implements ChatDataStore: the chat's subscriptions.
+func (t *PodcastTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if chat := state.Chats[chatKey]; chat != nil {
+		return chat, nil
+	}
+	return nil, nil
+}
+
+// PurgeChat implements ChatDataStore. The check schedule goes with the
+// chat's jobs.
+func (t *PodcastTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return 0, err
+	}
+	chat := state.Chats[chatKey]
+	if chat == nil {
+		return 0, nil
+	}
+	delete(state.Chats, chatKey)
+	return len(chat.Feeds), saveJSONAtomic(t.statePath, state)
+}
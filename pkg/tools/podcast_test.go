@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+type fakeTranscriber struct {
+	calls atomic.Int32
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, audioFilePath string) (*voice.TranscriptionResponse, error) {
+	f.calls.Add(1)
+	data, err := os.ReadFile(audioFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return &voice.TranscriptionResponse{Text: "Transcript of " + string(data)}, nil
+}
+
+// TestPodcastTool_SubscribeSummarizeAndAsk verifies a subscription only reports episodes out after it, summarizes each once from a transcript made once, and answers questions from an episode's transcript
+func TestPodcastTool_SubscribeSummarizeAndAsk(t *testing.T) {
+	var episodes atomic.Int32
+	episodes.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/audio/") {
+			w.Write([]byte("audio " + strings.TrimPrefix(r.URL.Path, "/audio/")))
+			return
+		}
+		items := `<item><title>Ep 1: Rates</title><guid>ep-1</guid><pubDate>Mon, 05 Oct 2026 08:00:00 +0000</pubDate><enclosure url="http://` + r.Host + `/audio/1.mp3" type="audio/mpeg"/></item>`
+		if episodes.Load() == 2 {
+			items = `<item><title>Ep 2: Housing</title><guid>ep-2</guid><pubDate>Mon, 12 Oct 2026 08:00:00 +0000</pubDate><itunes:duration>42:10</itunes:duration><enclosure url="http://` + r.Host + `/audio/2.mp3" type="audio/mpeg"/></item>` + items
+		}
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><title>Money Talk</title>` + items + `</channel></rss>`))
+	}))
+	defer server.Close()
+
+	workspace := t.TempDir()
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	provider := &recordingProvider{}
+	transcriber := &fakeTranscriber{}
+	tool := NewPodcastTool(provider, "test", transcriber, workspace, PodcastOptions{})
+	tool.SetScheduler(cs)
+	// Without ffmpeg the file is sent to the transcriber whole
+	tool.bin = "picoclaw-no-ffmpeg"
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	r := tool.Execute(ctx, map[string]interface{}{"action": "subscribe", "podcast": server.URL + "/feed.xml"})
+	if r.IsError || !strings.Contains(r.ForLLM, "Subscribed to Money Talk") || !strings.Contains(r.ForLLM, `"Ep 1: Rates"`) {
+		t.Fatalf("subscribe: %+v", r)
+	}
+	jobs := cs.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != podcastJobKind {
+		t.Fatalf("Expected one check job, got %+v", jobs)
+	}
+	if out, err := tool.ExecuteJob(context.Background(), &jobs[0]); err != nil || out != "" {
+		t.Fatalf("Expected nothing new yet, got %q, %v", out, err)
+	}
+
+	episodes.Store(2)
+	out, err := tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil || out != "🎙️ New episode of Money Talk: Ep 2: Housing\n\nsummary A" {
+		t.Fatalf("Expected the new episode's summary, got %q, %v", out, err)
+	}
+	if !strings.Contains(provider.inputs[0], "Transcript of audio 2.mp3") {
+		t.Errorf("Expected the transcript summarized, got %q", provider.inputs[0])
+	}
+	if out, _ := tool.ExecuteJob(context.Background(), &jobs[0]); out != "" {
+		t.Errorf("Expected the episode reported once, got %q", out)
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "episodes", "podcast": "money"})
+	if !strings.Contains(r.ForLLM, "1. Ep 2: Housing (2026-10-12, 42:10) ✓") || !strings.Contains(r.ForLLM, "2. Ep 1: Rates (2026-10-05)") || strings.Contains(r.ForLLM, "Rates (2026-10-05) ✓") {
+		t.Errorf("episodes: %s", r.ForLLM)
+	}
+	r = tool.Execute(ctx, map[string]interface{}{"action": "summarize", "podcast": "money", "episode": "housing"})
+	if r.IsError || !strings.HasSuffix(r.ForLLM, "summary A") || len(provider.inputs) != 1 || transcriber.calls.Load() != 1 {
+		t.Errorf("Expected the kept summary, got %+v after %d calls", r, len(provider.inputs))
+	}
+
+	r = tool.Execute(ctx, map[string]interface{}{"action": "ask", "episode": "2", "question": "What about rates?"})
+	if r.IsError || !strings.Contains(r.ForLLM, "Ep 1: Rates") || !strings.Contains(provider.inputs[1], "Transcript of audio 1.mp3") || !strings.Contains(provider.inputs[1], "Question: What about rates?") || transcriber.calls.Load() != 2 {
+		t.Errorf("ask: %+v, inputs %q", r, provider.inputs)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "unsubscribe", "podcast": "Money"}); r.IsError || len(cs.ListJobs(true)) != 0 {
+		t.Errorf("unsubscribe: %+v, jobs %+v", r, cs.ListJobs(true))
+	}
+}
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ToolPolicy limits where a tool can be used and carries its settings.
+// Empty Channels or Users mean no restriction. Users entries match the
+// sender ID or its numeric part ("123|name").
+type ToolPolicy struct {
+	Disabled bool
+	Channels []string
+	Users    []string
+	Settings ToolSettings
+}
+
+// Allows reports whether a message from senderID on channel may use the
+// tool.
+func (p ToolPolicy) Allows(channel, senderID string) bool {
+	if len(p.Channels) > 0 && !containsFold(p.Channels, channel) {
+		return false
+	}
+	if len(p.Users) == 0 {
+		return true
+	}
+	if senderID == "" {
+		return false
+	}
+	idPart := senderID
+	if idx := strings.Index(idPart, "|"); idx > 0 {
+		idPart = idPart[:idx]
+	}
+	for _, u := range p.Users {
+		if u == senderID || u == idPart {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolSettings are the per-tool settings from the config file. Values come
+// from JSON, so numbers are float64; the accessors convert and report a
+// wrong type as an error naming the key.
+type ToolSettings map[string]interface{}
+
+// String returns the string at key, or "" when it is not set.
+func (s ToolSettings) String(key string) (string, error) {
+	v, ok := s[key]
+	if !ok || v == nil {
+		return "", nil
+	}
+	str, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: want a string, got %T", key, v)
+	}
+	return str, nil
+}
+
+// Int returns the whole number at key, or 0 when it is not set.
+func (s ToolSettings) Int(key string) (int, error) {
+	v, ok := s[key]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	switch n := v.(type) {
+	case float64:
+		if n != float64(int(n)) {
+			return 0, fmt.Errorf("%s: want a whole number, got %g", key, n)
+		}
+		return int(n), nil
+	case int:
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s: want a number, got %T", key, v)
+}
+
+// Duration returns the duration at key, written either as a Go duration
+// string ("90s") or as a number of seconds, or 0 when it is not set.
+func (s ToolSettings) Duration(key string) (time.Duration, error) {
+	if str, ok := s[key].(string); ok {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", key, err)
+		}
+		return d, nil
+	}
+	seconds, err := s.Int(key)
+	return time.Duration(seconds) * time.Second, err
+}
+
+type senderKey struct{}
+
+// WithSender records the ID of the user a request comes from, so tool
+// policies restricted to some users can be checked.
+func WithSender(ctx context.Context, senderID string) context.Context {
+	return context.WithValue(ctx, senderKey{}, senderID)
+}
+
+// SenderFromContext returns the sender recorded by WithSender, or "".
+func SenderFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(senderKey{}).(string)
+	return id
+}
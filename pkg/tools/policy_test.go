@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestApplyPolicies_DisablesAndConfigures verifies disabled tools are removed and settings reach the tool
+func TestApplyPolicies_DisablesAndConfigures(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "big.txt"), []byte(strings.Repeat("x", 100)), 0644)
+
+	r := NewToolRegistry()
+	r.Register(NewReadFileTool(workspace, true))
+	r.Register(NewExecTool(workspace, true))
+	r.Register(NewCalculatorTool())
+
+	err := r.ApplyPolicies(map[string]ToolPolicy{
+		"exec":      {Disabled: true},
+		"read_file": {Settings: ToolSettings{"max_bytes": float64(10)}},
+		"calculate": {Settings: ToolSettings{"precision": float64(2)}},
+		"missing":   {Disabled: true},
+	})
+	if err == nil || !strings.Contains(err.Error(), "calculate: tool has no settings") {
+		t.Errorf("expected an error for calculator settings, got %v", err)
+	}
+	if _, ok := r.Get("exec"); ok {
+		t.Error("exec should be removed")
+	}
+	result := r.Execute(context.Background(), "read_file", map[string]interface{}{"path": "big.txt"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "10 byte limit") {
+		t.Errorf("expected the size limit to apply, got %q", result.ForLLM)
+	}
+}
+
+// TestApplyPolicies_LimitsChannelsAndUsers verifies restricted tools are hidden and refused elsewhere
+func TestApplyPolicies_LimitsChannelsAndUsers(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(NewCalculatorTool())
+	r.ApplyPolicies(map[string]ToolPolicy{
+		"calculate": {Channels: []string{"telegram"}, Users: []string{"42"}},
+	})
+
+	if defs := r.ToProviderDefsFor("telegram", "42|alice"); len(defs) != 1 {
+		t.Errorf("owner on telegram should see calculate, got %d tools", len(defs))
+	}
+	if defs := r.ToProviderDefsFor("discord", "42"); len(defs) != 0 {
+		t.Errorf("calculate should be hidden on discord, got %d tools", len(defs))
+	}
+
+	args := map[string]interface{}{"action": "eval", "expression": "1+1"}
+	ctx := WithSender(context.Background(), "7")
+	if result := r.ExecuteWithContext(ctx, "calculate", args, "telegram", "1", nil); !result.IsError {
+		t.Error("calculate should be refused for another user")
+	}
+	ctx = WithSender(context.Background(), "42")
+	if result := r.ExecuteWithContext(ctx, "calculate", args, "telegram", "1", nil); result.IsError {
+		t.Errorf("calculate should run for the allowed user: %s", result.ForLLM)
+	}
+}
+
+// TestToolSettings_ReportsWrongTypes verifies accessors name the key with the wrong type
+func TestToolSettings_ReportsWrongTypes(t *testing.T) {
+	s := ToolSettings{"album": 3.0, "size": "big", "timeout": "90s", "half": 1.5}
+	if _, err := s.String("album"); err == nil || !strings.HasPrefix(err.Error(), "album:") {
+		t.Errorf("String: %v", err)
+	}
+	if _, err := s.Int("size"); err == nil || !strings.HasPrefix(err.Error(), "size:") {
+		t.Errorf("Int: %v", err)
+	}
+	if _, err := s.Int("half"); err == nil {
+		t.Error("Int should refuse fractions")
+	}
+	if d, err := s.Duration("timeout"); err != nil || d.Seconds() != 90 {
+		t.Errorf("Duration = %v, %v", d, err)
+	}
+}
+
+// TestRoles_LimitToolsAndConfirmChanges verifies guests only get their tools, and a trusted user's change runs once they say yes to that exact call
+func TestRoles_LimitToolsAndConfirmChanges(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewToolRegistry()
+	r.Register(NewCalculatorTool())
+	r.Register(NewWriteFileTool(workspace, true))
+	confirmations := NewConfirmations()
+	r.SetRoles(&Roles{
+		Of: func(channel, senderID string) string {
+			if role, ok := map[string]string{"1": RoleOwner, "2": RoleTrusted}[senderID]; ok {
+				return role
+			}
+			return RoleGuest
+		},
+		Policies: map[string]RolePolicy{
+			RoleTrusted: {Confirm: []string{"write_file"}},
+			RoleGuest:   {Tools: []string{"calculate"}},
+		},
+	}, confirmations)
+
+	if defs := r.ToProviderDefsFor("telegram", "3"); len(defs) != 1 || defs[0].Function.Name != "calculate" {
+		t.Errorf("a guest should only see calculate, got %d tools", len(defs))
+	}
+	write := map[string]interface{}{"path": "a.txt", "content": "hi"}
+	guest := WithSender(context.Background(), "3")
+	if res := r.ExecuteWithContext(guest, "write_file", write, "telegram", "c3", nil); !res.IsError {
+		t.Error("a guest wrote a file")
+	}
+	owner := WithSender(context.Background(), "1")
+	if res := r.ExecuteWithContext(owner, "write_file", write, "telegram", "c1", nil); res.IsError {
+		t.Errorf("the owner was refused: %s", res.ForLLM)
+	}
+
+	trusted := WithSender(context.Background(), "2")
+	res := r.ExecuteWithContext(trusted, "write_file", write, "telegram", "c2", nil)
+	if !res.IsError || !strings.Contains(res.ForLLM, "confirm") {
+		t.Fatalf("change ran without confirmation: %s", res.ForLLM)
+	}
+	if !confirmations.Answer("telegram:c2", "Yes!") {
+		t.Fatal("yes not recognized")
+	}
+	other := map[string]interface{}{"path": "b.txt", "content": "other"}
+	if res := r.ExecuteWithContext(trusted, "write_file", other, "telegram", "c2", nil); !res.IsError {
+		t.Error("the yes let a different call through")
+	}
+	r.ExecuteWithContext(trusted, "write_file", write, "telegram", "c2", nil)
+	confirmations.Answer("telegram:c2", "yes")
+	if res := r.ExecuteWithContext(trusted, "write_file", write, "telegram", "c2", nil); res.IsError {
+		t.Fatalf("confirmed call refused: %s", res.ForLLM)
+	}
+	if res := r.ExecuteWithContext(trusted, "write_file", write, "telegram", "c2", nil); !res.IsError {
+		t.Error("one yes let the call through twice")
+	}
+	if confirmations.Answer("telegram:c2", "no, wait") {
+		t.Error("no taken as yes")
+	}
+}
+
+// TestRegistry_NotifiesChanges verifies registering, replacing, removing
+// and swapping in tools tell the listeners what changed and bump the version
+func TestRegistry_NotifiesChanges(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewToolRegistry()
+	var changes []ToolChange
+	r.OnChange(func(c ToolChange) {
+		// Listeners run outside the lock, so they may use the registry
+		r.Count()
+		changes = append(changes, c)
+	})
+
+	r.Register(NewCalculatorTool())
+	r.Register(NewCalculatorTool())
+	if r.Unregister("missing") {
+		t.Error("removed a tool that was not there")
+	}
+	if !r.Unregister("calculate") {
+		t.Error("calculate not removed")
+	}
+	if result := r.Execute(context.Background(), "calculate", map[string]interface{}{}); !result.IsError {
+		t.Errorf("removed tool still runs: %+v", result)
+	}
+
+	r.Register(NewReadFileTool(workspace, true))
+	kept, _ := r.Get("read_file")
+	next := NewToolRegistry()
+	next.Register(kept)
+	next.Register(NewExecTool(workspace, true))
+	before := r.Version()
+	r.ReplaceWith(next)
+	if r.Version() == before {
+		t.Error("version not bumped by ReplaceWith")
+	}
+
+	want := []string{"added calculate", "replaced calculate", "removed calculate", "added read_file", "added exec"}
+	var got []string
+	for _, c := range changes {
+		for _, name := range c.Added {
+			got = append(got, "added "+name)
+		}
+		for _, name := range c.Replaced {
+			got = append(got, "replaced "+name)
+		}
+		for _, name := range c.Removed {
+			got = append(got, "removed "+name)
+		}
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+}
+
+// TestRegistry_SummariesForChat verifies the summaries list only the
+// tools the chat and sender are offered
+func TestRegistry_SummariesForChat(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewToolRegistry()
+	r.Register(NewReadFileTool(workspace, true))
+	r.Register(NewExecTool(workspace, true))
+	r.Register(NewCalculatorTool())
+	r.ApplyPolicies(map[string]ToolPolicy{"exec": {Users: []string{"42"}}})
+	r.SetChatTools(func(chat string) []string {
+		if chat == "telegram:-100" {
+			return []string{"calculate", "exec"}
+		}
+		return nil
+	})
+
+	names := func(summaries []string) string {
+		var out []string
+		for _, s := range summaries {
+			out = append(out, strings.SplitN(s, "`", 3)[1])
+		}
+		return strings.Join(out, ",")
+	}
+	if got := names(r.SummariesForChat("telegram", "-100", "7")); got != "calculate" {
+		t.Errorf("group chat, other user: %s", got)
+	}
+	if got := names(r.SummariesForChat("telegram", "-100", "42")); got != "calculate,exec" {
+		t.Errorf("group chat, exec user: %s", got)
+	}
+	if got := names(r.SummariesForChat("telegram", "5", "7")); got != "calculate,read_file" {
+		t.Errorf("other chat: %s", got)
+	}
+	if got := names(r.GetSummaries()); got != "calculate,exec,read_file" {
+		t.Errorf("all: %s", got)
+	}
+}
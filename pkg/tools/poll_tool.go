@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+// defaultPollOpen is how long a poll takes votes when no closing time is
+// given.
+const defaultPollOpen = 24 * time.Hour
+
+// PollTool posts native polls to chats that support them ("what time works
+// for dinner?") and reads their votes. When a poll closes on its own the
+// result comes back to the chat for the agent to act on.
+type PollTool struct {
+	polls    *Polls
+	profiles *profile.Store
+}
+
+func NewPollTool(polls *Polls, profiles *profile.Store) *PollTool {
+	return &PollTool{polls: polls, profiles: profiles}
+}
+
+func (t *PollTool) Name() string {
+	return "poll"
+}
+
+func (t *PollTool) Description() string {
+	return "Post a poll to this chat for its members to vote on (\"what time works for dinner?\"), where the chat app has polls (Telegram, WhatsApp), and read or close it. The poll closes after closes_in, or once voters people have voted; its result then comes back to this chat, with follow_up, so you can report it and do what was asked with the winner, such as creating the calendar event for the winning slot."
+}
+
+func (t *PollTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "create", "close")
+}
+
+func (t *PollTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"create", "results", "close", "list"},
+				"description": "Action to perform",
+			},
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "create: the question, up to 300 characters",
+			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": fmt.Sprintf("create: 2 to %d answers, up to 100 characters each", maxPollOptions),
+			},
+			"multiple": map[string]interface{}{
+				"type":        "boolean",
+				"description": "create: let each person pick several answers",
+			},
+			"closes_in": map[string]interface{}{
+				"type":        "string",
+				"description": "create: how long the poll takes votes, like \"2h\" or \"90 min\", or when it closes in RFC 3339 (default 24 hours)",
+			},
+			"voters": map[string]interface{}{
+				"type":        "integer",
+				"description": "create: close as soon as this many people have voted",
+			},
+			"follow_up": map[string]interface{}{
+				"type":        "string",
+				"description": "create: what the user wants done with the result, e.g. \"create a calendar event for the winning time\"",
+			},
+			"poll": map[string]interface{}{
+				"type":        "string",
+				"description": "results, close: poll ID or part of its question (default: the latest poll)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PollTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	loc := time.Local
+	if t.profiles != nil {
+		loc = t.profiles.Get(channel + ":" + chatID).Location()
+	}
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "create":
+		return t.create(ctx, channel, chatID, args, loc)
+	case "list":
+		polls := t.polls.List(channel, chatID)
+		if len(polls) == 0 {
+			return SilentResult("No polls in this chat")
+		}
+		var sb strings.Builder
+		sb.WriteString("Polls:")
+		for _, poll := range polls {
+			state := "open"
+			if !poll.Open() {
+				state = "closed"
+			}
+			fmt.Fprintf(&sb, "\n- %s %q, %s, %d vote(s)", poll.ID, poll.Question, state, len(poll.Ballots))
+		}
+		return SilentResult(sb.String())
+	case "results", "close":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+
+	query, _ := args["poll"].(string)
+	poll, ok := t.polls.Find(channel, chatID, query)
+	if !ok {
+		if strings.TrimSpace(query) == "" {
+			return ErrorResult("no polls in this chat")
+		}
+		return ErrorResult(fmt.Sprintf("no poll matching %q; use action=list to see them", query))
+	}
+	if action == "close" {
+		closed, err := t.polls.Close(ctx, poll.ID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("cannot close %q: %v", poll.Question, err))
+		}
+		poll = closed
+	}
+	result := DescribePoll(poll, loc)
+	if !poll.Open() && poll.FollowUp != "" {
+		result += "\nAsked to be done with the result: " + poll.FollowUp
+	}
+	return SilentResult(result)
+}
+
+func (t *PollTool) create(ctx context.Context, channel, chatID string, args map[string]interface{}, loc *time.Location) *ToolResult {
+	if !t.polls.Supports(channel) {
+		return ErrorResult(fmt.Sprintf("%s has no polls here; ask in a message with numbered options instead", channel))
+	}
+	question, _ := args["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return ErrorResult("question is required for create")
+	}
+	if len([]rune(question)) > 300 {
+		return ErrorResult("question is over 300 characters")
+	}
+	list, _ := stringListArg(args, "options")
+	var options []string
+	for _, o := range list {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+		if len([]rune(o)) > 100 {
+			return ErrorResult(fmt.Sprintf("option %q is over 100 characters", o))
+		}
+		options = append(options, o)
+	}
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return ErrorResult(fmt.Sprintf("a poll needs 2 to %d options", maxPollOptions))
+	}
+
+	closes := time.Now().Add(defaultPollOpen)
+	if in, _ := args["closes_in"].(string); strings.TrimSpace(in) != "" {
+		if at, err := time.Parse(time.RFC3339, strings.TrimSpace(in)); err == nil {
+			closes = at
+		} else if d, err := parseImportDuration(in); err == nil {
+			closes = time.Now().Add(d)
+		} else {
+			return ErrorResult(fmt.Sprintf("cannot read closes_in %q; use a duration like 2h or an RFC 3339 time", in))
+		}
+		if !closes.After(time.Now()) {
+			return ErrorResult("closes_in is in the past")
+		}
+	}
+	voters := 0
+	if v, ok := args["voters"].(float64); ok && v > 0 {
+		voters = int(v)
+	}
+	multiple, _ := args["multiple"].(bool)
+	followUp, _ := args["follow_up"].(string)
+
+	poll, err := t.polls.Create(ctx, channel, chatID, PollRequest{Question: question, Options: options, Multiple: multiple}, closes, voters, strings.TrimSpace(followUp))
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to post the poll: %v", err)).WithError(err)
+	}
+	noteAuditRef(ctx, poll.ID)
+	result := fmt.Sprintf("Poll %s posted. It closes %s", poll.ID, poll.Closes.In(loc).Format("Mon 2 Jan 15:04"))
+	if voters > 0 {
+		result += fmt.Sprintf(" or once %d people have voted", voters)
+	}
+	return SilentResult(result + "; the result will come back to this chat then.")
+}
@@ -0,0 +1,481 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// PollChannel is implemented by channels that can post native polls. The
+// votes cast in them come back through the handler given to
+// SetPollHandler.
+type PollChannel interface {
+	SendPoll(ctx context.Context, chatID string, poll PollRequest) (SentPoll, error)
+	SetPollHandler(handler func(PollVote))
+}
+
+// PollCloser is implemented by poll channels that can stop a poll, so the
+// chat sees it closed and takes no more votes.
+type PollCloser interface {
+	StopPoll(ctx context.Context, chatID, messageID string) error
+}
+
+// PollRequest is a poll to post.
+type PollRequest struct {
+	Question string
+	Options  []string
+	// Multiple lets each voter pick more than one option
+	Multiple bool
+}
+
+// SentPoll identifies a posted poll: ID is what its votes carry, and
+// MessageID the message it was posted as.
+type SentPoll struct {
+	ID        string
+	MessageID string
+}
+
+// PollVote is a voter's current choice in a poll, as option indexes. No
+// options means the vote was taken back.
+type PollVote struct {
+	PollID  string
+	Voter   string
+	Name    string
+	Options []int
+}
+
+// maxPollOptions is the most options every poll channel takes.
+const maxPollOptions = 10
+
+// pollKeep is how long closed polls are kept for their results.
+const pollKeep = 30 * 24 * time.Hour
+
+// Poll is a poll posted to a chat, with the votes cast so far.
+type Poll struct {
+	ID        string   `json:"id"`
+	Channel   string   `json:"channel"`
+	ChatID    string   `json:"chat_id"`
+	MessageID string   `json:"message_id,omitempty"`
+	Question  string   `json:"question"`
+	Options   []string `json:"options"`
+	Multiple  bool     `json:"multiple,omitempty"`
+	// Voters closes the poll early once that many people have voted
+	Voters int `json:"voters,omitempty"`
+	// FollowUp is what the user asked to be done with the result, and
+	// Asker who asked, whose permissions it is done with
+	FollowUp string                `json:"follow_up,omitempty"`
+	Asker    string                `json:"asker,omitempty"`
+	Ballots  map[string]PollBallot `json:"ballots,omitempty"`
+	Created  time.Time             `json:"created"`
+	Closes   time.Time             `json:"closes"`
+	Closed   time.Time             `json:"closed,omitempty"`
+}
+
+// PollBallot is one voter's choice.
+type PollBallot struct {
+	Name    string `json:"name"`
+	Options []int  `json:"options"`
+}
+
+// Open reports whether the poll still takes votes.
+func (p Poll) Open() bool {
+	return p.Closed.IsZero()
+}
+
+// Polls keeps the polls posted through the poll tool, in a JSON file, and
+// closes each when its time is up or enough people have voted. Results of
+// polls that close on their own are passed to the notify function, for the
+// agent to report and act on in the poll's chat.
+type Polls struct {
+	path string
+
+	mu       sync.Mutex
+	polls    []*Poll
+	channels map[string]PollChannel
+	timers   map[string]*time.Timer
+	started  bool
+	notify   func(Poll)
+}
+
+// NewPolls returns the polls stored at path.
+func NewPolls(path string) *Polls {
+	p := &Polls{path: path, channels: map[string]PollChannel{}, timers: map[string]*time.Timer{}}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &p.polls); err != nil {
+			logger.WarnCF("polls", "Failed to read polls", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	cutoff := time.Now().Add(-pollKeep)
+	kept := p.polls[:0]
+	for _, poll := range p.polls {
+		if poll.Open() || poll.Closed.After(cutoff) {
+			kept = append(kept, poll)
+		}
+	}
+	p.polls = kept
+	return p
+}
+
+// AddChannel lets polls be posted to the named channel and counts the
+// votes it reports.
+func (p *Polls) AddChannel(name string, channel PollChannel) {
+	p.mu.Lock()
+	p.channels[name] = channel
+	p.mu.Unlock()
+	channel.SetPollHandler(func(v PollVote) { p.vote(name, v) })
+}
+
+// Supports reports whether polls can be posted to the named channel.
+func (p *Polls) Supports(channel string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.channels[channel] != nil
+}
+
+// SetNotify sets the function told about polls that close on their own.
+func (p *Polls) SetNotify(fn func(Poll)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notify = fn
+}
+
+// Start closes polls at their closing time from now on, at once for those
+// whose time passed while picoclaw was down.
+func (p *Polls) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = true
+	for _, poll := range p.polls {
+		if poll.Open() {
+			p.armLocked(poll)
+		}
+	}
+}
+
+// Stop stops closing polls; open ones are closed by the next Start.
+func (p *Polls) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = false
+	for id, timer := range p.timers {
+		timer.Stop()
+		delete(p.timers, id)
+	}
+}
+
+// Create posts a poll to a chat for the sender in ctx. It closes at
+// closes, or once voters people have voted when voters is set.
+func (p *Polls) Create(ctx context.Context, channel, chatID string, req PollRequest, closes time.Time, voters int, followUp string) (Poll, error) {
+	p.mu.Lock()
+	pc := p.channels[channel]
+	p.mu.Unlock()
+	if pc == nil {
+		return Poll{}, fmt.Errorf("polls cannot be posted on %s", channel)
+	}
+	sent, err := pc.SendPoll(ctx, chatID, req)
+	if err != nil {
+		return Poll{}, err
+	}
+	poll := &Poll{
+		ID:        sent.ID,
+		Channel:   channel,
+		ChatID:    chatID,
+		MessageID: sent.MessageID,
+		Question:  req.Question,
+		Options:   req.Options,
+		Multiple:  req.Multiple,
+		Voters:    voters,
+		FollowUp:  followUp,
+		Asker:     SenderFromContext(ctx),
+		Created:   time.Now(),
+		Closes:    closes,
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.polls = append(p.polls, poll)
+	if p.started {
+		p.armLocked(poll)
+	}
+	p.saveLocked()
+	return *poll, nil
+}
+
+// Find returns the chat's poll whose ID is query or whose question
+// contains it, the newest first; an empty query finds the newest poll.
+func (p *Polls) Find(channel, chatID, query string) (Poll, bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.polls) - 1; i >= 0; i-- {
+		poll := p.polls[i]
+		if poll.Channel != channel || poll.ChatID != chatID {
+			continue
+		}
+		if query == "" || poll.ID == query || strings.Contains(strings.ToLower(poll.Question), query) {
+			return copyPoll(poll), true
+		}
+	}
+	return Poll{}, false
+}
+
+// List returns the chat's polls, newest first.
+func (p *Polls) List(channel, chatID string) []Poll {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var list []Poll
+	for i := len(p.polls) - 1; i >= 0; i-- {
+		if poll := p.polls[i]; poll.Channel == channel && poll.ChatID == chatID {
+			list = append(list, copyPoll(poll))
+		}
+	}
+	return list
+}
+
+// Close closes a poll now and returns it with its final votes. Unlike a
+// poll closing on its own, nobody is notified: the caller has the result.
+func (p *Polls) Close(ctx context.Context, id string) (Poll, error) {
+	p.mu.Lock()
+	poll := p.findLocked("", id)
+	if poll == nil {
+		p.mu.Unlock()
+		return Poll{}, fmt.Errorf("no poll %s", id)
+	}
+	if !poll.Open() {
+		p.mu.Unlock()
+		return copyPoll(poll), fmt.Errorf("it closed %s", poll.Closed.Format("Mon 2 Jan 15:04"))
+	}
+	closed, pc := p.closeLocked(poll)
+	p.mu.Unlock()
+	stopPoll(ctx, pc, closed)
+	return closed, nil
+}
+
+// vote records a vote reported by channel, closing the poll when it has
+// all the voters it waited for.
+func (p *Polls) vote(channel string, v PollVote) {
+	p.mu.Lock()
+	poll := p.findLocked(channel, v.PollID)
+	if poll == nil || !poll.Open() {
+		p.mu.Unlock()
+		return
+	}
+	var options []int
+	for _, o := range v.Options {
+		if o >= 0 && o < len(poll.Options) {
+			options = append(options, o)
+		}
+	}
+	if len(options) == 0 {
+		delete(poll.Ballots, v.Voter)
+	} else {
+		if poll.Ballots == nil {
+			poll.Ballots = map[string]PollBallot{}
+		}
+		poll.Ballots[v.Voter] = PollBallot{Name: v.Name, Options: options}
+	}
+	if poll.Voters == 0 || len(poll.Ballots) < poll.Voters {
+		p.saveLocked()
+		p.mu.Unlock()
+		return
+	}
+	closed, pc := p.closeLocked(poll)
+	notify := p.notify
+	p.mu.Unlock()
+	go p.finish(closed, pc, notify)
+}
+
+// expire closes a poll whose time is up.
+func (p *Polls) expire(id string) {
+	p.mu.Lock()
+	poll := p.findLocked("", id)
+	if poll == nil || !poll.Open() || !p.started {
+		p.mu.Unlock()
+		return
+	}
+	closed, pc := p.closeLocked(poll)
+	notify := p.notify
+	p.mu.Unlock()
+	p.finish(closed, pc, notify)
+}
+
+// finish stops a poll that closed on its own in its chat and reports it.
+func (p *Polls) finish(poll Poll, pc PollChannel, notify func(Poll)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stopPoll(ctx, pc, poll)
+	if notify != nil {
+		notify(poll)
+	}
+}
+
+// stopPoll closes a poll in its chat where the channel can; the result
+// stands either way.
+func stopPoll(ctx context.Context, pc PollChannel, poll Poll) {
+	closer, ok := pc.(PollCloser)
+	if !ok || poll.MessageID == "" {
+		return
+	}
+	if err := closer.StopPoll(ctx, poll.ChatID, poll.MessageID); err != nil {
+		logger.WarnCF("polls", "Failed to stop poll", map[string]interface{}{
+			"poll":  poll.ID,
+			"error": err.Error(),
+		})
+	}
+}
+
+func (p *Polls) closeLocked(poll *Poll) (Poll, PollChannel) {
+	poll.Closed = time.Now()
+	if timer := p.timers[poll.ID]; timer != nil {
+		timer.Stop()
+		delete(p.timers, poll.ID)
+	}
+	p.saveLocked()
+	return copyPoll(poll), p.channels[poll.Channel]
+}
+
+func (p *Polls) armLocked(poll *Poll) {
+	if p.timers[poll.ID] != nil {
+		return
+	}
+	id := poll.ID
+	p.timers[id] = time.AfterFunc(time.Until(poll.Closes), func() { p.expire(id) })
+}
+
+// findLocked returns the poll with id, posted on channel unless channel
+// is empty.
+func (p *Polls) findLocked(channel, id string) *Poll {
+	for _, poll := range p.polls {
+		if poll.ID == id && (channel == "" || poll.Channel == channel) {
+			return poll
+		}
+	}
+	return nil
+}
+
+func (p *Polls) saveLocked() {
+	if p.path == "" {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(p.path), 0755)
+	if err == nil {
+		var data []byte
+		if data, err = json.MarshalIndent(p.polls, "", "  "); err == nil {
+			tmp := p.path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0600); err == nil {
+				err = os.Rename(tmp, p.path)
+			}
+		}
+	}
+	if err != nil {
+		logger.WarnCF("polls", "Failed to save polls", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func copyPoll(poll *Poll) Poll {
+	c := *poll
+	c.Ballots = make(map[string]PollBallot, len(poll.Ballots))
+	for k, v := range poll.Ballots {
+		c.Ballots[k] = v
+	}
+	return c
+}
+
+// DescribePoll reports a poll's votes option by option, with who picked
+// each, the winner first once it is closed.
+func DescribePoll(poll Poll, loc *time.Location) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%q ", poll.Question)
+	if poll.Open() {
+		fmt.Fprintf(&sb, "(open, closes %s", poll.Closes.In(loc).Format("Mon 2 Jan 15:04"))
+		if poll.Voters > 0 {
+			fmt.Fprintf(&sb, " or once %d people have voted", poll.Voters)
+		}
+		sb.WriteString(")")
+	} else {
+		fmt.Fprintf(&sb, "(closed %s)", poll.Closed.In(loc).Format("Mon 2 Jan 15:04"))
+	}
+
+	names := make([][]string, len(poll.Options))
+	voters := make([]string, 0, len(poll.Ballots))
+	for id := range poll.Ballots {
+		voters = append(voters, id)
+	}
+	sort.Strings(voters)
+	for _, id := range voters {
+		ballot := poll.Ballots[id]
+		name := ballot.Name
+		if name == "" {
+			name = id
+		}
+		for _, o := range ballot.Options {
+			names[o] = append(names[o], name)
+		}
+	}
+	order := make([]int, len(poll.Options))
+	for i := range order {
+		order[i] = i
+	}
+	if !poll.Open() {
+		sort.SliceStable(order, func(a, b int) bool { return len(names[order[a]]) > len(names[order[b]]) })
+	}
+	for _, o := range order {
+		fmt.Fprintf(&sb, "\n- %s: %d", poll.Options[o], len(names[o]))
+		if len(names[o]) > 0 {
+			sb.WriteString(" (" + strings.Join(names[o], ", ") + ")")
+		}
+	}
+	switch len(voters) {
+	case 0:
+		sb.WriteString("\nNobody has voted.")
+	case 1:
+		sb.WriteString("\n1 person voted.")
+	default:
+		fmt.Fprintf(&sb, "\n%d people voted.", len(voters))
+	}
+	if !poll.Open() && len(voters) > 0 && len(order) > 1 && len(names[order[0]]) == len(names[order[1]]) {
+		sb.WriteString(" The top options are tied.")
+	}
+	return sb.String()
+}
+
+// ChatData implements ChatDataStore: the chat's polls and their votes.
+func (p *Polls) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	channel, chatID, _ := strings.Cut(chatKey, ":")
+	if list := p.List(channel, chatID); len(list) > 0 {
+		return list, nil
+	}
+	return nil, nil
+}
+
+// PurgeChat implements ChatDataStore. Open polls stop counting; they stay
+// posted in the chat.
+func (p *Polls) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	channel, chatID, _ := strings.Cut(chatKey, ":")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kept := p.polls[:0:0]
+	for _, poll := range p.polls {
+		if poll.Channel != channel || poll.ChatID != chatID {
+			kept = append(kept, poll)
+			continue
+		}
+		if timer := p.timers[poll.ID]; timer != nil {
+			timer.Stop()
+			delete(p.timers, poll.ID)
+		}
+	}
+	n := len(p.polls) - len(kept)
+	if n > 0 {
+		p.polls = kept
+		p.saveLocked()
+	}
+	return n, nil
+}
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePollChannel posts polls by numbering them and records stopped ones.
+type fakePollChannel struct {
+	mu      sync.Mutex
+	posted  []PollRequest
+	stopped []string
+	votes   func(PollVote)
+}
+
+func (c *fakePollChannel) SendPoll(ctx context.Context, chatID string, poll PollRequest) (SentPoll, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posted = append(c.posted, poll)
+	n := len(c.posted)
+	return SentPoll{ID: fmt.Sprintf("p%d", n), MessageID: fmt.Sprintf("m%d", n)}, nil
+}
+
+func (c *fakePollChannel) SetPollHandler(handler func(PollVote)) {
+	c.votes = handler
+}
+
+func (c *fakePollChannel) StopPoll(ctx context.Context, chatID, messageID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = append(c.stopped, messageID)
+	return nil
+}
+
+// TestPollTool_VotesCloseAndReport verifies a poll is posted to the chat's channel, counts changing votes by voter, and once enough people voted is stopped and its result reported with the follow-up
+func TestPollTool_VotesCloseAndReport(t *testing.T) {
+	polls := NewPolls(filepath.Join(t.TempDir(), "polls.json"))
+	channel := &fakePollChannel{}
+	polls.AddChannel("telegram", channel)
+	reported := make(chan Poll, 1)
+	polls.SetNotify(func(p Poll) { reported <- p })
+	polls.Start()
+	defer polls.Stop()
+	tool := NewPollTool(polls, nil)
+	ctx := WithSender(WithChat(context.Background(), "telegram", "-100"), "42")
+
+	if r := tool.Execute(WithChat(context.Background(), "slack", "C1"), map[string]interface{}{"action": "create", "question": "Dinner?", "options": []interface{}{"19:00", "20:00"}}); !r.IsError {
+		t.Errorf("poll posted on a channel without polls: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "create", "question": "Dinner?", "options": []interface{}{"19:00"}}); !r.IsError {
+		t.Errorf("poll with one option posted: %s", r.ForLLM)
+	}
+	r := tool.Execute(ctx, map[string]interface{}{
+		"action": "create", "question": "What time works for dinner?", "options": []interface{}{"19:00", "20:00", "21:00"},
+		"voters": float64(3), "closes_in": "2h", "follow_up": "create a calendar event for the winning time",
+	})
+	if r.IsError || !strings.Contains(r.ForLLM, "Poll p1 posted") || len(channel.posted) != 1 {
+		t.Fatalf("unexpected create: %s", r.ForLLM)
+	}
+
+	channel.votes(PollVote{PollID: "p1", Voter: "1", Name: "Ana", Options: []int{0}})
+	channel.votes(PollVote{PollID: "p1", Voter: "2", Name: "Bruno", Options: []int{1}})
+	channel.votes(PollVote{PollID: "p1", Voter: "2", Name: "Bruno", Options: []int{0}})
+	channel.votes(PollVote{PollID: "p9", Voter: "3", Name: "Zoe", Options: []int{0}})
+	r = tool.Execute(ctx, map[string]interface{}{"action": "results", "poll": "dinner"})
+	if r.IsError || !strings.Contains(r.ForLLM, "- 19:00: 2 (Ana, Bruno)") || !strings.Contains(r.ForLLM, "2 people voted") || !strings.Contains(r.ForLLM, "(open") {
+		t.Fatalf("unexpected results: %s", r.ForLLM)
+	}
+
+	channel.votes(PollVote{PollID: "p1", Voter: "3", Name: "Carla", Options: []int{2}})
+	select {
+	case p := <-reported:
+		if p.Open() || p.FollowUp != "create a calendar event for the winning time" || p.Asker != "42" {
+			t.Errorf("unexpected reported poll: %+v", p)
+		}
+		if text := DescribePoll(p, time.UTC); !strings.Contains(text, "\n- 19:00: 2 (Ana, Bruno)\n- 21:00: 1 (Carla)\n- 20:00: 0") {
+			t.Errorf("winner not listed first: %s", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closed poll not reported")
+	}
+	channel.mu.Lock()
+	stopped := channel.stopped
+	channel.mu.Unlock()
+	if len(stopped) != 1 || stopped[0] != "m1" {
+		t.Errorf("poll not stopped in the chat: %v", stopped)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "close"}); !r.IsError {
+		t.Errorf("closed poll closed again: %s", r.ForLLM)
+	}
+}
+
+// TestPolls_CloseOverdueAfterRestart verifies a poll whose time ran out while picoclaw was down is closed and reported at the next start
+func TestPolls_CloseOverdueAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "polls.json")
+	polls := NewPolls(path)
+	polls.AddChannel("whatsapp", &fakePollChannel{})
+	ctx := WithChat(context.Background(), "whatsapp", "g1")
+	if _, err := polls.Create(ctx, "whatsapp", "g1", PollRequest{Question: "Beach or hills?", Options: []string{"Beach", "Hills"}}, time.Now().Add(50*time.Millisecond), 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	next := NewPolls(path)
+	next.AddChannel("whatsapp", &fakePollChannel{})
+	reported := make(chan Poll, 1)
+	next.SetNotify(func(p Poll) { reported <- p })
+	if p, ok := next.Find("whatsapp", "g1", ""); !ok || !p.Open() {
+		t.Fatalf("poll not kept open: %+v", p)
+	}
+	next.Start()
+	defer next.Stop()
+	select {
+	case p := <-reported:
+		if p.Question != "Beach or hills?" || p.Open() {
+			t.Errorf("unexpected reported poll: %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("overdue poll not closed")
+	}
+}
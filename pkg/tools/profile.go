@@ -0,0 +1,201 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+// ProfileTool reads and updates the user's profile for the current chat.
+type ProfileTool struct {
+	store   *profile.Store
+	channel string
+	chatID  string
+}
+
+func NewProfileTool(store *profile.Store) *ProfileTool {
+	return &ProfileTool{store: store}
+}
+
+func (t *ProfileTool) Name() string {
+	return "user_profile"
+}
+
+func (t *ProfileTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ProfileTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "set")
+}
+
+func (t *ProfileTool) Description() string {
+	return "Get or set the user's timezone, locale, preferred reply language, quiet hours and reply style (verbosity, emoji, 12h/24h clock, metric/imperial units) for this chat. Set the timezone whenever the user mentions where they are or what time it is for them; reminders and schedules use it. No proactive messages are sent during quiet hours. Replies follow the language each message is written in; set fixed_language to always reply in language instead. Set the style whenever the user asks for shorter or longer answers, no emoji, another clock or other units, so it holds in later conversations."
+}
+
+func (t *ProfileTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"get", "set"},
+				"description": "Action to perform",
+			},
+			"timezone": map[string]interface{}{
+				"type":        "string",
+				"description": "IANA timezone, e.g. America/Sao_Paulo",
+			},
+			"locale": map[string]interface{}{
+				"type":        "string",
+				"description": "Locale for dates, numbers and the wording of tool replies, e.g. pt-BR. Set it with the language when the user writes in one other than English",
+			},
+			"language": map[string]interface{}{
+				"type":        "string",
+				"description": "Language to reply in, e.g. Portuguese",
+			},
+			"fixed_language": map[string]interface{}{
+				"type":        "boolean",
+				"description": "true to always reply in language, even when the user writes in another one; false (default) to answer each message in the language it is written in",
+			},
+			"quiet_hours": map[string]interface{}{
+				"type":        "string",
+				"description": "Quiet hours as HH:MM-HH:MM in the user's timezone (e.g. 22:00-07:00), or \"off\"",
+			},
+			"verbosity": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"concise", "normal", "detailed"},
+				"description": "How long replies should be",
+			},
+			"emoji": map[string]interface{}{
+				"type":        "boolean",
+				"description": "false to keep emoji out of replies and notifications",
+			},
+			"clock": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"12h", "24h", "locale"},
+				"description": "How times are written; locale follows the user's locale",
+			},
+			"units": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"metric", "imperial", "locale"},
+				"description": "Units for temperatures, distances and weights; locale follows the user's locale",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ProfileTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *ProfileTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	chatKey := t.channel + ":" + t.chatID
+
+	action, _ := args["action"].(string)
+	switch action {
+	case "get":
+		return SilentResult(FormatProfile(t.store.Get(chatKey), time.Now()))
+
+	case "set":
+		p := t.store.Get(chatKey)
+		if v, ok := args["timezone"].(string); ok {
+			p.Timezone = strings.TrimSpace(v)
+		}
+		if v, ok := args["locale"].(string); ok {
+			p.Locale = strings.TrimSpace(v)
+		}
+		if v, ok := args["language"].(string); ok {
+			p.Language = strings.TrimSpace(v)
+		}
+		if v, ok := args["fixed_language"].(bool); ok {
+			p.FixedLanguage = v
+		}
+		if v, ok := args["quiet_hours"].(string); ok {
+			v = strings.TrimSpace(v)
+			if v == "" || strings.EqualFold(v, "off") {
+				p.QuietStart, p.QuietEnd = "", ""
+			} else {
+				start, end, found := strings.Cut(v, "-")
+				if !found {
+					return ErrorResult("quiet_hours must look like 22:00-07:00")
+				}
+				p.QuietStart, p.QuietEnd = strings.TrimSpace(start), strings.TrimSpace(end)
+			}
+		}
+		if v, ok := args["verbosity"].(string); ok {
+			p.Verbosity = strings.ToLower(strings.TrimSpace(v))
+			if p.Verbosity == "normal" {
+				p.Verbosity = ""
+			}
+		}
+		if v, ok := args["emoji"].(bool); ok {
+			p.NoEmoji = !v
+		}
+		if v, ok := args["clock"].(string); ok {
+			p.Clock = strings.ToLower(strings.TrimSpace(v))
+			if p.Clock == "locale" {
+				p.Clock = ""
+			}
+		}
+		if v, ok := args["units"].(string); ok {
+			p.Units = strings.ToLower(strings.TrimSpace(v))
+			if p.Units == "locale" {
+				p.Units = ""
+			}
+		}
+		if err := t.store.Set(chatKey, p); err != nil {
+			return ErrorResult(fmt.Sprintf("invalid profile: %v", err)).WithError(err)
+		}
+		return SilentResult("Profile updated.\n" + FormatProfile(p, time.Now()))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// FormatProfile renders a profile for the model, including the user's
+// current local time.
+func FormatProfile(p profile.Profile, now time.Time) string {
+	if p.IsZero() {
+		return "No profile set (server timezone is used)."
+	}
+	var sb strings.Builder
+	if p.Timezone != "" {
+		fmt.Fprintf(&sb, "Timezone: %s (local time %s)\n", p.Timezone, now.In(p.Location()).Format("2006-01-02 15:04 (Monday)"))
+	}
+	if p.Locale != "" {
+		fmt.Fprintf(&sb, "Locale: %s\n", p.Locale)
+	}
+	if p.Language != "" {
+		if p.FixedLanguage {
+			fmt.Fprintf(&sb, "Language: always %s\n", p.Language)
+		} else {
+			fmt.Fprintf(&sb, "Preferred language: %s\n", p.Language)
+		}
+	}
+	if p.QuietStart != "" {
+		fmt.Fprintf(&sb, "Quiet hours: %s-%s\n", p.QuietStart, p.QuietEnd)
+	}
+	if p.Verbosity != "" {
+		fmt.Fprintf(&sb, "Replies: %s\n", p.Verbosity)
+	}
+	if p.NoEmoji {
+		sb.WriteString("Emoji: off\n")
+	}
+	if p.Clock != "" {
+		fmt.Fprintf(&sb, "Clock: %s\n", p.Clock)
+	}
+	if p.Units != "" {
+		fmt.Fprintf(&sb, "Units: %s\n", p.Units)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+// TestProfileTool_SetQuietHours verifies quiet hours are parsed and invalid timezones rejected
+func TestProfileTool_SetQuietHours(t *testing.T) {
+	store := profile.NewStore(t.TempDir())
+	tool := NewProfileTool(store)
+	tool.SetContext("telegram", "42")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":      "set",
+		"timezone":    "Europe/Lisbon",
+		"quiet_hours": "22:30 - 07:00",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	p := store.Get("telegram:42")
+	if p.QuietStart != "22:30" || p.QuietEnd != "07:00" || p.Timezone != "Europe/Lisbon" {
+		t.Errorf("Unexpected profile: %+v", p)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"action":   "set",
+		"timezone": "Lisbon",
+	})
+	if !result.IsError {
+		t.Error("Expected invalid timezone to be rejected")
+	}
+}
+
+// TestCronTool_DefersDuringQuietHours verifies reminders due in quiet hours are rescheduled for their end
+func TestCronTool_DefersDuringQuietHours(t *testing.T) {
+	store := profile.NewStore(t.TempDir())
+	now := time.Now().UTC()
+	store.Set("telegram:42", profile.Profile{
+		Timezone:   "UTC",
+		QuietStart: now.Add(-time.Hour).Format("15:04"),
+		QuietEnd:   now.Add(time.Hour).Format("15:04"),
+	})
+
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	msgBus := bus.NewMessageBus()
+	tool := NewCronTool(cs, nil, msgBus, t.TempDir(), true, 0)
+	tool.SetProfiles(store)
+
+	job := &cron.CronJob{ID: "j1", Payload: cron.CronPayload{Deliver: true, Message: "Drink water", Channel: "telegram", To: "42"}}
+	tool.ExecuteJob(context.Background(), job)
+
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Schedule.Kind != "at" || !strings.Contains(jobs[0].Payload.Message, "Drink water") {
+		t.Fatalf("Expected one deferred job, got %+v", jobs)
+	}
+	if at := time.UnixMilli(*jobs[0].Schedule.AtMS); at.Before(now) {
+		t.Errorf("Deferred job scheduled in the past: %v", at)
+	}
+}
@@ -0,0 +1,252 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Recipient address kinds for ResolveRecipient.
+const (
+	RecipientEmail = "email"
+	RecipientPhone = "phone"
+)
+
+// relationAliases groups the words people use for the same relation, so
+// "email mom" finds the contact whose notes say "mother".
+var relationAliases = [][]string{
+	{"mom", "mother", "mum", "mommy", "mama", "mãe", "mae", "mamá", "mamãe"},
+	{"dad", "father", "daddy", "papa", "pai", "papá", "papai"},
+	{"wife", "husband", "spouse", "partner", "esposa", "marido"},
+	{"sister", "sis", "irmã"},
+	{"brother", "bro", "irmão"},
+	{"son", "filho"},
+	{"daughter", "filha"},
+	{"grandma", "grandmother", "granny", "avó", "vovó"},
+	{"grandpa", "grandfather", "avô", "vovô"},
+	{"boss", "manager", "chefe"},
+}
+
+// Margin by which the best candidate must outscore the next one to be
+// picked without asking.
+const recipientLead = 20
+
+// RecipientMatch is one contact address a reference may point to.
+type RecipientMatch struct {
+	Contact Contact
+	Address string
+	Score   int
+}
+
+func (m RecipientMatch) String() string {
+	if m.Contact.Name == "" {
+		return m.Address
+	}
+	return fmt.Sprintf("%s <%s>", m.Contact.Name, m.Address)
+}
+
+// RecipientResolution is the outcome of resolving a reference such as
+// "mom" or "Ana" to an address. Match is set only when one candidate is a
+// clear winner; otherwise Candidates lists the options, best first, for
+// the user to choose from.
+type RecipientResolution struct {
+	Reference  string
+	Kind       string
+	Match      *RecipientMatch
+	Candidates []RecipientMatch
+}
+
+// ResolveRecipient turns a reference from a request ("mom", "Ana Silva",
+// "ana@example.com") into an email address or phone number from the
+// address books. Literal addresses are returned as they are. Each contact
+// address is scored against the reference; a single clear winner is
+// returned as Match so send flows never have to invent an address.
+func (d *ContactDirectory) ResolveRecipient(ctx context.Context, reference, kind string) (*RecipientResolution, error) {
+	ref := normalizeReference(reference)
+	res := &RecipientResolution{Reference: reference, Kind: kind}
+	if ref == "" {
+		return res, nil
+	}
+	if addr, ok := literalAddress(reference, kind); ok {
+		res.Match = &RecipientMatch{Address: addr, Score: 100}
+		res.Candidates = []RecipientMatch{*res.Match}
+		return res, nil
+	}
+
+	queries := []string{ref}
+	aliases := relationFor(ref)
+	for _, alias := range aliases {
+		if alias != ref {
+			queries = append(queries, alias)
+		}
+	}
+	seen := map[string]bool{}
+	for _, q := range queries {
+		contacts, err := d.Search(ctx, q, 20)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range contacts {
+			key := c.Source + ":" + c.ID + ":" + c.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			score := scoreRecipient(c, ref, aliases)
+			if score == 0 {
+				continue
+			}
+			addresses := c.Emails
+			if kind == RecipientPhone {
+				addresses = c.Phones
+			}
+			for _, addr := range addresses {
+				res.Candidates = append(res.Candidates, RecipientMatch{Contact: c, Address: addr, Score: score})
+			}
+		}
+	}
+	sort.SliceStable(res.Candidates, func(i, j int) bool {
+		return res.Candidates[i].Score > res.Candidates[j].Score
+	})
+
+	switch {
+	case len(res.Candidates) == 1:
+		res.Match = &res.Candidates[0]
+	case len(res.Candidates) > 1 && res.Candidates[0].Score-res.Candidates[1].Score >= recipientLead:
+		res.Match = &res.Candidates[0]
+	}
+	return res, nil
+}
+
+// Describe renders the resolution for the model, telling it to ask the
+// user rather than guess when there is no single match.
+func (r *RecipientResolution) Describe() string {
+	noun := "an email address"
+	if r.Kind == RecipientPhone {
+		noun = "a phone number"
+	}
+	if r.Match != nil {
+		return fmt.Sprintf("%q is %s", r.Reference, r.Match)
+	}
+	if len(r.Candidates) == 0 {
+		return fmt.Sprintf("No contact with %s matches %q. Ask the user for it; do not guess one.", noun, r.Reference)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%q matches several contacts. Ask the user which one they mean before sending:", r.Reference)
+	for i, c := range r.Candidates {
+		if i == 5 {
+			fmt.Fprintf(&sb, "\n(%d more)", len(r.Candidates)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, c)
+	}
+	return sb.String()
+}
+
+// Clarify asks the user which candidate they mean, when there are several
+// and none is a clear winner. with returns the arguments that redo the
+// call using one address. It returns nil when there is nothing to ask.
+func (r *RecipientResolution) Clarify(with func(address string) map[string]interface{}) *ToolResult {
+	if r.Match != nil || len(r.Candidates) < 2 {
+		return nil
+	}
+	choices := make([]Choice, 0, len(r.Candidates))
+	for _, c := range r.Candidates {
+		choices = append(choices, Choice{Label: c.String(), Args: with(c.Address)})
+	}
+	return ClarifyResult(fmt.Sprintf("Which %q do you mean?", r.Reference), choices)
+}
+
+// normalizeReference lowercases a reference and drops possessives, so
+// "My Mom" and "mom's" both become "mom".
+func normalizeReference(reference string) string {
+	ref := strings.ToLower(strings.TrimSpace(reference))
+	for _, prefix := range []string{"my ", "our "} {
+		ref = strings.TrimPrefix(ref, prefix)
+	}
+	ref = strings.TrimSuffix(strings.TrimSuffix(ref, "'s"), "’s")
+	return strings.Join(strings.Fields(ref), " ")
+}
+
+func literalAddress(reference, kind string) (string, bool) {
+	reference = strings.TrimSpace(reference)
+	if kind == RecipientPhone {
+		if strings.IndexFunc(reference, unicode.IsLetter) >= 0 || len(normalizePhone(reference)) < 6 {
+			return "", false
+		}
+		return reference, true
+	}
+	if !strings.Contains(reference, "@") {
+		return "", false
+	}
+	addr, err := mail.ParseAddress(reference)
+	if err != nil {
+		return "", false
+	}
+	return addr.Address, true
+}
+
+func relationFor(ref string) []string {
+	for _, group := range relationAliases {
+		for _, alias := range group {
+			if alias == ref {
+				return group
+			}
+		}
+	}
+	return nil
+}
+
+func hasWord(text, word string) bool {
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreRecipient rates how well contact c fits reference ref: an exact
+// name beats a relation noted on the contact, which beats a first name,
+// then all words of the name, then partial matches. Zero means no match.
+func scoreRecipient(c Contact, ref string, aliases []string) int {
+	name := strings.ToLower(strings.Join(strings.Fields(c.Name), " "))
+	if name == ref {
+		return 100
+	}
+	for _, alias := range aliases {
+		if hasWord(c.Name, alias) || hasWord(c.Notes, alias) {
+			return 90
+		}
+	}
+	words := strings.Fields(ref)
+	nameWords := strings.Fields(name)
+	if len(nameWords) > 0 && len(words) == 1 && nameWords[0] == ref {
+		return 80
+	}
+	all := true
+	for _, w := range words {
+		all = all && hasWord(name, w)
+	}
+	if all {
+		return 70
+	}
+	all = true
+	for _, w := range words {
+		all = all && strings.Contains(name, w)
+	}
+	if all {
+		return 50
+	}
+	for _, e := range c.Emails {
+		if strings.Contains(strings.ToLower(e), ref) {
+			return 40
+		}
+	}
+	return 0
+}
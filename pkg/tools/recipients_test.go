@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newRecipientDirectory(t *testing.T, contacts ...Contact) *ContactDirectory {
+	t.Helper()
+	book := NewLocalAddressBook(filepath.Join(t.TempDir(), "contacts.json"))
+	for i := range contacts {
+		if _, err := book.Save(context.Background(), &contacts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewContactDirectory(book)
+}
+
+// TestResolveRecipient_RelationInNotes verifies "mom" finds the contact noted as mother over a weaker name match
+func TestResolveRecipient_RelationInNotes(t *testing.T) {
+	dir := newRecipientDirectory(t,
+		Contact{Name: "Maria Souza", Emails: []string{"maria@example.com"}, Notes: "Mother"},
+		Contact{Name: "Tom Momsen", Emails: []string{"tom@example.com"}},
+	)
+	res, err := dir.ResolveRecipient(context.Background(), "my Mom", RecipientEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Match == nil || res.Match.Address != "maria@example.com" {
+		t.Fatalf("expected Maria, got %+v", res)
+	}
+}
+
+// TestResolveRecipient_AsksWhenAmbiguous verifies equally good matches are listed instead of picked
+func TestResolveRecipient_AsksWhenAmbiguous(t *testing.T) {
+	dir := newRecipientDirectory(t,
+		Contact{Name: "Ana Silva", Emails: []string{"ana.silva@example.com"}},
+		Contact{Name: "Ana Costa", Emails: []string{"ana.costa@example.com"}},
+		Contact{Name: "Bruno", Phones: []string{"+1 555 0100"}},
+	)
+	res, err := dir.ResolveRecipient(context.Background(), "Ana", RecipientEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Match != nil || len(res.Candidates) != 2 {
+		t.Fatalf("expected two candidates and no match, got %+v", res)
+	}
+	if desc := res.Describe(); !strings.Contains(desc, "Ask the user") || !strings.Contains(desc, "ana.costa@example.com") {
+		t.Errorf("unexpected description: %s", desc)
+	}
+
+	// An exact full name settles it
+	res, _ = dir.ResolveRecipient(context.Background(), "ana costa", RecipientEmail)
+	if res.Match == nil || res.Match.Address != "ana.costa@example.com" {
+		t.Errorf("expected Ana Costa, got %+v", res)
+	}
+	// Contacts without the wanted kind of address are not candidates
+	res, _ = dir.ResolveRecipient(context.Background(), "bruno", RecipientEmail)
+	if res.Match != nil || len(res.Candidates) != 0 {
+		t.Errorf("expected no email for Bruno, got %+v", res)
+	}
+}
+
+// TestContactsTool_ResolveLiteralAddress verifies an address given outright is used without a lookup
+func TestContactsTool_ResolveLiteralAddress(t *testing.T) {
+	tool := NewContactsTool(newRecipientDirectory(t))
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "resolve",
+		"query":  "Ana <ana@example.com>",
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "ana@example.com") {
+		t.Errorf("unexpected result: %s", result.ForLLM)
+	}
+}
@@ -2,17 +2,75 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/httprec"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/outage"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tracing"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/webhooks"
 )
 
 type ToolRegistry struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools          map[string]Tool
+	policies       map[string]ToolPolicy
+	roles          *Roles
+	confirmations  *Confirmations
+	clarifications *Clarifications
+	pdfPasswords   *PDFPasswords
+	chatTools      func(chat string) []string
+	mu             sync.RWMutex
+	observer       func(ToolExecution)
+	auditor        func(ToolExecution)
+	callLocks      sync.Map // tool name -> *sync.Mutex, see ExecuteWithContext
+	connectivity   Connectivity
+	deferred       *DeferredActions
+	outages        *outage.Tracker
+	outageDeferred *DeferredActions
+	googleScopes   map[string]bool
+	entities       *EntityBook
+	localOnly      func(channel, chatID string) bool
+	// version counts changes to the tools or to who may use them
+	version   uint64
+	listeners []func(ToolChange)
+}
+
+// ToolChange is what a change to a registry did, by tool name: tools
+// added, tools swapped for a new instance, and tools removed. All are
+// empty when only who may use the tools changed.
+type ToolChange struct {
+	Added    []string
+	Replaced []string
+	Removed  []string
+}
+
+// Empty reports whether the change added, replaced or removed no tool.
+func (c ToolChange) Empty() bool {
+	return len(c.Added) == 0 && len(c.Replaced) == 0 && len(c.Removed) == 0
+}
+
+// ToolExecution describes a finished tool execution, for observers such as
+// the admin dashboard.
+type ToolExecution struct {
+	Tool     string
+	Channel  string
+	ChatID   string
+	Sender   string
+	Args     map[string]interface{}
+	Result   *ToolResult
+	Started  time.Time
+	Duration time.Duration
+	// Refs are the IDs and paths a mutating call touched, as far as the
+	// tool reported them
+	Refs []string
 }
 
 func NewToolRegistry() *ToolRegistry {
@@ -21,10 +79,319 @@ func NewToolRegistry() *ToolRegistry {
 	}
 }
 
+// Register adds tool, or replaces the tool of the same name, and tells
+// the OnChange listeners. It may be called while the agent runs; the
+// next model call is offered the new set.
 func (r *ToolRegistry) Register(tool Tool) {
+	name := tool.Name()
+	var change ToolChange
+	r.mu.Lock()
+	if _, ok := r.tools[name]; ok {
+		change.Replaced = []string{name}
+	} else {
+		change.Added = []string{name}
+	}
+	r.tools[name] = tool
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, change)
+}
+
+// Unregister removes the tool name, reporting whether there was one.
+// Calls to it from then on fail as for an unknown tool.
+func (r *ToolRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	if _, ok := r.tools[name]; !ok {
+		r.mu.Unlock()
+		return false
+	}
+	delete(r.tools, name)
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, ToolChange{Removed: []string{name}})
+	return true
+}
+
+// OnChange calls fn after every change to the tools or to who may use
+// them, outside the registry's lock, so fn may use the registry.
+func (r *ToolRegistry) OnChange(fn func(ToolChange)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Version counts the changes to the tools and to who may use them, so a
+// holder of their schemas or summaries can tell when to build them again.
+func (r *ToolRegistry) Version() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// changedLocked counts a change and returns the listeners to tell.
+func (r *ToolRegistry) changedLocked() []func(ToolChange) {
+	r.version++
+	return append([]func(ToolChange){}, r.listeners...)
+}
+
+func notify(listeners []func(ToolChange), change ToolChange) {
+	for _, fn := range listeners {
+		fn(change)
+	}
+}
+
+// SetRoles limits each user's tools by their role, and holds the changes
+// of tools their role must confirm in confirmations until the user says
+// yes. Nil roles lifts the limits. Roles are kept by ReplaceWith.
+func (r *ToolRegistry) SetRoles(roles *Roles, confirmations *Confirmations) {
+	r.mu.Lock()
+	r.roles = roles
+	r.confirmations = confirmations
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, ToolChange{})
+}
+
+// SetClarifications lets tools ask the user to pick among candidates: the
+// question is kept in clarifications until the user answers it.
+func (r *ToolRegistry) SetClarifications(clarifications *Clarifications) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clarifications = clarifications
+}
+
+// SetPDFPasswords lets tools open password-protected PDFs: a call that
+// fails on one asks the user in the chat for the password, and the
+// answers kept in passwords open the files.
+func (r *ToolRegistry) SetPDFPasswords(passwords *PDFPasswords) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pdfPasswords = passwords
+}
+
+// SetEntities links the people, files and events each call in a chat
+// mentions into entities, kept in book.
+func (r *ToolRegistry) SetEntities(book *EntityBook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entities = book
+}
+
+// SetChatTools limits the tools each chat may use: fn returns the names
+// allowed in a "channel:chat_id", or nil for every tool. The sender's
+// role and the tool policies still apply.
+func (r *ToolRegistry) SetChatTools(fn func(chat string) []string) {
+	r.mu.Lock()
+	r.chatTools = fn
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, ToolChange{})
+}
+
+// SetGoogleScopes records the Google OAuth scopes granted: actions of
+// ScopedTools that need another scope are left out of the tool schemas
+// and refused. Nil scopes lift the check.
+func (r *ToolRegistry) SetGoogleScopes(scopes []string) {
+	var granted map[string]bool
+	if scopes != nil {
+		granted = make(map[string]bool, len(scopes))
+		for _, scope := range scopes {
+			granted[scope] = true
+		}
+	}
+	r.mu.Lock()
+	r.googleScopes = granted
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, ToolChange{})
+}
+
+// SetObserver registers fn to be called after every tool execution.
+func (r *ToolRegistry) SetObserver(fn func(ToolExecution)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observer = fn
+}
+
+// SetAuditor registers fn to be called after every call of a MutatingTool
+// that changes something, successful or not.
+func (r *ToolRegistry) SetAuditor(fn func(ToolExecution)) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.tools[tool.Name()] = tool
+	r.auditor = fn
+}
+
+// SetConnectivity turns on offline mode: while conn reports no internet,
+// only tools that work offline run. Changes asked for in a chat are kept
+// in deferred, when not nil, to run once the connection is back; other
+// calls are refused with an explanation for the user.
+func (r *ToolRegistry) SetConnectivity(conn Connectivity, deferred *DeferredActions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connectivity = conn
+	r.deferred = deferred
+}
+
+// SetOutages makes failures from a service the tracker finds down
+// explained as an outage. Changes asked for in a chat are kept in
+// deferred, when not nil, and made once the service is back.
+func (r *ToolRegistry) SetOutages(tracker *outage.Tracker, deferred *DeferredActions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outages = tracker
+	r.outageDeferred = deferred
+}
+
+// SetLocalOnly makes calls from chats localOnly reports on refused when
+// they would send content to an online service; see LocalTool.
+func (r *ToolRegistry) SetLocalOnly(localOnly func(channel, chatID string) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.localOnly = localOnly
+}
+
+// serviceDown reports whether service, when not empty, is down.
+func (r *ToolRegistry) serviceDown(service string) (bool, time.Time) {
+	if service == "" {
+		return false, time.Time{}
+	}
+	r.mu.RLock()
+	tracker := r.outages
+	r.mu.RUnlock()
+	return tracker.Down(service)
+}
+
+// online reports whether tools that need the internet may run.
+func (r *ToolRegistry) online() (bool, time.Time) {
+	r.mu.RLock()
+	conn := r.connectivity
+	r.mu.RUnlock()
+	if conn == nil {
+		return true, time.Time{}
+	}
+	return conn.Online()
+}
+
+// ReplaceWith swaps in the tools of other, keeping r's observer, auditor
+// and OnChange listeners, which are told what changed. Holders of r see
+// the new set from their next lookup.
+func (r *ToolRegistry) ReplaceWith(other *ToolRegistry) {
+	other.mu.RLock()
+	replacement := make(map[string]Tool, len(other.tools))
+	for name, tool := range other.tools {
+		replacement[name] = tool
+	}
+	policies := other.policies
+	scopes := other.googleScopes
+	other.mu.RUnlock()
+
+	var change ToolChange
+	r.mu.Lock()
+	for name, tool := range replacement {
+		switch old, ok := r.tools[name]; {
+		case !ok:
+			change.Added = append(change.Added, name)
+		case old != tool:
+			change.Replaced = append(change.Replaced, name)
+		}
+	}
+	for name := range r.tools {
+		if _, ok := replacement[name]; !ok {
+			change.Removed = append(change.Removed, name)
+		}
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Replaced)
+	sort.Strings(change.Removed)
+	r.tools = replacement
+	r.policies = policies
+	r.googleScopes = scopes
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, change)
+}
+
+// ApplyPolicies removes disabled tools, passes settings to tools that
+// implement ConfigurableTool and keeps the channel and user limits for
+// ExecuteWithContext and ToProviderDefsFor. Call it after registering the
+// tools. Settings a tool rejects are reported in the returned error; that
+// tool keeps its defaults.
+func (r *ToolRegistry) ApplyPolicies(policies map[string]ToolPolicy) error {
+	r.mu.Lock()
+	var change ToolChange
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		policy := policies[name]
+		tool, ok := r.tools[name]
+		if !ok {
+			continue
+		}
+		if policy.Disabled {
+			delete(r.tools, name)
+			change.Removed = append(change.Removed, name)
+			continue
+		}
+		if len(policy.Settings) == 0 {
+			continue
+		}
+		configurable, ok := tool.(ConfigurableTool)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: tool has no settings", name))
+			continue
+		}
+		if err := configurable.Configure(policy.Settings); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	r.policies = policies
+	listeners := r.changedLocked()
+	r.mu.Unlock()
+	notify(listeners, change)
+	return errors.Join(errs...)
+}
+
+// Allowed reports whether the tool name may be used by senderID on
+// channel, by the tool's policy and the sender's role.
+func (r *ToolRegistry) Allowed(name, channel, senderID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.allowedLocked(name, channel, senderID)
+}
+
+func (r *ToolRegistry) allowedLocked(name, channel, senderID string) bool {
+	policy, ok := r.policies[name]
+	return (!ok || policy.Allows(channel, senderID)) && r.roles.allows(name, channel, senderID)
+}
+
+// chatAllowsLocked reports whether the chat's tool limit, if any, lets it
+// use the tool name.
+func (r *ToolRegistry) chatAllowsLocked(name, channel, chatID string) bool {
+	if r.chatTools == nil || chatID == "" {
+		return true
+	}
+	allowed := r.chatTools(channel + ":" + chatID)
+	return allowed == nil || containsFold(allowed, name)
+}
+
+// confirmed reports whether a call may go ahead: it changes nothing, the
+// sender's role need not confirm it, or the user already said yes.
+func (r *ToolRegistry) confirmed(tool Tool, args map[string]interface{}, channel, chatID, senderID string) bool {
+	r.mu.RLock()
+	roles, confirmations := r.roles, r.confirmations
+	r.mu.RUnlock()
+	if confirmations == nil || !roles.needsConfirmation(tool.Name(), channel, senderID) {
+		return true
+	}
+	if mutating, ok := tool.(MutatingTool); ok && !mutating.Mutates(args) {
+		return true
+	}
+	return confirmations.admit(channel+":"+chatID, tool.Name(), args)
 }
 
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
@@ -57,9 +424,217 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
-	// If tool implements ContextualTool, set context
-	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
-		contextualTool.SetContext(channel, chatID)
+	// Direct calls without a channel come from picoclaw itself, not a chat
+	r.mu.RLock()
+	chatAllowed := r.chatAllowsLocked(name, channel, chatID)
+	r.mu.RUnlock()
+	if channel != "" && (!r.Allowed(name, channel, SenderFromContext(ctx)) || !chatAllowed) {
+		logger.WarnCF("tool", "Tool not allowed here",
+			map[string]interface{}{
+				"tool":    name,
+				"channel": channel,
+			})
+		return ErrorResult(fmt.Sprintf("tool %q is not available in this chat", name)).WithError(fmt.Errorf("tool not allowed"))
+	}
+	r.mu.RLock()
+	missing := scopedActions(tool, r.googleScopes)
+	r.mu.RUnlock()
+	if action, _ := args["action"].(string); action != "" && slices.Contains(missing, action) {
+		logger.WarnCF("tool", "Tool action needs an ungranted Google scope",
+			map[string]interface{}{
+				"tool":   name,
+				"action": action,
+			})
+		return scopeRefusal(name, action, tool.(ScopedTool).ActionScopes()[action])
+	}
+	if channel != "" && !r.confirmed(tool, args, channel, chatID, SenderFromContext(ctx)) {
+		logger.InfoCF("tool", "Tool call waiting for confirmation",
+			map[string]interface{}{
+				"tool":    name,
+				"channel": channel,
+			})
+		return ErrorResult(fmt.Sprintf("Not done yet: this user must confirm %s changes. Tell them exactly what you are about to do and ask them to reply yes; if they do, call %s again with the same arguments.", name, name))
+	}
+
+	// A change made before the round was cut short is reported, not redone
+	var journaled string
+	round := journaledRoundFromContext(ctx)
+	if mutating, ok := tool.(MutatingTool); ok && round != nil && mutating.Mutates(args) {
+		journaled = round.key(name, args)
+		if done, ok := round.journal.Done(ctx, journaled); ok {
+			logger.InfoCF("tool", "Tool call already made before a restart",
+				map[string]interface{}{
+					"tool":    name,
+					"channel": channel,
+				})
+			return SilentResult(fmt.Sprintf("This %s call was already made before a restart, so it was not made again. Its result was: %s", name, done))
+		}
+	}
+
+	r.mu.RLock()
+	localOnly := r.localOnly
+	r.mu.RUnlock()
+	if localOnly != nil && chatID != "" && localOnly(channel, chatID) && uploads(tool, args) {
+		logger.WarnCF("tool", "Upload refused in a local-only chat",
+			map[string]interface{}{
+				"tool":    name,
+				"channel": channel,
+			})
+		return localOnlyRefusal(name)
+	}
+
+	if online, since := r.online(); !online && !worksOffline(tool, args) {
+		r.mu.RLock()
+		deferred := r.deferred
+		r.mu.RUnlock()
+		mutating, ok := tool.(MutatingTool)
+		if deferred == nil || !ok || !mutating.Mutates(args) || channel == "" || chatID == "" {
+			return offlineRefusal(name, since)
+		}
+		err := deferred.Add(DeferredCall{Tool: name, Args: args, Channel: channel, ChatID: chatID, SenderID: SenderFromContext(ctx), Queued: time.Now()})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("There is no internet connection and this change could not be kept for later: %v. Tell the user it was not done.", err)).WithError(err)
+		}
+		result := SilentResult(fmt.Sprintf("There is no internet connection right now, so this %s change is saved and will be made as soon as the connection is back; the user will be told how it went. Tell the user it is waiting, not done.", name))
+		if journaled != "" {
+			round.journal.Record(ctx, journaled, result.ForLLM)
+		}
+		return result
+	}
+
+	ctx, calls := outage.WithCalls(ctx)
+	result := r.run(ctx, name, args, channel, chatID, asyncCallback)
+	if result.IsError {
+		if explained := r.explainOutage(ctx, tool, calls, args, channel, chatID); explained != nil {
+			if journaled != "" && !explained.IsError {
+				round.journal.Record(ctx, journaled, explained.ForLLM)
+			}
+			return explained
+		}
+	} else if journaled != "" && result.Clarify == nil {
+		round.journal.Record(ctx, journaled, result.ForLLM)
+	}
+	if result.Clarify != nil {
+		r.askUser(result, name, args, channel, chatID)
+	}
+	var locked *PDFPasswordError
+	if errors.As(result.Err, &locked) {
+		r.askPassword(result, locked, name, args, channel, chatID)
+	}
+	return result
+}
+
+// explainOutage replaces the result of a call that failed because a
+// service it reached is down: a change asked for in a chat is kept to
+// make once the service is back, anything else fails with a message
+// naming the service instead of its raw error. It returns nil when no
+// service the call reached is down.
+func (r *ToolRegistry) explainOutage(ctx context.Context, tool Tool, calls *outage.Calls, args map[string]interface{}, channel, chatID string) *ToolResult {
+	r.mu.RLock()
+	tracker, deferred := r.outages, r.outageDeferred
+	r.mu.RUnlock()
+	if tracker == nil {
+		return nil
+	}
+	for _, service := range calls.Failed() {
+		down, since := tracker.Confirm(ctx, service)
+		if !down {
+			continue
+		}
+		name := tool.Name()
+		logger.WarnCF("tool", "Tool call failed during an outage",
+			map[string]interface{}{
+				"tool":    name,
+				"service": service,
+			})
+		mutating, ok := tool.(MutatingTool)
+		if deferred != nil && ok && mutating.Mutates(args) && channel != "" && chatID != "" {
+			err := deferred.Add(DeferredCall{Tool: name, Args: args, Channel: channel, ChatID: chatID, SenderID: SenderFromContext(ctx), Service: service, Queued: time.Now()})
+			if err == nil {
+				return SilentResult(fmt.Sprintf("%s appears to be down (since %s), so this %s change is saved and will be made as soon as it is back; the user will be told how it went. Tell the user it is waiting, not done.",
+					service, since.Format("15:04"), name))
+			}
+		}
+		return ErrorResult(fmt.Sprintf("%s appears to be down (since %s). Don't retry: tell the user \"%s appears to be down (since %s)\" and what you couldn't do, not the raw error.",
+			service, since.Format("15:04"), service, since.Format("15:04"))).WithError(fmt.Errorf("%s is down", service))
+	}
+	return nil
+}
+
+// askPassword asks the user for the password of the PDF a call could not
+// open and keeps the call to run again with it. Without a chat to ask
+// in, the error is left for the model.
+func (r *ToolRegistry) askPassword(result *ToolResult, locked *PDFPasswordError, name string, args map[string]interface{}, channel, chatID string) {
+	r.mu.RLock()
+	passwords := r.pdfPasswords
+	r.mu.RUnlock()
+	if passwords == nil || channel == "" || chatID == "" {
+		return
+	}
+	passwords.ask(channel+":"+chatID, name, args, locked.hash)
+	question := "🔒 This PDF is password-protected."
+	if locked.Wrong {
+		question = "🔒 That password did not open the PDF."
+	}
+	result.ForUser = question + " Reply with its password and I'll open it, or reply cancel. The password is only kept in memory for an hour; it is not saved, logged or shown to the assistant."
+	result.Silent = false
+	result.IsError = false
+	result.Err = nil
+	result.ForLLM = fmt.Sprintf("%s. The user has been asked for the password in a separate message; when they send it, %s runs again and you will see the result. Never ask for the password yourself or call %s again for this; end your turn without repeating the request.",
+		locked.Error(), name, name)
+}
+
+// askUser shows the user the options of a result that needs a pick and
+// keeps the call to run again with it. Without a chat to ask in, the
+// result is left for the model.
+func (r *ToolRegistry) askUser(result *ToolResult, name string, args map[string]interface{}, channel, chatID string) {
+	r.mu.RLock()
+	clarifications := r.clarifications
+	r.mu.RUnlock()
+	if clarifications == nil || channel == "" || chatID == "" || len(result.Clarify.Choices) == 0 {
+		result.Clarify = nil
+		return
+	}
+	clarifications.ask(channel+":"+chatID, name, args, result.Clarify)
+	text := result.Clarify.text()
+	result.ForUser = text + "\nReply with a number to choose."
+	result.Silent = false
+	result.ForLLM = fmt.Sprintf("The user has been shown this question with numbered options:\n%s\nWhen they pick one, %s runs again with it and you will see the result with their reply. Don't call %s again for this or guess; end your turn without repeating the options.",
+		text, name, name)
+}
+
+// run executes a call ExecuteWithContext has admitted, or a deferred one
+// that was admitted before.
+func (r *ToolRegistry) run(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
+	tool, ok := r.Get(name)
+	if !ok {
+		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
+	}
+
+	// Tools that keep the chat or callback in fields take one call at a
+	// time, so rounds for different chats cannot swap them mid-call
+	_, contextual := tool.(ContextualTool)
+	_, async := tool.(AsyncTool)
+	if contextual || async {
+		lock, _ := r.callLocks.LoadOrStore(name, &sync.Mutex{})
+		lock.(*sync.Mutex).Lock()
+		defer lock.(*sync.Mutex).Unlock()
+	}
+
+	r.mu.RLock()
+	ctx = withPDFPasswords(ctx, r.pdfPasswords)
+	entities := r.entities
+	r.mu.RUnlock()
+	var mentions *mentionList
+	if entities != nil && channel != "" && chatID != "" {
+		ctx, mentions = withMentions(ctx)
+	}
+	if channel != "" && chatID != "" {
+		ctx = WithChat(ctx, channel, chatID)
+		// If tool implements ContextualTool, set context
+		if contextualTool, ok := tool.(ContextualTool); ok {
+			contextualTool.SetContext(channel, chatID)
+		}
 	}
 
 	// If tool implements AsyncTool and callback is provided, set callback
@@ -71,9 +646,78 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			})
 	}
 
+	ctx, span := tracing.Start(ctx, "tool."+name, tracing.String("tool", name), tracing.String("channel", channel))
+	defer span.End()
+
+	mutating, ok := tool.(MutatingTool)
+	var refs *auditRefs
+	if ok && mutating.Mutates(args) {
+		refs = &auditRefs{}
+		ctx = context.WithValue(ctx, auditRefsKey{}, refs)
+	}
+
+	ctx, recording := httprec.Start(ctx, name, args)
 	start := time.Now()
-	result := tool.Execute(ctx, args)
+	var result *ToolResult
+	emit, stopStream := streamFromContext(ctx)
+	if streaming, ok := tool.(StreamingTool); ok && emit != nil {
+		result = streaming.ExecuteStream(ctx, args, emit)
+	} else {
+		result = tool.Execute(ctx, args)
+	}
+	stopStream()
 	duration := time.Since(start)
+	if path, err := recording.Finish(); err != nil {
+		logger.WarnCF("tool", "Failed to save the HTTP recording", map[string]interface{}{"tool": name, "error": err.Error()})
+	} else if path != "" {
+		logger.DebugCF("tool", "HTTP calls recorded", map[string]interface{}{"tool": name, "file": path})
+	}
+	toolDuration.Observe(duration.Seconds(), name)
+	switch {
+	case result.IsError:
+		span.SetError(logger.Redact(utils.Truncate(result.ForLLM, 200)))
+		toolCalls.Inc(name, "error")
+		failed := map[string]interface{}{
+			"tool":    name,
+			"channel": channel,
+			"chat_id": chatID,
+			"error":   logger.Redact(utils.Truncate(result.ForLLM, 500)),
+		}
+		if action, _ := args["action"].(string); action != "" {
+			failed["action"] = action
+		}
+		webhooks.Emit(webhooks.ToolFailed, failed)
+	case result.Async:
+		toolCalls.Inc(name, "async")
+	default:
+		toolCalls.Inc(name, "ok")
+	}
+
+	r.mu.RLock()
+	observe, audit := r.observer, r.auditor
+	r.mu.RUnlock()
+	execution := ToolExecution{
+		Tool:     name,
+		Channel:  channel,
+		ChatID:   chatID,
+		Sender:   SenderFromContext(ctx),
+		Args:     args,
+		Result:   result,
+		Started:  start,
+		Duration: duration,
+	}
+	if observe != nil {
+		observe(execution)
+	}
+	if audit != nil && refs != nil {
+		execution.Refs = refs.list(args)
+		audit(execution)
+	}
+	if mentions != nil && !result.IsError {
+		if err := entities.Link(channel+":"+chatID, name, mentions.take()); err != nil {
+			logger.WarnCF("tool", "Failed to save the entities mentioned", map[string]interface{}{"tool": name, "error": err.Error()})
+		}
+	}
 
 	// Log based on result type
 	if result.IsError {
@@ -115,11 +759,35 @@ func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 // ToProviderDefs converts tool definitions to provider-compatible format.
 // This is the format expected by LLM provider APIs.
 func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
+	return r.toProviderDefs(func(string) bool { return true })
+}
+
+// ToProviderDefsFor is ToProviderDefs without the tools that senderID may
+// not use on channel, so the model is not offered them.
+func (r *ToolRegistry) ToProviderDefsFor(channel, senderID string) []providers.ToolDefinition {
+	return r.ToProviderDefsForChat(channel, "", senderID)
+}
+
+// ToProviderDefsForChat is ToProviderDefsFor with the chat's own tool
+// limit (see SetChatTools) applied too.
+func (r *ToolRegistry) ToProviderDefsForChat(channel, chatID, senderID string) []providers.ToolDefinition {
+	if channel == "" {
+		return r.ToProviderDefs()
+	}
+	return r.toProviderDefs(func(name string) bool {
+		return r.allowedLocked(name, channel, senderID) && r.chatAllowsLocked(name, channel, chatID)
+	})
+}
+
+func (r *ToolRegistry) toProviderDefs(include func(name string) bool) []providers.ToolDefinition {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
 	for _, tool := range r.tools {
+		if !include(tool.Name()) {
+			continue
+		}
 		schema := ToolToSchema(tool)
 
 		// Safely extract nested values with type checks
@@ -131,6 +799,12 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 		name, _ := fn["name"].(string)
 		desc, _ := fn["description"].(string)
 		params, _ := fn["parameters"].(map[string]interface{})
+		if missing := scopedActions(tool, r.googleScopes); len(missing) > 0 {
+			var removed []string
+			if params, removed = withoutActions(params, missing); len(removed) > 0 {
+				desc += " Turned off for lack of Google access: action " + strings.Join(removed, ", ") + "."
+			}
+		}
 
 		definitions = append(definitions, providers.ToolDefinition{
 			Type: "function",
@@ -169,9 +843,35 @@ func (r *ToolRegistry) GetSummaries() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	summaries := make([]string, 0, len(r.tools))
-	for _, tool := range r.tools {
-		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", tool.Name(), tool.Description()))
+	return r.summariesLocked(func(string) bool { return true })
+}
+
+// SummariesForChat is GetSummaries for the tools ToProviderDefsForChat
+// offers, so the prompt lists the tools the model can call.
+func (r *ToolRegistry) SummariesForChat(channel, chatID, senderID string) []string {
+	if channel == "" {
+		return r.GetSummaries()
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.summariesLocked(func(name string) bool {
+		return r.allowedLocked(name, channel, senderID) && r.chatAllowsLocked(name, channel, chatID)
+	})
+}
+
+// summariesLocked returns the summaries of the tools include accepts,
+// sorted by name.
+func (r *ToolRegistry) summariesLocked(include func(name string) bool) []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		if include(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	summaries := make([]string, 0, len(names))
+	for _, name := range names {
+		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", name, r.tools[name].Description()))
 	}
 	return summaries
 }
@@ -0,0 +1,566 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const reportJobKind = "report"
+
+// Google types Drive converts uploaded HTML and CSV to.
+const (
+	googleDocType   = "application/vnd.google-apps.document"
+	googleSheetType = "application/vnd.google-apps.spreadsheet"
+)
+
+// reportPeriods are how often a report can run, and so the span each
+// run covers: the day, week or month that just ended.
+var reportPeriods = []string{"daily", "weekly", "monthly"}
+
+// ReportRequest is the period one run of a report covers.
+type ReportRequest struct {
+	Channel string
+	ChatID  string
+	// From and To bound the period, To exclusive
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+	Locale   string
+}
+
+// Report is what a report source produces: a few summary lines and a
+// table. Docs show both; Sheets get the table.
+type Report struct {
+	Title   string
+	Period  string
+	Summary []string
+	Columns []string
+	Rows    [][]string
+}
+
+// ReportSource builds one kind of report. Sources backed by accounts or
+// tools (email, expenses, backups) are registered when those are set up.
+type ReportSource interface {
+	Name() string
+	Title() string
+	Build(ctx context.Context, req ReportRequest) (*Report, error)
+}
+
+// ReportTool renders reports as Google Docs or Sheets in a Drive folder,
+// on demand or on a schedule, and links them in chat. The Doc layout is
+// an HTML template that can be replaced per report by a file in the
+// workspace (reports/templates/<name>.html).
+type ReportTool struct {
+	drive       *GoogleDriveClient
+	folderID    string
+	format      string
+	templateDir string
+	profiles    *profile.Store
+	scheduler   *cron.CronService
+	mu          sync.RWMutex
+	sources     map[string]ReportSource
+	now         func() time.Time
+}
+
+// NewReportTool creates the tool. Reports are saved to folderID (My Drive
+// when empty) as format, "doc" or "sheet", unless a schedule says
+// otherwise.
+func NewReportTool(token TokenFunc, folderID, format, workspace string, profiles *profile.Store) *ReportTool {
+	if format == "" {
+		format = "doc"
+	}
+	return &ReportTool{
+		drive:       NewGoogleDriveClient(token),
+		folderID:    folderID,
+		format:      format,
+		templateDir: filepath.Join(workspace, "reports", "templates"),
+		profiles:    profiles,
+		sources:     make(map[string]ReportSource),
+		now:         time.Now,
+	}
+}
+
+// RegisterSource makes a kind of report available.
+func (t *ReportTool) RegisterSource(source ReportSource) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sources[source.Name()] = source
+}
+
+func (t *ReportTool) source(name string) (ReportSource, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s, ok := t.sources[name]
+	return s, ok
+}
+
+func (t *ReportTool) sourceNames() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.sources))
+	for name := range t.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *ReportTool) Name() string {
+	return "reports"
+}
+
+func (t *ReportTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "run", "schedule", "remove")
+}
+
+func (t *ReportTool) Description() string {
+	return "Recurring reports saved to Google Drive as a Google Doc or Sheet and linked in chat: " + strings.Join(t.sourceNames(), ", ") + ". run makes one now for the period that just ended; schedule repeats it daily, weekly or monthly; list and remove manage schedules."
+}
+
+func (t *ReportTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"run", "schedule", "list", "remove"},
+			},
+			"report": map[string]interface{}{
+				"type":        "string",
+				"enum":        t.sourceNames(),
+				"description": "Which report (run, schedule, remove)",
+			},
+			"every": map[string]interface{}{
+				"type":        "string",
+				"enum":        reportPeriods,
+				"description": "How often, and so the period each report covers (default weekly)",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"doc", "sheet"},
+				"description": "Google Doc or Google Sheet (default " + t.format + ")",
+			},
+			"time": map[string]interface{}{
+				"type":        "string",
+				"description": "schedule: time of day HH:MM in the user's timezone (default 08:00); weekly reports run on Mondays, monthly ones on the 1st",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ReportTool) JobKinds() []string {
+	return []string{reportJobKind}
+}
+
+func (t *ReportTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *ReportTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	action, _ := args["action"].(string)
+	name, _ := args["report"].(string)
+	data := map[string]string{"report": name, "every": "weekly", "format": t.format, "time": "08:00"}
+	for _, key := range []string{"every", "format", "time"} {
+		if v, _ := args[key].(string); strings.TrimSpace(v) != "" {
+			data[key] = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	if action == "run" || action == "schedule" {
+		if _, ok := t.source(name); !ok {
+			return ErrorResult(fmt.Sprintf("unknown report %q; available: %s", name, strings.Join(t.sourceNames(), ", ")))
+		}
+		if !containsString(reportPeriods, data["every"]) {
+			return ErrorResult("every must be daily, weekly or monthly")
+		}
+		if data["format"] != "doc" && data["format"] != "sheet" {
+			return ErrorResult("format must be doc or sheet")
+		}
+	}
+
+	switch action {
+	case "run":
+		msg, err := t.render(ctx, channel, chatID, data)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return NewToolResult(msg)
+
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("reports cannot be scheduled (scheduler not running)")
+		}
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		clock, err := time.Parse("15:04", data["time"])
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid time %q (expected HH:MM)", data["time"]))
+		}
+		expr := fmt.Sprintf("%d %d * * *", clock.Minute(), clock.Hour())
+		switch data["every"] {
+		case "weekly":
+			expr = fmt.Sprintf("%d %d * * 1", clock.Minute(), clock.Hour())
+		case "monthly":
+			expr = fmt.Sprintf("%d %d 1 * *", clock.Minute(), clock.Hour())
+		}
+		if existing := t.findJob(channel, chatID, name); existing != nil {
+			t.scheduler.RemoveJob(existing.ID)
+		}
+		var tz string
+		if t.profiles != nil {
+			tz = t.profiles.Get(channel + ":" + chatID).Timezone
+		}
+		source, _ := t.source(name)
+		job, err := t.scheduler.AddJobWithPayload(source.Title(), cron.CronSchedule{Kind: "cron", Expr: expr, TZ: tz},
+			cron.CronPayload{
+				Kind:    reportJobKind,
+				Message: source.Title(),
+				Channel: channel,
+				To:      chatID,
+				Data:    data,
+			})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule the report: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Scheduled: %s (id: %s)", describeReportJob(data, tz), job.ID))
+
+	case "list":
+		jobs := t.jobs(channel, chatID)
+		if len(jobs) == 0 {
+			return SilentResult("No reports scheduled for this chat.")
+		}
+		var lines []string
+		for _, job := range jobs {
+			lines = append(lines, "- "+describeReportJob(job.Payload.Data, job.Schedule.TZ))
+		}
+		return SilentResult(strings.Join(lines, "\n"))
+
+	case "remove":
+		job := t.findJob(channel, chatID, name)
+		if job == nil {
+			return ErrorResult(fmt.Sprintf("no %s report is scheduled for this chat", name))
+		}
+		t.scheduler.RemoveJob(job.ID)
+		return SilentResult(fmt.Sprintf("Stopped the %s report.", name))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func describeReportJob(data map[string]string, tz string) string {
+	when := "every day"
+	switch data["every"] {
+	case "weekly":
+		when = "every Monday"
+	case "monthly":
+		when = "on the 1st of every month"
+	}
+	return fmt.Sprintf("%s report, %s at %s%s, as a Google %s", data["report"], when, data["time"], tzSuffix(tz), map[string]string{"doc": "Doc", "sheet": "Sheet"}[data["format"]])
+}
+
+func (t *ReportTool) jobs(channel, chatID string) []cron.CronJob {
+	if t.scheduler == nil {
+		return nil
+	}
+	var jobs []cron.CronJob
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == reportJobKind && job.Payload.Channel == channel && job.Payload.To == chatID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func (t *ReportTool) findJob(channel, chatID, name string) *cron.CronJob {
+	for _, job := range t.jobs(channel, chatID) {
+		if job.Payload.Data["report"] == name {
+			return &job
+		}
+	}
+	return nil
+}
+
+// ExecuteJob implements ScheduledTool.
+func (t *ReportTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.render(WithChat(ctx, job.Payload.Channel, job.Payload.To), job.Payload.Channel, job.Payload.To, job.Payload.Data)
+}
+
+// render builds the report for the period that just ended, uploads it and
+// returns the chat message linking it.
+func (t *ReportTool) render(ctx context.Context, channel, chatID string, data map[string]string) (string, error) {
+	source, ok := t.source(data["report"])
+	if !ok {
+		return "", fmt.Errorf("the %s report is not available (is its tool still enabled?)", data["report"])
+	}
+	loc, tag := time.Local, LocaleFromContext(ctx)
+	if t.profiles != nil {
+		prof := t.profiles.Get(channel + ":" + chatID)
+		loc = prof.Location()
+		if prof.Locale != "" {
+			tag = prof.Locale
+		}
+		tag = locale.WithPreferences(tag, prof.Clock, prof.Units)
+	}
+	from, to := reportPeriod(t.now().In(loc), data["every"])
+	report, err := source.Build(ctx, ReportRequest{Channel: channel, ChatID: chatID, From: from, To: to, Location: loc, Locale: tag})
+	if err != nil {
+		return "", fmt.Errorf("failed to build the %s report: %w", data["report"], err)
+	}
+	if report.Title == "" {
+		report.Title = source.Title()
+	}
+	last := to.AddDate(0, 0, -1)
+	report.Period = locale.Date(from, tag)
+	if !last.Equal(from) {
+		report.Period += " – " + locale.Date(last, tag)
+	}
+
+	name := fmt.Sprintf("%s %s", report.Title, from.Format("2006-01-02"))
+	var file *DriveFile
+	if data["format"] == "sheet" {
+		body, err := reportCSV(report)
+		if err != nil {
+			return "", err
+		}
+		file, err = t.drive.UploadConverted(ctx, t.folderID, name, "text/csv", googleSheetType, body)
+		if err != nil {
+			return "", fmt.Errorf("failed to save the report to Drive: %w", err)
+		}
+	} else {
+		body, err := t.reportHTML(data["report"], report)
+		if err != nil {
+			return "", err
+		}
+		file, err = t.drive.UploadConverted(ctx, t.folderID, name, "text/html", googleDocType, body)
+		if err != nil {
+			return "", fmt.Errorf("failed to save the report to Drive: %w", err)
+		}
+	}
+	msg := fmt.Sprintf("📊 %s, %s: %s", report.Title, report.Period, file.WebViewLink)
+	if len(report.Summary) > 0 {
+		msg += "\n" + strings.Join(report.Summary, "\n")
+	}
+	return msg, nil
+}
+
+// reportPeriod is the day, week (Monday to Sunday) or month before now.
+func reportPeriod(now time.Time, every string) (time.Time, time.Time) {
+	today := midnightOf(now)
+	switch every {
+	case "daily":
+		return today.AddDate(0, 0, -1), today
+	case "monthly":
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return first.AddDate(0, -1, 0), first
+	}
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	return monday.AddDate(0, 0, -7), monday
+}
+
+// defaultReportTemplate lays a report out as a Google Doc.
+const defaultReportTemplate = `<html><body>
+<h1>{{.Title}}</h1>
+<p><i>{{.Period}}</i></p>
+{{range .Summary}}<p>{{.}}</p>
+{{end}}{{if .Rows}}<table border="1" cellpadding="4">
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{end}}
+</body></html>`
+
+// reportHTML renders a report with its template from the workspace, or
+// the default one.
+func (t *ReportTool) reportHTML(name string, report *Report) ([]byte, error) {
+	text := defaultReportTemplate
+	if custom, err := os.ReadFile(filepath.Join(t.templateDir, name+".html")); err == nil {
+		text = string(custom)
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("report template %s.html: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, report); err != nil {
+		return nil, fmt.Errorf("report template %s.html: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func reportCSV(report *Report) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(report.Columns)
+	w.WriteAll(report.Rows)
+	return buf.Bytes(), w.Error()
+}
+
+// EmailStatsReport counts the mail received in the period, how much is
+// still unread, and who sent the most.
+type EmailStatsReport struct {
+	gmail *GmailClient
+}
+
+func NewEmailStatsReport(token TokenFunc) *EmailStatsReport {
+	return &EmailStatsReport{gmail: NewGmailClient(token)}
+}
+
+func (s *EmailStatsReport) Name() string  { return "email_stats" }
+func (s *EmailStatsReport) Title() string { return "Email stats" }
+
+// emailStatsMax is the most messages one report reads, Gmail's page size.
+const emailStatsMax = 500
+
+func (s *EmailStatsReport) Build(ctx context.Context, req ReportRequest) (*Report, error) {
+	messages, err := s.gmail.SearchSummaries(ctx, "in:inbox "+GmailDateQuery(req.From, req.To), emailStatsMax)
+	if err != nil {
+		return nil, err
+	}
+	type counts struct {
+		name          string
+		total, unread int
+	}
+	bySender := map[string]*counts{}
+	unread, bulk := 0, 0
+	for _, m := range messages {
+		addr := strings.ToLower(senderAddress(m.From))
+		c := bySender[addr]
+		if c == nil {
+			c = &counts{name: senderName(m.From)}
+			bySender[addr] = c
+		}
+		c.total++
+		if containsString(m.Labels, "UNREAD") {
+			c.unread++
+			unread++
+		}
+		if m.Bulk {
+			bulk++
+		}
+	}
+	senders := make([]*counts, 0, len(bySender))
+	for _, c := range bySender {
+		senders = append(senders, c)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		if senders[i].total != senders[j].total {
+			return senders[i].total > senders[j].total
+		}
+		return senders[i].name < senders[j].name
+	})
+
+	received := fmt.Sprint(len(messages))
+	if len(messages) == emailStatsMax {
+		received = "At least " + received
+	}
+	report := &Report{
+		Summary: []string{
+			fmt.Sprintf("%s messages received, %d still unread, %d from mailing lists.", received, unread, bulk),
+		},
+		Columns: []string{"Sender", "Messages", "Unread"},
+	}
+	for i, c := range senders {
+		if i == 20 {
+			break
+		}
+		report.Rows = append(report.Rows, []string{c.name, fmt.Sprint(c.total), fmt.Sprint(c.unread)})
+	}
+	return report, nil
+}
+
+// ExpenseReport totals the expenses of the period by category.
+type ExpenseReport struct {
+	ledger   ExpenseLedger
+	currency string
+}
+
+func NewExpenseReport(ledger ExpenseLedger, currency string) *ExpenseReport {
+	return &ExpenseReport{ledger: ledger, currency: currency}
+}
+
+func (s *ExpenseReport) Name() string  { return "expenses" }
+func (s *ExpenseReport) Title() string { return "Expense summary" }
+
+func (s *ExpenseReport) Build(ctx context.Context, req ReportRequest) (*Report, error) {
+	expenses, err := s.ledger.List(ctx, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	type total struct {
+		count int
+		cents int64
+	}
+	byCategory := map[string]*total{}
+	var sum int64
+	for _, e := range expenses {
+		category := e.Category
+		if category == "" {
+			category = "other"
+		}
+		if byCategory[category] == nil {
+			byCategory[category] = &total{}
+		}
+		byCategory[category].count++
+		byCategory[category].cents += e.Cents
+		sum += e.Cents
+	}
+	categories := make([]string, 0, len(byCategory))
+	for c := range byCategory {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return byCategory[categories[i]].cents > byCategory[categories[j]].cents
+	})
+	report := &Report{
+		Summary: []string{fmt.Sprintf("%d expenses, %s in total.", len(expenses), formatCents(sum, s.currency))},
+		Columns: []string{"Category", "Expenses", "Total"},
+	}
+	for _, c := range categories {
+		report.Rows = append(report.Rows, []string{c, fmt.Sprint(byCategory[c].count), formatCents(byCategory[c].cents, s.currency)})
+	}
+	return report, nil
+}
+
+// BackupReport lists the chat's scheduled backups and how their last runs
+// went.
+type BackupReport struct {
+	backups *BackupTool
+}
+
+func NewBackupReport(backups *BackupTool) *BackupReport {
+	return &BackupReport{backups: backups}
+}
+
+func (s *BackupReport) Name() string  { return "backup_status" }
+func (s *BackupReport) Title() string { return "Backup status" }
+
+func (s *BackupReport) Build(ctx context.Context, req ReportRequest) (*Report, error) {
+	jobs := s.backups.jobs(req.Channel, req.ChatID)
+	report := &Report{
+		Summary: []string{fmt.Sprintf("%d backups scheduled.", len(jobs))},
+		Columns: []string{"Backup", "What", "Last run", "Result"},
+	}
+	for _, job := range jobs {
+		last := "never"
+		if job.State.LastRunAtMS != nil {
+			last = locale.DateTime(time.UnixMilli(*job.State.LastRunAtMS).In(req.Location), req.Locale)
+		}
+		report.Rows = append(report.Rows, []string{job.Payload.Data["name"], describeBackup(job.Payload.Data), last, s.backups.lastRun(job.Payload.Data)})
+	}
+	return report, nil
+}
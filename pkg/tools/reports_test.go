@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestReportTool_RendersToDriveAndSchedules verifies reports cover the period that just ended, are saved as converted Docs or Sheets with a workspace template, and are scheduled once per chat
+func TestReportTool_RendersToDriveAndSchedules(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	workspace := t.TempDir()
+	tool := NewReportTool(testkit.Token, "reports-folder", "doc", workspace, nil)
+	// Wednesday 6 May 2026; last week is 27 April to 3 May
+	tool.now = func() time.Time { return time.Date(2026, 5, 6, 9, 0, 0, 0, time.Local) }
+	tool.RegisterSource(NewEmailStatsReport(testkit.Token))
+	tool.RegisterSource(NewExpenseReport(&memoryLedger{expenses: []Expense{
+		{Cents: 1250, Category: "food"},
+		{Cents: 4000, Category: "transport"},
+		{Cents: 750, Category: "food"},
+	}}, "EUR"))
+	g.AddEmail(testkit.Email{From: "Ana <ana@example.com>", Subject: "Hi", Labels: []string{"INBOX", "UNREAD"}, Date: time.Date(2026, 4, 28, 10, 0, 0, 0, time.Local)})
+	g.AddEmail(testkit.Email{From: "Ana <ana@example.com>", Subject: "Again", Labels: []string{"INBOX"}, Date: time.Date(2026, 4, 29, 10, 0, 0, 0, time.Local)})
+	g.AddEmail(testkit.Email{From: "Bo <bo@example.com>", Subject: "Too new", Labels: []string{"INBOX"}, Date: time.Date(2026, 5, 5, 10, 0, 0, 0, time.Local)})
+
+	ctx := WithChat(context.Background(), "telegram", "42")
+	r := tool.Execute(ctx, map[string]interface{}{"action": "run", "report": "email_stats"})
+	if r.IsError {
+		t.Fatalf("run failed: %s", r.ForLLM)
+	}
+	if !strings.Contains(r.ForLLM, "Email stats, Mon 27 Apr 2026 – Sun 3 May 2026: https://drive.google.com/") || !strings.Contains(r.ForLLM, "2 messages received, 1 still unread") {
+		t.Errorf("unexpected message: %s", r.ForLLM)
+	}
+
+	os.MkdirAll(filepath.Join(workspace, "reports", "templates"), 0755)
+	os.WriteFile(filepath.Join(workspace, "reports", "templates", "expenses.html"), []byte(`<p>Spent: {{index .Summary 0}}</p>`), 0644)
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "run", "report": "expenses"}); r.IsError {
+		t.Fatalf("run failed: %s", r.ForLLM)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "run", "report": "expenses", "format": "sheet", "every": "monthly"}); r.IsError {
+		t.Fatalf("run failed: %s", r.ForLLM)
+	}
+
+	files := g.Files()
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+	stats, doc, sheet := files[0], files[1], files[2]
+	if stats.Name != "Email stats 2026-04-27" || stats.MimeType != googleDocType || stats.Parent != "reports-folder" ||
+		!strings.Contains(string(stats.Content), "<td>Ana</td><td>2</td><td>1</td>") {
+		t.Errorf("unexpected email stats doc: %s %s %s", stats.Name, stats.MimeType, stats.Content)
+	}
+	if doc.MimeType != googleDocType || string(doc.Content) != "<p>Spent: 3 expenses, 60.00 EUR in total.</p>" {
+		t.Errorf("template not used: %s", doc.Content)
+	}
+	if sheet.Name != "Expense summary 2026-04-01" || sheet.MimeType != googleSheetType ||
+		string(sheet.Content) != "Category,Expenses,Total\ntransport,1,40.00 EUR\nfood,2,20.00 EUR\n" {
+		t.Errorf("unexpected sheet %s: %q", sheet.Name, sheet.Content)
+	}
+
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool.SetScheduler(cs)
+	for _, every := range []string{"daily", "monthly"} {
+		if r := tool.Execute(ctx, map[string]interface{}{"action": "schedule", "report": "expenses", "every": every, "time": "18:30"}); r.IsError {
+			t.Fatalf("schedule failed: %s", r.ForLLM)
+		}
+	}
+	jobs := tool.jobs("telegram", "42")
+	if len(jobs) != 1 || jobs[0].Schedule.Expr != "30 18 1 * *" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(r.ForLLM, "expenses report, on the 1st of every month at 18:30, as a Google Doc") {
+		t.Errorf("unexpected list: %s", r.ForLLM)
+	}
+	msg, err := tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil || !strings.HasPrefix(msg, "📊 Expense summary, Wed 1 Apr 2026 – Thu 30 Apr 2026: ") {
+		t.Errorf("job run: %q %v", msg, err)
+	}
+}
@@ -0,0 +1,28 @@
+package tools
+
+import "fmt"
+
+// LocalTool is implemented by tools that change something online without
+// sending a chat's content anywhere it was not, such as a reply in the
+// same chat, so those calls still run in local-only chats.
+type LocalTool interface {
+	KeepsLocal(args map[string]interface{}) bool
+}
+
+// uploads reports whether a call would send content to an online service:
+// it changes something, needs the internet and is not kept local.
+func uploads(tool Tool, args map[string]interface{}) bool {
+	mutating, ok := tool.(MutatingTool)
+	if !ok || !mutating.Mutates(args) || worksOffline(tool, args) {
+		return false
+	}
+	local, ok := tool.(LocalTool)
+	return !ok || !local.KeepsLocal(args)
+}
+
+// localOnlyRefusal tells the model a call was refused because the chat
+// is local-only.
+func localOnlyRefusal(name string) *ToolResult {
+	return ErrorResult(fmt.Sprintf("This chat is local-only: nothing said in it may be sent to online services, so %s can't make this change. Don't retry or look for another way: tell the user it was not done and why.", name)).
+		WithError(fmt.Errorf("local-only chat"))
+}
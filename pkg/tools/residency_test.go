@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestRegistry_LocalOnlyRefusesUploads verifies that in a local-only chat
+// changes to online services are refused while reads, local tools and
+// replies in the same chat still run, and other chats are unaffected
+func TestRegistry_LocalOnlyRefusesUploads(t *testing.T) {
+	dir := t.TempDir()
+	calendar := &fakeCalendar{}
+	var sent []string
+	message := NewMessageTool()
+	message.SetSendCallback(func(channel, chatID, content string) error {
+		sent = append(sent, channel+":"+chatID)
+		return nil
+	})
+	registry := NewToolRegistry()
+	registry.Register(calendar)
+	registry.Register(message)
+	registry.Register(NewListDirTool(dir, true))
+	registry.SetLocalOnly(func(channel, chatID string) bool { return channel+":"+chatID == "telegram:42" })
+	ctx := context.Background()
+
+	result := registry.ExecuteWithContext(ctx, "calendar", map[string]interface{}{"action": "create", "title": "Clinic"}, "telegram", "42", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "local-only") || len(calendar.created) != 0 {
+		t.Errorf("upload not refused: %+v, created %v", result, calendar.created)
+	}
+	if result := registry.ExecuteWithContext(ctx, "calendar", map[string]interface{}{"action": "list"}, "telegram", "42", nil); result.IsError {
+		t.Errorf("read refused: %s", result.ForLLM)
+	}
+	if result := registry.ExecuteWithContext(ctx, "list_dir", map[string]interface{}{"path": dir}, "telegram", "42", nil); result.IsError {
+		t.Errorf("local tool refused: %s", result.ForLLM)
+	}
+	if result := registry.ExecuteWithContext(ctx, "message", map[string]interface{}{"content": "hi"}, "telegram", "42", nil); result.IsError {
+		t.Errorf("reply in the chat refused: %s", result.ForLLM)
+	}
+	result = registry.ExecuteWithContext(ctx, "message", map[string]interface{}{"content": "hi", "channel": "telegram", "chat_id": "7"}, "telegram", "42", nil)
+	if !result.IsError || len(sent) != 1 || sent[0] != "telegram:42" {
+		t.Errorf("message to another chat not refused: %+v, sent %v", result, sent)
+	}
+	if result := registry.ExecuteWithContext(ctx, "calendar", map[string]interface{}{"action": "create", "title": "Lunch"}, "telegram", "7", nil); result.IsError {
+		t.Errorf("other chat refused: %s", result.ForLLM)
+	}
+}
@@ -23,10 +23,17 @@ type ToolResult struct {
 	// When true, the result should be treated as an error.
 	IsError bool `json:"is_error"`
 
+	// Media lists local image files to show the user, such as a preview
+	// collage. They are sent even when ForUser is empty, unless Silent.
+	Media []string `json:"media,omitempty"`
+
 	// Async indicates whether the tool is running asynchronously.
 	// When true, the tool will complete later and notify via callback.
 	Async bool `json:"async"`
 
+	// Clarify asks the user to pick among candidates; see ClarifyResult.
+	Clarify *Clarification `json:"-"`
+
 	// Err is the underlying error (not JSON serialized).
 	// Used for internal error handling and logging.
 	Err error `json:"-"`
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles a user can have. Owners may use every tool without confirming;
+// what trusted users and guests may do is set per deployment.
+const (
+	RoleOwner   = "owner"
+	RoleTrusted = "trusted"
+	RoleGuest   = "guest"
+)
+
+// confirmationWindow is how long a change waits for the user's yes.
+const confirmationWindow = 10 * time.Minute
+
+// RolePolicy is what users with one role may do.
+type RolePolicy struct {
+	// Tools lists the tools the role may use; empty allows every tool
+	Tools []string
+	// Confirm lists tools whose changes wait for the user to say yes
+	Confirm []string
+}
+
+// Roles assigns users their role and limits each role's tools. The
+// registry checks them for every call made from a chat.
+type Roles struct {
+	// Of returns the role of senderID on channel
+	Of       func(channel, senderID string) string
+	Policies map[string]RolePolicy
+}
+
+func (r *Roles) policy(channel, senderID string) (RolePolicy, bool) {
+	if r == nil || r.Of == nil {
+		return RolePolicy{}, false
+	}
+	role := r.Of(channel, senderID)
+	if role == RoleOwner {
+		return RolePolicy{}, false
+	}
+	return r.Policies[role], true
+}
+
+func (r *Roles) allows(name, channel, senderID string) bool {
+	p, ok := r.policy(channel, senderID)
+	return !ok || len(p.Tools) == 0 || containsFold(p.Tools, name)
+}
+
+func (r *Roles) needsConfirmation(name, channel, senderID string) bool {
+	p, ok := r.policy(channel, senderID)
+	return ok && containsFold(p.Confirm, name)
+}
+
+// Confirmations holds, per chat, the change a user was asked to confirm.
+// The user's next message answers it: a yes lets the same call through
+// once, anything else drops it.
+type Confirmations struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	tool     string
+	args     string
+	expires  time.Time
+	approved bool
+}
+
+func NewConfirmations() *Confirmations {
+	return &Confirmations{now: time.Now, pending: map[string]*pendingConfirmation{}}
+}
+
+// admit reports whether a call was confirmed, using up the confirmation.
+// Otherwise the call is remembered as the one waiting for the user.
+func (c *Confirmations) admit(chat, tool string, args map[string]interface{}) bool {
+	data, _ := json.Marshal(args)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pending[chat]; ok && p.approved && p.tool == tool && p.args == string(data) && c.now().Before(p.expires) {
+		delete(c.pending, chat)
+		return true
+	}
+	c.pending[chat] = &pendingConfirmation{tool: tool, args: string(data), expires: c.now().Add(confirmationWindow)}
+	return false
+}
+
+// Grant approves a call in chat ahead of time, for changes the user
+// already said yes to in another form, such as a plan. The returned
+// function withdraws the approval if the call did not use it.
+func (c *Confirmations) Grant(chat, tool string, args map[string]interface{}) func() {
+	data, _ := json.Marshal(args)
+	granted := &pendingConfirmation{tool: tool, args: string(data), expires: c.now().Add(confirmationWindow), approved: true}
+	c.mu.Lock()
+	c.pending[chat] = granted
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.pending[chat] == granted {
+			delete(c.pending, chat)
+		}
+	}
+}
+
+// Answer takes a user's message in chat as the reply to the change waiting
+// there, if any, and reports whether it was a yes.
+func (c *Confirmations) Answer(chat, reply string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[chat]
+	if !ok || p.approved {
+		return false
+	}
+	if !isAffirmative(reply) || !c.now().Before(p.expires) {
+		delete(c.pending, chat)
+		return false
+	}
+	p.approved = true
+	p.expires = c.now().Add(confirmationWindow)
+	return true
+}
+
+// isAffirmative recognizes a short yes in the languages picoclaw is most
+// used in.
+func isAffirmative(reply string) bool {
+	reply = strings.ToLower(strings.Trim(strings.TrimSpace(reply), ".!👍 "))
+	switch reply {
+	case "y", "yes", "yep", "yeah", "ok", "okay", "sure", "confirm", "confirmed", "go ahead", "do it",
+		"sim", "pode", "si", "sí", "oui", "ja", "是", "好", "👍":
+		return true
+	}
+	return false
+}
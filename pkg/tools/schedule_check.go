@@ -0,0 +1,403 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	// scheduleCheckMaxDays bounds the period one check covers
+	scheduleCheckMaxDays = 31
+	// relatedMailPerEvent is how many related emails are shown per event
+	relatedMailPerEvent = 2
+	// relatedMailAddresses bounds the participants searched for per event
+	relatedMailAddresses = 6
+)
+
+// changeWords in a related email suggest the meeting moved or is off.
+var changeWords = []string{"cancel", "reschedul", "postpone", "moved to", "move to", "new time", "push back", "pushed back"}
+
+// ScheduleCheckTool answers "am I double-booked?": it reads the coming
+// days of the primary calendar, finds overlapping meetings and unanswered
+// invitations, looks for the email threads about each with the same
+// people or subject, and proposes what to do. It changes nothing itself;
+// the model carries out the fixes the user picks with the calendar and
+// gmail tools.
+type ScheduleCheckTool struct {
+	calendar *GoogleCalendarClient
+	// mail is nil when Gmail is not set up; the check then skips email
+	mail     *GmailClient
+	profiles *profile.Store
+	// travel, when set, also flags meetings too far from the one before
+	travel *TravelPlanner
+	now    func() time.Time
+}
+
+func NewScheduleCheckTool(calendar *GoogleCalendarClient, mail *GmailClient, profiles *profile.Store) *ScheduleCheckTool {
+	return &ScheduleCheckTool{calendar: calendar, mail: mail, profiles: profiles, now: time.Now}
+}
+
+// SetTravel has the check flag back-to-back meetings in places too far
+// apart to get between in time.
+func (t *ScheduleCheckTool) SetTravel(p *TravelPlanner) {
+	t.travel = p
+}
+
+func (t *ScheduleCheckTool) Name() string {
+	return "schedule_check"
+}
+
+// Untrusted is true: the report quotes email subjects and snippets.
+func (t *ScheduleCheckTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ScheduleCheckTool) Description() string {
+	travel := ""
+	if t.travel != nil {
+		travel = ", meetings too far from the one before to get there in time"
+	}
+	return "Cross-check the user's upcoming calendar with their email, for questions like \"am I double-booked?\" or \"anything I need to sort out this week?\". Finds overlapping meetings, meetings during out of office" + travel + ", and invitations not answered yet; for each it finds the email threads with the same people or subject, notes threads that mention cancelling or moving, and proposes a fix. It changes nothing: ask the user before declining, moving or replying."
+}
+
+func (t *ScheduleCheckTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"period": map[string]interface{}{
+				"type":        "string",
+				"description": "Period to check, e.g. \"this week\", \"tomorrow\", \"next 3 days\" (default the next 7 days, at most 31)",
+			},
+		},
+	}
+}
+
+// scheduleIssue is an event the check found something wrong with.
+type scheduleIssue struct {
+	event    CalendarEvent
+	problems []string
+	fixes    []string
+}
+
+func (t *ScheduleCheckTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	var prof profile.Profile
+	if t.profiles != nil {
+		channel, chatID := ChatFromContext(ctx)
+		prof = t.profiles.Get(channel + ":" + chatID)
+	}
+	now := t.now().In(prof.Location())
+	from, to := now, now.AddDate(0, 0, 7)
+	if period, _ := args["period"].(string); strings.TrimSpace(period) != "" {
+		var err error
+		if from, to, err = when.Range(period, now, prof.Locale); err != nil {
+			return ErrorResult(err.Error())
+		}
+		if from.Before(now) {
+			from = now
+		}
+	}
+	if to.Sub(from) > scheduleCheckMaxDays*24*time.Hour {
+		to = from.AddDate(0, 0, scheduleCheckMaxDays)
+	}
+	if !to.After(from) {
+		return ErrorResult("that period is already over")
+	}
+
+	events, err := t.calendar.ListEvents(ctx, "primary", from, to)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the calendar: %v", err)).WithError(err)
+	}
+	tag := LocaleFromContext(ctx)
+	issues := findScheduleIssues(events, tag)
+	if t.travel != nil {
+		issues = addTravelIssues(issues, events, t.travel.tightLegs(ctx, events, tag))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Checked %d events from %s to %s.", len(events), locale.DateTime(from, tag), locale.DateTime(to, tag))
+	if len(issues) == 0 {
+		sb.WriteString(" No overlapping meetings and no unanswered invitations.")
+		return SilentResult(sb.String())
+	}
+	mailNote := ""
+	for i, issue := range issues {
+		fmt.Fprintf(&sb, "\n\n%d. %q, %s", i+1, issue.event.Summary, describeEventTime(issue.event, tag))
+		for _, p := range issue.problems {
+			sb.WriteString("\n   - " + p)
+		}
+		if t.mail != nil {
+			related, err := t.relatedMail(ctx, issue.event, now)
+			if err != nil {
+				mailNote = fmt.Sprintf("\n\n(Email could not be searched: %v)", err)
+			}
+			changed := false
+			for _, m := range related {
+				fmt.Fprintf(&sb, "\n   - related email from %s, %s: %q (id %s)", senderName(m.From), locale.Date(m.Received.In(now.Location()), tag), m.Subject, m.ID)
+				if mentionsChange(m.Subject + " " + m.Snippet) {
+					sb.WriteString(", which mentions cancelling or moving the meeting")
+					changed = true
+				}
+			}
+			if changed {
+				issue.fixes = append([]string{"read the email first: the meeting may have changed and the calendar be out of date"}, issue.fixes...)
+			}
+		}
+		for _, f := range issue.fixes {
+			sb.WriteString("\n   Proposed: " + f)
+		}
+	}
+	sb.WriteString(mailNote)
+	return SilentResult(sb.String())
+}
+
+// findScheduleIssues flags the events that overlap another meeting or an
+// out of office block, and the invitations not answered, in start order.
+// Declined, free, all-day and focus or working location events are not
+// meetings that can clash.
+func findScheduleIssues(events []CalendarEvent, tag string) []*scheduleIssue {
+	var blocking []CalendarEvent
+	for _, ev := range events {
+		if ev.AllDay && ev.Type != EventOutOfOffice || ev.Free || ev.MyResponse() == "declined" {
+			continue
+		}
+		if ev.Type == "" || ev.Type == EventOutOfOffice {
+			blocking = append(blocking, ev)
+		}
+	}
+	sort.SliceStable(blocking, func(i, j int) bool { return blocking[i].Start.Before(blocking[j].Start) })
+
+	byID := map[string]*scheduleIssue{}
+	var order []string
+	issue := func(ev CalendarEvent) *scheduleIssue {
+		if byID[ev.ID] == nil {
+			byID[ev.ID] = &scheduleIssue{event: ev}
+			order = append(order, ev.ID)
+		}
+		return byID[ev.ID]
+	}
+
+	for i, a := range blocking {
+		for _, b := range blocking[i+1:] {
+			if !b.Start.Before(a.End) {
+				break
+			}
+			if a.Type == EventOutOfOffice && b.Type == EventOutOfOffice {
+				continue
+			}
+			if a.Type == EventOutOfOffice || b.Type == EventOutOfOffice {
+				meeting := a
+				if a.Type == EventOutOfOffice {
+					meeting = b
+				}
+				is := issue(meeting)
+				is.problems = append(is.problems, "it is during your out of office time")
+				is.fixes = append(is.fixes, declineOrMove(meeting))
+				continue
+			}
+			keep, move := pickToKeep(a, b)
+			span := fmt.Sprintf("%s–%s", locale.Time(maxTime(a.Start, b.Start), tag), locale.Time(minTime(a.End, b.End), tag))
+			issue(a).problems = append(issue(a).problems, fmt.Sprintf("overlaps %q from %s", b.Summary, span))
+			issue(b).problems = append(issue(b).problems, fmt.Sprintf("overlaps %q from %s", a.Summary, span))
+			issue(move).fixes = append(issue(move).fixes, fmt.Sprintf("keep %q and %s", keep.Summary, declineOrMove(move)))
+		}
+	}
+
+	for _, ev := range events {
+		switch ev.MyResponse() {
+		case "needsAction":
+			is := issue(ev)
+			invitedBy := ""
+			if ev.Organizer != "" {
+				invitedBy = " from " + ev.Organizer
+			}
+			is.problems = append(is.problems, "you have not answered the invitation"+invitedBy)
+			if len(is.fixes) == 0 {
+				is.fixes = append(is.fixes, "accept it, or decline it if you will not go")
+			}
+		case "tentative":
+			is := issue(ev)
+			is.problems = append(is.problems, "you answered maybe")
+		}
+	}
+
+	issues := make([]*scheduleIssue, 0, len(order))
+	for _, id := range order {
+		issues = append(issues, byID[id])
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].event.Start.Before(issues[j].event.Start) })
+	return issues
+}
+
+// addTravelIssues flags the events in tight, by ID, as too far from the
+// meeting before them, keeping issues in start order.
+func addTravelIssues(issues []*scheduleIssue, events []CalendarEvent, tight map[string]string) []*scheduleIssue {
+	for _, ev := range events {
+		reason, ok := tight[ev.ID]
+		if !ok {
+			continue
+		}
+		var is *scheduleIssue
+		for _, existing := range issues {
+			if existing.event.ID == ev.ID {
+				is = existing
+			}
+		}
+		if is == nil {
+			is = &scheduleIssue{event: ev}
+			issues = append(issues, is)
+		}
+		is.problems = append(is.problems, reason)
+		is.fixes = append(is.fixes, "join remotely, leave the meeting before early, or "+declineOrMove(ev))
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].event.Start.Before(issues[j].event.Start) })
+	return issues
+}
+
+// pickToKeep decides which of two clashing meetings to propose keeping:
+// one the user organized over an invitation, an accepted one over one not
+// answered yet, otherwise the one booked first in the day.
+func pickToKeep(a, b CalendarEvent) (keep, move CalendarEvent) {
+	rank := func(ev CalendarEvent) int {
+		switch ev.MyResponse() {
+		case "":
+			return 3
+		case "accepted":
+			return 2
+		case "tentative":
+			return 1
+		}
+		return 0
+	}
+	if rank(b) > rank(a) {
+		return b, a
+	}
+	return a, b
+}
+
+func declineOrMove(ev CalendarEvent) string {
+	if ev.MyResponse() == "" {
+		return fmt.Sprintf("move %q, telling the attendees", ev.Summary)
+	}
+	organizer := "the organizer"
+	if ev.Organizer != "" {
+		organizer = ev.Organizer
+	}
+	return fmt.Sprintf("decline %q or ask %s for another time", ev.Summary, organizer)
+}
+
+// relatedMail finds recent email with the event's participants whose
+// subject shares a word with the event's title.
+func (t *ScheduleCheckTool) relatedMail(ctx context.Context, ev CalendarEvent, now time.Time) ([]GmailSummary, error) {
+	var terms []string
+	for _, addr := range eventParticipants(ev) {
+		terms = append(terms, "from:"+addr, "to:"+addr)
+		if len(terms) >= 2*relatedMailAddresses {
+			break
+		}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	query := fmt.Sprintf("{%s} after:%d", strings.Join(terms, " "), now.AddDate(0, 0, -30).Unix())
+	found, err := t.mail.SearchSummaries(ctx, query, 10)
+	if err != nil {
+		return nil, err
+	}
+	words := titleWords(ev.Summary)
+	var related []GmailSummary
+	for _, m := range found {
+		if sharesWord(m.Subject, words) {
+			related = append(related, m)
+		}
+		if len(related) == relatedMailPerEvent {
+			break
+		}
+	}
+	return related, nil
+}
+
+// eventParticipants are the addresses of the other people in a meeting.
+func eventParticipants(ev CalendarEvent) []string {
+	seen := map[string]bool{}
+	var addrs []string
+	add := func(addr string) {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		// Resource and group calendars are not people who write email
+		if addr == "" || seen[addr] || strings.HasSuffix(addr, "calendar.google.com") {
+			return
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	self := ""
+	for _, a := range ev.Attendees {
+		if a.Self {
+			self = strings.ToLower(a.Email)
+		}
+	}
+	if !strings.EqualFold(ev.Organizer, self) {
+		add(ev.Organizer)
+	}
+	for _, a := range ev.Attendees {
+		if !a.Self {
+			add(a.Email)
+		}
+	}
+	return addrs
+}
+
+// titleWords are the words of an event title worth matching on.
+func titleWords(title string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	}) {
+		if len([]rune(w)) >= 4 && !stopTitleWords[w] {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+var stopTitleWords = map[string]bool{"meeting": true, "call": true, "sync": true, "with": true, "invitation": true, "updated": true, "weekly": true, "daily": true}
+
+func sharesWord(subject string, words []string) bool {
+	subject = strings.ToLower(subject)
+	for _, w := range words {
+		if strings.Contains(subject, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func mentionsChange(text string) bool {
+	text = strings.ToLower(text)
+	for _, w := range changeWords {
+		if strings.Contains(text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestScheduleCheckTool_FindsClashesAndUnansweredInvites verifies overlapping meetings, meetings during out of office and unanswered invitations are reported with their related email and a proposed fix
+func TestScheduleCheckTool_FindsClashesAndUnansweredInvites(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	// Wednesday 6 May 2026
+	now := time.Date(2026, 5, 6, 8, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2026, 5, day, hour, 0, 0, 0, time.UTC) }
+	me := testkit.Attendee{Email: "me@example.com", Self: true}
+
+	g.AddEvent(testkit.Event{Summary: "Team standup", Start: at(6, 10), End: at(6, 11)})
+	accepted := me
+	accepted.Response = "accepted"
+	pending := me
+	pending.Response = "needsAction"
+	g.AddEvent(testkit.Event{Summary: "Budget review", Start: at(6, 10), End: at(6, 12), Organizer: "ana@acme.com",
+		Attendees: []testkit.Attendee{pending, {Email: "ana@acme.com", Response: "accepted"}}})
+	g.AddEvent(testkit.Event{Summary: "Out of office", Start: at(8, 0), End: at(9, 0), EventType: "outOfOffice"})
+	g.AddEvent(testkit.Event{Summary: "Vendor demo", Start: at(8, 14), End: at(8, 15), Organizer: "bo@vendor.com",
+		Attendees: []testkit.Attendee{accepted, {Email: "bo@vendor.com"}}})
+	declined := me
+	declined.Response = "declined"
+	g.AddEvent(testkit.Event{Summary: "Offsite planning", Start: at(7, 9), End: at(7, 10), Organizer: "cy@acme.com",
+		Attendees: []testkit.Attendee{declined}})
+	g.AddEvent(testkit.Event{Summary: "Lunch", Start: at(7, 9), End: at(7, 10)})
+
+	g.AddEmail(testkit.Email{From: "Ana <ana@acme.com>", To: "me@example.com", Subject: "Budget review: can we reschedule?", Date: at(5, 9)})
+	g.AddEmail(testkit.Email{From: "Ana <ana@acme.com>", To: "me@example.com", Subject: "Lunch order", Date: at(5, 9)})
+
+	tool := NewScheduleCheckTool(NewGoogleCalendarClient(testkit.Token), NewGmailClient(testkit.Token), nil)
+	tool.now = func() time.Time { return now }
+	r := tool.Execute(context.Background(), map[string]interface{}{})
+	if r.IsError {
+		t.Fatalf("check failed: %s", r.ForLLM)
+	}
+	for _, want := range []string{
+		`"Team standup"`,
+		`overlaps "Budget review" from 10:00–11:00`,
+		"you have not answered the invitation from ana@acme.com",
+		`Proposed: keep "Team standup" and decline "Budget review" or ask ana@acme.com for another time`,
+		`related email from Ana, `,
+		`"Budget review: can we reschedule?"`,
+		"which mentions cancelling or moving",
+		`"Vendor demo"`,
+		"it is during your out of office time",
+	} {
+		if !strings.Contains(r.ForLLM, want) {
+			t.Errorf("report lacks %q:\n%s", want, r.ForLLM)
+		}
+	}
+	for _, unwanted := range []string{"Offsite planning", "Lunch order", `"Lunch"`} {
+		if strings.Contains(r.ForLLM, unwanted) {
+			t.Errorf("report mentions %q:\n%s", unwanted, r.ForLLM)
+		}
+	}
+}
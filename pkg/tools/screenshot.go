@@ -0,0 +1,449 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// screenshotReadingTTL is how long the actions offered for a screenshot
+// can be picked
+const screenshotReadingTTL = 24 * time.Hour
+
+const screenshotPrompt = `You read a screenshot a user sent to their assistant, as text recognized by OCR (expect broken lines and misread characters), and say what it is. Return ONLY a JSON object (no prose, no code fences):
+{"kind": "event|booking|bill|receipt|other", "title": "...", "start": "YYYY-MM-DDTHH:MM or YYYY-MM-DD or empty", "end": "same formats or empty", "timezone": "IANA zone of the place, or empty if unknown", "location": "...", "amount": 0, "currency": "ISO 4217 code or empty", "merchant": "...", "due": "YYYY-MM-DD or empty", "reference": "booking, order or invoice number, or empty", "summary": "one sentence saying what it is"}
+Rules:
+- event: an invitation or event page the user may attend; title is the event's name, start and end its times.
+- booking: a confirmation of a reservation, ticket or appointment (flight, train, hotel, restaurant, doctor); title like "Dinner at Nomad" or "Flight TP 1234 LIS → OPO", start and end its times.
+- bill: something to pay later; amount is what is due, due the date to pay by, merchant who bills.
+- receipt: something already paid; amount is the total, start the date paid, merchant the shop.
+- other: anything else.
+- Never invent dates, times or amounts that are not in the text. A date without a year is its next occurrence after today.`
+
+// screenshotReading is what was read from one screenshot, kept until the
+// user picks what to do with it.
+type screenshotReading struct {
+	ID        string
+	ChatKey   string
+	Kind      string
+	Summary   string
+	Event     *CalendarEvent
+	Amount    float64
+	Currency  string
+	Merchant  string
+	Due       time.Time
+	Reference string
+	Created   time.Time
+}
+
+// extractedScreenshot is a screenshot as the prompt describes it.
+type extractedScreenshot struct {
+	Kind      string  `json:"kind"`
+	Title     string  `json:"title"`
+	Start     string  `json:"start"`
+	End       string  `json:"end"`
+	Timezone  string  `json:"timezone"`
+	Location  string  `json:"location"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+	Merchant  string  `json:"merchant"`
+	Due       string  `json:"due"`
+	Reference string  `json:"reference"`
+	Summary   string  `json:"summary"`
+}
+
+// ScreenshotTool turns a screenshot the user sends (an invitation, a
+// booking confirmation, a bill, a receipt) into an action: it reads the
+// text with OCR, has the model say what the screenshot is, and offers the
+// actions that fit as one-tap choices: add it to the calendar, be
+// reminded of it, log the expense.
+type ScreenshotTool struct {
+	provider  providers.LLMProvider
+	model     string
+	ocr       ocr.Engine
+	workspace string
+	restrict  bool
+	profiles  *profile.Store
+	calendar  *GoogleCalendarClient
+	ledger    ExpenseLedger
+	currency  string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	readings  map[string]*screenshotReading
+	now       func() time.Time
+}
+
+func NewScreenshotTool(provider providers.LLMProvider, model string, engine ocr.Engine, workspace string, restrict bool, profiles *profile.Store) *ScreenshotTool {
+	return &ScreenshotTool{
+		provider:  provider,
+		model:     model,
+		ocr:       engine,
+		workspace: workspace,
+		restrict:  restrict,
+		profiles:  profiles,
+		readings:  make(map[string]*screenshotReading),
+		now:       time.Now,
+	}
+}
+
+// SetCalendar offers adding events and bookings to the primary calendar.
+func (t *ScreenshotTool) SetCalendar(calendar *GoogleCalendarClient) {
+	t.calendar = calendar
+}
+
+// SetLedger offers logging bills and receipts as expenses, in currency
+// unless the screenshot shows another.
+func (t *ScreenshotTool) SetLedger(ledger ExpenseLedger, currency string) {
+	t.ledger, t.currency = ledger, currency
+}
+
+func (t *ScreenshotTool) Name() string {
+	return "screenshot"
+}
+
+func (t *ScreenshotTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "read")
+}
+
+func (t *ScreenshotTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "apply")
+}
+
+func (t *ScreenshotTool) Description() string {
+	return "Turn a screenshot or photo the user sends into an action. action=read reads the image (an event invitation, a booking confirmation, a bill, a receipt) and offers the user what fits as one-tap choices: add it to the calendar, a reminder before it or before the bill is due, log it as an expense. The user's pick is applied for them. action=apply does one of the offered actions (do) for a reading (id), when the user asks for it in words. Use it when the user sends such a screenshot, or asks \"add this\" or \"remind me to pay this\" about one."
+}
+
+func (t *ScreenshotTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"read", "apply"},
+				"description": "Action to perform",
+			},
+			"image": map[string]interface{}{
+				"type":        "string",
+				"description": "read: the image, as an artifact reference (artifact:ID) or a workspace path",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "apply: the reading's ID, from read",
+			},
+			"do": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"calendar", "reminder", "expense"},
+				"description": "apply: what to do",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// JobKinds is empty: reminders are delivered jobs that the cron tool
+// sends, like the ones the user sets.
+func (t *ScreenshotTool) JobKinds() []string {
+	return nil
+}
+
+func (t *ScreenshotTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *ScreenshotTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return "", nil
+}
+
+func (t *ScreenshotTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	switch action {
+	case "read":
+		image, _ := args["image"].(string)
+		if strings.TrimSpace(image) == "" {
+			return ErrorResult("image is required")
+		}
+		return t.read(ctx, chatKey, strings.TrimSpace(image))
+	case "apply":
+		id, _ := args["id"].(string)
+		do, _ := args["do"].(string)
+		t.mu.Lock()
+		r, ok := t.readings[id]
+		t.mu.Unlock()
+		if !ok || r.ChatKey != chatKey || t.now().Sub(r.Created) > screenshotReadingTTL {
+			return ErrorResult(fmt.Sprintf("reading %q not found or expired; read the screenshot again", id))
+		}
+		return t.apply(ctx, r, do, channel, chatID)
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *ScreenshotTool) read(ctx context.Context, chatKey, image string) *ToolResult {
+	if t.ocr == nil || !t.ocr.IsAvailable() {
+		return ErrorResult("screenshots need OCR, which is not available (install tesseract and enable ocr)")
+	}
+	path, err := validatePath(image, t.workspace, t.restrict)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	text, err := t.ocr.Recognize(ctx, path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the image: %v", err)).WithError(err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return SilentResult("No text could be read from the image; ask the user what it is or for a sharper screenshot.")
+	}
+	prof := t.profiles.Get(chatKey)
+	r, err := t.extract(ctx, text, prof)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read the screenshot: %v", err)).WithError(err)
+	}
+	r.ChatKey = chatKey
+
+	t.mu.Lock()
+	for id, old := range t.readings {
+		if t.now().Sub(old.Created) > screenshotReadingTTL {
+			delete(t.readings, id)
+		}
+	}
+	t.readings[r.ID] = r
+	t.mu.Unlock()
+
+	described := t.describe(r, prof)
+	var choices []Choice
+	for _, do := range t.actions(r) {
+		choices = append(choices, Choice{
+			Label: t.actionLabel(r, do, prof),
+			Args:  map[string]interface{}{"action": "apply", "id": r.ID, "do": do},
+		})
+	}
+	if len(choices) == 0 {
+		return SilentResult(described + " Nothing to add to the calendar, remind or log was found in it.")
+	}
+	return ClarifyResult(described+" What should I do?", choices)
+}
+
+// extract has the model say what the screenshot's text is.
+func (t *ScreenshotTool) extract(ctx context.Context, text string, prof profile.Profile) (*screenshotReading, error) {
+	if len(text) > maxExtractChars {
+		text = text[:maxExtractChars]
+	}
+	loc := prof.Location()
+	now := t.now().In(loc)
+	messages := []providers.Message{
+		{Role: "system", Content: screenshotPrompt + "\n\n" + quotedDocumentNote},
+		{Role: "user", Content: fmt.Sprintf("Today is %s (user timezone %s).\n\n%s", now.Format("Monday 2006-01-02"), loc.String(), QuoteUntrusted(t.Name(), text))},
+	}
+	resp, err := t.provider.Chat(ctx, messages, nil, t.model, map[string]interface{}{
+		"max_tokens":  800,
+		"temperature": 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw := resp.Content
+	start, end := strings.Index(raw, "{"), strings.LastIndex(raw, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("model returned no reading")
+	}
+	var e extractedScreenshot
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &e); err != nil {
+		return nil, fmt.Errorf("model returned an invalid reading: %w", err)
+	}
+
+	r := &screenshotReading{
+		ID:        newPlanID(),
+		Kind:      e.Kind,
+		Summary:   strings.TrimSpace(e.Summary),
+		Amount:    e.Amount,
+		Currency:  strings.ToUpper(strings.TrimSpace(e.Currency)),
+		Merchant:  strings.TrimSpace(e.Merchant),
+		Reference: strings.TrimSpace(e.Reference),
+		Created:   t.now(),
+	}
+	if e.Start != "" && (e.Kind == "event" || e.Kind == "booking") {
+		notes := e.Reference
+		if notes != "" {
+			notes = "Reference: " + notes
+		}
+		ev, err := extractedEvent{Title: e.Title, Start: e.Start, End: e.End, Timezone: e.Timezone, Location: e.Location, Notes: notes}.toCalendarEvent(loc, now)
+		if err == nil {
+			r.Event = &ev
+		}
+	}
+	if e.Due != "" {
+		if due, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(e.Due), loc); err == nil {
+			r.Due = due
+		}
+	}
+	if r.Merchant == "" && r.Kind != "event" && r.Kind != "booking" {
+		r.Merchant = strings.TrimSpace(e.Title)
+	}
+	return r, nil
+}
+
+// actions returns what can be done with a reading, best first.
+func (t *ScreenshotTool) actions(r *screenshotReading) []string {
+	var actions []string
+	if r.Event != nil {
+		if t.calendar != nil {
+			actions = append(actions, "calendar")
+		}
+		if t.scheduler != nil && r.Event.Start.After(t.now()) {
+			actions = append(actions, "reminder")
+		}
+	}
+	if r.Kind == "bill" && !r.Due.IsZero() && t.scheduler != nil {
+		actions = append(actions, "reminder")
+	}
+	if (r.Kind == "bill" || r.Kind == "receipt") && r.Amount > 0 && t.ledger != nil {
+		actions = append(actions, "expense")
+	}
+	return actions
+}
+
+// describe says what the screenshot is, for the question.
+func (t *ScreenshotTool) describe(r *screenshotReading, prof profile.Profile) string {
+	var sb strings.Builder
+	if r.Summary != "" {
+		sb.WriteString(strings.TrimSuffix(r.Summary, "."))
+	} else {
+		sb.WriteString("The screenshot is " + r.Kind)
+	}
+	if r.Event != nil {
+		fmt.Fprintf(&sb, ": %s, %s", r.Event.Summary, describeEventTime(*r.Event, prof.FormatLocale()))
+		if r.Event.Location != "" {
+			fmt.Fprintf(&sb, " at %s", r.Event.Location)
+		}
+	}
+	if r.Amount > 0 {
+		fmt.Fprintf(&sb, ", %s", formatCents(toCents(r.Amount), t.expenseCurrency(r)))
+	}
+	if !r.Due.IsZero() {
+		fmt.Fprintf(&sb, ", due %s", locale.Date(r.Due, prof.FormatLocale()))
+	}
+	if r.Reference != "" {
+		fmt.Fprintf(&sb, " (ref. %s)", r.Reference)
+	}
+	return sb.String() + "."
+}
+
+func (t *ScreenshotTool) expenseCurrency(r *screenshotReading) string {
+	if r.Currency != "" {
+		return r.Currency
+	}
+	return t.currency
+}
+
+// reminderTime is when to remind of a reading: an hour before an event
+// with a time, at 9:00 on the day of one without, and at 9:00 the day
+// before a bill is due.
+func (t *ScreenshotTool) reminderTime(r *screenshotReading, prof profile.Profile) time.Time {
+	morning := func(day time.Time) time.Time {
+		day = day.In(prof.Location())
+		return time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, prof.Location())
+	}
+	var at time.Time
+	switch {
+	case r.Event != nil && r.Event.AllDay:
+		at = morning(r.Event.Start)
+	case r.Event != nil:
+		at = r.Event.Start.Add(-time.Hour)
+	default:
+		at = morning(r.Due.AddDate(0, 0, -1))
+	}
+	if !at.After(t.now()) {
+		// Too late for the usual time: soon, then
+		at = t.now().Add(5 * time.Minute)
+	}
+	return at
+}
+
+func (t *ScreenshotTool) reminderMessage(r *screenshotReading, prof profile.Profile) string {
+	if r.Event != nil {
+		msg := fmt.Sprintf("⏰ %s, %s", r.Event.Summary, describeEventTime(*r.Event, prof.FormatLocale()))
+		if r.Event.Location != "" {
+			msg += " at " + r.Event.Location
+		}
+		return msg
+	}
+	msg := "⏰ Pay " + r.Merchant
+	if r.Amount > 0 {
+		msg += " " + formatCents(toCents(r.Amount), t.expenseCurrency(r))
+	}
+	msg += ", due " + locale.Date(r.Due, prof.FormatLocale())
+	if r.Reference != "" {
+		msg += " (ref. " + r.Reference + ")"
+	}
+	return msg
+}
+
+// actionLabel is the choice offered for do.
+func (t *ScreenshotTool) actionLabel(r *screenshotReading, do string, prof profile.Profile) string {
+	switch do {
+	case "calendar":
+		return "Add to calendar"
+	case "reminder":
+		return "Remind me " + locale.DateTime(t.reminderTime(r, prof), prof.FormatLocale())
+	}
+	return "Log expense " + formatCents(toCents(r.Amount), t.expenseCurrency(r))
+}
+
+func (t *ScreenshotTool) apply(ctx context.Context, r *screenshotReading, do, channel, chatID string) *ToolResult {
+	offered := false
+	for _, a := range t.actions(r) {
+		offered = offered || a == do
+	}
+	if !offered {
+		return ErrorResult(fmt.Sprintf("%q cannot be done with this screenshot; it offers: %s", do, strings.Join(t.actions(r), ", ")))
+	}
+	prof := t.profiles.Get(r.ChatKey)
+	switch do {
+	case "calendar":
+		created, err := t.calendar.InsertEvent(ctx, "primary", *r.Event)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to add the event: %v", err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Added to the calendar: %s, %s %s", r.Event.Summary, describeEventTime(*r.Event, prof.FormatLocale()), created.HTMLLink))
+	case "reminder":
+		at := t.reminderTime(r, prof)
+		atMS := at.UnixMilli()
+		message := t.reminderMessage(r, prof)
+		if _, err := t.scheduler.AddJob(utils.Truncate(message, 30), cron.CronSchedule{Kind: "at", AtMS: &atMS}, message, true, channel, chatID); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to set the reminder: %v", err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Reminder set for %s.", locale.DateTime(at, prof.FormatLocale())))
+	}
+	date := t.now()
+	if r.Kind == "receipt" && r.Event != nil {
+		date = r.Event.Start
+	}
+	note := "screenshot"
+	if r.Reference != "" {
+		note += ", ref. " + r.Reference
+	}
+	category := ""
+	if r.Kind == "bill" {
+		category = "bills"
+	}
+	expense := &Expense{Date: date, Cents: toCents(r.Amount), Currency: t.expenseCurrency(r), Category: category, Merchant: r.Merchant, Note: note}
+	if err := t.ledger.Add(ctx, expense); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to log the expense: %v", err)).WithError(err)
+	}
+	out := "Logged " + formatCents(expense.Cents, expense.Currency)
+	if expense.Merchant != "" {
+		out += " at " + expense.Merchant
+	}
+	return NewToolResult(out + ".")
+}
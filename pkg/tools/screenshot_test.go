@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestScreenshotTool_OffersAndAppliesActions verifies a bill offers a reminder the day before it is due and logging the expense as one-tap choices, the pick is applied, and a booking can be added to the calendar
+func TestScreenshotTool_OffersAndAppliesActions(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "shot.png"), []byte("png"), 0644)
+	due := time.Now().AddDate(0, 0, 10)
+	provider := &staticProvider{reply: `{"kind": "bill", "title": "EDP", "amount": 42.5, "currency": "eur", "merchant": "EDP", "due": "` + due.Format("2006-01-02") + `", "reference": "FT 123", "summary": "An EDP electricity bill."}`}
+	ledger := &memoryLedger{}
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+
+	tool := NewScreenshotTool(provider, "test", fakeOCR{text: "EDP Comercial\nTotal a pagar 42,50 EUR"}, workspace, true, profile.NewStore(workspace))
+	tool.SetCalendar(NewGoogleCalendarClient(testkit.Token))
+	tool.SetLedger(ledger, "USD")
+	tool.SetScheduler(cs)
+	clarifications := NewClarifications()
+	registry := NewToolRegistry()
+	registry.Register(tool)
+	registry.SetClarifications(clarifications)
+
+	result := registry.ExecuteWithContext(context.Background(), "screenshot", map[string]interface{}{"action": "read", "image": "shot.png"}, "telegram", "42", nil)
+	labels := result.Clarify.Labels()
+	if len(labels) != 2 || !strings.HasPrefix(labels[0], "Remind me ") || !strings.HasPrefix(labels[1], "Log expense ") || !strings.Contains(result.ForUser, "An EDP electricity bill, ") {
+		t.Fatalf("unexpected question: %+v", result)
+	}
+	pick, ok := clarifications.Answer("telegram:42", "2")
+	if !ok {
+		t.Fatal("expense not picked")
+	}
+	result = registry.ExecuteWithContext(context.Background(), pick.Tool, pick.Args, "telegram", "42", nil)
+	if result.IsError || len(ledger.expenses) != 1 {
+		t.Fatalf("expense not logged: %+v", result)
+	}
+	if e := ledger.expenses[0]; e.Cents != 4250 || e.Currency != "EUR" || e.Merchant != "EDP" || e.Category != "bills" || e.Note != "screenshot, ref. FT 123" {
+		t.Errorf("unexpected expense: %+v", e)
+	}
+
+	result = registry.ExecuteWithContext(context.Background(), "screenshot", map[string]interface{}{"action": "apply", "id": pick.Args["id"], "do": "reminder"}, "telegram", "42", nil)
+	jobs := cs.ListJobs(false)
+	remindAt := time.Date(due.Year(), due.Month(), due.Day()-1, 9, 0, 0, 0, time.Local)
+	if result.IsError || len(jobs) != 1 || *jobs[0].Schedule.AtMS != remindAt.UnixMilli() || !jobs[0].Payload.Deliver || !strings.HasPrefix(jobs[0].Payload.Message, "⏰ Pay EDP") {
+		t.Errorf("unexpected reminder: %+v, %+v", result, jobs)
+	}
+
+	start := time.Now().AddDate(0, 0, 3)
+	provider.reply = `{"kind": "booking", "title": "Dinner at Nomad", "start": "` + start.Format("2006-01-02") + `T20:00", "location": "Rua Nova 5", "reference": "R-77", "summary": "A table booking."}`
+	result = registry.ExecuteWithContext(context.Background(), "screenshot", map[string]interface{}{"action": "read", "image": "shot.png"}, "telegram", "42", nil)
+	if labels := result.Clarify.Labels(); len(labels) != 2 || labels[0] != "Add to calendar" {
+		t.Fatalf("unexpected question: %+v", result)
+	}
+	pick, _ = clarifications.Answer("telegram:42", "1")
+	result = registry.ExecuteWithContext(context.Background(), pick.Tool, pick.Args, "telegram", "42", nil)
+	events := g.Events("")
+	if result.IsError || len(events) != 1 || events[0].Summary != "Dinner at Nomad" || events[0].Location != "Rua Nova 5" || events[0].Start.Hour() != 20 {
+		t.Errorf("booking not added: %+v, %+v", result, events)
+	}
+	if r := registry.ExecuteWithContext(context.Background(), "screenshot", map[string]interface{}{"action": "apply", "id": pick.Args["id"], "do": "expense"}, "telegram", "42", nil); !r.IsError {
+		t.Errorf("a booking without an amount logged an expense: %+v", r)
+	}
+}
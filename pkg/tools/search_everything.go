@@ -0,0 +1,587 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/embeddings"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	// searchSourceTimeout keeps one slow service from holding up the rest
+	searchSourceTimeout = 10 * time.Second
+	searchPerSource     = 8
+	defaultSearchLimit  = 15
+)
+
+// SearchHit is one result from a search source.
+type SearchHit struct {
+	Source  string
+	Title   string
+	Snippet string
+	URL     string
+	// Time is when the item was sent, modified or happens (zero if unknown)
+	Time time.Time
+	// Ref identifies the item for follow-up tools, e.g. "email_id=..."
+	Ref string
+}
+
+// SearchSource is one place search_everything looks.
+type SearchSource interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]SearchHit, error)
+}
+
+// DatedSearchSource is a SearchSource that can limit a search to a time
+// span itself. Hits from other sources are filtered afterwards.
+type DatedSearchSource interface {
+	SearchSource
+	SearchBetween(ctx context.Context, query string, from, to time.Time, limit int) ([]SearchHit, error)
+}
+
+// SearchEverythingTool fans a query out to every configured source in
+// parallel and returns one ranked list, so the user does not have to know
+// whether something was an email, a file, an event or a note.
+type SearchEverythingTool struct {
+	sources  []SearchSource
+	now      func() time.Time
+	profiles *profile.Store
+	channel  string
+	chatID   string
+}
+
+func NewSearchEverythingTool(sources ...SearchSource) *SearchEverythingTool {
+	return &SearchEverythingTool{sources: sources, now: time.Now}
+}
+
+// SetProfiles lets "when" be read in the user's timezone and locale.
+func (t *SearchEverythingTool) SetProfiles(store *profile.Store) {
+	t.profiles = store
+}
+
+func (t *SearchEverythingTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *SearchEverythingTool) Name() string {
+	return "search_everything"
+}
+
+func (t *SearchEverythingTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *SearchEverythingTool) Description() string {
+	names := make([]string, len(t.sources))
+	for i, s := range t.sources {
+		names[i] = s.Name()
+	}
+	return "Search everywhere at once (" + strings.Join(names, ", ") +
+		") when the user doesn't say where something is. Returns one ranked list labelled by source; use the service-specific tools to open or act on a result."
+}
+
+func (t *SearchEverythingTool) Parameters() map[string]interface{} {
+	names := make([]string, len(t.sources))
+	for i, s := range t.sources {
+		names[i] = s.Name()
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to look for, e.g. \"passport renewal\"",
+			},
+			"sources": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": names},
+				"description": "Only search these sources (default all)",
+			},
+			"when": map[string]interface{}{
+				"type":        "string",
+				"description": "Only items from this time, e.g. \"last week\", \"yesterday\", \"March\", \"past 3 days\"",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum results (default 15)",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+type sourceResult struct {
+	hits []SearchHit
+	err  error
+}
+
+func (t *SearchEverythingTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return t.ExecuteStream(ctx, args, nil)
+}
+
+// ExecuteStream searches like Execute, reporting each source's count and
+// best hit to emit as soon as that source answers.
+func (t *SearchEverythingTool) ExecuteStream(ctx context.Context, args map[string]interface{}, emit ChunkFunc) *ToolResult {
+	query, _ := args["query"].(string)
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return ErrorResult("query is required")
+	}
+	limit := defaultSearchLimit
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), 50)
+	}
+	only := make(map[string]bool)
+	names, _ := stringListArg(args, "sources")
+	for _, name := range names {
+		only[strings.ToLower(name)] = true
+	}
+
+	var selected []SearchSource
+	for _, s := range t.sources {
+		if len(only) == 0 || only[s.Name()] {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		return ErrorResult("no matching sources to search")
+	}
+	var from, to time.Time
+	if span, _ := args["when"].(string); strings.TrimSpace(span) != "" {
+		var prof profile.Profile
+		if t.profiles != nil {
+			prof = t.profiles.Get(t.channel + ":" + t.chatID)
+		}
+		var err error
+		if from, to, err = when.Range(span, t.now().In(prof.Location()), prof.Locale); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+
+	results := make([]sourceResult, len(selected))
+	var wg sync.WaitGroup
+	for i, s := range selected {
+		wg.Add(1)
+		go func(i int, s SearchSource) {
+			defer wg.Done()
+			sctx, cancel := context.WithTimeout(ctx, searchSourceTimeout)
+			defer cancel()
+			var hits []SearchHit
+			var err error
+			if dated, ok := s.(DatedSearchSource); ok && !from.IsZero() {
+				hits, err = dated.SearchBetween(sctx, query, from, to, searchPerSource)
+			} else {
+				hits, err = s.Search(sctx, query, searchPerSource)
+			}
+			// Items without a time (notes) cannot be placed, so they stay
+			kept := hits[:0]
+			for _, h := range hits {
+				if from.IsZero() || h.Time.IsZero() || !h.Time.Before(from) && h.Time.Before(to) {
+					kept = append(kept, h)
+				}
+			}
+			hits = kept
+			results[i] = sourceResult{hits: hits, err: err}
+			if emit != nil {
+				emit(sourceChunk(s.Name(), hits, err))
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	var hits []SearchHit
+	var failed []string
+	for i, r := range results {
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", selected[i].Name(), r.err))
+			continue
+		}
+		for _, h := range r.hits {
+			h.Source = selected[i].Name()
+			hits = append(hits, h)
+		}
+	}
+	rankSearchHits(hits, query, t.now())
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	var sb strings.Builder
+	if len(hits) == 0 {
+		fmt.Fprintf(&sb, "Nothing found for %q", query)
+	} else {
+		fmt.Fprintf(&sb, "%d result(s) for %q:\n", len(hits), query)
+		for i, h := range hits {
+			fmt.Fprintf(&sb, "%d. [%s] %s", i+1, h.Source, h.Title)
+			if !h.Time.IsZero() {
+				sb.WriteString(" · " + h.Time.Format("2006-01-02"))
+			}
+			if h.Ref != "" {
+				sb.WriteString(" · " + h.Ref)
+			}
+			if h.URL != "" {
+				sb.WriteString(" · " + h.URL)
+			}
+			sb.WriteString("\n")
+			if h.Snippet != "" {
+				sb.WriteString("   " + truncateSnippet(h.Snippet, 160) + "\n")
+			}
+		}
+	}
+	if len(failed) > 0 {
+		sb.WriteString("\nNot searched: " + strings.Join(failed, "; "))
+	}
+	return SilentResult(strings.TrimSuffix(sb.String(), "\n"))
+}
+
+// sourceChunk is what the user sees of one source while the others are
+// still searching: "gmail: 3 found, e.g. Passport renewal".
+func sourceChunk(source string, hits []SearchHit, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf("%s: not searched (%v)", source, err)
+	case len(hits) == 0:
+		return source + ": nothing found"
+	}
+	return fmt.Sprintf("%s: %d found, e.g. %s", source, len(hits), truncateSnippet(hits[0].Title, 60))
+}
+
+// rankSearchHits orders hits by how many query terms appear in the title
+// (weighted) and snippet, with a bonus for recent items.
+func rankSearchHits(hits []SearchHit, query string, now time.Time) {
+	terms := strings.Fields(strings.ToLower(query))
+	score := func(h SearchHit) float64 {
+		title, snippet := strings.ToLower(h.Title), strings.ToLower(h.Snippet)
+		var s float64
+		for _, term := range terms {
+			if strings.Contains(title, term) {
+				s += 2
+			} else if strings.Contains(snippet, term) {
+				s++
+			}
+		}
+		s /= float64(2 * max(len(terms), 1))
+		if !h.Time.IsZero() {
+			days := math.Abs(now.Sub(h.Time).Hours() / 24)
+			s += 0.5 / (1 + days/30)
+		}
+		return s
+	}
+	scores := make([]float64, len(hits))
+	for i, h := range hits {
+		scores[i] = score(h)
+	}
+	sort.Stable(hitsByScore{hits, scores})
+}
+
+type hitsByScore struct {
+	hits   []SearchHit
+	scores []float64
+}
+
+func (h hitsByScore) Len() int           { return len(h.hits) }
+func (h hitsByScore) Less(i, j int) bool { return h.scores[i] > h.scores[j] }
+func (h hitsByScore) Swap(i, j int) {
+	h.hits[i], h.hits[j] = h.hits[j], h.hits[i]
+	h.scores[i], h.scores[j] = h.scores[j], h.scores[i]
+}
+
+func truncateSnippet(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+// GmailSearchSource searches mail with Gmail's own query syntax.
+type GmailSearchSource struct{ gmail *GmailClient }
+
+func NewGmailSearchSource(token TokenFunc) *GmailSearchSource {
+	return &GmailSearchSource{gmail: NewGmailClient(token)}
+}
+
+func (s *GmailSearchSource) Name() string { return "gmail" }
+
+func (s *GmailSearchSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	return s.SearchBetween(ctx, query, time.Time{}, time.Time{}, limit)
+}
+
+// SearchBetween lets Gmail apply the span, so the limit is not used up by
+// older mail.
+func (s *GmailSearchSource) SearchBetween(ctx context.Context, query string, from, to time.Time, limit int) ([]SearchHit, error) {
+	if terms := GmailDateQuery(from, to); terms != "" {
+		query += " " + terms
+	}
+	msgs, err := s.gmail.SearchSummaries(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]SearchHit, len(msgs))
+	for i, m := range msgs {
+		noteMentions(ctx, personMention(m.From))
+		hits[i] = SearchHit{
+			Title:   fmt.Sprintf("%s — %s", m.Subject, m.From),
+			Snippet: m.Snippet,
+			Time:    m.Received,
+			Ref:     "email_id=" + m.ID,
+		}
+	}
+	return hits, nil
+}
+
+// DriveSearchSource searches file names and contents in Drive.
+type DriveSearchSource struct{ drive *GoogleDriveClient }
+
+func NewDriveSearchSource(token TokenFunc) *DriveSearchSource {
+	return &DriveSearchSource{drive: NewGoogleDriveClient(token)}
+}
+
+func (s *DriveSearchSource) Name() string { return "drive" }
+
+func (s *DriveSearchSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	files, err := s.drive.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]SearchHit, len(files))
+	for i, f := range files {
+		noteMentions(ctx, fileMention(f))
+		hits[i] = SearchHit{Title: f.Name, URL: f.WebViewLink, Time: f.ModifiedTime, Ref: "drive_file_id=" + f.ID}
+	}
+	return hits, nil
+}
+
+// CalendarSearchSource searches events from a year back to a year ahead.
+type CalendarSearchSource struct {
+	calendar *GoogleCalendarClient
+	now      func() time.Time
+}
+
+func NewCalendarSearchSource(token TokenFunc) *CalendarSearchSource {
+	return &CalendarSearchSource{calendar: NewGoogleCalendarClient(token), now: time.Now}
+}
+
+func (s *CalendarSearchSource) Name() string { return "calendar" }
+
+func (s *CalendarSearchSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	now := s.now()
+	events, err := s.calendar.SearchEvents(ctx, "primary", query, now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	// Events closest to today matter most
+	sort.SliceStable(events, func(i, j int) bool {
+		return math.Abs(float64(events[i].Start.Sub(now))) < math.Abs(float64(events[j].Start.Sub(now)))
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	hits := make([]SearchHit, len(events))
+	for i, ev := range events {
+		noteMentions(ctx, eventMentions(ev)...)
+		hits[i] = SearchHit{
+			Title:   ev.Summary + ", " + describeEventTime(ev, LocaleFromContext(ctx)),
+			Snippet: joinNonEmpty(" · ", ev.Location, ev.Description),
+			URL:     ev.HTMLLink,
+			Time:    ev.Start,
+		}
+	}
+	return hits, nil
+}
+
+// photoCategories maps everyday words to Google Photos content categories.
+var photoCategories = map[string]string{
+	"animal": "ANIMALS", "animals": "ANIMALS", "pet": "PETS", "pets": "PETS", "dog": "PETS", "dogs": "PETS",
+	"cat": "PETS", "cats": "PETS", "food": "FOOD", "meal": "FOOD", "receipt": "RECEIPTS", "receipts": "RECEIPTS",
+	"document": "DOCUMENTS", "documents": "DOCUMENTS", "screenshot": "SCREENSHOTS", "screenshots": "SCREENSHOTS",
+	"selfie": "SELFIES", "selfies": "SELFIES", "landscape": "LANDSCAPES", "landscapes": "LANDSCAPES",
+	"city": "CITYSCAPES", "landmark": "LANDMARKS", "landmarks": "LANDMARKS", "travel": "TRAVEL", "trip": "TRAVEL",
+	"wedding": "WEDDINGS", "birthday": "BIRTHDAYS", "birthdays": "BIRTHDAYS", "whiteboard": "WHITEBOARDS",
+	"garden": "GARDENS", "flowers": "FLOWERS", "flower": "FLOWERS", "sport": "SPORT", "sports": "SPORT",
+	"night": "NIGHT", "concert": "PERFORMANCES", "holiday": "HOLIDAYS", "holidays": "HOLIDAYS", "people": "PEOPLE",
+}
+
+// PhotosSearchSource matches album titles and, for words that name a
+// content category ("receipts", "dogs"), recent photos in that category.
+type PhotosSearchSource struct{ photos *GooglePhotosClient }
+
+func NewPhotosSearchSource(token TokenFunc) *PhotosSearchSource {
+	return &PhotosSearchSource{photos: NewGooglePhotosClient(token)}
+}
+
+func (s *PhotosSearchSource) Name() string { return "photos" }
+
+func (s *PhotosSearchSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	var hits []SearchHit
+	albums, err := s.photos.ListAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := strings.ToLower(query)
+	for _, a := range albums {
+		if strings.Contains(strings.ToLower(a.Title), q) {
+			hits = append(hits, SearchHit{Title: "Album: " + a.Title, Snippet: fmt.Sprintf("%d items", a.Count), URL: a.ProductURL})
+		}
+	}
+
+	seen := make(map[string]bool)
+	var categories []string
+	for _, word := range strings.Fields(q) {
+		if c, ok := photoCategories[word]; ok && !seen[c] {
+			seen[c] = true
+			categories = append(categories, c)
+		}
+	}
+	if len(categories) > 0 && len(hits) < limit {
+		items, err := s.photos.SearchCategories(ctx, categories, false, limit-len(hits))
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			hits = append(hits, SearchHit{
+				Title:   item.Filename,
+				Snippet: strings.ToLower(strings.Join(categories, ", ")),
+				URL:     item.ProductURL,
+				Time:    item.Created,
+			})
+		}
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// WorkspaceNotesSource greps markdown files in the workspace memory: the
+// long-term memory file or the daily notes. With an embeddings index it
+// also finds lines that mean what the query asks without sharing its
+// words.
+type WorkspaceNotesSource struct {
+	name  string
+	files func() ([]string, error)
+	index *embeddings.Index
+}
+
+// NewMemorySearchSource searches memory/MEMORY.md.
+func NewMemorySearchSource(workspace string) *WorkspaceNotesSource {
+	path := filepath.Join(workspace, "memory", "MEMORY.md")
+	return &WorkspaceNotesSource{name: "memory", files: func() ([]string, error) { return []string{path}, nil }}
+}
+
+// NewNotesSearchSource searches the daily notes, memory/YYYYMM/YYYYMMDD.md.
+func NewNotesSearchSource(workspace string) *WorkspaceNotesSource {
+	pattern := filepath.Join(workspace, "memory", "[0-9][0-9][0-9][0-9][0-9][0-9]", "*.md")
+	return &WorkspaceNotesSource{name: "notes", files: func() ([]string, error) { return filepath.Glob(pattern) }}
+}
+
+// SetIndex ranks lines by meaning as well as by words.
+func (s *WorkspaceNotesSource) SetIndex(index *embeddings.Index) {
+	s.index = index
+}
+
+func (s *WorkspaceNotesSource) Name() string { return s.name }
+
+func (s *WorkspaceNotesSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	// Newest daily notes first
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	terms := strings.Fields(strings.ToLower(query))
+
+	var lines []SearchHit
+	var matched []bool
+	for _, path := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		var date time.Time
+		if d, err := time.Parse("20060102", strings.TrimSuffix(filepath.Base(path), ".md")); err == nil {
+			date = d
+		}
+		title := filepath.Base(path)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") && len(line) > 1 {
+				title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			}
+			if line == "" {
+				continue
+			}
+			lower := strings.ToLower(line)
+			found := 0
+			for _, term := range terms {
+				if strings.Contains(lower, term) {
+					found++
+				}
+			}
+			// Every term for short queries; most of them for long ones
+			ok := found > 0 && found >= (len(terms)*2+2)/3
+			if s.index == nil && !ok {
+				continue
+			}
+			lines = append(lines, SearchHit{Title: title, Snippet: line, Time: date})
+			matched = append(matched, ok)
+		}
+		f.Close()
+		if s.index == nil && len(lines) >= limit {
+			break
+		}
+	}
+
+	if s.index != nil && len(lines) > 0 {
+		docs := make([]string, len(lines))
+		for i, l := range lines {
+			docs[i] = l.Snippet
+		}
+		ranked, err := s.index.Rank(ctx, query, docs)
+		if err == nil {
+			// Lines with the query's words first, then by meaning
+			sort.SliceStable(ranked, func(a, b int) bool {
+				return matched[ranked[a].Index] && !matched[ranked[b].Index]
+			})
+			var hits []SearchHit
+			for _, m := range ranked {
+				if len(hits) >= limit || (!matched[m.Index] && !m.Relevant) {
+					break
+				}
+				hits = append(hits, lines[m.Index])
+			}
+			return hits, nil
+		}
+		logger.WarnCF("tools", "Semantic search failed, matching words only", map[string]interface{}{
+			"source": s.name,
+			"error":  err.Error(),
+		})
+	}
+
+	var hits []SearchHit
+	for i, l := range lines {
+		if matched[i] {
+			hits = append(hits, l)
+		}
+		if len(hits) >= limit {
+			break
+		}
+	}
+	return hits, nil
+}
@@ -0,0 +1,170 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/embeddings"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+type failingSource struct{}
+
+func (failingSource) Name() string { return "broken" }
+func (failingSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	return nil, errors.New("offline")
+}
+
+// TestSearchEverythingTool_MergesSources verifies hits from every source are labelled, ranked and failures reported
+func TestSearchEverythingTool_MergesSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/drive/files":
+			if !strings.Contains(r.URL.Query().Get("q"), "fullText contains 'passport renewal'") {
+				t.Errorf("unexpected drive query %q", r.URL.Query().Get("q"))
+			}
+			w.Write([]byte(`{"files":[{"id":"f1","name":"Passport renewal form.pdf","webViewLink":"https://drive/f1","modifiedTime":"2026-10-01T10:00:00Z"}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "memory", "202610"), 0755)
+	os.WriteFile(filepath.Join(workspace, "memory", "MEMORY.md"),
+		[]byte("# Documents\n- Passport expires 2027-01, renewal takes 6 weeks\n- Car insurance renews in May\n"), 0644)
+	os.WriteFile(filepath.Join(workspace, "memory", "202610", "20261012.md"),
+		[]byte("# 2026-10-12\n- booked photo for passport renewal\n"), 0644)
+
+	drive := NewDriveSearchSource(func(ctx context.Context) (string, error) { return "tok", nil })
+	drive.drive.baseURL = server.URL + "/drive"
+	tool := NewSearchEverythingTool(drive, NewNotesSearchSource(workspace), NewMemorySearchSource(workspace), failingSource{})
+	tool.now = func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+
+	r := tool.Execute(context.Background(), map[string]interface{}{"query": "passport renewal"})
+	if r.IsError {
+		t.Fatalf("unexpected error: %s", r.ForLLM)
+	}
+	for _, want := range []string{
+		"1. [drive] Passport renewal form.pdf · 2026-10-01 · drive_file_id=f1 · https://drive/f1",
+		"[notes] 2026-10-12 · 2026-10-12",
+		"[memory] Documents",
+		"Passport expires 2027-01",
+		"Not searched: broken (offline)",
+	} {
+		if !strings.Contains(r.ForLLM, want) {
+			t.Errorf("missing %q in:\n%s", want, r.ForLLM)
+		}
+	}
+	if strings.Contains(r.ForLLM, "insurance") {
+		t.Errorf("unrelated memory line matched:\n%s", r.ForLLM)
+	}
+
+	r = tool.Execute(context.Background(), map[string]interface{}{"query": "passport", "sources": []interface{}{"memory"}})
+	if strings.Contains(r.ForLLM, "[drive]") || strings.Contains(r.ForLLM, "[notes]") || !strings.Contains(r.ForLLM, "[memory]") {
+		t.Errorf("sources filter not applied:\n%s", r.ForLLM)
+	}
+}
+
+// TestSearchEverythingTool_WhenLimitsGmailQuery verifies a natural-language span becomes Gmail date terms and filters other sources
+func TestSearchEverythingTool_WhenLimitsGmailQuery(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	g.AddEmail(testkit.Email{From: "bank@example.com", Subject: "Statement October", Date: now.AddDate(0, 0, -1)})
+	g.AddEmail(testkit.Email{From: "bank@example.com", Subject: "Statement September", Date: now.AddDate(0, -1, 0)})
+
+	tool := NewSearchEverythingTool(NewGmailSearchSource(testkit.Token))
+	tool.now = func() time.Time { return now }
+	r := tool.Execute(context.Background(), map[string]interface{}{"query": "statement", "when": "yesterday"})
+	if r.IsError || !strings.Contains(r.ForLLM, "Statement October") || strings.Contains(r.ForLLM, "September") {
+		t.Fatalf("unexpected result:\n%s", r.ForLLM)
+	}
+	var q string
+	for _, req := range g.Requests() {
+		if strings.HasSuffix(req.Path, "/messages") {
+			q = req.Query.Get("q")
+		}
+	}
+	if want := fmt.Sprintf("statement after:%d before:%d", now.AddDate(0, 0, -1).Truncate(24*time.Hour).Unix()-1, now.Truncate(24*time.Hour).Unix()); q != want {
+		t.Errorf("gmail query %q, want %q", q, want)
+	}
+
+	if r := tool.Execute(context.Background(), map[string]interface{}{"query": "statement", "when": "whenever"}); !r.IsError {
+		t.Errorf("unreadable span accepted: %s", r.ForLLM)
+	}
+}
+
+type slowSource struct {
+	name  string
+	delay time.Duration
+}
+
+func (s slowSource) Name() string { return s.name }
+func (s slowSource) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	time.Sleep(s.delay)
+	return []SearchHit{{Title: s.name + " hit about " + query}}, nil
+}
+
+// TestSearchEverythingTool_StreamsSourcesAsTheyAnswer verifies the registry streams one chunk per source, fastest first, and none after the call
+func TestSearchEverythingTool_StreamsSourcesAsTheyAnswer(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(NewSearchEverythingTool(slowSource{"notes", 0}, failingSource{}, slowSource{"drive", 50 * time.Millisecond}))
+
+	var mu sync.Mutex
+	var chunks []string
+	ctx := WithStream(context.Background(), func(chunk string) {
+		mu.Lock()
+		defer mu.Unlock()
+		chunks = append(chunks, chunk)
+	})
+	r := registry.ExecuteWithContext(ctx, "search_everything", map[string]interface{}{"query": "visa"}, "telegram", "1", nil)
+	if r.IsError || !strings.Contains(r.ForLLM, "2 result(s)") {
+		t.Fatalf("unexpected result: %s", r.ForLLM)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(chunks) != 3 || chunks[2] != "drive: 1 found, e.g. drive hit about visa" {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+	if !slices.Contains(chunks, "broken: not searched (offline)") {
+		t.Errorf("failure not streamed: %q", chunks)
+	}
+
+	// Without a listener the tool runs as before
+	if r := registry.Execute(context.Background(), "search_everything", map[string]interface{}{"query": "visa"}); r.IsError {
+		t.Fatal(r.ForLLM)
+	}
+}
+
+// TestWorkspaceNotesSource_SemanticIndex verifies that with an index, notes sharing only part of the query's words are found and exact matches still come first
+func TestWorkspaceNotesSource_SemanticIndex(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "memory"), 0755)
+	os.WriteFile(filepath.Join(workspace, "memory", "MEMORY.md"), []byte("# People\nAna's dentist is Dr. Lima\nBruno likes jazz\n# Car\nCar insurance renews in March\n"), 0644)
+
+	src := NewMemorySearchSource(workspace)
+	if hits, _ := src.Search(context.Background(), "dentists insurance", 5); len(hits) != 0 {
+		t.Fatalf("keyword search should need most terms, got %+v", hits)
+	}
+	src.SetIndex(embeddings.NewIndex(filepath.Join(workspace, "cache", "ix.json"), embeddings.NewLocal(), nil))
+	hits, err := src.Search(context.Background(), "dentists insurance", 5)
+	if err != nil || len(hits) != 2 {
+		t.Fatalf("semantic search: %+v %v", hits, err)
+	}
+	if hits, _ := src.Search(context.Background(), "jazz", 5); len(hits) == 0 || hits[0].Snippet != "Bruno likes jazz" {
+		t.Errorf("exact match not first: %+v", hits)
+	}
+}
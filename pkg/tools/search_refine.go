@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// maxRefineWords bounds how many single words of a query a Drive search
+// that found nothing tries in file names.
+const maxRefineWords = 3
+
+// broaderPhotoCategories are the categories a Photos search falls back
+// to when the ones asked for find nothing.
+var broaderPhotoCategories = map[string][]string{
+	"PETS":         {"ANIMALS"},
+	"SELFIES":      {"PEOPLE"},
+	"LANDMARKS":    {"CITYSCAPES", "TRAVEL"},
+	"CITYSCAPES":   {"LANDMARKS", "TRAVEL"},
+	"LANDSCAPES":   {"TRAVEL"},
+	"RECEIPTS":     {"DOCUMENTS"},
+	"DOCUMENTS":    {"RECEIPTS", "SCREENSHOTS", "WHITEBOARDS"},
+	"WHITEBOARDS":  {"DOCUMENTS"},
+	"SCREENSHOTS":  {"DOCUMENTS"},
+	"FLOWERS":      {"GARDENS"},
+	"GARDENS":      {"FLOWERS", "LANDSCAPES"},
+	"WEDDINGS":     {"PEOPLE"},
+	"BIRTHDAYS":    {"PEOPLE", "HOLIDAYS"},
+	"HOLIDAYS":     {"TRAVEL"},
+	"PERFORMANCES": {"NIGHT"},
+}
+
+// searchAttempt is a variation of a search that a refinement tried, and
+// how many results it found.
+type searchAttempt struct {
+	desc  string
+	found int
+}
+
+func describeAttempts(attempts []searchAttempt) string {
+	parts := make([]string, len(attempts))
+	for i, a := range attempts {
+		parts[i] = fmt.Sprintf("%s (%d)", a.desc, a.found)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// refinePhotoSearch runs search and, when it finds nothing, widens it a
+// step at a time until one finds something: both photos and videos,
+// three days either side, the whole months, broader categories, archived
+// items. A date search that fills limit is narrowed to the categories the
+// query named. The note says what was tried, "" when the search as asked
+// was used; tag formats its dates.
+func refinePhotoSearch(ctx context.Context, photos *GooglePhotosClient, search photoSearch, limit int, tag string) ([]PhotoItem, string, error) {
+	items, err := search.run(ctx, photos, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(items) >= limit {
+		if !search.byDate || len(search.named) == 0 {
+			return items, fmt.Sprintf("At least %d items matched and only the first %d are listed; a shorter span, a media type or a category would narrow it.", limit, limit), nil
+		}
+		narrow := search
+		narrow.categories = search.named
+		narrowed, err := narrow.run(ctx, photos, limit)
+		if err != nil || len(narrowed) == 0 {
+			return items, fmt.Sprintf("At least %d items matched and only the first %d are listed; none of them is classified as %s.", limit, limit, strings.ToLower(strings.Join(search.named, " or "))), nil
+		}
+		return narrowed, fmt.Sprintf("At least %d items matched those dates, so only the ones classified as %s are listed.", limit, strings.ToLower(strings.Join(search.named, " or "))), nil
+	}
+	if len(items) > 0 {
+		return items, "", nil
+	}
+
+	asked := search
+	var steps []func(*photoSearch) string
+	if search.byDate {
+		if search.mediaType != "ALL_MEDIA" {
+			steps = append(steps, func(s *photoSearch) string {
+				s.mediaType = "ALL_MEDIA"
+				return "photos and videos"
+			})
+		}
+		steps = append(steps, func(s *photoSearch) string {
+			s.from, s.to = s.from.AddDate(0, 0, -3), s.to.AddDate(0, 0, 3)
+			return fmt.Sprintf("3 days either side, %s – %s", locale.Day(s.from, tag), locale.Day(s.to, tag))
+		}, func(s *photoSearch) string {
+			first := time.Date(asked.from.Year(), asked.from.Month(), 1, 0, 0, 0, 0, asked.from.Location())
+			last := time.Date(asked.to.Year(), asked.to.Month()+1, 0, 0, 0, 0, 0, asked.to.Location())
+			if !first.Before(s.from) && !last.After(s.to) {
+				return ""
+			}
+			s.from, s.to = first, last
+			return fmt.Sprintf("the whole month, %s – %s", locale.Day(first, tag), locale.Day(last, tag))
+		})
+	} else {
+		steps = append(steps, func(s *photoSearch) string {
+			seen := map[string]bool{}
+			for _, c := range s.categories {
+				seen[c] = true
+			}
+			added := []string{}
+			for _, c := range s.categories {
+				for _, b := range broaderPhotoCategories[c] {
+					if !seen[b] {
+						seen[b] = true
+						added = append(added, b)
+					}
+				}
+			}
+			if len(added) == 0 {
+				return ""
+			}
+			s.categories = append(s.categories, added...)
+			return "also " + strings.ToLower(strings.Join(added, ", "))
+		})
+	}
+	if !search.archived {
+		steps = append(steps, func(s *photoSearch) string {
+			s.archived = true
+			return "archived items too"
+		})
+	}
+
+	var attempts []searchAttempt
+	for _, step := range steps {
+		desc := step(&search)
+		if desc == "" {
+			continue
+		}
+		items, err := search.run(ctx, photos, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		attempts = append(attempts, searchAttempt{desc: desc, found: len(items)})
+		if len(items) > 0 {
+			return items, "Nothing matched as asked, so variations were tried: " + describeAttempts(attempts) + ". Listed is what the last one found.", nil
+		}
+	}
+	if len(attempts) == 0 {
+		return nil, "", nil
+	}
+	return nil, "Also tried " + describeAttempts(attempts) + ".", nil
+}
+
+// refineDriveSearch searches Drive for query and, when nothing matches,
+// tries file names with all of its words and then with each of the
+// longest ones alone, stopping at the first that finds something. A
+// search that fills limit is narrowed to the files with the whole query
+// in their name. The note says what was tried, "" when the search as
+// asked was used.
+func refineDriveSearch(ctx context.Context, drive *GoogleDriveClient, query string, limit int) ([]DriveFile, string, error) {
+	files, err := drive.Search(ctx, query, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) >= limit {
+		named, err := drive.SearchNames(ctx, []string{query}, limit)
+		if err != nil || len(named) == 0 || len(named) >= limit {
+			return files, fmt.Sprintf("At least %d files mention %q and only the first %d are listed; more words would narrow it.", limit, query, limit), nil
+		}
+		return named, fmt.Sprintf("At least %d files mention %q, so only the %d with it in their name are listed.", limit, query, len(named)), nil
+	}
+	if len(files) > 0 {
+		return files, "", nil
+	}
+
+	words := searchWords(query)
+	var tries [][]string
+	if len(words) > 1 {
+		tries = append(tries, words)
+	}
+	byLength := append([]string(nil), words...)
+	sort.SliceStable(byLength, func(i, j int) bool { return len(byLength[i]) > len(byLength[j]) })
+	for _, w := range byLength[:min(len(byLength), maxRefineWords)] {
+		tries = append(tries, []string{w})
+	}
+
+	var attempts []searchAttempt
+	for _, try := range tries {
+		files, err := drive.SearchNames(ctx, try, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		attempts = append(attempts, searchAttempt{desc: "names with " + strings.Join(try, " and "), found: len(files)})
+		if len(files) > 0 {
+			return files, "Nothing matched as asked, so variations were tried: " + describeAttempts(attempts) + ". Listed is what the last one found.", nil
+		}
+	}
+	if len(attempts) == 0 {
+		return nil, "", nil
+	}
+	return nil, "Also tried " + describeAttempts(attempts) + ".", nil
+}
+
+// searchWords splits a query into the lowercase fragments worth looking
+// for in file names: "Q4_budget-v2.xlsx" gives q4, budget, v2 and xlsx.
+func searchWords(query string) []string {
+	var words []string
+	seen := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) >= 2 && !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
@@ -0,0 +1,492 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+const securityReviewJobKind = "security_review"
+
+// securityMail matches filter criteria aimed at the mail an intruder hides
+// so the user does not notice: security alerts, password resets, sign-in
+// codes.
+var securityMail = regexp.MustCompile(`(?i)(security|password|sign[- ]?in|log[- ]?in|verif|2-step|two[- ]factor|alert|suspicious|recovery|unusual)`)
+
+// GmailFilter is a filter of the mailbox: the mail it matches and what it
+// does with it.
+type GmailFilter struct {
+	ID       string
+	Criteria string
+	Add      []string
+	Remove   []string
+	// Forward is the address matching mail is forwarded to
+	Forward string
+}
+
+// Filters lists the mailbox's filters.
+func (c *GmailClient) Filters(ctx context.Context) ([]GmailFilter, error) {
+	var resp struct {
+		Filter []struct {
+			ID       string `json:"id"`
+			Criteria struct {
+				From         string `json:"from"`
+				To           string `json:"to"`
+				Subject      string `json:"subject"`
+				Query        string `json:"query"`
+				NegatedQuery string `json:"negatedQuery"`
+			} `json:"criteria"`
+			Action struct {
+				AddLabelIDs    []string `json:"addLabelIds"`
+				RemoveLabelIDs []string `json:"removeLabelIds"`
+				Forward        string   `json:"forward"`
+			} `json:"action"`
+		} `json:"filter"`
+	}
+	if err := c.do(ctx, "/users/me/settings/filters", &resp); err != nil {
+		return nil, err
+	}
+	filters := make([]GmailFilter, len(resp.Filter))
+	for i, f := range resp.Filter {
+		var terms []string
+		for _, term := range [][2]string{{"from:", f.Criteria.From}, {"to:", f.Criteria.To}, {"subject:", f.Criteria.Subject}, {"", f.Criteria.Query}, {"-", f.Criteria.NegatedQuery}} {
+			if term[1] != "" {
+				terms = append(terms, term[0]+term[1])
+			}
+		}
+		filters[i] = GmailFilter{
+			ID:       f.ID,
+			Criteria: strings.Join(terms, " "),
+			Add:      f.Action.AddLabelIDs,
+			Remove:   f.Action.RemoveLabelIDs,
+			Forward:  f.Action.Forward,
+		}
+	}
+	return filters, nil
+}
+
+// AutoForwarding returns the address all incoming mail is forwarded to
+// and what happens to Gmail's copy, or "" when forwarding is off.
+func (c *GmailClient) AutoForwarding(ctx context.Context) (address, disposition string, err error) {
+	var resp struct {
+		Enabled      bool   `json:"enabled"`
+		EmailAddress string `json:"emailAddress"`
+		Disposition  string `json:"disposition"`
+	}
+	if err := c.do(ctx, "/users/me/settings/autoForwarding", &resp); err != nil {
+		return "", "", err
+	}
+	if !resp.Enabled {
+		return "", "", nil
+	}
+	return resp.EmailAddress, resp.Disposition, nil
+}
+
+// ForwardingAddresses lists the verified addresses mail can be forwarded
+// to, by auto-forwarding or a filter.
+func (c *GmailClient) ForwardingAddresses(ctx context.Context) ([]string, error) {
+	var resp struct {
+		ForwardingAddresses []struct {
+			Email  string `json:"forwardingEmail"`
+			Status string `json:"verificationStatus"`
+		} `json:"forwardingAddresses"`
+	}
+	if err := c.do(ctx, "/users/me/settings/forwardingAddresses", &resp); err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, a := range resp.ForwardingAddresses {
+		if a.Status == "accepted" {
+			addresses = append(addresses, a.Email)
+		}
+	}
+	return addresses, nil
+}
+
+// DriveApp is a third-party app the user connected to Google Drive.
+type DriveApp struct {
+	ID   string
+	Name string
+}
+
+// Apps lists the apps connected to the user's Drive. It needs the
+// drive.apps.readonly scope.
+func (c *GoogleDriveClient) Apps(ctx context.Context) ([]DriveApp, error) {
+	var resp struct {
+		Items []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/apps", nil, &resp); err != nil {
+		return nil, err
+	}
+	apps := make([]DriveApp, len(resp.Items))
+	for i, a := range resp.Items {
+		apps[i] = DriveApp{ID: a.ID, Name: a.Name}
+	}
+	return apps, nil
+}
+
+// securityFinding is something in the account worth the user's look. Key
+// identifies it across reviews, so scheduled ones only report what is new.
+type securityFinding struct {
+	Key    string
+	Urgent bool
+	Text   string
+}
+
+type securityReviewState struct {
+	// Apps are the Drive apps seen by the last review, by ID
+	Apps     map[string]string `json:"apps"`
+	Findings []string          `json:"findings"`
+	LastRun  time.Time         `json:"last_run"`
+}
+
+// SecurityReviewTool checks the Google account for the changes an
+// intruder makes to keep reading the user's mail unnoticed: forwarding of
+// all mail, filters that forward, delete or hide mail, and apps newly
+// connected to Drive. It can run on a schedule, then reporting only what
+// is new since the review before.
+type SecurityReviewTool struct {
+	gmail     *GmailClient
+	drive     *GoogleDriveClient
+	statePath string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// NewSecurityReviewTool creates the tool. State is kept in
+// workspace/state/security_review.json.
+func NewSecurityReviewTool(token TokenFunc, workspace string) *SecurityReviewTool {
+	return &SecurityReviewTool{
+		gmail:     NewGmailClient(token),
+		drive:     NewGoogleDriveClient(token),
+		statePath: filepath.Join(workspace, "state", "security_review.json"),
+		now:       time.Now,
+	}
+}
+
+func (t *SecurityReviewTool) Name() string {
+	return "security_review"
+}
+
+func (t *SecurityReviewTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "schedule", "unschedule")
+}
+
+// Untrusted reports that a review quotes filters and app names, which an
+// intruder chooses.
+func (t *SecurityReviewTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "run")
+}
+
+func (t *SecurityReviewTool) Description() string {
+	return "Check the user's Google account for signs of tampering: mail auto-forwarded elsewhere, Gmail filters that forward, delete or hide mail (especially security alerts), and apps newly connected to Google Drive. " +
+		"run reviews now; schedule repeats it every few days in this chat, reporting only new findings; unschedule stops it. It only reads settings and changes nothing: tell the user where to fix what it finds."
+}
+
+func (t *SecurityReviewTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"run", "schedule", "unschedule"},
+				"description": "Action to perform",
+			},
+			"every_days": map[string]interface{}{
+				"type":        "integer",
+				"description": "schedule: days between reviews (default 7)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *SecurityReviewTool) JobKinds() []string {
+	return []string{securityReviewJobKind}
+}
+
+func (t *SecurityReviewTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *SecurityReviewTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "run":
+		report, err := t.review(ctx, false)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("security review failed: %v", err)).WithError(err)
+		}
+		return NewToolResult(report)
+
+	case "schedule":
+		if t.scheduler == nil {
+			return ErrorResult("scheduled reviews are not available (scheduler not running)")
+		}
+		channel, chatID := ChatFromContext(ctx)
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		days := 7
+		if d, ok := args["every_days"].(float64); ok && d >= 1 {
+			days = int(d)
+		}
+		t.unschedule(channel + ":" + chatID)
+		everyMS := (time.Duration(days) * 24 * time.Hour).Milliseconds()
+		_, err := t.scheduler.AddJobWithPayload("Security review", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+			Kind:    securityReviewJobKind,
+			Message: "Security review",
+			Channel: channel,
+			To:      chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to schedule: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("The account is reviewed every %d day(s); only new findings are reported here.", days))
+
+	case "unschedule":
+		channel, chatID := ChatFromContext(ctx)
+		if t.scheduler == nil || t.unschedule(channel+":"+chatID) == 0 {
+			return SilentResult("No security review was scheduled in this chat.")
+		}
+		return SilentResult("Scheduled security reviews stopped.")
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// unschedule removes the chat's reviews and reports how many there were.
+func (t *SecurityReviewTool) unschedule(chat string) int {
+	removed := 0
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == securityReviewJobKind && job.Payload.Channel+":"+job.Payload.To == chat && t.scheduler.RemoveJob(job.ID) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ExecuteJob implements ScheduledTool. It reports only findings the
+// review before did not have.
+func (t *SecurityReviewTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.review(ctx, true)
+}
+
+// review checks the account and returns the report; onlyNew leaves out
+// what the last review already found, and returns "" when nothing is new.
+func (t *SecurityReviewTool) review(ctx context.Context, onlyNew bool) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+
+	var findings []securityFinding
+	var checked, skipped []string
+	forwardTo, disposition, err := t.gmail.AutoForwarding(ctx)
+	if err != nil {
+		skipped = append(skipped, fmt.Sprintf("auto-forwarding (%v)", err))
+	} else {
+		checked = append(checked, "auto-forwarding")
+		if forwardTo != "" {
+			findings = append(findings, securityFinding{
+				Key:    "forward-all:" + forwardTo,
+				Urgent: true,
+				Text:   fmt.Sprintf("All incoming mail is forwarded to %s%s.", forwardTo, describeDisposition(disposition)),
+			})
+		}
+	}
+
+	filters, err := t.gmail.Filters(ctx)
+	if err != nil {
+		skipped = append(skipped, fmt.Sprintf("filters (%v)", err))
+	} else {
+		checked = append(checked, fmt.Sprintf("%d filter(s)", len(filters)))
+		for _, f := range filters {
+			if finding, ok := reviewFilter(f); ok {
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	addresses, err := t.gmail.ForwardingAddresses(ctx)
+	if err != nil {
+		skipped = append(skipped, fmt.Sprintf("forwarding addresses (%v)", err))
+	} else {
+		for _, a := range addresses {
+			if !strings.EqualFold(a, forwardTo) && !forwardedByFilter(filters, a) {
+				findings = append(findings, securityFinding{
+					Key:  "forwarding-address:" + a,
+					Text: fmt.Sprintf("%s is set up as a forwarding address, though nothing forwards to it now; remove it if you do not know it.", a),
+				})
+			}
+		}
+	}
+
+	apps, err := t.drive.Apps(ctx)
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusForbidden:
+		skipped = append(skipped, "apps connected to Drive (needs the https://www.googleapis.com/auth/drive.apps.readonly scope)")
+	case err != nil:
+		skipped = append(skipped, fmt.Sprintf("apps connected to Drive (%v)", err))
+	default:
+		checked = append(checked, fmt.Sprintf("%d Drive app(s)", len(apps)))
+		known := state.Apps
+		state.Apps = map[string]string{}
+		for _, a := range apps {
+			state.Apps[a.ID] = a.Name
+			if _, seen := known[a.ID]; !seen && known != nil {
+				findings = append(findings, securityFinding{
+					Key:  "drive-app:" + a.ID,
+					Text: fmt.Sprintf("%s was connected to your Google Drive since the last review.", a.Name),
+				})
+			}
+		}
+	}
+
+	previous := map[string]bool{}
+	for _, key := range state.Findings {
+		previous[key] = true
+	}
+	current := map[string]bool{}
+	for _, f := range findings {
+		current[f.Key] = true
+	}
+	if len(skipped) > 0 {
+		// What a failed check found before is still known, so it is not
+		// reported as new when the check works again
+		for key := range previous {
+			current[key] = true
+		}
+	}
+	state.Findings = nil
+	for key := range current {
+		state.Findings = append(state.Findings, key)
+	}
+	sort.Strings(state.Findings)
+	state.LastRun = t.now()
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	if len(checked) == 0 {
+		return "", fmt.Errorf("nothing could be checked: %s", strings.Join(skipped, "; "))
+	}
+
+	if onlyNew {
+		var fresh []securityFinding
+		for _, f := range findings {
+			if !previous[f.Key] {
+				fresh = append(fresh, f)
+			}
+		}
+		if len(fresh) == 0 {
+			return "", nil
+		}
+		findings = fresh
+	}
+	return formatSecurityReview(findings, checked, skipped), nil
+}
+
+// reviewFilter reports a filter that forwards, deletes or hides mail. One
+// aimed at security mail is urgent: that is how an intruder keeps the
+// user from seeing alerts about their account.
+func reviewFilter(f GmailFilter) (securityFinding, bool) {
+	criteria := f.Criteria
+	if criteria == "" {
+		criteria = "all mail"
+	}
+	finding := securityFinding{Key: "filter:" + f.ID, Urgent: securityMail.MatchString(f.Criteria)}
+	switch {
+	case f.Forward != "":
+		finding.Urgent = true
+		finding.Text = fmt.Sprintf("A filter forwards mail matching %q to %s.", criteria, f.Forward)
+	case hasLabel(f.Add, "TRASH"):
+		finding.Text = fmt.Sprintf("A filter deletes mail matching %q.", criteria)
+	case hasLabel(f.Remove, "INBOX") && (hasLabel(f.Remove, "UNREAD") || finding.Urgent):
+		finding.Text = fmt.Sprintf("A filter hides mail matching %q: it skips the inbox.", criteria)
+		if hasLabel(f.Remove, "UNREAD") {
+			finding.Text = fmt.Sprintf("A filter hides mail matching %q: it skips the inbox and is marked read.", criteria)
+		}
+	case hasLabel(f.Add, "SPAM") && finding.Urgent:
+		finding.Text = fmt.Sprintf("A filter sends mail matching %q to spam.", criteria)
+	default:
+		return securityFinding{}, false
+	}
+	return finding, true
+}
+
+func forwardedByFilter(filters []GmailFilter, address string) bool {
+	for _, f := range filters {
+		if strings.EqualFold(f.Forward, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeDisposition(disposition string) string {
+	switch disposition {
+	case "trash":
+		return ", and Gmail's copy is deleted"
+	case "archive":
+		return ", and Gmail's copy is archived"
+	case "markRead":
+		return ", and Gmail's copy is marked read"
+	}
+	return ""
+}
+
+func formatSecurityReview(findings []securityFinding, checked, skipped []string) string {
+	var sb strings.Builder
+	if len(findings) == 0 {
+		fmt.Fprintf(&sb, "✅ Security review: nothing unusual found (checked %s).", strings.Join(checked, ", "))
+	} else {
+		sort.SliceStable(findings, func(i, j int) bool { return findings[i].Urgent && !findings[j].Urgent })
+		fmt.Fprintf(&sb, "🔐 Security review: %d thing(s) to look at (checked %s)", len(findings), strings.Join(checked, ", "))
+		for _, f := range findings {
+			mark := "🟠"
+			if f.Urgent {
+				mark = "🔴"
+			}
+			fmt.Fprintf(&sb, "\n%s %s", mark, f.Text)
+		}
+		sb.WriteString("\nIf you did not set these up, change your Google password, then remove them in Gmail settings (Filters and Blocked Addresses, Forwarding) and at https://myaccount.google.com/permissions.")
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&sb, "\nNot checked: %s.", strings.Join(skipped, "; "))
+	}
+	return sb.String()
+}
+
+// loadState reads the state; callers hold t.mu.
+func (t *SecurityReviewTool) loadState() (*securityReviewState, error) {
+	state := &securityReviewState{}
+	data, err := os.ReadFile(t.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read security review state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse security review state: %w", err)
+		}
+	}
+	return state, nil
+}
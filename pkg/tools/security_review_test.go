@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestSecurityReviewTool_FlagsTampering verifies forwarding and filters that forward, delete or hide mail are reported, urgent ones first, and scheduled reviews report only what is new, such as a newly connected Drive app
+func TestSecurityReviewTool_FlagsTampering(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	g.SetAutoForwarding("copy@evil.example")
+	g.AddFilter(testkit.Filter{From: "boss@example.com", RemoveLabels: []string{"INBOX"}})
+	g.AddFilter(testkit.Filter{From: "news@example.com", RemoveLabels: []string{"INBOX", "UNREAD"}})
+	g.AddFilter(testkit.Filter{Query: "security alert", AddLabels: []string{"TRASH"}})
+	g.AddFilter(testkit.Filter{From: "bank.example", Forward: "spy@evil.example"})
+	g.AddApp(testkit.App{ID: "app-1", Name: "Docs Scanner"})
+
+	tool := NewSecurityReviewTool(testkit.Token, t.TempDir())
+	result := tool.Execute(context.Background(), map[string]interface{}{"action": "run"})
+	if result.IsError {
+		t.Fatalf("run failed: %s", result.ForLLM)
+	}
+	report := result.ForLLM
+	for _, want := range []string{
+		"4 thing(s) to look at (checked auto-forwarding, 4 filter(s), 1 Drive app(s))",
+		"\n🔴 All incoming mail is forwarded to copy@evil.example, and Gmail's copy is archived.",
+		"\n🔴 A filter forwards mail matching \"from:bank.example\" to spy@evil.example.",
+		"\n🔴 A filter deletes mail matching \"security alert\".",
+		"\n🟠 A filter hides mail matching \"from:news@example.com\": it skips the inbox and is marked read.",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected %q in the report, got:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "boss@example.com") || strings.Contains(report, "Docs Scanner") {
+		t.Errorf("Expected a plain archive filter and apps of the first review left out, got:\n%s", report)
+	}
+
+	job := &cron.CronJob{Payload: cron.CronPayload{Kind: securityReviewJobKind, Channel: "telegram", To: "1"}}
+	g.AddApp(testkit.App{ID: "app-2", Name: "Shady Sync"})
+	report, err := tool.ExecuteJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if !strings.Contains(report, "1 thing(s)") || !strings.Contains(report, "🟠 Shady Sync was connected to your Google Drive since the last review.") {
+		t.Errorf("Expected only the new app reported, got:\n%s", report)
+	}
+	if again, _ := tool.ExecuteJob(context.Background(), job); again != "" {
+		t.Errorf("Expected nothing new to report, got:\n%s", again)
+	}
+
+	g.FailNext("/drive/v3/apps", 1, 403)
+	report, _ = tool.review(context.Background(), false)
+	if !strings.Contains(report, "Not checked: apps connected to Drive (needs the https://www.googleapis.com/auth/drive.apps.readonly scope).") {
+		t.Errorf("Expected the Drive check said to be skipped, got:\n%s", report)
+	}
+}
@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+// quietHoursSetting is the settings key for the chat's quiet hours. They
+// live in the chat's profile rather than the config file.
+const quietHoursSetting = "quiet_hours"
+
+// SettingInfo is a setting the owner may change and its current value.
+type SettingInfo struct {
+	Key         string
+	Description string
+	Value       string
+}
+
+// SettingsEditor changes the config file and applies it right away. The
+// gateway implements it.
+type SettingsEditor interface {
+	// Settings lists what may be changed, with the current values.
+	Settings() []SettingInfo
+	// ChangeSetting validates value, writes it to the config and reloads
+	// it, returning a summary of what changed. Nothing is written when
+	// the value or the resulting config is invalid.
+	ChangeSetting(key, value string) (string, error)
+}
+
+// SettingsTool lets owners view and change a short list of safe config
+// values from chat. Keys, tokens, owners and channels are not among
+// them; those still need the config file.
+type SettingsTool struct {
+	editor   SettingsEditor
+	profiles *profile.Store
+	isOwner  func(channel, senderID string) bool
+}
+
+func NewSettingsTool(editor SettingsEditor, profiles *profile.Store) *SettingsTool {
+	return &SettingsTool{editor: editor, profiles: profiles}
+}
+
+// SetOwnerCheck sets how the tool tells owners apart. Until it is set
+// nobody may use it.
+func (t *SettingsTool) SetOwnerCheck(isOwner func(channel, senderID string) bool) {
+	t.isOwner = isOwner
+}
+
+func (t *SettingsTool) Name() string {
+	return "settings"
+}
+
+func (t *SettingsTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *SettingsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "set")
+}
+
+func (t *SettingsTool) Description() string {
+	return "View and change the assistant's settings: quiet hours for this chat, the daily briefing (on/off, time, weather city, news topics), the default photo album, daily usage limits, queue limits, the heartbeat, tool call limits and the default locale. Use list to show the settings and their values, set to change one; changes are checked and apply immediately. Only the owner may use this tool. Say back the old and new value after a change."
+}
+
+func (t *SettingsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "set"},
+				"description": "list shows the settings and their values, set changes one",
+			},
+			"key": map[string]interface{}{
+				"type":        "string",
+				"description": "For set: the setting as shown by list, e.g. tools.briefing.time or quiet_hours",
+			},
+			"value": map[string]interface{}{
+				"type":        "string",
+				"description": "For set: the new value, e.g. 07:30, on, 50, \"tech, science\", or 22:00-07:00 (\"off\" to clear) for quiet_hours",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *SettingsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if t.isOwner == nil || !t.isOwner(channel, SenderFromContext(ctx)) {
+		return ErrorResult("only the owner can view and change settings")
+	}
+	chatKey := channel + ":" + chatID
+
+	action, _ := args["action"].(string)
+	switch action {
+	case "list":
+		var sb strings.Builder
+		if t.profiles != nil && chatID != "" {
+			fmt.Fprintf(&sb, "- %s = %s: when no proactive messages are sent to this chat, as 22:00-07:00 or off\n",
+				quietHoursSetting, formatQuietHours(t.profiles.Get(chatKey)))
+		}
+		for _, s := range t.editor.Settings() {
+			value := s.Value
+			if value == "" {
+				value = "(not set)"
+			}
+			fmt.Fprintf(&sb, "- %s = %s: %s\n", s.Key, value, s.Description)
+		}
+		return SilentResult(sb.String())
+
+	case "set":
+		key, _ := args["key"].(string)
+		value, _ := args["value"].(string)
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			return ErrorResult("key is required for set")
+		}
+		if key == quietHoursSetting {
+			return t.setQuietHours(chatKey, chatID, value)
+		}
+		summary, err := t.editor.ChangeSetting(key, value)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("%s was not changed: %v", key, err)).WithError(err)
+		}
+		return SilentResult(summary)
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// setQuietHours changes the quiet hours in the chat's profile.
+func (t *SettingsTool) setQuietHours(chatKey, chatID, value string) *ToolResult {
+	if t.profiles == nil || chatID == "" {
+		return ErrorResult("quiet hours are set per chat; use this in a conversation")
+	}
+	p := t.profiles.Get(chatKey)
+	old := formatQuietHours(p)
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "off") {
+		p.QuietStart, p.QuietEnd = "", ""
+	} else {
+		start, end, found := strings.Cut(value, "-")
+		if !found {
+			return ErrorResult("quiet_hours must look like 22:00-07:00")
+		}
+		p.QuietStart, p.QuietEnd = strings.TrimSpace(start), strings.TrimSpace(end)
+	}
+	if err := t.profiles.Set(chatKey, p); err != nil {
+		return ErrorResult(fmt.Sprintf("quiet_hours was not changed: %v", err)).WithError(err)
+	}
+	if until, quiet := t.profiles.QuietUntil(chatKey, time.Now()); quiet {
+		return SilentResult(fmt.Sprintf("quiet_hours: %s -> %s (quiet now, until %s)", old, formatQuietHours(p), until.In(p.Location()).Format("15:04")))
+	}
+	return SilentResult(fmt.Sprintf("quiet_hours: %s -> %s", old, formatQuietHours(p)))
+}
+
+func formatQuietHours(p profile.Profile) string {
+	if p.QuietStart == "" {
+		return "off"
+	}
+	return p.QuietStart + "-" + p.QuietEnd
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+type fakeSettings struct {
+	values map[string]string
+}
+
+func (f *fakeSettings) Settings() []SettingInfo {
+	return []SettingInfo{{Key: "tools.briefing.time", Description: "briefing time", Value: f.values["tools.briefing.time"]}}
+}
+
+func (f *fakeSettings) ChangeSetting(key, value string) (string, error) {
+	if key != "tools.briefing.time" {
+		return "", fmt.Errorf("%s cannot be changed from chat", key)
+	}
+	old := f.values[key]
+	f.values[key] = value
+	return key + ": " + old + " -> " + value, nil
+}
+
+// TestSettingsTool_OwnerChangesConfigAndQuietHours verifies owners list and change settings, quiet hours go to the chat's profile, and others are refused
+func TestSettingsTool_OwnerChangesConfigAndQuietHours(t *testing.T) {
+	editor := &fakeSettings{values: map[string]string{"tools.briefing.time": "08:00"}}
+	profiles := profile.NewStore(t.TempDir())
+	tool := NewSettingsTool(editor, profiles)
+	tool.SetOwnerCheck(func(channel, senderID string) bool { return senderID == "owner" })
+	owner := WithSender(WithChat(context.Background(), "telegram", "42"), "owner")
+
+	result := tool.Execute(owner, map[string]interface{}{"action": "list"})
+	if result.IsError || !strings.Contains(result.ForLLM, "quiet_hours = off") || !strings.Contains(result.ForLLM, "tools.briefing.time = 08:00") {
+		t.Fatalf("list = %+v", result)
+	}
+
+	result = tool.Execute(owner, map[string]interface{}{"action": "set", "key": "tools.briefing.time", "value": "07:30"})
+	if result.IsError || editor.values["tools.briefing.time"] != "07:30" {
+		t.Errorf("set = %+v", result)
+	}
+	result = tool.Execute(owner, map[string]interface{}{"action": "set", "key": "providers.openai.api_key", "value": "x"})
+	if !result.IsError {
+		t.Error("a setting the editor refuses should fail")
+	}
+
+	result = tool.Execute(owner, map[string]interface{}{"action": "set", "key": "quiet_hours", "value": "22:00-07:00"})
+	if result.IsError || !strings.Contains(result.ForLLM, "off -> 22:00-07:00") {
+		t.Errorf("quiet hours = %+v", result)
+	}
+	if p := profiles.Get("telegram:42"); p.QuietStart != "22:00" || p.QuietEnd != "07:00" {
+		t.Errorf("profile = %+v", p)
+	}
+	result = tool.Execute(owner, map[string]interface{}{"action": "set", "key": "quiet_hours", "value": "22:00-25:00"})
+	if !result.IsError || profiles.Get("telegram:42").QuietEnd != "07:00" {
+		t.Errorf("invalid quiet hours = %+v", result)
+	}
+
+	guest := WithSender(WithChat(context.Background(), "telegram", "42"), "guest")
+	if result := tool.Execute(guest, map[string]interface{}{"action": "list"}); !result.IsError {
+		t.Error("only the owner may see the settings")
+	}
+}
@@ -0,0 +1,500 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Share limits: how many messages a snippet holds, and how many lines of
+// text its image draws before cutting it short.
+const (
+	maxShareMessages   = 50
+	maxShareImageLines = 300
+)
+
+var (
+	shareEmail  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+`)
+	shareLink   = regexp.MustCompile(`https?://[^\s)>\]]+`)
+	sharePhone  = regexp.MustCompile(`\+?\(?\d[\d ()./-]{6,}\d`)
+	shareNumber = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){3,7}\b|\b\d(?:[ -]?\d){5,}\b`)
+	shareDate   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+// shareRedactions are the kinds of personal data a snippet can have
+// masked, in the order they are applied.
+var shareRedactions = []string{"emails", "links", "phones", "numbers"}
+
+// ShareTool turns part of the current conversation, or a tool result, into
+// a file the user can forward to someone else: plain text, Markdown, or an
+// image of the chat. Tokens and keys are always masked; emails, links,
+// phone numbers, long numbers and given words on request.
+type ShareTool struct {
+	history    func(channel, chatID string) []providers.Message
+	previewDir string
+}
+
+// NewShareTool creates the tool. history returns a chat's conversation;
+// snippets are written to previewDir.
+func NewShareTool(history func(channel, chatID string) []providers.Message, previewDir string) *ShareTool {
+	return &ShareTool{history: history, previewDir: previewDir}
+}
+
+func (t *ShareTool) Name() string {
+	return "share"
+}
+
+func (t *ShareTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ShareTool) Description() string {
+	return "Export part of this conversation, or the latest result of a tool, as a file the user can forward to someone else: format=text (.txt), markdown (.md) or image (a picture of the chat). " +
+		"By default the last question and answer before this request are shared; last picks how many messages, from_text starts at the latest message containing it, tool shares that tool's latest result instead. " +
+		"Tokens and keys are always masked; redact masks emails, links, phones or numbers (account and card numbers), redact_terms masks names or other words. " +
+		"Use it for \"share this with Ana\", \"give me that as a file\" or \"screenshot our chat without my email\"."
+}
+
+func (t *ShareTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"text", "markdown", "image"},
+				"description": "File format (default markdown)",
+			},
+			"last": map[string]interface{}{
+				"type":        "integer",
+				"description": "How many messages to share, counted back from before this request (default 2: the last question and answer)",
+			},
+			"from_text": map[string]interface{}{
+				"type":        "string",
+				"description": "Share from the latest message containing this text up to this request",
+			},
+			"tool": map[string]interface{}{
+				"type":        "string",
+				"description": "Share the latest result of this tool (e.g. web_search) instead of messages",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Heading for the snippet",
+			},
+			"redact": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": shareRedactions},
+				"description": "Personal data to mask",
+			},
+			"redact_terms": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Names or other words to mask",
+			},
+		},
+	}
+}
+
+// shareEntry is a message of a snippet.
+type shareEntry struct {
+	who  string
+	text string
+}
+
+func (t *ShareTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	history := t.history(channel, chatID)
+
+	var entries []shareEntry
+	if tool, _ := args["tool"].(string); tool != "" {
+		result, ok := latestToolResult(history, tool)
+		if !ok {
+			return ErrorResult(fmt.Sprintf("%s has no result in this conversation to share", tool))
+		}
+		entries = []shareEntry{{who: "Result of " + tool, text: result}}
+	} else {
+		var err error
+		if entries, err = pickShareMessages(history, args); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+
+	var terms []string
+	if list, ok := args["redact_terms"].([]interface{}); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				terms = append(terms, strings.TrimSpace(s))
+			}
+		}
+	}
+	kinds := map[string]bool{}
+	if list, ok := args["redact"].([]interface{}); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				kinds[s] = true
+			}
+		}
+	}
+	masked := 0
+	for i := range entries {
+		var n int
+		entries[i].text, n = redactSnippet(entries[i].text, kinds, terms)
+		masked += n
+	}
+	title, _ := args["title"].(string)
+
+	format, _ := args["format"].(string)
+	var data []byte
+	ext := ".md"
+	switch format {
+	case "", "markdown":
+		data = []byte(snippetMarkdown(title, entries))
+	case "text":
+		data, ext = []byte(snippetText(title, entries)), ".txt"
+	case "image":
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, renderSnippet(title, entries)); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to render the snippet: %v", err)).WithError(err)
+		}
+		data, ext = buf.Bytes(), ".png"
+	default:
+		return ErrorResult(fmt.Sprintf("unknown format %q; use text, markdown or image", format))
+	}
+	path, err := savePreview(t.previewDir, "share", ext, data)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the snippet: %v", err)).WithError(err)
+	}
+
+	note := fmt.Sprintf("Sent the user a %s snippet of %d message(s) to forward", strings.TrimPrefix(ext, "."), len(entries))
+	if masked > 0 {
+		note += fmt.Sprintf(", with %d item(s) masked", masked)
+	}
+	return &ToolResult{ForLLM: note + ". Don't repeat its content.", Media: []string{path}}
+}
+
+// latestToolResult returns the content of the latest result of tool in
+// history.
+func latestToolResult(history []providers.Message, tool string) (string, bool) {
+	names := map[string]string{}
+	for _, m := range history {
+		for _, call := range m.ToolCalls {
+			name := call.Name
+			if call.Function != nil {
+				name = call.Function.Name
+			}
+			names[call.ID] = name
+		}
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		m := history[i]
+		if m.Role == "tool" && names[m.ToolCallID] == tool && strings.TrimSpace(m.Content) != "" {
+			return m.Content, true
+		}
+	}
+	return "", false
+}
+
+// pickShareMessages selects the user and assistant messages before the
+// request to share, the last of them or those from the latest one
+// containing from_text.
+func pickShareMessages(history []providers.Message, args map[string]interface{}) ([]shareEntry, error) {
+	// The latest user message is the request to share itself
+	end := len(history)
+	for end > 0 && history[end-1].Role != "user" {
+		end--
+	}
+	if end > 0 {
+		end--
+	}
+	var entries []shareEntry
+	for _, m := range history[:end] {
+		text := strings.TrimSpace(m.Content)
+		if text == "" {
+			continue
+		}
+		switch m.Role {
+		case "user":
+			entries = append(entries, shareEntry{who: "Me", text: text})
+		case "assistant":
+			entries = append(entries, shareEntry{who: "Assistant", text: text})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("there is nothing in this conversation to share yet")
+	}
+
+	if from, _ := args["from_text"].(string); strings.TrimSpace(from) != "" {
+		want := strings.ToLower(strings.TrimSpace(from))
+		for i := len(entries) - 1; i >= 0; i-- {
+			if strings.Contains(strings.ToLower(entries[i].text), want) {
+				entries = entries[i:]
+				return entries[:min(len(entries), maxShareMessages)], nil
+			}
+		}
+		return nil, fmt.Errorf("no message in this conversation contains %q", from)
+	}
+	last := 2
+	if n, ok := args["last"].(float64); ok && n >= 1 {
+		last = min(int(n), maxShareMessages)
+	}
+	return entries[max(0, len(entries)-last):], nil
+}
+
+// redactSnippet masks secrets, the kinds of personal data asked for and
+// terms in s, and returns how many items it masked.
+func redactSnippet(s string, kinds map[string]bool, terms []string) (string, int) {
+	count := 0
+	if masked := logger.RedactSecrets(s); masked != s {
+		count += strings.Count(masked, "[redacted]") - strings.Count(s, "[redacted]")
+		s = masked
+	}
+	replace := func(re *regexp.Regexp, label string, keep func(string) bool) {
+		s = re.ReplaceAllStringFunc(s, func(m string) string {
+			if keep != nil && keep(m) {
+				return m
+			}
+			count++
+			return label
+		})
+	}
+	for _, kind := range shareRedactions {
+		if !kinds[kind] {
+			continue
+		}
+		switch kind {
+		case "emails":
+			replace(shareEmail, "[email]", nil)
+		case "links":
+			replace(shareLink, "[link]", nil)
+		case "phones":
+			replace(sharePhone, "[phone]", func(m string) bool {
+				digits := strings.Count(strings.Map(func(r rune) rune {
+					if unicode.IsDigit(r) {
+						return 'd'
+					}
+					return -1
+				}, m), "d")
+				return digits < 9 || digits > 15 || shareDate.MatchString(strings.TrimSpace(m))
+			})
+		case "numbers":
+			replace(shareNumber, "[number]", func(m string) bool { return shareDate.MatchString(m) })
+		}
+	}
+	for _, term := range terms {
+		replace(termPattern(term), "[redacted]", nil)
+	}
+	return s, count
+}
+
+// termPattern matches term case-insensitively as a whole word; \b only
+// knows ASCII letters, so it is left out next to other characters.
+func termPattern(term string) *regexp.Regexp {
+	isWord := func(r rune) bool {
+		return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+	}
+	expr := regexp.QuoteMeta(term)
+	runes := []rune(term)
+	if isWord(runes[0]) {
+		expr = `\b` + expr
+	}
+	if isWord(runes[len(runes)-1]) {
+		expr += `\b`
+	}
+	return regexp.MustCompile(`(?i)` + expr)
+}
+
+func snippetMarkdown(title string, entries []shareEntry) string {
+	var sb strings.Builder
+	if title != "" {
+		fmt.Fprintf(&sb, "# %s\n\n", title)
+	}
+	for i, e := range entries {
+		if i > 0 {
+			sb.WriteString("\n---\n\n")
+		}
+		fmt.Fprintf(&sb, "**%s**\n\n%s\n", e.who, e.text)
+	}
+	return sb.String()
+}
+
+func snippetText(title string, entries []shareEntry) string {
+	var sb strings.Builder
+	if title != "" {
+		fmt.Fprintf(&sb, "%s\n%s\n\n", title, strings.Repeat("=", len([]rune(title))))
+	}
+	for i, e := range entries {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s:\n%s\n", e.who, plainText(e.text))
+	}
+	return sb.String()
+}
+
+// plainText drops the Markdown emphasis and code marks models reply with.
+func plainText(s string) string {
+	return strings.NewReplacer("**", "", "__", "", "`", "").Replace(s)
+}
+
+// Snippet image layout, in pixels, on the agenda's text metrics.
+const (
+	snippetWidth  = 720
+	snippetMargin = 16
+	snippetBubble = 560
+	snippetPad    = 10
+)
+
+var (
+	snippetMine   = color.RGBA{0xd9, 0xfd, 0xd3, 0xff}
+	snippetOthers = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+	snippetBack   = color.RGBA{0xfa, 0xfa, 0xfa, 0xff}
+)
+
+// renderSnippet draws entries as chat bubbles, the user's on the right,
+// like a screenshot of the chat.
+func renderSnippet(title string, entries []shareEntry) image.Image {
+	perLine := (snippetBubble - 2*snippetPad) / charWidth
+	type bubble struct {
+		who   string
+		lines []string
+		mine  bool
+	}
+	var bubbles []bubble
+	total := 0
+	for _, e := range entries {
+		lines := wrapText(asciiFold(plainText(e.text)), perLine)
+		if total+len(lines) > maxShareImageLines {
+			lines = append(lines[:max(0, maxShareImageLines-total)], "...")
+		}
+		total += len(lines)
+		bubbles = append(bubbles, bubble{who: e.who, lines: lines, mine: e.who == "Me"})
+		if total >= maxShareImageLines {
+			break
+		}
+	}
+
+	height := snippetMargin
+	if title != "" {
+		height += lineHeight + snippetMargin
+	}
+	for _, b := range bubbles {
+		height += (len(b.lines)+1)*lineHeight + 2*snippetPad + snippetMargin
+	}
+	img := image.NewRGBA(image.Rect(0, 0, snippetWidth, height))
+	fillRect(img, img.Bounds(), snippetBack)
+
+	y := snippetMargin
+	if title != "" {
+		drawText(img, snippetMargin, y, asciiFold(title), agendaText, snippetWidth-2*snippetMargin)
+		y += lineHeight + snippetMargin
+	}
+	for _, b := range bubbles {
+		width := len([]rune(b.who))
+		for _, l := range b.lines {
+			width = max(width, len([]rune(l)))
+		}
+		w := width*charWidth + 2*snippetPad
+		x, bg := snippetMargin, snippetOthers
+		if b.mine {
+			x, bg = snippetWidth-snippetMargin-w, snippetMine
+		}
+		h := (len(b.lines)+1)*lineHeight + 2*snippetPad
+		fillRect(img, image.Rect(x, y, x+w, y+h), bg)
+		drawText(img, x+snippetPad, y+snippetPad, b.who, agendaMuted, w)
+		for i, l := range b.lines {
+			drawText(img, x+snippetPad, y+snippetPad+(i+1)*lineHeight, l, agendaText, w)
+		}
+		y += h + snippetMargin
+	}
+	return img
+}
+
+// wrapText breaks s into lines of at most width characters, at spaces
+// where it can.
+func wrapText(s string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			for len([]rune(word)) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				r := []rune(word)
+				lines = append(lines, string(r[:width]))
+				word = string(r[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// asciiFold spells s with the characters the image font has: accented
+// Latin letters lose their accents, typographic quotes and dashes become
+// plain ones, and emoji and other symbols are dropped.
+func asciiFold(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n' || (r >= ' ' && r <= '~'):
+			sb.WriteRune(r)
+		case r == '‘' || r == '’':
+			sb.WriteByte('\'')
+		case r == '“' || r == '”':
+			sb.WriteByte('"')
+		case r == '–' || r == '—':
+			sb.WriteByte('-')
+		case r == '…':
+			sb.WriteString("...")
+		case r == '\t' || unicode.IsSpace(r):
+			sb.WriteByte(' ')
+		default:
+			if base, ok := foldLatin[unicode.ToLower(r)]; ok {
+				if unicode.IsUpper(r) {
+					base = unicode.ToUpper(base)
+				}
+				sb.WriteRune(base)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// foldLatin maps accented lower-case Latin letters to their base letter.
+var foldLatin = func() map[rune]rune {
+	m := map[rune]rune{}
+	for base, accented := range map[rune]string{
+		'a': "àáâãäåā", 'c': "çćč", 'e': "èéêëēęě", 'i': "ìíîïī", 'n': "ñń",
+		'o': "òóôõöøō", 'u': "ùúûüū", 'y': "ýÿ", 's': "śšß", 'z': "źżž", 'l': "ł", 'r': "ř", 'd': "ď", 't': "ť",
+	} {
+		for _, r := range accented {
+			m[r] = base
+		}
+	}
+	return m
+}()
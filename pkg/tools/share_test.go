@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func shareHistory() []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: "Where should we eat on Friday?"},
+		{Role: "assistant", Content: "Try **Taberna Sá**, call +351 912 345 678 or write to ana.silva@example.com."},
+		{Role: "user", Content: "Find the train times to Porto"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c1", Name: "web_search"}}},
+		{Role: "tool", ToolCallID: "c1", Content: "Alfa Pendular 08:09 and 10:09, from 2026-10-16, booking ref 4481 2290 1177"},
+		{Role: "assistant", Content: "Trains leave at 08:09 and 10:09."},
+		{Role: "user", Content: "Share that with Rui"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c2", Name: "share"}}},
+	}
+}
+
+// TestShareTool_MessagesAndRedaction verifies the messages before the request are exported as Markdown or text with the personal data asked for masked
+func TestShareTool_MessagesAndRedaction(t *testing.T) {
+	tool := NewShareTool(func(channel, chatID string) []providers.Message { return shareHistory() }, t.TempDir())
+	ctx := WithChat(context.Background(), "telegram", "1")
+
+	result := tool.Execute(ctx, map[string]interface{}{"title": "Friday"})
+	if result.IsError || len(result.Media) != 1 || !strings.HasSuffix(result.Media[0], ".md") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	data, _ := os.ReadFile(result.Media[0])
+	if got := string(data); got != "# Friday\n\n**Me**\n\nFind the train times to Porto\n\n---\n\n**Assistant**\n\nTrains leave at 08:09 and 10:09.\n" {
+		t.Errorf("unexpected snippet:\n%s", got)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{
+		"format":       "text",
+		"from_text":    "eat on friday",
+		"redact":       []interface{}{"emails", "phones"},
+		"redact_terms": []interface{}{"Taberna Sá"},
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "3 item(s) masked") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	data, _ = os.ReadFile(result.Media[0])
+	got := string(data)
+	if !strings.Contains(got, "Me:\nWhere should we eat on Friday?") || !strings.Contains(got, "Try [redacted], call [phone] or write to [email].") ||
+		!strings.Contains(got, "Trains leave at 08:09") || strings.Contains(got, "Share that") {
+		t.Errorf("unexpected snippet:\n%s", got)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"from_text": "ferry"}); !r.IsError {
+		t.Errorf("missing text not reported: %s", r.ForLLM)
+	}
+}
+
+// TestShareTool_ToolResultImage verifies a tool's latest result is shared as an image with numbers masked
+func TestShareTool_ToolResultImage(t *testing.T) {
+	tool := NewShareTool(func(channel, chatID string) []providers.Message { return shareHistory() }, t.TempDir())
+	ctx := WithChat(context.Background(), "telegram", "1")
+
+	result := tool.Execute(ctx, map[string]interface{}{"tool": "web_search", "format": "image", "redact": []interface{}{"numbers"}})
+	if result.IsError || len(result.Media) != 1 || !strings.Contains(result.ForLLM, "1 item(s) masked") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	f, err := os.Open(result.Media[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != snippetWidth || b.Dy() < 2*lineHeight {
+		t.Errorf("unexpected image size %v", b)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"tool": "weather"}); !r.IsError {
+		t.Errorf("tool without a result not reported: %s", r.ForLLM)
+	}
+	if text, _ := redactSnippet("Alfa 08:09 on 2026-10-16, ref 4481 2290 1177", map[string]bool{"numbers": true}, nil); text != "Alfa 08:09 on 2026-10-16, ref [number]" {
+		t.Errorf("unexpected redaction: %s", text)
+	}
+}
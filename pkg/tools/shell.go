@@ -46,6 +46,20 @@ func (t *ExecTool) Name() string {
 	return "exec"
 }
 
+func (t *ExecTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *ExecTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
+// Untrusted is true: command output can hold anything the files and
+// programs it read do.
+func (t *ExecTool) Untrusted(args map[string]interface{}) bool {
+	return true
+}
+
 func (t *ExecTool) Description() string {
 	return "Execute a shell command and return its output. Use with caution."
 }
@@ -211,6 +225,22 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 	return ""
 }
 
+// Configure takes "workspace" (the working directory) and "timeout", as a
+// duration or in seconds.
+func (t *ExecTool) Configure(settings ToolSettings) error {
+	timeout, err := settings.Duration("timeout")
+	if err != nil {
+		return err
+	}
+	if timeout < 0 {
+		return fmt.Errorf("timeout: must not be negative, got %s", timeout)
+	}
+	if timeout > 0 {
+		t.timeout = timeout
+	}
+	return configureWorkspace(settings, &t.workingDir)
+}
+
 func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
@@ -0,0 +1,295 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/governor"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const (
+	defaultSlideshowPhotos = 30
+	maxSlideshowPhotos     = 60
+	// slideshowWidth and slideshowHeight are the video's size; photos are
+	// fetched at most this large and letterboxed into it
+	slideshowWidth  = 1280
+	slideshowHeight = 720
+	// slideshowTimeout bounds the encoding, which is slow on small boards
+	slideshowTimeout = 10 * time.Minute
+)
+
+// SlideshowTool makes a short video from the photos of a Google Photos
+// album or search, each shown for a few seconds, and sends it to the
+// chat. Photos are downloaded at the video's size and encoded with ffmpeg.
+type SlideshowTool struct {
+	photos   *GooglePhotosClient
+	profiles *profile.Store
+	outDir   string
+	client   *http.Client
+	// bin is the ffmpeg executable
+	bin string
+}
+
+// NewSlideshowTool creates the tool. Videos are written to outDir.
+func NewSlideshowTool(photos *GooglePhotosClient, profiles *profile.Store, outDir string) *SlideshowTool {
+	return &SlideshowTool{
+		photos:   photos,
+		profiles: profiles,
+		outDir:   outDir,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		bin:      "ffmpeg",
+	}
+}
+
+func (t *SlideshowTool) Name() string {
+	return "photo_slideshow"
+}
+
+func (t *SlideshowTool) Description() string {
+	return "Make a slideshow video from Google Photos and send it to the user, e.g. \"make a recap video of the birthday\": give an album (title or ID), or from/to dates or a content category as in the photos tool. Photos are shown in order for a few seconds each; videos in the selection are skipped."
+}
+
+func (t *SlideshowTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"album": map[string]interface{}{
+				"type":        "string",
+				"description": "Album title (or words from it) or album ID",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "Without album: first day, e.g. 2026-05-02, or a span such as \"last weekend\"",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Without album: last day (default: the end of from)",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Without album or dates: content categories such as \"pets\" or \"beach\"",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum photos (default %d, at most %d)", defaultSlideshowPhotos, maxSlideshowPhotos),
+			},
+			"seconds": map[string]interface{}{
+				"type":        "number",
+				"description": "Seconds each photo is shown (default 3)",
+			},
+		},
+	}
+}
+
+func (t *SlideshowTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if _, err := exec.LookPath(t.bin); err != nil {
+		return ErrorResult("slideshows need ffmpeg, which is not installed on this device")
+	}
+	limit := defaultSlideshowPhotos
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = min(int(l), maxSlideshowPhotos)
+	}
+	seconds := 3.0
+	if s, ok := args["seconds"].(float64); ok && s > 0 {
+		seconds = min(max(s, 1), 10)
+	}
+
+	items, source, err := t.selectPhotos(ctx, args, limit)
+	if err != nil {
+		if _, ok := err.(photosArgError); ok {
+			return ErrorResult(err.Error())
+		}
+		return ErrorResult(fmt.Sprintf("finding the photos failed: %v", err)).WithError(err)
+	}
+	if len(items) == 0 {
+		return SilentResult(fmt.Sprintf("No photos found in %s, so no slideshow was made.", source))
+	}
+
+	if err := os.MkdirAll(t.outDir, 0755); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	prunePreviews(t.outDir, time.Now().Add(-previewTTL))
+	frames, err := os.MkdirTemp(t.outDir, "frames-")
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	defer os.RemoveAll(frames)
+	n := t.download(ctx, items, frames)
+	if n == 0 {
+		return ErrorResult("none of the photos could be downloaded")
+	}
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	out := filepath.Join(t.outDir, "slideshow-"+hex.EncodeToString(id)+".mp4")
+	if err := t.encode(ctx, frames, seconds, out); err != nil {
+		return ErrorResult(fmt.Sprintf("making the video failed: %v", err)).WithError(err)
+	}
+	length := time.Duration(float64(n) * seconds * float64(time.Second)).Round(time.Second)
+	text := fmt.Sprintf("Made a %s slideshow of %d photo(s) from %s; the video was sent to the user.", length, n, source)
+	if skipped := len(items) - n; skipped > 0 {
+		text += fmt.Sprintf(" %d photo(s) could not be downloaded and were left out.", skipped)
+	}
+	return &ToolResult{ForLLM: text, Media: []string{out}}
+}
+
+// selectPhotos returns the photos to show, in order, and describes where
+// they come from.
+func (t *SlideshowTool) selectPhotos(ctx context.Context, args map[string]interface{}, limit int) ([]PhotoItem, string, error) {
+	var items []PhotoItem
+	var source string
+	if ref, _ := args["album"].(string); strings.TrimSpace(ref) != "" {
+		album, err := t.findAlbum(ctx, strings.TrimSpace(ref))
+		if err != nil {
+			return nil, "", err
+		}
+		// Fetch more than needed: videos are dropped below
+		if items, err = t.photos.SearchAlbum(ctx, album.ID, limit*2); err != nil {
+			return nil, "", err
+		}
+		source = fmt.Sprintf("the album %q", album.Title)
+	} else {
+		var prof profile.Profile
+		if t.profiles != nil {
+			channel, chatID := ChatFromContext(ctx)
+			prof = t.profiles.Get(channel + ":" + chatID)
+		}
+		search := map[string]interface{}{"media_type": "photo"}
+		for _, key := range []string{"from", "to"} {
+			if v, ok := args[key]; ok {
+				search[key] = v
+			}
+		}
+		query, _ := args["query"].(string)
+		var err error
+		if items, err = searchPhotos(ctx, t.photos, prof, search, query, limit*2); err != nil {
+			return nil, "", err
+		}
+		source = "the search"
+	}
+	var photos []PhotoItem
+	for _, item := range items {
+		if !strings.HasPrefix(item.MimeType, "video/") && item.BaseURL != "" && len(photos) < limit {
+			photos = append(photos, item)
+		}
+	}
+	return photos, source, nil
+}
+
+// findAlbum picks an album by ID or by words in its title.
+func (t *SlideshowTool) findAlbum(ctx context.Context, ref string) (*PhotoAlbum, error) {
+	albums, err := t.photos.ListAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var match *PhotoAlbum
+	for i, a := range albums {
+		if a.ID == ref {
+			return &albums[i], nil
+		}
+		if strings.Contains(strings.ToLower(a.Title), strings.ToLower(ref)) && match == nil {
+			match = &albums[i]
+		}
+	}
+	if match == nil {
+		return nil, photosArgError(fmt.Sprintf("no album matching %q", ref))
+	}
+	return match, nil
+}
+
+// download saves the photos, sized for the video, as numbered frames in
+// dir, keeping their order and skipping ones that fail. It returns how
+// many were saved.
+func (t *SlideshowTool) download(ctx context.Context, items []PhotoItem, dir string) int {
+	ok := make([]bool, len(items))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, previewFetchers)
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, baseURL string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ok[i] = t.fetch(ctx, baseURL, filepath.Join(dir, fmt.Sprintf("photo-%03d.jpg", i))) == nil
+		}(i, item.BaseURL)
+	}
+	wg.Wait()
+
+	// ffmpeg reads frames by consecutive numbers, so close the gaps
+	n := 0
+	for i, saved := range ok {
+		if !saved {
+			continue
+		}
+		if i != n {
+			os.Rename(filepath.Join(dir, fmt.Sprintf("photo-%03d.jpg", i)), filepath.Join(dir, fmt.Sprintf("photo-%03d.jpg", n)))
+		}
+		n++
+	}
+	return n
+}
+
+func (t *SlideshowTool) fetch(ctx context.Context, baseURL, path string) error {
+	if err := egress.CheckDownloadURL(baseURL); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s=w%d-h%d", baseURL, slideshowWidth, slideshowHeight), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed (%d)", resp.StatusCode)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, io.LimitReader(resp.Body, 20<<20))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// encode turns the frames into an H.264 video phones play inline, each
+// photo letterboxed to the video's size.
+func (t *SlideshowTool) encode(ctx context.Context, frames string, seconds float64, out string) error {
+	release, err := governor.Acquire(ctx, governor.Transcode)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, slideshowTimeout)
+	defer cancel()
+	filter := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,format=yuv420p,fps=25",
+		slideshowWidth, slideshowHeight, slideshowWidth, slideshowHeight)
+	cmd := exec.CommandContext(ctx, t.bin, "-y", "-loglevel", "error",
+		"-framerate", fmt.Sprintf("1/%g", seconds), "-i", filepath.Join(frames, "photo-%03d.jpg"),
+		"-vf", filter, "-c:v", "libx264", "-preset", "veryfast", "-movflags", "+faststart", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestSlideshowTool_EncodesAlbumPhotos verifies an album's photos, without its videos, are downloaded in order and handed to ffmpeg
+func TestSlideshowTool_EncodesAlbumPhotos(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	var ids []string
+	for _, m := range []testkit.MediaItem{
+		{Filename: "cake.jpg", Data: []byte("cake")},
+		{Filename: "party.mp4", MimeType: "video/mp4", Data: []byte("video")},
+		{Filename: "candles.jpg", Data: []byte("candles")},
+	} {
+		ids = append(ids, g.AddMedia(m))
+	}
+	g.AddAlbum("Ana's birthday", ids...)
+
+	// The fake ffmpeg lists the frames it was given into the output file
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\nfor last; do :; done\nfor f in \"$(dirname \"$7\")\"/photo-*.jpg; do cat \"$f\"; echo; done > \"$last\"\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tool := NewSlideshowTool(NewGooglePhotosClient(testkit.Token), nil, filepath.Join(dir, "out"))
+	tool.bin = bin
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"album": "birthday", "seconds": float64(2)})
+	if result.IsError {
+		t.Fatalf("slideshow failed: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "4s slideshow of 2 photo(s)") {
+		t.Errorf("Expected a 4s slideshow of 2 photos, got: %s", result.ForLLM)
+	}
+	if len(result.Media) != 1 {
+		t.Fatalf("Expected the video as media, got %v", result.Media)
+	}
+	video, _ := os.ReadFile(result.Media[0])
+	if string(video) != "cake\ncandles\n" {
+		t.Errorf("Expected the two photos in order, got %q", video)
+	}
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SMSSender sends text messages to phone numbers.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// TwilioSMS sends text messages through a Twilio account.
+type TwilioSMS struct {
+	accountSID string
+	authToken  string
+	from       string
+	baseURL    string
+	client     *http.Client
+}
+
+func NewTwilioSMS(accountSID, authToken, from string) *TwilioSMS {
+	return &TwilioSMS{
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		baseURL:    "https://api.twilio.com/2010-04-01",
+		client:     &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+// SendSMS implements SMSSender. to is a phone number with country code.
+func (s *TwilioSMS) SendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("To", "+"+normalizePhone(to))
+	form.Set("From", s.from)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", s.baseURL, url.PathEscape(s.accountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Message != "" {
+		return fmt.Errorf("twilio: %s", apiErr.Message)
+	}
+	return fmt.Errorf("twilio: HTTP %d", resp.StatusCode)
+}
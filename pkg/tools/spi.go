@@ -20,6 +20,14 @@ func (t *SPITool) Name() string {
 	return "spi"
 }
 
+func (t *SPITool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *SPITool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "transfer")
+}
+
 func (t *SPITool) Description() string {
 	return "Interact with SPI bus devices for high-speed peripheral communication. Actions: list (find SPI devices), transfer (full-duplex send/receive), read (receive bytes). Linux only."
 }
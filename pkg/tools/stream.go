@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"sync"
+)
+
+// ChunkFunc receives a part of a tool's result as soon as it is ready,
+// for the user to watch while the tool runs.
+type ChunkFunc func(chunk string)
+
+// StreamingTool is an optional interface for tools whose result arrives
+// in parts, such as searches over several services. When the caller
+// listens (see WithStream), the registry runs ExecuteStream instead of
+// Execute; the returned result is still the complete one the model sees.
+type StreamingTool interface {
+	Tool
+	ExecuteStream(ctx context.Context, args map[string]interface{}, emit ChunkFunc) *ToolResult
+}
+
+type streamKey struct{}
+
+// WithStream makes streaming tools called with ctx report their chunks
+// to fn.
+func WithStream(ctx context.Context, fn ChunkFunc) context.Context {
+	return context.WithValue(ctx, streamKey{}, fn)
+}
+
+// streamFromContext returns the listener set with WithStream, wrapped so
+// a tool may emit from several goroutines and chunks sent after the call
+// returned are dropped. The returned stop ends the call.
+func streamFromContext(ctx context.Context) (emit ChunkFunc, stop func()) {
+	fn, _ := ctx.Value(streamKey{}).(ChunkFunc)
+	if fn == nil {
+		return nil, func() {}
+	}
+	var mu sync.Mutex
+	done := false
+	emit = func(chunk string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !done && chunk != "" {
+			fn(chunk)
+		}
+	}
+	return emit, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		done = true
+	}
+}
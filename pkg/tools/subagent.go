@@ -19,6 +19,8 @@ type SubagentTask struct {
 	Status        string
 	Result        string
 	Created       int64
+
+	cancel context.CancelFunc
 }
 
 type SubagentManager struct {
@@ -77,6 +79,9 @@ func (sm *SubagentManager) Spawn(ctx context.Context, task, label, originChannel
 		Status:        "running",
 		Created:       time.Now().UnixMilli(),
 	}
+	// The task outlives the round that spawned it, so it gets its own
+	// cancel func instead of the round's
+	ctx, subagentTask.cancel = context.WithCancel(context.WithoutCancel(ctx))
 	sm.tasks[taskID] = subagentTask
 
 	// Start task in background with context cancellation support
@@ -89,13 +94,18 @@ func (sm *SubagentManager) Spawn(ctx context.Context, task, label, originChannel
 }
 
 func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, callback AsyncCallback) {
+	if task.cancel != nil {
+		defer task.cancel()
+	}
 	task.Status = "running"
 	task.Created = time.Now().UnixMilli()
 
 	// Build system prompt for subagent
 	systemPrompt := `You are a subagent. Complete the given task independently and report the result.
 You have access to tools - use them as needed to complete your task.
-After completing the task, provide a clear summary of what was done.`
+After completing the task, provide a clear summary of what was done.
+
+` + UntrustedPrompt
 
 	messages := []providers.Message{
 		{
@@ -194,6 +204,19 @@ func (sm *SubagentManager) GetTask(taskID string) (*SubagentTask, bool) {
 	return task, ok
 }
 
+// Cancel stops a running task. It reports false if the task is unknown or
+// already finished.
+func (sm *SubagentManager) Cancel(taskID string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	task, ok := sm.tasks[taskID]
+	if !ok || task.Status != "running" || task.cancel == nil {
+		return false
+	}
+	task.cancel()
+	return true
+}
+
 func (sm *SubagentManager) ListTasks() []*SubagentTask {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -268,7 +291,7 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 	messages := []providers.Message{
 		{
 			Role:    "system",
-			Content: "You are a subagent. Complete the given task independently and provide a clear, concise result.",
+			Content: "You are a subagent. Complete the given task independently and provide a clear, concise result.\n\n" + UntrustedPrompt,
 		},
 		{
 			Role:    "user",
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// recordingProvider answers every call with a fixed summary and remembers the inputs
+type recordingProvider struct {
+	mu     sync.Mutex
+	inputs []string
+}
+
+func (p *recordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inputs = append(p.inputs, messages[len(messages)-1].Content)
+	return &providers.LLMResponse{Content: "summary " + string(rune('A'+len(p.inputs)-1))}, nil
+}
+
+func (p *recordingProvider) GetDefaultModel() string { return "test" }
+
+// TestSplitForSummary verifies chunks stay under the limit and break on paragraphs
+func TestSplitForSummary(t *testing.T) {
+	text := strings.Repeat("word ", 30) + "\n\n" + strings.Repeat("more ", 30)
+	chunks := splitForSummary(text, 200)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d: %q", len(chunks), chunks)
+	}
+	if strings.Contains(chunks[0], "more") {
+		t.Errorf("Expected the first chunk to end at the paragraph break: %q", chunks[0])
+	}
+	for _, c := range chunks {
+		if len(c) > 200 {
+			t.Errorf("Chunk too long: %d", len(c))
+		}
+	}
+}
+
+// TestSummarizeTool_MapReduceAndCache verifies long files are summarized in parts and the result is cached
+func TestSummarizeTool_MapReduceAndCache(t *testing.T) {
+	workspace := t.TempDir()
+	var doc strings.Builder
+	for i := 0; i < 5; i++ {
+		doc.WriteString(strings.Repeat("lorem ipsum dolor ", 50) + "\n\n")
+	}
+	os.WriteFile(filepath.Join(workspace, "report.txt"), []byte(doc.String()), 0644)
+
+	provider := &recordingProvider{}
+	tool := NewSummarizeTool(provider, "test", workspace, true, nil, nil)
+	tool.chunkChars = 1000
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"path": "report.txt"})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	// 5 map calls plus one reduce over the notes
+	if len(provider.inputs) != 6 {
+		t.Fatalf("Expected 6 LLM calls, got %d", len(provider.inputs))
+	}
+	if !strings.Contains(provider.inputs[5], "[Part 5/5]") {
+		t.Errorf("Expected the reduce step to see all parts:\n%s", provider.inputs[5])
+	}
+	if !strings.Contains(result.ForLLM, "Summary of report.txt") || !strings.HasSuffix(result.ForLLM, "summary F") {
+		t.Errorf("Unexpected result: %s", result.ForLLM)
+	}
+
+	cached := tool.Execute(context.Background(), map[string]interface{}{"path": "report.txt"})
+	if len(provider.inputs) != 6 || !strings.Contains(cached.ForLLM, "cached") {
+		t.Errorf("Expected a cache hit, got %d calls: %s", len(provider.inputs), cached.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": "../outside.txt"})
+	if !result.IsError {
+		t.Errorf("Expected paths outside the workspace to be rejected")
+	}
+}
+
+// TestSummarizeTool_DriveAndEmail verifies Google Docs are exported as text and email bodies are decoded
+func TestSummarizeTool_DriveAndEmail(t *testing.T) {
+	body := base64.URLEncoding.EncodeToString([]byte("Please send the signed contract by Friday."))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/drive/files/doc1":
+			w.Write([]byte(`{"name":"Lease","mimeType":"application/vnd.google-apps.document"}`))
+		case r.URL.Path == "/drive/files/doc1/export":
+			if r.URL.Query().Get("mimeType") != "text/plain" {
+				t.Errorf("Unexpected export type: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte("The tenant pays rent monthly."))
+		case r.URL.Path == "/gmail/users/me/messages/m1":
+			w.Write([]byte(`{"payload":{"mimeType":"multipart/alternative","headers":[{"name":"Subject","value":"Contract"}],
+				"parts":[{"mimeType":"text/html","body":{"data":""}},{"mimeType":"text/plain","body":{"data":"` + body + `"}}]}}`))
+		default:
+			t.Errorf("Unexpected request: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := &recordingProvider{}
+	tool := NewSummarizeTool(provider, "test", t.TempDir(), true, func(ctx context.Context) (string, error) { return "tok", nil }, nil)
+	tool.driveURL = server.URL + "/drive"
+	tool.gmailURL = server.URL + "/gmail"
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"drive_file_id": "doc1"})
+	if result.IsError || provider.inputs[0] != QuoteUntrusted("summarize", "The tenant pays rent monthly.") {
+		t.Errorf("Unexpected drive result: %s (input %q)", result.ForLLM, provider.inputs)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"email_id": "m1"})
+	if result.IsError || !strings.Contains(provider.inputs[1], "Subject: Contract\n\nPlease send the signed contract by Friday.") {
+		t.Errorf("Unexpected email result: %s (input %q)", result.ForLLM, provider.inputs)
+	}
+}
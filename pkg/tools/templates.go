@@ -0,0 +1,402 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/automation"
+)
+
+// MessageTemplate is a message the user sends often, such as "running
+// late", with {placeholders} filled in when it is sent.
+type MessageTemplate struct {
+	Name    string    `json:"name"`
+	Text    string    `json:"text"`
+	Updated time.Time `json:"updated"`
+	// Chat is the chat it was saved from, if known
+	Chat string `json:"chat,omitempty"`
+	// File is the automation file defining the template, empty for ones
+	// saved from chat
+	File string `json:"-"`
+}
+
+// TemplateStore keeps the user's message templates in the workspace.
+// Templates defined in automation files are offered too; they take
+// precedence and can only be changed in their file.
+type TemplateStore struct {
+	path      string
+	defs      *automation.Store
+	mu        sync.Mutex
+	templates map[string]*MessageTemplate
+}
+
+// NewTemplateStore loads the templates saved in the workspace.
+func NewTemplateStore(workspace string) *TemplateStore {
+	s := &TemplateStore{
+		path:      filepath.Join(workspace, "state", "templates.json"),
+		templates: make(map[string]*MessageTemplate),
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.templates)
+	}
+	return s
+}
+
+// SetDefinitions adds the templates defined in automation files.
+func (s *TemplateStore) SetDefinitions(defs *automation.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defs = defs
+}
+
+// defined returns the file-defined template named key, if any. Callers
+// hold s.mu.
+func (s *TemplateStore) defined(key string) (MessageTemplate, bool) {
+	if s.defs == nil {
+		return MessageTemplate{}, false
+	}
+	for _, t := range s.defs.Current().Templates {
+		if templateKey(t.Name) == key {
+			return MessageTemplate{Name: t.Name, Text: t.Text, File: t.File}, true
+		}
+	}
+	return MessageTemplate{}, false
+}
+
+// templateKey normalizes a template name so "Running late" and "running
+// late template" find the same one.
+func templateKey(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	name = strings.Trim(name, `"'`)
+	return strings.TrimSuffix(name, " template")
+}
+
+// Get returns the named template.
+func (s *TemplateStore) Get(name string) (MessageTemplate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tpl, ok := s.defined(templateKey(name)); ok {
+		return tpl, true
+	}
+	if tpl, ok := s.templates[templateKey(name)]; ok {
+		return *tpl, true
+	}
+	return MessageTemplate{}, false
+}
+
+// Save adds or replaces a template, saved from chat ("channel:chatID",
+// may be empty).
+func (s *TemplateStore) Save(name, text, chat string) error {
+	key := templateKey(name)
+	if key == "" || strings.TrimSpace(text) == "" {
+		return fmt.Errorf("a template needs a name and text")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tpl, ok := s.defined(key); ok {
+		return fmt.Errorf("the %q template is defined in %s; change it there", tpl.Name, tpl.File)
+	}
+	s.templates[key] = &MessageTemplate{Name: strings.TrimSpace(name), Text: text, Updated: time.Now(), Chat: chat}
+	return saveJSONAtomic(s.path, s.templates)
+}
+
+// Delete removes a template, reporting whether it existed.
+func (s *TemplateStore) Delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := templateKey(name)
+	if tpl, ok := s.defined(key); ok {
+		return false, fmt.Errorf("the %q template is defined in %s; remove it there", tpl.Name, tpl.File)
+	}
+	if _, ok := s.templates[key]; !ok {
+		return false, nil
+	}
+	delete(s.templates, key)
+	return true, saveJSONAtomic(s.path, s.templates)
+}
+
+// List returns the templates sorted by name.
+func (s *TemplateStore) List() []MessageTemplate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]MessageTemplate, 0, len(s.templates))
+	for key, tpl := range s.templates {
+		if _, ok := s.defined(key); !ok {
+			list = append(list, *tpl)
+		}
+	}
+	if s.defs != nil {
+		for _, t := range s.defs.Current().Templates {
+			list = append(list, MessageTemplate{Name: t.Name, Text: t.Text, File: t.File})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return templateKey(list[i].Name) < templateKey(list[j].Name) })
+	return list
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]*)\}`)
+
+// templateVariables lists the placeholders in text, in order of first use.
+func templateVariables(text string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(m[1])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// expandTemplate fills the placeholders of text from vars, adding the
+// ones derived from others: first_name from name, eta_time from eta and
+// the current time and date. It returns the placeholders that had no
+// value, which are left in the text.
+func expandTemplate(text string, vars map[string]string, now time.Time) (string, []string) {
+	values := make(map[string]string, len(vars)+4)
+	for k, v := range vars {
+		values[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	if name := values["name"]; name != "" && values["first_name"] == "" {
+		values["first_name"] = strings.Fields(name)[0]
+	}
+	if eta := values["eta"]; eta != "" {
+		if d, at, ok := parseETA(eta, now); ok {
+			values["eta"] = formatETA(d)
+			if values["eta_time"] == "" {
+				values["eta_time"] = at.Format("15:04")
+			}
+		}
+	}
+	if values["time"] == "" {
+		values["time"] = now.Format("15:04")
+	}
+	if values["date"] == "" {
+		values["date"] = now.Format("Jan 2")
+	}
+
+	var missing []string
+	out := templatePlaceholder.ReplaceAllStringFunc(text, func(m string) string {
+		name := strings.ToLower(m[1 : len(m)-1])
+		if v := values[name]; v != "" {
+			return v
+		}
+		for _, seen := range missing {
+			if seen == name {
+				return m
+			}
+		}
+		missing = append(missing, name)
+		return m
+	})
+	return out, missing
+}
+
+var etaAmount = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*(h|hr|hrs|hours?|m|min|mins|minutes?)?$`)
+
+// parseETA reads an ETA given as minutes ("15"), a duration ("20 min",
+// "1h30m", "1.5 hours") or a clock time ("14:30"), returning how long
+// until then and when that is.
+func parseETA(s string, now time.Time) (time.Duration, time.Time, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if clock, err := time.Parse("15:04", s); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if at.Before(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at.Sub(now).Round(time.Minute), at, true
+	}
+	if d, err := time.ParseDuration(strings.ReplaceAll(s, " ", "")); err == nil && d > 0 {
+		return d, now.Add(d), true
+	}
+	m := etaAmount.FindStringSubmatch(s)
+	if m == nil {
+		return 0, time.Time{}, false
+	}
+	n, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil || n <= 0 {
+		return 0, time.Time{}, false
+	}
+	unit := time.Minute
+	if strings.HasPrefix(m[2], "h") {
+		unit = time.Hour
+	}
+	d := time.Duration(n * float64(unit)).Round(time.Minute)
+	return d, now.Add(d), true
+}
+
+// formatETA writes a duration as "15 min" or "1 h 30 min".
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%d min", m)
+	case m == 0:
+		return fmt.Sprintf("%d h", h)
+	default:
+		return fmt.Sprintf("%d h %d min", h, m)
+	}
+}
+
+// TemplatesTool manages message templates; the message tool sends them.
+type TemplatesTool struct {
+	store *TemplateStore
+}
+
+func NewTemplatesTool(store *TemplateStore) *TemplatesTool {
+	return &TemplatesTool{store: store}
+}
+
+func (t *TemplatesTool) Name() string {
+	return "templates"
+}
+
+func (t *TemplatesTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *TemplatesTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "save", "delete")
+}
+
+func (t *TemplatesTool) Description() string {
+	return "Keep message templates the user sends often, such as \"running late\": text with placeholders in braces, like \"Hi {first_name}, running late, there in {eta} (around {eta_time})\". {name}, {first_name}, {eta}, {eta_time}, {time} and {date} are filled in for them; any other {placeholder} is a variable to pass when sending. To send one, use the message tool with template and vars, e.g. for \"send the running late template to Ana\"."
+}
+
+func (t *TemplatesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"save", "show", "list", "delete"},
+				"description": "save adds or replaces a template, show prints one with its placeholders, list shows them all, delete removes one",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Template name, e.g. \"running late\"",
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "For save: the template text with {placeholders}",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *TemplatesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	name, _ := args["name"].(string)
+	switch action {
+	case "list":
+		list := t.store.List()
+		if len(list) == 0 {
+			return SilentResult("No message templates saved yet.")
+		}
+		var sb strings.Builder
+		sb.WriteString("Message templates:")
+		for _, tpl := range list {
+			fmt.Fprintf(&sb, "\n- %s: %s", tpl.Name, tpl.Text)
+			if tpl.File != "" {
+				fmt.Fprintf(&sb, " [from %s]", tpl.File)
+			}
+		}
+		return SilentResult(sb.String())
+
+	case "show":
+		tpl, ok := t.store.Get(name)
+		if !ok {
+			return ErrorResult(fmt.Sprintf("no template named %q", name))
+		}
+		out := fmt.Sprintf("%s: %s", tpl.Name, tpl.Text)
+		if vars := templateVariables(tpl.Text); len(vars) > 0 {
+			out += "\nPlaceholders: " + strings.Join(vars, ", ")
+		}
+		return SilentResult(out)
+
+	case "save":
+		text, _ := args["text"].(string)
+		channel, chatID := ChatFromContext(ctx)
+		chat := ""
+		if chatID != "" {
+			chat = channel + ":" + chatID
+		}
+		if err := t.store.Save(name, text, chat); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		out := fmt.Sprintf("Saved the %q template.", strings.TrimSpace(name))
+		if vars := templateVariables(text); len(vars) > 0 {
+			out += " Placeholders: " + strings.Join(vars, ", ") + "."
+		}
+		return SilentResult(out)
+
+	case "delete":
+		removed, err := t.store.Delete(name)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if !removed {
+			return ErrorResult(fmt.Sprintf("no template named %q", name))
+		}
+		return SilentResult(fmt.Sprintf("Deleted the %q template.", strings.TrimSpace(name)))
+	}
+	return ErrorResult(fmt.Sprintf("unknown action %q", action))
+}
+
+// ChatData implements ChatDataStore: the templates saved from the chat.
+// Templates are shared by every chat; older ones record no chat.
+func (s *TemplateStore) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var saved []MessageTemplate
+	for _, tpl := range s.templates {
+		if tpl.Chat == chatKey {
+			saved = append(saved, *tpl)
+		}
+	}
+	if len(saved) == 0 {
+		return nil, nil
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Name < saved[j].Name })
+	return saved, nil
+}
+
+// PurgeChat implements ChatDataStore.
+func (s *TemplateStore) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, tpl := range s.templates {
+		if tpl.Chat == chatKey {
+			delete(s.templates, key)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, saveJSONAtomic(s.path, s.templates)
+}
+
+// ChatData implements ChatDataStore for the store behind the tool.
+func (t *TemplatesTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	return t.store.ChatData(ctx, chatKey)
+}
+
+// PurgeChat implements ChatDataStore for the store behind the tool.
+func (t *TemplatesTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	return t.store.PurgeChat(ctx, chatKey)
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExpandTemplate_DerivedVariablesAndMissing verifies first_name and eta_time are derived, ETAs in several forms are normalized and unfilled placeholders are reported
+func TestExpandTemplate_DerivedVariablesAndMissing(t *testing.T) {
+	now := time.Date(2026, 3, 10, 14, 20, 0, 0, time.UTC)
+	text := "Hi {first_name}, running late, there in {eta} (around {eta_time})"
+	cases := map[string]string{
+		"15":        "Hi Ana, running late, there in 15 min (around 14:35)",
+		"1h30m":     "Hi Ana, running late, there in 1 h 30 min (around 15:50)",
+		"20 min":    "Hi Ana, running late, there in 20 min (around 14:40)",
+		"1.5 hours": "Hi Ana, running late, there in 1 h 30 min (around 15:50)",
+		"15:00":     "Hi Ana, running late, there in 40 min (around 15:00)",
+	}
+	for eta, want := range cases {
+		got, missing := expandTemplate(text, map[string]string{"name": "Ana Souza", "eta": eta}, now)
+		if got != want || len(missing) != 0 {
+			t.Errorf("eta %q: got %q (missing %v), want %q", eta, got, missing, want)
+		}
+	}
+
+	got, missing := expandTemplate("{Place} at {time}, {place}", map[string]string{}, now)
+	if got != "{Place} at 14:20, {place}" || len(missing) != 1 || missing[0] != "place" {
+		t.Errorf("got %q, missing %v", got, missing)
+	}
+}
+
+// TestMessageTool_Execute_Template verifies a saved template is sent filled in from vars, and one with unfilled placeholders is refused
+func TestMessageTool_Execute_Template(t *testing.T) {
+	workspace := t.TempDir()
+	store := NewTemplateStore(workspace)
+	templates := NewTemplatesTool(store)
+	result := templates.Execute(context.Background(), map[string]interface{}{
+		"action": "save",
+		"name":   "Running late",
+		"text":   "Hi {first_name}, I'm running late, there in {eta}. Sorry! {sign}",
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "first_name, eta, sign") {
+		t.Fatalf("save: %s", result.ForLLM)
+	}
+
+	tool := NewMessageTool()
+	tool.SetTemplates(store, nil)
+	var sent string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sent = content
+		return nil
+	})
+	ctx := WithChat(context.Background(), "whatsapp", "5511999990000")
+
+	result = tool.Execute(ctx, map[string]interface{}{
+		"template": "running late template",
+		"vars":     map[string]interface{}{"name": "Ana Souza", "eta": float64(10)},
+	})
+	if !result.IsError || sent != "" || !strings.Contains(result.ForLLM, "needs a value for sign") {
+		t.Fatalf("template with a missing variable sent: %q, %s", sent, result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{
+		"template": "running late",
+		"content":  "Traffic on the bridge.",
+		"vars":     map[string]interface{}{"name": "Ana Souza", "eta": float64(10), "sign": "– Rui"},
+	})
+	if result.IsError {
+		t.Fatalf("send failed: %s", result.ForLLM)
+	}
+	if want := "Hi Ana, I'm running late, there in 10 min. Sorry! – Rui\nTraffic on the bridge."; sent != want {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+
+	if reloaded, ok := NewTemplateStore(workspace).Get("running late"); !ok || reloaded.Name != "Running late" {
+		t.Errorf("template not persisted: %+v", reloaded)
+	}
+}
@@ -49,7 +49,7 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		// 1. Build tool definitions
 		var providerToolDefs []providers.ToolDefinition
 		if config.Tools != nil {
-			providerToolDefs = config.Tools.ToProviderDefs()
+			providerToolDefs = config.Tools.ToProviderDefsForChat(channel, chatID, SenderFromContext(ctx))
 		}
 
 		// 2. Set default LLM options
@@ -117,8 +117,9 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		for _, tc := range response.ToolCalls {
 			argsJSON, _ := json.Marshal(tc.Arguments)
 			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("toolloop", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
+			logger.InfoCF("toolloop", "Tool call: "+tc.Name,
 				map[string]any{
+					"args":      argsPreview,
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
@@ -136,6 +137,9 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 			if contentForLLM == "" && toolResult.Err != nil {
 				contentForLLM = toolResult.Err.Error()
 			}
+			if config.Tools != nil {
+				contentForLLM = config.Tools.QuoteResult(tc.Name, tc.Arguments, contentForLLM)
+			}
 
 			// Add tool result message
 			toolResultMsg := providers.Message{
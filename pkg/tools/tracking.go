@@ -0,0 +1,557 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+const trackingWatchJobKind = "tracking_watch"
+
+// TrackingStatus is a normalized flight or parcel status.
+type TrackingStatus struct {
+	ID      string // flight number or tracking number
+	Status  string // short machine-ish status, e.g. "scheduled", "InTransit"
+	Summary string // human readable one-liner
+	Final   bool   // landed / delivered / cancelled: no further updates expected
+}
+
+// FlightTracker is implemented by flight status backends.
+type FlightTracker interface {
+	TrackFlight(ctx context.Context, flight, date string) (*TrackingStatus, error)
+}
+
+// ParcelTracker is implemented by parcel tracking backends.
+type ParcelTracker interface {
+	TrackParcel(ctx context.Context, number, carrier string) (*TrackingStatus, error)
+}
+
+// APIError is an HTTP API's answer with a status outside 2xx.
+type APIError struct {
+	Status int
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (%d): %s", e.Status, e.Body)
+}
+
+func doJSONRequest(ctx context.Context, client *http.Client, method, reqURL string, headers map[string]string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// AviationStackTracker reads real-time flight status from aviationstack.com.
+type AviationStackTracker struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewAviationStackTracker(apiKey string) *AviationStackTracker {
+	return &AviationStackTracker{
+		apiKey:  apiKey,
+		baseURL: "http://api.aviationstack.com/v1",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type aviationStackEndpoint struct {
+	Airport   string `json:"airport"`
+	IATA      string `json:"iata"`
+	Terminal  string `json:"terminal"`
+	Gate      string `json:"gate"`
+	Delay     int    `json:"delay"`
+	Scheduled string `json:"scheduled"`
+	Estimated string `json:"estimated"`
+	Actual    string `json:"actual"`
+}
+
+func (e aviationStackEndpoint) describe() string {
+	parts := []string{e.IATA}
+	when := e.Estimated
+	if e.Actual != "" {
+		when = e.Actual
+	}
+	if when == "" {
+		when = e.Scheduled
+	}
+	if t, err := time.Parse(time.RFC3339, when); err == nil {
+		parts = append(parts, t.Format("Jan 2 15:04"))
+	}
+	if e.Terminal != "" {
+		parts = append(parts, "T"+e.Terminal)
+	}
+	if e.Gate != "" {
+		parts = append(parts, "gate "+e.Gate)
+	}
+	if e.Delay > 0 {
+		parts = append(parts, fmt.Sprintf("+%dmin", e.Delay))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p *AviationStackTracker) TrackFlight(ctx context.Context, flight, date string) (*TrackingStatus, error) {
+	flight = strings.ToUpper(strings.ReplaceAll(flight, " ", ""))
+	params := url.Values{}
+	params.Set("access_key", p.apiKey)
+	params.Set("flight_iata", flight)
+	if date != "" {
+		params.Set("flight_date", date)
+	}
+
+	var resp struct {
+		Data []struct {
+			FlightStatus string                `json:"flight_status"`
+			Departure    aviationStackEndpoint `json:"departure"`
+			Arrival      aviationStackEndpoint `json:"arrival"`
+			Airline      struct {
+				Name string `json:"name"`
+			} `json:"airline"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := doJSONRequest(ctx, p.client, http.MethodGet, p.baseURL+"/flights?"+params.Encode(), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("aviationstack: %s", resp.Error.Message)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("flight %s not found", flight)
+	}
+
+	f := resp.Data[0]
+	summary := fmt.Sprintf("%s %s: %s — departs %s, arrives %s",
+		f.Airline.Name, flight, f.FlightStatus, f.Departure.describe(), f.Arrival.describe())
+	switch f.FlightStatus {
+	case "landed", "cancelled", "diverted":
+		return &TrackingStatus{ID: flight, Status: f.FlightStatus, Summary: summary, Final: true}, nil
+	}
+	return &TrackingStatus{ID: flight, Status: f.FlightStatus, Summary: summary}, nil
+}
+
+// AfterShipTracker tracks parcels through the AfterShip tracking API.
+type AfterShipTracker struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewAfterShipTracker(apiKey string) *AfterShipTracker {
+	return &AfterShipTracker{
+		apiKey:  apiKey,
+		baseURL: "https://api.aftership.com/v4",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *AfterShipTracker) TrackParcel(ctx context.Context, number, carrier string) (*TrackingStatus, error) {
+	headers := map[string]string{"aftership-api-key": p.apiKey}
+
+	// AfterShip only tracks registered numbers. Registering an existing number
+	// fails with a conflict, which is fine.
+	tracking := map[string]interface{}{"tracking_number": number}
+	if carrier != "" {
+		tracking["slug"] = carrier
+	}
+	_ = doJSONRequest(ctx, p.client, http.MethodPost, p.baseURL+"/trackings", headers,
+		map[string]interface{}{"tracking": tracking}, nil)
+
+	params := url.Values{}
+	params.Set("tracking_numbers", number)
+	if carrier != "" {
+		params.Set("slug", carrier)
+	}
+	var resp struct {
+		Data struct {
+			Trackings []struct {
+				Slug             string `json:"slug"`
+				Tag              string `json:"tag"`
+				SubtagMessage    string `json:"subtag_message"`
+				ExpectedDelivery string `json:"expected_delivery"`
+				Checkpoints      []struct {
+					CheckpointTime string `json:"checkpoint_time"`
+					Message        string `json:"message"`
+					Location       string `json:"location"`
+				} `json:"checkpoints"`
+			} `json:"trackings"`
+		} `json:"data"`
+	}
+	if err := doJSONRequest(ctx, p.client, http.MethodGet, p.baseURL+"/trackings?"+params.Encode(), headers, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data.Trackings) == 0 {
+		return nil, fmt.Errorf("tracking number %s not found", number)
+	}
+
+	tr := resp.Data.Trackings[0]
+	summary := fmt.Sprintf("%s (%s): %s", number, tr.Slug, tr.Tag)
+	if tr.SubtagMessage != "" && tr.SubtagMessage != tr.Tag {
+		summary += " — " + tr.SubtagMessage
+	}
+	if n := len(tr.Checkpoints); n > 0 {
+		last := tr.Checkpoints[n-1]
+		summary += fmt.Sprintf("\nLatest: %s %s %s", last.CheckpointTime, last.Location, last.Message)
+	}
+	if tr.ExpectedDelivery != "" {
+		summary += "\nExpected delivery: " + tr.ExpectedDelivery
+	}
+	return &TrackingStatus{
+		ID:      number,
+		Status:  tr.Tag,
+		Summary: summary,
+		Final:   tr.Tag == "Delivered" || tr.Tag == "Expired" || tr.Tag == "Exception",
+	}, nil
+}
+
+// SeventeenTrackTracker tracks parcels through the 17TRACK v2.2 API.
+type SeventeenTrackTracker struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewSeventeenTrackTracker(apiKey string) *SeventeenTrackTracker {
+	return &SeventeenTrackTracker{
+		apiKey:  apiKey,
+		baseURL: "https://api.17track.net/track/v2.2",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *SeventeenTrackTracker) TrackParcel(ctx context.Context, number, carrier string) (*TrackingStatus, error) {
+	headers := map[string]string{"17token": p.apiKey}
+	item := map[string]interface{}{"number": number}
+	if carrier != "" {
+		item["carrier"] = carrier
+	}
+	payload := []map[string]interface{}{item}
+
+	// Registration is idempotent on 17TRACK's side; already-registered numbers
+	// come back in the rejected list.
+	_ = doJSONRequest(ctx, p.client, http.MethodPost, p.baseURL+"/register", headers, payload, nil)
+
+	var resp struct {
+		Data struct {
+			Accepted []struct {
+				Number    string `json:"number"`
+				TrackInfo struct {
+					LatestStatus struct {
+						Status    string `json:"status"`
+						SubStatus string `json:"sub_status"`
+					} `json:"latest_status"`
+					LatestEvent struct {
+						TimeISO     string `json:"time_iso"`
+						Description string `json:"description"`
+						Location    string `json:"location"`
+					} `json:"latest_event"`
+				} `json:"track_info"`
+			} `json:"accepted"`
+		} `json:"data"`
+	}
+	if err := doJSONRequest(ctx, p.client, http.MethodPost, p.baseURL+"/gettrackinfo", headers, payload, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data.Accepted) == 0 {
+		return nil, fmt.Errorf("tracking number %s not found", number)
+	}
+
+	info := resp.Data.Accepted[0].TrackInfo
+	status := info.LatestStatus.Status
+	summary := fmt.Sprintf("%s: %s", number, status)
+	if ev := info.LatestEvent; ev.Description != "" {
+		summary += fmt.Sprintf("\nLatest: %s %s %s", ev.TimeISO, ev.Location, ev.Description)
+	}
+	return &TrackingStatus{
+		ID:      number,
+		Status:  status,
+		Summary: summary,
+		Final:   status == "Delivered" || status == "Expired" || status == "Exception",
+	}, nil
+}
+
+// TrackingTool looks up flight and parcel status and can watch them, sending
+// a proactive message whenever the status changes.
+type TrackingTool struct {
+	flights       FlightTracker
+	parcels       ParcelTracker
+	checkInterval time.Duration
+	scheduler     *cron.CronService
+	channel       string
+	chatID        string
+}
+
+func NewTrackingTool(flights FlightTracker, parcels ParcelTracker, checkInterval time.Duration) *TrackingTool {
+	if checkInterval <= 0 {
+		checkInterval = 30 * time.Minute
+	}
+	return &TrackingTool{
+		flights:       flights,
+		parcels:       parcels,
+		checkInterval: checkInterval,
+	}
+}
+
+func (t *TrackingTool) Name() string {
+	return "tracking"
+}
+
+func (t *TrackingTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "watch", "unwatch")
+}
+
+func (t *TrackingTool) Description() string {
+	return "Track flights (by flight number, e.g. LA3040) and parcels (by tracking number). Use watch to get a message automatically whenever the status changes, e.g. when a package is out for delivery or a flight is delayed."
+}
+
+func (t *TrackingTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"status", "watch", "unwatch", "list"},
+				"description": "status: look up once; watch: notify on every status change; unwatch: stop a watch; list: show watches",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"flight", "parcel"},
+				"description": "What is being tracked (status, watch)",
+			},
+			"number": map[string]interface{}{
+				"type":        "string",
+				"description": "Flight number (IATA, e.g. AA100) or parcel tracking number",
+			},
+			"carrier": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional parcel carrier code (e.g. usps, dhl, correios); auto-detected if omitted",
+			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional flight date (YYYY-MM-DD)",
+			},
+			"watch_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Watch ID (unwatch)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *TrackingTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// JobKinds implements ScheduledTool.
+func (t *TrackingTool) JobKinds() []string {
+	return []string{trackingWatchJobKind}
+}
+
+// SetScheduler implements ScheduledTool.
+func (t *TrackingTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *TrackingTool) lookup(ctx context.Context, kind, number, carrier, date string) (*TrackingStatus, error) {
+	switch kind {
+	case "flight":
+		if t.flights == nil {
+			return nil, fmt.Errorf("no flight tracking provider configured")
+		}
+		return t.flights.TrackFlight(ctx, number, date)
+	case "parcel":
+		if t.parcels == nil {
+			return nil, fmt.Errorf("no parcel tracking provider configured")
+		}
+		return t.parcels.TrackParcel(ctx, number, carrier)
+	default:
+		return nil, fmt.Errorf("kind must be flight or parcel")
+	}
+}
+
+func (t *TrackingTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	switch action {
+	case "list":
+		return t.listWatches()
+	case "unwatch":
+		return t.unwatch(args)
+	}
+
+	kind, _ := args["kind"].(string)
+	number, _ := args["number"].(string)
+	carrier, _ := args["carrier"].(string)
+	date, _ := args["date"].(string)
+	if number == "" {
+		return ErrorResult("number is required")
+	}
+
+	status, err := t.lookup(ctx, kind, number, carrier, date)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("tracking failed: %v", err)).WithError(err)
+	}
+
+	switch action {
+	case "status":
+		return SilentResult(status.Summary)
+	case "watch":
+		return t.watch(kind, carrier, date, status)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *TrackingTool) watch(kind, carrier, date string, status *TrackingStatus) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("watching is not available (scheduler not running)")
+	}
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	if status.Final {
+		return SilentResult(status.Summary + "\n(Final status; not watching.)")
+	}
+
+	everyMS := t.checkInterval.Milliseconds()
+	name := fmt.Sprintf("Track %s %s", kind, status.ID)
+	job, err := t.scheduler.AddJobWithPayload(name, cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+		Kind:    trackingWatchJobKind,
+		Message: name,
+		Channel: t.channel,
+		To:      t.chatID,
+		Data: map[string]string{
+			"kind":        kind,
+			"number":      status.ID,
+			"carrier":     carrier,
+			"date":        date,
+			"last_status": status.Status,
+		},
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to add watch: %v", err))
+	}
+
+	return SilentResult(fmt.Sprintf("%s\nWatching (id: %s), checked every %s", status.Summary, job.ID, t.checkInterval))
+}
+
+func (t *TrackingTool) listWatches() *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("watching is not available (scheduler not running)")
+	}
+
+	var sb strings.Builder
+	for _, job := range t.scheduler.ListJobs(false) {
+		if job.Payload.Kind != trackingWatchJobKind {
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s: %s (id: %s)\n", job.Name, job.Payload.Data["last_status"], job.ID)
+	}
+	if sb.Len() == 0 {
+		return SilentResult("No active tracking watches")
+	}
+	return SilentResult("Active tracking watches:\n" + sb.String())
+}
+
+func (t *TrackingTool) unwatch(args map[string]interface{}) *ToolResult {
+	if t.scheduler == nil {
+		return ErrorResult("watching is not available (scheduler not running)")
+	}
+	id, _ := args["watch_id"].(string)
+	if id == "" {
+		return ErrorResult("watch_id is required for unwatch")
+	}
+	if !t.scheduler.RemoveJob(id) {
+		return ErrorResult(fmt.Sprintf("watch %s not found", id))
+	}
+	return SilentResult(fmt.Sprintf("Tracking watch %s removed", id))
+}
+
+// ExecuteJob implements ScheduledTool. It polls a watched item and returns a
+// notification when its status changed. Watches end on a final status.
+func (t *TrackingTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	data := job.Payload.Data
+	status, err := t.lookup(ctx, data["kind"], data["number"], data["carrier"], data["date"])
+	if err != nil {
+		return "", err
+	}
+
+	if status.Final {
+		if t.scheduler != nil {
+			t.scheduler.RemoveJob(job.ID)
+		}
+	} else if status.Status == data["last_status"] {
+		return "", nil
+	} else if t.scheduler != nil {
+		updated := *job
+		updated.Payload.Data = make(map[string]string, len(data))
+		for k, v := range data {
+			updated.Payload.Data[k] = v
+		}
+		updated.Payload.Data["last_status"] = status.Status
+		if err := t.scheduler.UpdateJob(&updated); err != nil {
+			return "", err
+		}
+	}
+
+	icon := "📦"
+	if data["kind"] == "flight" {
+		icon = "✈️"
+	}
+	return fmt.Sprintf("%s Update: %s", icon, status.Summary), nil
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+type stubParcelTracker struct {
+	status string
+}
+
+func (p *stubParcelTracker) TrackParcel(ctx context.Context, number, carrier string) (*TrackingStatus, error) {
+	return &TrackingStatus{
+		ID:      number,
+		Status:  p.status,
+		Summary: number + ": " + p.status,
+		Final:   p.status == "Delivered",
+	}, nil
+}
+
+// TestAviationStackTracker_TrackFlight verifies flight responses are normalized
+func TestAviationStackTracker_TrackFlight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("flight_iata") != "LA3040" {
+			t.Errorf("Expected normalized flight number, got %q", r.URL.Query().Get("flight_iata"))
+		}
+		w.Write([]byte(`{"data":[{"flight_status":"landed","airline":{"name":"LATAM"},
+			"departure":{"iata":"GRU","scheduled":"2026-03-01T10:00:00+00:00","gate":"12"},
+			"arrival":{"iata":"SDU","actual":"2026-03-01T11:05:00+00:00","delay":5}}]}`))
+	}))
+	defer server.Close()
+
+	tracker := NewAviationStackTracker("key")
+	tracker.baseURL = server.URL
+
+	status, err := tracker.TrackFlight(context.Background(), "la 3040", "")
+	if err != nil {
+		t.Fatalf("TrackFlight failed: %v", err)
+	}
+	if !status.Final || status.Status != "landed" {
+		t.Errorf("Expected final landed status, got %+v", status)
+	}
+	if !strings.Contains(status.Summary, "gate 12") || !strings.Contains(status.Summary, "+5min") {
+		t.Errorf("Expected gate and delay in summary, got %q", status.Summary)
+	}
+}
+
+// TestTrackingTool_WatchNotifiesOnChange verifies watches notify only on status changes
+func TestTrackingTool_WatchNotifiesOnChange(t *testing.T) {
+	parcels := &stubParcelTracker{status: "InTransit"}
+	tool := NewTrackingTool(nil, parcels, time.Minute)
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool.SetScheduler(cs)
+	tool.SetContext("whatsapp", "5511")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "watch",
+		"kind":   "parcel",
+		"number": "1Z999",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	jobs := cs.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != trackingWatchJobKind {
+		t.Fatalf("Expected one tracking job, got %+v", jobs)
+	}
+
+	// Unchanged status: no message
+	msg, err := tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil || msg != "" {
+		t.Fatalf("Expected no update, got %q (err=%v)", msg, err)
+	}
+
+	parcels.status = "OutForDelivery"
+	msg, err = tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil || !strings.Contains(msg, "OutForDelivery") {
+		t.Fatalf("Expected update message, got %q (err=%v)", msg, err)
+	}
+	jobs = cs.ListJobs(false)
+	if jobs[0].Payload.Data["last_status"] != "OutForDelivery" {
+		t.Errorf("Expected last_status to be persisted, got %q", jobs[0].Payload.Data["last_status"])
+	}
+
+	parcels.status = "Delivered"
+	msg, _ = tool.ExecuteJob(context.Background(), &jobs[0])
+	if !strings.Contains(msg, "Delivered") {
+		t.Errorf("Expected delivered message, got %q", msg)
+	}
+	if len(cs.ListJobs(true)) != 0 {
+		t.Error("Expected watch to be removed after delivery")
+	}
+}
@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/screening"
+	"github.com/sipeed/picoclaw/pkg/storage"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+// TransferTool copies a file from one service to another through the
+// device: the source is downloaded and uploaded at the same time, about a
+// chunk at a time, so a video larger than the board's memory can go from
+// Google Photos to Drive or from Drive to a bucket. Files whose size the
+// source does not tell (Photos originals, exported Docs) are spooled to
+// disk first, since the resumable uploads need it up front.
+type TransferTool struct {
+	drive  *GoogleDriveClient
+	photos *GooglePhotosClient
+	gmail  *GmailClient
+	stores map[string]storage.Store
+	// spoolDir holds files of unknown size while they are copied; it is
+	// under the workspace rather than /tmp, which is often in memory on
+	// small boards
+	spoolDir string
+}
+
+func NewTransferTool(spoolDir string) *TransferTool {
+	return &TransferTool{stores: map[string]storage.Store{}, spoolDir: spoolDir}
+}
+
+func (t *TransferTool) SetDrive(drive *GoogleDriveClient)    { t.drive = drive }
+func (t *TransferTool) SetPhotos(photos *GooglePhotosClient) { t.photos = photos }
+func (t *TransferTool) SetGmail(gmail *GmailClient)          { t.gmail = gmail }
+
+// AddStore makes store an endpoint, as "<name>:<path>".
+func (t *TransferTool) AddStore(name string, store storage.Store) {
+	t.stores[strings.ToLower(name)] = store
+}
+
+func (t *TransferTool) Name() string {
+	return "transfer"
+}
+
+func (t *TransferTool) Mutates(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *TransferTool) Description() string {
+	return "Copy a file from one service to another without going through the chat, e.g. a video from Google Photos to Drive, a Drive file to an S3 bucket, or an email attachment to Dropbox. " +
+		"Endpoints: " + strings.Join(t.endpoints(), "; ") + ". Large files are streamed and progress is reported while they copy."
+}
+
+// endpoints describes the endpoints that are set up.
+func (t *TransferTool) endpoints() []string {
+	var out []string
+	if t.drive != nil {
+		out = append(out, "drive:<file id> (from) or drive[:<folder id>] (to)")
+	}
+	if t.photos != nil {
+		out = append(out, "photos:<media item id> (from) or photos[:<album id>] (to, app-created albums only)")
+	}
+	if t.gmail != nil {
+		out = append(out, "gmail:<message id>/<attachment file name or number> (from)")
+	}
+	names := make([]string, 0, len(t.stores))
+	for name := range t.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, fmt.Sprintf("%s:<path> (%s; a path ending in / is a folder)", name, t.stores[name].Kind()))
+	}
+	return out
+}
+
+func (t *TransferTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "Where the file is, e.g. drive:1AbC..., photos:AKx..., gmail:18c2.../invoice.pdf or dropbox:Backups/report.pdf",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Where to copy it, e.g. drive, drive:<folder id>, photos, s3:archive/ or dropbox:Invoices/",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "File name at the destination (defaults to the source's)",
+			},
+		},
+		"required": []string{"from", "to"},
+	}
+}
+
+// transferSource is an open source file.
+type transferSource struct {
+	name     string
+	mimeType string
+	// size is -1 when not known
+	size int64
+	body io.ReadCloser
+	// where names the service in messages
+	where string
+	// screen marks email attachments, whose contents are screened
+	// before they are passed on
+	screen bool
+}
+
+// splitEndpoint splits "kind:rest" into a lower-case kind and rest.
+func splitEndpoint(endpoint string) (string, string) {
+	kind, rest, _ := strings.Cut(strings.TrimSpace(endpoint), ":")
+	return strings.ToLower(kind), strings.TrimSpace(rest)
+}
+
+func (t *TransferTool) open(ctx context.Context, endpoint string) (*transferSource, error) {
+	kind, ref := splitEndpoint(endpoint)
+	switch {
+	case kind == "drive" && t.drive != nil:
+		if ref == "" {
+			return nil, fmt.Errorf("give the Drive file id, as drive:<file id>")
+		}
+		file, body, err := t.drive.Open(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		return &transferSource{name: file.Name, mimeType: file.MimeType, size: file.Size, body: body, where: "Google Drive"}, nil
+	case kind == "photos" && t.photos != nil:
+		if ref == "" {
+			return nil, fmt.Errorf("give the media item id, as photos:<id>")
+		}
+		item, err := t.photos.Get(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		body, err := t.photos.Download(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		return &transferSource{name: item.Filename, mimeType: item.MimeType, size: -1, body: body, where: "Google Photos"}, nil
+	case kind == "gmail" && t.gmail != nil:
+		return t.openAttachment(ctx, ref)
+	}
+	store, ok := t.stores[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q; available: %s", endpoint, strings.Join(t.endpoints(), "; "))
+	}
+	name, err := storage.Clean(ref)
+	if err != nil || name == "" {
+		return nil, fmt.Errorf("give the file path, as %s:<path>", kind)
+	}
+	size := int64(-1)
+	if files, err := store.List(ctx, path.Dir(name)); err == nil {
+		for _, f := range files {
+			if f.Path == name && !f.Dir {
+				size = f.Size
+			}
+		}
+	}
+	body, err := store.Open(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("no file %q in the %s", name, store.Kind())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transferSource{name: path.Base(name), mimeType: mime.TypeByExtension(path.Ext(name)), size: size, body: body, where: "the " + store.Kind()}, nil
+}
+
+// openAttachment opens "<message id>/<file name or number>".
+func (t *TransferTool) openAttachment(ctx context.Context, ref string) (*transferSource, error) {
+	id, which, ok := strings.Cut(ref, "/")
+	if !ok || id == "" || which == "" {
+		return nil, fmt.Errorf("give the attachment as gmail:<message id>/<file name or number>")
+	}
+	msg, err := t.gmail.GetMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var att *GmailAttachment
+	if n, err := strconv.Atoi(which); err == nil && n >= 1 && n <= len(msg.Attachments) {
+		att = &msg.Attachments[n-1]
+	}
+	for i := range msg.Attachments {
+		if att == nil && strings.EqualFold(msg.Attachments[i].Filename, which) {
+			att = &msg.Attachments[i]
+		}
+	}
+	if att == nil {
+		names := make([]string, len(msg.Attachments))
+		for i, a := range msg.Attachments {
+			names[i] = fmt.Sprintf("%d. %s", i+1, a.Filename)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("message %s has no attachments", id)
+		}
+		return nil, fmt.Errorf("no attachment %q in message %s; it has: %s", which, id, strings.Join(names, ", "))
+	}
+	body, err := t.gmail.OpenAttachment(ctx, id, *att)
+	if err != nil {
+		return nil, err
+	}
+	return &transferSource{name: att.Filename, mimeType: att.MimeType, size: int64(att.Size), body: body, where: "Gmail", screen: true}, nil
+}
+
+// put writes src to endpoint under name and says where it went.
+func (t *TransferTool) put(ctx context.Context, endpoint, name string, src *transferSource, r io.Reader) (string, error) {
+	kind, ref := splitEndpoint(endpoint)
+	switch {
+	case kind == "drive" && t.drive != nil:
+		file, err := t.drive.UploadStream(ctx, ref, name, src.mimeType, r, src.size)
+		if err != nil {
+			return "", err
+		}
+		where := "Google Drive"
+		if file.WebViewLink != "" {
+			where += " (" + file.WebViewLink + ")"
+		}
+		return where, nil
+	case kind == "photos" && t.photos != nil:
+		if _, err := t.photos.UploadSized(ctx, name, src.mimeType, r, src.size, ref); err != nil {
+			return "", err
+		}
+		return "Google Photos", nil
+	case kind == "gmail" && t.gmail != nil:
+		return "", fmt.Errorf("gmail can only be a source; to send a file by email use the email tools")
+	}
+	store, ok := t.stores[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown destination %q; available: %s", endpoint, strings.Join(t.endpoints(), "; "))
+	}
+	dest := ref
+	if dest == "" || strings.HasSuffix(dest, "/") {
+		dest = path.Join(dest, name)
+	}
+	dest, err := storage.Clean(dest)
+	if err != nil {
+		return "", err
+	}
+	if err := checkOutgoingFile(ctx, store.Kind(), name, src.size, nil); err != nil {
+		return "", err
+	}
+	if err := store.Put(ctx, dest, r, src.size); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s in the %s", dest, store.Kind()), nil
+}
+
+// spool copies a source of unknown size to a temporary file, which then
+// serves as the source with its size known.
+func (t *TransferTool) spool(ctx context.Context, src *transferSource) (func(), error) {
+	if err := os.MkdirAll(t.spoolDir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(t.spoolDir, "transfer-*")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	n, err := io.Copy(f, transfer.ProgressReader(ctx, src.body, transfer.Progress{Name: src.name, Total: -1}))
+	src.body.Close()
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to download %s: %w", src.name, err)
+	}
+	src.body, src.size = f, n
+	return cleanup, nil
+}
+
+// scan screens a spooled source and rewinds it.
+func (t *TransferTool) scan(ctx context.Context, src *transferSource) error {
+	if err := screening.Scan(ctx, src.name, src.body); err != nil {
+		return err
+	}
+	_, err := src.body.(io.Seeker).Seek(0, io.SeekStart)
+	return err
+}
+
+func (t *TransferTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	from, _ := args["from"].(string)
+	to, _ := args["to"].(string)
+	if from == "" || to == "" {
+		return ErrorResult("from and to are required")
+	}
+	if kind, _ := splitEndpoint(to); kind == "gmail" {
+		return ErrorResult("gmail can only be a source; to send a file by email use the email tools")
+	}
+
+	// The copy reports its own progress; the download and upload inside
+	// it stay quiet
+	quiet := transfer.WithProgress(ctx, nil)
+	src, err := t.open(quiet, from)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("cannot read %s: %v", from, err)).WithError(err)
+	}
+	defer func() { src.body.Close() }()
+	// A file to scan is all on disk before any of it goes on
+	scan := src.screen && screening.Current().Scans()
+	if src.size < 0 || scan {
+		cleanup, err := t.spool(ctx, src)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		defer cleanup()
+	}
+	if scan {
+		if err := t.scan(ctx, src); err != nil {
+			return ErrorResult(fmt.Sprintf("cannot copy %s: %v", src.name, err)).WithError(err)
+		}
+	}
+
+	name, _ := args["name"].(string)
+	if name == "" {
+		name = src.name
+	}
+	r := transfer.ProgressReader(ctx, src.body, transfer.Progress{Name: name, Upload: true, Total: src.size})
+	where, err := t.put(quiet, to, name, src, r)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("copying %s to %s failed: %v", name, to, err)).WithError(err)
+	}
+	return NewToolResult(fmt.Sprintf("Copied %s (%s) from %s to %s.", name, formatFileSize(src.size), src.where, where))
+}
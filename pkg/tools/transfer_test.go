@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+	"github.com/sipeed/picoclaw/pkg/transfer"
+)
+
+// TestTransferTool_AttachmentToDriveStreams verifies a large attachment is decoded and uploaded in resumable chunks, surviving a failed chunk
+func TestTransferTool_AttachmentToDriveStreams(t *testing.T) {
+	transfer.SetOptions(transfer.Options{ChunkSize: 1 << 20, RetryDelay: time.Millisecond})
+	t.Cleanup(func() { transfer.SetOptions(transfer.Options{}) })
+	g := testkit.NewGoogle(t)
+	g.Install()
+	data := bytes.Repeat([]byte("video-frame "), 600000)
+	id := g.AddEmail(testkit.Email{Subject: "Clip", Attachments: []testkit.Attachment{{Filename: "clip.mp4", MimeType: "video/mp4", Data: data}}})
+	g.FailNext("upload_id=", 1, 503)
+
+	tool := NewTransferTool(t.TempDir())
+	tool.SetGmail(NewGmailClient(testkit.Token))
+	tool.SetDrive(NewGoogleDriveClient(testkit.Token))
+	var last transfer.Progress
+	ctx := transfer.WithProgress(context.Background(), func(p transfer.Progress) { last = p })
+
+	result := tool.Execute(ctx, map[string]interface{}{"from": "gmail:" + id + "/clip.mp4", "to": "drive"})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	var uploaded *testkit.File
+	for _, f := range g.Files() {
+		if f.Name == "clip.mp4" {
+			uploaded = &f
+		}
+	}
+	if uploaded == nil || !bytes.Equal(uploaded.Content, data) {
+		t.Fatalf("clip.mp4 not uploaded intact: %v", uploaded != nil)
+	}
+	if last.Name != "clip.mp4" || !last.Upload || last.Done != int64(len(data)) || last.Total != int64(len(data)) {
+		t.Errorf("last progress = %+v", last)
+	}
+}
+
+// TestTransferTool_DriveToStore verifies a Drive file lands in a storage folder under its own name
+func TestTransferTool_DriveToStore(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	fileID := g.AddFile(testkit.File{Name: "report.pdf", MimeType: "application/pdf", Content: []byte("%PDF-1.7 report")})
+
+	dir := t.TempDir()
+	tool := NewTransferTool(filepath.Join(dir, "spool"))
+	tool.SetDrive(NewGoogleDriveClient(testkit.Token))
+	store := storage.NewLocal(filepath.Join(dir, "dropbox"))
+	tool.AddStore("Dropbox", store)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"from": "drive:" + fileID, "to": "dropbox:Backups/"})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	r, err := store.Open(context.Background(), "Backups/report.pdf")
+	if err != nil {
+		t.Fatalf("copy not found: %v", err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if string(got) != "%PDF-1.7 report" {
+		t.Errorf("copied %q", got)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"from": "dropbox:Backups/report.pdf", "to": "gmail:x"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "only be a source") {
+		t.Errorf("Expected gmail to be refused as a destination, got: %s", result.ForLLM)
+	}
+}
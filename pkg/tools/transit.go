@@ -0,0 +1,639 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/locale"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/when"
+)
+
+const (
+	transitJobKind = "transit_leave"
+	// transitAlertWindow is how far ahead the alerts look at the calendar
+	transitAlertWindow = 3 * time.Hour
+)
+
+// TransitTrip is a trip by public transport, as its walks and rides.
+type TransitTrip struct {
+	Leave  time.Time
+	Arrive time.Time
+	Steps  []TransitStep
+}
+
+// TransitStep is a ride on one line, or a walk when Line is empty.
+type TransitStep struct {
+	Line     string
+	Vehicle  string
+	Headsign string
+	From     string
+	To       string
+	Depart   time.Time
+	Arrive   time.Time
+	Duration time.Duration
+}
+
+// TransitRouter is implemented by public transport route backends.
+type TransitRouter interface {
+	// TransitRoute plans the trip from one address to another leaving at
+	// depart or, when arrive is set, arriving by arrive
+	TransitRoute(ctx context.Context, from, to string, depart, arrive time.Time) (*TransitTrip, error)
+}
+
+// GoogleRoutesTransit plans trips with the transit mode of the Google
+// Routes API.
+type GoogleRoutesTransit struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewGoogleRoutesTransit(apiKey string) *GoogleRoutesTransit {
+	return &GoogleRoutesTransit{
+		apiKey:  apiKey,
+		baseURL: "https://routes.googleapis.com",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// routesStopDetails is the stopDetails of a transit step.
+type routesStopDetails struct {
+	DepartureStop struct {
+		Name string `json:"name"`
+	} `json:"departureStop"`
+	ArrivalStop struct {
+		Name string `json:"name"`
+	} `json:"arrivalStop"`
+	DepartureTime string `json:"departureTime"`
+	ArrivalTime   string `json:"arrivalTime"`
+}
+
+func (g *GoogleRoutesTransit) TransitRoute(ctx context.Context, from, to string, depart, arrive time.Time) (*TransitTrip, error) {
+	payload := map[string]interface{}{
+		"origin":      map[string]string{"address": from},
+		"destination": map[string]string{"address": to},
+		"travelMode":  "TRANSIT",
+	}
+	if !arrive.IsZero() {
+		payload["arrivalTime"] = arrive.UTC().Format(time.RFC3339)
+	} else if !depart.IsZero() {
+		payload["departureTime"] = depart.UTC().Format(time.RFC3339)
+	}
+	headers := map[string]string{
+		"X-Goog-Api-Key":   g.apiKey,
+		"X-Goog-FieldMask": "routes.duration,routes.legs.steps.travelMode,routes.legs.steps.staticDuration,routes.legs.steps.transitDetails",
+	}
+	var resp struct {
+		Routes []struct {
+			Duration string `json:"duration"`
+			Legs     []struct {
+				Steps []struct {
+					TravelMode     string `json:"travelMode"`
+					StaticDuration string `json:"staticDuration"`
+					TransitDetails *struct {
+						StopDetails routesStopDetails `json:"stopDetails"`
+						Headsign    string            `json:"headsign"`
+						TransitLine struct {
+							Name      string `json:"name"`
+							NameShort string `json:"nameShort"`
+							Vehicle   struct {
+								Type string `json:"type"`
+							} `json:"vehicle"`
+						} `json:"transitLine"`
+					} `json:"transitDetails"`
+				} `json:"steps"`
+			} `json:"legs"`
+		} `json:"routes"`
+	}
+	if err := doJSONRequest(ctx, g.client, http.MethodPost, g.baseURL+"/directions/v2:computeRoutes", headers, payload, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Routes) == 0 {
+		return nil, fmt.Errorf("routes: no public transport route from %q to %q", from, to)
+	}
+	route := resp.Routes[0]
+	trip := &TransitTrip{}
+	for _, leg := range route.Legs {
+		for _, s := range leg.Steps {
+			d, _ := time.ParseDuration(s.StaticDuration)
+			if s.TransitDetails == nil {
+				// Consecutive walking steps are one walk
+				if n := len(trip.Steps); n > 0 && trip.Steps[n-1].Line == "" {
+					trip.Steps[n-1].Duration += d
+				} else {
+					trip.Steps = append(trip.Steps, TransitStep{Duration: d})
+				}
+				continue
+			}
+			td := s.TransitDetails
+			step := TransitStep{
+				Line:     td.TransitLine.NameShort,
+				Vehicle:  strings.ToLower(strings.ReplaceAll(td.TransitLine.Vehicle.Type, "_", " ")),
+				Headsign: td.Headsign,
+				From:     td.StopDetails.DepartureStop.Name,
+				To:       td.StopDetails.ArrivalStop.Name,
+				Duration: d,
+			}
+			if step.Line == "" {
+				step.Line = td.TransitLine.Name
+			}
+			step.Depart, _ = time.Parse(time.RFC3339, td.StopDetails.DepartureTime)
+			step.Arrive, _ = time.Parse(time.RFC3339, td.StopDetails.ArrivalTime)
+			trip.Steps = append(trip.Steps, step)
+		}
+	}
+	total, _ := time.ParseDuration(route.Duration)
+	trip.Leave, trip.Arrive = transitTimes(trip.Steps, total, depart, arrive)
+	return trip, nil
+}
+
+// transitTimes works out when a trip leaves and arrives: from the
+// timetable of its first and last rides and the walks around them, or,
+// for a trip on foot, from its total length and the time asked for.
+func transitTimes(steps []TransitStep, total time.Duration, depart, arrive time.Time) (time.Time, time.Time) {
+	first, last := -1, -1
+	for i, s := range steps {
+		if s.Line != "" && !s.Depart.IsZero() {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		switch {
+		case !arrive.IsZero():
+			return arrive.Add(-total), arrive
+		case depart.IsZero():
+			depart = time.Now()
+		}
+		return depart, depart.Add(total)
+	}
+	leave, end := steps[first].Depart, steps[last].Arrive
+	for _, s := range steps[:first] {
+		leave = leave.Add(-s.Duration)
+	}
+	for _, s := range steps[last+1:] {
+		end = end.Add(s.Duration)
+	}
+	return leave, end
+}
+
+// TransitOptions configures the transit tool.
+type TransitOptions struct {
+	// Home is where trips and the first trip of the day start when the
+	// user does not say; Work is where trips go
+	Home string
+	Work string
+	// Lead is how long before it is time to leave an alert comes
+	Lead time.Duration
+	// Every is how often scheduled alerts check the calendar
+	Every time.Duration
+}
+
+// transitState keeps, per chat, the alerts schedule and the events
+// already alerted about, by event ID and start.
+type transitState struct {
+	Chats map[string]*transitChat `json:"chats"`
+}
+
+type transitChat struct {
+	JobID   string               `json:"job_id"`
+	Alerted map[string]time.Time `json:"alerted,omitempty"`
+}
+
+// TransitTool answers public transport questions: the next departures
+// from a stop, read from a GTFS timetable, and trips with their rides and
+// times, planned by a TransitRouter. Scheduled in a chat, it also watches
+// the calendar and says when to leave for the next event with a place,
+// from home or from the meeting before it.
+type TransitTool struct {
+	feed      *GTFSFeed
+	router    TransitRouter
+	calendar  *GoogleCalendarClient
+	profiles  *profile.Store
+	opts      TransitOptions
+	statePath string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// NewTransitTool creates the tool. feed, router and calendar may be nil:
+// departures need the feed, trips the router, and alerts the router and
+// the calendar.
+func NewTransitTool(feed *GTFSFeed, router TransitRouter, calendar *GoogleCalendarClient, workspace string, opts TransitOptions, profiles *profile.Store) *TransitTool {
+	if opts.Lead <= 0 {
+		opts.Lead = 10 * time.Minute
+	}
+	if opts.Every <= 0 {
+		opts.Every = 5 * time.Minute
+	}
+	return &TransitTool{
+		feed:      feed,
+		router:    router,
+		calendar:  calendar,
+		profiles:  profiles,
+		opts:      opts,
+		statePath: filepath.Join(workspace, "state", "transit.json"),
+		now:       time.Now,
+	}
+}
+
+func (t *TransitTool) Name() string {
+	return "transit"
+}
+
+func (t *TransitTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "schedule_alerts", "unschedule_alerts")
+}
+
+func (t *TransitTool) Description() string {
+	return "Public transport. action=departures lists the next departures from a stop (stop: its name or ID; line to keep one line only), from the local timetable. action=trip plans a trip by public transport (from, default home; to, default work) leaving now, at depart_at or arriving by arrive_by, with each walk and ride and when to leave: use it for \"when do I need to leave to get to work by 9?\" or \"how long is my commute now?\". action=schedule_alerts watches the user's calendar in this chat and sends a \"leave now\" alert, with the ride to take, before each event with a place; unschedule_alerts stops them."
+}
+
+func (t *TransitTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"departures", "trip", "schedule_alerts", "unschedule_alerts"},
+				"description": "Action to perform",
+			},
+			"stop": map[string]interface{}{
+				"type":        "string",
+				"description": "departures: the stop or station, by name or stop ID",
+			},
+			"line": map[string]interface{}{
+				"type":        "string",
+				"description": "departures: only this line, e.g. \"42\" or \"U2\"",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": "departures: how many to list (default 5, max 20)",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "trip: the address to start from (default: home)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "trip: the address to go to (default: work)",
+			},
+			"depart_at": map[string]interface{}{
+				"type":        "string",
+				"description": "trip: when to leave, as the user said it (\"at 8\", \"tomorrow 7:30\"); default now",
+			},
+			"arrive_by": map[string]interface{}{
+				"type":        "string",
+				"description": "trip: when to arrive by, same forms as depart_at",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *TransitTool) JobKinds() []string {
+	return []string{transitJobKind}
+}
+
+func (t *TransitTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *TransitTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chatKey := channel + ":" + chatID
+	action, _ := args["action"].(string)
+	switch action {
+	case "departures":
+		return t.departures(args, chatKey)
+	case "trip":
+		return t.trip(ctx, args, chatKey)
+	case "schedule_alerts", "unschedule_alerts":
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		if action == "unschedule_alerts" {
+			return t.unschedule(chatKey)
+		}
+		return t.schedule(channel, chatID)
+	}
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *TransitTool) departures(args map[string]interface{}, chatKey string) *ToolResult {
+	if t.feed == nil {
+		return ErrorResult("next departures need a GTFS timetable (tools.transit.gtfs)")
+	}
+	stop, _ := args["stop"].(string)
+	if strings.TrimSpace(stop) == "" {
+		return ErrorResult("stop is required")
+	}
+	line, _ := args["line"].(string)
+	count := 5
+	if n, ok := args["count"].(float64); ok && n >= 1 {
+		count = min(int(n), 20)
+	}
+	deps, err := t.feed.Departures(stop, line, t.now(), count)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if len(deps) == 0 {
+		return SilentResult(fmt.Sprintf("No departures from %s in the next 24 hours.", stop))
+	}
+	prof := t.profiles.Get(chatKey)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Next departures from %s:", deps[0].Stop)
+	for _, d := range deps {
+		fmt.Fprintf(&sb, "\n- %s %s", locale.Time(d.Time.In(prof.Location()), prof.FormatLocale()), d.Line)
+		if d.Headsign != "" {
+			fmt.Fprintf(&sb, " towards %s", d.Headsign)
+		}
+		if d.Stop != deps[0].Stop {
+			fmt.Fprintf(&sb, " (from %s)", d.Stop)
+		}
+		fmt.Fprintf(&sb, ", in %s", formatETA(d.Time.Sub(t.now()).Round(time.Minute)))
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *TransitTool) trip(ctx context.Context, args map[string]interface{}, chatKey string) *ToolResult {
+	if t.router == nil {
+		return ErrorResult("trips need a Google Routes API key (tools.transit.routes_api_key)")
+	}
+	from, _ := args["from"].(string)
+	to, _ := args["to"].(string)
+	if from = strings.TrimSpace(from); from == "" {
+		from = t.opts.Home
+	}
+	if to = strings.TrimSpace(to); to == "" {
+		to = t.opts.Work
+	}
+	if from == "" || to == "" {
+		return ErrorResult("from and to are required (no home or work address is configured)")
+	}
+	prof := t.profiles.Get(chatKey)
+	now := t.now().In(prof.Location())
+	var depart, arrive time.Time
+	for key, target := range map[string]*time.Time{"depart_at": &depart, "arrive_by": &arrive} {
+		s, _ := args[key].(string)
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		r, err := when.Parse(s, now, prof.Locale)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid %s: %v", key, err))
+		}
+		*target = r.Time
+	}
+	if depart.IsZero() && arrive.IsZero() {
+		depart = now
+	}
+	trip, err := t.router.TransitRoute(ctx, from, to, depart, arrive)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to plan the trip: %v", err)).WithError(err)
+	}
+	return SilentResult(describeTransitTrip(trip, prof))
+}
+
+// describeTransitTrip lists a trip's times, then each walk and ride.
+func describeTransitTrip(trip *TransitTrip, prof profile.Profile) string {
+	at := func(t time.Time) string { return locale.Time(t.In(prof.Location()), prof.FormatLocale()) }
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Leave at %s, arrive at %s (%s).", at(trip.Leave), at(trip.Arrive), formatETA(trip.Arrive.Sub(trip.Leave).Round(time.Minute)))
+	for _, s := range trip.Steps {
+		if s.Line == "" {
+			fmt.Fprintf(&sb, "\n- walk %s", formatETA(s.Duration.Round(time.Minute)))
+			continue
+		}
+		fmt.Fprintf(&sb, "\n- %s", transitRide(s, prof))
+		if !s.Arrive.IsZero() {
+			fmt.Fprintf(&sb, " to %s, arriving %s", s.To, at(s.Arrive))
+		}
+	}
+	return sb.String()
+}
+
+// transitRide says which ride to take, e.g. "bus 42 towards Downtown from
+// Main St at 8:18".
+func transitRide(s TransitStep, prof profile.Profile) string {
+	ride := strings.TrimSpace(s.Vehicle + " " + s.Line)
+	if s.Headsign != "" {
+		ride += " towards " + s.Headsign
+	}
+	if s.From != "" {
+		ride += " from " + s.From
+	}
+	if !s.Depart.IsZero() {
+		ride += " at " + locale.Time(s.Depart.In(prof.Location()), prof.FormatLocale())
+	}
+	return ride
+}
+
+func (t *TransitTool) schedule(channel, chatID string) *ToolResult {
+	switch {
+	case t.scheduler == nil:
+		return ErrorResult("alerts are not available (scheduler not running)")
+	case t.router == nil || t.calendar == nil:
+		return ErrorResult("leave-now alerts need a Google Routes API key (tools.transit.routes_api_key) and the calendar tools (tools.events)")
+	case t.opts.Home == "":
+		return ErrorResult("leave-now alerts need a home address (tools.transit.home) for trips to the first event of the day")
+	}
+	chatKey := channel + ":" + chatID
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	describe := fmt.Sprintf("Leave-now alerts are on in this chat: the calendar is checked every %s, and you are told %s before it is time to leave for an event with a place.",
+		formatETA(t.opts.Every), formatETA(t.opts.Lead))
+	if state.Chats[chatKey] != nil {
+		return SilentResult(describe)
+	}
+	everyMS := t.opts.Every.Milliseconds()
+	job, err := t.scheduler.AddJobWithPayload("Leave-now alerts", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+		Kind:    transitJobKind,
+		Message: "Leave-now alerts",
+		Channel: channel,
+		To:      chatID,
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("could not schedule the alerts: %v", err)).WithError(err)
+	}
+	state.Chats[chatKey] = &transitChat{JobID: job.ID, Alerted: map[string]time.Time{}}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		t.scheduler.RemoveJob(job.ID)
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return SilentResult(describe)
+}
+
+func (t *TransitTool) unschedule(chatKey string) *ToolResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	c := state.Chats[chatKey]
+	if c == nil {
+		return SilentResult("Leave-now alerts are not on in this chat.")
+	}
+	if t.scheduler != nil {
+		t.scheduler.RemoveJob(c.JobID)
+	}
+	delete(state.Chats, chatKey)
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	return SilentResult("Leave-now alerts are off in this chat.")
+}
+
+// ExecuteJob implements ScheduledTool. It plans the trip to each event
+// with a place starting in the next few hours and alerts the chat about
+// those it is nearly time to leave for, once per event.
+func (t *TransitTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	chatKey := job.Payload.Channel + ":" + job.Payload.To
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	c := state.Chats[chatKey]
+	if c == nil || t.router == nil || t.calendar == nil {
+		return "", nil
+	}
+	prof := t.profiles.Get(chatKey)
+	now := t.now()
+	local := now.In(prof.Location())
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	events, err := t.calendar.ListEvents(ctx, "primary", dayStart, now.Add(transitAlertWindow))
+	if err != nil {
+		return "", err
+	}
+
+	var alerts []string
+	for _, ev := range events {
+		key := ev.ID + "@" + ev.Start.UTC().Format(time.RFC3339)
+		if _, done := c.Alerted[key]; done || !ev.Start.After(now) || !physical(ev.Location) || !attended(ev) {
+			continue
+		}
+		from := t.opts.Home
+		if prev := previous(ev, events); prev != nil && physical(prev.Location) {
+			from = prev.Location
+		}
+		if strings.EqualFold(strings.TrimSpace(from), strings.TrimSpace(ev.Location)) {
+			continue
+		}
+		trip, err := t.router.TransitRoute(ctx, from, ev.Location, time.Time{}, ev.Start)
+		if err != nil {
+			logger.WarnCF("transit", "Could not plan the trip to an event", map[string]interface{}{"event": ev.Summary, "error": err.Error()})
+			continue
+		}
+		if trip.Leave.Sub(now) > t.opts.Lead {
+			continue
+		}
+		c.Alerted[key] = ev.Start
+		alerts = append(alerts, t.leaveAlert(ev, trip, now, prof))
+	}
+	for key, start := range c.Alerted {
+		if now.Sub(start) > 24*time.Hour {
+			delete(c.Alerted, key)
+		}
+	}
+	if len(alerts) == 0 {
+		return "", nil
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	return strings.Join(alerts, "\n\n"), nil
+}
+
+// leaveAlert tells the user to leave for ev, and how.
+func (t *TransitTool) leaveAlert(ev CalendarEvent, trip *TransitTrip, now time.Time, prof profile.Profile) string {
+	at := func(t time.Time) string { return locale.Time(t.In(prof.Location()), prof.FormatLocale()) }
+	var sb strings.Builder
+	if late := now.Sub(trip.Leave).Round(time.Minute); late > 0 {
+		fmt.Fprintf(&sb, "🏃 Leave now for %s at %s (%s), you should have left %s ago", ev.Summary, at(ev.Start), ev.Location, formatETA(late))
+	} else {
+		fmt.Fprintf(&sb, "🚶 Time to go at %s for %s at %s (%s)", at(trip.Leave), ev.Summary, at(ev.Start), ev.Location)
+	}
+	for _, s := range trip.Steps {
+		if s.Line != "" {
+			fmt.Fprintf(&sb, ": take the %s", transitRide(s, prof))
+			break
+		}
+	}
+	fmt.Fprintf(&sb, ", arriving %s.", at(trip.Arrive))
+	return sb.String()
+}
+
+// loadState reads the state; callers hold t.mu.
+func (t *TransitTool) loadState() (*transitState, error) {
+	state := &transitState{}
+	data, err := os.ReadFile(t.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read transit alerts: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse transit alerts: %w", err)
+		}
+	}
+	if state.Chats == nil {
+		state.Chats = make(map[string]*transitChat)
+	}
+	for _, c := range state.Chats {
+		if c.Alerted == nil {
+			c.Alerted = make(map[string]time.Time)
+		}
+	}
+	return state, nil
+}
+
+// ChatData implements ChatDataStore: the chat's alerts schedule and the
+// events alerted about.
+func (t *TransitTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if chat := state.Chats[chatKey]; chat != nil {
+		return chat, nil
+	}
+	return nil, nil
+}
+
+// PurgeChat implements ChatDataStore. The alerts schedule goes with the
+// chat's jobs.
+func (t *TransitTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return 0, err
+	}
+	chat := state.Chats[chatKey]
+	if chat == nil {
+		return 0, nil
+	}
+	delete(state.Chats, chatKey)
+	return 1 + len(chat.Alerted), saveJSONAtomic(t.statePath, state)
+}
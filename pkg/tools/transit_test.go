@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestGTFSFeed_Departures verifies departures are read from the timetable by stop name with its platforms, include trips of the day before running past midnight, follow the service calendar and filter by line
+func TestGTFSFeed_Departures(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"agency.txt": "agency_id,agency_name,agency_url,agency_timezone\nA,Metro,https://metro.example,UTC\n",
+		"stops.txt":  "\ufeffstop_id,stop_name,parent_station\nST,Main St,\nP1,Main St,ST\nOAK,Oak Ave,\n",
+		"routes.txt": "route_id,route_short_name,route_long_name\nR42,42,\nR7,,Night Line\n",
+		"trips.txt":  "route_id,service_id,trip_id,trip_headsign\nR42,WK,late,Downtown\nR42,WE,morning,Downtown\nR7,WE,night,Harbor\nR42,WE,oak,Uptown\n",
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"WK,1,1,1,1,1,0,0,20260101,20261231\nWE,0,0,0,0,0,1,1,20260101,20261231\n",
+		"calendar_dates.txt": "service_id,date,exception_type\nWE,20261018,2\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"late,24:10:00,24:10:00,P1,1\nmorning,08:00:00,08:00:00,P1,1\nnight,00:30:00,00:30:00,ST,1\noak,07:00:00,07:00:00,OAK,1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feed := NewGTFSFeed(dir)
+	// Saturday just past midnight
+	after := time.Date(2026, 10, 17, 0, 5, 0, 0, time.UTC)
+
+	deps, err := feed.Departures("main st", "", after, 10)
+	if err != nil {
+		t.Fatalf("Departures() error: %v", err)
+	}
+	var got []string
+	for _, d := range deps {
+		got = append(got, d.Time.UTC().Format("Mon 15:04")+" "+d.Line+" "+d.Headsign)
+	}
+	want := []string{"Sat 00:10 42 Downtown", "Sat 00:30 Night Line Harbor", "Sat 08:00 42 Downtown"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Departures() = %v, want %v", got, want)
+	}
+
+	// Sunday's weekend service is cancelled
+	deps, err = feed.Departures("ST", "42", time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC), 10)
+	if err != nil || len(deps) != 0 {
+		t.Errorf("Expected no line 42 departure until Monday, got %+v, %v", deps, err)
+	}
+	if _, err := feed.Departures("a", "", after, 10); err == nil || !strings.Contains(err.Error(), "Main St, Oak Ave") {
+		t.Errorf("Expected the matching stops listed, got %v", err)
+	}
+
+	tool := NewTransitTool(feed, nil, nil, t.TempDir(), TransitOptions{}, profile.NewStore(t.TempDir()))
+	tool.now = func() time.Time { return after }
+	r := tool.Execute(context.Background(), map[string]interface{}{"action": "departures", "stop": "Oak", "line": "42"})
+	if r.IsError || !strings.Contains(r.ForLLM, "Next departures from Oak Ave:") || !strings.Contains(r.ForLLM, "42 towards Uptown") {
+		t.Errorf("departures: %+v", r)
+	}
+}
+
+// TestGoogleRoutesTransit_TransitRoute verifies a Routes answer is read into walks and rides, consecutive walks merged and counted into when to leave and arrive
+func TestGoogleRoutesTransit_TransitRoute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/directions/v2:computeRoutes" || r.Header.Get("X-Goog-Api-Key") != "k" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"routes":[{"duration":"2400s","legs":[{"steps":[
+			{"travelMode":"WALK","staticDuration":"120s"},
+			{"travelMode":"WALK","staticDuration":"180s"},
+			{"travelMode":"TRANSIT","staticDuration":"1500s","transitDetails":{
+				"stopDetails":{"departureStop":{"name":"Main St"},"arrivalStop":{"name":"Harbor"},
+					"departureTime":"2026-10-16T08:05:00Z","arrivalTime":"2026-10-16T08:30:00Z"},
+				"headsign":"Downtown","transitLine":{"name":"Crosstown","nameShort":"42","vehicle":{"type":"BUS"}}}},
+			{"travelMode":"WALK","staticDuration":"240s"}]}]}]}`))
+	}))
+	defer server.Close()
+	routes := NewGoogleRoutesTransit("k")
+	routes.baseURL = server.URL
+
+	trip, err := routes.TransitRoute(context.Background(), "Home", "Office", time.Time{}, time.Date(2026, 10, 16, 8, 45, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("TransitRoute() error: %v", err)
+	}
+	if !trip.Leave.Equal(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)) || !trip.Arrive.Equal(time.Date(2026, 10, 16, 8, 34, 0, 0, time.UTC)) {
+		t.Errorf("Expected to leave 08:00 and arrive 08:34, got %v and %v", trip.Leave, trip.Arrive)
+	}
+	if len(trip.Steps) != 3 || trip.Steps[0].Duration != 5*time.Minute || trip.Steps[1].Line != "42" || trip.Steps[1].Vehicle != "bus" || trip.Steps[1].From != "Main St" {
+		t.Errorf("unexpected steps: %+v", trip.Steps)
+	}
+}
+
+type fakeTransit struct {
+	from []string
+}
+
+func (f *fakeTransit) TransitRoute(ctx context.Context, from, to string, depart, arrive time.Time) (*TransitTrip, error) {
+	f.from = append(f.from, from)
+	ride := TransitStep{Line: "42", Vehicle: "bus", Headsign: "Downtown", From: "Main St", Depart: arrive.Add(-25 * time.Minute), Arrive: arrive.Add(-5 * time.Minute)}
+	return &TransitTrip{Leave: arrive.Add(-30 * time.Minute), Arrive: arrive.Add(-5 * time.Minute), Steps: []TransitStep{{Duration: 5 * time.Minute}, ride}}, nil
+}
+
+// TestTransitTool_LeaveNowAlerts verifies alerts come once, only for events with a place it is nearly time to leave for, planned from the meeting before
+func TestTransitTool_LeaveNowAlerts(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	y, m, d := time.Now().AddDate(0, 0, 1).Date()
+	at := func(hour, min int) time.Time { return time.Date(y, m, d, hour, min, 0, 0, time.Local) }
+	g.AddEvent(testkit.Event{Summary: "Standup", Location: "Office HQ", Start: at(9, 0), End: at(9, 30)})
+	g.AddEvent(testkit.Event{Summary: "Dentist", Location: "Clinic", Start: at(10, 35), End: at(11, 0)})
+	g.AddEvent(testkit.Event{Summary: "Call", Location: "https://meet.example/abc", Start: at(10, 40), End: at(11, 0)})
+	g.AddEvent(testkit.Event{Summary: "Lunch", Location: "Cafe", Start: at(12, 30), End: at(13, 30)})
+
+	workspace := t.TempDir()
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	router := &fakeTransit{}
+	tool := NewTransitTool(nil, router, NewGoogleCalendarClient(testkit.Token), workspace, TransitOptions{Home: "Home St 1"}, profile.NewStore(workspace))
+	tool.SetScheduler(cs)
+	tool.now = func() time.Time { return at(10, 0) }
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "schedule_alerts"}); r.IsError || !strings.Contains(r.ForLLM, "10 min before") {
+		t.Fatalf("schedule_alerts: %+v", r)
+	}
+	tool.Execute(ctx, map[string]interface{}{"action": "schedule_alerts"})
+	jobs := cs.ListJobs(false)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != transitJobKind {
+		t.Fatalf("Expected one alerts job, got %+v", jobs)
+	}
+
+	out, err := tool.ExecuteJob(context.Background(), &jobs[0])
+	if err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if !strings.HasPrefix(out, "🚶 Time to go at ") || !strings.Contains(out, "for Dentist") || !strings.Contains(out, "take the bus 42 towards Downtown from Main St") ||
+		strings.Contains(out, "Lunch") || strings.Contains(out, "Call") {
+		t.Errorf("unexpected alert: %q", out)
+	}
+	if strings.Join(router.from, "|") != "Office HQ|Clinic" {
+		t.Errorf("Expected trips from the meeting before each event, got %v", router.from)
+	}
+	if out, _ := tool.ExecuteJob(context.Background(), &jobs[0]); out != "" {
+		t.Errorf("Expected no second alert, got %q", out)
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "unschedule_alerts"}); r.IsError || len(cs.ListJobs(true)) != 0 {
+		t.Errorf("unschedule_alerts: %+v, jobs %+v", r, cs.ListJobs(true))
+	}
+}
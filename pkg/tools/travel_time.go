@@ -0,0 +1,242 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// travelBufferNote marks the travel events the planner adds, so they are
+// not taken for the place the user comes from.
+const travelBufferNote = "Travel time added by picoclaw"
+
+// TravelTimer is implemented by route backends.
+type TravelTimer interface {
+	// TravelTime estimates the trip from one address to another by mode,
+	// arriving at arrive
+	TravelTime(ctx context.Context, from, to, mode string, arrive time.Time) (time.Duration, error)
+}
+
+// GoogleMapsTravel estimates trips with the Google Maps Distance Matrix
+// API.
+type GoogleMapsTravel struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewGoogleMapsTravel(apiKey string) *GoogleMapsTravel {
+	return &GoogleMapsTravel{
+		apiKey:  apiKey,
+		baseURL: "https://maps.googleapis.com/maps/api",
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (m *GoogleMapsTravel) TravelTime(ctx context.Context, from, to, mode string, arrive time.Time) (time.Duration, error) {
+	params := url.Values{}
+	params.Set("origins", from)
+	params.Set("destinations", to)
+	params.Set("mode", mode)
+	params.Set("key", m.apiKey)
+	// Timetables only matter for transit; the API refuses times past
+	if mode == "transit" && arrive.After(time.Now()) {
+		params.Set("arrival_time", fmt.Sprint(arrive.Unix()))
+	}
+	var resp struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+		Rows         []struct {
+			Elements []struct {
+				Status   string `json:"status"`
+				Duration struct {
+					Value int `json:"value"`
+				} `json:"duration"`
+			} `json:"elements"`
+		} `json:"rows"`
+	}
+	if err := doJSONRequest(ctx, m.client, http.MethodGet, m.baseURL+"/distancematrix/json?"+params.Encode(), nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Status != "OK" {
+		return 0, fmt.Errorf("maps: %s %s", resp.Status, resp.ErrorMessage)
+	}
+	if len(resp.Rows) == 0 || len(resp.Rows[0].Elements) == 0 {
+		return 0, fmt.Errorf("maps: no route from %q to %q", from, to)
+	}
+	el := resp.Rows[0].Elements[0]
+	if el.Status != "OK" {
+		return 0, fmt.Errorf("maps: no %s route from %q to %q (%s)", mode, from, to, el.Status)
+	}
+	return time.Duration(el.Duration.Value) * time.Second, nil
+}
+
+// TravelOptions configures the planner.
+type TravelOptions struct {
+	// Home is where the day starts, for the first meeting out
+	Home string
+	// Mode is driving (the default), transit, walking or bicycling
+	Mode string
+	// Buffers blocks the travel time in the calendar before each event
+	Buffers bool
+}
+
+// TravelPlanner works out how long it takes to get to a calendar event
+// from the meeting before it, or from home, blocks that time in the
+// calendar and spots meetings too far apart to make in time.
+type TravelPlanner struct {
+	router   TravelTimer
+	calendar *GoogleCalendarClient
+	opts     TravelOptions
+}
+
+func NewTravelPlanner(router TravelTimer, calendar *GoogleCalendarClient, opts TravelOptions) *TravelPlanner {
+	if opts.Mode == "" {
+		opts.Mode = "driving"
+	}
+	return &TravelPlanner{router: router, calendar: calendar, opts: opts}
+}
+
+// travelLeg is the trip to an event. After is the meeting it starts from,
+// nil when it starts from home.
+type travelLeg struct {
+	From     string
+	After    *CalendarEvent
+	Duration time.Duration
+}
+
+// gap is the time between the meeting the leg starts from and ev.
+func (l *travelLeg) gap(ev CalendarEvent) time.Duration {
+	return ev.Start.Sub(l.After.End)
+}
+
+// tooTight reports whether the leg cannot be made between the meetings.
+func (l *travelLeg) tooTight(ev CalendarEvent) bool {
+	return l.After != nil && l.Duration > l.gap(ev)
+}
+
+// physical reports whether an event takes place somewhere one travels to,
+// rather than online or nowhere in particular.
+func physical(location string) bool {
+	location = strings.TrimSpace(location)
+	return location != "" && !strings.Contains(location, "://")
+}
+
+// attended reports whether an event is a timed meeting the user attends.
+func attended(ev CalendarEvent) bool {
+	return !ev.AllDay && !ev.Free && ev.MyResponse() != "declined" && (ev.Type == "" || ev.Type == EventDefault) && ev.Description != travelBufferNote
+}
+
+// previous returns the last meeting of ev's day that ends by its start.
+func previous(ev CalendarEvent, events []CalendarEvent) *CalendarEvent {
+	y, m, d := ev.Start.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, ev.Start.Location())
+	var prev *CalendarEvent
+	for i, other := range events {
+		if other.ID == ev.ID || !attended(other) || other.End.After(ev.Start) || other.End.Before(dayStart) {
+			continue
+		}
+		if prev == nil || other.End.After(prev.End) {
+			prev = &events[i]
+		}
+	}
+	return prev
+}
+
+// leg works out the trip to ev from the meeting before it among events,
+// or from home. It returns nil when ev is not somewhere to travel to or
+// the start is not known.
+func (p *TravelPlanner) leg(ctx context.Context, ev CalendarEvent, events []CalendarEvent) (*travelLeg, error) {
+	if !physical(ev.Location) || !attended(ev) {
+		return nil, nil
+	}
+	leg := &travelLeg{From: p.opts.Home, After: previous(ev, events)}
+	if leg.After != nil && physical(leg.After.Location) {
+		leg.From = leg.After.Location
+	}
+	if !physical(leg.From) || strings.EqualFold(strings.TrimSpace(leg.From), strings.TrimSpace(ev.Location)) {
+		return nil, nil
+	}
+	d, err := p.router.TravelTime(ctx, leg.From, ev.Location, p.opts.Mode, ev.Start)
+	if err != nil {
+		return nil, err
+	}
+	// Round up to five minutes, as people plan
+	leg.Duration = (d + 5*time.Minute - 1) / (5 * time.Minute) * (5 * time.Minute)
+	return leg, nil
+}
+
+// describe says how far ev is, in the user's locale tag.
+func (p *TravelPlanner) describe(leg *travelLeg, tag string) string {
+	by := map[string]string{"driving": "by car", "transit": "by public transport", "walking": "on foot", "bicycling": "by bike"}[p.opts.Mode]
+	out := fmt.Sprintf("%d min %s from ", int(leg.Duration.Minutes()), by)
+	if leg.After != nil {
+		out += fmt.Sprintf("%q (%s, ends %s)", leg.After.Summary, leg.From, locale.Time(leg.After.End, tag))
+	} else {
+		out += "home"
+	}
+	return out
+}
+
+// Arrange looks at the trip to a newly created event: it returns a note
+// saying how far it is, blocks the travel time before it in calendarID
+// when buffers are on, and warns when the meeting before it ends too late
+// to get there. It returns "" for events not worth a note.
+func (p *TravelPlanner) Arrange(ctx context.Context, calendarID string, ev CalendarEvent, tag string) string {
+	if !physical(ev.Location) || !attended(ev) {
+		return ""
+	}
+	y, m, d := ev.Start.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, ev.Start.Location())
+	events, err := p.calendar.ListEvents(ctx, calendarID, dayStart, ev.Start)
+	if err != nil {
+		return fmt.Sprintf("travel time not checked: %v", err)
+	}
+	leg, err := p.leg(ctx, ev, events)
+	if err != nil {
+		return fmt.Sprintf("travel time not checked: %v", err)
+	}
+	if leg == nil {
+		return ""
+	}
+	note := p.describe(leg, tag)
+	if leg.tooTight(ev) {
+		return fmt.Sprintf("⚠️ %s, but only %d min between them: you cannot get there on time", note, int(leg.gap(ev).Minutes()))
+	}
+	if !p.opts.Buffers {
+		return note
+	}
+	buffer := CalendarEvent{
+		Summary:     "Travel to " + ev.Summary,
+		Description: travelBufferNote,
+		Start:       ev.Start.Add(-leg.Duration),
+		End:         ev.Start,
+	}
+	if _, err := p.calendar.InsertEvent(ctx, calendarID, buffer); err != nil {
+		return fmt.Sprintf("%s (travel time not blocked: %v)", note, err)
+	}
+	return fmt.Sprintf("%s; travel blocked from %s", note, locale.Time(buffer.Start, tag))
+}
+
+// tightLegs returns, by event ID, the events among events that cannot be
+// reached in time from the meeting before them, with the reason. Trips
+// that cannot be worked out are left out.
+func (p *TravelPlanner) tightLegs(ctx context.Context, events []CalendarEvent, tag string) map[string]string {
+	sorted := append([]CalendarEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+	tight := map[string]string{}
+	for _, ev := range sorted {
+		leg, err := p.leg(ctx, ev, sorted)
+		if err != nil || leg == nil || leg.After == nil || !leg.tooTight(ev) {
+			continue
+		}
+		tight[ev.ID] = fmt.Sprintf("getting here takes %s, but there are only %d min between them", p.describe(leg, tag), int(leg.gap(ev).Minutes()))
+	}
+	return tight
+}
@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+type fakeRouter map[string]time.Duration
+
+func (r fakeRouter) TravelTime(ctx context.Context, from, to, mode string, arrive time.Time) (time.Duration, error) {
+	return r[from+" -> "+to], nil
+}
+
+// TestTravelPlanner_BlocksTravelAndWarns verifies travel is blocked before an event reachable from the meeting before it, and a meeting too far from the one before is warned about instead
+func TestTravelPlanner_BlocksTravelAndWarns(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	y, m, d := time.Now().AddDate(0, 0, 1).Date()
+	at := func(hour, min int) time.Time { return time.Date(y, m, d, hour, min, 0, 0, time.Local) }
+	g.AddEvent(testkit.Event{Summary: "Standup", Location: "Office HQ", Start: at(9, 0), End: at(10, 0)})
+	dentist := CalendarEvent{Summary: "Dentist", Location: "Clinic", Start: at(11, 0), End: at(11, 30)}
+	dentist.ID = g.AddEvent(testkit.Event{Summary: dentist.Summary, Location: dentist.Location, Start: dentist.Start, End: dentist.End})
+
+	router := fakeRouter{"Office HQ -> Clinic": 22 * time.Minute, "Clinic -> Airport": 50 * time.Minute}
+	planner := NewTravelPlanner(router, NewGoogleCalendarClient(testkit.Token), TravelOptions{Home: "Home St 1", Buffers: true})
+
+	note := planner.Arrange(context.Background(), "primary", dentist, "")
+	if !strings.Contains(note, "25 min by car") || !strings.Contains(note, "Standup") || !strings.Contains(note, "travel blocked") {
+		t.Errorf("Expected the trip from the standup, rounded up and blocked, got %q", note)
+	}
+	var buffer *testkit.Event
+	for _, ev := range g.Events("primary") {
+		if ev.Summary == "Travel to Dentist" {
+			buffer = &ev
+		}
+	}
+	if buffer == nil || !buffer.Start.Equal(at(10, 35)) || !buffer.End.Equal(at(11, 0)) {
+		t.Fatalf("Expected travel blocked 10:35-11:00, got %+v", buffer)
+	}
+
+	flight := CalendarEvent{Summary: "Flight", Location: "Airport", Start: at(12, 0), End: at(14, 0)}
+	flight.ID = g.AddEvent(testkit.Event{Summary: flight.Summary, Location: flight.Location, Start: flight.Start, End: flight.End})
+	note = planner.Arrange(context.Background(), "primary", flight, "")
+	if !strings.Contains(note, "cannot get there on time") || !strings.Contains(note, "only 30 min") {
+		t.Errorf("Expected a warning the flight cannot be reached, got %q", note)
+	}
+	if n := len(g.Events("primary")); n != 4 {
+		t.Errorf("Expected no travel blocked for the flight, got %d events", n)
+	}
+
+	events, err := NewGoogleCalendarClient(testkit.Token).ListEvents(context.Background(), "primary", at(0, 0), at(23, 59))
+	if err != nil {
+		t.Fatalf("ListEvents() error: %v", err)
+	}
+	tight := planner.tightLegs(context.Background(), events, "")
+	if len(tight) != 1 || !strings.Contains(tight[flight.ID], "Dentist") {
+		t.Errorf("Expected only the flight flagged, after the dentist, got %v", tight)
+	}
+}
+
+// TestGoogleMapsTravel_TravelTime verifies the Distance Matrix answer is read, and a place without a route is an error
+func TestGoogleMapsTravel_TravelTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/distancematrix/json" || q.Get("key") != "k" || q.Get("mode") != "walking" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		status := "OK"
+		if q.Get("destinations") == "Atlantis" {
+			status = "ZERO_RESULTS"
+		}
+		w.Write([]byte(`{"status":"OK","rows":[{"elements":[{"status":"` + status + `","duration":{"value":754}}]}]}`))
+	}))
+	defer server.Close()
+	maps := NewGoogleMapsTravel("k")
+	maps.baseURL = server.URL
+
+	d, err := maps.TravelTime(context.Background(), "Home", "Park", "walking", time.Now())
+	if err != nil || d != 754*time.Second {
+		t.Errorf("TravelTime() = %v, %v, want 12m34s", d, err)
+	}
+	if _, err := maps.TravelTime(context.Background(), "Home", "Atlantis", "walking", time.Now()); err == nil {
+		t.Error("Expected an error for a place without a route")
+	}
+}
@@ -0,0 +1,343 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/store"
+)
+
+// Compensating actions the journal knows how to run.
+const (
+	UndoDeleteEvent     = "calendar.delete_event"
+	UndoTrashDriveFile  = "drive.trash"
+	UndoStarDriveFile   = "drive.star"
+	UndoRemoveFromAlbum = "photos.remove_from_album"
+	UndoRestoreFile     = "file.restore"
+	UndoTruncateFile    = "file.truncate"
+	UndoDeleteKeepNote  = "keep.delete_note"
+)
+
+const (
+	// undoWindow is how far back mutations can be undone
+	undoWindow = 7 * 24 * time.Hour
+	// undoMaxFileBytes bounds the previous content kept to restore a
+	// file; larger overwrites are not journaled
+	undoMaxFileBytes = 1 << 20
+	// undoMaxCount bounds how many operations one call reverses
+	undoMaxCount = 10
+)
+
+// UndoAction is the compensating step for a mutation a tool just made.
+type UndoAction struct {
+	Kind string
+	// Description says what was done: "created event "Dinner" on Fri 6 Mar"
+	Description string
+	Params      map[string]string
+}
+
+// UndoHandler runs a compensating action.
+type UndoHandler func(ctx context.Context, params map[string]string) error
+
+// UndoJournal keeps recent mutations per chat in the state store, with
+// the handlers that reverse them. Tools record through the context (see
+// WithUndo), so a mutation made outside a chat is simply not journaled.
+type UndoJournal struct {
+	log *store.Undo
+
+	mu       sync.RWMutex
+	token    TokenFunc
+	handlers map[string]UndoHandler
+}
+
+// NewUndoJournal returns a journal stored in log. token authorizes the
+// Google compensating actions; nil leaves them failing until SetToken.
+func NewUndoJournal(log *store.Undo, token TokenFunc) *UndoJournal {
+	j := &UndoJournal{log: log, token: token, handlers: map[string]UndoHandler{}}
+	j.Handle(UndoDeleteEvent, func(ctx context.Context, p map[string]string) error {
+		token, err := j.googleToken()
+		if err != nil {
+			return err
+		}
+		return NewGoogleCalendarClient(token).DeleteEvent(ctx, p["calendar_id"], p["event_id"])
+	})
+	j.Handle(UndoTrashDriveFile, func(ctx context.Context, p map[string]string) error {
+		token, err := j.googleToken()
+		if err != nil {
+			return err
+		}
+		return NewGoogleDriveClient(token).Trash(ctx, p["file_id"])
+	})
+	j.Handle(UndoStarDriveFile, func(ctx context.Context, p map[string]string) error {
+		token, err := j.googleToken()
+		if err != nil {
+			return err
+		}
+		_, err = NewGoogleDriveClient(token).SetStarred(ctx, p["file_id"], p["starred"] == "true")
+		return err
+	})
+	j.Handle(UndoRemoveFromAlbum, func(ctx context.Context, p map[string]string) error {
+		token, err := j.googleToken()
+		if err != nil {
+			return err
+		}
+		return NewGooglePhotosClient(token).RemoveFromAlbum(ctx, p["album_id"], strings.Split(p["item_ids"], ","))
+	})
+	j.Handle(UndoDeleteKeepNote, func(ctx context.Context, p map[string]string) error {
+		token, err := j.googleToken()
+		if err != nil {
+			return err
+		}
+		return NewKeepClient(token).Delete(ctx, p["name"])
+	})
+	j.Handle(UndoRestoreFile, func(ctx context.Context, p map[string]string) error {
+		if p["existed"] != "true" {
+			return removeIfExists(p["path"])
+		}
+		return os.WriteFile(p["path"], []byte(p["content"]), 0644)
+	})
+	j.Handle(UndoTruncateFile, func(ctx context.Context, p map[string]string) error {
+		if p["existed"] != "true" {
+			return removeIfExists(p["path"])
+		}
+		size, err := strconv.ParseInt(p["size"], 10, 64)
+		if err != nil {
+			return err
+		}
+		return os.Truncate(p["path"], size)
+	})
+	return j
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetToken replaces the Google token source, e.g. after a config reload.
+func (j *UndoJournal) SetToken(token TokenFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.token = token
+}
+
+func (j *UndoJournal) googleToken() (TokenFunc, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.token == nil {
+		return nil, fmt.Errorf("Google is not configured")
+	}
+	return j.token, nil
+}
+
+// Handle registers the handler for a kind of compensating action.
+func (j *UndoJournal) Handle(kind string, h UndoHandler) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.handlers[kind] = h
+}
+
+// Record journals a mutation made from scope.
+func (j *UndoJournal) Record(ctx context.Context, scope string, a UndoAction) error {
+	_, err := j.log.Record(ctx, store.UndoRecord{Scope: scope, Kind: a.Kind, Description: a.Description, Params: a.Params})
+	return err
+}
+
+// Recent lists up to n mutations from scope that can still be undone,
+// newest first.
+func (j *UndoJournal) Recent(ctx context.Context, scope string, n int) ([]store.UndoRecord, error) {
+	cutoff := time.Now().Add(-undoWindow)
+	if _, err := j.log.Prune(ctx, cutoff); err != nil {
+		return nil, err
+	}
+	return j.log.Recent(ctx, scope, cutoff, n)
+}
+
+// UndoOutcome is the result of reversing one journaled mutation.
+type UndoOutcome struct {
+	Record store.UndoRecord
+	Err    error
+}
+
+// Undo reverses the last n mutations from scope, newest first. A failed
+// step does not stop the others; it stays in the journal to be retried.
+func (j *UndoJournal) Undo(ctx context.Context, scope string, n int) ([]UndoOutcome, error) {
+	records, err := j.Recent(ctx, scope, n)
+	if err != nil {
+		return nil, err
+	}
+	outcomes := make([]UndoOutcome, 0, len(records))
+	for _, r := range records {
+		j.mu.RLock()
+		handler := j.handlers[r.Kind]
+		j.mu.RUnlock()
+		var err error
+		if handler == nil {
+			err = fmt.Errorf("no way to undo %s", r.Kind)
+		} else {
+			// A compensating action is not itself journaled
+			err = handler(WithUndo(ctx, nil, ""), r.Params)
+		}
+		if err == nil {
+			err = j.log.MarkUndone(ctx, r.ID)
+		}
+		outcomes = append(outcomes, UndoOutcome{Record: r, Err: err})
+	}
+	return outcomes, nil
+}
+
+type undoKey struct{}
+
+type undoScope struct {
+	journal *UndoJournal
+	scope   string
+}
+
+// WithUndo returns ctx in which mutating tools journal what they do in
+// j under scope, the chat the request came from.
+func WithUndo(ctx context.Context, j *UndoJournal, scope string) context.Context {
+	return context.WithValue(ctx, undoKey{}, undoScope{journal: j, scope: scope})
+}
+
+func undoFromContext(ctx context.Context) (*UndoJournal, string) {
+	u, _ := ctx.Value(undoKey{}).(undoScope)
+	return u.journal, u.scope
+}
+
+// recordUndo journals a mutation if ctx carries a journal, and notes the
+// objects it touched for the audit log. Failures are logged rather than
+// returned: the mutation itself has succeeded.
+func recordUndo(ctx context.Context, a UndoAction) {
+	keys := make([]string, 0, len(a.Params))
+	for key := range a.Params {
+		if strings.HasSuffix(key, "_id") || key == "path" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		noteAuditRef(ctx, a.Params[key])
+	}
+	j, scope := undoFromContext(ctx)
+	if j == nil || scope == "" {
+		return
+	}
+	if err := j.Record(context.WithoutCancel(ctx), scope, a); err != nil {
+		logger.WarnCF("tools", "Failed to journal an undo step", map[string]interface{}{
+			"kind":  a.Kind,
+			"error": err.Error(),
+		})
+	}
+}
+
+// recordFileUndo journals how to put path back the way it was before a
+// write: previous holds its old content, or is nil if it did not exist.
+func recordFileUndo(ctx context.Context, path, verb string, previous []byte) {
+	if len(previous) > undoMaxFileBytes {
+		return
+	}
+	recordUndo(ctx, UndoAction{
+		Kind:        UndoRestoreFile,
+		Description: fmt.Sprintf("%s %s", verb, path),
+		Params:      map[string]string{"path": path, "existed": strconv.FormatBool(previous != nil), "content": string(previous)},
+	})
+}
+
+// UndoTool lists and reverses the mutations made from the current chat.
+type UndoTool struct{}
+
+func NewUndoTool() *UndoTool {
+	return &UndoTool{}
+}
+
+func (t *UndoTool) Name() string {
+	return "undo"
+}
+
+func (t *UndoTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "undo")
+}
+
+func (t *UndoTool) Description() string {
+	return "Undo recent changes made from this chat: delete events that were created, move uploaded Drive files and created folders to the trash, take photos back out of albums, and restore files that were written or edited. Use action=list to show what can be undone, then action=undo with count to reverse the last N changes."
+}
+
+func (t *UndoTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "undo"},
+				"description": "Action to perform",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("How many of the latest changes to undo (default 1, at most %d)", undoMaxCount),
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *UndoTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	journal, scope := undoFromContext(ctx)
+	if journal == nil || scope == "" {
+		return ErrorResult("undo is only available in a chat")
+	}
+	action, _ := args["action"].(string)
+	count := 1
+	if c, ok := args["count"].(float64); ok && c >= 1 {
+		count = min(int(c), undoMaxCount)
+	}
+
+	switch action {
+	case "list":
+		records, err := journal.Recent(ctx, scope, undoMaxCount)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if len(records) == 0 {
+			return SilentResult("Nothing to undo.")
+		}
+		var sb strings.Builder
+		sb.WriteString("Recent changes, newest first:")
+		for i, r := range records {
+			fmt.Fprintf(&sb, "\n%d. %s (%s ago)", i+1, r.Description, time.Since(r.CreatedAt).Round(time.Minute))
+		}
+		return SilentResult(sb.String())
+	case "undo":
+		outcomes, err := journal.Undo(ctx, scope, count)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if len(outcomes) == 0 {
+			return SilentResult("Nothing to undo.")
+		}
+		var sb strings.Builder
+		failed := 0
+		for _, o := range outcomes {
+			if o.Err != nil {
+				failed++
+				fmt.Fprintf(&sb, "Could not undo: %s (%v)\n", o.Record.Description, o.Err)
+				continue
+			}
+			fmt.Fprintf(&sb, "Undone: %s\n", o.Record.Description)
+		}
+		if failed == len(outcomes) {
+			return ErrorResult(strings.TrimSpace(sb.String()))
+		}
+		return SilentResult(strings.TrimSpace(sb.String()))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
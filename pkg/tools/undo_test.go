@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/store"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+func newTestUndo(t *testing.T) *UndoJournal {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	db := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	return NewUndoJournal(db.Undo, testkit.Token)
+}
+
+// TestUndo_ReversesGoogleChangesNewestFirst verifies created events and uploads are journaled and undone in reverse order
+func TestUndo_ReversesGoogleChangesNewestFirst(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	journal := newTestUndo(t)
+	ctx := WithUndo(context.Background(), journal, "telegram:1")
+
+	start := time.Date(2026, 3, 6, 19, 0, 0, 0, time.UTC)
+	if _, err := NewGoogleCalendarClient(testkit.Token).InsertEvent(ctx, "", CalendarEvent{Summary: "Dinner", Start: start, End: start.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewGoogleDriveClient(testkit.Token).Upload(ctx, "", "march.pdf", "application/pdf", []byte("%PDF")); err != nil {
+		t.Fatal(err)
+	}
+	// Made from another chat, so not ours to undo
+	other := WithUndo(context.Background(), journal, "telegram:2")
+	NewGoogleDriveClient(testkit.Token).Upload(other, "", "other.pdf", "application/pdf", []byte("%PDF"))
+
+	tool := NewUndoTool()
+	list := tool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if list.IsError || !strings.Contains(list.ForLLM, `1. uploaded "march.pdf"`) || !strings.Contains(list.ForLLM, `2. added event "Dinner"`) {
+		t.Fatalf("unexpected list: %s", list.ForLLM)
+	}
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "undo"})
+	if result.IsError || !strings.Contains(result.ForLLM, "march.pdf") {
+		t.Fatalf("unexpected undo: %s", result.ForLLM)
+	}
+	files := g.Files()
+	if len(files) != 2 || !files[0].Trashed || files[1].Trashed {
+		t.Errorf("expected only march.pdf trashed: %+v", files)
+	}
+	if len(g.Events("primary")) != 1 {
+		t.Fatal("event removed before its turn")
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "undo", "count": float64(5)})
+	if result.IsError || !strings.Contains(result.ForLLM, "Dinner") {
+		t.Fatalf("unexpected undo: %s", result.ForLLM)
+	}
+	if events := g.Events("primary"); len(events) != 0 {
+		t.Errorf("event not deleted: %+v", events)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "undo"}); result.ForLLM != "Nothing to undo." {
+		t.Errorf("journal not emptied: %s", result.ForLLM)
+	}
+}
+
+// TestUndo_RestoresFiles verifies writes, edits and appends are put back, and new files removed
+func TestUndo_RestoresFiles(t *testing.T) {
+	journal := newTestUndo(t)
+	ctx := WithUndo(context.Background(), journal, "cli:direct")
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.md")
+	os.WriteFile(notes, []byte("one\n"), 0644)
+
+	NewEditFileTool(dir, true).Execute(ctx, map[string]interface{}{"path": notes, "old_text": "one", "new_text": "uno"})
+	NewAppendFileTool(dir, true).Execute(ctx, map[string]interface{}{"path": notes, "content": "two\n"})
+	NewWriteFileTool(dir, true).Execute(ctx, map[string]interface{}{"path": filepath.Join(dir, "new.txt"), "content": "hi"})
+
+	result := NewUndoTool().Execute(ctx, map[string]interface{}{"action": "undo", "count": float64(3)})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if data, _ := os.ReadFile(notes); string(data) != "one\n" {
+		t.Errorf("notes.md = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("new.txt still exists: %v", err)
+	}
+}
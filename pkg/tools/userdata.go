@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/artifacts"
+)
+
+// UserDataKeeper exports and erases what is stored about the person behind
+// a chat. The agent implements it over its sessions, profiles, memories,
+// audit log and artifacts.
+type UserDataKeeper interface {
+	ExportUserData(ctx context.Context, channel, chatID string) (*artifacts.Artifact, error)
+	DeleteUserData(ctx context.Context, channel, chatID string) (string, error)
+}
+
+// ChatDataStore is a store that keeps data about chats, so my_data can
+// export and erase it. chatKey is "channel:chatID".
+type ChatDataStore interface {
+	// ChatData returns what is kept about the chat, nil when nothing is
+	ChatData(ctx context.Context, chatKey string) (interface{}, error)
+	// PurgeChat erases it and returns how many records went
+	PurgeChat(ctx context.Context, chatKey string) (int, error)
+}
+
+// snapshot encodes v, taken under its store's lock, so an export does not
+// race later changes.
+func snapshot(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+// UserDataTool lets users of a chat get a copy of their data, for
+// inspection or to move elsewhere, and have all of it deleted.
+type UserDataTool struct {
+	keeper UserDataKeeper
+}
+
+func NewUserDataTool(keeper UserDataKeeper) *UserDataTool {
+	return &UserDataTool{keeper: keeper}
+}
+
+func (t *UserDataTool) Name() string {
+	return "my_data"
+}
+
+func (t *UserDataTool) WorksOffline(args map[string]interface{}) bool {
+	return true
+}
+
+func (t *UserDataTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "delete")
+}
+
+func (t *UserDataTool) Description() string {
+	return "Everything stored about the user of this chat: conversation history, profile, memories, the audit log of changes made for them and file metadata. export sends them a zip with all of it; delete erases it all, linked accounts included (the audit log is append-only and stays). Ask the user to confirm before deleting, then call with confirm=true. Use it for \"what data do you have on me?\", \"export my data\" and \"delete everything about me\"."
+}
+
+func (t *UserDataTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"export", "delete"},
+				"description": "Action to perform",
+			},
+			"confirm": map[string]interface{}{
+				"type":        "boolean",
+				"description": "For delete: true once the user has confirmed",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *UserDataTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	if channel == "" || chatID == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "export":
+		a, err := t.keeper.ExportUserData(ctx, channel, chatID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("export failed: %v", err)).WithError(err)
+		}
+		return &ToolResult{
+			ForLLM: fmt.Sprintf("Exported the user's data as %s and sent it to the user. It holds a README.txt explaining each file.", a),
+			Media:  []string{a.Path},
+		}
+	case "delete":
+		if confirm, _ := args["confirm"].(bool); !confirm {
+			return SilentResult("Nothing deleted. This erases the conversation, profile, memories and files kept for this user and cannot be undone; ask the user to confirm, then call again with confirm=true.")
+		}
+		report, err := t.keeper.DeleteUserData(ctx, channel, chatID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("%s %v", report, err)).WithError(err)
+		}
+		return SilentResult(report)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q", action))
+	}
+}
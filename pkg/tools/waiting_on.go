@@ -0,0 +1,609 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+const (
+	waitingOnJobKind = "waiting_on"
+	// waitingOnRetention is how long a thread is still watched for a reply
+	// after the user was nudged about it
+	waitingOnRetention = 30 * 24 * time.Hour
+	// defaultFollowUp is the body of auto-drafted follow-ups when the user
+	// gave none
+	defaultFollowUp = "Hi,\n\nJust following up on my last email. Have you had a chance to look at it?\n\nThanks"
+)
+
+// WaitingOnOptions configures the tracker.
+type WaitingOnOptions struct {
+	// Days is how long to wait for a reply when the user does not say
+	Days int
+	// Every is how often schedules check the threads for replies
+	Every time.Duration
+	// AutoDraft drafts a follow-up in Gmail when a nudge goes out, unless
+	// the user asks otherwise for a thread
+	AutoDraft bool
+}
+
+// awaitedThread is a sent email the user is waiting on a reply to. Sent
+// is when the user last wrote in the thread; a message from anyone else
+// after it is the reply.
+type awaitedThread struct {
+	ThreadID  string    `json:"thread_id"`
+	MessageID string    `json:"message_id"`
+	Chat      string    `json:"chat"`
+	Subject   string    `json:"subject"`
+	To        []string  `json:"to"`
+	Sent      time.Time `json:"sent"`
+	Days      int       `json:"days"`
+	AutoDraft bool      `json:"auto_draft,omitempty"`
+	FollowUp  string    `json:"follow_up,omitempty"`
+	Nudged    time.Time `json:"nudged,omitempty"`
+	DraftID   string    `json:"draft_id,omitempty"`
+}
+
+// due is when the user is nudged if no reply came.
+func (a *awaitedThread) due() time.Time {
+	return a.Sent.AddDate(0, 0, a.Days)
+}
+
+type waitingOnState struct {
+	Threads map[string]*awaitedThread `json:"threads"`
+}
+
+// WaitingOnTool keeps the sent emails the user is waiting on an answer
+// to. A schedule in the chat watches each thread in Gmail: a reply is
+// reported and ends the wait, and when none arrives within the window the
+// user is nudged, with a follow-up drafted in Gmail if asked.
+type WaitingOnTool struct {
+	gmail     *GmailClient
+	profiles  *profile.Store
+	opts      WaitingOnOptions
+	statePath string
+	scheduler *cron.CronService
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// NewWaitingOnTool creates the tool. State is kept in
+// workspace/state/waiting_on.json.
+func NewWaitingOnTool(token TokenFunc, workspace string, opts WaitingOnOptions, profiles *profile.Store) *WaitingOnTool {
+	if opts.Days <= 0 {
+		opts.Days = 3
+	}
+	if opts.Every <= 0 {
+		opts.Every = time.Hour
+	}
+	return &WaitingOnTool{
+		gmail:     NewGmailClient(token),
+		profiles:  profiles,
+		opts:      opts,
+		statePath: filepath.Join(workspace, "state", "waiting_on.json"),
+		now:       time.Now,
+	}
+}
+
+func (t *WaitingOnTool) Name() string {
+	return "waiting_on"
+}
+
+func (t *WaitingOnTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "add", "done", "check")
+}
+
+// Untrusted reports that listings and checks carry email subjects and
+// replies.
+func (t *WaitingOnTool) Untrusted(args map[string]interface{}) bool {
+	return actionIn(args, "list", "check")
+}
+
+func (t *WaitingOnTool) Description() string {
+	return fmt.Sprintf("Follow-up tracker for sent emails: add marks a sent email (by email_id, a Gmail query, or the last one sent) as waiting on a reply. "+
+		"Replies are reported in this chat; if none arrives within days (default %d) the user is nudged, and with auto_draft a follow-up is drafted in Gmail for them to review. "+
+		"List what the user is waiting on, mark a thread done when it no longer needs an answer, or check for replies now.", t.opts.Days)
+}
+
+func (t *WaitingOnTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"add", "list", "done", "check"},
+				"description": "Action to perform",
+			},
+			"email_id": map[string]interface{}{
+				"type":        "string",
+				"description": "add: ID of the sent email",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "add: Gmail search for the sent email when there is no email_id, e.g. \"to:ana@example.com contract\" (default: the last email sent)",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("add: days to wait for a reply before nudging (default %d)", t.opts.Days),
+			},
+			"auto_draft": map[string]interface{}{
+				"type":        "boolean",
+				"description": fmt.Sprintf("add: draft a follow-up in Gmail when no reply comes (default %t)", t.opts.AutoDraft),
+			},
+			"follow_up": map[string]interface{}{
+				"type":        "string",
+				"description": "add: text of the follow-up to draft, in the language of the thread (default: a short polite nudge)",
+			},
+			"thread": map[string]interface{}{
+				"type":        "string",
+				"description": "done: thread ID, or words from the subject or recipient",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *WaitingOnTool) JobKinds() []string {
+	return []string{waitingOnJobKind}
+}
+
+func (t *WaitingOnTool) SetScheduler(cs *cron.CronService) {
+	t.scheduler = cs
+}
+
+func (t *WaitingOnTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChatFromContext(ctx)
+	chat := channel + ":" + chatID
+	action, _ := args["action"].(string)
+
+	switch action {
+	case "add":
+		if channel == "" || chatID == "" {
+			return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+		}
+		msg, err := t.add(ctx, channel, chatID, args)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "list":
+		msg, err := t.list(chat)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "done":
+		ref, _ := args["thread"].(string)
+		msg, err := t.done(chat, ref)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		return SilentResult(msg)
+
+	case "check":
+		report, err := t.check(ctx, chat)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to check for replies: %v", err)).WithError(err)
+		}
+		if report == "" {
+			report = "No replies yet, and nothing is overdue."
+		}
+		return SilentResult(report)
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// add starts waiting on a reply to the email args name.
+func (t *WaitingOnTool) add(ctx context.Context, channel, chatID string, args map[string]interface{}) (string, error) {
+	id, _ := args["email_id"].(string)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		query, _ := args["query"].(string)
+		ids, err := t.gmail.Search(ctx, strings.TrimSpace("in:sent "+query), 1)
+		if err != nil {
+			return "", fmt.Errorf("failed to search sent mail: %w", err)
+		}
+		if len(ids) == 0 {
+			return "", fmt.Errorf("no sent email matches %q", query)
+		}
+		id = ids[0]
+	}
+	msg, err := t.gmail.GetMessage(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the email: %w", err)
+	}
+	days := t.opts.Days
+	if d, ok := args["days"].(float64); ok && d >= 1 {
+		days = int(d)
+	}
+	autoDraft := t.opts.AutoDraft
+	if a, ok := args["auto_draft"].(bool); ok {
+		autoDraft = a
+	}
+	followUp, _ := args["follow_up"].(string)
+	chat := channel + ":" + chatID
+	thread := &awaitedThread{
+		ThreadID:  msg.ThreadID,
+		MessageID: msg.ID,
+		Chat:      chat,
+		Subject:   msg.Subject,
+		To:        recipients(msg.To, msg.Cc),
+		Sent:      msg.Received,
+		Days:      days,
+		AutoDraft: autoDraft,
+		FollowUp:  strings.TrimSpace(followUp),
+	}
+	if thread.Sent.IsZero() {
+		thread.Sent = t.now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	state.Threads[thread.ThreadID] = thread
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	if err := t.schedule(channel, chatID); err != nil {
+		return "", err
+	}
+
+	out := fmt.Sprintf("Waiting on a reply to %q from %s. ", thread.Subject, strings.Join(thread.To, ", "))
+	out += fmt.Sprintf("If none comes by %s, the user will be nudged here", thread.due().In(t.location(chat)).Format("Mon Jan 2 15:04"))
+	if thread.AutoDraft {
+		out += " and a follow-up drafted in Gmail"
+	}
+	return out + ".", nil
+}
+
+// recipients lists the addresses in To and Cc headers.
+func recipients(headers ...string) []string {
+	var out []string
+	for _, h := range headers {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		list, err := mail.ParseAddressList(h)
+		if err != nil {
+			out = append(out, strings.TrimSpace(h))
+			continue
+		}
+		for _, addr := range list {
+			out = append(out, addr.Address)
+		}
+	}
+	return out
+}
+
+// schedule starts the chat's check, unless it has one.
+func (t *WaitingOnTool) schedule(channel, chatID string) error {
+	if t.scheduler == nil {
+		return fmt.Errorf("reply tracking is not available (scheduler not running)")
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == waitingOnJobKind && job.Payload.Channel == channel && job.Payload.To == chatID {
+			return nil
+		}
+	}
+	everyMS := t.opts.Every.Milliseconds()
+	_, err := t.scheduler.AddJobWithPayload("Waiting on replies", cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, cron.CronPayload{
+		Kind:    waitingOnJobKind,
+		Message: "Waiting on replies",
+		Channel: channel,
+		To:      chatID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule the reply check: %w", err)
+	}
+	return nil
+}
+
+// unschedule removes the chat's check.
+func (t *WaitingOnTool) unschedule(chat string) {
+	if t.scheduler == nil {
+		return
+	}
+	for _, job := range t.scheduler.ListJobs(true) {
+		if job.Payload.Kind == waitingOnJobKind && job.Payload.Channel+":"+job.Payload.To == chat {
+			t.scheduler.RemoveJob(job.ID)
+		}
+	}
+}
+
+// threads returns the chat's threads, the oldest sent first.
+func (state *waitingOnState) threads(chat string) []*awaitedThread {
+	var out []*awaitedThread
+	for _, a := range state.Threads {
+		if a.Chat == chat {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Sent.Before(out[j].Sent) })
+	return out
+}
+
+func (t *WaitingOnTool) list(chat string) (string, error) {
+	t.mu.Lock()
+	state, err := t.loadState()
+	t.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	threads := state.threads(chat)
+	if len(threads) == 0 {
+		return "Not waiting on any replies.", nil
+	}
+	loc := t.location(chat)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Waiting on %d reply(ies):", len(threads))
+	for _, a := range threads {
+		fmt.Fprintf(&sb, "\n- %q to %s, sent %s", a.Subject, strings.Join(a.To, ", "), a.Sent.In(loc).Format("Jan 2"))
+		if a.Nudged.IsZero() {
+			fmt.Fprintf(&sb, ", nudge %s", a.due().In(loc).Format("Mon Jan 2 15:04"))
+		} else {
+			fmt.Fprintf(&sb, ", overdue since %s", a.due().In(loc).Format("Jan 2"))
+		}
+		if a.DraftID != "" {
+			sb.WriteString(" (follow-up drafted)")
+		}
+		fmt.Fprintf(&sb, " [thread %s]", a.ThreadID)
+	}
+	return sb.String(), nil
+}
+
+// done stops waiting on the thread ref names: its ID, or words from its
+// subject or a recipient.
+func (t *WaitingOnTool) done(chat, ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", fmt.Errorf("thread is required for done")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	var match *awaitedThread
+	for _, a := range state.threads(chat) {
+		if a.ThreadID == ref {
+			match = a
+			break
+		}
+		if strings.Contains(strings.ToLower(a.Subject+" "+strings.Join(a.To, " ")), strings.ToLower(ref)) {
+			if match != nil {
+				return "", fmt.Errorf("%q matches several threads; use the thread ID from list", ref)
+			}
+			match = a
+		}
+	}
+	if match == nil {
+		return "", fmt.Errorf("not waiting on a thread matching %q", ref)
+	}
+	delete(state.Threads, match.ThreadID)
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	if len(state.threads(chat)) == 0 {
+		t.unschedule(chat)
+	}
+	return fmt.Sprintf("No longer waiting on %q.", match.Subject), nil
+}
+
+// ExecuteJob implements ScheduledTool. It reports replies and overdue
+// threads, and says nothing otherwise.
+func (t *WaitingOnTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	return t.check(ctx, job.Payload.Channel+":"+job.Payload.To)
+}
+
+// check looks for replies in the chat's threads and nudges about those
+// overdue. It returns a report, "" when there is nothing to tell.
+func (t *WaitingOnTool) check(ctx context.Context, chat string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return "", err
+	}
+	now := t.now()
+	loc := t.location(chat)
+	var replies, nudges, failures []string
+	for _, a := range state.threads(chat) {
+		messages, err := t.gmail.Thread(ctx, a.ThreadID)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			// The thread was deleted; nothing to wait on
+			delete(state.Threads, a.ThreadID)
+			continue
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%q: %v", a.Subject, err))
+			continue
+		}
+		if reply := firstReply(messages, a.Sent); reply != nil {
+			line := fmt.Sprintf("%s replied to %q", senderName(reply.From), a.Subject)
+			if reply.Snippet != "" {
+				line += ": " + reply.Snippet
+			}
+			replies = append(replies, line)
+			delete(state.Threads, a.ThreadID)
+			continue
+		}
+		if last := lastSent(messages); last != nil && last.Received.After(a.Sent) {
+			// The user followed up on their own; the wait starts again
+			a.Sent, a.MessageID, a.Nudged = last.Received, last.ID, time.Time{}
+		}
+		switch {
+		case !a.Nudged.IsZero():
+			if now.Sub(a.Nudged) > waitingOnRetention {
+				delete(state.Threads, a.ThreadID)
+			}
+		case !now.Before(a.due()):
+			line := fmt.Sprintf("No reply from %s to %q, sent %s.", strings.Join(a.To, ", "), a.Subject, a.Sent.In(loc).Format("Mon Jan 2"))
+			if a.AutoDraft {
+				if id, err := t.draftFollowUp(ctx, a); err != nil {
+					line += fmt.Sprintf(" Could not draft a follow-up: %v", err)
+				} else {
+					a.DraftID = id
+					line += " A follow-up is waiting in your Gmail drafts."
+				}
+			}
+			a.Nudged = now
+			nudges = append(nudges, line)
+		}
+	}
+	if err := saveJSONAtomic(t.statePath, state); err != nil {
+		return "", err
+	}
+	if len(state.threads(chat)) == 0 {
+		t.unschedule(chat)
+	}
+
+	var sb strings.Builder
+	if len(replies) > 0 {
+		fmt.Fprintf(&sb, "↩️ %s", strings.Join(replies, "\n↩️ "))
+	}
+	if len(nudges) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⏳ %s", strings.Join(nudges, "\n⏳ "))
+	}
+	if len(failures) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "⚠️ Could not check %d thread(s):\n- %s", len(failures), strings.Join(failures, "\n- "))
+	}
+	return sb.String(), nil
+}
+
+// firstReply returns the first message after since that the user did not
+// write.
+func firstReply(messages []GmailSummary, since time.Time) *GmailSummary {
+	for i, m := range messages {
+		if m.Received.After(since) && !hasLabel(m.Labels, "SENT") && !hasLabel(m.Labels, "DRAFT") {
+			return &messages[i]
+		}
+	}
+	return nil
+}
+
+// lastSent returns the last message the user sent in the thread.
+func lastSent(messages []GmailSummary) *GmailSummary {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if hasLabel(messages[i].Labels, "SENT") {
+			return &messages[i]
+		}
+	}
+	return nil
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// draftFollowUp drafts a reply to the user's last email in the thread.
+func (t *WaitingOnTool) draftFollowUp(ctx context.Context, a *awaitedThread) (string, error) {
+	msg, err := t.gmail.GetMessage(ctx, a.MessageID)
+	if err != nil {
+		return "", err
+	}
+	body := a.FollowUp
+	if body == "" {
+		body = defaultFollowUp
+	}
+	return t.gmail.CreateDraft(ctx, OutgoingEmail{
+		To:         a.To,
+		Subject:    replySubject(a.Subject),
+		Body:       body,
+		InReplyTo:  msg.MessageID,
+		References: strings.TrimSpace(msg.References + " " + msg.MessageID),
+		ThreadID:   a.ThreadID,
+	})
+}
+
+func (t *WaitingOnTool) location(chat string) *time.Location {
+	if t.profiles == nil || chat == "" {
+		return time.Local
+	}
+	return t.profiles.Get(chat).Location()
+}
+
+// loadState reads the state; callers hold t.mu.
+func (t *WaitingOnTool) loadState() (*waitingOnState, error) {
+	state := &waitingOnState{}
+	data, err := os.ReadFile(t.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read waiting-on state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse waiting-on state: %w", err)
+		}
+	}
+	if state.Threads == nil {
+		state.Threads = make(map[string]*awaitedThread)
+	}
+	return state, nil
+}
+
+// ChatData implements ChatDataStore: the threads the chat waits on.
+func (t *WaitingOnTool) ChatData(ctx context.Context, chatKey string) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if threads := state.threads(chatKey); len(threads) > 0 {
+		return threads, nil
+	}
+	return nil, nil
+}
+
+// PurgeChat implements ChatDataStore. The check schedule goes with the
+// chat's jobs.
+func (t *WaitingOnTool) PurgeChat(ctx context.Context, chatKey string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, err := t.loadState()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for id, a := range state.Threads {
+		if a.Chat == chatKey {
+			delete(state.Threads, id)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, saveJSONAtomic(t.statePath, state)
+}
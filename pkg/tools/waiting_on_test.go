@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/testkit"
+)
+
+// TestWaitingOnTool_NudgesDraftsAndSeesReply verifies an unanswered thread is nudged once with a follow-up drafted in it, and a reply ends the wait and its schedule
+func TestWaitingOnTool_NudgesDraftsAndSeesReply(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Now()
+	sent := g.AddEmail(testkit.Email{
+		From: "me@example.com", To: "Ana <ana@example.com>", Subject: "Contract draft",
+		Date: now.Add(-4 * 24 * time.Hour), Labels: []string{"SENT"}, Thread: "t1",
+	})
+	g.AddEmail(testkit.Email{From: "bob@example.com", To: "me@example.com", Subject: "Lunch?", Date: now.Add(-time.Hour)})
+
+	tool := NewWaitingOnTool(testkit.Token, t.TempDir(), WaitingOnOptions{Days: 3}, nil)
+	cs := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool.SetScheduler(cs)
+	ctx := WithChat(context.Background(), "telegram", "42")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "add", "query": "to:ana", "auto_draft": true})
+	if result.IsError {
+		t.Fatalf("add failed: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Contract draft") {
+		t.Errorf("Expected the thread named, got %q", result.ForLLM)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Payload.Kind != waitingOnJobKind {
+		t.Fatalf("Expected one reply check scheduled, got %+v", jobs)
+	}
+	job := &jobs[0]
+
+	report, err := tool.ExecuteJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if !strings.Contains(report, "No reply from ana@example.com") || !strings.Contains(report, "drafts") {
+		t.Errorf("Expected a nudge with a drafted follow-up, got %q", report)
+	}
+	drafts := g.Drafts()
+	if len(drafts) != 1 || drafts[0].Thread != "t1" || drafts[0].Subject != "Re: Contract draft" || !strings.Contains(drafts[0].To, "ana@example.com") {
+		t.Fatalf("Expected a follow-up drafted in the thread, got %+v", drafts)
+	}
+	if !strings.Contains(string(drafts[0].Raw), "<"+sent+"@testkit>") {
+		t.Errorf("Expected the draft to reply to the sent email, got:\n%s", drafts[0].Raw)
+	}
+	if len(g.Sent()) != 0 {
+		t.Errorf("Expected nothing sent, got %+v", g.Sent())
+	}
+	if again, _ := tool.ExecuteJob(context.Background(), job); again != "" {
+		t.Errorf("Expected no second nudge, got %q", again)
+	}
+
+	g.AddEmail(testkit.Email{From: "Ana <ana@example.com>", To: "me@example.com", Subject: "Re: Contract draft", Body: "Looks good, signing today", Thread: "t1"})
+	report, err = tool.ExecuteJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("ExecuteJob() error: %v", err)
+	}
+	if !strings.Contains(report, "Ana replied") || !strings.Contains(report, "signing today") {
+		t.Errorf("Expected the reply reported, got %q", report)
+	}
+	if list := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(list.ForLLM, "Not waiting") {
+		t.Errorf("Expected nothing left to wait on, got %q", list.ForLLM)
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 0 {
+		t.Errorf("Expected the schedule removed, got %+v", jobs)
+	}
+}
+
+// TestWaitingOnTool_OwnFollowUpRestartsWait verifies a later email from the user in the thread moves the deadline instead of counting as a reply
+func TestWaitingOnTool_OwnFollowUpRestartsWait(t *testing.T) {
+	g := testkit.NewGoogle(t)
+	g.Install()
+	now := time.Now()
+	g.AddEmail(testkit.Email{
+		From: "me@example.com", To: "ops@example.com", Subject: "Invoice 113",
+		Date: now.Add(-5 * 24 * time.Hour), Labels: []string{"SENT"}, Thread: "t2",
+	})
+	g.AddEmail(testkit.Email{
+		From: "me@example.com", To: "ops@example.com", Subject: "Re: Invoice 113",
+		Date: now.Add(-24 * time.Hour), Labels: []string{"SENT"}, Thread: "t2",
+	})
+
+	tool := NewWaitingOnTool(testkit.Token, t.TempDir(), WaitingOnOptions{Days: 2}, nil)
+	tool.SetScheduler(cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil))
+	ctx := WithChat(context.Background(), "telegram", "42")
+	ids, err := tool.gmail.Search(ctx, "subject:Invoice", 10)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("Search() = %v, %v", ids, err)
+	}
+	// The older email, as if marked right after sending it
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "add", "email_id": ids[1]}); result.IsError {
+		t.Fatalf("add failed: %s", result.ForLLM)
+	}
+
+	report, err := tool.check(ctx, "telegram:42")
+	if err != nil {
+		t.Fatalf("check() error: %v", err)
+	}
+	if report != "" {
+		t.Errorf("Expected no nudge within two days of the follow-up, got %q", report)
+	}
+	if list := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(list.ForLLM, "Invoice 113") {
+		t.Errorf("Expected the thread still waited on, got %q", list.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "done", "thread": "invoice"}); result.IsError {
+		t.Fatalf("done failed: %s", result.ForLLM)
+	}
+	if list := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(list.ForLLM, "Not waiting") {
+		t.Errorf("Expected nothing left to wait on, got %q", list.ForLLM)
+	}
+}
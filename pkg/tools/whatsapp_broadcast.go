@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// BroadcastList is a broadcast list of the linked WhatsApp account.
+type BroadcastList struct {
+	ID         string
+	Name       string
+	Recipients int
+}
+
+// Broadcaster is implemented by channels that can post announcements: to
+// broadcast lists, and as status updates where the backend allows it.
+type Broadcaster interface {
+	BroadcastLists(ctx context.Context) ([]BroadcastList, error)
+	SendBroadcast(ctx context.Context, listID, content string) error
+	PostStatus(ctx context.Context, content string) error
+}
+
+// WhatsAppBroadcastTool posts announcements to WhatsApp broadcast lists and
+// status. They reach everyone on the account's lists, so only owners may
+// post.
+type WhatsAppBroadcastTool struct {
+	broadcaster Broadcaster
+	isOwner     func(channel, senderID string) bool
+}
+
+func NewWhatsAppBroadcastTool(broadcaster Broadcaster) *WhatsAppBroadcastTool {
+	return &WhatsAppBroadcastTool{broadcaster: broadcaster}
+}
+
+// SetOwnerCheck sets how the tool tells owners apart. Until it is set
+// nobody may post.
+func (t *WhatsAppBroadcastTool) SetOwnerCheck(isOwner func(channel, senderID string) bool) {
+	t.isOwner = isOwner
+}
+
+func (t *WhatsAppBroadcastTool) Name() string {
+	return "whatsapp_broadcast"
+}
+
+func (t *WhatsAppBroadcastTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "send", "status")
+}
+
+func (t *WhatsAppBroadcastTool) Description() string {
+	return "Post announcements from the linked WhatsApp account: list its broadcast lists, send a message to a broadcast list, or post a text status update (when the bridge supports it). Only the owner may send or post; confirm the exact text with them first, since it reaches every recipient."
+}
+
+func (t *WhatsAppBroadcastTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"lists", "send", "status"},
+				"description": "lists shows the broadcast lists, send posts to one, status posts a status update",
+			},
+			"list": map[string]interface{}{
+				"type":        "string",
+				"description": "For send: the broadcast list name or ID (e.g. 1234...@broadcast)",
+			},
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "For send and status: the text to post",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// findList returns the list whose ID or name is ref.
+func (t *WhatsAppBroadcastTool) findList(ctx context.Context, ref string) (*BroadcastList, error) {
+	lists, err := t.broadcaster.BroadcastLists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list broadcast lists: %w", err)
+	}
+	for i := range lists {
+		if lists[i].ID == ref || strings.EqualFold(lists[i].Name, ref) {
+			return &lists[i], nil
+		}
+	}
+	names := make([]string, 0, len(lists))
+	for _, l := range lists {
+		names = append(names, l.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no broadcast list %q: the account has none", ref)
+	}
+	return nil, fmt.Errorf("no broadcast list %q; the lists are: %s", ref, strings.Join(names, ", "))
+}
+
+func (t *WhatsAppBroadcastTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	content, _ := args["content"].(string)
+	content = strings.TrimSpace(content)
+
+	if action == "send" || action == "status" {
+		channel, _ := ChatFromContext(ctx)
+		if t.isOwner == nil || !t.isOwner(channel, SenderFromContext(ctx)) {
+			return ErrorResult("only the owner can post WhatsApp broadcasts and status updates")
+		}
+		if content == "" {
+			return ErrorResult(fmt.Sprintf("content is required for %s", action))
+		}
+	}
+
+	switch action {
+	case "lists":
+		lists, err := t.broadcaster.BroadcastLists(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list broadcast lists: %v", err)).WithError(err)
+		}
+		if len(lists) == 0 {
+			return SilentResult("No WhatsApp broadcast lists")
+		}
+		var sb strings.Builder
+		for _, l := range lists {
+			fmt.Fprintf(&sb, "- %s (%s, %d recipients)\n", l.Name, l.ID, l.Recipients)
+		}
+		return SilentResult(sb.String())
+
+	case "send":
+		ref, _ := args["list"].(string)
+		if ref == "" {
+			return ErrorResult("list is required for send")
+		}
+		list, err := t.findList(ctx, ref)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if err := t.broadcaster.SendBroadcast(ctx, list.ID, content); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to send broadcast: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Sent to broadcast list %s (%d recipients)", list.Name, list.Recipients))
+
+	case "status":
+		if err := t.broadcaster.PostStatus(ctx, content); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to post status: %v", err)).WithError(err)
+		}
+		return SilentResult("Posted the WhatsApp status update")
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type fakeBroadcaster struct {
+	sentList string
+	sent     string
+	status   string
+}
+
+func (b *fakeBroadcaster) BroadcastLists(ctx context.Context) ([]BroadcastList, error) {
+	return []BroadcastList{{ID: "1@broadcast", Name: "Customers", Recipients: 40}}, nil
+}
+
+func (b *fakeBroadcaster) SendBroadcast(ctx context.Context, listID, content string) error {
+	b.sentList, b.sent = listID, content
+	return nil
+}
+
+func (b *fakeBroadcaster) PostStatus(ctx context.Context, content string) error {
+	b.status = content
+	return nil
+}
+
+func ownerCheck(channel, senderID string) bool {
+	return channel == "whatsapp" && senderID == "owner"
+}
+
+// TestWhatsAppBroadcastTool_SendsToListByName verifies an owner can send to a broadcast list given by name
+func TestWhatsAppBroadcastTool_SendsToListByName(t *testing.T) {
+	b := &fakeBroadcaster{}
+	tool := NewWhatsAppBroadcastTool(b)
+	tool.SetOwnerCheck(ownerCheck)
+	ctx := WithSender(WithChat(context.Background(), "whatsapp", "owner@s.whatsapp.net"), "owner")
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "send", "list": "customers", "content": "Open until 8pm today"})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if b.sentList != "1@broadcast" || b.sent != "Open until 8pm today" {
+		t.Errorf("Unexpected broadcast: %q to %q", b.sent, b.sentList)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "send", "list": "Suppliers", "content": "hi"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "Customers") {
+		t.Errorf("Expected unknown list error naming the lists, got: %s", result.ForLLM)
+	}
+}
+
+// TestWhatsAppBroadcastTool_OwnerOnly verifies other users can list but not send or post a status
+func TestWhatsAppBroadcastTool_OwnerOnly(t *testing.T) {
+	b := &fakeBroadcaster{}
+	tool := NewWhatsAppBroadcastTool(b)
+	tool.SetOwnerCheck(ownerCheck)
+	ctx := WithSender(WithChat(context.Background(), "whatsapp", "guest@s.whatsapp.net"), "guest")
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "lists"}); result.IsError {
+		t.Errorf("Expected lists to work, got error: %s", result.ForLLM)
+	}
+	result := tool.Execute(ctx, map[string]interface{}{"action": "status", "content": "Closed today"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "only the owner") {
+		t.Errorf("Expected owner-only error, got: %s", result.ForLLM)
+	}
+	if b.status != "" {
+		t.Errorf("Status was posted by a non-owner: %q", b.status)
+	}
+}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ChatGroup is a group chat on a messaging channel.
+type ChatGroup struct {
+	ID           string
+	Subject      string
+	Participants int
+}
+
+// GroupMember is a participant of a group chat.
+type GroupMember struct {
+	ID    string
+	Admin bool
+}
+
+// GroupManager is implemented by channels that can administer group chats.
+// UpdateParticipants accepts "add", "remove", "promote" and "demote".
+type GroupManager interface {
+	ListGroups(ctx context.Context) ([]ChatGroup, error)
+	GroupParticipants(ctx context.Context, groupID string) ([]GroupMember, error)
+	CreateGroup(ctx context.Context, subject string, participants []string) (*ChatGroup, error)
+	UpdateParticipants(ctx context.Context, groupID string, participants []string, action string) error
+}
+
+// WhatsAppGroupsTool lets the agent administer WhatsApp groups through the bridge.
+type WhatsAppGroupsTool struct {
+	manager  GroupManager
+	contacts *ContactDirectory
+	chatID   string
+}
+
+func NewWhatsAppGroupsTool(manager GroupManager) *WhatsAppGroupsTool {
+	return &WhatsAppGroupsTool{manager: manager}
+}
+
+// SetContacts lets members be given as contact names ("mom", "Ana"),
+// which are resolved to phone numbers from the address books.
+func (t *WhatsAppGroupsTool) SetContacts(directory *ContactDirectory) {
+	t.contacts = directory
+}
+
+func (t *WhatsAppGroupsTool) Name() string {
+	return "whatsapp_groups"
+}
+
+func (t *WhatsAppGroupsTool) Mutates(args map[string]interface{}) bool {
+	return actionIn(args, "create", "add", "remove", "promote", "demote")
+}
+
+func (t *WhatsAppGroupsTool) Description() string {
+	return "Manage WhatsApp groups: list groups, show participants, create a group, and add, remove, promote or demote members. Adding/removing members requires the linked account to be a group admin."
+}
+
+func (t *WhatsAppGroupsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "participants", "create", "add", "remove", "promote", "demote"},
+				"description": "Action to perform",
+			},
+			"group_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Group ID (e.g. 1203630...@g.us). Defaults to the current chat when it is a group.",
+			},
+			"subject": map[string]interface{}{
+				"type":        "string",
+				"description": "Group name (create)",
+			},
+			"members": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Phone numbers with country code, e.g. 5511999990000, or contact names when contacts are set up (create/add/remove/promote/demote)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *WhatsAppGroupsTool) SetContext(channel, chatID string) {
+	t.chatID = ""
+	if channel == "whatsapp" {
+		t.chatID = chatID
+	}
+}
+
+// whatsAppJID turns a phone number into a WhatsApp user JID. Values that
+// already are JIDs are returned unchanged.
+func whatsAppJID(member string) string {
+	if strings.Contains(member, "@") {
+		return member
+	}
+	return normalizePhone(member) + "@s.whatsapp.net"
+}
+
+func (t *WhatsAppGroupsTool) groupID(args map[string]interface{}) (string, error) {
+	if id, ok := args["group_id"].(string); ok && id != "" {
+		return id, nil
+	}
+	if strings.HasSuffix(t.chatID, "@g.us") {
+		return t.chatID, nil
+	}
+	return "", fmt.Errorf("group_id is required (current chat is not a group)")
+}
+
+func (t *WhatsAppGroupsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, ok := args["action"].(string)
+	if !ok {
+		return ErrorResult("action is required")
+	}
+
+	members, _ := stringListArg(args, "members")
+	jids := make([]string, 0, len(members))
+	for i, m := range members {
+		if t.contacts != nil && !strings.Contains(m, "@") {
+			res, err := t.contacts.ResolveRecipient(ctx, m, RecipientPhone)
+			if err != nil {
+				return ErrorResult(fmt.Sprintf("failed to look up %s: %v", m, err)).WithError(err)
+			}
+			if res.Match == nil {
+				// The pick replaces this member with the chosen number
+				if clarify := res.Clarify(func(address string) map[string]interface{} {
+					original, _ := stringListArg(args, "members")
+					picked := make([]interface{}, len(original))
+					for j, member := range original {
+						picked[j] = member
+					}
+					picked[i] = address
+					return map[string]interface{}{"members": picked}
+				}); clarify != nil {
+					return clarify
+				}
+				return ErrorResult(res.Describe())
+			}
+			members[i] = res.Match.String()
+			m = res.Match.Address
+		}
+		jids = append(jids, whatsAppJID(m))
+	}
+
+	switch action {
+	case "list":
+		groups, err := t.manager.ListGroups(ctx)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list groups: %v", err)).WithError(err)
+		}
+		if len(groups) == 0 {
+			return SilentResult("No WhatsApp groups")
+		}
+		var sb strings.Builder
+		for _, g := range groups {
+			fmt.Fprintf(&sb, "- %s (%s, %d participants)\n", g.Subject, g.ID, g.Participants)
+		}
+		return SilentResult(sb.String())
+
+	case "participants":
+		groupID, err := t.groupID(args)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		participants, err := t.manager.GroupParticipants(ctx, groupID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to get participants: %v", err)).WithError(err)
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d participants:\n", len(participants))
+		for _, p := range participants {
+			role := ""
+			if p.Admin {
+				role = " (admin)"
+			}
+			fmt.Fprintf(&sb, "- %s%s\n", p.ID, role)
+		}
+		return SilentResult(sb.String())
+
+	case "create":
+		subject, _ := args["subject"].(string)
+		if subject == "" {
+			return ErrorResult("subject is required for create")
+		}
+		if len(jids) == 0 {
+			return ErrorResult("members is required for create")
+		}
+		group, err := t.manager.CreateGroup(ctx, subject, jids)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to create group: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Created group %s (%s)", group.Subject, group.ID))
+
+	case "add", "remove", "promote", "demote":
+		groupID, err := t.groupID(args)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if len(jids) == 0 {
+			return ErrorResult(fmt.Sprintf("members is required for %s", action))
+		}
+		if err := t.manager.UpdateParticipants(ctx, groupID, jids, action); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to %s members: %v", action, err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("%s: %s in %s", action, strings.Join(members, ", "), groupID))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeGroupManager struct {
+	updatedGroup  string
+	updatedAction string
+	updatedJIDs   []string
+}
+
+func (m *fakeGroupManager) ListGroups(ctx context.Context) ([]ChatGroup, error) {
+	return []ChatGroup{{ID: "123@g.us", Subject: "Family", Participants: 5}}, nil
+}
+
+func (m *fakeGroupManager) GroupParticipants(ctx context.Context, groupID string) ([]GroupMember, error) {
+	return []GroupMember{{ID: "5511999990000@s.whatsapp.net", Admin: true}}, nil
+}
+
+func (m *fakeGroupManager) CreateGroup(ctx context.Context, subject string, participants []string) (*ChatGroup, error) {
+	return &ChatGroup{ID: "new@g.us", Subject: subject, Participants: len(participants)}, nil
+}
+
+func (m *fakeGroupManager) UpdateParticipants(ctx context.Context, groupID string, participants []string, action string) error {
+	m.updatedGroup, m.updatedJIDs, m.updatedAction = groupID, participants, action
+	return nil
+}
+
+// TestWhatsAppGroupsTool_AddUsesCurrentGroup verifies members are added to the current group chat as JIDs
+func TestWhatsAppGroupsTool_AddUsesCurrentGroup(t *testing.T) {
+	manager := &fakeGroupManager{}
+	tool := NewWhatsAppGroupsTool(manager)
+	tool.SetContext("whatsapp", "123@g.us")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":  "add",
+		"members": []interface{}{"+55 (11) 98888-7777"},
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if manager.updatedGroup != "123@g.us" || manager.updatedAction != "add" {
+		t.Errorf("Unexpected update: %s %s", manager.updatedGroup, manager.updatedAction)
+	}
+	if len(manager.updatedJIDs) != 1 || manager.updatedJIDs[0] != "5511988887777@s.whatsapp.net" {
+		t.Errorf("Expected normalized JID, got %v", manager.updatedJIDs)
+	}
+}
+
+// TestWhatsAppGroupsTool_RequiresGroupOutsideGroupChat verifies group_id is required from a direct chat
+func TestWhatsAppGroupsTool_RequiresGroupOutsideGroupChat(t *testing.T) {
+	tool := NewWhatsAppGroupsTool(&fakeGroupManager{})
+	tool.SetContext("whatsapp", "5511999990000@s.whatsapp.net")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"action": "participants"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "group_id") {
+		t.Errorf("Expected group_id error, got: %s", result.ForLLM)
+	}
+}
+
+// TestWhatsAppGroupsTool_ResolvesMemberNames verifies contact names become phone JIDs and unknown names are refused
+func TestWhatsAppGroupsTool_ResolvesMemberNames(t *testing.T) {
+	book := NewLocalAddressBook(filepath.Join(t.TempDir(), "contacts.json"))
+	book.Save(context.Background(), &Contact{Name: "Maria Souza", Phones: []string{"+55 11 97777-6666"}, Notes: "Mother"})
+	manager := &fakeGroupManager{}
+	tool := NewWhatsAppGroupsTool(manager)
+	tool.SetContacts(NewContactDirectory(book))
+	tool.SetContext("whatsapp", "123@g.us")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"action": "add", "members": []interface{}{"mom"}})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if len(manager.updatedJIDs) != 1 || manager.updatedJIDs[0] != "5511977776666@s.whatsapp.net" {
+		t.Errorf("Expected mom's JID, got %v", manager.updatedJIDs)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"action": "add", "members": []interface{}{"Carlos"}})
+	if !result.IsError || !strings.Contains(result.ForLLM, "Ask the user") {
+		t.Errorf("Expected an unknown-contact error, got: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,245 @@
+// Package tracing records spans for agent rounds, LLM calls, tool calls and
+// outbound sends, and exports them to an OpenTelemetry collector with
+// OTLP/HTTP (JSON encoding). It is a small subset of the OpenTelemetry API
+// on the standard library, so tracing adds no dependencies to a device
+// build; when it is not initialized every call is a cheap no-op.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds, as in the OTLP protocol.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Attr is a span attribute. Value is a string, bool, int, int64 or float64.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int) Attr   { return Attr{key, int64(value)} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+func Float(key string, v float64) Attr { return Attr{key, v} }
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type contextKey struct{}
+
+// Span is an operation being timed. A nil *Span (tracing disabled or not
+// sampled) accepts every method, so callers never check.
+type Span struct {
+	tracer   *Tracer
+	sc       spanContext
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []Attr
+	errMsg string
+	ended  bool
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetError(err.Error())
+}
+
+// SetError marks the span as failed with a message.
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMsg = msg
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = s.tracer.now()
+	s.mu.Unlock()
+	s.tracer.exporter.enqueue(s)
+}
+
+// TraceParent returns the W3C traceparent header for the span, or "" for a
+// nil span.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return formatTraceParent(s.sc)
+}
+
+func formatTraceParent(sc spanContext) string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// Tracer creates spans and hands finished ones to its exporter.
+type Tracer struct {
+	exporter    *exporter
+	sampleRatio float64
+	now         func() time.Time
+}
+
+var (
+	globalMu sync.RWMutex
+	global   *Tracer
+)
+
+// Config configures the exporter. Endpoint is the collector's OTLP/HTTP
+// base URL, e.g. http://localhost:4318; spans are posted to
+// Endpoint/v1/traces. SampleRatio is the share of rounds traced (0 < r <= 1).
+type Config struct {
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	SampleRatio float64
+}
+
+// Init installs the global tracer. The returned function flushes pending
+// spans and stops the exporter.
+func Init(cfg Config) (func(context.Context) error, error) {
+	if !strings.HasPrefix(cfg.Endpoint, "http://") && !strings.HasPrefix(cfg.Endpoint, "https://") {
+		return nil, fmt.Errorf("tracing endpoint must be an http(s) URL, got %q", cfg.Endpoint)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "picoclaw"
+	}
+	if cfg.SampleRatio <= 0 || cfg.SampleRatio > 1 {
+		cfg.SampleRatio = 1
+	}
+	t := &Tracer{
+		exporter:    newExporter(cfg),
+		sampleRatio: cfg.SampleRatio,
+		now:         time.Now,
+	}
+	globalMu.Lock()
+	global = t
+	globalMu.Unlock()
+	return func(ctx context.Context) error {
+		globalMu.Lock()
+		if global == t {
+			global = nil
+		}
+		globalMu.Unlock()
+		return t.exporter.shutdown(ctx)
+	}, nil
+}
+
+// Enabled reports whether a tracer is installed.
+func Enabled() bool {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global != nil
+}
+
+// Start begins an internal span as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind is Start with an explicit span kind.
+func StartKind(ctx context.Context, name string, kind int, attrs ...Attr) (context.Context, *Span) {
+	globalMu.RLock()
+	t := global
+	globalMu.RUnlock()
+	if t == nil {
+		return ctx, nil
+	}
+	return t.start(ctx, name, kind, attrs)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind int, attrs []Attr) (context.Context, *Span) {
+	parent, hasParent := ctx.Value(contextKey{}).(spanContext)
+	sc := spanContext{sampled: true}
+	if hasParent {
+		sc.traceID = parent.traceID
+		sc.sampled = parent.sampled
+	} else {
+		rand.Read(sc.traceID[:])
+		sc.sampled = t.sampleRatio >= 1 || mathrand.Float64() < t.sampleRatio
+	}
+	rand.Read(sc.spanID[:])
+	ctx = context.WithValue(ctx, contextKey{}, sc)
+	if !sc.sampled {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, sc: sc, name: name, kind: kind, start: t.now(), attrs: attrs}
+	if hasParent {
+		span.parentID = parent.spanID
+	}
+	return ctx, span
+}
+
+// WithTraceParent returns ctx carrying the remote parent from a W3C
+// traceparent value, so spans started from it join that trace. Invalid or
+// empty values return ctx unchanged.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	var sc spanContext
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	sc.sampled = parts[3] == "01"
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// TraceParent returns the traceparent of the span in ctx, or "".
+func TraceParent(ctx context.Context) string {
+	if sc, ok := ctx.Value(contextKey{}).(spanContext); ok {
+		return formatTraceParent(sc)
+	}
+	return ""
+}
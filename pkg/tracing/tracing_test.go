@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestTracing_ExportsNestedSpans verifies child spans share the trace, link to their parent and reach the collector
+func TestTracing_ExportsNestedSpans(t *testing.T) {
+	var mu sync.Mutex
+	var received otlpRequest
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	shutdown, err := Init(Config{Endpoint: server.URL + "/", Headers: map[string]string{"Authorization": "Bearer k"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, root := StartKind(context.Background(), "agent.message", KindServer, String("channel", "telegram"))
+	_, tool := Start(ctx, "tool.web_fetch", Int("n", 3))
+	tool.RecordError(errors.New("timeout"))
+	tool.End()
+	parent := root.TraceParent()
+	root.End()
+
+	// A send on the other side of the bus joins the same trace
+	_, send := Start(WithTraceParent(context.Background(), parent), "channel.send")
+	send.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() {
+		t.Error("tracer still installed after shutdown")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if auth != "Bearer k" {
+		t.Errorf("headers not sent: %q", auth)
+	}
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload: %+v", received)
+	}
+	spans := map[string]otlpSpan{}
+	for _, s := range received.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[s.Name] = s
+	}
+	rootSpan, toolSpan, sendSpan := spans["agent.message"], spans["tool.web_fetch"], spans["channel.send"]
+	if rootSpan.ParentSpanID != "" || rootSpan.Kind != KindServer {
+		t.Errorf("unexpected root span: %+v", rootSpan)
+	}
+	if toolSpan.TraceID != rootSpan.TraceID || toolSpan.ParentSpanID != rootSpan.SpanID {
+		t.Errorf("tool span not a child of the root: %+v", toolSpan)
+	}
+	if toolSpan.Status.Code != 2 || toolSpan.Status.Message != "timeout" {
+		t.Errorf("tool error not recorded: %+v", toolSpan.Status)
+	}
+	if toolSpan.Attributes[0].Key != "n" || toolSpan.Attributes[0].Value.IntValue == nil || *toolSpan.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("unexpected attributes: %+v", toolSpan.Attributes)
+	}
+	if sendSpan.TraceID != rootSpan.TraceID || sendSpan.ParentSpanID != rootSpan.SpanID {
+		t.Errorf("send span did not join the trace: %+v", sendSpan)
+	}
+	if !strings.HasPrefix(parent, "00-"+rootSpan.TraceID+"-") {
+		t.Errorf("unexpected traceparent %q", parent)
+	}
+}
+
+// TestTracing_DisabledIsNoop verifies spans are nil and safe to use without a tracer
+func TestTracing_DisabledIsNoop(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop")
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(errors.New("x"))
+	span.End()
+	if span != nil || span.TraceParent() != "" || TraceParent(ctx) != "" {
+		t.Error("expected a no-op span without a tracer")
+	}
+}
@@ -0,0 +1,574 @@
+// Package transfer moves large files to and from cloud APIs in a way that
+// survives flaky links: uploads go in chunks and resume from the last byte
+// the server committed, downloads continue with Range requests after a
+// dropped connection, both report progress and share one bandwidth cap,
+// and finished transfers are checked against the checksum the API gives.
+//
+// The protocols themselves (Drive's and Photos' resumable uploads) live
+// with their clients, behind Session; this package drives them.
+package transfer
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// chunkGranularity is the unit Google's resumable uploads want chunks
+	// in; only the last chunk may be smaller.
+	chunkGranularity = 256 << 10
+
+	DefaultChunkSize  = 8 << 20
+	DefaultRetries    = 5
+	DefaultRetryDelay = time.Second
+)
+
+// Options tune every transfer in the process.
+type Options struct {
+	// ChunkSize is the size of each upload chunk, rounded down to 256 KiB
+	ChunkSize int64
+	// MaxBytesPerSecond caps the combined rate of all transfers; 0 means
+	// no cap
+	MaxBytesPerSecond int64
+	// Retries is how many times a failed chunk or dropped download is
+	// resumed before giving up
+	Retries int
+	// RetryDelay is the first pause before resuming; it doubles each time
+	RetryDelay time.Duration
+	// Windows are the times of day background uploads may run; none
+	// lets them run at any time
+	Windows []Window
+}
+
+// Window is a daily period, in the device's local time, when background
+// uploads such as backups may run, so they don't take the uplink while it
+// is in use.
+type Window struct {
+	// Start and End are offsets from midnight; an End before Start spans
+	// midnight, and equal ones the whole day
+	Start, End time.Duration
+	// MaxBytesPerSecond caps background uploads in the window, within the
+	// overall cap; 0 means no cap of its own
+	MaxBytesPerSecond int64
+}
+
+// contains reports whether the time of day tod falls in w.
+func (w Window) contains(tod time.Duration) bool {
+	if w.Start <= w.End {
+		return w.Start == w.End || (tod >= w.Start && tod < w.End)
+	}
+	return tod >= w.Start || tod < w.End
+}
+
+func (o Options) withDefaults() Options {
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+	o.ChunkSize = max(o.ChunkSize/chunkGranularity*chunkGranularity, chunkGranularity)
+	if o.Retries <= 0 {
+		o.Retries = DefaultRetries
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = DefaultRetryDelay
+	}
+	return o
+}
+
+var (
+	mu       sync.RWMutex
+	settings = Options{}.withDefaults()
+	limit    = &limiter{}
+	// bulk paces background uploads at the cap of the current window
+	bulk = &limiter{}
+	now  = time.Now
+)
+
+// SetOptions replaces the options of transfers started from now on; the
+// bandwidth cap applies at once.
+func SetOptions(o Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	settings = o.withDefaults()
+	limit.setRate(o.MaxBytesPerSecond)
+}
+
+func current() Options {
+	mu.RLock()
+	defer mu.RUnlock()
+	return settings
+}
+
+type backgroundKey struct{}
+
+// Background returns ctx in which uploads are bulk work that can wait,
+// such as a backup: they only run inside the transfer windows, at the
+// windows' caps.
+func Background(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+// windowCheckEvery bounds each wait for a window, so new options apply.
+const windowCheckEvery = 10 * time.Minute
+
+// WaitForWindow blocks until a transfer window is open and returns it; it
+// returns at once when no windows are set.
+func WaitForWindow(ctx context.Context) (Window, error) {
+	logged := false
+	for {
+		windows := current().Windows
+		if len(windows) == 0 {
+			return Window{}, nil
+		}
+		t := now()
+		tod := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+		wait := 24 * time.Hour
+		for _, w := range windows {
+			if w.contains(tod) {
+				return w, nil
+			}
+			wait = min(wait, (w.Start-tod+24*time.Hour)%(24*time.Hour))
+		}
+		if !logged {
+			logger.InfoCF("transfer", "Background uploads waiting for their transfer window", map[string]interface{}{
+				"opens": t.Add(wait).Format("15:04"),
+			})
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return Window{}, ctx.Err()
+		case <-time.After(min(wait, windowCheckEvery)):
+		}
+	}
+}
+
+// Pace waits until n more bytes may be uploaded: under the overall cap
+// and, for background uploads, inside a window and under its cap. Uploads
+// too small for Upload call it themselves before sending.
+func Pace(ctx context.Context, n int64) error {
+	if isBackground(ctx) {
+		w, err := WaitForWindow(ctx)
+		if err != nil {
+			return err
+		}
+		bulk.setRate(w.MaxBytesPerSecond)
+		if err := bulk.wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	return limit.wait(ctx, n)
+}
+
+// ErrChecksum is returned when a finished transfer does not match the
+// checksum the API reported for it.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// StatusError is an HTTP error answer to part of a transfer.
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("transfer failed (%d): %s", e.Status, strings.TrimSpace(e.Body))
+}
+
+// retryable reports whether err is worth resuming after: dropped
+// connections, timeouts, rate limits and server errors are; other HTTP
+// errors and cancellation are not.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrChecksum) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Status == http.StatusRequestTimeout || status.Status == http.StatusTooManyRequests || status.Status >= 500
+	}
+	return true
+}
+
+// pause waits before the attempt-th retry.
+func pause(ctx context.Context, o Options, attempt int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(o.RetryDelay << (attempt - 1)):
+		return nil
+	}
+}
+
+// Progress is how far a transfer has got.
+type Progress struct {
+	// Name is the file being transferred
+	Name string
+	// Upload is false for downloads
+	Upload bool
+	Done   int64
+	// Total is -1 when the size is not known
+	Total int64
+}
+
+// ProgressFunc receives progress reports. Reports for one transfer come
+// from one goroutine, in order; the last has Done == Total when the size
+// is known.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress returns ctx in which transfers report their progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func report(ctx context.Context, p Progress) {
+	if fn, _ := ctx.Value(progressKey{}).(ProgressFunc); fn != nil {
+		fn(p)
+	}
+}
+
+// ProgressReader reports the bytes read through r to the progress
+// function in ctx, as p with Done counted up. It is for copies between
+// two services, which report as one transfer; the calls they make inside
+// should get a ctx without progress (WithProgress(ctx, nil)).
+func ProgressReader(ctx context.Context, r io.Reader, p Progress) io.Reader {
+	return &progressReader{ctx: ctx, r: r, p: p}
+}
+
+type progressReader struct {
+	ctx context.Context
+	r   io.Reader
+	p   Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.p.Done += int64(n)
+		report(r.ctx, r.p)
+	}
+	return n, err
+}
+
+// Throttle wraps fn so that it only hears about transfers of at least
+// minSize bytes (or of unknown size), at most once per interval, plus
+// their completion. It is what chat progress messages want: small files
+// finish before anyone would read a percentage.
+func Throttle(fn ProgressFunc, interval time.Duration, minSize int64) ProgressFunc {
+	var mu sync.Mutex
+	last := map[string]time.Time{}
+	return func(p Progress) {
+		if p.Total >= 0 && p.Total < minSize {
+			return
+		}
+		mu.Lock()
+		key := fmt.Sprintf("%t:%s", p.Upload, p.Name)
+		finished := p.Total >= 0 && p.Done >= p.Total
+		if !finished && time.Since(last[key]) < interval {
+			mu.Unlock()
+			return
+		}
+		if finished {
+			delete(last, key)
+		} else {
+			last[key] = time.Now()
+		}
+		mu.Unlock()
+		fn(p)
+	}
+}
+
+// FormatProgress renders p for a chat: "Uploading video.mp4: 45% (12.0 of
+// 26.5 MB)".
+func FormatProgress(p Progress) string {
+	verb := "Downloading"
+	if p.Upload {
+		verb = "Uploading"
+	}
+	if p.Total <= 0 {
+		return fmt.Sprintf("%s %s: %s so far", verb, p.Name, formatMB(p.Done))
+	}
+	return fmt.Sprintf("%s %s: %d%% (%s of %s)", verb, p.Name, p.Done*100/p.Total, strings.TrimSuffix(formatMB(p.Done), " MB"), formatMB(p.Total))
+}
+
+func formatMB(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// Session is one resumable upload on the server side.
+type Session interface {
+	// Send stores chunk at offset of a total-byte file; last marks the
+	// final chunk. It returns the number of bytes the server now holds
+	// and, once the file is complete, the server's final answer.
+	Send(ctx context.Context, chunk []byte, offset, total int64, last bool) (committed int64, final []byte, err error)
+	// Query asks the server how many bytes it holds, after a failed Send.
+	Query(ctx context.Context, total int64) (committed int64, final []byte, err error)
+}
+
+// Upload sends size bytes from r through s in chunks, resuming from what
+// the server committed when a chunk fails, and returns the server's final
+// answer.
+func Upload(ctx context.Context, name string, r io.ReaderAt, size int64, s Session) ([]byte, error) {
+	o := current()
+	buf := make([]byte, min(o.ChunkSize, max(size, 0)))
+	var offset int64
+	attempt := 0
+	for {
+		n := min(o.ChunkSize, size-offset)
+		chunk := buf[:n]
+		if _, err := r.ReadAt(chunk, offset); err != nil && !(err == io.EOF && int64(len(chunk)) == n) {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := Pace(ctx, n); err != nil {
+			return nil, err
+		}
+		committed, final, err := s.Send(ctx, chunk, offset, size, offset+n == size)
+		for err != nil {
+			if !retryable(ctx, err) || attempt >= o.Retries {
+				return nil, err
+			}
+			attempt++
+			logger.DebugCF("transfer", "Resuming upload", map[string]interface{}{
+				"name": name, "offset": offset, "attempt": attempt, "error": err.Error(),
+			})
+			if err := pause(ctx, o, attempt); err != nil {
+				return nil, err
+			}
+			committed, final, err = s.Query(ctx, size)
+		}
+		if final != nil {
+			report(ctx, Progress{Name: name, Upload: true, Done: size, Total: size})
+			return final, nil
+		}
+		if committed > offset {
+			attempt = 0
+		}
+		if committed >= size {
+			// Everything is stored but the answer was lost
+			if _, final, err = s.Query(ctx, size); err != nil {
+				return nil, err
+			}
+			if final == nil {
+				return nil, fmt.Errorf("upload of %s completed without an answer from the server", name)
+			}
+			report(ctx, Progress{Name: name, Upload: true, Done: size, Total: size})
+			return final, nil
+		}
+		offset = committed
+		report(ctx, Progress{Name: name, Upload: true, Done: offset, Total: size})
+	}
+}
+
+// UploadStream is Upload for a reader that can only be read once, such as
+// a download from another service. Only the bytes the server has not yet
+// committed are kept, about one chunk, so a failed chunk can be resent
+// without holding the whole file.
+func UploadStream(ctx context.Context, name string, r io.Reader, size int64, s Session) ([]byte, error) {
+	return Upload(ctx, name, &streamReaderAt{r: r}, size, s)
+}
+
+// streamReaderAt serves Upload's reads from a plain reader. Upload reads
+// forward from what the server committed, which never moves back, so
+// only the window from the last read offset on needs keeping.
+type streamReaderAt struct {
+	r    io.Reader
+	base int64
+	buf  []byte
+	err  error
+}
+
+func (s *streamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < s.base {
+		return 0, fmt.Errorf("cannot go back to byte %d of a stream already at %d", off, s.base)
+	}
+	if drop := off - s.base; drop > int64(len(s.buf)) {
+		if _, err := io.CopyN(io.Discard, s.r, drop-int64(len(s.buf))); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[:0]
+	} else {
+		s.buf = append(s.buf[:0], s.buf[drop:]...)
+	}
+	s.base = off
+	if need := len(p) - len(s.buf); need > 0 && s.err == nil {
+		n := len(s.buf)
+		s.buf = append(s.buf, make([]byte, need)...)
+		var read int
+		read, s.err = io.ReadFull(s.r, s.buf[n:])
+		s.buf = s.buf[:n+read]
+	}
+	n := copy(p, s.buf)
+	if n < len(p) {
+		// Upload only asks for bytes within the size, so running out is
+		// a stream shorter than promised
+		if s.err == nil || s.err == io.EOF {
+			return n, io.ErrUnexpectedEOF
+		}
+		return n, s.err
+	}
+	return n, nil
+}
+
+// Download describes a file to read.
+type Download struct {
+	Name string
+	// Size is -1 when not known
+	Size int64
+	// MD5 is the hex checksum the API reports, checked when the whole file
+	// is read from the start; empty skips the check
+	MD5 string
+	// Offset is where to start, to continue a partial copy
+	Offset int64
+	// Open starts reading at offset. Offsets past zero need a server that
+	// honors Range requests.
+	Open func(ctx context.Context, offset int64) (io.ReadCloser, error)
+}
+
+// Open starts the download. The returned reader picks up where it left
+// off when the connection drops, and fails with ErrChecksum at the end if
+// the content does not match d.MD5.
+func Open(ctx context.Context, d Download) (io.ReadCloser, error) {
+	body, err := d.Open(ctx, d.Offset)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{ctx: ctx, d: d, o: current(), body: body, offset: d.Offset}
+	if d.MD5 != "" && d.Offset == 0 {
+		r.hash = md5.New()
+	}
+	return r, nil
+}
+
+type reader struct {
+	ctx     context.Context
+	d       Download
+	o       Options
+	body    io.ReadCloser
+	offset  int64
+	attempt int
+	hash    hash.Hash
+}
+
+// readSize bounds each read so the bandwidth cap is smooth.
+const readSize = 64 << 10
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > readSize {
+		p = p[:readSize]
+	}
+	for {
+		n, err := r.body.Read(p)
+		if n > 0 {
+			r.attempt = 0
+			r.offset += int64(n)
+			if r.hash != nil {
+				r.hash.Write(p[:n])
+			}
+			report(r.ctx, Progress{Name: r.d.Name, Done: r.offset, Total: r.d.Size})
+			if werr := limit.wait(r.ctx, int64(n)); werr != nil {
+				return n, werr
+			}
+		}
+		if err == nil {
+			return n, nil
+		}
+		if err == io.EOF {
+			if r.d.Size < 0 || r.offset >= r.d.Size {
+				if r.hash != nil && !strings.EqualFold(hex.EncodeToString(r.hash.Sum(nil)), r.d.MD5) {
+					return n, fmt.Errorf("%s: %w", r.d.Name, ErrChecksum)
+				}
+				return n, io.EOF
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		if rerr := r.resume(err); rerr != nil {
+			return n, rerr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume reopens the download at the current offset after err.
+func (r *reader) resume(err error) error {
+	for {
+		if !retryable(r.ctx, err) || r.attempt >= r.o.Retries {
+			return err
+		}
+		r.attempt++
+		logger.DebugCF("transfer", "Resuming download", map[string]interface{}{
+			"name": r.d.Name, "offset": r.offset, "attempt": r.attempt, "error": err.Error(),
+		})
+		r.body.Close()
+		r.body = io.NopCloser(strings.NewReader(""))
+		if perr := pause(r.ctx, r.o, r.attempt); perr != nil {
+			return perr
+		}
+		var body io.ReadCloser
+		if body, err = r.d.Open(r.ctx, r.offset); err == nil {
+			r.body = body
+			return nil
+		}
+	}
+}
+
+func (r *reader) Close() error {
+	return r.body.Close()
+}
+
+// limiter spaces transfers out to a byte rate shared by all of them.
+type limiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+func (l *limiter) setRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate != bytesPerSecond {
+		l.rate = bytesPerSecond
+		l.next = time.Time{}
+	}
+}
+
+// wait blocks until n more bytes fit under the rate.
+func (l *limiter) wait(ctx context.Context, n int64) error {
+	l.mu.Lock()
+	if l.rate <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
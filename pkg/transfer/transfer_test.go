@@ -0,0 +1,191 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func fastRetries(t *testing.T) {
+	SetOptions(Options{ChunkSize: chunkGranularity, RetryDelay: time.Millisecond})
+	t.Cleanup(func() { SetOptions(Options{}) })
+}
+
+// memSession stores chunks in memory and fails the sends listed in failAt.
+type memSession struct {
+	data   []byte
+	sends  int
+	failAt map[int]error
+}
+
+func (s *memSession) Send(ctx context.Context, chunk []byte, offset, total int64, last bool) (int64, []byte, error) {
+	s.sends++
+	if err := s.failAt[s.sends]; err != nil {
+		return 0, nil, err
+	}
+	s.data = append(s.data[:offset], chunk...)
+	if last {
+		return total, []byte("done"), nil
+	}
+	return int64(len(s.data)), nil, nil
+}
+
+func (s *memSession) Query(ctx context.Context, total int64) (int64, []byte, error) {
+	return int64(len(s.data)), nil, nil
+}
+
+// TestUpload_ResumesFromCommittedOffset verifies a failed chunk is resent from what the server holds and progress ends at the total
+func TestUpload_ResumesFromCommittedOffset(t *testing.T) {
+	fastRetries(t)
+	data := bytes.Repeat([]byte("0123456789"), 60000)
+	s := &memSession{failAt: map[int]error{2: errors.New("connection reset")}}
+	var last Progress
+	ctx := WithProgress(context.Background(), func(p Progress) { last = p })
+
+	final, err := Upload(ctx, "video.mp4", bytes.NewReader(data), int64(len(data)), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(final) != "done" || !bytes.Equal(s.data, data) {
+		t.Fatalf("final %q, stored %d of %d bytes", final, len(s.data), len(data))
+	}
+	// Three chunks and one resend
+	if s.sends != 4 {
+		t.Errorf("sent %d chunks, want 4", s.sends)
+	}
+	if last.Done != int64(len(data)) || last.Total != int64(len(data)) || !last.Upload {
+		t.Errorf("last progress = %+v", last)
+	}
+
+	s = &memSession{failAt: map[int]error{1: &StatusError{Status: 403, Body: "forbidden"}}}
+	if _, err := Upload(context.Background(), "x", bytes.NewReader(data), int64(len(data)), s); err == nil || s.sends != 1 {
+		t.Errorf("a 403 should not be retried: err=%v sends=%d", err, s.sends)
+	}
+}
+
+// flakyBody fails at the end of r, as a dropped connection does.
+type flakyBody struct {
+	r io.Reader
+}
+
+func (b *flakyBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *flakyBody) Close() error { return nil }
+
+// TestOpen_ResumesAndVerifiesChecksum verifies a dropped download continues from its offset and a bad checksum is reported
+func TestOpen_ResumesAndVerifiesChecksum(t *testing.T) {
+	fastRetries(t)
+	data := bytes.Repeat([]byte("abcdefgh"), 20000)
+	sum := md5.Sum(data)
+	var offsets []int64
+	open := func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		offsets = append(offsets, offset)
+		if len(offsets) == 1 {
+			return &flakyBody{r: bytes.NewReader(data[:50000])}, nil
+		}
+		return io.NopCloser(bytes.NewReader(data[offset:])), nil
+	}
+	d := Download{Name: "a.bin", Size: int64(len(data)), MD5: hex.EncodeToString(sum[:]), Open: open}
+	r, err := Open(context.Background(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || len(offsets) != 2 || offsets[1] != 50000 {
+		t.Fatalf("read %d bytes, opens at %v", len(got), offsets)
+	}
+
+	offsets = nil
+	d.MD5 = "00000000000000000000000000000000"
+	r, _ = Open(context.Background(), d)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+}
+
+// halfSession commits only the first half of each chunk but the last, as
+// a server may.
+type halfSession struct {
+	memSession
+}
+
+func (s *halfSession) Send(ctx context.Context, chunk []byte, offset, total int64, last bool) (int64, []byte, error) {
+	if !last {
+		chunk = chunk[:len(chunk)/2]
+	}
+	return s.memSession.Send(ctx, chunk, offset, total, last)
+}
+
+// TestUploadStream_ResendsFromWindow verifies a read-once stream survives failed and partly committed chunks
+func TestUploadStream_ResendsFromWindow(t *testing.T) {
+	fastRetries(t)
+	data := bytes.Repeat([]byte("0123456789"), 60000)
+
+	s := &memSession{failAt: map[int]error{2: errors.New("connection reset")}}
+	final, err := UploadStream(context.Background(), "a.bin", struct{ io.Reader }{bytes.NewReader(data)}, int64(len(data)), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(final) != "done" || !bytes.Equal(s.data, data) {
+		t.Fatalf("final %q, stored %d of %d bytes", final, len(s.data), len(data))
+	}
+
+	h := &halfSession{}
+	if _, err := UploadStream(context.Background(), "a.bin", struct{ io.Reader }{bytes.NewReader(data)}, int64(len(data)), h); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.data, data) {
+		t.Errorf("stored %d of %d bytes, or out of order", len(h.data), len(data))
+	}
+
+	short := struct{ io.Reader }{bytes.NewReader(data[:1000])}
+	if _, err := UploadStream(context.Background(), "a.bin", short, int64(len(data)), &memSession{}); err == nil {
+		t.Error("expected an error for a stream shorter than its size")
+	}
+}
+
+// TestUpload_BackgroundWaitsForWindow verifies background uploads hold until a window opens while others go at once
+func TestUpload_BackgroundWaitsForWindow(t *testing.T) {
+	base := time.Date(2026, 5, 2, 6, 59, 59, 850*int(time.Millisecond), time.Local)
+	start := time.Now()
+	now = func() time.Time { return base.Add(time.Since(start)) }
+	SetOptions(Options{ChunkSize: chunkGranularity, Windows: []Window{
+		{Start: 23 * time.Hour, End: 6 * time.Hour},
+		{Start: 7 * time.Hour, End: 8 * time.Hour, MaxBytesPerSecond: 1 << 30},
+	}})
+	t.Cleanup(func() {
+		now = time.Now
+		SetOptions(Options{})
+	})
+	data := bytes.Repeat([]byte("x"), chunkGranularity)
+
+	if _, err := Upload(context.Background(), "now.jpg", bytes.NewReader(data), int64(len(data)), &memSession{}); err != nil || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("interactive upload waited %v: %v", time.Since(start), err)
+	}
+	if _, err := Upload(Background(context.Background()), "backup.jpg", bytes.NewReader(data), int64(len(data)), &memSession{}); err != nil {
+		t.Fatal(err)
+	}
+	if opened := now(); opened.Hour() != 7 {
+		t.Errorf("background upload ran at %s, before its window", opened.Format("15:04:05.000"))
+	}
+
+	// A window across midnight covers both sides of it
+	night := Window{Start: 23 * time.Hour, End: 7 * time.Hour}
+	if !night.contains(30*time.Minute) || !night.contains(23*time.Hour+time.Minute) || night.contains(12*time.Hour) {
+		t.Error("overnight window misplaced")
+	}
+}
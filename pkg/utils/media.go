@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/janitor"
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
@@ -53,6 +54,11 @@ type DownloadOptions struct {
 	LoggerPrefix string
 }
 
+// MediaDir is where DownloadFile saves files.
+func MediaDir() string {
+	return filepath.Join(os.TempDir(), "picoclaw_media")
+}
+
 // DownloadFile downloads a file from URL to a local temp directory.
 // Returns the local file path or empty string on error.
 func DownloadFile(url, filename string, opts DownloadOptions) string {
@@ -64,7 +70,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := MediaDir()
 	if err := os.MkdirAll(mediaDir, 0700); err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
 			"error": err.Error(),
@@ -109,6 +115,14 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		return ""
 	}
 
+	if err := janitor.Check(resp.ContentLength); err != nil {
+		logger.WarnCF(opts.LoggerPrefix, "File download refused", map[string]interface{}{
+			"error": err.Error(),
+			"url":   url,
+		})
+		return ""
+	}
+
 	out, err := os.Create(localPath)
 	if err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create local file", map[string]interface{}{
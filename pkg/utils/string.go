@@ -1,5 +1,7 @@
 package utils
 
+import "strings"
+
 // Truncate returns a truncated version of s with at most maxLen runes.
 // Handles multi-byte Unicode characters properly.
 // If the string is truncated, "..." is appended to indicate truncation.
@@ -14,3 +16,38 @@ func Truncate(s string, maxLen int) string {
 	}
 	return string(runes[:maxLen-3]) + "..."
 }
+
+// StripEmoji removes emoji, and the space after one that starts a line or
+// follows a space, so "⏰ Bills due" becomes "Bills due".
+func StripEmoji(s string) string {
+	var sb strings.Builder
+	dropped := false
+	for _, r := range s {
+		if isEmoji(r) {
+			dropped = true
+			continue
+		}
+		if dropped && r == ' ' {
+			out := sb.String()
+			if out == "" || strings.HasSuffix(out, "\n") || strings.HasSuffix(out, " ") {
+				dropped = false
+				continue
+			}
+		}
+		dropped = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF, // pictographs, emoticons, flags
+		r >= 0x2600 && r <= 0x27BF,            // symbols and dingbats
+		r >= 0x2300 && r <= 0x23FF,            // ⏰ ⌛ and friends
+		r >= 0x2B00 && r <= 0x2BFF,            // ⭐ ⬆
+		r == 0xFE0F, r == 0x200D, r == 0x20E3: // variation selector, joiner, keycap
+		return true
+	}
+	return false
+}
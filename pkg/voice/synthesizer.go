@@ -0,0 +1,134 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxSpeechInput is the input limit of the OpenAI speech endpoint.
+const maxSpeechInput = 4096
+
+// SpeechSynthesizer turns text into voice notes using an OpenAI-compatible
+// /audio/speech endpoint (the TTS counterpart of the Whisper API).
+type SpeechSynthesizer struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewSpeechSynthesizer(apiKey, apiBase, model, voice string) *SpeechSynthesizer {
+	logger.DebugCF("voice", "Creating speech synthesizer", map[string]interface{}{"has_api_key": apiKey != "", "model": model})
+
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "gpt-4o-mini-tts"
+	}
+	if voice == "" {
+		voice = "alloy"
+	}
+	return &SpeechSynthesizer{
+		apiKey:  apiKey,
+		apiBase: strings.TrimRight(apiBase, "/"),
+		model:   model,
+		voice:   voice,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Synthesize renders text as Ogg/Opus, the format messaging apps expect for
+// voice notes, and returns the path of a temporary file. The caller removes it.
+func (s *SpeechSynthesizer) Synthesize(ctx context.Context, text string) (string, error) {
+	text = speakable(text)
+	if text == "" {
+		return "", fmt.Errorf("nothing to synthesize")
+	}
+	if len(text) > maxSpeechInput {
+		return "", fmt.Errorf("text too long for speech (%d bytes, max %d)", len(text), maxSpeechInput)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"model":           s.model,
+		"voice":           s.voice,
+		"input":           text,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiBase+"/audio/speech", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		logger.ErrorCF("voice", "Speech API error", map[string]interface{}{
+			"status_code": resp.StatusCode,
+			"response":    string(body),
+		})
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	f, err := os.CreateTemp("", "picoclaw-voice-*.ogg")
+	if err != nil {
+		return "", fmt.Errorf("failed to create audio file: %w", err)
+	}
+	size, err := io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write audio file: %w", err)
+	}
+
+	logger.InfoCF("voice", "Speech synthesized", map[string]interface{}{
+		"text_length": len(text),
+		"audio_bytes": size,
+	})
+	return f.Name(), nil
+}
+
+var (
+	reCodeBlock = regexp.MustCompile("(?s)```.*?```")
+	reLink      = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
+	reMarkup    = regexp.MustCompile("(?m)^#{1,6}\\s+|^>\\s?|^[-*]\\s+|\\*\\*|__|~~|`")
+)
+
+// speakable strips Markdown that would otherwise be read out loud. Code
+// blocks are dropped entirely; they make no sense as speech.
+func speakable(text string) string {
+	text = reCodeBlock.ReplaceAllString(text, "")
+	text = reLink.ReplaceAllString(text, "$1")
+	text = reMarkup.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}
+
+func (s *SpeechSynthesizer) IsAvailable() bool {
+	return s.apiKey != ""
+}
@@ -0,0 +1,86 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSpeechSynthesizer_SendsSpeechRequest verifies the request carries the key, model, voice and speakable text and the audio lands in an Ogg file
+func TestSpeechSynthesizer_SendsSpeechRequest(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/audio/speech" || r.Header.Get("Authorization") != "Bearer k" ||
+			r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("OggS audio"))
+	}))
+	defer srv.Close()
+
+	s := NewSpeechSynthesizer("k", srv.URL+"/", "tts-1", "nova")
+	path, err := s.Synthesize(context.Background(), "## Hello\n\nSee **[the docs](https://x)**\n```\ncode\n```")
+	if err != nil {
+		t.Fatalf("Synthesize: %v", err)
+	}
+	defer os.Remove(path)
+
+	want := map[string]string{"model": "tts-1", "voice": "nova", "input": "Hello\n\nSee the docs", "response_format": "opus"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("request %s = %q, want %q", k, got[k], v)
+		}
+	}
+	if filepath.Ext(path) != ".ogg" {
+		t.Errorf("expected an .ogg file, got %s", path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "OggS audio" {
+		t.Errorf("audio file = %q", data)
+	}
+}
+
+// TestSpeechSynthesizer_ReportsAPIErrors verifies a non-2xx response is an error carrying the status and body, with no file left behind
+func TestSpeechSynthesizer_ReportsAPIErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "picoclaw-voice-*.ogg"))
+	path, err := NewSpeechSynthesizer("k", srv.URL, "", "").Synthesize(context.Background(), "hello")
+	if err == nil || path != "" {
+		t.Fatalf("expected an error, got path %q", path)
+	}
+	if !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("error should carry status and body: %v", err)
+	}
+	if after, _ := filepath.Glob(filepath.Join(os.TempDir(), "picoclaw-voice-*.ogg")); len(after) != len(before) {
+		t.Errorf("error left audio files behind: %v", after)
+	}
+}
+
+// TestSpeechSynthesizer_RejectsUnspeakableText verifies text that is empty once Markdown is stripped, or over the input limit, never reaches the API
+func TestSpeechSynthesizer_RejectsUnspeakableText(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	s := NewSpeechSynthesizer("k", srv.URL, "", "")
+	for _, text := range []string{"```\nonly code\n```", strings.Repeat("a", maxSpeechInput+1)} {
+		if _, err := s.Synthesize(context.Background(), text); err == nil {
+			t.Errorf("expected an error for %.20q", text)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("expected no API calls, got %d", calls)
+	}
+}
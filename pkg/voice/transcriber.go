@@ -20,6 +20,9 @@ type GroqTranscriber struct {
 	apiKey     string
 	apiBase    string
 	httpClient *http.Client
+	// localOnly, when set, names the chats whose audio must not leave
+	// the device
+	localOnly func(channel, chatID string) bool
 }
 
 type TranscriptionResponse struct {
@@ -157,3 +160,18 @@ func (t *GroqTranscriber) IsAvailable() bool {
 	logger.DebugCF("voice", "Checking transcriber availability", map[string]interface{}{"available": available})
 	return available
 }
+
+// SetLocalOnly sets which chats are local-only, so their voice notes are
+// not sent for transcription. Call it before the channels start.
+func (t *GroqTranscriber) SetLocalOnly(localOnly func(channel, chatID string) bool) {
+	t.localOnly = localOnly
+}
+
+// AvailableFor reports whether voice notes from chatID on channel may be
+// transcribed.
+func (t *GroqTranscriber) AvailableFor(channel, chatID string) bool {
+	if t.localOnly != nil && t.localOnly(channel, chatID) {
+		return false
+	}
+	return t.IsAvailable()
+}
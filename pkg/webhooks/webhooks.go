@@ -0,0 +1,239 @@
+// Package webhooks tells external systems what the agent is doing: each
+// event, such as a message answered or a backup finished, is posted as
+// signed JSON to the URLs configured for it, so flows in n8n, Home
+// Assistant or Zapier can react to it.
+//
+// Deliveries carry these headers:
+//
+//	X-Picoclaw-Event      the event type, e.g. "backup.finished"
+//	X-Picoclaw-Delivery   the event ID, the same on every retry
+//	X-Picoclaw-Timestamp  Unix seconds when the request was signed
+//	X-Picoclaw-Signature  "sha256=" + hex HMAC-SHA256 of
+//	                      "<timestamp>.<body>" keyed with the secret
+//
+// Receivers should recompute the signature and reject old timestamps.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Event types.
+const (
+	// MessageProcessed is sent when a chat message has been answered
+	MessageProcessed = "message.processed"
+	// ToolFailed is sent when a tool call ends in an error
+	ToolFailed = "tool.failed"
+	// ReminderFired is sent when a scheduled reminder or task goes off
+	ReminderFired = "reminder.fired"
+	// BackupFinished is sent when a backup run ends, failed or not
+	BackupFinished = "backup.finished"
+)
+
+// Types lists the event types, for validating configs.
+var Types = []string{MessageProcessed, ToolFailed, ReminderFired, BackupFinished}
+
+const (
+	// queueSize bounds the events waiting to be posted; more are dropped
+	queueSize = 100
+	// attempts is how many times a delivery is tried
+	attempts = 3
+)
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	ID   string                 `json:"id"`
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Endpoint is a URL events are posted to.
+type Endpoint struct {
+	URL string
+	// Secret signs the deliveries; empty sends them unsigned
+	Secret string
+	// Events limits the types posted; empty posts every type
+	Events []string
+}
+
+func (e Endpoint) wants(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher queues events and posts them, one at a time, retrying
+// failed deliveries with a growing pause. Emit never blocks the agent.
+type Dispatcher struct {
+	client     *http.Client
+	retryDelay time.Duration
+	queue      chan Event
+
+	mu        sync.RWMutex
+	endpoints []Endpoint
+}
+
+// New creates a dispatcher posting to endpoints; Run starts the posting.
+func New(endpoints []Endpoint) *Dispatcher {
+	return &Dispatcher{
+		client:     &http.Client{Timeout: 15 * time.Second},
+		retryDelay: 2 * time.Second,
+		queue:      make(chan Event, queueSize),
+		endpoints:  endpoints,
+	}
+}
+
+// SetEndpoints replaces the endpoints events are posted to from now on.
+func (d *Dispatcher) SetEndpoints(endpoints []Endpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endpoints = endpoints
+}
+
+// Emit queues an event for the endpoints that want its type.
+func (d *Dispatcher) Emit(eventType string, data map[string]interface{}) {
+	if d == nil {
+		return
+	}
+	d.mu.RLock()
+	wanted := false
+	for _, e := range d.endpoints {
+		wanted = wanted || e.wants(eventType)
+	}
+	d.mu.RUnlock()
+	if !wanted {
+		return
+	}
+	event := Event{ID: newID(), Type: eventType, Time: time.Now().UTC(), Data: data}
+	select {
+	case d.queue <- event:
+	default:
+		logger.WarnCF("webhooks", "Webhook queue full, event dropped", map[string]interface{}{"type": eventType})
+	}
+}
+
+// Run posts queued events until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.queue:
+			d.deliver(ctx, event)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.WarnCF("webhooks", "Event not encodable", map[string]interface{}{"type": event.Type, "error": err.Error()})
+		return
+	}
+	d.mu.RLock()
+	endpoints := d.endpoints
+	d.mu.RUnlock()
+	for _, e := range endpoints {
+		if !e.wants(event.Type) {
+			continue
+		}
+		var err error
+		for attempt := 1; attempt <= attempts; attempt++ {
+			var retry bool
+			if retry, err = d.post(ctx, e, event, body); err == nil || !retry {
+				break
+			}
+			if attempt < attempts {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(d.retryDelay << (attempt - 1)):
+				}
+			}
+		}
+		if err != nil {
+			logger.WarnCF("webhooks", "Webhook delivery failed", map[string]interface{}{
+				"url": e.URL, "type": event.Type, "error": err.Error(),
+			})
+		}
+	}
+}
+
+// post sends one delivery and reports whether a failure is worth retrying.
+func (d *Dispatcher) post(ctx context.Context, e Endpoint, event Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "picoclaw-webhooks")
+	req.Header.Set("X-Picoclaw-Event", event.Type)
+	req.Header.Set("X-Picoclaw-Delivery", event.ID)
+	req.Header.Set("X-Picoclaw-Timestamp", strconv.FormatInt(timestamp, 10))
+	if e.Secret != "" {
+		req.Header.Set("X-Picoclaw-Signature", Sign(e.Secret, timestamp, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(text)))
+}
+
+// Sign returns the X-Picoclaw-Signature of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var current atomic.Pointer[Dispatcher]
+
+// SetDefault makes d the dispatcher Emit posts through; nil turns
+// webhooks off.
+func SetDefault(d *Dispatcher) {
+	current.Store(d)
+}
+
+// Emit queues an event on the default dispatcher, if there is one. It is
+// what the agent, tools and scheduler call.
+func Emit(eventType string, data map[string]interface{}) {
+	current.Load().Emit(eventType, data)
+}
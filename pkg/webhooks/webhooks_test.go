@@ -0,0 +1,62 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDispatcher_PostsSignedEventsAndRetries verifies deliveries are signed, filtered by type and retried after a server error
+func TestDispatcher_PostsSignedEventsAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	calls := 0
+	done := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Picoclaw-Timestamp"), 10, 64)
+		if r.Header.Get("X-Picoclaw-Signature") != Sign("s3cret", timestamp, body) {
+			t.Errorf("bad signature %q", r.Header.Get("X-Picoclaw-Signature"))
+		}
+		var event Event
+		json.Unmarshal(body, &event)
+		if r.Header.Get("X-Picoclaw-Event") != event.Type || r.Header.Get("X-Picoclaw-Delivery") != event.ID {
+			t.Errorf("headers do not match event %+v", event)
+		}
+		received = append(received, event)
+		done <- struct{}{}
+	}))
+	defer server.Close()
+
+	d := New([]Endpoint{{URL: server.URL, Secret: "s3cret", Events: []string{BackupFinished}}})
+	d.retryDelay = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.Emit(ToolFailed, map[string]interface{}{"tool": "exec"})
+	d.Emit(BackupFinished, map[string]interface{}{"name": "photos"})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 || len(received) != 1 || received[0].Type != BackupFinished || received[0].Data["name"] != "photos" {
+		t.Errorf("calls %d, received %+v", calls, received)
+	}
+}
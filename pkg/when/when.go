@@ -0,0 +1,610 @@
+// Package when reads dates and times the way people write them in chat
+// ("next Tuesday at 3", "tomorrow evening", "in 2 hours", "5 March"), in
+// the user's timezone. Tools accept these wherever they take a time, so
+// the model does not have to do calendar arithmetic to produce RFC 3339.
+//
+// Only English is understood. Numeric dates such as 3/5 are read
+// month-first for US-style locales and day-first otherwise.
+package when
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/locale"
+)
+
+// Result is a parsed point in time.
+type Result struct {
+	// Time is in the location of the reference time. For a day without a
+	// time of day it is midnight.
+	Time time.Time
+	// HasTime is false when only a day was given ("Friday", "5 March")
+	HasTime bool
+}
+
+// Parse reads s relative to now, in now's location. Incomplete times lean
+// to the future, as wanted for scheduling: "Friday" is the coming one and
+// "9am" is tomorrow once 9am has passed. Besides the phrases above it
+// accepts RFC 3339, "2006-01-02" and "2006-01-02 15:04".
+func Parse(s string, now time.Time, locale string) (Result, error) {
+	return parse(s, now, locale, false)
+}
+
+// Range reads a span: "today", "last week", "this month", "past 3 days",
+// "March" or "March 2026", or a single day, which spans that day. Times
+// without a year lean to the past, as wanted for searches. to is
+// exclusive.
+func Range(s string, now time.Time, locale string) (from, to time.Time, err error) {
+	loc := now.Location()
+	today := midnight(now)
+	words := tokenize(s)
+	if len(words) == 2 || len(words) == 3 {
+		unit := words[len(words)-1]
+		switch words[0] {
+		case "this", "last", "next", "past":
+			n := 1
+			if len(words) == 3 {
+				if n, err = strconv.Atoi(words[1]); err != nil || n <= 0 || words[0] == "this" {
+					break
+				}
+			}
+			unit = strings.TrimSuffix(unit, "s")
+			if words[0] == "past" || words[0] == "last" && len(words) == 3 {
+				// A rolling window up to now: "past 3 days", "last 2 weeks"
+				switch unit {
+				case "hour":
+					return now.Add(-time.Duration(n) * time.Hour), now, nil
+				case "day":
+					return today.AddDate(0, 0, -n), now, nil
+				case "week":
+					return today.AddDate(0, 0, -7*n), now, nil
+				case "month":
+					return today.AddDate(0, -n, 0), now, nil
+				case "year":
+					return today.AddDate(-n, 0, 0), now, nil
+				}
+				break
+			}
+			shift := map[string]int{"this": 0, "last": -1, "next": 1}[words[0]]
+			switch unit {
+			case "week":
+				monday := today.AddDate(0, 0, -((int(today.Weekday())+6)%7)+7*shift)
+				return monday, monday.AddDate(0, 0, 7), nil
+			case "month":
+				first := time.Date(today.Year(), today.Month()+time.Month(shift), 1, 0, 0, 0, 0, loc)
+				return first, first.AddDate(0, 1, 0), nil
+			case "year":
+				first := time.Date(today.Year()+shift, 1, 1, 0, 0, 0, 0, loc)
+				return first, first.AddDate(1, 0, 0), nil
+			}
+		}
+	}
+	// A month on its own, with or without a year
+	if m, ok := months[words0(words)]; ok && len(words) <= 2 {
+		year, used := readYear(words[1:])
+		if used == len(words)-1 {
+			if used == 0 {
+				year = today.Year()
+				if m > today.Month() {
+					year--
+				}
+			}
+			first := time.Date(year, m, 1, 0, 0, 0, 0, loc)
+			return first, first.AddDate(0, 1, 0), nil
+		}
+	}
+	r, err := parse(s, now, locale, true)
+	if err != nil {
+		return from, to, err
+	}
+	if !r.HasTime {
+		return r.Time, r.Time.AddDate(0, 0, 1), nil
+	}
+	return r.Time, r.Time, nil
+}
+
+func words0(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	return words[0]
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+// Parts of the day, and the hour each stands for on its own
+var dayParts = map[string]int{
+	"morning": 9, "noon": 12, "midday": 12, "afternoon": 15, "evening": 19, "tonight": 20, "night": 20, "midnight": 0,
+}
+
+// filler words that carry no meaning here
+var filler = map[string]bool{
+	"at": true, "on": true, "the": true, "of": true, "by": true, "around": true, "about": true,
+}
+
+// tokenize lowercases s and splits it into words, dropping punctuation
+// that does not belong to a date or time.
+func tokenize(s string) []string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer(",", " ", "a.m.", "am", "p.m.", "pm", "o'clock", "", "'s", "").Replace(s)
+	s = strings.TrimSuffix(s, ".")
+	return strings.Fields(s)
+}
+
+// state collects what the words said.
+type state struct {
+	date      time.Time // the day, when one was named
+	hasDate   bool
+	hour      int
+	minute    int
+	hasTime   bool
+	meridiem  string // "am", "pm" or ""
+	dayPart   string // "morning", "evening" ... when named
+	offset    time.Duration
+	hasOffset bool
+}
+
+func parse(s string, now time.Time, locale string, preferPast bool) (Result, error) {
+	loc := now.Location()
+	raw := strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return Result{Time: t.In(loc), HasTime: true}, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return Result{Time: t, HasTime: true}, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, loc); err == nil {
+		return Result{Time: t}, nil
+	}
+
+	words := tokenize(s)
+	if len(words) == 0 {
+		return Result{}, fmt.Errorf("no date or time given")
+	}
+	fail := func() (Result, error) {
+		return Result{}, fmt.Errorf("cannot read %q as a date or time; try \"tomorrow at 15:00\", \"next Tuesday at 3pm\", \"in 2 hours\" or 2006-01-02 15:04", raw)
+	}
+	today := midnight(now)
+	var st state
+	setDate := func(d time.Time) bool {
+		if st.hasDate {
+			return false
+		}
+		st.date, st.hasDate = d, true
+		return true
+	}
+
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		next := ""
+		if i+1 < len(words) {
+			next = words[i+1]
+		}
+		switch {
+		case filler[w]:
+		case w == "now":
+			st.offset, st.hasOffset = 0, true
+		case w == "today":
+			if !setDate(today) {
+				return fail()
+			}
+		case w == "tomorrow":
+			if !setDate(today.AddDate(0, 0, 1)) {
+				return fail()
+			}
+		case w == "yesterday":
+			if !setDate(today.AddDate(0, 0, -1)) {
+				return fail()
+			}
+		case w == "day" && next == "after" && i+2 < len(words) && words[i+2] == "tomorrow":
+			if !setDate(today.AddDate(0, 0, 2)) {
+				return fail()
+			}
+			i += 2
+		case w == "in" || w == "within":
+			// "in 2 hours", "in an hour", "in half an hour"; "in the
+			// morning" is a part of the day
+			if next == "the" {
+				continue
+			}
+			d, used, ok := readDuration(words[i+1:])
+			if !ok {
+				return fail()
+			}
+			st.offset, st.hasOffset = st.offset+d, true
+			i += used
+		case w == "next" || w == "this" || w == "last" || w == "coming":
+			if next == "" {
+				return fail()
+			}
+			i++
+			if wd, ok := weekdays[next]; ok {
+				if !setDate(weekdayFrom(today, wd, w)) {
+					return fail()
+				}
+				continue
+			}
+			if _, ok := dayParts[next]; ok && w == "this" {
+				st.dayPart = next
+				continue
+			}
+			shift := map[string]int{"next": 1, "this": 0, "coming": 1, "last": -1}[w]
+			var d time.Time
+			switch strings.TrimSuffix(next, "s") {
+			case "week":
+				d = today.AddDate(0, 0, -((int(today.Weekday())+6)%7)+7*shift)
+				if shift == 0 {
+					d = today
+				}
+			case "month":
+				d = time.Date(today.Year(), today.Month()+time.Month(shift), 1, 0, 0, 0, 0, loc)
+				if shift == 0 {
+					d = today
+				}
+			case "year":
+				d = time.Date(today.Year()+shift, 1, 1, 0, 0, 0, 0, loc)
+			default:
+				return fail()
+			}
+			if !setDate(d) {
+				return fail()
+			}
+		default:
+			if wd, ok := weekdays[w]; ok {
+				qualifier := ""
+				if preferPast {
+					qualifier = "last"
+				}
+				if !setDate(weekdayFrom(today, wd, qualifier)) {
+					return fail()
+				}
+				continue
+			}
+			if _, ok := dayParts[w]; ok {
+				st.dayPart = w
+				continue
+			}
+			if w == "am" || w == "pm" {
+				if !st.hasTime || st.meridiem != "" {
+					return fail()
+				}
+				st.meridiem = w
+				continue
+			}
+			if m, ok := months[w]; ok {
+				// "March 5", "March 5th 2027"
+				day, used := readDayOfMonth(words[i+1:])
+				if used == 0 {
+					return fail()
+				}
+				i += used
+				year, used := readYear(words[i+1:])
+				i += used
+				d, ok := monthDay(today, year, m, day, preferPast)
+				if !ok || !setDate(d) {
+					return fail()
+				}
+				continue
+			}
+			if day, used := readDayOfMonth(words[i:]); used > 0 && i+used < len(words) {
+				// "5 March", "5th of March 2027"
+				j := i + used
+				if words[j] == "of" && j+1 < len(words) {
+					j++
+				}
+				if m, ok := months[words[j]]; ok {
+					i = j
+					year, used := readYear(words[i+1:])
+					i += used
+					d, ok := monthDay(today, year, m, day, preferPast)
+					if !ok || !setDate(d) {
+						return fail()
+					}
+					continue
+				}
+			}
+			if d, ok := numericDate(w, today, locale, preferPast); ok {
+				if !setDate(d) {
+					return fail()
+				}
+				continue
+			}
+			if d, used, ok := readDuration(words[i:]); ok && i+used < len(words) && words[i+used] == "ago" {
+				st.offset, st.hasOffset = st.offset-d, true
+				i += used
+				continue
+			} else if ok && i+used+1 < len(words) && words[i+used] == "from" && words[i+used+1] == "now" {
+				st.offset, st.hasOffset = st.offset+d, true
+				i += used + 1
+				continue
+			}
+			h, m, mer, ok := readClock(w)
+			if !ok || st.hasTime {
+				return fail()
+			}
+			st.hour, st.minute, st.meridiem, st.hasTime = h, m, mer, true
+		}
+	}
+	return st.resolve(now, today, preferPast)
+}
+
+// resolve turns what was said into a time.
+func (st state) resolve(now, today time.Time, preferPast bool) (Result, error) {
+	if !st.hasTime && st.dayPart != "" {
+		st.hour, st.hasTime = dayParts[st.dayPart], true
+	}
+	if st.hasTime {
+		h := st.hour
+		switch {
+		case st.meridiem == "pm" && h < 12:
+			h += 12
+		case st.meridiem == "am" && h == 12:
+			h = 0
+		case st.meridiem == "" && h < 12 && (st.dayPart == "afternoon" || st.dayPart == "evening" || st.dayPart == "night" || st.dayPart == "tonight"):
+			h += 12
+		case st.meridiem == "" && st.dayPart == "" && h >= 1 && h <= 6:
+			// Nobody means "at 3" as three in the morning
+			h += 12
+		}
+		st.hour = h
+	}
+
+	if st.hasOffset {
+		if st.hasDate || st.hasTime {
+			// "in 3 days at 9", "tomorrow in an hour" makes no sense
+			if st.offset%(24*time.Hour) != 0 || st.hasDate {
+				return Result{}, fmt.Errorf("cannot combine a relative time with a date")
+			}
+			st.date, st.hasDate = today.AddDate(0, 0, int(st.offset/(24*time.Hour))), true
+		} else {
+			t := now.Add(st.offset)
+			// Whole days ("in 3 days") name a day rather than an instant
+			if st.offset != 0 && st.offset%(24*time.Hour) == 0 {
+				return Result{Time: midnight(t)}, nil
+			}
+			return Result{Time: t.Truncate(time.Second), HasTime: true}, nil
+		}
+	}
+
+	if !st.hasTime {
+		if !st.hasDate {
+			return Result{}, fmt.Errorf("no date or time given")
+		}
+		return Result{Time: st.date}, nil
+	}
+	day := st.date
+	if !st.hasDate {
+		day = today
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), st.hour, st.minute, 0, 0, now.Location())
+	if !st.hasDate && !preferPast && !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return Result{Time: t, HasTime: true}, nil
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// weekdayFrom finds wd from today: the coming one (never today itself),
+// the one this week for "this", or the one before today for "last".
+func weekdayFrom(today time.Time, wd time.Weekday, qualifier string) time.Time {
+	diff := (int(wd) - int(today.Weekday()) + 7) % 7
+	switch qualifier {
+	case "this":
+		// Monday-based week: "this Sunday" is the end of this week. Once
+		// the day has gone, the next one is meant.
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		d := monday.AddDate(0, 0, (int(wd)+6)%7)
+		if d.Before(today) {
+			d = d.AddDate(0, 0, 7)
+		}
+		return d
+	case "last":
+		back := (int(today.Weekday()) - int(wd) + 7) % 7
+		if back == 0 {
+			back = 7
+		}
+		return today.AddDate(0, 0, -back)
+	}
+	if diff == 0 {
+		diff = 7
+	}
+	return today.AddDate(0, 0, diff)
+}
+
+// readDuration reads "2 hours", "an hour", "half an hour", "90 min",
+// "1h30m" from the start of words, returning how many words it used.
+func readDuration(words []string) (time.Duration, int, bool) {
+	if len(words) == 0 {
+		return 0, 0, false
+	}
+	if d, err := time.ParseDuration(words[0]); err == nil && d > 0 {
+		return d, 1, true
+	}
+	if words[0] == "half" && len(words) >= 3 && (words[1] == "an" || words[1] == "a") && strings.HasPrefix(words[2], "hour") {
+		return 30 * time.Minute, 3, true
+	}
+	if len(words) < 2 {
+		return 0, 0, false
+	}
+	var n float64
+	switch words[0] {
+	case "a", "an", "one":
+		n = 1
+	default:
+		v, err := strconv.ParseFloat(words[0], 64)
+		if err != nil || v <= 0 {
+			if v, ok := numberWords[words[0]]; ok {
+				n = float64(v)
+				break
+			}
+			return 0, 0, false
+		}
+		n = v
+	}
+	var unit time.Duration
+	switch strings.TrimSuffix(words[1], "s") {
+	case "second", "sec":
+		unit = time.Second
+	case "minute", "min", "mn":
+		unit = time.Minute
+	case "hour", "hr", "h":
+		unit = time.Hour
+	case "day":
+		unit = 24 * time.Hour
+	case "week", "wk":
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, 0, false
+	}
+	return time.Duration(n * float64(unit)), 2, true
+}
+
+var numberWords = map[string]int{
+	"two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+	"eleven": 11, "twelve": 12, "fifteen": 15, "twenty": 20, "thirty": 30, "forty": 40, "forty-five": 45,
+}
+
+// readDayOfMonth reads "5", "5th", "21st" from the start of words.
+func readDayOfMonth(words []string) (int, int) {
+	if len(words) == 0 {
+		return 0, 0
+	}
+	w := words[0]
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		w = strings.TrimSuffix(w, suffix)
+	}
+	n, err := strconv.Atoi(w)
+	if err != nil || n < 1 || n > 31 {
+		return 0, 0
+	}
+	return n, 1
+}
+
+// readYear reads a four-digit year from the start of words.
+func readYear(words []string) (int, int) {
+	if len(words) == 0 || len(words[0]) != 4 {
+		return 0, 0
+	}
+	y, err := strconv.Atoi(words[0])
+	if err != nil {
+		return 0, 0
+	}
+	return y, 1
+}
+
+// monthDay builds the date; without a year it is the next one to come,
+// or with preferPast the last one gone.
+func monthDay(today time.Time, year int, m time.Month, day int, preferPast bool) (time.Time, bool) {
+	y := year
+	if y == 0 {
+		y = today.Year()
+	}
+	d := time.Date(y, m, day, 0, 0, 0, 0, today.Location())
+	if d.Day() != day {
+		return d, false // 31 April
+	}
+	if year == 0 {
+		if !preferPast && d.Before(today) {
+			d = d.AddDate(1, 0, 0)
+		} else if preferPast && d.After(today) {
+			d = d.AddDate(-1, 0, 0)
+		}
+	}
+	return d, true
+}
+
+// numericDate reads "5/3", "5/3/2027", "5.3.27" and "2027/03/05".
+func numericDate(w string, today time.Time, tag string, preferPast bool) (time.Time, bool) {
+	parts := strings.FieldsFunc(w, func(r rune) bool { return r == '/' || r == '.' || r == '-' })
+	if len(parts) < 2 || len(parts) > 3 {
+		return time.Time{}, false
+	}
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return time.Time{}, false
+		}
+		nums[i] = n
+	}
+	if len(parts[0]) == 4 && len(nums) == 3 {
+		d := time.Date(nums[0], time.Month(nums[1]), nums[2], 0, 0, 0, 0, today.Location())
+		return d, d.Day() == nums[2] && int(d.Month()) == nums[1]
+	}
+	day, month := nums[0], nums[1]
+	if locale.MonthFirst(tag) {
+		day, month = month, day
+	}
+	if month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	year := 0
+	if len(nums) == 3 {
+		year = nums[2]
+		if year < 100 {
+			year += 2000
+		}
+	}
+	return monthDay(today, year, time.Month(month), day, preferPast)
+}
+
+// readClock reads a time of day: "3", "3pm", "15:30", "3:30pm", "1530h".
+func readClock(w string) (hour, minute int, meridiem string, ok bool) {
+	for _, m := range []string{"am", "pm"} {
+		if strings.HasSuffix(w, m) {
+			meridiem = m
+			w = strings.TrimSuffix(w, m)
+			break
+		}
+	}
+	military := strings.HasSuffix(w, "h")
+	w = strings.TrimSuffix(w, "h")
+	hs, ms, hasColon := strings.Cut(strings.ReplaceAll(w, ".", ":"), ":")
+	if !hasColon && military && len(hs) == 4 {
+		hs, ms = hs[:2], hs[2:]
+	}
+	h, err := strconv.Atoi(hs)
+	if err != nil || h < 0 || h > 23 {
+		return 0, 0, "", false
+	}
+	if ms != "" {
+		if minute, err = strconv.Atoi(ms); err != nil || minute < 0 || minute > 59 || len(ms) != 2 {
+			return 0, 0, "", false
+		}
+	}
+	if meridiem != "" && (h < 1 || h > 12) {
+		return 0, 0, "", false
+	}
+	return h, minute, meridiem, true
+}
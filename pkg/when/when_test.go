@@ -0,0 +1,105 @@
+package when
+
+import (
+	"testing"
+	"time"
+)
+
+// Wednesday 6 May 2026, 10:15 in São Paulo
+var now = time.Date(2026, 5, 6, 10, 15, 0, 0, time.FixedZone("BRT", -3*3600))
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 5, day, hour, minute, 0, 0, now.Location())
+}
+
+// TestParse_Phrases verifies common chat phrasings resolve to the intended time in the reference location
+func TestParse_Phrases(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    time.Time
+		hasTime bool
+	}{
+		{"next Tuesday at 3", at(12, 15, 0), true},
+		{"tuesday 3pm", at(12, 15, 0), true},
+		{"tomorrow at 9", at(7, 9, 0), true},
+		{"tomorrow morning", at(7, 9, 0), true},
+		{"tonight at 8", at(6, 20, 0), true},
+		{"this evening", at(6, 19, 0), true},
+		{"at 9am", at(7, 9, 0), true},
+		{"11:30", at(6, 11, 30), true},
+		{"3:30 p.m.", at(6, 15, 30), true},
+		{"noon", at(6, 12, 0), true},
+		{"in 2 hours", at(6, 12, 15), true},
+		{"in half an hour", at(6, 10, 45), true},
+		{"20 minutes from now", at(6, 10, 35), true},
+		{"in 3 days", at(9, 0, 0), false},
+		{"Friday", at(8, 0, 0), false},
+		{"wednesday", at(13, 0, 0), false},
+		{"this Sunday", at(10, 0, 0), false},
+		{"day after tomorrow at 7:45", at(8, 7, 45), true},
+		{"May 20th", at(20, 0, 0), false},
+		{"20 May at 18:00", at(20, 18, 0), true},
+		{"5th of June 2026", time.Date(2026, 6, 5, 0, 0, 0, 0, now.Location()), false},
+		{"March 1", time.Date(2027, 3, 1, 0, 0, 0, 0, now.Location()), false},
+		{"12/5", at(12, 0, 0), false},
+		{"next week", at(11, 0, 0), false},
+		{"next month", time.Date(2026, 6, 1, 0, 0, 0, 0, now.Location()), false},
+		{"2026-05-30", at(30, 0, 0), false},
+		{"2026-05-30 14:00", at(30, 14, 0), true},
+		{"2026-05-30T14:00:00Z", at(30, 11, 0), true},
+	}
+	for _, c := range cases {
+		got, err := Parse(c.in, now, "pt-BR")
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if !got.Time.Equal(c.want) || got.HasTime != c.hasTime {
+			t.Errorf("%q = %s (time %v), want %s (time %v)", c.in, got.Time, got.HasTime, c.want, c.hasTime)
+		}
+	}
+}
+
+// TestParse_LocaleAndErrors verifies numeric dates follow the locale and nonsense is refused rather than guessed
+func TestParse_LocaleAndErrors(t *testing.T) {
+	if got, _ := Parse("6/12", now, "en-US"); !got.Time.Equal(time.Date(2026, 6, 12, 0, 0, 0, 0, now.Location())) {
+		t.Errorf("en-US 6/12 = %s", got.Time)
+	}
+	if got, _ := Parse("6/12", now, "en-GB"); !got.Time.Equal(time.Date(2026, 12, 6, 0, 0, 0, 0, now.Location())) {
+		t.Errorf("en-GB 6/12 = %s", got.Time)
+	}
+	for _, bad := range []string{"", "soonish", "tomorrow yesterday", "31 April", "25:00", "at 3 banana", "tomorrow in 2 hours"} {
+		if got, err := Parse(bad, now, ""); err == nil {
+			t.Errorf("%q parsed as %s", bad, got.Time)
+		}
+	}
+}
+
+// TestRange_Spans verifies spans lean to the past and end exclusively
+func TestRange_Spans(t *testing.T) {
+	cases := []struct {
+		in       string
+		from, to time.Time
+	}{
+		{"today", at(6, 0, 0), at(7, 0, 0)},
+		{"yesterday", at(5, 0, 0), at(6, 0, 0)},
+		{"last week", time.Date(2026, 4, 27, 0, 0, 0, 0, now.Location()), at(4, 0, 0)},
+		{"this month", at(1, 0, 0), time.Date(2026, 6, 1, 0, 0, 0, 0, now.Location())},
+		{"past 3 days", at(3, 0, 0), now},
+		{"last 2 weeks", time.Date(2026, 4, 22, 0, 0, 0, 0, now.Location()), now},
+		{"december", time.Date(2025, 12, 1, 0, 0, 0, 0, now.Location()), time.Date(2026, 1, 1, 0, 0, 0, 0, now.Location())},
+		{"March 2026", time.Date(2026, 3, 1, 0, 0, 0, 0, now.Location()), time.Date(2026, 4, 1, 0, 0, 0, 0, now.Location())},
+		{"friday", at(1, 0, 0), at(2, 0, 0)},
+		{"June 3", time.Date(2025, 6, 3, 0, 0, 0, 0, now.Location()), time.Date(2025, 6, 4, 0, 0, 0, 0, now.Location())},
+	}
+	for _, c := range cases {
+		from, to, err := Range(c.in, now, "")
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if !from.Equal(c.from) || !to.Equal(c.to) {
+			t.Errorf("%q = %s – %s, want %s – %s", c.in, from, to, c.from, c.to)
+		}
+	}
+}